@@ -87,7 +87,7 @@ func main() {
 		}
 	}
 
-	gw, err := gateway.New(cfg, *configPath, log)
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithConfigPath(*configPath), gateway.WithLogger(log))
 	if err != nil {
 		log.Fatalf("Failed to initialize gateway: %v", err)
 	}
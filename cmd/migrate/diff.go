@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"odin/pkg/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// storedFields are the service settings the MongoDB adapter persists.
+// Anything else in the YAML sources is lost on migration and reported
+// separately instead of as a removal.
+var storedFields = map[string]bool{
+	"name":           true,
+	"namespace":      true,
+	"basePath":       true,
+	"targets":        true,
+	"stripBasePath":  true,
+	"timeout":        true,
+	"retryCount":     true,
+	"retryDelay":     true,
+	"authentication": true,
+	"loadBalancing":  true,
+	"headers":        true,
+	"protocol":       true,
+	"transform":      true,
+	"aggregation":    true,
+	"healthCheck":    true,
+}
+
+// fieldChange is one differing setting, keyed by its dotted path
+type fieldChange struct {
+	path          string
+	before, after string
+	added         bool
+	removed       bool
+}
+
+// printServiceDiff compares the services about to be migrated with those
+// already in MongoDB and prints what migrating with --force would change
+func printServiceDiff(w io.Writer, sources, current []config.ServiceConfig) {
+	existing := make(map[string]config.ServiceConfig, len(current))
+	for _, svc := range current {
+		existing[svc.Name] = svc
+	}
+
+	sorted := append([]config.ServiceConfig(nil), sources...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var added, changed, unchanged, untouched int
+	seen := make(map[string]bool, len(sorted))
+	for _, svc := range sorted {
+		seen[svc.Name] = true
+		svc.SetDefaults()
+		desired, skipped := flattenService(svc, true)
+
+		old, ok := existing[svc.Name]
+		if !ok {
+			added++
+			fmt.Fprintf(w, "+ %s (new)\n", svc.Name)
+			printSkipped(w, skipped)
+			continue
+		}
+
+		old.SetDefaults()
+		stored, _ := flattenService(old, false)
+		changes := diffFields(stored, desired)
+		if len(changes) == 0 {
+			unchanged++
+			fmt.Fprintf(w, "= %s\n", svc.Name)
+			printSkipped(w, skipped)
+			continue
+		}
+
+		changed++
+		fmt.Fprintf(w, "~ %s\n", svc.Name)
+		for _, c := range changes {
+			switch {
+			case c.added:
+				fmt.Fprintf(w, "    + %s: %s\n", c.path, c.after)
+			case c.removed:
+				fmt.Fprintf(w, "    - %s: %s\n", c.path, c.before)
+			default:
+				fmt.Fprintf(w, "    ~ %s: %s -> %s\n", c.path, c.before, c.after)
+			}
+		}
+		printSkipped(w, skipped)
+	}
+
+	names := make([]string, 0, len(existing))
+	for name := range existing {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		untouched++
+		fmt.Fprintf(w, "  %s (only in MongoDB, left untouched)\n", name)
+	}
+
+	fmt.Fprintf(w, "\n%d new, %d changed, %d unchanged, %d only in MongoDB\n", added, changed, unchanged, untouched)
+}
+
+func printSkipped(w io.Writer, skipped []string) {
+	if len(skipped) > 0 {
+		fmt.Fprintf(w, "    ! not stored in MongoDB: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+// flattenService renders a service as dotted paths to scalar values, e.g.
+// targets[0] or healthCheck.interval. Settings MongoDB does not store are
+// left out; with reportSkipped their top-level keys are returned.
+func flattenService(svc config.ServiceConfig, reportSkipped bool) (map[string]string, []string) {
+	fields := make(map[string]string)
+	var skipped []string
+
+	data, err := yaml.Marshal(svc)
+	if err != nil {
+		return fields, nil
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fields, nil
+	}
+
+	for key, value := range doc {
+		if !storedFields[key] {
+			// Settings left empty are not lost
+			lost := make(map[string]string)
+			flatten(lost, key, value)
+			if reportSkipped && len(lost) > 0 {
+				skipped = append(skipped, key)
+			}
+			continue
+		}
+		flatten(fields, key, value)
+	}
+	sort.Strings(skipped)
+	return fields, skipped
+}
+
+func flatten(fields map[string]string, path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flatten(fields, path+"."+key, child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fields, fmt.Sprintf("%s[%d]", path, i), child)
+		}
+	case nil:
+		// Empty settings are the same as absent ones
+	default:
+		text := fmt.Sprint(v)
+		if text == "" {
+			return
+		}
+		fields[path] = text
+	}
+}
+
+func diffFields(stored, desired map[string]string) []fieldChange {
+	var changes []fieldChange
+	for path, value := range desired {
+		prev, ok := stored[path]
+		switch {
+		case !ok:
+			changes = append(changes, fieldChange{path: path, after: value, added: true})
+		case prev != value:
+			changes = append(changes, fieldChange{path: path, before: prev, after: value})
+		}
+	}
+	for path, value := range stored {
+		if _, ok := desired[path]; !ok {
+			changes = append(changes, fieldChange{path: path, before: value, removed: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	return changes
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintServiceDiff(t *testing.T) {
+	users := config.ServiceConfig{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081"}}
+
+	tests := []struct {
+		name    string
+		sources []config.ServiceConfig
+		current []config.ServiceConfig
+		want    string
+	}{
+		{
+			name:    "new service",
+			sources: []config.ServiceConfig{users},
+			want: "+ users (new)\n" +
+				"\n1 new, 0 changed, 0 unchanged, 0 only in MongoDB\n",
+		},
+		{
+			name:    "unchanged service",
+			sources: []config.ServiceConfig{users},
+			// Defaults compare equal to the settings they stand for
+			current: []config.ServiceConfig{{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081"}, Timeout: 30 * time.Second}},
+			want: "= users\n" +
+				"\n0 new, 0 changed, 1 unchanged, 0 only in MongoDB\n",
+		},
+		{
+			name:    "changed field",
+			sources: []config.ServiceConfig{{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081"}, Timeout: 10 * time.Second}},
+			current: []config.ServiceConfig{users},
+			want: "~ users\n" +
+				"    ~ timeout: 30s -> 10s\n" +
+				"\n0 new, 1 changed, 0 unchanged, 0 only in MongoDB\n",
+		},
+		{
+			name:    "added and removed fields",
+			sources: []config.ServiceConfig{{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081", "http://users:8082"}}},
+			current: []config.ServiceConfig{{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081"}, Headers: map[string]string{"X-Team": "identity"}}},
+			want: "~ users\n" +
+				"    - headers.X-Team: identity\n" +
+				"    + targets[1]: http://users:8082\n" +
+				"\n0 new, 1 changed, 0 unchanged, 0 only in MongoDB\n",
+		},
+		{
+			name: "unstored fields",
+			sources: []config.ServiceConfig{{
+				Name:     "users",
+				BasePath: "/api/users",
+				Targets:  []string{"http://users:8081"},
+				CORS:     &config.CORSConfig{AllowOrigins: []string{"*"}},
+				Match:    "request.method == 'GET'",
+			}},
+			current: []config.ServiceConfig{users},
+			want: "= users\n" +
+				"    ! not stored in MongoDB: cors, match\n" +
+				"\n0 new, 0 changed, 1 unchanged, 0 only in MongoDB\n",
+		},
+		{
+			name:    "services only in MongoDB",
+			sources: []config.ServiceConfig{users},
+			current: []config.ServiceConfig{
+				{Name: "legacy", BasePath: "/legacy", Targets: []string{"http://legacy:8080"}},
+				{Name: "billing", BasePath: "/billing", Targets: []string{"http://billing:8080"}},
+			},
+			want: "+ users (new)\n" +
+				"  billing (only in MongoDB, left untouched)\n" +
+				"  legacy (only in MongoDB, left untouched)\n" +
+				"\n1 new, 0 changed, 0 unchanged, 2 only in MongoDB\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			printServiceDiff(&out, tt.sources, tt.current)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestFlattenService(t *testing.T) {
+	svc := config.ServiceConfig{
+		Name:     "users",
+		BasePath: "/api/users",
+		Targets:  []string{"http://users:8081", "http://users:8082"},
+		Headers:  map[string]string{"X-Team": "identity"},
+		CORS:     &config.CORSConfig{AllowOrigins: []string{"*"}},
+	}
+
+	fields, skipped := flattenService(svc, true)
+	assert.Equal(t, "http://users:8082", fields["targets[1]"])
+	assert.Equal(t, "identity", fields["headers.X-Team"])
+	assert.NotContains(t, fields, "cors.allowOrigins[0]")
+	// Empty settings are neither fields nor lost
+	assert.NotContains(t, fields, "namespace")
+	assert.Equal(t, []string{"cors"}, skipped)
+
+	_, skipped = flattenService(svc, false)
+	assert.Empty(t, skipped)
+}
+
+func TestDiffFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		stored, desired map[string]string
+		want            []fieldChange
+	}{
+		{
+			name:    "equal",
+			stored:  map[string]string{"basePath": "/api"},
+			desired: map[string]string{"basePath": "/api"},
+		},
+		{
+			name:    "changed",
+			stored:  map[string]string{"basePath": "/api"},
+			desired: map[string]string{"basePath": "/v2"},
+			want:    []fieldChange{{path: "basePath", before: "/api", after: "/v2"}},
+		},
+		{
+			name:    "added and removed, sorted by path",
+			stored:  map[string]string{"targets[1]": "http://b"},
+			desired: map[string]string{"headers.X-Team": "identity"},
+			want: []fieldChange{
+				{path: "headers.X-Team", after: "identity", added: true},
+				{path: "targets[1]", before: "http://b", removed: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffFields(tt.stored, tt.desired))
+		})
+	}
+}
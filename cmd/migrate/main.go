@@ -23,6 +23,8 @@ func main() {
 		dryRun        = flag.Bool("dry-run", false, "Perform dry run without actual migration")
 		force         = flag.Bool("force", false, "Force migration even if services exist")
 		verbose       = flag.Bool("verbose", false, "Enable verbose logging")
+		target        = flag.String("target", "mongodb", "Migration target (only mongodb is supported)")
+		diff          = flag.Bool("diff", false, "Print per-service differences against MongoDB without writing")
 	)
 
 	flag.Parse()
@@ -38,6 +40,17 @@ func main() {
 		FullTimestamp: true,
 	})
 
+	// Only MongoDB has a repository implementation. A postgres target needs a
+	// SQL implementation of mongodb.Repository before it can reuse the
+	// loaders below.
+	switch *target {
+	case "mongodb":
+	case "postgres":
+		logger.Fatal("The postgres target is not available: there is no SQL repository to migrate into yet")
+	default:
+		logger.Fatalf("Unknown target %q, expected mongodb", *target)
+	}
+
 	logger.Info("Starting MongoDB migration tool")
 
 	// Load main configuration
@@ -115,12 +128,12 @@ func main() {
 		logger.WithError(err).Fatal("Failed to list existing services")
 	}
 
-	if len(existingServices) > 0 && !*force {
+	if len(existingServices) > 0 && !*force && !*diff {
 		logger.WithField("count", len(existingServices)).Fatal(
 			"Services already exist in MongoDB. Use --force to overwrite")
 	}
 
-	if len(existingServices) > 0 {
+	if len(existingServices) > 0 && !*diff {
 		logger.WithField("count", len(existingServices)).Warn("Existing services will be replaced")
 	}
 
@@ -174,6 +187,17 @@ func main() {
 
 	logger.WithField("count", len(servicesToMigrate)).Info("Total unique services to migrate")
 
+	// Diff - compare against MongoDB and stop before anything is written
+	if *diff {
+		adapter := mongodb.NewServiceAdapter(repo, logger)
+		current, err := adapter.LoadAllServices(ctx)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load services from MongoDB")
+		}
+		printServiceDiff(os.Stdout, servicesToMigrate, current)
+		return
+	}
+
 	// Dry run - just print what would be migrated
 	if *dryRun {
 		logger.Info("DRY RUN MODE - No changes will be made")
@@ -1,160 +1,73 @@
 package main
 
 import (
-	"context"
-	"flag"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-
-	// Added missing time import
-	"odin/pkg/config"
-	"odin/pkg/gateway"
-	"odin/pkg/logging"
+	"runtime"
+	"strings"
 )
 
+const defaultConfigPath = "config/config.yaml"
+
 var (
-	configPath string
-	version    = "dev"
+	version   = "dev"
+	buildTime = ""
 )
 
-func init() {
-	flag.StringVar(&configPath, "config", "config/config.yaml", "Path to configuration file")
-	flag.Parse()
-}
-
-func main() {
-	logger := logging.NewLogger()
-
-	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
-		loggingConfig := logging.Config{
-			Level: envLogLevel,
-			JSON:  false,
-		}
-		logging.ConfigureLogger(logger, loggingConfig)
-	}
-
-	logger.Infof("Starting Odin API Gateway %s", version)
-	logger.Infof("Loading configuration from %s", configPath)
+const usage = `Odin API Gateway
 
-	cfg, err := config.Load(configPath, logger)
-	if err != nil {
-		logger.Fatalf("Failed to load configuration: %v", err)
-	}
+Usage:
+  odin [serve] [-config path]           Start the gateway
+  odin validate [-config path]          Check a configuration file
+  odin routes [-config path] [-o json]  Print the effective routing table
+  odin services list                    List services of a running gateway
+  odin services get <name>              Show one service
+  odin services apply -f <file>         Create or update services from a YAML or JSON file
+  odin version                          Print version information
 
-	// Configure logging
-	loggingConfig := logging.Config{
-		Level: cfg.Logging.Level,
-		JSON:  cfg.Logging.JSON,
-	}
-	logging.ConfigureLogger(logger, loggingConfig)
-
-	// Apply environment variable overrides
-	if envPort := os.Getenv("GATEWAY_PORT"); envPort != "" {
-		var port int
-		if _, err := fmt.Sscanf(envPort, "%d", &port); err == nil {
-			cfg.Server.Port = port
-		}
-	}
-
-	// Log enabled features
-	features := []string{"HTTP routing"}
-
-	if cfg.Plugins.Enabled {
-		features = append(features, "plugin system")
-	}
-
-	httpServices := 0
-	graphqlServices := 0
-	grpcServices := 0
-
-	for _, svc := range cfg.Services {
-		switch svc.Protocol {
-		case "graphql":
-			graphqlServices++
-		case "grpc":
-			grpcServices++
-		default:
-			httpServices++
-		}
-	}
+The services commands talk to the admin API. Set its address and credentials with
+-admin-url, -token or -user and -password, or ODIN_ADMIN_URL, ODIN_ADMIN_TOKEN,
+ODIN_ADMIN_USER and ODIN_ADMIN_PASSWORD. odinctl covers the rest of the admin API.
+`
 
-	if graphqlServices > 0 {
-		features = append(features, fmt.Sprintf("GraphQL proxy (%d services)", graphqlServices))
-	}
-
-	if grpcServices > 0 {
-		features = append(features, fmt.Sprintf("gRPC proxy (%d services)", grpcServices))
-	}
-
-	if cfg.Auth.JWTSecret != "" || len(cfg.Auth.IgnorePathRegexes) > 0 {
-		features = append(features, "JWT authentication")
-	}
-
-	if cfg.Cache.Enabled {
-		features = append(features, "response caching")
-	}
-
-	if cfg.RateLimit.Enabled {
-		features = append(features, "rate limiting")
+func main() {
+	// Without a subcommand the binary starts the gateway, as it always has
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		serve(os.Args[1:])
+		return
 	}
 
-	if cfg.Monitoring.Enabled {
-		features = append(features, "Prometheus metrics")
+	command, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch command {
+	case "serve":
+		serve(args)
+	case "validate":
+		err = runValidate(args)
+	case "routes":
+		err = runRoutes(args)
+	case "services":
+		err = runServices(args)
+	case "version":
+		printVersion()
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
 	}
 
-	logger.Infof("Enabled features: %v", features)
-	logger.Infof("Services configured: %d HTTP, %d GraphQL, %d gRPC", httpServices, graphqlServices, grpcServices)
-
-	gw, err := gateway.New(cfg, configPath, logger)
 	if err != nil {
-		logger.Fatalf("Failed to initialize gateway: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+}
 
-	// Start the server in a goroutine
-	go func() {
-		if err := gw.Start(); err != nil {
-			if err.Error() != "http: Server closed" {
-				logger.Fatalf("Failed to start server: %v", err)
-			}
-		}
-	}()
-
-	// Setup signal handling
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
-	// Handle SIGHUP for config reload
-	reload := make(chan os.Signal, 1)
-	signal.Notify(reload, syscall.SIGHUP)
-
-	go func() {
-		for {
-			<-reload
-			logger.Info("Received SIGHUP, reloading configuration")
-			// Fix: Remove the unused newConfig variable
-			if _, err := config.Load(configPath, logger); err != nil {
-				logger.Errorf("Failed to reload configuration: %v", err)
-			} else {
-				// Apply updated configuration (implementation depends on your design)
-				logger.Info("Configuration reloaded successfully")
-			}
-		}
-	}()
-
-	// Block until signal is received
-	sig := <-quit
-	logger.Infof("Received signal: %v, shutting down...", sig)
-
-	// Create a deadline for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.GracefulTimeout)
-	defer cancel()
-
-	// Attempt graceful shutdown
-	if err := gw.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+func printVersion() {
+	fmt.Printf("version: %s\n", version)
+	if buildTime != "" {
+		fmt.Printf("built:   %s\n", buildTime)
 	}
-
-	logger.Info("Server gracefully shut down")
+	fmt.Printf("go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	"github.com/sirupsen/logrus"
+)
+
+// route is one entry of the effective routing table
+type route struct {
+	Service        string   `json:"service"`
+	BasePath       string   `json:"basePath"`
+	Protocol       string   `json:"protocol"`
+	StripBasePath  bool     `json:"stripBasePath"`
+	Targets        []string `json:"targets"`
+	LoadBalancing  string   `json:"loadBalancing"`
+	Timeout        string   `json:"timeout"`
+	Authentication bool     `json:"authentication"`
+	Middleware     []string `json:"middleware,omitempty"`
+}
+
+// runRoutes prints the routes the gateway would register for a configuration,
+// with defaults applied
+func runRoutes(args []string) error {
+	flags := flag.NewFlagSet("routes", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to configuration file")
+	output := flags.String("o", "table", "Output format: table or json")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	routes, err := routingTable(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(routes)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tBASE PATH\tPROTOCOL\tTARGETS\tMIDDLEWARE")
+		for _, r := range routes {
+			basePath := r.BasePath + "/*"
+			if r.StripBasePath {
+				basePath += " (stripped)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				r.Service, basePath, r.Protocol, strings.Join(r.Targets, ","), dash(strings.Join(r.Middleware, ",")))
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", *output)
+}
+
+// routingTable lists the services in registration order, with the
+// middleware the router applies to each in order. The gateway is built
+// without serving, so the middleware is the one it would apply.
+func routingTable(cfg *config.Config) ([]route, error) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+	defer gw.Shutdown(context.Background())
+
+	routes := make([]route, 0, len(cfg.Services))
+	for _, svc := range cfg.Services {
+		routes = append(routes, route{
+			Service:        svc.Name,
+			BasePath:       svc.BasePath,
+			Protocol:       svc.Protocol,
+			StripBasePath:  svc.StripBasePath,
+			Targets:        svc.Targets,
+			LoadBalancing:  svc.LoadBalancing,
+			Timeout:        svc.Timeout.String(),
+			Authentication: svc.Authentication,
+			Middleware:     gw.MiddlewareChain(svc.Name),
+		})
+	}
+	return routes, nil
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
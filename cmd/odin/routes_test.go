@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"odin/pkg/gateway"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const routesConfig = `
+server:
+  port: 8080
+logging:
+  accessLog: "off"
+ipFilter:
+  enabled: true
+services:
+  - name: users
+    basePath: /api/users
+    targets: [http://users:8081]
+    authentication: true
+    cors:
+      allowOrigins: ["*"]
+  - name: orders
+    basePath: /api/orders
+    targets: [http://orders:8082]
+    ipFilter:
+      deny: [192.0.2.1]
+    limits:
+      maxRequestBodySize: 1024
+`
+
+func TestRoutingTableMatchesRouter(t *testing.T) {
+	t.Chdir(t.TempDir()) // The gateway creates the admin templates directory
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(routesConfig), 0644))
+	cfg, err := loadConfig(path)
+	require.NoError(t, err)
+
+	routes, err := routingTable(cfg)
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer gw.Shutdown(context.Background())
+
+	for _, route := range routes {
+		assert.Equal(t, gw.MiddlewareChain(route.Service), route.Middleware, route.Service)
+	}
+	// The global filter applies to every service
+	assert.Equal(t, []string{"requests", "ipfilter", "cors", "auth"}, routes[0].Middleware)
+	assert.Equal(t, []string{"limits", "requests", "ipfilter"}, routes[1].Middleware)
+}
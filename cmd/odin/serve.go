@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+	"odin/pkg/logging"
+	"odin/pkg/systemd"
+	"odin/pkg/tuning"
+	"odin/pkg/upgrade"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serve starts the gateway and blocks until it is shut down
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to configuration file")
+	flags.Parse(args)
+
+	logger := logging.NewLogger()
+
+	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
+		loggingConfig := logging.Config{
+			Level: envLogLevel,
+			JSON:  false,
+		}
+		logging.ConfigureLogger(logger, loggingConfig)
+	}
+
+	logger.Infof("Starting Odin API Gateway %s", version)
+	logger.Infof("Loading configuration from %s", *configPath)
+
+	cfg, err := config.Load(*configPath, logger)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Configure logging
+	loggingConfig := logging.Config{
+		Level: cfg.Logging.Level,
+		JSON:  cfg.Logging.JSON,
+	}
+	logging.ConfigureLogger(logger, loggingConfig)
+
+	// Apply environment variable overrides
+	if envPort := os.Getenv("GATEWAY_PORT"); envPort != "" {
+		var port int
+		if _, err := fmt.Sscanf(envPort, "%d", &port); err == nil {
+			cfg.Server.Port = port
+		}
+	}
+
+	// Size the runtime to the container before anything is started
+	runtimeSettings, err := tuning.Apply(cfg.Runtime)
+	if err != nil {
+		logger.Fatalf("Failed to apply runtime settings: %v", err)
+	}
+	logger.WithFields(logrus.Fields{
+		"gomaxprocs":        runtimeSettings.GOMAXPROCS,
+		"gomaxprocsSource":  runtimeSettings.GOMAXPROCSSource,
+		"cpuLimit":          runtimeSettings.Cgroup.CPU,
+		"memoryLimit":       runtimeSettings.MemoryLimit,
+		"memoryLimitSource": runtimeSettings.MemoryLimitSource,
+		"cgroupMemory":      runtimeSettings.Cgroup.Memory,
+	}).Info("Runtime limits applied")
+
+	// Log enabled features
+	features := []string{"HTTP routing"}
+
+	if cfg.Plugins.Enabled {
+		features = append(features, "plugin system")
+	}
+
+	httpServices := 0
+	graphqlServices := 0
+	grpcServices := 0
+
+	for _, svc := range cfg.Services {
+		switch svc.Protocol {
+		case "graphql":
+			graphqlServices++
+		case "grpc":
+			grpcServices++
+		default:
+			httpServices++
+		}
+	}
+
+	if graphqlServices > 0 {
+		features = append(features, fmt.Sprintf("GraphQL proxy (%d services)", graphqlServices))
+	}
+
+	if grpcServices > 0 {
+		features = append(features, fmt.Sprintf("gRPC proxy (%d services)", grpcServices))
+	}
+
+	if cfg.Auth.JWTSecret != "" || len(cfg.Auth.IgnorePathRegexes) > 0 {
+		features = append(features, "JWT authentication")
+	}
+
+	if cfg.Cache.Enabled {
+		features = append(features, "response caching")
+	}
+
+	if cfg.RateLimit.Enabled {
+		features = append(features, "rate limiting")
+	}
+
+	if cfg.Monitoring.Enabled {
+		features = append(features, "Prometheus metrics")
+	}
+
+	logger.Infof("Enabled features: %v", features)
+	logger.Infof("Services configured: %d HTTP, %d GraphQL, %d gRPC", httpServices, graphqlServices, grpcServices)
+
+	upgrader, err := upgrade.New(logger)
+	if err != nil {
+		logger.Fatalf("Failed to take over listeners: %v", err)
+	}
+
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithConfigPath(*configPath), gateway.WithLogger(logger))
+	if err != nil {
+		logger.Fatalf("Failed to initialize gateway: %v", err)
+	}
+	gw.SetUpgrader(upgrader)
+
+	// Start the server in a goroutine
+	go func() {
+		if err := gw.Start(); err != nil {
+			if err.Error() != "http: Server closed" {
+				logger.Fatalf("Failed to start server: %v", err)
+			}
+		}
+	}()
+
+	// Once the gateway answers requests, let a previous process drain and
+	// tell systemd, then keep its watchdog fed
+	notifyCtx, stopNotify := context.WithCancel(context.Background())
+	defer stopNotify()
+	go announceReady(notifyCtx, gw, upgrader, logger)
+
+	// Setup signal handling
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	// Handle the upgrade signal by handing the listeners to a new binary
+	upgraded := make(chan struct{})
+	upgradeSignal := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgradeSignal, upgradeSignals...)
+	}
+
+	go func() {
+		for range upgradeSignal {
+			logger.Info("Received upgrade signal, starting new gateway process")
+			process, err := upgrader.Upgrade(upgradeTimeout)
+			if err != nil {
+				logger.WithError(err).Error("Upgrade failed, this process keeps serving")
+				continue
+			}
+			// With NotifyAccess=main, systemd now listens to the new process
+			if _, err := systemd.Notify(fmt.Sprintf("MAINPID=%d", process.Pid)); err != nil {
+				logger.WithError(err).Warn("Failed to notify systemd")
+			}
+			close(upgraded)
+			return
+		}
+	}()
+
+	// Handle SIGHUP for config reload
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for {
+			<-reload
+			logger.Info("Received SIGHUP, reloading configuration")
+			newConfig, err := config.Load(*configPath, logger)
+			if err != nil {
+				logger.Errorf("Failed to reload configuration: %v", err)
+				continue
+			}
+			if _, err := gw.Reload(newConfig); err != nil {
+				logger.Errorf("Failed to reload configuration: %v", err)
+			}
+		}
+	}()
+
+	// Block until signal is received or a new process has taken over
+	select {
+	case sig := <-quit:
+		logger.Infof("Received signal: %v, shutting down...", sig)
+		stopNotify()
+		if _, err := systemd.Notify(systemd.Stopping); err != nil {
+			logger.WithError(err).Warn("Failed to notify systemd")
+		}
+	case <-upgraded:
+		logger.Info("New gateway process is serving, draining connections...")
+		stopNotify()
+	}
+
+	// Create a deadline for graceful shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.GracefulTimeout)
+	defer cancel()
+
+	// Attempt graceful shutdown
+	if err := gw.Shutdown(ctx); err != nil {
+		logger.Fatalf("Server forced to shutdown: %v", err)
+	}
+
+	logger.Info("Server gracefully shut down")
+}
+
+// upgradeTimeout is how long a new process may take to become ready
+const upgradeTimeout = time.Minute
+
+// announceReady waits until the gateway answers its own self-check. It then
+// tells the process it was upgraded from, if any, to drain, sends READY=1 to
+// systemd and pings the watchdog while self-checks keep passing.
+func announceReady(ctx context.Context, gw *gateway.Gateway, upgrader *upgrade.Upgrader, logger *logrus.Logger) {
+	notify := os.Getenv("NOTIFY_SOCKET") != ""
+	if !notify && !upgrader.HasParent() {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-gw.Listening():
+	}
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for gw.SelfCheck(ctx) != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	if upgrader.HasParent() {
+		if err := upgrader.Ready(); err != nil {
+			logger.WithError(err).Warn("Failed to tell the previous process to drain")
+		} else {
+			logger.Info("Took over from the previous gateway process")
+		}
+	}
+	if !notify {
+		return
+	}
+
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		logger.WithError(err).Warn("Failed to notify systemd")
+		return
+	}
+	logger.Info("Notified systemd that the gateway is ready")
+
+	if timeout, ok := systemd.WatchdogInterval(); ok {
+		logger.WithField("timeout", timeout).Info("systemd watchdog enabled")
+		systemd.RunWatchdog(ctx, timeout, gw.SelfCheck, logger)
+	}
+}
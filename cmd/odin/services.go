@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"odin/pkg/adminclient"
+
+	"gopkg.in/yaml.v3"
+)
+
+func newAdminFlags(name string) (*flag.FlagSet, *adminclient.Client) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	client := adminclient.New("")
+	flags.StringVar(&client.BaseURL, "admin-url", envOr("ODIN_ADMIN_URL", "http://localhost:8080"), "Gateway address")
+	flags.StringVar(&client.Token, "token", os.Getenv("ODIN_ADMIN_TOKEN"), "Admin API token, used instead of the username and password")
+	flags.StringVar(&client.Username, "user", envOr("ODIN_ADMIN_USER", "admin"), "Admin username")
+	flags.StringVar(&client.Password, "password", os.Getenv("ODIN_ADMIN_PASSWORD"), "Admin password")
+	return flags, client
+}
+
+func runServices(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: list, get, apply")
+	}
+
+	switch args[0] {
+	case "list":
+		flags, client := newAdminFlags("services list")
+		output := flags.String("o", "table", "Output format: table, json or yaml")
+		flags.Parse(args[1:])
+		return listServices(client, *output)
+
+	case "get":
+		flags, client := newAdminFlags("services get")
+		output := flags.String("o", "yaml", "Output format: json or yaml")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: odin services get [flags] <name>")
+		}
+		return getService(client, flags.Arg(0), *output)
+
+	case "apply":
+		flags, client := newAdminFlags("services apply")
+		file := flags.String("f", "", "YAML or JSON file with one service, a list of services or a services: section")
+		flags.Parse(args[1:])
+		if *file == "" {
+			return fmt.Errorf("usage: odin services apply [flags] -f <file>")
+		}
+		return applyServices(client, *file)
+	}
+
+	return fmt.Errorf("unknown services command %q", args[0])
+}
+
+func listServices(client *adminclient.Client, output string) error {
+	resources, err := client.Resources("services")
+	if err != nil {
+		return err
+	}
+
+	if output != "table" {
+		return printStructured(resources, output)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tBASE PATH\tPROTOCOL\tTARGETS\tAUTH")
+	for _, res := range resources {
+		fmt.Fprintf(w, "%s\t%v\t%v\t%s\t%v\n",
+			res.Name, res.Spec["basePath"], res.Spec["protocol"], joinList(res.Spec["targets"]), res.Spec["authentication"])
+	}
+	return w.Flush()
+}
+
+func getService(client *adminclient.Client, name, output string) error {
+	res, err := client.Resource("services", name)
+	if err != nil {
+		return err
+	}
+	return printStructured(res.Spec, output)
+}
+
+// applyServices reconciles every service in a file. It stops at the first
+// service the gateway rejects; services before it stay applied.
+func applyServices(client *adminclient.Client, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	services, err := parseServices(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	for _, svc := range services {
+		name, _ := svc["name"].(string)
+		if name == "" {
+			return fmt.Errorf("%s: every service needs a name", file)
+		}
+		body, err := yaml.Marshal(svc)
+		if err != nil {
+			return err
+		}
+
+		res, err := client.Apply("services", name, body, false)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+		fmt.Printf("%s %s\n", res.ID, res.Result)
+	}
+	return nil
+}
+
+// parseServices accepts a single service, a list of services or a
+// configuration-style document with a services: section
+func parseServices(data []byte) ([]map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if m, ok := doc.(map[string]interface{}); ok {
+		if list, ok := m["services"]; ok {
+			doc = list
+		} else {
+			return []map[string]interface{}{m}, nil
+		}
+	}
+
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a service, a list of services or a services: section")
+	}
+	services := make([]map[string]interface{}, 0, len(list))
+	for i, item := range list {
+		svc, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("service %d is not an object", i)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func printStructured(value interface{}, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(value)
+	}
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+func joinList(value interface{}) string {
+	items, _ := value.([]interface{})
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, fmt.Sprint(item))
+	}
+	return strings.Join(parts, ",")
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
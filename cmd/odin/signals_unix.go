@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals start a zero-downtime binary upgrade
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// Listener handover is not supported on Windows
+var upgradeSignals []os.Signal
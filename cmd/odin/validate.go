@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"odin/pkg/cel"
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runValidate loads a configuration the same way the gateway does, so every
+// default and validation rule applies
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath, "Path to configuration file")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	// Expressions are compiled by the gateway, so check them here too
+	for _, svc := range cfg.Services {
+		if _, err := cel.CompileRoute(svc); err != nil {
+			return fmt.Errorf("%s: service %s: %w", *configPath, svc.Name, err)
+		}
+	}
+
+	fmt.Printf("%s: configuration is valid (%d services)\n", *configPath, len(cfg.Services))
+	return nil
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg, err := config.Load(path, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
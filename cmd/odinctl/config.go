@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"odin/pkg/adminclient"
+
+	"gopkg.in/yaml.v3"
+)
+
+// change is what applying a configuration file does to a resource
+type change struct {
+	kind    kind
+	name    string
+	result  string                 // created, updated, unchanged or deleted
+	item    map[string]interface{} // The resource in the file; nil when deleted
+	current map[string]interface{} // The resource in the gateway, with defaults
+	desired map[string]interface{} // The resource after the change, with defaults
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: diff, apply, export, reload")
+	}
+
+	command := args[0]
+	flags, client := newFlags("config " + command)
+	var file *string
+	var prune, exitCode *bool
+	switch command {
+	case "diff", "apply":
+		file = flags.String("f", "", "Configuration file")
+		prune = flags.Bool("prune", false, "Also delete resources missing from the sections the file has")
+		if command == "diff" {
+			exitCode = flags.Bool("exit-code", false, "Exit with status 1 when the gateway differs from the file")
+		}
+	}
+	parseFlags(flags, client, args[1:])
+
+	switch command {
+	case "diff", "apply":
+		if *file == "" {
+			return fmt.Errorf("usage: odinctl config %s [flags] -f <file>", command)
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		changes, err := plan(client, data, *prune)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *file, err)
+		}
+		if command == "apply" {
+			return apply(client, changes)
+		}
+		if printChanges(changes) && *exitCode {
+			os.Exit(1)
+		}
+		return nil
+
+	case "export":
+		body, err := client.Stream("/admin/api/settings/export")
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		_, err = io.Copy(os.Stdout, body)
+		return err
+
+	case "reload":
+		var report struct {
+			Message         string   `json:"message"`
+			Applied         []string `json:"applied"`
+			RequiresRestart []string `json:"requiresRestart"`
+		}
+		if err := client.Do(http.MethodPost, "/admin/api/settings/reload", nil, &report); err != nil {
+			return err
+		}
+		fmt.Println(report.Message)
+		if len(report.Applied) > 0 {
+			fmt.Printf("applied: %s\n", strings.Join(report.Applied, ", "))
+		}
+		if len(report.RequiresRestart) > 0 {
+			fmt.Printf("requires restart: %s\n", strings.Join(report.RequiresRestart, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown config command %q", command)
+}
+
+// plan asks the gateway what applying the services, clusters and plugins of
+// a configuration file would change, without changing anything. Sections the
+// file does not have are left alone; with prune, resources missing from the
+// sections it has are deleted.
+func plan(client *adminclient.Client, data []byte, prune bool) ([]change, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var changes []change
+	for _, k := range kinds {
+		value, found := section(doc, k.section)
+		if !found {
+			continue
+		}
+		items, err := resourceList(value, k)
+		if err != nil {
+			return nil, err
+		}
+
+		listed := make(map[string]bool, len(items))
+		for _, item := range items {
+			res, err := applyResource(client, k, item, true)
+			if err != nil {
+				return nil, err
+			}
+			listed[res.Name] = true
+			ch := change{kind: k, name: res.Name, result: res.Result, item: item, desired: res.Spec}
+			if res.Result == "updated" {
+				current, err := client.Resource(k.name, res.Name)
+				if err != nil {
+					return nil, err
+				}
+				ch.current = current.Spec
+			}
+			changes = append(changes, ch)
+		}
+
+		if !prune {
+			continue
+		}
+		remote, err := client.Resources(k.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range remote {
+			if !listed[res.Name] {
+				changes = append(changes, change{kind: k, name: res.Name, result: "deleted", current: res.Spec})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// printChanges prints the changes with the lines of updated resources that
+// change, and reports whether there are any
+func printChanges(changes []change) bool {
+	unchanged := 0
+	for _, ch := range changes {
+		if ch.result == "unchanged" {
+			unchanged++
+			continue
+		}
+		fmt.Printf("%s/%s %s\n", strings.TrimSuffix(ch.kind.name, "s"), ch.name, ch.result)
+		if ch.result != "updated" {
+			continue
+		}
+		for _, line := range diffLines(yamlLines(ch.current), yamlLines(ch.desired), 2) {
+			fmt.Println("    " + line)
+		}
+	}
+	if unchanged > 0 {
+		fmt.Printf("%d unchanged\n", unchanged)
+	}
+	return unchanged < len(changes)
+}
+
+// apply makes the planned changes. It stops at the first change the gateway
+// rejects; changes before it stay applied.
+func apply(client *adminclient.Client, changes []change) error {
+	unchanged := 0
+	for _, ch := range changes {
+		var res *adminclient.Resource
+		var err error
+		switch ch.result {
+		case "unchanged":
+			unchanged++
+			continue
+		case "deleted":
+			res, err = client.Delete(ch.kind.name, ch.name, false)
+		default:
+			res, err = applyResource(client, ch.kind, ch.item, false)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", res.ID, res.Result)
+	}
+	if unchanged > 0 {
+		fmt.Printf("%d unchanged\n", unchanged)
+	}
+	return nil
+}
+
+func yamlLines(spec map[string]interface{}) []string {
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,63 @@
+package main
+
+// diffLines compares two texts line by line. Lines only in a start with
+// "- ", lines only in b with "+ " and common lines with "  ". Only the
+// common lines within context lines of a change are kept; "..." stands for
+// the others.
+func diffLines(a, b []string, context int) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+
+	keep := make([]bool, len(lines))
+	for k, line := range lines {
+		if line[0] == ' ' {
+			continue
+		}
+		for c := max(0, k-context); c <= min(len(lines)-1, k+context); c++ {
+			keep[c] = true
+		}
+	}
+	var out []string
+	skipped := false
+	for k, line := range lines {
+		if !keep[k] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out = append(out, "...")
+			skipped = false
+		}
+		out = append(out, line)
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// drainedTarget mirrors the disabled targets of the target maintenance API
+type drainedTarget struct {
+	Target     string    `json:"target"`
+	Reason     string    `json:"reason,omitempty"`
+	DisabledBy string    `json:"disabledBy"`
+	DisabledAt time.Time `json:"disabledAt"`
+	UsedBy     []string  `json:"usedBy"`
+}
+
+// runDrain takes a target out of load balancing, or lists the drained ones
+func runDrain(args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		flags, client := newFlags("drain list")
+		output := flags.String("o", "table", "Output format: table, json or yaml")
+		parseFlags(flags, client, args[1:])
+
+		var targets []drainedTarget
+		if err := client.Do(http.MethodGet, "/admin/api/targets/disabled", nil, &targets); err != nil {
+			return err
+		}
+		if *output != "table" {
+			return printStructured(targets, *output)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TARGET\tUSED BY\tBY\tSINCE\tREASON")
+		for _, t := range targets {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				t.Target, strings.Join(t.UsedBy, ","), t.DisabledBy, t.DisabledAt.Format(time.RFC3339), dash(t.Reason))
+		}
+		return w.Flush()
+	}
+
+	flags, client := newFlags("drain")
+	reason := flags.String("reason", "", "Why the target is drained")
+	parseFlags(flags, client, args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: odinctl drain [flags] <target>")
+	}
+
+	body, _ := json.Marshal(map[string]string{"target": flags.Arg(0), "reason": *reason})
+	var drained drainedTarget
+	if err := client.Do(http.MethodPost, "/admin/api/targets/disable", body, &drained); err != nil {
+		return err
+	}
+	fmt.Printf("%s drained (%s)\n", drained.Target, strings.Join(drained.UsedBy, ", "))
+	return nil
+}
+
+// runUndrain puts a drained target back into load balancing
+func runUndrain(args []string) error {
+	flags, client := newFlags("undrain")
+	parseFlags(flags, client, args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: odinctl undrain [flags] <target>")
+	}
+
+	body, _ := json.Marshal(map[string]string{"target": flags.Arg(0)})
+	if err := client.Do(http.MethodPost, "/admin/api/targets/enable", body, nil); err != nil {
+		return err
+	}
+	fmt.Printf("%s undrained\n", flags.Arg(0))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keychainService names the tokens odinctl stores in the system keychain,
+// one per gateway address
+const keychainService = "odinctl"
+
+var errNoKeychain = errors.New("no supported keychain on " + runtime.GOOS + "; use ODIN_ADMIN_TOKEN instead")
+
+// keychainGet returns the token stored for a gateway, with the macOS
+// keychain or the Secret Service (secret-tool) on Linux
+func keychainGet(gateway string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", keychainAccount(gateway), "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", keychainAccount(gateway))
+	default:
+		return "", errNoKeychain
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("no token stored for " + gateway)
+	}
+	return token, nil
+}
+
+// keychainSet stores the token of a gateway, replacing any stored before
+func keychainSet(gateway, token string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", keychainAccount(gateway), "-w", token)
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=odinctl "+keychainAccount(gateway),
+			"service", keychainService, "account", keychainAccount(gateway))
+		cmd.Stdin = strings.NewReader(token)
+	default:
+		return errNoKeychain
+	}
+	return runKeychain(cmd)
+}
+
+// keychainDelete removes the token of a gateway
+func keychainDelete(gateway string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", keychainAccount(gateway))
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", keychainService, "account", keychainAccount(gateway))
+	default:
+		return errNoKeychain
+	}
+	return runKeychain(cmd)
+}
+
+func keychainAccount(gateway string) string {
+	return strings.TrimRight(gateway, "/")
+}
+
+func runKeychain(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return err
+}
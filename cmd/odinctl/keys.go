@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// reviewedKey mirrors the API keys of the key review API
+type reviewedKey struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	UserID       string    `json:"userId"`
+	Plan         string    `json:"plan,omitempty"`
+	Prefix       string    `json:"prefix"`
+	Status       string    `json:"status"`
+	RejectReason string    `json:"rejectReason,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: list, approve, reject, revoke")
+	}
+
+	command := args[0]
+	flags, client := newFlags("keys " + command)
+	var status, output, reason *string
+	switch command {
+	case "list":
+		status = flags.String("status", "pending", "Keys to list: pending, approved or rejected")
+		output = flags.String("o", "table", "Output format: table, json or yaml")
+	case "reject", "revoke":
+		reason = flags.String("reason", "", "Why the key is rejected or revoked")
+	}
+	parseFlags(flags, client, args[1:])
+
+	if command == "list" {
+		var keys []reviewedKey
+		if err := client.Do(http.MethodGet, "/admin/api/keys?status="+url.QueryEscape(*status), nil, &keys); err != nil {
+			return err
+		}
+		if *output != "table" {
+			return printStructured(keys, *output)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tUSER\tPLAN\tPREFIX\tSTATUS\tCREATED")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.ID, key.Name, key.UserID, dash(key.Plan), key.Prefix, key.Status, key.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: odinctl keys %s [flags] <id>", command)
+	}
+	id := flags.Arg(0)
+	switch command {
+	case "approve", "reject":
+		var body []byte
+		if reason != nil {
+			body, _ = json.Marshal(map[string]string{"reason": *reason})
+		}
+		var key reviewedKey
+		if err := client.Do(http.MethodPost, "/admin/api/keys/"+url.PathEscape(id)+"/"+command, body, &key); err != nil {
+			return err
+		}
+		fmt.Printf("key/%s %s\n", key.ID, key.Status)
+		return nil
+	case "revoke":
+		// Revoked keys are refused by every gateway sharing the revocation list
+		body, _ := json.Marshal(map[string]string{"kind": "apiKey", "value": id, "reason": *reason})
+		if err := client.Do(http.MethodPost, "/admin/api/revocations", body, nil); err != nil {
+			return err
+		}
+		fmt.Printf("key/%s revoked\n", id)
+		return nil
+	}
+	return fmt.Errorf("unknown keys command %q", command)
+}
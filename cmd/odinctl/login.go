@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// runLogin checks a token against the gateway and stores it in the keychain,
+// so later commands authenticate without flags or environment variables
+func runLogin(args []string) error {
+	flags, client := newFlags("login")
+	flags.Parse(args)
+
+	if client.Token == "" {
+		fmt.Fprint(os.Stderr, "Token: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("no token given")
+		}
+		client.Token = strings.TrimSpace(line)
+	}
+	if client.Token == "" {
+		return fmt.Errorf("no token given")
+	}
+
+	if err := client.Do(http.MethodGet, "/admin/api/settings/info", nil, nil); err != nil {
+		return fmt.Errorf("the gateway did not accept the token: %w", err)
+	}
+	if err := keychainSet(client.BaseURL, client.Token); err != nil {
+		return fmt.Errorf("storing the token: %w", err)
+	}
+	fmt.Printf("Logged in to %s\n", client.BaseURL)
+	return nil
+}
+
+// runLogout removes the token stored for the gateway
+func runLogout(args []string) error {
+	flags, client := newFlags("logout")
+	flags.Parse(args)
+	if err := keychainDelete(client.BaseURL); err != nil {
+		return err
+	}
+	fmt.Printf("Logged out of %s\n", client.BaseURL)
+	return nil
+}
+
+// runToken creates a random admin token and prints it with the entry that
+// lets the gateway accept it
+func runToken(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return fmt.Errorf("expected: generate")
+	}
+	flags := flag.NewFlagSet("odinctl token generate", flag.ExitOnError)
+	name := flags.String("name", "odinctl", "Name of the token in the gateway configuration")
+	flags.Parse(args[1:])
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	token := "odin_" + base64.RawURLEncoding.EncodeToString(secret)
+	sum := sha256.Sum256([]byte(token))
+
+	fmt.Printf("Token: %s\n\n", token)
+	fmt.Printf("Add it to the gateway configuration, which only keeps its hash:\n\n")
+	fmt.Printf("admin:\n  tokens:\n    - name: %s\n      sha256: %s\n", *name, hex.EncodeToString(sum[:]))
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"odin/pkg/logging"
+)
+
+// runLogs prints the gateway's latest log entries and, with -f, follows
+// new ones until interrupted
+func runLogs(args []string) error {
+	flags, client := newFlags("logs")
+	follow := flags.Bool("f", false, "Follow new entries")
+	lines := flags.Int("n", 100, "Number of recent entries to print")
+	level := flags.String("level", "", "Only entries at or above this level, e.g. warn")
+	service := flags.String("service", "", "Only entries of this service")
+	output := flags.String("o", "text", "Output format: text or json")
+	parseFlags(flags, client, args)
+
+	query := url.Values{}
+	query.Set("lines", strconv.Itoa(*lines))
+	if *follow {
+		query.Set("follow", "true")
+	}
+	if *level != "" {
+		query.Set("level", *level)
+	}
+	if *service != "" {
+		query.Set("service", *service)
+	}
+
+	body, err := client.Stream("/admin/api/logs?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if *output == "json" {
+			fmt.Println(scanner.Text())
+			continue
+		}
+		var entry logging.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("invalid log entry: %w", err)
+		}
+		fmt.Println(formatEntry(entry))
+	}
+	return scanner.Err()
+}
+
+// formatEntry prints an entry like the gateway's text logs
+func formatEntry(e logging.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-7s %s", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level), e.Message)
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(e.Fields[key])
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+// Command odinctl administers a running Odin gateway through its admin API.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"odin/pkg/adminclient"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	version   = "dev"
+	buildTime = ""
+)
+
+const usage = `odinctl administers a running Odin gateway through its admin API.
+
+Usage:
+  odinctl services list|get <name>|apply -f <file>|delete <name>
+  odinctl clusters list|get <name>|apply -f <file>|delete <name>
+  odinctl plugins  list|get <name>|apply -f <file>|delete <name>|enable <name>|disable <name>
+  odinctl keys list [-status pending|approved|rejected]
+  odinctl keys approve <id> | reject [-reason text] <id> | revoke [-reason text] <id>
+  odinctl config diff -f <file> [-prune] [-exit-code]
+  odinctl config apply -f <file> [-prune]
+  odinctl config export | reload
+  odinctl drain [-reason text] <target> | drain list
+  odinctl undrain <target>
+  odinctl logs [-f] [-n lines] [-level level] [-service name]
+  odinctl login [-token token]          Store a token for the gateway in the keychain
+  odinctl logout                        Remove the stored token
+  odinctl token generate [-name name]   Create a token and its admin.tokens entry
+  odinctl version
+
+Every command accepts -admin-url (ODIN_ADMIN_URL, default http://localhost:8080). Requests
+authenticate with -token (ODIN_ADMIN_TOKEN), else the token stored with login, else -user and
+-password (ODIN_ADMIN_USER and ODIN_ADMIN_PASSWORD). Flags go before positional arguments.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch command {
+	case "services", "clusters", "plugins":
+		err = runResources(command, args)
+	case "keys":
+		err = runKeys(args)
+	case "config":
+		err = runConfig(args)
+	case "drain":
+		err = runDrain(args)
+	case "undrain":
+		err = runUndrain(args)
+	case "logs":
+		err = runLogs(args)
+	case "login":
+		err = runLogin(args)
+	case "logout":
+		err = runLogout(args)
+	case "token":
+		err = runToken(args)
+	case "version":
+		printVersion()
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newFlags creates the flags of a command with the connection flags
+func newFlags(name string) (*flag.FlagSet, *adminclient.Client) {
+	flags := flag.NewFlagSet("odinctl "+name, flag.ExitOnError)
+	client := adminclient.New("")
+	flags.StringVar(&client.BaseURL, "admin-url", envOr("ODIN_ADMIN_URL", "http://localhost:8080"), "Gateway address")
+	flags.StringVar(&client.Token, "token", os.Getenv("ODIN_ADMIN_TOKEN"), "Admin API token")
+	flags.StringVar(&client.Username, "user", envOr("ODIN_ADMIN_USER", "admin"), "Admin username, without a token")
+	flags.StringVar(&client.Password, "password", os.Getenv("ODIN_ADMIN_PASSWORD"), "Admin password, without a token")
+	return flags, client
+}
+
+// parseFlags parses the flags of a command and falls back to the token
+// stored for the gateway when no credentials are given
+func parseFlags(flags *flag.FlagSet, client *adminclient.Client, args []string) {
+	flags.Parse(args)
+	if client.Token == "" && client.Password == "" {
+		if token, err := keychainGet(client.BaseURL); err == nil {
+			client.Token = token
+		}
+	}
+}
+
+func printStructured(value interface{}, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(value)
+	}
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+func printVersion() {
+	fmt.Printf("version: %s\n", version)
+	if buildTime != "" {
+		fmt.Printf("built:   %s\n", buildTime)
+	}
+	fmt.Printf("go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
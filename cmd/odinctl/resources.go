@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"odin/pkg/adminclient"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kind is a resource kind of the declarative admin API
+type kind struct {
+	name    string   // As in the API paths, e.g. services
+	section []string // Where the kind is listed in a configuration file
+	columns []string // Spec fields shown by list
+}
+
+var kinds = []kind{
+	{name: "services", section: []string{"services"}, columns: []string{"basePath", "protocol", "targets", "authentication"}},
+	{name: "clusters", section: []string{"multiCluster", "clusters"}, columns: []string{"endpoint", "region", "priority", "enabled"}},
+	{name: "plugins", section: []string{"plugins", "plugins"}, columns: []string{"path", "enabled"}},
+}
+
+func lookupKind(name string) kind {
+	for _, k := range kinds {
+		if k.name == name {
+			return k
+		}
+	}
+	panic("unknown kind " + name)
+}
+
+func runResources(kindName string, args []string) error {
+	k := lookupKind(kindName)
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: list, get, apply, delete")
+	}
+
+	command := args[0]
+	flags, client := newFlags(k.name + " " + command)
+	var output, file *string
+	switch command {
+	case "list":
+		output = flags.String("o", "table", "Output format: table, json or yaml")
+	case "get":
+		output = flags.String("o", "yaml", "Output format: json or yaml")
+	case "apply":
+		file = flags.String("f", "", "YAML or JSON file with one resource, a list, or a configuration file")
+	}
+	parseFlags(flags, client, args[1:])
+
+	switch command {
+	case "list":
+		return listResources(client, k, *output)
+	case "get", "delete", "enable", "disable":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: odinctl %s %s [flags] <name>", k.name, command)
+		}
+		name := flags.Arg(0)
+		switch command {
+		case "get":
+			res, err := client.Resource(k.name, name)
+			if err != nil {
+				return err
+			}
+			return printStructured(res.Spec, *output)
+		case "delete":
+			res, err := client.Delete(k.name, name, false)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", res.ID, res.Result)
+			return nil
+		}
+		if k.name != "plugins" {
+			break
+		}
+		// Plugins are turned on and off without changing their configuration
+		path := "/admin/api/plugins/" + url.PathEscape(name) + "/" + command
+		if err := client.Do(http.MethodPost, path, nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("plugin/%s %sd\n", name, command)
+		return nil
+	case "apply":
+		if *file == "" {
+			return fmt.Errorf("usage: odinctl %s apply [flags] -f <file>", k.name)
+		}
+		return applyFile(client, k, *file)
+	}
+	return fmt.Errorf("unknown %s command %q", k.name, command)
+}
+
+func listResources(client *adminclient.Client, k kind, output string) error {
+	resources, err := client.Resources(k.name)
+	if err != nil {
+		return err
+	}
+	if output != "table" {
+		return printStructured(resources, output)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"NAME"}
+	for _, column := range k.columns {
+		header = append(header, strings.ToUpper(column))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, res := range resources {
+		row := []string{res.Name}
+		for _, column := range k.columns {
+			row = append(row, dash(format(res.Spec[column])))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// applyFile reconciles every resource in a file. It stops at the first
+// resource the gateway rejects; resources before it stay applied.
+func applyFile(client *adminclient.Client, k kind, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	items, err := parseResources(data, k)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for _, item := range items {
+		res, err := applyResource(client, k, item, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", res.ID, res.Result)
+	}
+	return nil
+}
+
+func applyResource(client *adminclient.Client, k kind, item map[string]interface{}, dryRun bool) (*adminclient.Resource, error) {
+	name, _ := item["name"].(string)
+	body, err := yaml.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Apply(k.name, name, body, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", strings.TrimSuffix(k.name, "s"), name, err)
+	}
+	return res, nil
+}
+
+// parseResources accepts a single resource, a list of resources or a
+// configuration file listing them in the kind's section
+func parseResources(data []byte, k kind) ([]map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		if list, found := section(m, k.section); found {
+			return resourceList(list, k)
+		}
+		if _, named := m["name"]; named {
+			return resourceList([]interface{}{m}, k)
+		}
+		return nil, fmt.Errorf("expected a %s, a list of %s or a configuration file with %s",
+			strings.TrimSuffix(k.name, "s"), k.name, strings.Join(k.section, "."))
+	}
+	return resourceList(doc, k)
+}
+
+// resourceList checks that value is a list of named resources
+func resourceList(value interface{}, k kind) ([]map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list", k.name)
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for i, element := range list {
+		item, ok := element.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s %d is not an object", k.name, i)
+		}
+		if name, _ := item["name"].(string); name == "" {
+			return nil, fmt.Errorf("%s %d has no name", k.name, i)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// section returns the value at path in a configuration document
+func section(doc map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(value)
+}
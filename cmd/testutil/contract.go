@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"odin/pkg/openapi"
+)
+
+// contractCheck is one request made by the contract tests
+type contractCheck struct {
+	service   string
+	path      string
+	expected  []int
+	validator *openapi.Validator
+}
+
+// runContract calls every HTTP service of a config through the gateway and
+// reports whether the responses match what the config and, where a service
+// has one, its OpenAPI spec promise. It returns the number of failures.
+func runContract(opts loadOptions) (int, error) {
+	if opts.configPath == "" {
+		return 0, fmt.Errorf("-contract needs -config")
+	}
+	cfg, err := loadTestConfig(opts.configPath)
+	if err != nil {
+		return 0, err
+	}
+	gateway := gatewayAddress(opts, cfg)
+
+	var checks []contractCheck
+	for _, svc := range cfg.Services {
+		if svc.Protocol == "grpc" {
+			continue
+		}
+		check := contractCheck{service: svc.Name, path: svc.BasePath}
+		if svc.HealthCheck != nil {
+			check.expected = svc.HealthCheck.ExpectedStatus
+		}
+		checks = append(checks, check)
+
+		if svc.Validation == nil || svc.Validation.Spec == "" {
+			continue
+		}
+		spec, err := openapi.LoadSpec(svc.Validation.Spec)
+		if err != nil {
+			return 0, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		validator := openapi.NewValidator(spec, svc.Validation.PathPrefix)
+		for _, path := range validator.ProbePaths() {
+			checks = append(checks, contractCheck{service: svc.Name, path: path, validator: validator})
+		}
+	}
+	if len(checks) == 0 {
+		return 0, fmt.Errorf("%s: no HTTP services to test", opts.configPath)
+	}
+
+	client := &http.Client{Timeout: opts.timeout}
+	failures := 0
+	for _, check := range checks {
+		status, elapsed, problems := check.run(client, gateway, opts.token)
+		result := "PASS"
+		if len(problems) > 0 {
+			result = "FAIL"
+			failures++
+		}
+		fmt.Printf("%s  %-20s GET %s -> %s (%s)\n", result, check.service, check.path, statusText(status), elapsed.Round(time.Millisecond))
+		for _, problem := range problems {
+			fmt.Printf("        %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\n%d checks, %d failed\n", len(checks), failures)
+	return failures, nil
+}
+
+func (c contractCheck) run(client *http.Client, gateway, token string) (int, time.Duration, []string) {
+	req, err := http.NewRequest(http.MethodGet, gateway+c.path, nil)
+	if err != nil {
+		return 0, 0, []string{err.Error()}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, time.Since(start), []string{err.Error()}
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+	if err != nil {
+		return resp.StatusCode, elapsed, []string{"reading body: " + err.Error()}
+	}
+
+	var problems []string
+	if c.validator != nil {
+		errs, _ := c.validator.ValidateResponse(http.MethodGet, c.path, resp.StatusCode, resp.Header, body)
+		for _, e := range errs {
+			problem := e.In
+			if e.Field != "" {
+				problem += " " + e.Field
+			}
+			problems = append(problems, problem+": "+e.Message)
+		}
+		return resp.StatusCode, elapsed, problems
+	}
+
+	if !statusExpected(c.expected, resp.StatusCode) {
+		want := "below 500"
+		if len(c.expected) > 0 {
+			want = strings.Trim(fmt.Sprint(c.expected), "[]")
+		}
+		problems = append(problems, fmt.Sprintf("status %d, expected %s", resp.StatusCode, want))
+	}
+
+	// Without a spec the only shape promised is that JSON responses parse
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && len(body) > 0 && !json.Valid(body) {
+		problems = append(problems, "body is not valid JSON")
+	}
+	return resp.StatusCode, elapsed, problems
+}
+
+// statusExpected accepts the service's expected health check statuses, or
+// anything the gateway did not fail on when none are configured
+func statusExpected(expected []int, status int) bool {
+	if len(expected) == 0 {
+		return status < 500
+	}
+	for _, code := range expected {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+func statusText(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return fmt.Sprint(status)
+}
+
+func exitOnFailures(failures int, err error) {
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+type loadOptions struct {
+	url         string
+	configPath  string
+	gateway     string
+	method      string
+	token       string
+	concurrency int
+	duration    time.Duration
+	rps         float64
+	timeout     time.Duration
+}
+
+// enabled reports whether any flag asks for a load test rather than a
+// single request
+func (o loadOptions) enabled() bool {
+	return o.concurrency > 0 || o.duration > 0 || o.rps > 0 || o.configPath != ""
+}
+
+// result is the outcome of one request
+type result struct {
+	target  string
+	latency time.Duration
+	status  int
+	err     error
+}
+
+func runLoad(opts loadOptions) error {
+	targets, err := loadTargets(opts)
+	if err != nil {
+		return err
+	}
+	if opts.concurrency <= 0 {
+		opts.concurrency = 10
+	}
+	if opts.duration <= 0 {
+		opts.duration = 10 * time.Second
+	}
+
+	rate := "unlimited"
+	if opts.rps > 0 {
+		rate = fmt.Sprintf("%g rps", opts.rps)
+	}
+	fmt.Printf("Load testing %d target(s) for %s with %d workers at %s\n",
+		len(targets), opts.duration, opts.concurrency, rate)
+
+	client := &http.Client{
+		Timeout: opts.timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: opts.concurrency,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.duration)
+	defer cancel()
+
+	// With a target rate, workers take a token per request; otherwise they
+	// send requests back to back
+	var tokens <-chan time.Time
+	if opts.rps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rps))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	results := make(chan result, opts.concurrency*4)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ; i += opts.concurrency {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				target := targets[i%len(targets)]
+				res := send(ctx, client, opts, target)
+				if ctx.Err() != nil && res.err != nil {
+					// Cut off by the end of the run, not a real failure
+					return
+				}
+				results <- res
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	report := newReport()
+	for res := range results {
+		report.add(res)
+	}
+	report.print(os.Stdout, time.Since(start), len(targets) > 1)
+	return nil
+}
+
+// loadTargets returns the URL given on the command line or the base path of
+// every HTTP service in a config
+func loadTargets(opts loadOptions) ([]string, error) {
+	if opts.configPath == "" {
+		if opts.url == "" {
+			return nil, fmt.Errorf("a URL or -config is required")
+		}
+		return []string{opts.url}, nil
+	}
+
+	cfg, err := loadTestConfig(opts.configPath)
+	if err != nil {
+		return nil, err
+	}
+	gateway := gatewayAddress(opts, cfg)
+
+	var targets []string
+	for _, svc := range cfg.Services {
+		if svc.Protocol == "grpc" {
+			continue
+		}
+		targets = append(targets, gateway+svc.BasePath)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no HTTP services to test", opts.configPath)
+	}
+	return targets, nil
+}
+
+func loadTestConfig(path string) (*config.Config, error) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg, err := config.Load(path, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// gatewayAddress is where requests for config routes go: -gateway, the URL
+// argument or the configured server port on localhost
+func gatewayAddress(opts loadOptions, cfg *config.Config) string {
+	gateway := opts.gateway
+	if gateway == "" {
+		gateway = opts.url
+	}
+	if gateway == "" {
+		gateway = fmt.Sprintf("http://localhost:%d", cfg.Server.Port)
+	}
+	return strings.TrimRight(gateway, "/")
+}
+
+func send(ctx context.Context, client *http.Client, opts loadOptions, target string) result {
+	res := result{target: target}
+	req, err := http.NewRequestWithContext(ctx, opts.method, target, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.token)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.latency = time.Since(start)
+		res.err = err
+		return res
+	}
+	// Latency includes reading the body, as a client would
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.latency = time.Since(start)
+	res.status = resp.StatusCode
+	res.err = err
+	return res
+}
+
+type targetStats struct {
+	requests int
+	errors   int
+}
+
+// report aggregates results. Every latency is kept so percentiles are exact;
+// that is fine for the runs this tool is meant for.
+type report struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    map[string]int
+	targets   map[string]*targetStats
+}
+
+func newReport() *report {
+	return &report{
+		statuses: make(map[int]int),
+		errors:   make(map[string]int),
+		targets:  make(map[string]*targetStats),
+	}
+}
+
+func (r *report) add(res result) {
+	stats := r.targets[res.target]
+	if stats == nil {
+		stats = &targetStats{}
+		r.targets[res.target] = stats
+	}
+	stats.requests++
+	r.latencies = append(r.latencies, res.latency)
+
+	switch {
+	case res.err != nil:
+		stats.errors++
+		r.errors[classifyError(res.err)]++
+	case res.status >= 400:
+		stats.errors++
+		r.statuses[res.status]++
+		r.errors[fmt.Sprintf("HTTP %d", res.status)]++
+	default:
+		r.statuses[res.status]++
+	}
+}
+
+func (r *report) print(w io.Writer, elapsed time.Duration, perTarget bool) {
+	total := len(r.latencies)
+	failed := 0
+	for _, n := range r.errors {
+		failed += n
+	}
+
+	fmt.Fprintf(w, "\nRequests:   %d (%d failed)\n", total, failed)
+	fmt.Fprintf(w, "Duration:   %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Throughput: %.1f req/s\n", float64(total)/elapsed.Seconds())
+	if total == 0 {
+		return
+	}
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	fmt.Fprintf(w, "\nLatency:\n")
+	fmt.Fprintf(w, "  min  %s\n", round(r.latencies[0]))
+	for _, p := range []float64{50, 90, 95, 99} {
+		fmt.Fprintf(w, "  p%-3g %s\n", p, round(percentile(r.latencies, p)))
+	}
+	fmt.Fprintf(w, "  max  %s\n", round(r.latencies[total-1]))
+
+	fmt.Fprintf(w, "\nStatus codes:\n")
+	for _, code := range sortedKeys(r.statuses) {
+		fmt.Fprintf(w, "  %d  %d\n", code, r.statuses[code])
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "\nErrors:\n")
+		kinds := make([]string, 0, len(r.errors))
+		for kind := range r.errors {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool { return r.errors[kinds[i]] > r.errors[kinds[j]] })
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "  %6d  %s\n", r.errors[kind], kind)
+		}
+	}
+
+	if perTarget {
+		fmt.Fprintf(w, "\nTargets:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  URL\tREQUESTS\tERRORS")
+		urls := make([]string, 0, len(r.targets))
+		for url := range r.targets {
+			urls = append(urls, url)
+		}
+		sort.Strings(urls)
+		for _, url := range urls {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\n", url, r.targets[url].requests, r.targets[url].errors)
+		}
+		tw.Flush()
+	}
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
+
+// classifyError groups transport errors so the breakdown stays short
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection refused"
+	case strings.Contains(err.Error(), "connection reset"):
+		return "connection reset"
+	case strings.Contains(err.Error(), "EOF"):
+		return "unexpected EOF"
+	}
+	return err.Error()
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,25 +9,66 @@ import (
 	"time"
 )
 
+const usage = `Usage:
+  testutil [flags] <url> [auth_token]    Send one request and print the response
+  testutil -duration 30s [flags] <url>   Load test a URL
+  testutil -config <file> [flags]        Load test every service route in a config
+  testutil -contract -config <file>      Check every service route against its contract
+
+Load test flags must come before the URL:
+`
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go <url> [auth_token]")
-		os.Exit(1)
+	opts := loadOptions{}
+	contract := flag.Bool("contract", false, "Check the services in -config through the gateway and exit non-zero on failures")
+	flag.IntVar(&opts.concurrency, "concurrency", 0, "Number of concurrent workers (enables load testing)")
+	flag.DurationVar(&opts.duration, "duration", 0, "How long to run the load test (enables load testing)")
+	flag.Float64Var(&opts.rps, "rps", 0, "Target requests per second across all workers, 0 for unlimited (enables load testing)")
+	flag.StringVar(&opts.configPath, "config", "", "Load test the base path of every service in this config")
+	flag.StringVar(&opts.gateway, "gateway", "", "Gateway address for -config routes (default: http://localhost:<server.port>)")
+	flag.StringVar(&opts.method, "method", http.MethodGet, "HTTP method")
+	flag.StringVar(&opts.token, "token", "", "Bearer token sent with every request")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Second, "Per-request timeout")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		opts.url = flag.Arg(0)
+	}
+	if flag.NArg() > 1 && opts.token == "" {
+		opts.token = flag.Arg(1)
 	}
 
-	url := os.Args[1]
-	var token string
-	if len(os.Args) > 2 {
-		token = os.Args[2]
+	if *contract {
+		exitOnFailures(runContract(opts))
+		return
 	}
 
+	if opts.enabled() {
+		if err := runLoad(opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	url, token := opts.url, opts.token
+
 	fmt.Printf("Testing URL: %s\n", url)
 
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: opts.timeout,
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequest(opts.method, url, nil)
 	if err != nil {
 		fmt.Printf("Error creating request: %v\n", err)
 		os.Exit(1)
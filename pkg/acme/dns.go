@@ -0,0 +1,232 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+)
+
+// DefaultCloudflareAPIURL is the Cloudflare v4 API endpoint
+const DefaultCloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// DNSProvider publishes the TXT records used by the dns-01 challenge.
+// fqdn is the full record name, e.g. _acme-challenge.example.com.
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// NewDNSProvider creates the provider selected in the configuration
+func NewDNSProvider(cfg config.ACMEDNSConfig) (DNSProvider, error) {
+	switch cfg.Provider {
+	case "webhook":
+		return NewWebhookProvider(cfg.WebhookURL, cfg.WebhookSecret), nil
+	case "cloudflare":
+		return NewCloudflareProvider(cfg.APIToken, ""), nil
+	}
+	return nil, fmt.Errorf("unsupported dns provider %q", cfg.Provider)
+}
+
+// WebhookProvider delegates record changes to an HTTP endpoint, which makes
+// any DNS host usable. It POSTs {"fqdn": ..., "value": ...} to <url>/present
+// and <url>/cleanup, the same contract as lego's httpreq provider.
+type WebhookProvider struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookProvider creates a webhook DNS provider
+func NewWebhookProvider(url, secret string) *WebhookProvider {
+	return &WebhookProvider{
+		url:    strings.TrimSuffix(url, "/"),
+		secret: secret,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Present asks the webhook to create the TXT record
+func (p *WebhookProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.call(ctx, "present", fqdn, value)
+}
+
+// CleanUp asks the webhook to remove the TXT record
+func (p *WebhookProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.call(ctx, "cleanup", fqdn, value)
+}
+
+func (p *WebhookProvider) call(ctx context.Context, action, fqdn, value string) error {
+	body, err := json.Marshal(map[string]string{"fqdn": fqdn + ".", "value": value})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/"+action, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+p.secret)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dns webhook %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("dns webhook %s returned status %d", action, resp.StatusCode)
+	}
+	return nil
+}
+
+// CloudflareProvider manages TXT records through the Cloudflare API. The
+// token needs Zone:Read and DNS:Edit permissions for the zones involved.
+type CloudflareProvider struct {
+	token   string
+	baseURL string
+	client  *http.Client
+
+	mu      sync.Mutex
+	records map[string]cloudflareRecord // fqdn|value -> created record
+}
+
+type cloudflareRecord struct {
+	zoneID string
+	id     string
+}
+
+// NewCloudflareProvider creates a Cloudflare DNS provider. An empty baseURL
+// uses DefaultCloudflareAPIURL.
+func NewCloudflareProvider(token, baseURL string) *CloudflareProvider {
+	if baseURL == "" {
+		baseURL = DefaultCloudflareAPIURL
+	}
+	return &CloudflareProvider{
+		token:   token,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		records: make(map[string]cloudflareRecord),
+	}
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Present creates the TXT record in the zone that contains fqdn
+func (p *CloudflareProvider) Present(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+
+	var record struct {
+		ID string `json:"id"`
+	}
+	err = p.do(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", map[string]interface{}{
+		"type":    "TXT",
+		"name":    fqdn,
+		"content": value,
+		"ttl":     120,
+	}, &record)
+	if err != nil {
+		return fmt.Errorf("failed to create TXT record %s: %w", fqdn, err)
+	}
+
+	p.mu.Lock()
+	p.records[fqdn+"|"+value] = cloudflareRecord{zoneID: zoneID, id: record.ID}
+	p.mu.Unlock()
+	return nil
+}
+
+// CleanUp deletes the TXT record created by Present
+func (p *CloudflareProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	record, ok := p.records[fqdn+"|"+value]
+	delete(p.records, fqdn+"|"+value)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := p.do(ctx, http.MethodDelete, "/zones/"+record.zoneID+"/dns_records/"+record.id, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete TXT record %s: %w", fqdn, err)
+	}
+	return nil
+}
+
+// findZone walks up the labels of fqdn until Cloudflare knows the zone
+func (p *CloudflareProvider) findZone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		if err := p.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", fmt.Errorf("failed to look up zone %s: %w", name, err)
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone found for %s", fqdn)
+}
+
+func (p *CloudflareProvider) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("unexpected response (status %d): %w", resp.StatusCode, err)
+	}
+	if !envelope.Success {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("cloudflare: %s", envelope.Errors[0].Message)
+		}
+		return fmt.Errorf("cloudflare returned status %d", resp.StatusCode)
+	}
+
+	if result != nil && len(envelope.Result) > 0 {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
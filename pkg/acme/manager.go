@@ -0,0 +1,503 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+)
+
+// ChallengePath is where the CA fetches http-01 challenge responses
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// checkInterval is how often certificates are checked for renewal. Failed
+// issuance is retried on the next check.
+const checkInterval = time.Hour
+
+// ErrUnknownDomain is returned when renewing a domain that is not configured
+var ErrUnknownDomain = errors.New("domain is not managed by ACME")
+
+// CertificateStatus describes a managed certificate
+type CertificateStatus struct {
+	Domain    string    `json:"domain"`
+	Issued    bool      `json:"issued"`
+	NotAfter  time.Time `json:"notAfter,omitempty"`
+	RenewedAt time.Time `json:"renewedAt,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Manager obtains certificates for the configured domains from an ACME CA,
+// renews them before they expire and serves them during TLS handshakes
+type Manager struct {
+	config  config.ACMEConfig
+	storage Storage
+	dns     DNSProvider
+	logger  *logrus.Logger
+
+	issueMu sync.Mutex // serializes orders and guards client
+	client  *acme.Client
+
+	mu       sync.RWMutex
+	certs    map[string]*tls.Certificate
+	status   map[string]*CertificateStatus
+	tokens   map[string]string // http-01 token -> key authorization
+	running  bool
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewManager creates an ACME manager. Certificates are not requested until
+// Start is called.
+func NewManager(cfg config.ACMEConfig, storage Storage, logger *logrus.Logger) (*Manager, error) {
+	m := &Manager{
+		config:   cfg,
+		storage:  storage,
+		logger:   logger,
+		certs:    make(map[string]*tls.Certificate),
+		status:   make(map[string]*CertificateStatus),
+		tokens:   make(map[string]string),
+		stopChan: make(chan struct{}),
+	}
+
+	if cfg.Challenge == "dns-01" {
+		provider, err := NewDNSProvider(cfg.DNS)
+		if err != nil {
+			return nil, err
+		}
+		m.dns = provider
+	}
+
+	for _, domain := range cfg.Domains {
+		domain = normalizeName(domain)
+		m.status[domain] = &CertificateStatus{Domain: domain}
+	}
+
+	return m, nil
+}
+
+// Start loads stored certificates and begins the issuance and renewal loop.
+// The http-01 handler must already be reachable on port 80.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return fmt.Errorf("acme manager already running")
+	}
+	m.running = true
+	m.mu.Unlock()
+
+	for _, domain := range m.domains() {
+		if err := m.load(ctx, domain); err != nil {
+			m.logger.WithError(err).WithField("domain", domain).Warn("Failed to load stored ACME certificate")
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"domains":   m.config.Domains,
+		"challenge": m.config.Challenge,
+		"directory": m.config.DirectoryURL,
+	}).Info("Starting ACME certificate manager")
+
+	m.wg.Add(1)
+	go m.renewLoop(ctx)
+
+	return nil
+}
+
+// Stop stops the renewal loop
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return fmt.Errorf("acme manager not running")
+	}
+	m.running = false
+	m.mu.Unlock()
+
+	close(m.stopChan)
+	m.wg.Wait()
+
+	return nil
+}
+
+func (m *Manager) renewLoop(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	m.renewDue(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.renewDue(ctx)
+		}
+	}
+}
+
+// renewDue obtains certificates that are missing or expire within renewBefore
+func (m *Manager) renewDue(ctx context.Context) {
+	for _, domain := range m.domains() {
+		m.mu.RLock()
+		cert := m.certs[domain]
+		m.mu.RUnlock()
+
+		if cert != nil && time.Until(cert.Leaf.NotAfter) > m.config.RenewBefore {
+			continue
+		}
+
+		select {
+		case <-m.stopChan:
+			return
+		default:
+		}
+
+		if err := m.Renew(ctx, domain); err != nil {
+			m.logger.WithError(err).WithField("domain", domain).Error("ACME certificate issuance failed")
+		}
+	}
+}
+
+// Renew obtains a new certificate for a managed domain now
+func (m *Manager) Renew(ctx context.Context, domain string) error {
+	domain = normalizeName(domain)
+
+	m.mu.RLock()
+	_, managed := m.status[domain]
+	m.mu.RUnlock()
+	if !managed {
+		return fmt.Errorf("%s: %w", domain, ErrUnknownDomain)
+	}
+
+	err := m.issue(ctx, domain)
+
+	m.mu.Lock()
+	if err != nil {
+		m.status[domain].LastError = err.Error()
+	} else {
+		m.status[domain].LastError = ""
+		m.status[domain].RenewedAt = time.Now().UTC()
+	}
+	m.mu.Unlock()
+
+	return err
+}
+
+// Status returns the state of every managed certificate sorted by domain
+func (m *Manager) Status() []CertificateStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]CertificateStatus, 0, len(m.status))
+	for _, status := range m.status {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Domain < statuses[j].Domain
+	})
+	return statuses
+}
+
+// GetCertificate returns the managed certificate for the requested server
+// name, or nil when there is none so another source can be consulted
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := normalizeName(hello.ServerName)
+	if name == "" {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if cert, ok := m.certs[name]; ok {
+		return cert, nil
+	}
+	if dot := strings.Index(name, "."); dot > 0 {
+		if cert, ok := m.certs["*"+name[dot:]]; ok {
+			return cert, nil
+		}
+	}
+	return nil, nil
+}
+
+// HTTPHandler answers http-01 challenges and passes every other request to next
+func (m *Manager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, ChallengePath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.mu.RLock()
+		keyAuth, ok := m.tokens[strings.TrimPrefix(r.URL.Path, ChallengePath)]
+		m.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// load installs a stored certificate
+func (m *Manager) load(ctx context.Context, domain string) error {
+	res, err := m.storage.Load(ctx, domain)
+	if err != nil || res == nil || len(res.CertPEM) == 0 {
+		return err
+	}
+
+	return m.install(domain, res.CertPEM, res.KeyPEM)
+}
+
+func (m *Manager) install(domain string, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid certificate for %s: %w", domain, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("invalid certificate for %s: %w", domain, err)
+	}
+	cert.Leaf = leaf
+
+	m.mu.Lock()
+	m.certs[domain] = &cert
+	m.status[domain].Issued = true
+	m.status[domain].NotAfter = leaf.NotAfter
+	m.mu.Unlock()
+
+	return nil
+}
+
+// issue runs an ACME order for domain and stores the resulting certificate
+func (m *Manager) issue(ctx context.Context, domain string) error {
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.logger.WithField("domain", domain).Info("Requesting ACME certificate")
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("order not ready: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize order: %w", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := m.storage.Save(ctx, &Resource{Name: domain, CertPEM: certPEM, KeyPEM: keyPEM}); err != nil {
+		return fmt.Errorf("failed to store certificate: %w", err)
+	}
+	if err := m.install(domain, certPEM, keyPEM); err != nil {
+		return err
+	}
+
+	m.logger.WithField("domain", domain).Info("ACME certificate issued")
+	return nil
+}
+
+// authorize completes one authorization with the configured challenge type
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, candidate := range authz.Challenges {
+		if candidate.Type == m.config.Challenge {
+			challenge = candidate
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("CA offered no %s challenge for %s", m.config.Challenge, authz.Identifier.Value)
+	}
+
+	switch challenge.Type {
+	case "http-01":
+		keyAuth, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.tokens[challenge.Token] = keyAuth
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			delete(m.tokens, challenge.Token)
+			m.mu.Unlock()
+		}()
+
+	case "dns-01":
+		value, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		fqdn := "_acme-challenge." + authz.Identifier.Value
+		if err := m.dns.Present(ctx, fqdn, value); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.dns.CleanUp(context.Background(), fqdn, value); err != nil {
+				m.logger.WithError(err).WithField("record", fqdn).Warn("Failed to remove ACME TXT record")
+			}
+		}()
+
+		// Give the record time to reach the authoritative name servers
+		select {
+		case <-time.After(m.config.DNS.PropagationDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept %s challenge: %w", challenge.Type, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authzURL); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// acmeClient returns a client with a registered account, creating and
+// storing the account key on first use
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{Key: key, DirectoryURL: m.config.DirectoryURL}
+
+	account := &acme.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	m.client = client
+	return client, nil
+}
+
+func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	res, err := m.storage.Load(ctx, accountResource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account key: %w", err)
+	}
+	if res != nil {
+		block, _ := pem.Decode(res.KeyPEM)
+		if block == nil {
+			return nil, fmt.Errorf("stored account key is not PEM encoded")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.storage.Save(ctx, &Resource{Name: accountResource, KeyPEM: keyPEM}); err != nil {
+		return nil, fmt.Errorf("failed to store account key: %w", err)
+	}
+	return key, nil
+}
+
+func (m *Manager) domains() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	domains := make([]string, 0, len(m.status))
+	for domain := range m.status {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
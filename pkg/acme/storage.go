@@ -0,0 +1,139 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"odin/pkg/mongodb"
+)
+
+// accountResource is the storage name of the ACME account key
+const accountResource = "account"
+
+// Resource is a stored private key and, for certificates, the PEM chain
+type Resource struct {
+	Name    string // Domain name, or "account" for the account key
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// Storage persists the account key and issued certificates so they survive
+// restarts and are not requested again from the CA
+type Storage interface {
+	// Load returns nil without an error when the resource does not exist
+	Load(ctx context.Context, name string) (*Resource, error)
+	Save(ctx context.Context, res *Resource) error
+}
+
+// DiskStorage keeps resources as <name>.crt and <name>.key files in a directory
+type DiskStorage struct {
+	dir string
+}
+
+// NewDiskStorage creates disk storage rooted at dir
+func NewDiskStorage(dir string) *DiskStorage {
+	return &DiskStorage{dir: dir}
+}
+
+// Load reads a resource from disk
+func (s *DiskStorage) Load(ctx context.Context, name string) (*Resource, error) {
+	base := filepath.Join(s.dir, fileName(name))
+
+	keyPEM, err := os.ReadFile(base + ".key")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key for %s: %w", name, err)
+	}
+
+	certPEM, err := os.ReadFile(base + ".crt")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read certificate for %s: %w", name, err)
+	}
+
+	return &Resource{Name: name, CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// Save writes a resource to disk. Keys are only readable by the owner.
+func (s *DiskStorage) Save(ctx context.Context, res *Resource) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	base := filepath.Join(s.dir, fileName(res.Name))
+	if len(res.CertPEM) > 0 {
+		if err := writeFile(base+".crt", res.CertPEM, 0644); err != nil {
+			return fmt.Errorf("failed to write certificate for %s: %w", res.Name, err)
+		}
+	}
+	if err := writeFile(base+".key", res.KeyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write key for %s: %w", res.Name, err)
+	}
+
+	return nil
+}
+
+// writeFile replaces a file atomically so a crash never leaves a certificate
+// without its matching key
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fileName maps wildcard names such as *.example.com to _.example.com
+func fileName(name string) string {
+	return strings.ReplaceAll(name, "*", "_")
+}
+
+// MongoStorage keeps resources in the acme_certificates collection, which
+// lets several gateway instances share one set of certificates
+type MongoStorage struct {
+	repo mongodb.Repository
+}
+
+// NewMongoStorage creates MongoDB-backed storage
+func NewMongoStorage(repo mongodb.Repository) *MongoStorage {
+	return &MongoStorage{repo: repo}
+}
+
+// Load reads a resource from MongoDB
+func (s *MongoStorage) Load(ctx context.Context, name string) (*Resource, error) {
+	doc, err := s.repo.GetACMEDocument(ctx, name)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	return &Resource{Name: name, CertPEM: []byte(doc.CertPEM), KeyPEM: []byte(doc.KeyPEM)}, nil
+}
+
+// Save writes a resource to MongoDB
+func (s *MongoStorage) Save(ctx context.Context, res *Resource) error {
+	doc := &mongodb.ACMEDocument{
+		ID:      res.Name,
+		CertPEM: string(res.CertPEM),
+		KeyPEM:  string(res.KeyPEM),
+	}
+	if leaf, err := parseLeaf(res.CertPEM); err == nil {
+		doc.Domains = leaf.DNSNames
+		doc.NotAfter = leaf.NotAfter
+	}
+	return s.repo.SaveACMEDocument(ctx, doc)
+}
+
+// parseLeaf returns the first certificate of a PEM chain
+func parseLeaf(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"odin/pkg/acme"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ACMEHandler exposes the state of ACME-managed certificates
+type ACMEHandler struct {
+	manager *acme.Manager
+}
+
+// NewACMEHandler creates a new ACME handler
+func NewACMEHandler(manager *acme.Manager) *ACMEHandler {
+	return &ACMEHandler{manager: manager}
+}
+
+// RegisterRoutes registers the ACME API routes
+func (h *ACMEHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/acme/certificates", h.listCertificates)
+	g.POST("/api/acme/certificates/:domain/renew", h.renewCertificate)
+}
+
+// listCertificates returns every managed domain with its expiry and last error
+func (h *ACMEHandler) listCertificates(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.manager.Status())
+}
+
+// renewCertificate requests a new certificate immediately
+func (h *ACMEHandler) renewCertificate(c echo.Context) error {
+	err := h.manager.Renew(c.Request().Context(), c.Param("domain"))
+	if errors.Is(err, acme.ErrUnknownDomain) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "certificate renewed",
+	})
+}
@@ -1,8 +1,30 @@
 package admin
 
 import (
+	"odin/pkg/acme"
+	"odin/pkg/backup"
+	"odin/pkg/cache"
 	"odin/pkg/config"
+	"odin/pkg/consumers"
+	"odin/pkg/dlp"
+	"odin/pkg/events"
+	"odin/pkg/faults"
+	"odin/pkg/gitops"
+	"odin/pkg/health"
+	"odin/pkg/ipfilter"
+	"odin/pkg/logging"
+	"odin/pkg/metering"
+	"odin/pkg/mongodb"
+	"odin/pkg/monitoring"
+	"odin/pkg/overload"
 	"odin/pkg/plugins"
+	"odin/pkg/portal"
+	"odin/pkg/ratelimit"
+	"odin/pkg/revocation"
+	"odin/pkg/scheduler"
+	"odin/pkg/streaming"
+	"odin/pkg/tcpproxy"
+	"odin/pkg/websocket"
 	"os"
 	"path/filepath"
 
@@ -16,16 +38,51 @@ type AdminCredentials struct {
 }
 
 type AdminHandler struct {
-	config               *config.Config
+	config               *config.Store
 	configPath           string
 	logger               *logrus.Logger
 	username             string
 	password             string
+	namespaceAdmins      map[string]config.AdminNamespaceConfig // by username
+	tokens               []config.AdminTokenConfig
 	enabled              bool
+	basicAuth            bool
 	pluginHandler        *PluginHandler
 	middlewareAPIHandler *MiddlewareAPIHandler
 	integrationHandler   *IntegrationHandler
 	pluginUploadHandler  *PluginUploadHandler
+	gitopsHandler        *GitOpsHandler
+	eventsHandler        *EventsHandler
+	streamingHandler     *StreamingHandler
+	ipFilterHandler      *IPFilterHandler
+	acmeHandler          *ACMEHandler
+	dlpHandler           *DLPHandler
+	overloadHandler      *OverloadHandler
+	websocketHandler     *WebSocketHandler
+	tcpHandler           *TCPHandler
+	meteringHandler      *MeteringHandler
+	healthHistoryHandler *HealthHistoryHandler
+	targetsHandler       *TargetsHandler
+	consumersHandler     *ConsumersHandler
+	keysHandler          *KeysHandler
+	backupHandler        *BackupHandler
+	schedulerHandler     *SchedulerHandler
+	revocationHandler    *RevocationHandler
+	faultsHandler        *FaultsHandler
+	logsHandler          *LogsHandler
+	usersHandler         *UsersHandler
+	storedServices       *StoredServicesHandler
+	mongoServices        *mongodb.ServiceAdapter
+	configVersions       *ConfigVersionsHandler
+	users                *userAuth
+	sessions             *sessions
+	cacheStore           cache.Store
+	reloader             Reloader
+	inFlight             InFlightCounter
+	rateLimitCounter     ratelimit.Counter
+	samples              *monitoring.RequestSamples
+	changes              *ChangeNotifier
+	events               events.Publisher
 }
 
 func loadAdminCredentials(logger *logrus.Logger) (*AdminCredentials, error) {
@@ -64,7 +121,10 @@ func loadAdminCredentials(logger *logrus.Logger) (*AdminCredentials, error) {
 	return &credentials, nil
 }
 
-func New(cfg *config.Config, configPath string, logger *logrus.Logger) *AdminHandler {
+// New creates the admin handler, which reads and changes the configuration
+// through configs
+func New(configs *config.Store, configPath string, logger *logrus.Logger) *AdminHandler {
+	cfg := configs.Load()
 	creds, _ := loadAdminCredentials(logger)
 
 	username := ""
@@ -89,17 +149,26 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) *AdminHan
 		password = "admin1"
 	}
 
+	namespaceAdmins := make(map[string]config.AdminNamespaceConfig, len(cfg.Admin.Namespaces))
+	for _, ns := range cfg.Admin.Namespaces {
+		namespaceAdmins[ns.Username] = ns
+	}
+
 	return &AdminHandler{
-		config:               cfg,
+		config:               configs,
 		configPath:           configPath,
 		logger:               logger,
 		username:             username,
 		password:             password,
+		namespaceAdmins:      namespaceAdmins,
+		tokens:               cfg.Admin.Tokens,
 		enabled:              cfg.Admin.Enabled,
+		basicAuth:            cfg.Admin.BasicAuth,
 		pluginHandler:        nil, // Will be set later via SetPluginHandler
 		middlewareAPIHandler: nil, // Will be set later via SetMiddlewareAPIHandler
 		integrationHandler:   nil, // Will be set later via SetIntegrationHandler
 		pluginUploadHandler:  nil, // Will be set later via SetPluginUploadHandler
+		changes:              NewChangeNotifier(logger),
 	}
 }
 
@@ -123,13 +192,185 @@ func (h *AdminHandler) SetPluginUploadHandler(handler *PluginUploadHandler) {
 	h.pluginUploadHandler = handler
 }
 
+// SetGitOpsSyncer enables the GitOps status, sync and webhook endpoints
+func (h *AdminHandler) SetGitOpsSyncer(syncer *gitops.Syncer) {
+	h.gitopsHandler = NewGitOpsHandler(syncer, h.logger)
+}
+
+// SetEventBus enables lifecycle events for admin changes and the dead-letter API
+func (h *AdminHandler) SetEventBus(bus *events.Bus, repo mongodb.Repository) {
+	h.events = bus
+	h.eventsHandler = NewEventsHandler(bus, repo, h.logger)
+}
+
+// SetStreamingPipeline enables the streaming status endpoint
+func (h *AdminHandler) SetStreamingPipeline(pipeline *streaming.Pipeline) {
+	h.streamingHandler = NewStreamingHandler(pipeline)
+}
+
+// SetIPFilter enables the IP allow/deny list API
+func (h *AdminHandler) SetIPFilter(filter *ipfilter.Filter) {
+	h.ipFilterHandler = NewIPFilterHandler(filter)
+}
+
+// SetACMEManager enables the ACME certificate API
+func (h *AdminHandler) SetACMEManager(manager *acme.Manager) {
+	h.acmeHandler = NewACMEHandler(manager)
+}
+
+// SetDLPStats exposes the audit counters of response DLP rules
+func (h *AdminHandler) SetDLPStats(stats *dlp.Stats) {
+	h.dlpHandler = NewDLPHandler(stats)
+}
+
+// SetOverloadGuard exposes the state of overload protection
+func (h *AdminHandler) SetOverloadGuard(guard *overload.Guard) {
+	h.overloadHandler = NewOverloadHandler(guard)
+}
+
+// SetWebSocketLimiter exposes the WebSocket connection counters
+func (h *AdminHandler) SetWebSocketLimiter(limiter *websocket.Limiter) {
+	h.websocketHandler = NewWebSocketHandler(limiter)
+}
+
+// SetTCPProxies exposes the state of the TCP proxy listeners
+func (h *AdminHandler) SetTCPProxies(proxies []*tcpproxy.Proxy) {
+	h.tcpHandler = NewTCPHandler(proxies)
+}
+
+// SetMeter enables the export of usage records for billing
+func (h *AdminHandler) SetMeter(meter *metering.Meter) {
+	h.meteringHandler = NewMeteringHandler(meter)
+}
+
+// SetHealthHistory enables the uptime and latency history of targets
+func (h *AdminHandler) SetHealthHistory(history *health.History) {
+	h.healthHistoryHandler = NewHealthHistoryHandler(history)
+}
+
+// SetMaintenance enables disabling and enabling upstream targets
+func (h *AdminHandler) SetMaintenance(m *health.Maintenance) {
+	h.targetsHandler = NewTargetsHandler(m, h.config)
+}
+
+// SetConsumers enables the management of consumers
+func (h *AdminHandler) SetConsumers(registry *consumers.Registry) {
+	h.consumersHandler = NewConsumersHandler(registry)
+}
+
+// SetPortal enables the review of API keys requested in the portal
+func (h *AdminHandler) SetPortal(p *portal.Portal) {
+	h.keysHandler = NewKeysHandler(p)
+}
+
+// SetBackupScheduler enables the status and manual runs of scheduled backups
+func (h *AdminHandler) SetBackupScheduler(scheduler *backup.Scheduler) {
+	h.backupHandler = NewBackupHandler(scheduler)
+}
+
+// SetScheduler enables the management of scheduled jobs
+func (h *AdminHandler) SetScheduler(s *scheduler.Scheduler) {
+	h.schedulerHandler = NewSchedulerHandler(s)
+}
+
+// SetRevocations enables revoking tokens and API keys
+func (h *AdminHandler) SetRevocations(list *revocation.List) {
+	h.revocationHandler = NewRevocationHandler(list)
+}
+
+// SetUserStore enables signing in as the users of store, with the access
+// of their role, and the management of those users
+func (h *AdminHandler) SetUserStore(store UserStore) {
+	h.users = newUserAuth(store)
+	h.usersHandler = NewUsersHandler(store)
+	h.usersHandler.onChange = h.users.forget
+}
+
+// SetSessions enables signing in for access and refresh tokens, with
+// refresh tokens and sign-ins recorded in store
+func (h *AdminHandler) SetSessions(store SessionStore, jwtSecret string) {
+	if jwtSecret == "" {
+		h.logger.Warn("auth.jwtSecret is not set: admin access tokens are signed with a random key and only valid on this instance until it restarts")
+	}
+	sessions, err := newSessions(store, h.config.Load().Admin.Sessions, jwtSecret)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create the admin session key, sessions are disabled")
+		return
+	}
+	h.sessions = sessions
+}
+
+// SetMongoDBServices enables the MongoDB service API, through which
+// namespace admins manage the services of their namespaces
+func (h *AdminHandler) SetMongoDBServices(adapter *mongodb.ServiceAdapter) {
+	h.mongoServices = adapter
+}
+
+// SetStoredServices enables managing the services stored in MongoDB, with
+// the changes routed live by router
+func (h *AdminHandler) SetStoredServices(store ServiceStore, router StoredServiceRouter) {
+	h.storedServices = NewStoredServicesHandler(store, router, h.logger)
+	h.storedServices.publish = h.publish
+}
+
+// SetConfigVersions enables listing, comparing and rolling back the
+// configuration versions in store. current returns the configuration running.
+func (h *AdminHandler) SetConfigVersions(store ConfigVersionStore, reloader Reloader, current func() *config.Config) {
+	h.configVersions = NewConfigVersionsHandler(store, reloader, current, h.logger)
+}
+
+// SetFaults enables turning fault injection on and off at runtime
+func (h *AdminHandler) SetFaults(injector *faults.Injector) {
+	h.faultsHandler = NewFaultsHandler(injector)
+}
+
+// SetLogTail enables reading and following the gateway's logs
+func (h *AdminHandler) SetLogTail(tail *logging.Tail) {
+	h.logsHandler = NewLogsHandler(tail)
+}
+
+// SetCacheStore enables purging cached responses from the settings API
+func (h *AdminHandler) SetCacheStore(store cache.Store) {
+	h.cacheStore = store
+}
+
+// SetReloader enables reloading the configuration file from the settings API
+func (h *AdminHandler) SetReloader(reloader Reloader) {
+	h.reloader = reloader
+}
+
+// SetInFlightCounter reports the requests each service is serving in the
+// system stats
+func (h *AdminHandler) SetInFlightCounter(counter InFlightCounter) {
+	h.inFlight = counter
+}
+
+// SetRateLimitCounter reports the health of the store rate limits are
+// counted in in the system stats
+func (h *AdminHandler) SetRateLimitCounter(counter ratelimit.Counter) {
+	h.rateLimitCounter = counter
+}
+
+// SetRequestSamples estimates the impact of settings changes on recent requests
+func (h *AdminHandler) SetRequestSamples(samples *monitoring.RequestSamples) {
+	h.samples = samples
+}
+
+// publish emits an event if the event bus is enabled
+func (h *AdminHandler) publish(eventType events.EventType, data map[string]interface{}) {
+	if h.events != nil {
+		h.events.Publish(eventType, data)
+	}
+}
+
 // GetIntegrationHandler returns the integration handler
 func (h *AdminHandler) GetIntegrationHandler() *IntegrationHandler {
 	return h.integrationHandler
 }
 
-func (h *AdminHandler) saveConfig() error {
-	data, err := yaml.Marshal(h.config)
+// saveConfig writes cfg to the configuration file
+func (h *AdminHandler) saveConfig(cfg *config.Config) error {
+	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to marshal configuration")
 		return err
@@ -1,54 +1,176 @@
 package admin
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
+// NamespaceContextKey is the echo context key of the namespace an admin
+// request is limited to; it is empty for the gateway administrator
+const NamespaceContextKey = "adminNamespace"
+
+// tokenContextKey is the echo context key of the name of the token an admin
+// request was authenticated with
+const tokenContextKey = "adminToken"
+
 func (h *AdminHandler) basicAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if !h.enabled {
 			return next(c)
 		}
 
-		auth := c.Request().Header.Get("Authorization")
-
-		if auth == "" {
-			cookie, err := c.Cookie("Authorization")
-			if err == nil && cookie.Value != "" {
-				auth = cookie.Value
-				if !strings.HasPrefix(auth, "Basic ") {
-					auth = "Basic " + auth
-				}
-			}
+		if name, ok := h.requestToken(c); ok {
+			c.Set(tokenContextKey, name)
+			c.Set(roleContextKey, RoleAdmin)
+			return next(c)
+		}
+		if claims, ok := h.requestSession(c); ok {
+			c.Set(userContextKey, claims.Subject)
+			c.Set(roleContextKey, claims.Role)
+			return next(c)
 		}
 
-		if auth == "" {
+		username, password, ok := h.requestCredentials(c)
+		if !ok {
 			return h.unauthorized(c)
 		}
-
-		const basicAuthPrefix = "Basic "
-		if !strings.HasPrefix(auth, basicAuthPrefix) {
+		role, ok := h.credentialsRole(c, username, password)
+		if !ok {
 			return h.unauthorized(c)
 		}
 
-		payload, err := base64.StdEncoding.DecodeString(auth[len(basicAuthPrefix):])
-		if err != nil {
-			return h.unauthorized(c)
+		c.Set(roleContextKey, role)
+		return next(c)
+	}
+}
+
+// namespaceAuthMiddleware also accepts the credentials of namespace admins,
+// storing the namespace they administer under NamespaceContextKey
+func (h *AdminHandler) namespaceAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !h.enabled {
+			return next(c)
+		}
+
+		if name, ok := h.requestToken(c); ok {
+			c.Set(tokenContextKey, name)
+			c.Set(NamespaceContextKey, "")
+			c.Set(roleContextKey, RoleAdmin)
+			return next(c)
+		}
+		if claims, ok := h.requestSession(c); ok {
+			c.Set(userContextKey, claims.Subject)
+			c.Set(NamespaceContextKey, "")
+			c.Set(roleContextKey, claims.Role)
+			return next(c)
 		}
 
-		pair := strings.SplitN(string(payload), ":", 2)
-		if len(pair) != 2 || pair[0] != h.username || pair[1] != h.password {
+		username, password, ok := h.requestCredentials(c)
+		if !ok {
+			return h.unauthorized(c)
+		}
+		if role, ok := h.credentialsRole(c, username, password); ok {
+			c.Set(NamespaceContextKey, "")
+			c.Set(roleContextKey, role)
+			return next(c)
+		}
+		ns, found := h.namespaceAdmins[username]
+		if !found || subtle.ConstantTimeCompare([]byte(password), []byte(ns.Password)) != 1 {
 			return h.unauthorized(c)
 		}
 
+		c.Set(NamespaceContextKey, ns.Name)
+		c.Set(roleContextKey, RoleUser)
 		return next(c)
 	}
 }
 
+// credentialsRole returns the role of the gateway administrator or of the
+// stored user with these credentials
+func (h *AdminHandler) credentialsRole(c echo.Context, username, password string) (string, bool) {
+	if username == h.username && password == h.password {
+		return RoleAdmin, true
+	}
+	if h.users != nil {
+		return h.users.authenticate(c.Request().Context(), username, password)
+	}
+	return "", false
+}
+
+// requestUser returns the username of the admin making a request, if known
+func requestUser(c echo.Context) (string, bool) {
+	if username, ok := c.Get(userContextKey).(string); ok {
+		return username, true
+	}
+	username, _, ok := basicCredentials(c)
+	return username, ok
+}
+
+// requestCredentials returns the basic auth credentials of the request, if
+// basic auth is enabled
+func (h *AdminHandler) requestCredentials(c echo.Context) (string, string, bool) {
+	if !h.basicAuth {
+		return "", "", false
+	}
+	return basicCredentials(c)
+}
+
+// basicCredentials returns the basic auth credentials of the request, taken
+// from the Authorization header or the cookie set at login
+func basicCredentials(c echo.Context) (string, string, bool) {
+	auth := c.Request().Header.Get("Authorization")
+
+	if auth == "" {
+		cookie, err := c.Cookie("Authorization")
+		if err == nil && cookie.Value != "" {
+			auth = cookie.Value
+			if !strings.HasPrefix(auth, "Basic ") {
+				auth = "Basic " + auth
+			}
+		}
+	}
+
+	const basicAuthPrefix = "Basic "
+	if !strings.HasPrefix(auth, basicAuthPrefix) {
+		return "", "", false
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(auth[len(basicAuthPrefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	pair := strings.SplitN(string(payload), ":", 2)
+	if len(pair) != 2 {
+		return "", "", false
+	}
+	return pair[0], pair[1], true
+}
+
+// requestToken returns the name of the admin token the request carries as
+// a bearer token, if it carries one of them
+func (h *AdminHandler) requestToken(c echo.Context) (string, bool) {
+	const bearerPrefix = "Bearer "
+	auth := c.Request().Header.Get("Authorization")
+	if len(h.tokens) == 0 || !strings.HasPrefix(auth, bearerPrefix) {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(auth[len(bearerPrefix):]))
+	for _, token := range h.tokens {
+		expected, err := hex.DecodeString(token.SHA256)
+		if err == nil && subtle.ConstantTimeCompare(sum[:], expected) == 1 {
+			return token.Name, true
+		}
+	}
+	return "", false
+}
+
 func (h *AdminHandler) unauthorized(c echo.Context) error {
 	c.Response().Header().Set("WWW-Authenticate", `Basic realm="Admin Area"`)
 	return c.HTML(http.StatusUnauthorized, `
@@ -73,13 +195,26 @@ func (h *AdminHandler) handleLoginPost(c echo.Context) error {
 	username := c.FormValue("username")
 	password := c.FormValue("password")
 
-	if username == h.username && password == h.password {
+	if h.sessions != nil {
+		pair, ok, err := h.signIn(c, username, password)
+		if err != nil {
+			return c.HTML(http.StatusInternalServerError, `<div class="alert alert-danger">Failed to start session</div>`)
+		}
+		if ok {
+			h.setSessionCookies(c, pair)
+			c.Response().Header().Set("HX-Redirect", "/admin/dashboard")
+			return c.String(http.StatusOK, "Login successful. Redirecting...")
+		}
+	} else if !h.basicAuth {
+		return c.HTML(http.StatusUnauthorized, `<div class="alert alert-danger">Sign-in needs MongoDB sessions or admin.basicAuth</div>`)
+	} else if _, ok := h.credentialsRole(c, username, password); ok {
 		authValue := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
 		cookie := http.Cookie{
 			Name:     "Authorization",
 			Value:    authValue,
 			Path:     "/admin",
 			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
 			MaxAge:   3600 * 24,
 		}
 		c.SetCookie(&cookie)
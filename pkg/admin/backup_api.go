@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/backup"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BackupHandler exposes scheduled configuration backups
+type BackupHandler struct {
+	scheduler *backup.Scheduler
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(scheduler *backup.Scheduler) *BackupHandler {
+	return &BackupHandler{scheduler: scheduler}
+}
+
+// RegisterRoutes registers the backup API routes
+func (h *BackupHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/backups/schedule", h.getSchedule)
+	g.POST("/api/backups/run", h.run)
+}
+
+// getSchedule returns the backup schedule, when the next backup is due and
+// the outcome of the last one
+func (h *BackupHandler) getSchedule(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.scheduler.Status())
+}
+
+// run takes a backup now, outside the schedule
+func (h *BackupHandler) run(c echo.Context) error {
+	result, err := h.scheduler.Run(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, result)
+	}
+	return c.JSON(http.StatusOK, result)
+}
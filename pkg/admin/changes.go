@@ -0,0 +1,271 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// SessionHeader identifies the admin UI session a change was made from, so
+// that the session is not told about its own changes
+const SessionHeader = "X-Admin-Session"
+
+// Kinds of admin changes
+const (
+	ChangeConfig  = "config"
+	ChangeService = "service"
+	ChangePlugin  = "plugin"
+)
+
+// changeSendBuffer is how many notifications may wait for a slow session
+// before it misses some
+const changeSendBuffer = 16
+
+// ChangeEvent tells admin sessions that another admin changed the gateway
+type ChangeEvent struct {
+	Type   string    `json:"type"` // Always "change"
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Kind   string    `json:"kind"`
+	Action string    `json:"action"` // created, updated or deleted
+	Target string    `json:"target"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+}
+
+// changeRoute maps admin paths starting with prefix to a kind of change
+type changeRoute struct {
+	prefix string
+	kind   string
+}
+
+var changeRoutes = []changeRoute{
+	{"/admin/services", ChangeService},
+	{"/admin/api/declarative/services", ChangeService},
+	{"/admin/api/plugins", ChangePlugin},
+	{"/admin/api/plugin-binaries", ChangePlugin},
+	{"/admin/api/middleware", ChangePlugin},
+	{"/admin/api/settings", ChangeConfig},
+	{"/admin/api/declarative", ChangeConfig},
+	{"/admin/api/gitops/sync", ChangeConfig},
+	{"/admin/api/ipfilter", ChangeConfig},
+}
+
+// readOnlyChanges are state-changing requests that leave the configuration
+// as it is
+var readOnlyChanges = []string{
+	"/admin/api/settings/validate",
+	"/admin/api/settings/cache/clear",
+	"/admin/api/plugins/build",
+	"/admin/api/plugins/test/",
+	"/admin/api/middleware/compile",
+	"/admin/api/middleware/*/test",
+	"/admin/api/middleware/*/metrics/reset",
+}
+
+// ChangeNotifier pushes the changes admins make to the configuration,
+// services and plugins to every other connected admin UI session, so that
+// operators do not keep editing stale state
+type ChangeNotifier struct {
+	logger   *logrus.Logger
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	sessions map[string]chan []byte
+}
+
+// NewChangeNotifier creates a notifier without connected sessions
+func NewChangeNotifier(logger *logrus.Logger) *ChangeNotifier {
+	return &ChangeNotifier{
+		logger:   logger,
+		sessions: make(map[string]chan []byte),
+	}
+}
+
+// Sessions returns the number of connected admin sessions
+func (n *ChangeNotifier) Sessions() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sessions)
+}
+
+// Notify sends event to every session but the one it was made from
+func (n *ChangeNotifier) Notify(event ChangeEvent, fromSession string) {
+	event.Type = "change"
+	data, err := json.Marshal(event)
+	if err != nil {
+		n.logger.WithError(err).Error("Failed to marshal change notification")
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for id, send := range n.sessions {
+		if id == fromSession {
+			continue
+		}
+		select {
+		case send <- data:
+		default:
+			n.logger.WithField("session", id).Warn("Admin session is too slow, dropping change notification")
+		}
+	}
+}
+
+// Middleware notifies the other sessions of every successful request that
+// changes the configuration, services or plugins
+func (n *ChangeNotifier) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+
+		req := c.Request()
+		switch req.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return err
+		}
+		if err != nil || c.Response().Status >= http.StatusBadRequest || dryRun(c) {
+			return err
+		}
+		kind := changeKind(req.URL.Path)
+		if kind == "" {
+			return err
+		}
+
+		user, ok := requestUser(c)
+		if !ok {
+			user = "anonymous"
+		}
+		n.Notify(ChangeEvent{
+			Time:   time.Now(),
+			User:   user,
+			Kind:   kind,
+			Action: changeAction(c, kind),
+			Target: changeTarget(c, kind),
+			Method: req.Method,
+			Path:   req.URL.Path,
+		}, req.Header.Get(SessionHeader))
+		return err
+	}
+}
+
+// HandleWebSocket streams change notifications to an admin UI session. The
+// first message names the session, which the UI sends back in SessionHeader.
+func (n *ChangeNotifier) HandleWebSocket(c echo.Context) error {
+	ws, err := n.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return nil // Upgrade has already replied
+	}
+	defer ws.Close()
+
+	id := uuid.NewString()
+	send := make(chan []byte, changeSendBuffer)
+	n.mu.Lock()
+	n.sessions[id] = send
+	n.mu.Unlock()
+	defer func() {
+		n.mu.Lock()
+		delete(n.sessions, id)
+		n.mu.Unlock()
+	}()
+
+	if err := ws.WriteJSON(map[string]string{"type": "hello", "session": id}); err != nil {
+		return nil
+	}
+
+	// Reads only detect the session going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return nil
+		case data := <-send:
+			ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// changeKind returns the kind of change a request to path makes, or "" if
+// it does not change the configuration, services or plugins
+func changeKind(path string) string {
+	for _, pattern := range readOnlyChanges {
+		if matchChangePath(pattern, path) {
+			return ""
+		}
+	}
+	for _, route := range changeRoutes {
+		if path == route.prefix || strings.HasPrefix(path, route.prefix+"/") {
+			return route.kind
+		}
+	}
+	return ""
+}
+
+// matchChangePath matches path against pattern, where * stands for one path
+// segment and a trailing slash for any remainder
+func matchChangePath(pattern, path string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	for i, part := range patternParts {
+		if i == len(patternParts)-1 && part == "" {
+			return len(pathParts) > i
+		}
+		if i >= len(pathParts) || (part != "*" && part != pathParts[i]) {
+			return false
+		}
+	}
+	return len(pathParts) == len(patternParts)
+}
+
+// changeAction tells creating a service or plugin, which posts to the
+// collection, from updating or deleting one
+func changeAction(c echo.Context, kind string) string {
+	switch {
+	case c.Request().Method == http.MethodDelete:
+		return "deleted"
+	case c.Request().Method == http.MethodPost && kind != ChangeConfig && routeTarget(c) == "":
+		return "created"
+	default:
+		return "updated"
+	}
+}
+
+// changeTarget returns the name of the changed service or plugin, or the
+// changed section of the configuration, as in "server" for
+// /admin/api/settings/server
+func changeTarget(c echo.Context, kind string) string {
+	if target := routeTarget(c); target != "" || kind != ChangeConfig {
+		return target
+	}
+	path := c.Request().URL.Path
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// routeTarget returns the name or ID in the route of the request, if any
+func routeTarget(c echo.Context) string {
+	for _, param := range []string{"name", "id"} {
+		if value := c.Param(param); value != "" {
+			return value
+		}
+	}
+	return ""
+}
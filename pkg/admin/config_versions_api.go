@@ -0,0 +1,362 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// versionTimeFormat is the layout of the time in the names of the versions
+// a rollback saves
+const versionTimeFormat = "20060102-150405.000"
+
+// ConfigVersionStore keeps the versions of the configuration and the audit log
+type ConfigVersionStore interface {
+	SaveConfig(ctx context.Context, doc *mongodb.ConfigDocument) error
+	GetConfigByVersion(ctx context.Context, version string) (*mongodb.ConfigDocument, error)
+	ListConfigs(ctx context.Context, limit int) ([]*mongodb.ConfigDocument, error)
+	CreateAuditLog(ctx context.Context, log *mongodb.AuditLogDocument) error
+}
+
+// ConfigVersion summarizes a stored configuration version
+type ConfigVersion struct {
+	Version      string    `json:"version"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"createdAt"`
+	CreatedBy    string    `json:"createdBy,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	CommitSHA    string    `json:"commitSha,omitempty"`
+	RestoredFrom string    `json:"restoredFrom,omitempty"`
+}
+
+// ConfigChange is a setting that differs between two versions. Path names
+// list elements by their name when they have one, as in services[orders].
+type ConfigChange struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"` // added, removed, changed
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// ConfigVersionsHandler lists, compares and rolls back configuration versions
+type ConfigVersionsHandler struct {
+	store    ConfigVersionStore
+	reloader Reloader
+	current  func() *config.Config
+	logger   *logrus.Logger
+	now      func() time.Time
+	mu       sync.Mutex // Serializes rollbacks
+}
+
+// NewConfigVersionsHandler creates a new config versions handler. current
+// returns the configuration running, which is saved before a rollback.
+func NewConfigVersionsHandler(store ConfigVersionStore, reloader Reloader, current func() *config.Config, logger *logrus.Logger) *ConfigVersionsHandler {
+	return &ConfigVersionsHandler{
+		store:    store,
+		reloader: reloader,
+		current:  current,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// RegisterRoutes registers the config version routes
+func (h *ConfigVersionsHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/config/versions", h.listVersions)
+	g.GET("/api/config/versions/:version", h.getVersion)
+	g.GET("/api/config/diff", h.diffVersions)
+	g.POST("/api/config/versions/:version/rollback", h.rollback)
+}
+
+func (h *ConfigVersionsHandler) listVersions(c echo.Context) error {
+	limit := 50
+	if raw := c.QueryParam("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be a positive number"})
+		}
+		limit = n
+	}
+
+	docs, err := h.store.ListConfigs(c.Request().Context(), limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list config versions")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list config versions"})
+	}
+
+	versions := make([]ConfigVersion, 0, len(docs))
+	for _, doc := range docs {
+		versions = append(versions, ConfigVersion{
+			Version:      doc.Version,
+			Active:       doc.Active,
+			CreatedAt:    doc.CreatedAt,
+			CreatedBy:    doc.CreatedBy,
+			Source:       doc.Source,
+			CommitSHA:    doc.CommitSHA,
+			RestoredFrom: doc.RestoredFrom,
+		})
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (h *ConfigVersionsHandler) getVersion(c echo.Context) error {
+	doc, err := h.store.GetConfigByVersion(c.Request().Context(), c.Param("version"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+	return c.JSON(http.StatusOK, doc)
+}
+
+// diffVersions lists the changes from one version to another
+func (h *ConfigVersionsHandler) diffVersions(c echo.Context) error {
+	from, to := c.QueryParam("from"), c.QueryParam("to")
+	if from == "" || to == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from and to versions are required"})
+	}
+
+	ctx := c.Request().Context()
+	fromValues, err := h.versionValues(ctx, from)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	toValues, err := h.versionValues(ctx, to)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+
+	changes := []ConfigChange{}
+	diffValues("", fromValues, toValues, &changes)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"changes": changes,
+	})
+}
+
+// versionValues returns the settings of a version, read back through the
+// configuration so that versions saved by different releases compare alike
+func (h *ConfigVersionsHandler) versionValues(ctx context.Context, version string) (map[string]interface{}, error) {
+	doc, err := h.store.GetConfigByVersion(ctx, version)
+	if err != nil {
+		return nil, fmt.Errorf("version %s not found", version)
+	}
+	cfg, err := mongodb.MapToConfig(doc.Config)
+	if err != nil {
+		return nil, fmt.Errorf("version %s is unreadable: %w", version, err)
+	}
+	return mongodb.ConfigToMap(cfg)
+}
+
+// rollback applies a stored version, after saving the configuration running
+// as a backup version. The version applied is saved as the active one.
+func (h *ConfigVersionsHandler) rollback(c echo.Context) error {
+	version := c.Param("version")
+	user := reviewer(c)
+	ctx := c.Request().Context()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	target, err := h.store.GetConfigByVersion(ctx, version)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Version not found"})
+	}
+	cfg, err := mongodb.MapToConfig(target.Config)
+	if err != nil {
+		h.audit(c, user, version, false, err.Error(), nil)
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	cfg.SetDefaults()
+
+	current, err := mongodb.ConfigToMap(h.current())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to convert the running configuration")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to back up the running configuration"})
+	}
+	stamp := h.now().UTC().Format(versionTimeFormat)
+	backup := &mongodb.ConfigDocument{
+		Version:   "backup-" + stamp,
+		Config:    current,
+		CreatedBy: user,
+		Source:    "backup",
+	}
+	if err := h.store.SaveConfig(ctx, backup); err != nil {
+		h.logger.WithError(err).Error("Failed to back up the running configuration")
+		h.audit(c, user, version, false, "failed to back up the running configuration", nil)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to back up the running configuration"})
+	}
+
+	report, err := h.reloader.Reload(cfg)
+	if err != nil {
+		h.audit(c, user, version, false, err.Error(), map[string]interface{}{"backup": backup.Version})
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	restored := &mongodb.ConfigDocument{
+		Version:      "rollback-" + stamp,
+		Config:       target.Config,
+		Active:       true,
+		CreatedBy:    user,
+		Source:       "rollback",
+		CommitSHA:    target.CommitSHA,
+		RestoredFrom: target.Version,
+	}
+	if err := h.store.SaveConfig(ctx, restored); err != nil {
+		h.logger.WithError(err).Error("Failed to record the rolled back configuration")
+	}
+	h.audit(c, user, version, true, "", map[string]interface{}{
+		"backup":  backup.Version,
+		"version": restored.Version,
+	})
+
+	h.logger.WithFields(logrus.Fields{
+		"version": version,
+		"backup":  backup.Version,
+		"user":    user,
+	}).Info("Configuration rolled back")
+
+	message := "Configuration rolled back"
+	if len(report.RequiresRestart) > 0 {
+		message = "Configuration rolled back. Some changes require a restart to take effect."
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":         message,
+		"version":         restored.Version,
+		"backup":          backup.Version,
+		"applied":         report.Applied,
+		"requiresRestart": report.RequiresRestart,
+	})
+}
+
+// audit records a rollback in the audit log
+func (h *ConfigVersionsHandler) audit(c echo.Context, user, version string, success bool, message string, changes map[string]interface{}) {
+	status := "success"
+	if !success {
+		status = "failure"
+	}
+	if changes == nil {
+		changes = map[string]interface{}{}
+	}
+	changes["restoredFrom"] = version
+	err := h.store.CreateAuditLog(c.Request().Context(), &mongodb.AuditLogDocument{
+		Action:    "config.rollback",
+		Resource:  "config",
+		Username:  user,
+		IPAddress: c.RealIP(),
+		Changes:   changes,
+		Status:    status,
+		Message:   message,
+	})
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to record config rollback in the audit log")
+	}
+}
+
+// diffValues appends the changes from one value to another below path
+func diffValues(path string, from, to interface{}, changes *[]ConfigChange) {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		keys := make([]string, 0, len(fromMap)+len(toMap))
+		for k := range fromMap {
+			keys = append(keys, k)
+		}
+		for k := range toMap {
+			if _, ok := fromMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffEntry(joinPath(path, k), fromMap, toMap, k, changes)
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]interface{})
+	toList, toIsList := to.([]interface{})
+	if fromIsList && toIsList {
+		fromNamed, fromOK := byName(fromList)
+		toNamed, toOK := byName(toList)
+		if fromOK && toOK {
+			names := make([]string, 0, len(fromNamed)+len(toNamed))
+			for _, v := range fromList {
+				names = append(names, v.(map[string]interface{})["name"].(string))
+			}
+			for _, v := range toList {
+				if name := v.(map[string]interface{})["name"].(string); fromNamed[name] == nil {
+					names = append(names, name)
+				}
+			}
+			for _, name := range names {
+				diffEntry(path+"["+name+"]", fromNamed, toNamed, name, changes)
+			}
+			return
+		}
+		for i := 0; i < len(fromList) || i < len(toList); i++ {
+			elementPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(fromList):
+				*changes = append(*changes, ConfigChange{Path: elementPath, Type: "added", To: toList[i]})
+			case i >= len(toList):
+				*changes = append(*changes, ConfigChange{Path: elementPath, Type: "removed", From: fromList[i]})
+			default:
+				diffValues(elementPath, fromList[i], toList[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, ConfigChange{Path: path, Type: "changed", From: from, To: to})
+	}
+}
+
+// diffEntry compares the entries under key of two maps
+func diffEntry(path string, from, to map[string]interface{}, key string, changes *[]ConfigChange) {
+	fromValue, inFrom := from[key]
+	toValue, inTo := to[key]
+	switch {
+	case !inFrom:
+		*changes = append(*changes, ConfigChange{Path: path, Type: "added", To: toValue})
+	case !inTo:
+		*changes = append(*changes, ConfigChange{Path: path, Type: "removed", From: fromValue})
+	default:
+		diffValues(path, fromValue, toValue, changes)
+	}
+}
+
+// byName indexes a list whose elements all have distinct names
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	named := make(map[string]interface{}, len(list))
+	for _, v := range list {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || name == "" || named[name] != nil {
+			return nil, false
+		}
+		named[name] = m
+	}
+	return named, true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
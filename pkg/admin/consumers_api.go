@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"odin/pkg/consumers"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConsumersHandler manages consumers and their credentials
+type ConsumersHandler struct {
+	registry *consumers.Registry
+}
+
+// NewConsumersHandler creates a new consumers handler
+func NewConsumersHandler(registry *consumers.Registry) *ConsumersHandler {
+	return &ConsumersHandler{registry: registry}
+}
+
+// RegisterRoutes registers the consumer API routes
+func (h *ConsumersHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/consumers", h.listConsumers)
+	g.POST("/api/consumers", h.createConsumer)
+	g.GET("/api/consumers/:id", h.getConsumer)
+	g.PUT("/api/consumers/:id", h.updateConsumer)
+	g.DELETE("/api/consumers/:id", h.deleteConsumer)
+}
+
+// consumerRequest is the body accepted when creating or replacing a consumer
+type consumerRequest struct {
+	Username         string                     `json:"username"`
+	CustomID         string                     `json:"customId"`
+	Tags             []string                   `json:"tags"`
+	Enabled          *bool                      `json:"enabled"` // default: true
+	APIKeyIDs        []string                   `json:"apiKeyIds"`
+	CertFingerprints []string                   `json:"certFingerprints"`
+	JWTSubjects      []string                   `json:"jwtSubjects"`
+	HMACKeys         []mongodb.ConsumerHMACKey  `json:"hmacKeys"` // Keys without a secret keep the one they have
+	Services         []string                   `json:"services"`
+	RateLimit        *mongodb.ConsumerRateLimit `json:"rateLimit"`
+	Headers          map[string]string          `json:"headers"`
+}
+
+func (r *consumerRequest) document() *mongodb.ConsumerDocument {
+	enabled := r.Enabled == nil || *r.Enabled
+	return &mongodb.ConsumerDocument{
+		Username:         r.Username,
+		CustomID:         r.CustomID,
+		Tags:             r.Tags,
+		Enabled:          enabled,
+		APIKeyIDs:        r.APIKeyIDs,
+		CertFingerprints: r.CertFingerprints,
+		JWTSubjects:      r.JWTSubjects,
+		HMACKeys:         r.HMACKeys,
+		Services:         r.Services,
+		RateLimit:        r.RateLimit,
+		Headers:          r.Headers,
+	}
+}
+
+// listConsumers returns every consumer, optionally only those with a tag
+func (h *ConsumersHandler) listConsumers(c echo.Context) error {
+	list := h.registry.List()
+
+	if tag := c.QueryParam("tag"); tag != "" {
+		filtered := make([]*mongodb.ConsumerDocument, 0, len(list))
+		for _, consumer := range list {
+			for _, t := range consumer.Tags {
+				if t == tag {
+					filtered = append(filtered, consumer)
+					break
+				}
+			}
+		}
+		list = filtered
+	}
+
+	redacted := make([]*mongodb.ConsumerDocument, len(list))
+	for i, consumer := range list {
+		redacted[i] = redact(consumer)
+	}
+	return c.JSON(http.StatusOK, redacted)
+}
+
+func (h *ConsumersHandler) getConsumer(c echo.Context) error {
+	consumer, ok := h.registry.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": consumers.ErrNotFound.Error()})
+	}
+	return c.JSON(http.StatusOK, redact(consumer))
+}
+
+func (h *ConsumersHandler) createConsumer(c echo.Context) error {
+	var req consumerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	consumer := req.document()
+	if err := h.registry.Create(c.Request().Context(), consumer); err != nil {
+		return consumerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, redact(consumer))
+}
+
+// updateConsumer replaces a consumer, credentials included. HMAC keys
+// sent without a secret keep their current one, so a consumer read from
+// the API can be sent back as is.
+func (h *ConsumersHandler) updateConsumer(c echo.Context) error {
+	var req consumerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	consumer := req.document()
+	if existing, ok := h.registry.Get(c.Param("id")); ok {
+		for i, key := range consumer.HMACKeys {
+			if key.Secret != "" {
+				continue
+			}
+			for _, current := range existing.HMACKeys {
+				if current.ID == key.ID {
+					consumer.HMACKeys[i].Secret = current.Secret
+				}
+			}
+		}
+	}
+	if err := h.registry.Update(c.Request().Context(), c.Param("id"), consumer); err != nil {
+		return consumerError(c, err)
+	}
+	return c.JSON(http.StatusOK, redact(consumer))
+}
+
+func (h *ConsumersHandler) deleteConsumer(c echo.Context) error {
+	if err := h.registry.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return consumerError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "consumer deleted"})
+}
+
+// redact returns a copy of consumer without its HMAC secrets, which the
+// API accepts but never returns
+func redact(consumer *mongodb.ConsumerDocument) *mongodb.ConsumerDocument {
+	copied := *consumer
+	copied.HMACKeys = make([]mongodb.ConsumerHMACKey, len(consumer.HMACKeys))
+	for i, key := range consumer.HMACKeys {
+		copied.HMACKeys[i] = mongodb.ConsumerHMACKey{ID: key.ID}
+	}
+	return &copied
+}
+
+// consumerError answers with the status matching a registry error
+func consumerError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, consumers.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, consumers.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, consumers.ErrConflict):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,500 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// maxDesiredStateSize bounds the size of a desired-state document
+const maxDesiredStateSize = 1 << 20
+
+// Reconcile outcomes reported by the declarative API
+const (
+	ReconcileCreated   = "created"
+	ReconcileUpdated   = "updated"
+	ReconcileUnchanged = "unchanged"
+	ReconcileDeleted   = "deleted"
+	ReconcileAbsent    = "absent"
+)
+
+// DesiredResource is the representation returned by the declarative API.
+// ID is stable for the lifetime of the resource and derived from its kind and name.
+type DesiredResource struct {
+	ID     string                 `json:"id"`
+	Kind   string                 `json:"kind"`
+	Name   string                 `json:"name"`
+	ETag   string                 `json:"etag"`
+	Result string                 `json:"result,omitempty"`
+	Spec   map[string]interface{} `json:"spec,omitempty"`
+}
+
+// declarativeKind describes how a resource kind is stored in the configuration
+type declarativeKind struct {
+	name    string
+	newItem func() interface{}
+	items   func(cfg *config.Config) []interface{}
+	nameOf  func(item interface{}) string
+	prepare func(item interface{}, name string) error
+	store   func(cfg *config.Config, index int, item interface{})
+	remove  func(cfg *config.Config, index int)
+}
+
+var declarativeKinds = map[string]*declarativeKind{
+	"services": {
+		name:    "service",
+		newItem: func() interface{} { return &config.ServiceConfig{} },
+		items: func(cfg *config.Config) []interface{} {
+			items := make([]interface{}, len(cfg.Services))
+			for i := range cfg.Services {
+				items[i] = &cfg.Services[i]
+			}
+			return items
+		},
+		nameOf: func(item interface{}) string { return item.(*config.ServiceConfig).Name },
+		prepare: func(item interface{}, name string) error {
+			svc := item.(*config.ServiceConfig)
+			if err := claimName(&svc.Name, name); err != nil {
+				return err
+			}
+			svc.SetDefaults()
+			return nil
+		},
+		store: func(cfg *config.Config, index int, item interface{}) {
+			svc := *item.(*config.ServiceConfig)
+			if index < 0 {
+				cfg.Services = append(cfg.Services, svc)
+				return
+			}
+			cfg.Services[index] = svc
+		},
+		remove: func(cfg *config.Config, index int) {
+			cfg.Services = append(cfg.Services[:index], cfg.Services[index+1:]...)
+		},
+	},
+	"clusters": {
+		name:    "cluster",
+		newItem: func() interface{} { return &config.ClusterConfig{} },
+		items: func(cfg *config.Config) []interface{} {
+			items := make([]interface{}, len(cfg.MultiCluster.Clusters))
+			for i := range cfg.MultiCluster.Clusters {
+				items[i] = &cfg.MultiCluster.Clusters[i]
+			}
+			return items
+		},
+		nameOf: func(item interface{}) string { return item.(*config.ClusterConfig).Name },
+		prepare: func(item interface{}, name string) error {
+			cluster := item.(*config.ClusterConfig)
+			if err := claimName(&cluster.Name, name); err != nil {
+				return err
+			}
+			if cluster.Endpoint == "" {
+				return fmt.Errorf("cluster %s: endpoint cannot be empty", name)
+			}
+			return nil
+		},
+		store: func(cfg *config.Config, index int, item interface{}) {
+			cluster := *item.(*config.ClusterConfig)
+			if index < 0 {
+				cfg.MultiCluster.Clusters = append(cfg.MultiCluster.Clusters, cluster)
+				return
+			}
+			cfg.MultiCluster.Clusters[index] = cluster
+		},
+		remove: func(cfg *config.Config, index int) {
+			clusters := cfg.MultiCluster.Clusters
+			cfg.MultiCluster.Clusters = append(clusters[:index], clusters[index+1:]...)
+		},
+	},
+	"plugins": {
+		name:    "plugin",
+		newItem: func() interface{} { return &config.PluginConfig{} },
+		items: func(cfg *config.Config) []interface{} {
+			items := make([]interface{}, len(cfg.Plugins.Plugins))
+			for i := range cfg.Plugins.Plugins {
+				items[i] = &cfg.Plugins.Plugins[i]
+			}
+			return items
+		},
+		nameOf: func(item interface{}) string { return item.(*config.PluginConfig).Name },
+		prepare: func(item interface{}, name string) error {
+			plugin := item.(*config.PluginConfig)
+			if err := claimName(&plugin.Name, name); err != nil {
+				return err
+			}
+			if plugin.Path == "" {
+				return fmt.Errorf("plugin %s: path cannot be empty", name)
+			}
+			return nil
+		},
+		store: func(cfg *config.Config, index int, item interface{}) {
+			plugin := *item.(*config.PluginConfig)
+			if index < 0 {
+				cfg.Plugins.Plugins = append(cfg.Plugins.Plugins, plugin)
+				return
+			}
+			cfg.Plugins.Plugins[index] = plugin
+		},
+		remove: func(cfg *config.Config, index int) {
+			plugins := cfg.Plugins.Plugins
+			cfg.Plugins.Plugins = append(plugins[:index], plugins[index+1:]...)
+		},
+	},
+}
+
+// registerDeclarativeRoutes registers the desired-state API used by
+// infrastructure-as-code tools
+func (h *AdminHandler) registerDeclarativeRoutes(g *echo.Group) {
+	desired := g.Group("/api/declarative/:kind")
+
+	desired.GET("", h.listDesired)
+	desired.GET("/:name", h.getDesired)
+	desired.PUT("/:name", h.putDesired)
+	desired.DELETE("/:name", h.deleteDesired)
+}
+
+// listDesired returns every resource of a kind with its current ETag
+func (h *AdminHandler) listDesired(c echo.Context) error {
+	kind, err := lookupKind(c)
+	if err != nil {
+		return err
+	}
+
+	resources := []DesiredResource{}
+	for _, item := range kind.items(h.config.Load()) {
+		res, err := newDesiredResource(kind, item, "")
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		resources = append(resources, *res)
+	}
+
+	return c.JSON(http.StatusOK, resources)
+}
+
+// getDesired returns a single resource. If-None-Match is honoured so clients
+// can cheaply detect drift.
+func (h *AdminHandler) getDesired(c echo.Context) error {
+	kind, err := lookupKind(c)
+	if err != nil {
+		return err
+	}
+
+	item, _ := findDesired(kind, h.config.Load(), c.Param("name"))
+	if item == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("%s %s not found", kind.name, c.Param("name")),
+		})
+	}
+
+	res, err := newDesiredResource(kind, item, "")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	c.Response().Header().Set("ETag", res.ETag)
+	if etagMatches(c.Request().Header.Get("If-None-Match"), res.ETag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// putDesired reconciles a resource to the submitted desired state. The
+// document replaces the resource entirely; submitting the current state is a
+// no-op and leaves the configuration file untouched. With ?dryRun=true the
+// change is validated and its result reported, but not made.
+func (h *AdminHandler) putDesired(c echo.Context) error {
+	kind, err := lookupKind(c)
+	if err != nil {
+		return err
+	}
+	name := c.Param("name")
+
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxDesiredStateSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read request body"})
+	}
+	if len(data) > maxDesiredStateSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "desired state document too large"})
+	}
+
+	// YAML is a superset of JSON, so both are accepted and durations such as
+	// "30s" decode the same way as in the configuration file
+	desired := kind.newItem()
+	if err := yaml.Unmarshal(data, desired); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid desired state: " + err.Error()})
+	}
+	if err := kind.prepare(desired, name); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	desiredTag, err := computeETag(desired)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Preconditions are checked and the change made under the configuration
+	// lock, so no other change slips in between
+	result, status := ReconcileUnchanged, http.StatusOK
+	var stored interface{}
+	err = h.config.Swap(func(cfg *config.Config) (*config.Config, error) {
+		current, index := findDesired(kind, cfg, name)
+		currentTag := ""
+		if current != nil {
+			if currentTag, err = computeETag(current); err != nil {
+				return nil, err
+			}
+		}
+		if status, msg := checkPreconditions(c, currentTag, cfg.Admin.RequireIfMatch); status != 0 {
+			return nil, echo.NewHTTPError(status, msg)
+		}
+		if current != nil && currentTag == desiredTag {
+			stored = current
+			return cfg, nil
+		}
+
+		// Validate the whole configuration with the change applied before committing it
+		candidate, err := cfg.Clone()
+		if err != nil {
+			return nil, err
+		}
+		kind.store(candidate, index, desired)
+		if err := config.Validate(candidate); err != nil {
+			return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+
+		result, status = ReconcileUpdated, http.StatusOK
+		if current == nil {
+			result, status = ReconcileCreated, http.StatusCreated
+		}
+		stored = desired
+		if dryRun(c) {
+			return cfg, nil
+		}
+		if err := h.saveConfig(candidate); err != nil {
+			return nil, fmt.Errorf("failed to save configuration: %w", err)
+		}
+		return candidate, nil
+	})
+	if err != nil {
+		return declarativeError(c, err)
+	}
+
+	res, err := newDesiredResource(kind, stored, result)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if dryRun(c) && result != ReconcileUnchanged {
+		return c.JSON(http.StatusOK, res)
+	}
+	c.Response().Header().Set("ETag", res.ETag)
+	if result == ReconcileUnchanged {
+		return c.JSON(http.StatusOK, res)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"kind":   kind.name,
+		"name":   name,
+		"result": result,
+	}).Info("Declarative resource reconciled")
+
+	h.publish(events.EventType(kind.name+"."+result), map[string]interface{}{
+		kind.name: name,
+		"source":  "declarative",
+	})
+
+	return c.JSON(status, res)
+}
+
+// deleteDesired removes a resource. Deleting a resource that does not exist
+// succeeds, so repeated deletes are idempotent. ?dryRun=true reports the
+// result without deleting.
+func (h *AdminHandler) deleteDesired(c echo.Context) error {
+	kind, err := lookupKind(c)
+	if err != nil {
+		return err
+	}
+	name := c.Param("name")
+
+	result, currentTag := ReconcileAbsent, ""
+	err = h.config.Swap(func(cfg *config.Config) (*config.Config, error) {
+		current, index := findDesired(kind, cfg, name)
+		if current != nil {
+			if currentTag, err = computeETag(current); err != nil {
+				return nil, err
+			}
+		}
+		if status, msg := checkPreconditions(c, currentTag, cfg.Admin.RequireIfMatch); status != 0 {
+			return nil, echo.NewHTTPError(status, msg)
+		}
+		if current == nil {
+			return cfg, nil
+		}
+
+		// Other sections may refer to the resource, so the configuration
+		// without it is validated too
+		candidate, err := cfg.Clone()
+		if err != nil {
+			return nil, err
+		}
+		kind.remove(candidate, index)
+		if err := config.Validate(candidate); err != nil {
+			return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+
+		result = ReconcileDeleted
+		if dryRun(c) {
+			return cfg, nil
+		}
+		if err := h.saveConfig(candidate); err != nil {
+			return nil, fmt.Errorf("failed to save configuration: %w", err)
+		}
+		return candidate, nil
+	})
+	if err != nil {
+		return declarativeError(c, err)
+	}
+
+	res := DesiredResource{
+		ID:     resourceID(kind, name),
+		Kind:   kind.name,
+		Name:   name,
+		ETag:   currentTag,
+		Result: result,
+	}
+	if result == ReconcileAbsent || dryRun(c) {
+		return c.JSON(http.StatusOK, res)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"kind": kind.name,
+		"name": name,
+	}).Info("Declarative resource deleted")
+
+	h.publish(events.EventType(kind.name+"."+ReconcileDeleted), map[string]interface{}{
+		kind.name: name,
+		"source":  "declarative",
+	})
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// declarativeError answers with the status of err, or 500
+func declarativeError(c echo.Context, err error) error {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return c.JSON(he.Code, map[string]string{"error": fmt.Sprint(he.Message)})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+func lookupKind(c echo.Context) (*declarativeKind, error) {
+	kind, ok := declarativeKinds[c.Param("kind")]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("unknown resource kind %q", c.Param("kind")))
+	}
+	return kind, nil
+}
+
+func findDesired(kind *declarativeKind, cfg *config.Config, name string) (interface{}, int) {
+	for i, item := range kind.items(cfg) {
+		if kind.nameOf(item) == name {
+			return item, i
+		}
+	}
+	return nil, -1
+}
+
+// claimName sets the resource name from the URL, rejecting documents that name a different resource
+func claimName(field *string, name string) error {
+	if *field != "" && *field != name {
+		return fmt.Errorf("name %q in document does not match %q in URL", *field, name)
+	}
+	*field = name
+	return nil
+}
+
+// checkPreconditions evaluates If-Match and If-None-Match against the current
+// ETag (empty when the resource does not exist). With requireIfMatch, changes
+// to an existing resource must carry If-Match. It returns a non-zero status
+// when the request must be rejected.
+func checkPreconditions(c echo.Context, currentTag string, requireIfMatch bool) (int, string) {
+	ifMatch := c.Request().Header.Get("If-Match")
+	if requireIfMatch && ifMatch == "" && currentTag != "" {
+		return http.StatusPreconditionRequired, "changes to an existing resource require If-Match"
+	}
+	if ifMatch != "" {
+		if currentTag == "" || !etagMatches(ifMatch, currentTag) {
+			return http.StatusPreconditionFailed, "resource has been modified or does not exist (If-Match failed)"
+		}
+	}
+	if ifNoneMatch := c.Request().Header.Get("If-None-Match"); ifNoneMatch != "" && currentTag != "" {
+		if etagMatches(ifNoneMatch, currentTag) {
+			return http.StatusPreconditionFailed, "resource already exists (If-None-Match failed)"
+		}
+	}
+	return 0, ""
+}
+
+// etagMatches reports whether a comma-separated If-Match/If-None-Match header matches tag
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// computeETag derives a strong ETag from the canonical YAML form of a resource
+func computeETag(item interface{}) (string, error) {
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resource: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+func resourceID(kind *declarativeKind, name string) string {
+	return kind.name + "/" + name
+}
+
+func newDesiredResource(kind *declarativeKind, item interface{}, result string) (*DesiredResource, error) {
+	etag, err := computeETag(item)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round-trip through YAML so the spec uses the same keys as the configuration file
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	name := kind.nameOf(item)
+	return &DesiredResource{
+		ID:     resourceID(kind, name),
+		Kind:   kind.name,
+		Name:   name,
+		ETag:   etag,
+		Result: result,
+		Spec:   spec,
+	}, nil
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/dlp"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DLPHandler exposes the audit counters of response DLP rules
+type DLPHandler struct {
+	stats *dlp.Stats
+}
+
+// NewDLPHandler creates a new DLP handler
+func NewDLPHandler(stats *dlp.Stats) *DLPHandler {
+	return &DLPHandler{stats: stats}
+}
+
+// RegisterRoutes registers the DLP API routes
+func (h *DLPHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/dlp/stats", h.getStats)
+}
+
+// getStats returns how often each rule masked or dropped a value
+func (h *DLPHandler) getStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"counters": h.stats.Snapshot(),
+	})
+}
@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// EventsHandler exposes the event dead-letter queue
+type EventsHandler struct {
+	bus    *events.Bus
+	repo   mongodb.Repository
+	logger *logrus.Logger
+}
+
+// NewEventsHandler creates a new events handler. repo may be nil when MongoDB
+// is disabled, in which case no dead letters are kept.
+func NewEventsHandler(bus *events.Bus, repo mongodb.Repository, logger *logrus.Logger) *EventsHandler {
+	return &EventsHandler{
+		bus:    bus,
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers the events API routes
+func (h *EventsHandler) RegisterRoutes(g *echo.Group) {
+	g.POST("/api/events/test", h.publishTestEvent)
+	g.GET("/api/events/dead-letters", h.listDeadLetters)
+	g.POST("/api/events/dead-letters/:id/redeliver", h.redeliverDeadLetter)
+	g.DELETE("/api/events/dead-letters/:id", h.deleteDeadLetter)
+}
+
+// publishTestEvent emits an event so webhook receivers can be verified
+func (h *EventsHandler) publishTestEvent(c echo.Context) error {
+	h.bus.Publish("gateway.test", map[string]interface{}{
+		"message": "test event from the admin API",
+	})
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": "test event queued",
+	})
+}
+
+// listDeadLetters returns the most recent failed deliveries
+func (h *EventsHandler) listDeadLetters(c echo.Context) error {
+	if h.repo == nil {
+		return c.JSON(http.StatusOK, []*mongodb.DeadLetterDocument{})
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	letters, err := h.repo.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if letters == nil {
+		letters = []*mongodb.DeadLetterDocument{}
+	}
+
+	return c.JSON(http.StatusOK, letters)
+}
+
+// redeliverDeadLetter retries a failed delivery and removes it on success
+func (h *EventsHandler) redeliverDeadLetter(c echo.Context) error {
+	if h.repo == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "dead letters require MongoDB",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	letter, err := h.repo.GetDeadLetter(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.bus.Redeliver(letter); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.repo.DeleteDeadLetter(ctx, letter.ID); err != nil {
+		h.logger.WithError(err).Warn("Failed to remove redelivered dead letter")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "event redelivered",
+	})
+}
+
+// deleteDeadLetter discards a failed delivery
+func (h *EventsHandler) deleteDeadLetter(c echo.Context) error {
+	if h.repo == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "dead letters require MongoDB",
+		})
+	}
+
+	if err := h.repo.DeleteDeadLetter(c.Request().Context(), c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/faults"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FaultsHandler turns fault injection into services on and off at runtime
+type FaultsHandler struct {
+	injector *faults.Injector
+}
+
+// NewFaultsHandler creates a new fault injection handler
+func NewFaultsHandler(injector *faults.Injector) *FaultsHandler {
+	return &FaultsHandler{injector: injector}
+}
+
+// RegisterRoutes registers the fault injection API routes
+func (h *FaultsHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/faults", h.listFaults)
+	g.PUT("/api/faults/:service", h.setFault)
+	g.DELETE("/api/faults/:service", h.clearFault)
+	g.DELETE("/api/faults", h.clearFaults)
+}
+
+// faultView is a fault as the API shows it, with readable durations
+type faultView struct {
+	DelayPercentage float64   `json:"delayPercentage,omitempty"`
+	Delay           string    `json:"delay,omitempty"`
+	ErrorPercentage float64   `json:"errorPercentage,omitempty"`
+	ErrorStatus     int       `json:"errorStatus,omitempty"`
+	AbortPercentage float64   `json:"abortPercentage,omitempty"`
+	ExpiresAt       time.Time `json:"expiresAt,omitzero"`
+}
+
+func newFaultView(f faults.Fault) faultView {
+	v := faultView{
+		DelayPercentage: f.DelayPercentage,
+		ErrorPercentage: f.ErrorPercentage,
+		ErrorStatus:     f.ErrorStatus,
+		AbortPercentage: f.AbortPercentage,
+		ExpiresAt:       f.ExpiresAt,
+	}
+	if f.Delay > 0 {
+		v.Delay = f.Delay.String()
+	}
+	return v
+}
+
+// listFaults returns whether faults are allowed and those in effect
+func (h *FaultsHandler) listFaults(c echo.Context) error {
+	views := make(map[string]faultView)
+	for service, f := range h.injector.Faults() {
+		views[service] = newFaultView(f)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"environment": h.injector.Environment(),
+		"allowed":     h.injector.Allowed(),
+		"faults":      views,
+	})
+}
+
+// setFault replaces the fault of a service, optionally for a limited time
+func (h *FaultsHandler) setFault(c echo.Context) error {
+	var req struct {
+		faultView
+		Duration string `json:"duration"` // How long the fault lasts; until cleared if empty
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	fault := config.FaultConfig{
+		DelayPercentage: req.DelayPercentage,
+		ErrorPercentage: req.ErrorPercentage,
+		ErrorStatus:     req.ErrorStatus,
+		AbortPercentage: req.AbortPercentage,
+	}
+	var ttl time.Duration
+	var err error
+	if req.Delay != "" {
+		if fault.Delay, err = time.ParseDuration(req.Delay); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid delay"})
+		}
+	}
+	if req.Duration != "" {
+		if ttl, err = time.ParseDuration(req.Duration); err != nil || ttl <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid duration"})
+		}
+	}
+
+	f, err := h.injector.Set(c.Param("service"), fault, ttl)
+	switch {
+	case errors.Is(err, faults.ErrNotAllowed):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, faults.ErrUnknownService):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, newFaultView(f))
+}
+
+// clearFault stops injecting faults into a service
+func (h *FaultsHandler) clearFault(c echo.Context) error {
+	if !h.injector.Clear(c.Param("service")) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "service has no fault"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "fault cleared"})
+}
+
+// clearFaults stops injecting faults into all services
+func (h *FaultsHandler) clearFaults(c echo.Context) error {
+	h.injector.ClearAll()
+	return c.JSON(http.StatusOK, map[string]string{"message": "all faults cleared"})
+}
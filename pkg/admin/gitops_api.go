@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+
+	"odin/pkg/gitops"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWebhookPayloadSize bounds the size of push webhook payloads
+const maxWebhookPayloadSize = 5 << 20
+
+// GitOpsHandler handles GitOps status, manual sync and push webhook endpoints
+type GitOpsHandler struct {
+	syncer *gitops.Syncer
+	logger *logrus.Logger
+}
+
+// NewGitOpsHandler creates a new GitOps handler
+func NewGitOpsHandler(syncer *gitops.Syncer, logger *logrus.Logger) *GitOpsHandler {
+	return &GitOpsHandler{
+		syncer: syncer,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers the GitOps API routes. The webhook is registered on
+// the public group because it authenticates with the webhook secret.
+func (h *GitOpsHandler) RegisterRoutes(public, protected *echo.Group) {
+	public.POST("/api/gitops/webhook", h.handleWebhook)
+
+	protected.GET("/api/gitops/status", h.getStatus)
+	protected.POST("/api/gitops/sync", h.triggerSync)
+}
+
+// getStatus returns the current sync status
+func (h *GitOpsHandler) getStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.syncer.Status())
+}
+
+// triggerSync runs a sync synchronously and returns its result
+func (h *GitOpsHandler) triggerSync(c echo.Context) error {
+	result, err := h.syncer.Sync(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// handleWebhook verifies a GitHub or GitLab push webhook and schedules a sync
+func (h *GitOpsHandler) handleWebhook(c echo.Context) error {
+	payload, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookPayloadSize))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "failed to read payload",
+		})
+	}
+
+	req := c.Request()
+	var verified bool
+	switch {
+	case req.Header.Get("X-Hub-Signature-256") != "":
+		verified = h.syncer.VerifySignature(payload, req.Header.Get("X-Hub-Signature-256"))
+	case req.Header.Get("X-Gitlab-Token") != "":
+		verified = h.syncer.VerifyToken(req.Header.Get("X-Gitlab-Token"))
+	}
+
+	if !verified {
+		h.logger.WithField("remote", c.RealIP()).Warn("Rejected GitOps webhook with invalid signature")
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "invalid webhook signature",
+		})
+	}
+
+	h.syncer.Trigger()
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": "sync scheduled",
+	})
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"odin/pkg/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HealthHistoryHandler serves the uptime and latency history of targets
+type HealthHistoryHandler struct {
+	history *health.History
+}
+
+// NewHealthHistoryHandler creates a new health history handler
+func NewHealthHistoryHandler(history *health.History) *HealthHistoryHandler {
+	return &HealthHistoryHandler{history: history}
+}
+
+// RegisterRoutes registers the health history API routes
+func (h *HealthHistoryHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/health/history", h.getHistory)
+}
+
+// getHistory returns the history of each target of a service between from
+// and to, which default to the last 24 hours
+func (h *HealthHistoryHandler) getHistory(c echo.Context) error {
+	service := c.QueryParam("service")
+	if service == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "service is required"})
+	}
+
+	now := time.Now().UTC()
+	from, err := parseUsageTime(c.QueryParam("from"), now.Add(-24*time.Hour), false)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be an RFC 3339 time or a date"})
+	}
+	to, err := parseUsageTime(c.QueryParam("to"), now, true)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be an RFC 3339 time or a date"})
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 30*time.Second)
+	defer cancel()
+
+	targets, err := h.history.Query(ctx, service, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"service": service,
+		"from":    from,
+		"to":      to,
+		"targets": targets,
+	})
+}
@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"odin/pkg/monitoring"
+)
+
+// SettingsImpact estimates how a settings change would have affected the
+// recent requests of each service
+type SettingsImpact struct {
+	Summary  []string        `json:"summary"`
+	Services []ServiceImpact `json:"services"`
+}
+
+// ServiceImpact is the share of a service's recent requests a change affects
+type ServiceImpact struct {
+	Service  string  `json:"service"`
+	Requests int     `json:"requests"` // Recent requests considered
+	Affected int     `json:"affected"`
+	Percent  float64 `json:"percent"`
+	Effect   string  `json:"effect"`
+}
+
+// impactFunc counts the recent requests of a service a change affects
+type impactFunc func(service string, samples []monitoring.RequestSample) int
+
+// estimateImpact applies count to every service with recent requests and
+// describes the services with affected requests as "<effect> x% of requests
+// to <service>"
+func estimateImpact(snapshot map[string][]monitoring.RequestSample, effect string, count impactFunc) *SettingsImpact {
+	impact := &SettingsImpact{Summary: []string{}, Services: []ServiceImpact{}}
+	for service, samples := range snapshot {
+		if len(samples) == 0 {
+			continue
+		}
+		affected := count(service, samples)
+		if affected == 0 {
+			continue
+		}
+		impact.Services = append(impact.Services, ServiceImpact{
+			Service:  service,
+			Requests: len(samples),
+			Affected: affected,
+			Percent:  float64(affected) * 100 / float64(len(samples)),
+			Effect:   effect,
+		})
+	}
+
+	sort.Slice(impact.Services, func(i, j int) bool {
+		if impact.Services[i].Percent != impact.Services[j].Percent {
+			return impact.Services[i].Percent > impact.Services[j].Percent
+		}
+		return impact.Services[i].Service < impact.Services[j].Service
+	})
+	for _, s := range impact.Services {
+		impact.Summary = append(impact.Summary, fmt.Sprintf("%s %.1f%% of requests to %s (%d of the last %d)",
+			s.Effect, s.Percent, s.Service, s.Affected, s.Requests))
+	}
+	return impact
+}
+
+// timeoutImpact counts the requests that took longer than timeout and so
+// would have been cut off
+func timeoutImpact(snapshot map[string][]monitoring.RequestSample, timeout time.Duration) *SettingsImpact {
+	effect := fmt.Sprintf("a %s timeout would have cut off", timeout)
+	return estimateImpact(snapshot, effect, func(_ string, samples []monitoring.RequestSample) int {
+		affected := 0
+		for _, sample := range samples {
+			if sample.Duration > timeout {
+				affected++
+			}
+		}
+		return affected
+	})
+}
+
+// cacheImpact counts the successful GET requests for a path requested again
+// within ttl, which a cache would have served
+func cacheImpact(snapshot map[string][]monitoring.RequestSample, ttl time.Duration, enabled bool) *SettingsImpact {
+	effect := fmt.Sprintf("caching for %s would have served", ttl)
+	if !enabled {
+		effect = "disabling the cache would send to the backend"
+	}
+	return estimateImpact(snapshot, effect, func(_ string, samples []monitoring.RequestSample) int {
+		affected := 0
+		cachedAt := make(map[string]time.Time)
+		for _, sample := range samples {
+			if sample.Method != http.MethodGet || sample.Status != http.StatusOK {
+				continue
+			}
+			if at, ok := cachedAt[sample.Path]; ok && sample.Time.Sub(at) < ttl {
+				affected++
+				continue
+			}
+			cachedAt[sample.Path] = sample.Time
+		}
+		return affected
+	})
+}
+
+// rateLimitImpact counts the requests beyond limit per client in windows of
+// window, across all services, which would have been rejected
+func rateLimitImpact(snapshot map[string][]monitoring.RequestSample, limit int, window time.Duration) *SettingsImpact {
+	type hit struct {
+		service string
+		sample  monitoring.RequestSample
+	}
+	var hits []hit
+	for service, samples := range snapshot {
+		for _, sample := range samples {
+			hits = append(hits, hit{service, sample})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].sample.Time.Before(hits[j].sample.Time)
+	})
+
+	type windowKey struct {
+		client string
+		start  time.Time
+	}
+	counts := make(map[windowKey]int)
+	rejected := make(map[string]int)
+	for _, h := range hits {
+		key := windowKey{h.sample.Client, h.sample.Time.Truncate(window)}
+		counts[key]++
+		if counts[key] > limit {
+			rejected[h.service]++
+		}
+	}
+
+	effect := fmt.Sprintf("a limit of %d per %s would have rejected", limit, window)
+	return estimateImpact(snapshot, effect, func(service string, _ []monitoring.RequestSample) int {
+		return rejected[service]
+	})
+}
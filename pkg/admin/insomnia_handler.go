@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"odin/pkg/config"
+	"odin/pkg/integrations/insomnia"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// maxInsomniaExportSize bounds the size of uploaded Insomnia export files
+const maxInsomniaExportSize = 10 << 20
+
+// InsomniaHandler handles Insomnia import/export API endpoints
+type InsomniaHandler struct {
+	config      *config.Store
+	transformer *insomnia.Transformer
+	logger      *logrus.Logger
+}
+
+// NewInsomniaHandler creates a new Insomnia handler
+func NewInsomniaHandler(cfg *config.Store, logger *logrus.Logger) *InsomniaHandler {
+	return &InsomniaHandler{
+		config:      cfg,
+		transformer: insomnia.NewTransformer(),
+		logger:      logger,
+	}
+}
+
+// RegisterRoutes registers Insomnia API routes
+func (h *InsomniaHandler) RegisterRoutes(g *echo.Group) {
+	integration := g.Group("/integrations/insomnia")
+
+	integration.POST("/import", h.ImportCollection)
+	integration.GET("/export/:service", h.ExportService)
+}
+
+// ImportCollection converts an uploaded Insomnia v4 export into an Odin service
+func (h *InsomniaHandler) ImportCollection(c echo.Context) error {
+	data, err := readInsomniaUpload(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	export, err := insomnia.Parse(data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	serviceName := c.QueryParam("serviceName")
+	service, routes, err := h.transformer.EnhancedTransform(export, serviceName)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("failed to transform export: %v", err),
+		})
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"service": service.Name,
+		"routes":  len(routes),
+	}).Info("Insomnia export imported")
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "collection imported successfully",
+		"service":    service,
+		"routes":     routes,
+		"routeCount": len(routes),
+		"summary":    h.transformer.Summarize(export),
+	})
+}
+
+// ExportService exports a configured Odin service as an Insomnia v4 export
+func (h *InsomniaHandler) ExportService(c echo.Context) error {
+	serviceName := c.Param("service")
+
+	var svc *config.ServiceConfig
+	services := h.config.Load().Services
+	for i := range services {
+		if services[i].Name == serviceName {
+			svc = &services[i]
+			break
+		}
+	}
+
+	if svc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("service not found: %s", serviceName),
+		})
+	}
+
+	export, err := h.transformer.OdinServiceToInsomnia(svc)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("failed to transform service: %v", err),
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s.insomnia.json"`, svc.Name))
+	return c.JSON(http.StatusOK, export)
+}
+
+// readInsomniaUpload reads the export either from a multipart "file" field or the raw body
+func readInsomniaUpload(c echo.Context) ([]byte, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxInsomniaExportSize {
+			return nil, fmt.Errorf("export file too large")
+		}
+		src, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+		}
+		defer src.Close()
+		return io.ReadAll(src)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxInsomniaExportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(data) > maxInsomniaExportSize {
+		return nil, fmt.Errorf("export file too large")
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty request body")
+	}
+
+	return data, nil
+}
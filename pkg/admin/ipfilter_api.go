@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"odin/pkg/ipfilter"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPFilterHandler manages IP allow/deny entries at runtime
+type IPFilterHandler struct {
+	filter *ipfilter.Filter
+}
+
+// NewIPFilterHandler creates a new IP filter handler
+func NewIPFilterHandler(filter *ipfilter.Filter) *IPFilterHandler {
+	return &IPFilterHandler{filter: filter}
+}
+
+// RegisterRoutes registers the IP filter API routes
+func (h *IPFilterHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/ipfilter/entries", h.listEntries)
+	g.POST("/api/ipfilter/entries", h.addEntry)
+	g.DELETE("/api/ipfilter/entries/:id", h.removeEntry)
+	g.GET("/api/ipfilter/check", h.checkAddress)
+}
+
+// ipFilterEntryRequest is the body accepted when adding an entry
+type ipFilterEntryRequest struct {
+	CIDR    string `json:"cidr"`
+	Action  string `json:"action"`
+	Service string `json:"service"`
+	Comment string `json:"comment"`
+	TTL     string `json:"ttl"` // Go duration such as "30m"; empty never expires
+}
+
+// listEntries returns configured and runtime entries
+func (h *IPFilterHandler) listEntries(c echo.Context) error {
+	entries := h.filter.List()
+
+	if service := c.QueryParam("service"); service != "" {
+		filtered := make([]ipfilter.Entry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.Service == service {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
+// addEntry adds a runtime entry, optionally expiring after a TTL
+func (h *IPFilterHandler) addEntry(c echo.Context) error {
+	var req ipFilterEntryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "ttl must be a positive duration such as 30m or 24h",
+			})
+		}
+		ttl = parsed
+	}
+
+	entry, err := h.filter.Add(ipfilter.Entry{
+		CIDR:    req.CIDR,
+		Action:  ipfilter.Action(req.Action),
+		Service: req.Service,
+		Comment: req.Comment,
+	}, ttl)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
+
+// removeEntry deletes a runtime entry
+func (h *IPFilterHandler) removeEntry(c echo.Context) error {
+	err := h.filter.Remove(c.Param("id"))
+	switch {
+	case errors.Is(err, ipfilter.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ipfilter.ErrStatic):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "entry removed",
+	})
+}
+
+// checkAddress reports whether an address would be admitted globally and,
+// if a service is given, by that service
+func (h *IPFilterHandler) checkAddress(c echo.Context) error {
+	ip := net.ParseIP(c.QueryParam("ip"))
+	if ip == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "ip query parameter must be a valid address",
+		})
+	}
+
+	service := c.QueryParam("service")
+	allowed := h.filter.Allowed(ip, "")
+	if allowed && service != "" {
+		allowed = h.filter.Allowed(ip, service)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"ip":      ip.String(),
+		"service": service,
+		"allowed": allowed,
+	})
+}
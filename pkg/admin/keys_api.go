@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"odin/pkg/mongodb"
+	"odin/pkg/portal"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeysHandler reviews the API keys developers request in the portal
+type KeysHandler struct {
+	portal *portal.Portal
+}
+
+// NewKeysHandler creates a new key review handler
+func NewKeysHandler(p *portal.Portal) *KeysHandler {
+	return &KeysHandler{portal: p}
+}
+
+// RegisterRoutes registers the key review API routes
+func (h *KeysHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/keys", h.listKeys)
+	g.POST("/api/keys/:id/approve", h.approveKey)
+	g.POST("/api/keys/:id/reject", h.rejectKey)
+}
+
+// reviewedKey is an API key as admins review it. The key itself is never
+// shown, only its prefix.
+type reviewedKey struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	UserID       string     `json:"userId"`
+	Plan         string     `json:"plan,omitempty"`
+	Prefix       string     `json:"prefix"`
+	Status       string     `json:"status"`
+	ReviewedBy   string     `json:"reviewedBy,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewedAt,omitempty"`
+	RejectReason string     `json:"rejectReason,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+func newReviewedKey(key *mongodb.APIKeyDocument) reviewedKey {
+	status := key.Status
+	if status == "" {
+		status = mongodb.APIKeyApproved
+	}
+	return reviewedKey{
+		ID:           key.ID,
+		Name:         key.Name,
+		UserID:       key.UserID,
+		Plan:         key.Plan,
+		Prefix:       key.Key[:min(8, len(key.Key))],
+		Status:       status,
+		ReviewedBy:   key.ReviewedBy,
+		ReviewedAt:   key.ReviewedAt,
+		RejectReason: key.RejectReason,
+		CreatedAt:    key.CreatedAt,
+	}
+}
+
+// listKeys returns the keys with the status in ?status=, pending by default
+func (h *KeysHandler) listKeys(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = mongodb.APIKeyPending
+	}
+	switch status {
+	case mongodb.APIKeyPending, mongodb.APIKeyApproved, mongodb.APIKeyRejected:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be pending, approved or rejected"})
+	}
+
+	keys, err := h.portal.Keys(c.Request().Context(), status)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list API keys"})
+	}
+	views := make([]reviewedKey, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newReviewedKey(key))
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+func (h *KeysHandler) approveKey(c echo.Context) error {
+	key, err := h.portal.Approve(c.Request().Context(), c.Param("id"), reviewer(c))
+	if err != nil {
+		return reviewError(c, err)
+	}
+	return c.JSON(http.StatusOK, newReviewedKey(key))
+}
+
+func (h *KeysHandler) rejectKey(c echo.Context) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req.Reason) > 500 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason cannot be longer than 500 characters"})
+	}
+
+	key, err := h.portal.Reject(c.Request().Context(), c.Param("id"), reviewer(c), req.Reason)
+	if err != nil {
+		return reviewError(c, err)
+	}
+	return c.JSON(http.StatusOK, newReviewedKey(key))
+}
+
+// reviewer names the admin making a request
+func reviewer(c echo.Context) string {
+	if name, ok := c.Get(tokenContextKey).(string); ok {
+		return "token:" + name
+	}
+	if username, ok := requestUser(c); ok {
+		return username
+	}
+	return "admin"
+}
+
+// reviewError answers with the status matching a review error
+func reviewError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, portal.ErrKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, portal.ErrNotPending):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"odin/pkg/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// LogsHandler serves the gateway's recent logs and follows new ones
+type LogsHandler struct {
+	tail *logging.Tail
+}
+
+// NewLogsHandler creates a new log handler
+func NewLogsHandler(tail *logging.Tail) *LogsHandler {
+	return &LogsHandler{tail: tail}
+}
+
+// RegisterRoutes registers the log API routes
+func (h *LogsHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/logs", h.getLogs)
+}
+
+// getLogs writes the latest ?lines= entries (default 100) as JSON lines,
+// then new entries as they are logged with ?follow=true. ?level= keeps
+// entries at or above a level and ?service= those of a service.
+func (h *LogsHandler) getLogs(c echo.Context) error {
+	lines := 100
+	if v := c.QueryParam("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "lines must be a non-negative number"})
+		}
+		lines = n
+	}
+	level := logrus.TraceLevel
+	if v := c.QueryParam("level"); v != "" {
+		var err error
+		if level, err = logrus.ParseLevel(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid level"})
+		}
+	}
+	service := c.QueryParam("service")
+	follow, _ := strconv.ParseBool(c.QueryParam("follow"))
+
+	keep := func(e logging.Entry) bool {
+		l, err := logrus.ParseLevel(e.Level)
+		if err != nil || l > level {
+			return false
+		}
+		return service == "" || e.Fields["service"] == service
+	}
+
+	var recent []logging.Entry
+	var entries <-chan logging.Entry
+	if follow {
+		var stop func()
+		recent, entries, stop = h.tail.Follow(lines, 256)
+		defer stop()
+	} else {
+		recent = h.tail.Recent(lines)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	res.Header().Set(echo.HeaderCacheControl, "no-store")
+	res.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(res)
+	for _, e := range recent {
+		if keep(e) {
+			if err := encoder.Encode(e); err != nil {
+				return nil
+			}
+		}
+	}
+	res.Flush()
+	if !follow {
+		return nil
+	}
+
+	// Following outlasts the server's write timeout
+	http.NewResponseController(res).SetWriteDeadline(time.Time{})
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-entries:
+			if !keep(e) {
+				continue
+			}
+			if err := encoder.Encode(e); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
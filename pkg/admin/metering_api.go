@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"odin/pkg/metering"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MeteringHandler exports usage records for billing
+type MeteringHandler struct {
+	meter *metering.Meter
+}
+
+// NewMeteringHandler creates a new metering handler
+func NewMeteringHandler(meter *metering.Meter) *MeteringHandler {
+	return &MeteringHandler{meter: meter}
+}
+
+// RegisterRoutes registers the metering API routes
+func (h *MeteringHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/metering/usage", h.exportUsage)
+}
+
+// usageTotals sums the usage records of an export
+type usageTotals struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+}
+
+// exportUsage returns the usage records whose period starts between from and
+// to, as JSON or, with format=csv, as a CSV file
+func (h *MeteringHandler) exportUsage(c echo.Context) error {
+	now := time.Now().UTC()
+	from, err := parseUsageTime(c.QueryParam("from"), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), false)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be an RFC 3339 time or a date"})
+	}
+	to, err := parseUsageTime(c.QueryParam("to"), now, true)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be an RFC 3339 time or a date"})
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 30*time.Second)
+	defer cancel()
+
+	records, err := h.meter.Query(ctx, mongodb.UsageRecordQuery{
+		From:    from,
+		To:      to,
+		KeyID:   c.QueryParam("keyId"),
+		UserID:  c.QueryParam("userId"),
+		Service: c.QueryParam("service"),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if records == nil {
+		records = []*mongodb.UsageRecordDocument{}
+	}
+
+	if format == "csv" {
+		data, err := usageCSV(records)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=usage-%s-%s.csv", from.Format("20060102"), to.Format("20060102")))
+		return c.Blob(http.StatusOK, "text/csv", data)
+	}
+
+	var totals usageTotals
+	for _, record := range records {
+		totals.Requests += record.Requests
+		totals.Errors += record.Errors
+		totals.BytesIn += record.BytesIn
+		totals.BytesOut += record.BytesOut
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"totals":  totals,
+		"records": records,
+	})
+}
+
+// usageCSV writes records as CSV with a header row
+func usageCSV(records []*mongodb.UsageRecordDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"periodStart", "periodEnd", "keyId", "userId", "plan", "service", "requests", "errors", "bytesIn", "bytesOut"})
+	for _, r := range records {
+		w.Write([]string{
+			r.PeriodStart.UTC().Format(time.RFC3339),
+			r.PeriodEnd.UTC().Format(time.RFC3339),
+			r.KeyID,
+			r.UserID,
+			r.Plan,
+			r.Service,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.Errors, 10),
+			strconv.FormatInt(r.BytesIn, 10),
+			strconv.FormatInt(r.BytesOut, 10),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseUsageTime parses an RFC 3339 time or a date, or returns def when
+// value is empty. A date is the start of the day (UTC), or the start of the
+// next day when end is set, so that the day is included.
+func parseUsageTime(value string, def time.Time, end bool) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -33,6 +33,7 @@ func NewMongoDBServiceHandler(adapter *mongodb.ServiceAdapter, registry *service
 // ServiceRequest represents a service create/update request
 type ServiceRequest struct {
 	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"` // default: the caller's namespace
 	BasePath       string            `json:"basePath"`
 	Targets        []string          `json:"targets"`
 	StripBasePath  bool              `json:"stripBasePath"`
@@ -49,6 +50,7 @@ type ServiceRequest struct {
 type ServiceResponse struct {
 	ID             string            `json:"id"`
 	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace,omitempty"`
 	BasePath       string            `json:"basePath"`
 	Targets        []string          `json:"targets"`
 	StripBasePath  bool              `json:"stripBasePath"`
@@ -69,7 +71,7 @@ func (h *AdminHandler) RegisterMongoDBRoutes(e *echo.Echo, adapter *mongodb.Serv
 	handler := NewMongoDBServiceHandler(adapter, nil, h.logger)
 
 	api := e.Group("/admin/api/mongodb")
-	api.Use(h.basicAuthMiddleware)
+	api.Use(h.namespaceAuthMiddleware, h.rbacMiddleware, CSRFMiddleware())
 
 	// Service endpoints
 	api.GET("/services", handler.ListServices)
@@ -85,9 +87,20 @@ func (h *AdminHandler) RegisterMongoDBRoutes(e *echo.Echo, adapter *mongodb.Serv
 	api.GET("/stats", handler.GetStatistics)
 }
 
+// scope returns a context limiting MongoDB operations to the namespace of
+// the request: the one its admin administers, or for the gateway
+// administrator the namespace query parameter, if given
+func scope(c echo.Context) (context.Context, string) {
+	namespace, _ := c.Get(NamespaceContextKey).(string)
+	if namespace == "" {
+		namespace = c.QueryParam("namespace")
+	}
+	return mongodb.WithNamespace(c.Request().Context(), namespace), namespace
+}
+
 // ListServices lists all services from MongoDB
 func (h *MongoDBServiceHandler) ListServices(c echo.Context) error {
-	ctx := context.Background()
+	ctx, _ := scope(c)
 
 	services, err := h.adapter.LoadServices(ctx)
 	if err != nil {
@@ -102,6 +115,7 @@ func (h *MongoDBServiceHandler) ListServices(c echo.Context) error {
 	for _, svc := range services {
 		responses = append(responses, ServiceResponse{
 			Name:           svc.Name,
+			Namespace:      svc.Namespace,
 			BasePath:       svc.BasePath,
 			Targets:        svc.Targets,
 			StripBasePath:  svc.StripBasePath,
@@ -121,7 +135,7 @@ func (h *MongoDBServiceHandler) ListServices(c echo.Context) error {
 
 // GetService retrieves a specific service
 func (h *MongoDBServiceHandler) GetService(c echo.Context) error {
-	ctx := context.Background()
+	ctx, _ := scope(c)
 	name := c.Param("name")
 
 	svc, err := h.adapter.GetService(ctx, name)
@@ -134,6 +148,7 @@ func (h *MongoDBServiceHandler) GetService(c echo.Context) error {
 
 	response := ServiceResponse{
 		Name:           svc.Name,
+		Namespace:      svc.Namespace,
 		BasePath:       svc.BasePath,
 		Targets:        svc.Targets,
 		StripBasePath:  svc.StripBasePath,
@@ -152,7 +167,7 @@ func (h *MongoDBServiceHandler) GetService(c echo.Context) error {
 
 // CreateService creates a new service
 func (h *MongoDBServiceHandler) CreateService(c echo.Context) error {
-	ctx := context.Background()
+	ctx, namespace := scope(c)
 
 	var req ServiceRequest
 	if err := c.Bind(&req); err != nil {
@@ -160,6 +175,9 @@ func (h *MongoDBServiceHandler) CreateService(c echo.Context) error {
 			"error": "Invalid request body",
 		})
 	}
+	if err := checkNamespace(&req, namespace); err != nil {
+		return err
+	}
 
 	// Validate required fields
 	if req.Name == "" {
@@ -203,6 +221,7 @@ func (h *MongoDBServiceHandler) CreateService(c echo.Context) error {
 	// Create service config
 	svc := &config.ServiceConfig{
 		Name:           req.Name,
+		Namespace:      req.Namespace,
 		BasePath:       req.BasePath,
 		Targets:        req.Targets,
 		StripBasePath:  req.StripBasePath,
@@ -223,7 +242,7 @@ func (h *MongoDBServiceHandler) CreateService(c echo.Context) error {
 		})
 	}
 
-	h.logger.WithField("service", req.Name).Info("Service created successfully")
+	h.logger.WithFields(logrus.Fields{"service": req.Name, "namespace": req.Namespace}).Info("Service created successfully")
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"message": "Service created successfully",
@@ -233,7 +252,7 @@ func (h *MongoDBServiceHandler) CreateService(c echo.Context) error {
 
 // UpdateService updates an existing service
 func (h *MongoDBServiceHandler) UpdateService(c echo.Context) error {
-	ctx := context.Background()
+	ctx, namespace := scope(c)
 	name := c.Param("name")
 
 	var req ServiceRequest
@@ -242,6 +261,9 @@ func (h *MongoDBServiceHandler) UpdateService(c echo.Context) error {
 			"error": "Invalid request body",
 		})
 	}
+	if err := checkNamespace(&req, namespace); err != nil {
+		return err
+	}
 
 	// Ensure name matches
 	if req.Name != "" && req.Name != name {
@@ -295,7 +317,7 @@ func (h *MongoDBServiceHandler) UpdateService(c echo.Context) error {
 
 // DeleteService deletes a service
 func (h *MongoDBServiceHandler) DeleteService(c echo.Context) error {
-	ctx := context.Background()
+	ctx, _ := scope(c)
 	name := c.Param("name")
 
 	if err := h.adapter.DeleteService(ctx, name); err != nil {
@@ -313,6 +335,19 @@ func (h *MongoDBServiceHandler) DeleteService(c echo.Context) error {
 	})
 }
 
+// checkNamespace places the service of req in namespace, the namespace of
+// the request; a service of another namespace is forbidden
+func checkNamespace(req *ServiceRequest, namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	if req.Namespace != "" && req.Namespace != namespace {
+		return echo.NewHTTPError(http.StatusForbidden, "Service belongs to another namespace")
+	}
+	req.Namespace = namespace
+	return nil
+}
+
 // CheckHealth checks MongoDB connection health
 func (h *MongoDBServiceHandler) CheckHealth(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -336,7 +371,7 @@ func (h *MongoDBServiceHandler) CheckHealth(c echo.Context) error {
 
 // GetStatistics returns MongoDB statistics
 func (h *MongoDBServiceHandler) GetStatistics(c echo.Context) error {
-	ctx := context.Background()
+	ctx, _ := scope(c)
 
 	services, err := h.adapter.LoadServices(ctx)
 	if err != nil {
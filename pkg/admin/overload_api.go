@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/overload"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OverloadHandler exposes the state of overload protection
+type OverloadHandler struct {
+	guard *overload.Guard
+}
+
+// NewOverloadHandler creates a new overload handler
+func NewOverloadHandler(guard *overload.Guard) *OverloadHandler {
+	return &OverloadHandler{guard: guard}
+}
+
+// RegisterRoutes registers the overload API routes
+func (h *OverloadHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/overload/stats", h.getStats)
+}
+
+// getStats returns the requests in flight and queued, whether the gateway is
+// overloaded, and how many requests were admitted and shed
+func (h *OverloadHandler) getStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.guard.Stats())
+}
@@ -0,0 +1,194 @@
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles of admin users, stored in UserDocument.Role
+const (
+	RoleAdmin  = "admin"  // everything, including users, plugins and settings
+	RoleUser   = "user"   // what viewers may, and manage services
+	RoleViewer = "viewer" // read-only
+)
+
+// roleContextKey is the echo context key of the role of an admin request
+const roleContextKey = "adminRole"
+
+// userCacheTTL is how long verified user credentials are trusted without
+// checking them again, which spares a bcrypt comparison per request
+const userCacheTTL = time.Minute
+
+// UserStore keeps the users of the admin interface, e.g. the MongoDB
+// repository
+type UserStore interface {
+	CreateUser(ctx context.Context, user *mongodb.UserDocument) error
+	GetUser(ctx context.Context, id string) (*mongodb.UserDocument, error)
+	GetUserByUsername(ctx context.Context, username string) (*mongodb.UserDocument, error)
+	ListUsers(ctx context.Context) ([]*mongodb.UserDocument, error)
+	UpdateUser(ctx context.Context, id string, user *mongodb.UserDocument) error
+	DeleteUser(ctx context.Context, id string) error
+}
+
+// verifiedUser is the role of credentials verified until expires
+type verifiedUser struct {
+	role    string
+	expires time.Time
+}
+
+// userAuth authenticates admin users kept in a UserStore
+type userAuth struct {
+	store UserStore
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]verifiedUser // By hash of the credentials
+}
+
+func newUserAuth(store UserStore) *userAuth {
+	return &userAuth{store: store, verified: make(map[[sha256.Size]byte]verifiedUser)}
+}
+
+// ValidRole reports whether role is one of the admin roles
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleUser || role == RoleViewer
+}
+
+// authenticate returns the role of an active user with these credentials.
+// Users of other roles, e.g. portal developers, have no admin access.
+func (a *userAuth) authenticate(ctx context.Context, username, password string) (string, bool) {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	now := time.Now()
+
+	a.mu.Lock()
+	if v, ok := a.verified[key]; ok && now.Before(v.expires) {
+		a.mu.Unlock()
+		return v.role, true
+	}
+	a.mu.Unlock()
+
+	user, err := a.store.GetUserByUsername(ctx, username)
+	if err != nil || user == nil || !user.Active || !ValidRole(user.Role) {
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "", false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, v := range a.verified {
+		if now.After(v.expires) {
+			delete(a.verified, k)
+		}
+	}
+	a.verified[key] = verifiedUser{role: user.Role, expires: now.Add(userCacheTTL)}
+	return user.Role, true
+}
+
+// role returns the role of an active user allowed in the admin interface
+func (a *userAuth) role(ctx context.Context, username string) (string, bool) {
+	user, err := a.store.GetUserByUsername(ctx, username)
+	if err != nil || user == nil || !user.Active || !ValidRole(user.Role) {
+		return "", false
+	}
+	return user.Role, true
+}
+
+// forget drops the verified credentials so changes to users apply at once
+func (a *userAuth) forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.verified = make(map[[sha256.Size]byte]verifiedUser)
+}
+
+// adminOnlyReads are read endpoints only admins may use, as they reveal
+// users, consumer credentials or secrets of the configuration
+var adminOnlyReads = []string{
+	"/admin/api/users",
+	"/admin/api/settings/export",
+	"/admin/api/settings/json",
+	"/admin/api/settings/backups",
+	"/admin/api/config",
+	"/admin/api/consumers",
+}
+
+// adminOnlyPaths are like adminOnlyReads, but the paths below them are not
+// included: the whole configuration is secret, its sections are not
+var adminOnlyPaths = []string{
+	"/admin/api/settings",
+}
+
+// serviceWrites are the endpoints users may change services through
+var serviceWrites = []string{
+	"/admin/services",
+	"/admin/api/mongodb/services",
+	"/admin/api/services",
+	"/admin/api/declarative/services",
+	"/admin/api/targets",
+}
+
+// Permits reports whether role may send a request with method to path
+func Permits(role, method, path string) bool {
+	switch role {
+	case RoleAdmin:
+		return true
+	case RoleUser, RoleViewer:
+	default:
+		return false
+	}
+
+	if underAny(path, adminOnlyReads) || isAny(path, adminOnlyPaths) {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return role == RoleUser && underAny(path, serviceWrites)
+}
+
+// underAny reports whether path is one of prefixes or below one of them
+func underAny(path string, prefixes []string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isAny reports whether path is one of paths
+func isAny(path string, paths []string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, p := range paths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// rbacMiddleware refuses requests the role set by authentication does not
+// permit
+func (h *AdminHandler) rbacMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !h.enabled {
+			return next(c)
+		}
+		role, _ := c.Get(roleContextKey).(string)
+		if !Permits(role, c.Request().Method, c.Request().URL.Path) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Your role does not permit this request"})
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"odin/pkg/revocation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RevocationHandler revokes JWTs, subjects and API keys
+type RevocationHandler struct {
+	list *revocation.List
+}
+
+// NewRevocationHandler creates a new revocation handler
+func NewRevocationHandler(list *revocation.List) *RevocationHandler {
+	return &RevocationHandler{list: list}
+}
+
+// RegisterRoutes registers the revocation API routes
+func (h *RevocationHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/revocations", h.listRevocations)
+	g.POST("/api/revocations", h.revoke)
+	g.DELETE("/api/revocations/:id", h.deleteRevocation)
+}
+
+// listRevocations returns the revocations in effect, latest first
+func (h *RevocationHandler) listRevocations(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.list.Entries())
+}
+
+// revoke revokes a jti, subject or API key ID right away
+func (h *RevocationHandler) revoke(c echo.Context) error {
+	var req struct {
+		Kind      string    `json:"kind"` // jti, subject or apiKey
+		Value     string    `json:"value"`
+		Reason    string    `json:"reason"`
+		ExpiresAt time.Time `json:"expiresAt"` // Optional; e.g. the exp of a revoked token
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req.Reason) > 500 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason cannot be longer than 500 characters"})
+	}
+
+	doc, err := h.list.Revoke(c.Request().Context(), req.Kind, req.Value, req.Reason, reviewer(c), req.ExpiresAt)
+	if err != nil {
+		return revocationError(c, err)
+	}
+	return c.JSON(http.StatusCreated, doc)
+}
+
+// deleteRevocation lifts a revocation by its ID, kind:value
+func (h *RevocationHandler) deleteRevocation(c echo.Context) error {
+	if err := h.list.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return revocationError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "revocation deleted"})
+}
+
+// revocationError answers with the status matching a revocation error
+func revocationError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, revocation.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, revocation.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
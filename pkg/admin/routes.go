@@ -19,8 +19,15 @@ func (h *AdminHandler) Register(e *echo.Echo) {
 	adminGroup.GET("/login", h.handleLogin)
 	adminGroup.POST("/login", h.handleLoginPost)
 
+	// Sessions with access and refresh tokens, for API clients
+	if h.sessions != nil {
+		adminGroup.POST("/api/auth/login", h.handleSessionLogin)
+		adminGroup.POST("/api/auth/refresh", h.handleSessionRefresh)
+		adminGroup.POST("/api/auth/logout", h.handleSessionLogout)
+	}
+
 	protected := adminGroup.Group("")
-	protected.Use(h.basicAuthMiddleware)
+	protected.Use(h.basicAuthMiddleware, h.rbacMiddleware, CSRFMiddleware(), h.changes.Middleware)
 
 	protected.GET("/dashboard", h.handleDashboard)
 
@@ -29,6 +36,9 @@ func (h *AdminHandler) Register(e *echo.Echo) {
 	protected.GET("/api/monitoring/metrics", GetMetricsAPI)
 	protected.GET("/ws/monitoring", WebSocketMonitoring)
 
+	// Notifications of changes made by other admins
+	protected.GET("/ws/changes", h.changes.HandleWebSocket)
+
 	// Traces routes
 	protected.GET("/traces", h.handleTraces)
 
@@ -46,12 +56,16 @@ func (h *AdminHandler) Register(e *echo.Echo) {
 	protected.DELETE("/services/:name", h.handleDeleteService)
 
 	// Settings API routes
-	settingsHandler := NewSettingsHandler(h.configPath, h.config)
+	settingsHandler := NewSettingsHandler(h.configPath, h.config, h.cacheStore, h.reloader, h.logger)
+	settingsHandler.SetInFlightCounter(h.inFlight)
+	settingsHandler.SetRateLimitCounter(h.rateLimitCounter)
+	settingsHandler.SetRequestSamples(h.samples)
 
 	protected.GET("/settings", h.handleSettings)
 	protected.GET("/api/settings", settingsHandler.GetAllSettings)
 	protected.GET("/api/settings/info", settingsHandler.GetGatewayInfo)
 	protected.GET("/api/settings/stats", settingsHandler.GetSystemStats)
+	protected.GET("/api/settings/runtime", settingsHandler.GetRuntimeSettings)
 
 	// Server settings
 	protected.GET("/api/settings/server", settingsHandler.GetServerSettings)
@@ -86,6 +100,9 @@ func (h *AdminHandler) Register(e *echo.Echo) {
 	protected.POST("/api/settings/reload", settingsHandler.ReloadConfig)
 	protected.GET("/api/settings/json", settingsHandler.GetConfigAsJSON)
 
+	// Declarative desired-state API for infrastructure-as-code tools
+	h.registerDeclarativeRoutes(protected)
+
 	// Register plugin routes if plugin handler is available
 	if h.pluginHandler != nil {
 		h.pluginHandler.RegisterPluginRoutes(protected)
@@ -107,6 +124,125 @@ func (h *AdminHandler) Register(e *echo.Echo) {
 		h.integrationHandler.RegisterRoutes(protected)
 	}
 
+	// Register GitOps routes if the syncer is enabled. The webhook authenticates
+	// with its own signature, so it is registered outside the protected group.
+	if h.gitopsHandler != nil {
+		h.gitopsHandler.RegisterRoutes(adminGroup, protected)
+	}
+
+	// Register event dead-letter routes if the event bus is enabled
+	if h.eventsHandler != nil {
+		h.eventsHandler.RegisterRoutes(protected)
+	}
+
+	// Register streaming status route if access/audit streaming is enabled
+	if h.streamingHandler != nil {
+		h.streamingHandler.RegisterRoutes(protected)
+	}
+
+	// Register IP allow/deny list routes if the IP filter is enabled
+	if h.ipFilterHandler != nil {
+		h.ipFilterHandler.RegisterRoutes(protected)
+	}
+
+	// Register ACME certificate routes if automatic certificates are enabled
+	if h.acmeHandler != nil {
+		h.acmeHandler.RegisterRoutes(protected)
+	}
+
+	// Register response DLP audit routes
+	if h.dlpHandler != nil {
+		h.dlpHandler.RegisterRoutes(protected)
+	}
+
+	// Register overload protection routes
+	if h.overloadHandler != nil {
+		h.overloadHandler.RegisterRoutes(protected)
+	}
+
+	// Register WebSocket connection routes
+	if h.websocketHandler != nil {
+		h.websocketHandler.RegisterRoutes(protected)
+	}
+
+	// Register TCP proxy routes
+	if h.tcpHandler != nil {
+		h.tcpHandler.RegisterRoutes(protected)
+	}
+
+	// Register metering export routes
+	if h.meteringHandler != nil {
+		h.meteringHandler.RegisterRoutes(protected)
+	}
+
+	// Register health history routes
+	if h.healthHistoryHandler != nil {
+		h.healthHistoryHandler.RegisterRoutes(protected)
+	}
+
+	// Register target maintenance routes
+	if h.targetsHandler != nil {
+		h.targetsHandler.RegisterRoutes(protected)
+	}
+
+	// Register consumer management routes
+	if h.consumersHandler != nil {
+		h.consumersHandler.RegisterRoutes(protected)
+	}
+
+	// Register API key review routes
+	if h.keysHandler != nil {
+		h.keysHandler.RegisterRoutes(protected)
+	}
+
+	// Register scheduled backup routes
+	if h.backupHandler != nil {
+		h.backupHandler.RegisterRoutes(protected)
+	}
+
+	// Register scheduled job routes
+	if h.schedulerHandler != nil {
+		h.schedulerHandler.RegisterRoutes(protected)
+	}
+
+	// Register token and API key revocation routes
+	if h.revocationHandler != nil {
+		h.revocationHandler.RegisterRoutes(protected)
+	}
+
+	// Register fault injection routes
+	if h.faultsHandler != nil {
+		h.faultsHandler.RegisterRoutes(protected)
+	}
+
+	// Register log tailing routes
+	if h.logsHandler != nil {
+		h.logsHandler.RegisterRoutes(protected)
+	}
+
+	// Register admin user routes
+	if h.usersHandler != nil {
+		h.usersHandler.RegisterRoutes(protected)
+	}
+
+	// Register config version routes
+	if h.configVersions != nil {
+		h.configVersions.RegisterRoutes(protected)
+	}
+
+	// Register stored service routes
+	if h.storedServices != nil {
+		h.storedServices.RegisterRoutes(protected)
+	}
+
+	// Register the MongoDB service API of namespace admins
+	if h.mongoServices != nil {
+		h.RegisterMongoDBRoutes(e, h.mongoServices)
+	}
+
+	// Insomnia import/export works on uploaded files and needs no external connection
+	NewInsomniaHandler(h.config, h.logger).RegisterRoutes(protected)
+
 	h.logger.Info("Admin routes registered")
 }
 
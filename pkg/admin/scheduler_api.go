@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"odin/pkg/mongodb"
+	"odin/pkg/scheduler"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SchedulerHandler manages scheduled jobs and shows their runs
+type SchedulerHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+// NewSchedulerHandler creates a new scheduler handler
+func NewSchedulerHandler(s *scheduler.Scheduler) *SchedulerHandler {
+	return &SchedulerHandler{scheduler: s}
+}
+
+// RegisterRoutes registers the scheduler API routes
+func (h *SchedulerHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/scheduler", h.getStatus)
+	g.GET("/api/scheduler/jobs", h.listJobs)
+	g.POST("/api/scheduler/jobs", h.createJob)
+	g.PUT("/api/scheduler/jobs/:name", h.updateJob)
+	g.DELETE("/api/scheduler/jobs/:name", h.deleteJob)
+	g.POST("/api/scheduler/jobs/:name/run", h.runJob)
+	g.GET("/api/scheduler/jobs/:name/runs", h.listRuns)
+}
+
+// jobRequest is the body accepted when creating or replacing a job
+type jobRequest struct {
+	Name     string                 `json:"name"`
+	Schedule string                 `json:"schedule"`
+	Task     string                 `json:"task"`
+	Params   map[string]interface{} `json:"params"`
+	Timeout  string                 `json:"timeout"`
+	Disabled bool                   `json:"disabled"`
+}
+
+func (r *jobRequest) document() *mongodb.ScheduledJobDocument {
+	return &mongodb.ScheduledJobDocument{
+		Name:     r.Name,
+		Schedule: r.Schedule,
+		Task:     r.Task,
+		Params:   r.Params,
+		Timeout:  r.Timeout,
+		Disabled: r.Disabled,
+	}
+}
+
+// getStatus tells which gateway runs the jobs
+func (h *SchedulerHandler) getStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.scheduler.Status())
+}
+
+// listJobs returns every job with its last run
+func (h *SchedulerHandler) listJobs(c echo.Context) error {
+	jobs, err := h.scheduler.Jobs(c.Request().Context())
+	if err != nil {
+		return schedulerError(c, err)
+	}
+	return c.JSON(http.StatusOK, jobs)
+}
+
+func (h *SchedulerHandler) createJob(c echo.Context) error {
+	var req jobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	job := req.document()
+	if err := h.scheduler.CreateJob(c.Request().Context(), job); err != nil {
+		return schedulerError(c, err)
+	}
+	return c.JSON(http.StatusCreated, job)
+}
+
+// updateJob replaces a job added through the API
+func (h *SchedulerHandler) updateJob(c echo.Context) error {
+	var req jobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	job := req.document()
+	job.Name = c.Param("name")
+	if err := h.scheduler.UpdateJob(c.Request().Context(), job); err != nil {
+		return schedulerError(c, err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func (h *SchedulerHandler) deleteJob(c echo.Context) error {
+	if err := h.scheduler.DeleteJob(c.Request().Context(), c.Param("name")); err != nil {
+		return schedulerError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "job deleted"})
+}
+
+// runJob runs a job now on this gateway and returns the run once it ends
+func (h *SchedulerHandler) runJob(c echo.Context) error {
+	run, err := h.scheduler.Run(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return schedulerError(c, err)
+	}
+	if run.Status == mongodb.JobRunFailed {
+		return c.JSON(http.StatusInternalServerError, run)
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// listRuns returns the latest runs of a job, 20 unless limit says otherwise
+func (h *SchedulerHandler) listRuns(c echo.Context) error {
+	limit := 20
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	runs, err := h.scheduler.Runs(c.Request().Context(), c.Param("name"), limit)
+	if err != nil {
+		return schedulerError(c, err)
+	}
+	return c.JSON(http.StatusOK, runs)
+}
+
+// schedulerError answers with the status matching a scheduler error
+func schedulerError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, scheduler.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, scheduler.ErrExists), errors.Is(err, scheduler.ErrReadOnly), errors.Is(err, scheduler.ErrRunning):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
@@ -1,9 +1,11 @@
 package admin
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"odin/pkg/config"
+	"odin/pkg/events"
 	"strconv"
 	"strings"
 	"time"
@@ -12,8 +14,14 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	errServiceNotFound = errors.New("service not found")
+	errServiceExists   = errors.New("service already exists")
+)
+
 func (h *AdminHandler) handleListServices(c echo.Context) error {
-	if len(h.config.Services) == 0 {
+	services := h.config.Load().Services
+	if len(services) == 0 {
 		return c.HTML(http.StatusOK, `<div class="alert alert-info">No services configured. Add a new service to get started.</div>`)
 	}
 
@@ -30,8 +38,11 @@ func (h *AdminHandler) handleListServices(c echo.Context) error {
 		<tbody>
 	`
 
-	for _, svc := range h.config.Services {
-		targets := svc.Targets[0]
+	for _, svc := range services {
+		targets := "-"
+		if len(svc.Targets) > 0 {
+			targets = svc.Targets[0]
+		}
 		if len(svc.Targets) > 1 {
 			targets += " +" + fmt.Sprint(len(svc.Targets)-1)
 		}
@@ -69,16 +80,17 @@ func (h *AdminHandler) handleListServices(c echo.Context) error {
 
 func (h *AdminHandler) handleNewService(c echo.Context) error {
 	data := map[string]interface{}{
-		"AvailableServices": h.config.Services,
+		"AvailableServices": h.config.Load().Services,
 	}
 	return h.renderTemplate(c, "add_service.html", data)
 }
 
 func (h *AdminHandler) handleEditService(c echo.Context) error {
 	name := c.Param("name")
+	services := h.config.Load().Services
 
 	var svc *config.ServiceConfig
-	for _, s := range h.config.Services {
+	for _, s := range services {
 		if s.Name == name {
 			svc = &s
 			break
@@ -90,7 +102,7 @@ func (h *AdminHandler) handleEditService(c echo.Context) error {
 	}
 
 	availableServices := make([]config.ServiceConfig, 0)
-	for _, s := range h.config.Services {
+	for _, s := range services {
 		if s.Name != name {
 			availableServices = append(availableServices, s)
 		}
@@ -114,12 +126,6 @@ func (h *AdminHandler) handleAddService(c echo.Context) error {
 	name := c.FormValue("name")
 	basePath := c.FormValue("basePath")
 
-	for _, svc := range h.config.Services {
-		if svc.Name == name {
-			return c.HTML(http.StatusBadRequest, `<div class="alert alert-danger">A service with this name already exists</div>`)
-		}
-	}
-
 	targets := parseMultilineInput(c.FormValue("targets"))
 	if len(targets) == 0 {
 		return c.HTML(http.StatusBadRequest, `<div class="alert alert-danger">At least one target URL is required</div>`)
@@ -141,12 +147,28 @@ func (h *AdminHandler) handleAddService(c echo.Context) error {
 		Timeout:        5 * time.Second,
 	}
 
-	h.config.Services = append(h.config.Services, newSvc)
-
-	if err := h.saveConfig(); err != nil {
+	err := h.config.Update(func(cfg *config.Config) error {
+		for _, svc := range cfg.Services {
+			if svc.Name == name {
+				return errServiceExists
+			}
+		}
+		cfg.Services = append(cfg.Services, newSvc)
+		return h.saveConfig(cfg)
+	})
+	if errors.Is(err, errServiceExists) {
+		return c.HTML(http.StatusBadRequest, `<div class="alert alert-danger">A service with this name already exists</div>`)
+	}
+	if err != nil {
 		return c.HTML(http.StatusInternalServerError, `<div class="alert alert-danger">Failed to save configuration: `+err.Error()+`</div>`)
 	}
 
+	h.publish(events.ServiceCreated, map[string]interface{}{
+		"service":  newSvc.Name,
+		"basePath": newSvc.BasePath,
+		"targets":  newSvc.Targets,
+	})
+
 	return c.HTML(http.StatusOK, `
 		<div class="alert alert-success">
 			Service added successfully! 
@@ -158,18 +180,6 @@ func (h *AdminHandler) handleAddService(c echo.Context) error {
 func (h *AdminHandler) handleUpdateService(c echo.Context) error {
 	name := c.Param("name")
 
-	var svcIndex = -1
-	for i, svc := range h.config.Services {
-		if svc.Name == name {
-			svcIndex = i
-			break
-		}
-	}
-
-	if svcIndex == -1 {
-		return c.HTML(http.StatusNotFound, `<div class="alert alert-danger">Service not found</div>`)
-	}
-
 	targets := parseMultilineInput(c.FormValue("targets"))
 	if len(targets) == 0 {
 		return c.HTML(http.StatusBadRequest, `<div class="alert alert-danger">At least one target URL is required</div>`)
@@ -190,16 +200,27 @@ func (h *AdminHandler) handleUpdateService(c echo.Context) error {
 	}
 
 	// Update service configuration
-	h.config.Services[svcIndex].BasePath = c.FormValue("basePath")
-	h.config.Services[svcIndex].Targets = targets
-	h.config.Services[svcIndex].StripBasePath = c.FormValue("stripBasePath") == "true"
-	h.config.Services[svcIndex].Authentication = c.FormValue("authentication") == "true"
-	h.config.Services[svcIndex].LoadBalancing = c.FormValue("loadBalancing")
-	h.config.Services[svcIndex].Timeout = time.Duration(timeout) * time.Second
-	h.config.Services[svcIndex].RetryCount = retryCount
-
-	// Save configuration
-	if err := h.saveConfig(); err != nil {
+	var updated config.ServiceConfig
+	err = h.config.Update(func(cfg *config.Config) error {
+		for i := range cfg.Services {
+			if svc := &cfg.Services[i]; svc.Name == name {
+				svc.BasePath = c.FormValue("basePath")
+				svc.Targets = targets
+				svc.StripBasePath = c.FormValue("stripBasePath") == "true"
+				svc.Authentication = c.FormValue("authentication") == "true"
+				svc.LoadBalancing = c.FormValue("loadBalancing")
+				svc.Timeout = time.Duration(timeout) * time.Second
+				svc.RetryCount = retryCount
+				updated = *svc
+				return h.saveConfig(cfg)
+			}
+		}
+		return errServiceNotFound
+	})
+	if errors.Is(err, errServiceNotFound) {
+		return c.HTML(http.StatusNotFound, `<div class="alert alert-danger">Service not found</div>`)
+	}
+	if err != nil {
 		return c.HTML(http.StatusInternalServerError, `<div class="alert alert-danger">Failed to save configuration</div>`)
 	}
 
@@ -208,29 +229,38 @@ func (h *AdminHandler) handleUpdateService(c echo.Context) error {
 		"action":  "update",
 	}).Info("Service updated")
 
+	h.publish(events.ServiceUpdated, map[string]interface{}{
+		"service":  name,
+		"basePath": updated.BasePath,
+		"targets":  updated.Targets,
+	})
+
 	return c.HTML(http.StatusOK, `<div class="alert alert-success">Service updated successfully</div>`)
 }
 
 func (h *AdminHandler) handleDeleteService(c echo.Context) error {
 	name := c.Param("name")
 
-	var found bool
-	for i, svc := range h.config.Services {
-		if svc.Name == name {
-			h.config.Services = append(h.config.Services[:i], h.config.Services[i+1:]...)
-			found = true
-			break
+	err := h.config.Update(func(cfg *config.Config) error {
+		for i, svc := range cfg.Services {
+			if svc.Name == name {
+				cfg.Services = append(cfg.Services[:i], cfg.Services[i+1:]...)
+				return h.saveConfig(cfg)
+			}
 		}
-	}
-
-	if !found {
+		return errServiceNotFound
+	})
+	if errors.Is(err, errServiceNotFound) {
 		return c.HTML(http.StatusNotFound, `<div class="alert alert-danger">Service not found</div>`)
 	}
-
-	if err := h.saveConfig(); err != nil {
+	if err != nil {
 		return c.HTML(http.StatusInternalServerError, `<div class="alert alert-danger">Failed to save configuration: `+err.Error()+`</div>`)
 	}
 
+	h.publish(events.ServiceDeleted, map[string]interface{}{
+		"service": name,
+	})
+
 	return h.handleListServices(c)
 }
 
@@ -0,0 +1,317 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// ServiceStore keeps the services routed from MongoDB, e.g. the MongoDB
+// service adapter. SaveService creates or replaces a service by namespace and
+// name; SaveService and DeleteService are given a context scoped with
+// mongodb.InNamespace to the namespace of the service.
+type ServiceStore interface {
+	LoadServices(ctx context.Context) ([]config.ServiceConfig, error)
+	SaveService(ctx context.Context, svc *config.ServiceConfig) error
+	DeleteService(ctx context.Context, name string) error
+}
+
+// StoredServiceRouter routes the stored services next to the configured
+// ones, e.g. the gateway. It refuses services that are invalid or clash
+// with others.
+type StoredServiceRouter interface {
+	SetStoredServices(services []config.ServiceConfig) error
+}
+
+// StoredServicesHandler manages the services stored in MongoDB. Changes are
+// routed before they are stored, so that invalid services are never stored
+// and the services stored are the services routed. Services are named by
+// namespace and name, the namespace being that of scope.
+type StoredServicesHandler struct {
+	store   ServiceStore
+	router  StoredServiceRouter
+	logger  *logrus.Logger
+	publish func(eventType events.EventType, data map[string]interface{})
+	mu      sync.Mutex // Serializes changes
+}
+
+// NewStoredServicesHandler creates a new stored services handler
+func NewStoredServicesHandler(store ServiceStore, router StoredServiceRouter, logger *logrus.Logger) *StoredServicesHandler {
+	return &StoredServicesHandler{
+		store:   store,
+		router:  router,
+		logger:  logger,
+		publish: func(events.EventType, map[string]interface{}) {},
+	}
+}
+
+// RegisterRoutes registers the stored service API routes
+func (h *StoredServicesHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/services", h.listServices)
+	g.GET("/api/services/:name", h.getService)
+	g.POST("/api/services", h.createService)
+	g.PUT("/api/services/:name", h.updateService)
+	g.DELETE("/api/services/:name", h.deleteService)
+}
+
+func (h *StoredServicesHandler) listServices(c echo.Context) error {
+	services, err := h.store.LoadServices(c.Request().Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load stored services")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load services"})
+	}
+
+	_, namespace := scope(c)
+	responses := make([]ServiceResponse, 0, len(services))
+	for _, svc := range services {
+		if namespace == "" || svc.Namespace == namespace {
+			responses = append(responses, serviceResponse(svc))
+		}
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+func (h *StoredServicesHandler) getService(c echo.Context) error {
+	services, err := h.store.LoadServices(c.Request().Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load stored services")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load services"})
+	}
+	_, namespace := scope(c)
+	if i := indexOfService(services, namespace, c.Param("name")); i >= 0 {
+		return c.JSON(http.StatusOK, serviceResponse(services[i]))
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+}
+
+func (h *StoredServicesHandler) createService(c echo.Context) error {
+	var req ServiceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	_, namespace := scope(c)
+	if err := checkNamespace(&req, namespace); err != nil {
+		return err
+	}
+	svc, err := serviceFromRequest(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := c.Request().Context()
+	services, err := h.store.LoadServices(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load stored services")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load services"})
+	}
+	if indexOfService(services, svc.Namespace, svc.Name) >= 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Service already exists"})
+	}
+
+	next := append(append([]config.ServiceConfig{}, services...), *svc)
+	ctx = mongodb.InNamespace(ctx, svc.Namespace)
+	if err := h.apply(services, next, func() error { return h.store.SaveService(ctx, svc) }); err != nil {
+		return h.applyError(c, err)
+	}
+
+	h.publish(events.ServiceCreated, map[string]interface{}{
+		"service":   svc.Name,
+		"namespace": svc.Namespace,
+		"basePath":  svc.BasePath,
+		"targets":   svc.Targets,
+		"source":    "mongodb",
+	})
+	return c.JSON(http.StatusCreated, serviceResponse(*svc))
+}
+
+// updateService replaces a stored service
+func (h *StoredServicesHandler) updateService(c echo.Context) error {
+	name := c.Param("name")
+	var req ServiceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Name != "" && req.Name != name {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Service name in URL and body must match"})
+	}
+	req.Name = name
+	_, namespace := scope(c)
+	if err := checkNamespace(&req, namespace); err != nil {
+		return err
+	}
+	svc, err := serviceFromRequest(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := c.Request().Context()
+	services, err := h.store.LoadServices(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load stored services")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load services"})
+	}
+	i := indexOfService(services, svc.Namespace, name)
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+	}
+
+	next := append([]config.ServiceConfig{}, services...)
+	next[i] = *svc
+	ctx = mongodb.InNamespace(ctx, svc.Namespace)
+	if err := h.apply(services, next, func() error { return h.store.SaveService(ctx, svc) }); err != nil {
+		return h.applyError(c, err)
+	}
+
+	h.publish(events.ServiceUpdated, map[string]interface{}{
+		"service":   svc.Name,
+		"namespace": svc.Namespace,
+		"basePath":  svc.BasePath,
+		"targets":   svc.Targets,
+		"source":    "mongodb",
+	})
+	return c.JSON(http.StatusOK, serviceResponse(*svc))
+}
+
+func (h *StoredServicesHandler) deleteService(c echo.Context) error {
+	name := c.Param("name")
+	_, namespace := scope(c)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := c.Request().Context()
+	services, err := h.store.LoadServices(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load stored services")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load services"})
+	}
+	i := indexOfService(services, namespace, name)
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+	}
+
+	next := append(append([]config.ServiceConfig{}, services[:i]...), services[i+1:]...)
+	ctx = mongodb.InNamespace(ctx, namespace)
+	if err := h.apply(services, next, func() error { return h.store.DeleteService(ctx, name) }); err != nil {
+		return h.applyError(c, err)
+	}
+
+	h.publish(events.ServiceDeleted, map[string]interface{}{
+		"service":   name,
+		"namespace": namespace,
+		"source":    "mongodb",
+	})
+	return c.JSON(http.StatusOK, map[string]string{"message": "service deleted"})
+}
+
+// storeError is a failure to store a change that was routed, and has been
+// unrouted since
+type storeError struct{ err error }
+
+func (e *storeError) Error() string { return e.err.Error() }
+
+// apply routes the next stored services, then stores the change; if the
+// change cannot be stored, the previous services are routed again
+func (h *StoredServicesHandler) apply(previous, next []config.ServiceConfig, store func() error) error {
+	if err := h.router.SetStoredServices(next); err != nil {
+		return err
+	}
+	if err := store(); err != nil {
+		if rerr := h.router.SetStoredServices(previous); rerr != nil {
+			h.logger.WithError(rerr).Error("Failed to restore the routes of the stored services")
+		}
+		return &storeError{err: err}
+	}
+	return nil
+}
+
+func (h *StoredServicesHandler) applyError(c echo.Context, err error) error {
+	if _, ok := err.(*storeError); ok {
+		h.logger.WithError(err).Error("Failed to store service")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store service"})
+	}
+	return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+}
+
+// serviceFromRequest builds the service of a request, with the defaults of
+// the configuration file
+func serviceFromRequest(req ServiceRequest) (*config.ServiceConfig, error) {
+	if req.Name == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Service name is required")
+	}
+	if req.BasePath == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Base path is required")
+	}
+	if len(req.Targets) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "At least one target is required")
+	}
+
+	svc := &config.ServiceConfig{
+		Name:           req.Name,
+		Namespace:      req.Namespace,
+		BasePath:       req.BasePath,
+		Targets:        req.Targets,
+		StripBasePath:  req.StripBasePath,
+		RetryCount:     req.RetryCount,
+		Authentication: req.Authentication,
+		LoadBalancing:  req.LoadBalancing,
+		Headers:        req.Headers,
+		Protocol:       req.Protocol,
+	}
+	var err error
+	if req.Timeout != "" {
+		if svc.Timeout, err = time.ParseDuration(req.Timeout); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid timeout")
+		}
+	}
+	if req.RetryDelay != "" {
+		if svc.RetryDelay, err = time.ParseDuration(req.RetryDelay); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid retry delay")
+		}
+	}
+	svc.SetDefaults()
+	return svc, nil
+}
+
+func serviceResponse(svc config.ServiceConfig) ServiceResponse {
+	return ServiceResponse{
+		Name:           svc.Name,
+		Namespace:      svc.Namespace,
+		BasePath:       svc.BasePath,
+		Targets:        svc.Targets,
+		StripBasePath:  svc.StripBasePath,
+		Timeout:        svc.Timeout.String(),
+		RetryCount:     svc.RetryCount,
+		RetryDelay:     svc.RetryDelay.String(),
+		Authentication: svc.Authentication,
+		LoadBalancing:  svc.LoadBalancing,
+		Headers:        svc.Headers,
+		Protocol:       svc.Protocol,
+		Enabled:        true,
+	}
+}
+
+// indexOfService returns the index of the service of namespace named name, or
+// -1; the empty namespace is the default one
+func indexOfService(services []config.ServiceConfig, namespace, name string) int {
+	for i, svc := range services {
+		if svc.Namespace == namespace && svc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
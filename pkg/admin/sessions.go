@@ -0,0 +1,415 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// sessionAudience keeps admin access tokens apart from gateway and
+	// portal JWTs
+	sessionAudience = "odin-admin"
+	// sessionCookie and refreshCookie hold the tokens of the admin UI
+	sessionCookie = "odin_session"
+	refreshCookie = "odin_refresh"
+	// userContextKey is the echo context key of the username of a request
+	// authenticated with an access token
+	userContextKey = "adminUser"
+)
+
+// errInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired or revoked
+var errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// SessionStore keeps the refresh tokens of admin sessions and the audit log
+// of sign-ins, e.g. the MongoDB repository
+type SessionStore interface {
+	CreateRefreshToken(ctx context.Context, token *mongodb.RefreshTokenDocument) error
+	GetRefreshToken(ctx context.Context, id string) (*mongodb.RefreshTokenDocument, error)
+	RevokeRefreshToken(ctx context.Context, id string) (bool, error)
+	RevokeRefreshTokens(ctx context.Context, sessionID string) error
+	CreateAuditLog(ctx context.Context, log *mongodb.AuditLogDocument) error
+}
+
+// sessionClaims are the claims of admin access tokens
+type sessionClaims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// tokenPair is the answer to sign-ins and refreshes
+type tokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // Seconds the access token is valid for
+	Role         string `json:"role"`
+}
+
+// sessions issues short-lived access tokens and the refresh tokens renewing
+// them. A refresh token is used once: refreshing revokes it, and using it
+// again revokes its whole session, as it must have been stolen.
+type sessions struct {
+	store      SessionStore
+	key        []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu        sync.Mutex
+	loggedOut map[string]time.Time // Session IDs, until their access tokens expire
+	nextSweep time.Time
+}
+
+// newSessions signs access tokens with a key derived from jwtSecret. Without
+// a secret the key would be public, so a random one is used instead: access
+// tokens are then only accepted by this instance until it restarts.
+func newSessions(store SessionStore, cfg config.AdminSessionsConfig, jwtSecret string) (*sessions, error) {
+	var key []byte
+	if jwtSecret != "" {
+		sum := sha256.Sum256([]byte("odin-admin:" + jwtSecret))
+		key = sum[:]
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	s := &sessions{
+		store:      store,
+		key:        key,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		loggedOut:  make(map[string]time.Time),
+	}
+	if s.accessTTL == 0 {
+		s.accessTTL = 15 * time.Minute
+	}
+	if s.refreshTTL == 0 {
+		s.refreshTTL = 7 * 24 * time.Hour
+	}
+	return s, nil
+}
+
+// start issues the tokens of a new session
+func (s *sessions) start(ctx context.Context, username, role string) (*tokenPair, error) {
+	return s.issue(ctx, uuid.NewString(), username, role)
+}
+
+func (s *sessions) issue(ctx context.Context, sessionID, username, role string) (*tokenPair, error) {
+	now := time.Now()
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, sessionClaims{
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			Audience:  jwt.ClaimStrings{sessionAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			ID:        uuid.NewString(),
+		},
+	}).SignedString(s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(buf)
+	err = s.store.CreateRefreshToken(ctx, &mongodb.RefreshTokenDocument{
+		ID:        refreshTokenID(refresh),
+		SessionID: sessionID,
+		Username:  username,
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+		Role:         role,
+	}, nil
+}
+
+// refresh exchanges a refresh token for new tokens of the same session.
+// role checks the user may still sign in and returns their current role.
+func (s *sessions) refresh(ctx context.Context, token string, role func(ctx context.Context, username string) (string, bool)) (*tokenPair, error) {
+	doc, err := s.store.GetRefreshToken(ctx, refreshTokenID(token))
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil || time.Now().After(doc.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	revoked, err := s.store.RevokeRefreshToken(ctx, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		// Used before: whoever holds the session's latest token may be the
+		// thief, so end the session for everybody
+		if err := s.end(ctx, doc.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	current, ok := role(ctx, doc.Username)
+	if !ok {
+		if err := s.end(ctx, doc.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+	return s.issue(ctx, doc.SessionID, doc.Username, current)
+}
+
+// end revokes the refresh tokens of a session and refuses its access tokens
+// on this instance until they expire
+func (s *sessions) end(ctx context.Context, sessionID string) error {
+	now := time.Now()
+	s.mu.Lock()
+	if now.After(s.nextSweep) {
+		for id, until := range s.loggedOut {
+			if now.After(until) {
+				delete(s.loggedOut, id)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+	s.loggedOut[sessionID] = now.Add(s.accessTTL)
+	s.mu.Unlock()
+
+	return s.store.RevokeRefreshTokens(ctx, sessionID)
+}
+
+// verify returns the claims of a valid access token
+func (s *sessions) verify(token string) (*sessionClaims, bool) {
+	claims := &sessionClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(sessionAudience), jwt.WithExpirationRequired())
+	if err != nil || !ValidRole(claims.Role) {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.loggedOut[claims.SessionID]; ok {
+		return nil, false
+	}
+	return claims, true
+}
+
+// refreshTokenID is the ID refresh tokens are stored by, so that the store
+// does not reveal them
+func refreshTokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestSession returns the claims of the access token a request carries
+// in the Authorization header or, from the admin UI, in the session cookie.
+// An expired UI session is renewed with its refresh cookie.
+func (h *AdminHandler) requestSession(c echo.Context) (*sessionClaims, bool) {
+	if h.sessions == nil {
+		return nil, false
+	}
+
+	const bearerPrefix = "Bearer "
+	if auth := c.Request().Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, bearerPrefix) {
+			return nil, false
+		}
+		return h.sessions.verify(auth[len(bearerPrefix):])
+	}
+
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		if claims, ok := h.sessions.verify(cookie.Value); ok {
+			return claims, true
+		}
+	}
+	cookie, err := c.Cookie(refreshCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, false
+	}
+	pair, err := h.sessions.refresh(c.Request().Context(), cookie.Value, h.signInRole)
+	if err != nil {
+		return nil, false
+	}
+	h.setSessionCookies(c, pair)
+	return h.sessions.verify(pair.AccessToken)
+}
+
+// signInRole returns the current role of a user who signed in, and whether
+// they still may
+func (h *AdminHandler) signInRole(ctx context.Context, username string) (string, bool) {
+	if username == h.username {
+		return RoleAdmin, true
+	}
+	if h.users == nil {
+		return "", false
+	}
+	return h.users.role(ctx, username)
+}
+
+func (h *AdminHandler) setSessionCookies(c echo.Context, pair *tokenPair) {
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    pair.AccessToken,
+		Path:     "/admin",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(h.sessions.accessTTL.Seconds()),
+	})
+	c.SetCookie(&http.Cookie{
+		Name:     refreshCookie,
+		Value:    pair.RefreshToken,
+		Path:     "/admin",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(h.sessions.refreshTTL.Seconds()),
+	})
+}
+
+func clearSessionCookies(c echo.Context) {
+	for _, name := range []string{sessionCookie, refreshCookie, "Authorization"} {
+		c.SetCookie(&http.Cookie{Name: name, Path: "/admin", HttpOnly: true, MaxAge: -1})
+	}
+}
+
+// audit records a sign-in or sign-out in the audit log
+func (h *AdminHandler) audit(c echo.Context, action, username string, success bool, message string) {
+	status := "success"
+	if !success {
+		status = "failure"
+	}
+	err := h.sessions.store.CreateAuditLog(c.Request().Context(), &mongodb.AuditLogDocument{
+		Action:    action,
+		Resource:  "admin",
+		Username:  username,
+		IPAddress: c.RealIP(),
+		Status:    status,
+		Message:   message,
+	})
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to record admin sign-in in the audit log")
+	}
+}
+
+// signIn checks credentials, records the attempt and starts a session
+func (h *AdminHandler) signIn(c echo.Context, username, password string) (*tokenPair, bool, error) {
+	role, ok := h.credentialsRole(c, username, password)
+	if !ok {
+		h.audit(c, "admin.login", username, false, "invalid credentials")
+		return nil, false, nil
+	}
+	pair, err := h.sessions.start(c.Request().Context(), username, role)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to start admin session")
+		return nil, true, err
+	}
+	h.audit(c, "admin.login", username, true, "")
+	return pair, true, nil
+}
+
+type signInRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// handleSessionLogin answers credentials with the tokens of a new session
+func (h *AdminHandler) handleSessionLogin(c echo.Context) error {
+	var req signInRequest
+	if err := c.Bind(&req); err != nil || req.Username == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	pair, ok, err := h.signIn(c, req.Username, req.Password)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start session"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid username or password"})
+	}
+	return c.JSON(http.StatusOK, pair)
+}
+
+// handleSessionRefresh exchanges a refresh token for new tokens
+func (h *AdminHandler) handleSessionRefresh(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	pair, err := h.sessions.refresh(c.Request().Context(), req.RefreshToken, h.signInRole)
+	if errors.Is(err, errInvalidRefreshToken) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to refresh admin session")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to refresh session"})
+	}
+	return c.JSON(http.StatusOK, pair)
+}
+
+// handleSessionLogout ends the session of the access token or of the
+// refresh token sent, and clears the cookies of the admin UI
+func (h *AdminHandler) handleSessionLogout(c echo.Context) error {
+	ctx := c.Request().Context()
+	sessionID, username := "", ""
+	if claims, ok := h.requestSession(c); ok {
+		sessionID, username = claims.SessionID, claims.Subject
+	} else {
+		var req refreshRequest
+		_ = c.Bind(&req)
+		if req.RefreshToken == "" {
+			if cookie, err := c.Cookie(refreshCookie); err == nil {
+				req.RefreshToken = cookie.Value
+			}
+		}
+		doc, err := h.sessions.store.GetRefreshToken(ctx, refreshTokenID(req.RefreshToken))
+		if err == nil && doc != nil {
+			sessionID, username = doc.SessionID, doc.Username
+		}
+	}
+	clearSessionCookies(c)
+	if sessionID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "No session to end"})
+	}
+
+	if err := h.sessions.end(ctx, sessionID); err != nil {
+		h.logger.WithError(err).Error("Failed to end admin session")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to end session"})
+	}
+	h.audit(c, "admin.logout", username, true, "")
+	return c.JSON(http.StatusOK, map[string]string{"message": "logged out"})
+}
@@ -4,38 +4,93 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"odin/pkg/cache"
 	"odin/pkg/config"
+	"odin/pkg/monitoring"
+	"odin/pkg/ratelimit"
+	"odin/pkg/tuning"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
 // SettingsHandler handles gateway settings management
 type SettingsHandler struct {
 	configPath string
-	config     *config.Config
+	config     *config.Store
+	cacheStore cache.Store
+	reloader   Reloader
+	logger     *logrus.Logger
+
+	inFlight         InFlightCounter
+	rateLimitCounter ratelimit.Counter
+	samples          *monitoring.RequestSamples
 }
 
-// NewSettingsHandler creates a new settings handler
-func NewSettingsHandler(configPath string, cfg *config.Config) *SettingsHandler {
+// Reloader applies a configuration to the running gateway
+type Reloader interface {
+	Reload(cfg *config.Config) (*config.ReloadReport, error)
+}
+
+// NewSettingsHandler creates a new settings handler. cacheStore may be nil
+// when response caching is disabled, and reloader when the gateway cannot
+// reload its configuration.
+func NewSettingsHandler(configPath string, cfg *config.Store, cacheStore cache.Store, reloader Reloader, logger *logrus.Logger) *SettingsHandler {
 	return &SettingsHandler{
 		configPath: configPath,
 		config:     cfg,
+		cacheStore: cacheStore,
+		reloader:   reloader,
+		logger:     logger,
+	}
+}
+
+// SetInFlightCounter reports the requests each service is serving in the
+// system stats
+func (h *SettingsHandler) SetInFlightCounter(counter InFlightCounter) {
+	h.inFlight = counter
+}
+
+// SetRateLimitCounter reports the health of the store rate limits are
+// counted in in the system stats
+func (h *SettingsHandler) SetRateLimitCounter(counter ratelimit.Counter) {
+	h.rateLimitCounter = counter
+}
+
+// SetRequestSamples estimates the impact of settings changes on the recent
+// requests of each service
+func (h *SettingsHandler) SetRequestSamples(samples *monitoring.RequestSamples) {
+	h.samples = samples
+}
+
+// impact estimates how a change would have affected recent requests, or
+// returns nil when requests are not sampled
+func (h *SettingsHandler) impact(estimate func(map[string][]monitoring.RequestSample) *SettingsImpact) *SettingsImpact {
+	if h.samples == nil {
+		return nil
 	}
+	return estimate(h.samples.Snapshot())
+}
+
+// dryRun reports whether the request only asks for the impact of a change
+func dryRun(c echo.Context) bool {
+	return c.QueryParam("dryRun") == "true"
 }
 
 // GetAllSettings returns all gateway settings
 func (h *SettingsHandler) GetAllSettings(c echo.Context) error {
-	return c.JSON(http.StatusOK, h.config)
+	return c.JSON(http.StatusOK, h.config.Load())
 }
 
 // GetServerSettings returns server configuration
 func (h *SettingsHandler) GetServerSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"server": h.config.Server,
+		"server": h.config.Load().Server,
 	})
 }
 
@@ -80,28 +135,45 @@ func (h *SettingsHandler) UpdateServerSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid gracefulTimeout duration"})
 	}
 
-	// Update config
-	h.config.Server.Port = req.Port
-	h.config.Server.Timeout = timeout
-	h.config.Server.ReadTimeout = readTimeout
-	h.config.Server.WriteTimeout = writeTimeout
-	h.config.Server.GracefulTimeout = gracefulTimeout
-	h.config.Server.Compression = req.Compression
+	// Requests are cut off by whichever timeout is shorter
+	cutoff := timeout
+	if writeTimeout > 0 && (cutoff <= 0 || writeTimeout < cutoff) {
+		cutoff = writeTimeout
+	}
+	var impact *SettingsImpact
+	if cutoff > 0 {
+		impact = h.impact(func(snapshot map[string][]monitoring.RequestSample) *SettingsImpact {
+			return timeoutImpact(snapshot, cutoff)
+		})
+	}
+	if dryRun(c) {
+		return c.JSON(http.StatusOK, map[string]interface{}{"dryRun": true, "impact": impact})
+	}
 
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err = h.config.Update(func(cfg *config.Config) error {
+		cfg.Server.Port = req.Port
+		cfg.Server.Timeout = timeout
+		cfg.Server.ReadTimeout = readTimeout
+		cfg.Server.WriteTimeout = writeTimeout
+		cfg.Server.GracefulTimeout = gracefulTimeout
+		cfg.Server.Compression = req.Compression
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Server settings updated successfully. Restart required to apply changes.",
+		"impact":  impact,
 	})
 }
 
 // GetLoggingSettings returns logging configuration
 func (h *SettingsHandler) GetLoggingSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"logging": h.config.Logging,
+		"logging": h.config.Load().Logging,
 	})
 }
 
@@ -122,12 +194,13 @@ func (h *SettingsHandler) UpdateLoggingSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid log level. Must be debug, info, warn, or error"})
 	}
 
-	// Update config
-	h.config.Logging.Level = req.Level
-	h.config.Logging.JSON = req.JSON
-
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err := h.config.Update(func(cfg *config.Config) error {
+		cfg.Logging.Level = req.Level
+		cfg.Logging.JSON = req.JSON
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
@@ -139,7 +212,7 @@ func (h *SettingsHandler) UpdateLoggingSettings(c echo.Context) error {
 // GetRateLimitSettings returns rate limiting configuration
 func (h *SettingsHandler) GetRateLimitSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"rateLimit": h.config.RateLimit,
+		"rateLimit": h.config.Load().RateLimit,
 	})
 }
 
@@ -167,27 +240,39 @@ func (h *SettingsHandler) UpdateRateLimitSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid duration"})
 	}
 
-	// Update config
-	h.config.RateLimit.Enabled = req.Enabled
-	h.config.RateLimit.Limit = req.Limit
-	h.config.RateLimit.Duration = duration
-	h.config.RateLimit.Strategy = req.Strategy
-	h.config.RateLimit.RedisURL = req.RedisURL
+	var impact *SettingsImpact
+	if req.Enabled {
+		impact = h.impact(func(snapshot map[string][]monitoring.RequestSample) *SettingsImpact {
+			return rateLimitImpact(snapshot, req.Limit, duration)
+		})
+	}
+	if dryRun(c) {
+		return c.JSON(http.StatusOK, map[string]interface{}{"dryRun": true, "impact": impact})
+	}
 
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err = h.config.Update(func(cfg *config.Config) error {
+		cfg.RateLimit.Enabled = req.Enabled
+		cfg.RateLimit.Limit = req.Limit
+		cfg.RateLimit.Duration = duration
+		cfg.RateLimit.Strategy = req.Strategy
+		cfg.RateLimit.RedisURL = req.RedisURL
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Rate limit settings updated successfully. Restart required to apply changes.",
+		"impact":  impact,
 	})
 }
 
 // GetCacheSettings returns cache configuration
 func (h *SettingsHandler) GetCacheSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"cache": h.config.Cache,
+		"cache": h.config.Load().Cache,
 	})
 }
 
@@ -216,27 +301,45 @@ func (h *SettingsHandler) UpdateCacheSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid strategy. Must be local or redis"})
 	}
 
-	// Update config
-	h.config.Cache.Enabled = req.Enabled
-	h.config.Cache.TTL = ttl
-	h.config.Cache.RedisURL = req.RedisURL
-	h.config.Cache.Strategy = req.Strategy
-	h.config.Cache.MaxSizeInMB = req.MaxSizeInMB
+	current := h.config.Load().Cache
+	var impact *SettingsImpact
+	switch {
+	case req.Enabled:
+		impact = h.impact(func(snapshot map[string][]monitoring.RequestSample) *SettingsImpact {
+			return cacheImpact(snapshot, ttl, true)
+		})
+	case current.Enabled:
+		impact = h.impact(func(snapshot map[string][]monitoring.RequestSample) *SettingsImpact {
+			return cacheImpact(snapshot, current.TTL, false)
+		})
+	}
+	if dryRun(c) {
+		return c.JSON(http.StatusOK, map[string]interface{}{"dryRun": true, "impact": impact})
+	}
 
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err = h.config.Update(func(cfg *config.Config) error {
+		cfg.Cache.Enabled = req.Enabled
+		cfg.Cache.TTL = ttl
+		cfg.Cache.RedisURL = req.RedisURL
+		cfg.Cache.Strategy = req.Strategy
+		cfg.Cache.MaxSizeInMB = req.MaxSizeInMB
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Cache settings updated successfully. Restart required to apply changes.",
+		"impact":  impact,
 	})
 }
 
 // GetMonitoringSettings returns monitoring configuration
 func (h *SettingsHandler) GetMonitoringSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"monitoring": h.config.Monitoring,
+		"monitoring": h.config.Load().Monitoring,
 	})
 }
 
@@ -252,13 +355,14 @@ func (h *SettingsHandler) UpdateMonitoringSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
-	// Update config
-	h.config.Monitoring.Enabled = req.Enabled
-	h.config.Monitoring.Path = req.Path
-	h.config.Monitoring.WebhookURL = req.WebhookURL
-
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err := h.config.Update(func(cfg *config.Config) error {
+		cfg.Monitoring.Enabled = req.Enabled
+		cfg.Monitoring.Path = req.Path
+		cfg.Monitoring.WebhookURL = req.WebhookURL
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
@@ -270,7 +374,7 @@ func (h *SettingsHandler) UpdateMonitoringSettings(c echo.Context) error {
 // GetTracingSettings returns tracing configuration
 func (h *SettingsHandler) GetTracingSettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"tracing": h.config.Tracing,
+		"tracing": h.config.Load().Tracing,
 	})
 }
 
@@ -295,17 +399,18 @@ func (h *SettingsHandler) UpdateTracingSettings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Sample rate must be between 0 and 1"})
 	}
 
-	// Update config
-	h.config.Tracing.Enabled = req.Enabled
-	h.config.Tracing.ServiceName = req.ServiceName
-	h.config.Tracing.ServiceVersion = req.ServiceVersion
-	h.config.Tracing.Environment = req.Environment
-	h.config.Tracing.Endpoint = req.Endpoint
-	h.config.Tracing.SampleRate = req.SampleRate
-	h.config.Tracing.Insecure = req.Insecure
-
-	// Save to file
-	if err := h.saveConfig(); err != nil {
+	// Update config and save it to file
+	err := h.config.Update(func(cfg *config.Config) error {
+		cfg.Tracing.Enabled = req.Enabled
+		cfg.Tracing.ServiceName = req.ServiceName
+		cfg.Tracing.ServiceVersion = req.ServiceVersion
+		cfg.Tracing.Environment = req.Environment
+		cfg.Tracing.Endpoint = req.Endpoint
+		cfg.Tracing.SampleRate = req.SampleRate
+		cfg.Tracing.Insecure = req.Insecure
+		return h.saveConfig(cfg)
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save configuration"})
 	}
 
@@ -323,29 +428,30 @@ func (h *SettingsHandler) GetGatewayInfo(c echo.Context) error {
 		lastModified = fileInfo.ModTime().Format(time.RFC3339)
 	}
 
+	cfg := h.config.Load()
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"configPath":     h.configPath,
 		"configModified": lastModified,
-		"servicesCount":  len(h.config.Services),
-		"pluginsCount":   len(h.config.Plugins.Plugins),
+		"servicesCount":  len(cfg.Services),
+		"pluginsCount":   len(cfg.Plugins.Plugins),
 		"features": map[string]bool{
-			"rateLimit":   h.config.RateLimit.Enabled,
-			"cache":       h.config.Cache.Enabled,
-			"monitoring":  h.config.Monitoring.Enabled,
-			"tracing":     h.config.Tracing.Enabled,
-			"plugins":     h.config.Plugins.Enabled,
-			"wasm":        h.config.WASM.Enabled,
-			"serviceMesh": h.config.ServiceMesh.Enabled,
-			"openapi":     h.config.OpenAPI.Enabled,
-			"mongodb":     h.config.MongoDB.Enabled,
-			"ai":          h.config.AI.Enabled,
+			"rateLimit":   cfg.RateLimit.Enabled,
+			"cache":       cfg.Cache.Enabled,
+			"monitoring":  cfg.Monitoring.Enabled,
+			"tracing":     cfg.Tracing.Enabled,
+			"plugins":     cfg.Plugins.Enabled,
+			"wasm":        cfg.WASM.Enabled,
+			"serviceMesh": cfg.ServiceMesh.Enabled,
+			"openapi":     cfg.OpenAPI.Enabled,
+			"mongodb":     cfg.MongoDB.Enabled,
+			"ai":          cfg.AI.Enabled,
 		},
 	})
 }
 
 // ExportConfig exports the current configuration
 func (h *SettingsHandler) ExportConfig(c echo.Context) error {
-	data, err := yaml.Marshal(h.config)
+	data, err := yaml.Marshal(h.config.Load())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to marshal configuration"})
 	}
@@ -397,9 +503,9 @@ func (h *SettingsHandler) ValidateConfig(c echo.Context) error {
 	})
 }
 
-// saveConfig saves the current configuration to file
-func (h *SettingsHandler) saveConfig() error {
-	data, err := yaml.Marshal(h.config)
+// saveConfig saves cfg to file
+func (h *SettingsHandler) saveConfig(cfg *config.Config) error {
+	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -498,17 +604,25 @@ func (h *SettingsHandler) RestoreConfigBackup(c echo.Context) error {
 
 	// Reload config
 	newConfig := testConfig
-	h.config = &newConfig
+	h.config.Swap(func(*config.Config) (*config.Config, error) { return &newConfig, nil })
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "Configuration restored successfully. Restart required to apply changes.",
 	})
 }
 
-// GetSystemStats returns system statistics
+// GetSystemStats returns request statistics along with the state of the Go
+// runtime, the requests each service is serving and the health of the cache
+// and rate limit stores
 func (h *SettingsHandler) GetSystemStats(c echo.Context) error {
 	metrics := GetCollector().GetMetrics()
 
+	inFlight := map[string]int64{}
+	if h.inFlight != nil {
+		inFlight = h.inFlight.InFlight()
+	}
+
+	ctx := c.Request().Context()
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"requests":          metrics.TotalRequests,
 		"avgResponseTime":   metrics.AvgResponseTime,
@@ -516,30 +630,115 @@ func (h *SettingsHandler) GetSystemStats(c echo.Context) error {
 		"successRate":       metrics.SuccessRate,
 		"errorRate":         (1.0 - metrics.SuccessRate) * 100,
 		"timestamp":         time.Now().Unix(),
+		"uptimeSeconds":     int64(time.Since(startTime).Seconds()),
+		"startedAt":         startTime.Format(time.RFC3339),
+		"runtime":           runtimeStats(),
+		"build":             buildStats(),
+		"inFlight":          inFlight,
+		"stores": map[string]StoreHealth{
+			"cache":     storeHealth(ctx, h.cacheStore),
+			"rateLimit": storeHealth(ctx, h.rateLimitCounter),
+		},
 	})
 }
 
-// ClearCache clears the gateway cache
+// GetRuntimeSettings returns the effective GOMAXPROCS and memory limit along
+// with the container limits they are derived from
+func (h *SettingsHandler) GetRuntimeSettings(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"runtime":    tuning.Current(),
+		"config":     h.config.Load().Runtime,
+		"goVersion":  runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+	})
+}
+
+// ClearCache purges cached responses: all of them, those to paths under a
+// prefix, or those of a service
 func (h *SettingsHandler) ClearCache(c echo.Context) error {
-	// This would need to interact with the actual cache store
-	// For now, return a placeholder response
-	return c.JSON(http.StatusOK, map[string]string{
+	if h.cacheStore == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Cache is not enabled"})
+	}
+
+	var req struct {
+		Prefix  string `json:"prefix"`
+		Service string `json:"service"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Prefix != "" && req.Service != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Specify either prefix or service, not both"})
+	}
+
+	prefix := req.Prefix
+	if req.Service != "" {
+		svc := h.findService(req.Service)
+		if svc == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+		}
+		prefix = svc.BasePath
+	}
+
+	purged, err := h.cacheStore.Purge(prefix)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":  fmt.Sprintf("Failed to clear cache: %v", err),
+			"purged": purged,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Cache cleared successfully",
+		"prefix":  prefix,
+		"service": req.Service,
+		"purged":  purged,
 	})
 }
 
-// ReloadConfig reloads the configuration from file
+// findService returns the configured service with the given name
+func (h *SettingsHandler) findService(name string) *config.ServiceConfig {
+	services := h.config.Load().Services
+	for i := range services {
+		if services[i].Name == name {
+			return &services[i]
+		}
+	}
+	return nil
+}
+
+// ReloadConfig loads and validates the configuration file, then applies it
+// the same way as SIGHUP. The report lists the sections that were applied
+// and those that only take effect after a restart.
 func (h *SettingsHandler) ReloadConfig(c echo.Context) error {
-	// This would trigger a configuration reload
-	// For now, return a placeholder response
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "Configuration reload initiated. This requires a restart to take full effect.",
+	if h.reloader == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Configuration reload is not available"})
+	}
+
+	cfg, err := config.Load(h.configPath, h.logger)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	report, err := h.reloader.Reload(cfg)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	message := "Configuration reloaded"
+	if len(report.RequiresRestart) > 0 {
+		message = "Configuration reloaded. Some changes require a restart to take effect."
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":         message,
+		"applied":         report.Applied,
+		"requiresRestart": report.RequiresRestart,
 	})
 }
 
 // GetConfigAsJSON returns the current configuration as JSON
 func (h *SettingsHandler) GetConfigAsJSON(c echo.Context) error {
-	data, err := json.MarshalIndent(h.config, "", "  ")
+	data, err := json.MarshalIndent(h.config.Load(), "", "  ")
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to marshal configuration"})
 	}
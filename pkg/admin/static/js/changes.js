@@ -0,0 +1,139 @@
+/**
+ * Odin API Gateway - Change Notifications Module
+ * Tells the operator when another admin changes the configuration, services
+ * or plugins, so that they do not keep editing stale state
+ */
+
+(() => {
+  'use strict';
+
+  const headerName = 'X-Admin-Session';
+  const safeMethods = ['GET', 'HEAD', 'OPTIONS', 'TRACE'];
+  const maxRetryDelay = 30000;
+
+  let session = '';
+  let retryDelay = 1000;
+
+  function isChange(method, url) {
+    if (!session || safeMethods.includes((method || 'GET').toUpperCase())) {
+      return false;
+    }
+    try {
+      return new URL(url, window.location.href).origin === window.location.origin;
+    } catch (e) {
+      return false;
+    }
+  }
+
+  // Name the session on our own changes so that the gateway does not
+  // report them back to us
+
+  const nativeFetch = window.fetch.bind(window);
+  window.fetch = (input, init = {}) => {
+    const isRequest = input instanceof Request;
+    const method = init.method || (isRequest ? input.method : 'GET');
+    const url = isRequest ? input.url : String(input);
+
+    if (isChange(method, url)) {
+      const headers = new Headers(init.headers || (isRequest ? input.headers : undefined));
+      headers.set(headerName, session);
+      init = { ...init, headers };
+    }
+    return nativeFetch(input, init);
+  };
+
+  const nativeOpen = XMLHttpRequest.prototype.open;
+  const nativeSend = XMLHttpRequest.prototype.send;
+  XMLHttpRequest.prototype.open = function (method, url, ...rest) {
+    this.odinIsChange = isChange(method, url);
+    return nativeOpen.call(this, method, url, ...rest);
+  };
+  XMLHttpRequest.prototype.send = function (body) {
+    if (this.odinIsChange) {
+      this.setRequestHeader(headerName, session);
+    }
+    return nativeSend.call(this, body);
+  };
+
+  document.addEventListener('htmx:configRequest', (event) => {
+    if (isChange(event.detail.verb, event.detail.path)) {
+      event.detail.headers[headerName] = session;
+    }
+  });
+
+  function describe(change) {
+    const what = change.target ? `${change.kind} "${change.target}"` : change.kind;
+    const when = new Date(change.time).toLocaleTimeString();
+    return `${change.user} ${change.action} ${what} at ${when}.`;
+  }
+
+  function banner() {
+    let el = document.getElementById('odin-change-banner');
+    if (el) {
+      return el;
+    }
+
+    el = document.createElement('div');
+    el.id = 'odin-change-banner';
+    el.className = 'alert alert-warning shadow d-flex align-items-start gap-3 m-0';
+    el.setAttribute('role', 'alert');
+    el.style.cssText = 'position:fixed;top:1rem;left:50%;transform:translateX(-50%);z-index:1080;max-width:40rem;';
+
+    const list = document.createElement('ul');
+    list.className = 'mb-0 ps-3 flex-grow-1';
+
+    const reload = document.createElement('button');
+    reload.type = 'button';
+    reload.className = 'btn btn-sm btn-warning';
+    reload.textContent = 'Reload';
+    reload.addEventListener('click', () => window.location.reload());
+
+    const dismiss = document.createElement('button');
+    dismiss.type = 'button';
+    dismiss.className = 'btn-close';
+    dismiss.setAttribute('aria-label', 'Dismiss');
+    dismiss.addEventListener('click', () => el.remove());
+
+    el.append(list, reload, dismiss);
+    document.body.appendChild(el);
+    return el;
+  }
+
+  function show(change) {
+    const item = document.createElement('li');
+    item.textContent = `${describe(change)} This page may be out of date.`;
+    banner().querySelector('ul').appendChild(item);
+  }
+
+  function connect() {
+    const scheme = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const ws = new WebSocket(`${scheme}//${window.location.host}/admin/ws/changes`);
+
+    ws.addEventListener('message', (event) => {
+      let message;
+      try {
+        message = JSON.parse(event.data);
+      } catch (e) {
+        return;
+      }
+      if (message.type === 'hello') {
+        session = message.session;
+        retryDelay = 1000;
+      } else if (message.type === 'change') {
+        show(message);
+      }
+    });
+
+    ws.addEventListener('close', () => {
+      session = '';
+      setTimeout(connect, retryDelay);
+      retryDelay = Math.min(retryDelay * 2, maxRetryDelay);
+    });
+  }
+
+  if (document.readyState === 'loading') {
+    document.addEventListener('DOMContentLoaded', connect);
+  } else {
+    connect();
+  }
+})();
@@ -0,0 +1,89 @@
+/**
+ * Odin API Gateway - CSRF Module
+ * Sends the admin CSRF token with every state-changing request
+ */
+
+(() => {
+  'use strict';
+
+  const cookieName = 'odin_csrf';
+  const headerName = 'X-CSRF-Token';
+  const fieldName = '_csrf';
+  const safeMethods = ['GET', 'HEAD', 'OPTIONS', 'TRACE'];
+
+  /**
+   * Read the token the gateway issued in the CSRF cookie
+   */
+  function token() {
+    const prefix = `${cookieName}=`;
+    const cookie = document.cookie.split('; ').find((c) => c.startsWith(prefix));
+    return cookie ? decodeURIComponent(cookie.slice(prefix.length)) : '';
+  }
+
+  function needsToken(method, url) {
+    if (safeMethods.includes((method || 'GET').toUpperCase())) {
+      return false;
+    }
+    try {
+      return new URL(url, window.location.href).origin === window.location.origin;
+    } catch (e) {
+      return false;
+    }
+  }
+
+  // fetch
+  const nativeFetch = window.fetch.bind(window);
+  window.fetch = (input, init = {}) => {
+    const isRequest = input instanceof Request;
+    const method = init.method || (isRequest ? input.method : 'GET');
+    const url = isRequest ? input.url : String(input);
+
+    if (needsToken(method, url)) {
+      const headers = new Headers(init.headers || (isRequest ? input.headers : undefined));
+      headers.set(headerName, token());
+      init = { ...init, headers };
+    }
+    return nativeFetch(input, init);
+  };
+
+  // XMLHttpRequest
+  const nativeOpen = XMLHttpRequest.prototype.open;
+  const nativeSend = XMLHttpRequest.prototype.send;
+  XMLHttpRequest.prototype.open = function (method, url, ...rest) {
+    this.odinNeedsCSRF = needsToken(method, url);
+    return nativeOpen.call(this, method, url, ...rest);
+  };
+  XMLHttpRequest.prototype.send = function (body) {
+    if (this.odinNeedsCSRF) {
+      this.setRequestHeader(headerName, token());
+    }
+    return nativeSend.call(this, body);
+  };
+
+  // HTMX
+  document.addEventListener('htmx:configRequest', (event) => {
+    if (needsToken(event.detail.verb, event.detail.path)) {
+      event.detail.headers[headerName] = token();
+    }
+  });
+
+  // Plain form posts
+  document.addEventListener(
+    'submit',
+    (event) => {
+      const form = event.target;
+      if (!(form instanceof HTMLFormElement) || !needsToken(form.method, form.action)) {
+        return;
+      }
+      let field = form.querySelector(`input[name="${fieldName}"]`);
+      if (!field) {
+        field = document.createElement('input');
+        field.type = 'hidden';
+        field.name = fieldName;
+        form.appendChild(field);
+      }
+      field.value = token();
+    },
+    true
+  );
+})();
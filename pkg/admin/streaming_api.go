@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/streaming"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StreamingHandler reports the state of the access/audit streaming pipeline
+type StreamingHandler struct {
+	pipeline *streaming.Pipeline
+}
+
+// NewStreamingHandler creates a new streaming handler
+func NewStreamingHandler(pipeline *streaming.Pipeline) *StreamingHandler {
+	return &StreamingHandler{pipeline: pipeline}
+}
+
+// RegisterRoutes registers the streaming API routes
+func (h *StreamingHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/streaming/status", h.getStatus)
+}
+
+// getStatus returns the pipeline counters
+func (h *StreamingHandler) getStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.pipeline.Stats())
+}
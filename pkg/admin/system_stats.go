@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// startTime approximates when the gateway process started
+var startTime = time.Now()
+
+// storePingTimeout bounds how long the system stats wait for a store
+const storePingTimeout = 2 * time.Second
+
+// InFlightCounter reports the number of requests each service is serving
+type InFlightCounter interface {
+	InFlight() map[string]int64
+}
+
+// Pinger is a backing store whose reachability can be checked
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// RuntimeStats describes the Go runtime of the gateway process
+type RuntimeStats struct {
+	Goroutines     int     `json:"goroutines"`
+	HeapAlloc      uint64  `json:"heapAlloc"`
+	HeapInuse      uint64  `json:"heapInuse"`
+	HeapObjects    uint64  `json:"heapObjects"`
+	TotalAlloc     uint64  `json:"totalAlloc"`
+	Sys            uint64  `json:"sys"`
+	NumGC          uint32  `json:"numGC"`
+	GCPauseTotalMs float64 `json:"gcPauseTotalMs"`
+	GCPauseLastMs  float64 `json:"gcPauseLastMs"`
+	// GCPauseMaxMs is the longest of the last 256 pauses
+	GCPauseMaxMs float64 `json:"gcPauseMaxMs"`
+	// OpenFDs is -1 where open file descriptors cannot be counted
+	OpenFDs int `json:"openFDs"`
+}
+
+// BuildStats describes the binary the gateway runs
+type BuildStats struct {
+	GoVersion string `json:"goVersion"`
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// StoreHealth describes whether a backing store can be reached
+type StoreHealth struct {
+	Status string `json:"status"` // ok, unreachable or disabled
+	Error  string `json:"error,omitempty"`
+}
+
+func runtimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAlloc:      mem.HeapAlloc,
+		HeapInuse:      mem.HeapInuse,
+		HeapObjects:    mem.HeapObjects,
+		TotalAlloc:     mem.TotalAlloc,
+		Sys:            mem.Sys,
+		NumGC:          mem.NumGC,
+		GCPauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+		OpenFDs:        openFDs(),
+	}
+	if mem.NumGC > 0 {
+		stats.GCPauseLastMs = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+	}
+	for _, pause := range mem.PauseNs {
+		if ms := float64(pause) / 1e6; ms > stats.GCPauseMaxMs {
+			stats.GCPauseMaxMs = ms
+		}
+	}
+	return stats
+}
+
+// openFDs counts the open file descriptors of the process on Linux
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	// ReadDir itself holds one descriptor open while listing
+	return len(entries) - 1
+}
+
+func buildStats() BuildStats {
+	stats := BuildStats{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return stats
+	}
+	stats.Module = info.Main.Path
+	stats.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			stats.Revision = setting.Value
+		case "vcs.time":
+			stats.BuildTime = setting.Value
+		case "vcs.modified":
+			stats.Modified = setting.Value == "true"
+		}
+	}
+	return stats
+}
+
+// storeHealth pings store, which is nil when its feature is disabled
+func storeHealth(ctx context.Context, store Pinger) StoreHealth {
+	if store == nil {
+		return StoreHealth{Status: "disabled"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, storePingTimeout)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		return StoreHealth{Status: "unreachable", Error: err.Error()}
+	}
+	return StoreHealth{Status: "ok"}
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"net/http"
+	"slices"
+
+	"odin/pkg/config"
+	"odin/pkg/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TargetsHandler takes upstream targets out of service and back, e.g. for
+// planned backend maintenance
+type TargetsHandler struct {
+	maintenance *health.Maintenance
+	config      *config.Store
+}
+
+// NewTargetsHandler creates a new target maintenance handler
+func NewTargetsHandler(maintenance *health.Maintenance, cfg *config.Store) *TargetsHandler {
+	return &TargetsHandler{maintenance: maintenance, config: cfg}
+}
+
+// RegisterRoutes registers the target maintenance API routes
+func (h *TargetsHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/targets/disabled", h.listDisabled)
+	g.POST("/api/targets/disable", h.disableTarget)
+	g.POST("/api/targets/enable", h.enableTarget)
+}
+
+// disabledTarget is a disabled target with the services and TCP listeners
+// it was taken out of
+type disabledTarget struct {
+	health.DisabledTarget
+	UsedBy []string `json:"usedBy"`
+}
+
+func (h *TargetsHandler) listDisabled(c echo.Context) error {
+	disabled := h.maintenance.Disabled()
+	views := make([]disabledTarget, 0, len(disabled))
+	for _, d := range disabled {
+		views = append(views, disabledTarget{DisabledTarget: d, UsedBy: targetUsers(h.config.Load(), d.Target)})
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+func (h *TargetsHandler) disableTarget(c echo.Context) error {
+	var req struct {
+		Target string `json:"target"`
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Target == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "target is required"})
+	}
+	if len(req.Reason) > 500 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason cannot be longer than 500 characters"})
+	}
+
+	users := targetUsers(h.config.Load(), req.Target)
+	if len(users) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "target is not used by any service or TCP listener"})
+	}
+
+	d := h.maintenance.Disable(req.Target, req.Reason, reviewer(c))
+	return c.JSON(http.StatusOK, disabledTarget{DisabledTarget: d, UsedBy: users})
+}
+
+func (h *TargetsHandler) enableTarget(c echo.Context) error {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if !h.maintenance.Enable(req.Target) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "target is not disabled"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"target": req.Target, "status": "enabled"})
+}
+
+// targetUsers returns the services and TCP listeners of cfg that send
+// traffic to target
+func targetUsers(cfg *config.Config, target string) []string {
+	users := []string{}
+	for _, svc := range cfg.Services {
+		used := slices.Contains(svc.Targets, target)
+		if svc.Versioning != nil {
+			for _, version := range svc.Versioning.Versions {
+				used = used || slices.Contains(version.Targets, target)
+			}
+		}
+		if used {
+			users = append(users, "service "+svc.Name)
+		}
+	}
+	for _, listener := range cfg.TCP.Listeners {
+		used := slices.Contains(listener.Targets, target)
+		for _, route := range listener.Routes {
+			used = used || slices.Contains(route.Targets, target)
+		}
+		if used {
+			users = append(users, "tcp listener "+listener.Name)
+		}
+	}
+	return users
+}
@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/tcpproxy"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TCPHandler exposes the state of the TCP proxy listeners
+type TCPHandler struct {
+	proxies []*tcpproxy.Proxy
+}
+
+// NewTCPHandler creates a new TCP proxy handler
+func NewTCPHandler(proxies []*tcpproxy.Proxy) *TCPHandler {
+	return &TCPHandler{proxies: proxies}
+}
+
+// RegisterRoutes registers the TCP proxy API routes
+func (h *TCPHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/tcp/stats", h.getStats)
+}
+
+// getStats returns the connection counters and target health of each
+// listener
+func (h *TCPHandler) getStats(c echo.Context) error {
+	stats := make([]tcpproxy.Stats, 0, len(h.proxies))
+	for _, proxy := range h.proxies {
+		stats = append(stats, proxy.Stats())
+	}
+	return c.JSON(http.StatusOK, stats)
+}
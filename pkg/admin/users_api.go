@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+
+	"odin/pkg/mongodb"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,64}$`)
+
+// UsersHandler manages the users of the admin interface and their roles
+type UsersHandler struct {
+	store    UserStore
+	onChange func() // Called after a user changed, e.g. to forget credentials
+}
+
+// NewUsersHandler creates a new users handler
+func NewUsersHandler(store UserStore) *UsersHandler {
+	return &UsersHandler{store: store, onChange: func() {}}
+}
+
+// RegisterRoutes registers the user API routes
+func (h *UsersHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/users", h.listUsers)
+	g.POST("/api/users", h.createUser)
+	g.PUT("/api/users/:id", h.updateUser)
+	g.DELETE("/api/users/:id", h.deleteUser)
+}
+
+// userRequest is the body accepted when creating or updating a user; fields
+// left out are kept on updates
+type userRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	Active   *bool  `json:"active"` // default: true
+}
+
+// withoutPassword returns a copy of user safe to answer with
+func withoutPassword(user *mongodb.UserDocument) *mongodb.UserDocument {
+	u := *user
+	u.Password = ""
+	return &u
+}
+
+func (h *UsersHandler) listUsers(c echo.Context) error {
+	users, err := h.store.ListUsers(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list users"})
+	}
+
+	list := make([]*mongodb.UserDocument, 0, len(users))
+	for _, user := range users {
+		list = append(list, withoutPassword(user))
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func (h *UsersHandler) createUser(c echo.Context) error {
+	var req userRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	var details []string
+	if !usernamePattern.MatchString(req.Username) {
+		details = append(details, "username must be 3 to 64 letters, digits, '.', '_' or '-'")
+	}
+	details = append(details, validateUser(req)...)
+	if req.Password == "" {
+		details = append(details, "password is required")
+	}
+	if len(details) > 0 {
+		return validationFailed(c, details)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+	}
+	user := &mongodb.UserDocument{
+		ID:       uuid.NewString(),
+		Username: req.Username,
+		Email:    req.Email,
+		Password: string(hash),
+		Role:     req.Role,
+		Active:   req.Active == nil || *req.Active,
+		APIKeys:  []string{},
+	}
+	if err := h.store.CreateUser(c.Request().Context(), user); err != nil {
+		if errors.Is(err, mongodb.ErrDuplicate) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Username or email is already taken"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
+	}
+	return c.JSON(http.StatusCreated, withoutPassword(user))
+}
+
+// updateUser changes the email, password, role or state of a user; the
+// username cannot change
+func (h *UsersHandler) updateUser(c echo.Context) error {
+	var req userRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := c.Request().Context()
+	user, err := h.store.GetUser(ctx, c.Param("id"))
+	if err != nil || user == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	if req.Username != "" && req.Username != user.Username {
+		return validationFailed(c, []string{"username cannot be changed"})
+	}
+	if req.Email == "" {
+		req.Email = user.Email
+	}
+	if req.Role == "" {
+		req.Role = user.Role
+	}
+	if details := validateUser(req); len(details) > 0 {
+		return validationFailed(c, details)
+	}
+
+	user.Email = req.Email
+	user.Role = req.Role
+	if req.Active != nil {
+		user.Active = *req.Active
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+		}
+		user.Password = string(hash)
+	}
+	if err := h.store.UpdateUser(ctx, user.ID, user); err != nil {
+		if errors.Is(err, mongodb.ErrDuplicate) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Email is already taken"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	}
+	h.onChange()
+	return c.JSON(http.StatusOK, withoutPassword(user))
+}
+
+func (h *UsersHandler) deleteUser(c echo.Context) error {
+	ctx := c.Request().Context()
+	if _, err := h.store.GetUser(ctx, c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	if err := h.store.DeleteUser(ctx, c.Param("id")); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete user"})
+	}
+	h.onChange()
+	return c.JSON(http.StatusOK, map[string]string{"message": "user deleted"})
+}
+
+// validateUser checks the fields of a request shared by creates and updates
+func validateUser(req userRequest) []string {
+	var details []string
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		details = append(details, "email must be a valid address")
+	}
+	if req.Password != "" && (len(req.Password) < 8 || len(req.Password) > 72) {
+		details = append(details, "password must be 8 to 72 characters")
+	}
+	if !ValidRole(req.Role) {
+		details = append(details, "role must be admin, user or viewer")
+	}
+	return details
+}
+
+func validationFailed(c echo.Context, details []string) error {
+	return c.JSON(http.StatusBadRequest, map[string]interface{}{
+		"error":   "Request validation failed",
+		"details": details,
+	})
+}
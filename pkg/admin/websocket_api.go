@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"net/http"
+
+	"odin/pkg/websocket"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WebSocketHandler exposes the WebSocket connection counters
+type WebSocketHandler struct {
+	limiter *websocket.Limiter
+}
+
+// NewWebSocketHandler creates a new WebSocket handler
+func NewWebSocketHandler(limiter *websocket.Limiter) *WebSocketHandler {
+	return &WebSocketHandler{limiter: limiter}
+}
+
+// RegisterRoutes registers the WebSocket API routes
+func (h *WebSocketHandler) RegisterRoutes(g *echo.Group) {
+	g.GET("/api/websocket/stats", h.getStats)
+}
+
+// getStats returns the open connections and how many were accepted,
+// rejected and closed for each service
+func (h *WebSocketHandler) getStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.limiter.Stats())
+}
@@ -0,0 +1,170 @@
+// Package adminclient calls the admin API of a running gateway, for the
+// command line tools.
+package adminclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Resource mirrors admin.DesiredResource without pulling the admin package
+// and its dependencies into the command line tools
+type Resource struct {
+	ID     string                 `json:"id"`
+	Kind   string                 `json:"kind"`
+	Name   string                 `json:"name"`
+	ETag   string                 `json:"etag"`
+	Result string                 `json:"result,omitempty"`
+	Spec   map[string]interface{} `json:"spec,omitempty"`
+}
+
+// Error is an error answered by the admin API
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("admin API returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+// Client calls the admin API with a bearer token, or with basic
+// authentication when it has no token
+type Client struct {
+	BaseURL  string
+	Token    string
+	Username string
+	Password string
+	HTTP     *http.Client
+}
+
+// New creates a client for the gateway at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Do sends a request with an optional JSON or YAML body to path, relative to
+// the gateway, and decodes the JSON answer into out unless it is nil. Bodies
+// starting with { or [ are sent as JSON.
+func (c *Client) Do(method, path string, body []byte, out interface{}) error {
+	resp, err := c.send(c.HTTP, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Stream sends a GET request to path and returns the answer as it arrives,
+// without a timeout. Callers close it.
+func (c *Client) Stream(path string) (io.ReadCloser, error) {
+	client := *c.HTTP
+	client.Timeout = 0
+	resp, err := c.send(&client, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) send(client *http.Client, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		contentType := "application/yaml"
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var apiErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return nil, &Error{StatusCode: resp.StatusCode, Message: apiErr.Error + apiErr.Message}
+	}
+	return resp, nil
+}
+
+// Resources lists the resources of a kind of the declarative API: services,
+// clusters or plugins
+func (c *Client) Resources(kind string) ([]Resource, error) {
+	var resources []Resource
+	err := c.Do(http.MethodGet, "/admin/api/declarative/"+kind, nil, &resources)
+	return resources, err
+}
+
+// Resource returns a resource of the declarative API
+func (c *Client) Resource(kind, name string) (*Resource, error) {
+	var res Resource
+	if err := c.Do(http.MethodGet, resourcePath(kind, name, false), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Apply reconciles a resource to spec, a YAML or JSON document. With dryRun
+// the gateway only reports what it would do.
+func (c *Client) Apply(kind, name string, spec []byte, dryRun bool) (*Resource, error) {
+	var res Resource
+	if err := c.Do(http.MethodPut, resourcePath(kind, name, dryRun), spec, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Delete deletes a resource. With dryRun the gateway only reports what it
+// would do.
+func (c *Client) Delete(kind, name string, dryRun bool) (*Resource, error) {
+	var res Resource
+	if err := c.Do(http.MethodDelete, resourcePath(kind, name, dryRun), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func resourcePath(kind, name string, dryRun bool) string {
+	path := "/admin/api/declarative/" + kind + "/" + url.PathEscape(name)
+	if dryRun {
+		path += "?dryRun=true"
+	}
+	return path
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"odin/pkg/config"
+	"odin/pkg/transform"
 	"strings"
 	"sync"
 	"time"
@@ -17,7 +18,9 @@ import (
 
 type Aggregator struct {
 	logger         *logrus.Logger
+	mu             sync.RWMutex
 	serviceConfigs map[string]config.ServiceConfig
+	paths          map[string]transform.Path
 	client         *http.Client
 }
 
@@ -35,16 +38,59 @@ type AggregateResponse struct {
 }
 
 func New(logger *logrus.Logger, services []config.ServiceConfig) *Aggregator {
+	a := &Aggregator{
+		logger: logger,
+		client: &http.Client{},
+	}
+	a.SetServices(services)
+	return a
+}
+
+// SetServices replaces the services requests are aggregated from, e.g. after
+// the configuration is reloaded
+func (a *Aggregator) SetServices(services []config.ServiceConfig) {
 	serviceMap := make(map[string]config.ServiceConfig)
+	paths := make(map[string]transform.Path)
 	for _, svc := range services {
 		serviceMap[svc.Name] = svc
+
+		// Split mapping paths once instead of on every request
+		if svc.Aggregation == nil {
+			continue
+		}
+		for _, dep := range svc.Aggregation.Dependencies {
+			for _, mappings := range [][]config.MappingConfig{dep.ParameterMapping, dep.ResultMapping} {
+				for _, mapping := range mappings {
+					paths[mapping.From] = transform.CompilePath(mapping.From)
+					paths[mapping.To] = transform.CompilePath(mapping.To)
+				}
+			}
+		}
 	}
 
-	return &Aggregator{
-		logger:         logger,
-		serviceConfigs: serviceMap,
-		client:         &http.Client{},
+	a.mu.Lock()
+	a.serviceConfigs = serviceMap
+	a.paths = paths
+	a.mu.Unlock()
+}
+
+// service returns the configuration of a service
+func (a *Aggregator) service(name string) (config.ServiceConfig, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	svc, ok := a.serviceConfigs[name]
+	return svc, ok
+}
+
+// path returns the compiled form of a mapping path
+func (a *Aggregator) path(expr string) transform.Path {
+	a.mu.RLock()
+	path, ok := a.paths[expr]
+	a.mu.RUnlock()
+	if ok {
+		return path
 	}
+	return transform.CompilePath(expr)
 }
 
 func (a *Aggregator) RegisterRoutes(e *echo.Echo) {
@@ -75,7 +121,7 @@ func (a *Aggregator) AggregateHandler(c echo.Context) error {
 		go func(svcName string) {
 			defer wg.Done()
 
-			svcConfig, exists := a.serviceConfigs[svcName]
+			svcConfig, exists := a.service(svcName)
 			if !exists {
 				resultsMu.Lock()
 				results[svcName] = &ServiceResponse{
@@ -170,7 +216,7 @@ func (a *Aggregator) callService(ctx context.Context, c echo.Context, svc *confi
 }
 
 func (a *Aggregator) EnrichResponse(ctx context.Context, serviceName string, responseBody []byte, headers http.Header, authToken string) ([]byte, error) {
-	serviceConfig, exists := a.serviceConfigs[serviceName]
+	serviceConfig, exists := a.service(serviceName)
 	if !exists || serviceConfig.Aggregation == nil {
 		return responseBody, nil
 	}
@@ -198,10 +244,7 @@ func (a *Aggregator) EnrichResponse(ctx context.Context, serviceName string, res
 		// Apply result mappings
 		if len(dep.ResultMapping) > 0 {
 			for _, mapping := range dep.ResultMapping {
-				toPath := strings.TrimPrefix(mapping.To, "$.")
-				if toPath != "" {
-					setNestedValue(enrichedResponse, strings.Split(toPath, "."), depData)
-				}
+				a.path(mapping.To).Set(enrichedResponse, depData)
 			}
 		} else {
 			// If no mapping specified, use service name as key
@@ -216,7 +259,7 @@ func (a *Aggregator) fetchDependencyDataForEnrichment(ctx context.Context, dep c
 	targetURL := dep.Path
 
 	// If we have a service configuration, use its first target as base
-	if serviceConfig, exists := a.serviceConfigs[dep.Service]; exists && len(serviceConfig.Targets) > 0 {
+	if serviceConfig, exists := a.service(dep.Service); exists && len(serviceConfig.Targets) > 0 {
 		baseURL := serviceConfig.Targets[0]
 		if !strings.HasSuffix(baseURL, "/") && !strings.HasPrefix(dep.Path, "/") {
 			targetURL = baseURL + "/" + dep.Path
@@ -231,8 +274,11 @@ func (a *Aggregator) fetchDependencyDataForEnrichment(ctx context.Context, dep c
 		paramName = strings.TrimSuffix(paramName, "}")
 
 		// Extract parameter value from original response
-		fromPath := strings.TrimPrefix(mapping.From, "$.")
-		paramValue, _ := getNestedValue(originalResponse, strings.Split(fromPath, "."))
+		from := a.path(mapping.From)
+		if from.IsRoot() {
+			continue
+		}
+		paramValue, _ := from.Get(originalResponse)
 
 		if paramValue != nil {
 			targetURL = strings.ReplaceAll(targetURL, "{"+paramName+"}", fmt.Sprintf("%v", paramValue))
@@ -287,26 +333,17 @@ func (a *Aggregator) mapResponseData(data interface{}, mappings []config.Mapping
 
 	// Apply mappings
 	for _, mapping := range mappings {
-		fromPath := strings.TrimPrefix(mapping.From, "$.")
-		toPath := strings.TrimPrefix(mapping.To, "$.")
-
-		// Extract value from source
-		if fromPath == "" || fromPath == "$" {
-			// Map entire object
-			if toPath == "" || toPath == "$" {
-				return dataMap
-			}
-			setNestedValue(result, strings.Split(toPath, "."), dataMap)
-		} else {
-			// Extract specific field
-			value, found := getNestedValue(dataMap, strings.Split(fromPath, "."))
-			if found {
-				if toPath == "" || toPath == "$" {
-					return value
-				}
-				setNestedValue(result, strings.Split(toPath, "."), value)
-			}
+		from, to := a.path(mapping.From), a.path(mapping.To)
+
+		// Extract value from source; the root path maps the entire object
+		value, found := from.Get(dataMap)
+		if !found {
+			continue
+		}
+		if to.IsRoot() {
+			return value
 		}
+		to.Set(result, value)
 	}
 
 	if len(result) == 0 {
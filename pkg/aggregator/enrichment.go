@@ -53,10 +53,7 @@ func (e *EnrichmentService) EnrichResponse(ctx context.Context, serviceName stri
 		// Apply result mappings
 		if len(dep.ResultMapping) > 0 {
 			for _, mapping := range dep.ResultMapping {
-				toPath := strings.TrimPrefix(mapping.To, "$.")
-				if toPath != "" {
-					setNestedValue(enrichedResponse, strings.Split(toPath, "."), depData)
-				}
+				e.aggregator.path(mapping.To).Set(enrichedResponse, depData)
 			}
 		} else {
 			// If no mapping specified, use service name as key
@@ -87,8 +84,11 @@ func (e *EnrichmentService) fetchDependencyData(ctx context.Context, dep config.
 		paramName = strings.TrimSuffix(paramName, "}")
 
 		// Extract parameter value from original response
-		fromPath := strings.TrimPrefix(mapping.From, "$.")
-		paramValue, found := getNestedValue(originalResponse, strings.Split(fromPath, "."))
+		from := e.aggregator.path(mapping.From)
+		if from.IsRoot() {
+			continue
+		}
+		paramValue, found := from.Get(originalResponse)
 
 		if found && paramValue != nil {
 			targetURL = strings.ReplaceAll(targetURL, "{"+paramName+"}", fmt.Sprintf("%v", paramValue))
@@ -61,24 +61,7 @@ func (tc *TrafficCollector) Collect(data *TrafficData) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
-	key := tc.makeKey(data.ServiceName, data.Endpoint)
-	pattern, exists := tc.patterns[key]
-
-	if !exists {
-		pattern = &TrafficPattern{
-			Timestamp:     time.Now(),
-			ServiceName:   data.ServiceName,
-			Endpoint:      data.Endpoint,
-			Method:        data.Method,
-			StatusCodes:   make(map[string]int64),
-			UserAgents:    make(map[string]int64),
-			SourceIPs:     make(map[string]int64),
-			RequestSizes:  make([]int64, 0, 100),
-			ResponseSizes: make([]int64, 0, 100),
-			Tags:          make(map[string]string),
-		}
-		tc.patterns[key] = pattern
-	}
+	pattern := tc.pattern(data.ServiceName, data.Endpoint, data.Method)
 
 	// Update counters
 	pattern.RequestCount++
@@ -128,6 +111,52 @@ func (tc *TrafficCollector) Collect(data *TrafficData) {
 	}
 }
 
+// RecordBotScore adds the score bot mitigation gave a request to the
+// endpoint's pattern
+func (tc *TrafficCollector) RecordBotScore(serviceName, endpoint, method string, score int, action string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	pattern := tc.pattern(serviceName, endpoint, method)
+
+	pattern.BotRequests++
+	pattern.AvgBotScore = (pattern.AvgBotScore*float64(pattern.BotRequests-1) + float64(score)) / float64(pattern.BotRequests)
+	if score > pattern.MaxBotScore {
+		pattern.MaxBotScore = score
+	}
+	if action != "" {
+		if pattern.BotActions == nil {
+			pattern.BotActions = make(map[string]int64)
+		}
+		pattern.BotActions[action]++
+	}
+}
+
+// pattern returns the pattern of an endpoint, creating it if needed.
+// Callers must hold the write lock.
+func (tc *TrafficCollector) pattern(serviceName, endpoint, method string) *TrafficPattern {
+	key := tc.makeKey(serviceName, endpoint)
+	pattern, exists := tc.patterns[key]
+
+	if !exists {
+		pattern = &TrafficPattern{
+			Timestamp:     time.Now(),
+			ServiceName:   serviceName,
+			Endpoint:      endpoint,
+			Method:        method,
+			StatusCodes:   make(map[string]int64),
+			UserAgents:    make(map[string]int64),
+			SourceIPs:     make(map[string]int64),
+			RequestSizes:  make([]int64, 0, 100),
+			ResponseSizes: make([]int64, 0, 100),
+			Tags:          make(map[string]string),
+		}
+		tc.patterns[key] = pattern
+	}
+
+	return pattern
+}
+
 // flushLoop periodically flushes collected patterns to the repository
 func (tc *TrafficCollector) flushLoop() {
 	defer tc.wg.Done()
@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"odin/pkg/events"
+
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +24,7 @@ type AnomalyDetector struct {
 	wg         sync.WaitGroup
 	mu         sync.RWMutex
 	baselines  map[string]*Baseline // Cache of baselines
+	events     events.Publisher
 }
 
 // NewAnomalyDetector creates a new anomaly detector
@@ -49,6 +52,13 @@ func NewAnomalyDetector(config *AIConfig, repository Repository, logger *logrus.
 	return detector
 }
 
+// SetEventPublisher enables anomaly.detected events
+func (ad *AnomalyDetector) SetEventPublisher(publisher events.Publisher) {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+	ad.events = publisher
+}
+
 // analysisLoop runs periodic analysis of traffic patterns
 func (ad *AnomalyDetector) analysisLoop() {
 	defer ad.wg.Done()
@@ -344,6 +354,31 @@ func (ad *AnomalyDetector) detectSuspiciousPattern(pattern *TrafficPattern) *Ano
 		}
 	}
 
+	// Check for bot activity reported by bot mitigation
+	if pattern.RequestCount > 0 && pattern.AvgBotScore >= 50 &&
+		float64(pattern.BotRequests)/float64(pattern.RequestCount) > 0.3 {
+		return &Anomaly{
+			ID:          uuid.New().String(),
+			Timestamp:   pattern.Timestamp,
+			ServiceName: pattern.ServiceName,
+			Endpoint:    pattern.Endpoint,
+			AnomalyType: AnomalyTypeBotActivity,
+			Severity:    SeverityMedium,
+			Score:       pattern.AvgBotScore,
+			Description: fmt.Sprintf("Bot activity detected: %d requests with an average bot score of %.0f",
+				pattern.BotRequests, pattern.AvgBotScore),
+			Details: map[string]interface{}{
+				"bot_requests":   pattern.BotRequests,
+				"max_bot_score":  pattern.MaxBotScore,
+				"bot_actions":    pattern.BotActions,
+				"total_requests": pattern.RequestCount,
+			},
+			Current:  pattern,
+			Resolved: false,
+			Tags:     make(map[string]string),
+		}
+	}
+
 	// Check for bot activity (suspicious user agents)
 	for ua, count := range pattern.UserAgents {
 		if ad.isSuspiciousUserAgent(ua) && float64(count)/float64(pattern.RequestCount) > 0.3 {
@@ -402,7 +437,7 @@ func (ad *AnomalyDetector) getOrCreateBaseline(serviceName string, patterns []*T
 		return nil, nil // Not enough data yet
 	}
 
-	baseline = ad.calculateBaseline(serviceName, patterns)
+	baseline = CalculateBaseline(serviceName, patterns)
 
 	// Save to repository
 	if err := ad.repository.SaveBaseline(ad.ctx, baseline); err != nil {
@@ -417,8 +452,28 @@ func (ad *AnomalyDetector) getOrCreateBaseline(serviceName string, patterns []*T
 	return baseline, nil
 }
 
-// calculateBaseline calculates statistical baseline from patterns
-func (ad *AnomalyDetector) calculateBaseline(serviceName string, patterns []*TrafficPattern) *Baseline {
+// RecalculateBaseline replaces the hourly baseline of a service with one
+// calculated from its traffic over the last window. It returns nil without
+// saving anything when there are fewer than minSamples patterns.
+func RecalculateBaseline(ctx context.Context, repository Repository, serviceName string, window time.Duration, minSamples int) (*Baseline, error) {
+	end := time.Now()
+	patterns, err := repository.GetTrafficPatterns(ctx, serviceName, "", end.Add(-window), end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic patterns: %w", err)
+	}
+	if len(patterns) == 0 || len(patterns) < minSamples {
+		return nil, nil
+	}
+
+	baseline := CalculateBaseline(serviceName, patterns)
+	if err := repository.SaveBaseline(ctx, baseline); err != nil {
+		return nil, fmt.Errorf("failed to save baseline: %w", err)
+	}
+	return baseline, nil
+}
+
+// CalculateBaseline calculates statistical baseline from patterns
+func CalculateBaseline(serviceName string, patterns []*TrafficPattern) *Baseline {
 	if len(patterns) == 0 {
 		return nil
 	}
@@ -582,6 +637,21 @@ func (ad *AnomalyDetector) createAlert(anomaly *Anomaly) {
 	if err := ad.repository.SaveAlert(ad.ctx, alert); err != nil {
 		ad.logger.WithError(err).Error("Failed to save alert")
 	}
+
+	ad.mu.RLock()
+	publisher := ad.events
+	ad.mu.RUnlock()
+	if publisher != nil {
+		publisher.Publish(events.AnomalyDetected, map[string]interface{}{
+			"anomalyId":   anomaly.ID,
+			"service":     anomaly.ServiceName,
+			"endpoint":    anomaly.Endpoint,
+			"anomalyType": anomaly.AnomalyType,
+			"severity":    anomaly.Severity,
+			"score":       anomaly.Score,
+			"description": anomaly.Description,
+		})
+	}
 }
 
 // Stop stops the anomaly detector
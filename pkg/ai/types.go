@@ -24,6 +24,10 @@ type TrafficPattern struct {
 	UniqueUsers     int64             `json:"unique_users" bson:"unique_users"`
 	AvgRequestSize  float64           `json:"avg_request_size" bson:"avg_request_size"`
 	AvgResponseSize float64           `json:"avg_response_size" bson:"avg_response_size"`
+	BotRequests     int64             `json:"bot_requests" bson:"bot_requests"` // Requests scored by bot mitigation
+	AvgBotScore     float64           `json:"avg_bot_score" bson:"avg_bot_score"`
+	MaxBotScore     int               `json:"max_bot_score" bson:"max_bot_score"`
+	BotActions      map[string]int64  `json:"bot_actions,omitempty" bson:"bot_actions,omitempty"`
 	Tags            map[string]string `json:"tags" bson:"tags"`
 }
 
@@ -0,0 +1,218 @@
+// Package apidocs serves browsable documentation of the gateway's services,
+// rendered from their OpenAPI documents with Swagger UI or Redoc. The
+// documents list the gateway as their server, so requests tried from the
+// documentation go through the gateway with the viewer's own credentials.
+package apidocs
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"odin/pkg/config"
+	"odin/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultPath is where the documentation is served unless configured
+	DefaultPath = "/docs"
+
+	// Security schemes of the credentials the gateway accepts
+	bearerScheme = "bearerAuth"
+	apiKeyScheme = "apiKeyAuth"
+)
+
+// defaultAssets are the CDN locations of the renderers' bundles
+var defaultAssets = map[string]string{
+	"swagger": "https://unpkg.com/swagger-ui-dist@5",
+	"redoc":   "https://cdn.jsdelivr.net/npm/redoc@2/bundles",
+}
+
+// Service is a documented service
+type Service struct {
+	Name           string        `json:"name"`
+	BasePath       string        `json:"basePath"`
+	Authentication bool          `json:"authentication"`
+	Spec           *openapi.Spec `json:"-"`
+	// Prepended to the paths of Spec when they are relative to the backend
+	PathPrefix string `json:"-"`
+}
+
+// document is a service with the OpenAPI document served for it
+type document struct {
+	Service
+	spec *openapi.Spec
+}
+
+// Site serves the documentation of services
+type Site struct {
+	path     string
+	renderer string
+	assets   string
+	docs     []*document // Sorted by name
+	all      *openapi.Spec
+}
+
+// New prepares the documentation of services. Operations of services behind
+// authentication require a JWT, or an API key in apiKeyHeader when the
+// gateway accepts API keys (apiKeyHeader is not empty).
+func New(cfg config.OpenAPIConfig, services []Service, apiKeyHeader string) (*Site, error) {
+	s := &Site{
+		path:     strings.TrimSuffix(cfg.UIPath, "/"),
+		renderer: cfg.UIRenderer,
+		assets:   strings.TrimSuffix(cfg.UIAssetsURL, "/"),
+	}
+	if s.path == "" {
+		s.path = DefaultPath
+	}
+	if s.renderer == "" {
+		s.renderer = "swagger"
+	}
+	if s.assets == "" {
+		s.assets = defaultAssets[s.renderer]
+	}
+
+	security := []map[string][]string{{bearerScheme: {}}}
+	if apiKeyHeader != "" {
+		security = append(security, map[string][]string{apiKeyScheme: {}})
+	}
+	addSchemes := func(g *openapi.Generator) {
+		g.AddSecurityScheme(bearerScheme, openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"})
+		if apiKeyHeader != "" {
+			g.AddSecurityScheme(apiKeyScheme, openapi.SecurityScheme{Type: "apiKey", In: "header", Name: apiKeyHeader})
+		}
+	}
+
+	for _, svc := range services {
+		if svc.Spec == nil {
+			continue
+		}
+		version := svc.Spec.Info.Version
+		if version == "" {
+			version = "1.0.0"
+		}
+		generator := openapi.NewGenerator(svc.Name, version, svc.Spec.Info.Description)
+		if err := generator.AddSpec(svc.Spec, svc.PathPrefix, svc.Name); err != nil {
+			return nil, err
+		}
+		if svc.Authentication {
+			addSchemes(generator)
+			generator.RequireSecurity(security)
+		}
+		s.docs = append(s.docs, &document{Service: svc, spec: generator.GetSpec()})
+	}
+	sort.Slice(s.docs, func(i, j int) bool { return s.docs[i].Name < s.docs[j].Name })
+
+	title, version := cfg.Title, cfg.Version
+	if title == "" {
+		title = "API Documentation"
+	}
+	if version == "" {
+		version = "1.0.0"
+	}
+	generator := openapi.NewGenerator(title, version, cfg.Description)
+	for _, doc := range s.docs {
+		if err := generator.AddSpec(doc.spec, "", doc.Name); err != nil {
+			return nil, err
+		}
+	}
+	s.all = generator.GetSpec()
+	return s, nil
+}
+
+// Path returns where the documentation is served
+func (s *Site) Path() string {
+	return s.path
+}
+
+// Register adds the documentation to e
+func (s *Site) Register(e *echo.Echo) {
+	e.GET(s.path, s.index)
+	e.GET(s.path+"/", s.index)
+	e.GET(s.path+"/services", s.listServices)
+	e.GET(s.path+"/all", s.viewAll)
+	e.GET(s.path+"/openapi.json", s.allSpec)
+	e.GET(s.path+"/services/:name", s.viewService)
+	e.GET(s.path+"/services/:name/openapi.json", s.serviceSpec)
+}
+
+func (s *Site) index(c echo.Context) error {
+	return s.render(c, "index.html", map[string]interface{}{
+		"Title":    s.all.Info.Title,
+		"Path":     s.path,
+		"Services": s.services(),
+	})
+}
+
+func (s *Site) listServices(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.services())
+}
+
+func (s *Site) viewAll(c echo.Context) error {
+	return s.view(c, s.all.Info.Title, s.path+"/openapi.json")
+}
+
+func (s *Site) viewService(c echo.Context) error {
+	doc := s.document(c.Param("name"))
+	if doc == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Service not found")
+	}
+	return s.view(c, doc.Name, s.path+"/services/"+url.PathEscape(doc.Name)+"/openapi.json")
+}
+
+func (s *Site) allSpec(c echo.Context) error {
+	return s.serve(c, s.all)
+}
+
+func (s *Site) serviceSpec(c echo.Context) error {
+	doc := s.document(c.Param("name"))
+	if doc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+	}
+	return s.serve(c, doc.spec)
+}
+
+// serve writes spec with the URL the client reached the gateway at as its
+// server, so "try it" requests are sent through the gateway
+func (s *Site) serve(c echo.Context, spec *openapi.Spec) error {
+	served := *spec
+	served.Servers = []openapi.Server{{URL: c.Scheme() + "://" + c.Request().Host}}
+	return c.JSON(http.StatusOK, served)
+}
+
+func (s *Site) view(c echo.Context, title, specURL string) error {
+	return s.render(c, s.renderer+".html", map[string]interface{}{
+		"Title":   title,
+		"Path":    s.path,
+		"SpecURL": specURL,
+		"Assets":  s.assets,
+	})
+}
+
+func (s *Site) render(c echo.Context, name string, data interface{}) error {
+	var b strings.Builder
+	if err := templates.ExecuteTemplate(&b, name, data); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, b.String())
+}
+
+func (s *Site) services() []Service {
+	services := make([]Service, 0, len(s.docs))
+	for _, doc := range s.docs {
+		services = append(services, doc.Service)
+	}
+	return services
+}
+
+func (s *Site) document(name string) *document {
+	for _, doc := range s.docs {
+		if doc.Name == name {
+			return doc
+		}
+	}
+	return nil
+}
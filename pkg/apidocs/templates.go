@@ -0,0 +1,76 @@
+package apidocs
+
+import "html/template"
+
+var templates = func() *template.Template {
+	t := template.New("")
+	template.Must(t.New("index.html").Parse(indexTemplate))
+	template.Must(t.New("swagger.html").Parse(swaggerTemplate))
+	template.Must(t.New("redoc.html").Parse(redocTemplate))
+	return t
+}()
+
+const indexTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+  <style>
+    body { font-family: sans-serif; margin: 2rem auto; max-width: 48rem; color: #222; }
+    li { margin: 0.5rem 0; }
+    code { color: #666; }
+  </style>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <p><a href="{{.Path}}/all">All services</a> &middot; <a href="{{.Path}}/openapi.json">openapi.json</a></p>
+  <ul>
+  {{- range .Services}}
+    <li><a href="{{$.Path}}/services/{{.Name}}">{{.Name}}</a> <code>{{.BasePath}}</code>{{if .Authentication}} &middot; requires credentials{{end}}</li>
+  {{- else}}
+    <li>No services are documented.</li>
+  {{- end}}
+  </ul>
+</body>
+</html>
+`
+
+const swaggerTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+  <p><a href="{{.Path}}/">&larr; Services</a></p>
+  <div id="docs"></div>
+  <script src="{{.Assets}}/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: {{.SpecURL}},
+      dom_id: "#docs",
+      deepLinking: true,
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
+
+const redocTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+</head>
+<body>
+  <p><a href="{{.Path}}/">&larr; Services</a></p>
+  <redoc spec-url="{{.SpecURL}}"></redoc>
+  <script src="{{.Assets}}/redoc.standalone.js"></script>
+</body>
+</html>
+`
@@ -0,0 +1,641 @@
+package async
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+	"odin/pkg/requestid"
+	"odin/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers clients control asynchronous requests with
+const (
+	HeaderPrefer            = "Prefer"
+	HeaderPreferenceApplied = "Preference-Applied"
+	HeaderCallback          = "X-Callback-URL"
+	RespondAsync            = "respond-async"
+)
+
+// Modes selectable per service
+const (
+	ModePrefer = "prefer"
+	ModeAlways = "always"
+)
+
+const (
+	defaultStatusPath   = "/_async/jobs"
+	defaultTimeout      = 5 * time.Minute
+	callbackAttempts    = 3
+	callbackTimeout     = 10 * time.Second
+	leaseMargin         = time.Minute
+	defaultPollInterval = 5 * time.Second
+)
+
+type jobKey struct{}
+
+// IsJob reports whether ctx belongs to a job's upstream call rather than to
+// a client's request
+func IsJob(ctx context.Context) bool {
+	return ctx.Value(jobKey{}) != nil
+}
+
+// Status is what clients polling a job and callbacks receive
+type Status struct {
+	ID             string     `json:"id"`
+	Service        string     `json:"service"`
+	Status         string     `json:"status"` // pending, running, completed or failed
+	RequestID      string     `json:"requestId,omitempty"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+	StatusURL      string     `json:"statusUrl"`
+	ResultURL      string     `json:"resultUrl,omitempty"`
+}
+
+// Manager accepts asynchronous requests, runs them on a pool of workers and
+// serves their status and results
+type Manager struct {
+	config  config.AsyncConfig
+	store   Store
+	durable bool
+	logger  *logrus.Logger
+	client  *http.Client
+	echo    *echo.Echo
+
+	mu       sync.RWMutex
+	services map[string]*registration
+
+	queue    chan string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+type registration struct {
+	config  service.AsyncConfig
+	timeout time.Duration
+	run     echo.HandlerFunc
+}
+
+// NewManager creates a manager keeping its jobs in store. Jobs of a durable
+// store, shared by several gateways, are also picked up from the store.
+func NewManager(cfg config.AsyncConfig, store Store, durable bool, logger *logrus.Logger) *Manager {
+	if cfg.StatusPath == "" {
+		cfg.StatusPath = defaultStatusPath
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.ResultTTL <= 0 {
+		cfg.ResultTTL = time.Hour
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 10 << 20
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		config:   cfg,
+		store:    store,
+		durable:  durable,
+		logger:   logger,
+		client:   &http.Client{Timeout: callbackTimeout},
+		services: make(map[string]*registration),
+		queue:    make(chan string, cfg.QueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Register serves the status and results of jobs on e. Jobs run through
+// e's error handler, so they get the same error responses as requests.
+func (m *Manager) Register(e *echo.Echo) {
+	m.echo = e
+	e.GET(m.config.StatusPath+"/:id", m.getStatus)
+	e.GET(m.config.StatusPath+"/:id/result", m.getResult)
+}
+
+// Middleware accepts the asynchronous requests of a service with 202 and
+// runs them through run in the background. Other requests go on to next.
+func (m *Manager) Middleware(name string, cfg service.AsyncConfig, run echo.HandlerFunc) echo.MiddlewareFunc {
+	reg := &registration{config: cfg, timeout: cfg.Timeout, run: run}
+	if reg.timeout <= 0 {
+		reg.timeout = defaultTimeout
+	}
+	m.mu.Lock()
+	m.services[name] = reg
+	m.mu.Unlock()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			preferred := prefersAsync(req.Header)
+			if (cfg.Mode != ModeAlways && !preferred) || req.Header.Get(echo.HeaderUpgrade) != "" {
+				return next(c)
+			}
+			return m.accept(c, name, reg, preferred)
+		}
+	}
+}
+
+// accept stores the request as a job and answers 202 with its status URL
+func (m *Manager) accept(c echo.Context, name string, reg *registration, preferred bool) error {
+	req := c.Request()
+
+	callback := req.Header.Get(HeaderCallback)
+	if callback != "" && !callbackAllowed(callback, reg.config.CallbackHosts) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Callback URL not allowed")
+	}
+	if !m.durable && len(m.queue) == cap(m.queue) {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many pending requests")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, m.config.MaxBodySize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	if int64(len(body)) > m.config.MaxBodySize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+
+	header := req.Header.Clone()
+	header.Del(HeaderPrefer)
+	header.Del(HeaderCallback)
+	job := &mongodb.AsyncJobDocument{
+		ID:          uuid.NewString(),
+		Service:     name,
+		Status:      mongodb.AsyncJobPending,
+		Method:      req.Method,
+		Host:        req.Host,
+		Path:        req.URL.Path,
+		Query:       req.URL.RawQuery,
+		Header:      header,
+		Body:        body,
+		RemoteAddr:  req.RemoteAddr,
+		Claims:      claims(c),
+		RequestID:   requestid.Get(c),
+		CallbackURL: callback,
+		TTL:         time.Now().Add(m.config.ResultTTL),
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	defer cancel()
+	if err := m.store.CreateAsyncJob(ctx, job); err != nil {
+		m.logger.WithError(err).WithField("service", name).Error("Failed to store asynchronous request")
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to accept request")
+	}
+	// Durable jobs that do not fit in the queue are picked up from the store
+	if !m.enqueue(job.ID) && !m.durable {
+		job.Status = mongodb.AsyncJobFailed
+		job.Error = "too many pending requests"
+		m.store.FinishAsyncJob(ctx, job)
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many pending requests")
+	}
+
+	status := m.status(job)
+	c.Response().Header().Set(echo.HeaderLocation, status.StatusURL)
+	if preferred {
+		c.Response().Header().Set(HeaderPreferenceApplied, RespondAsync)
+	}
+	return c.JSON(http.StatusAccepted, status)
+}
+
+func (m *Manager) enqueue(id string) bool {
+	select {
+	case m.queue <- id:
+		return true
+	default:
+		return false
+	}
+}
+
+// getStatus answers a client polling a job
+func (m *Manager) getStatus(c echo.Context) error {
+	job, err := m.job(c)
+	if err != nil {
+		return err
+	}
+	if !finished(job) {
+		c.Response().Header().Set("Retry-After", "1")
+	}
+	return c.JSON(http.StatusOK, m.status(job))
+}
+
+// getResult answers with the response of a completed job, as the target
+// sent it
+func (m *Manager) getResult(c echo.Context) error {
+	job, err := m.job(c)
+	if err != nil {
+		return err
+	}
+	switch job.Status {
+	case mongodb.AsyncJobCompleted:
+		header := c.Response().Header()
+		for name, values := range job.ResponseHeader {
+			header[name] = values
+		}
+		header.Set(echo.HeaderContentLength, strconv.Itoa(len(job.ResponseBody)))
+		c.Response().WriteHeader(job.ResponseStatus)
+		_, err := c.Response().Write(job.ResponseBody)
+		return err
+	case mongodb.AsyncJobFailed:
+		return echo.NewHTTPError(http.StatusBadGateway, "Request failed: "+job.Error)
+	default:
+		status := m.status(job)
+		c.Response().Header().Set(echo.HeaderLocation, status.StatusURL)
+		c.Response().Header().Set("Retry-After", "1")
+		return c.JSON(http.StatusAccepted, status)
+	}
+}
+
+func (m *Manager) job(c echo.Context) (*mongodb.AsyncJobDocument, error) {
+	job, err := m.store.GetAsyncJob(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		m.logger.WithError(err).Error("Failed to get asynchronous request")
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to get request status")
+	}
+	if job == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Request not found")
+	}
+	return job, nil
+}
+
+func (m *Manager) status(job *mongodb.AsyncJobDocument) Status {
+	status := Status{
+		ID:             job.ID,
+		Service:        job.Service,
+		Status:         job.Status,
+		RequestID:      job.RequestID,
+		ResponseStatus: job.ResponseStatus,
+		Error:          job.Error,
+		CreatedAt:      job.CreatedAt,
+		StatusURL:      m.config.StatusPath + "/" + job.ID,
+	}
+	if !job.CompletedAt.IsZero() {
+		completed := job.CompletedAt
+		status.CompletedAt = &completed
+	}
+	if job.Status == mongodb.AsyncJobCompleted {
+		status.ResultURL = status.StatusURL + "/result"
+	}
+	return status
+}
+
+// Start runs the workers until Stop is called. With a durable store, jobs
+// left unfinished by stopped gateways are picked up too.
+func (m *Manager) Start() {
+	for i := 0; i < m.config.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	if m.durable {
+		m.wg.Add(1)
+		go m.poll()
+	}
+	m.logger.WithFields(logrus.Fields{
+		"workers": m.config.Workers,
+		"path":    m.config.StatusPath,
+	}).Info("Asynchronous requests enabled")
+}
+
+// Stop stops the workers. Running jobs are cancelled; with a durable store
+// they run again once their lease expires.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		m.cancel()
+		close(m.stopChan)
+	})
+	m.wg.Wait()
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+// poll queues the runnable jobs of the store while the queue has room
+func (m *Manager) poll() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		room := cap(m.queue) - len(m.queue)
+		if room > 0 {
+			ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+			jobs, err := m.store.ListRunnableAsyncJobs(ctx, room)
+			cancel()
+			if err != nil {
+				m.logger.WithError(err).Warn("Failed to list asynchronous requests")
+			}
+			for _, job := range jobs {
+				m.enqueue(job.ID)
+			}
+		}
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run claims a job, replays its request through the service and stores the
+// response
+func (m *Manager) run(id string) {
+	m.mu.RLock()
+	services := m.services
+	m.mu.RUnlock()
+
+	// Claim for the longest timeout, since the job's service is not known yet
+	lease := defaultTimeout
+	for _, reg := range services {
+		lease = max(lease, reg.timeout)
+	}
+	job, err := m.store.ClaimAsyncJob(m.ctx, id, time.Now().Add(lease+leaseMargin))
+	if err != nil {
+		m.logger.WithError(err).WithField("job", id).Warn("Failed to claim asynchronous request")
+		return
+	}
+	if job == nil {
+		return // Run elsewhere, or already done
+	}
+	logger := m.logger.WithFields(logrus.Fields{"job": job.ID, "service": job.Service})
+
+	m.mu.RLock()
+	reg, ok := m.services[job.Service]
+	m.mu.RUnlock()
+	if !ok {
+		m.finish(job, nil, "service no longer accepts asynchronous requests")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, reg.timeout)
+	defer cancel()
+	ctx = context.WithValue(requestid.NewContext(ctx, job.RequestID), jobKey{}, job.ID)
+
+	u := &url.URL{Path: job.Path, RawQuery: job.Query}
+	req, err := http.NewRequestWithContext(ctx, job.Method, u.RequestURI(), bytes.NewReader(job.Body))
+	if err != nil {
+		m.finish(job, nil, err.Error())
+		return
+	}
+	req.RequestURI = u.RequestURI()
+	req.Header = http.Header(job.Header).Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Host = job.Host
+	req.RemoteAddr = job.RemoteAddr
+
+	rec := newRecorder(m.config.MaxBodySize)
+	c := m.echo.NewContext(req, rec)
+	c.Set(requestid.ContextKey, job.RequestID)
+	if job.Claims != nil {
+		c.Set("user", job.Claims)
+	}
+
+	if err := m.call(reg.run, c); err != nil {
+		m.echo.HTTPErrorHandler(err, c)
+	}
+	if m.ctx.Err() != nil && m.durable {
+		logger.Info("Asynchronous request interrupted by shutdown, it will run again")
+		return
+	}
+	if m.ctx.Err() != nil {
+		m.finish(job, nil, "gateway stopped before the request finished")
+		return
+	}
+	if rec.overflow {
+		m.finish(job, nil, "response exceeds the maximum body size")
+		return
+	}
+	m.finish(job, rec, "")
+	logger.WithField("status", job.ResponseStatus).Debug("Asynchronous request completed")
+}
+
+// call runs h, turning a panic into an error so one job cannot stop a worker
+func (m *Manager) call(h echo.HandlerFunc, c echo.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(c)
+}
+
+// finish stores the result of job, the response in rec or failure, and
+// notifies its callback
+func (m *Manager) finish(job *mongodb.AsyncJobDocument, rec *recorder, failure string) {
+	now := time.Now()
+	job.CompletedAt = now
+	job.TTL = now.Add(m.config.ResultTTL)
+	if rec != nil {
+		job.Status = mongodb.AsyncJobCompleted
+		job.ResponseStatus = rec.status
+		if job.ResponseStatus == 0 {
+			job.ResponseStatus = http.StatusOK
+		}
+		job.ResponseHeader = rec.header
+		job.ResponseBody = rec.body.Bytes()
+	} else {
+		job.Status = mongodb.AsyncJobFailed
+		job.Error = failure
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.store.FinishAsyncJob(ctx, job); err != nil {
+		m.logger.WithError(err).WithField("job", job.ID).Error("Failed to store asynchronous request result")
+		return
+	}
+	if job.CallbackURL != "" {
+		m.mu.RLock()
+		reg := m.services[job.Service]
+		m.mu.RUnlock()
+		var secret string
+		if reg != nil {
+			secret = reg.config.CallbackSecret
+		}
+		m.notify(job, secret)
+	}
+}
+
+// notify posts the status of a finished job to its callback URL, signed
+// like event webhooks
+func (m *Manager) notify(job *mongodb.AsyncJobDocument, secret string) {
+	body, err := json.Marshal(m.status(job))
+	if err != nil {
+		return
+	}
+	backoff := time.Second
+	var lastErr error
+	for attempt := 0; attempt < callbackAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-m.stopChan:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if lastErr = m.post(job, secret, body); lastErr == nil {
+			return
+		}
+	}
+	m.logger.WithError(lastErr).WithField("job", job.ID).Warn("Failed to deliver asynchronous request callback")
+}
+
+func (m *Manager) post(job *mongodb.AsyncJobDocument, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, job.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "Odin-Async/1.0")
+	req.Header.Set(events.HeaderEvent, "async."+job.Status)
+	req.Header.Set(events.HeaderDelivery, job.ID)
+	req.Header.Set(events.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if secret != "" {
+		req.Header.Set(events.HeaderSignature, events.Sign(secret, timestamp, body))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func finished(job *mongodb.AsyncJobDocument) bool {
+	return job.Status == mongodb.AsyncJobCompleted || job.Status == mongodb.AsyncJobFailed
+}
+
+// prefersAsync reports whether the request asks for Prefer: respond-async
+func prefersAsync(header http.Header) bool {
+	for _, value := range header.Values(HeaderPrefer) {
+		for _, preference := range strings.Split(value, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(token), RespondAsync) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callbackAllowed reports whether callbacks may be sent to rawURL. Hosts
+// match exactly, with or without the port; entries starting with a dot
+// match subdomains.
+func callbackAllowed(rawURL string, hosts []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return false
+	}
+	hostname := strings.ToLower(u.Hostname())
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if host == hostname || host == strings.ToLower(u.Host) {
+			return true
+		}
+		if strings.HasPrefix(host, ".") && strings.HasSuffix(hostname, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// claims returns the authenticated client's JWT claims as a map, so they
+// can be stored with the job
+func claims(c echo.Context) map[string]interface{} {
+	user := c.Get("user")
+	if user == nil {
+		return nil
+	}
+	if m, ok := user.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// recorder keeps the response of a job, up to a limit
+type recorder struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func newRecorder(limit int64) *recorder {
+	return &recorder{header: make(http.Header), limit: limit}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if int64(r.body.Len()+len(p)) > r.limit {
+		r.overflow = true
+		return 0, fmt.Errorf("response exceeds %d bytes", r.limit)
+	}
+	return r.body.Write(p)
+}
+
+// Flush lets streaming handlers write to the recorder
+func (r *recorder) Flush() {}
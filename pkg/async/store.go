@@ -0,0 +1,123 @@
+package async
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+)
+
+// Store keeps jobs and their results. The MongoDB repository is a Store
+// shared by every gateway using the same database.
+type Store interface {
+	CreateAsyncJob(ctx context.Context, job *mongodb.AsyncJobDocument) error
+	GetAsyncJob(ctx context.Context, id string) (*mongodb.AsyncJobDocument, error)
+	ClaimAsyncJob(ctx context.Context, id string, leaseUntil time.Time) (*mongodb.AsyncJobDocument, error)
+	FinishAsyncJob(ctx context.Context, job *mongodb.AsyncJobDocument) error
+	ListRunnableAsyncJobs(ctx context.Context, limit int) ([]*mongodb.AsyncJobDocument, error)
+}
+
+// memoryStore keeps the jobs of a single gateway until they expire. Jobs
+// are lost on restart.
+type memoryStore struct {
+	mu        sync.Mutex
+	jobs      map[string]*mongodb.AsyncJobDocument
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates a store that keeps jobs in memory
+func NewMemoryStore() Store {
+	return &memoryStore{jobs: make(map[string]*mongodb.AsyncJobDocument)}
+}
+
+func (s *memoryStore) CreateAsyncJob(ctx context.Context, job *mongodb.AsyncJobDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for id, j := range s.jobs {
+			if expired(j, now) {
+				delete(s.jobs, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetAsyncJob(ctx context.Context, id string) (*mongodb.AsyncJobDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || expired(job, time.Now()) {
+		return nil, nil
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) ClaimAsyncJob(ctx context.Context, id string, leaseUntil time.Time) (*mongodb.AsyncJobDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job, ok := s.jobs[id]
+	if !ok || !runnable(job, now) {
+		return nil, nil
+	}
+	job.Status = mongodb.AsyncJobRunning
+	job.LeaseUntil = leaseUntil
+	job.UpdatedAt = now
+	job.Attempts++
+	copied := *job
+	return &copied, nil
+}
+
+func (s *memoryStore) FinishAsyncJob(ctx context.Context, job *mongodb.AsyncJobDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.UpdatedAt = time.Now()
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) ListRunnableAsyncJobs(ctx context.Context, limit int) ([]*mongodb.AsyncJobDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var jobs []*mongodb.AsyncJobDocument
+	for _, job := range s.jobs {
+		if runnable(job, now) {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// runnable reports whether nobody runs job: it is pending, or running with
+// an expired lease
+func runnable(job *mongodb.AsyncJobDocument, now time.Time) bool {
+	return job.Status == mongodb.AsyncJobPending ||
+		job.Status == mongodb.AsyncJobRunning && job.LeaseUntil.Before(now)
+}
+
+func expired(job *mongodb.AsyncJobDocument, now time.Time) bool {
+	return !job.TTL.IsZero() && job.TTL.Before(now)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"odin/pkg/certs"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyStore looks up API keys, e.g. the MongoDB repository
+type APIKeyStore interface {
+	GetAPIKey(ctx context.Context, key string) (*mongodb.APIKeyDocument, error)
+}
+
+// APIKeyAuth authenticates requests by API key and enforces the client
+// identities a key is pinned to
+type APIKeyAuth struct {
+	store       APIKeyStore
+	header      string
+	ja3         func(r *http.Request) string
+	revocations Revocations
+}
+
+// NewAPIKeyAuth creates an API key authenticator reading keys from header
+func NewAPIKeyAuth(store APIKeyStore, header string) *APIKeyAuth {
+	return &APIKeyAuth{
+		store:  store,
+		header: header,
+		ja3:    func(*http.Request) string { return "" },
+	}
+}
+
+// SetJA3Lookup sets how the JA3 fingerprint of a request's TLS connection
+// is found. Without it, keys pinned to JA3 fingerprints are always rejected.
+func (a *APIKeyAuth) SetJA3Lookup(lookup func(r *http.Request) string) {
+	a.ja3 = lookup
+}
+
+// SetRevocations rejects the keys revoked in revocations
+func (a *APIKeyAuth) SetRevocations(revocations Revocations) {
+	a.revocations = revocations
+}
+
+// Key returns the API key sent with a request, if any
+func (a *APIKeyAuth) Key(r *http.Request) string {
+	return r.Header.Get(a.header)
+}
+
+// Authenticate validates an API key and stores its document in the context
+// as "apiKey"
+func (a *APIKeyAuth) Authenticate(c echo.Context, key string) error {
+	doc, err := a.Lookup(c.Request(), key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	c.Set("apiKey", doc)
+	return nil
+}
+
+// Lookup validates an API key sent with r and returns its document
+func (a *APIKeyAuth) Lookup(r *http.Request, key string) (*mongodb.APIKeyDocument, error) {
+	doc, err := a.store.GetAPIKey(r.Context(), key)
+	if err != nil || doc == nil || !doc.Enabled {
+		return nil, errors.New("Invalid API key")
+	}
+	switch doc.Status {
+	case mongodb.APIKeyPending:
+		return nil, errors.New("API key is pending approval")
+	case mongodb.APIKeyRejected:
+		return nil, errors.New("API key was rejected")
+	}
+	if doc.ExpiresAt != nil && time.Now().After(*doc.ExpiresAt) {
+		return nil, errors.New("API key expired")
+	}
+	if a.revocations != nil && a.revocations.APIKeyRevoked(doc.ID) {
+		return nil, errors.New("API key was revoked")
+	}
+	if !a.identityMatches(r, doc) {
+		return nil, errors.New("API key is not valid for this client")
+	}
+	return doc, nil
+}
+
+// identityMatches checks the request's TLS client against the key's pins.
+// When a key is pinned to both certificates and JA3 fingerprints, both must
+// match.
+func (a *APIKeyAuth) identityMatches(r *http.Request, doc *mongodb.APIKeyDocument) bool {
+	if len(doc.CertFingerprints) > 0 {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return false
+		}
+		if !pinned(doc.CertFingerprints, certs.Fingerprint(r.TLS.PeerCertificates[0]), certs.NormalizeFingerprint) {
+			return false
+		}
+	}
+
+	if len(doc.JA3Fingerprints) > 0 {
+		ja3 := a.ja3(r)
+		if ja3 == "" || !pinned(doc.JA3Fingerprints, ja3, normalizeJA3) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func pinned(pins []string, fingerprint string, normalize func(string) string) bool {
+	for _, pin := range pins {
+		if normalize(pin) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeJA3(fingerprint string) string {
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"odin/pkg/certs"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// clientCertHeader prefixes the headers the verified certificate is
+// forwarded to upstreams in
+const clientCertHeader = "X-Client-Cert-"
+
+// ClientCertAuth authenticates a service's clients by the certificate they
+// present in the TLS handshake. Certificates must chain to one of the
+// service's CAs and, when allowlists are set, carry an allowed common name
+// or SAN.
+type ClientCertAuth struct {
+	roots       *x509.CertPool
+	allowedCNs  []string
+	allowedSANs []string
+}
+
+// NewClientCertAuth loads the CA bundle of cfg
+func NewClientCertAuth(cfg config.ClientCertConfig) (*ClientCertAuth, error) {
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in CA bundle %s", cfg.CAFile)
+	}
+	return &ClientCertAuth{
+		roots:       roots,
+		allowedCNs:  cfg.AllowedCNs,
+		allowedSANs: cfg.AllowedSANs,
+	}, nil
+}
+
+// Verify returns the client's certificate if it chains to the CAs and is
+// allowed. Certificates after the first one are used as intermediates.
+func (a *ClientCertAuth) Verify(peerCerts []*x509.Certificate) (*x509.Certificate, error) {
+	if len(peerCerts) == 0 {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "Client certificate required")
+	}
+	cert := peerCerts[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range peerCerts[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         a.roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid client certificate")
+	}
+	if !a.allowed(cert) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Client certificate not allowed")
+	}
+	return cert, nil
+}
+
+// allowed reports whether the certificate's common name or one of its SANs
+// is in the allowlists; without allowlists every certificate is
+func (a *ClientCertAuth) allowed(cert *x509.Certificate) bool {
+	if len(a.allowedCNs) == 0 && len(a.allowedSANs) == 0 {
+		return true
+	}
+	for _, pattern := range a.allowedCNs {
+		if wildcardMatch(pattern, cert.Subject.CommonName) {
+			return true
+		}
+	}
+	for _, san := range subjectAltNames(cert) {
+		for _, pattern := range a.allowedSANs {
+			if wildcardMatch(pattern, san) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware rejects requests without a valid client certificate and
+// forwards the verified identity in X-Client-Cert-* headers, replacing any
+// the client sent. Without another authentication the certificate's common
+// name is the client's user.
+func (a *ClientCertAuth) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			for name := range req.Header {
+				if strings.HasPrefix(name, clientCertHeader) {
+					req.Header.Del(name)
+				}
+			}
+
+			var peerCerts []*x509.Certificate
+			if req.TLS != nil {
+				peerCerts = req.TLS.PeerCertificates
+			}
+			cert, err := a.Verify(peerCerts)
+			if err != nil {
+				return err
+			}
+
+			req.Header.Set(clientCertHeader+"Subject", cert.Subject.String())
+			req.Header.Set(clientCertHeader+"Issuer", cert.Issuer.String())
+			req.Header.Set(clientCertHeader+"CN", cert.Subject.CommonName)
+			req.Header.Set(clientCertHeader+"Serial", cert.SerialNumber.String())
+			req.Header.Set(clientCertHeader+"Fingerprint", certs.Fingerprint(cert))
+			if sans := subjectAltNames(cert); len(sans) > 0 {
+				req.Header.Set(clientCertHeader+"SAN", strings.Join(sans, ","))
+			}
+			if c.Get("user") == nil {
+				c.Set("user", &JWTClaims{UserID: cert.Subject.CommonName, Username: cert.Subject.CommonName})
+			}
+			return next(c)
+		}
+	}
+}
+
+// subjectAltNames lists the DNS names, emails, IPs and URIs of a certificate
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// wildcardMatch reports whether s matches pattern, in which * matches any
+// characters
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
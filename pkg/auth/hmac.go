@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HMACSecrets looks up the secrets requests are signed with by key ID, e.g.
+// the consumers registry
+type HMACSecrets interface {
+	HMACSecret(keyID string) (string, bool)
+}
+
+// HMACAuth authenticates requests signed with a secret of their consumer.
+// The signature is an HMAC over "<timestamp>.<method>.<request URI>.<body>",
+// so a signed request cannot be replayed to another endpoint, nor to the
+// same one once it has been seen or its timestamp is out of the clock skew.
+type HMACAuth struct {
+	signatureHeader string
+	timestampHeader string
+	keyIDHeader     string
+	algorithm       string
+	hash            func() hash.Hash
+	clockSkew       time.Duration
+	maxBodySize     int64
+	secrets         HMACSecrets
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // Signatures accepted, until they expire
+	nextSweep time.Time
+}
+
+// NewHMACAuth creates an authenticator looking secrets up in secrets
+func NewHMACAuth(cfg config.HMACConfig, secrets HMACSecrets) *HMACAuth {
+	a := &HMACAuth{
+		signatureHeader: cfg.SignatureHeader,
+		timestampHeader: cfg.TimestampHeader,
+		keyIDHeader:     cfg.KeyIDHeader,
+		algorithm:       cfg.Algorithm,
+		clockSkew:       cfg.ClockSkew,
+		maxBodySize:     cfg.MaxBodySize,
+		secrets:         secrets,
+		seen:            make(map[string]time.Time),
+	}
+	if a.signatureHeader == "" {
+		a.signatureHeader = "X-Signature"
+	}
+	if a.timestampHeader == "" {
+		a.timestampHeader = "X-Timestamp"
+	}
+	if a.keyIDHeader == "" {
+		a.keyIDHeader = "X-Key-ID"
+	}
+	if a.clockSkew == 0 {
+		a.clockSkew = 5 * time.Minute
+	}
+	if a.maxBodySize == 0 {
+		a.maxBodySize = 10 << 20
+	}
+	switch a.algorithm {
+	case "sha384":
+		a.hash = sha512.New384
+	case "sha512":
+		a.hash = sha512.New
+	default:
+		a.algorithm, a.hash = "sha256", sha256.New
+	}
+	return a
+}
+
+// Sign returns the signature header value of a request signed with secret
+// at timestamp
+func (a *HMACAuth) Sign(secret string, timestamp int64, method, requestURI string, body []byte) string {
+	mac := hmac.New(a.hash, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("." + method + "." + requestURI + "."))
+	mac.Write(body)
+	return a.algorithm + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware rejects requests without a valid signature. The key ID of
+// those accepted is stored as "hmacKeyID", which identifies their consumer.
+func (a *HMACAuth) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			keyID := req.Header.Get(a.keyIDHeader)
+			signature := req.Header.Get(a.signatureHeader)
+			if keyID == "" || signature == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing request signature")
+			}
+
+			timestamp, err := strconv.ParseInt(req.Header.Get(a.timestampHeader), 10, 64)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid signature timestamp")
+			}
+			now := time.Now()
+			if skew := now.Sub(time.Unix(timestamp, 0)); skew > a.clockSkew || skew < -a.clockSkew {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Signature timestamp out of range")
+			}
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, a.maxBodySize+1))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+			}
+			if int64(len(body)) > a.maxBodySize {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large to verify")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			secret, ok := a.secrets.HMACSecret(keyID)
+			if !ok || !hmac.Equal([]byte(signature), []byte(a.Sign(secret, timestamp, req.Method, req.RequestURI, body))) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid request signature")
+			}
+			if !a.firstUse(signature, now) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Request signature already used")
+			}
+
+			c.Set("hmacKeyID", keyID)
+			return next(c)
+		}
+	}
+}
+
+// firstUse records a signature until its timestamp leaves the clock skew
+// and reports whether it was not seen before
+func (a *HMACAuth) firstUse(signature string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.After(a.nextSweep) {
+		for s, expires := range a.seen {
+			if now.After(expires) {
+				delete(a.seen, s)
+			}
+		}
+		a.nextSweep = now.Add(time.Minute)
+	}
+	if _, ok := a.seen[signature]; ok {
+		return false
+	}
+	// A timestamp is accepted until clockSkew after it, at most 2*clockSkew
+	// from now
+	a.seen[signature] = now.Add(2 * a.clockSkew)
+	return true
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gopkg.in/yaml.v3"
 )
@@ -102,6 +103,15 @@ func loadJWTSecret() (string, error) {
 	return "", fmt.Errorf("couldn't load JWT secret from any source")
 }
 
+// JWTSecret returns the secret gateway JWTs are signed with: the one in the
+// secrets file or ODIN_JWT_SECRET, else the configured one
+func JWTSecret(config config.AuthConfig) string {
+	if secret, err := loadJWTSecret(); err == nil {
+		return secret
+	}
+	return config.JWTSecret
+}
+
 type JWTClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
@@ -110,15 +120,41 @@ type JWTClaims struct {
 }
 
 func NewJWTMiddleware(config config.AuthConfig) echo.MiddlewareFunc {
-	jwtSecret, err := loadJWTSecret()
-	if err != nil {
-		jwtSecret = config.JWTSecret
-	}
+	return NewAuthMiddleware(config, nil)
+}
 
+// NewAuthMiddleware accepts an API key when apiKeys is set and the request
+// carries one, and a JWT bearer token otherwise
+func NewAuthMiddleware(config config.AuthConfig, apiKeys *APIKeyAuth) echo.MiddlewareFunc {
+	jwtSecret := JWTSecret(config)
 	if jwtSecret == "" {
-		fmt.Println("WARNING: JWT secret is not configured")
+		fmt.Fprintln(os.Stderr, "WARNING: JWT secret is not configured")
 	}
 
+	return bearerAuth(config, apiKeys, func(c echo.Context, tokenString string) error {
+		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(jwtSecret), nil
+		})
+
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+		}
+
+		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+			c.Set("user", claims)
+			return nil
+		}
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	})
+}
+
+// bearerAuth skips the ignored paths, accepts API keys when apiKeys is set
+// and the request carries one, and passes bearer tokens to verify otherwise
+func bearerAuth(config config.AuthConfig, apiKeys *APIKeyAuth, verify func(c echo.Context, token string) error) echo.MiddlewareFunc {
 	ignorePaths := make([]*regexp.Regexp, 0)
 	for _, regex := range config.IgnorePathRegexes {
 		compiledRegex, err := regexp.Compile(regex)
@@ -137,6 +173,15 @@ func NewJWTMiddleware(config config.AuthConfig) echo.MiddlewareFunc {
 				}
 			}
 
+			if apiKeys != nil {
+				if key := apiKeys.Key(c.Request()); key != "" {
+					if err := apiKeys.Authenticate(c, key); err != nil {
+						return err
+					}
+					return next(c)
+				}
+			}
+
 			authHeader := c.Request().Header.Get("Authorization")
 			if authHeader == "" {
 				return echo.NewHTTPError(http.StatusUnauthorized, "Missing authorization header")
@@ -147,27 +192,41 @@ func NewJWTMiddleware(config config.AuthConfig) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid authorization format")
 			}
 
-			tokenString := tokenParts[1]
-
-			token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(jwtSecret), nil
-			})
-
-			if err != nil {
-				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+			if err := verify(c, tokenParts[1]); err != nil {
+				return err
 			}
+			return next(c)
+		}
+	}
+}
+
+// Revocations tells whether credentials were revoked before they expired
+type Revocations interface {
+	TokenRevoked(id string, subjects []string, issuedAt time.Time) bool
+	APIKeyRevoked(id string) bool
+}
 
-			if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-				c.Set("user", claims)
-				return next(c)
+// RejectRevokedTokens wraps an authentication middleware so that requests
+// authenticated with a revoked JWT are rejected
+func RejectRevokedTokens(authenticate echo.MiddlewareFunc, revocations Revocations) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return authenticate(func(c echo.Context) error {
+			if claims, ok := c.Get("user").(*JWTClaims); ok && TokenRevoked(revocations, &claims.RegisteredClaims, claims.UserID) {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Token was revoked")
 			}
+			return next(c)
+		})
+	}
+}
 
-			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
-		}
+// TokenRevoked reports whether the token with claims, whose user_id claim
+// is userID, is revoked by its jti or its subject
+func TokenRevoked(revocations Revocations, claims *jwt.RegisteredClaims, userID string) bool {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
 	}
+	return revocations.TokenRevoked(claims.ID, []string{claims.Subject, userID}, issuedAt)
 }
 
 func GenerateToken(userID, username, role string, secret string, expiry time.Duration) (string, error) {
@@ -184,6 +243,7 @@ func GenerateToken(userID, username, role string, secret string, expiry time.Dur
 		Username: username,
 		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // Lets the token be revoked on its own
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultKeyRefresh is how often signing keys are fetched again
+	defaultKeyRefresh = time.Hour
+	// unknownKeyRefresh is how often a token signed with an unknown key may
+	// have the keys fetched again, so such tokens cannot flood the provider
+	unknownKeyRefresh = 10 * time.Second
+	// maxJWKSSize bounds discovery documents and key sets
+	maxJWKSSize = 1 << 20
+)
+
+// oidcMethods are the asymmetric algorithms providers sign tokens with
+var oidcMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCProvider validates access tokens issued by an OpenID Connect
+// provider. Its signing keys are discovered from the issuer, cached, and
+// fetched again periodically and when a token is signed with a key not seen
+// yet, so that keys the provider rotates are picked up.
+type OIDCProvider struct {
+	config      config.OIDCProviderConfig
+	auth        config.AuthConfig
+	apiKeys     *APIKeyAuth
+	revocations Revocations
+	client      *http.Client
+	logger      *logrus.Logger
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	jwksURL string
+
+	fetchMu     sync.Mutex // One fetch at a time
+	lastUnknown time.Time
+
+	startOnce sync.Once
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewOIDCProvider creates a provider; its keys are fetched by Start. API
+// keys from apiKeys are accepted like with the JWT secret.
+func NewOIDCProvider(cfg config.OIDCProviderConfig, auth config.AuthConfig, apiKeys *APIKeyAuth, logger *logrus.Logger) *OIDCProvider {
+	return &OIDCProvider{
+		config:   cfg,
+		auth:     auth,
+		apiKeys:  apiKeys,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		keys:     make(map[string]crypto.PublicKey),
+		jwksURL:  cfg.JWKSURL,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// SetRevocations rejects revoked tokens of the provider
+func (p *OIDCProvider) SetRevocations(revocations Revocations) {
+	p.revocations = revocations
+}
+
+// Name returns the name services refer to the provider by
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// Start fetches the signing keys, then again every refresh interval until
+// Stop. A provider that cannot be reached yet is retried when tokens arrive.
+func (p *OIDCProvider) Start() {
+	p.startOnce.Do(func() {
+		p.refresh()
+		p.wg.Add(1)
+		go p.loop()
+	})
+}
+
+// Stop stops refreshing the keys
+func (p *OIDCProvider) Stop() {
+	select {
+	case <-p.stopChan:
+	default:
+		close(p.stopChan)
+	}
+	p.wg.Wait()
+}
+
+func (p *OIDCProvider) loop() {
+	defer p.wg.Done()
+	interval := p.config.RefreshInterval
+	if interval <= 0 {
+		interval = defaultKeyRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-ticker.C:
+			p.refresh()
+		}
+	}
+}
+
+// refresh fetches the keys, keeping the current ones if that fails
+func (p *OIDCProvider) refresh() {
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.Timeout)
+	defer cancel()
+	if err := p.fetchKeys(ctx); err != nil {
+		p.logger.WithError(err).WithField("provider", p.config.Name).Warn("Failed to fetch OIDC signing keys")
+	}
+}
+
+// fetchKeys replaces the keys with those the provider publishes. The
+// caller holds fetchMu.
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	p.mu.RLock()
+	jwksURL := p.jwksURL
+	p.mu.RUnlock()
+	if jwksURL == "" {
+		discovered, err := p.discover(ctx)
+		if err != nil {
+			return err
+		}
+		jwksURL = discovered
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURL, &set); err != nil {
+		return fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			p.logger.WithError(err).WithField("kid", k.Kid).Debug("Skipping OIDC signing key")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%s has no usable signing keys", jwksURL)
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.jwksURL = jwksURL
+	p.mu.Unlock()
+	return nil
+}
+
+// discover looks up where the issuer publishes its keys
+func (p *OIDCProvider) discover(ctx context.Context) (string, error) {
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	url := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, url, &doc); err != nil {
+		return "", fmt.Errorf("discovery failed: %w", err)
+	}
+	if doc.Issuer != p.config.Issuer {
+		return "", fmt.Errorf("discovery returned issuer %q instead of %q", doc.Issuer, p.config.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", fmt.Errorf("discovery returned no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(v)
+}
+
+// key returns the key a token was signed with. A key not seen yet may have
+// been rotated in, so the keys are fetched again unless that was done for
+// another unknown key moments ago. Tokens without kid are checked against
+// every key.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+	// Another request may have fetched the key meanwhile
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.lastUnknown) < unknownKeyRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	p.lastUnknown = time.Now()
+	if err := p.fetchKeys(ctx); err != nil {
+		p.logger.WithError(err).WithField("provider", p.config.Name).Warn("Failed to fetch OIDC signing keys")
+	}
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) cachedKey(kid string) (interface{}, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if kid != "" {
+		key, ok := p.keys[kid]
+		return key, ok
+	}
+	if len(p.keys) == 0 {
+		return nil, false
+	}
+	set := jwt.VerificationKeySet{}
+	for _, key := range p.keys {
+		set.Keys = append(set.Keys, key)
+	}
+	return set, true
+}
+
+// Middleware authenticates clients with the provider's tokens, or with an
+// API key, and requires the provider's scopes plus scopes. Like with the
+// JWT secret, the client's claims are stored as "user".
+func (p *OIDCProvider) Middleware(scopes []string) echo.MiddlewareFunc {
+	required := append(append([]string{}, p.config.Scopes...), scopes...)
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(oidcMethods),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithExpirationRequired(),
+	}
+	if len(p.config.Audience) > 0 {
+		options = append(options, jwt.WithAudience(p.config.Audience...))
+	}
+	parser := jwt.NewParser(options...)
+
+	authenticate := bearerAuth(p.auth, p.apiKeys, func(c echo.Context, tokenString string) error {
+		claims := &oidcClaims{}
+		_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.key(c.Request().Context(), kid)
+		})
+		if err != nil {
+			p.logger.WithError(err).WithField("provider", p.config.Name).Debug("Rejected OIDC token")
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired token")
+		}
+		if missing := missingScopes(claims.scopes(), required); len(missing) > 0 {
+			c.Response().Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(required, " ")))
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient scope")
+		}
+		c.Set("user", claims.jwtClaims())
+		return nil
+	})
+	if p.revocations != nil {
+		authenticate = RejectRevokedTokens(authenticate, p.revocations)
+	}
+	return authenticate
+}
+
+// oidcClaims are the claims of a provider's access token the gateway uses
+type oidcClaims struct {
+	Scope             string      `json:"scope,omitempty"`
+	Scp               interface{} `json:"scp,omitempty"` // Some providers list scopes here, as a string or an array
+	PreferredUsername string      `json:"preferred_username,omitempty"`
+	Email             string      `json:"email,omitempty"`
+	Role              string      `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *oidcClaims) scopes() []string {
+	scopes := strings.Fields(c.Scope)
+	switch scp := c.Scp.(type) {
+	case string:
+		scopes = append(scopes, strings.Fields(scp)...)
+	case []interface{}:
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// jwtClaims maps the claims onto those of gateway tokens, so that consumers,
+// revocation and policies work the same with either
+func (c *oidcClaims) jwtClaims() *JWTClaims {
+	username := c.PreferredUsername
+	if username == "" {
+		username = c.Email
+	}
+	return &JWTClaims{
+		UserID:           c.Subject,
+		Username:         username,
+		Role:             c.Role,
+		RegisteredClaims: c.RegisteredClaims,
+	}
+}
+
+// missingScopes returns the required scopes not granted
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// jwk is a JSON Web Key of a provider's key set
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA, EC or Ed25519 public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported or invalid %s key", k.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
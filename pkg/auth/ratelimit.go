@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// persistInterval is how often API key counts are written to the store
+const persistInterval = 10 * time.Second
+
+// apiKeyPrefix starts the counter keys of API keys
+const apiKeyPrefix = "apikey:"
+
+// RateLimitStore persists rate limit counts, e.g. the MongoDB repository
+type RateLimitStore interface {
+	UpdateRateLimit(ctx context.Context, limit *mongodb.RateLimitDocument) error
+	ListRateLimits(ctx context.Context, prefix string, expiresAfter time.Time) ([]*mongodb.RateLimitDocument, error)
+}
+
+// APIKeyLimiter limits every API key to the requests per minute of its
+// rateLimit. Keys subscribed to a plan follow the plan's limit instead.
+// Requests are counted with a rate limit counter, in Redis when gateways
+// share limits, and the counts are persisted to the store in the background.
+type APIKeyLimiter struct {
+	counter ratelimit.Counter
+	store   RateLimitStore
+	logger  *logrus.Logger
+
+	mu        sync.Mutex
+	pending   map[string]*mongodb.RateLimitDocument
+	startOnce sync.Once
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewAPIKeyLimiter creates a limiter counting requests with counter
+func NewAPIKeyLimiter(counter ratelimit.Counter, store RateLimitStore, logger *logrus.Logger) *APIKeyLimiter {
+	return &APIKeyLimiter{
+		counter:  counter,
+		store:    store,
+		logger:   logger,
+		pending:  make(map[string]*mongodb.RateLimitDocument),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start restores the counts persisted for the current window, so that a
+// restart does not reset them, and persists the counts periodically until
+// Stop
+func (l *APIKeyLimiter) Start() {
+	l.startOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), persistInterval)
+		l.restore(ctx, time.Now())
+		cancel()
+
+		l.wg.Add(1)
+		go l.loop()
+	})
+}
+
+// restore seeds the counter with the persisted counts of the window now
+// falls in. Counters that cannot be seeded keep counting from zero.
+func (l *APIKeyLimiter) restore(ctx context.Context, now time.Time) {
+	seeder, ok := l.counter.(ratelimit.Seeder)
+	if !ok {
+		return
+	}
+	docs, err := l.store.ListRateLimits(ctx, apiKeyPrefix, now)
+	if err != nil {
+		l.logger.WithError(err).Warn("Failed to restore API key rate limits")
+		return
+	}
+
+	start, end := ratelimit.Window(ratelimit.PeriodMinute, now)
+	for _, doc := range docs {
+		if !doc.Window.Equal(start) {
+			continue
+		}
+		if err := seeder.Seed(ctx, doc.Key, int64(doc.Count), start, end); err != nil {
+			l.logger.WithError(err).WithField("key", doc.Key).Warn("Failed to restore API key rate limit")
+		}
+	}
+}
+
+// Stop stops persisting the counts and persists those not written yet
+func (l *APIKeyLimiter) Stop() {
+	select {
+	case <-l.stopChan:
+	default:
+		close(l.stopChan)
+	}
+	l.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), persistInterval)
+	defer cancel()
+	l.persist(ctx)
+}
+
+func (l *APIKeyLimiter) loop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopChan:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), persistInterval)
+			l.persist(ctx)
+			cancel()
+		}
+	}
+}
+
+// persist writes the counts that changed since the last call
+func (l *APIKeyLimiter) persist(ctx context.Context) {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = make(map[string]*mongodb.RateLimitDocument)
+	l.mu.Unlock()
+
+	for _, doc := range pending {
+		if err := l.store.UpdateRateLimit(ctx, doc); err != nil {
+			l.logger.WithError(err).WithField("key", doc.Key).Warn("Failed to persist API key rate limit")
+		}
+	}
+}
+
+// Middleware runs after a service's authentication. Requests of API keys
+// over their limit are answered with 429; those without a key or a limit are
+// left alone.
+func (l *APIKeyLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, ok := c.Get("apiKey").(*mongodb.APIKeyDocument)
+			if !ok || key.Plan != "" || key.RateLimit <= 0 {
+				return next(c)
+			}
+
+			now := time.Now()
+			start, end := ratelimit.Window(ratelimit.PeriodMinute, now)
+			id := apiKeyPrefix + key.ID
+			count, err := l.counter.Increment(c.Request().Context(), id, start, end)
+			if err != nil {
+				l.logger.WithError(err).WithField("apiKey", key.Name).Error("Failed to check API key rate limit")
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Rate limit unavailable")
+			}
+			l.record(id, count, start, end)
+
+			remaining := key.RateLimit - int(count)
+			if remaining < 0 {
+				remaining = 0
+			}
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			header.Set("X-RateLimit-Reset", strconv.FormatInt(end.Unix(), 10))
+			if count > int64(key.RateLimit) {
+				header.Set("Retry-After", strconv.Itoa(int(end.Sub(now).Seconds())+1))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "API key rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// record keeps the latest count of a key's window until it is persisted
+func (l *APIKeyLimiter) record(key string, count int64, start, end time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if doc, ok := l.pending[key]; ok && doc.Window.Equal(start) && int64(doc.Count) > count {
+		return // A concurrent request already recorded a later count
+	}
+	l.pending[key] = &mongodb.RateLimitDocument{
+		Key:       key,
+		Count:     int(count),
+		Window:    start,
+		ExpiresAt: end,
+	}
+}
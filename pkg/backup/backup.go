@@ -0,0 +1,292 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources a snapshot can be taken from
+const (
+	SourceFile    = "file"
+	SourceMongoDB = "mongodb"
+)
+
+// Marker separates the name of the snapshotted file from the time the
+// snapshot was taken, as in config.yaml.backup-20250102-150405
+const Marker = ".backup-"
+
+// TimeFormat is the layout of the time in snapshot names
+const TimeFormat = "20060102-150405"
+
+// ConfigSource provides the configuration document active in MongoDB
+type ConfigSource interface {
+	GetActiveConfig(ctx context.Context) (*mongodb.ConfigDocument, error)
+}
+
+// Result describes a backup run
+type Result struct {
+	Time      time.Time `json:"time"`
+	Snapshots []string  `json:"snapshots"`
+	Uploaded  []string  `json:"uploaded"`
+	Pruned    []string  `json:"pruned"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Status describes the schedule and the last run
+type Status struct {
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	LastRun  *Result   `json:"lastRun,omitempty"`
+}
+
+// Scheduler snapshots the active configuration on a schedule and deletes
+// snapshots that fall out of retention
+type Scheduler struct {
+	cfg        config.BackupConfig
+	configPath string
+	dir        string
+	schedule   Schedule
+	configs    ConfigSource
+	uploader   *S3Uploader
+	logger     *logrus.Logger
+	now        func() time.Time
+
+	runMu   sync.Mutex // serializes runs
+	mu      sync.Mutex
+	next    time.Time
+	lastRun *Result
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for the configuration file at configPath.
+// configs may be nil unless the mongodb source is enabled.
+func NewScheduler(cfg config.BackupConfig, configPath string, configs ConfigSource, logger *logrus.Logger) (*Scheduler, error) {
+	schedule, err := ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	s := &Scheduler{
+		cfg:        cfg,
+		configPath: configPath,
+		dir:        cfg.Directory,
+		schedule:   schedule,
+		configs:    configs,
+		logger:     logger,
+		now:        time.Now,
+	}
+	if s.dir == "" {
+		s.dir = filepath.Join(filepath.Dir(configPath), "backups")
+	}
+	for _, source := range cfg.Sources {
+		if source == SourceMongoDB && configs == nil {
+			return nil, fmt.Errorf("the mongodb source requires a MongoDB connection")
+		}
+	}
+	if cfg.S3 != nil {
+		if s.uploader, err = NewS3Uploader(*cfg.S3); err != nil {
+			return nil, fmt.Errorf("s3: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Start runs backups on the schedule until Stop is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go s.loop(ctx)
+}
+
+// Stop stops scheduling backups and waits for a running one to finish
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// Status returns the schedule, when the next backup is due and the outcome
+// of the last one
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{Schedule: s.cfg.Schedule, Next: s.next, LastRun: s.lastRun}
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		next := s.schedule.Next(s.now())
+		if next.IsZero() {
+			s.logger.WithField("schedule", s.cfg.Schedule).Warn("Backup schedule never matches")
+			return
+		}
+		s.mu.Lock()
+		s.next = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		result, err := s.Run(ctx)
+		if err != nil {
+			s.logger.WithError(err).Error("Scheduled config backup failed")
+			continue
+		}
+		s.logger.WithFields(logrus.Fields{
+			"snapshots": len(result.Snapshots),
+			"uploaded":  len(result.Uploaded),
+			"pruned":    len(result.Pruned),
+		}).Info("Scheduled config backup completed")
+	}
+}
+
+// Run takes a snapshot of every source, uploads them if S3 is configured and
+// then enforces retention. Snapshots taken before an error are kept.
+func (s *Scheduler) Run(ctx context.Context) (*Result, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	result := &Result{Time: s.now(), Snapshots: []string{}, Uploaded: []string{}, Pruned: []string{}}
+	err := s.run(ctx, result)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.lastRun = result
+	s.mu.Unlock()
+	return result, err
+}
+
+func (s *Scheduler) run(ctx context.Context, result *Result) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	stamp := result.Time.Format(TimeFormat)
+	for _, source := range s.cfg.Sources {
+		name, data, err := s.snapshot(ctx, source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		name += Marker + stamp
+
+		path := filepath.Join(s.dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		result.Snapshots = append(result.Snapshots, path)
+
+		if s.uploader != nil {
+			if err := s.uploader.Upload(ctx, name, data); err != nil {
+				return fmt.Errorf("s3: %w", err)
+			}
+			result.Uploaded = append(result.Uploaded, s.cfg.S3.Prefix+name)
+		}
+	}
+
+	pruned, err := Prune(s.dir, s.cfg.MaxCount, s.cfg.MaxAge, result.Time)
+	result.Pruned = append(result.Pruned, pruned...)
+	if err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	return nil
+}
+
+// snapshot returns the contents of a source and the name its snapshots start with
+func (s *Scheduler) snapshot(ctx context.Context, source string) (string, []byte, error) {
+	switch source {
+	case SourceFile:
+		data, err := os.ReadFile(s.configPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		return filepath.Base(s.configPath), data, nil
+	case SourceMongoDB:
+		doc, err := s.configs.GetActiveConfig(ctx)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get active config: %w", err)
+		}
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal config: %w", err)
+		}
+		return "mongodb-config.yaml", data, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported source")
+	}
+}
+
+// Prune deletes the snapshots in dir that are older than maxAge or beyond the
+// newest maxCount of the same file, and returns their paths. Zero disables a
+// limit. Files without a snapshot time in their name are left alone.
+func Prune(dir string, maxCount int, maxAge time.Duration, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	type snapshot struct {
+		path  string
+		taken time.Time
+	}
+	series := make(map[string][]snapshot)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		idx := strings.LastIndex(entry.Name(), Marker)
+		if idx < 0 {
+			continue
+		}
+		taken, err := time.ParseInLocation(TimeFormat, entry.Name()[idx+len(Marker):], now.Location())
+		if err != nil {
+			continue
+		}
+		name := entry.Name()[:idx]
+		series[name] = append(series[name], snapshot{filepath.Join(dir, entry.Name()), taken})
+	}
+
+	pruned := []string{}
+	for _, snapshots := range series {
+		sort.Slice(snapshots, func(i, j int) bool {
+			return snapshots[i].taken.After(snapshots[j].taken)
+		})
+		for i, snap := range snapshots {
+			expired := maxAge > 0 && now.Sub(snap.taken) > maxAge
+			excess := maxCount > 0 && i >= maxCount
+			if !expired && !excess {
+				continue
+			}
+			if err := os.Remove(snap.path); err != nil && !os.IsNotExist(err) {
+				return pruned, fmt.Errorf("failed to delete %s: %w", snap.path, err)
+			}
+			pruned = append(pruned, snap.path)
+		}
+	}
+	sort.Strings(pruned)
+	return pruned, nil
+}
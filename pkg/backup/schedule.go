@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next time a backup is due after a given time
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses a five-field cron expression (minute, hour, day of
+// month, month, day of week), one of @hourly, @daily, @weekly and @monthly,
+// or "@every <duration>". Cron expressions are evaluated in the time zone of
+// the times passed to Next.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if interval < time.Minute {
+			return nil, fmt.Errorf("interval must be at least 1m")
+		}
+		return every(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// Both 0 and 7 are Sunday
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return &s, nil
+}
+
+type every time.Duration
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+// maxSearch bounds the search for a time matching expressions like
+// "0 0 31 2 *" that never match
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	loc := t.Location()
+
+	for t.Before(limit) {
+		if !s.month[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both the day of month and the day of week
+// are restricted, a day matching either is due
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[t.Weekday()]
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// parseField parses a comma-separated list of values, ranges and steps such
+// as "*/15", "1-5" or "0,30" into a set of the values between min and max
+func parseField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if rng, stepText, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+			part, step = rng, n
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			loText, hiText, isRange := strings.Cut(part, "-")
+			var err error
+			if lo, err = strconv.Atoi(loText); err != nil {
+				return nil, fmt.Errorf("invalid value %q", loText)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiText); err != nil {
+					return nil, fmt.Errorf("invalid value %q", hiText)
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end in steps of 15
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,346 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// ScoreHeader carries the score of tagged requests to the upstream service
+const ScoreHeader = "X-Bot-Score"
+
+// Action is what the guard does with a scored request
+type Action string
+
+const (
+	ActionNone      Action = ""
+	ActionTag       Action = "tag"
+	ActionChallenge Action = "challenge"
+	ActionThrottle  Action = "throttle"
+	ActionBlock     Action = "block"
+)
+
+// Result is the outcome of scoring one request
+type Result struct {
+	Score           int      `json:"score"`
+	Reasons         []string `json:"reasons,omitempty"`
+	Action          Action   `json:"action,omitempty"`
+	ChallengePassed bool     `json:"challengePassed,omitempty"`
+}
+
+// Recorder receives the score of every scored request, e.g. to feed the
+// AI traffic patterns
+type Recorder interface {
+	RecordBotScore(serviceName, endpoint, method string, score int, action string)
+}
+
+// Guard scores requests for signs of automation and tags, challenges,
+// throttles or blocks them
+type Guard struct {
+	config   config.BotConfig
+	secret   []byte
+	excluded map[string]bool
+	recorder Recorder
+	clientIP func(r *http.Request) net.IP
+	logger   *logrus.Logger
+
+	mu        sync.Mutex
+	clients   map[string]*clientState
+	lastPrune time.Time
+}
+
+// New creates a guard from the configuration
+func New(cfg config.BotConfig, logger *logrus.Logger) (*Guard, error) {
+	secret := []byte(cfg.Challenge.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate challenge secret: %w", err)
+		}
+	}
+
+	excluded := make(map[string]bool, len(cfg.ExcludeServices))
+	for _, name := range cfg.ExcludeServices {
+		excluded[name] = true
+	}
+
+	return &Guard{
+		config:   cfg,
+		secret:   secret,
+		excluded: excluded,
+		clientIP: remoteIP,
+		logger:   logger,
+		clients:  make(map[string]*clientState),
+	}, nil
+}
+
+// SetRecorder records scores, e.g. into the AI traffic collector
+func (g *Guard) SetRecorder(recorder Recorder) {
+	g.recorder = recorder
+}
+
+// SetClientIP replaces how the client address is determined, e.g. with the
+// IP filter's trusted-proxy aware lookup
+func (g *Guard) SetClientIP(clientIP func(r *http.Request) net.IP) {
+	g.clientIP = clientIP
+}
+
+// Applies reports whether the guard protects a service
+func (g *Guard) Applies(service string) bool {
+	return !g.excluded[service]
+}
+
+// Evaluate scores a request and picks its action. It also records the
+// request for the client's cadence, so it must be called once per request.
+func (g *Guard) Evaluate(r *http.Request) Result {
+	if g.skipped(r) {
+		return Result{}
+	}
+
+	now := time.Now()
+	ip := g.ipString(r)
+
+	g.mu.Lock()
+	state := g.client(ip, now)
+	state.arrivals = append(state.arrivals, now)
+	if keep := g.maxArrivals(); len(state.arrivals) > keep {
+		state.arrivals = state.arrivals[len(state.arrivals)-keep:]
+	}
+	arrivals := append([]time.Time(nil), state.arrivals...)
+	g.mu.Unlock()
+
+	score, reasons := scoreUserAgent(r)
+	cadenceScore, cadenceReasons := scoreCadence(arrivals, now, g.config.CadenceWindow, g.config.CadenceLimit)
+	score += cadenceScore
+	reasons = append(reasons, cadenceReasons...)
+	if score > 100 {
+		score = 100
+	}
+
+	result := Result{Score: score, Reasons: reasons, Action: g.action(score)}
+	if result.Action == ActionChallenge && g.challengePassed(r, ip, now) {
+		result.ChallengePassed = true
+		result.Action = ActionTag
+	}
+	return result
+}
+
+func (g *Guard) action(score int) Action {
+	thresholds := g.config.Thresholds
+	switch {
+	case thresholds.Block > 0 && score >= thresholds.Block:
+		return ActionBlock
+	case thresholds.Throttle > 0 && score >= thresholds.Throttle:
+		return ActionThrottle
+	case thresholds.Challenge > 0 && score >= thresholds.Challenge:
+		return ActionChallenge
+	case thresholds.Tag > 0 && score >= thresholds.Tag:
+		return ActionTag
+	}
+	return ActionNone
+}
+
+func (g *Guard) skipped(r *http.Request) bool {
+	for _, prefix := range g.config.ExcludePaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	ua := strings.ToLower(r.UserAgent())
+	for _, allowed := range g.config.AllowUserAgents {
+		if allowed != "" && strings.Contains(ua, strings.ToLower(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware applies the guard to a service's routes. It must be registered
+// ahead of authentication so blocked clients never reach it.
+func (g *Guard) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			// Upstreams must be able to trust the header
+			req.Header.Del(ScoreHeader)
+
+			result := g.Evaluate(req)
+			if g.recorder != nil && result.Score > 0 {
+				g.recorder.RecordBotScore(service, req.URL.Path, req.Method, result.Score, string(result.Action))
+			}
+
+			if result.Action == ActionBlock || result.Action == ActionThrottle || result.Action == ActionChallenge {
+				g.logger.WithFields(logrus.Fields{
+					"service": service,
+					"ip":      g.ipString(req),
+					"score":   result.Score,
+					"action":  result.Action,
+					"reasons": result.Reasons,
+				}).Debug("Bot mitigation applied")
+			}
+
+			switch result.Action {
+			case ActionBlock:
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+
+			case ActionThrottle:
+				if !g.allowThrottled(g.ipString(req), time.Now()) {
+					c.Response().Header().Set("Retry-After", "60")
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests")
+				}
+
+			case ActionChallenge:
+				return g.challenge(c)
+			}
+
+			if result.Action != ActionNone {
+				req.Header.Set(ScoreHeader, strconv.Itoa(result.Score))
+			}
+			return next(c)
+		}
+	}
+}
+
+// challenge hands out a token that must be sent back with the next request,
+// as a cookie or in the configured header. Clients that keep cookies pass
+// transparently; simple scripts do not.
+func (g *Guard) challenge(c echo.Context) error {
+	cfg := g.config.Challenge
+	expires := time.Now().Add(cfg.TTL)
+	token := g.Token(g.ipString(c.Request()), expires)
+
+	c.SetCookie(&http.Cookie{
+		Name:     cfg.Cookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if cfg.Header != "" {
+		c.Response().Header().Set(cfg.Header, token)
+	}
+
+	return c.JSON(http.StatusForbidden, map[string]string{
+		"error": "Bot challenge required; retry the request with the issued token",
+	})
+}
+
+// Token returns a challenge token for a client address, valid until expires
+func (g *Guard) Token(ip string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + g.sign(ip, expiry)
+}
+
+func (g *Guard) challengePassed(r *http.Request, ip string, now time.Time) bool {
+	cfg := g.config.Challenge
+	var tokens []string
+	if cookie, err := r.Cookie(cfg.Cookie); err == nil {
+		tokens = append(tokens, cookie.Value)
+	}
+	if cfg.Header != "" {
+		if value := r.Header.Get(cfg.Header); value != "" {
+			tokens = append(tokens, value)
+		}
+	}
+
+	for _, token := range tokens {
+		expiry, signature, ok := strings.Cut(token, ".")
+		if !ok {
+			continue
+		}
+		unix, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || now.After(time.Unix(unix, 0)) {
+			continue
+		}
+		if hmac.Equal([]byte(signature), []byte(g.sign(ip, expiry))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) sign(ip, expiry string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(ip + "|" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// allowThrottled counts a throttled request against the client's
+// per-minute budget
+func (g *Guard) allowThrottled(ip string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state := g.client(ip, now)
+	if now.Sub(state.throttleStart) >= time.Minute {
+		state.throttleStart = now
+		state.throttleCount = 0
+	}
+	if state.throttleCount >= g.config.ThrottleRPM {
+		return false
+	}
+	state.throttleCount++
+	return true
+}
+
+// client returns the state of a client address and drops idle clients.
+// Callers must hold mu.
+func (g *Guard) client(ip string, now time.Time) *clientState {
+	idle := 2 * time.Minute
+	if window := 2 * g.config.CadenceWindow; window > idle {
+		idle = window
+	}
+	if now.Sub(g.lastPrune) > time.Minute {
+		for key, state := range g.clients {
+			if now.Sub(state.lastSeen) > idle {
+				delete(g.clients, key)
+			}
+		}
+		g.lastPrune = now
+	}
+
+	state, ok := g.clients[ip]
+	if !ok {
+		state = &clientState{}
+		g.clients[ip] = state
+	}
+	state.lastSeen = now
+	return state
+}
+
+// maxArrivals is how many arrivals are kept per client
+func (g *Guard) maxArrivals() int {
+	if g.config.CadenceLimit+1 > minCadenceSamples {
+		return g.config.CadenceLimit + 1
+	}
+	return minCadenceSamples
+}
+
+func (g *Guard) ipString(r *http.Request) string {
+	if ip := g.clientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
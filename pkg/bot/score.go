@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// automationAgents are user agent fragments of HTTP libraries, headless
+// browsers and self-declared crawlers
+var automationAgents = []string{
+	"curl", "wget", "python", "go-http-client", "java/", "okhttp", "libwww",
+	"scrapy", "httpclient", "node-fetch", "axios", "headless", "phantomjs",
+	"selenium", "puppeteer", "playwright", "bot", "crawler", "spider", "scraper",
+}
+
+// minCadenceSamples is the number of arrivals needed before the regularity
+// of a client's request intervals is judged
+const minCadenceSamples = 10
+
+// clientState tracks one client address
+type clientState struct {
+	arrivals      []time.Time // most recent arrivals, oldest first
+	throttleStart time.Time
+	throttleCount int
+	lastSeen      time.Time
+}
+
+// scoreUserAgent scores the user agent and how well the other request
+// headers fit it. Go's HTTP server does not preserve header order, so the
+// fingerprint relies on which headers are present.
+func scoreUserAgent(r *http.Request) (int, []string) {
+	ua := strings.ToLower(r.UserAgent())
+	if ua == "" {
+		return 40, []string{"missing user agent"}
+	}
+
+	for _, fragment := range automationAgents {
+		if strings.Contains(ua, fragment) {
+			return 40, []string{"automation user agent"}
+		}
+	}
+
+	if !strings.HasPrefix(ua, "mozilla/") {
+		return 20, []string{"unrecognised user agent"}
+	}
+
+	score := 0
+	var reasons []string
+	if r.Header.Get("Accept-Language") == "" {
+		score += 15
+		reasons = append(reasons, "browser without Accept-Language")
+	}
+	if r.Header.Get("Accept") == "" {
+		score += 10
+		reasons = append(reasons, "browser without Accept")
+	}
+	if r.Header.Get("Accept-Encoding") == "" {
+		score += 10
+		reasons = append(reasons, "browser without Accept-Encoding")
+	}
+	// Chromium-based browsers have sent fetch metadata since version 76
+	if strings.Contains(ua, "chrome/") && r.Header.Get("Sec-Fetch-Mode") == "" {
+		score += 15
+		reasons = append(reasons, "browser headers inconsistent with user agent")
+	}
+
+	return score, reasons
+}
+
+// scoreCadence scores how fast and how regularly a client sends requests
+func scoreCadence(arrivals []time.Time, now time.Time, window time.Duration, limit int) (int, []string) {
+	score := 0
+	var reasons []string
+
+	inWindow := 0
+	for _, arrival := range arrivals {
+		if now.Sub(arrival) <= window {
+			inWindow++
+		}
+	}
+	if limit > 0 && inWindow > limit {
+		score += 30
+		reasons = append(reasons, "high request rate")
+	}
+
+	// Scripts tend to fire at fixed intervals; people do not
+	if len(arrivals) >= minCadenceSamples {
+		intervals := make([]float64, 0, len(arrivals)-1)
+		var sum float64
+		for i := 1; i < len(arrivals); i++ {
+			interval := arrivals[i].Sub(arrivals[i-1]).Seconds()
+			intervals = append(intervals, interval)
+			sum += interval
+		}
+		mean := sum / float64(len(intervals))
+
+		var variance float64
+		for _, interval := range intervals {
+			variance += (interval - mean) * (interval - mean)
+		}
+		variance /= float64(len(intervals))
+
+		if mean > 0 && math.Sqrt(variance)/mean < 0.1 {
+			score += 20
+			reasons = append(reasons, "machine-regular request cadence")
+		}
+	}
+
+	return score, reasons
+}
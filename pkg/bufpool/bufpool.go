@@ -0,0 +1,60 @@
+// Package bufpool recycles the buffers the proxy reads and copies bodies
+// with, so busy gateways do not allocate fresh slices for every request.
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// copySize is the size of the buffers used for streaming copies
+	copySize = 32 * 1024
+
+	// maxPooled is the largest buffer put back into the pool. Bigger ones
+	// are left to the garbage collector so a single large body does not pin
+	// its memory for the lifetime of the process.
+	maxPooled = 1 << 20
+)
+
+var buffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copySize)
+		return &buf
+	},
+}
+
+// Get returns an empty buffer from the pool
+func Get() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// Put returns a buffer to the pool. The buffer and any slice obtained from
+// its Bytes method must not be used afterwards.
+func Put(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooled {
+		return
+	}
+	buf.Reset()
+	buffers.Put(buf)
+}
+
+// ReadAll reads r into a pooled buffer. The caller releases it with Put once
+// the contents are no longer needed, also when an error is returned.
+func ReadAll(r io.Reader) (*bytes.Buffer, error) {
+	buf := Get()
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
+
+// Copy is io.Copy with a pooled buffer
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	bufp := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bufp)
+	return io.CopyBuffer(dst, src, *bufp)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"odin/pkg/config"
+	"strings"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -23,9 +24,23 @@ type Store interface {
 	Set(key string, value interface{}, ttl time.Duration)
 	Delete(key string)
 	Clear()
+	// Purge deletes the cached responses to paths starting with prefix, or
+	// every entry when prefix is empty, and returns how many it deleted
+	Purge(prefix string) (int, error)
+	// Ping reports whether the store can be reached
+	Ping(ctx context.Context) error
 	Close() error
 }
 
+// KeyPrefix starts the keys of every cache entry
+const KeyPrefix = "cache:"
+
+// ResponseKey builds the key of a cached response to a request for path.
+// Keys start with the path so responses can be purged by path prefix.
+func ResponseKey(path, digest string) string {
+	return KeyPrefix + path + "#" + digest
+}
+
 type LocalStore struct {
 	cache *cache.Cache
 }
@@ -78,6 +93,27 @@ func (s *LocalStore) Clear() {
 	s.cache.Flush()
 }
 
+func (s *LocalStore) Purge(prefix string) (int, error) {
+	if prefix == "" {
+		purged := s.cache.ItemCount()
+		s.cache.Flush()
+		return purged, nil
+	}
+
+	purged := 0
+	for key := range s.cache.Items() {
+		if strings.HasPrefix(key, KeyPrefix+prefix) {
+			s.cache.Delete(key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *LocalStore) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (s *LocalStore) Close() error {
 	return nil
 }
@@ -118,12 +154,46 @@ func (s *RedisStore) Delete(key string) {
 
 func (s *RedisStore) Clear() {
 	ctx := context.Background()
-	iter := s.client.Scan(ctx, 0, "cache:*", 100).Iterator()
+	iter := s.client.Scan(ctx, 0, KeyPrefix+"*", 100).Iterator()
 	for iter.Next(ctx) {
 		s.client.Del(ctx, iter.Val())
 	}
 }
 
+func (s *RedisStore) Purge(prefix string) (int, error) {
+	ctx := context.Background()
+	purged := 0
+	iter := s.client.Scan(ctx, 0, KeyPrefix+escapeGlob(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		deleted, err := s.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			return purged, fmt.Errorf("failed to delete cache entry: %w", err)
+		}
+		purged += int(deleted)
+	}
+	if err := iter.Err(); err != nil {
+		return purged, fmt.Errorf("failed to scan cache entries: %w", err)
+	}
+	return purged, nil
+}
+
+// escapeGlob escapes the characters Redis patterns treat specially
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\', '^', '-':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 func (s *RedisStore) Close() error {
 	return s.client.Close()
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"net/http"
@@ -104,7 +105,7 @@ func (sm *StrategyManager) GenerateKey(req *http.Request, userContext string) st
 
 	key := strings.Join(keyParts, ":")
 	hash := md5.Sum([]byte(key))
-	return fmt.Sprintf("cache:%x", hash)
+	return ResponseKey(req.URL.Path, fmt.Sprintf("%x", hash))
 }
 
 func (sm *StrategyManager) ShouldCache(statusCode int, headers http.Header) bool {
@@ -286,6 +287,29 @@ func (m *MemoryStore) Clear() {
 	m.items = make(map[string]interface{})
 }
 
+func (m *MemoryStore) Purge(prefix string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prefix == "" {
+		purged := len(m.items)
+		m.items = make(map[string]interface{})
+		return purged, nil
+	}
+
+	purged := 0
+	for key := range m.items {
+		if strings.HasPrefix(key, KeyPrefix+prefix) {
+			delete(m.items, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (m *MemoryStore) Close() error {
 	return nil
 }
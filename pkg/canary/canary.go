@@ -47,7 +47,10 @@ func (r *Router) ShouldUseCanary(req *http.Request, config *service.CanaryConfig
 	}
 
 	// Weight-based routing (sticky by IP for consistent routing)
-	if config.Weight > 0 && config.Weight < 100 {
+	if config.Weight >= 100 {
+		return true
+	}
+	if config.Weight > 0 {
 		return r.shouldRouteByWeight(req, config.Weight)
 	}
 
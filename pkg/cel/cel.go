@@ -0,0 +1,76 @@
+// Package cel evaluates predicates written in a subset of the Common
+// Expression Language (CEL) over request attributes, so that routes and
+// authorization policies can express conditions without plugins.
+//
+// Expressions may refer to request (method, path, host, scheme, ip, headers
+// and query), claims (the JWT claims of authenticated clients) and now, the
+// time of the request. They support the CEL literals, operators, has(),
+// size(), int(), double(), string(), the string methods startsWith,
+// endsWith, contains, matches, lowerAscii, upperAscii and trim, and the
+// timestamp methods getHours, getMinutes, getDayOfWeek, getDayOfMonth,
+// getMonth and getFullYear. inCidr(ip, range) is an extension.
+package cel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variables are the attributes expressions may refer to
+var variables = map[string]bool{"request": true, "claims": true, "now": true}
+
+// Program is a compiled expression
+type Program struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression. References to unknown attributes or
+// functions, and invalid literal patterns, ranges and time zones, are
+// reported here rather than when requests are evaluated.
+func Compile(source string) (*Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	if lit, ok := root.(*literal); ok {
+		if _, ok := lit.value.(bool); !ok {
+			return nil, fmt.Errorf("expression is %s, not bool", typeName(lit.value))
+		}
+	}
+	return &Program{source: source, root: root}, nil
+}
+
+// String returns the source of the program
+func (p *Program) String() string {
+	return p.source
+}
+
+// Eval evaluates the program with the given attributes
+func (p *Program) Eval(vars map[string]any) (any, error) {
+	return p.root.eval(vars)
+}
+
+// Test evaluates a boolean program
+func (p *Program) Test(vars map[string]any) (bool, error) {
+	v, err := p.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression is %s, not bool", typeName(v))
+	}
+	return b, nil
+}
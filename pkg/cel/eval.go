@@ -0,0 +1,748 @@
+package cel
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// node is a parsed expression
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literal struct{ value any }
+
+func (n *literal) eval(map[string]any) (any, error) { return n.value, nil }
+
+type variable struct{ name string }
+
+func (n *variable) eval(vars map[string]any) (any, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("no such attribute: %s", n.name)
+	}
+	return v, nil
+}
+
+type listNode struct{ items []node }
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	list := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+type mapNode struct{ keys, values []node }
+
+func (n *mapNode) eval(vars map[string]any) (any, error) {
+	m := make(map[string]any, len(n.keys))
+	for i := range n.keys {
+		k, err := n.keys[i].eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be strings, got %s", typeName(k))
+		}
+		v, err := n.values[i].eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+type selectField struct {
+	operand node
+	field   string
+}
+
+func (n *selectField) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot select %s from %s", n.field, typeName(v))
+	}
+	field, ok := m[n.field]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", n.field)
+	}
+	return field, nil
+}
+
+type hasField struct {
+	operand node
+	field   string
+}
+
+func (n *hasField) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("has() on %s", typeName(v))
+	}
+	_, ok = m[n.field]
+	return ok, nil
+}
+
+type indexNode struct{ operand, index node }
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch container := v.(type) {
+	case map[string]any:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map index must be a string, got %s", typeName(index))
+		}
+		value, ok := container[key]
+		if !ok {
+			return nil, fmt.Errorf("no such key: %s", key)
+		}
+		return value, nil
+	case []any:
+		i, ok := toInt(index)
+		if !ok {
+			return nil, fmt.Errorf("list index must be an int, got %s", typeName(index))
+		}
+		if i < 0 || i >= int64(len(container)) {
+			return nil, fmt.Errorf("index %d out of range", i)
+		}
+		return container[i], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(v))
+}
+
+type not struct{ operand node }
+
+func (n *not) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! applied to %s", typeName(v))
+	}
+	return !b, nil
+}
+
+type negate struct{ operand node }
+
+func (n *negate) eval(vars map[string]any) (any, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if i, ok := v.(int64); ok {
+		return -i, nil
+	}
+	if f, ok := toFloat(v); ok {
+		return -f, nil
+	}
+	return nil, fmt.Errorf("- applied to %s", typeName(v))
+}
+
+type conditional struct{ cond, then, otherwise node }
+
+func (n *conditional) eval(vars map[string]any) (any, error) {
+	v, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition is %s, not bool", typeName(v))
+	}
+	if b {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+// logical is && or ||. As in CEL, either side decides the result on its
+// own: claims.role == "admin" || request.ip.startsWith("10.") is true for
+// clients from 10.x even when they have no role claim.
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n *logical) eval(vars map[string]any) (any, error) {
+	left, leftErr := evalBool(n.left, vars)
+	if leftErr == nil && left != n.and {
+		return left, nil
+	}
+	right, rightErr := evalBool(n.right, vars)
+	if rightErr == nil && right != n.and {
+		return right, nil
+	}
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
+	return n.and, nil
+}
+
+func evalBool(n node, vars map[string]any) (bool, error) {
+	v, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n *binary) eval(vars map[string]any) (any, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in":
+		switch container := right.(type) {
+		case []any:
+			for _, item := range container {
+				if equal(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]any:
+			key, ok := left.(string)
+			if !ok {
+				return false, nil
+			}
+			_, ok = container[key]
+			return ok, nil
+		}
+		return nil, fmt.Errorf("in applied to %s", typeName(right))
+	}
+	return arithmetic(n.op, left, right)
+}
+
+func arithmetic(op string, left, right any) (any, error) {
+	if op == "+" {
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		}
+		if l, ok := left.([]any); ok {
+			if r, ok := right.([]any); ok {
+				return append(append([]any{}, l...), r...), nil
+			}
+		}
+	}
+	li, lInt := left.(int64)
+	ri, rInt := right.(int64)
+	if lInt && rInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s applied to %s and %s", op, typeName(left), typeName(right))
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	}
+	return math.Mod(lf, rf), nil
+}
+
+// equal compares values, numbers by value whatever their type since claims
+// decoded from JSON are doubles
+func equal(left, right any) bool {
+	if lf, ok := toFloat(left); ok {
+		rf, ok := toFloat(right)
+		return ok && lf == rf
+	}
+	if lt, ok := left.(time.Time); ok {
+		rt, ok := right.(time.Time)
+		return ok && lt.Equal(rt)
+	}
+	switch l := left.(type) {
+	case []any:
+		r, ok := right.([]any)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !equal(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		r, ok := right.(map[string]any)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for k, v := range l {
+			rv, ok := r[k]
+			if !ok || !equal(v, rv) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compare(left, right any) (int, error) {
+	if lf, ok := toFloat(left); ok {
+		if rf, ok := toFloat(right); ok {
+			switch {
+			case lf < rf:
+				return -1, nil
+			case lf > rf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	if l, ok := left.(time.Time); ok {
+		if r, ok := right.(time.Time); ok {
+			return l.Compare(r), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s", typeName(left), typeName(right))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		if n == math.Trunc(n) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64, int:
+		return "int"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	case time.Time:
+		return "timestamp"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// call is a function or method call. The target of methods is passed to fn
+// first.
+type call struct {
+	target node // nil for functions
+	args   []node
+	fn     func(args []any) (any, error)
+}
+
+func (n *call) eval(vars map[string]any) (any, error) {
+	operands := n.args
+	if n.target != nil {
+		operands = append([]node{n.target}, n.args...)
+	}
+	values := make([]any, len(operands))
+	for i, operand := range operands {
+		v, err := operand.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return n.fn(values)
+}
+
+// newCall resolves a function, or a method when target is not nil
+func newCall(name string, target node, args []node) (node, error) {
+	n := &call{target: target, args: args}
+	arity := func(want ...int) error {
+		for _, w := range want {
+			if len(args) == w {
+				return nil
+			}
+		}
+		return fmt.Errorf("wrong number of arguments to %s", name)
+	}
+
+	if target == nil {
+		switch name {
+		case "size", "int", "double", "string":
+			if err := arity(1); err != nil {
+				return nil, err
+			}
+			n.fn = conversions[name]
+		case "inCidr":
+			if err := arity(2); err != nil {
+				return nil, err
+			}
+			fn, err := inCIDR(args[1])
+			if err != nil {
+				return nil, err
+			}
+			n.fn = fn
+		default:
+			return nil, fmt.Errorf("undeclared function %s", name)
+		}
+		return n, nil
+	}
+
+	switch name {
+	case "size":
+		if err := arity(0); err != nil {
+			return nil, err
+		}
+		n.fn = conversions["size"]
+	case "startsWith", "endsWith", "contains":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		test := map[string]func(s, sub string) bool{
+			"startsWith": strings.HasPrefix,
+			"endsWith":   strings.HasSuffix,
+			"contains":   strings.Contains,
+		}[name]
+		n.fn = func(values []any) (any, error) {
+			s, ok1 := values[0].(string)
+			sub, ok2 := values[1].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%s applied to %s", name, typeName(values[0]))
+			}
+			return test(s, sub), nil
+		}
+	case "matches":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		fn, err := matches(args[0])
+		if err != nil {
+			return nil, err
+		}
+		n.fn = fn
+	case "lowerAscii", "upperAscii", "trim":
+		if err := arity(0); err != nil {
+			return nil, err
+		}
+		change := map[string]func(string) string{
+			"lowerAscii": strings.ToLower,
+			"upperAscii": strings.ToUpper,
+			"trim":       strings.TrimSpace,
+		}[name]
+		n.fn = func(values []any) (any, error) {
+			s, ok := values[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("%s applied to %s", name, typeName(values[0]))
+			}
+			return change(s), nil
+		}
+	case "getHours", "getMinutes", "getDayOfWeek", "getDayOfMonth", "getMonth", "getFullYear":
+		if err := arity(0, 1); err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			if lit, ok := args[0].(*literal); ok {
+				zone, _ := lit.value.(string)
+				if _, err := location(zone); err != nil {
+					return nil, err
+				}
+			}
+		}
+		n.fn = timePart(name)
+	default:
+		return nil, fmt.Errorf("undeclared method %s", name)
+	}
+	return n, nil
+}
+
+var conversions = map[string]func(args []any) (any, error){
+	"size": func(args []any) (any, error) {
+		switch v := args[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(v)), nil
+		case []any:
+			return int64(len(v)), nil
+		case map[string]any:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size applied to %s", typeName(args[0]))
+	},
+	"int": func(args []any) (any, error) {
+		switch v := args[0].(type) {
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("int(%q): not an integer", v)
+			}
+			return i, nil
+		case time.Time:
+			return v.Unix(), nil
+		}
+		if f, ok := toFloat(args[0]); ok {
+			return int64(f), nil
+		}
+		return nil, fmt.Errorf("int applied to %s", typeName(args[0]))
+	},
+	"double": func(args []any) (any, error) {
+		if s, ok := args[0].(string); ok {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("double(%q): not a number", s)
+			}
+			return f, nil
+		}
+		if f, ok := toFloat(args[0]); ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("double applied to %s", typeName(args[0]))
+	},
+	"string": func(args []any) (any, error) {
+		switch v := args[0].(type) {
+		case string:
+			return v, nil
+		case int64, float64, bool:
+			return fmt.Sprint(v), nil
+		case time.Time:
+			return v.UTC().Format(time.RFC3339), nil
+		}
+		return nil, fmt.Errorf("string applied to %s", typeName(args[0]))
+	},
+}
+
+// matches tests strings against a regular expression, compiled once if it
+// is a literal
+func matches(pattern node) (func(args []any) (any, error), error) {
+	var re *regexp.Regexp
+	if lit, ok := pattern.(*literal); ok {
+		s, ok := lit.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("matches takes a string pattern")
+		}
+		var err error
+		if re, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", s, err)
+		}
+	}
+	return func(args []any) (any, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("matches applied to %s", typeName(args[0]))
+		}
+		compiled := re
+		if compiled == nil {
+			p, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("matches takes a string pattern")
+			}
+			var err error
+			if compiled, err = regexp.Compile(p); err != nil {
+				return nil, err
+			}
+		}
+		return compiled.MatchString(s), nil
+	}, nil
+}
+
+// inCIDR tests whether an IP address is in a range, parsed once if it is a
+// literal
+func inCIDR(cidr node) (func(args []any) (any, error), error) {
+	var network *net.IPNet
+	if lit, ok := cidr.(*literal); ok {
+		s, ok := lit.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("inCidr takes a string range")
+		}
+		var err error
+		if _, network, err = net.ParseCIDR(s); err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", s)
+		}
+	}
+	return func(args []any) (any, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("inCidr applied to %s", typeName(args[0]))
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false, nil
+		}
+		ipNet := network
+		if ipNet == nil {
+			r, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("inCidr takes a string range")
+			}
+			var err error
+			if _, ipNet, err = net.ParseCIDR(r); err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", r)
+			}
+		}
+		return ipNet.Contains(ip), nil
+	}, nil
+}
+
+var locations sync.Map // Time zones by name
+
+// timePart returns a CEL timestamp accessor. Times are in UTC unless a time
+// zone name is given. Months count from 0 and weekdays from Sunday, as in
+// CEL.
+func timePart(name string) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("%s applied to %s", name, typeName(args[0]))
+		}
+		t = t.UTC()
+		if len(args) == 2 {
+			zone, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("%s takes a time zone name", name)
+			}
+			loc, err := location(zone)
+			if err != nil {
+				return nil, err
+			}
+			t = t.In(loc)
+		}
+		switch name {
+		case "getHours":
+			return int64(t.Hour()), nil
+		case "getMinutes":
+			return int64(t.Minute()), nil
+		case "getDayOfWeek":
+			return int64(t.Weekday()), nil
+		case "getDayOfMonth":
+			return int64(t.Day() - 1), nil
+		case "getMonth":
+			return int64(t.Month() - 1), nil
+		}
+		return int64(t.Year()), nil
+	}
+}
+
+func location(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
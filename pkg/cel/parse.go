@@ -0,0 +1,458 @@
+package cel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokFloat
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // Punctuation, identifier or the decoded string
+	pos  int
+}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+		case unicode.IsDigit(rune(c)) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			kind := tokInt
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				((src[i] == '-' || src[i] == '+') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				if src[i] == '.' || src[i] == 'e' || src[i] == 'E' {
+					kind = tokFloat
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: kind, text: src[start:i], pos: start})
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, pos: i})
+			i += n
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", "[", "]", "{", "}", ".", ",", ":", "?", "!", "-", "+", "*", "/", "%", "<", ">"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %d: unexpected character %q", i, c)
+			}
+			tokens = append(tokens, token{kind: tokPunct, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// lexString decodes the quoted string src starts with and returns it with
+// the number of bytes it spans
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\\', '"', '\'':
+				b.WriteByte(src[i])
+			default:
+				return "", 0, fmt.Errorf("unknown escape \\%c", src[i])
+			}
+		case c == '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// parser builds the tree of an expression by recursive descent, with the
+// precedence of CEL: ?: then || then && then relations then + - then * / %
+// then unary operators then member access and calls
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the punctuation op if it comes next
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.errorf("expected %q", op)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of expression"
+	}
+	return fmt.Errorf("at %d near %q: %s", t.pos, found, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	then, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &conditional{cond: cond, then: then, otherwise: otherwise}, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseRelation()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseRelation()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseRelation() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		op := t.text
+		switch {
+		case t.kind == tokPunct && (op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">="):
+		case t.kind == tokIdent && op == "in":
+		default:
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokPunct || (op != "+" && op != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokPunct || (op != "*" && op != "/" && op != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negate{operand: operand}, nil
+	}
+	return p.parseMember()
+}
+
+func (p *parser) parseMember() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				p.pos--
+				return nil, p.errorf("expected a field or method name")
+			}
+			if p.accept("(") {
+				args, err := p.parseArgs(")")
+				if err != nil {
+					return nil, err
+				}
+				if n, err = newCall(t.text, n, args); err != nil {
+					return nil, fmt.Errorf("at %d: %w", t.pos, err)
+				}
+				continue
+			}
+			n = &selectField{operand: n, field: t.text}
+		case p.accept("["):
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{operand: n, index: index}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: invalid integer %s", t.pos, t.text)
+		}
+		return &literal{value: v}, nil
+	case tokFloat:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: invalid number %s", t.pos, t.text)
+		}
+		return &literal{value: v}, nil
+	case tokString:
+		return &literal{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null":
+			return &literal{value: nil}, nil
+		}
+		if p.accept("(") {
+			if t.text == "has" {
+				return p.parseHas(t)
+			}
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			n, err := newCall(t.text, nil, args)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", t.pos, err)
+			}
+			return n, nil
+		}
+		if !variables[t.text] {
+			return nil, fmt.Errorf("at %d: undeclared reference to %q", t.pos, t.text)
+		}
+		return &variable{name: t.text}, nil
+	case tokPunct:
+		switch t.text {
+		case "(":
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		case "{":
+			return p.parseMap()
+		}
+	}
+	p.pos--
+	return nil, p.errorf("unexpected token")
+}
+
+// parseHas parses the has(x.field) macro, which tests for a field without
+// failing when it is missing
+func (p *parser) parseHas(t token) (node, error) {
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	sel, ok := arg.(*selectField)
+	if !ok {
+		return nil, fmt.Errorf("at %d: has() takes a field selection such as has(claims.email)", t.pos)
+	}
+	return &hasField{operand: sel.operand, field: sel.field}, nil
+}
+
+// parseArgs parses a comma separated list of expressions up to end
+func (p *parser) parseArgs(end string) ([]node, error) {
+	var args []node
+	if p.accept(end) {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(end) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseMap() (node, error) {
+	m := &mapNode{}
+	if p.accept("}") {
+		return m, nil
+	}
+	for {
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values = append(m.values, value)
+		if p.accept("}") {
+			return m, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
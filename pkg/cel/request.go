@@ -0,0 +1,60 @@
+package cel
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Vars returns the attributes of a request that expressions refer to.
+// Header names are lowercase and repeated headers are joined with commas;
+// query parameters take their first value.
+func Vars(c echo.Context) map[string]any {
+	req := c.Request()
+
+	headers := make(map[string]any, len(req.Header))
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	query := make(map[string]any)
+	for name, values := range c.QueryParams() {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+
+	return map[string]any{
+		"request": map[string]any{
+			"method":  req.Method,
+			"path":    req.URL.Path,
+			"host":    req.Host,
+			"scheme":  c.Scheme(),
+			"ip":      c.RealIP(),
+			"headers": headers,
+			"query":   query,
+		},
+		"claims": claims(c),
+		"now":    time.Now(),
+	}
+}
+
+// claims returns the authenticated client's JWT claims as a map, empty for
+// anonymous requests
+func claims(c echo.Context) map[string]any {
+	m := map[string]any{}
+	user := c.Get("user")
+	if user == nil {
+		return m
+	}
+	if claims, ok := user.(map[string]any); ok {
+		return claims
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(data, &m)
+	return m
+}
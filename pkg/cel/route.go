@@ -0,0 +1,125 @@
+package cel
+
+import (
+	"fmt"
+	"net/http"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Route holds the compiled predicates of a service
+type Route struct {
+	Match  *Program // Requests it is false for are answered 404; nil matches all
+	Canary *Program // Requests it is true for go to the canary; may be nil
+	Policy *Policy  // May be nil
+}
+
+// CompileRoute compiles the predicates of a service, and returns nil if it
+// has none
+func CompileRoute(svc config.ServiceConfig) (*Route, error) {
+	route := &Route{}
+	var err error
+	if svc.Match != "" {
+		if route.Match, err = Compile(svc.Match); err != nil {
+			return nil, fmt.Errorf("match: %w", err)
+		}
+	}
+	if svc.Canary != nil && svc.Canary.Match != "" {
+		if route.Canary, err = Compile(svc.Canary.Match); err != nil {
+			return nil, fmt.Errorf("canary.match: %w", err)
+		}
+	}
+	if len(svc.Policies) > 0 {
+		if route.Policy, err = NewPolicy(svc.Policies); err != nil {
+			return nil, fmt.Errorf("policies: %w", err)
+		}
+	}
+	if route.Match == nil && route.Canary == nil && route.Policy == nil {
+		return nil, nil
+	}
+	return route, nil
+}
+
+// Matches reports whether the request satisfies the program. Requests it
+// fails to evaluate for, for instance because a claim is missing, do not.
+func (p *Program) Matches(c echo.Context) bool {
+	ok, err := p.Test(Vars(c))
+	return err == nil && ok
+}
+
+// Gate answers 404 to the requests the program does not match, as if the
+// route did not exist
+func (p *Program) Gate() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !p.Matches(c) {
+				return echo.NewHTTPError(http.StatusNotFound, "Not Found")
+			}
+			return next(c)
+		}
+	}
+}
+
+// Policy allows or denies requests by the first rule they match
+type Policy struct {
+	rules     []policyRule
+	allowList bool // Requests no rule matches are denied
+}
+
+type policyRule struct {
+	name    string
+	allow   bool
+	when    *Program
+	message string
+}
+
+// NewPolicy compiles authorization rules
+func NewPolicy(rules []config.PolicyConfig) (*Policy, error) {
+	p := &Policy{}
+	for i, r := range rules {
+		when, err := Compile(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+		rule := policyRule{name: r.Name, allow: r.Effect == "allow", when: when, message: r.Message}
+		if rule.message == "" {
+			rule.message = "Forbidden"
+		}
+		p.allowList = p.allowList || rule.allow
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// Authorize returns whether the request is allowed, and the message to deny
+// it with if not. An allow rule that fails to evaluate does not match,
+// while a deny rule that fails to evaluate denies, so errors never grant
+// access.
+func (p *Policy) Authorize(c echo.Context) (bool, string) {
+	vars := Vars(c)
+	for _, rule := range p.rules {
+		ok, err := rule.when.Test(vars)
+		if err != nil {
+			ok = !rule.allow
+		}
+		if !ok {
+			continue
+		}
+		return rule.allow, rule.message
+	}
+	return !p.allowList, "Forbidden"
+}
+
+// Middleware answers 403 to the requests the policy denies
+func (p *Policy) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if allowed, message := p.Authorize(c); !allowed {
+				return echo.NewHTTPError(http.StatusForbidden, message)
+			}
+			return next(c)
+		}
+	}
+}
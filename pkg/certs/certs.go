@@ -0,0 +1,213 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"odin/pkg/config"
+)
+
+// Store holds the gateway's certificates and selects one per TLS handshake
+// based on the server name the client asked for (SNI)
+type Store struct {
+	byName   map[string]*tls.Certificate
+	fallback *tls.Certificate
+}
+
+// NewStore loads the configured certificates. Each certificate serves the
+// domains listed in its configuration, or the DNS names it was issued for.
+// The first certificate is used when no name matches.
+func NewStore(certificates []config.TLSCertificateConfig) (*Store, error) {
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates configured")
+	}
+
+	store := &Store{byName: make(map[string]*tls.Certificate)}
+
+	for _, certConfig := range certificates {
+		cert, err := tls.LoadX509KeyPair(certConfig.CertFile, certConfig.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate %s: %w", certConfig.CertFile, err)
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %s: %w", certConfig.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		domains := certConfig.Domains
+		if len(domains) == 0 {
+			domains = leaf.DNSNames
+		}
+		if len(domains) == 0 && leaf.Subject.CommonName != "" {
+			domains = []string{leaf.Subject.CommonName}
+		}
+
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+			// The first certificate configured for a name wins
+			if _, exists := store.byName[domain]; !exists {
+				store.byName[domain] = &cert
+			}
+		}
+
+		if store.fallback == nil {
+			store.fallback = &cert
+		}
+	}
+
+	return store, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. Exact names are
+// preferred over wildcard names such as *.example.com.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	if name != "" {
+		if cert, ok := s.byName[name]; ok {
+			return cert, nil
+		}
+		if dot := strings.Index(name, "."); dot > 0 {
+			if cert, ok := s.byName["*"+name[dot:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+
+	return s.fallback, nil
+}
+
+// Names returns the server names the store has certificates for
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.byName))
+	for name := range s.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Source supplies certificates obtained at runtime, such as from ACME. It
+// returns a nil certificate when it has none for the requested name.
+type Source interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// NewTLSConfig builds the server TLS configuration. Certificates from managed
+// are preferred; those from files, usually a Store or Reloader of the
+// configured certificates, serve every other name. Either may be nil, but
+// not both.
+func NewTLSConfig(cfg config.ServerTLSConfig, files, managed Source) (*tls.Config, error) {
+	if files == nil && managed == nil {
+		return nil, fmt.Errorf("no certificates configured")
+	}
+
+	var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	if files != nil {
+		getCertificate = files.GetCertificate
+	}
+	if managed != nil {
+		getCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := managed.GetCertificate(hello)
+			if err != nil || cert != nil {
+				return cert, err
+			}
+			if files == nil {
+				return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+			}
+			return files.GetCertificate(hello)
+		}
+	}
+
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherSuites, err := ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	// Client certificates are only identified by fingerprint, so they are
+	// requested but not verified against a CA
+	if cfg.ClientAuth == "request" {
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	}
+	return tlsConfig, nil
+}
+
+// ParseVersion converts "1.0" through "1.3" to a TLS version. An empty
+// value defaults to TLS 1.2.
+func ParseVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q (expected 1.0, 1.1, 1.2 or 1.3)", version)
+}
+
+// ParseCipherSuites converts IANA cipher suite names such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 to their IDs. Suites Go considers
+// insecure are rejected. Cipher suites only apply up to TLS 1.2; TLS 1.3
+// suites are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// RedirectHandler permanently redirects plaintext requests to HTTPS on httpsPort
+func RedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			// IPv6 literal
+			host = "[" + host + "]"
+		}
+		if httpsPort != 443 {
+			host += ":" + strconv.Itoa(httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,133 @@
+package certs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate as lowercase
+// hex, the form API keys are pinned with
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint brings a fingerprint as printed by common tools,
+// e.g. "SHA256:AB:CD:..." from openssl, into the form Fingerprint returns
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256:")
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256 fingerprint=")
+	return strings.ReplaceAll(fingerprint, ":", "")
+}
+
+// JA3 returns the JA3 fingerprint of a ClientHello: the MD5 of the client's
+// version, cipher suites, extensions, curves and point formats. GREASE
+// values are ignored.
+//
+// The legacy version field is not exposed by crypto/tls. Clients offering
+// TLS 1.3 send 1.2 there, so the highest supported version is capped at 1.2,
+// which gives the same result for every client that sends supported_versions.
+func JA3(hello *tls.ClientHelloInfo) string {
+	var version uint16
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	if version > tls.VersionTLS12 {
+		version = tls.VersionTLS12
+	}
+
+	curves := make([]uint16, 0, len(hello.SupportedCurves))
+	for _, curve := range hello.SupportedCurves {
+		curves = append(curves, uint16(curve))
+	}
+	points := make([]uint16, 0, len(hello.SupportedPoints))
+	for _, point := range hello.SupportedPoints {
+		points = append(points, uint16(point))
+	}
+
+	fields := []string{
+		strconv.Itoa(int(version)),
+		joinValues(hello.CipherSuites),
+		joinValues(hello.Extensions),
+		joinValues(curves),
+		joinValues(points),
+	}
+	sum := md5.Sum([]byte(strings.Join(fields, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+func joinValues(values []uint16) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// isGREASE reports whether v is one of the reserved values clients insert
+// at random (RFC 8701)
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// FingerprintRecorder remembers the JA3 fingerprint of every open TLS
+// connection so handlers can look it up by the request's remote address
+type FingerprintRecorder struct {
+	mu     sync.RWMutex
+	byAddr map[string]string
+}
+
+// NewFingerprintRecorder creates an empty recorder
+func NewFingerprintRecorder() *FingerprintRecorder {
+	return &FingerprintRecorder{byAddr: make(map[string]string)}
+}
+
+// Attach records the fingerprint of each handshake made with cfg. The
+// server's ConnState must be set to ConnState so entries are released.
+func (f *FingerprintRecorder) Attach(cfg *tls.Config) {
+	previous := cfg.GetConfigForClient
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if hello.Conn != nil {
+			f.mu.Lock()
+			f.byAddr[hello.Conn.RemoteAddr().String()] = JA3(hello)
+			f.mu.Unlock()
+		}
+		if previous != nil {
+			return previous(hello)
+		}
+		return nil, nil
+	}
+}
+
+// ConnState forgets connections once they are closed or hijacked
+func (f *FingerprintRecorder) ConnState(conn net.Conn, state http.ConnState) {
+	if state == http.StateClosed || state == http.StateHijacked {
+		f.mu.Lock()
+		delete(f.byAddr, conn.RemoteAddr().String())
+		f.mu.Unlock()
+	}
+}
+
+// JA3 returns the fingerprint of the connection a request arrived on, or ""
+// for plaintext requests
+func (f *FingerprintRecorder) JA3(r *http.Request) string {
+	if r.TLS == nil {
+		return ""
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.byAddr[r.RemoteAddr]
+}
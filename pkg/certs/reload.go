@@ -0,0 +1,160 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reloader serves the configured certificates and loads them again when
+// their files change, so renewed certificates, including SPIFFE SVIDs
+// rotated on disk, are served without restarting the listener. Handshakes
+// in progress keep the certificate they started with.
+type Reloader struct {
+	certificates []config.TLSCertificateConfig
+	logger       *logrus.Logger
+
+	store atomic.Pointer[Store]
+
+	mu       sync.Mutex
+	stamps   map[string]fileStamp
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader loads the configured certificates
+func NewReloader(certificates []config.TLSCertificateConfig, logger *logrus.Logger) (*Reloader, error) {
+	r := &Reloader{certificates: certificates, logger: logger}
+	stamps := r.stat()
+	store, err := NewStore(certificates)
+	if err != nil {
+		return nil, err
+	}
+	r.store.Store(store)
+	r.stamps = stamps
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate with the certificates
+// loaded last
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.store.Load().GetCertificate(hello)
+}
+
+// Store returns the certificates loaded last
+func (r *Reloader) Store() *Store {
+	return r.store.Load()
+}
+
+// Reload loads the certificates again if any of their files changed and
+// reports whether it did. When the new files cannot be loaded, e.g. because
+// a certificate was replaced but its key not yet, the previous certificates
+// stay in use and the files are tried again on the next call.
+func (r *Reloader) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps := r.stat()
+	if sameStamps(stamps, r.stamps) {
+		return false, nil
+	}
+	store, err := NewStore(r.certificates)
+	if err != nil {
+		return false, err
+	}
+	r.store.Store(store)
+	r.stamps = stamps
+	return true, nil
+}
+
+// stat returns the current version of every certificate and key file.
+// Files that cannot be read are left out, which counts as a change once
+// they are back.
+func (r *Reloader) stat() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, cert := range r.certificates {
+		for _, path := range []string{cert.CertFile, cert.KeyFile} {
+			// Stat follows symlinks, so swapped Kubernetes secret volumes
+			// are noticed too
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
+
+// Start checks the files for changes every interval until Stop is called
+func (r *Reloader) Start(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopChan != nil {
+		return
+	}
+	r.stopChan = make(chan struct{})
+
+	r.wg.Add(1)
+	go r.watch(interval, r.stopChan)
+}
+
+// Stop stops checking for changes
+func (r *Reloader) Stop() {
+	r.mu.Lock()
+	stopChan := r.stopChan
+	r.stopChan = nil
+	r.mu.Unlock()
+
+	if stopChan != nil {
+		close(stopChan)
+		r.wg.Wait()
+	}
+}
+
+func (r *Reloader) watch(interval time.Duration, stopChan chan struct{}) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				r.logger.WithError(err).Warn("Failed to reload TLS certificates, keeping the current ones")
+				continue
+			}
+			if reloaded {
+				r.logger.WithField("names", r.Store().Names()).Info("Reloaded TLS certificates")
+			}
+		}
+	}
+}
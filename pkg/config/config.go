@@ -2,11 +2,19 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpguts"
 	"gopkg.in/yaml.v3"
 )
 
@@ -27,31 +35,201 @@ type Config struct {
 	OpenAPI      OpenAPIConfig      `yaml:"openapi"`
 	MongoDB      MongoDBConfig      `yaml:"mongodb"`
 	AI           AIConfig           `yaml:"ai"`
+	GitOps       GitOpsConfig       `yaml:"gitops"`
+	Events       EventsConfig       `yaml:"events"`
+	Streaming    StreamingConfig    `yaml:"streaming"`
+	IPFilter     IPFilterConfig     `yaml:"ipFilter"`
+	Bot          BotConfig          `yaml:"bot"`
+	Runtime      RuntimeConfig      `yaml:"runtime"`
+	Overload     OverloadConfig     `yaml:"overload"`
+	WebSocket    WebSocketConfig    `yaml:"websocket"`
+	TCP          TCPConfig          `yaml:"tcp"`
+	Portal       PortalConfig       `yaml:"portal"`
+	Products     []ProductConfig    `yaml:"products"`
+	Metering     MeteringConfig     `yaml:"metering"`
+	Consumers    ConsumersConfig    `yaml:"consumers"`
+	Backup       BackupConfig       `yaml:"backup"`
+	ErrorPages   ErrorPagesConfig   `yaml:"errorPages"`
+	Discovery    DiscoveryConfig    `yaml:"discovery"`
+	FeatureFlags FeatureFlagsConfig `yaml:"featureFlags"`
+	Async        AsyncConfig        `yaml:"async"`
+	Scheduler    SchedulerConfig    `yaml:"scheduler"`
+	GeoIP        GeoIPConfig        `yaml:"geoip"`
+	Faults       FaultsConfig       `yaml:"faults"`
 }
 
 type ServerConfig struct {
-	Port            int           `yaml:"port"`
-	Timeout         time.Duration `yaml:"timeout"`
-	ReadTimeout     time.Duration `yaml:"readTimeout"`
-	WriteTimeout    time.Duration `yaml:"writeTimeout"`
-	GracefulTimeout time.Duration `yaml:"gracefulTimeout"`
-	Compression     bool          `yaml:"compression"`
+	Port            int             `yaml:"port"`
+	Timeout         time.Duration   `yaml:"timeout"`
+	ReadTimeout     time.Duration   `yaml:"readTimeout"`
+	WriteTimeout    time.Duration   `yaml:"writeTimeout"`
+	GracefulTimeout time.Duration   `yaml:"gracefulTimeout"`
+	Compression     bool            `yaml:"compression"`
+	TLS             ServerTLSConfig `yaml:"tls"`
+	Limits          RequestLimits   `yaml:"limits"`
+	// CompressionOptions tune response compression when Compression is on
+	CompressionOptions CompressionConfig `yaml:"compressionOptions"`
+	// RequestID sets how requests are identified in logs, traces, plugins
+	// and upstream requests
+	RequestID RequestIDConfig `yaml:"requestId"`
+}
+
+// RequestIDConfig sets the format of request IDs and which inbound IDs are
+// kept. Zero values use the defaults.
+type RequestIDConfig struct {
+	Header          string   `yaml:"header"`                    // default: X-Request-ID
+	Format          string   `yaml:"format"`                    // uuidv4 (default), uuidv7 or ulid
+	Prefix          string   `yaml:"prefix,omitempty"`          // Prepended to generated IDs
+	Trust           string   `yaml:"trust"`                     // Inbound IDs kept from: all (default), none or networks
+	TrustedNetworks []string `yaml:"trustedNetworks,omitempty"` // CIDRs or addresses of the peers trusted with trust: networks
+}
+
+// CompressionConfig selects the encodings responses are compressed with.
+// Clients get the encoding they prefer in Accept-Encoding, ties going to the
+// earliest in Encodings. Zero values use the defaults.
+type CompressionConfig struct {
+	Encodings   []string `yaml:"encodings,omitempty"` // br, zstd and gzip, in order of preference (default: br, zstd, gzip)
+	MinSize     int      `yaml:"minSize"`             // Smaller responses are sent as they are (default: 1024 bytes)
+	GzipLevel   int      `yaml:"gzipLevel"`           // 1-9 (default: 6)
+	BrotliLevel int      `yaml:"brotliLevel"`         // 1-11 (default: 4)
+	ZstdLevel   int      `yaml:"zstdLevel"`           // 1-22 (default: 3)
+}
+
+// RequestLimits bounds request lines and headers. Oversized requests are
+// rejected before any other middleware runs. Zero disables a limit.
+type RequestLimits struct {
+	MaxURLLength   int `yaml:"maxUrlLength"`   // Bytes in the path and query string (414)
+	MaxQueryParams int `yaml:"maxQueryParams"` // Query string parameters (414)
+	MaxHeaderCount int `yaml:"maxHeaderCount"` // Header fields (431)
+	MaxHeaderSize  int `yaml:"maxHeaderSize"`  // Bytes in a single header field, name and value (431)
+	MaxHeaderBytes int `yaml:"maxHeaderBytes"` // Bytes in all header fields (431); also bounds what the server reads
+}
+
+// ServerTLSConfig configures TLS termination at the gateway
+type ServerTLSConfig struct {
+	Enabled        bool                   `yaml:"enabled"`
+	Port           int                    `yaml:"port"`                     // HTTPS port (default: 8443)
+	Certificates   []TLSCertificateConfig `yaml:"certificates"`             // Selected per connection by SNI; the first is the default
+	MinVersion     string                 `yaml:"minVersion,omitempty"`     // 1.0, 1.1, 1.2 (default) or 1.3
+	CipherSuites   []string               `yaml:"cipherSuites,omitempty"`   // IANA names; applies to TLS 1.2 and below
+	RedirectHTTP   bool                   `yaml:"redirectHttp,omitempty"`   // Redirect the plaintext port to HTTPS instead of serving it
+	ClientAuth     string                 `yaml:"clientAuth,omitempty"`     // none (default) or request; request asks clients for a certificate that API keys can be pinned to and services can require
+	ReloadInterval time.Duration          `yaml:"reloadInterval,omitempty"` // How often certificate files are checked for changes (default: 30s)
+	ACME           ACMEConfig             `yaml:"acme"`
+}
+
+// ACMEConfig configures automatic certificates from an ACME CA such as Let's Encrypt
+type ACMEConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Email        string        `yaml:"email"`                  // Account contact for expiry notices
+	AcceptTOS    bool          `yaml:"acceptTos"`              // Must be true to register an account
+	DirectoryURL string        `yaml:"directoryUrl,omitempty"` // default: Let's Encrypt production
+	Domains      []string      `yaml:"domains"`                // One certificate per domain; wildcards require dns-01
+	Challenge    string        `yaml:"challenge"`              // http-01 (default) or dns-01
+	Storage      string        `yaml:"storage"`                // disk (default) or mongodb
+	StorageDir   string        `yaml:"storageDir,omitempty"`   // default: data/acme
+	RenewBefore  time.Duration `yaml:"renewBefore,omitempty"`  // default: 720h (30 days)
+	DNS          ACMEDNSConfig `yaml:"dns,omitempty"`
+}
+
+// ACMEDNSConfig configures the DNS provider used for dns-01 challenges
+type ACMEDNSConfig struct {
+	Provider         string        `yaml:"provider"`                   // webhook or cloudflare
+	WebhookURL       string        `yaml:"webhookUrl,omitempty"`       // Base URL receiving /present and /cleanup calls
+	WebhookSecret    string        `yaml:"webhookSecret,omitempty"`    // Sent as a bearer token to the webhook
+	APIToken         string        `yaml:"apiToken,omitempty"`         // Cloudflare API token with DNS edit permission
+	PropagationDelay time.Duration `yaml:"propagationDelay,omitempty"` // Wait after creating the record (default: 30s)
+}
+
+// TLSCertificateConfig is a certificate and the domains it serves
+type TLSCertificateConfig struct {
+	CertFile string   `yaml:"certFile"`
+	KeyFile  string   `yaml:"keyFile"`
+	Domains  []string `yaml:"domains,omitempty"` // Exact or wildcard names; default: the certificate's DNS names
 }
 
 type LoggingConfig struct {
-	Level string `yaml:"level"`
-	JSON  bool   `yaml:"json"`
+	Level     string `yaml:"level"`
+	JSON      bool   `yaml:"json"`
+	AccessLog string `yaml:"accessLog"` // default, fast (allocation-free, for high QPS) or off
 }
 
 type AuthConfig struct {
-	JWTSecret         string        `yaml:"jwtSecret"`
-	AccessTokenTTL    time.Duration `yaml:"accessTokenTTL"`
-	RefreshTokenTTL   time.Duration `yaml:"refreshTokenTTL"`
-	IgnorePathRegexes []string      `yaml:"ignorePathRegexes"`
+	JWTSecret         string           `yaml:"jwtSecret"`
+	AccessTokenTTL    time.Duration    `yaml:"accessTokenTTL"`
+	RefreshTokenTTL   time.Duration    `yaml:"refreshTokenTTL"`
+	IgnorePathRegexes []string         `yaml:"ignorePathRegexes"`
+	APIKeyHeader      string           `yaml:"apiKeyHeader,omitempty"` // Header carrying API keys (default: X-API-Key); keys are looked up in MongoDB
+	Revocation        RevocationConfig `yaml:"revocation,omitempty"`
+	// OpenID Connect providers services may authenticate clients with
+	// instead of the JWT secret, see auth.provider of services
+	OIDC []OIDCProviderConfig `yaml:"oidc,omitempty"`
+	HMAC HMACConfig           `yaml:"hmac,omitempty"` // How services with auth.provider: hmac verify signed requests
+}
+
+// HMACConfig verifies requests signed with a secret of their consumer, for
+// clients such as webhook senders that cannot use JWTs
+type HMACConfig struct {
+	SignatureHeader string        `yaml:"signatureHeader,omitempty"` // <algorithm>=<hex HMAC> (default: X-Signature)
+	TimestampHeader string        `yaml:"timestampHeader,omitempty"` // Unix seconds the request was signed at (default: X-Timestamp)
+	KeyIDHeader     string        `yaml:"keyIdHeader,omitempty"`     // ID of the consumer's secret (default: X-Key-ID)
+	Algorithm       string        `yaml:"algorithm,omitempty"`       // sha256 (default), sha384 or sha512
+	ClockSkew       time.Duration `yaml:"clockSkew,omitempty"`       // How far timestamps may be from the gateway's clock (default: 5m)
+	MaxBodySize     int64         `yaml:"maxBodySize,omitempty"`     // Largest body verified, in bytes (default: 10MB)
+}
+
+// OIDCProviderConfig validates access tokens of an OpenID Connect provider.
+// Its signing keys are discovered from the issuer and refreshed as the
+// provider rotates them.
+type OIDCProviderConfig struct {
+	Name            string        `yaml:"name"`                      // What services refer to in auth.provider
+	Issuer          string        `yaml:"issuer"`                    // Tokens must carry it as iss; keys are discovered from its /.well-known/openid-configuration
+	JWKSURL         string        `yaml:"jwksUrl,omitempty"`         // Fetch the keys from here instead of discovering them
+	Audience        []string      `yaml:"audience,omitempty"`        // Tokens must be meant for one of these (default: not checked)
+	Scopes          []string      `yaml:"scopes,omitempty"`          // Scopes every token must carry
+	RefreshInterval time.Duration `yaml:"refreshInterval,omitempty"` // How often the keys are fetched again (default: 1h)
+}
+
+// RevocationConfig rejects revoked JWTs, subjects and API keys before they
+// expire. Revocations are kept in a store shared by the gateways, each of
+// which keeps a copy it refreshes.
+type RevocationConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Store            string        `yaml:"store,omitempty"`            // memory (default), mongodb or redis
+	RedisURL         string        `yaml:"redisUrl,omitempty"`         // For the redis store
+	SyncInterval     time.Duration `yaml:"syncInterval,omitempty"`     // How often the copy is refreshed from the store (default: 10s)
+	MaxTokenLifetime time.Duration `yaml:"maxTokenLifetime,omitempty"` // How long token and subject revocations are kept (default: accessTokenTTL, or 24h)
 }
 
 type AdminConfig struct {
-	Enabled  bool   `yaml:"enabled"`
+	Enabled        bool                   `yaml:"enabled"`
+	Username       string                 `yaml:"username"`
+	Password       string                 `yaml:"password"`
+	Namespaces     []AdminNamespaceConfig `yaml:"namespaces"`
+	Tokens         []AdminTokenConfig     `yaml:"tokens,omitempty"` // Bearer tokens for the admin API, e.g. for odinctl
+	Sessions       AdminSessionsConfig    `yaml:"sessions,omitempty"`
+	RequireIfMatch bool                   `yaml:"requireIfMatch,omitempty"` // Declarative changes to existing resources need If-Match
+	BasicAuth      bool                   `yaml:"basicAuth,omitempty"`      // Accept username and password on every request, not only at sign-in
+}
+
+// AdminSessionsConfig sets the lifetimes of the tokens of admin sessions,
+// which sign-ins start when MongoDB keeps their refresh tokens
+type AdminSessionsConfig struct {
+	AccessTokenTTL  time.Duration `yaml:"accessTokenTTL,omitempty"`  // default: 15m
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTTL,omitempty"` // default: 7d
+}
+
+// AdminTokenConfig is a bearer token with full admin access, stored as the
+// hex SHA-256 of the token so the configuration does not reveal it
+type AdminTokenConfig struct {
+	Name   string `yaml:"name"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// AdminNamespaceConfig delegates the administration of a namespace: its
+// credentials manage the MongoDB services of that namespace and nothing else
+type AdminNamespaceConfig struct {
+	Name     string `yaml:"name"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 }
@@ -67,14 +245,19 @@ type PluginConfig struct {
 	Path    string                 `yaml:"path"`
 	Enabled bool                   `yaml:"enabled"`
 	Config  map[string]interface{} `yaml:"config"`
-	Hooks   []string               `yaml:"hooks"` // pre-request, post-request, pre-response, post-response
+	Hooks   []string               `yaml:"hooks"`          // pre-request, post-request, pre-response, post-response
+	Flag    string                 `yaml:"flag,omitempty"` // The plugin only runs for requests this feature flag is on for
 }
 
+// RateLimitConfig limits the requests of every API key, user or client IP.
+// Limits are kept in Redis when redisUrl is set, unless the strategy is
+// local, so that every gateway sharing it enforces the same limits.
 type RateLimitConfig struct {
 	Enabled  bool          `yaml:"enabled"`
-	Limit    int           `yaml:"limit"`
-	Duration time.Duration `yaml:"duration"`
-	Strategy string        `yaml:"strategy"`
+	Limit    int           `yaml:"limit"`           // Requests per duration (default: 100)
+	Duration time.Duration `yaml:"duration"`        // default: 1m
+	Strategy string        `yaml:"strategy"`        // sliding-window (default), token-bucket or fixed-window; local and redis mean sliding-window
+	Burst    int           `yaml:"burst,omitempty"` // Requests a token bucket lets through at once (default: limit)
 	RedisURL string        `yaml:"redisUrl"`
 }
 
@@ -87,19 +270,97 @@ type CacheConfig struct {
 }
 
 type MonitoringConfig struct {
-	Enabled    bool   `yaml:"enabled"`
-	Path       string `yaml:"path"`
-	WebhookURL string `yaml:"webhookUrl,omitempty"` // Optional webhook for health alerts
+	Enabled    bool                `yaml:"enabled"`
+	Path       string              `yaml:"path"`
+	WebhookURL string              `yaml:"webhookUrl,omitempty"` // Optional webhook for health alerts
+	Alerts     AlertChannelsConfig `yaml:"alerts,omitempty"`
+	History    HealthHistoryConfig `yaml:"history,omitempty"`
+	Probes     ProbesConfig        `yaml:"probes,omitempty"`
+}
+
+// ProbesConfig configures the liveness and readiness endpoints, e.g. for
+// Kubernetes probes. The gateway is ready once its routes are registered,
+// the enabled dependencies are reachable and every critical service has
+// enough healthy targets.
+type ProbesConfig struct {
+	LivenessPath       string                  `yaml:"livenessPath,omitempty"`       // default: /live
+	ReadinessPath      string                  `yaml:"readinessPath,omitempty"`      // default: /ready
+	Timeout            time.Duration           `yaml:"timeout,omitempty"`            // Time allowed for the readiness checks (default: 2s)
+	IgnoreDependencies []string                `yaml:"ignoreDependencies,omitempty"` // mongodb, cache or rateLimit
+	CriticalServices   []CriticalServiceConfig `yaml:"criticalServices,omitempty"`
+}
+
+// CriticalServiceConfig keeps the gateway unready while a service has fewer
+// healthy targets than required
+type CriticalServiceConfig struct {
+	Name              string `yaml:"name"`
+	MinHealthyTargets int    `yaml:"minHealthyTargets,omitempty"` // default: 1
+}
+
+// HealthHistoryConfig keeps the results of target health checks in MongoDB
+// for uptime and latency charts. Checks are aggregated per target into one
+// record per resolution to bound the volume.
+type HealthHistoryConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Resolution time.Duration `yaml:"resolution,omitempty"` // Length of the period checks are aggregated over (default: 1m)
+	Retention  time.Duration `yaml:"retention,omitempty"`  // How long records are kept (default: 168h)
+}
+
+// AlertChannelsConfig configures native notification channels for health alerts
+type AlertChannelsConfig struct {
+	Slack     []SlackAlertConfig     `yaml:"slack,omitempty"`
+	Teams     []TeamsAlertConfig     `yaml:"teams,omitempty"`
+	PagerDuty []PagerDutyAlertConfig `yaml:"pagerduty,omitempty"`
+}
+
+// AlertRouting selects which alerts a channel receives
+type AlertRouting struct {
+	Severities   []string `yaml:"severities,omitempty"`   // info, warning, critical; empty receives all
+	SkipResolved bool     `yaml:"skipResolved,omitempty"` // Do not send recovery notifications
+}
+
+type SlackAlertConfig struct {
+	Name         string `yaml:"name"`
+	WebhookURL   string `yaml:"webhookUrl"`
+	Channel      string `yaml:"channel,omitempty"` // Overrides the webhook's default channel
+	Username     string `yaml:"username,omitempty"`
+	AlertRouting `yaml:",inline"`
+}
+
+type TeamsAlertConfig struct {
+	Name         string `yaml:"name"`
+	WebhookURL   string `yaml:"webhookUrl"`
+	AlertRouting `yaml:",inline"`
+}
+
+type PagerDutyAlertConfig struct {
+	Name         string `yaml:"name"`
+	RoutingKey   string `yaml:"routingKey"`          // Events API v2 integration key
+	Source       string `yaml:"source,omitempty"`    // default: odin-gateway
+	EventsURL    string `yaml:"eventsUrl,omitempty"` // default: https://events.pagerduty.com/v2/enqueue
+	AlertRouting `yaml:",inline"`
 }
 
 type TracingConfig struct {
-	Enabled        bool    `yaml:"enabled"`
-	ServiceName    string  `yaml:"serviceName"`
-	ServiceVersion string  `yaml:"serviceVersion"`
-	Environment    string  `yaml:"environment"`
-	Endpoint       string  `yaml:"endpoint"`
-	SampleRate     float64 `yaml:"sampleRate"`
-	Insecure       bool    `yaml:"insecure"`
+	Enabled        bool              `yaml:"enabled"`
+	ServiceName    string            `yaml:"serviceName"`
+	ServiceVersion string            `yaml:"serviceVersion"`
+	Environment    string            `yaml:"environment"`
+	Endpoint       string            `yaml:"endpoint"`
+	SampleRate     float64           `yaml:"sampleRate"`
+	Insecure       bool              `yaml:"insecure"`
+	Logs           TracingLogsConfig `yaml:"logs"`
+}
+
+// TracingLogsConfig exports the gateway's logs over OTLP/HTTP, with the
+// resource of its traces and the IDs of the spans they were written in
+type TracingLogsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Endpoint      string        `yaml:"endpoint,omitempty"`      // OTLP/HTTP logs URL (default: the tracing endpoint with /v1/logs)
+	Level         string        `yaml:"level,omitempty"`         // Least severe level exported (default: info)
+	BatchSize     int           `yaml:"batchSize,omitempty"`     // Records per export (default: 512)
+	FlushInterval time.Duration `yaml:"flushInterval,omitempty"` // Longest a record waits for export (default: 5s)
+	QueueSize     int           `yaml:"queueSize,omitempty"`     // Records waiting for export before new ones are dropped (default: 4096)
 }
 
 type ServiceMeshConfig struct {
@@ -212,14 +473,17 @@ type ClusterTLS struct {
 }
 
 type OpenAPIConfig struct {
-	Enabled      bool   `yaml:"enabled"`
-	Title        string `yaml:"title"`
-	Version      string `yaml:"version"`
-	Description  string `yaml:"description"`
-	AutoGenerate bool   `yaml:"autoGenerate"`
-	OutputPath   string `yaml:"outputPath"`
-	UIEnabled    bool   `yaml:"uiEnabled"`
-	UIPath       string `yaml:"uiPath"`
+	Enabled      bool     `yaml:"enabled"`
+	Title        string   `yaml:"title"`
+	Version      string   `yaml:"version"`
+	Description  string   `yaml:"description"`
+	AutoGenerate bool     `yaml:"autoGenerate"`
+	OutputPath   string   `yaml:"outputPath"`
+	UIEnabled    bool     `yaml:"uiEnabled"`             // Serve documentation of the services at UIPath
+	UIPath       string   `yaml:"uiPath"`                // default: /docs
+	UIRenderer   string   `yaml:"uiRenderer,omitempty"`  // swagger (default) or redoc
+	UIAssetsURL  string   `yaml:"uiAssetsUrl,omitempty"` // Where the renderer's scripts are loaded from (default: a public CDN)
+	UIServices   []string `yaml:"uiServices,omitempty"`  // Services documented (default: all HTTP services)
 }
 
 type MongoDBConfig struct {
@@ -231,6 +495,7 @@ type MongoDBConfig struct {
 	ConnectTimeout time.Duration `yaml:"connectTimeout"`
 	Auth           MongoDBAuth   `yaml:"auth"`
 	TLS            MongoDBTLS    `yaml:"tls"`
+	RouteServices  bool          `yaml:"routeServices,omitempty"` // Route the enabled services stored in MongoDB, managed live through /admin/api/services
 }
 
 type MongoDBAuth struct {
@@ -263,28 +528,764 @@ type AIConfig struct {
 	Tags                  map[string]string `yaml:"tags"`
 }
 
+// GitOpsConfig configures syncing declarative configuration from a Git repository
+type GitOpsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Repository    string        `yaml:"repository"`    // Clone URL (https or ssh)
+	Branch        string        `yaml:"branch"`        // default: main
+	Path          string        `yaml:"path"`          // Directory inside the repository holding the YAML files
+	Directory     string        `yaml:"directory"`     // Local checkout directory (default: data/gitops)
+	Interval      time.Duration `yaml:"interval"`      // Poll interval (default: 1m, 0 disables polling when a webhook is used)
+	WebhookSecret string        `yaml:"webhookSecret"` // HMAC secret for push webhooks
+	Username      string        `yaml:"username,omitempty"`
+	Token         string        `yaml:"token,omitempty"`
+	SSHKeyFile    string        `yaml:"sshKeyFile,omitempty"`
+}
+
+// EventsConfig configures delivery of gateway lifecycle events to webhooks
+type EventsConfig struct {
+	Enabled   bool                 `yaml:"enabled"`
+	QueueSize int                  `yaml:"queueSize"` // Buffered events before new ones are dropped (default: 1000)
+	Workers   int                  `yaml:"workers"`   // Concurrent delivery workers (default: 2)
+	Webhooks  []EventWebhookConfig `yaml:"webhooks"`
+}
+
+// EventWebhookConfig describes a single webhook subscription
+type EventWebhookConfig struct {
+	Name         string            `yaml:"name"`
+	URL          string            `yaml:"url"`
+	Secret       string            `yaml:"secret"`       // HMAC-SHA256 signing secret
+	Events       []string          `yaml:"events"`       // Event types or prefixes like "service.*"; empty subscribes to all
+	Headers      map[string]string `yaml:"headers"`      // Extra headers sent with every delivery
+	Timeout      time.Duration     `yaml:"timeout"`      // default: 10s
+	MaxRetries   int               `yaml:"maxRetries"`   // default: 3
+	RetryBackoff time.Duration     `yaml:"retryBackoff"` // Initial backoff, doubled per attempt (default: 1s)
+}
+
+// StreamingConfig configures publishing access and audit records to a message bus
+type StreamingConfig struct {
+	Enabled       bool                 `yaml:"enabled"`
+	Backend       string               `yaml:"backend"` // kafka or nats
+	Schema        string               `yaml:"schema"`  // json (default) or cloudevents
+	AccessTopic   string               `yaml:"accessTopic"`
+	AuditTopic    string               `yaml:"auditTopic"`
+	BatchSize     int                  `yaml:"batchSize"`     // Records per publish call (default: 100)
+	FlushInterval time.Duration        `yaml:"flushInterval"` // Maximum time a record waits in a batch (default: 1s)
+	BufferSize    int                  `yaml:"bufferSize"`    // Records buffered before new ones are dropped (default: 10000)
+	Kafka         StreamingKafkaConfig `yaml:"kafka"`
+	NATS          StreamingNATSConfig  `yaml:"nats"`
+}
+
+// StreamingKafkaConfig configures publishing through a Kafka REST Proxy
+type StreamingKafkaConfig struct {
+	RestProxyURL string        `yaml:"restProxyUrl"`
+	Username     string        `yaml:"username,omitempty"`
+	Password     string        `yaml:"password,omitempty"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+// StreamingNATSConfig configures the NATS connection
+type StreamingNATSConfig struct {
+	URL      string        `yaml:"url"` // nats://host:4222 or tls://host:4222
+	Token    string        `yaml:"token,omitempty"`
+	Username string        `yaml:"username,omitempty"`
+	Password string        `yaml:"password,omitempty"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// IPFilterConfig configures client IP allow/deny lists
+type IPFilterConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Allow          []string `yaml:"allow,omitempty"`          // CIDRs or addresses; when set, only these clients are admitted
+	Deny           []string `yaml:"deny,omitempty"`           // CIDRs or addresses that are always rejected
+	TrustedProxies []string `yaml:"trustedProxies,omitempty"` // Proxies whose X-Forwarded-For header is honoured
+}
+
+// RuntimeConfig adapts the Go runtime to the CPU and memory limits of the
+// container the gateway runs in. The GOMAXPROCS and GOMEMLIMIT environment
+// variables take precedence over these settings.
+type RuntimeConfig struct {
+	MaxProcs         int     `yaml:"maxProcs"`         // Override GOMAXPROCS (default: derived from the CPU limit)
+	MemoryLimit      string  `yaml:"memoryLimit"`      // Soft memory limit, e.g. 1536MiB, or "off" (default: memoryLimitRatio of the cgroup limit)
+	MemoryLimitRatio float64 `yaml:"memoryLimitRatio"` // Share of the cgroup memory limit used without memoryLimit (default: 0.9)
+}
+
+// memoryUnits are the suffixes GOMEMLIMIT accepts
+var memoryUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// MemoryLimitBytes parses MemoryLimit in the format of GOMEMLIMIT. It
+// returns 0 when no limit is configured and -1 when it is turned off.
+func (r RuntimeConfig) MemoryLimitBytes() (int64, error) {
+	value := strings.TrimSpace(r.MemoryLimit)
+	switch value {
+	case "":
+		return 0, nil
+	case "off":
+		return -1, nil
+	}
+
+	factor := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, factor = strings.TrimSuffix(value, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 || n > (1<<63-1)/factor {
+		return 0, fmt.Errorf("invalid memory limit %q", r.MemoryLimit)
+	}
+	return n * factor, nil
+}
+
+// OverloadConfig bounds how many service requests are proxied at once.
+// Requests beyond that wait in a queue; when the queue delay stays above
+// targetDelay the gateway sheds load with 503 and Retry-After, dropping the
+// lowest priority requests first.
+type OverloadConfig struct {
+	Enabled       bool            `yaml:"enabled"`
+	MaxConcurrent int             `yaml:"maxConcurrent"`     // Requests proxied at once (default: 1000)
+	MaxQueue      int             `yaml:"maxQueue"`          // Requests waiting for a slot (default: maxConcurrent)
+	MaxQueueTime  time.Duration   `yaml:"maxQueueTime"`      // Longest wait while the queue is healthy (default: 1s)
+	TargetDelay   time.Duration   `yaml:"targetDelay"`       // Queue delay considered healthy (default: 10ms)
+	Interval      time.Duration   `yaml:"interval"`          // How long the delay may exceed targetDelay before shedding (default: 100ms)
+	RetryAfter    time.Duration   `yaml:"retryAfter"`        // Sent with 503 responses (default: 1s)
+	Classes       []OverloadClass `yaml:"classes,omitempty"` // Request priorities, first match wins
+}
+
+// OverloadClass assigns a priority to matching requests. Unmatched requests
+// have priority 0; higher priorities are admitted first and shed last.
+type OverloadClass struct {
+	Name        string   `yaml:"name"`
+	Priority    int      `yaml:"priority"`
+	Services    []string `yaml:"services,omitempty"`
+	Paths       []string `yaml:"paths,omitempty"` // Path prefixes
+	Methods     []string `yaml:"methods,omitempty"`
+	Header      string   `yaml:"header,omitempty"` // Matches when present, or equal to headerValue if set
+	HeaderValue string   `yaml:"headerValue,omitempty"`
+}
+
+// WebSocketConfig enables WebSocket proxying to HTTP services and bounds the
+// connections the gateway holds open, including those of websocket services.
+// Connection limits of 0 mean no limit.
+type WebSocketConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	MaxConnections      int           `yaml:"maxConnections"`      // Open connections across all services
+	MaxConnectionsPerIP int           `yaml:"maxConnectionsPerIP"` // Open connections per client address across all services
+	MaxMessageSize      int64         `yaml:"maxMessageSize"`      // Largest message in bytes, in either direction (default: 512KB)
+	IdleTimeout         time.Duration `yaml:"idleTimeout"`         // Close connections without messages for this long (default: 5m)
+}
+
+// ServiceWebSocketConfig sets a service's own WebSocket limits. Unset
+// message size and idle timeout fall back to the global settings.
+type ServiceWebSocketConfig struct {
+	MaxConnections      int           `yaml:"maxConnections,omitempty"`      // Open connections to this service
+	MaxConnectionsPerIP int           `yaml:"maxConnectionsPerIP,omitempty"` // Open connections to this service per client address
+	MaxMessageSize      int64         `yaml:"maxMessageSize,omitempty"`
+	IdleTimeout         time.Duration `yaml:"idleTimeout,omitempty"`
+}
+
+// FeatureFlagsConfig defines flags evaluated per request to toggle routes,
+// canary weights and plugins. Flags in File override those defined here and
+// are reloaded when the file changes.
+type FeatureFlagsConfig struct {
+	File         string                       `yaml:"file,omitempty"`         // YAML file with a flags map
+	PollInterval time.Duration                `yaml:"pollInterval,omitempty"` // How often File is checked for changes (default: 10s)
+	Flags        map[string]FeatureFlagConfig `yaml:"flags,omitempty"`
+}
+
+// FeatureFlagConfig is a boolean or numeric flag. The value of the first
+// rule matching a request wins, Default otherwise.
+type FeatureFlagConfig struct {
+	Default any              `yaml:"default"`
+	Rules   []FlagRuleConfig `yaml:"rules,omitempty"`
+}
+
+// FlagRuleConfig matches requests by a header or JWT claim. Percentage
+// matches a stable share of the values, or of client IPs when neither is
+// set.
+type FlagRuleConfig struct {
+	Header     string   `yaml:"header,omitempty"`
+	Claim      string   `yaml:"claim,omitempty"`
+	Values     []string `yaml:"values,omitempty"`     // Any value when empty
+	Percentage *int     `yaml:"percentage,omitempty"` // 0-100
+	Value      any      `yaml:"value"`
+}
+
+// DiscoveryConfig sets how dns:// and dns+srv:// service targets are
+// resolved. Records are looked up again when their TTL expires, but no
+// sooner than minRefresh and no later than maxRefresh.
+type DiscoveryConfig struct {
+	Nameservers []string      `yaml:"nameservers,omitempty"` // host:port; default: the nameservers in /etc/resolv.conf
+	Timeout     time.Duration `yaml:"timeout,omitempty"`     // Per lookup (default: 2s)
+	MinRefresh  time.Duration `yaml:"minRefresh,omitempty"`  // Also the retry interval after failed lookups (default: 5s)
+	MaxRefresh  time.Duration `yaml:"maxRefresh,omitempty"`  // default: 5m
+}
+
+// TCPConfig configures layer-4 proxying of raw TCP connections, for
+// backends that do not speak HTTP
+type TCPConfig struct {
+	Listeners []TCPListenerConfig `yaml:"listeners"`
+}
+
+// TCPListenerConfig forwards the connections accepted on one port to a pool
+// of targets. Health checks open a TCP connection to each target; only
+// interval, timeout and the thresholds of HealthCheckConfig apply.
+//
+// In tls-passthrough mode, connections are routed by the server name (SNI)
+// the client sends in its TLS ClientHello, without terminating TLS. Targets
+// then receive connections matching no route, if any.
+type TCPListenerConfig struct {
+	Name               string             `yaml:"name"`
+	Port               int                `yaml:"port"`
+	Mode               string             `yaml:"mode"`                  // tcp or tls-passthrough (default: tcp)
+	Targets            []string           `yaml:"targets"`               // host:port
+	Routes             []TLSRouteConfig   `yaml:"routes,omitempty"`      // SNI routes of a tls-passthrough listener
+	LoadBalancing      string             `yaml:"loadBalancing"`         // round-robin, random or least-connections (default: round-robin)
+	ConnectTimeout     time.Duration      `yaml:"connectTimeout"`        // Timeout for connecting to a target (default: 5s)
+	ClientHelloTimeout time.Duration      `yaml:"clientHelloTimeout"`    // Time allowed for the ClientHello in tls-passthrough mode (default: 10s)
+	IdleTimeout        time.Duration      `yaml:"idleTimeout"`           // Close connections without traffic for this long; 0 never does
+	MaxConnections     int                `yaml:"maxConnections"`        // Open connections; 0 for no limit
+	HealthCheck        *HealthCheckConfig `yaml:"healthCheck,omitempty"` // Checks the targets of every route too
+}
+
+// TLSRouteConfig sends TLS connections for some server names to a pool of
+// targets, which terminate TLS themselves
+type TLSRouteConfig struct {
+	ServerNames   []string `yaml:"serverNames"`   // Exact names, or *.example.com for one label below example.com
+	Targets       []string `yaml:"targets"`       // host:port
+	LoadBalancing string   `yaml:"loadBalancing"` // Defaults to the listener's
+}
+
+// PortalConfig configures the developer portal API, where developers sign
+// up, browse the products on offer and manage their own API keys. Users and
+// keys are kept in MongoDB.
+type PortalConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	Path              string        `yaml:"path"`                   // default: /portal
+	AllowRegistration bool          `yaml:"allowRegistration"`      // Let anyone sign up; otherwise accounts are created by an admin
+	TokenTTL          time.Duration `yaml:"tokenTTL"`               // Lifetime of portal session tokens (default: 24h)
+	MaxKeysPerUser    int           `yaml:"maxKeysPerUser"`         // default: 10
+	DefaultPlans      []string      `yaml:"defaultPlans,omitempty"` // Plans every developer is entitled to, as product/plan
+	RequireApproval   bool          `yaml:"requireApproval"`        // Keys of every plan stay pending until an admin approves them
+}
+
+// ProductConfig bundles services that are offered together under a set of
+// plans, such as free, pro and enterprise
+type ProductConfig struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description,omitempty"`
+	Services    []string     `yaml:"services"`
+	Plans       []PlanConfig `yaml:"plans"`
+}
+
+// PlanConfig sets the limits of the API keys subscribed to a plan. Keys of
+// a plan are only accepted by the services of its product.
+type PlanConfig struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description,omitempty"`
+	RateLimit   int           `yaml:"rateLimit,omitempty"`   // Requests per minute per key; 0 for no limit
+	Quota       int           `yaml:"quota,omitempty"`       // Requests per quota period per key; 0 for no quota
+	QuotaPeriod string        `yaml:"quotaPeriod,omitempty"` // day or month, in UTC (default: month)
+	KeyTTL      time.Duration `yaml:"keyTTL,omitempty"`      // Keys created in the portal expire this long after they are created; 0 never
+	// Keys created in the portal stay pending until an admin approves them
+	RequireApproval bool `yaml:"requireApproval,omitempty"`
+}
+
+// MeteringConfig configures usage metering for billing. Requests and bytes
+// per API key and service are aggregated into usage records, one per period,
+// kept in MongoDB.
+type MeteringConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Period    time.Duration `yaml:"period"`              // Length of a usage record's period; must divide a day (default: 1h)
+	Retention time.Duration `yaml:"retention,omitempty"` // How long records are kept; 0 keeps them forever
+}
+
+// ConsumersConfig enables consumers: clients of the gateway, kept in
+// MongoDB, that group credentials and carry their own rate limit, allowed
+// services and upstream headers
+type ConsumersConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	RefreshInterval time.Duration `yaml:"refreshInterval,omitempty"` // How often consumers are reloaded from MongoDB (default: 30s)
+}
+
+// ErrorPagesConfig renders the errors the gateway generates itself on
+// service routes, such as a 502 when no target answers, a 401 or 403 from
+// authentication or a 429 from rate limiting. Templates are Go templates
+// keyed by status code ("502"), status class ("4xx") or "default", and can
+// use .Status, .StatusText, .Message, .RequestID, .Service, .Method, .Path
+// and .Time. JSON templates can quote values with the json function, as in
+// {"error": {{json .Message}}}; HTML templates escape them automatically.
+type ErrorPagesConfig struct {
+	Format    string            `yaml:"format,omitempty"`    // json (default) or html
+	Templates map[string]string `yaml:"templates,omitempty"` // Errors without a template get the built-in page of the format
+}
+
+// BackupConfig schedules snapshots of the active configuration. Snapshots
+// of the config file are written next to the backups taken when the admin
+// UI saves, and are subject to the same retention.
+type BackupConfig struct {
+	Enabled   bool            `yaml:"enabled"`
+	Schedule  string          `yaml:"schedule"`            // Cron expression, @hourly, @daily, @weekly, @monthly or @every <duration> (default: @daily)
+	Directory string          `yaml:"directory,omitempty"` // default: backups next to the config file
+	Sources   []string        `yaml:"sources,omitempty"`   // file and/or mongodb (default: file)
+	MaxCount  int             `yaml:"maxCount,omitempty"`  // Snapshots kept per source; 0 keeps any number
+	MaxAge    time.Duration   `yaml:"maxAge,omitempty"`    // Snapshots older than this are deleted; 0 keeps them forever
+	S3        *BackupS3Config `yaml:"s3,omitempty"`        // Also upload every snapshot
+}
+
+// BackupS3Config uploads backups to S3 or S3-compatible storage such as MinIO
+type BackupS3Config struct {
+	Endpoint        string `yaml:"endpoint,omitempty"` // default: https://s3.<region>.amazonaws.com
+	Region          string `yaml:"region,omitempty"`   // default: us-east-1
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix,omitempty"` // Prepended to object keys, e.g. odin/
+	AccessKeyID     string `yaml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	PathStyle       bool   `yaml:"pathStyle,omitempty"` // Address the bucket in the path instead of the host name, as MinIO expects
+}
+
+// BotConfig configures heuristic bot and scraper mitigation. Each request
+// gets a score from 0 to 100; the highest threshold it reaches picks the action.
+type BotConfig struct {
+	Enabled         bool               `yaml:"enabled"`
+	Thresholds      BotThresholds      `yaml:"thresholds"`
+	Challenge       BotChallengeConfig `yaml:"challenge"`
+	ThrottleRPM     int                `yaml:"throttleRpm"`               // Requests per minute per client once throttled (default: 30)
+	CadenceWindow   time.Duration      `yaml:"cadenceWindow"`             // Window for per-IP request cadence (default: 10s)
+	CadenceLimit    int                `yaml:"cadenceLimit"`              // Requests per window considered automated (default: 20)
+	AllowUserAgents []string           `yaml:"allowUserAgents,omitempty"` // Substrings of user agents that are never scored, e.g. monitoring
+	ExcludePaths    []string           `yaml:"excludePaths,omitempty"`    // Path prefixes that are never scored
+	ExcludeServices []string           `yaml:"excludeServices,omitempty"` // Services the middleware is not applied to
+}
+
+// BotThresholds are the minimum scores for each action. A zero threshold
+// disables the action.
+type BotThresholds struct {
+	Tag       int `yaml:"tag"`       // Forward with an X-Bot-Score header (default: 30)
+	Challenge int `yaml:"challenge"` // Require the challenge cookie or header (default: 50)
+	Throttle  int `yaml:"throttle"`  // Limit to throttleRpm (default: 70)
+	Block     int `yaml:"block"`     // Reject with 403 (default: 90)
+}
+
+// BotChallengeConfig configures the token clients must return to pass a challenge
+type BotChallengeConfig struct {
+	Cookie string        `yaml:"cookie"`           // default: odin_bot_check
+	Header string        `yaml:"header,omitempty"` // Optional header accepted instead of the cookie
+	Secret string        `yaml:"secret,omitempty"` // HMAC key; random per process when empty
+	TTL    time.Duration `yaml:"ttl"`              // Token lifetime (default: 1h)
+}
+
+// IPFilterRules are the allow/deny lists of a single service
+type IPFilterRules struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+}
+
 type ServiceConfig struct {
-	Name           string             `yaml:"name"`
-	BasePath       string             `yaml:"basePath"`
-	Targets        []string           `yaml:"targets"`
-	StripBasePath  bool               `yaml:"stripBasePath"`
-	Timeout        time.Duration      `yaml:"timeout"`
-	RetryCount     int                `yaml:"retryCount"`
-	RetryDelay     time.Duration      `yaml:"retryDelay"`
-	Authentication bool               `yaml:"authentication"`
-	LoadBalancing  string             `yaml:"loadBalancing"`
-	Headers        map[string]string  `yaml:"headers"`
-	Protocol       string             `yaml:"protocol"` // http, graphql, grpc
-	Transform      TransformConfig    `yaml:"transform"`
-	Aggregation    *AggregationConfig `yaml:"aggregation,omitempty"`
-	GraphQL        *GraphQLConfig     `yaml:"graphql,omitempty"`
-	GRPC           *GRPCConfig        `yaml:"grpc,omitempty"`
-	HealthCheck    *HealthCheckConfig `yaml:"healthCheck,omitempty"`
+	Name           string                  `yaml:"name"`
+	Namespace      string                  `yaml:"namespace"` // team owning the service when stored in MongoDB
+	BasePath       string                  `yaml:"basePath"`
+	Targets        []string                `yaml:"targets"`
+	StripBasePath  bool                    `yaml:"stripBasePath"`
+	Timeout        time.Duration           `yaml:"timeout"`
+	RetryCount     int                     `yaml:"retryCount"`
+	RetryDelay     time.Duration           `yaml:"retryDelay"`
+	Authentication bool                    `yaml:"authentication"`
+	LoadBalancing  string                  `yaml:"loadBalancing"`
+	Headers        map[string]string       `yaml:"headers"`
+	HeaderRules    *HeaderRulesConfig      `yaml:"headerRules,omitempty"`
+	ResponseFields []ResponseFieldsConfig  `yaml:"responseFields,omitempty"`
+	Protocol       string                  `yaml:"protocol"` // http, graphql, grpc, mqtt-ws, soap, websocket
+	Transform      TransformConfig         `yaml:"transform"`
+	Aggregation    *AggregationConfig      `yaml:"aggregation,omitempty"`
+	GraphQL        *GraphQLConfig          `yaml:"graphql,omitempty"`
+	GRPC           *GRPCConfig             `yaml:"grpc,omitempty"`
+	MQTT           *MQTTConfig             `yaml:"mqtt,omitempty"`
+	SOAP           *SOAPConfig             `yaml:"soap,omitempty"`
+	HealthCheck    *HealthCheckConfig      `yaml:"healthCheck,omitempty"`
+	IPFilter       *IPFilterRules          `yaml:"ipFilter,omitempty"`
+	CORS           *CORSConfig             `yaml:"cors,omitempty"`
+	Validation     *ValidationConfig       `yaml:"validation,omitempty"`
+	DLP            *DLPConfig              `yaml:"dlp,omitempty"`
+	Transport      *TransportConfig        `yaml:"transport,omitempty"`
+	Backpressure   *BackpressureConfig     `yaml:"backpressure,omitempty"` // How 429 and 503 responses with Retry-After are retried
+	Canary         *CanaryConfig           `yaml:"canary,omitempty"`
+	FeatureFlag    string                  `yaml:"featureFlag,omitempty"` // The route answers 404 unless this flag is on for the request
+	Match          string                  `yaml:"match,omitempty"`       // CEL expression; the route answers 404 to requests it is false for
+	Policies       []PolicyConfig          `yaml:"policies,omitempty"`    // Authorization rules, the first one matching a request decides
+	Experiment     *ExperimentConfig       `yaml:"experiment,omitempty"`  // A/B test splitting clients between variants
+	Fault          *FaultConfig            `yaml:"fault,omitempty"`       // Failures injected into requests when faults are enabled
+	WebSocket      *ServiceWebSocketConfig `yaml:"websocket,omitempty"`
+	Versioning     *VersioningConfig       `yaml:"versioning,omitempty"`
+	Mock           *MockConfig             `yaml:"mock,omitempty"`
+	Static         *StaticResponseConfig   `yaml:"static,omitempty"`     // Answer every request with a fixed response, without targets
+	Redirect       *RedirectConfig         `yaml:"redirect,omitempty"`   // Redirect every request, without targets
+	ErrorPages     *ErrorPagesConfig       `yaml:"errorPages,omitempty"` // Overrides the global error pages for this service
+	Async          *ServiceAsyncConfig     `yaml:"async,omitempty"`      // Accept requests with 202 and call the targets in the background
+	// Responses larger than this many bytes, or of unknown length, are
+	// streamed to the client when nothing inspects the body (default: 1MB)
+	StreamThreshold int64                   `yaml:"streamThreshold,omitempty"`
+	Streaming       *ServiceStreamingConfig `yaml:"streaming,omitempty"` // Pass event streams and chunked responses through as they arrive
+	Auth            *ServiceAuthConfig      `yaml:"auth,omitempty"`      // Which provider authenticates the service's clients
+	Limits          *ServiceLimitsConfig    `yaml:"limits,omitempty"`    // Caps on request and response sizes
+}
+
+// ServiceLimitsConfig bounds the requests and responses of a service on top
+// of the server-wide request limits. Zero disables a limit.
+type ServiceLimitsConfig struct {
+	MaxRequestBodySize  int64 `yaml:"maxRequestBodySize,omitempty"`  // Request bodies in bytes (413)
+	MaxHeaderBytes      int   `yaml:"maxHeaderBytes,omitempty"`      // All request headers in bytes (431)
+	MaxResponseBodySize int64 `yaml:"maxResponseBodySize,omitempty"` // Target response bodies in bytes (502)
+}
+
+// ServiceAuthConfig picks how a service's clients authenticate. Setting a
+// provider turns authentication on.
+type ServiceAuthConfig struct {
+	Provider   string            `yaml:"provider,omitempty"`   // jwt (default): the gateway's JWT secret; hmac: signed requests; otherwise the name of an auth.oidc provider
+	Scopes     []string          `yaml:"scopes,omitempty"`     // Scopes tokens need for this service, on top of the provider's
+	ClientCert *ClientCertConfig `yaml:"clientCert,omitempty"` // Require a client certificate, alone or along with a token
+}
+
+// ClientCertConfig requires clients to present a certificate issued by one
+// of the service's CAs. The gateway only asks for certificates with
+// server.tls.clientAuth: request.
+type ClientCertConfig struct {
+	CAFile      string   `yaml:"caFile"`                // PEM bundle of the CAs certificates must chain to
+	AllowedCNs  []string `yaml:"allowedCNs,omitempty"`  // Subject common names accepted; * matches any characters
+	AllowedSANs []string `yaml:"allowedSANs,omitempty"` // DNS, email, IP or URI SANs accepted; * matches any characters
+}
+
+// TransportConfig tunes the connections the gateway keeps to a service's
+// targets. Every service gets its own connection pool.
+type TransportConfig struct {
+	MaxIdleConnsPerHost int                `yaml:"maxIdleConnsPerHost,omitempty"` // Idle connections kept per target (default: 100)
+	IdleConnTimeout     time.Duration      `yaml:"idleConnTimeout,omitempty"`     // How long idle connections are kept (default: 90s)
+	DialTimeout         time.Duration      `yaml:"dialTimeout,omitempty"`         // TCP connect timeout (default: 30s)
+	TLSHandshakeTimeout time.Duration      `yaml:"tlsHandshakeTimeout,omitempty"` // default: 10s
+	DisableKeepAlives   bool               `yaml:"disableKeepAlives,omitempty"`   // Open a new connection for every request
+	TLS                 *UpstreamTLSConfig `yaml:"tls,omitempty"`
+	Proxy               *EgressProxyConfig `yaml:"proxy,omitempty"` // Reach the targets through an HTTP or SOCKS5 proxy
+}
+
+// EgressProxyConfig sends a service's upstream requests through a proxy.
+// Environment proxy variables are ignored for services that set one.
+type EgressProxyConfig struct {
+	URL      string   `yaml:"url"`                // http://, https://, socks5:// or socks5h:// proxy
+	Username string   `yaml:"username,omitempty"` // Overrides credentials in the URL
+	Password string   `yaml:"password,omitempty"`
+	NoProxy  []string `yaml:"noProxy,omitempty"` // Hosts, .domains, CIDRs or host:port reached directly; * for all
+}
+
+// AsyncConfig sets where asynchronous requests are kept and how many run at
+// once. Services opt in with their own async section.
+type AsyncConfig struct {
+	Store        string        `yaml:"store,omitempty"`        // memory (default) or mongodb, which survives restarts and is shared by replicas
+	StatusPath   string        `yaml:"statusPath,omitempty"`   // Where clients poll jobs (default: /_async/jobs)
+	Workers      int           `yaml:"workers,omitempty"`      // Jobs run at once (default: 4)
+	QueueSize    int           `yaml:"queueSize,omitempty"`    // Jobs waiting before new ones are refused with 503 (default: 1000)
+	ResultTTL    time.Duration `yaml:"resultTtl,omitempty"`    // How long jobs and their results are kept (default: 1h)
+	MaxBodySize  int64         `yaml:"maxBodySize,omitempty"`  // Largest request and response body of a job in bytes (default: 10MB)
+	PollInterval time.Duration `yaml:"pollInterval,omitempty"` // How often the mongodb store is checked for jobs to run (default: 5s)
+}
+
+// ServiceAsyncConfig accepts a service's requests with 202 and a status URL,
+// then calls the targets in the background
+type ServiceAsyncConfig struct {
+	Mode           string        `yaml:"mode,omitempty"`           // prefer (default): requests with Prefer: respond-async; always: every request
+	Timeout        time.Duration `yaml:"timeout,omitempty"`        // Deadline of a job's upstream call, instead of the service timeout (default: 5m)
+	CallbackHosts  []string      `yaml:"callbackHosts,omitempty"`  // Hosts X-Callback-URL may point at; callbacks are refused when empty
+	CallbackSecret string        `yaml:"callbackSecret,omitempty"` // Signs callbacks like event webhooks
+}
+
+// ServiceStreamingConfig flushes text/event-stream and chunked responses to
+// the client as the target sends them. The service timeout then only bounds
+// the wait for the response headers.
+type ServiceStreamingConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	FlushInterval time.Duration `yaml:"flushInterval,omitempty"` // Batch writes for this long before flushing (default: flush every write)
+	MaxDuration   time.Duration `yaml:"maxDuration,omitempty"`   // Streams are cut after this long (default: no limit)
+}
+
+// SchedulerConfig runs recurring gateway tasks such as cache warm-up,
+// metric rollups and API key expiry. With the mongodb store, replicas elect
+// one of them to run the jobs and share the jobs added through the admin API.
+type SchedulerConfig struct {
+	Enabled       bool                 `yaml:"enabled"`
+	Store         string               `yaml:"store,omitempty"`         // memory (default) or mongodb
+	LeaseDuration time.Duration        `yaml:"leaseDuration,omitempty"` // How long a leader that stops renewing stays leader (default: 30s)
+	HistoryTTL    time.Duration        `yaml:"historyTtl,omitempty"`    // How long runs are kept (default: 720h)
+	Jobs          []ScheduledJobConfig `yaml:"jobs,omitempty"`
+}
+
+// ScheduledJobConfig runs a task on a schedule
+type ScheduledJobConfig struct {
+	Name     string                 `yaml:"name"`
+	Schedule string                 `yaml:"schedule"` // Cron expression, @hourly, @daily, @weekly, @monthly or @every <duration>
+	Task     string                 `yaml:"task"`     // http, expireApiKeys, usageReport, metricRollup or recalculateBaselines
+	Params   map[string]interface{} `yaml:"params,omitempty"`
+	Timeout  time.Duration          `yaml:"timeout,omitempty"` // default: 10m
+	Disabled bool                   `yaml:"disabled,omitempty"`
+}
+
+// FaultsConfig allows injecting failures into services, to test how their
+// clients cope. Faults only apply in the allowed environments, so that a
+// configuration shared with production cannot inject them there.
+type FaultsConfig struct {
+	Enabled             bool     `yaml:"enabled"`
+	Environment         string   `yaml:"environment"`                   // Where the gateway runs, e.g. staging
+	AllowedEnvironments []string `yaml:"allowedEnvironments,omitempty"` // (default: development, test, staging)
+}
+
+// FaultConfig sets the failures injected into a service's requests. Each
+// request is delayed, failed and aborted with the given probabilities.
+type FaultConfig struct {
+	DelayPercentage float64       `yaml:"delayPercentage,omitempty"`
+	Delay           time.Duration `yaml:"delay,omitempty"` // Added before the request is served
+	ErrorPercentage float64       `yaml:"errorPercentage,omitempty"`
+	ErrorStatus     int           `yaml:"errorStatus,omitempty"`     // Answered instead of serving the request (default: 503)
+	AbortPercentage float64       `yaml:"abortPercentage,omitempty"` // Connections closed without a response
+}
+
+// GeoIPConfig looks up where clients are in MaxMind databases and passes
+// it to services in X-Geo-* headers
+type GeoIPConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Database       string   `yaml:"database,omitempty"`       // GeoIP2 or GeoLite2 City or Country .mmdb file
+	ASNDatabase    string   `yaml:"asnDatabase,omitempty"`    // GeoLite2 ASN .mmdb file
+	LogFields      bool     `yaml:"logFields,omitempty"`      // Add the client's country and ASN to access logs
+	MetricLabels   []string `yaml:"metricLabels,omitempty"`   // Count requests by country, region and/or asn
+	MaxLabelValues int      `yaml:"maxLabelValues,omitempty"` // Values per label before the rest are counted as "other" (default: 50)
+}
+
+// BackpressureConfig sets how the gateway reacts to targets that answer 429
+// or 503 with Retry-After. Such responses are retried once the indicated
+// delay has passed, within the service's retryCount.
+type BackpressureConfig struct {
+	DisableRetries  bool          `yaml:"disableRetries,omitempty"`  // Return these responses to the client right away
+	MaxDelay        time.Duration `yaml:"maxDelay,omitempty"`        // Longer delays are not waited for; the response goes to the client (default: 5s)
+	StripRetryAfter bool          `yaml:"stripRetryAfter,omitempty"` // Don't pass the targets' Retry-After on to clients
+}
+
+// CanaryConfig sends part of a service's traffic to other targets. Requests
+// matching the header or cookie always go to the canary.
+type CanaryConfig struct {
+	Targets     []string `yaml:"targets"`
+	Weight      int      `yaml:"weight"`               // Percentage of clients sent to the canary (0-100)
+	WeightFlag  string   `yaml:"weightFlag,omitempty"` // Feature flag giving the weight per request instead
+	Header      string   `yaml:"header,omitempty"`
+	HeaderValue string   `yaml:"headerValue,omitempty"`
+	CookieName  string   `yaml:"cookieName,omitempty"`
+	CookieValue string   `yaml:"cookieValue,omitempty"`
+	Match       string   `yaml:"match,omitempty"` // CEL expression sending the requests it is true for to the canary
+}
+
+// ExperimentConfig splits a share of a service's clients between variants.
+// Clients are assigned by a claim when authenticated, by a cookie the gateway
+// sets otherwise, and keep their variant across requests.
+type ExperimentConfig struct {
+	Name         string          `yaml:"name"`
+	Traffic      int             `yaml:"traffic"`                // Percentage of clients in the experiment (0-100)
+	Claim        string          `yaml:"claim,omitempty"`        // Claim identifying authenticated clients, e.g. sub
+	CookieName   string          `yaml:"cookieName,omitempty"`   // Cookie identifying other clients (default: odin_exp_<name>)
+	CookieMaxAge time.Duration   `yaml:"cookieMaxAge,omitempty"` // (default: 720h)
+	Variants     []VariantConfig `yaml:"variants"`
+}
+
+// VariantConfig is one arm of an experiment
+type VariantConfig struct {
+	Name    string            `yaml:"name"`
+	Weight  int               `yaml:"weight"`            // Share of the experiment's clients, relative to the other variants
+	Targets []string          `yaml:"targets,omitempty"` // Replace the service's targets
+	Headers map[string]string `yaml:"headers,omitempty"` // Added to the requests sent to targets
+}
+
+// PolicyConfig allows or denies the requests a CEL expression is true for.
+// When no policy matches, requests are denied if the service has allow
+// policies and allowed otherwise.
+type PolicyConfig struct {
+	Name    string `yaml:"name,omitempty"`
+	Effect  string `yaml:"effect"`            // allow or deny
+	When    string `yaml:"when"`              // CEL expression over request, claims and now
+	Message string `yaml:"message,omitempty"` // Sent with the 403 of denied requests (default: Forbidden)
+}
+
+// UpstreamTLSConfig controls how the gateway verifies and authenticates to
+// HTTPS targets
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`             // Trust only this CA instead of the system roots
+	CertFile           string `yaml:"certFile,omitempty"`           // Client certificate for mTLS
+	KeyFile            string `yaml:"keyFile,omitempty"`            // Client certificate key
+	ServerName         string `yaml:"serverName,omitempty"`         // Name to verify instead of the target host
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"` // Skip verification, for testing only
+}
+
+// DLPConfig masks or drops sensitive data in a service's JSON responses
+// before they leave the gateway
+type DLPConfig struct {
+	Rules []DLPRule `yaml:"rules"`
+}
+
+// DLPRule selects values by field, by content or both. A rule with only
+// fields applies to every value of those fields; a rule with a detector
+// applies to the matching parts of string and number values.
+type DLPRule struct {
+	Name     string   `yaml:"name,omitempty"`     // Reported in the audit counters (default: detector or first field)
+	Fields   []string `yaml:"fields,omitempty"`   // Field names or dotted paths such as customer.card.number; empty scans every field
+	Detector string   `yaml:"detector,omitempty"` // pan, ssn, email or regex
+	Pattern  string   `yaml:"pattern,omitempty"`  // Regular expression for the regex detector
+	Action   string   `yaml:"action,omitempty"`   // mask (default) or drop
+	MaskChar string   `yaml:"maskChar,omitempty"` // default: *
+	KeepLast int      `yaml:"keepLast,omitempty"` // Trailing characters left unmasked, e.g. 4 for card numbers
+}
+
+// VersioningConfig routes a service's requests to the version of its API
+// they ask for
+type VersioningConfig struct {
+	Strategy     string             `yaml:"strategy"`               // path, header or mediaType
+	Header       string             `yaml:"header,omitempty"`       // Request header naming the version (default: X-API-Version)
+	Default      string             `yaml:"default,omitempty"`      // Version of requests that name none; empty rejects them
+	StripVersion bool               `yaml:"stripVersion,omitempty"` // Remove the version segment from the upstream path (path strategy)
+	Versions     []APIVersionConfig `yaml:"versions"`
+}
+
+// APIVersionConfig is one version of a service's API. Deprecated versions
+// are still served, with Deprecation, Sunset and Link headers telling
+// clients to move on; after the sunset date they are answered with 410 Gone.
+type APIVersionConfig struct {
+	Name         string    `yaml:"name"`                   // e.g. v2, matched case-insensitively and with or without the v
+	Targets      []string  `yaml:"targets,omitempty"`      // default: the service's targets
+	Deprecated   bool      `yaml:"deprecated,omitempty"`   // Send the Deprecation header
+	DeprecatedAt time.Time `yaml:"deprecatedAt,omitempty"` // When the version was deprecated; implies deprecated
+	Sunset       time.Time `yaml:"sunset,omitempty"`       // When the version stops being served
+	Link         string    `yaml:"link,omitempty"`         // Migration guide, sent as Link rel="deprecation"
+}
+
+// ValidationConfig attaches an OpenAPI document to a service's routes so
+// requests are validated before they are proxied
+type ValidationConfig struct {
+	Spec       string `yaml:"spec,omitempty"`       // OpenAPI 3 document (JSON or YAML); empty uses the spec generated for the service
+	PathPrefix string `yaml:"pathPrefix,omitempty"` // Prepended to the document's paths when they are relative to the backend
+}
+
+// MockConfig has the gateway answer a service's requests itself, with
+// canned responses or the examples of its OpenAPI document, so clients can
+// integrate before the backend exists
+type MockConfig struct {
+	FromSpec    bool              `yaml:"fromSpec,omitempty"`    // Answer the operations of the spec with their examples
+	Spec        string            `yaml:"spec,omitempty"`        // OpenAPI 3 document; default: validation.spec, else the spec generated for the service
+	PathPrefix  string            `yaml:"pathPrefix,omitempty"`  // Prepended to the document's paths when they are relative to the backend
+	Latency     time.Duration     `yaml:"latency,omitempty"`     // Delay before every mock response
+	Jitter      time.Duration     `yaml:"jitter,omitempty"`      // Random extra delay, up to this long
+	Passthrough bool              `yaml:"passthrough,omitempty"` // Proxy requests without a mock response to the targets instead of answering 404
+	Routes      []MockRouteConfig `yaml:"routes,omitempty"`
+}
+
+// MockRouteConfig is a canned response for the requests of one route
+type MockRouteConfig struct {
+	Method  string            `yaml:"method,omitempty"` // default: any method
+	Path    string            `yaml:"path"`             // Request path; {name} segments match any value
+	Status  int               `yaml:"status,omitempty"` // default: 200
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	Latency *time.Duration    `yaml:"latency,omitempty"` // Replaces the mock's latency for the route
+}
+
+// StaticResponseConfig is the response a static service answers every
+// request with, e.g. a maintenance page or a well-known document
+type StaticResponseConfig struct {
+	Status  int               `yaml:"status,omitempty"`  // default: 200
+	Headers map[string]string `yaml:"headers,omitempty"` // Content-Type defaults to the type detected from the body
+	Body    string            `yaml:"body,omitempty"`
+}
+
+// RedirectConfig redirects every request of a service. Location is a Go
+// template of the request's .Scheme, .Host, .Path, .Subpath (the path below
+// the base path), .Query and .Method.
+type RedirectConfig struct {
+	Status   int    `yaml:"status,omitempty"` // 301, 302 (default), 303, 307 or 308
+	Location string `yaml:"location"`         // e.g. https://new.example.com{{.Path}}{{if .Query}}?{{.Query}}{{end}}
+}
+
+// CORSConfig is the cross-origin policy the gateway enforces for a service
+type CORSConfig struct {
+	AllowOrigins     []string `yaml:"allowOrigins"`               // Exact origins, "*" or wildcards like https://*.example.com
+	AllowMethods     []string `yaml:"allowMethods,omitempty"`     // default: GET, HEAD, PUT, PATCH, POST, DELETE
+	AllowHeaders     []string `yaml:"allowHeaders,omitempty"`     // default: the headers requested by the preflight
+	ExposeHeaders    []string `yaml:"exposeHeaders,omitempty"`    // Response headers readable by the browser
+	AllowCredentials bool     `yaml:"allowCredentials,omitempty"` // Allow cookies and Authorization headers
+	MaxAge           int      `yaml:"maxAge,omitempty"`           // Seconds a preflight may be cached
+}
+
+// ResponseFieldsConfig strips every field but Fields from the successful
+// JSON responses to the requests matching Method and Path. The first rule
+// matching a request applies.
+type ResponseFieldsConfig struct {
+	Method string   `yaml:"method,omitempty"` // default: any method
+	Path   string   `yaml:"path,omitempty"`   // Request path; {name} segments match any value (default: any path)
+	Fields []string `yaml:"fields"`           // Dotted paths such as $.user.id; arrays are filtered item by item
+}
+
+// HeaderRulesConfig changes the headers of a service's requests before they
+// are proxied and of the responses returned to clients. Rules apply in
+// order, after Headers and transformations.
+type HeaderRulesConfig struct {
+	Request  []HeaderRuleConfig `yaml:"request,omitempty"`
+	Response []HeaderRuleConfig `yaml:"response,omitempty"`
+}
+
+// HeaderRuleConfig changes a header of the requests matching Method and
+// Path, or of their responses
+type HeaderRuleConfig struct {
+	Action string `yaml:"action"`           // add, set, remove, rename, copy-from-claim or copy-from-header
+	Name   string `yaml:"name"`             // Header changed
+	Value  string `yaml:"value,omitempty"`  // Value added or set
+	From   string `yaml:"from,omitempty"`   // Header renamed, claim copied (e.g. sub or org.id) or client request header copied
+	Method string `yaml:"method,omitempty"` // default: any method
+	Path   string `yaml:"path,omitempty"`   // Request path; {name} segments match any value (default: any path)
 }
 
 type TransformConfig struct {
 	Request  []TransformRule `yaml:"request"`
 	Response []TransformRule `yaml:"response"`
+	// XML converts request and response bodies between XML and JSON, e.g. so
+	// JSON clients can use an XML service
+	XML *XMLTransformConfig `yaml:"xml,omitempty"`
+	// Templates rewrite bodies with Go templates; the first one matching a
+	// request applies
+	Templates []TemplateTransformConfig `yaml:"templates,omitempty"`
+}
+
+// TemplateTransformConfig renders the bodies of the requests it matches
+// through Go templates, which see the body as .body and the request's
+// .headers, .params, .query and .claims
+type TemplateTransformConfig struct {
+	Method   string `yaml:"method,omitempty"`   // default: any method
+	Path     string `yaml:"path,omitempty"`     // Request path; {name} segments match any value and are in .params (default: any path)
+	Request  string `yaml:"request,omitempty"`  // Template of the request body sent to the service
+	Response string `yaml:"response,omitempty"` // Template of the response body sent to the client; also sees .status
+}
+
+// XMLTransformConfig selects the body conversions of a service and how
+// attributes and namespaces map to JSON
+type XMLTransformConfig struct {
+	Request         string `yaml:"request,omitempty"`         // json-to-xml or xml-to-json
+	Response        string `yaml:"response,omitempty"`        // json-to-xml or xml-to-json
+	AttributePrefix string `yaml:"attributePrefix,omitempty"` // Prefix of JSON keys holding attributes (default: @)
+	TextKey         string `yaml:"textKey,omitempty"`         // Key of element text next to attributes or children (default: #text)
+	KeepNamespaces  bool   `yaml:"keepNamespaces,omitempty"`  // Keep namespace prefixes and xmlns attributes in JSON
+	Namespace       string `yaml:"namespace,omitempty"`       // Default namespace declared on the XML root element
+	RootElement     string `yaml:"rootElement,omitempty"`     // Element wrapping XML produced and unwrapped from XML read
+	ContentType     string `yaml:"contentType,omitempty"`     // Content type of XML produced (default: application/xml)
 }
 
 type TransformRule struct {
@@ -298,21 +1299,106 @@ type AggregationConfig struct {
 }
 
 type GraphQLConfig struct {
-	MaxQueryDepth       int           `yaml:"maxQueryDepth"`
-	MaxQueryComplexity  int           `yaml:"maxQueryComplexity"`
-	EnableIntrospection bool          `yaml:"enableIntrospection"`
-	EnableQueryCaching  bool          `yaml:"enableQueryCaching"`
-	CacheTTL            time.Duration `yaml:"cacheTTL"`
+	MaxQueryDepth       int                      `yaml:"maxQueryDepth"`
+	MaxQueryComplexity  int                      `yaml:"maxQueryComplexity"`
+	EnableIntrospection bool                     `yaml:"enableIntrospection"`
+	EnableQueryCaching  bool                     `yaml:"enableQueryCaching"`
+	CacheTTL            time.Duration            `yaml:"cacheTTL"`
+	Federation          *GraphQLFederationConfig `yaml:"federation,omitempty"`
+}
+
+// GraphQLFederationConfig serves one schema merged from several GraphQL
+// services in place of the service's targets. Root fields are sent to the
+// subgraph defining them; links add fields resolved by another subgraph.
+type GraphQLFederationConfig struct {
+	Subgraphs []GraphQLSubgraph `yaml:"subgraphs"`
+	Links     []GraphQLLink     `yaml:"links,omitempty"`
+}
+
+type GraphQLSubgraph struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// GraphQLLink adds a field to a type of the merged schema, resolved by a
+// root query field of a subgraph with arguments taken from the type
+type GraphQLLink struct {
+	Type      string            `yaml:"type"`      // Type the field is added to, e.g. Order
+	Field     string            `yaml:"field"`     // Name of the added field, e.g. customer
+	Subgraph  string            `yaml:"subgraph"`  // Subgraph resolving the field
+	Query     string            `yaml:"query"`     // Root query field of the subgraph, e.g. user
+	Arguments map[string]string `yaml:"arguments"` // Query argument -> field of the type, e.g. id: customerId
 }
 
 type GRPCConfig struct {
 	ProtoFiles       []string `yaml:"protoFiles"`
 	ImportPaths      []string `yaml:"importPaths"`
-	EnableReflection bool     `yaml:"enableReflection"`
+	EnableReflection bool     `yaml:"enableReflection"` // Describe methods through the target's server reflection service
 	MaxMessageSize   int      `yaml:"maxMessageSize"`
 	EnableTLS        bool     `yaml:"enableTLS"`
 	TLSCertFile      string   `yaml:"tlsCertFile"`
 	TLSKeyFile       string   `yaml:"tlsKeyFile"`
+	// DescriptorSets are FileDescriptorSet files (protoc --include_imports
+	// --descriptor_set_out) describing the methods transcoded from JSON
+	DescriptorSets       []string      `yaml:"descriptorSets,omitempty"`
+	Routes               []GRPCRoute   `yaml:"routes,omitempty"`
+	StreamTimeout        time.Duration `yaml:"streamTimeout,omitempty"`        // Streams are cut after this long (default: no limit)
+	MaxConcurrentStreams int           `yaml:"maxConcurrentStreams,omitempty"` // Streams open at once; more are refused with 503 (default: no limit)
+}
+
+// GRPCRoute maps a REST route under the service's base path to a gRPC
+// method. Path and query parameters set the request fields of the same name.
+type GRPCRoute struct {
+	Method   string `yaml:"method"`             // HTTP method clients use (default: POST)
+	Path     string `yaml:"path"`               // Route relative to basePath, may contain :params
+	RPC      string `yaml:"rpc"`                // Full method name, e.g. users.v1.UserService/GetUser
+	Body     string `yaml:"body,omitempty"`     // Request field the JSON body fills (default: the whole message)
+	Response string `yaml:"response,omitempty"` // Response field returned as JSON (default: the whole message)
+}
+
+// MQTTConfig configures an mqtt-ws service. Clients connect over WebSocket
+// and authenticate in their CONNECT packet; the gateway checks their
+// publishes and subscriptions against the ACL and relays them to the broker
+// with the broker credentials below. {userId}, {username} and {clientId} in
+// brokerUsername, brokerPassword and ACL topics are replaced per connection.
+type MQTTConfig struct {
+	Auth           string        `yaml:"auth"`                     // Credential expected as the CONNECT password or in the handshake: jwt or apiKey (default: jwt)
+	BrokerUsername string        `yaml:"brokerUsername,omitempty"` // default: {userId}
+	BrokerPassword string        `yaml:"brokerPassword,omitempty"` // Omitted from the CONNECT when empty
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`           // Time allowed for the CONNECT packet (default: 10s)
+	MaxPacketSize  int           `yaml:"maxPacketSize"`            // Largest packet accepted from clients (default: 256KB)
+	ACL            []MQTTACLRule `yaml:"acl,omitempty"`            // Topics clients may use; empty allows all
+}
+
+// MQTTACLRule grants access to the topics matching a topic filter
+type MQTTACLRule struct {
+	Topic  string   `yaml:"topic"`           // Topic filter, may contain + and # wildcards
+	Access string   `yaml:"access"`          // publish, subscribe or all (default: all)
+	Roles  []string `yaml:"roles,omitempty"` // Only for clients with one of these roles
+}
+
+// SOAPConfig configures a soap service, which accepts JSON from clients and
+// calls a SOAP endpoint. Each operation maps a route under the service's base
+// path to a SOAP action.
+type SOAPConfig struct {
+	Version           string          `yaml:"version"`           // SOAP version: 1.1 or 1.2 (default: 1.1)
+	Schemas           []string        `yaml:"schemas,omitempty"` // XSD files request bodies are validated against
+	ValidateResponses bool            `yaml:"validateResponses"` // Also validate response bodies against the schemas
+	Header            string          `yaml:"header,omitempty"`  // Template for the SOAP header of every request
+	MaxResponseSize   int64           `yaml:"maxResponseSize"`   // Largest response read from the endpoint (default: 10MB)
+	Operations        []SOAPOperation `yaml:"operations"`
+}
+
+// SOAPOperation renders a SOAP request from a JSON request and picks the
+// part of the response returned to the client
+type SOAPOperation struct {
+	Name     string   `yaml:"name"`
+	Method   string   `yaml:"method"`             // HTTP method clients use (default: POST)
+	Path     string   `yaml:"path"`               // Route relative to basePath, may contain :params (default: /<name>)
+	Action   string   `yaml:"action,omitempty"`   // SOAPAction
+	Request  string   `yaml:"request"`            // Template for the SOAP body
+	Response string   `yaml:"response,omitempty"` // Slash-separated path below the response element to return (default: the whole element)
+	Arrays   []string `yaml:"arrays,omitempty"`   // Elements always returned as JSON arrays, even when they occur once
 }
 
 type DependencyConfig struct {
@@ -329,13 +1415,24 @@ type MappingConfig struct {
 
 // HealthCheckConfig holds health check configuration for backend targets
 type HealthCheckConfig struct {
-	Enabled            bool          `yaml:"enabled"`
-	Interval           time.Duration `yaml:"interval"`           // How often to check (default: 30s)
-	Timeout            time.Duration `yaml:"timeout"`            // Request timeout (default: 5s)
-	UnhealthyThreshold int           `yaml:"unhealthyThreshold"` // Failures before unhealthy (default: 3)
-	HealthyThreshold   int           `yaml:"healthyThreshold"`   // Successes before healthy (default: 2)
-	ExpectedStatus     []int         `yaml:"expectedStatus"`     // Expected HTTP status codes (default: [200, 204])
-	InsecureSkipVerify bool          `yaml:"insecureSkipVerify"` // Skip TLS verification
+	Enabled            bool                 `yaml:"enabled"`
+	Interval           time.Duration        `yaml:"interval"`              // How often to check (default: 30s)
+	Timeout            time.Duration        `yaml:"timeout"`               // Request timeout (default: 5s)
+	UnhealthyThreshold int                  `yaml:"unhealthyThreshold"`    // Failures before unhealthy (default: 3)
+	HealthyThreshold   int                  `yaml:"healthyThreshold"`      // Successes before healthy (default: 2)
+	ExpectedStatus     []int                `yaml:"expectedStatus"`        // Expected HTTP status codes (default: [200, 204])
+	InsecureSkipVerify bool                 `yaml:"insecureSkipVerify"`    // Skip TLS verification
+	Type               string               `yaml:"type,omitempty"`        // http (default: GET <target>/health), tcp (connect only) or grpc (health protocol)
+	GRPCService        string               `yaml:"grpcService,omitempty"` // Service the grpc probe asks about (default: the whole server)
+	Passive            *PassiveHealthConfig `yaml:"passive,omitempty"`
+}
+
+// PassiveHealthConfig marks targets degraded from the outcome of proxied
+// requests, between active checks
+type PassiveHealthConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Failures int           `yaml:"failures,omitempty"` // Consecutive 5xx responses, timeouts or connection errors before degraded (default: 5)
+	Decay    time.Duration `yaml:"decay,omitempty"`    // Time without failures before a degraded target is healthy again (default: 30s)
 }
 
 // SetDefaults sets default values for ServiceConfig
@@ -355,6 +1452,77 @@ func (s *ServiceConfig) SetDefaults() {
 	if s.Protocol == "" {
 		s.Protocol = "http"
 	}
+	if s.Auth != nil && s.Auth.Provider != "" {
+		s.Authentication = true
+	}
+	if hc := s.HealthCheck; hc != nil && hc.Passive != nil && hc.Passive.Enabled {
+		if hc.Passive.Failures == 0 {
+			hc.Passive.Failures = 5
+		}
+		if hc.Passive.Decay == 0 {
+			hc.Passive.Decay = 30 * time.Second
+		}
+	}
+	if s.Protocol == "mqtt-ws" {
+		if s.MQTT == nil {
+			s.MQTT = &MQTTConfig{}
+		}
+		if s.MQTT.Auth == "" {
+			s.MQTT.Auth = "jwt"
+		}
+		if s.MQTT.BrokerUsername == "" {
+			s.MQTT.BrokerUsername = "{userId}"
+		}
+		if s.MQTT.ConnectTimeout == 0 {
+			s.MQTT.ConnectTimeout = 10 * time.Second
+		}
+		if s.MQTT.MaxPacketSize == 0 {
+			s.MQTT.MaxPacketSize = 256 * 1024
+		}
+		for i := range s.MQTT.ACL {
+			if s.MQTT.ACL[i].Access == "" {
+				s.MQTT.ACL[i].Access = "all"
+			}
+		}
+	}
+	if s.Protocol == "soap" && s.SOAP != nil {
+		if s.SOAP.Version == "" {
+			s.SOAP.Version = "1.1"
+		}
+		if s.SOAP.MaxResponseSize == 0 {
+			s.SOAP.MaxResponseSize = 10 << 20
+		}
+		for i := range s.SOAP.Operations {
+			op := &s.SOAP.Operations[i]
+			if op.Method == "" {
+				op.Method = "POST"
+			}
+			if op.Path == "" {
+				op.Path = "/" + op.Name
+			}
+		}
+	}
+	if s.DLP != nil {
+		for i := range s.DLP.Rules {
+			rule := &s.DLP.Rules[i]
+			if rule.Action == "" {
+				rule.Action = "mask"
+			}
+			if rule.MaskChar == "" {
+				rule.MaskChar = "*"
+			}
+			if rule.Name == "" {
+				if rule.Detector != "" {
+					rule.Name = rule.Detector
+				} else if len(rule.Fields) > 0 {
+					rule.Name = rule.Fields[0]
+				}
+			}
+		}
+	}
+	if s.Versioning != nil && s.Versioning.Header == "" {
+		s.Versioning.Header = "X-API-Version"
+	}
 }
 
 func Load(configPath string, logger *logrus.Logger) (*Config, error) {
@@ -368,48 +1536,6 @@ func Load(configPath string, logger *logrus.Logger) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	// Set defaults
-	if config.Server.Port == 0 {
-		config.Server.Port = 8080
-	}
-	if config.Server.ReadTimeout == 0 {
-		config.Server.ReadTimeout = 30 * time.Second
-	}
-	if config.Server.WriteTimeout == 0 {
-		config.Server.WriteTimeout = 30 * time.Second
-	}
-	if config.Server.GracefulTimeout == 0 {
-		config.Server.GracefulTimeout = 15 * time.Second
-	}
-	if config.Server.Timeout == 0 {
-		config.Server.Timeout = 30 * time.Second
-	}
-
-	if config.Logging.Level == "" {
-		config.Logging.Level = "info"
-	}
-
-	if config.Monitoring.Path == "" {
-		config.Monitoring.Path = "/metrics"
-	}
-
-	// Set tracing defaults
-	if config.Tracing.ServiceName == "" {
-		config.Tracing.ServiceName = "odin-gateway"
-	}
-	if config.Tracing.ServiceVersion == "" {
-		config.Tracing.ServiceVersion = "1.0.0"
-	}
-	if config.Tracing.Environment == "" {
-		config.Tracing.Environment = "development"
-	}
-	if config.Tracing.Endpoint == "" {
-		config.Tracing.Endpoint = "http://localhost:4318/v1/traces"
-	}
-	if config.Tracing.SampleRate == 0 {
-		config.Tracing.SampleRate = 1.0
-	}
-
 	// Load services from external file if available
 	servicesPath := filepath.Join(filepath.Dir(configPath), "services.yaml")
 	if _, err := os.Stat(servicesPath); err == nil {
@@ -424,10 +1550,7 @@ func Load(configPath string, logger *logrus.Logger) (*Config, error) {
 		}
 	}
 
-	// Set defaults for services
-	for i := range config.Services {
-		config.Services[i].SetDefaults()
-	}
+	config.SetDefaults()
 
 	if err := validateConfig(&config); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -436,22 +1559,2015 @@ func Load(configPath string, logger *logrus.Logger) (*Config, error) {
 	return &config, nil
 }
 
-func validateConfig(config *Config) error {
-	if config.Server.Port <= 0 || config.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+// usesWebSocketServices reports whether a service uses the websocket
+// protocol, whose connections follow the global WebSocket settings
+func (c *Config) usesWebSocketServices() bool {
+	for _, svc := range c.Services {
+		if svc.Protocol == "websocket" {
+			return true
+		}
 	}
+	return false
+}
 
-	for _, service := range config.Services {
-		if service.Name == "" {
-			return fmt.Errorf("service name cannot be empty")
+// SetDefaults fills in the defaults of settings left empty. Load applies
+// them; configurations built in code should too before use.
+func (c *Config) SetDefaults() {
+	if c.Server.Port == 0 {
+		c.Server.Port = 8080
+	}
+	if c.Server.ReadTimeout == 0 {
+		c.Server.ReadTimeout = 30 * time.Second
+	}
+	if c.Server.WriteTimeout == 0 {
+		c.Server.WriteTimeout = 30 * time.Second
+	}
+	if c.Server.GracefulTimeout == 0 {
+		c.Server.GracefulTimeout = 15 * time.Second
+	}
+	if c.Server.Timeout == 0 {
+		c.Server.Timeout = 30 * time.Second
+	}
+	if c.Auth.APIKeyHeader == "" {
+		c.Auth.APIKeyHeader = "X-API-Key"
+	}
+	if c.Server.TLS.Enabled && c.Server.TLS.Port == 0 {
+		c.Server.TLS.Port = 8443
+	}
+	if c.Server.TLS.Enabled && c.Server.TLS.ReloadInterval == 0 {
+		c.Server.TLS.ReloadInterval = 30 * time.Second
+	}
+	if c.Server.TLS.ACME.Enabled {
+		acme := &c.Server.TLS.ACME
+		if acme.DirectoryURL == "" {
+			acme.DirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+		}
+		if acme.Challenge == "" {
+			acme.Challenge = "http-01"
+		}
+		if acme.Storage == "" {
+			acme.Storage = "disk"
+		}
+		if acme.StorageDir == "" {
+			acme.StorageDir = "data/acme"
+		}
+		if acme.RenewBefore == 0 {
+			acme.RenewBefore = 30 * 24 * time.Hour
+		}
+		if acme.DNS.PropagationDelay == 0 {
+			acme.DNS.PropagationDelay = 30 * time.Second
+		}
+	}
+
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+
+	if c.Runtime.MemoryLimitRatio == 0 {
+		c.Runtime.MemoryLimitRatio = 0.9
+	}
+
+	if c.Monitoring.Path == "" {
+		c.Monitoring.Path = "/metrics"
+	}
+
+	probes := &c.Monitoring.Probes
+	if probes.LivenessPath == "" {
+		probes.LivenessPath = "/live"
+	}
+	if probes.ReadinessPath == "" {
+		probes.ReadinessPath = "/ready"
+	}
+	if probes.Timeout == 0 {
+		probes.Timeout = 2 * time.Second
+	}
+	for i := range probes.CriticalServices {
+		if probes.CriticalServices[i].MinHealthyTargets == 0 {
+			probes.CriticalServices[i].MinHealthyTargets = 1
+		}
+	}
+
+	// Set tracing defaults
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "odin-gateway"
+	}
+	if c.Tracing.ServiceVersion == "" {
+		c.Tracing.ServiceVersion = "1.0.0"
+	}
+	if c.Tracing.Environment == "" {
+		c.Tracing.Environment = "development"
+	}
+	if c.Tracing.Endpoint == "" {
+		c.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+	}
+	if c.Tracing.SampleRate == 0 {
+		c.Tracing.SampleRate = 1.0
+	}
+
+	// Set defaults for services
+	for i := range c.Services {
+		c.Services[i].SetDefaults()
+	}
+
+	// Set GitOps defaults
+	if c.GitOps.Enabled {
+		if c.GitOps.Branch == "" {
+			c.GitOps.Branch = "main"
+		}
+		if c.GitOps.Directory == "" {
+			c.GitOps.Directory = "data/gitops"
+		}
+		if c.GitOps.Interval == 0 && c.GitOps.WebhookSecret == "" {
+			c.GitOps.Interval = time.Minute
+		}
+	}
+
+	// Set event delivery defaults
+	if c.Events.Enabled {
+		if c.Events.QueueSize == 0 {
+			c.Events.QueueSize = 1000
+		}
+		if c.Events.Workers == 0 {
+			c.Events.Workers = 2
+		}
+		for i := range c.Events.Webhooks {
+			webhook := &c.Events.Webhooks[i]
+			if webhook.Timeout == 0 {
+				webhook.Timeout = 10 * time.Second
+			}
+			if webhook.MaxRetries == 0 {
+				webhook.MaxRetries = 3
+			}
+			if webhook.RetryBackoff == 0 {
+				webhook.RetryBackoff = time.Second
+			}
+		}
+	}
+
+	// Set streaming defaults
+	if c.Streaming.Enabled {
+		if c.Streaming.Schema == "" {
+			c.Streaming.Schema = "json"
+		}
+		if c.Streaming.AccessTopic == "" {
+			c.Streaming.AccessTopic = "odin.access"
+		}
+		if c.Streaming.AuditTopic == "" {
+			c.Streaming.AuditTopic = "odin.audit"
+		}
+		if c.Streaming.BatchSize == 0 {
+			c.Streaming.BatchSize = 100
+		}
+		if c.Streaming.FlushInterval == 0 {
+			c.Streaming.FlushInterval = time.Second
+		}
+		if c.Streaming.BufferSize == 0 {
+			c.Streaming.BufferSize = 10000
+		}
+		if c.Streaming.Kafka.Timeout == 0 {
+			c.Streaming.Kafka.Timeout = 10 * time.Second
+		}
+		if c.Streaming.NATS.Timeout == 0 {
+			c.Streaming.NATS.Timeout = 5 * time.Second
+		}
+	}
+
+	// Set bot mitigation defaults
+	if c.Bot.Enabled {
+		thresholds := &c.Bot.Thresholds
+		if *thresholds == (BotThresholds{}) {
+			*thresholds = BotThresholds{Tag: 30, Challenge: 50, Throttle: 70, Block: 90}
+		}
+		if c.Bot.Challenge.Cookie == "" {
+			c.Bot.Challenge.Cookie = "odin_bot_check"
+		}
+		if c.Bot.Challenge.TTL == 0 {
+			c.Bot.Challenge.TTL = time.Hour
+		}
+		if c.Bot.ThrottleRPM == 0 {
+			c.Bot.ThrottleRPM = 30
+		}
+		if c.Bot.CadenceWindow == 0 {
+			c.Bot.CadenceWindow = 10 * time.Second
+		}
+		if c.Bot.CadenceLimit == 0 {
+			c.Bot.CadenceLimit = 20
+		}
+	}
+
+	if c.Overload.Enabled {
+		overload := &c.Overload
+		if overload.MaxConcurrent == 0 {
+			overload.MaxConcurrent = 1000
+		}
+		if overload.MaxQueue == 0 {
+			overload.MaxQueue = overload.MaxConcurrent
+		}
+		if overload.MaxQueueTime == 0 {
+			overload.MaxQueueTime = time.Second
+		}
+		if overload.TargetDelay == 0 {
+			overload.TargetDelay = 10 * time.Millisecond
+		}
+		if overload.Interval == 0 {
+			overload.Interval = 100 * time.Millisecond
+		}
+		if overload.RetryAfter == 0 {
+			overload.RetryAfter = time.Second
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Limit == 0 {
+			c.RateLimit.Limit = 100
+		}
+		if c.RateLimit.Duration == 0 {
+			c.RateLimit.Duration = time.Minute
+		}
+	}
+
+	if c.WebSocket.Enabled || c.usesWebSocketServices() {
+		if c.WebSocket.MaxMessageSize == 0 {
+			c.WebSocket.MaxMessageSize = 512 * 1024
+		}
+		if c.WebSocket.IdleTimeout == 0 {
+			c.WebSocket.IdleTimeout = 5 * time.Minute
+		}
+	}
+
+	for i := range c.TCP.Listeners {
+		listener := &c.TCP.Listeners[i]
+		if listener.Mode == "" {
+			listener.Mode = "tcp"
+		}
+		if listener.LoadBalancing == "" {
+			listener.LoadBalancing = "round-robin"
+		}
+		if listener.ConnectTimeout == 0 {
+			listener.ConnectTimeout = 5 * time.Second
+		}
+		if listener.ClientHelloTimeout == 0 {
+			listener.ClientHelloTimeout = 10 * time.Second
+		}
+		for j := range listener.Routes {
+			if listener.Routes[j].LoadBalancing == "" {
+				listener.Routes[j].LoadBalancing = listener.LoadBalancing
+			}
+		}
+	}
+
+	for i := range c.Products {
+		for j := range c.Products[i].Plans {
+			if c.Products[i].Plans[j].QuotaPeriod == "" {
+				c.Products[i].Plans[j].QuotaPeriod = "month"
+			}
+		}
+	}
+
+	if c.Metering.Enabled && c.Metering.Period == 0 {
+		c.Metering.Period = time.Hour
+	}
+
+	if history := &c.Monitoring.History; history.Enabled {
+		if history.Resolution == 0 {
+			history.Resolution = time.Minute
+		}
+		if history.Retention == 0 {
+			history.Retention = 7 * 24 * time.Hour
+		}
+	}
+
+	if c.Consumers.Enabled && c.Consumers.RefreshInterval == 0 {
+		c.Consumers.RefreshInterval = 30 * time.Second
+	}
+
+	if c.Backup.Enabled {
+		if c.Backup.Schedule == "" {
+			c.Backup.Schedule = "@daily"
+		}
+		if len(c.Backup.Sources) == 0 {
+			c.Backup.Sources = []string{"file"}
+		}
+		if s3 := c.Backup.S3; s3 != nil {
+			if s3.Region == "" {
+				s3.Region = "us-east-1"
+			}
+			if s3.Endpoint == "" {
+				s3.Endpoint = "https://s3." + s3.Region + ".amazonaws.com"
+			}
+		}
+	}
+
+	if c.Admin.Sessions.AccessTokenTTL == 0 {
+		c.Admin.Sessions.AccessTokenTTL = 15 * time.Minute
+	}
+	if c.Admin.Sessions.RefreshTokenTTL == 0 {
+		c.Admin.Sessions.RefreshTokenTTL = 7 * 24 * time.Hour
+	}
+
+	if c.Portal.Enabled {
+		if c.Portal.Path == "" {
+			c.Portal.Path = "/portal"
+		}
+		if c.Portal.TokenTTL == 0 {
+			c.Portal.TokenTTL = 24 * time.Hour
+		}
+		if c.Portal.MaxKeysPerUser == 0 {
+			c.Portal.MaxKeysPerUser = 10
+		}
+	}
+}
+
+// ReloadReport describes the outcome of a configuration reload
+type ReloadReport struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requiresRestart"`
+}
+
+// ChangedSections returns the names of the top-level sections that differ
+// between old and new, in the order they are declared. Sections are compared
+// as YAML, so an empty list equals a missing one.
+func ChangedSections(old, new *Config) []string {
+	o, n := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	var changed []string
+	for i := 0; i < o.NumField(); i++ {
+		oldYAML, oldErr := yaml.Marshal(o.Field(i).Interface())
+		newYAML, newErr := yaml.Marshal(n.Field(i).Interface())
+		if oldErr != nil || newErr != nil || string(oldYAML) != string(newYAML) {
+			name, _, _ := strings.Cut(o.Type().Field(i).Tag.Get("yaml"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// Validate checks a configuration for errors that would prevent the gateway from starting
+func Validate(config *Config) error {
+	return validateConfig(config)
+}
+
+// Clone returns a deep copy of the configuration
+func (c *Config) Clone() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	var clone Config
+	if err := yaml.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return &clone, nil
+}
+
+func validateConfig(config *Config) error {
+	if config.Server.Port <= 0 || config.Server.Port > 65535 {
+		return fmt.Errorf("invalid server port: %d", config.Server.Port)
+	}
+
+	limits := config.Server.Limits
+	if limits.MaxURLLength < 0 || limits.MaxQueryParams < 0 || limits.MaxHeaderCount < 0 ||
+		limits.MaxHeaderSize < 0 || limits.MaxHeaderBytes < 0 {
+		return fmt.Errorf("server.limits: limits cannot be negative")
+	}
+
+	if err := validateCompression(config.Server.CompressionOptions); err != nil {
+		return fmt.Errorf("server.compressionOptions: %w", err)
+	}
+
+	if err := validateRequestID(config.Server.RequestID); err != nil {
+		return fmt.Errorf("server.requestId: %w", err)
+	}
+
+	if config.Server.TLS.Enabled {
+		tlsConfig := config.Server.TLS
+		if tlsConfig.Port <= 0 || tlsConfig.Port > 65535 || tlsConfig.Port == config.Server.Port {
+			return fmt.Errorf("server.tls: invalid port %d", tlsConfig.Port)
+		}
+		if len(tlsConfig.Certificates) == 0 && !tlsConfig.ACME.Enabled {
+			return fmt.Errorf("server.tls: at least one certificate is required")
+		}
+		for i, cert := range tlsConfig.Certificates {
+			if cert.CertFile == "" || cert.KeyFile == "" {
+				return fmt.Errorf("server.tls: certificate %d: certFile and keyFile are required", i)
+			}
+		}
+		switch tlsConfig.MinVersion {
+		case "", "1.0", "1.1", "1.2", "1.3":
+		default:
+			return fmt.Errorf("server.tls: unsupported minVersion %q", tlsConfig.MinVersion)
+		}
+		switch tlsConfig.ClientAuth {
+		case "", "none", "request":
+		default:
+			return fmt.Errorf("server.tls: clientAuth must be none or request")
+		}
+		if tlsConfig.ReloadInterval < 0 {
+			return fmt.Errorf("server.tls: reloadInterval cannot be negative")
+		}
+	}
+
+	if acme := config.Server.TLS.ACME; acme.Enabled {
+		if !config.Server.TLS.Enabled {
+			return fmt.Errorf("server.tls.acme: requires server.tls.enabled")
+		}
+		if !acme.AcceptTOS {
+			return fmt.Errorf("server.tls.acme: acceptTos must be true to register with the CA")
+		}
+		if len(acme.Domains) == 0 {
+			return fmt.Errorf("server.tls.acme: at least one domain is required")
+		}
+		switch acme.Challenge {
+		case "http-01":
+			for _, domain := range acme.Domains {
+				if strings.HasPrefix(domain, "*.") {
+					return fmt.Errorf("server.tls.acme: wildcard domain %s requires the dns-01 challenge", domain)
+				}
+			}
+		case "dns-01":
+			switch acme.DNS.Provider {
+			case "webhook":
+				if acme.DNS.WebhookURL == "" {
+					return fmt.Errorf("server.tls.acme: dns.webhookUrl cannot be empty")
+				}
+			case "cloudflare":
+				if acme.DNS.APIToken == "" {
+					return fmt.Errorf("server.tls.acme: dns.apiToken cannot be empty")
+				}
+			default:
+				return fmt.Errorf("server.tls.acme: unsupported dns provider %q (expected webhook or cloudflare)", acme.DNS.Provider)
+			}
+		default:
+			return fmt.Errorf("server.tls.acme: unsupported challenge %q (expected http-01 or dns-01)", acme.Challenge)
+		}
+		if acme.Storage != "disk" && acme.Storage != "mongodb" {
+			return fmt.Errorf("server.tls.acme: unsupported storage %q (expected disk or mongodb)", acme.Storage)
+		}
+		if acme.Storage == "mongodb" && !config.MongoDB.Enabled {
+			return fmt.Errorf("server.tls.acme: mongodb storage requires mongodb.enabled")
+		}
+	}
+
+	for _, service := range config.Services {
+		if service.Name == "" {
+			return fmt.Errorf("service name cannot be empty")
 		}
 		if service.BasePath == "" {
 			return fmt.Errorf("service %s: basePath cannot be empty", service.Name)
 		}
-		if len(service.Targets) == 0 {
+		if service.CORS != nil {
+			if len(service.CORS.AllowOrigins) == 0 {
+				return fmt.Errorf("service %s: cors.allowOrigins cannot be empty", service.Name)
+			}
+			if service.CORS.AllowCredentials {
+				for _, origin := range service.CORS.AllowOrigins {
+					if origin == "*" {
+						return fmt.Errorf("service %s: cors.allowCredentials cannot be combined with origin \"*\"", service.Name)
+					}
+				}
+			}
+			if service.CORS.MaxAge < 0 {
+				return fmt.Errorf("service %s: cors.maxAge cannot be negative", service.Name)
+			}
+		}
+		if hc := service.HealthCheck; hc != nil {
+			switch hc.Type {
+			case "", "http", "tcp", "grpc":
+			default:
+				return fmt.Errorf("service %s: healthCheck: unsupported type %q (expected http, tcp or grpc)", service.Name, hc.Type)
+			}
+			if p := hc.Passive; p != nil && (p.Failures < 0 || p.Decay < 0) {
+				return fmt.Errorf("service %s: healthCheck.passive: values cannot be negative", service.Name)
+			}
+		}
+		for i, tmpl := range service.Transform.Templates {
+			if tmpl.Request == "" && tmpl.Response == "" {
+				return fmt.Errorf("service %s: transform.templates[%d]: request or response must be set", service.Name, i)
+			}
+			if tmpl.Path != "" && !strings.HasPrefix(tmpl.Path, "/") {
+				return fmt.Errorf("service %s: transform.templates[%d]: path must start with /", service.Name, i)
+			}
+		}
+		for i, rule := range service.ResponseFields {
+			if len(rule.Fields) == 0 {
+				return fmt.Errorf("service %s: responseFields[%d]: fields cannot be empty", service.Name, i)
+			}
+			if rule.Path != "" && !strings.HasPrefix(rule.Path, "/") {
+				return fmt.Errorf("service %s: responseFields[%d]: path must start with /", service.Name, i)
+			}
+		}
+		if hr := service.HeaderRules; hr != nil {
+			if err := validateHeaderRules(hr.Request); err != nil {
+				return fmt.Errorf("service %s: headerRules.request: %w", service.Name, err)
+			}
+			if err := validateHeaderRules(hr.Response); err != nil {
+				return fmt.Errorf("service %s: headerRules.response: %w", service.Name, err)
+			}
+		}
+		if x := service.Transform.XML; x != nil {
+			if err := validateXMLTransform(x); err != nil {
+				return fmt.Errorf("service %s: transform.xml: %w", service.Name, err)
+			}
+		}
+		if service.DLP != nil {
+			if err := validateDLP(service.DLP); err != nil {
+				return fmt.Errorf("service %s: dlp: %w", service.Name, err)
+			}
+		}
+		if t := service.Transport; t != nil {
+			if t.MaxIdleConnsPerHost < 0 || t.IdleConnTimeout < 0 || t.DialTimeout < 0 || t.TLSHandshakeTimeout < 0 {
+				return fmt.Errorf("service %s: transport: values cannot be negative", service.Name)
+			}
+			if t.TLS != nil && (t.TLS.CertFile == "") != (t.TLS.KeyFile == "") {
+				return fmt.Errorf("service %s: transport.tls: certFile and keyFile must be set together", service.Name)
+			}
+			if t.Proxy != nil {
+				if err := validateEgressProxy(t.Proxy); err != nil {
+					return fmt.Errorf("service %s: transport.proxy: %w", service.Name, err)
+				}
+			}
+		}
+		if b := service.Backpressure; b != nil && b.MaxDelay < 0 {
+			return fmt.Errorf("service %s: backpressure: maxDelay cannot be negative", service.Name)
+		}
+		if a := service.Async; a != nil {
+			if err := validateServiceAsync(a, service); err != nil {
+				return fmt.Errorf("service %s: async: %w", service.Name, err)
+			}
+		}
+		if service.Protocol == "soap" {
+			if service.SOAP == nil || len(service.SOAP.Operations) == 0 {
+				return fmt.Errorf("service %s: soap: at least one operation is required", service.Name)
+			}
+			if err := validateSOAP(service.SOAP); err != nil {
+				return fmt.Errorf("service %s: soap: %w", service.Name, err)
+			}
+		}
+		if service.Protocol == "graphql" && service.GraphQL != nil && service.GraphQL.Federation != nil {
+			if err := validateGraphQLFederation(service.GraphQL.Federation); err != nil {
+				return fmt.Errorf("service %s: graphql: federation: %w", service.Name, err)
+			}
+		}
+		if service.Protocol == "grpc" && service.GRPC != nil {
+			if err := validateGRPC(service.GRPC); err != nil {
+				return fmt.Errorf("service %s: grpc: %w", service.Name, err)
+			}
+		}
+		if m := service.MQTT; m != nil {
+			if err := validateMQTT(m); err != nil {
+				return fmt.Errorf("service %s: mqtt: %w", service.Name, err)
+			}
+		}
+		if service.Protocol == "websocket" && (len(service.Targets) == 0 || service.Mock != nil) {
+			return fmt.Errorf("service %s: websocket services need targets and cannot be mocked", service.Name)
+		}
+		if ws := service.WebSocket; ws != nil {
+			if ws.MaxConnections < 0 || ws.MaxConnectionsPerIP < 0 || ws.MaxMessageSize < 0 || ws.IdleTimeout < 0 {
+				return fmt.Errorf("service %s: websocket: values cannot be negative", service.Name)
+			}
+		}
+		if service.StreamThreshold < 0 {
+			return fmt.Errorf("service %s: streamThreshold cannot be negative", service.Name)
+		}
+		if s := service.Streaming; s != nil && (s.FlushInterval < 0 || s.MaxDuration < 0) {
+			return fmt.Errorf("service %s: streaming: durations cannot be negative", service.Name)
+		}
+		if l := service.Limits; l != nil && (l.MaxRequestBodySize < 0 || l.MaxHeaderBytes < 0 || l.MaxResponseBodySize < 0) {
+			return fmt.Errorf("service %s: limits: values cannot be negative", service.Name)
+		}
+		if a := service.Auth; a != nil {
+			if err := validateServiceAuth(a, config); err != nil {
+				return fmt.Errorf("service %s: auth: %w", service.Name, err)
+			}
+		}
+		if service.Versioning != nil {
+			if err := validateVersioning(service.Versioning); err != nil {
+				return fmt.Errorf("service %s: versioning: %w", service.Name, err)
+			}
+		}
+		if service.IPFilter != nil {
+			if err := validateCIDRs(append(service.IPFilter.Allow, service.IPFilter.Deny...)); err != nil {
+				return fmt.Errorf("service %s: ipFilter: %w", service.Name, err)
+			}
+		}
+		if service.Mock != nil {
+			if err := validateMock(service.Mock); err != nil {
+				return fmt.Errorf("service %s: mock: %w", service.Name, err)
+			}
+		}
+		if len(service.Policies) > 0 {
+			if err := validatePolicies(service.Policies); err != nil {
+				return fmt.Errorf("service %s: policies: %w", service.Name, err)
+			}
+		}
+		if service.Fault != nil {
+			if err := ValidateFault(*service.Fault); err != nil {
+				return fmt.Errorf("service %s: fault: %w", service.Name, err)
+			}
+		}
+		if service.Experiment != nil {
+			if err := ValidateExperiment(service.Experiment); err != nil {
+				return fmt.Errorf("service %s: experiment: %w", service.Name, err)
+			}
+		}
+		for _, target := range service.Targets {
+			if !strings.HasPrefix(target, "dns://") && !strings.HasPrefix(target, "dns+srv://") {
+				continue
+			}
+			if service.Protocol != "" && service.Protocol != "http" && service.Protocol != "websocket" {
+				return fmt.Errorf("service %s: DNS targets are only supported for http and websocket services", service.Name)
+			}
+			if err := validateDNSTarget(target); err != nil {
+				return fmt.Errorf("service %s: %w", service.Name, err)
+			}
+		}
+		if service.Static != nil || service.Redirect != nil {
+			if err := validateFixedService(service); err != nil {
+				return fmt.Errorf("service %s: %w", service.Name, err)
+			}
+			continue
+		}
+		// Mocked services answer requests themselves, so they may not have a
+		// backend yet; federated GraphQL services query their subgraphs
+		federated := service.Protocol == "graphql" && service.GraphQL != nil && service.GraphQL.Federation != nil
+		if len(service.Targets) == 0 && !federated && (service.Mock == nil || service.Mock.Passthrough) {
 			return fmt.Errorf("service %s: at least one target must be specified", service.Name)
 		}
 	}
 
+	if err := validateDiscovery(config.Discovery); err != nil {
+		return fmt.Errorf("discovery: %w", err)
+	}
+
+	if err := validateFeatureFlags(config); err != nil {
+		return err
+	}
+
+	if err := validateRateLimit(config.RateLimit); err != nil {
+		return fmt.Errorf("rateLimit: %w", err)
+	}
+
+	if err := validateAsync(config); err != nil {
+		return fmt.Errorf("async: %w", err)
+	}
+
+	if config.Auth.Revocation.Enabled {
+		if err := validateRevocation(config); err != nil {
+			return fmt.Errorf("auth: revocation: %w", err)
+		}
+	}
+
+	if err := validateOIDC(config.Auth.OIDC); err != nil {
+		return fmt.Errorf("auth: oidc: %w", err)
+	}
+
+	if err := validateHMAC(config.Auth.HMAC); err != nil {
+		return fmt.Errorf("auth: hmac: %w", err)
+	}
+
+	if config.Scheduler.Enabled {
+		if err := validateScheduler(config); err != nil {
+			return fmt.Errorf("scheduler: %w", err)
+		}
+	}
+
+	if config.Tracing.Logs.Enabled {
+		if err := validateTracingLogs(config.Tracing.Logs); err != nil {
+			return fmt.Errorf("tracing: logs: %w", err)
+		}
+	}
+
+	if config.OpenAPI.UIEnabled {
+		if err := validateOpenAPIUI(config); err != nil {
+			return fmt.Errorf("openapi: %w", err)
+		}
+	}
+
+	if config.Faults.Enabled && config.Faults.Environment == "" {
+		return fmt.Errorf("faults: environment is required")
+	}
+
+	if config.GeoIP.Enabled {
+		if err := validateGeoIP(config.GeoIP); err != nil {
+			return fmt.Errorf("geoip: %w", err)
+		}
+	}
+
+	if config.GitOps.Enabled && config.GitOps.Repository == "" {
+		return fmt.Errorf("gitops: repository cannot be empty")
+	}
+
+	for _, slack := range config.Monitoring.Alerts.Slack {
+		if slack.WebhookURL == "" {
+			return fmt.Errorf("monitoring.alerts.slack %s: webhookUrl cannot be empty", slack.Name)
+		}
+		if err := validateAlertRouting(slack.AlertRouting); err != nil {
+			return fmt.Errorf("monitoring.alerts.slack %s: %w", slack.Name, err)
+		}
+	}
+	for _, teams := range config.Monitoring.Alerts.Teams {
+		if teams.WebhookURL == "" {
+			return fmt.Errorf("monitoring.alerts.teams %s: webhookUrl cannot be empty", teams.Name)
+		}
+		if err := validateAlertRouting(teams.AlertRouting); err != nil {
+			return fmt.Errorf("monitoring.alerts.teams %s: %w", teams.Name, err)
+		}
+	}
+	for _, pd := range config.Monitoring.Alerts.PagerDuty {
+		if pd.RoutingKey == "" {
+			return fmt.Errorf("monitoring.alerts.pagerduty %s: routingKey cannot be empty", pd.Name)
+		}
+		if err := validateAlertRouting(pd.AlertRouting); err != nil {
+			return fmt.Errorf("monitoring.alerts.pagerduty %s: %w", pd.Name, err)
+		}
+	}
+
+	if config.Streaming.Enabled {
+		switch config.Streaming.Backend {
+		case "kafka":
+			if config.Streaming.Kafka.RestProxyURL == "" {
+				return fmt.Errorf("streaming: kafka.restProxyUrl cannot be empty")
+			}
+		case "nats":
+			if config.Streaming.NATS.URL == "" {
+				return fmt.Errorf("streaming: nats.url cannot be empty")
+			}
+		default:
+			return fmt.Errorf("streaming: unsupported backend %q (expected kafka or nats)", config.Streaming.Backend)
+		}
+		if config.Streaming.Schema != "" && config.Streaming.Schema != "json" && config.Streaming.Schema != "cloudevents" {
+			return fmt.Errorf("streaming: unsupported schema %q (expected json or cloudevents)", config.Streaming.Schema)
+		}
+	}
+
+	ipLists := append(append(append([]string{}, config.IPFilter.Allow...), config.IPFilter.Deny...), config.IPFilter.TrustedProxies...)
+	if err := validateCIDRs(ipLists); err != nil {
+		return fmt.Errorf("ipFilter: %w", err)
+	}
+
+	if config.Bot.Enabled {
+		thresholds := config.Bot.Thresholds
+		for name, value := range map[string]int{
+			"tag":       thresholds.Tag,
+			"challenge": thresholds.Challenge,
+			"throttle":  thresholds.Throttle,
+			"block":     thresholds.Block,
+		} {
+			if value < 0 || value > 100 {
+				return fmt.Errorf("bot: thresholds.%s must be between 0 and 100", name)
+			}
+		}
+		if config.Bot.ThrottleRPM < 0 || config.Bot.CadenceLimit < 0 {
+			return fmt.Errorf("bot: throttleRpm and cadenceLimit cannot be negative")
+		}
+	}
+
+	if ws := config.WebSocket; ws.MaxConnections < 0 || ws.MaxConnectionsPerIP < 0 || ws.MaxMessageSize < 0 || ws.IdleTimeout < 0 {
+		return fmt.Errorf("websocket: values cannot be negative")
+	}
+
+	if err := validateTCP(config.TCP, config.Server); err != nil {
+		return fmt.Errorf("tcp: %w", err)
+	}
+
+	if err := validateProducts(config.Products, config.Services); err != nil {
+		return fmt.Errorf("products: %w", err)
+	}
+
+	if config.Portal.Enabled {
+		if err := validatePortal(config.Portal, config); err != nil {
+			return fmt.Errorf("portal: %w", err)
+		}
+	}
+
+	if config.Metering.Enabled {
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("metering: requires mongodb to be enabled")
+		}
+		period := config.Metering.Period
+		if period < time.Minute || (24*time.Hour)%period != 0 {
+			return fmt.Errorf("metering: period must be at least 1m and divide a day")
+		}
+		if config.Metering.Retention < 0 {
+			return fmt.Errorf("metering: retention cannot be negative")
+		}
+	}
+
+	if err := validateProbes(config); err != nil {
+		return fmt.Errorf("monitoring.probes: %w", err)
+	}
+
+	if history := config.Monitoring.History; history.Enabled {
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("monitoring.history: requires mongodb to be enabled")
+		}
+		if history.Resolution < time.Second || history.Retention < history.Resolution {
+			return fmt.Errorf("monitoring.history: resolution must be at least 1s and retention at least one resolution")
+		}
+	}
+
+	if config.Consumers.Enabled {
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("consumers: requires mongodb to be enabled")
+		}
+		if config.Consumers.RefreshInterval < time.Second {
+			return fmt.Errorf("consumers: refreshInterval must be at least 1s")
+		}
+	}
+
+	if config.Backup.Enabled {
+		if err := validateBackup(config.Backup, config); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+
+	if err := validateErrorPages(config.ErrorPages); err != nil {
+		return fmt.Errorf("errorPages: %w", err)
+	}
+	for _, service := range config.Services {
+		if service.ErrorPages == nil {
+			continue
+		}
+		if err := validateErrorPages(*service.ErrorPages); err != nil {
+			return fmt.Errorf("service %s: errorPages: %w", service.Name, err)
+		}
+	}
+
+	if err := validateAdminAccess(config.Admin); err != nil {
+		return err
+	}
+
+	if config.Overload.Enabled {
+		overload := config.Overload
+		if overload.MaxConcurrent <= 0 || overload.MaxQueue < 0 {
+			return fmt.Errorf("overload: maxConcurrent must be positive and maxQueue cannot be negative")
+		}
+		if overload.MaxQueueTime < 0 || overload.TargetDelay < 0 || overload.Interval < 0 || overload.RetryAfter < 0 {
+			return fmt.Errorf("overload: durations cannot be negative")
+		}
+		for i, class := range overload.Classes {
+			if class.Name == "" {
+				return fmt.Errorf("overload: class %d: name cannot be empty", i)
+			}
+		}
+	}
+
+	switch config.Logging.AccessLog {
+	case "", "default", "fast", "off":
+	default:
+		return fmt.Errorf("logging: unsupported accessLog %q (expected default, fast or off)", config.Logging.AccessLog)
+	}
+
+	if config.Runtime.MaxProcs < 0 {
+		return fmt.Errorf("runtime: maxProcs cannot be negative")
+	}
+	if _, err := config.Runtime.MemoryLimitBytes(); err != nil {
+		return fmt.Errorf("runtime: %w", err)
+	}
+	if config.Runtime.MemoryLimitRatio < 0 || config.Runtime.MemoryLimitRatio > 1 {
+		return fmt.Errorf("runtime: memoryLimitRatio must be between 0 and 1")
+	}
+
+	for i, webhook := range config.Events.Webhooks {
+		if webhook.URL == "" {
+			return fmt.Errorf("events: webhook %d (%s): url cannot be empty", i, webhook.Name)
+		}
+	}
+
+	return nil
+}
+
+func validateBackup(backup BackupConfig, config *Config) error {
+	for _, source := range backup.Sources {
+		switch source {
+		case "file":
+		case "mongodb":
+			if !config.MongoDB.Enabled {
+				return fmt.Errorf("the mongodb source requires mongodb to be enabled")
+			}
+		default:
+			return fmt.Errorf("unsupported source %q (expected file or mongodb)", source)
+		}
+	}
+	if backup.MaxCount < 0 || backup.MaxAge < 0 {
+		return fmt.Errorf("maxCount and maxAge cannot be negative")
+	}
+	if s3 := backup.S3; s3 != nil {
+		if s3.Bucket == "" {
+			return fmt.Errorf("s3: bucket cannot be empty")
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return fmt.Errorf("s3: accessKeyId and secretAccessKey are required")
+		}
+	}
+	return nil
+}
+
+func validateErrorPages(pages ErrorPagesConfig) error {
+	switch pages.Format {
+	case "", "json", "html":
+	default:
+		return fmt.Errorf("unsupported format %q (expected json or html)", pages.Format)
+	}
+	for key := range pages.Templates {
+		switch key {
+		case "default", "4xx", "5xx":
+			continue
+		}
+		if code, err := strconv.Atoi(key); err != nil || code < 400 || code > 599 {
+			return fmt.Errorf("invalid template key %q (expected a 4xx or 5xx status code, 4xx, 5xx or default)", key)
+		}
+	}
+	return nil
+}
+
+func validateAdminAccess(admin AdminConfig) error {
+	names := make(map[string]bool)
+	usernames := map[string]bool{admin.Username: true}
+	for i, ns := range admin.Namespaces {
+		if ns.Name == "" || strings.ContainsAny(ns.Name, "/ ") {
+			return fmt.Errorf("admin.namespaces: namespace %d: invalid name %q", i, ns.Name)
+		}
+		if names[ns.Name] {
+			return fmt.Errorf("admin.namespaces: duplicate namespace %s", ns.Name)
+		}
+		names[ns.Name] = true
+		if ns.Username == "" || ns.Password == "" {
+			return fmt.Errorf("admin.namespaces: %s: username and password are required", ns.Name)
+		}
+		if usernames[ns.Username] {
+			return fmt.Errorf("admin.namespaces: %s: username %s is already used", ns.Name, ns.Username)
+		}
+		usernames[ns.Username] = true
+	}
+
+	tokens := make(map[string]bool)
+	for i, token := range admin.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("admin.tokens: token %d: name cannot be empty", i)
+		}
+		if tokens[token.Name] {
+			return fmt.Errorf("admin.tokens: duplicate token %s", token.Name)
+		}
+		tokens[token.Name] = true
+		if !sha256Pattern.MatchString(token.SHA256) {
+			return fmt.Errorf("admin.tokens: %s: sha256 must be 64 hexadecimal characters", token.Name)
+		}
+	}
+
+	sessions := admin.Sessions
+	if sessions.AccessTokenTTL < 0 || sessions.RefreshTokenTTL < 0 {
+		return fmt.Errorf("admin.sessions: token lifetimes cannot be negative")
+	}
+	if sessions.RefreshTokenTTL > 0 && sessions.RefreshTokenTTL < sessions.AccessTokenTTL {
+		return fmt.Errorf("admin.sessions: refreshTokenTTL cannot be shorter than accessTokenTTL")
+	}
+	return nil
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+func validateAlertRouting(routing AlertRouting) error {
+	for _, severity := range routing.Severities {
+		switch severity {
+		case "info", "warning", "critical":
+		default:
+			return fmt.Errorf("unknown severity %q", severity)
+		}
+	}
+	return nil
+}
+
+// validateCIDRs checks that every entry is a CIDR or a single IP address
+// validateProbes checks that critical services exist and have health checks
+func validateProbes(config *Config) error {
+	probes := config.Monitoring.Probes
+	for _, path := range []string{probes.LivenessPath, probes.ReadinessPath} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("path %q must start with /", path)
+		}
+	}
+	for _, dependency := range probes.IgnoreDependencies {
+		switch dependency {
+		case "mongodb", "cache", "rateLimit":
+		default:
+			return fmt.Errorf("unknown dependency %q (expected mongodb, cache or rateLimit)", dependency)
+		}
+	}
+	for _, critical := range probes.CriticalServices {
+		var service *ServiceConfig
+		for i := range config.Services {
+			if config.Services[i].Name == critical.Name {
+				service = &config.Services[i]
+			}
+		}
+		if service == nil {
+			return fmt.Errorf("critical service %s does not exist", critical.Name)
+		}
+		if service.HealthCheck == nil || !service.HealthCheck.Enabled {
+			return fmt.Errorf("critical service %s needs healthCheck enabled", critical.Name)
+		}
+		if critical.MinHealthyTargets < 0 || critical.MinHealthyTargets > len(service.Targets) {
+			return fmt.Errorf("critical service %s: minHealthyTargets must be between 1 and its %d targets", critical.Name, len(service.Targets))
+		}
+	}
+	return nil
+}
+
+func validateHeaderRules(rules []HeaderRuleConfig) error {
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name cannot be empty", i)
+		}
+		switch rule.Action {
+		case "add", "set", "remove":
+		case "rename", "copy-from-claim", "copy-from-header":
+			if rule.From == "" {
+				return fmt.Errorf("rule %d: from is required for %s", i, rule.Action)
+			}
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i, rule.Action)
+		}
+		if rule.Path != "" && !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("rule %d: path must start with /", i)
+		}
+	}
+	return nil
+}
+
+func validateXMLTransform(x *XMLTransformConfig) error {
+	if x.Request == "" && x.Response == "" {
+		return fmt.Errorf("request or response must be set")
+	}
+	for _, conversion := range []string{x.Request, x.Response} {
+		switch conversion {
+		case "", "json-to-xml", "xml-to-json":
+		default:
+			return fmt.Errorf("unknown conversion %q (expected json-to-xml or xml-to-json)", conversion)
+		}
+	}
+	if x.AttributePrefix != "" && x.AttributePrefix == x.TextKey {
+		return fmt.Errorf("attributePrefix and textKey must differ")
+	}
+	return nil
+}
+
+func validateDLP(dlp *DLPConfig) error {
+	for i, rule := range dlp.Rules {
+		if len(rule.Fields) == 0 && rule.Detector == "" {
+			return fmt.Errorf("rule %d: fields or detector must be set", i)
+		}
+		switch rule.Detector {
+		case "", "pan", "ssn", "email":
+		case "regex":
+			if rule.Pattern == "" {
+				return fmt.Errorf("rule %s: pattern is required for the regex detector", rule.Name)
+			}
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("rule %s: invalid pattern: %w", rule.Name, err)
+			}
+		default:
+			return fmt.Errorf("rule %s: unknown detector %q", rule.Name, rule.Detector)
+		}
+		if rule.Action != "mask" && rule.Action != "drop" {
+			return fmt.Errorf("rule %s: action must be mask or drop", rule.Name)
+		}
+		if rule.KeepLast < 0 {
+			return fmt.Errorf("rule %s: keepLast cannot be negative", rule.Name)
+		}
+	}
+	return nil
+}
+
+func validateMock(m *MockConfig) error {
+	if !m.FromSpec && len(m.Routes) == 0 {
+		return fmt.Errorf("fromSpec or at least one route is required")
+	}
+	if m.Latency < 0 || m.Jitter < 0 {
+		return fmt.Errorf("latency and jitter cannot be negative")
+	}
+	for i, route := range m.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %d: path must start with /", i)
+		}
+		if route.Status != 0 && (route.Status < 100 || route.Status > 599) {
+			return fmt.Errorf("route %d: invalid status %d", i, route.Status)
+		}
+		if route.Latency != nil && *route.Latency < 0 {
+			return fmt.Errorf("route %d: latency cannot be negative", i)
+		}
+	}
+	return nil
+}
+
+// validateFixedService checks a service that answers with a static response
+// or a redirect instead of proxying
+func validateFixedService(service ServiceConfig) error {
+	if service.Static != nil && service.Redirect != nil {
+		return fmt.Errorf("static and redirect cannot be combined")
+	}
+	if len(service.Targets) > 0 || service.Mock != nil {
+		return fmt.Errorf("static and redirect services cannot have targets or a mock")
+	}
+	if service.Protocol != "" && service.Protocol != "http" {
+		return fmt.Errorf("static and redirect services must use the http protocol")
+	}
+	if static := service.Static; static != nil {
+		if static.Status != 0 && (static.Status < 200 || static.Status > 599) {
+			return fmt.Errorf("static: invalid status %d", static.Status)
+		}
+		return nil
+	}
+	switch service.Redirect.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("redirect: status must be 301, 302, 303, 307 or 308")
+	}
+	if service.Redirect.Location == "" {
+		return fmt.Errorf("redirect: location is required")
+	}
+	return nil
+}
+
+func validateVersioning(v *VersioningConfig) error {
+	switch v.Strategy {
+	case "path", "header", "mediaType":
+	default:
+		return fmt.Errorf("unsupported strategy %q (expected path, header or mediaType)", v.Strategy)
+	}
+	if len(v.Versions) == 0 {
+		return fmt.Errorf("at least one version is required")
+	}
+	names := make(map[string]bool)
+	for _, version := range v.Versions {
+		if version.Name == "" || strings.ContainsAny(version.Name, "/;,+ ") {
+			return fmt.Errorf("invalid version name %q", version.Name)
+		}
+		name := strings.TrimPrefix(strings.ToLower(version.Name), "v")
+		if names[name] {
+			return fmt.Errorf("duplicate version %s", version.Name)
+		}
+		names[name] = true
+		if !version.DeprecatedAt.IsZero() && !version.Sunset.IsZero() && version.Sunset.Before(version.DeprecatedAt) {
+			return fmt.Errorf("version %s: sunset cannot be before deprecatedAt", version.Name)
+		}
+	}
+	if v.Default != "" && !names[strings.TrimPrefix(strings.ToLower(v.Default), "v")] {
+		return fmt.Errorf("default version %s is not defined", v.Default)
+	}
+	return nil
+}
+
+func validateMQTT(m *MQTTConfig) error {
+	if m.Auth != "" && m.Auth != "jwt" && m.Auth != "apiKey" {
+		return fmt.Errorf("auth must be jwt or apiKey")
+	}
+	if m.ConnectTimeout < 0 || m.MaxPacketSize < 0 {
+		return fmt.Errorf("connectTimeout and maxPacketSize cannot be negative")
+	}
+	for i, rule := range m.ACL {
+		if rule.Topic == "" {
+			return fmt.Errorf("acl %d: topic cannot be empty", i)
+		}
+		switch rule.Access {
+		case "", "publish", "subscribe", "all":
+		default:
+			return fmt.Errorf("acl %s: access must be publish, subscribe or all", rule.Topic)
+		}
+	}
+	return nil
+}
+
+func validateSOAP(s *SOAPConfig) error {
+	if s.Version != "" && s.Version != "1.1" && s.Version != "1.2" {
+		return fmt.Errorf("version must be 1.1 or 1.2")
+	}
+	if s.MaxResponseSize < 0 {
+		return fmt.Errorf("maxResponseSize cannot be negative")
+	}
+	routes := make(map[string]bool)
+	for i, op := range s.Operations {
+		if op.Name == "" {
+			return fmt.Errorf("operation %d: name cannot be empty", i)
+		}
+		if strings.TrimSpace(op.Request) == "" {
+			return fmt.Errorf("operation %s: request template cannot be empty", op.Name)
+		}
+		method := strings.ToUpper(op.Method)
+		if method == "" {
+			method = "POST"
+		}
+		path := op.Path
+		if path == "" {
+			path = "/" + op.Name
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("operation %s: path must start with /", op.Name)
+		}
+		if routes[method+" "+path] {
+			return fmt.Errorf("operation %s: %s %s is used by another operation", op.Name, method, path)
+		}
+		routes[method+" "+path] = true
+	}
+	return nil
+}
+
+func validateCompression(c CompressionConfig) error {
+	for _, encoding := range c.Encodings {
+		switch encoding {
+		case "br", "zstd", "gzip":
+		default:
+			return fmt.Errorf("unsupported encoding %q (expected br, zstd or gzip)", encoding)
+		}
+	}
+	if c.MinSize < 0 {
+		return fmt.Errorf("minSize cannot be negative")
+	}
+	if c.GzipLevel < 0 || c.GzipLevel > 9 {
+		return fmt.Errorf("gzipLevel must be between 1 and 9")
+	}
+	if c.BrotliLevel < 0 || c.BrotliLevel > 11 {
+		return fmt.Errorf("brotliLevel must be between 1 and 11")
+	}
+	if c.ZstdLevel < 0 || c.ZstdLevel > 22 {
+		return fmt.Errorf("zstdLevel must be between 1 and 22")
+	}
+	return nil
+}
+
+func validateEgressProxy(p *EgressProxyConfig) error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("url must be an http, https, socks5 or socks5h URL")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url must include a host")
+	}
+	if p.Password != "" && p.Username == "" {
+		return fmt.Errorf("password requires a username")
+	}
+	for _, entry := range p.NoProxy {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("noProxy entries cannot be empty")
+		}
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(entry)); err != nil {
+				return fmt.Errorf("invalid noProxy CIDR %q", entry)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRequestID(r RequestIDConfig) error {
+	switch r.Format {
+	case "", "uuidv4", "uuidv7", "ulid":
+	default:
+		return fmt.Errorf("unsupported format %q (expected uuidv4, uuidv7 or ulid)", r.Format)
+	}
+	if r.Header != "" && !httpguts.ValidHeaderFieldName(r.Header) {
+		return fmt.Errorf("invalid header name %q", r.Header)
+	}
+	switch r.Trust {
+	case "", "all", "none":
+		if len(r.TrustedNetworks) > 0 {
+			return fmt.Errorf("trustedNetworks require trust: networks")
+		}
+	case "networks":
+		if len(r.TrustedNetworks) == 0 {
+			return fmt.Errorf("trust: networks requires trustedNetworks")
+		}
+	default:
+		return fmt.Errorf("unsupported trust %q (expected all, none or networks)", r.Trust)
+	}
+	return validateCIDRs(r.TrustedNetworks)
+}
+
+func validateGraphQLFederation(f *GraphQLFederationConfig) error {
+	if len(f.Subgraphs) == 0 {
+		return fmt.Errorf("at least one subgraph is required")
+	}
+	subgraphs := make(map[string]bool)
+	for i, subgraph := range f.Subgraphs {
+		if subgraph.Name == "" {
+			return fmt.Errorf("subgraph %d: name is required", i)
+		}
+		if subgraphs[subgraph.Name] {
+			return fmt.Errorf("subgraph %s: duplicate name", subgraph.Name)
+		}
+		subgraphs[subgraph.Name] = true
+		if u, err := url.Parse(subgraph.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("subgraph %s: url must be an http or https URL", subgraph.Name)
+		}
+	}
+	links := make(map[string]bool)
+	for i, link := range f.Links {
+		if link.Type == "" || link.Field == "" || link.Query == "" {
+			return fmt.Errorf("link %d: type, field and query are required", i)
+		}
+		if !subgraphs[link.Subgraph] {
+			return fmt.Errorf("link %s.%s: unknown subgraph %q", link.Type, link.Field, link.Subgraph)
+		}
+		if links[link.Type+"."+link.Field] {
+			return fmt.Errorf("link %s.%s: duplicate link", link.Type, link.Field)
+		}
+		links[link.Type+"."+link.Field] = true
+		if len(link.Arguments) == 0 {
+			return fmt.Errorf("link %s.%s: at least one argument is required", link.Type, link.Field)
+		}
+	}
+	return nil
+}
+
+func validateGRPC(g *GRPCConfig) error {
+	if g.StreamTimeout < 0 {
+		return fmt.Errorf("streamTimeout cannot be negative")
+	}
+	if g.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("maxConcurrentStreams cannot be negative")
+	}
+	if len(g.Routes) == 0 {
+		return nil
+	}
+	if len(g.DescriptorSets) == 0 && !g.EnableReflection {
+		return fmt.Errorf("descriptorSets or enableReflection are required for routes")
+	}
+	routes := make(map[string]bool)
+	for i, route := range g.Routes {
+		if !strings.Contains(route.RPC, "/") {
+			return fmt.Errorf("route %d: rpc must be a full method name such as package.Service/Method", i)
+		}
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %d: path must start with /", i)
+		}
+		method := strings.ToUpper(route.Method)
+		if method == "" {
+			method = "POST"
+		}
+		if routes[method+" "+route.Path] {
+			return fmt.Errorf("route %d: %s %s is used by another route", i, method, route.Path)
+		}
+		routes[method+" "+route.Path] = true
+	}
+	return nil
+}
+
+func validateTCP(tcp TCPConfig, server ServerConfig) error {
+	names := make(map[string]bool)
+	ports := map[int]bool{server.Port: true}
+	if server.TLS.Enabled {
+		ports[server.TLS.Port] = true
+	}
+	for i, listener := range tcp.Listeners {
+		if listener.Name == "" || strings.ContainsAny(listener.Name, ",= ") {
+			return fmt.Errorf("listener %d: name must be set and cannot contain commas, '=' or spaces", i)
+		}
+		if names[listener.Name] {
+			return fmt.Errorf("listener %s: duplicate name", listener.Name)
+		}
+		names[listener.Name] = true
+		if listener.Port <= 0 || listener.Port > 65535 {
+			return fmt.Errorf("listener %s: invalid port %d", listener.Name, listener.Port)
+		}
+		if ports[listener.Port] {
+			return fmt.Errorf("listener %s: port %d is already in use", listener.Name, listener.Port)
+		}
+		ports[listener.Port] = true
+		switch listener.Mode {
+		case "", "tcp":
+			if len(listener.Targets) == 0 {
+				return fmt.Errorf("listener %s: at least one target must be specified", listener.Name)
+			}
+			if len(listener.Routes) > 0 {
+				return fmt.Errorf("listener %s: routes require mode tls-passthrough", listener.Name)
+			}
+		case "tls-passthrough":
+			if len(listener.Routes) == 0 {
+				return fmt.Errorf("listener %s: at least one route must be specified", listener.Name)
+			}
+		default:
+			return fmt.Errorf("listener %s: mode must be tcp or tls-passthrough", listener.Name)
+		}
+		if err := validateTCPPool(listener.Targets, listener.LoadBalancing); err != nil {
+			return fmt.Errorf("listener %s: %w", listener.Name, err)
+		}
+		serverNames := make(map[string]bool)
+		for j, route := range listener.Routes {
+			if len(route.ServerNames) == 0 {
+				return fmt.Errorf("listener %s: route %d: at least one server name must be specified", listener.Name, j)
+			}
+			for _, name := range route.ServerNames {
+				name = strings.ToLower(name)
+				if !validServerName(name) {
+					return fmt.Errorf("listener %s: route %d: invalid server name %q", listener.Name, j, name)
+				}
+				if serverNames[name] {
+					return fmt.Errorf("listener %s: route %d: server name %q is used by another route", listener.Name, j, name)
+				}
+				serverNames[name] = true
+			}
+			if len(route.Targets) == 0 {
+				return fmt.Errorf("listener %s: route %d: at least one target must be specified", listener.Name, j)
+			}
+			if err := validateTCPPool(route.Targets, route.LoadBalancing); err != nil {
+				return fmt.Errorf("listener %s: route %d: %w", listener.Name, j, err)
+			}
+		}
+		if listener.ConnectTimeout < 0 || listener.ClientHelloTimeout < 0 || listener.IdleTimeout < 0 || listener.MaxConnections < 0 {
+			return fmt.Errorf("listener %s: values cannot be negative", listener.Name)
+		}
+	}
+	return nil
+}
+
+func validatePortal(portal PortalConfig, config *Config) error {
+	if !config.MongoDB.Enabled {
+		return fmt.Errorf("requires mongodb to be enabled")
+	}
+	if !strings.HasPrefix(portal.Path, "/") || portal.Path == "/" || strings.HasSuffix(portal.Path, "/") {
+		return fmt.Errorf("path must start with / and cannot end with /")
+	}
+	if portal.Path == "/admin" || strings.HasPrefix(portal.Path, "/admin/") {
+		return fmt.Errorf("path cannot be under /admin")
+	}
+	if portal.TokenTTL < 0 || portal.MaxKeysPerUser < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+
+	plans := make(map[string]bool)
+	for _, product := range config.Products {
+		for _, plan := range product.Plans {
+			plans[product.Name+"/"+plan.Name] = true
+		}
+	}
+	for _, id := range portal.DefaultPlans {
+		if !plans[id] {
+			return fmt.Errorf("defaultPlans: unknown plan %s, plans are named product/plan", id)
+		}
+	}
+	return nil
+}
+
+func validateProducts(products []ProductConfig, services []ServiceConfig) error {
+	serviceNames := make(map[string]bool)
+	for _, svc := range services {
+		serviceNames[svc.Name] = true
+	}
+	names := make(map[string]bool)
+	for i, product := range products {
+		if product.Name == "" || strings.Contains(product.Name, "/") {
+			return fmt.Errorf("product %d: name must be set and cannot contain '/'", i)
+		}
+		if names[product.Name] {
+			return fmt.Errorf("product %s: duplicate name", product.Name)
+		}
+		names[product.Name] = true
+		if len(product.Services) == 0 {
+			return fmt.Errorf("product %s: at least one service must be specified", product.Name)
+		}
+		for _, name := range product.Services {
+			if !serviceNames[name] {
+				return fmt.Errorf("product %s: unknown service %s", product.Name, name)
+			}
+		}
+		if len(product.Plans) == 0 {
+			return fmt.Errorf("product %s: at least one plan must be specified", product.Name)
+		}
+		plans := make(map[string]bool)
+		for j, plan := range product.Plans {
+			if plan.Name == "" || strings.Contains(plan.Name, "/") {
+				return fmt.Errorf("product %s: plan %d: name must be set and cannot contain '/'", product.Name, j)
+			}
+			if plans[plan.Name] {
+				return fmt.Errorf("product %s: plan %s: duplicate name", product.Name, plan.Name)
+			}
+			plans[plan.Name] = true
+			if plan.RateLimit < 0 || plan.Quota < 0 || plan.KeyTTL < 0 {
+				return fmt.Errorf("product %s: plan %s: values cannot be negative", product.Name, plan.Name)
+			}
+			switch plan.QuotaPeriod {
+			case "", "day", "month":
+			default:
+				return fmt.Errorf("product %s: plan %s: quotaPeriod must be day or month", product.Name, plan.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDNSTarget checks a dns:// or dns+srv:// target
+func validateDNSTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid DNS target %q", target)
+	}
+	if u.Scheme == "dns+srv" && u.Port() != "" {
+		return fmt.Errorf("target %q: dns+srv targets take their ports from the SRV records", target)
+	}
+	switch u.Query().Get("scheme") {
+	case "", "http", "https":
+		return nil
+	default:
+		return fmt.Errorf("target %q: scheme must be http or https", target)
+	}
+}
+
+// validateFeatureFlags checks the flags and the references to them. Flags
+// from a file are only known at runtime, so references are not checked then.
+func validateFeatureFlags(config *Config) error {
+	ff := config.FeatureFlags
+	if ff.PollInterval < 0 {
+		return fmt.Errorf("featureFlags: pollInterval cannot be negative")
+	}
+	if err := ValidateFeatureFlags(ff.Flags); err != nil {
+		return fmt.Errorf("featureFlags: %w", err)
+	}
+	defined := func(name string, numeric bool) error {
+		if ff.File != "" {
+			return nil
+		}
+		flag, ok := ff.Flags[name]
+		if !ok {
+			return fmt.Errorf("feature flag %q is not defined", name)
+		}
+		if _, isBool := flag.Default.(bool); isBool == numeric {
+			return fmt.Errorf("feature flag %q has the wrong type", name)
+		}
+		return nil
+	}
+
+	for _, service := range config.Services {
+		if service.FeatureFlag != "" {
+			if err := defined(service.FeatureFlag, false); err != nil {
+				return fmt.Errorf("service %s: featureFlag: %w", service.Name, err)
+			}
+		}
+		if canary := service.Canary; canary != nil {
+			if len(canary.Targets) == 0 {
+				return fmt.Errorf("service %s: canary: at least one target is required", service.Name)
+			}
+			if canary.Weight < 0 || canary.Weight > 100 {
+				return fmt.Errorf("service %s: canary: weight must be between 0 and 100", service.Name)
+			}
+			if canary.WeightFlag != "" {
+				if err := defined(canary.WeightFlag, true); err != nil {
+					return fmt.Errorf("service %s: canary.weightFlag: %w", service.Name, err)
+				}
+			}
+		}
+	}
+	for _, plugin := range config.Plugins.Plugins {
+		if plugin.Flag != "" {
+			if err := defined(plugin.Flag, false); err != nil {
+				return fmt.Errorf("plugins.%s: flag: %w", plugin.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateFeatureFlags checks flag definitions, wherever they come from.
+// Flags are booleans or numbers, and all values of a flag have one type.
+func ValidateFeatureFlags(flags map[string]FeatureFlagConfig) error {
+	for name, flag := range flags {
+		kind, ok := flagValueKind(flag.Default)
+		if !ok {
+			return fmt.Errorf("flag %s: default must be a boolean or a number", name)
+		}
+		for i, rule := range flag.Rules {
+			if rule.Header != "" && rule.Claim != "" {
+				return fmt.Errorf("flag %s: rule %d: header and claim are mutually exclusive", name, i)
+			}
+			if len(rule.Values) > 0 && rule.Header == "" && rule.Claim == "" {
+				return fmt.Errorf("flag %s: rule %d: values require a header or claim", name, i)
+			}
+			if rule.Header == "" && rule.Claim == "" && rule.Percentage == nil {
+				return fmt.Errorf("flag %s: rule %d: header, claim or percentage is required", name, i)
+			}
+			if p := rule.Percentage; p != nil && (*p < 0 || *p > 100) {
+				return fmt.Errorf("flag %s: rule %d: percentage must be between 0 and 100", name, i)
+			}
+			if k, ok := flagValueKind(rule.Value); !ok || k != kind {
+				return fmt.Errorf("flag %s: rule %d: value must have the type of the default", name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// flagValueKind returns whether v is a boolean or a number
+func flagValueKind(v any) (string, bool) {
+	switch v.(type) {
+	case bool:
+		return "bool", true
+	case int, int64, float64:
+		return "number", true
+	}
+	return "", false
+}
+
+func validateDiscovery(discovery DiscoveryConfig) error {
+	for _, server := range discovery.Nameservers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("nameserver %q must be host:port", server)
+		}
+	}
+	if discovery.Timeout < 0 || discovery.MinRefresh < 0 || discovery.MaxRefresh < 0 {
+		return fmt.Errorf("durations cannot be negative")
+	}
+	if discovery.MaxRefresh > 0 && discovery.MinRefresh > discovery.MaxRefresh {
+		return fmt.Errorf("minRefresh cannot exceed maxRefresh")
+	}
+	return nil
+}
+
+// validateTCPPool checks the targets and load balancing of a listener or route
+func validateTCPPool(targets []string, loadBalancing string) error {
+	for _, target := range targets {
+		_, port, err := net.SplitHostPort(target)
+		if err == nil {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil {
+			return fmt.Errorf("target %q must be host:port", target)
+		}
+	}
+	switch loadBalancing {
+	case "", "round-robin", "random", "least-connections":
+		return nil
+	default:
+		return fmt.Errorf("unsupported loadBalancing %q", loadBalancing)
+	}
+}
+
+// validServerName reports whether name is a DNS name, optionally with a
+// leading "*." wildcard label
+func validServerName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validateCIDRs(entries []string) error {
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid address or CIDR %q", entry)
+		}
+	}
+	return nil
+}
+
+// validateServiceAsync checks the async section of a service
+func validateServiceAsync(a *ServiceAsyncConfig, service ServiceConfig) error {
+	switch a.Mode {
+	case "", "prefer", "always":
+	default:
+		return fmt.Errorf("unsupported mode %q (expected prefer or always)", a.Mode)
+	}
+	if a.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	if service.Protocol != "" && service.Protocol != "http" {
+		return fmt.Errorf("only supported for http services")
+	}
+	if service.Static != nil || service.Redirect != nil {
+		return fmt.Errorf("cannot be combined with static or redirect")
+	}
+	for _, host := range a.CallbackHosts {
+		if host == "" || strings.ContainsAny(host, "/?#@") {
+			return fmt.Errorf("invalid callback host %q", host)
+		}
+	}
+	return nil
+}
+
+// validateRateLimit checks the strategy and limits of the global rate limit
+func validateRateLimit(r RateLimitConfig) error {
+	switch r.Strategy {
+	case "", "local", "redis", "sliding-window", "token-bucket", "fixed-window":
+	default:
+		return fmt.Errorf("unsupported strategy %q (expected sliding-window, token-bucket or fixed-window)", r.Strategy)
+	}
+	if r.Limit < 0 || r.Duration < 0 || r.Burst < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	return nil
+}
+
+// validateAsync checks where asynchronous requests are kept
+func validateAsync(config *Config) error {
+	a := config.Async
+	switch a.Store {
+	case "", "memory":
+	case "mongodb":
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("mongodb store requires mongodb.enabled")
+		}
+	default:
+		return fmt.Errorf("unsupported store %q (expected memory or mongodb)", a.Store)
+	}
+	if a.Workers < 0 || a.QueueSize < 0 || a.ResultTTL < 0 || a.MaxBodySize < 0 || a.PollInterval < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	if a.StatusPath == "" {
+		return nil
+	}
+	if !strings.HasPrefix(a.StatusPath, "/") || strings.HasSuffix(a.StatusPath, "/") {
+		return fmt.Errorf("statusPath must start and not end with /")
+	}
+	for _, service := range config.Services {
+		// A catch-all basePath of / does not shadow the more specific status routes
+		base := strings.TrimSuffix(service.BasePath, "/")
+		if base == "" {
+			continue
+		}
+		if a.StatusPath == base || strings.HasPrefix(a.StatusPath, base+"/") {
+			return fmt.Errorf("statusPath %s is served by service %s", a.StatusPath, service.Name)
+		}
+	}
+	return nil
+}
+
+// validateScheduler checks the scheduler store and jobs. Schedules are
+// parsed when the scheduler starts.
+func validateScheduler(config *Config) error {
+	s := config.Scheduler
+	switch s.Store {
+	case "", "memory":
+	case "mongodb":
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("mongodb store requires mongodb.enabled")
+		}
+	default:
+		return fmt.Errorf("unsupported store %q (expected memory or mongodb)", s.Store)
+	}
+	if s.LeaseDuration < 0 || s.HistoryTTL < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	names := make(map[string]bool, len(s.Jobs))
+	for i, job := range s.Jobs {
+		if job.Name == "" {
+			return fmt.Errorf("job %d: name cannot be empty", i)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicate job %s", job.Name)
+		}
+		names[job.Name] = true
+		if job.Schedule == "" || job.Task == "" {
+			return fmt.Errorf("job %s: schedule and task are required", job.Name)
+		}
+		if job.Timeout < 0 {
+			return fmt.Errorf("job %s: timeout cannot be negative", job.Name)
+		}
+	}
+	return nil
+}
+
+// validateRevocation checks where revocations are kept
+func validateRevocation(config *Config) error {
+	r := config.Auth.Revocation
+	switch r.Store {
+	case "", "memory":
+	case "mongodb":
+		if !config.MongoDB.Enabled {
+			return fmt.Errorf("mongodb store requires mongodb.enabled")
+		}
+	case "redis":
+		if r.RedisURL == "" {
+			return fmt.Errorf("redis store requires redisUrl")
+		}
+	default:
+		return fmt.Errorf("unsupported store %q (expected memory, mongodb or redis)", r.Store)
+	}
+	if r.SyncInterval < 0 || r.MaxTokenLifetime < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	return nil
+}
+
+// validateOIDC checks that providers have a unique name and an issuer
+func validateOIDC(providers []OIDCProviderConfig) error {
+	names := make(map[string]bool)
+	for i, p := range providers {
+		switch {
+		case p.Name == "":
+			return fmt.Errorf("provider %d: name is required", i)
+		case p.Name == "jwt" || p.Name == "hmac":
+			return fmt.Errorf("provider %d: %s is reserved", i, p.Name)
+		case names[p.Name]:
+			return fmt.Errorf("duplicate provider %q", p.Name)
+		}
+		names[p.Name] = true
+		if err := validateHTTPURL(p.Issuer); err != nil {
+			return fmt.Errorf("provider %s: issuer: %w", p.Name, err)
+		}
+		if p.JWKSURL != "" {
+			if err := validateHTTPURL(p.JWKSURL); err != nil {
+				return fmt.Errorf("provider %s: jwksUrl: %w", p.Name, err)
+			}
+		}
+		if p.RefreshInterval < 0 {
+			return fmt.Errorf("provider %s: refreshInterval cannot be negative", p.Name)
+		}
+	}
+	return nil
+}
+
+// validateHMAC checks the algorithm and limits of request signing
+func validateHMAC(h HMACConfig) error {
+	switch h.Algorithm {
+	case "", "sha256", "sha384", "sha512":
+	default:
+		return fmt.Errorf("unsupported algorithm %q (expected sha256, sha384 or sha512)", h.Algorithm)
+	}
+	if h.ClockSkew < 0 || h.MaxBodySize < 0 {
+		return fmt.Errorf("values cannot be negative")
+	}
+	return nil
+}
+
+// validateHTTPURL checks that raw is an absolute http or https URL
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	return nil
+}
+
+// validateServiceAuth checks that a service's provider is configured and
+// that client certificates are asked for
+func validateServiceAuth(a *ServiceAuthConfig, config *Config) error {
+	if cc := a.ClientCert; cc != nil {
+		if cc.CAFile == "" {
+			return fmt.Errorf("clientCert: caFile is required")
+		}
+		if !config.Server.TLS.Enabled || config.Server.TLS.ClientAuth != "request" {
+			return fmt.Errorf("clientCert: requires server.tls.enabled and server.tls.clientAuth: request")
+		}
+	}
+	switch a.Provider {
+	case "", "jwt", "hmac":
+		if len(a.Scopes) > 0 {
+			return fmt.Errorf("scopes require an oidc provider")
+		}
+		if a.Provider == "hmac" && !config.Consumers.Enabled {
+			return fmt.Errorf("the hmac provider requires consumers.enabled, which hold the secrets")
+		}
+		return nil
+	}
+	for _, p := range config.Auth.OIDC {
+		if p.Name == a.Provider {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown provider %q (expected jwt, hmac or one of auth.oidc)", a.Provider)
+}
+
+// validatePolicies checks the effect and condition of authorization rules.
+// Their expressions are compiled when the gateway starts.
+func validatePolicies(policies []PolicyConfig) error {
+	for i, p := range policies {
+		if p.Effect != "allow" && p.Effect != "deny" {
+			return fmt.Errorf("policy %d: effect must be allow or deny", i)
+		}
+		if strings.TrimSpace(p.When) == "" {
+			return fmt.Errorf("policy %d: when is required", i)
+		}
+	}
+	return nil
+}
+
+// ValidateExperiment checks the traffic share and variants of an experiment
+func ValidateExperiment(e *ExperimentConfig) error {
+	if e.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if e.Traffic < 0 || e.Traffic > 100 {
+		return fmt.Errorf("traffic must be between 0 and 100")
+	}
+	if e.CookieMaxAge < 0 {
+		return fmt.Errorf("cookieMaxAge cannot be negative")
+	}
+	if len(e.Variants) < 2 {
+		return fmt.Errorf("at least two variants are required")
+	}
+	names := make(map[string]bool, len(e.Variants))
+	total := 0
+	for i, v := range e.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("variant %d: name is required", i)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variant %q", v.Name)
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %s: weight cannot be negative", v.Name)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("at least one variant needs a weight")
+	}
+	return nil
+}
+
+// validateOpenAPIUI checks the path, renderer and services of the
+// documentation site
+func validateOpenAPIUI(config *Config) error {
+	ui := config.OpenAPI
+	if ui.UIPath != "" && (!strings.HasPrefix(ui.UIPath, "/") || ui.UIPath == "/") {
+		return fmt.Errorf("uiPath must start with / and not be the root")
+	}
+	if ui.UIRenderer != "" && ui.UIRenderer != "swagger" && ui.UIRenderer != "redoc" {
+		return fmt.Errorf("uiRenderer must be swagger or redoc")
+	}
+	for _, name := range ui.UIServices {
+		found := false
+		for _, svc := range config.Services {
+			found = found || svc.Name == name
+		}
+		if !found {
+			return fmt.Errorf("uiServices: unknown service %s", name)
+		}
+	}
+	return nil
+}
+
+// ValidateFault checks the probabilities and failures of a fault
+func ValidateFault(f FaultConfig) error {
+	for name, p := range map[string]float64{
+		"delayPercentage": f.DelayPercentage,
+		"errorPercentage": f.ErrorPercentage,
+		"abortPercentage": f.AbortPercentage,
+	} {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("%s must be between 0 and 100", name)
+		}
+	}
+	if f.ErrorPercentage+f.AbortPercentage > 100 {
+		return fmt.Errorf("errorPercentage and abortPercentage cannot add up to more than 100")
+	}
+	if f.DelayPercentage == 0 && f.ErrorPercentage == 0 && f.AbortPercentage == 0 {
+		return fmt.Errorf("at least one percentage is required")
+	}
+	if f.Delay < 0 || (f.DelayPercentage > 0 && f.Delay == 0) {
+		return fmt.Errorf("delay must be positive")
+	}
+	if f.ErrorStatus != 0 && (f.ErrorStatus < 400 || f.ErrorStatus > 599) {
+		return fmt.Errorf("errorStatus must be between 400 and 599")
+	}
+	return nil
+}
+
+// validateTracingLogs checks the level and batching of log export
+func validateTracingLogs(l TracingLogsConfig) error {
+	if l.Level != "" {
+		if _, err := logrus.ParseLevel(l.Level); err != nil {
+			return fmt.Errorf("invalid level %q", l.Level)
+		}
+	}
+	if l.BatchSize < 0 || l.QueueSize < 0 || l.FlushInterval < 0 {
+		return fmt.Errorf("batchSize, queueSize and flushInterval cannot be negative")
+	}
+	return nil
+}
+
+// validateGeoIP checks the databases and metric labels of GeoIP lookups
+func validateGeoIP(g GeoIPConfig) error {
+	if g.Database == "" && g.ASNDatabase == "" {
+		return fmt.Errorf("database or asnDatabase is required")
+	}
+	for _, label := range g.MetricLabels {
+		if label != "country" && label != "region" && label != "asn" {
+			return fmt.Errorf("unsupported metric label %q (expected country, region or asn)", label)
+		}
+	}
+	if g.MaxLabelValues < 0 {
+		return fmt.Errorf("maxLabelValues cannot be negative")
+	}
 	return nil
 }
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the active configuration. Readers get a snapshot that is
+// never changed afterwards; writers publish a changed copy instead, so no
+// reader sees a configuration half updated.
+type Store struct {
+	mu      sync.Mutex // Serializes writers
+	current atomic.Pointer[Config]
+}
+
+// NewStore returns a store whose active configuration is cfg, which must
+// not be changed afterwards
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Load returns the active configuration. Callers must not change it.
+func (s *Store) Load() *Config {
+	return s.current.Load()
+}
+
+// Swap publishes the configuration next returns in place of current. Writers
+// wait for each other, so next sees every earlier change. Nothing is
+// published when next fails.
+func (s *Store) Swap(next func(current *Config) (*Config, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := next(s.current.Load())
+	if err != nil {
+		return err
+	}
+	s.current.Store(cfg)
+	return nil
+}
+
+// Update applies change to a copy of the active configuration and publishes
+// the copy, unless change fails
+func (s *Store) Update(change func(cfg *Config) error) error {
+	return s.Swap(func(current *Config) (*Config, error) {
+		cfg, err := current.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if err := change(cfg); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	})
+}
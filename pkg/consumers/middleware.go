@@ -0,0 +1,111 @@
+package consumers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/certs"
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers identifying the consumer to the service. Clients cannot set them;
+// they are removed from every request.
+const (
+	HeaderConsumerID       = "X-Consumer-ID"
+	HeaderConsumerUsername = "X-Consumer-Username"
+	HeaderConsumerCustomID = "X-Consumer-Custom-ID"
+)
+
+// Identify returns the consumer a request belongs to: the owner of the API
+// key, JWT or HMAC key it was authenticated with, or of its client
+// certificate
+func (r *Registry) Identify(c echo.Context) *mongodb.ConsumerDocument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if key, ok := c.Get("apiKey").(*mongodb.APIKeyDocument); ok {
+		if consumer, ok := r.index.byKey[key.ID]; ok {
+			return consumer
+		}
+	}
+	if keyID, ok := c.Get("hmacKeyID").(string); ok {
+		if consumer, ok := r.index.byHMACKey[keyID]; ok {
+			return consumer
+		}
+	}
+	if claims, ok := c.Get("user").(*auth.JWTClaims); ok {
+		if consumer, ok := r.index.bySubject[claims.Subject]; ok && claims.Subject != "" {
+			return consumer
+		}
+		if consumer, ok := r.index.bySubject[claims.UserID]; ok && claims.UserID != "" {
+			return consumer
+		}
+	}
+	if tls := c.Request().TLS; tls != nil && len(tls.PeerCertificates) > 0 {
+		if consumer, ok := r.index.byCert[certs.Fingerprint(tls.PeerCertificates[0])]; ok {
+			return consumer
+		}
+	}
+	return nil
+}
+
+// Middleware runs after a service's authentication. Requests of a consumer
+// are only accepted when it is enabled and allowed to call service, within
+// its rate limit; they then carry the consumer's headers to the service.
+// Requests without a consumer are left alone.
+func (r *Registry) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header
+			header.Del(HeaderConsumerID)
+			header.Del(HeaderConsumerUsername)
+			header.Del(HeaderConsumerCustomID)
+
+			consumer := r.Identify(c)
+			if consumer == nil {
+				return next(c)
+			}
+			if !consumer.Enabled {
+				return echo.NewHTTPError(http.StatusForbidden, "Consumer is disabled")
+			}
+			if len(consumer.Services) > 0 && !slices.Contains(consumer.Services, service) {
+				return echo.NewHTTPError(http.StatusForbidden, "Consumer is not allowed to access this service")
+			}
+
+			if limit := consumer.RateLimit; limit != nil {
+				now := time.Now()
+				info, allowed, err := ratelimit.CheckWindow(c.Request().Context(), r.counter, "consumer:"+consumer.ID, limit.Limit, limit.Period, now)
+				if err != nil {
+					r.logger.WithError(err).WithField("consumer", consumer.Username).Error("Failed to check consumer rate limit")
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "Rate limit unavailable")
+				}
+				respHeader := c.Response().Header()
+				respHeader.Set("X-RateLimit-Limit", strconv.Itoa(info.Limit))
+				respHeader.Set("X-RateLimit-Remaining", strconv.Itoa(info.Remaining))
+				respHeader.Set("X-RateLimit-Reset", strconv.FormatInt(info.ResetTime.Unix(), 10))
+				if !allowed {
+					respHeader.Set("Retry-After", strconv.Itoa(int(info.ResetTime.Sub(now).Seconds())+1))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+				}
+			}
+
+			for name, value := range consumer.Headers {
+				header.Set(name, value)
+			}
+			header.Set(HeaderConsumerID, consumer.ID)
+			header.Set(HeaderConsumerUsername, consumer.Username)
+			if consumer.CustomID != "" {
+				header.Set(HeaderConsumerCustomID, consumer.CustomID)
+			}
+
+			c.Set("consumer", consumer)
+			return next(c)
+		}
+	}
+}
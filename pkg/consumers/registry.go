@@ -0,0 +1,310 @@
+package consumers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/certs"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Errors returned when consumers are changed
+var (
+	ErrNotFound = errors.New("consumer not found")
+	ErrInvalid  = errors.New("invalid consumer")
+	ErrConflict = errors.New("consumer conflicts with another consumer")
+)
+
+// Store keeps consumers, e.g. the MongoDB repository
+type Store interface {
+	CreateConsumer(ctx context.Context, consumer *mongodb.ConsumerDocument) error
+	GetConsumer(ctx context.Context, id string) (*mongodb.ConsumerDocument, error)
+	ListConsumers(ctx context.Context) ([]*mongodb.ConsumerDocument, error)
+	UpdateConsumer(ctx context.Context, id string, consumer *mongodb.ConsumerDocument) error
+	DeleteConsumer(ctx context.Context, id string) error
+}
+
+// index finds consumers by ID and by credential
+type index struct {
+	byID      map[string]*mongodb.ConsumerDocument
+	byKey     map[string]*mongodb.ConsumerDocument
+	byCert    map[string]*mongodb.ConsumerDocument
+	bySubject map[string]*mongodb.ConsumerDocument
+	byHMACKey map[string]*mongodb.ConsumerDocument
+	secrets   map[string]string // HMAC secrets by key ID
+}
+
+func newIndex(consumers []*mongodb.ConsumerDocument) *index {
+	idx := &index{
+		byID:      make(map[string]*mongodb.ConsumerDocument),
+		byKey:     make(map[string]*mongodb.ConsumerDocument),
+		byCert:    make(map[string]*mongodb.ConsumerDocument),
+		bySubject: make(map[string]*mongodb.ConsumerDocument),
+		byHMACKey: make(map[string]*mongodb.ConsumerDocument),
+		secrets:   make(map[string]string),
+	}
+	for _, consumer := range consumers {
+		idx.byID[consumer.ID] = consumer
+		for _, id := range consumer.APIKeyIDs {
+			idx.byKey[id] = consumer
+		}
+		for _, fingerprint := range consumer.CertFingerprints {
+			idx.byCert[certs.NormalizeFingerprint(fingerprint)] = consumer
+		}
+		for _, subject := range consumer.JWTSubjects {
+			idx.bySubject[subject] = consumer
+		}
+		for _, key := range consumer.HMACKeys {
+			idx.byHMACKey[key.ID] = consumer
+			idx.secrets[key.ID] = key.Secret
+		}
+	}
+	return idx
+}
+
+// Registry keeps the consumers of the store in memory so requests are
+// matched to them without a lookup. It reloads them periodically, which
+// picks up changes made by other gateways, and after every change made
+// through it.
+type Registry struct {
+	cfg     config.ConsumersConfig
+	store   Store
+	counter ratelimit.Counter
+	logger  *logrus.Logger
+
+	mu    sync.RWMutex
+	index *index
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRegistry loads the consumers of store and keeps reloading them. Rate
+// limits are counted with counter, in memory or in Redis when several
+// gateways share them.
+func NewRegistry(cfg config.ConsumersConfig, store Store, counter ratelimit.Counter, logger *logrus.Logger) (*Registry, error) {
+	r := &Registry{
+		cfg:     cfg,
+		store:   store,
+		counter: counter,
+		logger:  logger,
+		index:   newIndex(nil),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go r.reloadLoop(ctx)
+
+	return r, nil
+}
+
+// Stop stops reloading consumers
+func (r *Registry) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *Registry) reloadLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := r.Reload(reloadCtx); err != nil {
+				// Keep serving the consumers loaded last
+				r.logger.WithError(err).Warn("Failed to reload consumers")
+			}
+			cancel()
+		}
+	}
+}
+
+// Reload replaces the consumers in memory with those of the store
+func (r *Registry) Reload(ctx context.Context) error {
+	consumers, err := r.store.ListConsumers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load consumers: %w", err)
+	}
+
+	idx := newIndex(consumers)
+	r.mu.Lock()
+	r.index = idx
+	r.mu.Unlock()
+	return nil
+}
+
+// HMACSecret returns the secret with the given key ID, so that the
+// requests of consumers can be verified
+func (r *Registry) HMACSecret(keyID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	secret, ok := r.index.secrets[keyID]
+	return secret, ok
+}
+
+// List returns the consumers ordered by username
+func (r *Registry) List() []*mongodb.ConsumerDocument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	consumers := make([]*mongodb.ConsumerDocument, 0, len(r.index.byID))
+	for _, consumer := range r.index.byID {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Username < consumers[j].Username
+	})
+	return consumers
+}
+
+// Get returns the consumer with the given ID
+func (r *Registry) Get(id string) (*mongodb.ConsumerDocument, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	consumer, ok := r.index.byID[id]
+	return consumer, ok
+}
+
+// Create validates and stores a new consumer, assigning its ID
+func (r *Registry) Create(ctx context.Context, consumer *mongodb.ConsumerDocument) error {
+	consumer.ID = uuid.New().String()
+	if err := r.validate(consumer); err != nil {
+		return err
+	}
+
+	if err := r.store.CreateConsumer(ctx, consumer); err != nil {
+		return storeError(err)
+	}
+	return r.Reload(ctx)
+}
+
+// Update validates and stores consumer in place of the consumer with the
+// given ID
+func (r *Registry) Update(ctx context.Context, id string, consumer *mongodb.ConsumerDocument) error {
+	existing, err := r.store.GetConsumer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+
+	consumer.ID = id
+	consumer.CreatedAt = existing.CreatedAt
+	if err := r.validate(consumer); err != nil {
+		return err
+	}
+
+	if err := r.store.UpdateConsumer(ctx, id, consumer); err != nil {
+		return storeError(err)
+	}
+	return r.Reload(ctx)
+}
+
+// Delete removes the consumer with the given ID. Its credentials stay
+// valid but no longer belong to a consumer.
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	if err := r.store.DeleteConsumer(ctx, id); err != nil {
+		return storeError(err)
+	}
+	return r.Reload(ctx)
+}
+
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, mongodb.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, mongodb.ErrDuplicate):
+		return fmt.Errorf("%w: username or credential already taken", ErrConflict)
+	}
+	return err
+}
+
+// validate checks consumer and normalizes its certificate fingerprints. A
+// username or credential taken by another consumer is a conflict.
+func (r *Registry) validate(consumer *mongodb.ConsumerDocument) error {
+	consumer.Username = strings.TrimSpace(consumer.Username)
+	if consumer.Username == "" {
+		return fmt.Errorf("%w: username is required", ErrInvalid)
+	}
+	if limit := consumer.RateLimit; limit != nil {
+		if limit.Limit <= 0 {
+			return fmt.Errorf("%w: rateLimit.limit must be positive", ErrInvalid)
+		}
+		switch limit.Period {
+		case ratelimit.PeriodMinute, ratelimit.PeriodDay, ratelimit.PeriodMonth:
+		default:
+			return fmt.Errorf("%w: rateLimit.period must be minute, day or month", ErrInvalid)
+		}
+	}
+	for name := range consumer.Headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("%w: invalid header name %q", ErrInvalid, name)
+		}
+	}
+	for i, fingerprint := range consumer.CertFingerprints {
+		consumer.CertFingerprints[i] = certs.NormalizeFingerprint(fingerprint)
+	}
+	hmacKeyIDs := make([]string, 0, len(consumer.HMACKeys))
+	for _, key := range consumer.HMACKeys {
+		if strings.TrimSpace(key.ID) == "" || key.Secret == "" {
+			return fmt.Errorf("%w: hmacKeys need an id and a secret", ErrInvalid)
+		}
+		if slices.Contains(hmacKeyIDs, key.ID) {
+			return fmt.Errorf("%w: duplicate hmacKeys id %s", ErrInvalid, key.ID)
+		}
+		hmacKeyIDs = append(hmacKeyIDs, key.ID)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, other := range r.index.byID {
+		if other.ID != consumer.ID && other.Username == consumer.Username {
+			return fmt.Errorf("%w: username %s is taken", ErrConflict, consumer.Username)
+		}
+	}
+	if err := r.claimed("API key", consumer.APIKeyIDs, r.index.byKey, consumer.ID); err != nil {
+		return err
+	}
+	if err := r.claimed("certificate", consumer.CertFingerprints, r.index.byCert, consumer.ID); err != nil {
+		return err
+	}
+	if err := r.claimed("JWT subject", consumer.JWTSubjects, r.index.bySubject, consumer.ID); err != nil {
+		return err
+	}
+	return r.claimed("HMAC key", hmacKeyIDs, r.index.byHMACKey, consumer.ID)
+}
+
+// claimed returns a conflict if one of credentials belongs to a consumer
+// other than id
+func (r *Registry) claimed(kind string, credentials []string, owners map[string]*mongodb.ConsumerDocument, id string) error {
+	for _, credential := range credentials {
+		if owner, ok := owners[credential]; ok && owner.ID != id {
+			return fmt.Errorf("%w: %s %s belongs to consumer %s", ErrConflict, kind, credential, owner.Username)
+		}
+	}
+	return nil
+}
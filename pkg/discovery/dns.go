@@ -0,0 +1,233 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// record is an address found in DNS and how long it may be used
+type record struct {
+	host string
+	port uint16
+	ttl  time.Duration
+}
+
+// client queries nameservers directly, since the system resolver does not
+// report record TTLs
+type client struct {
+	nameservers []string
+	timeout     time.Duration
+}
+
+// systemNameservers returns the nameservers in /etc/resolv.conf, or the
+// local one if there are none
+func systemNameservers() []string {
+	var servers []string
+	if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				servers = append(servers, net.JoinHostPort(fields[1], "53"))
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = []string{"127.0.0.1:53"}
+	}
+	return servers
+}
+
+// lookupSRV returns the targets of the SRV records of name with the lowest
+// priority
+func (c *client) lookupSRV(ctx context.Context, name string) ([]record, error) {
+	answers, err := c.query(ctx, name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	lowest := -1
+	for _, answer := range answers {
+		srv, ok := answer.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		priority := int(srv.Priority)
+		if lowest >= 0 && priority > lowest {
+			continue
+		}
+		if priority < lowest {
+			records = records[:0]
+		}
+		lowest = priority
+		records = append(records, record{
+			host: strings.TrimSuffix(srv.Target.String(), "."),
+			port: srv.Port,
+			ttl:  time.Duration(answer.Header.TTL) * time.Second,
+		})
+	}
+	return records, nil
+}
+
+// lookupHost returns the A and AAAA records of name
+func (c *client) lookupHost(ctx context.Context, name string) ([]record, error) {
+	var records []record
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := c.query(ctx, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			var ip net.IP
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ip = net.IP(body.A[:])
+			case *dnsmessage.AAAAResource:
+				ip = net.IP(body.AAAA[:])
+			default:
+				continue
+			}
+			records = append(records, record{
+				host: ip.String(),
+				ttl:  time.Duration(answer.Header.TTL) * time.Second,
+			})
+		}
+	}
+	return records, nil
+}
+
+// query asks the nameservers in turn for the records of name, returning
+// the answers of the first that responds. A name that does not exist has no
+// answers.
+func (c *client) query(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var lastErr error
+	for _, server := range c.nameservers {
+		resp, err := exchange(ctx, "udp", server, packed)
+		if err == nil && resp.Truncated {
+			resp, err = exchange(ctx, "tcp", server, packed)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.ID != id {
+			lastErr = fmt.Errorf("%s: response does not match the query", server)
+			continue
+		}
+		switch resp.RCode {
+		case dnsmessage.RCodeSuccess:
+			return resp.Answers, nil
+		case dnsmessage.RCodeNameError:
+			return nil, nil
+		default:
+			lastErr = fmt.Errorf("%s: lookup of %s failed: %s", server, name, resp.RCode)
+		}
+	}
+	return nil, lastErr
+}
+
+// exchange sends query to server over network and reads the response
+func exchange(ctx context.Context, network, server string, query []byte) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var data []byte
+	if network == "tcp" {
+		// Messages over TCP are prefixed with their length
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		data = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		data = make([]byte, 65535)
+		n, err := conn.Read(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[:n]
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(data); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", server, err)
+	}
+	return &resp, nil
+}
+
+// urls turns records into target URLs of t, sorted so that unchanged
+// answers compare equal, and returns the shortest TTL among them
+func (t *Target) urls(records []record) ([]string, time.Duration) {
+	seen := make(map[string]bool, len(records))
+	urls := make([]string, 0, len(records))
+	var ttl time.Duration
+	for i, r := range records {
+		port := t.port
+		if r.port != 0 {
+			port = strconv.Itoa(int(r.port))
+		}
+		u := t.scheme + "://" + net.JoinHostPort(r.host, port) + t.path
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+		if i == 0 || r.ttl < ttl {
+			ttl = r.ttl
+		}
+	}
+	sort.Strings(urls)
+	return urls, ttl
+}
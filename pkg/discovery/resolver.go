@@ -0,0 +1,322 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config sets how targets are resolved. Zero values use the defaults.
+type Config struct {
+	Nameservers []string      // host:port; default: the nameservers in /etc/resolv.conf
+	Timeout     time.Duration // Per lookup (default: 2s)
+	MinRefresh  time.Duration // Shortest time between lookups of a name, also after failures (default: 5s)
+	MaxRefresh  time.Duration // Longest time records are used, whatever their TTL (default: 5m)
+}
+
+// Target is a service target resolved through DNS:
+//
+//	dns+srv://_http._tcp.orders.service.consul   SRV records, host and port from each record
+//	dns://orders.internal:8080/api               A and AAAA records, one target per address
+//
+// Targets are http:// unless ?scheme=https is given.
+type Target struct {
+	raw    string
+	srv    bool
+	name   string
+	port   string
+	scheme string
+	path   string
+}
+
+// IsDNS reports whether target is resolved through DNS
+func IsDNS(target string) bool {
+	return strings.HasPrefix(target, "dns://") || strings.HasPrefix(target, "dns+srv://")
+}
+
+// ParseTarget parses a dns:// or dns+srv:// target
+func ParseTarget(target string) (*Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	t := &Target{
+		raw:    target,
+		srv:    u.Scheme == "dns+srv",
+		name:   u.Hostname(),
+		port:   u.Port(),
+		scheme: u.Query().Get("scheme"),
+		path:   strings.TrimSuffix(u.EscapedPath(), "/"),
+	}
+	if u.Scheme != "dns" && u.Scheme != "dns+srv" {
+		return nil, fmt.Errorf("target %q: scheme must be dns or dns+srv", target)
+	}
+	if t.name == "" {
+		return nil, fmt.Errorf("target %q: name is required", target)
+	}
+	if t.srv && t.port != "" {
+		return nil, fmt.Errorf("target %q: dns+srv targets take their ports from the SRV records", target)
+	}
+	switch t.scheme {
+	case "":
+		t.scheme = "http"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("target %q: scheme must be http or https", target)
+	}
+	if t.port == "" {
+		t.port = "80"
+		if t.scheme == "https" {
+			t.port = "443"
+		}
+	}
+	return t, nil
+}
+
+// Change reports the addresses a target gained and lost in a lookup
+type Change struct {
+	Target  string
+	Added   []string
+	Removed []string
+}
+
+// Resolver looks up DNS targets when their records expire and keeps their
+// current addresses for the load balancers
+type Resolver struct {
+	config    Config
+	client    *client
+	logger    *logrus.Logger
+	mu        sync.RWMutex
+	targets   map[string]*resolved
+	listeners []func(Change)
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+type resolved struct {
+	target *Target
+	urls   []string
+	next   time.Time
+}
+
+// NewResolver creates a resolver without targets
+func NewResolver(config Config, logger *logrus.Logger) *Resolver {
+	if len(config.Nameservers) == 0 {
+		config.Nameservers = systemNameservers()
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.MinRefresh == 0 {
+		config.MinRefresh = 5 * time.Second
+	}
+	if config.MaxRefresh == 0 {
+		config.MaxRefresh = 5 * time.Minute
+	}
+	return &Resolver{
+		config:   config,
+		client:   &client{nameservers: config.Nameservers, timeout: config.Timeout},
+		logger:   logger,
+		targets:  make(map[string]*resolved),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Add resolves target and keeps it up to date once Start is called. A
+// target that cannot be resolved yet has no addresses until it can.
+func (r *Resolver) Add(target string) error {
+	t, err := ParseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if _, exists := r.targets[target]; exists {
+		r.mu.Unlock()
+		return nil
+	}
+	r.targets[target] = &resolved{target: t}
+	r.mu.Unlock()
+
+	r.refresh(target)
+	return nil
+}
+
+// OnChange calls fn whenever a lookup changes the addresses of a target
+func (r *Resolver) OnChange(fn func(Change)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Targets returns the current addresses of target
+func (r *Resolver) Targets(target string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if res, ok := r.targets[target]; ok {
+		return res.urls
+	}
+	return nil
+}
+
+// Expand replaces the DNS targets among targets with their current
+// addresses. targets is returned as is when it has none.
+func (r *Resolver) Expand(targets []string) []string {
+	dynamic := false
+	for _, target := range targets {
+		if IsDNS(target) {
+			dynamic = true
+			break
+		}
+	}
+	if !dynamic {
+		return targets
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	expanded := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if !IsDNS(target) {
+			expanded = append(expanded, target)
+		} else if res, ok := r.targets[target]; ok {
+			expanded = append(expanded, res.urls...)
+		}
+	}
+	return expanded
+}
+
+// refresh looks target up and schedules its next lookup for when the
+// records expire. Failed and empty lookups keep the previous addresses, so
+// a DNS outage does not empty the load balancers.
+func (r *Resolver) refresh(target string) {
+	r.mu.RLock()
+	res := r.targets[target]
+	r.mu.RUnlock()
+
+	var records []record
+	var err error
+	if res.target.srv {
+		records, err = r.client.lookupSRV(context.Background(), res.target.name)
+	} else {
+		records, err = r.client.lookupHost(context.Background(), res.target.name)
+	}
+
+	urls, ttl := res.target.urls(records)
+	if err == nil && len(urls) == 0 {
+		err = fmt.Errorf("no records found")
+	}
+	if err != nil {
+		r.logger.WithError(err).WithField("target", target).Warn("Failed to resolve DNS target, keeping its addresses")
+		r.mu.Lock()
+		res.next = time.Now().Add(r.config.MinRefresh)
+		r.mu.Unlock()
+		return
+	}
+
+	if ttl < r.config.MinRefresh {
+		ttl = r.config.MinRefresh
+	}
+	if ttl > r.config.MaxRefresh {
+		ttl = r.config.MaxRefresh
+	}
+
+	r.mu.Lock()
+	previous := res.urls
+	res.urls = urls
+	res.next = time.Now().Add(ttl)
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if reflect.DeepEqual(previous, urls) {
+		return
+	}
+	change := Change{Target: target, Added: difference(urls, previous), Removed: difference(previous, urls)}
+	r.logger.WithFields(logrus.Fields{
+		"target":  target,
+		"added":   change.Added,
+		"removed": change.Removed,
+	}).Info("DNS target addresses changed")
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
+
+// difference returns the elements of a that are not in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !in[s] {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+// Start looks the targets up again as their records expire, until Stop
+func (r *Resolver) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop stops refreshing the targets
+func (r *Resolver) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+func (r *Resolver) run() {
+	defer r.wg.Done()
+
+	for {
+		due, wait := r.due()
+		for _, target := range due {
+			select {
+			case <-r.stopChan:
+				return
+			default:
+			}
+			r.refresh(target)
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// due returns the targets whose records have expired, or how long until the
+// next ones do
+func (r *Resolver) due() ([]string, time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	wait := r.config.MaxRefresh
+	var due []string
+	for target, res := range r.targets {
+		if until := res.next.Sub(now); until <= 0 {
+			due = append(due, target)
+		} else if until < wait {
+			wait = until
+		}
+	}
+	return due, wait
+}
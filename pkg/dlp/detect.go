@@ -0,0 +1,87 @@
+package dlp
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// Card numbers are 13 to 19 digits, optionally grouped by spaces or dashes
+	panPattern   = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+)
+
+// detector finds sensitive substrings in a value
+type detector struct {
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+func newDetector(name, pattern string) (*detector, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "pan":
+		return &detector{pattern: panPattern, valid: luhn}, nil
+	case "ssn":
+		return &detector{pattern: ssnPattern, valid: validSSN}, nil
+	case "email":
+		return &detector{pattern: emailPattern}, nil
+	case "regex":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return &detector{pattern: re}, nil
+	}
+	return nil, fmt.Errorf("unknown detector %q", name)
+}
+
+// find returns the byte ranges of the sensitive parts of value
+func (d *detector) find(value string) [][]int {
+	matches := d.pattern.FindAllStringIndex(value, -1)
+	if d.valid == nil {
+		return matches
+	}
+	valid := matches[:0]
+	for _, m := range matches {
+		if d.valid(value[m[0]:m[1]]) {
+			valid = append(valid, m)
+		}
+	}
+	return valid
+}
+
+// luhn reports whether the digits of a candidate card number carry a valid
+// check digit, which rules out most order numbers and timestamps
+func luhn(candidate string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// validSSN rejects numbers the SSA never issues
+func validSSN(candidate string) bool {
+	area, group, serial := candidate[0:3], candidate[4:6], candidate[7:11]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
@@ -0,0 +1,255 @@
+package dlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"odin/pkg/config"
+)
+
+// Filter masks or drops sensitive values in one service's JSON responses
+type Filter struct {
+	service string
+	rules   []*rule
+	stats   *Stats
+}
+
+type rule struct {
+	name     string
+	action   string
+	fields   []string
+	detector *detector
+	maskChar string
+	keepLast int
+}
+
+// NewFilter compiles a service's rules. Occurrences are counted in stats,
+// which may be nil.
+func NewFilter(service string, cfg config.DLPConfig, stats *Stats) (*Filter, error) {
+	filter := &Filter{service: service, stats: stats}
+	for _, r := range cfg.Rules {
+		det, err := newDetector(r.Detector, r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		maskChar := r.MaskChar
+		if maskChar == "" {
+			maskChar = "*"
+		}
+		filter.rules = append(filter.rules, &rule{
+			name:     r.Name,
+			action:   r.Action,
+			fields:   r.Fields,
+			detector: det,
+			maskChar: maskChar,
+			keepLast: r.KeepLast,
+		})
+	}
+	return filter, nil
+}
+
+// Inspects reports whether a response with these headers can be filtered.
+// Only uncompressed JSON bodies are parsed.
+func Inspects(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Apply returns the body with the rules applied and whether anything was
+// masked or dropped. Unchanged bodies are returned as they are, so their
+// formatting is preserved.
+func (f *Filter) Apply(body []byte) ([]byte, bool, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, false, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return body, false, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	scope := make([]bool, len(f.rules))
+	for i, r := range f.rules {
+		scope[i] = len(r.fields) == 0
+	}
+	counts := make([]int, len(f.rules))
+
+	doc, dropped := f.walk(doc, "", scope, counts)
+	if dropped {
+		doc = nil
+	}
+
+	changed := false
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		changed = true
+		if f.stats != nil {
+			f.stats.Record(f.service, f.rules[i].name, f.rules[i].action, n)
+		}
+	}
+	if !changed {
+		return body, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return body, false, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), true, nil
+}
+
+// walk applies the rules in scope to a value and reports whether the value
+// must be removed from its parent
+func (f *Filter) walk(value interface{}, path string, scope []bool, counts []int) (interface{}, bool) {
+	// Fields selected by a drop rule without a detector go regardless of
+	// their content
+	for i, r := range f.rules {
+		if scope[i] && r.detector == nil && r.action == "drop" {
+			counts[i]++
+			return nil, true
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			result, drop := f.walk(child, childPath, f.childScope(scope, key, childPath), counts)
+			if drop {
+				delete(v, key)
+			} else {
+				v[key] = result
+			}
+		}
+		return v, false
+
+	case []interface{}:
+		kept := v[:0]
+		for _, child := range v {
+			if result, drop := f.walk(child, path, scope, counts); !drop {
+				kept = append(kept, result)
+			}
+		}
+		return kept, false
+
+	case string:
+		if masked, changed, drop := f.scalar(v, scope, counts); drop || changed {
+			return masked, drop
+		}
+		return v, false
+
+	case json.Number:
+		if masked, changed, drop := f.scalar(v.String(), scope, counts); drop || changed {
+			return masked, drop
+		}
+		return v, false
+
+	case bool:
+		if masked, changed, drop := f.scalar(strconv.FormatBool(v), scope, counts); drop || changed {
+			return masked, drop
+		}
+		return v, false
+	}
+
+	return value, false
+}
+
+// scalar applies the rules in scope to a string or number
+func (f *Filter) scalar(text string, scope []bool, counts []int) (string, bool, bool) {
+	changed := false
+	for i, r := range f.rules {
+		if !scope[i] {
+			continue
+		}
+		if r.detector == nil {
+			counts[i]++
+			text = r.mask(text)
+			changed = true
+			continue
+		}
+
+		matches := r.detector.find(text)
+		if len(matches) == 0 {
+			continue
+		}
+		counts[i] += len(matches)
+		if r.action == "drop" {
+			return "", false, true
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(text[last:m[0]])
+			b.WriteString(r.mask(text[m[0]:m[1]]))
+			last = m[1]
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+		changed = true
+	}
+	return text, changed, false
+}
+
+// childScope adds the rules whose fields select a key to its parent's scope.
+// Once a field is selected the rule applies to everything nested in it.
+func (f *Filter) childScope(scope []bool, key, path string) []bool {
+	var child []bool
+	for i, r := range f.rules {
+		if scope[i] || !r.selects(key, path) {
+			continue
+		}
+		if child == nil {
+			child = append([]bool(nil), scope...)
+		}
+		child[i] = true
+	}
+	if child == nil {
+		return scope
+	}
+	return child
+}
+
+// selects matches plain field names against the key and dotted paths
+// against the full path, ignoring case and array indices
+func (r *rule) selects(key, path string) bool {
+	for _, field := range r.fields {
+		if strings.Contains(field, ".") {
+			if strings.EqualFold(field, path) {
+				return true
+			}
+		} else if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// mask replaces all but the last keepLast characters
+func (r *rule) mask(value string) string {
+	runes := []rune(value)
+	visible := r.keepLast
+	if visible > len(runes) {
+		visible = len(runes)
+	}
+	return strings.Repeat(r.maskChar, len(runes)-visible) + string(runes[len(runes)-visible:])
+}
@@ -0,0 +1,68 @@
+package dlp
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Counter is the audit count of one rule of one service
+type Counter struct {
+	Service     string    `json:"service"`
+	Rule        string    `json:"rule"`
+	Action      string    `json:"action"`
+	Occurrences int64     `json:"occurrences"` // Values masked or dropped
+	Responses   int64     `json:"responses"`   // Responses with at least one occurrence
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+type counterKey struct {
+	service string
+	rule    string
+}
+
+// Stats counts what DLP rules removed from responses. It is shared by the
+// filters of all services.
+type Stats struct {
+	mu       sync.Mutex
+	counters map[counterKey]*Counter
+}
+
+// NewStats creates an empty set of counters
+func NewStats() *Stats {
+	return &Stats{counters: make(map[counterKey]*Counter)}
+}
+
+// Record adds the occurrences a rule found in one response
+func (s *Stats) Record(service, rule, action string, occurrences int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := counterKey{service: service, rule: rule}
+	counter, ok := s.counters[key]
+	if !ok {
+		counter = &Counter{Service: service, Rule: rule, Action: action}
+		s.counters[key] = counter
+	}
+	counter.Occurrences += int64(occurrences)
+	counter.Responses++
+	counter.LastSeen = time.Now()
+}
+
+// Snapshot returns a copy of the counters ordered by service and rule
+func (s *Stats) Snapshot() []Counter {
+	s.mu.Lock()
+	counters := make([]Counter, 0, len(s.counters))
+	for _, counter := range s.counters {
+		counters = append(counters, *counter)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Service != counters[j].Service {
+			return counters[i].Service < counters[j].Service
+		}
+		return counters[i].Rule < counters[j].Rule
+	})
+	return counters
+}
@@ -0,0 +1,304 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/requestid"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Error page formats
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+// PageData is what error page templates are rendered with
+type PageData struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+	Service    string
+	Method     string
+	Path       string
+	Time       time.Time
+}
+
+// template is satisfied by both text and HTML templates
+type template interface {
+	Execute(w io.Writer, data any) error
+}
+
+// pageSet holds the templates of the global or a service's error pages
+type pageSet struct {
+	format    string
+	templates map[string]template
+}
+
+// pageService is a service with its base path, to find the service a
+// request was for
+type pageService struct {
+	name     string
+	basePath string
+	pages    *pageSet
+}
+
+// Pages renders the errors the gateway generates on service routes with the
+// templates of the service, falling back to the global ones and then to a
+// built-in page, so that clients always get errors in one shape
+type Pages struct {
+	global   *pageSet
+	mu       sync.RWMutex
+	services []pageService // Longest base path first
+	logger   *logrus.Logger
+}
+
+// NewPages parses the global error page templates and those of services
+func NewPages(global config.ErrorPagesConfig, services []config.ServiceConfig, logger *logrus.Logger) (*Pages, error) {
+	globalSet, err := newPageSet(global, FormatJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pages{global: globalSet, logger: logger}
+	if err := p.SetServices(services); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetServices replaces the services whose errors are rendered, e.g. after
+// the configuration is reloaded
+func (p *Pages) SetServices(services []config.ServiceConfig) error {
+	var pageServices []pageService
+	for _, svc := range services {
+		if svc.BasePath == "" {
+			continue
+		}
+		service := pageService{name: svc.Name, basePath: strings.TrimSuffix(svc.BasePath, "/")}
+		if svc.ErrorPages != nil {
+			var err error
+			if service.pages, err = newPageSet(*svc.ErrorPages, p.global.format); err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+		}
+		pageServices = append(pageServices, service)
+	}
+	sort.SliceStable(pageServices, func(i, j int) bool {
+		return len(pageServices[i].basePath) > len(pageServices[j].basePath)
+	})
+
+	p.mu.Lock()
+	p.services = pageServices
+	p.mu.Unlock()
+	return nil
+}
+
+// newPageSet parses the templates of cfg, which are in defaultFormat unless
+// it sets its own
+func newPageSet(cfg config.ErrorPagesConfig, defaultFormat string) (*pageSet, error) {
+	set := &pageSet{format: cfg.Format, templates: make(map[string]template, len(cfg.Templates))}
+	if set.format == "" {
+		set.format = defaultFormat
+	}
+	for key, text := range cfg.Templates {
+		var (
+			tmpl template
+			err  error
+		)
+		if set.format == FormatHTML {
+			tmpl, err = htmltemplate.New(key).Parse(text)
+		} else {
+			tmpl, err = texttemplate.New(key).Funcs(texttemplate.FuncMap{"json": jsonValue}).Parse(text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", key, err)
+		}
+		set.templates[key] = tmpl
+	}
+	return set, nil
+}
+
+// lookup returns the template for status, trying the status code, its class
+// and then the default template
+func (s *pageSet) lookup(status int) template {
+	for _, key := range []string{strconv.Itoa(status), strconv.Itoa(status/100) + "xx", "default"} {
+		if tmpl, ok := s.templates[key]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// ErrorHandler renders errors of requests to services as error pages and
+// passes the rest, such as those of the admin API, to fallback
+func (p *Pages) ErrorHandler(fallback echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		service, ok := p.service(c)
+		if !ok {
+			fallback(err, c)
+			return
+		}
+		if c.Response().Committed {
+			return
+		}
+
+		status, message := errorStatus(err)
+		data := PageData{
+			Status:     status,
+			StatusText: http.StatusText(status),
+			Message:    message,
+			RequestID:  requestID(c),
+			Service:    service.name,
+			Method:     c.Request().Method,
+			Path:       c.Request().URL.Path,
+			Time:       time.Now().UTC(),
+		}
+
+		format, body := p.render(service, data)
+		contentType := echo.MIMEApplicationJSONCharsetUTF8
+		if format == FormatHTML {
+			contentType = echo.MIMETextHTMLCharsetUTF8
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(status)
+		} else {
+			err = c.Blob(status, contentType, body)
+		}
+		if err != nil {
+			p.logger.WithError(err).Error("Failed to write error response")
+		}
+	}
+}
+
+// render renders data with the service's template for its status, or else
+// the global one, or else the built-in page of the service's format
+func (p *Pages) render(service pageService, data PageData) (string, []byte) {
+	format := p.global.format
+	sets := []*pageSet{p.global}
+	if service.pages != nil {
+		format = service.pages.format
+		sets = []*pageSet{service.pages, p.global}
+	}
+
+	for _, set := range sets {
+		tmpl := set.lookup(data.Status)
+		if tmpl == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			p.logger.WithError(err).WithField("service", data.Service).Error("Failed to render error page")
+			break
+		}
+		return set.format, buf.Bytes()
+	}
+	return format, builtinPage(format, data)
+}
+
+// service returns the service with the longest base path the request is
+// under. A service at the root only claims requests routed to it, so that
+// errors of the admin API and other gateway routes keep their own shape.
+func (p *Pages) service(c echo.Context) (pageService, bool) {
+	path := c.Request().URL.Path
+	p.mu.RLock()
+	services := p.services
+	p.mu.RUnlock()
+	for _, service := range services {
+		if service.basePath == "" {
+			switch c.Path() {
+			case "", "/", "/*":
+				return service, true
+			}
+			continue
+		}
+		if path == service.basePath || strings.HasPrefix(path, service.basePath+"/") {
+			return service, true
+		}
+	}
+	return pageService{}, false
+}
+
+func builtinPage(format string, data PageData) []byte {
+	if format == FormatHTML {
+		var buf bytes.Buffer
+		if err := builtinHTML.Execute(&buf, data); err == nil {
+			return buf.Bytes()
+		}
+	}
+	body, _ := json.Marshal(struct {
+		Error     string `json:"error"`
+		Status    int    `json:"status"`
+		RequestID string `json:"requestId,omitempty"`
+	}{data.Message, data.Status, data.RequestID})
+	return body
+}
+
+var builtinHTML = htmltemplate.Must(htmltemplate.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`))
+
+// errorStatus returns the status code and message an error is reported with
+func errorStatus(err error) (int, string) {
+	var he *HTTPError
+	var ee *echo.HTTPError
+	switch {
+	case errors.As(err, &he):
+		return he.Code, he.Message
+	case errors.As(err, &ee):
+		if e, ok := ee.Message.(error); ok {
+			return ee.Code, e.Error()
+		}
+		return ee.Code, fmt.Sprint(ee.Message)
+	default:
+		return http.StatusInternalServerError, "Internal server error"
+	}
+}
+
+// requestID returns the ID of the request, assigning one if the client and
+// earlier middleware did not
+func requestID(c echo.Context) string {
+	if id, ok := c.Get(requestid.ContextKey).(string); ok {
+		return id
+	}
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	id := c.Request().Header.Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = uuid.NewString()
+	}
+	c.Response().Header().Set(echo.HeaderXRequestID, id)
+	return id
+}
+
+// jsonValue quotes v as a JSON value for JSON error templates
+func jsonValue(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
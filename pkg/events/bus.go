@@ -0,0 +1,363 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Source is set on every event emitted by the gateway
+const Source = "odin"
+
+// Headers sent with every webhook delivery
+const (
+	HeaderEvent     = "X-Odin-Event"
+	HeaderDelivery  = "X-Odin-Delivery"
+	HeaderTimestamp = "X-Odin-Timestamp"
+	HeaderSignature = "X-Odin-Signature"
+)
+
+// Bus fans gateway events out to in-process subscribers and configured webhooks.
+// Deliveries are asynchronous; failed webhook deliveries are retried with
+// exponential backoff and recorded in the dead-letter store.
+type Bus struct {
+	config      config.EventsConfig
+	deadLetters DeadLetterStore
+	logger      *logrus.Logger
+	client      *http.Client
+
+	subscribers []Subscriber
+	queue       chan Event
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+	mu          sync.RWMutex
+	running     bool
+}
+
+// NewBus creates a new event bus. deadLetters may be nil, in which case failed
+// deliveries are only logged.
+func NewBus(cfg config.EventsConfig, deadLetters DeadLetterStore, logger *logrus.Logger) *Bus {
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+
+	return &Bus{
+		config:      cfg,
+		deadLetters: deadLetters,
+		logger:      logger,
+		client:      &http.Client{},
+		queue:       make(chan Event, queueSize),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Subscribe registers an in-process subscriber. Subscribers run on the
+// delivery workers and must not block.
+func (b *Bus) Subscribe(subscriber Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Start launches the delivery workers
+func (b *Bus) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running {
+		return fmt.Errorf("event bus already running")
+	}
+	b.running = true
+
+	workers := b.config.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+	for i := 0; i < workers; i++ {
+		b.wg.Add(1)
+		go b.worker()
+	}
+
+	b.logger.WithFields(logrus.Fields{
+		"workers":  workers,
+		"webhooks": len(b.config.Webhooks),
+	}).Info("Event bus started")
+
+	return nil
+}
+
+// Stop stops the workers. Events still queued are dropped.
+func (b *Bus) Stop() error {
+	b.mu.Lock()
+	if !b.running {
+		b.mu.Unlock()
+		return fmt.Errorf("event bus not running")
+	}
+	b.running = false
+	b.mu.Unlock()
+
+	close(b.stopChan)
+	b.wg.Wait()
+
+	b.logger.Info("Event bus stopped")
+	return nil
+}
+
+// Publish queues an event for delivery. It never blocks: when the queue is
+// full the event is dropped and a warning is logged. Publishing on a nil bus
+// is a no-op so optional producers need no guard.
+func (b *Bus) Publish(eventType EventType, data map[string]interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Source:    Source,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+
+	select {
+	case b.queue <- event:
+	default:
+		b.logger.WithField("type", eventType).Warn("Event queue full, dropping event")
+	}
+}
+
+func (b *Bus) worker() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case event := <-b.queue:
+			b.dispatch(event)
+		}
+	}
+}
+
+// dispatch hands an event to subscribers and every matching webhook
+func (b *Bus) dispatch(event Event) {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		b.notify(subscriber, event)
+	}
+
+	for _, webhook := range b.config.Webhooks {
+		if !Matches(webhook.Events, event.Type) {
+			continue
+		}
+		b.deliver(webhook, event)
+	}
+}
+
+// notify calls a subscriber, isolating the bus from subscriber panics
+func (b *Bus) notify(subscriber Subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.WithFields(logrus.Fields{
+				"type":  event.Type,
+				"panic": r,
+			}).Error("Event subscriber panicked")
+		}
+	}()
+	subscriber(event)
+}
+
+// deliver posts an event to a webhook, retrying with exponential backoff
+func (b *Bus) deliver(webhook config.EventWebhookConfig, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		b.logger.WithError(err).WithField("type", event.Type).Error("Failed to encode event")
+		return
+	}
+
+	attempts, status, err := b.send(webhook, event.ID, event.Type, body)
+	if err == nil {
+		return
+	}
+
+	b.logger.WithError(err).WithFields(logrus.Fields{
+		"webhook":  webhook.Name,
+		"type":     event.Type,
+		"attempts": attempts,
+	}).Error("Event delivery failed")
+
+	if b.deadLetters == nil {
+		return
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return
+	}
+
+	letter := &mongodb.DeadLetterDocument{
+		ID:         uuid.New().String(),
+		EventID:    event.ID,
+		EventType:  string(event.Type),
+		Webhook:    webhook.Name,
+		URL:        webhook.URL,
+		Payload:    payload,
+		Attempts:   attempts,
+		LastStatus: status,
+		LastError:  err.Error(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.deadLetters.CreateDeadLetter(ctx, letter); err != nil {
+		b.logger.WithError(err).Warn("Failed to record event dead letter")
+	}
+}
+
+// Redeliver sends a dead-lettered event to its webhook once more, without retries
+func (b *Bus) Redeliver(letter *mongodb.DeadLetterDocument) error {
+	webhook, ok := b.webhook(letter.Webhook)
+	if !ok {
+		return fmt.Errorf("webhook %s is no longer configured", letter.Webhook)
+	}
+	webhook.MaxRetries = 0
+
+	body, err := json.Marshal(letter.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	_, _, err = b.send(webhook, letter.EventID, EventType(letter.EventType), body)
+	return err
+}
+
+func (b *Bus) webhook(name string) (config.EventWebhookConfig, bool) {
+	for _, webhook := range b.config.Webhooks {
+		if webhook.Name == name {
+			return webhook, true
+		}
+	}
+	return config.EventWebhookConfig{}, false
+}
+
+// send performs up to 1+MaxRetries attempts and returns the number of
+// attempts made and the last HTTP status received
+func (b *Bus) send(webhook config.EventWebhookConfig, deliveryID string, eventType EventType, body []byte) (int, int, error) {
+	backoff := webhook.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var lastStatus int
+	var lastErr error
+	attempts := 0
+
+	for attempt := 0; attempt <= webhook.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-b.stopChan:
+				return attempts, lastStatus, fmt.Errorf("event bus stopped: %w", lastErr)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		attempts++
+		lastStatus, lastErr = b.post(webhook, deliveryID, eventType, body)
+		if lastErr == nil {
+			return attempts, lastStatus, nil
+		}
+	}
+
+	return attempts, lastStatus, lastErr
+}
+
+func (b *Bus) post(webhook config.EventWebhookConfig, deliveryID string, eventType EventType, body []byte) (int, error) {
+	timeout := webhook.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Odin-Events/1.0")
+	req.Header.Set(HeaderEvent, string(eventType))
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if webhook.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+	}
+	for key, value := range webhook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign computes the X-Odin-Signature value for a delivery: an HMAC-SHA256 over
+// "<timestamp>.<body>", hex encoded and prefixed with "sha256=". Including the
+// timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches reports whether an event type is selected by a subscription list.
+// An empty list or "*" selects everything; "service.*" selects a whole group.
+func Matches(patterns []string, eventType EventType) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == string(eventType) {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(string(eventType), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
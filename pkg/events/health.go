@@ -0,0 +1,46 @@
+package events
+
+import (
+	"odin/pkg/health"
+)
+
+// AlertChannel forwards health alerts to the event bus so target state
+// changes reach event subscribers. It implements health.AlertChannel.
+type AlertChannel struct {
+	publisher Publisher
+}
+
+// NewAlertChannel creates a health alert channel that publishes events
+func NewAlertChannel(publisher Publisher) *AlertChannel {
+	return &AlertChannel{publisher: publisher}
+}
+
+// Name returns the channel name
+func (a *AlertChannel) Name() string {
+	return "events"
+}
+
+// Send publishes the alert as a target.* event
+func (a *AlertChannel) Send(alert health.Alert) error {
+	var eventType EventType
+	switch alert.Type {
+	case health.AlertTypeTargetDown:
+		eventType = TargetUnhealthy
+	case health.AlertTypeTargetRecovered:
+		eventType = TargetRecovered
+	default:
+		eventType = EventType("health." + string(alert.Type))
+	}
+
+	data := map[string]interface{}{
+		"target":   alert.Target,
+		"severity": alert.Severity,
+		"message":  alert.Message,
+	}
+	for key, value := range alert.Metadata {
+		data[key] = value
+	}
+
+	a.publisher.Publish(eventType, data)
+	return nil
+}
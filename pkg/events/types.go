@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"odin/pkg/mongodb"
+)
+
+// EventType identifies a gateway lifecycle event
+type EventType string
+
+const (
+	ServiceCreated  EventType = "service.created"
+	ServiceUpdated  EventType = "service.updated"
+	ServiceDeleted  EventType = "service.deleted"
+	PluginLoaded    EventType = "plugin.loaded"
+	PluginUnloaded  EventType = "plugin.unloaded"
+	TargetUnhealthy EventType = "target.unhealthy"
+	TargetRecovered EventType = "target.recovered"
+	AnomalyDetected EventType = "anomaly.detected"
+	ConfigReloaded  EventType = "config.reloaded"
+	UsageRecorded   EventType = "usage.recorded"
+	APIKeyRequested EventType = "apikey.requested"
+	APIKeyApproved  EventType = "apikey.approved"
+	APIKeyRejected  EventType = "apikey.rejected"
+)
+
+// Event is the envelope delivered to subscribers and webhooks
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      EventType              `json:"type"`
+	Source    string                 `json:"source"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Publisher emits events. Components that produce events depend on this
+// interface rather than on the bus itself.
+type Publisher interface {
+	Publish(eventType EventType, data map[string]interface{})
+}
+
+// Subscriber receives every published event in-process
+type Subscriber func(event Event)
+
+// DeadLetterStore persists deliveries that failed after all retries
+type DeadLetterStore interface {
+	CreateDeadLetter(ctx context.Context, letter *mongodb.DeadLetterDocument) error
+}
@@ -0,0 +1,224 @@
+// Package experiments runs A/B tests on services. Each client is placed in
+// a variant of the experiment, or left out of it, by a hash of its identity,
+// so it sees the same variant on every request and on every gateway.
+package experiments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Header tells clients and targets the variant of the request, as
+// experiment=variant. Clients cannot set it for targets.
+const Header = "X-Experiment"
+
+// ContextKey is where the middleware stores the *Variant of a request
+const ContextKey = "experiment.variant"
+
+// buckets is the resolution of traffic shares and weights
+const buckets = 10000
+
+var (
+	experimentRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_experiment_requests_total",
+			Help: "Total number of requests of clients in experiments by variant",
+		},
+		[]string{"service", "experiment", "variant", "status"},
+	)
+
+	experimentDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_gateway_experiment_request_duration_seconds",
+			Help:    "Duration of the requests of clients in experiments by variant",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"service", "experiment", "variant"},
+	)
+)
+
+// Variant is one arm of an experiment
+type Variant struct {
+	Name    string
+	Targets []string          // Replace the service's targets when not empty
+	Headers map[string]string // Added to the requests sent to targets
+	weight  int
+}
+
+// Experiment assigns the clients of a service to variants
+type Experiment struct {
+	service      string
+	name         string
+	traffic      int // Buckets in the experiment
+	claim        string
+	cookieName   string
+	cookieMaxAge time.Duration
+	variants     []*Variant
+	totalWeight  int
+}
+
+// New prepares the experiment of a service
+func New(service string, cfg config.ExperimentConfig) (*Experiment, error) {
+	if err := config.ValidateExperiment(&cfg); err != nil {
+		return nil, err
+	}
+	e := &Experiment{
+		service:      service,
+		name:         cfg.Name,
+		traffic:      cfg.Traffic * buckets / 100,
+		claim:        cfg.Claim,
+		cookieName:   cfg.CookieName,
+		cookieMaxAge: cfg.CookieMaxAge,
+	}
+	if e.cookieName == "" {
+		e.cookieName = "odin_exp_" + cfg.Name
+	}
+	if e.cookieMaxAge == 0 {
+		e.cookieMaxAge = 30 * 24 * time.Hour
+	}
+	for _, v := range cfg.Variants {
+		e.variants = append(e.variants, &Variant{Name: v.Name, Targets: v.Targets, Headers: v.Headers, weight: v.Weight})
+		e.totalWeight += v.Weight
+	}
+	return e, nil
+}
+
+// Name returns the name of the experiment
+func (e *Experiment) Name() string {
+	return e.name
+}
+
+// Assign returns the variant of the client with the given identity, and
+// nil if the client is not in the experiment. Whether a client takes part
+// and which variant it gets are hashed separately, so raising the traffic
+// share adds clients without moving those already in the experiment.
+func (e *Experiment) Assign(key string) *Variant {
+	if hash(e.name, "traffic", key)%buckets >= uint32(e.traffic) {
+		return nil
+	}
+	point := int(hash(e.name, "variant", key) % uint32(e.totalWeight))
+	for _, v := range e.variants {
+		if point < v.weight {
+			return v
+		}
+		point -= v.weight
+	}
+	return nil
+}
+
+// hash places a client in the same bucket on every gateway, differently for
+// every experiment so the same clients are not always in all of them
+func hash(parts ...string) uint32 {
+	h := fnv.New32a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return h.Sum32()
+}
+
+// Middleware assigns requests to variants. Requests of clients in the
+// experiment carry the variant's headers to targets and the Header to both
+// targets and clients, and are counted by variant. Clients without an
+// identity get a cookie holding a new one.
+func (e *Experiment) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			req.Header.Del(Header)
+
+			key, err := e.identity(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to assign experiment")
+			}
+			variant := e.Assign(key)
+			if variant == nil {
+				return next(c)
+			}
+
+			assignment := e.name + "=" + variant.Name
+			for name, value := range variant.Headers {
+				req.Header.Set(name, value)
+			}
+			req.Header.Set(Header, assignment)
+			c.Response().Header().Set(Header, assignment)
+			c.Set(ContextKey, variant)
+
+			start := time.Now()
+			err = next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+			experimentRequests.WithLabelValues(e.service, e.name, variant.Name, strconv.Itoa(status)).Inc()
+			experimentDuration.WithLabelValues(e.service, e.name, variant.Name).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// identity returns what the client is assigned by: its claim when
+// authenticated, its cookie otherwise
+func (e *Experiment) identity(c echo.Context) (string, error) {
+	if e.claim != "" {
+		if value, ok := claims(c)[e.claim]; ok && value != nil {
+			return "claim:" + fmt.Sprint(value), nil
+		}
+	}
+	if cookie, err := c.Cookie(e.cookieName); err == nil && cookie.Value != "" {
+		return "cookie:" + cookie.Value, nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+	c.SetCookie(&http.Cookie{
+		Name:     e.cookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(e.cookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "cookie:" + id, nil
+}
+
+// claims returns the authenticated client's JWT claims as a map
+func claims(c echo.Context) map[string]interface{} {
+	user := c.Get("user")
+	if user == nil {
+		return nil
+	}
+	if m, ok := user.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// FromContext returns the variant of the request, or nil
+func FromContext(c echo.Context) *Variant {
+	v, _ := c.Get(ContextKey).(*Variant)
+	return v
+}
@@ -0,0 +1,239 @@
+// Package faults injects latency, errors and aborted connections into the
+// requests of services, so their clients can be tested against failures.
+package faults
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Header tells clients which fault was injected into a response
+const Header = "X-Odin-Fault"
+
+var (
+	// ErrNotAllowed is returned when faults are set outside the allowed
+	// environments
+	ErrNotAllowed = errors.New("fault injection is not allowed in this environment")
+	// ErrUnknownService is returned for faults of services that do not exist
+	ErrUnknownService = errors.New("service not found")
+)
+
+var faultsInjected = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_faults_injected_total",
+		Help: "Total number of faults injected into requests by kind (delay, error or abort)",
+	},
+	[]string{"service", "kind"},
+)
+
+// defaultEnvironments are where faults are allowed unless configured
+var defaultEnvironments = []string{"development", "test", "staging"}
+
+// Fault is a fault in effect for a service
+type Fault struct {
+	config.FaultConfig
+	ExpiresAt time.Time // Zero if it does not expire
+}
+
+// Injector holds the faults of services and injects them into requests
+type Injector struct {
+	environment string
+	allowed     bool
+	logger      *logrus.Logger
+
+	mu       sync.RWMutex
+	services map[string]bool
+	faults   map[string]Fault
+}
+
+// New starts with the faults of the configured services. Outside the
+// allowed environments it holds none and rejects new ones.
+func New(cfg config.FaultsConfig, services []config.ServiceConfig, logger *logrus.Logger) *Injector {
+	allowed := cfg.AllowedEnvironments
+	if len(allowed) == 0 {
+		allowed = defaultEnvironments
+	}
+	i := &Injector{
+		environment: cfg.Environment,
+		allowed:     cfg.Environment != "" && slices.Contains(allowed, cfg.Environment),
+		services:    make(map[string]bool, len(services)),
+		logger:      logger,
+		faults:      make(map[string]Fault),
+	}
+	for _, svc := range services {
+		i.services[svc.Name] = true
+		if svc.Fault != nil && i.allowed {
+			i.faults[svc.Name] = Fault{FaultConfig: *svc.Fault}
+		}
+	}
+	return i
+}
+
+// SetServices replaces the services faults can be injected into, e.g. after
+// the configuration is reloaded. Faults of services that are gone are
+// dropped; those of the others are kept.
+func (i *Injector) SetServices(services []config.ServiceConfig) {
+	known := make(map[string]bool, len(services))
+	for _, svc := range services {
+		known[svc.Name] = true
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, svc := range services {
+		if _, set := i.faults[svc.Name]; !set && !i.services[svc.Name] && svc.Fault != nil && i.allowed {
+			i.faults[svc.Name] = Fault{FaultConfig: *svc.Fault}
+		}
+	}
+	for name := range i.faults {
+		if !known[name] {
+			delete(i.faults, name)
+		}
+	}
+	i.services = known
+}
+
+// Allowed reports whether faults can be injected in the gateway's
+// environment
+func (i *Injector) Allowed() bool {
+	return i.allowed
+}
+
+// Environment returns where the gateway runs
+func (i *Injector) Environment() string {
+	return i.environment
+}
+
+// Set injects fault into the requests of service, for ttl if it is not zero
+func (i *Injector) Set(service string, fault config.FaultConfig, ttl time.Duration) (Fault, error) {
+	if !i.allowed {
+		return Fault{}, ErrNotAllowed
+	}
+	i.mu.RLock()
+	known := i.services[service]
+	i.mu.RUnlock()
+	if !known {
+		return Fault{}, ErrUnknownService
+	}
+	if err := config.ValidateFault(fault); err != nil {
+		return Fault{}, err
+	}
+	f := Fault{FaultConfig: fault}
+	if ttl > 0 {
+		f.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	i.mu.Lock()
+	i.faults[service] = f
+	i.mu.Unlock()
+	i.logger.WithFields(logrus.Fields{
+		"service":   service,
+		"expiresAt": f.ExpiresAt,
+	}).Warn("Fault injection enabled")
+	return f, nil
+}
+
+// Clear stops injecting faults into the requests of service, and reports
+// whether it had any
+func (i *Injector) Clear(service string) bool {
+	i.mu.Lock()
+	_, ok := i.faults[service]
+	delete(i.faults, service)
+	i.mu.Unlock()
+	if ok {
+		i.logger.WithField("service", service).Info("Fault injection disabled")
+	}
+	return ok
+}
+
+// ClearAll stops injecting faults into all services
+func (i *Injector) ClearAll() {
+	i.mu.Lock()
+	clear(i.faults)
+	i.mu.Unlock()
+	i.logger.Info("Fault injection disabled for all services")
+}
+
+// Faults returns the faults in effect by service
+func (i *Injector) Faults() map[string]Fault {
+	now := time.Now()
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	faults := make(map[string]Fault, len(i.faults))
+	for service, f := range i.faults {
+		if f.ExpiresAt.IsZero() || now.Before(f.ExpiresAt) {
+			faults[service] = f
+		}
+	}
+	return faults
+}
+
+// fault returns the fault in effect for service
+func (i *Injector) fault(service string) (Fault, bool) {
+	i.mu.RLock()
+	f, ok := i.faults[service]
+	i.mu.RUnlock()
+	if ok && !f.ExpiresAt.IsZero() && !time.Now().Before(f.ExpiresAt) {
+		return Fault{}, false
+	}
+	return f, ok
+}
+
+// Middleware injects the faults of service into its requests. Delays come
+// first; then the request is aborted, failed or served.
+func (i *Injector) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			f, ok := i.fault(service)
+			if !ok {
+				return next(c)
+			}
+
+			if roll(f.DelayPercentage) {
+				faultsInjected.WithLabelValues(service, "delay").Inc()
+				c.Response().Header().Add(Header, "delay")
+				timer := time.NewTimer(f.Delay)
+				select {
+				case <-timer.C:
+				case <-c.Request().Context().Done():
+					timer.Stop()
+					return c.Request().Context().Err()
+				}
+			}
+
+			// A single roll keeps the two outcomes exclusive
+			point := rand.Float64() * 100
+			switch {
+			case point < f.AbortPercentage:
+				faultsInjected.WithLabelValues(service, "abort").Inc()
+				// Closes the connection, or resets the HTTP/2 stream,
+				// without a response
+				panic(http.ErrAbortHandler)
+			case point < f.AbortPercentage+f.ErrorPercentage:
+				faultsInjected.WithLabelValues(service, "error").Inc()
+				status := f.ErrorStatus
+				if status == 0 {
+					status = http.StatusServiceUnavailable
+				}
+				c.Response().Header().Add(Header, "error")
+				return echo.NewHTTPError(status, "Fault injected")
+			}
+			return next(c)
+		}
+	}
+}
+
+// roll returns true with the given probability in percent
+func roll(percentage float64) bool {
+	return percentage > 0 && rand.Float64()*100 < percentage
+}
@@ -0,0 +1,343 @@
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags evaluates feature flags per request. Flags come from the
+// configuration and, optionally, a file that is reloaded when it changes.
+type Flags struct {
+	file     string
+	interval time.Duration
+	logger   *logrus.Logger
+
+	mu        sync.Mutex
+	inline    map[string]config.FeatureFlagConfig
+	fromFile  map[string]config.FeatureFlagConfig
+	stamp     fileStamp
+	compiled  atomic.Pointer[map[string]*flag]
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	startOnce sync.Once
+}
+
+type flag struct {
+	def   any
+	rules []rule
+}
+
+type rule struct {
+	header     string
+	claim      string
+	values     map[string]bool
+	percentage int // -1 when the rule has none
+	value      any
+}
+
+// fileStamp identifies a version of the flags file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the flags of cfg, including those of its file
+func New(cfg config.FeatureFlagsConfig, logger *logrus.Logger) (*Flags, error) {
+	f := &Flags{
+		file:     cfg.File,
+		interval: cfg.PollInterval,
+		logger:   logger,
+		inline:   cfg.Flags,
+		stopChan: make(chan struct{}),
+	}
+	if f.interval == 0 {
+		f.interval = 10 * time.Second
+	}
+	if f.file != "" {
+		if _, err := f.Reload(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	if err := f.compile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetFlags replaces the flags defined in the configuration. Flags from the
+// file still override them.
+func (f *Flags) SetFlags(flags map[string]config.FeatureFlagConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inline = flags
+	return f.compileLocked()
+}
+
+// Reload reads the flags file again if it changed since it was last read.
+// On error the current flags are kept.
+func (f *Flags) Reload() (bool, error) {
+	if f.file == "" {
+		return false, nil
+	}
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return false, fmt.Errorf("feature flags file: %w", err)
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if stamp == f.stamp && f.compiled.Load() != nil {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(f.file)
+	if err != nil {
+		return false, fmt.Errorf("feature flags file: %w", err)
+	}
+	var file struct {
+		Flags map[string]config.FeatureFlagConfig `yaml:"flags"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("feature flags file %s: %w", f.file, err)
+	}
+	if err := config.ValidateFeatureFlags(file.Flags); err != nil {
+		return false, fmt.Errorf("feature flags file %s: %w", f.file, err)
+	}
+
+	previous := f.fromFile
+	f.fromFile = file.Flags
+	if err := f.compileLocked(); err != nil {
+		f.fromFile = previous
+		return false, err
+	}
+	f.stamp = stamp
+	return true, nil
+}
+
+func (f *Flags) compile() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compileLocked()
+}
+
+func (f *Flags) compileLocked() error {
+	all := make(map[string]config.FeatureFlagConfig, len(f.inline)+len(f.fromFile))
+	maps.Copy(all, f.inline)
+	maps.Copy(all, f.fromFile)
+	if err := config.ValidateFeatureFlags(all); err != nil {
+		return err
+	}
+
+	compiled := make(map[string]*flag, len(all))
+	for name, cfg := range all {
+		fl := &flag{def: cfg.Default}
+		for _, r := range cfg.Rules {
+			compiledRule := rule{header: r.Header, claim: r.Claim, percentage: -1, value: r.Value}
+			if r.Percentage != nil {
+				compiledRule.percentage = *r.Percentage
+			}
+			if len(r.Values) > 0 {
+				compiledRule.values = make(map[string]bool, len(r.Values))
+				for _, v := range r.Values {
+					compiledRule.values[v] = true
+				}
+			}
+			fl.rules = append(fl.rules, compiledRule)
+		}
+		compiled[name] = fl
+	}
+	f.compiled.Store(&compiled)
+	return nil
+}
+
+// Start checks the flags file for changes until Stop is called
+func (f *Flags) Start() {
+	if f.file == "" {
+		return
+	}
+	f.startOnce.Do(func() {
+		f.wg.Add(1)
+		go f.watch()
+	})
+}
+
+// Stop stops checking the flags file
+func (f *Flags) Stop() {
+	select {
+	case <-f.stopChan:
+	default:
+		close(f.stopChan)
+	}
+	f.wg.Wait()
+}
+
+func (f *Flags) watch() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stopChan:
+			return
+		case <-ticker.C:
+			reloaded, err := f.Reload()
+			if err != nil {
+				f.logger.WithError(err).Warn("Failed to reload feature flags, keeping the current ones")
+			} else if reloaded {
+				f.logger.WithField("file", f.file).Info("Feature flags reloaded")
+			}
+		}
+	}
+}
+
+// Evaluate returns the value of the flag for the request, and false if the
+// flag is not defined
+func (f *Flags) Evaluate(c echo.Context, name string) (any, bool) {
+	compiled := f.compiled.Load()
+	if compiled == nil {
+		return nil, false
+	}
+	fl, ok := (*compiled)[name]
+	if !ok {
+		return nil, false
+	}
+	for _, r := range fl.rules {
+		if r.matches(c, name) {
+			return r.value, true
+		}
+	}
+	return fl.def, true
+}
+
+// Bool returns the value of a boolean flag, or fallback if it is not
+// defined
+func (f *Flags) Bool(c echo.Context, name string, fallback bool) bool {
+	value, _ := f.Evaluate(c, name)
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return fallback
+}
+
+// Int returns the value of a numeric flag, or fallback if it is not defined
+func (f *Flags) Int(c echo.Context, name string, fallback int) int {
+	value, _ := f.Evaluate(c, name)
+	switch n := value.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return fallback
+}
+
+// Gate answers 404 to the requests the flag is off for, as if the route did
+// not exist
+func (f *Flags) Gate(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !f.Bool(c, name, false) {
+				return echo.NewHTTPError(http.StatusNotFound, "Not Found")
+			}
+			return next(c)
+		}
+	}
+}
+
+// matches reports whether the rule applies to the request
+func (r *rule) matches(c echo.Context, name string) bool {
+	var keys []string
+	switch {
+	case r.header != "":
+		keys = c.Request().Header.Values(r.header)
+	case r.claim != "":
+		keys = claimValues(c, r.claim)
+	default:
+		keys = []string{c.RealIP()}
+	}
+
+	for _, key := range keys {
+		if r.values != nil && !r.values[key] {
+			continue
+		}
+		if r.percentage >= 0 && bucket(name, key) >= r.percentage {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// bucket places key in one of 100 buckets, differently for every flag so
+// the same clients are not always the first to get every feature
+func bucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
+
+// claimValues returns the claim of the authenticated client as strings; list
+// claims such as roles give one value per element
+func claimValues(c echo.Context, name string) []string {
+	switch v := claims(c)[name].(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// claims returns the authenticated client's JWT claims as a map
+func claims(c echo.Context) map[string]interface{} {
+	user := c.Get("user")
+	if user == nil {
+		return nil
+	}
+	if m, ok := user.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// Defined reports whether name is a flag
+func (f *Flags) Defined(name string) bool {
+	compiled := f.compiled.Load()
+	if compiled == nil {
+		return false
+	}
+	_, ok := (*compiled)[name]
+	return ok
+}
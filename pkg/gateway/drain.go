@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requestTracker keeps the requests the gateway is serving, WebSocket
+// connections included, so Shutdown can wait for them and report the ones it
+// cuts off
+type requestTracker struct {
+	mu       sync.Mutex
+	active   map[*trackedRequest]struct{}
+	draining bool
+	idle     chan struct{}
+}
+
+type trackedRequest struct {
+	method    string
+	path      string
+	websocket bool
+	started   time.Time
+	cancel    context.CancelFunc
+}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{active: make(map[*trackedRequest]struct{})}
+}
+
+// Middleware tracks each request for as long as its handler runs. Once the
+// gateway is draining, new requests are refused with 503.
+func (t *requestTracker) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx, cancel := context.WithCancel(req.Context())
+			r := &trackedRequest{
+				method:    req.Method,
+				path:      req.URL.Path,
+				websocket: c.IsWebSocket(),
+				started:   time.Now(),
+				cancel:    cancel,
+			}
+			if !t.add(r) {
+				cancel()
+				c.Response().Header().Set(echo.HeaderConnection, "close")
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Server is shutting down")
+			}
+			defer t.remove(r)
+
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+func (t *requestTracker) add(r *trackedRequest) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.active[r] = struct{}{}
+	return true
+}
+
+func (t *requestTracker) remove(r *trackedRequest) {
+	r.cancel()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.active, r)
+	if t.draining && len(t.active) == 0 {
+		t.closeIdle()
+	}
+}
+
+// closeIdle signals that the last request has finished; t.mu must be held
+func (t *requestTracker) closeIdle() {
+	select {
+	case <-t.idle:
+	default:
+		close(t.idle)
+	}
+}
+
+// drain stops admitting requests and waits for the active ones to finish
+// until ctx is done
+func (t *requestTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.draining {
+		t.draining = true
+		t.idle = make(chan struct{})
+		if len(t.active) == 0 {
+			t.closeIdle()
+		}
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forceClose cancels the contexts of the requests still active, oldest
+// first, and returns them. Proxied requests are aborted and WebSocket
+// connections closed with status 1001.
+func (t *requestTracker) forceClose() []*trackedRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	closed := make([]*trackedRequest, 0, len(t.active))
+	for r := range t.active {
+		r.cancel()
+		closed = append(closed, r)
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].started.Before(closed[j].started)
+	})
+	return closed
+}
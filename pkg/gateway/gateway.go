@@ -2,53 +2,152 @@ package gateway
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"slices"
+	"sync"
 	"time"
 
+	"odin/pkg/acme"
 	"odin/pkg/admin"
 	"odin/pkg/aggregator"
+	"odin/pkg/ai"
+	"odin/pkg/apidocs"
+	"odin/pkg/async"
 	"odin/pkg/auth"
+	"odin/pkg/backup"
+	"odin/pkg/bot"
 	"odin/pkg/cache"
+	"odin/pkg/certs"
 	"odin/pkg/config"
-	"odin/pkg/graphql"
-	"odin/pkg/grpc"
+	"odin/pkg/consumers"
+	"odin/pkg/discovery"
+	"odin/pkg/dlp"
+	"odin/pkg/errors"
+	"odin/pkg/events"
+	"odin/pkg/faults"
+	"odin/pkg/flags"
+	"odin/pkg/geoip"
+	"odin/pkg/gitops"
 	"odin/pkg/health"
 	"odin/pkg/integrations/postman"
+	"odin/pkg/ipfilter"
 	"odin/pkg/logging"
+	"odin/pkg/metering"
 	"odin/pkg/middleware"
+	"odin/pkg/mock"
 	"odin/pkg/mongodb"
 	"odin/pkg/monitoring"
+	"odin/pkg/openapi"
+	"odin/pkg/overload"
 	"odin/pkg/plugins"
+	"odin/pkg/portal"
+	"odin/pkg/products"
+	"odin/pkg/ratelimit"
+	"odin/pkg/requestid"
+	"odin/pkg/revocation"
 	"odin/pkg/routing"
+	"odin/pkg/scheduler"
 	"odin/pkg/service"
 	"odin/pkg/servicemesh"
+	"odin/pkg/streaming"
+	"odin/pkg/tcpproxy"
 	"odin/pkg/tracing"
+	"odin/pkg/transform"
+	"odin/pkg/upgrade"
+	"odin/pkg/websocket"
 
 	"github.com/labstack/echo/v4"
 	echomw "github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
 type Gateway struct {
-	server          *echo.Echo
-	config          *config.Config
-	logger          *logrus.Logger
-	adminHandler    *admin.AdminHandler
-	serviceRegistry *service.Registry
-	router          *routing.Router
-	pluginManager   *plugins.PluginManager
-	tracingManager  *tracing.Manager
-	healthChecker   *health.TargetChecker
-	alertManager    *health.AlertManager
-	meshManager     *servicemesh.Manager
-	mongoRepo       mongodb.Repository
+	server           *echo.Echo
+	requests         *requestTracker
+	config           *config.Store
+	logger           *logrus.Logger
+	adminHandler     *admin.AdminHandler
+	serviceRegistry  *service.Registry
+	router           *routing.Router
+	pluginManager    *plugins.PluginManager
+	tracingManager   *tracing.Manager
+	healthChecker    *health.TargetChecker
+	resolver         *discovery.Resolver
+	flags            *flags.Flags
+	async            *async.Manager
+	scheduler        *scheduler.Scheduler
+	revocations      *revocation.List
+	apiKeyLimiter    *auth.APIKeyLimiter
+	oidcProviders    map[string]*auth.OIDCProvider
+	healthHistory    *health.History
+	readiness        *health.Readiness
+	alertManager     *health.AlertManager
+	meshManager      *servicemesh.Manager
+	mongoRepo        mongodb.Repository
+	gitopsSyncer     *gitops.Syncer
+	backups          *backup.Scheduler
+	acmeManager      *acme.Manager
+	trafficCollector *ai.TrafficCollector
+	fingerprints     *certs.FingerprintRecorder
+	certReloader     *certs.Reloader
+	eventBus         *events.Bus
+	streaming        *streaming.Pipeline
+	httpServer       *http.Server
+	plainServer      *http.Server
+	tcpProxies       []*tcpproxy.Proxy
+	portal           *portal.Portal
+	meter            *metering.Meter
+	consumers        *consumers.Registry
+	upgrader         *upgrade.Upgrader
+	listening        chan struct{}
+	reloadMu         sync.Mutex
+
+	// Components rebuilt or updated when the services change
+	aggregator *aggregator.Aggregator
+	errorPages *errors.Pages
+	faults     *faults.Injector
+	ipFilter   *ipfilter.Filter
+	apiKeys    *auth.APIKeyAuth
+	wsLimiter  *websocket.Limiter
+	dlpStats   *dlp.Stats
+	routed     map[string][]byte      // The services routed, marshaled
+	stored     []config.ServiceConfig // Services from MongoDB routed after the configured ones
+	closers    []func()               // Release the protocol proxies of the routed services
+	checksMu   sync.Mutex
+	checks     map[string]serviceCheck
 }
 
-func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway, error) {
+// New builds a gateway from opts. It serves nothing until Start is called,
+// but can be used as an http.Handler right away, e.g. in tests.
+func New(opts ...Option) (*Gateway, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg, configPath, logger := o.config, o.configPath, o.logger
+
 	e := echo.New()
 
+	// Reject oversized request lines and headers before anything else runs
+	e.Pre(middleware.RequestLimitsMiddleware(cfg.Server.Limits, logger))
+
+	// Identify every request before anything logs or forwards it
+	requestIDs, err := requestid.New(cfg.Server.RequestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize request IDs: %w", err)
+	}
+	e.Pre(requestIDs.Middleware())
+
+	// Track requests in flight so shutdown can drain them
+	requests := newRequestTracker()
+	e.Pre(requests.Middleware())
+
 	// Initialize distributed tracing
 	tracingConfig := tracing.Config{
 		Enabled:        cfg.Tracing.Enabled,
@@ -58,6 +157,14 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		Endpoint:       cfg.Tracing.Endpoint,
 		SampleRate:     cfg.Tracing.SampleRate,
 		Insecure:       cfg.Tracing.Insecure,
+		Logs: tracing.LogsConfig{
+			Enabled:       cfg.Tracing.Logs.Enabled,
+			Endpoint:      cfg.Tracing.Logs.Endpoint,
+			Level:         cfg.Tracing.Logs.Level,
+			BatchSize:     cfg.Tracing.Logs.BatchSize,
+			FlushInterval: cfg.Tracing.Logs.FlushInterval,
+			QueueSize:     cfg.Tracing.Logs.QueueSize,
+		},
 	}
 
 	tracingManager, err := tracing.NewManager(tracingConfig, logger)
@@ -68,6 +175,7 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 	// Add OpenTelemetry middleware for Echo
 	if cfg.Tracing.Enabled {
 		e.Use(otelecho.Middleware(cfg.Tracing.ServiceName))
+		e.Use(requestid.TraceMiddleware())
 	}
 
 	// Add monitoring middleware
@@ -84,83 +192,47 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		}
 	})
 
-	registry := service.NewRegistry(logger)
-
-	for _, svcConfig := range cfg.Services {
-		svc := &service.Config{
-			Name:           svcConfig.Name,
-			BasePath:       svcConfig.BasePath,
-			Targets:        svcConfig.Targets,
-			StripBasePath:  svcConfig.StripBasePath,
-			Timeout:        svcConfig.Timeout,
-			RetryCount:     svcConfig.RetryCount,
-			RetryDelay:     svcConfig.RetryDelay,
-			Authentication: svcConfig.Authentication,
-			LoadBalancing:  svcConfig.LoadBalancing,
-			Headers:        svcConfig.Headers,
-			Protocol:       svcConfig.Protocol,
-		}
-
-		svc.Transform.Request = make([]service.TransformRule, len(svcConfig.Transform.Request))
-		for i, rule := range svcConfig.Transform.Request {
-			svc.Transform.Request[i] = service.TransformRule{
-				From:    rule.From,
-				To:      rule.To,
-				Default: rule.Default,
-			}
-		}
-
-		svc.Transform.Response = make([]service.TransformRule, len(svcConfig.Transform.Response))
-		for i, rule := range svcConfig.Transform.Response {
-			svc.Transform.Response[i] = service.TransformRule{
-				From:    rule.From,
-				To:      rule.To,
-				Default: rule.Default,
-			}
-		}
-
-		if svcConfig.Aggregation != nil {
-			aggregation := &service.AggregationConfig{
-				Dependencies: make([]service.DependencyConfig, len(svcConfig.Aggregation.Dependencies)),
-			}
-
-			for i, dep := range svcConfig.Aggregation.Dependencies {
-				dependency := service.DependencyConfig{
-					Service:          dep.Service,
-					Path:             dep.Path,
-					ParameterMapping: make([]service.MappingConfig, len(dep.ParameterMapping)),
-					ResultMapping:    make([]service.MappingConfig, len(dep.ResultMapping)),
-				}
-
-				for j, mapping := range dep.ParameterMapping {
-					dependency.ParameterMapping[j] = service.MappingConfig{
-						From: mapping.From,
-						To:   mapping.To,
-					}
-				}
-
-				for j, mapping := range dep.ResultMapping {
-					dependency.ResultMapping[j] = service.MappingConfig{
-						From: mapping.From,
-						To:   mapping.To,
-					}
-				}
+	registry := newServiceRegistry(cfg.Services, logger)
 
-				aggregation.Dependencies[i] = dependency
-			}
+	router := routing.NewRouter(e, registry, logger)
 
-			svc.Aggregation = aggregation
-		}
+	// Evaluate the feature flags that gate routes, canary weights and plugins
+	featureFlags, err := flags.New(cfg.FeatureFlags, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	router.SetFlags(featureFlags)
+	warnUndefinedFlags(cfg, featureFlags, logger)
 
-		if err := registry.Register(svc); err != nil {
-			logger.WithError(err).Warnf("Failed to register service %s", svc.Name)
+	// Render the errors the gateway generates on service routes in one shape
+	errorPages, err := errors.NewPages(cfg.ErrorPages, cfg.Services, logger)
+	if err != nil {
+		return nil, fmt.Errorf("error pages: %w", err)
+	}
+	e.HTTPErrorHandler = errorPages.ErrorHandler(e.DefaultHTTPErrorHandler)
+
+	configs := config.NewStore(cfg)
+	adminHandler := admin.New(configs, configPath, logger)
+
+	// Keep the latest logs for admin API clients such as odinctl to read
+	logTail := logging.NewTail(1000)
+	logger.AddHook(logTail)
+	adminHandler.SetLogTail(logTail)
+
+	// Inject failures into services for resilience testing, only where the
+	// environment allows it
+	var injector *faults.Injector
+	if cfg.Faults.Enabled {
+		injector = faults.New(cfg.Faults, cfg.Services, logger)
+		if injector.Allowed() {
+			router.SetFaults(injector)
+			logger.WithField("environment", cfg.Faults.Environment).Warn("Fault injection is enabled")
+		} else {
+			logger.WithField("environment", cfg.Faults.Environment).Warn("Fault injection is not allowed in this environment, ignoring faults")
 		}
+		adminHandler.SetFaults(injector)
 	}
 
-	router := routing.NewRouter(e, registry, logger)
-
-	adminHandler := admin.New(cfg, configPath, logger)
-
 	// Initialize MongoDB repository
 	mongoConfig := &mongodb.Config{
 		Enabled:        cfg.MongoDB.Enabled,
@@ -182,14 +254,44 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		},
 	}
 
-	mongoRepo, err := mongodb.NewRepository(mongoConfig, logger)
-	if err != nil {
-		logger.WithError(err).Warn("Failed to initialize MongoDB repository, plugin persistence will be disabled")
-		mongoRepo = nil
+	mongoRepo := o.store
+	if mongoRepo == nil {
+		mongoRepo, err = mongodb.NewRepository(mongoConfig, logger)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to initialize MongoDB repository, plugin persistence will be disabled")
+			mongoRepo = nil
+		}
+	}
+
+	// Admin users with roles, and the refresh tokens of their sessions, are
+	// kept in MongoDB
+	if cfg.MongoDB.Enabled && mongoRepo != nil {
+		adminHandler.SetUserStore(mongoRepo)
+		adminHandler.SetSessions(mongoRepo, auth.JWTSecret(cfg.Auth))
+		adminHandler.SetMongoDBServices(mongodb.NewServiceAdapter(mongoRepo, logger))
+	}
+
+	// Initialize lifecycle event bus
+	var eventBus *events.Bus
+	if cfg.Events.Enabled {
+		var deadLetters events.DeadLetterStore
+		var eventsRepo mongodb.Repository
+		if cfg.MongoDB.Enabled && mongoRepo != nil {
+			deadLetters = mongoRepo
+			eventsRepo = mongoRepo
+		}
+		eventBus = events.NewBus(cfg.Events, deadLetters, logger)
+		if err := eventBus.Start(); err != nil {
+			logger.WithError(err).Warn("Failed to start event bus")
+		}
+		adminHandler.SetEventBus(eventBus, eventsRepo)
 	}
 
 	// Initialize plugin manager
 	pluginManager := plugins.NewPluginManager(logger)
+	if eventBus != nil {
+		pluginManager.SetEventPublisher(eventBus)
+	}
 
 	// Initialize plugin repository if MongoDB is available
 	var pluginRepo *plugins.PluginRepository
@@ -266,6 +368,22 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		}
 	}
 
+	for _, pluginCfg := range cfg.Plugins.Plugins {
+		if pluginCfg.Flag != "" {
+			flag := pluginCfg.Flag
+			pluginManager.SetGate(pluginCfg.Name, func(c echo.Context) bool {
+				return featureFlags.Bool(c, flag, false)
+			})
+		}
+	}
+
+	// Plugins passed by the program embedding the gateway
+	for _, p := range o.plugins {
+		if err := pluginManager.RegisterPlugin(p.plugin, p.config, p.hooks); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.plugin.Name(), err)
+		}
+	}
+
 	// Initialize alert manager for health checks
 	alertManager := health.NewAlertManager(logger)
 
@@ -279,6 +397,14 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		logger.WithField("webhook", cfg.Monitoring.WebhookURL).Info("Health alert webhook configured")
 	}
 
+	// Add native notification channels
+	addAlertChannels(alertManager, cfg.Monitoring.Alerts, logger)
+
+	// Forward target health changes to the event bus
+	if eventBus != nil {
+		alertManager.AddChannel(events.NewAlertChannel(eventBus))
+	}
+
 	alertManager.Start()
 	logger.Info("Alert manager started")
 
@@ -293,6 +419,18 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 	}
 	healthChecker := health.NewTargetChecker(healthCheckerConfig, logger, alertManager)
 
+	// Keep aggregated check results for uptime and latency history
+	var healthHistory *health.History
+	if cfg.Monitoring.History.Enabled {
+		if mongoRepo == nil {
+			return nil, fmt.Errorf("health check history requires a MongoDB connection")
+		}
+		healthHistory = health.NewHistory(cfg.Monitoring.History, mongoRepo, logger)
+		healthChecker.SetRecorder(healthHistory)
+		adminHandler.SetHealthHistory(healthHistory)
+		logger.WithField("resolution", cfg.Monitoring.History.Resolution).Info("Health check history enabled")
+	}
+
 	// Initialize service mesh integration
 	meshConfig := servicemesh.Config{
 		Enabled:         cfg.ServiceMesh.Enabled,
@@ -344,7 +482,9 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 
 	gateway := &Gateway{
 		server:          e,
-		config:          cfg,
+		requests:        requests,
+		listening:       make(chan struct{}),
+		config:          configs,
 		logger:          logger,
 		adminHandler:    adminHandler,
 		serviceRegistry: registry,
@@ -352,49 +492,59 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		pluginManager:   pluginManager,
 		tracingManager:  tracingManager,
 		healthChecker:   healthChecker,
+		healthHistory:   healthHistory,
 		alertManager:    alertManager,
 		meshManager:     meshManager,
 		mongoRepo:       mongoRepo,
+		eventBus:        eventBus,
+		aggregator:      agg,
+		errorPages:      errorPages,
+		faults:          injector,
 	}
 
-	// Setup protocol-specific proxies
-	for _, svcConfig := range cfg.Services {
-		switch svcConfig.Protocol {
-		case "graphql":
-			if svcConfig.GraphQL != nil && len(svcConfig.Targets) > 0 {
-				graphqlConfig := &graphql.ProxyConfig{
-					Endpoint:            svcConfig.Targets[0],
-					MaxQueryDepth:       svcConfig.GraphQL.MaxQueryDepth,
-					MaxQueryComplexity:  svcConfig.GraphQL.MaxQueryComplexity,
-					EnableIntrospection: svcConfig.GraphQL.EnableIntrospection,
-					Timeout:             svcConfig.Timeout,
-					EnableQueryCaching:  svcConfig.GraphQL.EnableQueryCaching,
-					CacheTTL:            svcConfig.GraphQL.CacheTTL,
-				}
-				graphqlProxy := graphql.NewProxy(graphqlConfig, logger)
-				graphqlProxy.RegisterRoutes(e, svcConfig.BasePath)
-				logger.WithField("service", svcConfig.Name).Info("GraphQL proxy registered")
-			}
-		case "grpc":
-			if svcConfig.GRPC != nil && len(svcConfig.Targets) > 0 {
-				grpcConfig := &grpc.ProxyConfig{
-					Target:           svcConfig.Targets[0],
-					MaxMessageSize:   svcConfig.GRPC.MaxMessageSize,
-					Timeout:          svcConfig.Timeout,
-					EnableTLS:        svcConfig.GRPC.EnableTLS,
-					TLSCertFile:      svcConfig.GRPC.TLSCertFile,
-					TLSKeyFile:       svcConfig.GRPC.TLSKeyFile,
-					EnableReflection: svcConfig.GRPC.EnableReflection,
-				}
-				grpcProxy, err := grpc.NewProxy(grpcConfig, logger)
-				if err != nil {
-					logger.WithError(err).Warnf("Failed to create gRPC proxy for service %s", svcConfig.Name)
-				} else {
-					grpcProxy.RegisterRoutes(e, svcConfig.BasePath)
-					logger.WithField("service", svcConfig.Name).Info("gRPC proxy registered")
-				}
+	// Initialize GitOps configuration sync
+	if cfg.GitOps.Enabled {
+		var recorder gitops.Recorder
+		if cfg.MongoDB.Enabled && mongoRepo != nil {
+			recorder = mongodb.NewConfigManager(mongoRepo, logger)
+		}
+		gateway.gitopsSyncer = gitops.NewSyncer(cfg.GitOps, gateway.currentConfig, gateway, recorder, logger)
+		adminHandler.SetGitOpsSyncer(gateway.gitopsSyncer)
+		if err := gateway.gitopsSyncer.Start(context.Background()); err != nil {
+			logger.WithError(err).Warn("Failed to start GitOps syncer")
+		}
+	}
+
+	// Snapshot the configuration on a schedule
+	if cfg.Backup.Enabled {
+		var configs backup.ConfigSource
+		if mongoRepo != nil {
+			configs = mongoRepo
+		}
+		gateway.backups, err = backup.NewScheduler(cfg.Backup, configPath, configs, logger)
+		if err != nil {
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+		gateway.backups.Start()
+		adminHandler.SetBackupScheduler(gateway.backups)
+		logger.WithField("schedule", cfg.Backup.Schedule).Info("Scheduled config backups enabled")
+	}
+
+	// Initialize automatic certificates; the manager starts with the listeners
+	if acmeCfg := cfg.Server.TLS.ACME; cfg.Server.TLS.Enabled && acmeCfg.Enabled {
+		var storage acme.Storage = acme.NewDiskStorage(acmeCfg.StorageDir)
+		if acmeCfg.Storage == "mongodb" {
+			if mongoRepo == nil {
+				return nil, fmt.Errorf("ACME mongodb storage requires a MongoDB connection")
 			}
+			storage = acme.NewMongoStorage(mongoRepo)
+		}
+		acmeManager, err := acme.NewManager(acmeCfg, storage, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize ACME: %w", err)
 		}
+		gateway.acmeManager = acmeManager
+		adminHandler.SetACMEManager(acmeManager)
 	}
 
 	logging.ConfigureLoggerLegacy(logger, cfg.Logging.Level, cfg.Logging.JSON)
@@ -414,74 +564,363 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		}
 	}
 
-	// Add all service targets to health checker
-	for _, svcConfig := range cfg.Services {
-		if svcConfig.HealthCheck != nil && svcConfig.HealthCheck.Enabled {
-			// Override defaults with service-specific config
-			svcHealthConfig := health.Config{
-				Interval:           svcConfig.HealthCheck.Interval,
-				Timeout:            svcConfig.HealthCheck.Timeout,
-				UnhealthyThreshold: svcConfig.HealthCheck.UnhealthyThreshold,
-				HealthyThreshold:   svcConfig.HealthCheck.HealthyThreshold,
-				ExpectedStatus:     svcConfig.HealthCheck.ExpectedStatus,
-				InsecureSkipVerify: svcConfig.HealthCheck.InsecureSkipVerify,
-			}
+	gateway.flags = featureFlags
+	featureFlags.Start()
 
-			// Use service-specific checker if it has custom config, otherwise use global
-			var checker *health.TargetChecker
-			if svcHealthConfig.Interval != 0 || svcHealthConfig.Timeout != 0 {
-				checker = health.NewTargetChecker(svcHealthConfig, logger, alertManager)
-				checker.Start() // Start service-specific checker immediately
-			} else {
-				checker = healthChecker
-			}
+	// Let admins take targets out of every load balancer for maintenance
+	maintenance := health.NewMaintenance()
+	router.SetMaintenance(maintenance)
+	adminHandler.SetMaintenance(maintenance)
 
-			for _, target := range svcConfig.Targets {
-				checker.AddTarget(target)
-				logger.WithFields(logrus.Fields{
-					"service": svcConfig.Name,
-					"target":  target,
-				}).Info("Added target to health monitoring")
-			}
-		}
+	// Layer-4 proxies for non-HTTP backends; their listeners open in Start
+	for _, listenerConfig := range cfg.TCP.Listeners {
+		proxy := tcpproxy.New(listenerConfig, logger, alertManager)
+		proxy.SetMaintenance(maintenance)
+		gateway.tcpProxies = append(gateway.tcpProxies, proxy)
+	}
+	if len(gateway.tcpProxies) > 0 {
+		adminHandler.SetTCPProxies(gateway.tcpProxies)
 	}
-
-	// Start the global health checker
-	healthChecker.Start()
-	logger.Info("Health monitoring started")
 
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			c.Set("config", cfg)
+			c.Set("config", configs.Load())
 			return next(c)
 		}
 	})
 
-	e.Use(echomw.LoggerWithConfig(echomw.LoggerConfig{
-		Format: "${time_rfc3339} | ${remote_ip} | ${method} ${uri} | ${status} | ${latency_human}\n",
-	}))
+	// Tell services where clients are, and optionally the access log
+	var geoHeaders []string
+	if cfg.GeoIP.Enabled {
+		locator, err := geoip.New(cfg.GeoIP)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %w", err)
+		}
+		e.Use(locator.Middleware())
+		if cfg.GeoIP.LogFields {
+			geoHeaders = []string{geoip.HeaderCountry, geoip.HeaderASN}
+		}
+		logger.WithField("labels", cfg.GeoIP.MetricLabels).Info("GeoIP enrichment enabled")
+	}
+
+	switch cfg.Logging.AccessLog {
+	case logging.AccessLogOff:
+	case logging.AccessLogFast:
+		accessLogger := logging.NewAccessLogger(os.Stdout, cfg.Logging.JSON)
+		accessLogger.LogHeaders(geoHeaders...)
+		e.Use(accessLogger.Middleware())
+	default:
+		format := "${time_rfc3339} | ${remote_ip} | ${method} ${uri} | ${status} | ${latency_human} | ${header:" + requestIDs.Header() + "}"
+		for _, name := range geoHeaders {
+			format += " | ${header:" + name + "}"
+		}
+		e.Use(echomw.LoggerWithConfig(echomw.LoggerConfig{Format: format + "\n"}))
+	}
+
+	// Publish access and audit records to Kafka or NATS
+	if cfg.Streaming.Enabled {
+		sink, err := streaming.NewSink(cfg.Streaming)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize streaming: %w", err)
+		}
+		pipeline := streaming.NewPipeline(cfg.Streaming, sink, logger)
+		if err := pipeline.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start streaming pipeline: %w", err)
+		}
+		e.Use(streaming.AccessMiddleware(pipeline))
+		e.Use(streaming.AuditMiddleware(pipeline))
+		if eventBus != nil {
+			eventBus.Subscribe(streaming.AuditSubscriber(pipeline))
+		}
+		adminHandler.SetStreamingPipeline(pipeline)
+		gateway.streaming = pipeline
+	}
+
+	// Reject blocked clients before any authentication or proxying happens
+	var ipFilter *ipfilter.Filter
+	if cfg.IPFilter.Enabled {
+		ipFilter, err = ipfilter.New(cfg.IPFilter, cfg.Services, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize IP filter: %w", err)
+		}
+		e.Use(ipFilter.Middleware())
+		router.SetIPFilter(ipFilter)
+		gateway.ipFilter = ipFilter
+		adminHandler.SetIPFilter(ipFilter)
+		logger.Info("IP filter enabled")
+	}
+
+	// Score service traffic for automation and feed the scores to AI analysis
+	if cfg.Bot.Enabled {
+		guard, err := bot.New(cfg.Bot, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize bot mitigation: %w", err)
+		}
+		if ipFilter != nil {
+			guard.SetClientIP(ipFilter.ClientIP)
+		}
+		if cfg.AI.Enabled && mongoRepo != nil && mongoRepo.GetDatabase() != nil {
+			aiRepo, err := ai.NewMongoRepository(mongoRepo.GetDatabase())
+			if err != nil {
+				logger.WithError(err).Warn("Failed to initialize AI repository, bot scores will not be recorded")
+			} else {
+				flushInterval := cfg.AI.FlushInterval
+				if flushInterval == 0 {
+					flushInterval = time.Minute
+				}
+				gateway.trafficCollector = ai.NewTrafficCollector(logger, aiRepo, flushInterval)
+				guard.SetRecorder(gateway.trafficCollector)
+			}
+		}
+		router.SetBotGuard(guard)
+		logger.Info("Bot mitigation enabled")
+	}
+
+	// Mask or drop sensitive fields in service responses
+	gateway.dlpStats = dlp.NewStats()
+	adminHandler.SetDLPStats(gateway.dlpStats)
+
+	// Bound the WebSocket connections of websocket services, and of HTTP
+	// services when they accept upgrades
+	gateway.wsLimiter = websocket.NewLimiter(websocket.Limits{
+		MaxConnections:      cfg.WebSocket.MaxConnections,
+		MaxConnectionsPerIP: cfg.WebSocket.MaxConnectionsPerIP,
+	})
+	adminHandler.SetWebSocketLimiter(gateway.wsLimiter)
+	if cfg.WebSocket.Enabled {
+		logger.Info("WebSocket proxying enabled")
+	}
+
+	// Queue and shed service requests beyond what the gateway can serve
+	if cfg.Overload.Enabled {
+		guard := overload.New(cfg.Overload, logger)
+		router.SetOverloadGuard(guard)
+		adminHandler.SetOverloadGuard(guard)
+		logger.WithField("maxConcurrent", cfg.Overload.MaxConcurrent).Info("Overload protection enabled")
+	}
 
 	if cfg.Monitoring.Enabled {
 		monitoring.Register(e, cfg.Monitoring.Path)
 	}
 
+	// The global limit, API keys, plans and consumers count requests in the
+	// same store under distinct keys
+	var counter ratelimit.Store
+	if cfg.RateLimit.Enabled || (cfg.MongoDB.Enabled && mongoRepo != nil) || len(cfg.Products) > 0 || cfg.Consumers.Enabled {
+		counter, err = rateLimitStore(cfg.RateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit counter: %w", err)
+		}
+		adminHandler.SetRateLimitCounter(counter)
+	}
+
+	// Limit the requests of every API key, user or client IP
 	if cfg.RateLimit.Enabled {
-		// Initialize rate limiter
-		logger.Info("Rate limiting enabled")
+		limiter, err := ratelimit.NewLimiter(ratelimit.Config{
+			Enabled:         true,
+			Algorithm:       rateLimitAlgorithm(cfg.RateLimit.Strategy),
+			DefaultLimit:    cfg.RateLimit.Limit,
+			DefaultWindow:   cfg.RateLimit.Duration,
+			BurstSize:       cfg.RateLimit.Burst,
+			SkipPaths:       rateLimitSkipPaths(cfg),
+			ResponseHeaders: true,
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("rate limiter: %w", err)
+		}
+		limiter.SetStore(counter)
+		e.Use(limiter.Middleware())
+		logger.WithFields(logrus.Fields{
+			"limit":    cfg.RateLimit.Limit,
+			"duration": cfg.RateLimit.Duration,
+			"strategy": rateLimitAlgorithm(cfg.RateLimit.Strategy),
+		}).Info("Rate limiting enabled")
 	}
 
 	if cfg.Server.Compression {
-		e.Use(echomw.Gzip())
+		e.Use(middleware.CompressionMiddleware(cfg.Server.CompressionOptions))
 	}
 
 	// Add plugin middleware if plugins are enabled
-	if cfg.Plugins.Enabled {
+	if cfg.Plugins.Enabled || len(o.plugins) > 0 {
 		e.Use(pluginManager.PluginMiddleware())
 		logger.Info("Plugin middleware enabled")
 	}
 
-	authMiddleware := auth.NewJWTMiddleware(cfg.Auth)
+	// Accept API keys from MongoDB alongside JWTs; keys may be pinned to the
+	// client's certificate or TLS fingerprint
+	var apiKeys *auth.APIKeyAuth
+	if cfg.MongoDB.Enabled && mongoRepo != nil {
+		apiKeys = auth.NewAPIKeyAuth(mongoRepo, cfg.Auth.APIKeyHeader)
+		if cfg.Server.TLS.Enabled {
+			gateway.fingerprints = certs.NewFingerprintRecorder()
+			apiKeys.SetJA3Lookup(gateway.fingerprints.JA3)
+		}
+	}
+	authMiddleware := auth.NewAuthMiddleware(cfg.Auth, apiKeys)
+
+	// Reject revoked JWTs and API keys before they expire
+	if cfg.Auth.Revocation.Enabled {
+		store, err := revocationStore(cfg.Auth.Revocation, mongoRepo)
+		if err != nil {
+			return nil, fmt.Errorf("revocation: %w", err)
+		}
+		gateway.revocations = revocation.New(cfg.Auth.Revocation, cfg.Auth.AccessTokenTTL, store, logger)
+		gateway.revocations.Start()
+		authMiddleware = auth.RejectRevokedTokens(authMiddleware, gateway.revocations)
+		if apiKeys != nil {
+			apiKeys.SetRevocations(gateway.revocations)
+		}
+		adminHandler.SetRevocations(gateway.revocations)
+		logger.WithField("store", cfg.Auth.Revocation.Store).Info("Token revocation enabled")
+	}
 	router.SetAuthMiddleware(authMiddleware)
+	gateway.apiKeys = apiKeys
+
+	// Services may authenticate with OpenID Connect providers instead of
+	// the JWT secret
+	if len(cfg.Auth.OIDC) > 0 {
+		gateway.oidcProviders = make(map[string]*auth.OIDCProvider, len(cfg.Auth.OIDC))
+		for _, providerCfg := range cfg.Auth.OIDC {
+			provider := auth.NewOIDCProvider(providerCfg, cfg.Auth, apiKeys, logger)
+			if gateway.revocations != nil {
+				provider.SetRevocations(gateway.revocations)
+			}
+			provider.Start()
+			gateway.oidcProviders[providerCfg.Name] = provider
+		}
+		router.SetOIDCProviders(gateway.oidcProviders)
+		logger.WithField("providers", len(cfg.Auth.OIDC)).Info("OIDC authentication enabled")
+	}
+
+	// Limit API keys to their own rate limit
+	if apiKeys != nil {
+		gateway.apiKeyLimiter = auth.NewAPIKeyLimiter(counter, mongoRepo, logger)
+		gateway.apiKeyLimiter.Start()
+		router.SetAPIKeyLimiter(gateway.apiKeyLimiter)
+	}
+
+	// Enforce the rate limits and quotas of the plans API keys subscribe to
+	catalog := products.NewCatalog(cfg.Products)
+	if len(cfg.Products) > 0 {
+		router.SetProductEnforcer(products.NewEnforcer(catalog, counter, logger))
+		logger.WithField("products", len(cfg.Products)).Info("API products enabled")
+	}
+
+	// Let developers sign up and subscribe keys to the plans on offer
+	if cfg.Portal.Enabled {
+		if mongoRepo == nil {
+			return nil, fmt.Errorf("portal requires a MongoDB connection")
+		}
+		published := catalog.Services()
+		var services []portal.Service
+		for _, svcConfig := range cfg.Services {
+			if !slices.Contains(published, svcConfig.Name) {
+				continue
+			}
+			spec, err := serviceSpec(svcConfig, registry)
+			if err != nil {
+				return nil, fmt.Errorf("portal: service %s: %w", svcConfig.Name, err)
+			}
+			svc := portal.Service{Name: svcConfig.Name, BasePath: svcConfig.BasePath, Spec: spec}
+			if svcConfig.Validation != nil && svcConfig.Validation.Spec != "" {
+				svc.PathPrefix = svcConfig.Validation.PathPrefix
+			}
+			services = append(services, svc)
+		}
+		gateway.portal, err = portal.New(cfg.Portal, catalog, mongoRepo, services, auth.JWTSecret(cfg.Auth), logger)
+		if err != nil {
+			return nil, fmt.Errorf("portal: %w", err)
+		}
+		gateway.portal.SetAPIKeyHeader(cfg.Auth.APIKeyHeader)
+		if eventBus != nil {
+			gateway.portal.SetEventPublisher(eventBus)
+		}
+		router.SetPortal(gateway.portal)
+		adminHandler.SetPortal(gateway.portal)
+	}
+
+	// Browsable documentation of the HTTP services, or of those listed
+	var docs *apidocs.Site
+	if cfg.OpenAPI.UIEnabled {
+		var services []apidocs.Service
+		for _, svcConfig := range cfg.Services {
+			if len(cfg.OpenAPI.UIServices) > 0 {
+				if !slices.Contains(cfg.OpenAPI.UIServices, svcConfig.Name) {
+					continue
+				}
+			} else if svcConfig.Protocol != "" && svcConfig.Protocol != "http" {
+				continue
+			}
+			spec, err := serviceSpec(svcConfig, registry)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: service %s: %w", svcConfig.Name, err)
+			}
+			svc := apidocs.Service{
+				Name:           svcConfig.Name,
+				BasePath:       svcConfig.BasePath,
+				Authentication: svcConfig.Authentication,
+				Spec:           spec,
+			}
+			if svcConfig.Validation != nil && svcConfig.Validation.Spec != "" {
+				svc.PathPrefix = svcConfig.Validation.PathPrefix
+			}
+			services = append(services, svc)
+		}
+		apiKeyHeader := ""
+		if apiKeys != nil {
+			apiKeyHeader = cfg.Auth.APIKeyHeader
+		}
+		docs, err = apidocs.New(cfg.OpenAPI, services, apiKeyHeader)
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %w", err)
+		}
+	}
+
+	// Meter requests and bytes per API key and service for billing
+	if cfg.Metering.Enabled {
+		if mongoRepo == nil {
+			return nil, fmt.Errorf("metering requires a MongoDB connection")
+		}
+		gateway.meter = metering.NewMeter(cfg.Metering, mongoRepo, logger)
+		if eventBus != nil {
+			gateway.meter.SetEventPublisher(eventBus)
+		}
+		router.SetMeter(gateway.meter)
+		adminHandler.SetMeter(gateway.meter)
+		logger.WithField("period", cfg.Metering.Period).Info("Usage metering enabled")
+	}
+
+	// Apply per-consumer rate limits, allowed services and headers
+	if cfg.Consumers.Enabled {
+		if mongoRepo == nil {
+			return nil, fmt.Errorf("consumers require a MongoDB connection")
+		}
+		gateway.consumers, err = consumers.NewRegistry(cfg.Consumers, mongoRepo, counter, logger)
+		if err != nil {
+			return nil, fmt.Errorf("consumers: %w", err)
+		}
+		router.SetConsumers(gateway.consumers)
+		router.SetHMACAuth(auth.NewHMACAuth(cfg.Auth.HMAC, gateway.consumers))
+		adminHandler.SetConsumers(gateway.consumers)
+		logger.WithField("consumers", len(gateway.consumers.List())).Info("Consumers enabled")
+	}
+
+	// Accept long-running requests with 202 and call the targets in the
+	// background
+	if usesAsync(cfg) {
+		var store async.Store = async.NewMemoryStore()
+		durable := cfg.Async.Store == "mongodb"
+		if durable {
+			if mongoRepo == nil {
+				return nil, fmt.Errorf("async: the mongodb store requires a MongoDB connection")
+			}
+			store = mongoRepo
+		}
+		gateway.async = async.NewManager(cfg.Async, store, durable, logger)
+		gateway.async.Register(e)
+		router.SetAsync(gateway.async)
+	}
 
 	var cacheStore cache.Store
 	if cfg.Cache.Enabled {
@@ -492,15 +931,85 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 		}
 		e.Use(middleware.CacheMiddleware(cacheStore, logger))
 		router.SetCacheStore(cacheStore)
+		adminHandler.SetCacheStore(cacheStore)
+	}
+
+	adminHandler.SetReloader(gateway)
+	adminHandler.SetInFlightCounter(router)
+
+	// Configuration versions kept in MongoDB can be compared and rolled back to
+	if cfg.MongoDB.Enabled && mongoRepo != nil {
+		adminHandler.SetConfigVersions(mongoRepo, gateway, gateway.currentConfig)
 	}
 
-	if err := router.RegisterRoutes(); err != nil {
-		return nil, fmt.Errorf("failed to register routes: %w", err)
+	// Sample recent requests to estimate the impact of settings changes
+	samples := monitoring.NewRequestSamples(monitoring.DefaultSamplesPerService)
+	router.SetRequestSamples(samples)
+	adminHandler.SetRequestSamples(samples)
+
+	// Services stored in MongoDB are routed and managed live next to the
+	// configured ones
+	if cfg.MongoDB.RouteServices && mongoRepo != nil {
+		adapter := mongodb.NewServiceAdapter(mongoRepo, logger)
+		gateway.loadStoredServices(context.Background(), adapter)
+		if len(gateway.stored) > 0 {
+			registry = newServiceRegistry(gateway.withStoredServices(cfg), logger)
+		}
+		adminHandler.SetStoredServices(adapter, gateway)
+	}
+
+	if err := gateway.routeServices(gateway.withStoredServices(cfg), registry); err != nil {
+		return nil, err
+	}
+
+	// Start the global health checker
+	healthChecker.Start()
+	logger.Info("Health monitoring started")
+
+	// Jobs are only run once their services' routes are known
+	if gateway.async != nil {
+		gateway.async.Start()
 	}
 
+	// Run recurring tasks; like async jobs, they may call the routes
+	if cfg.Scheduler.Enabled {
+		var store scheduler.Store = scheduler.NewMemoryStore()
+		if cfg.Scheduler.Store == "mongodb" {
+			if mongoRepo == nil {
+				return nil, fmt.Errorf("scheduler: the mongodb store requires a MongoDB connection")
+			}
+			store = mongoRepo
+		}
+		gateway.scheduler, err = scheduler.New(cfg.Scheduler, store, logger)
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: %w", err)
+		}
+		registerTasks(gateway.scheduler, cfg, e, mongoRepo, logger)
+		if err := gateway.scheduler.Start(); err != nil {
+			return nil, fmt.Errorf("scheduler: %w", err)
+		}
+		adminHandler.SetScheduler(gateway.scheduler)
+		logger.WithField("jobs", len(cfg.Scheduler.Jobs)).Info("Scheduler enabled")
+	}
+
+	// Liveness and readiness probes
+	gateway.readiness = newReadiness(cfg, mongoRepo, cacheStore, counter, gateway.criticalCheck)
+	health.RegisterProbes(e, cfg.Monitoring.Probes, gateway.readiness)
+	gateway.readiness.MarkRoutesRegistered()
+
 	adminHandler.Register(e)
 	logger.Info("Admin interface registered at /admin")
 
+	if gateway.portal != nil {
+		gateway.portal.Register(e)
+		logger.WithField("path", cfg.Portal.Path).Info("Developer portal API registered")
+	}
+
+	if docs != nil {
+		docs.Register(e)
+		logger.WithField("path", docs.Path()).Info("API documentation registered")
+	}
+
 	// Start monitoring metrics broadcaster
 	collector := admin.GetCollector()
 	collector.StartMetricsBroadcaster()
@@ -509,47 +1018,641 @@ func New(cfg *config.Config, configPath string, logger *logrus.Logger) (*Gateway
 	return gateway, nil
 }
 
+// ServeHTTP serves a request as the gateway's listeners would
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.server.ServeHTTP(w, r)
+}
+
+// MiddlewareChain returns the names of the middleware applied to the
+// requests of a service, outermost first
+func (g *Gateway) MiddlewareChain(service string) []string {
+	return g.router.Chain(service)
+}
+
+// SetUpgrader makes Start take its listeners from u, so they can be inherited
+// from and handed over to other gateway processes
+func (g *Gateway) SetUpgrader(u *upgrade.Upgrader) {
+	g.upgrader = u
+}
+
+// Listening is closed once Start holds all its listeners. Connections are
+// queued from then on, even before the server accepts them.
+func (g *Gateway) Listening() <-chan struct{} {
+	return g.listening
+}
+
+// listen opens the listener called name, through the upgrader if there is one
+func (g *Gateway) listen(name, addr string) (net.Listener, error) {
+	if g.upgrader != nil {
+		return g.upgrader.Listen(name, addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
 func (g *Gateway) Start() error {
-	addr := fmt.Sprintf(":%d", g.config.Server.Port)
+	if err := g.startTCPProxies(); err != nil {
+		return err
+	}
+
+	server := g.config.Load().Server
+	addr := fmt.Sprintf(":%d", server.Port)
 
 	s := &http.Server{
-		Addr:         addr,
-		ReadTimeout:  g.config.Server.ReadTimeout,
-		WriteTimeout: g.config.Server.WriteTimeout,
+		Addr:           addr,
+		ReadTimeout:    server.ReadTimeout,
+		WriteTimeout:   server.WriteTimeout,
+		MaxHeaderBytes: maxHeaderBytes(server.Limits),
+	}
+	g.httpServer = s
+
+	tlsCfg := server.TLS
+	if !tlsCfg.Enabled {
+		listener, err := g.listen("http", addr)
+		if err != nil {
+			return err
+		}
+		g.server.Listener = listener
+		close(g.listening)
+		g.logger.Infof("Server starting on %s", addr)
+		return g.server.StartServer(s)
+	}
+
+	var files, managed certs.Source
+	if len(tlsCfg.Certificates) > 0 {
+		reloader, err := certs.NewReloader(tlsCfg.Certificates, g.logger)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		// Renewed certificate files are served without a restart
+		reloader.Start(tlsCfg.ReloadInterval)
+		g.certReloader = reloader
+		files = reloader
+	}
+	if g.acmeManager != nil {
+		managed = g.acmeManager
+	}
+	tlsConfig, err := certs.NewTLSConfig(tlsCfg, files, managed)
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS: %w", err)
+	}
+	s.Addr = fmt.Sprintf(":%d", tlsCfg.Port)
+	s.TLSConfig = tlsConfig
+	if g.fingerprints != nil {
+		g.fingerprints.Attach(tlsConfig)
+		s.ConnState = g.fingerprints.ConnState
+	}
+
+	// The plaintext port keeps serving the gateway unless it should redirect
+	var handler http.Handler = g.server
+	if tlsCfg.RedirectHTTP {
+		handler = certs.RedirectHandler(tlsCfg.Port)
 	}
+	// http-01 challenges are answered on the plaintext port even when redirecting
+	if g.acmeManager != nil {
+		handler = g.acmeManager.HTTPHandler(handler)
+	}
+	g.plainServer = &http.Server{
+		Addr:           addr,
+		Handler:        handler,
+		ReadTimeout:    s.ReadTimeout,
+		WriteTimeout:   s.WriteTimeout,
+		MaxHeaderBytes: s.MaxHeaderBytes,
+	}
+	plainListener, err := g.listen("http", addr)
+	if err != nil {
+		return err
+	}
+	tlsListener, err := g.listen("https", s.Addr)
+	if err != nil {
+		plainListener.Close()
+		return err
+	}
+	g.server.TLSListener = tls.NewListener(tlsListener, tlsConfig)
+	close(g.listening)
 
-	g.logger.Infof("Server starting on %s", addr)
+	go func() {
+		g.logger.WithField("redirect", tlsCfg.RedirectHTTP).Infof("HTTP server starting on %s", addr)
+		if err := g.plainServer.Serve(plainListener); err != nil && err != http.ErrServerClosed {
+			g.logger.WithError(err).Error("HTTP server failed")
+		}
+	}()
+
+	if g.acmeManager != nil {
+		if err := g.acmeManager.Start(context.Background()); err != nil {
+			g.logger.WithError(err).Warn("Failed to start ACME certificate manager")
+		}
+	}
+
+	g.logger.Infof("HTTPS server starting on %s", s.Addr)
 	return g.server.StartServer(s)
 }
 
+// startTCPProxies opens the TCP proxy listeners and serves them in the
+// background
+func (g *Gateway) startTCPProxies() error {
+	for _, proxy := range g.tcpProxies {
+		listener, err := g.listen("tcp-"+proxy.Name(), proxy.Addr())
+		if err != nil {
+			return fmt.Errorf("tcp listener %s: %w", proxy.Name(), err)
+		}
+		go func(proxy *tcpproxy.Proxy) {
+			if err := proxy.Serve(listener); err != nil {
+				g.logger.WithError(err).WithField("listener", proxy.Name()).Error("TCP proxy failed")
+			}
+		}(proxy)
+	}
+	return nil
+}
+
+// componentStopTimeout bounds how long Shutdown waits for the background
+// components once requests have drained
+const componentStopTimeout = 10 * time.Second
+
+// Shutdown stops accepting connections and requests, and waits for those in
+// flight, WebSocket connections included, until ctx is done or, without a
+// deadline, for the server's graceful timeout. What is still active then is
+// closed and logged. Background components are stopped last, so that the
+// drained requests are still logged, metered and streamed.
 func (g *Gateway) Shutdown(ctx context.Context) error {
-	g.logger.Info("Stopping health monitoring...")
+	if g.readiness != nil {
+		g.readiness.MarkShuttingDown()
+	}
+	timeout := g.config.Load().Server.GracefulTimeout
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// TCP connections drain alongside the HTTP servers
+	var tcpWG sync.WaitGroup
+	for _, proxy := range g.tcpProxies {
+		tcpWG.Add(1)
+		go func(proxy *tcpproxy.Proxy) {
+			defer tcpWG.Done()
+			if err := proxy.Shutdown(ctx); err != nil {
+				g.logger.WithError(err).WithField("listener", proxy.Name()).Warn("TCP connections did not drain in time")
+			}
+		}(proxy)
+	}
+
+	// Shutting the servers down closes their listeners and idle connections
+	// and waits for active ones, except hijacked WebSocket connections, which
+	// the request tracker waits for
+	servers := []*http.Server{g.plainServer, g.httpServer}
+	var serverWG sync.WaitGroup
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		serverWG.Add(1)
+		go func(server *http.Server) {
+			defer serverWG.Done()
+			server.Shutdown(ctx)
+		}(server)
+	}
+	drainErr := g.requests.drain(ctx)
+	serverWG.Wait()
+
+	if drainErr != nil {
+		closed := g.requests.forceClose()
+		for _, r := range closed {
+			g.logger.WithFields(logrus.Fields{
+				"method":    r.method,
+				"path":      r.path,
+				"websocket": r.websocket,
+				"duration":  time.Since(r.started).Round(time.Millisecond),
+			}).Warn("Closing request still in flight at shutdown")
+		}
+		for _, server := range servers {
+			if server != nil {
+				server.Close()
+			}
+		}
+		// Give the cancelled handlers a moment to send close frames and errors
+		wait, cancel := context.WithTimeout(context.Background(), time.Second)
+		g.requests.drain(wait)
+		cancel()
+		g.logger.WithField("requests", len(closed)).Warn("Shutdown timed out, closed requests still in flight")
+	}
+	tcpWG.Wait()
+
+	g.stopComponents(componentStopTimeout)
+
+	if drainErr != nil {
+		return fmt.Errorf("requests still in flight were closed: %w", drainErr)
+	}
+	return g.server.Shutdown(ctx)
+}
+
+// component is a background part of the gateway that Shutdown stops
+type component struct {
+	name string
+	stop func() error
+}
+
+// warnUndefinedFlags logs the flags that are referenced but defined nowhere;
+// they are off, and canaries fall back to their weight
+func warnUndefinedFlags(cfg *config.Config, featureFlags *flags.Flags, logger *logrus.Logger) {
+	warn := func(flag, owner string) {
+		if flag != "" && !featureFlags.Defined(flag) {
+			logger.WithFields(logrus.Fields{"flag": flag, "for": owner}).Warn("Feature flag is not defined")
+		}
+	}
+	for _, svcConfig := range cfg.Services {
+		warn(svcConfig.FeatureFlag, "service "+svcConfig.Name)
+		if svcConfig.Canary != nil {
+			warn(svcConfig.Canary.WeightFlag, "canary of service "+svcConfig.Name)
+		}
+	}
+	for _, pluginCfg := range cfg.Plugins.Plugins {
+		warn(pluginCfg.Flag, "plugin "+pluginCfg.Name)
+	}
+}
+
+// registerTasks makes the built-in tasks available to scheduled jobs. Tasks
+// that read or change stored data need MongoDB.
+func registerTasks(s *scheduler.Scheduler, cfg *config.Config, handler http.Handler, mongoRepo mongodb.Repository, logger *logrus.Logger) {
+	s.Register(scheduler.TaskHTTP, scheduler.HTTPTask(handler, &http.Client{}))
+	if mongoRepo == nil {
+		return
+	}
+	s.Register(scheduler.TaskExpireAPIKeys, scheduler.ExpireAPIKeysTask(mongoRepo))
+	s.Register(scheduler.TaskUsageReport, scheduler.UsageReportTask(mongoRepo))
+	s.Register(scheduler.TaskMetricRollup, scheduler.MetricRollupTask(mongoRepo))
+	if mongoRepo.GetDatabase() == nil {
+		return
+	}
+	aiRepo, err := ai.NewMongoRepository(mongoRepo.GetDatabase())
+	if err != nil {
+		logger.WithError(err).Warn("Failed to initialize AI repository, baselines cannot be recalculated")
+		return
+	}
+	services := make([]string, 0, len(cfg.Services))
+	for _, svc := range cfg.Services {
+		services = append(services, svc.Name)
+	}
+	s.Register(scheduler.TaskRecalculateBaselines, scheduler.RecalculateBaselinesTask(aiRepo,
+		func() []string { return services }, cfg.AI.BaselineWindow, cfg.AI.MinSamplesForBaseline))
+}
+
+// usesAsync reports whether any service accepts asynchronous requests
+func usesAsync(cfg *config.Config) bool {
+	for _, svc := range cfg.Services {
+		if svc.Async != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// components lists the background components in the order they are stopped
+func (g *Gateway) components() []component {
+	var list []component
+	add := func(name string, stop func() error) {
+		list = append(list, component{name: name, stop: stop})
+	}
+	noErr := func(stop func()) func() error {
+		return func() error {
+			stop()
+			return nil
+		}
+	}
+
+	if g.resolver != nil {
+		add("DNS discovery", noErr(g.resolver.Stop))
+	}
+	if g.flags != nil {
+		add("feature flags", noErr(g.flags.Stop))
+	}
+	if g.async != nil {
+		add("asynchronous requests", noErr(g.async.Stop))
+	}
+	if g.scheduler != nil {
+		add("scheduler", noErr(g.scheduler.Stop))
+	}
+	if g.revocations != nil {
+		add("token revocations", noErr(g.revocations.Stop))
+	}
+	for name, provider := range g.oidcProviders {
+		add("OIDC provider "+name, noErr(provider.Stop))
+	}
 	if g.healthChecker != nil {
-		g.healthChecker.Stop()
+		add("health checks", noErr(g.healthChecker.Stop))
+	}
+	if g.healthHistory != nil {
+		add("health history", noErr(g.healthHistory.Stop))
 	}
 	if g.alertManager != nil {
-		g.alertManager.Stop()
+		add("alerts", noErr(g.alertManager.Stop))
 	}
-	g.logger.Info("Health monitoring stopped")
-
-	// Stop Postman integration if initialized
 	if g.adminHandler != nil {
-		integrationHandler := g.adminHandler.GetIntegrationHandler()
-		if integrationHandler != nil {
-			g.logger.Info("Stopping Postman integration...")
-			if err := integrationHandler.Shutdown(); err != nil {
-				g.logger.WithError(err).Warn("Error stopping Postman integration")
+		if integrationHandler := g.adminHandler.GetIntegrationHandler(); integrationHandler != nil {
+			add("Postman integration", integrationHandler.Shutdown)
+		}
+	}
+	// Flush access and audit streaming
+	if g.streaming != nil {
+		add("streaming pipeline", g.streaming.Stop)
+	}
+	// Save usage counted in the current period, before the event bus stops
+	// so that its usage.recorded event is delivered
+	if g.meter != nil {
+		add("metering", noErr(g.meter.Stop))
+	}
+	if g.eventBus != nil {
+		add("event bus", g.eventBus.Stop)
+	}
+	// Save the developer usage counted so far
+	if g.portal != nil {
+		add("developer portal", noErr(g.portal.Stop))
+	}
+	if g.consumers != nil {
+		add("consumer reloads", noErr(g.consumers.Stop))
+	}
+	// Save the API key counts not persisted yet
+	if g.apiKeyLimiter != nil {
+		add("API key rate limits", noErr(g.apiKeyLimiter.Stop))
+	}
+	// Flush recorded traffic patterns
+	if g.trafficCollector != nil {
+		add("traffic collector", noErr(g.trafficCollector.Stop))
+	}
+	if g.gitopsSyncer != nil && g.gitopsSyncer.IsRunning() {
+		add("GitOps sync", g.gitopsSyncer.Stop)
+	}
+	if g.backups != nil {
+		add("config backups", noErr(g.backups.Stop))
+	}
+	if g.meshManager != nil {
+		add("service mesh", g.meshManager.Stop)
+	}
+	if g.acmeManager != nil {
+		add("ACME certificate manager", g.acmeManager.Stop)
+	}
+	if g.certReloader != nil {
+		add("certificate reloads", noErr(g.certReloader.Stop))
+	}
+	// Last, so the logs of stopping the others are exported
+	if g.tracingManager != nil {
+		add("telemetry export", func() error { return g.tracingManager.Shutdown(context.Background()) })
+	}
+	return list
+}
+
+// stopComponents stops the background components in order, waiting up to
+// timeout for all of them. Those that have not stopped by then are logged
+// and left to finish on their own.
+func (g *Gateway) stopComponents(timeout time.Duration) {
+	list := g.components()
+	var mu sync.Mutex
+	next := 0
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, c := range list {
+			g.logger.Debugf("Stopping %s...", c.name)
+			if err := c.stop(); err != nil {
+				g.logger.WithError(err).Warnf("Error stopping %s", c.name)
 			}
+			mu.Lock()
+			next++
+			mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		g.logger.Info("Background components stopped")
+	case <-timer.C:
+		mu.Lock()
+		pending := list[next:]
+		mu.Unlock()
+		for _, c := range pending {
+			g.logger.WithField("component", c.name).Warn("Background component did not stop in time")
 		}
 	}
+}
 
-	// Stop service mesh integration
-	if g.meshManager != nil {
-		g.logger.Info("Stopping service mesh integration...")
-		if err := g.meshManager.Stop(); err != nil {
-			g.logger.WithError(err).Warn("Error stopping service mesh")
+// maxHeaderBytes is how much of the request line and headers the server
+// reads. It leaves room for the URL so overlong URLs reach the limits
+// middleware and get 414 rather than the server's own 431. Zero keeps Go's
+// default of 1 MB.
+func maxHeaderBytes(limits config.RequestLimits) int {
+	if limits.MaxHeaderBytes == 0 {
+		return 0
+	}
+	return limits.MaxHeaderBytes + limits.MaxURLLength
+}
+
+// addAlertChannels registers the configured Slack, Teams and PagerDuty channels
+func addAlertChannels(alertManager *health.AlertManager, alerts config.AlertChannelsConfig, logger *logrus.Logger) {
+	routed := func(channel health.AlertChannel, routing config.AlertRouting) health.AlertChannel {
+		severities := make([]health.Severity, 0, len(routing.Severities))
+		for _, severity := range routing.Severities {
+			severities = append(severities, health.Severity(severity))
 		}
+		return health.NewRoutedChannel(channel, severities, routing.SkipResolved)
 	}
 
-	return g.server.Shutdown(ctx)
+	for _, slack := range alerts.Slack {
+		channel := health.NewSlackChannel(slack.Name, slack.WebhookURL, slack.Channel, slack.Username, logger)
+		alertManager.AddChannel(routed(channel, slack.AlertRouting))
+		logger.WithField("channel", channel.Name()).Info("Slack alert channel configured")
+	}
+
+	for _, teams := range alerts.Teams {
+		channel := health.NewTeamsChannel(teams.Name, teams.WebhookURL, logger)
+		alertManager.AddChannel(routed(channel, teams.AlertRouting))
+		logger.WithField("channel", channel.Name()).Info("Teams alert channel configured")
+	}
+
+	for _, pd := range alerts.PagerDuty {
+		channel := health.NewPagerDutyChannel(pd.Name, pd.RoutingKey, pd.Source, pd.EventsURL, logger)
+		alertManager.AddChannel(routed(channel, pd.AlertRouting))
+		logger.WithField("channel", channel.Name()).Info("PagerDuty alert channel configured")
+	}
+}
+
+// newRequestValidator builds the validator for a service from its configured
+// OpenAPI document, or from the spec generated for the service
+func headerRules(rules []config.HeaderRuleConfig) []transform.HeaderRule {
+	converted := make([]transform.HeaderRule, len(rules))
+	for i, rule := range rules {
+		converted[i] = transform.HeaderRule{
+			Action: rule.Action,
+			Name:   rule.Name,
+			Value:  rule.Value,
+			From:   rule.From,
+			Method: rule.Method,
+			Path:   rule.Path,
+		}
+	}
+	return converted
+}
+
+// xmlTransformation converts a service's bodies between XML and JSON as x
+// sets out
+func xmlTransformation(x *config.XMLTransformConfig) *service.TransformationConfig {
+	opts := transform.XMLOptions{
+		AttributePrefix: x.AttributePrefix,
+		TextKey:         x.TextKey,
+		KeepNamespaces:  x.KeepNamespaces,
+		Namespace:       x.Namespace,
+		RootElement:     x.RootElement,
+		ContentType:     x.ContentType,
+	}
+	t := &service.TransformationConfig{}
+	if x.Request != "" {
+		t.Request = &transform.RequestTransform{Convert: x.Request, XML: opts}
+	}
+	if x.Response != "" {
+		t.Response = &transform.ResponseTransform{Convert: x.Response, XML: opts}
+	}
+	return t
+}
+
+func newRequestValidator(svcConfig config.ServiceConfig, registry *service.Registry) (*openapi.Validator, error) {
+	spec, err := serviceSpec(svcConfig, registry)
+	if err != nil {
+		return nil, err
+	}
+	return openapi.NewValidator(spec, svcConfig.Validation.PathPrefix), nil
+}
+
+// newMocker builds the mocker for a service. Responses from the spec use the
+// mock's OpenAPI document, or the one requests are validated against.
+func newMocker(svcConfig config.ServiceConfig, registry *service.Registry) (*mock.Mocker, error) {
+	mockCfg := *svcConfig.Mock
+	if !mockCfg.FromSpec {
+		return mock.NewMocker(svcConfig.Name, mockCfg, nil), nil
+	}
+
+	var spec *openapi.Spec
+	var err error
+	prefix := mockCfg.PathPrefix
+	if mockCfg.Spec != "" {
+		spec, err = openapi.LoadSpec(mockCfg.Spec)
+	} else {
+		spec, err = serviceSpec(svcConfig, registry)
+		if prefix == "" && svcConfig.Validation != nil {
+			prefix = svcConfig.Validation.PathPrefix
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mock.NewMocker(svcConfig.Name, mockCfg, openapi.NewValidator(spec, prefix)), nil
+}
+
+// newReadiness checks the enabled dependencies that are not ignored, and
+// the healthy targets of critical services
+func newReadiness(cfg *config.Config, mongoRepo mongodb.Repository, cacheStore cache.Store, counter ratelimit.Counter, critical func(service string, min int) health.ReadinessCheck) *health.Readiness {
+	probes := cfg.Monitoring.Probes
+	readiness := health.NewReadiness(probes.Timeout)
+
+	if cfg.MongoDB.Enabled && !slices.Contains(probes.IgnoreDependencies, "mongodb") {
+		readiness.AddCheck("mongodb", func(ctx context.Context) error {
+			if mongoRepo == nil {
+				return fmt.Errorf("not connected")
+			}
+			return mongoRepo.Ping(ctx)
+		})
+	}
+	if cacheStore != nil && !slices.Contains(probes.IgnoreDependencies, "cache") {
+		readiness.AddCheck("cache", cacheStore.Ping)
+	}
+	if counter != nil && !slices.Contains(probes.IgnoreDependencies, "rateLimit") {
+		readiness.AddCheck("rateLimit", counter.Ping)
+	}
+
+	for _, service := range probes.CriticalServices {
+		readiness.AddCheck("service:"+service.Name, critical(service.Name, service.MinHealthyTargets))
+	}
+	return readiness
+}
+
+// rateLimitStore keeps rate limits, plan quotas and consumer limits in Redis
+// when rate limiting uses it, so that gateways sharing it enforce the same
+// limits, and in memory otherwise
+func rateLimitStore(cfg config.RateLimitConfig) (ratelimit.Store, error) {
+	if cfg.Strategy == "local" || cfg.RedisURL == "" {
+		return ratelimit.NewMemoryStore(), nil
+	}
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return ratelimit.NewRedisStore(client), nil
+}
+
+// rateLimitAlgorithm maps a rate limit strategy to the limiter's algorithm;
+// the older local and redis strategies named the store only
+func rateLimitAlgorithm(strategy string) ratelimit.Algorithm {
+	switch strategy {
+	case "token-bucket":
+		return ratelimit.AlgorithmTokenBucket
+	case "fixed-window":
+		return ratelimit.AlgorithmFixedWindow
+	default:
+		return ratelimit.AlgorithmSlidingWindow
+	}
+}
+
+// rateLimitSkipPaths are the gateway's own endpoints, which the global rate
+// limit does not apply to
+func rateLimitSkipPaths(cfg *config.Config) []string {
+	paths := []string{"/admin", "/health", cfg.Monitoring.Probes.LivenessPath, cfg.Monitoring.Probes.ReadinessPath}
+	if cfg.Monitoring.Enabled && cfg.Monitoring.Path != "" {
+		paths = append(paths, cfg.Monitoring.Path)
+	}
+	return paths
+}
+
+// revocationStore connects to the store revocations are shared in
+func revocationStore(cfg config.RevocationConfig, mongoRepo mongodb.Repository) (revocation.Store, error) {
+	switch cfg.Store {
+	case "mongodb":
+		if mongoRepo == nil {
+			return nil, fmt.Errorf("the mongodb store requires a MongoDB connection")
+		}
+		return mongoRepo, nil
+	case "redis":
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		}
+		return revocation.NewRedisStore(client), nil
+	}
+	return revocation.NewMemoryStore(), nil
+}
+
+// serviceSpec loads a service's configured OpenAPI document, or generates
+// one for the service when it has none
+func serviceSpec(svcConfig config.ServiceConfig, registry *service.Registry) (*openapi.Spec, error) {
+	if svcConfig.Validation != nil && svcConfig.Validation.Spec != "" {
+		return openapi.LoadSpec(svcConfig.Validation.Spec)
+	}
+
+	svc, ok := registry.GetService(svcConfig.Name)
+	if !ok {
+		return nil, fmt.Errorf("service is not registered")
+	}
+
+	generator := openapi.NewGenerator(svcConfig.Name, "1.0.0", "")
+	if err := generator.GenerateFromServices([]*service.Config{svc}); err != nil {
+		return nil, err
+	}
+	return generator.GetSpec(), nil
 }
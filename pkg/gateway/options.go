@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"fmt"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+	"odin/pkg/plugins"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a gateway built with New
+type Option func(*options)
+
+type options struct {
+	config     *config.Config
+	configPath string
+	logger     *logrus.Logger
+	store      mongodb.Repository
+	plugins    []pluginOption
+}
+
+type pluginOption struct {
+	plugin plugins.Plugin
+	config map[string]interface{}
+	hooks  []string
+}
+
+// WithConfig serves cfg. Its defaults are filled in and it is validated, so
+// a configuration built in code only needs the settings it changes. Without
+// it, the gateway serves the default configuration.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithConfigPath names the file the configuration was loaded from, which
+// the admin API saves changes to and backups read
+func WithConfigPath(path string) Option {
+	return func(o *options) {
+		o.configPath = path
+	}
+}
+
+// WithLogger logs to logger instead of a new logrus logger
+func WithLogger(logger *logrus.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithStore keeps services, API keys, plugins and the other persisted state
+// in store instead of connecting to the configured MongoDB. Features that
+// require MongoDB are available with it.
+func WithStore(store mongodb.Repository) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithPlugin runs p on the given hooks, next to the plugins loaded from the
+// configuration. Plugins are initialized with config when the gateway is
+// built.
+func WithPlugin(p plugins.Plugin, config map[string]interface{}, hooks ...plugins.HookType) Option {
+	return func(o *options) {
+		names := make([]string, len(hooks))
+		for i, hook := range hooks {
+			names[i] = string(hook)
+		}
+		o.plugins = append(o.plugins, pluginOption{plugin: p, config: config, hooks: names})
+	}
+}
+
+// newOptions applies opts over the defaults and checks the configuration
+func newOptions(opts []Option) (*options, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.config == nil {
+		o.config = &config.Config{}
+	}
+	if o.logger == nil {
+		o.logger = logrus.New()
+	}
+	if o.store != nil {
+		o.config.MongoDB.Enabled = true
+	}
+
+	o.config.SetDefaults()
+	if err := config.Validate(o.config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return o, nil
+}
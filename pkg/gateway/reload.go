@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reload validates cfg and makes it the active configuration; cfg must not
+// be changed afterwards. Sections that can be changed at runtime are applied
+// immediately; the report lists the sections that only take effect after a
+// restart.
+func (g *Gateway) Reload(cfg *config.Config) (*config.ReloadReport, error) {
+	if err := config.Validate(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	report := &config.ReloadReport{
+		Applied:         []string{},
+		RequiresRestart: []string{},
+	}
+	// Admin API changes wait for the reload rather than being lost to it
+	err := g.config.Swap(func(old *config.Config) (*config.Config, error) {
+		if err := g.apply(old, cfg, report); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g.logger.WithFields(logrus.Fields{
+		"applied":         report.Applied,
+		"requiresRestart": report.RequiresRestart,
+	}).Info("Configuration reloaded")
+
+	if g.eventBus != nil {
+		g.eventBus.Publish(events.ConfigReloaded, map[string]interface{}{
+			"applied":         report.Applied,
+			"requiresRestart": report.RequiresRestart,
+		})
+	}
+
+	return report, nil
+}
+
+// apply applies the changes from old to cfg that take effect at runtime,
+// recording them in report along with those needing a restart
+func (g *Gateway) apply(old, cfg *config.Config, report *config.ReloadReport) error {
+	// Services are routed anew when any of them changed; requests in flight
+	// finish on the routes they started on. They are compared with the
+	// services routed rather than the active configuration, which the admin
+	// API changes too. Services stored in MongoDB stay routed.
+	services := g.withStoredServices(cfg)
+	if added, removed, changed := g.changedServices(services); len(added)+len(removed)+len(changed) > 0 {
+		if err := g.routeServices(services, newServiceRegistry(services, g.logger)); err != nil {
+			return fmt.Errorf("services: %w", err)
+		}
+		report.Applied = append(report.Applied, "services")
+		g.logger.WithFields(logrus.Fields{
+			"added":   added,
+			"removed": removed,
+			"changed": changed,
+		}).Info("Services rerouted")
+	}
+
+	if !reflect.DeepEqual(old.Logging, cfg.Logging) {
+		logging.ConfigureLoggerLegacy(g.logger, cfg.Logging.Level, cfg.Logging.JSON)
+		report.Applied = append(report.Applied, "logging")
+	}
+
+	// Renewed certificate files are picked up right away rather than at the
+	// next check
+	if g.certReloader != nil {
+		if reloaded, err := g.certReloader.Reload(); err != nil {
+			g.logger.WithError(err).Warn("Failed to reload TLS certificates, keeping the current ones")
+		} else if reloaded {
+			report.Applied = append(report.Applied, "certificates")
+		}
+	}
+
+	// Flags are evaluated per request, so new definitions apply right away
+	if g.flags != nil && !reflect.DeepEqual(old.FeatureFlags.Flags, cfg.FeatureFlags.Flags) {
+		if err := g.flags.SetFlags(cfg.FeatureFlags.Flags); err != nil {
+			return fmt.Errorf("invalid feature flags: %w", err)
+		}
+		report.Applied = append(report.Applied, "featureFlags")
+	}
+
+	// Every other section is read once, at startup
+	for _, section := range config.ChangedSections(old, cfg) {
+		switch section {
+		case "services", "logging":
+			// Applied above
+		case "featureFlags":
+			// Flag definitions were applied above, but not where they come from
+			if old.FeatureFlags.File != cfg.FeatureFlags.File {
+				report.RequiresRestart = append(report.RequiresRestart, "featureFlags.file")
+			}
+			if old.FeatureFlags.PollInterval != cfg.FeatureFlags.PollInterval {
+				report.RequiresRestart = append(report.RequiresRestart, "featureFlags.pollInterval")
+			}
+		default:
+			report.RequiresRestart = append(report.RequiresRestart, section)
+		}
+	}
+
+	return nil
+}
+
+// ApplyConfig implements gitops.Applier
+func (g *Gateway) ApplyConfig(ctx context.Context, cfg *config.Config) error {
+	_, err := g.Reload(cfg)
+	return err
+}
+
+// currentConfig returns a snapshot of the active configuration
+func (g *Gateway) currentConfig() *config.Config {
+	return g.config.Load()
+}
+
+// changedServices compares services with the services routed
+func (g *Gateway) changedServices(services []config.ServiceConfig) (added, removed, changed []string) {
+	fingerprints := serviceFingerprints(services)
+	for _, svc := range services {
+		routed, ok := g.routed[svc.Name]
+		if !ok {
+			added = append(added, svc.Name)
+		} else if !bytes.Equal(routed, fingerprints[svc.Name]) {
+			changed = append(changed, svc.Name)
+		}
+	}
+	for name := range g.routed {
+		if _, ok := fingerprints[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	return added, removed, changed
+}
@@ -0,0 +1,673 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/cel"
+	"odin/pkg/config"
+	"odin/pkg/discovery"
+	"odin/pkg/dlp"
+	"odin/pkg/experiments"
+	"odin/pkg/graphql"
+	"odin/pkg/grpc"
+	"odin/pkg/health"
+	"odin/pkg/mqtt"
+	"odin/pkg/service"
+	"odin/pkg/soap"
+	"odin/pkg/static"
+	"odin/pkg/transform"
+	"odin/pkg/versioning"
+	"odin/pkg/websocket"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// serviceCheck is how the targets of a service are health checked
+type serviceCheck struct {
+	checker   *health.TargetChecker
+	dedicated bool // Started for the service alone, rather than the global checker
+	config    config.HealthCheckConfig
+	targets   []string
+}
+
+// newServiceRegistry registers services, logging those that are invalid
+func newServiceRegistry(services []config.ServiceConfig, logger *logrus.Logger) *service.Registry {
+	registry := service.NewRegistry(logger)
+
+	for _, svcConfig := range services {
+		svc := &service.Config{
+			Name:            svcConfig.Name,
+			BasePath:        svcConfig.BasePath,
+			Targets:         svcConfig.Targets,
+			StripBasePath:   svcConfig.StripBasePath,
+			Timeout:         svcConfig.Timeout,
+			RetryCount:      svcConfig.RetryCount,
+			RetryDelay:      svcConfig.RetryDelay,
+			Authentication:  svcConfig.Authentication,
+			LoadBalancing:   svcConfig.LoadBalancing,
+			Headers:         svcConfig.Headers,
+			Protocol:        svcConfig.Protocol,
+			FeatureFlag:     svcConfig.FeatureFlag,
+			StreamThreshold: svcConfig.StreamThreshold,
+		}
+
+		if canary := svcConfig.Canary; canary != nil {
+			svc.Canary = &service.CanaryConfig{
+				Enabled:     true,
+				Targets:     canary.Targets,
+				Weight:      canary.Weight,
+				WeightFlag:  canary.WeightFlag,
+				Header:      canary.Header,
+				HeaderValue: canary.HeaderValue,
+				CookieName:  canary.CookieName,
+				CookieValue: canary.CookieValue,
+			}
+		}
+
+		if svcConfig.CORS != nil {
+			svc.CORS = &service.CORSConfig{
+				AllowOrigins:     svcConfig.CORS.AllowOrigins,
+				AllowMethods:     svcConfig.CORS.AllowMethods,
+				AllowHeaders:     svcConfig.CORS.AllowHeaders,
+				ExposeHeaders:    svcConfig.CORS.ExposeHeaders,
+				AllowCredentials: svcConfig.CORS.AllowCredentials,
+				MaxAge:           svcConfig.CORS.MaxAge,
+			}
+		}
+
+		if b := svcConfig.Backpressure; b != nil {
+			svc.Backpressure = &service.BackpressureConfig{
+				DisableRetries:  b.DisableRetries,
+				MaxDelay:        b.MaxDelay,
+				StripRetryAfter: b.StripRetryAfter,
+			}
+		}
+
+		if s := svcConfig.Streaming; s != nil {
+			svc.Streaming = &service.StreamingConfig{
+				Enabled:       s.Enabled,
+				FlushInterval: s.FlushInterval,
+				MaxDuration:   s.MaxDuration,
+			}
+		}
+
+		if a := svcConfig.Auth; a != nil {
+			svc.Auth = &service.AuthConfig{Provider: a.Provider, Scopes: a.Scopes}
+		}
+
+		if l := svcConfig.Limits; l != nil {
+			svc.Limits = &service.LimitsConfig{
+				MaxRequestBodySize:  l.MaxRequestBodySize,
+				MaxHeaderBytes:      l.MaxHeaderBytes,
+				MaxResponseBodySize: l.MaxResponseBodySize,
+			}
+		}
+
+		if a := svcConfig.Async; a != nil {
+			svc.Async = &service.AsyncConfig{
+				Mode:           a.Mode,
+				Timeout:        a.Timeout,
+				CallbackHosts:  a.CallbackHosts,
+				CallbackSecret: a.CallbackSecret,
+			}
+		}
+
+		if svcConfig.Transport != nil {
+			svc.Transport = &service.TransportConfig{
+				MaxIdleConnsPerHost: svcConfig.Transport.MaxIdleConnsPerHost,
+				IdleConnTimeout:     svcConfig.Transport.IdleConnTimeout,
+				DialTimeout:         svcConfig.Transport.DialTimeout,
+				TLSHandshakeTimeout: svcConfig.Transport.TLSHandshakeTimeout,
+				DisableKeepAlives:   svcConfig.Transport.DisableKeepAlives,
+			}
+			if tlsConfig := svcConfig.Transport.TLS; tlsConfig != nil {
+				svc.Transport.TLS = &service.UpstreamTLSConfig{
+					CAFile:             tlsConfig.CAFile,
+					CertFile:           tlsConfig.CertFile,
+					KeyFile:            tlsConfig.KeyFile,
+					ServerName:         tlsConfig.ServerName,
+					InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+				}
+			}
+			if proxy := svcConfig.Transport.Proxy; proxy != nil {
+				svc.Transport.Proxy = &service.EgressProxyConfig{
+					URL:      proxy.URL,
+					Username: proxy.Username,
+					Password: proxy.Password,
+					NoProxy:  proxy.NoProxy,
+				}
+			}
+		}
+
+		svc.Transform.Request = make([]service.TransformRule, len(svcConfig.Transform.Request))
+		for i, rule := range svcConfig.Transform.Request {
+			svc.Transform.Request[i] = service.TransformRule{
+				From:    rule.From,
+				To:      rule.To,
+				Default: rule.Default,
+			}
+		}
+
+		svc.Transform.Response = make([]service.TransformRule, len(svcConfig.Transform.Response))
+		for i, rule := range svcConfig.Transform.Response {
+			svc.Transform.Response[i] = service.TransformRule{
+				From:    rule.From,
+				To:      rule.To,
+				Default: rule.Default,
+			}
+		}
+
+		for _, rule := range svcConfig.ResponseFields {
+			svc.ResponseFields = append(svc.ResponseFields, transform.FieldRule{
+				Method: rule.Method,
+				Path:   rule.Path,
+				Fields: rule.Fields,
+			})
+		}
+
+		if hr := svcConfig.HeaderRules; hr != nil {
+			svc.HeaderRules = &service.HeaderRulesConfig{
+				Request:  headerRules(hr.Request),
+				Response: headerRules(hr.Response),
+			}
+		}
+
+		if svcConfig.Transform.XML != nil {
+			svc.Transformation = xmlTransformation(svcConfig.Transform.XML)
+		}
+		if len(svcConfig.Transform.Templates) > 0 {
+			if svc.Transformation == nil {
+				svc.Transformation = &service.TransformationConfig{}
+			}
+			for _, tmpl := range svcConfig.Transform.Templates {
+				svc.Transformation.Templates = append(svc.Transformation.Templates, transform.TemplateRule{
+					Method:   tmpl.Method,
+					Path:     tmpl.Path,
+					Request:  tmpl.Request,
+					Response: tmpl.Response,
+				})
+			}
+		}
+
+		if svcConfig.Aggregation != nil {
+			aggregation := &service.AggregationConfig{
+				Dependencies: make([]service.DependencyConfig, len(svcConfig.Aggregation.Dependencies)),
+			}
+
+			for i, dep := range svcConfig.Aggregation.Dependencies {
+				dependency := service.DependencyConfig{
+					Service:          dep.Service,
+					Path:             dep.Path,
+					ParameterMapping: make([]service.MappingConfig, len(dep.ParameterMapping)),
+					ResultMapping:    make([]service.MappingConfig, len(dep.ResultMapping)),
+				}
+
+				for j, mapping := range dep.ParameterMapping {
+					dependency.ParameterMapping[j] = service.MappingConfig{
+						From: mapping.From,
+						To:   mapping.To,
+					}
+				}
+
+				for j, mapping := range dep.ResultMapping {
+					dependency.ResultMapping[j] = service.MappingConfig{
+						From: mapping.From,
+						To:   mapping.To,
+					}
+				}
+
+				aggregation.Dependencies[i] = dependency
+			}
+
+			svc.Aggregation = aggregation
+		}
+
+		if err := registry.Register(svc); err != nil {
+			logger.WithError(err).Warnf("Failed to register service %s", svc.Name)
+		}
+	}
+	return registry
+}
+
+// routeServices builds the routes of services and swaps them in for the
+// routes in use, along with the services known to the other components.
+// Requests in flight finish on the routes they started on. Global settings
+// are read from the active configuration.
+func (g *Gateway) routeServices(services []config.ServiceConfig, registry *service.Registry) (err error) {
+	cfg := g.config.Load()
+	logger := g.logger
+	router := g.router
+
+	// Protocol proxies are released once the routes using them are
+	// replaced, or right away if the services cannot be routed
+	var closers []func()
+	defer func() {
+		if err != nil {
+			for _, release := range closers {
+				release()
+			}
+		}
+	}()
+
+	router.ResetServices(registry)
+	checks := make(map[string]serviceCheck)
+	for _, svcConfig := range services {
+		// Compile the CEL match conditions and policies
+		route, err := cel.CompileRoute(svcConfig)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", svcConfig.Name, err)
+		}
+		if route != nil {
+			router.SetRoutePredicates(svcConfig.Name, route)
+		}
+
+		// Run the A/B experiment
+		if svcConfig.Experiment != nil {
+			experiment, err := experiments.New(svcConfig.Name, *svcConfig.Experiment)
+			if err != nil {
+				return fmt.Errorf("service %s: experiment: %w", svcConfig.Name, err)
+			}
+			router.SetExperiment(svcConfig.Name, experiment)
+		}
+
+		// Validate requests against the OpenAPI spec attached to the service
+		if svcConfig.Validation != nil {
+			validator, err := newRequestValidator(svcConfig, registry)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", svcConfig.Name, err)
+			}
+			router.SetRequestValidator(svcConfig.Name, validator)
+			logger.WithField("service", svcConfig.Name).Info("Request validation enabled")
+		}
+
+		// Answer mocked requests without calling the backends
+		if svcConfig.Mock != nil {
+			mocker, err := newMocker(svcConfig, registry)
+			if err != nil {
+				return fmt.Errorf("service %s: mock: %w", svcConfig.Name, err)
+			}
+			router.SetMocker(svcConfig.Name, mocker)
+			logger.WithField("service", svcConfig.Name).Warn("Service is mocked; its responses are made up by the gateway")
+		}
+
+		// Answer static and redirect services without an upstream
+		switch {
+		case svcConfig.Static != nil:
+			router.SetStaticResponder(svcConfig.Name, static.NewResponse(*svcConfig.Static))
+		case svcConfig.Redirect != nil:
+			responder, err := static.NewRedirect(svcConfig.BasePath, *svcConfig.Redirect)
+			if err != nil {
+				return fmt.Errorf("service %s: redirect: %w", svcConfig.Name, err)
+			}
+			router.SetStaticResponder(svcConfig.Name, responder)
+		}
+
+		// Require client certificates issued by the service's CAs
+		if a := svcConfig.Auth; a != nil && a.ClientCert != nil {
+			clientCert, err := auth.NewClientCertAuth(*a.ClientCert)
+			if err != nil {
+				return fmt.Errorf("service %s: clientCert: %w", svcConfig.Name, err)
+			}
+			router.SetClientCertAuth(svcConfig.Name, clientCert)
+		}
+
+		// Mask or drop sensitive fields in responses
+		if svcConfig.DLP != nil && len(svcConfig.DLP.Rules) > 0 {
+			filter, err := dlp.NewFilter(svcConfig.Name, *svcConfig.DLP, g.dlpStats)
+			if err != nil {
+				return fmt.Errorf("service %s: dlp: %w", svcConfig.Name, err)
+			}
+			router.SetDLPFilter(svcConfig.Name, filter)
+			logger.WithField("service", svcConfig.Name).Info("Response DLP enabled")
+		}
+
+		// Route requests to API versions and announce deprecated ones
+		if svcConfig.Versioning != nil {
+			router.SetVersionRouter(svcConfig.Name, versioning.NewRouter(svcConfig.Name, svcConfig.BasePath, *svcConfig.Versioning))
+			logger.WithField("service", svcConfig.Name).Info("API versioning enabled")
+		}
+
+		// Proxy WebSocket upgrades within connection limits, to HTTP services
+		// when enabled and to websocket services always
+		if svcConfig.Protocol == "websocket" || (cfg.WebSocket.Enabled && (svcConfig.Protocol == "" || svcConfig.Protocol == "http")) {
+			router.SetWebSocketProxy(svcConfig.Name, g.newWebSocketProxy(svcConfig))
+		}
+
+		switch svcConfig.Protocol {
+		case "graphql":
+			if svcConfig.GraphQL != nil && (len(svcConfig.Targets) > 0 || svcConfig.GraphQL.Federation != nil) {
+				graphqlConfig := &graphql.ProxyConfig{
+					MaxQueryDepth:       svcConfig.GraphQL.MaxQueryDepth,
+					MaxQueryComplexity:  svcConfig.GraphQL.MaxQueryComplexity,
+					EnableIntrospection: svcConfig.GraphQL.EnableIntrospection,
+					Timeout:             svcConfig.Timeout,
+					EnableQueryCaching:  svcConfig.GraphQL.EnableQueryCaching,
+					CacheTTL:            svcConfig.GraphQL.CacheTTL,
+				}
+				if len(svcConfig.Targets) > 0 {
+					graphqlConfig.Endpoint = svcConfig.Targets[0]
+				}
+				if federation := svcConfig.GraphQL.Federation; federation != nil {
+					graphqlConfig.Federation = &graphql.FederationConfig{}
+					for _, subgraph := range federation.Subgraphs {
+						graphqlConfig.Federation.Subgraphs = append(graphqlConfig.Federation.Subgraphs, graphql.Subgraph(subgraph))
+					}
+					for _, link := range federation.Links {
+						graphqlConfig.Federation.Links = append(graphqlConfig.Federation.Links, graphql.Link(link))
+					}
+				}
+				graphqlProxy := graphql.NewProxy(graphqlConfig, logger)
+				basePath := svcConfig.BasePath
+				router.SetServiceRoutes(svcConfig.Name, func(e *echo.Echo) {
+					graphqlProxy.RegisterRoutes(e, basePath)
+				})
+				logger.WithField("service", svcConfig.Name).Info("GraphQL proxy registered")
+			}
+		case "grpc":
+			if svcConfig.GRPC != nil && len(svcConfig.Targets) > 0 {
+				grpcConfig := &grpc.ProxyConfig{
+					Target:               svcConfig.Targets[0],
+					MaxMessageSize:       svcConfig.GRPC.MaxMessageSize,
+					Timeout:              svcConfig.Timeout,
+					EnableTLS:            svcConfig.GRPC.EnableTLS,
+					TLSCertFile:          svcConfig.GRPC.TLSCertFile,
+					TLSKeyFile:           svcConfig.GRPC.TLSKeyFile,
+					EnableReflection:     svcConfig.GRPC.EnableReflection,
+					DescriptorSets:       svcConfig.GRPC.DescriptorSets,
+					Service:              svcConfig.Name,
+					StreamTimeout:        svcConfig.GRPC.StreamTimeout,
+					MaxConcurrentStreams: svcConfig.GRPC.MaxConcurrentStreams,
+				}
+				for _, route := range svcConfig.GRPC.Routes {
+					grpcConfig.Routes = append(grpcConfig.Routes, grpc.RESTRoute(route))
+				}
+				grpcProxy, err := grpc.NewProxy(grpcConfig, logger)
+				if err != nil {
+					logger.WithError(err).Warnf("Failed to create gRPC proxy for service %s", svcConfig.Name)
+					break
+				}
+				// Calls still running on the old routes get the service's
+				// timeout to finish
+				timeout := svcConfig.Timeout
+				closers = append(closers, func() {
+					time.AfterFunc(timeout, func() { grpcProxy.Close() })
+				})
+				basePath := svcConfig.BasePath
+				router.SetServiceRoutes(svcConfig.Name, func(e *echo.Echo) {
+					grpcProxy.RegisterRoutes(e, basePath)
+				})
+				logger.WithField("service", svcConfig.Name).Info("gRPC proxy registered")
+			}
+		case "mqtt-ws":
+			// Terminate MQTT over WebSocket, authenticating clients with the
+			// same JWTs and API keys as HTTP requests
+			if len(svcConfig.Targets) == 0 {
+				break
+			}
+			var authenticator mqtt.Authenticator
+			if svcConfig.MQTT.Auth == "apiKey" {
+				if g.apiKeys == nil {
+					return fmt.Errorf("service %s: mqtt apiKey authentication requires MongoDB", svcConfig.Name)
+				}
+				authenticator = mqtt.NewAPIKeyAuthenticator(g.apiKeys)
+			} else {
+				jwtAuthenticator := mqtt.NewJWTAuthenticator(auth.JWTSecret(cfg.Auth))
+				if g.revocations != nil {
+					jwtAuthenticator.SetRevocations(g.revocations)
+				}
+				authenticator = jwtAuthenticator
+			}
+			mqttProxy := mqtt.NewProxy(svcConfig.Name, svcConfig.Targets[0], *svcConfig.MQTT, authenticator, logger)
+			basePath := svcConfig.BasePath
+			router.SetServiceRoutes(svcConfig.Name, func(e *echo.Echo) {
+				mqttProxy.RegisterRoutes(e, basePath)
+			})
+			logger.WithField("service", svcConfig.Name).Info("MQTT over WebSocket proxy registered")
+		case "soap":
+			// Bridge JSON clients to the SOAP service
+			if svcConfig.SOAP == nil {
+				break
+			}
+			soapProxy, err := soap.NewProxy(svcConfig.Name, svcConfig.Targets, *svcConfig.SOAP, logger)
+			if err != nil {
+				return fmt.Errorf("service %s: soap: %w", svcConfig.Name, err)
+			}
+			router.SetSOAPProxy(svcConfig.Name, soapProxy)
+			logger.WithField("service", svcConfig.Name).Info("SOAP bridge registered")
+		}
+
+		// Resolve dns:// and dns+srv:// targets and follow their records
+		for _, target := range svcConfig.Targets {
+			if !discovery.IsDNS(target) {
+				continue
+			}
+			if g.resolver == nil {
+				g.resolver = discovery.NewResolver(discovery.Config{
+					Nameservers: cfg.Discovery.Nameservers,
+					Timeout:     cfg.Discovery.Timeout,
+					MinRefresh:  cfg.Discovery.MinRefresh,
+					MaxRefresh:  cfg.Discovery.MaxRefresh,
+				}, logger)
+				g.resolver.OnChange(g.followResolvedTargets)
+				g.resolver.Start()
+			}
+			if err := g.resolver.Add(target); err != nil {
+				return fmt.Errorf("service %s: %w", svcConfig.Name, err)
+			}
+		}
+
+		if hc := svcConfig.HealthCheck; hc != nil && hc.Enabled {
+			check := g.newServiceCheck(svcConfig)
+			router.SetHealthChecker(svcConfig.Name, check.checker)
+			checks[svcConfig.Name] = check
+		}
+	}
+	if g.resolver != nil {
+		router.SetResolver(g.resolver)
+	}
+
+	if g.errorPages != nil {
+		if err := g.errorPages.SetServices(services); err != nil {
+			return err
+		}
+	}
+	if g.ipFilter != nil {
+		if err := g.ipFilter.SetServiceLists(services); err != nil {
+			return fmt.Errorf("failed to initialize IP filter: %w", err)
+		}
+	}
+	if g.faults != nil {
+		g.faults.SetServices(services)
+	}
+	if g.aggregator != nil {
+		g.aggregator.SetServices(services)
+	}
+
+	if err := router.RegisterRoutes(); err != nil {
+		return fmt.Errorf("failed to register routes: %w", err)
+	}
+	g.serviceRegistry = registry
+	g.updateChecks(checks)
+
+	for _, release := range g.closers {
+		release()
+	}
+	g.closers = closers
+	g.routed = serviceFingerprints(services)
+	return nil
+}
+
+// newWebSocketProxy proxies the WebSocket upgrades of an HTTP service with
+// the global settings, unless the service overrides them
+func (g *Gateway) newWebSocketProxy(svcConfig config.ServiceConfig) *websocket.Proxy {
+	global := g.config.Load().WebSocket
+	wsConfig := websocket.Config{
+		MaxMessageSize: global.MaxMessageSize,
+		IdleTimeout:    global.IdleTimeout,
+	}
+	var limits websocket.Limits
+	if ws := svcConfig.WebSocket; ws != nil {
+		limits = websocket.Limits{
+			MaxConnections:      ws.MaxConnections,
+			MaxConnectionsPerIP: ws.MaxConnectionsPerIP,
+		}
+		if ws.MaxMessageSize > 0 {
+			wsConfig.MaxMessageSize = ws.MaxMessageSize
+		}
+		if ws.IdleTimeout > 0 {
+			wsConfig.IdleTimeout = ws.IdleTimeout
+		}
+	}
+	proxy := websocket.NewProxy(wsConfig, g.logger)
+	proxy.SetLimiter(g.wsLimiter, svcConfig.Name, limits)
+	return proxy
+}
+
+// newServiceCheck picks the checker of a service's targets: one of its own
+// if it has custom settings, otherwise the global one. The service's checker
+// is kept while its settings do not change, so that target health survives
+// reloads.
+func (g *Gateway) newServiceCheck(svcConfig config.ServiceConfig) serviceCheck {
+	hc := svcConfig.HealthCheck
+	check := serviceCheck{checker: g.healthChecker, config: *hc, targets: svcConfig.Targets}
+
+	// Override defaults with service-specific config
+	svcHealthConfig := health.Config{
+		Interval:           hc.Interval,
+		Timeout:            hc.Timeout,
+		UnhealthyThreshold: hc.UnhealthyThreshold,
+		HealthyThreshold:   hc.HealthyThreshold,
+		ExpectedStatus:     hc.ExpectedStatus,
+		InsecureSkipVerify: hc.InsecureSkipVerify,
+		Probe:              hc.Type,
+		GRPCService:        hc.GRPCService,
+	}
+	if passive := hc.Passive; passive != nil && passive.Enabled {
+		svcHealthConfig.PassiveFailures = passive.Failures
+		svcHealthConfig.PassiveDecay = passive.Decay
+	}
+
+	probe := svcHealthConfig.Probe
+	if svcHealthConfig.Interval == 0 && svcHealthConfig.Timeout == 0 && (probe == "" || probe == health.ProbeHTTP) && svcHealthConfig.PassiveFailures == 0 {
+		return check
+	}
+	check.dedicated = true
+
+	g.checksMu.Lock()
+	previous, ok := g.checks[svcConfig.Name]
+	g.checksMu.Unlock()
+	if ok && previous.dedicated && reflect.DeepEqual(previous.config, check.config) {
+		check.checker = previous.checker
+		return check
+	}
+	check.checker = health.NewTargetChecker(svcHealthConfig, g.logger, g.alertManager)
+	if g.healthHistory != nil {
+		check.checker.SetRecorder(g.healthHistory)
+	}
+	return check
+}
+
+// updateChecks makes checks the health checks of the services. Checkers no
+// service uses any more are stopped, new ones started, and the targets of
+// the others updated.
+func (g *Gateway) updateChecks(checks map[string]serviceCheck) {
+	g.checksMu.Lock()
+	defer g.checksMu.Unlock()
+
+	previous := g.checkedTargets(g.checks)
+	current := g.checkedTargets(checks)
+	for checker, targets := range current {
+		for target, service := range targets {
+			if _, ok := previous[checker][target]; ok {
+				continue
+			}
+			checker.AddServiceTarget(service, target)
+			g.logger.WithFields(logrus.Fields{
+				"service": service,
+				"target":  target,
+			}).Info("Added target to health monitoring")
+		}
+		if _, ok := previous[checker]; !ok && checker != g.healthChecker {
+			checker.Start()
+		}
+	}
+	for checker, targets := range previous {
+		if _, ok := current[checker]; !ok && checker != g.healthChecker {
+			checker.Stop()
+			continue
+		}
+		for target := range targets {
+			if _, ok := current[checker][target]; !ok {
+				checker.RemoveTarget(target)
+			}
+		}
+	}
+	g.checks = checks
+}
+
+// checkedTargets returns the targets each checker checks for checks, with
+// the DNS targets replaced by their addresses, and the service of each
+func (g *Gateway) checkedTargets(checks map[string]serviceCheck) map[*health.TargetChecker]map[string]string {
+	checked := make(map[*health.TargetChecker]map[string]string)
+	for name, check := range checks {
+		targets := check.targets
+		if g.resolver != nil {
+			targets = g.resolver.Expand(targets)
+		}
+		if checked[check.checker] == nil {
+			checked[check.checker] = make(map[string]string)
+		}
+		for _, target := range targets {
+			checked[check.checker][target] = name
+		}
+	}
+	return checked
+}
+
+// followResolvedTargets health checks the addresses DNS targets resolve to
+func (g *Gateway) followResolvedTargets(change discovery.Change) {
+	g.checksMu.Lock()
+	defer g.checksMu.Unlock()
+	for name, check := range g.checks {
+		if !slices.Contains(check.targets, change.Target) {
+			continue
+		}
+		for _, target := range change.Added {
+			check.checker.AddServiceTarget(name, target)
+		}
+		for _, target := range change.Removed {
+			check.checker.RemoveTarget(target)
+		}
+	}
+}
+
+// criticalCheck fails while fewer than min targets of a service are healthy
+func (g *Gateway) criticalCheck(name string, min int) health.ReadinessCheck {
+	return func(ctx context.Context) error {
+		g.checksMu.Lock()
+		check, ok := g.checks[name]
+		g.checksMu.Unlock()
+		if !ok {
+			return fmt.Errorf("service is not health checked")
+		}
+		return health.MinHealthyTargets(check.checker, check.targets, min)(ctx)
+	}
+}
+
+// serviceFingerprints marshals each service, to tell the services that
+// changed between configurations
+func serviceFingerprints(services []config.ServiceConfig) map[string][]byte {
+	fingerprints := make(map[string][]byte, len(services))
+	for _, svc := range services {
+		data, _ := yaml.Marshal(svc)
+		fingerprints[svc.Name] = data
+	}
+	return fingerprints
+}
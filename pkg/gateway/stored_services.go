@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetStoredServices routes services stored in MongoDB next to those of the
+// configuration, replacing the stored services routed before. They are
+// refused if they are invalid or clash with other services.
+func (g *Gateway) SetStoredServices(services []config.ServiceConfig) error {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+
+	stored, err := g.checkStoredServices(g.config.Load(), services, false)
+	if err != nil {
+		return err
+	}
+	all := append(append([]config.ServiceConfig{}, g.config.Load().Services...), stored...)
+	if added, removed, changed := g.changedServices(all); len(added)+len(removed)+len(changed) > 0 {
+		if err := g.routeServices(all, newServiceRegistry(all, g.logger)); err != nil {
+			return err
+		}
+		g.logger.WithFields(logrus.Fields{
+			"added":   added,
+			"removed": removed,
+			"changed": changed,
+		}).Info("Stored services rerouted")
+	}
+	g.stored = stored
+	return nil
+}
+
+// checkStoredServices returns stored services with their defaults set, or
+// an error if one is invalid or shares a name or base path with another
+// service. With skipClashes, the services clashing with others are left out
+// instead.
+func (g *Gateway) checkStoredServices(cfg *config.Config, services []config.ServiceConfig, skipClashes bool) ([]config.ServiceConfig, error) {
+	names := make(map[string]string, len(cfg.Services)+len(services))
+	basePaths := make(map[string]string, len(cfg.Services)+len(services))
+	for _, svc := range cfg.Services {
+		names[svc.Name] = "the configuration"
+		basePaths[svc.BasePath] = svc.Name
+	}
+
+	stored := make([]config.ServiceConfig, 0, len(services))
+	for _, svc := range services {
+		svc.SetDefaults()
+		var clash error
+		if where, ok := names[svc.Name]; ok {
+			clash = fmt.Errorf("service %s is already defined in %s", svc.Name, where)
+		} else if other, ok := basePaths[svc.BasePath]; ok {
+			clash = fmt.Errorf("service %s: base path %s is already used by service %s", svc.Name, svc.BasePath, other)
+		}
+		if clash != nil && !skipClashes {
+			return nil, clash
+		}
+		if clash != nil {
+			g.logger.WithError(clash).Warn("Stored service not routed")
+			continue
+		}
+		names[svc.Name] = "MongoDB"
+		basePaths[svc.BasePath] = svc.Name
+		stored = append(stored, svc)
+	}
+
+	candidate, err := cfg.Clone()
+	if err != nil {
+		return nil, err
+	}
+	candidate.Services = append(candidate.Services, stored...)
+	if err := config.Validate(candidate); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// withStoredServices returns the services of cfg followed by the stored
+// services that fit next to them
+func (g *Gateway) withStoredServices(cfg *config.Config) []config.ServiceConfig {
+	all := append([]config.ServiceConfig{}, cfg.Services...)
+	if len(g.stored) == 0 {
+		return all
+	}
+	stored, err := g.checkStoredServices(cfg, g.stored, true)
+	if err != nil {
+		g.logger.WithError(err).Warn("Stored services are invalid with the new configuration and are no longer routed")
+		return all
+	}
+	return append(all, stored...)
+}
+
+// loadStoredServices reads the enabled services stored in MongoDB, for the
+// first routing of the services
+func (g *Gateway) loadStoredServices(ctx context.Context, adapter *mongodb.ServiceAdapter) {
+	services, err := adapter.LoadServices(ctx)
+	if err != nil {
+		g.logger.WithError(err).Warn("Failed to load stored services; only the configured services are routed")
+		return
+	}
+	stored, err := g.checkStoredServices(g.config.Load(), services, true)
+	if err != nil {
+		g.logger.WithError(err).Warn("Stored services are invalid; only the configured services are routed")
+		return
+	}
+	g.stored = stored
+}
@@ -0,0 +1,260 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Headers telling services where clients are. Clients cannot set them;
+// they are removed from every request.
+const (
+	HeaderCountry = "X-Geo-Country"
+	HeaderRegion  = "X-Geo-Region"
+	HeaderCity    = "X-Geo-City"
+	HeaderASN     = "X-Geo-ASN"
+	HeaderASNOrg  = "X-Geo-ASN-Org"
+)
+
+var headers = []string{HeaderCountry, HeaderRegion, HeaderCity, HeaderASN, HeaderASNOrg}
+
+// Values of metric labels
+const (
+	labelUnknown = "unknown" // The address is in no network of the database
+	labelOther   = "other"   // The label already has maxLabelValues values
+)
+
+var geoRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_geo_requests_total",
+		Help: "Total number of requests by client location; labels not enabled are empty",
+	},
+	[]string{"country", "region", "asn"},
+)
+
+// maxCached bounds the locations kept per database
+const maxCached = 10000
+
+// Location is where a client address is
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code
+	Region  string // ISO 3166-2 code of the first subdivision, without the country
+	City    string // English name
+	ASN     uint   // Autonomous system number, 0 if unknown
+	ASNOrg  string // Organization of the autonomous system
+}
+
+// Locator looks up client addresses in a city or country database and an
+// ASN database, and passes the result to services as headers
+type Locator struct {
+	city *Reader
+	asn  *Reader
+
+	labels         map[string]bool
+	maxLabelValues int
+
+	mu     sync.Mutex
+	seen   map[string]map[string]bool // Label values counted so far
+	cities map[uint]Location          // Decoded records by data offset
+	asns   map[uint]Location
+}
+
+// New opens the databases of cfg
+func New(cfg config.GeoIPConfig) (*Locator, error) {
+	l := &Locator{
+		labels:         make(map[string]bool),
+		maxLabelValues: cfg.MaxLabelValues,
+		seen:           make(map[string]map[string]bool),
+		cities:         make(map[uint]Location),
+		asns:           make(map[uint]Location),
+	}
+	if l.maxLabelValues == 0 {
+		l.maxLabelValues = 50
+	}
+	for _, label := range cfg.MetricLabels {
+		l.labels[label] = true
+	}
+
+	var err error
+	if cfg.Database != "" {
+		if l.city, err = Open(cfg.Database); err != nil {
+			return nil, fmt.Errorf("database: %w", err)
+		}
+	}
+	if cfg.ASNDatabase != "" {
+		if l.asn, err = Open(cfg.ASNDatabase); err != nil {
+			return nil, fmt.Errorf("asnDatabase: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Lookup returns where ip is, and false if neither database knows it
+func (l *Locator) Lookup(ip net.IP) (Location, bool) {
+	var loc Location
+	found := false
+	if l.city != nil {
+		if city, ok := l.lookup(l.city, l.cities, ip, cityLocation); ok {
+			loc = city
+			found = true
+		}
+	}
+	if l.asn != nil {
+		if asn, ok := l.lookup(l.asn, l.asns, ip, asnLocation); ok {
+			loc.ASN, loc.ASNOrg = asn.ASN, asn.ASNOrg
+			found = true
+		}
+	}
+	return loc, found
+}
+
+// lookup finds ip in db. Many addresses share a record, so decoded records
+// are cached by their offset.
+func (l *Locator) lookup(db *Reader, cache map[uint]Location, ip net.IP, decode func(map[string]any) Location) (Location, bool) {
+	offset, ok, err := db.lookupOffset(ip)
+	if err != nil || !ok {
+		return Location{}, false
+	}
+
+	l.mu.Lock()
+	loc, cached := cache[offset]
+	l.mu.Unlock()
+	if cached {
+		return loc, true
+	}
+
+	value, _, err := (&decoder{data: db.section}).decode(offset)
+	if err != nil {
+		return Location{}, false
+	}
+	record, _ := value.(map[string]any)
+	loc = decode(record)
+
+	l.mu.Lock()
+	if len(cache) >= maxCached {
+		clear(cache)
+	}
+	cache[offset] = loc
+	l.mu.Unlock()
+	return loc, true
+}
+
+func cityLocation(record map[string]any) Location {
+	loc := Location{
+		Country: stringAt(record, "country", "iso_code"),
+		City:    stringAt(record, "city", "names", "en"),
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		if first, ok := subdivisions[0].(map[string]any); ok {
+			loc.Region = stringAt(first, "iso_code")
+		}
+	}
+	return loc
+}
+
+func asnLocation(record map[string]any) Location {
+	loc := Location{ASNOrg: stringAt(record, "autonomous_system_organization")}
+	if n, ok := record["autonomous_system_number"].(uint64); ok {
+		loc.ASN = uint(n)
+	}
+	return loc
+}
+
+// stringAt returns the string at a path of map keys, or ""
+func stringAt(m map[string]any, path ...string) string {
+	var v any = m
+	for _, key := range path {
+		current, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = current[key]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// Middleware sets the location headers of every request to the client's
+// location, and counts requests by location when metric labels are enabled
+func (l *Locator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header
+			for _, name := range headers {
+				header.Del(name)
+			}
+
+			loc, found := l.Lookup(net.ParseIP(c.RealIP()))
+			if found {
+				setHeader(header, HeaderCountry, loc.Country)
+				setHeader(header, HeaderRegion, loc.Region)
+				setHeader(header, HeaderCity, loc.City)
+				setHeader(header, HeaderASNOrg, loc.ASNOrg)
+				if loc.ASN != 0 {
+					header.Set(HeaderASN, strconv.FormatUint(uint64(loc.ASN), 10))
+				}
+				c.Set("geo", loc)
+			}
+			if len(l.labels) > 0 {
+				l.count(loc, found)
+			}
+			return next(c)
+		}
+	}
+}
+
+func setHeader(header http.Header, name, value string) {
+	if value != "" {
+		header.Set(name, value)
+	}
+}
+
+// count adds the request to the metric of its location
+func (l *Locator) count(loc Location, found bool) {
+	asn, region := "", ""
+	if loc.ASN != 0 {
+		asn = strconv.FormatUint(uint64(loc.ASN), 10)
+	}
+	if loc.Region != "" {
+		region = loc.Country + "-" + loc.Region // Region codes repeat across countries
+	}
+	geoRequests.WithLabelValues(
+		l.labelValue("country", loc.Country, found),
+		l.labelValue("region", region, found),
+		l.labelValue("asn", asn, found),
+	).Inc()
+}
+
+// labelValue keeps the number of values of each label under maxLabelValues,
+// so that metrics stay cheap however many places clients come from
+func (l *Locator) labelValue(label, value string, found bool) string {
+	if !l.labels[label] {
+		return ""
+	}
+	if !found || value == "" {
+		return labelUnknown
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := l.seen[label]
+	if values == nil {
+		values = make(map[string]bool)
+		l.seen[label] = values
+	}
+	if !values[value] {
+		if len(values) >= l.maxLabelValues {
+			return labelOther
+		}
+		values[value] = true
+	}
+	return value
+}
@@ -0,0 +1,354 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata at the end of a MaxMind DB file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Reader looks up IP addresses in a MaxMind DB (.mmdb) file, the format of
+// the GeoIP2 and GeoLite2 databases. The file is read into memory once.
+type Reader struct {
+	data       []byte
+	tree       []byte
+	section    []byte // Data section
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // Node IPv4 lookups start from in IPv6 databases
+	dbType     string
+}
+
+// Open reads a MaxMind DB file
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(data)
+}
+
+// NewReader reads a MaxMind DB from its contents
+func NewReader(data []byte) (*Reader, error) {
+	start := bytes.LastIndex(data, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata not found")
+	}
+	meta := &decoder{data: data[start+len(metadataMarker):]}
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid metadata: not a map")
+	}
+
+	r := &Reader{data: data}
+	r.nodeCount = uintField(m, "node_count")
+	r.recordSize = uintField(m, "record_size")
+	r.ipVersion = uintField(m, "ip_version")
+	r.dbType, _ = m["database_type"].(string)
+	if major := uintField(m, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("unsupported format version %d", major)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, errors.New("invalid database: search tree exceeds the file")
+	}
+	r.tree = data[:treeSize]
+	r.section = data[treeSize+16 : start]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// DatabaseType returns the type recorded in the database, such as
+// GeoLite2-City
+func (r *Reader) DatabaseType() string {
+	return r.dbType
+}
+
+// Lookup returns the record of the network ip belongs to, nil if there is
+// none
+func (r *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	offset, ok, err := r.lookupOffset(ip)
+	if err != nil || !ok {
+		return nil, err
+	}
+	value, _, err := (&decoder{data: r.section}).decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := value.(map[string]any)
+	return m, nil
+}
+
+// lookupOffset returns where the record of ip starts in the data section
+func (r *Reader) lookupOffset(ip net.IP) (uint, bool, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return 0, false, fmt.Errorf("IPv6 address %s in an IPv4 database", ip)
+	}
+
+	bits := len(ip) * 8
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return 0, false, nil
+	case node > r.nodeCount:
+		offset := node - r.nodeCount - 16
+		if offset >= uint(len(r.section)) {
+			return 0, false, errors.New("invalid database: record points outside the data section")
+		}
+		return offset, true, nil
+	}
+	return 0, false, errors.New("invalid database: search tree is too deep")
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (r *Reader) record(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(r.tree[node*8+bit*4:]))
+}
+
+func uintField(m map[string]any, name string) uint {
+	switch v := m[name].(type) {
+	case uint64:
+		return uint(v)
+	case uint32:
+		return uint(v)
+	case uint16:
+		return uint(v)
+	}
+	return 0
+}
+
+// Data section types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder reads values of the MaxMind DB data format
+type decoder struct {
+	data []byte
+}
+
+// decode returns the value at offset and the offset following it
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == typePointer {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+	return d.value(kind, size, offset)
+}
+
+// control reads the type and size of the value at offset, and returns the
+// offset of its payload
+func (d *decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, errors.New("unexpected end of data")
+	}
+	ctrl := d.data[offset]
+	offset++
+	kind := int(ctrl >> 5)
+	if kind == typePointer {
+		return kind, uint(ctrl & 0x1f), offset, nil
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, errors.New("unexpected end of data")
+		}
+		kind = 7 + int(d.data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.data)) {
+			return 0, 0, 0, errors.New("unexpected end of data")
+		}
+		extra := uint(0)
+		for _, b := range d.data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	return kind, size, offset, nil
+}
+
+// pointer decodes a pointer whose control byte had the low bits ctrl
+func (d *decoder) pointer(ctrl, offset uint) (uint, uint, error) {
+	n := ctrl>>3&0x3 + 1
+	if offset+n > uint(len(d.data)) {
+		return 0, 0, errors.New("unexpected end of data")
+	}
+	p := uint(0)
+	if n < 4 {
+		p = ctrl & 0x7
+	}
+	for _, b := range d.data[offset : offset+n] {
+		p = p<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
+
+func (d *decoder) value(kind int, size, offset uint) (any, uint, error) {
+	end := offset + size
+	payload := func() ([]byte, error) {
+		if end > uint(len(d.data)) {
+			return nil, errors.New("unexpected end of data")
+		}
+		return d.data[offset:end], nil
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		list := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			list = append(list, value)
+			offset = next
+		}
+		return list, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeEndMarker, typeContainer:
+		return nil, offset, nil
+	}
+
+	b, err := payload()
+	if err != nil {
+		return nil, 0, err
+	}
+	switch kind {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if kind == typeInt32 {
+			return int64(int32(uint32(n))), end, nil
+		}
+		return n, end, nil
+	case typeUint128:
+		// Too large for any field the gateway reads
+		return append([]byte(nil), b...), end, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", kind)
+}
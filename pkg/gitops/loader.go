@@ -0,0 +1,144 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"odin/pkg/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Declarative file layout inside the synced directory:
+//
+//	settings.yaml      top-level gateway settings (server, logging, cache, ...)
+//	services.yaml      a `services:` list
+//	services/*.yaml    one file per service, or a `services:` list per file
+//	plugins.yaml       a `plugins:` block
+const (
+	settingsFile = "settings.yaml"
+	servicesFile = "services.yaml"
+	servicesDir  = "services"
+	pluginsFile  = "plugins.yaml"
+)
+
+// LoadDirectory builds a new configuration by overlaying the declarative files
+// found in dir on top of a copy of base. It returns the resulting configuration
+// and the files that contributed to it.
+func LoadDirectory(dir string, base *config.Config) (*config.Config, []string, error) {
+	cfg, err := base.Clone()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []string
+
+	// Settings are decoded onto the copy so only keys present in the file change
+	settingsPath := filepath.Join(dir, settingsFile)
+	if data, err := os.ReadFile(settingsPath); err == nil {
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", settingsFile, err)
+		}
+		files = append(files, settingsFile)
+	}
+
+	services, serviceFiles, err := loadServices(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(serviceFiles) > 0 {
+		cfg.Services = services
+		files = append(files, serviceFiles...)
+	}
+
+	pluginsPath := filepath.Join(dir, pluginsFile)
+	if data, err := os.ReadFile(pluginsPath); err == nil {
+		var doc struct {
+			Plugins config.PluginsConfig `yaml:"plugins"`
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", pluginsFile, err)
+		}
+		cfg.Plugins = doc.Plugins
+		files = append(files, pluginsFile)
+	}
+
+	// The sync settings themselves are never taken from the repository
+	cfg.GitOps = base.GitOps
+
+	for i := range cfg.Services {
+		cfg.Services[i].SetDefaults()
+	}
+
+	return cfg, files, nil
+}
+
+// loadServices reads services.yaml and every YAML file under services/
+func loadServices(dir string) ([]config.ServiceConfig, []string, error) {
+	var services []config.ServiceConfig
+	var files []string
+
+	paths := []string{filepath.Join(dir, servicesFile)}
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, servicesDir, pattern))
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		parsed, err := parseServices(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, rel)
+		services = append(services, parsed...)
+	}
+
+	seen := make(map[string]string)
+	for _, svc := range services {
+		if prev, ok := seen[svc.Name]; ok {
+			return nil, nil, fmt.Errorf("service %s is declared more than once (basePath %s)", svc.Name, prev)
+		}
+		seen[svc.Name] = svc.BasePath
+	}
+
+	return services, files, nil
+}
+
+// parseServices accepts either a `services:` list or a single service document
+func parseServices(data []byte) ([]config.ServiceConfig, error) {
+	var doc struct {
+		Services []config.ServiceConfig `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Services) > 0 {
+		return doc.Services, nil
+	}
+
+	var svc config.ServiceConfig
+	if err := yaml.Unmarshal(data, &svc); err != nil {
+		return nil, err
+	}
+	if svc.Name == "" {
+		return nil, nil
+	}
+
+	return []config.ServiceConfig{svc}, nil
+}
@@ -0,0 +1,358 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Source is recorded with every configuration applied by the syncer
+const Source = "gitops"
+
+// Syncer keeps a local checkout of a configuration repository and applies
+// new commits to the gateway
+type Syncer struct {
+	config   config.GitOpsConfig
+	base     func() *config.Config
+	applier  Applier
+	recorder Recorder
+	logger   *logrus.Logger
+	gitPath  string
+
+	syncMu   sync.Mutex // serializes sync runs
+	mu       sync.RWMutex
+	status   SyncStatus
+	running  bool
+	trigger  chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewSyncer creates a new GitOps syncer. base returns the configuration the
+// declarative files are overlaid on, usually the currently active one.
+func NewSyncer(cfg config.GitOpsConfig, base func() *config.Config, applier Applier, recorder Recorder, logger *logrus.Logger) *Syncer {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		gitPath = "git"
+	}
+
+	return &Syncer{
+		config:   cfg,
+		base:     base,
+		applier:  applier,
+		recorder: recorder,
+		logger:   logger,
+		gitPath:  gitPath,
+		status: SyncStatus{
+			Repository: maskRepository(cfg.Repository),
+			Branch:     cfg.Branch,
+		},
+		trigger:  make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the background sync loop
+func (s *Syncer) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("gitops syncer already running")
+	}
+	s.running = true
+	s.status.Running = true
+	s.mu.Unlock()
+
+	s.logger.WithFields(logrus.Fields{
+		"repository": maskRepository(s.config.Repository),
+		"branch":     s.config.Branch,
+		"interval":   s.config.Interval,
+	}).Info("Starting GitOps syncer")
+
+	s.wg.Add(1)
+	go s.syncLoop(ctx)
+
+	return nil
+}
+
+// Stop stops the background sync loop
+func (s *Syncer) Stop() error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("gitops syncer not running")
+	}
+	s.running = false
+	s.status.Running = false
+	s.mu.Unlock()
+
+	s.logger.Info("Stopping GitOps syncer")
+	close(s.stopChan)
+	s.wg.Wait()
+
+	return nil
+}
+
+// IsRunning reports whether the background loop is active
+func (s *Syncer) IsRunning() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.running
+}
+
+// Trigger requests an asynchronous sync, e.g. from a push webhook.
+// Requests arriving while one is pending are coalesced.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the current sync status
+func (s *Syncer) Status() SyncStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// VerifySignature validates a GitHub-style "sha256=<hex>" HMAC signature of a webhook payload
+func (s *Syncer) VerifySignature(payload []byte, signature string) bool {
+	if s.config.WebhookSecret == "" {
+		return false
+	}
+
+	signature = strings.TrimPrefix(signature, "sha256=")
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.config.WebhookSecret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// VerifyToken validates a shared-secret token (GitLab X-Gitlab-Token style)
+func (s *Syncer) VerifyToken(token string) bool {
+	if s.config.WebhookSecret == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(s.config.WebhookSecret))
+}
+
+// syncLoop runs the periodic and webhook-triggered syncs
+func (s *Syncer) syncLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	var tick <-chan time.Time
+	if s.config.Interval > 0 {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	s.runSync(ctx, "initial")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-tick:
+			s.runSync(ctx, "scheduled")
+		case <-s.trigger:
+			s.runSync(ctx, "webhook")
+		}
+	}
+}
+
+func (s *Syncer) runSync(ctx context.Context, reason string) {
+	result, err := s.Sync(ctx)
+	if err != nil {
+		s.logger.WithError(err).WithField("trigger", reason).Error("GitOps sync failed")
+		return
+	}
+	s.logger.WithFields(logrus.Fields{
+		"trigger": reason,
+		"commit":  result.CommitSHA,
+		"applied": result.Applied,
+	}).Debug(result.Message)
+}
+
+// Sync fetches the repository and applies the configuration if the commit changed
+func (s *Syncer) Sync(ctx context.Context) (*SyncResult, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	result, err := s.sync(ctx)
+
+	s.mu.Lock()
+	s.status.LastSync = time.Now()
+	s.status.SyncCount++
+	if err != nil {
+		s.status.LastError = err.Error()
+	} else {
+		s.status.LastError = ""
+		if result.Applied {
+			s.status.AppliedSHA = result.CommitSHA
+			s.status.LastApplied = time.Now()
+			s.status.AppliedCount++
+		}
+	}
+	s.mu.Unlock()
+
+	return result, err
+}
+
+func (s *Syncer) sync(ctx context.Context) (*SyncResult, error) {
+	if err := s.checkout(ctx); err != nil {
+		return nil, err
+	}
+
+	sha, err := s.git(ctx, s.config.Directory, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{CommitSHA: sha}
+
+	s.mu.RLock()
+	applied := s.status.AppliedSHA
+	s.mu.RUnlock()
+	if sha == applied {
+		result.Message = "configuration already at latest commit"
+		return result, nil
+	}
+
+	dir := filepath.Join(s.config.Directory, s.config.Path)
+	cfg, files, err := LoadDirectory(dir, s.base())
+	if err != nil {
+		return nil, fmt.Errorf("commit %s: %w", shortSHA(sha), err)
+	}
+	result.Files = files
+	result.Services = len(cfg.Services)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("commit %s: no declarative configuration found in %s", shortSHA(sha), s.config.Path)
+	}
+
+	if err := config.Validate(cfg); err != nil {
+		return nil, fmt.Errorf("commit %s: validation failed: %w", shortSHA(sha), err)
+	}
+
+	if err := s.applier.ApplyConfig(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("commit %s: failed to apply configuration: %w", shortSHA(sha), err)
+	}
+
+	if s.recorder != nil {
+		if err := s.recorder.RecordCommit(ctx, cfg, sha, Source); err != nil {
+			s.logger.WithError(err).Warn("Failed to record applied GitOps commit")
+		}
+	}
+
+	result.Applied = true
+	result.Message = fmt.Sprintf("applied commit %s (%d files)", shortSHA(sha), len(files))
+
+	s.logger.WithFields(logrus.Fields{
+		"commit":   sha,
+		"files":    files,
+		"services": result.Services,
+	}).Info("GitOps configuration applied")
+
+	return result, nil
+}
+
+// checkout clones the repository on first use and hard-resets it to the remote branch afterwards
+func (s *Syncer) checkout(ctx context.Context) error {
+	dir := s.config.Directory
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return fmt.Errorf("failed to create checkout directory: %w", err)
+		}
+		_, err := s.git(ctx, "", "clone", "--depth", "1", "--branch", s.config.Branch, "--single-branch", s.remoteURL(), dir)
+		return err
+	}
+
+	if _, err := s.git(ctx, dir, "fetch", "--depth", "1", s.remoteURL(), s.config.Branch); err != nil {
+		return err
+	}
+	_, err := s.git(ctx, dir, "reset", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// git runs a git command and returns its trimmed stdout
+func (s *Syncer) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, s.gitPath, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if s.config.SSHKeyFile != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", s.config.SSHKeyFile))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if s.config.Token != "" {
+			msg = strings.ReplaceAll(msg, s.config.Token, "****")
+		}
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, msg)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// remoteURL returns the repository URL with HTTPS credentials applied
+func (s *Syncer) remoteURL() string {
+	if s.config.Token == "" {
+		return s.config.Repository
+	}
+
+	u, err := url.Parse(s.config.Repository)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return s.config.Repository
+	}
+
+	username := s.config.Username
+	if username == "" {
+		username = "git"
+	}
+	u.User = url.UserPassword(username, s.config.Token)
+	return u.String()
+}
+
+// maskRepository strips credentials from a repository URL
+func maskRepository(repo string) string {
+	u, err := url.Parse(repo)
+	if err != nil || u.User == nil {
+		return repo
+	}
+	u.User = nil
+	return u.String()
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
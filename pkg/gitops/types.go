@@ -0,0 +1,48 @@
+package gitops
+
+import (
+	"context"
+	"time"
+
+	"odin/pkg/config"
+)
+
+// Applier applies a validated configuration to the running gateway
+type Applier interface {
+	ApplyConfig(ctx context.Context, cfg *config.Config) error
+}
+
+// ApplierFunc adapts a function to the Applier interface
+type ApplierFunc func(ctx context.Context, cfg *config.Config) error
+
+// ApplyConfig calls f(ctx, cfg)
+func (f ApplierFunc) ApplyConfig(ctx context.Context, cfg *config.Config) error {
+	return f(ctx, cfg)
+}
+
+// Recorder persists the commit a configuration was applied from
+type Recorder interface {
+	RecordCommit(ctx context.Context, cfg *config.Config, commitSHA, source string) error
+}
+
+// SyncStatus describes the outcome of the last sync
+type SyncStatus struct {
+	Running      bool      `json:"running"`
+	Repository   string    `json:"repository"`
+	Branch       string    `json:"branch"`
+	AppliedSHA   string    `json:"appliedSha,omitempty"`
+	LastSync     time.Time `json:"lastSync,omitempty"`
+	LastApplied  time.Time `json:"lastApplied,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+	SyncCount    int64     `json:"syncCount"`
+	AppliedCount int64     `json:"appliedCount"`
+}
+
+// SyncResult describes a single sync run
+type SyncResult struct {
+	CommitSHA string   `json:"commitSha"`
+	Applied   bool     `json:"applied"`
+	Files     []string `json:"files,omitempty"`
+	Services  int      `json:"services"`
+	Message   string   `json:"message"`
+}
@@ -0,0 +1,648 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FederationConfig merges the schemas of several GraphQL services into one.
+// Root fields are sent to the service defining them and links add fields to
+// types, resolved by a root query of another service.
+type FederationConfig struct {
+	Subgraphs []Subgraph `yaml:"subgraphs"`
+	Links     []Link     `yaml:"links,omitempty"`
+}
+
+// Subgraph is a GraphQL service whose schema is merged
+type Subgraph struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// Link adds a field to a type, resolved by a root query field of a service
+// with arguments taken from fields of the type
+type Link struct {
+	Type      string            `yaml:"type"`      // Type the field is added to, e.g. Order
+	Field     string            `yaml:"field"`     // Name of the added field, e.g. customer
+	Subgraph  string            `yaml:"subgraph"`  // Service resolving the field
+	Query     string            `yaml:"query"`     // Root query field of the service, e.g. user
+	Arguments map[string]string `yaml:"arguments"` // Query argument -> field of the type, e.g. id: customerId
+}
+
+// linkPrefix starts the aliases of the fields the gateway adds to queries to
+// resolve links; they are removed from responses
+const linkPrefix = "_odin_"
+
+// Federation executes requests against the merged schema of its services.
+// The schema is introspected on the first request.
+type Federation struct {
+	config *FederationConfig
+	client *http.Client
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	schema *federatedSchema
+}
+
+// NewFederation creates a federation of the configured services
+func NewFederation(config *FederationConfig, client *http.Client, logger *logrus.Logger) *Federation {
+	return &Federation{config: config, client: client, logger: logger}
+}
+
+// requestError is an invalid request, answered with 400 Bad Request
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return e.err.Error() }
+
+// loadSchema returns the merged schema, introspecting the services if it was
+// not loaded yet
+func (f *Federation) loadSchema(ctx context.Context) (*federatedSchema, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.schema != nil {
+		return f.schema, nil
+	}
+
+	schemas := make([]subgraphSchema, len(f.config.Subgraphs))
+	errs := make([]error, len(f.config.Subgraphs))
+	var wg sync.WaitGroup
+	for i, subgraph := range f.config.Subgraphs {
+		wg.Add(1)
+		go func(i int, subgraph Subgraph) {
+			defer wg.Done()
+			schema, err := f.fetchSchema(ctx, subgraph)
+			if err != nil {
+				errs[i] = fmt.Errorf("subgraph %s: %w", subgraph.Name, err)
+			}
+			schemas[i] = subgraphSchema{subgraph: subgraph, schema: schema}
+		}(i, subgraph)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schema, err := mergeSchemas(schemas, f.config.Links)
+	if err != nil {
+		return nil, err
+	}
+	f.schema = schema
+	f.logger.WithField("subgraphs", len(schemas)).Info("GraphQL federated schema loaded")
+	return schema, nil
+}
+
+// plan is what the gateway does with the result of a selection set sent to
+// a service: the links it resolves and the fields whose selections hold links
+type plan struct {
+	links  []*linkSelection
+	fields map[string]*plan
+}
+
+// linkSelection is a link field of a query
+type linkSelection struct {
+	key   string // Response key of the field
+	link  *resolvedLink
+	field *field
+	args  map[string]string // Query argument -> response key of the field it is taken from
+}
+
+func (p *plan) empty() bool {
+	return p == nil || (len(p.links) == 0 && len(p.fields) == 0)
+}
+
+func (p *plan) merge(other *plan) {
+	for _, ls := range other.links {
+		p.addLink(ls)
+	}
+	for key, child := range other.fields {
+		p.addField(key, child)
+	}
+}
+
+// addLink adds ls, merging the selections of a link field selected twice
+func (p *plan) addLink(ls *linkSelection) {
+	for _, existing := range p.links {
+		if existing.key == ls.key && existing.link == ls.link {
+			merged := *existing.field
+			merged.selections = append(append([]selection(nil), existing.field.selections...), ls.field.selections...)
+			existing.field = &merged
+			return
+		}
+	}
+	p.links = append(p.links, ls)
+}
+
+func (p *plan) addField(key string, child *plan) {
+	if p.fields == nil {
+		p.fields = make(map[string]*plan)
+	}
+	if existing, ok := p.fields[key]; ok {
+		existing.merge(child)
+		return
+	}
+	p.fields[key] = child
+}
+
+// prepare removes the link fields from selections of typeName, adding the
+// fields their arguments are taken from, and returns what to do with the
+// result
+func (s *federatedSchema) prepare(selections []selection, typeName string, vars map[string]interface{}) ([]selection, *plan) {
+	p := &plan{}
+	var out []selection
+	injected := make(map[string]bool)
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if link, ok := s.links[typeName][sel.name]; ok {
+				if !included(sel.directives, vars) {
+					continue
+				}
+				ls := &linkSelection{key: sel.key(), link: link, field: sel, args: make(map[string]string)}
+				for arg, source := range link.Arguments {
+					alias := linkPrefix + typeName + "_" + source
+					ls.args[arg] = alias
+					if !injected[alias] {
+						injected[alias] = true
+						out = append(out, &field{alias: alias, name: source})
+					}
+				}
+				p.addLink(ls)
+				continue
+			}
+			fieldType, ok := s.fieldType(typeName, sel.name)
+			if !ok || len(sel.selections) == 0 {
+				out = append(out, sel)
+				continue
+			}
+			children, child := s.prepare(sel.selections, fieldType, vars)
+			prepared := *sel
+			prepared.selections = children
+			out = append(out, &prepared)
+			if !child.empty() {
+				p.addField(sel.key(), child)
+			}
+		case *inlineFragment:
+			fragmentType := typeName
+			if sel.typeCondition != "" {
+				fragmentType = sel.typeCondition
+			}
+			children, child := s.prepare(sel.selections, fragmentType, vars)
+			prepared := *sel
+			prepared.selections = children
+			out = append(out, &prepared)
+			p.merge(child)
+		default:
+			out = append(out, sel)
+		}
+	}
+	return out, p
+}
+
+// site is an object of a result whose link field is to be resolved
+type site struct {
+	object map[string]interface{}
+	link   *linkSelection
+	args   map[string]interface{}
+	path   []interface{}
+}
+
+// collect finds the link fields to resolve in the result of a prepared
+// selection set, and removes the fields added for them
+func collect(data interface{}, p *plan, path []interface{}, sites *[]*site) {
+	switch data := data.(type) {
+	case []interface{}:
+		for i, item := range data {
+			collect(item, p, appendPath(path, i), sites)
+		}
+	case map[string]interface{}:
+		for _, ls := range p.links {
+			args := make(map[string]interface{}, len(ls.args))
+			applies, null := true, false
+			for arg, key := range ls.args {
+				v, ok := data[key]
+				if !ok {
+					applies = false
+					break
+				}
+				null = null || v == nil
+				args[arg] = v
+			}
+			if !applies {
+				continue
+			}
+			if null {
+				data[ls.key] = nil
+				continue
+			}
+			*sites = append(*sites, &site{object: data, link: ls, args: args, path: appendPath(path, ls.key)})
+		}
+		for _, ls := range p.links {
+			for _, key := range ls.args {
+				delete(data, key)
+			}
+		}
+		for key, child := range p.fields {
+			collect(data[key], child, appendPath(path, key), sites)
+		}
+	}
+}
+
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(path)+1), path...), elem)
+}
+
+// execute runs a request against the services of the federation
+func (f *Federation) execute(ctx context.Context, req *GraphQLRequest) (*GraphQLResponse, error) {
+	schema, err := f.loadSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parse(req.Query)
+	if err != nil {
+		return nil, &requestError{err}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return nil, &requestError{err}
+	}
+	rootType, ok := schema.rootTypes[op.kind]
+	if !ok {
+		return nil, &requestError{fmt.Errorf("%s operations are not supported", op.kind)}
+	}
+	vars := make(map[string]interface{}, len(req.Variables))
+	for name, v := range req.Variables {
+		vars[name] = v
+	}
+	for _, def := range op.variables {
+		if _, ok := vars[def.name]; !ok && def.defaultValue != nil {
+			vars[def.name] = def.defaultValue.resolve(nil)
+		}
+	}
+	selections, err := inlineFragments(op.selections, doc, nil)
+	if err != nil {
+		return nil, &requestError{err}
+	}
+
+	// Root fields go to their services in one request per service, or per
+	// run of fields of the same service for mutations, which run in order
+	e := &execution{ctx: ctx, federation: f, schema: schema, op: op, vars: vars, data: make(map[string]interface{})}
+	var groups []*subrequest
+	for _, root := range rootFields(selections, vars) {
+		switch root.name {
+		case "__typename":
+			e.data[root.key()] = rootType
+			continue
+		case "__schema", "__type":
+			mergeValue(e.data, root.key(), schema.introspect(root, vars))
+			continue
+		}
+		owner, ok := schema.owners[op.kind][root.name]
+		if !ok {
+			return nil, &requestError{fmt.Errorf("cannot query field %q on type %q", root.name, rootType)}
+		}
+		var group *subrequest
+		for _, g := range groups {
+			if g.subgraph == owner && (op.kind == "query" || g == groups[len(groups)-1]) {
+				group = g
+			}
+		}
+		if group == nil {
+			group = &subrequest{subgraph: owner}
+			groups = append(groups, group)
+		}
+		group.fields = append(group.fields, root)
+	}
+
+	var sites []*site
+	for _, group := range groups {
+		selections := make([]selection, len(group.fields))
+		for i, root := range group.fields {
+			selections[i] = root
+		}
+		var p *plan
+		group.selections, p = schema.prepare(selections, rootType, vars)
+		group.apply = func(data map[string]interface{}, errs []GraphQLError) {
+			if data == nil {
+				for _, root := range group.fields {
+					e.data[root.key()] = nil
+				}
+			}
+			collect(data, p, nil, &sites)
+			for key, v := range data {
+				mergeValue(e.data, key, v)
+			}
+			e.errors = append(e.errors, errs...)
+		}
+	}
+	if op.kind == "mutation" {
+		for _, group := range groups {
+			e.run([]*subrequest{group})
+		}
+	} else {
+		e.run(groups)
+	}
+
+	// Links are resolved level by level, in one request per service
+	for len(sites) > 0 {
+		sites = e.resolveLinks(sites)
+	}
+
+	return &GraphQLResponse{Data: e.data, Errors: e.errors}, nil
+}
+
+// execution is the state of a request being executed
+type execution struct {
+	ctx        context.Context
+	federation *Federation
+	schema     *federatedSchema
+	op         *operation
+	vars       map[string]interface{}
+	data       map[string]interface{}
+	errors     []GraphQLError
+}
+
+// subrequest is the part of a request one service executes
+type subrequest struct {
+	subgraph   string
+	kind       string
+	fields     []*field
+	selections []selection
+	variables  []*variableDefinition // Added to the operation's
+	values     map[string]interface{}
+	apply      func(data map[string]interface{}, errs []GraphQLError)
+}
+
+// run sends subrequests to their services in parallel and applies their
+// results in order
+func (e *execution) run(subrequests []*subrequest) {
+	type result struct {
+		data map[string]interface{}
+		errs []GraphQLError
+	}
+	results := make([]result, len(subrequests))
+	var wg sync.WaitGroup
+	for i, sub := range subrequests {
+		wg.Add(1)
+		go func(i int, sub *subrequest) {
+			defer wg.Done()
+			results[i].data, results[i].errs = e.send(sub)
+		}(i, sub)
+	}
+	wg.Wait()
+	for i, sub := range subrequests {
+		sub.apply(results[i].data, results[i].errs)
+	}
+}
+
+// send sends a subrequest with the variables of the operation it uses
+func (e *execution) send(sub *subrequest) (map[string]interface{}, []GraphQLError) {
+	kind := sub.kind
+	if kind == "" {
+		kind = e.op.kind
+	}
+	used := make(map[string]bool)
+	usedVariables(sub.selections, used)
+	op := &operation{kind: kind, name: e.op.name, selections: sub.selections}
+	values := make(map[string]interface{})
+	for _, def := range e.op.variables {
+		if used[def.name] {
+			op.variables = append(op.variables, def)
+			if v, ok := e.vars[def.name]; ok {
+				values[def.name] = v
+			}
+		}
+	}
+	op.variables = append(op.variables, sub.variables...)
+	for name, v := range sub.values {
+		values[name] = v
+	}
+
+	subgraph := e.schema.subgraphs[sub.subgraph]
+	req := &GraphQLRequest{Query: op.print(), OperationName: op.name}
+	if len(values) > 0 {
+		req.Variables = values
+	}
+	resp, err := postGraphQL(e.ctx, e.federation.client, subgraph.URL, req)
+	if err != nil {
+		e.federation.logger.WithError(err).WithField("subgraph", subgraph.Name).Error("Failed to query GraphQL subgraph")
+		return nil, []GraphQLError{{Message: fmt.Sprintf("subgraph %s is unavailable", subgraph.Name)}}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	return data, resp.Errors
+}
+
+// resolveLinks resolves the link fields of sites, batching the queries of
+// each service into one request, and returns the sites their results hold
+func (e *execution) resolveLinks(sites []*site) []*site {
+	type entry struct {
+		alias string
+		sites []*site
+		plan  *plan
+	}
+	var subrequests []*subrequest
+	bySubgraph := make(map[string]*subrequest)
+	entries := make(map[*subrequest][]*entry)
+	keys := make(map[string]*entry)
+
+	for _, st := range sites {
+		link := st.link.link
+		// Sites asking the same query of the same object share its result
+		key, _ := json.Marshal([]interface{}{link.Type, link.Field, st.args, (&operation{kind: "query", selections: st.link.field.selections}).print()})
+		if existing, ok := keys[string(key)]; ok {
+			existing.sites = append(existing.sites, st)
+			continue
+		}
+
+		sub, ok := bySubgraph[link.Subgraph]
+		if !ok {
+			sub = &subrequest{subgraph: link.Subgraph, kind: "query", values: make(map[string]interface{})}
+			bySubgraph[link.Subgraph] = sub
+			subrequests = append(subrequests, sub)
+		}
+		alias := "_" + strconv.Itoa(len(sub.fields))
+		query := &field{alias: alias, name: link.Query}
+		names := make([]string, 0, len(st.args))
+		for arg := range st.args {
+			names = append(names, arg)
+		}
+		sort.Strings(names)
+		for _, arg := range names {
+			variable := alias + "_" + arg
+			query.arguments = append(query.arguments, &argument{name: arg, value: &value{kind: variableValue, raw: variable}})
+			sub.variables = append(sub.variables, &variableDefinition{name: variable, typ: link.argTypes[arg]})
+			sub.values[variable] = st.args[arg]
+		}
+		var p *plan
+		query.selections, p = e.schema.prepare(st.link.field.selections, link.typ.named(), e.vars)
+		sub.fields = append(sub.fields, query)
+		sub.selections = append(sub.selections, query)
+
+		ent := &entry{alias: alias, sites: []*site{st}, plan: p}
+		keys[string(key)] = ent
+		entries[sub] = append(entries[sub], ent)
+	}
+
+	var next []*site
+	for _, sub := range subrequests {
+		sub.apply = func(data map[string]interface{}, errs []GraphQLError) {
+			byAlias := make(map[string]*entry)
+			for _, ent := range entries[sub] {
+				byAlias[ent.alias] = ent
+				result := data[ent.alias]
+				for _, st := range ent.sites {
+					st.object[st.link.key] = result
+				}
+				collect(result, ent.plan, ent.sites[0].path, &next)
+			}
+			for _, gqlErr := range errs {
+				if len(gqlErr.Path) > 0 {
+					if alias, ok := gqlErr.Path[0].(string); ok && byAlias[alias] != nil {
+						gqlErr.Path = append(append([]interface{}(nil), byAlias[alias].sites[0].path...), gqlErr.Path[1:]...)
+					}
+				} else if data == nil {
+					for _, ent := range entries[sub] {
+						for _, st := range ent.sites {
+							e.errors = append(e.errors, GraphQLError{Message: gqlErr.Message, Path: st.path, Extensions: gqlErr.Extensions})
+						}
+					}
+					continue
+				}
+				e.errors = append(e.errors, gqlErr)
+			}
+		}
+	}
+	e.run(subrequests)
+	return next
+}
+
+// inlineFragments replaces fragment spreads by inline fragments, so that
+// selections can be split without the fragments they use
+func inlineFragments(selections []selection, doc *document, visiting map[string]bool) ([]selection, error) {
+	out := make([]selection, 0, len(selections))
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if len(sel.selections) == 0 {
+				out = append(out, sel)
+				continue
+			}
+			children, err := inlineFragments(sel.selections, doc, visiting)
+			if err != nil {
+				return nil, err
+			}
+			inlined := *sel
+			inlined.selections = children
+			out = append(out, &inlined)
+		case *inlineFragment:
+			children, err := inlineFragments(sel.selections, doc, visiting)
+			if err != nil {
+				return nil, err
+			}
+			inlined := *sel
+			inlined.selections = children
+			out = append(out, &inlined)
+		case *fragmentSpread:
+			fragment, ok := doc.fragments[sel.name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %s", sel.name)
+			}
+			if visiting[sel.name] {
+				return nil, fmt.Errorf("fragment %s spreads itself", sel.name)
+			}
+			nested := map[string]bool{sel.name: true}
+			for name := range visiting {
+				nested[name] = true
+			}
+			children, err := inlineFragments(fragment.selections, doc, nested)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, &inlineFragment{typeCondition: fragment.typeCondition, directives: sel.directives, selections: children})
+		}
+	}
+	return out, nil
+}
+
+// rootFields returns the fields of the root selection set that are included
+func rootFields(selections []selection, vars map[string]interface{}) []*field {
+	var fields []*field
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if included(sel.directives, vars) {
+				fields = append(fields, sel)
+			}
+		case *inlineFragment:
+			if included(sel.directives, vars) {
+				fields = append(fields, rootFields(sel.selections, vars)...)
+			}
+		}
+	}
+	return fields
+}
+
+// included evaluates the @skip and @include directives
+func included(directives []*directive, vars map[string]interface{}) bool {
+	for _, d := range directives {
+		for _, arg := range d.arguments {
+			if arg.name != "if" {
+				continue
+			}
+			condition := arg.value.resolve(vars) == true
+			if (d.name == "skip" && condition) || (d.name == "include" && !condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// usedVariables adds the variables selections refer to to used
+func usedVariables(selections []selection, used map[string]bool) {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			for _, arg := range sel.arguments {
+				valueVariables(arg.value, used)
+			}
+			directiveVariables(sel.directives, used)
+			usedVariables(sel.selections, used)
+		case *inlineFragment:
+			directiveVariables(sel.directives, used)
+			usedVariables(sel.selections, used)
+		}
+	}
+}
+
+func directiveVariables(directives []*directive, used map[string]bool) {
+	for _, d := range directives {
+		for _, arg := range d.arguments {
+			valueVariables(arg.value, used)
+		}
+	}
+}
+
+func valueVariables(v *value, used map[string]bool) {
+	switch v.kind {
+	case variableValue:
+		used[v.raw] = true
+	case listValue:
+		for _, item := range v.list {
+			valueVariables(item, used)
+		}
+	case objectValue:
+		for _, f := range v.fields {
+			valueVariables(f.value, used)
+		}
+	}
+}
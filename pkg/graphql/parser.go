@@ -0,0 +1,848 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is a parsed executable GraphQL document: the operations and
+// fragments of a request. Federation parses requests to split them between
+// services and prints the parts each service gets.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragmentDefinition
+}
+
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []*variableDefinition
+	directives []*directive
+	selections []selection
+}
+
+type variableDefinition struct {
+	name         string
+	typ          string // As written, e.g. [ID!]!
+	defaultValue *value
+}
+
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+}
+
+// key is the name of the field in the response
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+}
+
+type fragmentDefinition struct {
+	name          string
+	typeCondition string
+	selections    []selection
+}
+
+type argument struct {
+	name  string
+	value *value
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+}
+
+type valueKind int
+
+const (
+	variableValue valueKind = iota
+	intValue
+	floatValue
+	stringValue
+	booleanValue
+	nullValue
+	enumValue
+	listValue
+	objectValue
+)
+
+type value struct {
+	kind   valueKind
+	raw    string      // Variable name, literal or decoded string
+	list   []*value    // Items of lists
+	fields []*argument // Fields of objects
+}
+
+// resolve returns the value as JSON would decode it, with variables
+// replaced by their values
+func (v *value) resolve(vars map[string]interface{}) interface{} {
+	switch v.kind {
+	case variableValue:
+		return vars[v.raw]
+	case intValue, floatValue:
+		n, _ := strconv.ParseFloat(v.raw, 64)
+		return n
+	case stringValue, enumValue:
+		return v.raw
+	case booleanValue:
+		return v.raw == "true"
+	case listValue:
+		items := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			items[i] = item.resolve(vars)
+		}
+		return items
+	case objectValue:
+		fields := make(map[string]interface{}, len(v.fields))
+		for _, f := range v.fields {
+			fields[f.name] = f.value.resolve(vars)
+		}
+		return fields
+	}
+	return nil
+}
+
+// operation returns the operation named name, or the only one
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) != 1 {
+			return nil, fmt.Errorf("operationName is required for documents with several operations")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind tokenKind
+	text string // Punctuator, name, number or decoded string
+	pos  int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// parse parses an executable document
+func parse(src string) (*document, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: make(map[string]*fragmentDefinition)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.is(tokenPunctuator, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections})
+		case p.is(tokenName, "query"), p.is(tokenName, "mutation"), p.is(tokenName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.is(tokenName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[fragment.name]; ok {
+				return nil, fmt.Errorf("fragment %s is defined twice", fragment.name)
+			}
+			doc.fragments[fragment.name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error at offset %d: unexpected %q", p.tok.pos, p.tok.text)
+}
+
+// expect consumes the punctuator text
+func (p *parser) expect(text string) error {
+	if !p.is(tokenPunctuator, text) {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.tok.text}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.tok.kind == tokenName {
+		if op.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is(tokenPunctuator, "(") {
+		if op.variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*variableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var definitions []*variableDefinition
+	for !p.is(tokenPunctuator, ")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		definition := &variableDefinition{name: name}
+		if definition.typ, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if p.is(tokenPunctuator, "=") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if definition.defaultValue, err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.directives(); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, p.next()
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.is(tokenPunctuator, "[") {
+		if err := p.next(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is(tokenPunctuator, "!") {
+		typ += "!"
+		return typ, p.next()
+	}
+	return typ, nil
+}
+
+func (p *parser) fragment() (*fragmentDefinition, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	fragment := &fragmentDefinition{name: name}
+	if fragment.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []selection
+	for !p.is(tokenPunctuator, "}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("syntax error at offset %d: empty selection set", p.tok.pos)
+	}
+	return selections, p.next()
+}
+
+func (p *parser) selection() (selection, error) {
+	if !p.is(tokenPunctuator, "...") {
+		return p.field()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName && p.tok.text != "on" {
+		spread := &fragmentSpread{name: p.tok.text}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		var err error
+		spread.directives, err = p.directives()
+		return spread, err
+	}
+
+	fragment := &inlineFragment{}
+	var err error
+	if p.is(tokenName, "on") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if fragment.typeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if fragment.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *parser) field() (*field, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name}
+	if p.is(tokenPunctuator, ":") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is(tokenPunctuator, "(") {
+		if f.arguments, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.is(tokenPunctuator, "{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) arguments() ([]*argument, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var arguments []*argument
+	for !p.is(tokenPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, &argument{name: name, value: v})
+	}
+	return arguments, p.next()
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	var directives []*directive
+	for p.is(tokenPunctuator, "@") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d := &directive{name: name}
+		if p.is(tokenPunctuator, "(") {
+			if d.arguments, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (p *parser) value() (*value, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokenPunctuator && tok.text == "$":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return &value{kind: variableValue, raw: name}, err
+	case tok.kind == tokenInt:
+		return &value{kind: intValue, raw: tok.text}, p.next()
+	case tok.kind == tokenFloat:
+		return &value{kind: floatValue, raw: tok.text}, p.next()
+	case tok.kind == tokenString:
+		return &value{kind: stringValue, raw: tok.text}, p.next()
+	case tok.kind == tokenName:
+		kind := enumValue
+		switch tok.text {
+		case "true", "false":
+			kind = booleanValue
+		case "null":
+			kind = nullValue
+		}
+		return &value{kind: kind, raw: tok.text}, p.next()
+	case tok.kind == tokenPunctuator && tok.text == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := &value{kind: listValue}
+		for !p.is(tokenPunctuator, "]") {
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list.list = append(list.list, item)
+		}
+		return list, p.next()
+	case tok.kind == tokenPunctuator && tok.text == "{":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		object := &value{kind: objectValue}
+		for !p.is(tokenPunctuator, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			object.fields = append(object.fields, &argument{name: name, value: v})
+		}
+		return object, p.next()
+	}
+	return nil, p.unexpected()
+}
+
+// next reads the next token, skipping whitespace, commas and comments
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			if strings.HasPrefix(p.src[p.pos:], "\uFEFF") {
+				p.pos += len("\uFEFF")
+				continue
+			}
+			break
+		}
+		p.pos++
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunctuator, text: "...", pos: start}
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunctuator, text: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, text: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		return p.number()
+	case c == '"':
+		return p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("syntax error at offset %d: unexpected character %q", start, r)
+	}
+	return nil
+}
+
+func (p *parser) number() error {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return fmt.Errorf("syntax error at offset %d: invalid number", start)
+	}
+	kind := tokenInt
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		kind = tokenFloat
+		if digits() == 0 {
+			return fmt.Errorf("syntax error at offset %d: invalid number", start)
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		kind = tokenFloat
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return fmt.Errorf("syntax error at offset %d: invalid number", start)
+		}
+	}
+	p.tok = token{kind: kind, text: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+func (p *parser) string() error {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := p.pos + 3
+		for {
+			i := strings.Index(p.src[end:], `"""`)
+			if i < 0 {
+				return fmt.Errorf("syntax error at offset %d: unterminated string", start)
+			}
+			end += i
+			if p.src[end-1] != '\\' {
+				break
+			}
+			end += 3
+		}
+		raw := strings.ReplaceAll(p.src[p.pos+3:end], `\"""`, `"""`)
+		p.pos = end + 3
+		p.tok = token{kind: tokenString, text: blockString(raw), pos: start}
+		return nil
+	}
+
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '\r' {
+			return fmt.Errorf("syntax error at offset %d: unterminated string", start)
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			return fmt.Errorf("syntax error at offset %d: unterminated string", start)
+		}
+		escape := p.src[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			sb.WriteByte(escape)
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				return fmt.Errorf("syntax error at offset %d: invalid unicode escape", p.pos)
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				return fmt.Errorf("syntax error at offset %d: invalid unicode escape", p.pos)
+			}
+			sb.WriteRune(rune(r))
+			p.pos += 4
+		default:
+			return fmt.Errorf("syntax error at offset %d: invalid escape \\%c", p.pos-2, escape)
+		}
+	}
+	p.tok = token{kind: tokenString, text: sb.String(), pos: start}
+	return nil
+}
+
+// blockString removes the common indentation and the blank first and last
+// lines of a block string
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// print writes op as a query document
+func (op *operation) print() string {
+	var sb strings.Builder
+	sb.WriteString(op.kind)
+	if op.name != "" {
+		sb.WriteString(" " + op.name)
+	}
+	if len(op.variables) > 0 {
+		sb.WriteString("(")
+		for i, v := range op.variables {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString("$" + v.name + ": " + v.typ)
+			if v.defaultValue != nil {
+				sb.WriteString(" = ")
+				printValue(&sb, v.defaultValue)
+			}
+		}
+		sb.WriteString(")")
+	}
+	printDirectives(&sb, op.directives)
+	sb.WriteString(" ")
+	printSelections(&sb, op.selections)
+	return sb.String()
+}
+
+func printSelections(sb *strings.Builder, selections []selection) {
+	sb.WriteString("{")
+	for i, sel := range selections {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		switch sel := sel.(type) {
+		case *field:
+			if sel.alias != "" {
+				sb.WriteString(sel.alias + ": ")
+			}
+			sb.WriteString(sel.name)
+			printArguments(sb, sel.arguments)
+			printDirectives(sb, sel.directives)
+			if len(sel.selections) > 0 {
+				sb.WriteString(" ")
+				printSelections(sb, sel.selections)
+			}
+		case *inlineFragment:
+			sb.WriteString("...")
+			if sel.typeCondition != "" {
+				sb.WriteString(" on " + sel.typeCondition)
+			}
+			printDirectives(sb, sel.directives)
+			sb.WriteString(" ")
+			printSelections(sb, sel.selections)
+		case *fragmentSpread:
+			sb.WriteString("..." + sel.name)
+			printDirectives(sb, sel.directives)
+		}
+	}
+	sb.WriteString("}")
+}
+
+func printArguments(sb *strings.Builder, arguments []*argument) {
+	if len(arguments) == 0 {
+		return
+	}
+	sb.WriteString("(")
+	for i, arg := range arguments {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(arg.name + ": ")
+		printValue(sb, arg.value)
+	}
+	sb.WriteString(")")
+}
+
+func printDirectives(sb *strings.Builder, directives []*directive) {
+	for _, d := range directives {
+		sb.WriteString(" @" + d.name)
+		printArguments(sb, d.arguments)
+	}
+}
+
+func printValue(sb *strings.Builder, v *value) {
+	switch v.kind {
+	case variableValue:
+		sb.WriteString("$" + v.raw)
+	case stringValue:
+		quoted, _ := json.Marshal(v.raw)
+		sb.Write(quoted)
+	case listValue:
+		sb.WriteString("[")
+		for i, item := range v.list {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			printValue(sb, item)
+		}
+		sb.WriteString("]")
+	case objectValue:
+		sb.WriteString("{")
+		for i, f := range v.fields {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(f.name + ": ")
+			printValue(sb, f.value)
+		}
+		sb.WriteString("}")
+	default:
+		sb.WriteString(v.raw)
+	}
+}
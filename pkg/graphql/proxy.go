@@ -50,13 +50,17 @@ type ProxyConfig struct {
 	Timeout             time.Duration `yaml:"timeout"`
 	EnableQueryCaching  bool          `yaml:"enableQueryCaching"`
 	CacheTTL            time.Duration `yaml:"cacheTTL"`
+	// Federation serves the merged schema of several services instead of
+	// forwarding requests to Endpoint
+	Federation *FederationConfig `yaml:"federation,omitempty"`
 }
 
 // Proxy handles GraphQL requests and forwards them to backend services
 type Proxy struct {
-	config *ProxyConfig
-	logger *logrus.Logger
-	client *http.Client
+	config     *ProxyConfig
+	logger     *logrus.Logger
+	client     *http.Client
+	federation *Federation
 }
 
 // NewProxy creates a new GraphQL proxy
@@ -74,13 +78,17 @@ func NewProxy(config *ProxyConfig, logger *logrus.Logger) *Proxy {
 		config.CacheTTL = 5 * time.Minute
 	}
 
-	return &Proxy{
+	p := &Proxy{
 		config: config,
 		logger: logger,
 		client: &http.Client{
 			Timeout: config.Timeout,
 		},
 	}
+	if config.Federation != nil {
+		p.federation = NewFederation(config.Federation, p.client, logger)
+	}
+	return p
 }
 
 // Handle processes GraphQL requests
@@ -130,6 +138,10 @@ func (p *Proxy) Handle(c echo.Context) error {
 		})
 	}
 
+	if p.federation != nil {
+		return p.handleFederated(c, &req)
+	}
+
 	// Forward request to backend
 	resp, err := p.forwardRequest(c.Request().Context(), &req)
 	if err != nil {
@@ -145,8 +157,34 @@ func (p *Proxy) Handle(c echo.Context) error {
 	return c.JSON(http.StatusOK, resp)
 }
 
+// handleFederated executes the request against the federated services
+func (p *Proxy) handleFederated(c echo.Context, req *GraphQLRequest) error {
+	resp, err := p.federation.execute(c.Request().Context(), req)
+	if rerr, ok := err.(*requestError); ok {
+		return c.JSON(http.StatusBadRequest, GraphQLResponse{
+			Errors: []GraphQLError{{
+				Message: rerr.Error(),
+			}},
+		})
+	}
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to load federated GraphQL schema")
+		return c.JSON(http.StatusBadGateway, GraphQLResponse{
+			Errors: []GraphQLError{{
+				Message: "Failed to load the federated schema",
+			}},
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 // forwardRequest forwards the GraphQL request to the backend service
 func (p *Proxy) forwardRequest(ctx context.Context, req *GraphQLRequest) (*GraphQLResponse, error) {
+	return postGraphQL(ctx, p.client, p.config.Endpoint, req)
+}
+
+// postGraphQL sends a GraphQL request to endpoint
+func postGraphQL(ctx context.Context, client *http.Client, endpoint string, req *GraphQLRequest) (*GraphQLResponse, error) {
 	// Serialize request
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -154,7 +192,7 @@ func (p *Proxy) forwardRequest(ctx context.Context, req *GraphQLRequest) (*Graph
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.Endpoint, bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -163,7 +201,7 @@ func (p *Proxy) forwardRequest(ctx context.Context, req *GraphQLRequest) (*Graph
 	httpReq.Header.Set("Accept", "application/json")
 
 	// Execute request
-	httpResp, err := p.client.Do(httpReq)
+	httpResp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
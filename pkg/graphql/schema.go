@@ -0,0 +1,482 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// introspectionQuery asks a service for its whole schema
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives { name description locations args { ...InputValue } }
+  }
+}
+fragment FullType on __Type {
+  kind name description
+  fields(includeDeprecated: true) { name description args { ...InputValue } type { ...TypeRef } isDeprecated deprecationReason }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) { name description isDeprecated deprecationReason }
+  possibleTypes { ...TypeRef }
+}
+fragment InputValue on __InputValue { name description type { ...TypeRef } defaultValue }
+fragment TypeRef on __Type {
+  kind name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } }
+}`
+
+type introspectionSchema struct {
+	QueryType        *namedType                `json:"queryType"`
+	MutationType     *namedType                `json:"mutationType"`
+	SubscriptionType *namedType                `json:"subscriptionType"`
+	Types            []*introspectionType      `json:"types"`
+	Directives       []*introspectionDirective `json:"directives"`
+}
+
+type namedType struct {
+	Name string `json:"name"`
+}
+
+type introspectionType struct {
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Description   *string                   `json:"description"`
+	Fields        []*introspectionField     `json:"fields"`
+	InputFields   []*introspectionValue     `json:"inputFields"`
+	Interfaces    []*typeRef                `json:"interfaces"`
+	EnumValues    []*introspectionEnumValue `json:"enumValues"`
+	PossibleTypes []*typeRef                `json:"possibleTypes"`
+}
+
+type introspectionField struct {
+	Name              string                `json:"name"`
+	Description       *string               `json:"description"`
+	Args              []*introspectionValue `json:"args"`
+	Type              *typeRef              `json:"type"`
+	IsDeprecated      bool                  `json:"isDeprecated"`
+	DeprecationReason *string               `json:"deprecationReason"`
+}
+
+type introspectionValue struct {
+	Name         string   `json:"name"`
+	Description  *string  `json:"description"`
+	Type         *typeRef `json:"type"`
+	DefaultValue *string  `json:"defaultValue"`
+}
+
+type introspectionEnumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type introspectionDirective struct {
+	Name        string                `json:"name"`
+	Description *string               `json:"description"`
+	Locations   []string              `json:"locations"`
+	Args        []*introspectionValue `json:"args"`
+}
+
+type typeRef struct {
+	Kind   string   `json:"kind"`
+	Name   *string  `json:"name"`
+	OfType *typeRef `json:"ofType"`
+}
+
+// named returns the name of the type t wraps in lists and non-nulls
+func (t *typeRef) named() string {
+	for t.OfType != nil {
+		t = t.OfType
+	}
+	if t.Name == nil {
+		return ""
+	}
+	return *t.Name
+}
+
+// String returns t as GraphQL writes it, e.g. [ID!]!
+func (t *typeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.named()
+}
+
+// subgraphSchema is the schema a federated service describes itself with
+type subgraphSchema struct {
+	subgraph Subgraph
+	schema   *introspectionSchema
+}
+
+// federatedSchema is the schema merged from the services: types of the same
+// name are merged, root fields belong to the service defining them and links
+// add fields resolved by other services
+type federatedSchema struct {
+	introspection map[string]interface{} // __schema, for introspection queries
+	fields        map[string]map[string]*introspectionField
+	rootTypes     map[string]string            // Operation kind -> root type
+	owners        map[string]map[string]string // Operation kind -> root field -> subgraph
+	links         map[string]map[string]*resolvedLink
+	subgraphs     map[string]Subgraph
+}
+
+// resolvedLink is a link checked against the schema of its service
+type resolvedLink struct {
+	Link
+	argTypes map[string]string // Query argument -> type, e.g. ID!
+	typ      *typeRef          // Type the query returns
+}
+
+// fetchSchema introspects the schema of a service
+func (f *Federation) fetchSchema(ctx context.Context, subgraph Subgraph) (*introspectionSchema, error) {
+	resp, err := postGraphQL(ctx, f.client, subgraph.URL, &GraphQLRequest{Query: introspectionQuery})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		return nil, fmt.Errorf("introspection failed: %s", resp.Errors[0].Message)
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Schema *introspectionSchema `json:"__schema"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid introspection result: %w", err)
+	}
+	if result.Schema == nil || result.Schema.QueryType == nil {
+		return nil, fmt.Errorf("introspection returned no schema")
+	}
+	return result.Schema, nil
+}
+
+// mergeSchemas merges the schemas of the services, in order, and adds the
+// links to them
+func mergeSchemas(subgraphs []subgraphSchema, links []Link) (*federatedSchema, error) {
+	merged := &federatedSchema{
+		fields:    make(map[string]map[string]*introspectionField),
+		rootTypes: map[string]string{"query": "Query"},
+		owners:    map[string]map[string]string{"query": {}, "mutation": {}},
+		links:     make(map[string]map[string]*resolvedLink),
+		subgraphs: make(map[string]Subgraph),
+	}
+	types := make(map[string]*introspectionType)
+	var order []string
+	directives := make(map[string]bool)
+	var mergedDirectives []*introspectionDirective
+
+	for _, sub := range subgraphs {
+		merged.subgraphs[sub.subgraph.Name] = sub.subgraph
+		roots := map[string]string{sub.schema.QueryType.Name: "query"}
+		if sub.schema.MutationType != nil {
+			roots[sub.schema.MutationType.Name] = "mutation"
+			merged.rootTypes["mutation"] = "Mutation"
+		}
+		for _, t := range sub.schema.Types {
+			name := t.Name
+			if sub.schema.SubscriptionType != nil && name == sub.schema.SubscriptionType.Name {
+				continue
+			}
+			if kind, ok := roots[name]; ok {
+				name = merged.rootTypes[kind]
+				for _, f := range t.Fields {
+					if owner, ok := merged.owners[kind][f.Name]; ok {
+						return nil, fmt.Errorf("%s field %s is defined by both %s and %s", kind, f.Name, owner, sub.subgraph.Name)
+					}
+					merged.owners[kind][f.Name] = sub.subgraph.Name
+				}
+			}
+
+			existing, ok := types[name]
+			if !ok {
+				copied := *t
+				copied.Name = name
+				copied.Fields = append([]*introspectionField(nil), t.Fields...)
+				types[name] = &copied
+				order = append(order, name)
+				continue
+			}
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+			if existing.Kind != t.Kind {
+				return nil, fmt.Errorf("type %s is a %s in %s but a %s in another service", name, t.Kind, sub.subgraph.Name, existing.Kind)
+			}
+			existing.Fields = mergeByName(existing.Fields, t.Fields, func(f *introspectionField) string { return f.Name })
+			existing.InputFields = mergeByName(existing.InputFields, t.InputFields, func(v *introspectionValue) string { return v.Name })
+			existing.EnumValues = mergeByName(existing.EnumValues, t.EnumValues, func(v *introspectionEnumValue) string { return v.Name })
+			existing.Interfaces = mergeByName(existing.Interfaces, t.Interfaces, (*typeRef).named)
+			existing.PossibleTypes = mergeByName(existing.PossibleTypes, t.PossibleTypes, (*typeRef).named)
+		}
+		for _, d := range sub.schema.Directives {
+			if !directives[d.Name] {
+				directives[d.Name] = true
+				mergedDirectives = append(mergedDirectives, d)
+			}
+		}
+	}
+
+	for _, name := range order {
+		fields := make(map[string]*introspectionField, len(types[name].Fields))
+		for _, f := range types[name].Fields {
+			fields[f.Name] = f
+		}
+		merged.fields[name] = fields
+	}
+	for _, link := range links {
+		resolved, err := resolveLink(link, subgraphs, merged)
+		if err != nil {
+			return nil, fmt.Errorf("link %s.%s: %w", link.Type, link.Field, err)
+		}
+		t := types[link.Type]
+		field := &introspectionField{Name: link.Field, Args: []*introspectionValue{}, Type: resolved.typ}
+		t.Fields = append(t.Fields, field)
+		merged.fields[link.Type][link.Field] = field
+		if merged.links[link.Type] == nil {
+			merged.links[link.Type] = make(map[string]*resolvedLink)
+		}
+		merged.links[link.Type][link.Field] = resolved
+	}
+
+	schema := &introspectionSchema{QueryType: &namedType{Name: "Query"}, Directives: mergedDirectives}
+	if name, ok := merged.rootTypes["mutation"]; ok {
+		schema.MutationType = &namedType{Name: name}
+	}
+	for _, name := range order {
+		schema.Types = append(schema.Types, types[name])
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &merged.introspection); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeByName appends the items of more whose names are not in items
+func mergeByName[T any](items, more []T, name func(T) string) []T {
+	names := make(map[string]bool, len(items))
+	for _, item := range items {
+		names[name(item)] = true
+	}
+	for _, item := range more {
+		if !names[name(item)] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// resolveLink checks a link against the schema of its service and the
+// merged type it adds a field to
+func resolveLink(link Link, subgraphs []subgraphSchema, merged *federatedSchema) (*resolvedLink, error) {
+	var sub *subgraphSchema
+	for i := range subgraphs {
+		if subgraphs[i].subgraph.Name == link.Subgraph {
+			sub = &subgraphs[i]
+		}
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("unknown subgraph %s", link.Subgraph)
+	}
+	var query *introspectionField
+	for _, t := range sub.schema.Types {
+		if t.Name != sub.schema.QueryType.Name {
+			continue
+		}
+		for _, f := range t.Fields {
+			if f.Name == link.Query {
+				query = f
+			}
+		}
+	}
+	if query == nil {
+		return nil, fmt.Errorf("%s has no query field %s", link.Subgraph, link.Query)
+	}
+
+	fields, ok := merged.fields[link.Type]
+	if !ok || link.Type == merged.rootTypes["query"] || link.Type == merged.rootTypes["mutation"] {
+		return nil, fmt.Errorf("unknown type %s", link.Type)
+	}
+	if _, ok := fields[link.Field]; ok {
+		return nil, fmt.Errorf("type %s already has a field %s", link.Type, link.Field)
+	}
+
+	resolved := &resolvedLink{Link: link, argTypes: make(map[string]string), typ: query.Type}
+	for _, arg := range query.Args {
+		source, ok := link.Arguments[arg.Name]
+		if !ok {
+			if arg.Type.Kind == "NON_NULL" && arg.DefaultValue == nil {
+				return nil, fmt.Errorf("required argument %s of %s is not set", arg.Name, link.Query)
+			}
+			continue
+		}
+		if _, ok := fields[source]; !ok {
+			return nil, fmt.Errorf("type %s has no field %s", link.Type, source)
+		}
+		resolved.argTypes[arg.Name] = arg.Type.String()
+	}
+	for name := range link.Arguments {
+		if _, ok := resolved.argTypes[name]; !ok {
+			return nil, fmt.Errorf("%s has no argument %s", link.Query, name)
+		}
+	}
+	return resolved, nil
+}
+
+// fieldType returns the named type of a field of a type of the schema
+func (s *federatedSchema) fieldType(typeName, fieldName string) (string, bool) {
+	f, ok := s.fields[typeName][fieldName]
+	if !ok {
+		return "", false
+	}
+	return f.Type.named(), true
+}
+
+// introspectionTypes are the introspection types fields of the same name
+// hold, for __typename
+var introspectionTypes = map[string]string{
+	"__schema":         "__Schema",
+	"__type":           "__Type",
+	"types":            "__Type",
+	"queryType":        "__Type",
+	"mutationType":     "__Type",
+	"subscriptionType": "__Type",
+	"type":             "__Type",
+	"ofType":           "__Type",
+	"interfaces":       "__Type",
+	"possibleTypes":    "__Type",
+	"fields":           "__Field",
+	"args":             "__InputValue",
+	"inputFields":      "__InputValue",
+	"enumValues":       "__EnumValue",
+	"directives":       "__Directive",
+}
+
+// introspect answers the root introspection field f from the merged schema
+func (s *federatedSchema) introspect(f *field, vars map[string]interface{}) interface{} {
+	if f.name == "__schema" {
+		return project(s.introspection, f.selections, "__Schema", vars)
+	}
+	var name interface{}
+	for _, arg := range f.arguments {
+		if arg.name == "name" {
+			name = arg.value.resolve(vars)
+		}
+	}
+	types, _ := s.introspection["types"].([]interface{})
+	for _, t := range types {
+		if t, ok := t.(map[string]interface{}); ok && t["name"] == name {
+			return project(t, f.selections, "__Type", vars)
+		}
+	}
+	return nil
+}
+
+// project selects the fields of an introspection result a query asks for
+func project(v interface{}, selections []selection, typeName string, vars map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = project(item, selections, typeName, vars)
+		}
+		return items
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for _, sel := range selections {
+			switch sel := sel.(type) {
+			case *field:
+				if !included(sel.directives, vars) {
+					continue
+				}
+				if sel.name == "__typename" {
+					out[sel.key()] = typeName
+					continue
+				}
+				value := v[sel.name]
+				if (sel.name == "fields" || sel.name == "enumValues") && !includeDeprecated(sel, vars) {
+					value = withoutDeprecated(value)
+				}
+				if len(sel.selections) > 0 {
+					value = project(value, sel.selections, introspectionTypes[sel.name], vars)
+				}
+				mergeValue(out, sel.key(), value)
+			case *inlineFragment:
+				if (sel.typeCondition == "" || sel.typeCondition == typeName) && included(sel.directives, vars) {
+					for key, value := range project(v, sel.selections, typeName, vars).(map[string]interface{}) {
+						mergeValue(out, key, value)
+					}
+				}
+			}
+		}
+		return out
+	}
+	return v
+}
+
+func includeDeprecated(f *field, vars map[string]interface{}) bool {
+	for _, arg := range f.arguments {
+		if arg.name == "includeDeprecated" {
+			return arg.value.resolve(vars) == true
+		}
+	}
+	return false
+}
+
+func withoutDeprecated(v interface{}) interface{} {
+	items, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	kept := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); !ok || m["isDeprecated"] != true {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// mergeValue sets key of out to v, merging objects and lists of objects
+// selected more than once
+func mergeValue(out map[string]interface{}, key string, v interface{}) {
+	existing, ok := out[key]
+	if !ok {
+		out[key] = v
+		return
+	}
+	switch existing := existing.(type) {
+	case map[string]interface{}:
+		if v, ok := v.(map[string]interface{}); ok {
+			for k, item := range v {
+				mergeValue(existing, k, item)
+			}
+			return
+		}
+	case []interface{}:
+		if v, ok := v.([]interface{}); ok && len(v) == len(existing) {
+			for i := range existing {
+				wrapper := map[string]interface{}{"": existing[i]}
+				mergeValue(wrapper, "", v[i])
+				existing[i] = wrapper[""]
+			}
+			return
+		}
+	}
+	out[key] = v
+}
@@ -0,0 +1,77 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// errUnknownMethod is returned for methods the descriptors do not describe
+var errUnknownMethod = errors.New("method not found")
+
+// LoadDescriptorSets reads FileDescriptorSet files, as written by
+// protoc --include_imports --descriptor_set_out, into a registry. Files
+// found in several sets are only loaded once.
+func LoadDescriptorSets(paths []string) (*protoregistry.Files, error) {
+	protos, err := loadDescriptorProtos(paths)
+	if err != nil {
+		return nil, err
+	}
+	return newFiles(protos)
+}
+
+// loadDescriptorProtos reads the files of FileDescriptorSet files by name
+func loadDescriptorProtos(paths []string) (map[string]*descriptorpb.FileDescriptorProto, error) {
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(data, set); err != nil {
+			return nil, fmt.Errorf("failed to parse descriptor set %s: %w", path, err)
+		}
+		for _, file := range set.GetFile() {
+			if _, ok := protos[file.GetName()]; !ok {
+				protos[file.GetName()] = file
+			}
+		}
+	}
+	return protos, nil
+}
+
+// newFiles builds a registry of files, which must include their imports
+func newFiles(protos map[string]*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range protos {
+		set.File = append(set.File, file)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor sets: %w", err)
+	}
+	return files, nil
+}
+
+// findMethod looks up a method by its full name, either
+// package.Service/Method or package.Service.Method
+func findMethod(files *protoregistry.Files, name string) (protoreflect.MethodDescriptor, error) {
+	fullName := protoreflect.FullName(strings.ReplaceAll(name, "/", "."))
+	desc, err := files.FindDescriptorByName(fullName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errUnknownMethod, name)
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not a method", errUnknownMethod, name)
+	}
+	return method, nil
+}
@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup runs one call per key at a time. Callers for a key whose
+// call is running wait for its result instead of making their own.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a running call and, once done is closed, its result
+type flight struct {
+	done  chan struct{}
+	found bool
+	err   error
+}
+
+// do runs fn unless a call for key is running, and returns the result of
+// the call. Callers stop waiting when ctx is done; the call goes on.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (bool, error)) (bool, error) {
+	g.mu.Lock()
+	f, running := g.calls[key]
+	if !running {
+		if g.calls == nil {
+			g.calls = make(map[string]*flight)
+		}
+		f = &flight{done: make(chan struct{})}
+		g.calls[key] = f
+	}
+	g.mu.Unlock()
+
+	if !running {
+		go func() {
+			f.found, f.err = fn()
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+
+	select {
+	case <-f.done:
+		return f.found, f.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
@@ -1,13 +1,14 @@
 package grpc
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
@@ -25,14 +26,26 @@ type ProxyConfig struct {
 	EnableTLS        bool          `yaml:"enableTLS"`
 	TLSCertFile      string        `yaml:"tlsCertFile"`
 	TLSKeyFile       string        `yaml:"tlsKeyFile"`
-	EnableReflection bool          `yaml:"enableReflection"`
+	EnableReflection bool          `yaml:"enableReflection"` // Ask the target about methods the descriptor sets lack
+	DescriptorSets   []string      `yaml:"descriptorSets"`   // Describe the methods transcoded
+	Routes           []RESTRoute   `yaml:"routes"`
+	// Service names the proxy in stream metrics
+	Service              string        `yaml:"service"`
+	StreamTimeout        time.Duration `yaml:"streamTimeout"`        // Streams are cut after this long (default: no limit)
+	MaxConcurrentStreams int           `yaml:"maxConcurrentStreams"` // Streams open at once; more are refused (default: no limit)
 }
 
 // Proxy handles gRPC requests and HTTP-gRPC transcoding
 type Proxy struct {
-	config *ProxyConfig
-	logger *logrus.Logger
-	conn   *grpc.ClientConn
+	config   *ProxyConfig
+	logger   *logrus.Logger
+	conn     *grpc.ClientConn
+	resolver *methodResolver
+	routes   []*restEndpoint
+	upgrader websocket.Upgrader
+
+	streamsMu sync.Mutex
+	streams   int
 }
 
 // NewProxy creates a new gRPC proxy
@@ -44,6 +57,14 @@ func NewProxy(config *ProxyConfig, logger *logrus.Logger) (*Proxy, error) {
 		config.MaxMessageSize = 4 * 1024 * 1024 // 4MB default
 	}
 
+	protos, err := loadDescriptorProtos(config.DescriptorSets)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Routes) > 0 && len(protos) == 0 && !config.EnableReflection {
+		return nil, fmt.Errorf("routes require descriptorSets or enableReflection")
+	}
+
 	// Set up gRPC dial options
 	opts := []grpc.DialOption{
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(config.MaxMessageSize)),
@@ -59,10 +80,48 @@ func NewProxy(config *ProxyConfig, logger *logrus.Logger) (*Proxy, error) {
 		return nil, fmt.Errorf("failed to connect to gRPC service: %w", err)
 	}
 
+	var reflectionConn *grpc.ClientConn
+	if config.EnableReflection {
+		reflectionConn = conn
+	}
+	resolver, err := newMethodResolver(protos, reflectionConn, config.Timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Routes are checked against the descriptor sets now; without them, on
+	// their first request, once reflection has described their methods
+	routes := make([]*restEndpoint, 0, len(config.Routes))
+	for _, route := range config.Routes {
+		if route.Method == "" {
+			route.Method = http.MethodPost
+		}
+		endpoint := &restEndpoint{RESTRoute: route}
+		if len(protos) > 0 {
+			method, err := findMethod(resolver.files, route.RPC)
+			if err == nil {
+				endpoint.compiled, err = compileRoute(method, route)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		routes = append(routes, endpoint)
+	}
+
 	return &Proxy{
-		config: config,
-		logger: logger,
-		conn:   conn,
+		config:   config,
+		logger:   logger,
+		conn:     conn,
+		resolver: resolver,
+		routes:   routes,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
 	}, nil
 }
 
@@ -81,76 +140,41 @@ type HTTPRequest struct {
 	Message map[string]interface{} `json:"message"`
 }
 
-// Handle processes HTTP to gRPC transcoding requests
+// Handle transcodes requests to {basePath}/{package.Service}/{Method} to
+// calls of that method, which the descriptor sets or reflection describe.
+// The JSON body and query parameters build the request message.
 func (p *Proxy) Handle(c echo.Context) error {
-	// Extract service and method from path
-	// Expected format: /grpc/{service}/{method}
-	path := c.Request().URL.Path
-	pathParts := strings.Split(strings.TrimPrefix(path, "/"), "/")
-
-	if len(pathParts) < 3 || pathParts[0] != "grpc" {
+	name := strings.Trim(c.Param("*"), "/")
+	if strings.Count(name, "/") != 1 || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid gRPC path format. Expected: /grpc/{service}/{method}",
+			"error": "Invalid gRPC path format. Expected: {basePath}/{package.Service}/{Method}",
 		})
 	}
-
-	serviceName := pathParts[1]
-	methodName := pathParts[2]
-	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
-
-	// Parse request body
-	var reqBody map[string]interface{}
-	if c.Request().Method == http.MethodPost {
-		if err := c.Bind(&reqBody); err != nil {
-			p.logger.WithError(err).Error("Failed to parse request body")
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"error": "Invalid JSON request body",
-			})
-		}
+	if !p.resolver.enabled() {
+		return c.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "gRPC transcoding requires descriptorSets or enableReflection",
+		})
 	}
 
-	// Create gRPC context with timeout
-	ctx, cancel := context.WithTimeout(c.Request().Context(), p.config.Timeout)
-	defer cancel()
-
-	// Convert HTTP headers to gRPC metadata
-	md := p.httpHeadersToMetadata(c.Request().Header)
-	ctx = metadata.NewOutgoingContext(ctx, md)
-
-	// Perform gRPC call using dynamic invocation
-	resp, err := p.invokeGRPCMethod(ctx, fullMethod, reqBody)
-	if err != nil {
-		return p.handleGRPCError(c, err)
+	method, err := p.resolver.find(c.Request().Context(), name)
+	if errors.Is(err, errUnknownMethod) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
 	}
-
-	// Return JSON response
-	return c.JSON(http.StatusOK, resp)
-}
-
-// invokeGRPCMethod performs dynamic gRPC method invocation
-func (p *Proxy) invokeGRPCMethod(ctx context.Context, method string, req map[string]interface{}) (interface{}, error) {
-	// Convert request to JSON bytes for generic handling
-	reqBytes, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		p.logger.WithError(err).WithField("rpc", name).Error("Failed to resolve gRPC method")
+		return c.JSON(http.StatusBadGateway, map[string]string{
+			"error": "Failed to resolve gRPC method",
+		})
 	}
-
-	// Create a generic message holder
-	var resp json.RawMessage
-
-	// Invoke the method using grpc.ClientConn.Invoke
-	err = p.conn.Invoke(ctx, method, reqBytes, &resp)
+	route, err := compileRoute(method, RESTRoute{Method: c.Request().Method, RPC: name})
 	if err != nil {
-		return nil, err
-	}
-
-	// Parse response
-	var result interface{}
-	if err := json.Unmarshal(resp, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
 	}
-
-	return result, nil
+	return p.transcode(c, route)
 }
 
 // httpHeadersToMetadata converts HTTP headers to gRPC metadata
@@ -183,9 +207,13 @@ func (p *Proxy) shouldSkipHeader(header string) bool {
 		"User-Agent",
 		"Accept-Encoding",
 		"Connection",
+		"Upgrade",
 	}
 
 	headerLower := strings.ToLower(header)
+	if strings.HasPrefix(headerLower, "sec-websocket-") {
+		return true
+	}
 	for _, skip := range skipHeaders {
 		if strings.ToLower(skip) == headerLower {
 			return true
@@ -265,6 +293,11 @@ func (p *Proxy) grpcCodeToHTTPStatus(code codes.Code) int {
 
 // RegisterRoutes registers gRPC proxy routes
 func (p *Proxy) RegisterRoutes(e *echo.Echo, basePath string) {
+	// REST routes take precedence over the generic /{service}/{method} form
+	for _, route := range p.routes {
+		e.Add(strings.ToUpper(route.Method), basePath+route.Path, p.restHandler(route))
+	}
+
 	// Handle both GET and POST for different gRPC methods
 	e.POST(basePath+"/*", p.Handle)
 	e.GET(basePath+"/*", p.Handle)
@@ -279,12 +312,3 @@ func (p *Proxy) RegisterRoutes(e *echo.Echo, basePath string) {
 		})
 	})
 }
-
-// StreamHandler handles gRPC streaming (placeholder for future implementation)
-func (p *Proxy) StreamHandler(c echo.Context) error {
-	// This would handle gRPC streaming over WebSockets or Server-Sent Events
-	// For production use, consider implementing proper streaming support
-	return c.JSON(http.StatusNotImplemented, map[string]string{
-		"error": "gRPC streaming not yet implemented",
-	})
-}
@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// reflectionRetry is how long a symbol the target's reflection service did
+// not know is not asked about again
+const reflectionRetry = time.Minute
+
+// maxMissing bounds the symbols remembered as unknown to reflection, since
+// clients choose them
+const maxMissing = 1024
+
+// methodResolver finds methods in descriptor sets and, with reflection, asks
+// the target's server reflection service about the methods they lack
+type methodResolver struct {
+	conn    *grpc.ClientConn // nil without reflection
+	timeout time.Duration
+	flights flightGroup // One reflection request per symbol at a time
+
+	mu      sync.Mutex // Not held while reflection requests run
+	protos  map[string]*descriptorpb.FileDescriptorProto
+	files   *protoregistry.Files
+	missing map[string]time.Time // Symbols reflection did not know, and when
+}
+
+func newMethodResolver(protos map[string]*descriptorpb.FileDescriptorProto, conn *grpc.ClientConn, timeout time.Duration) (*methodResolver, error) {
+	files, err := newFiles(protos)
+	if err != nil {
+		return nil, err
+	}
+	return &methodResolver{
+		conn:    conn,
+		timeout: timeout,
+		protos:  protos,
+		files:   files,
+		missing: make(map[string]time.Time),
+	}, nil
+}
+
+// enabled reports whether the resolver can find any method
+func (r *methodResolver) enabled() bool {
+	return r.conn != nil || len(r.protos) > 0
+}
+
+// find looks up a method by its full name, package.Service/Method
+func (r *methodResolver) find(ctx context.Context, name string) (protoreflect.MethodDescriptor, error) {
+	service := strings.ReplaceAll(name, "/", ".")
+	service = service[:max(strings.LastIndex(service, "."), 0)]
+
+	r.mu.Lock()
+	method, err := findMethod(r.files, name)
+	if err == nil || r.conn == nil {
+		r.mu.Unlock()
+		return method, err
+	}
+	if missed, ok := r.missing[service]; ok {
+		if time.Since(missed) < reflectionRetry {
+			r.mu.Unlock()
+			return nil, err
+		}
+		delete(r.missing, service)
+	}
+	r.mu.Unlock()
+
+	// Requests for the same service share one reflection request, which
+	// outlives the request that started it
+	found, err := r.flights.do(ctx, service, func() (bool, error) {
+		r.mu.Lock()
+		_, err := r.files.FindDescriptorByName(protoreflect.FullName(service))
+		r.mu.Unlock()
+		if err == nil {
+			return true, nil
+		}
+		return r.reflect(context.WithoutCancel(ctx), service)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !found {
+		r.addMissing(service)
+	}
+	return findMethod(r.files, name)
+}
+
+// addMissing remembers that reflection did not know symbol, forgetting
+// expired symbols, or any, to make room. r.mu must be held.
+func (r *methodResolver) addMissing(symbol string) {
+	if len(r.missing) >= maxMissing {
+		for missed, at := range r.missing {
+			if time.Since(at) >= reflectionRetry {
+				delete(r.missing, missed)
+			}
+		}
+	}
+	if len(r.missing) >= maxMissing {
+		for missed := range r.missing {
+			delete(r.missing, missed)
+			break
+		}
+	}
+	r.missing[symbol] = time.Now()
+}
+
+// reflect loads the file defining symbol and its imports from the target's
+// reflection service. It reports false if the service does not know symbol.
+func (r *methodResolver) reflect(ctx context.Context, symbol string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(r.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return false, fmt.Errorf("server reflection: %w", err)
+	}
+	defer stream.CloseSend()
+
+	r.mu.Lock()
+	known := r.protos
+	r.mu.Unlock()
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	for name, file := range known {
+		protos[name] = file
+	}
+	requests := []*reflectionpb.ServerReflectionRequest{{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}}
+	for len(requests) > 0 {
+		if err := stream.Send(requests[0]); err != nil {
+			return false, fmt.Errorf("server reflection: %w", err)
+		}
+		requests = requests[1:]
+		resp, err := stream.Recv()
+		if err != nil {
+			return false, fmt.Errorf("server reflection: %w", err)
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			if _, symbolRequest := resp.GetOriginalRequest().GetMessageRequest().(*reflectionpb.ServerReflectionRequest_FileContainingSymbol); symbolRequest {
+				return false, nil
+			}
+			return false, fmt.Errorf("server reflection: %s", errResp.GetErrorMessage())
+		}
+		for _, data := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, file); err != nil {
+				return false, fmt.Errorf("server reflection: invalid file descriptor: %w", err)
+			}
+			if _, ok := protos[file.GetName()]; ok {
+				continue
+			}
+			protos[file.GetName()] = file
+			for _, dep := range file.GetDependency() {
+				if _, ok := protos[dep]; !ok {
+					requests = append(requests, &reflectionpb.ServerReflectionRequest{
+						MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+					})
+				}
+			}
+		}
+	}
+
+	// Other symbols may have been loaded meanwhile
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, file := range r.protos {
+		protos[name] = file
+	}
+	files, err := newFiles(protos)
+	if err != nil {
+		return false, fmt.Errorf("server reflection: %w", err)
+	}
+	r.protos, r.files = protos, files
+	return true, nil
+}
@@ -0,0 +1,335 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// RESTRoute maps a REST route under the service's base path to a method of
+// the gRPC service. Path parameters and query parameters set the
+// request fields of the same name, the JSON body fills the request message
+// or one of its fields, and the response message is returned as JSON.
+type RESTRoute struct {
+	Method   string `yaml:"method"`             // HTTP method clients use (default: POST)
+	Path     string `yaml:"path"`               // Route relative to basePath, may contain :params
+	RPC      string `yaml:"rpc"`                // Full method name, e.g. users.v1.UserService/GetUser
+	Body     string `yaml:"body,omitempty"`     // Request field the body fills (default: the whole message)
+	Response string `yaml:"response,omitempty"` // Response field returned (default: the whole message)
+}
+
+type restRoute struct {
+	RESTRoute
+	fullMethod string
+	method     protoreflect.MethodDescriptor
+	params     map[string][]protoreflect.FieldDescriptor
+	body       []protoreflect.FieldDescriptor
+	response   []protoreflect.FieldDescriptor
+}
+
+// restEndpoint is a route whose method may only be resolved through server
+// reflection, on its first request
+type restEndpoint struct {
+	RESTRoute
+	mu       sync.Mutex
+	compiled *restRoute
+}
+
+// compileRoute resolves the fields of route against its method
+func compileRoute(method protoreflect.MethodDescriptor, route RESTRoute) (*restRoute, error) {
+	r := &restRoute{
+		RESTRoute:  route,
+		fullMethod: "/" + string(method.Parent().FullName()) + "/" + string(method.Name()),
+		method:     method,
+		params:     make(map[string][]protoreflect.FieldDescriptor),
+	}
+	var err error
+	for _, segment := range strings.Split(route.Path, "/") {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := segment[1:]
+		if r.params[name], err = fieldPath(method.Input(), name); err != nil {
+			return nil, fmt.Errorf("route %s %s: path parameter %w", route.Method, route.Path, err)
+		}
+		if !isScalar(last(r.params[name])) {
+			return nil, fmt.Errorf("route %s %s: path parameter %s is not a scalar field", route.Method, route.Path, name)
+		}
+	}
+	if route.Body != "" && route.Body != "*" {
+		if r.body, err = fieldPath(method.Input(), route.Body); err != nil {
+			return nil, fmt.Errorf("route %s %s: body %w", route.Method, route.Path, err)
+		}
+		if !isMessage(last(r.body)) {
+			return nil, fmt.Errorf("route %s %s: body field %s is not a message", route.Method, route.Path, route.Body)
+		}
+	}
+	if route.Response != "" {
+		if r.response, err = fieldPath(method.Output(), route.Response); err != nil {
+			return nil, fmt.Errorf("route %s %s: response %w", route.Method, route.Path, err)
+		}
+		if !isMessage(last(r.response)) {
+			return nil, fmt.Errorf("route %s %s: response field %s is not a message", route.Method, route.Path, route.Response)
+		}
+	}
+	return r, nil
+}
+
+// compiledRoute returns the compiled route of endpoint, resolving its method
+// the first time
+func (p *Proxy) compiledRoute(ctx context.Context, endpoint *restEndpoint) (*restRoute, error) {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	if endpoint.compiled != nil {
+		return endpoint.compiled, nil
+	}
+	method, err := p.resolver.find(ctx, endpoint.RPC)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.compiled, err = compileRoute(method, endpoint.RESTRoute); err != nil {
+		return nil, err
+	}
+	return endpoint.compiled, nil
+}
+
+// fieldPath resolves a dotted field name, e.g. user.id, below desc. Names
+// are the fields' proto or JSON names.
+func fieldPath(desc protoreflect.MessageDescriptor, name string) ([]protoreflect.FieldDescriptor, error) {
+	var fields []protoreflect.FieldDescriptor
+	for i, part := range strings.Split(name, ".") {
+		if i > 0 {
+			if !isMessage(fields[i-1]) {
+				return nil, fmt.Errorf("%s: %s is not a message", name, fields[i-1].Name())
+			}
+			desc = fields[i-1].Message()
+		}
+		field := desc.Fields().ByName(protoreflect.Name(part))
+		if field == nil {
+			field = desc.Fields().ByJSONName(part)
+		}
+		if field == nil {
+			return nil, fmt.Errorf("%s: no field %s in %s", name, part, desc.FullName())
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func last(fields []protoreflect.FieldDescriptor) protoreflect.FieldDescriptor {
+	return fields[len(fields)-1]
+}
+
+func isMessage(field protoreflect.FieldDescriptor) bool {
+	return field.Message() != nil && !field.IsList() && !field.IsMap()
+}
+
+func isScalar(field protoreflect.FieldDescriptor) bool {
+	return field.Message() == nil && !field.IsList()
+}
+
+// restHandler converts the REST requests of endpoint to calls of its method
+func (p *Proxy) restHandler(endpoint *restEndpoint) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		route, err := p.compiledRoute(c.Request().Context(), endpoint)
+		if err != nil {
+			p.logger.WithError(err).WithField("rpc", endpoint.RPC).Error("Failed to resolve gRPC method of REST route")
+			return c.JSON(http.StatusBadGateway, map[string]string{
+				"error": "Failed to resolve gRPC method",
+			})
+		}
+		return p.transcode(c, route)
+	}
+}
+
+// transcode calls the method of route with the request built from c and
+// answers with the response as JSON
+func (p *Proxy) transcode(c echo.Context, route *restRoute) error {
+	if isStreaming(route.method) {
+		return p.stream(c, route)
+	}
+
+	req, err := route.request(c)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), p.config.Timeout)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, p.httpHeadersToMetadata(c.Request().Header))
+
+	resp := dynamicpb.NewMessage(route.method.Output())
+	if err := p.conn.Invoke(ctx, route.fullMethod, req, resp); err != nil {
+		return p.handleGRPCError(c, err)
+	}
+
+	body, err := route.marshalResponse(resp)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to marshal gRPC response")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Internal server error",
+		})
+	}
+	return c.JSONBlob(http.StatusOK, body)
+}
+
+// request builds the request message from the body first, then the query
+// parameters and finally the path parameters, which take precedence.
+// Query parameters that are not fields of the message are ignored.
+func (r *restRoute) request(c echo.Context) (*dynamicpb.Message, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return r.message(c, body)
+}
+
+// message builds a request message from body and the parameters of c, as
+// request does; streamed requests each get the parameters
+func (r *restRoute) message(c echo.Context, body []byte) (*dynamicpb.Message, error) {
+	req := dynamicpb.NewMessage(r.method.Input())
+	if len(strings.TrimSpace(string(body))) > 0 {
+		target := protoreflect.Message(req)
+		for _, field := range r.body {
+			target = target.Mutable(field).Message()
+		}
+		if err := protojson.Unmarshal(body, target.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+	}
+
+	for name, values := range c.QueryParams() {
+		fields, err := fieldPath(r.method.Input(), name)
+		if err != nil || (!isScalar(last(fields)) && !isScalarList(last(fields))) {
+			continue
+		}
+		if err := setField(req, fields, values); err != nil {
+			return nil, err
+		}
+	}
+	for i, name := range c.ParamNames() {
+		if fields, ok := r.params[name]; ok {
+			if err := setField(req, fields, []string{c.ParamValues()[i]}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return req, nil
+}
+
+func isScalarList(field protoreflect.FieldDescriptor) bool {
+	return field.IsList() && field.Message() == nil
+}
+
+// setField sets the field at the end of fields from string values; lists
+// get all of them, other fields the first
+func setField(msg protoreflect.Message, fields []protoreflect.FieldDescriptor, values []string) error {
+	for _, field := range fields[:len(fields)-1] {
+		msg = msg.Mutable(field).Message()
+	}
+	field := last(fields)
+	if field.IsList() {
+		list := msg.Mutable(field).List()
+		for _, value := range values {
+			v, err := scalarValue(field, value)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+	v, err := scalarValue(field, values[0])
+	if err != nil {
+		return err
+	}
+	msg.Set(field, v)
+	return nil
+}
+
+// scalarValue parses value as the type of field
+func scalarValue(field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	invalid := fmt.Errorf("invalid value %q for field %s", value, field.Name())
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfInt32(int32(n)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfUint32(uint32(n)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfUint64(n), nil
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfFloat32(float32(f)), nil
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			if b, err = base64.URLEncoding.DecodeString(value); err != nil {
+				return protoreflect.Value{}, invalid
+			}
+		}
+		return protoreflect.ValueOfBytes(b), nil
+	case protoreflect.EnumKind:
+		if v := field.Enum().Values().ByName(protoreflect.Name(value)); v != nil {
+			return protoreflect.ValueOfEnum(v.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, invalid
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	}
+	return protoreflect.Value{}, invalid
+}
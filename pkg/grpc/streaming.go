@@ -0,0 +1,356 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Kinds of streaming methods, as labelled in metrics
+const (
+	streamServer = "server_streaming"
+	streamClient = "client_streaming"
+	streamBidi   = "bidi_streaming"
+)
+
+// streamWriteTimeout bounds each message written to a WebSocket client
+const streamWriteTimeout = 10 * time.Second
+
+var (
+	activeStreams = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_grpc_streams",
+			Help: "Currently open gRPC streams",
+		},
+		[]string{"service", "type"},
+	)
+
+	endedStreams = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_grpc_streams_total",
+			Help: "Total number of gRPC streams by the status they ended with",
+		},
+		[]string{"service", "type", "code"},
+	)
+
+	rejectedStreams = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_grpc_streams_rejected_total",
+			Help: "Total number of gRPC streams refused for exceeding maxConcurrentStreams",
+		},
+		[]string{"service"},
+	)
+)
+
+func streamKind(method protoreflect.MethodDescriptor) string {
+	switch {
+	case method.IsStreamingClient() && method.IsStreamingServer():
+		return streamBidi
+	case method.IsStreamingClient():
+		return streamClient
+	default:
+		return streamServer
+	}
+}
+
+func isStreaming(method protoreflect.MethodDescriptor) bool {
+	return method.IsStreamingClient() || method.IsStreamingServer()
+}
+
+// ActiveStreams returns the number of streams the proxy holds open
+func (p *Proxy) ActiveStreams() int {
+	p.streamsMu.Lock()
+	defer p.streamsMu.Unlock()
+	return p.streams
+}
+
+// acquireStream admits a stream of kind under maxConcurrentStreams. The
+// returned function must be called once the stream has ended with err.
+func (p *Proxy) acquireStream(kind string) (func(err error), bool) {
+	p.streamsMu.Lock()
+	defer p.streamsMu.Unlock()
+	if p.config.MaxConcurrentStreams > 0 && p.streams >= p.config.MaxConcurrentStreams {
+		rejectedStreams.WithLabelValues(p.config.Service).Inc()
+		return nil, false
+	}
+	p.streams++
+	activeStreams.WithLabelValues(p.config.Service, kind).Inc()
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			p.streamsMu.Lock()
+			p.streams--
+			p.streamsMu.Unlock()
+			activeStreams.WithLabelValues(p.config.Service, kind).Dec()
+			endedStreams.WithLabelValues(p.config.Service, kind, streamCode(err).String()).Inc()
+		})
+	}, true
+}
+
+// streamCode is the status a stream ended with
+func streamCode(err error) codes.Code {
+	if err == nil || errors.Is(err, io.EOF) {
+		return codes.OK
+	}
+	return status.Code(err)
+}
+
+// streamContext bounds a stream by streamTimeout and passes the request's
+// headers on as metadata
+func (p *Proxy) streamContext(c echo.Context) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if p.config.StreamTimeout > 0 {
+		ctx, cancel = context.WithTimeout(c.Request().Context(), p.config.StreamTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.Request().Context())
+	}
+	return metadata.NewOutgoingContext(ctx, p.httpHeadersToMetadata(c.Request().Header)), cancel
+}
+
+// stream serves a streaming method: server streams as newline-delimited
+// JSON or Server-Sent Events, client and bidirectional streams over a
+// WebSocket connection
+func (p *Proxy) stream(c echo.Context, route *restRoute) error {
+	clientStreams := route.method.IsStreamingClient()
+	if clientStreams && !websocket.IsWebSocketUpgrade(c.Request()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("method %s streams requests and requires a WebSocket connection", route.RPC),
+		})
+	}
+
+	release, ok := p.acquireStream(streamKind(route.method))
+	if !ok {
+		p.logger.WithField("service", p.config.Service).Warn("gRPC stream refused: too many concurrent streams")
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "Too many concurrent streams",
+		})
+	}
+
+	var err error
+	if clientStreams {
+		err = p.streamWebSocket(c, route)
+	} else {
+		err = p.streamResponses(c, route)
+	}
+	release(err)
+	if streamCode(err) != codes.OK {
+		p.logger.WithError(err).WithFields(logrus.Fields{
+			"service": p.config.Service,
+			"rpc":     route.RPC,
+		}).Debug("gRPC stream ended with an error")
+	}
+	return nil
+}
+
+// streamResponses calls a server-streaming method and writes each response
+// as it arrives. Errors before the first response are answered like unary
+// errors; later ones end the stream with an error entry.
+func (p *Proxy) streamResponses(c echo.Context, route *restRoute) error {
+	req, err := route.request(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancel := p.streamContext(c)
+	defer cancel()
+	stream, err := p.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, route.fullMethod)
+	if err == nil {
+		err = stream.SendMsg(req)
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	resp := dynamicpb.NewMessage(route.method.Output())
+	if err == nil {
+		err = stream.RecvMsg(resp)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		p.handleGRPCError(c, err)
+		return err
+	}
+
+	events := acceptsEventStream(c.Request())
+	contentType := "application/x-ndjson"
+	if events {
+		contentType = "text/event-stream"
+	}
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The server's write timeout would end streams too
+	controller := http.NewResponseController(c.Response().Writer)
+	controller.SetWriteDeadline(time.Time{})
+	controller.Flush()
+
+	for err == nil {
+		body, merr := route.marshalResponse(resp)
+		if merr != nil {
+			err = status.Error(codes.Internal, "failed to marshal gRPC response")
+			break
+		}
+		if events {
+			_, err = fmt.Fprintf(c.Response(), "data: %s\n\n", body)
+		} else {
+			_, err = fmt.Fprintf(c.Response(), "%s\n", body)
+		}
+		if err != nil {
+			return status.FromContextError(context.Canceled).Err()
+		}
+		controller.Flush()
+
+		resp = dynamicpb.NewMessage(route.method.Output())
+		err = stream.RecvMsg(resp)
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	st := status.Convert(err)
+	entry, _ := json.Marshal(map[string]string{"error": st.Message(), "code": st.Code().String()})
+	if events {
+		fmt.Fprintf(c.Response(), "event: error\ndata: %s\n\n", entry)
+	} else {
+		fmt.Fprintf(c.Response(), "%s\n", entry)
+	}
+	controller.Flush()
+	return err
+}
+
+// streamWebSocket relays a client or bidirectional stream over a WebSocket
+// connection. Each text message is a request, each response is sent as one,
+// and an empty message ends the client's side of the stream. The connection
+// is closed with the status the call ended with.
+func (p *Proxy) streamWebSocket(c echo.Context, route *restRoute) error {
+	ws, err := p.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	defer ws.Close()
+	ws.SetReadLimit(int64(p.config.MaxMessageSize))
+
+	ctx, cancel := p.streamContext(c)
+	defer cancel()
+	stream, err := p.conn.NewStream(ctx, &grpc.StreamDesc{
+		ServerStreams: route.method.IsStreamingServer(),
+		ClientStreams: true,
+	}, route.fullMethod)
+	if err != nil {
+		closeWebSocket(ws, err)
+		return err
+	}
+
+	// Only this goroutine writes to the connection; the reader reports
+	// invalid requests through invalid and ends the call
+	invalid := make(chan error, 1)
+	go func() {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				cancel()
+				return
+			}
+			if len(data) == 0 {
+				stream.CloseSend()
+				continue
+			}
+			req, err := route.message(c, data)
+			if err != nil {
+				invalid <- err
+				cancel()
+				return
+			}
+			if err := stream.SendMsg(req); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		resp := dynamicpb.NewMessage(route.method.Output())
+		err = stream.RecvMsg(resp)
+		if err != nil {
+			break
+		}
+		body, merr := route.marshalResponse(resp)
+		if merr != nil {
+			err = status.Error(codes.Internal, "failed to marshal gRPC response")
+			break
+		}
+		ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if werr := ws.WriteMessage(websocket.TextMessage, body); werr != nil {
+			return status.Error(codes.Canceled, werr.Error())
+		}
+	}
+
+	select {
+	case reason := <-invalid:
+		err = status.Error(codes.InvalidArgument, reason.Error())
+	default:
+	}
+	closeWebSocket(ws, err)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// closeWebSocket closes ws normally after a stream ended, or with the code
+// and message of the status it failed with
+func closeWebSocket(ws *websocket.Conn, err error) {
+	code, text := websocket.CloseNormalClosure, ""
+	if streamCode(err) != codes.OK {
+		st := status.Convert(err)
+		code, text = websocket.CloseInternalServerErr, st.Code().String()+": "+st.Message()
+		if st.Code() == codes.InvalidArgument {
+			code = websocket.CloseInvalidFramePayloadData
+		}
+		if len(text) > 123 { // Close reasons are limited to 123 bytes
+			text = text[:123]
+		}
+	}
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(streamWriteTimeout))
+}
+
+// marshalResponse returns the response, or its field named by the route, as
+// protobuf JSON
+func (r *restRoute) marshalResponse(resp *dynamicpb.Message) ([]byte, error) {
+	var result protoreflect.Message = resp
+	for _, field := range r.response {
+		result = result.Get(field).Message()
+	}
+	return protojson.Marshal(result.Interface())
+}
+
+// acceptsEventStream reports whether the client asked for Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
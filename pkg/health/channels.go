@@ -0,0 +1,408 @@
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const DefaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// IsResolution reports whether the alert announces that an earlier alert is resolved
+func (a Alert) IsResolution() bool {
+	return a.Type == AlertTypeTargetRecovered
+}
+
+// IncidentKey identifies the incident an alert belongs to. An alert and its
+// resolution share the same key so incident tools can correlate them.
+func (a Alert) IncidentKey() string {
+	alertType := a.Type
+	if alertType == AlertTypeTargetRecovered {
+		alertType = AlertTypeTargetDown
+	}
+	return fmt.Sprintf("odin:%s:%s", alertType, a.Target)
+}
+
+// RoutedChannel forwards only alerts of selected severities to a channel.
+// Resolutions are forwarded regardless of severity unless skipResolved is set,
+// so every channel that received an alert also hears when it clears.
+type RoutedChannel struct {
+	channel      AlertChannel
+	severities   map[Severity]bool
+	skipResolved bool
+}
+
+// NewRoutedChannel wraps channel with severity routing. An empty severities
+// list forwards every alert.
+func NewRoutedChannel(channel AlertChannel, severities []Severity, skipResolved bool) *RoutedChannel {
+	routed := &RoutedChannel{
+		channel:      channel,
+		skipResolved: skipResolved,
+	}
+	if len(severities) > 0 {
+		routed.severities = make(map[Severity]bool, len(severities))
+		for _, severity := range severities {
+			routed.severities[severity] = true
+		}
+	}
+	return routed
+}
+
+func (r *RoutedChannel) Name() string {
+	return r.channel.Name()
+}
+
+func (r *RoutedChannel) Send(alert Alert) error {
+	if alert.IsResolution() {
+		if r.skipResolved {
+			return nil
+		}
+		return r.channel.Send(alert)
+	}
+	if r.severities != nil && !r.severities[alert.Severity] {
+		return nil
+	}
+	return r.channel.Send(alert)
+}
+
+// SlackChannel sends alerts to a Slack incoming webhook using Block Kit
+type SlackChannel struct {
+	URL      string
+	Channel  string
+	Username string
+	name     string
+	client   *http.Client
+	logger   *logrus.Logger
+}
+
+// NewSlackChannel creates a new Slack alert channel
+func NewSlackChannel(name, webhookURL, channel, username string, logger *logrus.Logger) *SlackChannel {
+	if name == "" {
+		name = "slack"
+	}
+	return &SlackChannel{
+		URL:      webhookURL,
+		Channel:  channel,
+		Username: username,
+		name:     name,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+	}
+}
+
+func (s *SlackChannel) Name() string {
+	return s.name
+}
+
+func (s *SlackChannel) Send(alert Alert) error {
+	title := fmt.Sprintf("%s %s", severityEmoji(alert), alertTitle(alert))
+
+	fields := []map[string]interface{}{
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Severity*\n%s", alert.Severity)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Target*\n%s", alert.Target)},
+	}
+	for _, key := range sortedKeys(alert.Metadata) {
+		fields = append(fields, map[string]interface{}{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*%s*\n%v", key, alert.Metadata[key]),
+		})
+	}
+	// Slack allows at most 10 fields per section
+	if len(fields) > 10 {
+		fields = fields[:10]
+	}
+
+	payload := map[string]interface{}{
+		"text": fmt.Sprintf("%s: %s", title, alert.Message),
+		"blocks": []map[string]interface{}{
+			{
+				"type": "header",
+				"text": map[string]interface{}{"type": "plain_text", "text": title},
+			},
+			{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": alert.Message},
+			},
+			{
+				"type":   "section",
+				"fields": fields,
+			},
+			{
+				"type": "context",
+				"elements": []map[string]interface{}{
+					{"type": "mrkdwn", "text": fmt.Sprintf("Odin Gateway • %s", alert.Timestamp.UTC().Format(time.RFC1123))},
+				},
+			},
+		},
+	}
+	if s.Channel != "" {
+		payload["channel"] = s.Channel
+	}
+	if s.Username != "" {
+		payload["username"] = s.Username
+	}
+
+	if err := postJSON(s.client, s.URL, payload, nil); err != nil {
+		return fmt.Errorf("failed to send Slack alert: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"channel":  s.name,
+		"type":     alert.Type,
+		"severity": alert.Severity,
+	}).Debug("Alert sent via Slack")
+
+	return nil
+}
+
+// TeamsChannel sends alerts to a Microsoft Teams webhook as an Adaptive Card.
+// The envelope is accepted by both Workflows webhooks and incoming webhooks.
+type TeamsChannel struct {
+	URL    string
+	name   string
+	client *http.Client
+	logger *logrus.Logger
+}
+
+// NewTeamsChannel creates a new Microsoft Teams alert channel
+func NewTeamsChannel(name, webhookURL string, logger *logrus.Logger) *TeamsChannel {
+	if name == "" {
+		name = "teams"
+	}
+	return &TeamsChannel{
+		URL:    webhookURL,
+		name:   name,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+	}
+}
+
+func (t *TeamsChannel) Name() string {
+	return t.name
+}
+
+func (t *TeamsChannel) Send(alert Alert) error {
+	facts := []map[string]interface{}{
+		{"title": "Severity", "value": string(alert.Severity)},
+		{"title": "Target", "value": alert.Target},
+		{"title": "Time", "value": alert.Timestamp.UTC().Format(time.RFC1123)},
+	}
+	for _, key := range sortedKeys(alert.Metadata) {
+		facts = append(facts, map[string]interface{}{
+			"title": key,
+			"value": fmt.Sprintf("%v", alert.Metadata[key]),
+		})
+	}
+
+	color := "Accent"
+	switch {
+	case alert.IsResolution():
+		color = "Good"
+	case alert.Severity == SeverityCritical:
+		color = "Attention"
+	case alert.Severity == SeverityWarning:
+		color = "Warning"
+	}
+
+	payload := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]interface{}{
+						{
+							"type":   "TextBlock",
+							"text":   alertTitle(alert),
+							"size":   "Large",
+							"weight": "Bolder",
+							"color":  color,
+						},
+						{
+							"type": "TextBlock",
+							"text": alert.Message,
+							"wrap": true,
+						},
+						{
+							"type":  "FactSet",
+							"facts": facts,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := postJSON(t.client, t.URL, payload, nil); err != nil {
+		return fmt.Errorf("failed to send Teams alert: %w", err)
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"channel":  t.name,
+		"type":     alert.Type,
+		"severity": alert.Severity,
+	}).Debug("Alert sent via Teams")
+
+	return nil
+}
+
+// PagerDutyChannel triggers and resolves incidents through the Events API v2
+type PagerDutyChannel struct {
+	RoutingKey string
+	Source     string
+	EventsURL  string
+	name       string
+	client     *http.Client
+	logger     *logrus.Logger
+}
+
+// NewPagerDutyChannel creates a new PagerDuty alert channel
+func NewPagerDutyChannel(name, routingKey, source, eventsURL string, logger *logrus.Logger) *PagerDutyChannel {
+	if name == "" {
+		name = "pagerduty"
+	}
+	if source == "" {
+		source = "odin-gateway"
+	}
+	if eventsURL == "" {
+		eventsURL = DefaultPagerDutyEventsURL
+	}
+	return &PagerDutyChannel{
+		RoutingKey: routingKey,
+		Source:     source,
+		EventsURL:  eventsURL,
+		name:       name,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     logger,
+	}
+}
+
+func (p *PagerDutyChannel) Name() string {
+	return p.name
+}
+
+func (p *PagerDutyChannel) Send(alert Alert) error {
+	event := map[string]interface{}{
+		"routing_key": p.RoutingKey,
+		"dedup_key":   alert.IncidentKey(),
+	}
+
+	if alert.IsResolution() {
+		event["event_action"] = "resolve"
+	} else {
+		event["event_action"] = "trigger"
+		event["payload"] = map[string]interface{}{
+			"summary":        truncate(alert.Message, 1024),
+			"source":         p.Source,
+			"severity":       pagerDutySeverity(alert.Severity),
+			"timestamp":      alert.Timestamp.UTC().Format(time.RFC3339),
+			"component":      alert.Target,
+			"class":          string(alert.Type),
+			"custom_details": alert.Metadata,
+		}
+	}
+
+	if err := postJSON(p.client, p.EventsURL, event, []int{http.StatusAccepted, http.StatusOK}); err != nil {
+		return fmt.Errorf("failed to send PagerDuty event: %w", err)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"channel": p.name,
+		"action":  event["event_action"],
+		"dedup":   event["dedup_key"],
+	}).Debug("Alert sent via PagerDuty")
+
+	return nil
+}
+
+// pagerDutySeverity maps alert severities onto PagerDuty's critical/error/warning/info
+func pagerDutySeverity(severity Severity) string {
+	switch severity {
+	case SeverityCritical:
+		return "critical"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+func alertTitle(alert Alert) string {
+	title := strings.ReplaceAll(string(alert.Type), "_", " ")
+	if title == "" {
+		title = "alert"
+	}
+	title = strings.ToUpper(title[:1]) + title[1:]
+	if alert.IsResolution() {
+		return "Resolved: " + title
+	}
+	return title
+}
+
+func severityEmoji(alert Alert) string {
+	if alert.IsResolution() {
+		return ":white_check_mark:"
+	}
+	switch alert.Severity {
+	case SeverityCritical:
+		return ":red_circle:"
+	case SeverityWarning:
+		return ":warning:"
+	default:
+		return ":information_source:"
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
+
+// postJSON posts payload and checks the response status. accepted defaults to any 2xx.
+func postJSON(client *http.Client, url string, payload interface{}, accepted []int) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if len(accepted) > 0 {
+		for _, status := range accepted {
+			if resp.StatusCode == status {
+				return nil
+			}
+		}
+	} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
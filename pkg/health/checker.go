@@ -3,6 +3,7 @@ package health
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -22,6 +23,7 @@ const (
 // TargetHealth tracks the health status of a single backend target
 type TargetHealth struct {
 	URL                 string
+	Service             string
 	Status              TargetStatus
 	LastCheck           time.Time
 	ConsecutiveFails    int
@@ -32,6 +34,8 @@ type TargetHealth struct {
 	SuccessfulChecks    int64
 	FailedChecks        int64
 	AverageResponseTime time.Duration
+	PassiveFails        int       // Consecutive failed requests reported through ReportRequest
+	LastPassiveFailure  time.Time // When the last failed request was reported
 }
 
 // Config holds health checker configuration
@@ -42,6 +46,21 @@ type Config struct {
 	HealthyThreshold   int           // Number of consecutive successes before marking healthy
 	ExpectedStatus     []int         // Expected HTTP status codes (default: 200)
 	InsecureSkipVerify bool          // Skip TLS verification
+	// Probe selects the check of targets when Check is not set: ProbeHTTP
+	// (default), ProbeTCP or ProbeGRPC
+	Probe string
+	// GRPCService is the service the grpc probe asks about; empty asks
+	// about the server as a whole
+	GRPCService string
+	// Check replaces the HTTP request to /health when set, e.g. with TCPCheck
+	Check func(target string) error
+	// PassiveFailures is the number of consecutive failed requests reported
+	// through ReportRequest that mark a healthy target degraded; 0 ignores
+	// reported requests
+	PassiveFailures int
+	// PassiveDecay is how long a degraded target must go without failed
+	// requests to be healthy again (default: 30s)
+	PassiveDecay time.Duration
 }
 
 // TargetChecker performs active health checks on backend targets
@@ -54,6 +73,8 @@ type TargetChecker struct {
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 	client   *http.Client
+	recorder Recorder
+	decay    map[string]*time.Timer // Returns degraded targets to healthy
 }
 
 // NewTargetChecker creates a new health checker for backend targets
@@ -74,6 +95,17 @@ func NewTargetChecker(config Config, logger *logrus.Logger, alerts *AlertManager
 	if len(config.ExpectedStatus) == 0 {
 		config.ExpectedStatus = []int{200, 204}
 	}
+	if config.PassiveFailures > 0 && config.PassiveDecay == 0 {
+		config.PassiveDecay = 30 * time.Second
+	}
+	if config.Check == nil {
+		switch config.Probe {
+		case ProbeTCP:
+			config.Check = TCPCheck(config.Timeout)
+		case ProbeGRPC:
+			config.Check = GRPCCheck(config.Timeout, config.GRPCService, config.InsecureSkipVerify)
+		}
+	}
 
 	return &TargetChecker{
 		config:   config,
@@ -81,6 +113,7 @@ func NewTargetChecker(config Config, logger *logrus.Logger, alerts *AlertManager
 		logger:   logger,
 		alerts:   alerts,
 		stopChan: make(chan struct{}),
+		decay:    make(map[string]*time.Timer),
 		client: &http.Client{
 			Timeout: config.Timeout,
 			Transport: &http.Transport{
@@ -92,15 +125,27 @@ func NewTargetChecker(config Config, logger *logrus.Logger, alerts *AlertManager
 	}
 }
 
+// SetRecorder tells recorder the outcome of every check. It must be set
+// before the checker is started.
+func (c *TargetChecker) SetRecorder(recorder Recorder) {
+	c.recorder = recorder
+}
+
 // AddTarget adds a new target to monitor
 func (c *TargetChecker) AddTarget(url string) {
+	c.AddServiceTarget("", url)
+}
+
+// AddServiceTarget adds a new target of service to monitor
+func (c *TargetChecker) AddServiceTarget(service, url string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if _, exists := c.targets[url]; !exists {
 		c.targets[url] = &TargetHealth{
-			URL:    url,
-			Status: TargetStatusHealthy, // Start optimistic
+			URL:     url,
+			Service: service,
+			Status:  TargetStatusHealthy, // Start optimistic
 		}
 		c.logger.WithField("url", url).Info("Added target for health monitoring")
 	}
@@ -112,6 +157,10 @@ func (c *TargetChecker) RemoveTarget(url string) {
 	defer c.mu.Unlock()
 
 	delete(c.targets, url)
+	if timer, ok := c.decay[url]; ok {
+		timer.Stop()
+		delete(c.decay, url)
+	}
 	c.logger.WithField("url", url).Info("Removed target from health monitoring")
 }
 
@@ -145,6 +194,12 @@ func (c *TargetChecker) Stop() {
 	c.logger.Info("Stopping health checker")
 	close(c.stopChan)
 	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, timer := range c.decay {
+		timer.Stop()
+	}
 }
 
 // checkAll performs health checks on all targets concurrently
@@ -174,6 +229,11 @@ func (c *TargetChecker) checkAll() {
 func (c *TargetChecker) checkTarget(url string) (bool, time.Duration, error) {
 	start := time.Now()
 
+	if c.config.Check != nil {
+		err := c.config.Check(url)
+		return err == nil, time.Since(start), err
+	}
+
 	// Build health check URL (append /health if not present)
 	healthURL := url
 	if healthURL[len(healthURL)-1] != '/' {
@@ -204,6 +264,18 @@ func (c *TargetChecker) checkTarget(url string) (bool, time.Duration, error) {
 	return false, responseTime, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 }
 
+// TCPCheck returns a check that passes when a TCP connection to a host:port
+// or URL target can be opened within timeout
+func TCPCheck(timeout time.Duration) func(target string) error {
+	return func(target string) error {
+		conn, err := net.DialTimeout("tcp", targetAddress(target), timeout)
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+		return conn.Close()
+	}
+}
+
 // updateTargetHealth updates the health status of a target based on check result
 func (c *TargetChecker) updateTargetHealth(url string, success bool, responseTime time.Duration, err error) {
 	c.mu.Lock()
@@ -238,6 +310,7 @@ func (c *TargetChecker) updateTargetHealth(url string, success bool, responseTim
 
 		if target.Status != TargetStatusHealthy && target.ConsecutivePasses >= c.config.HealthyThreshold {
 			target.Status = TargetStatusHealthy
+			target.PassiveFails = 0
 			c.logger.WithFields(logrus.Fields{
 				"url":    url,
 				"passes": target.ConsecutivePasses,
@@ -249,7 +322,7 @@ func (c *TargetChecker) updateTargetHealth(url string, success bool, responseTim
 		target.FailedChecks++
 		target.LastError = err.Error()
 
-		if target.Status == TargetStatusHealthy && target.ConsecutiveFails >= c.config.UnhealthyThreshold {
+		if target.Status != TargetStatusUnhealthy && target.ConsecutiveFails >= c.config.UnhealthyThreshold {
 			target.Status = TargetStatusUnhealthy
 			c.logger.WithFields(logrus.Fields{
 				"url":   url,
@@ -259,6 +332,10 @@ func (c *TargetChecker) updateTargetHealth(url string, success bool, responseTim
 		}
 	}
 
+	if c.recorder != nil {
+		c.recorder.RecordCheck(target.Service, url, target.Status, responseTime, err)
+	}
+
 	// Send alerts on status changes
 	if oldStatus != target.Status {
 		if target.Status == TargetStatusUnhealthy {
@@ -76,6 +76,8 @@ func (c *Checker) Liveness() *Status {
 	}
 }
 
+// Register registers the health and debug endpoints. Liveness and readiness
+// are registered by RegisterProbes.
 func Register(e *echo.Echo, logger *logrus.Logger) {
 	e.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{
@@ -83,20 +85,6 @@ func Register(e *echo.Echo, logger *logrus.Logger) {
 		})
 	})
 
-	// Add readiness endpoint
-	e.GET("/ready", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{
-			"status": "ready",
-		})
-	})
-
-	// Add liveness endpoint
-	e.GET("/live", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{
-			"status": "alive",
-		})
-	})
-
 	e.GET("/debug/routes", func(c echo.Context) error {
 		var routes []map[string]interface{}
 		for _, route := range e.Routes() {
@@ -0,0 +1,256 @@
+package health
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Recorder is told the outcome of every health check, e.g. to keep its history
+type Recorder interface {
+	RecordCheck(service, target string, status TargetStatus, latency time.Duration, err error)
+}
+
+// HistoryStore keeps health check history, e.g. the MongoDB repository
+type HistoryStore interface {
+	SaveHealthCheck(ctx context.Context, check *mongodb.HealthCheckDocument) error
+	QueryHealthChecks(ctx context.Context, serviceName string, start, end time.Time) ([]*mongodb.HealthCheckDocument, error)
+}
+
+// historyKey identifies the checks aggregated into one record
+type historyKey struct {
+	periodStart time.Time
+	service     string
+	target      string
+}
+
+type checkStats struct {
+	status     TargetStatus
+	checks     int64
+	failures   int64
+	latency    time.Duration // Sum over all checks
+	maxLatency time.Duration
+	lastError  string
+}
+
+// History aggregates the health checks of each target per resolution and
+// saves them once their period has ended
+type History struct {
+	cfg    config.HealthHistoryConfig
+	store  HistoryStore
+	logger *logrus.Logger
+
+	mu    sync.Mutex
+	stats map[historyKey]*checkStats
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHistory creates a history and starts saving its records
+func NewHistory(cfg config.HealthHistoryConfig, store HistoryStore, logger *logrus.Logger) *History {
+	h := &History{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		stats:  make(map[historyKey]*checkStats),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.wg.Add(1)
+	go h.flushLoop(ctx)
+
+	return h
+}
+
+// Stop stops the history and saves what has been aggregated so far,
+// including the current period
+func (h *History) Stop() {
+	h.cancel()
+	h.wg.Wait()
+}
+
+// RecordCheck counts a check of target into the record of its period
+func (h *History) RecordCheck(service, target string, status TargetStatus, latency time.Duration, err error) {
+	key := historyKey{periodStart: time.Now().UTC().Truncate(h.cfg.Resolution), service: service, target: target}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.stats[key]
+	if !ok {
+		s = &checkStats{}
+		h.stats[key] = s
+	}
+	s.status = status
+	s.checks++
+	s.latency += latency
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+	}
+}
+
+func (h *History) flushLoop(ctx context.Context) {
+	defer h.wg.Done()
+
+	for {
+		// Save each period shortly after it ends
+		now := time.Now()
+		next := now.UTC().Truncate(h.cfg.Resolution).Add(h.cfg.Resolution)
+		timer := time.NewTimer(next.Sub(now) + time.Second)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			h.flush(time.Time{}) // Final flush
+			return
+		case <-timer.C:
+			h.flush(next)
+		}
+	}
+}
+
+// flush saves the records of the periods that started before before, or of
+// every period when before is zero
+func (h *History) flush(before time.Time) {
+	h.mu.Lock()
+	taken := make(map[historyKey]*checkStats)
+	for key, s := range h.stats {
+		if before.IsZero() || key.periodStart.Before(before) {
+			taken[key] = s
+			delete(h.stats, key)
+		}
+	}
+	h.mu.Unlock()
+
+	if len(taken) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for key, s := range taken {
+		if err := h.store.SaveHealthCheck(ctx, h.newRecord(key, s)); err != nil {
+			h.logger.WithError(err).WithFields(logrus.Fields{
+				"service": key.service,
+				"target":  key.target,
+			}).Error("Failed to save health check history")
+		}
+	}
+}
+
+func (h *History) newRecord(key historyKey, s *checkStats) *mongodb.HealthCheckDocument {
+	id := sha256.Sum256([]byte(key.periodStart.Format(time.RFC3339) + "|" + key.service + "|" + key.target))
+	return &mongodb.HealthCheckDocument{
+		ID:          hex.EncodeToString(id[:16]),
+		ServiceName: key.service,
+		Target:      key.target,
+		Status:      string(s.status),
+		Latency:     (s.latency / time.Duration(s.checks)).Milliseconds(),
+		Message:     s.lastError,
+		CheckedAt:   key.periodStart,
+		Metadata: map[string]interface{}{
+			"checks":       s.checks,
+			"failures":     s.failures,
+			"maxLatencyMs": s.maxLatency.Milliseconds(),
+			"resolution":   h.cfg.Resolution.String(),
+		},
+		TTL: key.periodStart.Add(h.cfg.Resolution + h.cfg.Retention),
+	}
+}
+
+// HistoryPoint is a target's checks over one period
+type HistoryPoint struct {
+	Time         time.Time `json:"time"`
+	Status       string    `json:"status"` // Status at the end of the period
+	Checks       int64     `json:"checks"`
+	Failures     int64     `json:"failures"`
+	LatencyMs    int64     `json:"latencyMs"` // Average
+	MaxLatencyMs int64     `json:"maxLatencyMs"`
+	Error        string    `json:"error,omitempty"` // Last error of the period
+}
+
+// TargetHistory is the uptime and latency of a target over time
+type TargetHistory struct {
+	Target    string         `json:"target"`
+	Checks    int64          `json:"checks"`
+	Uptime    float64        `json:"uptime"` // Percentage of passed checks
+	LatencyMs int64          `json:"latencyMs"`
+	Points    []HistoryPoint `json:"points"`
+}
+
+// Query returns the history of each target of service between start and
+// end, sorted by target
+func (h *History) Query(ctx context.Context, service string, start, end time.Time) ([]TargetHistory, error) {
+	records, err := h.store.QueryHealthChecks(ctx, service, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	byTarget := make(map[string]*TargetHistory)
+	latencySum := make(map[string]int64)
+	for _, record := range records {
+		th, ok := byTarget[record.Target]
+		if !ok {
+			th = &TargetHistory{Target: record.Target, Points: []HistoryPoint{}}
+			byTarget[record.Target] = th
+		}
+		point := HistoryPoint{
+			Time:         record.CheckedAt,
+			Status:       record.Status,
+			Checks:       metadataInt(record.Metadata, "checks", 1),
+			Failures:     metadataInt(record.Metadata, "failures", 0),
+			LatencyMs:    record.Latency,
+			MaxLatencyMs: metadataInt(record.Metadata, "maxLatencyMs", record.Latency),
+			Error:        record.Message,
+		}
+		th.Points = append(th.Points, point)
+		th.Checks += point.Checks
+		th.Uptime += float64(point.Checks - point.Failures)
+		latencySum[record.Target] += point.LatencyMs * point.Checks
+	}
+
+	history := make([]TargetHistory, 0, len(byTarget))
+	for target, th := range byTarget {
+		if th.Checks > 0 {
+			th.Uptime = th.Uptime * 100 / float64(th.Checks)
+			th.LatencyMs = latencySum[target] / th.Checks
+		}
+		history = append(history, *th)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Target < history[j].Target
+	})
+	return history, nil
+}
+
+// metadataInt reads a number saved in a record's metadata, which MongoDB
+// may return as any integer type
+func metadataInt(metadata map[string]interface{}, key string, def int64) int64 {
+	switch v := metadata[key].(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		return def
+	}
+}
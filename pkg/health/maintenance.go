@@ -0,0 +1,100 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DisabledTarget is a target an admin has taken out of service
+type DisabledTarget struct {
+	Target     string    `json:"target"`
+	Reason     string    `json:"reason,omitempty"`
+	DisabledBy string    `json:"disabledBy"`
+	DisabledAt time.Time `json:"disabledAt"`
+}
+
+// Maintenance keeps the targets that are administratively disabled, e.g.
+// for planned backend maintenance. Load balancers skip disabled targets
+// whatever their health.
+type Maintenance struct {
+	mu       sync.RWMutex
+	disabled map[string]DisabledTarget
+}
+
+// NewMaintenance creates a maintenance list with no disabled targets
+func NewMaintenance() *Maintenance {
+	return &Maintenance{disabled: make(map[string]DisabledTarget)}
+}
+
+// Disable takes target out of every load balancer it is in until it is
+// enabled again. Disabling a disabled target updates its reason.
+func (m *Maintenance) Disable(target, reason, user string) DisabledTarget {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := DisabledTarget{Target: target, Reason: reason, DisabledBy: user, DisabledAt: time.Now()}
+	m.disabled[target] = d
+	return d
+}
+
+// Enable puts target back into service and reports whether it was disabled
+func (m *Maintenance) Enable(target string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.disabled[target]
+	delete(m.disabled, target)
+	return ok
+}
+
+// IsDisabled returns whether target is disabled
+func (m *Maintenance) IsDisabled(target string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.disabled[target]
+	return ok
+}
+
+// Disabled returns the disabled targets, sorted by target
+func (m *Maintenance) Disabled() []DisabledTarget {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	targets := make([]DisabledTarget, 0, len(m.disabled))
+	for _, d := range m.disabled {
+		targets = append(targets, d)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Target < targets[j].Target
+	})
+	return targets
+}
+
+// AvailableTargets returns the targets a load balancer should pick from:
+// those not disabled in m and, unless that would leave none, not found
+// unhealthy by checker. Either of m and checker may be nil.
+func AvailableTargets(targets []string, checker *TargetChecker, m *Maintenance) []string {
+	if checker == nil && m == nil {
+		return targets
+	}
+
+	enabled := make([]string, 0, len(targets))
+	healthy := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if m != nil && m.IsDisabled(target) {
+			continue
+		}
+		enabled = append(enabled, target)
+		if checker == nil || checker.IsHealthy(target) {
+			healthy = append(healthy, target)
+		}
+	}
+	// Health checks may be wrong, e.g. when a shared health endpoint is
+	// down, so spread requests over every target rather than refuse them
+	if len(healthy) == 0 {
+		return enabled
+	}
+	return healthy
+}
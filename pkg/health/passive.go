@@ -0,0 +1,88 @@
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReportRequest passes the outcome of a request proxied to url to the
+// checker, with err set when the request failed. After PassiveFailures
+// consecutive failures a healthy target is marked degraded until it has
+// gone PassiveDecay without failures, or passes enough active checks.
+func (c *TargetChecker) ReportRequest(url string, err error) {
+	if c.config.PassiveFailures <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target, exists := c.targets[url]
+	if !exists {
+		return
+	}
+
+	if err == nil {
+		target.PassiveFails = 0
+		return
+	}
+
+	target.PassiveFails++
+	target.LastPassiveFailure = time.Now()
+	target.LastError = err.Error()
+
+	if target.Status == TargetStatusDegraded {
+		c.decay[url].Reset(c.config.PassiveDecay)
+		return
+	}
+	if target.Status != TargetStatusHealthy || target.PassiveFails < c.config.PassiveFailures {
+		return
+	}
+
+	target.Status = TargetStatusDegraded
+	target.ConsecutivePasses = 0
+	if timer, ok := c.decay[url]; ok {
+		timer.Reset(c.config.PassiveDecay)
+	} else {
+		c.decay[url] = time.AfterFunc(c.config.PassiveDecay, func() { c.recoverDegraded(url) })
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"url":   url,
+		"fails": target.PassiveFails,
+		"error": err.Error(),
+	}).Warn("Target marked as degraded by failed requests")
+
+	c.alerts.SendAlert(Alert{
+		Type:      AlertTypeHighErrorRate,
+		Severity:  SeverityWarning,
+		Target:    url,
+		Message:   fmt.Sprintf("Target %s is degraded: %d consecutive requests failed", url, target.PassiveFails),
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"error": target.LastError,
+		},
+	})
+}
+
+// recoverDegraded returns a degraded target to healthy once it has gone
+// PassiveDecay without failed requests
+func (c *TargetChecker) recoverDegraded(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target, exists := c.targets[url]
+	if !exists || target.Status != TargetStatusDegraded {
+		return
+	}
+	// A failure reported while the timer fired has reset it already
+	if time.Since(target.LastPassiveFailure) < c.config.PassiveDecay {
+		return
+	}
+
+	target.Status = TargetStatusHealthy
+	target.PassiveFails = 0
+	c.logger.WithField("url", url).Info("Degraded target recovered to healthy")
+}
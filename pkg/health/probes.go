@@ -0,0 +1,70 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Probe types selectable per service health check
+const (
+	ProbeHTTP = "http" // GET <target>/health and compare the status code
+	ProbeTCP  = "tcp"  // Open a TCP connection to the target
+	ProbeGRPC = "grpc" // Call the standard gRPC health service of the target
+)
+
+// GRPCCheck returns a check that passes when the target reports service as
+// SERVING through the gRPC health checking protocol. An empty service asks
+// for the health of the server as a whole. Targets with an https or grpcs
+// URL are called over TLS.
+func GRPCCheck(timeout time.Duration, service string, insecureSkipVerify bool) func(target string) error {
+	return func(target string) error {
+		creds := insecure.NewCredentials()
+		if u, err := url.Parse(target); err == nil && (u.Scheme == "https" || u.Scheme == "grpcs") {
+			creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: insecureSkipVerify})
+		}
+
+		conn, err := grpc.NewClient(targetAddress(target), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("unexpected serving status: %s", resp.GetStatus())
+		}
+		return nil
+	}
+}
+
+// targetAddress returns the host:port to connect to for a target given as a
+// URL, such as http://backend:8080, or as host:port already
+func targetAddress(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return target
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "https", "grpcs":
+		return net.JoinHostPort(u.Hostname(), "443")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
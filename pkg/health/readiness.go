@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadinessCheck is a dependency the gateway needs to serve traffic
+type ReadinessCheck func(ctx context.Context) error
+
+// Readiness decides whether the gateway should receive traffic: its routes
+// are registered, it is not shutting down, and every dependency check passes
+type Readiness struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	routes error // Why routes cannot be served, nil once registered
+	checks map[string]ReadinessCheck
+}
+
+// NewReadiness creates a readiness that is not ready until its routes are
+// registered. Each check is given timeout to pass.
+func NewReadiness(timeout time.Duration) *Readiness {
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	return &Readiness{
+		timeout: timeout,
+		routes:  errors.New("routes are not registered yet"),
+		checks:  make(map[string]ReadinessCheck),
+	}
+}
+
+// AddCheck adds a dependency check
+func (r *Readiness) AddCheck(name string, check ReadinessCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// MarkRoutesRegistered reports that the gateway can serve its routes
+func (r *Readiness) MarkRoutesRegistered() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = nil
+}
+
+// MarkShuttingDown makes the gateway unready so that no new traffic is sent
+// to it while it drains
+func (r *Readiness) MarkShuttingDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = errors.New("shutting down")
+}
+
+// Check runs the dependency checks concurrently and returns the status of
+// each, and whether all passed
+func (r *Readiness) Check(ctx context.Context) (*Status, bool) {
+	r.mu.RLock()
+	routes := r.routes
+	checks := make(map[string]ReadinessCheck, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	errs := make(map[string]error, len(checks)+1)
+	errs["routes"] = routes
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			errs[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now().Unix()
+	status := &Status{Status: "ready", Timestamp: now, Checks: make(map[string]CheckInfo, len(errs))}
+	ready := true
+	for name, err := range errs {
+		info := CheckInfo{Status: "healthy", Timestamp: now}
+		if err != nil {
+			info.Status = "unhealthy"
+			info.Error = err.Error()
+			status.Status = "not_ready"
+			ready = false
+		}
+		status.Checks[name] = info
+	}
+	return status, ready
+}
+
+// MinHealthyTargets returns a check that fails while fewer than min of
+// targets are healthy according to checker
+func MinHealthyTargets(checker *TargetChecker, targets []string, min int) ReadinessCheck {
+	return func(ctx context.Context) error {
+		healthy := 0
+		var unhealthy []string
+		for _, target := range targets {
+			if checker.IsHealthy(target) {
+				healthy++
+			} else {
+				unhealthy = append(unhealthy, target)
+			}
+		}
+		if healthy < min {
+			sort.Strings(unhealthy)
+			return fmt.Errorf("%d of %d targets healthy, %d required (unhealthy: %v)", healthy, len(targets), min, unhealthy)
+		}
+		return nil
+	}
+}
+
+// RegisterProbes registers the liveness endpoint, which answers as long as
+// the process serves requests, and the readiness endpoint, which answers
+// 503 Service Unavailable while readiness is not ready
+func RegisterProbes(e *echo.Echo, cfg config.ProbesConfig, readiness *Readiness) {
+	e.GET(cfg.LivenessPath, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, &Status{
+			Status:    "alive",
+			Timestamp: time.Now().Unix(),
+		})
+	})
+
+	e.GET(cfg.ReadinessPath, func(c echo.Context) error {
+		status, ready := readiness.Check(c.Request().Context())
+		if !ready {
+			return c.JSON(http.StatusServiceUnavailable, status)
+		}
+		return c.JSON(http.StatusOK, status)
+	})
+}
@@ -0,0 +1,454 @@
+package insomnia
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/integrations/postman"
+	"odin/pkg/service"
+
+	"github.com/google/uuid"
+)
+
+// insomniaVarPattern matches Insomnia template variables such as {{ _.base_url }}
+var insomniaVarPattern = regexp.MustCompile(`{{\s*_\.([A-Za-z0-9_\-.]+)\s*}}`)
+
+// postmanVarPattern matches Postman variables such as {{base_url}}
+var postmanVarPattern = regexp.MustCompile(`{{\s*([A-Za-z0-9_\-.]+)\s*}}`)
+
+// Transformer handles conversion between Insomnia exports and Odin services.
+// Insomnia resources are mapped onto the Postman collection model so that the
+// service derivation logic (base URL, base path, headers, routes) is shared
+// with the Postman integration.
+type Transformer struct {
+	postman *postman.Transformer
+}
+
+// NewTransformer creates a new transformer
+func NewTransformer() *Transformer {
+	return &Transformer{
+		postman: postman.NewTransformer(),
+	}
+}
+
+// Parse decodes and validates an Insomnia v4 export
+func Parse(data []byte) (*Export, error) {
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse insomnia export: %w", err)
+	}
+
+	if export.Type != ExportType {
+		return nil, fmt.Errorf("unsupported insomnia document type: %q", export.Type)
+	}
+	if export.ExportFormat != ExportFormat {
+		return nil, fmt.Errorf("unsupported insomnia export format: %d (expected %d)", export.ExportFormat, ExportFormat)
+	}
+
+	return &export, nil
+}
+
+// InsomniaToOdinService converts an Insomnia export to an Odin service configuration
+func (t *Transformer) InsomniaToOdinService(export *Export) (*config.ServiceConfig, error) {
+	collection, err := t.ToPostmanCollection(export)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.postman.PostmanToOdinService(collection)
+}
+
+// EnhancedTransform converts an Insomnia export into a service and its route mappings
+func (t *Transformer) EnhancedTransform(export *Export, serviceName string) (*service.Config, []postman.RouteMapping, error) {
+	collection, err := t.ToPostmanCollection(export)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if serviceName == "" {
+		serviceName = collection.Info.Name
+	}
+
+	return t.postman.EnhancedTransform(collection, serviceName)
+}
+
+// OdinServiceToInsomnia converts an Odin service to an Insomnia export
+func (t *Transformer) OdinServiceToInsomnia(svc *config.ServiceConfig) (*Export, error) {
+	collection, err := t.postman.OdinServiceToPostman(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	export := t.FromPostmanCollection(collection)
+
+	// Expose the first target as the base_url environment variable
+	if len(svc.Targets) > 0 {
+		workspaceID := export.Resources[0].ID
+		export.Resources = append(export.Resources, Resource{
+			ID:       newID("env"),
+			Type:     ResourceEnvironment,
+			ParentID: workspaceID,
+			Name:     "Base Environment",
+			Data: map[string]interface{}{
+				"base_url": svc.Targets[0],
+			},
+		})
+	}
+
+	return export, nil
+}
+
+// ToPostmanCollection maps an Insomnia export onto a Postman collection
+func (t *Transformer) ToPostmanCollection(export *Export) (*postman.PostmanCollection, error) {
+	if export == nil {
+		return nil, fmt.Errorf("export is nil")
+	}
+
+	workspace := t.findWorkspace(export)
+	if workspace == nil {
+		return nil, fmt.Errorf("export contains no workspace")
+	}
+
+	children := make(map[string][]Resource)
+	for _, res := range export.Resources {
+		children[res.ParentID] = append(children[res.ParentID], res)
+	}
+
+	variables := t.TransformEnvironment(export)
+
+	collection := &postman.PostmanCollection{
+		Info: postman.CollectionInfo{
+			ID:          workspace.ID,
+			Name:        workspace.Name,
+			Description: workspace.Description,
+			Schema:      "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		Item: t.buildItems(workspace.ID, children, variables),
+	}
+
+	return collection, nil
+}
+
+// FromPostmanCollection maps a Postman collection onto an Insomnia export
+func (t *Transformer) FromPostmanCollection(collection *postman.PostmanCollection) *Export {
+	now := time.Now()
+
+	workspace := Resource{
+		ID:          newID("wrk"),
+		Type:        ResourceWorkspace,
+		Name:        collection.Info.Name,
+		Description: collection.Info.Description,
+		Scope:       "collection",
+		Created:     now.UnixMilli(),
+		Modified:    now.UnixMilli(),
+	}
+
+	export := &Export{
+		Type:         ExportType,
+		ExportFormat: ExportFormat,
+		ExportDate:   now.UTC().Format(time.RFC3339),
+		ExportSource: ExportSource,
+		Resources:    []Resource{workspace},
+	}
+
+	t.appendResources(export, workspace.ID, collection.Item)
+
+	return export
+}
+
+// TransformEnvironment flattens the string values of all environments in the export.
+// Sub-environments override values from the base environment.
+func (t *Transformer) TransformEnvironment(export *Export) map[string]string {
+	variables := make(map[string]string)
+	if export == nil {
+		return variables
+	}
+
+	// Base environments are parented to the workspace, sub-environments to another environment
+	envIDs := make(map[string]bool)
+	for _, res := range export.Resources {
+		if res.Type == ResourceEnvironment {
+			envIDs[res.ID] = true
+		}
+	}
+
+	for _, pass := range []bool{false, true} {
+		for _, res := range export.Resources {
+			if res.Type != ResourceEnvironment || envIDs[res.ParentID] != pass {
+				continue
+			}
+			for k, v := range res.Data {
+				if s, ok := v.(string); ok {
+					variables[k] = s
+				}
+			}
+		}
+	}
+
+	return variables
+}
+
+// Summarize counts the resources of an export
+func (t *Transformer) Summarize(export *Export) ImportResult {
+	result := ImportResult{
+		Variables:  t.TransformEnvironment(export),
+		ImportedAt: time.Now(),
+	}
+
+	if workspace := t.findWorkspace(export); workspace != nil {
+		result.Workspace = workspace.Name
+	}
+
+	for _, res := range export.Resources {
+		switch res.Type {
+		case ResourceRequest:
+			result.Requests++
+		case ResourceRequestGroup:
+			result.Folders++
+		}
+	}
+
+	return result
+}
+
+// findWorkspace returns the workspace resource of the export
+func (t *Transformer) findWorkspace(export *Export) *Resource {
+	for i := range export.Resources {
+		if export.Resources[i].Type == ResourceWorkspace {
+			return &export.Resources[i]
+		}
+	}
+	return nil
+}
+
+// buildItems recursively converts request groups and requests below parentID
+func (t *Transformer) buildItems(parentID string, children map[string][]Resource, variables map[string]string) []postman.CollectionItem {
+	var items []postman.CollectionItem
+
+	for _, res := range children[parentID] {
+		switch res.Type {
+		case ResourceRequestGroup:
+			items = append(items, postman.CollectionItem{
+				Name:        res.Name,
+				Description: res.Description,
+				Item:        t.buildItems(res.ID, children, variables),
+			})
+		case ResourceRequest:
+			items = append(items, postman.CollectionItem{
+				Name:        res.Name,
+				Description: res.Description,
+				Request:     t.toPostmanRequest(res, variables),
+			})
+		}
+	}
+
+	return items
+}
+
+// toPostmanRequest converts an Insomnia request resource into a Postman request
+func (t *Transformer) toPostmanRequest(res Resource, variables map[string]string) *postman.Request {
+	raw := resolveVariables(res.URL, variables)
+
+	req := &postman.Request{
+		Method:      strings.ToUpper(res.Method),
+		Description: res.Description,
+		URL:         parseURL(raw),
+	}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	for _, h := range res.Headers {
+		req.Header = append(req.Header, postman.Header{
+			Key:      h.Name,
+			Value:    toPostmanVariables(h.Value),
+			Disabled: h.Disabled,
+		})
+	}
+
+	for _, p := range res.Parameters {
+		req.URL.Query = append(req.URL.Query, postman.KeyValue{
+			Key:      p.Name,
+			Value:    toPostmanVariables(p.Value),
+			Disabled: p.Disabled,
+		})
+	}
+
+	if res.Body != nil {
+		req.Body = toPostmanBody(res.Body)
+	}
+
+	if authType, ok := res.Authentication["type"].(string); ok && authType != "" {
+		req.Auth = &postman.Auth{Type: authType}
+		if token, ok := res.Authentication["token"].(string); ok && authType == "bearer" {
+			req.Auth.Bearer = []postman.AuthAttribute{{Key: "token", Value: toPostmanVariables(token), Type: "string"}}
+		}
+	}
+
+	return req
+}
+
+// appendResources converts Postman items into Insomnia resources below parentID
+func (t *Transformer) appendResources(export *Export, parentID string, items []postman.CollectionItem) {
+	now := time.Now().UnixMilli()
+
+	for _, item := range items {
+		if item.Request == nil {
+			folder := Resource{
+				ID:          newID("fld"),
+				Type:        ResourceRequestGroup,
+				ParentID:    parentID,
+				Name:        item.Name,
+				Description: item.Description,
+				Created:     now,
+				Modified:    now,
+			}
+			export.Resources = append(export.Resources, folder)
+			t.appendResources(export, folder.ID, item.Item)
+			continue
+		}
+
+		req := Resource{
+			ID:          newID("req"),
+			Type:        ResourceRequest,
+			ParentID:    parentID,
+			Name:        item.Name,
+			Description: item.Description,
+			Method:      item.Request.Method,
+			Created:     now,
+			Modified:    now,
+		}
+
+		if item.Request.URL != nil {
+			req.URL = toInsomniaVariables(item.Request.URL.Raw)
+			for _, q := range item.Request.URL.Query {
+				req.Parameters = append(req.Parameters, Pair{
+					Name:     q.Key,
+					Value:    toInsomniaVariables(q.Value),
+					Disabled: q.Disabled,
+				})
+			}
+		}
+
+		for _, h := range item.Request.Header {
+			req.Headers = append(req.Headers, Pair{
+				Name:     h.Key,
+				Value:    toInsomniaVariables(h.Value),
+				Disabled: h.Disabled,
+			})
+		}
+
+		if item.Request.Body != nil {
+			req.Body = fromPostmanBody(item.Request.Body)
+		}
+
+		export.Resources = append(export.Resources, req)
+	}
+}
+
+// toPostmanBody converts an Insomnia body into a Postman body
+func toPostmanBody(body *Body) *postman.RequestBody {
+	switch body.MimeType {
+	case "application/x-www-form-urlencoded":
+		rb := &postman.RequestBody{Mode: "urlencoded"}
+		for _, p := range body.Params {
+			rb.URLEncoded = append(rb.URLEncoded, postman.KeyValue{Key: p.Name, Value: p.Value, Disabled: p.Disabled})
+		}
+		return rb
+	case "multipart/form-data":
+		rb := &postman.RequestBody{Mode: "formdata"}
+		for _, p := range body.Params {
+			rb.FormData = append(rb.FormData, postman.FormDataItem{Key: p.Name, Value: p.Value, Type: "text", Disabled: p.Disabled})
+		}
+		return rb
+	default:
+		rb := &postman.RequestBody{Mode: "raw", Raw: toPostmanVariables(body.Text)}
+		if strings.Contains(body.MimeType, "json") {
+			rb.Options = map[string]interface{}{
+				"raw": map[string]interface{}{"language": "json"},
+			}
+		}
+		return rb
+	}
+}
+
+// fromPostmanBody converts a Postman body into an Insomnia body
+func fromPostmanBody(body *postman.RequestBody) *Body {
+	switch body.Mode {
+	case "urlencoded":
+		b := &Body{MimeType: "application/x-www-form-urlencoded"}
+		for _, kv := range body.URLEncoded {
+			b.Params = append(b.Params, Pair{Name: kv.Key, Value: kv.Value, Disabled: kv.Disabled})
+		}
+		return b
+	case "formdata":
+		b := &Body{MimeType: "multipart/form-data"}
+		for _, fd := range body.FormData {
+			b.Params = append(b.Params, Pair{Name: fd.Key, Value: fd.Value, Disabled: fd.Disabled})
+		}
+		return b
+	default:
+		mimeType := "text/plain"
+		if raw, ok := body.Options["raw"].(map[string]interface{}); ok && raw["language"] == "json" {
+			mimeType = "application/json"
+		}
+		return &Body{MimeType: mimeType, Text: toInsomniaVariables(body.Raw)}
+	}
+}
+
+// parseURL splits a raw URL into the Postman URL structure
+func parseURL(raw string) *postman.URL {
+	u := &postman.URL{Raw: raw}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return u
+	}
+
+	u.Protocol = parsed.Scheme
+	u.Host = strings.Split(parsed.Hostname(), ".")
+	u.Port = parsed.Port()
+	if p := strings.Trim(parsed.Path, "/"); p != "" {
+		u.Path = strings.Split(p, "/")
+	}
+
+	return u
+}
+
+// resolveVariables substitutes known environment values and converts the rest to Postman syntax
+func resolveVariables(s string, variables map[string]string) string {
+	s = insomniaVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := insomniaVarPattern.FindStringSubmatch(match)[1]
+		if v, ok := variables[name]; ok {
+			return v
+		}
+		return match
+	})
+	return toPostmanVariables(s)
+}
+
+// toPostmanVariables converts {{ _.name }} to {{name}}
+func toPostmanVariables(s string) string {
+	return insomniaVarPattern.ReplaceAllString(s, "{{$1}}")
+}
+
+// toInsomniaVariables converts {{name}} to {{ _.name }}
+func toInsomniaVariables(s string) string {
+	return postmanVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := postmanVarPattern.FindStringSubmatch(match)[1]
+		if strings.HasPrefix(name, "_.") {
+			return match
+		}
+		return "{{ _." + name + " }}"
+	})
+}
+
+// newID generates an Insomnia-style resource ID such as req_3f2a...
+func newID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
@@ -0,0 +1,73 @@
+package insomnia
+
+import "time"
+
+// Export format constants
+const (
+	ExportType   = "export"
+	ExportFormat = 4
+	ExportSource = "odin.gateway"
+)
+
+// Resource types found in an Insomnia v4 export
+const (
+	ResourceWorkspace    = "workspace"
+	ResourceRequestGroup = "request_group"
+	ResourceRequest      = "request"
+	ResourceEnvironment  = "environment"
+	ResourceCookieJar    = "cookie_jar"
+	ResourceAPISpec      = "api_spec"
+)
+
+// Export represents an Insomnia v4 export file
+type Export struct {
+	Type         string     `json:"_type"`
+	ExportFormat int        `json:"__export_format"`
+	ExportDate   string     `json:"__export_date,omitempty"`
+	ExportSource string     `json:"__export_source,omitempty"`
+	Resources    []Resource `json:"resources"`
+}
+
+// Resource is a single entry of an Insomnia export. Insomnia uses one flat
+// list for workspaces, folders, requests and environments, linked by parentId.
+type Resource struct {
+	ID             string                 `json:"_id"`
+	Type           string                 `json:"_type"`
+	ParentID       string                 `json:"parentId,omitempty"`
+	Name           string                 `json:"name"`
+	Description    string                 `json:"description,omitempty"`
+	Method         string                 `json:"method,omitempty"`
+	URL            string                 `json:"url,omitempty"`
+	Body           *Body                  `json:"body,omitempty"`
+	Headers        []Pair                 `json:"headers,omitempty"`
+	Parameters     []Pair                 `json:"parameters,omitempty"`
+	Authentication map[string]interface{} `json:"authentication,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	Scope          string                 `json:"scope,omitempty"`
+	Modified       int64                  `json:"modified,omitempty"`
+	Created        int64                  `json:"created,omitempty"`
+}
+
+// Body represents an Insomnia request body
+type Body struct {
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Params   []Pair `json:"params,omitempty"`
+}
+
+// Pair is a name/value entry used for headers, query parameters and form fields
+type Pair struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ImportResult summarizes the outcome of importing an Insomnia export
+type ImportResult struct {
+	Workspace  string            `json:"workspace"`
+	Requests   int               `json:"requests"`
+	Folders    int               `json:"folders"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	ImportedAt time.Time         `json:"importedAt"`
+}
@@ -0,0 +1,221 @@
+package postman
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"odin/pkg/openapi"
+)
+
+// BaseURLVariable and APIKeyVariable are the variables the collections
+// generated from OpenAPI documents are parameterized with
+const (
+	BaseURLVariable = "baseUrl"
+	APIKeyVariable  = "apiKey"
+)
+
+const collectionSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// methodOrder lists the methods of a path in the order they are shown
+var methodOrder = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// OpenAPIToPostman converts an OpenAPI document to a Postman collection, so
+// the collection documents exactly the operations of the spec. Requests are
+// grouped in a folder per tag and address {{baseUrl}}; path parameters become
+// path variables and request bodies carry the examples of the spec. When
+// apiKeyHeader is set, requests send {{apiKey}} in that header.
+func (t *Transformer) OpenAPIToPostman(spec *openapi.Spec, apiKeyHeader string) (*PostmanCollection, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("spec is nil")
+	}
+
+	collection := &PostmanCollection{
+		Info: CollectionInfo{
+			Name:        spec.Info.Title,
+			Description: spec.Info.Description,
+			Schema:      collectionSchema,
+			Version:     spec.Info.Version,
+		},
+		Item: []CollectionItem{},
+	}
+	if apiKeyHeader != "" {
+		collection.Auth = &Auth{
+			Type: "apikey",
+			APIKey: []AuthAttribute{
+				{Key: "key", Value: apiKeyHeader, Type: "string"},
+				{Key: "value", Value: "{{" + APIKeyVariable + "}}", Type: "string"},
+				{Key: "in", Value: "header", Type: "string"},
+			},
+		}
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	folders := make(map[string]*CollectionItem)
+	var tags []string
+	for _, path := range paths {
+		item := spec.Paths[path]
+		operations := map[string]*openapi.Operation{
+			http.MethodGet:     item.Get,
+			http.MethodPost:    item.Post,
+			http.MethodPut:     item.Put,
+			http.MethodPatch:   item.Patch,
+			http.MethodDelete:  item.Delete,
+			http.MethodOptions: item.Options,
+		}
+		for _, method := range methodOrder {
+			op := operations[method]
+			if op == nil {
+				continue
+			}
+			request, err := t.openAPIRequest(spec, method, path, item.Parameters, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+
+			if len(op.Tags) == 0 {
+				collection.Item = append(collection.Item, request)
+				continue
+			}
+			folder, ok := folders[op.Tags[0]]
+			if !ok {
+				folder = &CollectionItem{Name: op.Tags[0]}
+				folders[op.Tags[0]] = folder
+				tags = append(tags, op.Tags[0])
+			}
+			folder.Item = append(folder.Item, request)
+		}
+	}
+
+	sort.Strings(tags)
+	for _, tag := range tags {
+		collection.Item = append(collection.Item, *folders[tag])
+	}
+	return collection, nil
+}
+
+// openAPIRequest converts an operation to a Postman request
+func (t *Transformer) openAPIRequest(spec *openapi.Spec, method, path string, shared []openapi.Parameter, op *openapi.Operation) (CollectionItem, error) {
+	name := op.Summary
+	if name == "" {
+		name = op.OperationID
+	}
+	if name == "" {
+		name = method + " " + path
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if param, ok := strings.CutPrefix(segment, "{"); ok && strings.HasSuffix(param, "}") {
+			segment = ":" + strings.TrimSuffix(param, "}")
+		}
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	url := &URL{
+		Host: []string{"{{" + BaseURLVariable + "}}"},
+		Path: segments,
+	}
+	request := &Request{
+		Method:      method,
+		URL:         url,
+		Description: op.Description,
+	}
+
+	for _, param := range parameters(shared, op.Parameters) {
+		value := ""
+		if param.Schema != nil && param.Schema.Example != nil {
+			value = fmt.Sprint(param.Schema.Example)
+		}
+		switch param.In {
+		case "path":
+			url.Variable = append(url.Variable, Variable{Key: param.Name, Value: value, Description: param.Description})
+		case "query":
+			url.Query = append(url.Query, KeyValue{Key: param.Name, Value: value, Description: param.Description, Disabled: !param.Required})
+		case "header":
+			request.Header = append(request.Header, Header{Key: param.Name, Value: value, Description: param.Description, Disabled: !param.Required})
+		}
+	}
+
+	raw := "{{" + BaseURLVariable + "}}/" + strings.Join(segments, "/")
+	var query []string
+	for _, q := range url.Query {
+		if !q.Disabled {
+			query = append(query, q.Key+"="+q.Value)
+		}
+	}
+	if len(query) > 0 {
+		raw += "?" + strings.Join(query, "&")
+	}
+	url.Raw = raw
+
+	contentType, body, err := spec.BodyExample(op.RequestBody)
+	if err != nil {
+		return CollectionItem{}, err
+	}
+	if contentType != "" {
+		request.Header = append(request.Header, Header{Key: "Content-Type", Value: contentType})
+	}
+	if body != nil {
+		request.Body = &RequestBody{Mode: "raw", Raw: string(body)}
+		if strings.Contains(contentType, "json") {
+			request.Body.Options = map[string]interface{}{
+				"raw": map[string]interface{}{
+					"language": "json",
+				},
+			}
+		}
+	}
+
+	return CollectionItem{Name: name, Request: request}, nil
+}
+
+// parameters combines the parameters shared by a path with those of one of
+// its operations, which override shared ones of the same name and location
+func parameters(shared, own []openapi.Parameter) []openapi.Parameter {
+	params := append([]openapi.Parameter{}, own...)
+	for _, param := range shared {
+		overridden := false
+		for _, p := range own {
+			if p.Name == param.Name && p.In == param.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// OpenAPIEnvironment creates the environment of a collection generated from
+// an OpenAPI document, pointing it at baseURL. The API key is left for the
+// developer to fill in.
+func (t *Transformer) OpenAPIEnvironment(name, baseURL string) *Environment {
+	now := time.Now().UTC()
+	return &Environment{
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Values: []EnvValue{
+			{Key: BaseURLVariable, Value: strings.TrimSuffix(baseURL, "/"), Type: "default", Enabled: true},
+			{Key: APIKeyVariable, Value: "", Type: "secret", Enabled: true},
+		},
+	}
+}
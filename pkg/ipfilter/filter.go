@@ -0,0 +1,326 @@
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Action decides what happens to a client matching an entry
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+)
+
+var (
+	// ErrNotFound is returned when an entry does not exist
+	ErrNotFound = errors.New("entry not found")
+	// ErrStatic is returned when removing an entry that comes from configuration
+	ErrStatic = errors.New("entry is defined in configuration and cannot be removed")
+)
+
+// Entry is a single allow or deny rule. Entries without a service apply to
+// every request; entries with a service apply only to that service's routes.
+type Entry struct {
+	ID        string     `json:"id"`
+	CIDR      string     `json:"cidr"`
+	Action    Action     `json:"action"`
+	Service   string     `json:"service,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+	Static    bool       `json:"static"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	network *net.IPNet
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// Filter evaluates client addresses against global and per-service lists.
+// Within a scope a matching deny entry always rejects; if the scope has any
+// allow entries, the client must also match one of them.
+type Filter struct {
+	mu      sync.RWMutex
+	entries []*Entry
+	trusted []*net.IPNet
+	logger  *logrus.Logger
+}
+
+// New creates a filter from the global configuration and the per-service lists
+func New(cfg config.IPFilterConfig, services []config.ServiceConfig, logger *logrus.Logger) (*Filter, error) {
+	f := &Filter{logger: logger}
+
+	for _, proxy := range cfg.TrustedProxies {
+		network, err := ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy: %w", err)
+		}
+		f.trusted = append(f.trusted, network)
+	}
+
+	global, err := staticEntries(cfg.Allow, cfg.Deny, "")
+	if err != nil {
+		return nil, err
+	}
+	f.entries = global
+	if err := f.SetServiceLists(services); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SetServiceLists replaces the configured lists of services, e.g. after the
+// configuration is reloaded. Global and runtime entries are kept.
+func (f *Filter) SetServiceLists(services []config.ServiceConfig) error {
+	var static []*Entry
+	for _, svc := range services {
+		if svc.IPFilter == nil {
+			continue
+		}
+		entries, err := staticEntries(svc.IPFilter.Allow, svc.IPFilter.Deny, svc.Name)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		static = append(static, entries...)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kept := make([]*Entry, 0, len(f.entries)+len(static))
+	for _, entry := range f.entries {
+		if !entry.Static || entry.Service == "" {
+			kept = append(kept, entry)
+		}
+	}
+	f.entries = append(kept, static...)
+	return nil
+}
+
+// staticEntries creates the entries of configured allow and deny lists
+func staticEntries(allow, deny []string, service string) ([]*Entry, error) {
+	var entries []*Entry
+	now := time.Now().UTC()
+	lists := []struct {
+		action Action
+		cidrs  []string
+	}{
+		{ActionAllow, allow},
+		{ActionDeny, deny},
+	}
+	for _, list := range lists {
+		for _, cidr := range list.cidrs {
+			network, err := ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, &Entry{
+				ID:        uuid.New().String(),
+				CIDR:      network.String(),
+				Action:    list.action,
+				Service:   service,
+				Static:    true,
+				CreatedAt: now,
+				network:   network,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// Add adds a runtime entry. A positive ttl makes the entry expire, which is
+// how temporary blocks are expressed.
+func (f *Filter) Add(entry Entry, ttl time.Duration) (*Entry, error) {
+	if entry.Action != ActionAllow && entry.Action != ActionDeny {
+		return nil, fmt.Errorf("action must be %q or %q", ActionAllow, ActionDeny)
+	}
+
+	network, err := ParseCIDR(entry.CIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	entry.ID = uuid.New().String()
+	entry.CIDR = network.String()
+	entry.Static = false
+	entry.CreatedAt = now
+	entry.ExpiresAt = nil
+	entry.network = network
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	f.mu.Lock()
+	f.prune(now)
+	f.entries = append(f.entries, &entry)
+	f.mu.Unlock()
+
+	f.logger.WithFields(logrus.Fields{
+		"cidr":    entry.CIDR,
+		"action":  entry.Action,
+		"service": entry.Service,
+		"ttl":     ttl,
+	}).Info("IP filter entry added")
+
+	result := entry
+	return &result, nil
+}
+
+// Remove deletes a runtime entry
+func (f *Filter) Remove(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, entry := range f.entries {
+		if entry.ID != id {
+			continue
+		}
+		if entry.Static {
+			return ErrStatic
+		}
+		f.entries = append(f.entries[:i], f.entries[i+1:]...)
+		f.logger.WithField("cidr", entry.CIDR).Info("IP filter entry removed")
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// List returns all unexpired entries, global entries first
+func (f *Filter) List() []Entry {
+	f.mu.Lock()
+	f.prune(time.Now())
+	entries := make([]Entry, 0, len(f.entries))
+	for _, entry := range f.entries {
+		entries = append(entries, *entry)
+	}
+	f.mu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Service != entries[j].Service {
+			return entries[i].Service < entries[j].Service
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
+
+// prune drops expired entries. Callers must hold the write lock.
+func (f *Filter) prune(now time.Time) {
+	kept := f.entries[:0]
+	for _, entry := range f.entries {
+		if !entry.expired(now) {
+			kept = append(kept, entry)
+		}
+	}
+	for i := len(kept); i < len(f.entries); i++ {
+		f.entries[i] = nil
+	}
+	f.entries = kept
+}
+
+// Allowed reports whether ip may access the given scope. An empty service
+// evaluates the global lists.
+func (f *Filter) Allowed(ip net.IP, service string) bool {
+	now := time.Now()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	hasAllow, allowed := false, false
+	for _, entry := range f.entries {
+		if entry.Service != service || entry.expired(now) {
+			continue
+		}
+		matches := ip != nil && entry.network.Contains(ip)
+		switch entry.Action {
+		case ActionDeny:
+			if matches {
+				return false
+			}
+		case ActionAllow:
+			hasAllow = true
+			allowed = allowed || matches
+		}
+	}
+
+	return !hasAllow || allowed
+}
+
+// ClientIP returns the address of the client that sent the request.
+// X-Forwarded-For is only honoured when the direct peer is a trusted proxy;
+// the header is then walked from the right, skipping further trusted proxies,
+// so clients cannot spoof their address by sending the header themselves.
+func (f *Filter) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+
+	if remote == nil || !f.isTrusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !f.isTrusted(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (f *Filter) isTrusted(ip net.IP) bool {
+	for _, network := range f.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDR parses a CIDR or a single address, which becomes a /32 or /128
+func ParseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		bits := 128
+		if v4 := ip.To4(); v4 != nil {
+			ip, bits = v4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address or CIDR %q", value)
+	}
+	return network, nil
+}
@@ -0,0 +1,41 @@
+package ipfilter
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware rejects clients blocked by the global lists
+func (f *Filter) Middleware() echo.MiddlewareFunc {
+	return f.middleware("")
+}
+
+// ServiceMiddleware rejects clients blocked by a service's lists. It must be
+// registered ahead of the service's authentication middleware.
+func (f *Filter) ServiceMiddleware(service string) echo.MiddlewareFunc {
+	return f.middleware(service)
+}
+
+func (f *Filter) middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := f.ClientIP(c.Request())
+			if f.Allowed(ip, service) {
+				return next(c)
+			}
+
+			fields := logrus.Fields{
+				"ip":  ip.String(),
+				"uri": c.Request().RequestURI,
+			}
+			if service != "" {
+				fields["service"] = service
+			}
+			f.logger.WithFields(fields).Warn("Request blocked by IP filter")
+
+			return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+		}
+	}
+}
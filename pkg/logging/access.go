@@ -0,0 +1,197 @@
+package logging
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"odin/pkg/bufpool"
+	"odin/pkg/requestid"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Access log modes selectable in the logging configuration
+const (
+	AccessLogDefault = "default"
+	AccessLogFast    = "fast"
+	AccessLogOff     = "off"
+)
+
+// AccessLogger writes one line per request, formatted by hand into a pooled
+// buffer, so logging does not allocate on the request path. Lines are JSON
+// objects or the same pipe-separated text the default access log writes.
+type AccessLogger struct {
+	out     io.Writer
+	json    bool
+	headers []string
+	mu      sync.Mutex
+}
+
+// NewAccessLogger creates an access logger writing to out
+func NewAccessLogger(out io.Writer, json bool) *AccessLogger {
+	return &AccessLogger{out: out, json: json}
+}
+
+// LogHeaders adds the values of request headers to every line, under their
+// lowercase names in JSON
+func (l *AccessLogger) LogHeaders(names ...string) {
+	l.headers = append(l.headers, names...)
+}
+
+// Middleware logs every request once the handler chain has responded
+func (l *AccessLogger) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so its status is logged
+				c.Error(err)
+			}
+
+			l.write(c, start, err)
+			return err
+		}
+	}
+}
+
+func (l *AccessLogger) write(c echo.Context, start time.Time, err error) {
+	req := c.Request()
+	res := c.Response()
+	latency := time.Since(start)
+	id := requestid.Get(c)
+
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	b := buf.AvailableBuffer()
+	if l.json {
+		b = append(b, `{"time":"`...)
+		b = start.AppendFormat(b, time.RFC3339)
+		b = append(b, `","remote_ip":`...)
+		b = appendJSONString(b, c.RealIP())
+		b = append(b, `,"method":`...)
+		b = appendJSONString(b, req.Method)
+		b = append(b, `,"uri":`...)
+		b = appendJSONString(b, req.RequestURI)
+		b = append(b, `,"status":`...)
+		b = strconv.AppendInt(b, int64(res.Status), 10)
+		b = append(b, `,"latency_us":`...)
+		b = strconv.AppendInt(b, latency.Microseconds(), 10)
+		b = append(b, `,"bytes_out":`...)
+		b = strconv.AppendInt(b, res.Size, 10)
+		if id != "" {
+			b = append(b, `,"request_id":`...)
+			b = appendJSONString(b, id)
+		}
+		for _, name := range l.headers {
+			b = append(b, ',')
+			b = appendJSONString(b, strings.ToLower(name))
+			b = append(b, ':')
+			b = appendJSONString(b, req.Header.Get(name))
+		}
+		if err != nil {
+			b = append(b, `,"error":`...)
+			b = appendJSONString(b, err.Error())
+		}
+		b = append(b, "}\n"...)
+	} else {
+		b = start.AppendFormat(b, time.RFC3339)
+		b = append(b, " | "...)
+		b = append(b, c.RealIP()...)
+		b = append(b, " | "...)
+		b = append(b, req.Method...)
+		b = append(b, ' ')
+		b = append(b, req.RequestURI...)
+		b = append(b, " | "...)
+		b = strconv.AppendInt(b, int64(res.Status), 10)
+		b = append(b, " | "...)
+		b = appendDuration(b, latency)
+		if id != "" {
+			b = append(b, " | "...)
+			b = append(b, id...)
+		}
+		for _, name := range l.headers {
+			b = append(b, " | "...)
+			b = append(b, req.Header.Get(name)...)
+		}
+		if err != nil {
+			b = append(b, " | "...)
+			b = append(b, err.Error()...)
+		}
+		b = append(b, '\n')
+	}
+	buf.Write(b)
+
+	// One write per line keeps concurrent lines from interleaving
+	l.mu.Lock()
+	l.out.Write(buf.Bytes())
+	l.mu.Unlock()
+}
+
+// appendDuration appends d in the largest unit it reaches, up to seconds
+func appendDuration(b []byte, d time.Duration) []byte {
+	switch {
+	case d < time.Microsecond:
+		b = strconv.AppendInt(b, int64(d), 10)
+		return append(b, "ns"...)
+	case d < time.Millisecond:
+		b = strconv.AppendFloat(b, float64(d)/float64(time.Microsecond), 'f', -1, 64)
+		return append(b, "µs"...)
+	case d < time.Second:
+		b = strconv.AppendFloat(b, float64(d)/float64(time.Millisecond), 'f', 3, 64)
+		return append(b, "ms"...)
+	default:
+		b = strconv.AppendFloat(b, d.Seconds(), 'f', 3, 64)
+		return append(b, 's')
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, s[start:i]...)
+				b = append(b, `\ufffd`...)
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		b = append(b, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		}
+		i++
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
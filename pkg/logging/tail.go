@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Entry is a log entry kept by a Tail
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Tail is a logrus hook keeping the latest entries of a logger and passing
+// new ones to followers, so the logs can be read remotely
+type Tail struct {
+	mu        sync.Mutex
+	entries   []Entry // Ring buffer of the latest entries
+	next      int
+	full      bool
+	followers map[chan Entry]struct{}
+}
+
+// NewTail creates a tail keeping the latest size entries
+func NewTail(size int) *Tail {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Tail{
+		entries:   make([]Entry, size),
+		followers: make(map[chan Entry]struct{}),
+	}
+}
+
+// Levels returns all levels; the logger's own level decides what is kept
+func (t *Tail) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire keeps an entry and passes it to the followers. Followers that are
+// not keeping up miss entries rather than slowing down the code logging.
+func (t *Tail) Fire(entry *logrus.Entry) error {
+	e := Entry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+	if len(entry.Data) > 0 {
+		e.Fields = make(map[string]interface{}, len(entry.Data))
+		for key, value := range entry.Data {
+			e.Fields[key] = fieldValue(value)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[t.next] = e
+	t.next = (t.next + 1) % len(t.entries)
+	t.full = t.full || t.next == 0
+	for follower := range t.followers {
+		select {
+		case follower <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+// Recent returns up to n of the latest entries, oldest first
+func (t *Tail) Recent(n int) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.recent(n)
+}
+
+// Follow returns up to n of the latest entries, and a channel receiving the
+// entries logged after them until stop is called
+func (t *Tail) Follow(n, buffer int) (recent []Entry, entries <-chan Entry, stop func()) {
+	follower := make(chan Entry, buffer)
+	t.mu.Lock()
+	recent = t.recent(n)
+	t.followers[follower] = struct{}{}
+	t.mu.Unlock()
+
+	var once sync.Once
+	return recent, follower, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.followers, follower)
+			t.mu.Unlock()
+		})
+	}
+}
+
+func (t *Tail) recent(n int) []Entry {
+	count := t.next
+	if t.full {
+		count = len(t.entries)
+	}
+	n = max(0, min(n, count))
+	entries := make([]Entry, 0, n)
+	for i := n; i > 0; i-- {
+		entries = append(entries, t.entries[(t.next-i+len(t.entries))%len(t.entries)])
+	}
+	return entries
+}
+
+// fieldValue keeps values JSON can encode as they are, and turns the others,
+// such as errors, into strings
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64, nil:
+		return v
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v
+	}
+	return fmt.Sprint(v)
+}
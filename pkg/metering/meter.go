@@ -0,0 +1,254 @@
+package metering
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Store keeps usage records, e.g. the MongoDB repository
+type Store interface {
+	AddUsageRecord(ctx context.Context, record *mongodb.UsageRecordDocument) error
+	QueryUsageRecords(ctx context.Context, query mongodb.UsageRecordQuery) ([]*mongodb.UsageRecordDocument, error)
+}
+
+// recordKey identifies the requests counted into one usage record
+type recordKey struct {
+	periodStart time.Time
+	keyID       string
+	service     string
+}
+
+type usage struct {
+	userID   string
+	plan     string
+	requests int64
+	errors   int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+// Meter counts the requests and bytes of each API key per service and saves
+// them as usage records once their period has ended
+type Meter struct {
+	cfg    config.MeteringConfig
+	store  Store
+	logger *logrus.Logger
+
+	mu        sync.Mutex
+	counts    map[recordKey]*usage
+	publisher events.Publisher
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewMeter creates a meter and starts saving usage records
+func NewMeter(cfg config.MeteringConfig, store Store, logger *logrus.Logger) *Meter {
+	m := &Meter{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		counts: make(map[recordKey]*usage),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go m.flushLoop(ctx)
+
+	return m
+}
+
+// SetEventPublisher publishes a usage.recorded event with the records saved
+// for each period, so billing systems can subscribe to them
+func (m *Meter) SetEventPublisher(publisher events.Publisher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publisher = publisher
+}
+
+// Stop stops the meter and saves what has been counted so far, including the
+// current period
+func (m *Meter) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Middleware counts the requests to service. Requests made with an API key
+// are counted towards the key; others are counted with an empty key.
+func (m *Meter) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			now := time.Now()
+			body := &countingReader{ReadCloser: c.Request().Body}
+			if c.Request().Body != nil {
+				c.Request().Body = body
+			}
+
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+
+			key := recordKey{periodStart: now.UTC().Truncate(m.cfg.Period), service: service}
+			var userID, plan string
+			if apiKey, ok := c.Get("apiKey").(*mongodb.APIKeyDocument); ok {
+				key.keyID = apiKey.ID
+				userID = apiKey.UserID
+				plan = apiKey.Plan
+			}
+			m.record(key, userID, plan, status >= 400, body.n, c.Response().Size)
+			return err
+		}
+	}
+}
+
+func (m *Meter) record(key recordKey, userID, plan string, failed bool, bytesIn, bytesOut int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.counts[key]
+	if !ok {
+		u = &usage{userID: userID, plan: plan}
+		m.counts[key] = u
+	}
+	u.requests++
+	if failed {
+		u.errors++
+	}
+	u.bytesIn += bytesIn
+	u.bytesOut += bytesOut
+}
+
+// countingReader counts the bytes of a request body as it is read
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (m *Meter) flushLoop(ctx context.Context) {
+	defer m.wg.Done()
+
+	for {
+		// Save each period shortly after it ends
+		now := time.Now()
+		next := now.UTC().Truncate(m.cfg.Period).Add(m.cfg.Period)
+		timer := time.NewTimer(next.Sub(now) + time.Second)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			m.flush(time.Time{}) // Final flush
+			return
+		case <-timer.C:
+			m.flush(next)
+		}
+	}
+}
+
+// flush saves the counts of the periods that started before before, or of
+// every period when before is zero
+func (m *Meter) flush(before time.Time) {
+	m.mu.Lock()
+	taken := make(map[recordKey]*usage)
+	for key, u := range m.counts {
+		if before.IsZero() || key.periodStart.Before(before) {
+			taken[key] = u
+			delete(m.counts, key)
+		}
+	}
+	publisher := m.publisher
+	m.mu.Unlock()
+
+	if len(taken) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	periods := make(map[time.Time][]*mongodb.UsageRecordDocument)
+	for key, u := range taken {
+		record := m.newRecord(key, u)
+		if err := m.store.AddUsageRecord(ctx, record); err != nil {
+			m.logger.WithError(err).WithFields(logrus.Fields{
+				"service": key.service,
+				"keyId":   key.keyID,
+			}).Error("Failed to save usage record")
+		}
+		periods[key.periodStart] = append(periods[key.periodStart], record)
+	}
+
+	if publisher == nil {
+		return
+	}
+	for start, records := range periods {
+		sortRecords(records)
+		publisher.Publish(events.UsageRecorded, map[string]interface{}{
+			"periodStart": start,
+			"periodEnd":   start.Add(m.cfg.Period),
+			"records":     records,
+		})
+	}
+}
+
+func (m *Meter) newRecord(key recordKey, u *usage) *mongodb.UsageRecordDocument {
+	id := sha256.Sum256([]byte(key.periodStart.Format(time.RFC3339) + "|" + key.keyID + "|" + key.service))
+	record := &mongodb.UsageRecordDocument{
+		ID:          hex.EncodeToString(id[:16]),
+		PeriodStart: key.periodStart,
+		PeriodEnd:   key.periodStart.Add(m.cfg.Period),
+		KeyID:       key.keyID,
+		UserID:      u.userID,
+		Plan:        u.plan,
+		Service:     key.service,
+		Requests:    u.requests,
+		Errors:      u.errors,
+		BytesIn:     u.bytesIn,
+		BytesOut:    u.bytesOut,
+	}
+	if m.cfg.Retention > 0 {
+		record.TTL = record.PeriodEnd.Add(m.cfg.Retention)
+	}
+	return record
+}
+
+// Query returns the usage records matching query
+func (m *Meter) Query(ctx context.Context, query mongodb.UsageRecordQuery) ([]*mongodb.UsageRecordDocument, error) {
+	return m.store.QueryUsageRecords(ctx, query)
+}
+
+func sortRecords(records []*mongodb.UsageRecordDocument) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.PeriodStart.Equal(b.PeriodStart) {
+			return a.PeriodStart.Before(b.PeriodStart)
+		}
+		if a.KeyID != b.KeyID {
+			return a.KeyID < b.KeyID
+		}
+		return a.Service < b.Service
+	})
+}
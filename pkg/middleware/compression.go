@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"odin/pkg/config"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+// encoder is a compressor that can be reused for another response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressionMiddleware compresses responses with the encoding clients
+// prefer among br, zstd and gzip. Responses smaller than the minimum size,
+// already encoded or of already compressed types such as images are sent as
+// they are.
+func CompressionMiddleware(cfg config.CompressionConfig) echo.MiddlewareFunc {
+	encodings := cfg.Encodings
+	if len(encodings) == 0 {
+		encodings = []string{"br", "zstd", "gzip"}
+	}
+	minSize := cfg.MinSize
+	if minSize == 0 {
+		minSize = 1024
+	}
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() interface{} {
+			level := cfg.GzipLevel
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			w, _ := gzip.NewWriterLevel(io.Discard, level)
+			return w
+		}},
+		"br": {New: func() interface{} {
+			level := cfg.BrotliLevel
+			if level == 0 {
+				level = 4
+			}
+			return brotli.NewWriterLevel(io.Discard, level)
+		}},
+		"zstd": {New: func() interface{} {
+			level := cfg.ZstdLevel
+			if level == 0 {
+				level = 3
+			}
+			w, _ := zstd.NewWriter(io.Discard,
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+				zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding), encodings)
+			if encoding == "" || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+			w := &compressWriter{
+				ResponseWriter: res.Writer,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				minSize:        minSize,
+			}
+			res.Writer = w
+			defer func() {
+				w.finish()
+				res.Writer = w.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding returns the encoding of supported the client gives the
+// highest quality, preferring the earliest on ties, or "" if it accepts none
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the status and the first minSize bytes of a
+// response until it knows whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	minSize  int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	encoder encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+	// Responses without a body, ranges and responses that already have an
+	// encoding go as they are
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusPartialContent ||
+		status == http.StatusNotModified || w.Header().Get(echo.HeaderContentEncoding) != "" {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.buf.Write(p)
+		if w.buf.Len() >= w.minSize {
+			if err := w.start(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what is held back uncompressed if compression has not started,
+// since streamed responses should not wait for minSize bytes
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.send(false); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response does not support hijacking")
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start compresses the response if its type is worth compressing
+func (w *compressWriter) start() error {
+	contentType := w.Header().Get(echo.HeaderContentType)
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf.Bytes())
+	}
+	return w.send(compressible(contentType))
+}
+
+// send writes the status held back and what is buffered, compressed or not
+func (w *compressWriter) send(compress bool) error {
+	w.decide(compress)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	_, err := w.Write(data)
+	return err
+}
+
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	header := w.Header()
+	if compress {
+		header.Set(echo.HeaderContentEncoding, w.encoding)
+		header.Del(echo.HeaderContentLength)
+		header.Del("Accept-Ranges")
+		w.encoder = w.pool.Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+	if compress || w.buf.Len() > 0 {
+		header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// finish sends a response that stayed under minSize and completes the
+// compressed stream
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			return // Nothing was written, e.g. a hijacked connection
+		}
+		w.send(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+// compressible reports whether a response of contentType is worth
+// compressing; images, audio, video, archives and fonts already are
+func compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-brotli", "application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/pdf", "application/octet-stream":
+		return false
+	}
+	return true
+}
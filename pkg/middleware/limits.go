@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"odin/pkg/config"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestLimitsMiddleware rejects requests whose URL or headers exceed the
+// configured limits. It only inspects what the server has already parsed and
+// never reads the body, so it should be registered with Echo#Pre to run
+// before routing, plugins and buffering.
+func RequestLimitsMiddleware(limits config.RequestLimits, logger *logrus.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			if reason := checkURL(req, limits); reason != "" {
+				logger.WithFields(logrus.Fields{
+					"ip":     c.RealIP(),
+					"reason": reason,
+				}).Warn("Request rejected by URL limits")
+				return echo.NewHTTPError(http.StatusRequestURITooLong, "Request URI too long")
+			}
+
+			if reason := checkHeaders(req, limits); reason != "" {
+				logger.WithFields(logrus.Fields{
+					"ip":     c.RealIP(),
+					"uri":    truncate(req.RequestURI, 256),
+					"reason": reason,
+				}).Warn("Request rejected by header limits")
+				return echo.NewHTTPError(http.StatusRequestHeaderFieldsTooLarge, "Request header fields too large")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func checkURL(req *http.Request, limits config.RequestLimits) string {
+	uri := req.RequestURI
+	if uri == "" {
+		uri = req.URL.RequestURI()
+	}
+	if limits.MaxURLLength > 0 && len(uri) > limits.MaxURLLength {
+		return "url length"
+	}
+
+	// Count parameters without parsing the query string
+	if limits.MaxQueryParams > 0 && req.URL.RawQuery != "" {
+		params := 0
+		for _, part := range strings.Split(req.URL.RawQuery, "&") {
+			if part != "" {
+				params++
+			}
+		}
+		if params > limits.MaxQueryParams {
+			return "query parameter count"
+		}
+	}
+
+	return ""
+}
+
+func checkHeaders(req *http.Request, limits config.RequestLimits) string {
+	if limits.MaxHeaderCount == 0 && limits.MaxHeaderSize == 0 && limits.MaxHeaderBytes == 0 {
+		return ""
+	}
+
+	count, total := 0, 0
+	for name, values := range req.Header {
+		for _, value := range values {
+			// name + ": " + value + CRLF, as sent on the wire
+			size := len(name) + len(value) + 4
+			if limits.MaxHeaderSize > 0 && len(name)+len(value) > limits.MaxHeaderSize {
+				return "header size"
+			}
+			count++
+			total += size
+		}
+	}
+
+	if limits.MaxHeaderCount > 0 && count > limits.MaxHeaderCount {
+		return "header count"
+	}
+	if limits.MaxHeaderBytes > 0 && total > limits.MaxHeaderBytes {
+		return "total header size"
+	}
+	return ""
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max] + "..."
+}
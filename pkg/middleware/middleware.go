@@ -74,7 +74,11 @@ func CacheMiddleware(store cache.Store, logger *logrus.Logger) echo.MiddlewareFu
 
 			err := next(c)
 
-			if err == nil {
+			// Responses meant for a single client, such as a developer's
+			// own API keys, are never shared, and event streams cannot be
+			// replayed
+			header := c.Response().Header()
+			if err == nil && !private(header.Get("Cache-Control")) && !strings.HasPrefix(header.Get(echo.HeaderContentType), "text/event-stream") {
 				cacheEntry := &cache.CacheEntry{
 					Headers:    make(map[string]string),
 					StatusCode: resWriter.statusCode,
@@ -100,6 +104,18 @@ func CacheMiddleware(store cache.Store, logger *logrus.Logger) echo.MiddlewareFu
 	}
 }
 
+// private reports whether a Cache-Control header forbids shared caches from
+// storing the response
+func private(cacheControl string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-store", "private":
+			return true
+		}
+	}
+	return false
+}
+
 type responseWriterWrapper struct {
 	http.ResponseWriter
 	statusCode int
@@ -121,6 +137,11 @@ func (w *responseWriterWrapper) Header() http.Header {
 	return w.ResponseWriter.Header()
 }
 
+// Unwrap lets streamed responses be flushed through the cache
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func generateCacheKey(c echo.Context) string {
 	req := c.Request()
 
@@ -138,5 +159,5 @@ func generateCacheKey(c echo.Context) string {
 
 	hasher := sha256.New()
 	hasher.Write([]byte(strings.Join(keyParts, "|")))
-	return hex.EncodeToString(hasher.Sum(nil))
+	return cache.ResponseKey(req.URL.Path, hex.EncodeToString(hasher.Sum(nil)))
 }
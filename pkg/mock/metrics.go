@@ -0,0 +1,14 @@
+package mock
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var mockResponses = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_mock_responses_total",
+		Help: "Total number of responses made up by the gateway for mocked services",
+	},
+	[]string{"service", "source"},
+)
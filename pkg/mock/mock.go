@@ -0,0 +1,218 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderMock marks responses made up by the gateway
+const HeaderMock = "X-Odin-Mock"
+
+// route is a compiled canned response
+type route struct {
+	config.MockRouteConfig
+	segments []string
+}
+
+// Mocker answers the requests of a mocked service
+type Mocker struct {
+	service string
+	cfg     config.MockConfig
+	routes  []*route
+	spec    *openapi.Validator
+}
+
+// NewMocker creates the mocker of a service. spec provides the examples
+// answered with fromSpec; it may be nil otherwise.
+func NewMocker(service string, cfg config.MockConfig, spec *openapi.Validator) *Mocker {
+	m := &Mocker{service: service, cfg: cfg, spec: spec}
+	for _, rc := range cfg.Routes {
+		m.routes = append(m.routes, &route{MockRouteConfig: rc, segments: splitPath(rc.Path)})
+	}
+	return m
+}
+
+// Middleware answers requests with their mock response. Requests without
+// one are proxied when the mock passes them through, and answered with 404
+// otherwise.
+func (m *Mocker) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			answered, err := m.serve(c)
+			if answered || err != nil {
+				return err
+			}
+			if m.cfg.Passthrough {
+				return next(c)
+			}
+			return m.notFound(c)
+		}
+	}
+}
+
+// Handle answers requests of a mocked service that has no targets
+func (m *Mocker) Handle(c echo.Context) error {
+	answered, err := m.serve(c)
+	if answered || err != nil {
+		return err
+	}
+	return m.notFound(c)
+}
+
+func (m *Mocker) notFound(c echo.Context) error {
+	req := c.Request()
+	return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("No mock response for %s %s", req.Method, req.URL.Path))
+}
+
+// serve writes the mock response of the request, if it has one. Canned
+// routes win over the examples of the spec.
+func (m *Mocker) serve(c echo.Context) (bool, error) {
+	req := c.Request()
+
+	if rt := m.match(req.Method, req.URL.Path); rt != nil {
+		latency := m.cfg.Latency
+		if rt.Latency != nil {
+			latency = *rt.Latency
+		}
+		if err := m.wait(c, latency); err != nil {
+			return true, err
+		}
+
+		header := c.Response().Header()
+		for name, value := range rt.Headers {
+			header.Set(name, value)
+		}
+		header.Set(HeaderMock, "true")
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		mockResponses.WithLabelValues(m.service, "route").Inc()
+		if rt.Body == "" {
+			return true, c.NoContent(status)
+		}
+		contentType := header.Get(echo.HeaderContentType)
+		if contentType == "" {
+			contentType = echo.MIMETextPlainCharsetUTF8
+			if json.Valid([]byte(rt.Body)) {
+				contentType = echo.MIMEApplicationJSON
+			}
+		}
+		return true, c.Blob(status, contentType, []byte(rt.Body))
+	}
+
+	if !m.cfg.FromSpec || m.spec == nil {
+		return false, nil
+	}
+
+	code, name := preference(req.Header.Get("Prefer"))
+	example, matched, err := m.spec.Example(req.Method, req.URL.Path, code, name)
+	if !matched {
+		return false, nil
+	}
+	if err != nil {
+		return true, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := m.wait(c, m.cfg.Latency); err != nil {
+		return true, err
+	}
+
+	c.Response().Header().Set(HeaderMock, "true")
+	mockResponses.WithLabelValues(m.service, "spec").Inc()
+	if example.Body == nil {
+		return true, c.NoContent(example.Status)
+	}
+	return true, c.Blob(example.Status, example.ContentType, example.Body)
+}
+
+// wait delays the response by latency plus jitter, unless the client goes
+// away first
+func (m *Mocker) wait(c echo.Context, latency time.Duration) error {
+	if m.cfg.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(m.cfg.Jitter) + 1))
+	}
+	if latency <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.Request().Context().Done():
+		return c.Request().Context().Err()
+	}
+}
+
+// match finds the canned route of a request. Routes with more literal
+// segments win, so /users/me is preferred over /users/{id}.
+func (m *Mocker) match(method, path string) *route {
+	segments := splitPath(path)
+
+	var best *route
+	bestLiterals := -1
+	for _, rt := range m.routes {
+		if rt.Method != "" && !strings.EqualFold(rt.Method, method) {
+			continue
+		}
+		if len(rt.segments) != len(segments) {
+			continue
+		}
+
+		literals := 0
+		matched := true
+		for i, segment := range rt.segments {
+			if isTemplate(segment) {
+				continue
+			}
+			if segment != segments[i] {
+				matched = false
+				break
+			}
+			literals++
+		}
+		if matched && literals > bestLiterals {
+			best, bestLiterals = rt, literals
+		}
+	}
+	return best
+}
+
+// preference reads the status and example a client asks for in a Prefer
+// header, such as "code=404" or "example=empty"
+func preference(prefer string) (code int, example string) {
+	for _, part := range strings.Split(prefer, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "code":
+			code, _ = strconv.Atoi(value)
+		case "example":
+			example = value
+		}
+	}
+	return code, example
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func isTemplate(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
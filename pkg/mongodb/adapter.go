@@ -8,6 +8,8 @@ import (
 	"odin/pkg/config"
 
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
 )
 
 // ServiceAdapter adapts between config.ServiceConfig and mongodb.ServiceDocument
@@ -42,13 +44,33 @@ func (a *ServiceAdapter) LoadServices(ctx context.Context) ([]config.ServiceConf
 	return services, nil
 }
 
-// SaveService saves a service to MongoDB
+// LoadAllServices loads every service from MongoDB, including disabled ones
+func (a *ServiceAdapter) LoadAllServices(ctx context.Context) ([]config.ServiceConfig, error) {
+	docs, err := a.repo.ListServices(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load services from MongoDB: %w", err)
+	}
+
+	services := make([]config.ServiceConfig, 0, len(docs))
+	for _, doc := range docs {
+		services = append(services, a.documentToConfig(doc))
+	}
+	return services, nil
+}
+
+// SaveService saves a service to MongoDB, in the namespace ctx is scoped to
+// or else in the service's own
 func (a *ServiceAdapter) SaveService(ctx context.Context, svc *config.ServiceConfig) error {
 	doc := a.configToDocument(svc)
+	if namespace, ok := NamespaceFromContext(ctx); ok {
+		doc.Namespace = namespace
+	} else {
+		ctx = InNamespace(ctx, doc.Namespace)
+	}
 
 	// Check if service exists
 	existing, err := a.repo.GetServiceByName(ctx, svc.Name)
-	if err == nil && existing != nil {
+	if err == nil && existing != nil && existing.Namespace == doc.Namespace {
 		// Update existing service
 		return a.repo.UpdateService(ctx, existing.ID, doc)
 	}
@@ -87,6 +109,7 @@ func (a *ServiceAdapter) UpdateService(ctx context.Context, name string, svc *co
 
 	updated := a.configToDocument(svc)
 	updated.ID = doc.ID
+	updated.Namespace = doc.Namespace
 	updated.CreatedAt = doc.CreatedAt
 
 	return a.repo.UpdateService(ctx, doc.ID, updated)
@@ -96,6 +119,7 @@ func (a *ServiceAdapter) UpdateService(ctx context.Context, name string, svc *co
 func (a *ServiceAdapter) documentToConfig(doc *ServiceDocument) config.ServiceConfig {
 	svc := config.ServiceConfig{
 		Name:           doc.Name,
+		Namespace:      doc.Namespace,
 		BasePath:       doc.BasePath,
 		Targets:        doc.Targets,
 		StripBasePath:  doc.StripBasePath,
@@ -114,6 +138,31 @@ func (a *ServiceAdapter) documentToConfig(doc *ServiceDocument) config.ServiceCo
 			Request:  convertTransformRules(doc.Transform["request"]),
 			Response: convertTransformRules(doc.Transform["response"]),
 		}
+		if x, ok := doc.Transform["xml"].(map[string]interface{}); ok {
+			keepNamespaces, _ := x["keepNamespaces"].(bool)
+			svc.Transform.XML = &config.XMLTransformConfig{
+				Request:         getString(x, "request"),
+				Response:        getString(x, "response"),
+				AttributePrefix: getString(x, "attributePrefix"),
+				TextKey:         getString(x, "textKey"),
+				KeepNamespaces:  keepNamespaces,
+				Namespace:       getString(x, "namespace"),
+				RootElement:     getString(x, "rootElement"),
+				ContentType:     getString(x, "contentType"),
+			}
+		}
+		if templates, ok := doc.Transform["templates"].([]interface{}); ok {
+			for _, t := range templates {
+				if tm, ok := t.(map[string]interface{}); ok {
+					svc.Transform.Templates = append(svc.Transform.Templates, config.TemplateTransformConfig{
+						Method:   getString(tm, "method"),
+						Path:     getString(tm, "path"),
+						Request:  getString(tm, "request"),
+						Response: getString(tm, "response"),
+					})
+				}
+			}
+		}
 	}
 
 	// Convert aggregation config
@@ -134,6 +183,21 @@ func (a *ServiceAdapter) documentToConfig(doc *ServiceDocument) config.ServiceCo
 			HealthyThreshold:   int(hc["healthyThreshold"].(int64)),
 			InsecureSkipVerify: hc["insecureSkipVerify"].(bool),
 		}
+		if probe, ok := hc["type"].(string); ok {
+			svc.HealthCheck.Type = probe
+		}
+		if grpcService, ok := hc["grpcService"].(string); ok {
+			svc.HealthCheck.GRPCService = grpcService
+		}
+		if passive, ok := hc["passive"].(bool); ok {
+			svc.HealthCheck.Passive = &config.PassiveHealthConfig{Enabled: passive}
+			if failures, ok := hc["passiveFailures"].(int64); ok {
+				svc.HealthCheck.Passive.Failures = int(failures)
+			}
+			if decay, ok := hc["passiveDecay"].(int64); ok {
+				svc.HealthCheck.Passive.Decay = time.Duration(decay) * time.Millisecond
+			}
+		}
 		if expectedStatus, ok := hc["expectedStatus"].([]interface{}); ok {
 			statuses := make([]int, 0, len(expectedStatus))
 			for _, s := range expectedStatus {
@@ -150,6 +214,7 @@ func (a *ServiceAdapter) documentToConfig(doc *ServiceDocument) config.ServiceCo
 func (a *ServiceAdapter) configToDocument(svc *config.ServiceConfig) *ServiceDocument {
 	doc := &ServiceDocument{
 		Name:           svc.Name,
+		Namespace:      svc.Namespace,
 		BasePath:       svc.BasePath,
 		Targets:        svc.Targets,
 		StripBasePath:  svc.StripBasePath,
@@ -165,11 +230,35 @@ func (a *ServiceAdapter) configToDocument(svc *config.ServiceConfig) *ServiceDoc
 	}
 
 	// Convert transform config
-	if len(svc.Transform.Request) > 0 || len(svc.Transform.Response) > 0 {
+	if len(svc.Transform.Request) > 0 || len(svc.Transform.Response) > 0 || svc.Transform.XML != nil || len(svc.Transform.Templates) > 0 {
 		doc.Transform = map[string]interface{}{
 			"request":  transformRulesToMap(svc.Transform.Request),
 			"response": transformRulesToMap(svc.Transform.Response),
 		}
+		if x := svc.Transform.XML; x != nil {
+			doc.Transform["xml"] = map[string]interface{}{
+				"request":         x.Request,
+				"response":        x.Response,
+				"attributePrefix": x.AttributePrefix,
+				"textKey":         x.TextKey,
+				"keepNamespaces":  x.KeepNamespaces,
+				"namespace":       x.Namespace,
+				"rootElement":     x.RootElement,
+				"contentType":     x.ContentType,
+			}
+		}
+		if len(svc.Transform.Templates) > 0 {
+			templates := make([]interface{}, 0, len(svc.Transform.Templates))
+			for _, t := range svc.Transform.Templates {
+				templates = append(templates, map[string]interface{}{
+					"method":   t.Method,
+					"path":     t.Path,
+					"request":  t.Request,
+					"response": t.Response,
+				})
+			}
+			doc.Transform["templates"] = templates
+		}
 	}
 
 	// Convert aggregation config
@@ -187,6 +276,17 @@ func (a *ServiceAdapter) configToDocument(svc *config.ServiceConfig) *ServiceDoc
 			"healthyThreshold":   svc.HealthCheck.HealthyThreshold,
 			"insecureSkipVerify": svc.HealthCheck.InsecureSkipVerify,
 		}
+		if svc.HealthCheck.Type != "" {
+			doc.HealthCheck["type"] = svc.HealthCheck.Type
+		}
+		if svc.HealthCheck.GRPCService != "" {
+			doc.HealthCheck["grpcService"] = svc.HealthCheck.GRPCService
+		}
+		if passive := svc.HealthCheck.Passive; passive != nil {
+			doc.HealthCheck["passive"] = passive.Enabled
+			doc.HealthCheck["passiveFailures"] = int64(passive.Failures)
+			doc.HealthCheck["passiveDecay"] = int64(passive.Decay / time.Millisecond)
+		}
 		if len(svc.HealthCheck.ExpectedStatus) > 0 {
 			statuses := make([]int, len(svc.HealthCheck.ExpectedStatus))
 			copy(statuses, svc.HealthCheck.ExpectedStatus)
@@ -366,10 +466,14 @@ func NewConfigManager(repo Repository, logger *logrus.Logger) *ConfigManager {
 
 // SaveConfig saves the current configuration to MongoDB
 func (m *ConfigManager) SaveConfig(ctx context.Context, cfg *config.Config, version string) error {
+	data, err := ConfigToMap(cfg)
+	if err != nil {
+		return err
+	}
 	doc := &ConfigDocument{
 		Version: version,
 		Active:  true,
-		Config:  configToMap(cfg),
+		Config:  data,
 	}
 
 	if err := m.repo.SaveConfig(ctx, doc); err != nil {
@@ -380,6 +484,37 @@ func (m *ConfigManager) SaveConfig(ctx context.Context, cfg *config.Config, vers
 	return nil
 }
 
+// RecordCommit saves the configuration applied from a Git commit as the active version
+func (m *ConfigManager) RecordCommit(ctx context.Context, cfg *config.Config, commitSHA, source string) error {
+	version := commitSHA
+	if len(version) > 12 {
+		version = version[:12]
+	}
+
+	data, err := ConfigToMap(cfg)
+	if err != nil {
+		return err
+	}
+	doc := &ConfigDocument{
+		Version:   version,
+		Active:    true,
+		Config:    data,
+		CreatedBy: source,
+		Source:    source,
+		CommitSHA: commitSHA,
+	}
+
+	if err := m.repo.SaveConfig(ctx, doc); err != nil {
+		return fmt.Errorf("failed to record config commit: %w", err)
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"version": version,
+		"source":  source,
+	}).Info("Applied configuration commit recorded in MongoDB")
+	return nil
+}
+
 // GetActiveConfig retrieves the active configuration
 func (m *ConfigManager) GetActiveConfig(ctx context.Context) (*config.Config, error) {
 	doc, err := m.repo.GetActiveConfig(ctx)
@@ -387,25 +522,67 @@ func (m *ConfigManager) GetActiveConfig(ctx context.Context) (*config.Config, er
 		return nil, err
 	}
 
-	cfg := mapToConfig(doc.Config)
+	cfg, err := MapToConfig(doc.Config)
+	if err != nil {
+		return nil, err
+	}
 	m.logger.WithField("version", doc.Version).Info("Loaded active configuration from MongoDB")
 	return cfg, nil
 }
 
-// Helper function to convert config to map (simplified - you may need to expand this)
-func configToMap(cfg *config.Config) map[string]interface{} {
-	// This is a simplified version - in production, you'd want full serialization
-	return map[string]interface{}{
-		"server":  cfg.Server,
-		"logging": cfg.Logging,
-		// Add other fields as needed
+// ConfigToMap converts a configuration to the document stored for its version
+func ConfigToMap(cfg *config.Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to convert config: %w", err)
+	}
+	return m, nil
+}
+
+// MapToConfig converts the document stored for a configuration version back
+// to the configuration
+func MapToConfig(data map[string]interface{}) (*config.Config, error) {
+	raw, err := yaml.Marshal(plainValue(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config document: %w", err)
 	}
+	var cfg config.Config
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config document: %w", err)
+	}
+	return &cfg, nil
 }
 
-// Helper function to convert map to config (simplified)
-func mapToConfig(data map[string]interface{}) *config.Config {
-	// This is a simplified version - in production, you'd want full deserialization
-	cfg := &config.Config{}
-	// Populate fields from data
-	return cfg
+// plainValue converts the documents and arrays BSON decodes to maps and slices
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case primitive.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = plainValue(e.Value)
+		}
+		return m
+	case primitive.M:
+		return plainValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = plainValue(e)
+		}
+		return m
+	case primitive.A:
+		return plainValue([]interface{}(v))
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = plainValue(e)
+		}
+		return s
+	default:
+		return v
+	}
 }
@@ -0,0 +1,47 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type namespaceKey struct{}
+
+// WithNamespace scopes the service operations run with the returned context
+// to namespace: they only see and change the services of that namespace, and
+// services created with it belong to it. An empty namespace leaves ctx
+// unscoped, giving access to the services of every namespace.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	if namespace == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// InNamespace scopes ctx like WithNamespace, except that the empty
+// namespace scopes it to the default namespace, the services without one
+func InNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NamespaceFromContext returns the namespace ctx is scoped to
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	namespace, ok := ctx.Value(namespaceKey{}).(string)
+	return namespace, ok
+}
+
+// scoped restricts filter to the namespace of ctx, if any
+func scoped(ctx context.Context, filter bson.M) bson.M {
+	namespace, ok := NamespaceFromContext(ctx)
+	if !ok {
+		return filter
+	}
+	if namespace == "" {
+		// Services of the default namespace are stored without the field
+		filter["namespace"] = bson.M{"$in": bson.A{"", nil}}
+		return filter
+	}
+	filter["namespace"] = namespace
+	return filter
+}
@@ -136,10 +136,13 @@ func createTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
 
 // createIndexes creates necessary indexes
 func (r *repository) createIndexes(ctx context.Context) error {
-	// Services indexes
+	// Services indexes; names are unique per namespace. The unique name
+	// index of earlier versions is dropped first, ignoring that it may be
+	// gone already.
 	servicesCol := r.database.Collection(ServicesCollection)
+	_, _ = servicesCol.Indexes().DropOne(ctx, "name_1")
 	_, err := servicesCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
-		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "namespace", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
 		{Keys: bson.D{{Key: "enabled", Value: 1}}},
 		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
 	})
@@ -243,6 +246,81 @@ func (r *repository) createIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create audit logs indexes: %w", err)
 	}
 
+	// Event dead letters indexes with TTL
+	deadLettersCol := r.database.Collection(DeadLettersCollection)
+	_, err = deadLettersCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "eventType", Value: 1}}},
+		{Keys: bson.D{{Key: "ttl", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create event dead letters indexes: %w", err)
+	}
+
+	// Usage records indexes; records only expire when they carry a TTL
+	usageCol := r.database.Collection(UsageRecordsCollection)
+	_, err = usageCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "periodStart", Value: 1}}},
+		{Keys: bson.D{{Key: "keyId", Value: 1}, {Key: "periodStart", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "periodStart", Value: 1}}},
+		{Keys: bson.D{{Key: "ttl", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create usage records indexes: %w", err)
+	}
+
+	// Consumers indexes; a credential may only belong to one consumer
+	consumersCol := r.database.Collection(ConsumersCollection)
+	_, err = consumersCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "apiKeyIds", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "certFingerprints", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "jwtSubjects", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		{Keys: bson.D{{Key: "hmacKeys.id", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumers indexes: %w", err)
+	}
+
+	// Async jobs indexes; jobs expire with their results
+	asyncJobsCol := r.database.Collection(AsyncJobsCollection)
+	_, err = asyncJobsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "ttl", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create async jobs indexes: %w", err)
+	}
+
+	// Job runs indexes; runs expire after the scheduler's history TTL
+	jobRunsCol := r.database.Collection(JobRunsCollection)
+	_, err = jobRunsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "startedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "ttl", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job runs indexes: %w", err)
+	}
+
+	// Revocations indexes; revocations without an expiry are kept
+	revocationsCol := r.database.Collection(RevocationsCollection)
+	_, err = revocationsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create revocations indexes: %w", err)
+	}
+
+	// Refresh tokens indexes; tokens are deleted once they expire
+	refreshTokensCol := r.database.Collection(RefreshTokensCollection)
+	_, err = refreshTokensCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sessionId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create refresh tokens indexes: %w", err)
+	}
+
 	return nil
 }
 
@@ -251,9 +329,15 @@ func (r *repository) createIndexes(ctx context.Context) error {
 func (r *repository) CreateService(ctx context.Context, service *ServiceDocument) error {
 	service.CreatedAt = time.Now()
 	service.UpdatedAt = time.Now()
+	if namespace, ok := NamespaceFromContext(ctx); ok {
+		service.Namespace = namespace
+	}
 
 	col := r.database.Collection(ServicesCollection)
 	_, err := col.InsertOne(ctx, service)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to create service: %w", ErrDuplicate)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
@@ -266,7 +350,7 @@ func (r *repository) GetService(ctx context.Context, id string) (*ServiceDocumen
 	col := r.database.Collection(ServicesCollection)
 
 	var service ServiceDocument
-	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&service)
+	err := col.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&service)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, fmt.Errorf("service not found: %s", id)
@@ -281,7 +365,7 @@ func (r *repository) GetServiceByName(ctx context.Context, name string) (*Servic
 	col := r.database.Collection(ServicesCollection)
 
 	var service ServiceDocument
-	err := col.FindOne(ctx, bson.M{"name": name}).Decode(&service)
+	err := col.FindOne(ctx, scoped(ctx, bson.M{"name": name})).Decode(&service)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, fmt.Errorf("service not found: %s", name)
@@ -295,7 +379,7 @@ func (r *repository) GetServiceByName(ctx context.Context, name string) (*Servic
 func (r *repository) ListServices(ctx context.Context, enabled *bool) ([]*ServiceDocument, error) {
 	col := r.database.Collection(ServicesCollection)
 
-	filter := bson.M{}
+	filter := scoped(ctx, bson.M{})
 	if enabled != nil {
 		filter["enabled"] = *enabled
 	}
@@ -316,13 +400,19 @@ func (r *repository) ListServices(ctx context.Context, enabled *bool) ([]*Servic
 
 func (r *repository) UpdateService(ctx context.Context, id string, service *ServiceDocument) error {
 	service.UpdatedAt = time.Now()
+	if namespace, ok := NamespaceFromContext(ctx); ok {
+		service.Namespace = namespace
+	}
 
 	col := r.database.Collection(ServicesCollection)
 	result, err := col.UpdateOne(
 		ctx,
-		bson.M{"_id": id},
+		scoped(ctx, bson.M{"_id": id}),
 		bson.M{"$set": service},
 	)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to update service: %w", ErrDuplicate)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update service: %w", err)
 	}
@@ -337,7 +427,7 @@ func (r *repository) UpdateService(ctx context.Context, id string, service *Serv
 
 func (r *repository) DeleteService(ctx context.Context, id string) error {
 	col := r.database.Collection(ServicesCollection)
-	result, err := col.DeleteOne(ctx, bson.M{"_id": id})
+	result, err := col.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id}))
 	if err != nil {
 		return fmt.Errorf("failed to delete service: %w", err)
 	}
@@ -699,6 +789,9 @@ func (n *noopRepository) GetRateLimit(ctx context.Context, key string) (*RateLim
 func (n *noopRepository) UpdateRateLimit(ctx context.Context, limit *RateLimitDocument) error {
 	return nil
 }
+func (n *noopRepository) ListRateLimits(ctx context.Context, prefix string, expiresAfter time.Time) ([]*RateLimitDocument, error) {
+	return nil, nil
+}
 func (n *noopRepository) GetCache(ctx context.Context, key string) (*CacheDocument, error) {
 	return nil, fmt.Errorf("MongoDB is disabled")
 }
@@ -714,6 +807,105 @@ func (n *noopRepository) CreateAuditLog(ctx context.Context, log *AuditLogDocume
 func (n *noopRepository) QueryAuditLogs(ctx context.Context, userID string, start, end time.Time) ([]*AuditLogDocument, error) {
 	return nil, nil
 }
+func (n *noopRepository) CreateDeadLetter(ctx context.Context, letter *DeadLetterDocument) error {
+	return nil
+}
+func (n *noopRepository) GetDeadLetter(ctx context.Context, id string) (*DeadLetterDocument, error) {
+	return nil, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) ListDeadLetters(ctx context.Context, limit int) ([]*DeadLetterDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) DeleteDeadLetter(ctx context.Context, id string) error {
+	return nil
+}
+func (n *noopRepository) GetACMEDocument(ctx context.Context, id string) (*ACMEDocument, error) {
+	return nil, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) SaveACMEDocument(ctx context.Context, doc *ACMEDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) AddUsageRecord(ctx context.Context, record *UsageRecordDocument) error {
+	return nil
+}
+func (n *noopRepository) QueryUsageRecords(ctx context.Context, query UsageRecordQuery) ([]*UsageRecordDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) CreateConsumer(ctx context.Context, consumer *ConsumerDocument) error {
+	return nil
+}
+func (n *noopRepository) GetConsumer(ctx context.Context, id string) (*ConsumerDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) ListConsumers(ctx context.Context) ([]*ConsumerDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) UpdateConsumer(ctx context.Context, id string, consumer *ConsumerDocument) error {
+	return nil
+}
+func (n *noopRepository) DeleteConsumer(ctx context.Context, id string) error {
+	return nil
+}
+func (n *noopRepository) CreateAsyncJob(ctx context.Context, job *AsyncJobDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) GetAsyncJob(ctx context.Context, id string) (*AsyncJobDocument, error) {
+	return nil, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) ClaimAsyncJob(ctx context.Context, id string, leaseUntil time.Time) (*AsyncJobDocument, error) {
+	return nil, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) FinishAsyncJob(ctx context.Context, job *AsyncJobDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) ListRunnableAsyncJobs(ctx context.Context, limit int) ([]*AsyncJobDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) ListScheduledJobs(ctx context.Context) ([]*ScheduledJobDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) SaveScheduledJob(ctx context.Context, job *ScheduledJobDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) DeleteScheduledJob(ctx context.Context, name string) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) CreateJobRun(ctx context.Context, run *JobRunDocument) error {
+	return nil
+}
+func (n *noopRepository) FinishJobRun(ctx context.Context, run *JobRunDocument) error {
+	return nil
+}
+func (n *noopRepository) ListJobRuns(ctx context.Context, job string, limit int) ([]*JobRunDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) AcquireLock(ctx context.Context, name, owner string, until time.Time) (bool, error) {
+	return false, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) ReleaseLock(ctx context.Context, name, owner string) error {
+	return nil
+}
+func (n *noopRepository) SaveRevocation(ctx context.Context, revocation *RevocationDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) ListRevocations(ctx context.Context) ([]*RevocationDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) DeleteRevocation(ctx context.Context, id string) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) CreateRefreshToken(ctx context.Context, token *RefreshTokenDocument) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) GetRefreshToken(ctx context.Context, id string) (*RefreshTokenDocument, error) {
+	return nil, nil
+}
+func (n *noopRepository) RevokeRefreshToken(ctx context.Context, id string) (bool, error) {
+	return false, fmt.Errorf("MongoDB is disabled")
+}
+func (n *noopRepository) RevokeRefreshTokens(ctx context.Context, sessionID string) error {
+	return fmt.Errorf("MongoDB is disabled")
+}
 func (n *noopRepository) Ping(ctx context.Context) error {
 	return fmt.Errorf("MongoDB is disabled")
 }
@@ -3,6 +3,7 @@ package mongodb
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -106,13 +107,23 @@ func (r *repository) ResolveAlert(ctx context.Context, id string) error {
 
 // Health check operations
 
+// SaveHealthCheck stores a health check result, replacing the one with the
+// same ID. CheckedAt defaults to now and TTL to 24 hours after it.
 func (r *repository) SaveHealthCheck(ctx context.Context, check *HealthCheckDocument) error {
-	check.CheckedAt = time.Now()
-	// Set TTL to 24 hours from now
-	check.TTL = time.Now().Add(24 * time.Hour)
+	if check.CheckedAt.IsZero() {
+		check.CheckedAt = time.Now()
+	}
+	if check.TTL.IsZero() {
+		check.TTL = check.CheckedAt.Add(24 * time.Hour)
+	}
 
 	col := r.database.Collection(HealthChecksCollection)
-	_, err := col.InsertOne(ctx, check)
+	var err error
+	if check.ID == "" {
+		_, err = col.InsertOne(ctx, check)
+	} else {
+		_, err = col.ReplaceOne(ctx, bson.M{"_id": check.ID}, check, options.Replace().SetUpsert(true))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to save health check: %w", err)
 	}
@@ -350,6 +361,9 @@ func (r *repository) CreateUser(ctx context.Context, user *UserDocument) error {
 
 	col := r.database.Collection(UsersCollection)
 	_, err := col.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to create user: %w", ErrDuplicate)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -572,6 +586,29 @@ func (r *repository) UpdateRateLimit(ctx context.Context, limit *RateLimitDocume
 	return nil
 }
 
+// ListRateLimits returns the rate limits whose keys start with prefix and
+// whose windows end after expiresAfter
+func (r *repository) ListRateLimits(ctx context.Context, prefix string, expiresAfter time.Time) ([]*RateLimitDocument, error) {
+	col := r.database.Collection(RateLimitsCollection)
+
+	filter := bson.M{
+		"key":       bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+		"expiresAt": bson.M{"$gt": expiresAfter},
+	}
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rate limits: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var limits []*RateLimitDocument
+	if err := cursor.All(ctx, &limits); err != nil {
+		return nil, fmt.Errorf("failed to decode rate limits: %w", err)
+	}
+
+	return limits, nil
+}
+
 // Cache operations
 
 func (r *repository) GetCache(ctx context.Context, key string) (*CacheDocument, error) {
@@ -672,3 +709,607 @@ func (r *repository) QueryAuditLogs(ctx context.Context, userID string, start, e
 
 	return logs, nil
 }
+
+// Event dead-letter operations
+
+func (r *repository) CreateDeadLetter(ctx context.Context, letter *DeadLetterDocument) error {
+	letter.CreatedAt = time.Now()
+	// Set TTL to 30 days from now
+	letter.TTL = time.Now().Add(30 * 24 * time.Hour)
+
+	col := r.database.Collection(DeadLettersCollection)
+	_, err := col.InsertOne(ctx, letter)
+	if err != nil {
+		return fmt.Errorf("failed to create dead letter: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetDeadLetter(ctx context.Context, id string) (*DeadLetterDocument, error) {
+	col := r.database.Collection(DeadLettersCollection)
+
+	var letter DeadLetterDocument
+	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&letter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("dead letter not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return &letter, nil
+}
+
+func (r *repository) ListDeadLetters(ctx context.Context, limit int) ([]*DeadLetterDocument, error) {
+	col := r.database.Collection(DeadLettersCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := col.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var letters []*DeadLetterDocument
+	if err := cursor.All(ctx, &letters); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letters: %w", err)
+	}
+
+	return letters, nil
+}
+
+func (r *repository) DeleteDeadLetter(ctx context.Context, id string) error {
+	col := r.database.Collection(DeadLettersCollection)
+	result, err := col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("dead letter not found: %s", id)
+	}
+
+	return nil
+}
+
+// ACME certificate operations
+
+func (r *repository) GetACMEDocument(ctx context.Context, id string) (*ACMEDocument, error) {
+	col := r.database.Collection(ACMECollection)
+
+	var doc ACMEDocument
+	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ACME document: %w", err)
+	}
+
+	return &doc, nil
+}
+
+func (r *repository) SaveACMEDocument(ctx context.Context, doc *ACMEDocument) error {
+	doc.UpdatedAt = time.Now()
+
+	col := r.database.Collection(ACMECollection)
+	opts := options.Replace().SetUpsert(true)
+	_, err := col.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, opts)
+	if err != nil {
+		return fmt.Errorf("failed to save ACME document: %w", err)
+	}
+
+	return nil
+}
+
+// Usage record operations
+
+func (r *repository) AddUsageRecord(ctx context.Context, record *UsageRecordDocument) error {
+	set := bson.M{"updatedAt": time.Now()}
+	if !record.TTL.IsZero() {
+		set["ttl"] = record.TTL
+	}
+
+	col := r.database.Collection(UsageRecordsCollection)
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"periodStart": record.PeriodStart,
+			"periodEnd":   record.PeriodEnd,
+			"keyId":       record.KeyID,
+			"userId":      record.UserID,
+			"plan":        record.Plan,
+			"service":     record.Service,
+		},
+		"$inc": bson.M{
+			"requests": record.Requests,
+			"errors":   record.Errors,
+			"bytesIn":  record.BytesIn,
+			"bytesOut": record.BytesOut,
+		},
+		"$set": set,
+	}
+	_, err := col.UpdateOne(ctx, bson.M{"_id": record.ID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to add usage record: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) QueryUsageRecords(ctx context.Context, query UsageRecordQuery) ([]*UsageRecordDocument, error) {
+	col := r.database.Collection(UsageRecordsCollection)
+
+	filter := bson.M{
+		"periodStart": bson.M{
+			"$gte": query.From,
+			"$lt":  query.To,
+		},
+	}
+	if query.KeyID != "" {
+		filter["keyId"] = query.KeyID
+	}
+	if query.UserID != "" {
+		filter["userId"] = query.UserID
+	}
+	if query.Service != "" {
+		filter["service"] = query.Service
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "periodStart", Value: 1}, {Key: "keyId", Value: 1}, {Key: "service", Value: 1}})
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []*UsageRecordDocument
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode usage records: %w", err)
+	}
+
+	return records, nil
+}
+
+// Consumer operations
+
+func (r *repository) CreateConsumer(ctx context.Context, consumer *ConsumerDocument) error {
+	consumer.CreatedAt = time.Now()
+	consumer.UpdatedAt = consumer.CreatedAt
+
+	col := r.database.Collection(ConsumersCollection)
+	_, err := col.InsertOne(ctx, consumer)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to create consumer: %w", ErrDuplicate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	r.logger.WithField("username", consumer.Username).Info("Consumer created in MongoDB")
+	return nil
+}
+
+func (r *repository) GetConsumer(ctx context.Context, id string) (*ConsumerDocument, error) {
+	col := r.database.Collection(ConsumersCollection)
+
+	var consumer ConsumerDocument
+	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&consumer)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer: %w", err)
+	}
+
+	return &consumer, nil
+}
+
+func (r *repository) ListConsumers(ctx context.Context) ([]*ConsumerDocument, error) {
+	col := r.database.Collection(ConsumersCollection)
+
+	cursor, err := col.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consumers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var consumers []*ConsumerDocument
+	if err := cursor.All(ctx, &consumers); err != nil {
+		return nil, fmt.Errorf("failed to decode consumers: %w", err)
+	}
+
+	return consumers, nil
+}
+
+// UpdateConsumer replaces the stored consumer with consumer
+func (r *repository) UpdateConsumer(ctx context.Context, id string, consumer *ConsumerDocument) error {
+	consumer.ID = id
+	consumer.UpdatedAt = time.Now()
+
+	col := r.database.Collection(ConsumersCollection)
+	result, err := col.ReplaceOne(ctx, bson.M{"_id": id}, consumer)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to update consumer: %w", ErrDuplicate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update consumer: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("consumer %s: %w", id, ErrNotFound)
+	}
+
+	r.logger.WithField("username", consumer.Username).Info("Consumer updated in MongoDB")
+	return nil
+}
+
+func (r *repository) DeleteConsumer(ctx context.Context, id string) error {
+	col := r.database.Collection(ConsumersCollection)
+	result, err := col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete consumer: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("consumer %s: %w", id, ErrNotFound)
+	}
+
+	r.logger.WithField("id", id).Info("Consumer deleted from MongoDB")
+	return nil
+}
+
+// Async job operations
+
+func (r *repository) CreateAsyncJob(ctx context.Context, job *AsyncJobDocument) error {
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+
+	col := r.database.Collection(AsyncJobsCollection)
+	if _, err := col.InsertOne(ctx, job); err != nil {
+		return fmt.Errorf("failed to create async job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetAsyncJob(ctx context.Context, id string) (*AsyncJobDocument, error) {
+	col := r.database.Collection(AsyncJobsCollection)
+
+	var job AsyncJobDocument
+	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get async job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// runnableAsyncJobs selects the jobs nobody runs: pending ones, and running
+// ones whose gateway stopped before finishing them
+func runnableAsyncJobs(now time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"status": AsyncJobPending},
+		{"status": AsyncJobRunning, "leaseUntil": bson.M{"$lt": now}},
+	}}
+}
+
+func (r *repository) ClaimAsyncJob(ctx context.Context, id string, leaseUntil time.Time) (*AsyncJobDocument, error) {
+	col := r.database.Collection(AsyncJobsCollection)
+
+	now := time.Now()
+	filter := runnableAsyncJobs(now)
+	filter["_id"] = id
+	update := bson.M{
+		"$set": bson.M{"status": AsyncJobRunning, "leaseUntil": leaseUntil, "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job AsyncJobDocument
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim async job: %w", err)
+	}
+
+	return &job, nil
+}
+
+func (r *repository) FinishAsyncJob(ctx context.Context, job *AsyncJobDocument) error {
+	job.UpdatedAt = time.Now()
+
+	col := r.database.Collection(AsyncJobsCollection)
+	update := bson.M{"$set": bson.M{
+		"status":         job.Status,
+		"responseStatus": job.ResponseStatus,
+		"responseHeader": job.ResponseHeader,
+		"responseBody":   job.ResponseBody,
+		"error":          job.Error,
+		"updatedAt":      job.UpdatedAt,
+		"completedAt":    job.CompletedAt,
+		"ttl":            job.TTL,
+	}}
+	result, err := col.UpdateOne(ctx, bson.M{"_id": job.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to finish async job: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("async job %s: %w", job.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (r *repository) ListRunnableAsyncJobs(ctx context.Context, limit int) ([]*AsyncJobDocument, error) {
+	col := r.database.Collection(AsyncJobsCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := col.Find(ctx, runnableAsyncJobs(time.Now()), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list async jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []*AsyncJobDocument
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode async jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Scheduler operations
+
+func (r *repository) ListScheduledJobs(ctx context.Context) ([]*ScheduledJobDocument, error) {
+	col := r.database.Collection(ScheduledJobsCollection)
+
+	cursor, err := col.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []*ScheduledJobDocument
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode scheduled jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func (r *repository) SaveScheduledJob(ctx context.Context, job *ScheduledJobDocument) error {
+	now := time.Now()
+	job.UpdatedAt = now
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+
+	col := r.database.Collection(ScheduledJobsCollection)
+	opts := options.Replace().SetUpsert(true)
+	if _, err := col.ReplaceOne(ctx, bson.M{"_id": job.Name}, job, opts); err != nil {
+		return fmt.Errorf("failed to save scheduled job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteScheduledJob(ctx context.Context, name string) error {
+	col := r.database.Collection(ScheduledJobsCollection)
+	result, err := col.DeleteOne(ctx, bson.M{"_id": name})
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled job: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("scheduled job %s: %w", name, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (r *repository) CreateJobRun(ctx context.Context, run *JobRunDocument) error {
+	col := r.database.Collection(JobRunsCollection)
+	if _, err := col.InsertOne(ctx, run); err != nil {
+		return fmt.Errorf("failed to create job run: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) FinishJobRun(ctx context.Context, run *JobRunDocument) error {
+	col := r.database.Collection(JobRunsCollection)
+	update := bson.M{"$set": bson.M{
+		"status":     run.Status,
+		"output":     run.Output,
+		"error":      run.Error,
+		"finishedAt": run.FinishedAt,
+	}}
+	result, err := col.UpdateOne(ctx, bson.M{"_id": run.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to finish job run: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("job run %s: %w", run.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListJobRuns returns the latest runs of job, or of every job when job is
+// empty, newest first
+func (r *repository) ListJobRuns(ctx context.Context, job string, limit int) ([]*JobRunDocument, error) {
+	col := r.database.Collection(JobRunsCollection)
+
+	filter := bson.M{}
+	if job != "" {
+		filter["job"] = job
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var runs []*JobRunDocument
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("failed to decode job runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// AcquireLock upserts the lock when owner holds it or its lease expired.
+// When another owner holds it, the filter matches nothing and the upsert
+// collides with the existing document.
+func (r *repository) AcquireLock(ctx context.Context, name, owner string, until time.Time) (bool, error) {
+	col := r.database.Collection(LocksCollection)
+
+	filter := bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"owner": owner},
+			{"expiresAt": bson.M{"$lt": time.Now()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": until}}
+	_, err := col.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *repository) ReleaseLock(ctx context.Context, name, owner string) error {
+	col := r.database.Collection(LocksCollection)
+	if _, err := col.DeleteOne(ctx, bson.M{"_id": name, "owner": owner}); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+// Revocation operations
+
+func (r *repository) SaveRevocation(ctx context.Context, revocation *RevocationDocument) error {
+	col := r.database.Collection(RevocationsCollection)
+	opts := options.Replace().SetUpsert(true)
+	if _, err := col.ReplaceOne(ctx, bson.M{"_id": revocation.ID}, revocation, opts); err != nil {
+		return fmt.Errorf("failed to save revocation: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevocations filters out expired revocations, which MongoDB only
+// deletes about once a minute
+func (r *repository) ListRevocations(ctx context.Context) ([]*RevocationDocument, error) {
+	col := r.database.Collection(RevocationsCollection)
+
+	filter := bson.M{"$or": []bson.M{
+		{"expiresAt": bson.M{"$exists": false}},
+		{"expiresAt": bson.M{"$gt": time.Now()}},
+	}}
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revocations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var revocations []*RevocationDocument
+	if err := cursor.All(ctx, &revocations); err != nil {
+		return nil, fmt.Errorf("failed to decode revocations: %w", err)
+	}
+
+	return revocations, nil
+}
+
+func (r *repository) DeleteRevocation(ctx context.Context, id string) error {
+	col := r.database.Collection(RevocationsCollection)
+	result, err := col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete revocation: %w", err)
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("revocation %s: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Refresh token operations
+
+func (r *repository) CreateRefreshToken(ctx context.Context, token *RefreshTokenDocument) error {
+	col := r.database.Collection(RefreshTokensCollection)
+	if _, err := col.InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetRefreshToken(ctx context.Context, id string) (*RefreshTokenDocument, error) {
+	col := r.database.Collection(RefreshTokensCollection)
+
+	var token RefreshTokenDocument
+	err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// RevokeRefreshToken only matches tokens not revoked yet, so of concurrent
+// refreshes with the same token a single one succeeds
+func (r *repository) RevokeRefreshToken(ctx context.Context, id string) (bool, error) {
+	col := r.database.Collection(RefreshTokensCollection)
+	result, err := col.UpdateOne(ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (r *repository) RevokeRefreshTokens(ctx context.Context, sessionID string) error {
+	col := r.database.Collection(RefreshTokensCollection)
+	_, err := col.UpdateMany(ctx,
+		bson.M{"sessionId": sessionID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
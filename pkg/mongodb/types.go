@@ -2,6 +2,7 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -37,25 +38,43 @@ type AuthConfig struct {
 
 // Collections defines MongoDB collection names
 const (
-	ServicesCollection     = "services"
-	ConfigCollection       = "config"
-	MetricsCollection      = "metrics"
-	TracesCollection       = "traces"
-	AlertsCollection       = "alerts"
-	HealthChecksCollection = "health_checks"
-	ClustersCollection     = "clusters"
-	PluginsCollection      = "plugins"
-	UsersCollection        = "users"
-	APIKeysCollection      = "api_keys"
-	RateLimitsCollection   = "rate_limits"
-	CacheCollection        = "cache"
-	AuditLogsCollection    = "audit_logs"
+	ServicesCollection      = "services"
+	ConfigCollection        = "config"
+	MetricsCollection       = "metrics"
+	TracesCollection        = "traces"
+	AlertsCollection        = "alerts"
+	HealthChecksCollection  = "health_checks"
+	ClustersCollection      = "clusters"
+	PluginsCollection       = "plugins"
+	UsersCollection         = "users"
+	APIKeysCollection       = "api_keys"
+	RateLimitsCollection    = "rate_limits"
+	CacheCollection         = "cache"
+	AuditLogsCollection     = "audit_logs"
+	DeadLettersCollection   = "event_dead_letters"
+	ACMECollection          = "acme_certificates"
+	UsageRecordsCollection  = "usage_records"
+	ConsumersCollection     = "consumers"
+	AsyncJobsCollection     = "async_jobs"
+	ScheduledJobsCollection = "scheduled_jobs"
+	JobRunsCollection       = "job_runs"
+	LocksCollection         = "locks"
+	RevocationsCollection   = "revocations"
+	RefreshTokensCollection = "admin_refresh_tokens"
 )
 
+// ErrDuplicate is returned when a document conflicts with a unique index,
+// such as a user with a taken username or email
+var ErrDuplicate = errors.New("document already exists")
+
+// ErrNotFound is returned when a document to update or delete does not exist
+var ErrNotFound = errors.New("document not found")
+
 // ServiceDocument represents a service in MongoDB
 type ServiceDocument struct {
 	ID             string                 `bson:"_id,omitempty" json:"id"`
 	Name           string                 `bson:"name" json:"name"`
+	Namespace      string                 `bson:"namespace,omitempty" json:"namespace,omitempty"` // Names are unique per namespace
 	BasePath       string                 `bson:"basePath" json:"basePath"`
 	Targets        []string               `bson:"targets" json:"targets"`
 	StripBasePath  bool                   `bson:"stripBasePath" json:"stripBasePath"`
@@ -77,13 +96,16 @@ type ServiceDocument struct {
 
 // ConfigDocument represents gateway configuration in MongoDB
 type ConfigDocument struct {
-	ID        string                 `bson:"_id,omitempty" json:"id"`
-	Version   string                 `bson:"version" json:"version"`
-	Config    map[string]interface{} `bson:"config" json:"config"`
-	Active    bool                   `bson:"active" json:"active"`
-	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time              `bson:"updatedAt" json:"updatedAt"`
-	CreatedBy string                 `bson:"createdBy" json:"createdBy"`
+	ID           string                 `bson:"_id,omitempty" json:"id"`
+	Version      string                 `bson:"version" json:"version"`
+	Config       map[string]interface{} `bson:"config" json:"config"`
+	Active       bool                   `bson:"active" json:"active"`
+	CreatedAt    time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time              `bson:"updatedAt" json:"updatedAt"`
+	CreatedBy    string                 `bson:"createdBy" json:"createdBy"`
+	Source       string                 `bson:"source,omitempty" json:"source,omitempty"`             // admin, gitops, migration, backup, rollback
+	CommitSHA    string                 `bson:"commitSha,omitempty" json:"commitSha,omitempty"`       // Git commit the config was applied from
+	RestoredFrom string                 `bson:"restoredFrom,omitempty" json:"restoredFrom,omitempty"` // Version a rollback restored
 }
 
 // MetricDocument represents a metric entry in MongoDB
@@ -193,6 +215,7 @@ type UserDocument struct {
 	Role      string    `bson:"role" json:"role"`         // admin, user, viewer
 	Active    bool      `bson:"active" json:"active"`
 	APIKeys   []string  `bson:"apiKeys" json:"apiKeys"`
+	Plans     []string  `bson:"plans,omitempty" json:"plans,omitempty"` // Plans the user may subscribe keys to in the developer portal, as product/plan
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 	LastLogin time.Time `bson:"lastLogin" json:"lastLogin"`
@@ -211,6 +234,32 @@ type APIKeyDocument struct {
 	CreatedAt   time.Time         `bson:"createdAt" json:"createdAt"`
 	LastUsed    time.Time         `bson:"lastUsed" json:"lastUsed"`
 	Metadata    map[string]string `bson:"metadata" json:"metadata"`
+	// Plan the key is subscribed to, as product/plan; its rate limit and
+	// quota apply to the key, and only its product's services accept it
+	Plan string `bson:"plan,omitempty" json:"plan,omitempty"`
+	// Client identities the key is bound to; a key with pins is rejected
+	// unless the request's TLS connection matches one of each kind
+	CertFingerprints []string `bson:"certFingerprints,omitempty" json:"certFingerprints,omitempty"` // SHA-256 of the client certificate
+	JA3Fingerprints  []string `bson:"ja3Fingerprints,omitempty" json:"ja3Fingerprints,omitempty"`   // JA3 of the TLS client
+	// Approval state of keys requested for plans that need approval; only
+	// approved keys authenticate. Keys without a status are approved.
+	Status       string     `bson:"status,omitempty" json:"status,omitempty"`
+	ReviewedBy   string     `bson:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt   *time.Time `bson:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	RejectReason string     `bson:"rejectReason,omitempty" json:"rejectReason,omitempty"`
+}
+
+// Approval states of an API key
+const (
+	APIKeyPending  = "pending"
+	APIKeyApproved = "approved"
+	APIKeyRejected = "rejected"
+)
+
+// Approved reports whether the key may authenticate as far as its approval
+// is concerned
+func (k *APIKeyDocument) Approved() bool {
+	return k.Status == "" || k.Status == APIKeyApproved
 }
 
 // RateLimitDocument represents rate limit state in MongoDB
@@ -246,12 +295,171 @@ type AuditLogDocument struct {
 	TTL       time.Time              `bson:"ttl" json:"ttl"`
 }
 
+// DeadLetterDocument records an event delivery that failed after all retries
+type DeadLetterDocument struct {
+	ID         string                 `bson:"_id,omitempty" json:"id"`
+	EventID    string                 `bson:"eventId" json:"eventId"`
+	EventType  string                 `bson:"eventType" json:"eventType"`
+	Webhook    string                 `bson:"webhook" json:"webhook"`
+	URL        string                 `bson:"url" json:"url"`
+	Payload    map[string]interface{} `bson:"payload" json:"payload"`
+	Attempts   int                    `bson:"attempts" json:"attempts"`
+	LastStatus int                    `bson:"lastStatus,omitempty" json:"lastStatus,omitempty"`
+	LastError  string                 `bson:"lastError" json:"lastError"`
+	CreatedAt  time.Time              `bson:"createdAt" json:"createdAt"`
+	TTL        time.Time              `bson:"ttl" json:"ttl"`
+}
+
+// UsageRecordDocument holds the requests and bytes of one API key to one
+// service during a metering period. Gateways add their counts to the same
+// record, so it holds the totals of all of them.
+type UsageRecordDocument struct {
+	ID          string    `bson:"_id" json:"id"` // Derived from the period, key and service
+	PeriodStart time.Time `bson:"periodStart" json:"periodStart"`
+	PeriodEnd   time.Time `bson:"periodEnd" json:"periodEnd"`
+	KeyID       string    `bson:"keyId" json:"keyId"` // Empty for requests without an API key
+	UserID      string    `bson:"userId" json:"userId"`
+	Plan        string    `bson:"plan,omitempty" json:"plan,omitempty"`
+	Service     string    `bson:"service" json:"service"`
+	Requests    int64     `bson:"requests" json:"requests"`
+	Errors      int64     `bson:"errors" json:"errors"`
+	BytesIn     int64     `bson:"bytesIn" json:"bytesIn"`
+	BytesOut    int64     `bson:"bytesOut" json:"bytesOut"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+	TTL         time.Time `bson:"ttl,omitempty" json:"-"`
+}
+
+// UsageRecordQuery selects usage records whose period starts in [From, To).
+// Empty fields match any record.
+type UsageRecordQuery struct {
+	From    time.Time
+	To      time.Time
+	KeyID   string
+	UserID  string
+	Service string
+}
+
+// Async job statuses
+const (
+	AsyncJobPending   = "pending"
+	AsyncJobRunning   = "running"
+	AsyncJobCompleted = "completed"
+	AsyncJobFailed    = "failed"
+)
+
+// AsyncJobDocument is a request accepted with 202 whose upstream call runs
+// in the background, with its result once it has one
+type AsyncJobDocument struct {
+	ID          string                 `bson:"_id" json:"id"`
+	Service     string                 `bson:"service" json:"service"`
+	Status      string                 `bson:"status" json:"status"`
+	Method      string                 `bson:"method" json:"method"`
+	Host        string                 `bson:"host" json:"-"`
+	Path        string                 `bson:"path" json:"path"`
+	Query       string                 `bson:"query,omitempty" json:"-"`
+	Header      map[string][]string    `bson:"header,omitempty" json:"-"`
+	Body        []byte                 `bson:"body,omitempty" json:"-"`
+	RemoteAddr  string                 `bson:"remoteAddr" json:"-"`
+	Claims      map[string]interface{} `bson:"claims,omitempty" json:"-"` // JWT claims of the client that made the request
+	RequestID   string                 `bson:"requestId,omitempty" json:"requestId,omitempty"`
+	CallbackURL string                 `bson:"callbackUrl,omitempty" json:"-"`
+	Attempts    int                    `bson:"attempts" json:"attempts"`
+	LeaseUntil  time.Time              `bson:"leaseUntil,omitempty" json:"-"` // A running job whose lease expired is run again
+	// Result
+	ResponseStatus int                 `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	ResponseHeader map[string][]string `bson:"responseHeader,omitempty" json:"-"`
+	ResponseBody   []byte              `bson:"responseBody,omitempty" json:"-"`
+	Error          string              `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time           `bson:"updatedAt" json:"updatedAt"`
+	CompletedAt    time.Time           `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	TTL            time.Time           `bson:"ttl" json:"-"`
+}
+
+// ScheduledJobDocument is a scheduler job added through the admin API
+type ScheduledJobDocument struct {
+	Name      string                 `bson:"_id" json:"name"`
+	Schedule  string                 `bson:"schedule" json:"schedule"`
+	Task      string                 `bson:"task" json:"task"`
+	Params    map[string]interface{} `bson:"params,omitempty" json:"params,omitempty"`
+	Timeout   string                 `bson:"timeout,omitempty" json:"timeout,omitempty"` // Duration such as 5m
+	Disabled  bool                   `bson:"disabled" json:"disabled"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time              `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Job run statuses
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// JobRunDocument records one run of a scheduler job
+type JobRunDocument struct {
+	ID         string    `bson:"_id" json:"id"`
+	Job        string    `bson:"job" json:"job"`
+	Task       string    `bson:"task" json:"task"`
+	Trigger    string    `bson:"trigger" json:"trigger"` // schedule or manual
+	Owner      string    `bson:"owner" json:"owner"`     // Gateway instance that ran the job
+	Status     string    `bson:"status" json:"status"`
+	Output     string    `bson:"output,omitempty" json:"output,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time `bson:"startedAt" json:"startedAt"`
+	FinishedAt time.Time `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	TTL        time.Time `bson:"ttl" json:"-"`
+}
+
+// LockDocument is a lease on a named lock, held by Owner until ExpiresAt
+// unless renewed
+type LockDocument struct {
+	Name      string    `bson:"_id" json:"name"`
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// RevocationDocument revokes a JWT by its jti, every token of a subject
+// issued before RevokedAt, or an API key by its ID
+type RevocationDocument struct {
+	ID        string    `bson:"_id" json:"id"` // kind:value
+	Kind      string    `bson:"kind" json:"kind"`
+	Value     string    `bson:"value" json:"value"`
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	RevokedBy string    `bson:"revokedBy,omitempty" json:"revokedBy,omitempty"`
+	RevokedAt time.Time `bson:"revokedAt" json:"revokedAt"`
+	ExpiresAt time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"` // Revocations without one are kept until deleted
+}
+
+// RefreshTokenDocument is a refresh token of an admin session, stored by
+// the hash of the token. Refreshing revokes it and issues a new one in the
+// same session.
+type RefreshTokenDocument struct {
+	ID        string    `bson:"_id" json:"id"` // Hex SHA-256 of the token
+	SessionID string    `bson:"sessionId" json:"sessionId"`
+	Username  string    `bson:"username" json:"username"`
+	Role      string    `bson:"role" json:"role"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt time.Time `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// ACMEDocument stores an ACME account key or an issued certificate with its key
+type ACMEDocument struct {
+	ID        string    `bson:"_id" json:"id"` // Domain name, or "account" for the account key
+	Domains   []string  `bson:"domains,omitempty" json:"domains,omitempty"`
+	CertPEM   string    `bson:"certPem,omitempty" json:"-"`
+	KeyPEM    string    `bson:"keyPem" json:"-"`
+	NotAfter  time.Time `bson:"notAfter,omitempty" json:"notAfter,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
 // Repository defines the interface for MongoDB operations
 type Repository interface {
 	// Database access
 	GetDatabase() *mongo.Database
 
-	// Service operations
+	// Service operations; with a context scoped by WithNamespace they only
+	// see and change the services of that namespace
 	CreateService(ctx context.Context, service *ServiceDocument) error
 	GetService(ctx context.Context, id string) (*ServiceDocument, error)
 	GetServiceByName(ctx context.Context, name string) (*ServiceDocument, error)
@@ -318,6 +526,7 @@ type Repository interface {
 	// Rate limit operations
 	GetRateLimit(ctx context.Context, key string) (*RateLimitDocument, error)
 	UpdateRateLimit(ctx context.Context, limit *RateLimitDocument) error
+	ListRateLimits(ctx context.Context, prefix string, expiresAfter time.Time) ([]*RateLimitDocument, error)
 
 	// Cache operations
 	GetCache(ctx context.Context, key string) (*CacheDocument, error)
@@ -328,7 +537,107 @@ type Repository interface {
 	CreateAuditLog(ctx context.Context, log *AuditLogDocument) error
 	QueryAuditLogs(ctx context.Context, userID string, start, end time.Time) ([]*AuditLogDocument, error)
 
+	// Event dead-letter operations
+	CreateDeadLetter(ctx context.Context, letter *DeadLetterDocument) error
+	GetDeadLetter(ctx context.Context, id string) (*DeadLetterDocument, error)
+	ListDeadLetters(ctx context.Context, limit int) ([]*DeadLetterDocument, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
+
+	// ACME certificate operations. GetACMEDocument returns nil without an
+	// error when the document does not exist.
+	GetACMEDocument(ctx context.Context, id string) (*ACMEDocument, error)
+	SaveACMEDocument(ctx context.Context, doc *ACMEDocument) error
+
+	// Usage record operations. AddUsageRecord adds the counts of record to
+	// the stored record with the same ID, creating it if needed.
+	AddUsageRecord(ctx context.Context, record *UsageRecordDocument) error
+	QueryUsageRecords(ctx context.Context, query UsageRecordQuery) ([]*UsageRecordDocument, error)
+
+	// Consumer operations. GetConsumer returns nil without an error when
+	// the consumer does not exist.
+	CreateConsumer(ctx context.Context, consumer *ConsumerDocument) error
+	GetConsumer(ctx context.Context, id string) (*ConsumerDocument, error)
+	ListConsumers(ctx context.Context) ([]*ConsumerDocument, error)
+	UpdateConsumer(ctx context.Context, id string, consumer *ConsumerDocument) error
+	DeleteConsumer(ctx context.Context, id string) error
+
+	// Async job operations. GetAsyncJob returns nil without an error when
+	// the job does not exist. ClaimAsyncJob marks a pending job, or a
+	// running one whose lease expired, as running until leaseUntil and
+	// returns it; it returns nil when the job cannot be claimed.
+	CreateAsyncJob(ctx context.Context, job *AsyncJobDocument) error
+	GetAsyncJob(ctx context.Context, id string) (*AsyncJobDocument, error)
+	ClaimAsyncJob(ctx context.Context, id string, leaseUntil time.Time) (*AsyncJobDocument, error)
+	FinishAsyncJob(ctx context.Context, job *AsyncJobDocument) error
+	ListRunnableAsyncJobs(ctx context.Context, limit int) ([]*AsyncJobDocument, error)
+
+	// Scheduler operations. SaveScheduledJob creates or replaces the job
+	// with the same name. AcquireLock takes or renews the lease on a lock
+	// for owner until the given time and reports whether owner holds it.
+	ListScheduledJobs(ctx context.Context) ([]*ScheduledJobDocument, error)
+	SaveScheduledJob(ctx context.Context, job *ScheduledJobDocument) error
+	DeleteScheduledJob(ctx context.Context, name string) error
+	CreateJobRun(ctx context.Context, run *JobRunDocument) error
+	FinishJobRun(ctx context.Context, run *JobRunDocument) error
+	ListJobRuns(ctx context.Context, job string, limit int) ([]*JobRunDocument, error)
+	AcquireLock(ctx context.Context, name, owner string, until time.Time) (bool, error)
+	ReleaseLock(ctx context.Context, name, owner string) error
+
+	// Revocation operations. SaveRevocation creates or replaces the
+	// revocation with the same ID; ListRevocations skips expired ones.
+	SaveRevocation(ctx context.Context, revocation *RevocationDocument) error
+	ListRevocations(ctx context.Context) ([]*RevocationDocument, error)
+	DeleteRevocation(ctx context.Context, id string) error
+
+	// Refresh token operations. GetRefreshToken returns nil without an
+	// error when the token does not exist. RevokeRefreshToken revokes a
+	// token that is not revoked yet and reports whether it did;
+	// RevokeRefreshTokens revokes every token of a session.
+	CreateRefreshToken(ctx context.Context, token *RefreshTokenDocument) error
+	GetRefreshToken(ctx context.Context, id string) (*RefreshTokenDocument, error)
+	RevokeRefreshToken(ctx context.Context, id string) (bool, error)
+	RevokeRefreshTokens(ctx context.Context, sessionID string) error
+
 	// Health and utility
 	Ping(ctx context.Context) error
 	Close(ctx context.Context) error
 }
+
+// ConsumerDocument is a client of the gateway, such as a partner or an
+// application, independent of the users who manage it. Requests made with
+// any of its credentials belong to it.
+type ConsumerDocument struct {
+	ID       string   `bson:"_id" json:"id"`
+	Username string   `bson:"username" json:"username"`
+	CustomID string   `bson:"customId,omitempty" json:"customId,omitempty"` // ID of the consumer in another system
+	Tags     []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	Enabled  bool     `bson:"enabled" json:"enabled"`
+	// Credentials; each belongs to at most one consumer
+	APIKeyIDs        []string `bson:"apiKeyIds,omitempty" json:"apiKeyIds,omitempty"`               // IDs of API keys
+	CertFingerprints []string `bson:"certFingerprints,omitempty" json:"certFingerprints,omitempty"` // SHA-256 of client certificates
+	JWTSubjects      []string `bson:"jwtSubjects,omitempty" json:"jwtSubjects,omitempty"`           // sub or user_id claims of gateway JWTs
+	// Secrets the consumer signs requests with, for services with the hmac
+	// provider
+	HMACKeys []ConsumerHMACKey `bson:"hmacKeys,omitempty" json:"hmacKeys,omitempty"`
+	// Services the consumer may call; empty allows every service
+	Services  []string           `bson:"services,omitempty" json:"services,omitempty"`
+	RateLimit *ConsumerRateLimit `bson:"rateLimit,omitempty" json:"rateLimit,omitempty"`
+	// Headers added to the consumer's requests before they are proxied
+	Headers   map[string]string `bson:"headers,omitempty" json:"headers,omitempty"`
+	CreatedAt time.Time         `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ConsumerHMACKey is a secret a consumer signs requests with. Requests name
+// it by ID, so that a consumer can rotate secrets without downtime.
+type ConsumerHMACKey struct {
+	ID     string `bson:"id" json:"id"`
+	Secret string `bson:"secret" json:"secret,omitempty"`
+}
+
+// ConsumerRateLimit limits the requests of a consumer across all its
+// credentials and services
+type ConsumerRateLimit struct {
+	Limit  int    `bson:"limit" json:"limit"`
+	Period string `bson:"period" json:"period"` // minute, day or month
+}
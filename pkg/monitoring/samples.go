@@ -0,0 +1,74 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSamplesPerService is how many recent requests are kept per service
+const DefaultSamplesPerService = 1000
+
+// RequestSample describes a request served by a service
+type RequestSample struct {
+	Time     time.Time     `json:"time"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Client   string        `json:"client"`
+	Status   int           `json:"status"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RequestSamples keeps the most recent requests of each service, e.g. to
+// estimate the impact of a settings change on real traffic
+type RequestSamples struct {
+	size int
+
+	mu       sync.Mutex
+	services map[string]*sampleRing
+}
+
+type sampleRing struct {
+	samples []RequestSample
+	next    int
+}
+
+// NewRequestSamples keeps up to size requests per service
+func NewRequestSamples(size int) *RequestSamples {
+	if size <= 0 {
+		size = DefaultSamplesPerService
+	}
+	return &RequestSamples{size: size, services: make(map[string]*sampleRing)}
+}
+
+// Record adds a request of service, replacing its oldest once full
+func (r *RequestSamples) Record(service string, sample RequestSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ring, ok := r.services[service]
+	if !ok {
+		ring = &sampleRing{samples: make([]RequestSample, 0, r.size)}
+		r.services[service] = ring
+	}
+	if len(ring.samples) < r.size {
+		ring.samples = append(ring.samples, sample)
+		return
+	}
+	ring.samples[ring.next] = sample
+	ring.next = (ring.next + 1) % r.size
+}
+
+// Snapshot returns the recent requests of each service, oldest first
+func (r *RequestSamples) Snapshot() map[string][]RequestSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(map[string][]RequestSample, len(r.services))
+	for service, ring := range r.services {
+		samples := make([]RequestSample, 0, len(ring.samples))
+		samples = append(samples, ring.samples[ring.next:]...)
+		samples = append(samples, ring.samples[:ring.next]...)
+		snapshot[service] = samples
+	}
+	return snapshot
+}
@@ -0,0 +1,175 @@
+package mqtt
+
+import (
+	"strings"
+
+	"odin/pkg/config"
+)
+
+// Access is what an ACL rule grants
+type Access int
+
+const (
+	AccessPublish Access = 1 << iota
+	AccessSubscribe
+)
+
+// Identity is the authenticated client behind a connection
+type Identity struct {
+	UserID   string
+	Username string
+	ClientID string
+	Roles    []string
+}
+
+// placeholders replaces {userId}, {username} and {clientId} with the
+// identity's values
+func (id *Identity) placeholders() *strings.Replacer {
+	return strings.NewReplacer("{userId}", id.UserID, "{username}", id.Username, "{clientId}", id.ClientID)
+}
+
+func (id *Identity) hasRole(roles []string) bool {
+	for _, role := range roles {
+		for _, r := range id.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type rule struct {
+	topic  string
+	access Access
+	roles  []string
+}
+
+// ACL decides which topics a client may publish to and subscribe to. An
+// empty ACL allows everything.
+type ACL struct {
+	rules []rule
+}
+
+// NewACL creates an ACL from the configured rules
+func NewACL(rules []config.MQTTACLRule) *ACL {
+	acl := &ACL{}
+	for _, r := range rules {
+		access := AccessPublish | AccessSubscribe
+		switch r.Access {
+		case "publish":
+			access = AccessPublish
+		case "subscribe":
+			access = AccessSubscribe
+		}
+		acl.rules = append(acl.rules, rule{topic: r.Topic, access: access, roles: r.Roles})
+	}
+	return acl
+}
+
+// Grants are the topic filters an ACL grants to one identity
+type Grants struct {
+	all     bool
+	filters []grant
+}
+
+type grant struct {
+	levels []string
+	access Access
+}
+
+// For resolves the rules that apply to id. Rules whose placeholders would
+// expand to an empty value or to one containing wildcards or separators are
+// skipped, so identities cannot widen the filters they are granted.
+func (a *ACL) For(id *Identity) *Grants {
+	if len(a.rules) == 0 {
+		return &Grants{all: true}
+	}
+
+	grants := &Grants{}
+	values := []string{id.UserID, id.Username, id.ClientID}
+	replacer := id.placeholders()
+	for _, r := range a.rules {
+		if len(r.roles) > 0 && !id.hasRole(r.roles) {
+			continue
+		}
+		if strings.Contains(r.topic, "{") && !safeValues(r.topic, values) {
+			continue
+		}
+		topic := replacer.Replace(r.topic)
+		grants.filters = append(grants.filters, grant{levels: strings.Split(topic, "/"), access: r.access})
+	}
+	return grants
+}
+
+// safeValues reports whether the placeholders used in topic expand to
+// plain topic levels
+func safeValues(topic string, values []string) bool {
+	for i, placeholder := range []string{"{userId}", "{username}", "{clientId}"} {
+		if !strings.Contains(topic, placeholder) {
+			continue
+		}
+		if values[i] == "" || strings.ContainsAny(values[i], "/+#") {
+			return false
+		}
+	}
+	return true
+}
+
+// CanPublish reports whether the client may publish to topic
+func (g *Grants) CanPublish(topic string) bool {
+	if g.all {
+		return true
+	}
+	levels := strings.Split(topic, "/")
+	for _, f := range g.filters {
+		if f.access&AccessPublish != 0 && covers(f.levels, levels) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSubscribe reports whether the client may subscribe to filter, which
+// must not match any topic the grants do not
+func (g *Grants) CanSubscribe(filter string) bool {
+	if g.all {
+		return true
+	}
+	levels := strings.Split(filter, "/")
+	for _, f := range g.filters {
+		if f.access&AccessSubscribe != 0 && covers(f.levels, levels) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether every topic matched by the requested levels is
+// matched by the granted ones. For a plain topic this is ordinary topic
+// matching. Wildcards at the first level do not match topics starting with
+// $, as in MQTT itself.
+func covers(granted, requested []string) bool {
+	if len(requested) > 0 && strings.HasPrefix(requested[0], "$") &&
+		len(granted) > 0 && (granted[0] == "+" || granted[0] == "#") {
+		return false
+	}
+
+	for i, g := range granted {
+		if g == "#" {
+			return true
+		}
+		if i >= len(requested) {
+			return false
+		}
+		switch r := requested[i]; {
+		case g == "+":
+			if r == "#" {
+				return false
+			}
+		case r != g:
+			return false
+		}
+	}
+	return len(requested) == len(granted)
+}
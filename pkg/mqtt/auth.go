@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"odin/pkg/auth"
+)
+
+// Authenticator identifies a client by the credential sent as its CONNECT
+// password, or in the WebSocket handshake when the password is empty, so
+// browser clients can use the same tokens as HTTP requests
+type Authenticator interface {
+	Authenticate(r *http.Request, password string) (*Identity, error)
+}
+
+// JWTAuthenticator accepts the gateway's JWTs
+type JWTAuthenticator struct {
+	manager     *auth.JWTManager
+	revocations auth.Revocations
+}
+
+// NewJWTAuthenticator creates an authenticator for JWTs signed with secret
+func NewJWTAuthenticator(secret string) *JWTAuthenticator {
+	return &JWTAuthenticator{manager: auth.NewJWTManager(auth.JWTConfig{Secret: secret})}
+}
+
+// SetRevocations rejects the tokens revoked in revocations
+func (a *JWTAuthenticator) SetRevocations(revocations auth.Revocations) {
+	a.revocations = revocations
+}
+
+// Authenticate validates the JWT in password or the Authorization header
+func (a *JWTAuthenticator) Authenticate(r *http.Request, password string) (*Identity, error) {
+	token := password
+	if token == "" {
+		token, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+
+	claims, err := a.manager.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if a.revocations != nil && auth.TokenRevoked(a.revocations, &claims.RegisteredClaims, claims.UserID) {
+		return nil, errors.New("token was revoked")
+	}
+	id := &Identity{UserID: claims.UserID, Username: claims.Username}
+	if claims.Role != "" {
+		id.Roles = []string{claims.Role}
+	}
+	return id, nil
+}
+
+// APIKeyAuthenticator accepts API keys. A key's permissions are its roles.
+type APIKeyAuthenticator struct {
+	keys *auth.APIKeyAuth
+}
+
+// NewAPIKeyAuthenticator creates an authenticator looking keys up in keys
+func NewAPIKeyAuthenticator(keys *auth.APIKeyAuth) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+// Authenticate validates the API key in password or the API key header
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request, password string) (*Identity, error) {
+	key := password
+	if key == "" {
+		key = a.keys.Key(r)
+	}
+	if key == "" {
+		return nil, errors.New("missing API key")
+	}
+
+	doc, err := a.keys.Lookup(r, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{UserID: doc.UserID, Username: doc.Name, Roles: doc.Permissions}, nil
+}
@@ -0,0 +1,408 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Control packet types, from the high nibble of the first byte
+const (
+	connectPacket    = 1
+	connackPacket    = 2
+	publishPacket    = 3
+	subscribePacket  = 8
+	disconnectPacket = 14
+)
+
+// Connect flags
+const (
+	flagUsername = 0x80
+	flagPassword = 0x40
+	flagWill     = 0x04
+)
+
+// Topic Alias property of MQTT 5 PUBLISH packets
+const propTopicAlias = 0x23
+
+var (
+	errMalformed      = errors.New("malformed MQTT packet")
+	errPacketTooLarge = errors.New("MQTT packet too large")
+	errNotBinary      = errors.New("MQTT over WebSocket requires binary messages")
+)
+
+// reason pairs the MQTT 3 return code and MQTT 5 reason code for a refusal
+type reason struct {
+	v3, v5 byte
+}
+
+var (
+	reasonNotAuthorized     = reason{v3: 5, v5: 0x87}
+	reasonServerUnavailable = reason{v3: 3, v5: 0x88}
+)
+
+// connack refuses a connection with r in the encoding of protocol level
+func connack(level byte, r reason) []byte {
+	if level == 5 {
+		return []byte{connackPacket << 4, 3, 0, r.v5, 0}
+	}
+	return []byte{connackPacket << 4, 2, 0, r.v3}
+}
+
+// disconnect tells an MQTT 5 client why the gateway is closing the connection.
+// Earlier versions have no server DISCONNECT; the connection is just closed.
+func disconnect(r reason) []byte {
+	return []byte{disconnectPacket << 4, 1, r.v5}
+}
+
+// packetReader splits the binary WebSocket messages of a connection into MQTT
+// control packets, which may span messages or share one
+type packetReader struct {
+	conn    *websocket.Conn
+	buf     []byte
+	maxSize int
+}
+
+func newPacketReader(conn *websocket.Conn, maxSize int) *packetReader {
+	return &packetReader{conn: conn, maxSize: maxSize}
+}
+
+// next returns the next complete packet. It is only valid until the next call.
+func (r *packetReader) next() ([]byte, error) {
+	for {
+		n, err := packetLength(r.buf, r.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 && len(r.buf) >= n {
+			packet := r.buf[:n:n]
+			r.buf = r.buf[n:]
+			if len(r.buf) == 0 {
+				r.buf = nil
+			}
+			return packet, nil
+		}
+
+		messageType, data, err := r.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType != websocket.BinaryMessage {
+			return nil, errNotBinary
+		}
+		r.buf = append(r.buf, data...)
+	}
+}
+
+// packetLength returns the full length of the packet at the start of buf,
+// or 0 if its fixed header is not complete yet
+func packetLength(buf []byte, maxSize int) (int, error) {
+	remaining, multiplier := 0, 1
+	for i := 1; i <= 4; i++ {
+		if i >= len(buf) {
+			return 0, nil
+		}
+		remaining += int(buf[i]&0x7f) * multiplier
+		if buf[i]&0x80 == 0 {
+			n := 1 + i + remaining
+			if n > maxSize {
+				return 0, errPacketTooLarge
+			}
+			return n, nil
+		}
+		multiplier *= 128
+	}
+	return 0, errMalformed
+}
+
+// packetType returns the control packet type of a packet
+func packetType(packet []byte) byte {
+	return packet[0] >> 4
+}
+
+// body returns a packet without its fixed header
+func body(packet []byte) []byte {
+	i := 1
+	for packet[i]&0x80 != 0 {
+		i++
+	}
+	return packet[i+1:]
+}
+
+// decoder reads the fields of a packet body. The first error sticks and
+// later reads return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = errMalformed
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// binary reads a length-prefixed byte sequence
+func (d *decoder) binary() []byte {
+	return d.bytes(int(d.uint16()))
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) varint() int {
+	value, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b := d.byte()
+		value += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return value
+		}
+		multiplier *= 128
+	}
+	d.err = errMalformed
+	return 0
+}
+
+// properties reads an MQTT 5 property list
+func (d *decoder) properties() []byte {
+	return d.bytes(d.varint())
+}
+
+// encoder builds a packet body
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) binary(v []byte) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) string(v string) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) varint(v int) {
+	for {
+		b := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			b |= 0x80
+		}
+		e.b = append(e.b, b)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+// packet prefixes the body with a fixed header
+func (e *encoder) packet(first byte) []byte {
+	header := &encoder{b: []byte{first}}
+	header.varint(len(e.b))
+	return append(header.b, e.b...)
+}
+
+// connect is a parsed CONNECT packet. Property lists are kept as they are.
+type connect struct {
+	protocol       string
+	level          byte
+	flags          byte
+	keepAlive      uint16
+	properties     []byte
+	clientID       string
+	willProperties []byte
+	willTopic      string
+	willPayload    []byte
+	username       string
+	password       []byte
+}
+
+func parseConnect(packet []byte) (*connect, error) {
+	if packetType(packet) != connectPacket {
+		return nil, errMalformed
+	}
+
+	d := &decoder{b: body(packet)}
+	c := &connect{}
+	c.protocol = d.string()
+	c.level = d.byte()
+	c.flags = d.byte()
+	c.keepAlive = d.uint16()
+	if c.level == 5 {
+		c.properties = d.properties()
+	}
+	c.clientID = d.string()
+	if c.flags&flagWill != 0 {
+		if c.level == 5 {
+			c.willProperties = d.properties()
+		}
+		c.willTopic = d.string()
+		c.willPayload = d.binary()
+	}
+	if c.flags&flagUsername != 0 {
+		c.username = d.string()
+	}
+	if c.flags&flagPassword != 0 {
+		c.password = d.binary()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return c, nil
+}
+
+// setCredentials replaces the username and password; empty values are
+// left out of the packet
+func (c *connect) setCredentials(username, password string) {
+	c.username, c.password = username, []byte(password)
+	c.flags &^= flagUsername | flagPassword
+	if username != "" {
+		c.flags |= flagUsername
+	}
+	if password != "" {
+		c.flags |= flagPassword
+	}
+}
+
+func (c *connect) encode() []byte {
+	e := &encoder{}
+	e.string(c.protocol)
+	e.b = append(e.b, c.level, c.flags)
+	e.b = binary.BigEndian.AppendUint16(e.b, c.keepAlive)
+	if c.level == 5 {
+		e.varint(len(c.properties))
+		e.b = append(e.b, c.properties...)
+	}
+	e.string(c.clientID)
+	if c.flags&flagWill != 0 {
+		if c.level == 5 {
+			e.varint(len(c.willProperties))
+			e.b = append(e.b, c.willProperties...)
+		}
+		e.string(c.willTopic)
+		e.binary(c.willPayload)
+	}
+	if c.flags&flagUsername != 0 {
+		e.string(c.username)
+	}
+	if c.flags&flagPassword != 0 {
+		e.binary(c.password)
+	}
+	return e.packet(connectPacket << 4)
+}
+
+// publishTopic returns the topic of a PUBLISH packet. MQTT 5 clients may
+// replace topics with aliases they set up earlier on the connection, which
+// are tracked in aliases.
+func publishTopic(packet []byte, level byte, aliases map[uint16]string) (string, error) {
+	d := &decoder{b: body(packet)}
+	topic := d.string()
+	if qos := packet[0] >> 1 & 3; qos > 0 {
+		d.uint16()
+	}
+	if level == 5 {
+		props := d.properties()
+		if d.err != nil {
+			return "", d.err
+		}
+		alias, ok, err := topicAlias(props)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			if topic != "" {
+				aliases[alias] = topic
+			} else {
+				topic = aliases[alias]
+			}
+		}
+	}
+	if d.err != nil {
+		return "", d.err
+	}
+	if topic == "" {
+		return "", errMalformed
+	}
+	return topic, nil
+}
+
+// subscribeFilters returns the topic filters of a SUBSCRIBE packet. Shared
+// subscriptions are returned without their $share/<group>/ prefix.
+func subscribeFilters(packet []byte, level byte) ([]string, error) {
+	d := &decoder{b: body(packet)}
+	d.uint16()
+	if level == 5 {
+		d.properties()
+	}
+
+	var filters []string
+	for d.err == nil && len(d.b) > 0 {
+		filter := d.string()
+		d.byte() // subscription options
+		if rest, ok := strings.CutPrefix(filter, "$share/"); ok {
+			if _, shared, ok := strings.Cut(rest, "/"); ok {
+				filter = shared
+			}
+		}
+		filters = append(filters, filter)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(filters) == 0 {
+		return nil, errMalformed
+	}
+	return filters, nil
+}
+
+// topicAlias finds the Topic Alias in an MQTT 5 property list
+func topicAlias(props []byte) (uint16, bool, error) {
+	d := &decoder{b: props}
+	for d.err == nil && len(d.b) > 0 {
+		id := d.varint()
+		switch id {
+		case propTopicAlias:
+			return d.uint16(), d.err == nil, d.err
+		case 0x01, 0x17, 0x19, 0x24, 0x25, 0x28, 0x29, 0x2A:
+			d.byte()
+		case 0x13, 0x21, 0x22:
+			d.uint16()
+		case 0x02, 0x11, 0x18, 0x27:
+			d.bytes(4)
+		case 0x0B:
+			d.varint()
+		case 0x03, 0x08, 0x09, 0x12, 0x15, 0x16, 0x1A, 0x1C, 0x1F:
+			d.binary()
+		case 0x26:
+			d.binary()
+			d.binary()
+		default:
+			return 0, false, errMalformed
+		}
+	}
+	return 0, false, d.err
+}
@@ -0,0 +1,259 @@
+// Package mqtt terminates MQTT over WebSocket at the gateway. Clients are
+// authenticated from their CONNECT packet with the gateway's JWTs or API
+// keys, their publishes and subscriptions are checked against topic ACLs,
+// and their traffic is relayed to the broker under broker credentials.
+package mqtt
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Proxy relays the MQTT connections of one service to its broker
+type Proxy struct {
+	name     string
+	target   string
+	config   config.MQTTConfig
+	auth     Authenticator
+	acl      *ACL
+	logger   *logrus.Logger
+	upgrader websocket.Upgrader
+	dialer   websocket.Dialer
+}
+
+// NewProxy creates a proxy for service name relaying to the broker's
+// WebSocket endpoint at target
+func NewProxy(name, target string, cfg config.MQTTConfig, authenticator Authenticator, logger *logrus.Logger) *Proxy {
+	if cfg.ConnectTimeout == 0 {
+		cfg.ConnectTimeout = 10 * time.Second
+	}
+	if cfg.MaxPacketSize == 0 {
+		cfg.MaxPacketSize = 256 * 1024
+	}
+
+	// MQTT over WebSocket uses the mqtt subprotocol; mqttv3.1 is its old name
+	subprotocols := []string{"mqtt", "mqttv3.1"}
+	return &Proxy{
+		name:   name,
+		target: brokerURL(target),
+		config: cfg,
+		auth:   authenticator,
+		acl:    NewACL(cfg.ACL),
+		logger: logger,
+		upgrader: websocket.Upgrader{
+			Subprotocols: subprotocols,
+			CheckOrigin:  func(r *http.Request) bool { return true },
+		},
+		dialer: websocket.Dialer{
+			HandshakeTimeout: cfg.ConnectTimeout,
+			Subprotocols:     subprotocols,
+		},
+	}
+}
+
+// brokerURL turns an http(s) target into a ws(s) URL
+func brokerURL(target string) string {
+	if rest, ok := strings.CutPrefix(target, "http"); ok {
+		return "ws" + rest
+	}
+	return target
+}
+
+// RegisterRoutes registers the MQTT endpoint at basePath
+func (p *Proxy) RegisterRoutes(e *echo.Echo, basePath string) {
+	e.GET(basePath, p.Handle)
+}
+
+// Handle upgrades the request, authenticates the client's CONNECT and
+// relays the connection until either side closes it
+func (p *Proxy) Handle(c echo.Context) error {
+	if !websocket.IsWebSocketUpgrade(c.Request()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "MQTT clients must connect over WebSocket")
+	}
+
+	client, err := p.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to upgrade MQTT client connection")
+		return err
+	}
+	defer client.Close()
+	client.SetReadLimit(int64(p.config.MaxPacketSize))
+
+	log := p.logger.WithFields(logrus.Fields{
+		"service":   p.name,
+		"client_ip": c.RealIP(),
+	})
+
+	// The first packet must be a CONNECT, sent promptly
+	reader := newPacketReader(client, p.config.MaxPacketSize)
+	client.SetReadDeadline(time.Now().Add(p.config.ConnectTimeout))
+	packet, err := reader.next()
+	if err != nil {
+		log.WithError(err).Debug("MQTT client did not connect")
+		return nil
+	}
+	conn, err := parseConnect(packet)
+	if err != nil {
+		log.WithError(err).Debug("Invalid MQTT CONNECT packet")
+		return nil
+	}
+	client.SetReadDeadline(time.Time{})
+	log = log.WithField("client_id", conn.clientID)
+
+	identity, err := p.auth.Authenticate(c.Request(), string(conn.password))
+	if err != nil {
+		log.WithError(err).Warn("MQTT client authentication failed")
+		client.WriteMessage(websocket.BinaryMessage, connack(conn.level, reasonNotAuthorized))
+		return nil
+	}
+	identity.ClientID = conn.clientID
+	grants := p.acl.For(identity)
+	if conn.flags&flagWill != 0 && !grants.CanPublish(conn.willTopic) {
+		log.WithField("topic", conn.willTopic).Warn("MQTT will topic denied by ACL")
+		client.WriteMessage(websocket.BinaryMessage, connack(conn.level, reasonNotAuthorized))
+		return nil
+	}
+
+	replacer := identity.placeholders()
+	conn.setCredentials(replacer.Replace(p.config.BrokerUsername), replacer.Replace(p.config.BrokerPassword))
+
+	broker, _, err := p.dialer.Dial(p.target, nil)
+	if err != nil {
+		log.WithError(err).Error("Failed to connect to MQTT broker")
+		client.WriteMessage(websocket.BinaryMessage, connack(conn.level, reasonServerUnavailable))
+		return nil
+	}
+	defer broker.Close()
+
+	if err := broker.WriteMessage(websocket.BinaryMessage, conn.encode()); err != nil {
+		log.WithError(err).Error("Failed to send CONNECT to MQTT broker")
+		return nil
+	}
+
+	s := &session{
+		client: client,
+		broker: broker,
+		reader: reader,
+		level:  conn.level,
+		grants: grants,
+		log:    log.WithField("user_id", identity.UserID),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.brokerToClient()
+	}()
+	s.clientToBroker()
+
+	// Unblock the other direction and wait for it
+	client.Close()
+	broker.Close()
+	<-done
+	return nil
+}
+
+// session is an authenticated connection relayed to the broker
+type session struct {
+	client  *websocket.Conn
+	broker  *websocket.Conn
+	reader  *packetReader
+	level   byte
+	grants  *Grants
+	aliases map[uint16]string
+	log     *logrus.Entry
+
+	clientMu sync.Mutex // serializes writes to client
+}
+
+// clientToBroker forwards the client's packets one by one, enforcing the
+// ACL. A denied publish or subscription closes the connection, as MQTT 3
+// has no other way to refuse a publish.
+func (s *session) clientToBroker() {
+	s.aliases = make(map[uint16]string)
+	for {
+		packet, err := s.reader.next()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.log.WithError(err).Debug("MQTT client connection ended")
+			}
+			return
+		}
+
+		if !s.allowed(packet) {
+			if s.level == 5 {
+				s.writeClient(disconnect(reasonNotAuthorized))
+			}
+			return
+		}
+
+		if err := s.broker.WriteMessage(websocket.BinaryMessage, packet); err != nil {
+			s.log.WithError(err).Debug("Failed to forward MQTT packet to broker")
+			return
+		}
+	}
+}
+
+// allowed checks a packet against the ACL
+func (s *session) allowed(packet []byte) bool {
+	switch packetType(packet) {
+	case publishPacket:
+		topic, err := publishTopic(packet, s.level, s.aliases)
+		if err != nil {
+			s.log.WithError(err).Warn("Invalid MQTT PUBLISH packet")
+			return false
+		}
+		if !s.grants.CanPublish(topic) {
+			s.log.WithField("topic", topic).Warn("MQTT publish denied by ACL")
+			return false
+		}
+	case subscribePacket:
+		filters, err := subscribeFilters(packet, s.level)
+		if err != nil {
+			s.log.WithError(err).Warn("Invalid MQTT SUBSCRIBE packet")
+			return false
+		}
+		for _, filter := range filters {
+			if !s.grants.CanSubscribe(filter) {
+				s.log.WithField("topic", filter).Warn("MQTT subscription denied by ACL")
+				return false
+			}
+		}
+	case connectPacket:
+		s.log.Warn("MQTT client sent a second CONNECT")
+		return false
+	}
+	return true
+}
+
+// brokerToClient relays the broker's messages unchanged
+func (s *session) brokerToClient() {
+	for {
+		messageType, data, err := s.broker.ReadMessage()
+		if err != nil {
+			s.client.Close()
+			return
+		}
+		if err := s.writeMessage(messageType, data); err != nil {
+			s.broker.Close()
+			return
+		}
+	}
+}
+
+func (s *session) writeClient(packet []byte) error {
+	return s.writeMessage(websocket.BinaryMessage, packet)
+}
+
+func (s *session) writeMessage(messageType int, data []byte) error {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	return s.client.WriteMessage(messageType, data)
+}
@@ -0,0 +1,260 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxExampleDepth stops generating examples of recursive schemas
+const maxExampleDepth = 8
+
+// ExampleResponse is a response built from the examples of a spec
+type ExampleResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Example builds the response the spec documents for method and path: the
+// lowest documented 2XX status, or default, with the media type's example,
+// its first named example, or a value generated from its schema. code and
+// name select another documented status and a named example instead.
+// matched is false when the spec does not describe the request.
+func (v *Validator) Example(method, path string, code int, name string) (resp *ExampleResponse, matched bool, err error) {
+	rt, _ := v.match(method, path)
+	if rt == nil {
+		return nil, false, nil
+	}
+
+	status, documented, ok := exampleStatus(rt.operation.Responses, code)
+	if !ok {
+		return nil, true, fmt.Errorf("status %d is not documented", code)
+	}
+
+	resp = &ExampleResponse{Status: status}
+	if len(documented.Content) == 0 {
+		return resp, true, nil
+	}
+
+	resp.ContentType, resp.Body, err = v.schemas.mediaExample(documented.Content, name)
+	if err != nil {
+		return nil, true, err
+	}
+	return resp, true, nil
+}
+
+// BodyExample builds an example of a request body: its media type's
+// example, its first named example, or a value generated from its schema.
+// JSON media types are preferred. body is nil when none can be built.
+func (s *Spec) BodyExample(requestBody *RequestBody) (contentType string, body []byte, err error) {
+	if requestBody == nil || len(requestBody.Content) == 0 {
+		return "", nil, nil
+	}
+	schemas := &schemaValidator{components: &s.Components}
+	return schemas.mediaExample(requestBody.Content, "")
+}
+
+// mediaExample picks the media type of content and builds its example, the
+// one called name if name is set
+func (v *schemaValidator) mediaExample(content map[string]MediaType, name string) (string, []byte, error) {
+	mediaType := exampleMediaType(content)
+	media := content[mediaType]
+
+	value, found := media.Example, media.Example != nil
+	if name != "" {
+		example, ok := media.Examples[name]
+		if !ok {
+			return "", nil, fmt.Errorf("example %q is not documented", name)
+		}
+		value, found = example.Value, true
+	} else if !found && len(media.Examples) > 0 {
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		value, found = media.Examples[names[0]].Value, true
+	}
+	if !found && media.Schema != nil {
+		value, found = v.example(media.Schema, 0), true
+	}
+	if !found {
+		return mediaType, nil, nil
+	}
+
+	if text, ok := value.(string); ok && !isJSON(mediaType) {
+		return mediaType, []byte(text), nil
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("example is not valid JSON: %w", err)
+	}
+	return mediaType, body, nil
+}
+
+// exampleStatus picks the response for code, or when code is 0 the lowest
+// documented success, falling back to default
+func exampleStatus(responses map[string]Response, code int) (int, Response, bool) {
+	if code != 0 {
+		resp, ok := findResponse(responses, code)
+		return code, resp, ok
+	}
+
+	best := 0
+	for key := range responses {
+		status, err := strconv.Atoi(key)
+		if err != nil && len(key) == 3 && strings.EqualFold(key[1:], "XX") {
+			status, err = strconv.Atoi(key[:1] + "00")
+		}
+		if err == nil && status >= 200 && status < 300 && (best == 0 || status < best) {
+			best = status
+		}
+	}
+	if best != 0 {
+		resp, _ := findResponse(responses, best)
+		return best, resp, true
+	}
+	if resp, ok := responses["default"]; ok {
+		return http.StatusOK, resp, true
+	}
+	return http.StatusOK, Response{}, true
+}
+
+// exampleMediaType prefers JSON among the documented media types
+func exampleMediaType(content map[string]MediaType) string {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	for _, mediaType := range types {
+		if isJSON(mediaType) {
+			return mediaType
+		}
+	}
+	return types[0]
+}
+
+// example generates a value matching schema, using the examples, enums and
+// defaults of the schema where it has them
+func (v *schemaValidator) example(schema *Schema, depth int) interface{} {
+	if schema == nil || depth > maxExampleDepth {
+		return nil
+	}
+	if schema.Ref != "" {
+		resolved, err := v.resolve(schema.Ref)
+		if err != nil {
+			return nil
+		}
+		return v.example(resolved, depth+1)
+	}
+	if schema.Example != nil {
+		return schema.Example
+	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
+	if len(schema.AllOf) > 0 {
+		merged := make(map[string]interface{})
+		for _, part := range schema.AllOf {
+			if object, ok := v.example(part, depth+1).(map[string]interface{}); ok {
+				for key, value := range object {
+					merged[key] = value
+				}
+			}
+		}
+		return merged
+	}
+	if len(schema.OneOf) > 0 {
+		return v.example(schema.OneOf[0], depth+1)
+	}
+	if len(schema.AnyOf) > 0 {
+		return v.example(schema.AnyOf[0], depth+1)
+	}
+
+	switch schema.Type {
+	case "object":
+		object := make(map[string]interface{}, len(schema.Properties))
+		for name, property := range schema.Properties {
+			object[name] = v.example(property, depth+1)
+		}
+		return object
+	case "array":
+		items := 1
+		if schema.MinItems != nil && *schema.MinItems > 1 {
+			items = *schema.MinItems
+		}
+		array := make([]interface{}, items)
+		for i := range array {
+			array[i] = v.example(schema.Items, depth+1)
+		}
+		return array
+	case "integer":
+		return int64(exampleNumber(schema))
+	case "number":
+		return exampleNumber(schema)
+	case "boolean":
+		return true
+	case "string":
+		return exampleString(schema)
+	}
+	if len(schema.Properties) > 0 {
+		return v.example(&Schema{Type: "object", Properties: schema.Properties}, depth)
+	}
+	return nil
+}
+
+// exampleNumber returns a number within the schema's range
+func exampleNumber(schema *Schema) float64 {
+	switch {
+	case schema.Minimum != nil && schema.ExclusiveMinimum:
+		return *schema.Minimum + 1
+	case schema.Minimum != nil:
+		return *schema.Minimum
+	case schema.Maximum != nil && schema.ExclusiveMaximum:
+		return *schema.Maximum - 1
+	case schema.Maximum != nil && *schema.Maximum < 1:
+		return *schema.Maximum
+	}
+	return 1
+}
+
+// exampleString returns a string of the schema's format and length
+func exampleString(schema *Schema) string {
+	var value string
+	switch schema.Format {
+	case "date-time":
+		value = "2024-01-01T00:00:00Z"
+	case "date":
+		value = "2024-01-01"
+	case "time":
+		value = "00:00:00"
+	case "email":
+		value = "user@example.com"
+	case "uri", "url":
+		value = "https://example.com"
+	case "hostname":
+		value = "example.com"
+	case "ipv4":
+		value = "192.0.2.1"
+	case "ipv6":
+		value = "2001:db8::1"
+	case "uuid":
+		value = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "byte":
+		value = "ZXhhbXBsZQ=="
+	default:
+		value = "string"
+	}
+	if schema.MinLength != nil && len(value) < *schema.MinLength {
+		value += strings.Repeat("x", *schema.MinLength-len(value))
+	}
+	if schema.MaxLength != nil && len(value) > *schema.MaxLength {
+		value = value[:*schema.MaxLength]
+	}
+	return value
+}
@@ -0,0 +1,175 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const schemaRefPrefix = "#/components/schemas/"
+
+// AddSpec adds the paths, schemas and security schemes of spec to the
+// specification, e.g. to document the services of a product together. prefix
+// is prepended to the paths of spec, for specs relative to the backend, and
+// operations without tags are tagged with tag. A schema whose name is taken
+// by a different schema is renamed after tag. spec is not modified.
+func (g *Generator) AddSpec(spec *Spec, prefix, tag string) error {
+	spec, err := copySpec(spec)
+	if err != nil {
+		return err
+	}
+
+	renamed := make(map[string]string)
+	for name, schema := range spec.Components.Schemas {
+		existing, taken := g.spec.Components.Schemas[name]
+		if !taken || reflect.DeepEqual(existing, schema) {
+			continue
+		}
+		newName := toCamelCase(tag) + name
+		if _, taken := g.spec.Components.Schemas[newName]; taken {
+			return fmt.Errorf("schema %s is defined differently by another spec", name)
+		}
+		renamed[name] = newName
+	}
+	if len(renamed) > 0 {
+		renameRefs(spec, renamed)
+	}
+	for name, schema := range spec.Components.Schemas {
+		if newName, ok := renamed[name]; ok {
+			name = newName
+		}
+		g.spec.Components.Schemas[name] = schema
+	}
+	for name, scheme := range spec.Components.SecuritySchemes {
+		if _, taken := g.spec.Components.SecuritySchemes[name]; !taken {
+			g.spec.Components.SecuritySchemes[name] = scheme
+		}
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	for path, item := range spec.Paths {
+		path = prefix + path
+		merged := g.spec.Paths[path]
+		for method, op := range item.operations() {
+			if len(op.Tags) == 0 && tag != "" {
+				op.Tags = []string{tag}
+			}
+			if merged.operations()[method] != nil {
+				return fmt.Errorf("operation %s %s is defined twice", method, path)
+			}
+			merged.set(method, op)
+		}
+		merged.Parameters = append(merged.Parameters, item.Parameters...)
+		g.spec.Paths[path] = merged
+	}
+	return nil
+}
+
+// operations returns the operations of the path by HTTP method
+func (item *PathItem) operations() map[string]*Operation {
+	operations := make(map[string]*Operation)
+	for method, op := range map[string]*Operation{
+		http.MethodGet:     item.Get,
+		http.MethodPost:    item.Post,
+		http.MethodPut:     item.Put,
+		http.MethodDelete:  item.Delete,
+		http.MethodPatch:   item.Patch,
+		http.MethodOptions: item.Options,
+	} {
+		if op != nil {
+			operations[method] = op
+		}
+	}
+	return operations
+}
+
+func (item *PathItem) set(method string, op *Operation) {
+	switch method {
+	case http.MethodGet:
+		item.Get = op
+	case http.MethodPost:
+		item.Post = op
+	case http.MethodPut:
+		item.Put = op
+	case http.MethodDelete:
+		item.Delete = op
+	case http.MethodPatch:
+		item.Patch = op
+	case http.MethodOptions:
+		item.Options = op
+	}
+}
+
+// copySpec deep copies spec, so merging never changes the specs of services
+func copySpec(spec *Spec) (*Spec, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy spec: %w", err)
+	}
+	var copied Spec
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy spec: %w", err)
+	}
+	return &copied, nil
+}
+
+// renameRefs points the schema references of spec at the renamed schemas
+func renameRefs(spec *Spec, renamed map[string]string) {
+	var roots []*Schema
+	for _, schema := range spec.Components.Schemas {
+		roots = append(roots, schema)
+	}
+	for _, item := range spec.Paths {
+		for _, op := range item.operations() {
+			for _, param := range mergeParameters(item.Parameters, op.Parameters) {
+				roots = append(roots, param.Schema)
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					roots = append(roots, media.Schema)
+				}
+			}
+			for _, resp := range op.Responses {
+				for _, media := range resp.Content {
+					roots = append(roots, media.Schema)
+				}
+			}
+		}
+	}
+
+	normalized := make(map[*Schema]bool)
+	for _, schema := range roots {
+		normalizeSchema(schema, normalized)
+	}
+	seen := make(map[*Schema]bool)
+	for _, schema := range roots {
+		renameSchemaRefs(schema, renamed, seen)
+	}
+}
+
+func renameSchemaRefs(schema *Schema, renamed map[string]string, seen map[*Schema]bool) {
+	if schema == nil || seen[schema] {
+		return
+	}
+	seen[schema] = true
+
+	if name, ok := strings.CutPrefix(schema.Ref, schemaRefPrefix); ok {
+		if newName, ok := renamed[name]; ok {
+			schema.Ref = schemaRefPrefix + newName
+		}
+	}
+	for _, property := range schema.Properties {
+		renameSchemaRefs(property, renamed, seen)
+	}
+	renameSchemaRefs(schema.Items, renamed, seen)
+	if additional, ok := schema.AdditionalProperties.(*Schema); ok {
+		renameSchemaRefs(additional, renamed, seen)
+	}
+	for _, group := range [][]*Schema{schema.AllOf, schema.AnyOf, schema.OneOf} {
+		for _, sub := range group {
+			renameSchemaRefs(sub, renamed, seen)
+		}
+	}
+}
@@ -47,6 +47,9 @@ type PathItem struct {
 	Delete  *Operation `json:"delete,omitempty" yaml:"delete,omitempty"`
 	Patch   *Operation `json:"patch,omitempty" yaml:"patch,omitempty"`
 	Options *Operation `json:"options,omitempty" yaml:"options,omitempty"`
+
+	// Parameters are shared by all operations on the path
+	Parameters []Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
 }
 
 // Operation represents an API operation
@@ -85,16 +88,46 @@ type Response struct {
 
 // MediaType represents a media type
 type MediaType struct {
-	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Schema   *Schema            `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Example  interface{}        `json:"example,omitempty" yaml:"example,omitempty"`
+	Examples map[string]Example `json:"examples,omitempty" yaml:"examples,omitempty"`
+}
+
+// Example is a named example of a media type
+type Example struct {
+	Summary string      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Value   interface{} `json:"value,omitempty" yaml:"value,omitempty"`
 }
 
 // Schema represents a data schema
 type Schema struct {
+	Ref        string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
 	Type       string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Format     string             `json:"format,omitempty" yaml:"format,omitempty"`
 	Properties map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
 	Items      *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
 	Required   []string           `json:"required,omitempty" yaml:"required,omitempty"`
 	Example    interface{}        `json:"example,omitempty" yaml:"example,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MinLength        *int     `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength        *int     `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern          string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	MinItems         *int     `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems         *int     `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+
+	// AdditionalProperties is either a bool or a schema for properties not
+	// listed in Properties
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty" yaml:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
 }
 
 // Components holds reusable objects
@@ -149,6 +182,17 @@ func (g *Generator) AddSecurityScheme(name string, scheme SecurityScheme) {
 	g.spec.Components.SecuritySchemes[name] = scheme
 }
 
+// RequireSecurity sets the security requirements of every operation, e.g.
+// to document the credentials the gateway accepts in front of a service
+func (g *Generator) RequireSecurity(security []map[string][]string) {
+	for path, item := range g.spec.Paths {
+		for _, op := range item.operations() {
+			op.Security = security
+		}
+		g.spec.Paths[path] = item
+	}
+}
+
 // GenerateFromServices generates OpenAPI spec from service configurations
 func (g *Generator) GenerateFromServices(services []*service.Config) error {
 	for _, svc := range services {
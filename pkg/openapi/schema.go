@@ -0,0 +1,365 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxValidationErrors caps the details reported for a single request
+const maxValidationErrors = 50
+
+// ValidationError describes one way in which a request violates its schema
+type ValidationError struct {
+	In      string `json:"in"`              // body, query, header, path, cookie or status (responses only)
+	Field   string `json:"field,omitempty"` // Parameter name or JSON path into the body
+	Message string `json:"message"`
+}
+
+// schemaValidator validates decoded values against schemas of one spec
+type schemaValidator struct {
+	components *Components
+	patterns   sync.Map // pattern -> *regexp.Regexp
+}
+
+func (v *schemaValidator) validate(schema *Schema, value interface{}, in, field string) []ValidationError {
+	var errs []ValidationError
+	v.check(schema, value, in, field, &errs, 0)
+	if len(errs) > maxValidationErrors {
+		errs = errs[:maxValidationErrors]
+	}
+	return errs
+}
+
+func (v *schemaValidator) check(schema *Schema, value interface{}, in, field string, errs *[]ValidationError, depth int) {
+	if schema == nil || len(*errs) > maxValidationErrors {
+		return
+	}
+
+	report := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{In: in, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Guard against self-referencing schemas
+	if depth > 32 {
+		return
+	}
+
+	if schema.Ref != "" {
+		resolved, err := v.resolve(schema.Ref)
+		if err != nil {
+			report("%v", err)
+			return
+		}
+		v.check(resolved, value, in, field, errs, depth+1)
+		return
+	}
+
+	for _, sub := range schema.AllOf {
+		v.check(sub, value, in, field, errs, depth+1)
+	}
+	if len(schema.AnyOf) > 0 && v.countMatches(schema.AnyOf, value, depth) == 0 {
+		report("must match at least one of the allowed schemas")
+	}
+	if len(schema.OneOf) > 0 {
+		if matches := v.countMatches(schema.OneOf, value, depth); matches != 1 {
+			report("must match exactly one of the allowed schemas, matched %d", matches)
+		}
+	}
+
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			report("must not be null")
+		}
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		report("must be one of %s", formatEnum(schema.Enum))
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			report("must be an object")
+			return
+		}
+		v.checkObject(schema, object, in, field, errs, depth)
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			report("must be an array")
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			report("must contain at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			report("must contain at most %d items", *schema.MaxItems)
+		}
+		for i, item := range items {
+			v.check(schema.Items, item, in, fmt.Sprintf("%s[%d]", field, i), errs, depth+1)
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			report("must be a string")
+			return
+		}
+		v.checkString(schema, str, report)
+
+	case "integer", "number":
+		number, ok := toFloat(value)
+		if !ok {
+			report("must be a %s", schema.Type)
+			return
+		}
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			report("must be an integer")
+			return
+		}
+		checkRange(schema, number, report)
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("must be a boolean")
+		}
+
+	case "":
+		// Untyped schemas still constrain objects through their properties
+		if object, ok := value.(map[string]interface{}); ok && (len(schema.Properties) > 0 || len(schema.Required) > 0) {
+			v.checkObject(schema, object, in, field, errs, depth)
+		}
+	}
+}
+
+func (v *schemaValidator) checkObject(schema *Schema, object map[string]interface{}, in, field string, errs *[]ValidationError, depth int) {
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			*errs = append(*errs, ValidationError{In: in, Field: joinField(field, name), Message: "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, ok := schema.Properties[name]; ok {
+			v.check(property, object[name], in, joinField(field, name), errs, depth+1)
+			continue
+		}
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, ValidationError{In: in, Field: joinField(field, name), Message: "is not an allowed property"})
+			}
+		case *Schema:
+			v.check(additional, object[name], in, joinField(field, name), errs, depth+1)
+		}
+	}
+}
+
+func (v *schemaValidator) checkString(schema *Schema, str string, report func(string, ...interface{})) {
+	length := utf8.RuneCountInString(str)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		report("must be at least %d characters long", *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		report("must be at most %d characters long", *schema.MaxLength)
+	}
+
+	if schema.Pattern != "" {
+		pattern, err := v.compile(schema.Pattern)
+		if err != nil {
+			report("has an invalid pattern in the schema: %v", err)
+		} else if !pattern.MatchString(str) {
+			report("must match pattern %s", schema.Pattern)
+		}
+	}
+
+	if schema.Format != "" && !validFormat(schema.Format, str) {
+		report("must be a valid %s", schema.Format)
+	}
+}
+
+func checkRange(schema *Schema, number float64, report func(string, ...interface{})) {
+	if schema.Minimum != nil {
+		if schema.ExclusiveMinimum && number <= *schema.Minimum {
+			report("must be greater than %v", *schema.Minimum)
+		} else if number < *schema.Minimum {
+			report("must be at least %v", *schema.Minimum)
+		}
+	}
+	if schema.Maximum != nil {
+		if schema.ExclusiveMaximum && number >= *schema.Maximum {
+			report("must be less than %v", *schema.Maximum)
+		} else if number > *schema.Maximum {
+			report("must be at most %v", *schema.Maximum)
+		}
+	}
+}
+
+func (v *schemaValidator) countMatches(schemas []*Schema, value interface{}, depth int) int {
+	matches := 0
+	for _, sub := range schemas {
+		var subErrs []ValidationError
+		v.check(sub, value, "", "", &subErrs, depth+1)
+		if len(subErrs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolve looks up a local reference such as #/components/schemas/User
+func (v *schemaValidator) resolve(ref string) (*Schema, error) {
+	const prefix = "#/components/schemas/"
+	if !strings.HasPrefix(ref, prefix) {
+		return nil, fmt.Errorf("unsupported schema reference %s", ref)
+	}
+	if v.components != nil {
+		if schema, ok := v.components.Schemas[strings.TrimPrefix(ref, prefix)]; ok {
+			return schema, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown schema reference %s", ref)
+}
+
+func (v *schemaValidator) compile(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := v.patterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns.Store(pattern, compiled)
+	return compiled, nil
+}
+
+// normalizeSchema replaces additionalProperties schemas decoded as generic maps
+// with *Schema so they can be validated
+func normalizeSchema(schema *Schema, seen map[*Schema]bool) {
+	if schema == nil || seen[schema] {
+		return
+	}
+	seen[schema] = true
+
+	if raw, ok := schema.AdditionalProperties.(map[string]interface{}); ok {
+		var additional Schema
+		if data, err := json.Marshal(raw); err == nil && json.Unmarshal(data, &additional) == nil {
+			schema.AdditionalProperties = &additional
+		} else {
+			schema.AdditionalProperties = nil
+		}
+	}
+	if additional, ok := schema.AdditionalProperties.(*Schema); ok {
+		normalizeSchema(additional, seen)
+	}
+
+	for _, property := range schema.Properties {
+		normalizeSchema(property, seen)
+	}
+	normalizeSchema(schema.Items, seen)
+	for _, group := range [][]*Schema{schema.AllOf, schema.AnyOf, schema.OneOf} {
+		for _, sub := range group {
+			normalizeSchema(sub, seen)
+		}
+	}
+}
+
+func validFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+	// Unknown formats are annotations only
+	return true
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	number, isNumber := toFloat(value)
+	for _, allowed := range enum {
+		if isNumber {
+			if candidate, ok := toFloat(allowed); ok && candidate == number {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprintf("%v", value)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
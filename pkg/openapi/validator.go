@@ -0,0 +1,450 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Validator checks incoming requests against the operations of a spec
+type Validator struct {
+	routes  []*route
+	schemas *schemaValidator
+}
+
+// route is a compiled spec operation
+type route struct {
+	method    string
+	path      string
+	segments  []string
+	literals  int
+	params    []Parameter
+	operation *Operation
+}
+
+// NewValidator compiles the operations of spec. pathPrefix is prepended to
+// every spec path, for specs that describe the backend rather than the gateway.
+func NewValidator(spec *Spec, pathPrefix string) *Validator {
+	v := &Validator{
+		schemas: &schemaValidator{components: &spec.Components},
+	}
+
+	seen := make(map[*Schema]bool)
+	for _, schema := range spec.Components.Schemas {
+		normalizeSchema(schema, seen)
+	}
+
+	prefix := strings.TrimSuffix(pathPrefix, "/")
+	for path, item := range spec.Paths {
+		operations := map[string]*Operation{
+			http.MethodGet:     item.Get,
+			http.MethodPost:    item.Post,
+			http.MethodPut:     item.Put,
+			http.MethodDelete:  item.Delete,
+			http.MethodPatch:   item.Patch,
+			http.MethodOptions: item.Options,
+		}
+
+		segments := splitPath(prefix + path)
+		literals := 0
+		for _, segment := range segments {
+			if !isTemplate(segment) {
+				literals++
+			}
+		}
+
+		for method, op := range operations {
+			if op == nil {
+				continue
+			}
+
+			params := mergeParameters(item.Parameters, op.Parameters)
+			for _, param := range params {
+				normalizeSchema(param.Schema, seen)
+			}
+			if op.RequestBody != nil {
+				for _, media := range op.RequestBody.Content {
+					normalizeSchema(media.Schema, seen)
+				}
+			}
+			for _, resp := range op.Responses {
+				for _, media := range resp.Content {
+					normalizeSchema(media.Schema, seen)
+				}
+			}
+
+			v.routes = append(v.routes, &route{
+				method:    method,
+				path:      prefix + path,
+				segments:  segments,
+				literals:  literals,
+				params:    params,
+				operation: op,
+			})
+		}
+	}
+
+	return v
+}
+
+// LoadSpec reads an OpenAPI document in JSON or YAML format
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI spec: %w", err)
+	}
+
+	var spec Spec
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &spec)
+	default:
+		err = json.Unmarshal(data, &spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec %s: %w", path, err)
+	}
+
+	return &spec, nil
+}
+
+// Validate checks the request against the matching operation. matched is
+// false when the spec does not describe the request; the request is then
+// not validated. The request body is restored for the next handler.
+func (v *Validator) Validate(r *http.Request) (errs []ValidationError, matched bool) {
+	rt, pathValues := v.match(r.Method, r.URL.Path)
+	if rt == nil {
+		return nil, false
+	}
+
+	query := r.URL.Query()
+	for _, param := range rt.params {
+		var raw []string
+		switch param.In {
+		case "path":
+			if value, ok := pathValues[param.Name]; ok {
+				raw = []string{value}
+			}
+		case "query":
+			raw = query[param.Name]
+		case "header":
+			// OpenAPI ignores these header parameters; they are described elsewhere
+			switch http.CanonicalHeaderKey(param.Name) {
+			case "Accept", "Content-Type", "Authorization":
+				continue
+			}
+			raw = r.Header.Values(param.Name)
+		case "cookie":
+			if cookie, err := r.Cookie(param.Name); err == nil {
+				raw = []string{cookie.Value}
+			}
+		default:
+			continue
+		}
+
+		if len(raw) == 0 {
+			if param.Required || param.In == "path" {
+				errs = append(errs, ValidationError{In: param.In, Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+
+		value := coerceParameter(param.Schema, raw)
+		errs = append(errs, v.schemas.validate(param.Schema, value, param.In, param.Name)...)
+	}
+
+	if rt.operation.RequestBody != nil {
+		errs = append(errs, v.validateBody(r, rt.operation.RequestBody)...)
+	}
+
+	return errs, true
+}
+
+// bodyTooLarge is reported for bodies cut off by the service's
+// maxRequestBodySize
+var bodyTooLarge = ValidationError{In: "body", Message: "is too large"}
+
+func (v *Validator) validateBody(r *http.Request, body *RequestBody) []ValidationError {
+	var data []byte
+	if r.Body != nil {
+		var err error
+		data, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return []ValidationError{bodyTooLarge}
+		}
+		if err != nil {
+			return []ValidationError{{In: "body", Message: "could not be read"}}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return []ValidationError{{In: "body", Message: "is required"}}
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(echo.HeaderContentType))
+	if err != nil {
+		mediaType = ""
+	}
+
+	media, ok := findMediaType(body.Content, mediaType)
+	if !ok {
+		return []ValidationError{{In: "header", Field: echo.HeaderContentType, Message: fmt.Sprintf("content type %q is not accepted", mediaType)}}
+	}
+
+	// Only JSON bodies are checked against their schema
+	if media.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []ValidationError{{In: "body", Message: "must be valid JSON: " + err.Error()}}
+	}
+
+	return v.schemas.validate(media.Schema, value, "body", "")
+}
+
+// ProbePaths returns the paths of GET operations that can be called without
+// input: no path templates and no required parameters
+func (v *Validator) ProbePaths() []string {
+	var paths []string
+	for _, rt := range v.routes {
+		if rt.method != http.MethodGet || rt.literals != len(rt.segments) {
+			continue
+		}
+		required := false
+		for _, param := range rt.params {
+			if param.Required {
+				required = true
+				break
+			}
+		}
+		if !required {
+			paths = append(paths, rt.path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ValidateResponse checks a response against the operation for method and
+// path. The status must be documented exactly, as a range such as 2XX or by
+// a default response, and JSON bodies must match the documented schema.
+// matched is false when the spec does not describe the request.
+func (v *Validator) ValidateResponse(method, path string, status int, header http.Header, body []byte) (errs []ValidationError, matched bool) {
+	rt, _ := v.match(method, path)
+	if rt == nil {
+		return nil, false
+	}
+
+	resp, ok := findResponse(rt.operation.Responses, status)
+	if !ok {
+		return []ValidationError{{In: "status", Message: fmt.Sprintf("%d is not documented", status)}}, true
+	}
+	if len(resp.Content) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return nil, true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get(echo.HeaderContentType))
+	if err != nil {
+		mediaType = ""
+	}
+	media, ok := findMediaType(resp.Content, mediaType)
+	if !ok {
+		return []ValidationError{{In: "header", Field: echo.HeaderContentType, Message: fmt.Sprintf("content type %q is not documented", mediaType)}}, true
+	}
+	if media.Schema == nil || !isJSON(mediaType) {
+		return nil, true
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []ValidationError{{In: "body", Message: "must be valid JSON: " + err.Error()}}, true
+	}
+
+	return v.schemas.validate(media.Schema, value, "body", ""), true
+}
+
+// findResponse picks the documented response for a status: the exact code,
+// then its range (2XX), then default
+func findResponse(responses map[string]Response, status int) (Response, bool) {
+	code := strconv.Itoa(status)
+	if resp, ok := responses[code]; ok {
+		return resp, true
+	}
+	for key, resp := range responses {
+		if len(key) == 3 && strings.EqualFold(key[1:], "XX") && key[0] == code[0] {
+			return resp, true
+		}
+	}
+	resp, ok := responses["default"]
+	return resp, ok
+}
+
+// match finds the operation for a request. Paths with more literal segments
+// win, so /users/me is preferred over /users/{id}.
+func (v *Validator) match(method, path string) (*route, map[string]string) {
+	segments := splitPath(path)
+
+	var best *route
+	var bestValues map[string]string
+	for _, rt := range v.routes {
+		if rt.method != method || len(rt.segments) != len(segments) {
+			continue
+		}
+		if best != nil && rt.literals <= best.literals {
+			continue
+		}
+
+		values := make(map[string]string)
+		matched := true
+		for i, segment := range rt.segments {
+			if isTemplate(segment) {
+				values[segment[1:len(segment)-1]] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			best, bestValues = rt, values
+		}
+	}
+
+	return best, bestValues
+}
+
+// Middleware rejects requests that violate the spec with 400 and the list of
+// violations. Requests the spec does not describe are passed through.
+func (v *Validator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			errs, matched := v.Validate(c.Request())
+			if !matched || len(errs) == 0 {
+				return next(c)
+			}
+			for _, err := range errs {
+				if err == bodyTooLarge {
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+				}
+			}
+
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Request validation failed",
+				"details": errs,
+			})
+		}
+	}
+}
+
+// mergeParameters combines path-level and operation-level parameters; the
+// operation wins when both define the same name and location
+func mergeParameters(shared, own []Parameter) []Parameter {
+	merged := make([]Parameter, 0, len(shared)+len(own))
+	merged = append(merged, own...)
+	for _, param := range shared {
+		overridden := false
+		for _, candidate := range own {
+			if candidate.Name == param.Name && candidate.In == param.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// coerceParameter converts raw string values to the type the schema expects
+func coerceParameter(schema *Schema, raw []string) interface{} {
+	if schema == nil {
+		return raw[0]
+	}
+
+	if schema.Type == "array" {
+		var parts []string
+		for _, value := range raw {
+			parts = append(parts, strings.Split(value, ",")...)
+		}
+		items := make([]interface{}, len(parts))
+		for i, part := range parts {
+			items[i] = coerceScalar(schema.Items, part)
+		}
+		return items
+	}
+
+	return coerceScalar(schema, raw[0])
+}
+
+func coerceScalar(schema *Schema, value string) interface{} {
+	if schema == nil {
+		return value
+	}
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func findMediaType(content map[string]MediaType, mediaType string) (MediaType, bool) {
+	if len(content) == 0 {
+		return MediaType{}, true
+	}
+	if media, ok := content[mediaType]; ok {
+		return media, true
+	}
+	if slash := strings.Index(mediaType, "/"); slash > 0 {
+		if media, ok := content[mediaType[:slash]+"/*"]; ok {
+			return media, true
+		}
+	}
+	media, ok := content["*/*"]
+	return media, ok
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func isTemplate(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
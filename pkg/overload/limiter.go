@@ -0,0 +1,224 @@
+package overload
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is returned for requests that are shed
+var ErrOverloaded = errors.New("gateway overloaded")
+
+// LimiterConfig sizes a Limiter
+type LimiterConfig struct {
+	MaxConcurrent int
+	MaxQueue      int
+	MaxQueueTime  time.Duration
+	TargetDelay   time.Duration
+	Interval      time.Duration
+}
+
+// waiter is a request queued for a slot. ready receives true once the
+// request owns a slot and false when it is shed.
+type waiter struct {
+	priority int
+	enqueued time.Time
+	ready    chan bool
+}
+
+// Limiter admits a bounded number of requests at once and queues the rest.
+// The queue delay is watched the way CoDel watches a packet queue: once it
+// has stayed above TargetDelay for a whole Interval the limiter considers
+// itself overloaded. It then serves the newest waiters first and lets new
+// ones wait at most TargetDelay, so requests that would time out anyway are
+// rejected quickly instead of dragging everyone's latency up.
+type Limiter struct {
+	cfg LimiterConfig
+
+	mu         sync.Mutex
+	inflight   int
+	queue      []*waiter
+	overloaded bool
+	aboveSince time.Time // when the queue delay first exceeded the target, zero while below
+	onChange   func(overloaded bool)
+
+	admitted atomic.Uint64
+	queued   atomic.Uint64
+	shed     atomic.Uint64
+}
+
+// Stats is a snapshot of the limiter's state and counters
+type Stats struct {
+	InFlight      int    `json:"inFlight"`
+	Queued        int    `json:"queued"`
+	Overloaded    bool   `json:"overloaded"`
+	AdmittedTotal uint64 `json:"admittedTotal"`
+	QueuedTotal   uint64 `json:"queuedTotal"`
+	ShedTotal     uint64 `json:"shedTotal"`
+}
+
+// NewLimiter creates a limiter. onChange, which may be nil, is called with
+// the limiter's lock held whenever it enters or leaves the overloaded state.
+func NewLimiter(cfg LimiterConfig, onChange func(overloaded bool)) *Limiter {
+	return &Limiter{cfg: cfg, onChange: onChange}
+}
+
+// Acquire waits for a slot. On success the caller must call the returned
+// function once the request is done. Requests are shed with ErrOverloaded
+// when the queue is full of requests at least as important, or when their
+// wait runs out.
+func (l *Limiter) Acquire(ctx context.Context, priority int) (func(), error) {
+	l.mu.Lock()
+	if l.inflight < l.cfg.MaxConcurrent && len(l.queue) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		l.admitted.Add(1)
+		return l.release, nil
+	}
+
+	if len(l.queue) >= l.cfg.MaxQueue {
+		// Make room by shedding a less important waiter
+		victim := l.lowest()
+		if victim < 0 || l.queue[victim].priority >= priority {
+			l.mu.Unlock()
+			l.shed.Add(1)
+			return nil, ErrOverloaded
+		}
+		l.queue[victim].ready <- false
+		l.remove(victim)
+		l.shed.Add(1)
+	}
+
+	w := &waiter{priority: priority, enqueued: time.Now(), ready: make(chan bool, 1)}
+	l.queue = append(l.queue, w)
+	timeout := l.cfg.MaxQueueTime
+	if l.overloaded {
+		timeout = l.cfg.TargetDelay
+	}
+	l.mu.Unlock()
+	l.queued.Add(1)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case ok := <-w.ready:
+		return l.admit(ok)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	for i, queued := range l.queue {
+		if queued == w {
+			l.remove(i)
+			l.mu.Unlock()
+			l.shed.Add(1)
+			return nil, ErrOverloaded
+		}
+	}
+	l.mu.Unlock()
+
+	// The waiter was admitted or shed while timing out
+	return l.admit(<-w.ready)
+}
+
+func (l *Limiter) admit(ok bool) (func(), error) {
+	if !ok {
+		return nil, ErrOverloaded
+	}
+	l.admitted.Add(1)
+	return l.release, nil
+}
+
+// release hands the slot to the next waiter or frees it
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next := l.next()
+	if next < 0 {
+		l.inflight--
+		l.aboveSince = time.Time{}
+		l.setOverloaded(false)
+		return
+	}
+
+	w := l.queue[next]
+	l.remove(next)
+	l.observe(time.Since(w.enqueued))
+	w.ready <- true
+}
+
+// observe updates the overload state with the queue delay of a request
+func (l *Limiter) observe(delay time.Duration) {
+	if delay < l.cfg.TargetDelay {
+		l.aboveSince = time.Time{}
+		l.setOverloaded(false)
+		return
+	}
+	now := time.Now()
+	if l.aboveSince.IsZero() {
+		l.aboveSince = now
+	} else if now.Sub(l.aboveSince) >= l.cfg.Interval {
+		l.setOverloaded(true)
+	}
+}
+
+func (l *Limiter) setOverloaded(overloaded bool) {
+	if l.overloaded == overloaded {
+		return
+	}
+	l.overloaded = overloaded
+	if l.onChange != nil {
+		l.onChange(overloaded)
+	}
+}
+
+// next returns the index of the waiter to admit: the most important one,
+// oldest first normally and newest first while overloaded
+func (l *Limiter) next() int {
+	best := -1
+	for i, w := range l.queue {
+		if best < 0 || w.priority > l.queue[best].priority ||
+			(w.priority == l.queue[best].priority && l.overloaded) {
+			best = i
+		}
+	}
+	return best
+}
+
+// lowest returns the index of the least important, newest waiter
+func (l *Limiter) lowest() int {
+	worst := -1
+	for i, w := range l.queue {
+		if worst < 0 || w.priority <= l.queue[worst].priority {
+			worst = i
+		}
+	}
+	return worst
+}
+
+func (l *Limiter) remove(i int) {
+	copy(l.queue[i:], l.queue[i+1:])
+	l.queue[len(l.queue)-1] = nil
+	l.queue = l.queue[:len(l.queue)-1]
+}
+
+// Stats returns the current state and counters
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	stats := Stats{
+		InFlight:   l.inflight,
+		Queued:     len(l.queue),
+		Overloaded: l.overloaded,
+	}
+	l.mu.Unlock()
+
+	stats.AdmittedTotal = l.admitted.Load()
+	stats.QueuedTotal = l.queued.Load()
+	stats.ShedTotal = l.shed.Load()
+	return stats
+}
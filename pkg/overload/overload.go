@@ -0,0 +1,128 @@
+// Package overload protects the gateway and its upstreams from overload.
+// Service requests beyond a concurrency limit are queued, and when the
+// queue delay shows the gateway cannot keep up, excess requests are shed
+// with 503 and Retry-After, least important first, so the latency of the
+// requests that are served stays stable.
+package overload
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"odin/pkg/config"
+	"odin/pkg/websocket"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Guard applies a shared Limiter to service requests, prioritized by the
+// configured request classes
+type Guard struct {
+	config  config.OverloadConfig
+	limiter *Limiter
+	logger  *logrus.Logger
+}
+
+// New creates a guard from the configuration
+func New(cfg config.OverloadConfig, logger *logrus.Logger) *Guard {
+	g := &Guard{config: cfg, logger: logger}
+	g.limiter = NewLimiter(LimiterConfig{
+		MaxConcurrent: cfg.MaxConcurrent,
+		MaxQueue:      cfg.MaxQueue,
+		MaxQueueTime:  cfg.MaxQueueTime,
+		TargetDelay:   cfg.TargetDelay,
+		Interval:      cfg.Interval,
+	}, g.logTransition)
+	return g
+}
+
+// Middleware limits the requests of a service
+func (g *Guard) Middleware(serviceName string) echo.MiddlewareFunc {
+	retryAfter := strconv.Itoa(int((g.config.RetryAfter + 999_999_999) / 1_000_000_000))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// WebSocket connections are bounded by their own limits; holding a
+			// slot for their whole lifetime would starve ordinary requests
+			req := c.Request()
+			if websocket.IsUpgrade(req) {
+				return next(c)
+			}
+
+			release, err := g.limiter.Acquire(req.Context(), g.Priority(serviceName, req))
+			if err != nil {
+				c.Response().Header().Set("Retry-After", retryAfter)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Service overloaded, retry later")
+			}
+			defer release()
+
+			return next(c)
+		}
+	}
+}
+
+// Priority returns the priority of the first class matching the request, or
+// 0 when none does
+func (g *Guard) Priority(serviceName string, req *http.Request) int {
+	for _, class := range g.config.Classes {
+		if matches(class, serviceName, req) {
+			return class.Priority
+		}
+	}
+	return 0
+}
+
+func matches(class config.OverloadClass, serviceName string, req *http.Request) bool {
+	if len(class.Services) > 0 && !contains(class.Services, serviceName) {
+		return false
+	}
+	if len(class.Methods) > 0 && !contains(class.Methods, req.Method) {
+		return false
+	}
+	if len(class.Paths) > 0 {
+		matched := false
+		for _, prefix := range class.Paths {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if class.Header != "" {
+		values := req.Header.Values(class.Header)
+		if len(values) == 0 || (class.HeaderValue != "" && !contains(values, class.HeaderValue)) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the limiter's current state and counters
+func (g *Guard) Stats() Stats {
+	return g.limiter.Stats()
+}
+
+func (g *Guard) logTransition(overloaded bool) {
+	if overloaded {
+		g.logger.WithFields(logrus.Fields{
+			"maxConcurrent": g.config.MaxConcurrent,
+			"targetDelay":   g.config.TargetDelay,
+		}).Warn("Gateway overloaded, shedding excess requests")
+	} else {
+		g.logger.Info("Gateway no longer overloaded")
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"reflect"
 	"sync"
 
+	"odin/pkg/events"
+	"odin/pkg/requestid"
+
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
@@ -31,6 +34,8 @@ type PluginContext struct {
 	Body        []byte
 	UserID      string
 	Metadata    map[string]interface{}
+
+	disabled map[string]bool // Plugins skipped for this request
 }
 
 // Plugin interface that all plugins must implement
@@ -101,6 +106,8 @@ type PluginManager struct {
 	middlewareChain *MiddlewareChain
 	tester          *MiddlewareTester
 	rollback        *MiddlewareRollback
+	events          events.Publisher
+	gates           map[string]func(echo.Context) bool
 	logger          *logrus.Logger
 	mu              sync.RWMutex
 }
@@ -268,6 +275,13 @@ func (w *pluginWrapper) Cleanup() error {
 	return nil
 }
 
+// SetEventPublisher enables plugin.loaded and plugin.unloaded events
+func (pm *PluginManager) SetEventPublisher(publisher events.Publisher) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.events = publisher
+}
+
 // LoadPlugin loads a plugin from a file
 func (pm *PluginManager) LoadPlugin(name, path string, config map[string]interface{}, hooks []string) error {
 	pm.mu.Lock()
@@ -303,6 +317,23 @@ func (pm *PluginManager) LoadPlugin(name, path string, config map[string]interfa
 		}
 	}
 
+	return pm.register(name, path, pluginInstance, config, hooks)
+}
+
+// RegisterPlugin adds a plugin built into the program, such as one passed to
+// an embedded gateway, as if it had been loaded from a file
+func (pm *PluginManager) RegisterPlugin(p Plugin, config map[string]interface{}, hooks []string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, exists := pm.plugins[p.Name()]; exists {
+		return fmt.Errorf("plugin %s is already loaded", p.Name())
+	}
+	return pm.register(p.Name(), "", p, config, hooks)
+}
+
+// register initializes a plugin and adds it to its hooks; pm.mu must be held
+func (pm *PluginManager) register(name, path string, pluginInstance Plugin, config map[string]interface{}, hooks []string) error {
 	// Initialize the plugin
 	if err := pluginInstance.Initialize(config); err != nil {
 		return fmt.Errorf("failed to initialize plugin %s: %w", name, err)
@@ -330,6 +361,14 @@ func (pm *PluginManager) LoadPlugin(name, path string, config map[string]interfa
 		"hooks":  hooks,
 	}).Info("Plugin loaded successfully")
 
+	if pm.events != nil {
+		pm.events.Publish(events.PluginLoaded, map[string]interface{}{
+			"plugin": name,
+			"path":   path,
+			"hooks":  hooks,
+		})
+	}
+
 	return nil
 }
 
@@ -362,6 +401,13 @@ func (pm *PluginManager) UnloadPlugin(name string) error {
 	delete(pm.plugins, name)
 
 	pm.logger.WithField("plugin", name).Info("Plugin unloaded")
+
+	if pm.events != nil {
+		pm.events.Publish(events.PluginUnloaded, map[string]interface{}{
+			"plugin": name,
+		})
+	}
+
 	return nil
 }
 
@@ -372,6 +418,9 @@ func (pm *PluginManager) ExecuteHook(hookType HookType, ctx context.Context, plu
 	pm.mu.RUnlock()
 
 	for _, plugin := range plugins {
+		if pluginCtx != nil && pluginCtx.disabled[plugin.Name()] {
+			continue
+		}
 		var err error
 		switch hookType {
 		case PreRequestHook:
@@ -396,6 +445,17 @@ func (pm *PluginManager) ExecuteHook(hookType HookType, ctx context.Context, plu
 	return nil
 }
 
+// SetGate runs the named plugin only for the requests enabled returns true
+// for
+func (pm *PluginManager) SetGate(name string, enabled func(echo.Context) bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.gates == nil {
+		pm.gates = make(map[string]func(echo.Context) bool)
+	}
+	pm.gates[name] = enabled
+}
+
 // ListPlugins returns a list of loaded plugin names
 func (pm *PluginManager) ListPlugins() []string {
 	pm.mu.RLock()
@@ -423,12 +483,22 @@ func (pm *PluginManager) PluginMiddleware() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			// Create plugin context
 			pluginCtx := &PluginContext{
-				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				RequestID: requestid.Get(c),
 				Path:      c.Request().URL.Path,
 				Method:    c.Request().Method,
 				Headers:   c.Request().Header,
 				Metadata:  make(map[string]interface{}),
 			}
+			pm.mu.RLock()
+			for name, enabled := range pm.gates {
+				if !enabled(c) {
+					if pluginCtx.disabled == nil {
+						pluginCtx.disabled = make(map[string]bool)
+					}
+					pluginCtx.disabled[name] = true
+				}
+			}
+			pm.mu.RUnlock()
 
 			// Execute pre-request hooks
 			if err := pm.ExecuteHook(PreRequestHook, c.Request().Context(), pluginCtx); err != nil {
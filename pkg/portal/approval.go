@@ -0,0 +1,130 @@
+package portal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+	"odin/pkg/products"
+)
+
+var (
+	// ErrKeyNotFound is returned when reviewing a key that does not exist
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrNotPending is returned when reviewing a key that was already reviewed
+	ErrNotPending = errors.New("API key is not pending approval")
+)
+
+// SetEventPublisher publishes apikey.requested when a key needing approval is
+// created, and apikey.approved or apikey.rejected when it is reviewed, so
+// admins and developers can be notified through webhooks
+func (p *Portal) SetEventPublisher(publisher events.Publisher) {
+	p.publisher = publisher
+}
+
+// requiresApproval reports whether keys of plan stay pending until approved
+func (p *Portal) requiresApproval(plan *products.Plan) bool {
+	return p.cfg.RequireApproval || plan.RequireApproval
+}
+
+// Keys returns the API keys with an approval status, oldest first. Keys
+// without a status count as approved.
+func (p *Portal) Keys(ctx context.Context, status string) ([]*mongodb.APIKeyDocument, error) {
+	keys, err := p.store.ListAPIKeys(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make([]*mongodb.APIKeyDocument, 0, len(keys))
+	for _, key := range keys {
+		keyStatus := key.Status
+		if keyStatus == "" {
+			keyStatus = mongodb.APIKeyApproved
+		}
+		if keyStatus == status {
+			matching = append(matching, key)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].CreatedAt.Before(matching[j].CreatedAt) })
+	return matching, nil
+}
+
+// Approve lets a pending key authenticate
+func (p *Portal) Approve(ctx context.Context, id, reviewer string) (*mongodb.APIKeyDocument, error) {
+	return p.review(ctx, id, reviewer, mongodb.APIKeyApproved, "")
+}
+
+// Reject refuses a pending key for good; the developer sees the reason
+func (p *Portal) Reject(ctx context.Context, id, reviewer, reason string) (*mongodb.APIKeyDocument, error) {
+	return p.review(ctx, id, reviewer, mongodb.APIKeyRejected, reason)
+}
+
+func (p *Portal) review(ctx context.Context, id, reviewer, status, reason string) (*mongodb.APIKeyDocument, error) {
+	p.reviewMu.Lock()
+	defer p.reviewMu.Unlock()
+
+	keys, err := p.store.ListAPIKeys(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var key *mongodb.APIKeyDocument
+	for _, k := range keys {
+		if k.ID == id {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, ErrKeyNotFound
+	}
+	if key.Status != mongodb.APIKeyPending {
+		return nil, ErrNotPending
+	}
+
+	reviewed := *key
+	now := time.Now()
+	reviewed.Status = status
+	reviewed.ReviewedBy = reviewer
+	reviewed.ReviewedAt = &now
+	reviewed.RejectReason = reason
+	if err := p.store.UpdateAPIKey(ctx, id, &reviewed); err != nil {
+		return nil, fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	eventType := events.APIKeyApproved
+	if status == mongodb.APIKeyRejected {
+		eventType = events.APIKeyRejected
+	}
+	p.publish(ctx, eventType, &reviewed)
+	return &reviewed, nil
+}
+
+// publish emits an event about key, with the contact details of its owner
+func (p *Portal) publish(ctx context.Context, eventType events.EventType, key *mongodb.APIKeyDocument) {
+	if p.publisher == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"id":     key.ID,
+		"name":   key.Name,
+		"plan":   key.Plan,
+		"userId": key.UserID,
+		"status": key.Status,
+	}
+	if user, err := p.store.GetUser(ctx, key.UserID); err == nil && user != nil {
+		data["username"] = user.Username
+		data["email"] = user.Email
+	}
+	if key.ReviewedBy != "" {
+		data["reviewedBy"] = key.ReviewedBy
+	}
+	if key.RejectReason != "" {
+		data["reason"] = key.RejectReason
+	}
+	p.publisher.Publish(eventType, data)
+}
@@ -0,0 +1,138 @@
+package portal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"odin/pkg/integrations/postman"
+	"odin/pkg/openapi"
+	"odin/pkg/products"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrUnknownProduct is returned for products that are not in the catalog
+var ErrUnknownProduct = errors.New("product not found")
+
+// SetAPIKeyHeader sets the header the gateway reads API keys from, which the
+// Postman collections of products authenticate with (default: X-API-Key)
+func (p *Portal) SetAPIKeyHeader(header string) {
+	p.apiKeyHeader = header
+}
+
+// ProductSpec aggregates the OpenAPI documents of a product's services into
+// one, with the paths the gateway serves them under. Operations are tagged
+// with their service unless their document tags them.
+func (p *Portal) ProductSpec(name string) (*openapi.Spec, error) {
+	var product *products.Product
+	for _, candidate := range p.catalog.Products() {
+		if candidate.Name == name {
+			product = candidate
+			break
+		}
+	}
+	if product == nil {
+		return nil, ErrUnknownProduct
+	}
+
+	generator := openapi.NewGenerator(product.Name, "1.0.0", product.Description)
+	for _, svc := range p.services {
+		if svc.Spec == nil || !slices.Contains(product.Services, svc.Name) {
+			continue
+		}
+		if err := generator.AddSpec(svc.Spec, svc.PathPrefix, svc.Name); err != nil {
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+	}
+	return generator.GetSpec(), nil
+}
+
+func (p *Portal) productSpec(c echo.Context) error {
+	spec, err := p.ProductSpec(c.Param("name"))
+	if err != nil {
+		return p.productSpecError(c, err)
+	}
+	spec.Servers = []openapi.Server{{URL: gatewayURL(c)}}
+	return c.JSON(http.StatusOK, spec)
+}
+
+// productBundle serves a zip of a product's OpenAPI document with the
+// Postman collection and environment generated from it
+func (p *Portal) productBundle(c echo.Context) error {
+	name := c.Param("name")
+	spec, err := p.ProductSpec(name)
+	if err != nil {
+		return p.productSpecError(c, err)
+	}
+	baseURL := gatewayURL(c)
+	spec.Servers = []openapi.Server{{URL: baseURL}}
+
+	transformer := postman.NewTransformer()
+	collection, err := transformer.OpenAPIToPostman(spec, p.apiKeyHeader)
+	if err != nil {
+		p.logger.WithError(err).WithField("product", name).Error("Failed to generate Postman collection")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate bundle"})
+	}
+	environment := transformer.OpenAPIEnvironment(name, baseURL)
+
+	bundle, err := zipFiles(map[string]interface{}{
+		"openapi.json":                     spec,
+		name + ".postman_collection.json":  collection,
+		name + ".postman_environment.json": environment,
+	})
+	if err != nil {
+		p.logger.WithError(err).WithField("product", name).Error("Failed to write bundle")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate bundle"})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-bundle.zip"`, name))
+	return c.Blob(http.StatusOK, "application/zip", bundle)
+}
+
+func (p *Portal) productSpecError(c echo.Context, err error) error {
+	if errors.Is(err, ErrUnknownProduct) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Product not found"})
+	}
+	p.logger.WithError(err).WithField("product", c.Param("name")).Error("Failed to aggregate product OpenAPI document")
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate OpenAPI document"})
+}
+
+// zipFiles archives files, by name, as indented JSON
+func zipFiles(files map[string]interface{}) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range names {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gatewayURL is the URL clients reached the gateway at
+func gatewayURL(c echo.Context) string {
+	return c.Scheme() + "://" + c.Request().Host
+}
@@ -0,0 +1,191 @@
+package portal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// keySource marks the keys created through the portal in their metadata
+const keySource = "portal"
+
+// keyView is an API key as its owner sees it. Only the prefix of the key is
+// shown once it has been created.
+type keyView struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Plan      string     `json:"plan,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Enabled   bool       `json:"enabled"`
+	RateLimit int        `json:"rateLimit,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastUsed  time.Time  `json:"lastUsed"`
+	// Approval of the key, for plans that need it
+	Status       string `json:"status,omitempty"`
+	RejectReason string `json:"rejectReason,omitempty"`
+}
+
+func newKeyView(key *mongodb.APIKeyDocument) keyView {
+	return keyView{
+		ID:        key.ID,
+		Name:      key.Name,
+		Plan:      key.Plan,
+		Prefix:    key.Key[:min(8, len(key.Key))],
+		Enabled:   key.Enabled,
+		RateLimit: key.RateLimit,
+		ExpiresAt: key.ExpiresAt,
+		CreatedAt: key.CreatedAt,
+		LastUsed:  key.LastUsed,
+
+		Status:       key.Status,
+		RejectReason: key.RejectReason,
+	}
+}
+
+func (p *Portal) listKeys(c echo.Context) error {
+	user := c.Get("portalUser").(*mongodb.UserDocument)
+	keys, err := p.store.ListAPIKeys(c.Request().Context(), user.ID)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to list portal API keys")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list API keys"})
+	}
+
+	views := make([]keyView, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newKeyView(key))
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+func (p *Portal) createKey(c echo.Context) error {
+	user := c.Get("portalUser").(*mongodb.UserDocument)
+	var req struct {
+		Name string `json:"name"`
+		Plan string `json:"plan"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	var details []string
+	if req.Name == "" || len(req.Name) > 100 {
+		details = append(details, "name must be 1 to 100 characters")
+	}
+	if req.Plan == "" {
+		details = append(details, "plan is required")
+	}
+	if len(details) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Request validation failed",
+			"details": details,
+		})
+	}
+
+	if !slices.Contains(p.entitlements(user), req.Plan) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("You are not entitled to plan %s", req.Plan)})
+	}
+	plan, _ := p.catalog.Plan(req.Plan)
+
+	ctx := c.Request().Context()
+	keys, err := p.store.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to list portal API keys")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create API key"})
+	}
+	if len(keys) >= p.cfg.MaxKeysPerUser {
+		return c.JSON(http.StatusConflict, map[string]string{"error": fmt.Sprintf("You already have the maximum of %d API keys", p.cfg.MaxKeysPerUser)})
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		p.logger.WithError(err).Error("Failed to generate API key")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create API key"})
+	}
+	key := &mongodb.APIKeyDocument{
+		ID:          uuid.New().String(),
+		Key:         "odin_" + hex.EncodeToString(secret),
+		Name:        req.Name,
+		UserID:      user.ID,
+		Permissions: plan.Product.Services,
+		RateLimit:   plan.RateLimit,
+		Plan:        plan.ID,
+		Enabled:     true,
+		Metadata:    map[string]string{"source": keySource},
+	}
+	if plan.KeyTTL > 0 {
+		expiresAt := time.Now().Add(plan.KeyTTL)
+		key.ExpiresAt = &expiresAt
+	}
+	if p.requiresApproval(plan) {
+		key.Status = mongodb.APIKeyPending
+	}
+	if err := p.store.CreateAPIKey(ctx, key); err != nil {
+		p.logger.WithError(err).Error("Failed to create portal API key")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create API key"})
+	}
+	if key.Status == mongodb.APIKeyPending {
+		p.publish(ctx, events.APIKeyRequested, key)
+	}
+
+	// The key itself is only ever returned here
+	view := newKeyView(key)
+	view.Key = key.Key
+	return c.JSON(http.StatusCreated, view)
+}
+
+func (p *Portal) deleteKey(c echo.Context) error {
+	user := c.Get("portalUser").(*mongodb.UserDocument)
+	ctx := c.Request().Context()
+	keys, err := p.store.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to list portal API keys")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete API key"})
+	}
+
+	for _, key := range keys {
+		if key.ID != c.Param("id") {
+			continue
+		}
+		if err := p.store.DeleteAPIKey(ctx, key.ID); err != nil {
+			p.logger.WithError(err).Error("Failed to delete portal API key")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete API key"})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+}
+
+// Middleware runs after a service's authentication and counts the requests
+// made with any key a user owns towards their usage, including those the
+// key's plan rejects
+func (p *Portal) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, ok := c.Get("apiKey").(*mongodb.APIKeyDocument)
+			if !ok || key.UserID == "" {
+				return next(c)
+			}
+
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+			p.usage.record(usageKey{key.UserID, key.ID, service}, status >= 400)
+			return err
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package portal
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+	"odin/pkg/openapi"
+	"odin/pkg/products"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// tokenAudience keeps portal tokens apart from gateway JWTs
+	tokenAudience = "odin-portal"
+	// developerRole is the role of users who sign up through the portal
+	developerRole = "developer"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,64}$`)
+
+// Store keeps developers, their API keys and their usage, e.g. the MongoDB
+// repository
+type Store interface {
+	CreateUser(ctx context.Context, user *mongodb.UserDocument) error
+	GetUser(ctx context.Context, id string) (*mongodb.UserDocument, error)
+	GetUserByUsername(ctx context.Context, username string) (*mongodb.UserDocument, error)
+	CreateAPIKey(ctx context.Context, key *mongodb.APIKeyDocument) error
+	ListAPIKeys(ctx context.Context, userID string) ([]*mongodb.APIKeyDocument, error)
+	UpdateAPIKey(ctx context.Context, id string, key *mongodb.APIKeyDocument) error
+	DeleteAPIKey(ctx context.Context, id string) error
+	SaveMetric(ctx context.Context, metric *mongodb.MetricDocument) error
+	QueryMetrics(ctx context.Context, name string, start, end time.Time, labels map[string]string) ([]*mongodb.MetricDocument, error)
+}
+
+// Service is a service published in the portal
+type Service struct {
+	Name     string        `json:"name"`
+	BasePath string        `json:"basePath"`
+	Products []string      `json:"products"` // Filled in by New
+	Spec     *openapi.Spec `json:"-"`
+	// Prepended to the paths of Spec when they are relative to the backend
+	PathPrefix string `json:"-"`
+}
+
+// Portal serves the developer portal API, where developers subscribe API
+// keys to the plans of products, and records the usage of their keys
+type Portal struct {
+	cfg      config.PortalConfig
+	catalog  *products.Catalog
+	store    Store
+	services []*Service // Sorted by name
+	key      []byte
+	logger   *logrus.Logger
+
+	usage  *usageRecorder
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	apiKeyHeader string
+	publisher    events.Publisher
+	reviewMu     sync.Mutex // Serializes key reviews
+}
+
+// New creates the portal for the services in the catalog's products and
+// starts recording usage. Portal tokens are signed with a key derived from the
+// gateway's JWT secret, so they are not accepted as gateway JWTs.
+func New(cfg config.PortalConfig, catalog *products.Catalog, store Store, services []Service, jwtSecret string, logger *logrus.Logger) (*Portal, error) {
+	if jwtSecret == "" {
+		return nil, errors.New("a JWT secret is required to sign portal tokens")
+	}
+
+	p := &Portal{
+		cfg:     cfg,
+		catalog: catalog,
+		store:   store,
+		logger:  logger,
+		usage:   newUsageRecorder(),
+
+		apiKeyHeader: "X-API-Key",
+	}
+	key := sha256.Sum256([]byte("odin-portal:" + jwtSecret))
+	p.key = key[:]
+
+	byName := make(map[string]*Service)
+	for i := range services {
+		svc := services[i]
+		svc.Products = nil
+		byName[svc.Name] = &svc
+	}
+	for _, product := range catalog.Products() {
+		for _, name := range product.Services {
+			svc, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("product %s: unknown service %s", product.Name, name)
+			}
+			svc.Products = append(svc.Products, product.Name)
+		}
+	}
+	for _, svc := range byName {
+		if len(svc.Products) > 0 {
+			p.services = append(p.services, svc)
+		}
+	}
+	sort.Slice(p.services, func(i, j int) bool { return p.services[i].Name < p.services[j].Name })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Add(1)
+	go p.flushLoop(ctx)
+
+	return p, nil
+}
+
+// Stop stops recording usage and saves what has not been saved yet
+func (p *Portal) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Register adds the portal API to e under the configured path
+func (p *Portal) Register(e *echo.Echo) {
+	api := e.Group(p.cfg.Path + "/api")
+	api.Use(noStore)
+
+	api.POST("/register", p.register)
+	api.POST("/login", p.login)
+	api.GET("/products", p.listProducts)
+	api.GET("/products/:name/openapi", p.productSpec)
+	api.GET("/products/:name/bundle", p.productBundle)
+	api.GET("/services", p.listServices)
+	api.GET("/services/:name/openapi", p.serviceSpec)
+
+	api.GET("/me", p.me, p.authenticate)
+	api.GET("/keys", p.listKeys, p.authenticate)
+	api.POST("/keys", p.createKey, p.authenticate)
+	api.DELETE("/keys/:id", p.deleteKey, p.authenticate)
+	api.GET("/usage", p.getUsage, p.authenticate)
+}
+
+// noStore keeps responses, which are specific to a developer, out of shared
+// caches including the gateway's own
+func noStore(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "no-store")
+		return next(c)
+	}
+}
+
+// authenticate accepts a portal token and stores the developer's document in
+// the context as "portalUser". Users disabled since they logged in are
+// rejected.
+func (p *Portal) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing portal token"})
+		}
+
+		claims := &jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return p.key, nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(tokenAudience))
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired portal token"})
+		}
+
+		user, err := p.store.GetUser(c.Request().Context(), claims.Subject)
+		if err != nil || user == nil || !user.Active {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired portal token"})
+		}
+
+		c.Set("portalUser", user)
+		return next(c)
+	}
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// profile is a developer as the portal shows them
+type profile struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Plans     []string  `json:"plans"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      profile   `json:"user"`
+}
+
+func (p *Portal) register(c echo.Context) error {
+	if !p.cfg.AllowRegistration {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Registration is disabled"})
+	}
+
+	var req credentials
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	var details []string
+	if !usernamePattern.MatchString(req.Username) {
+		details = append(details, "username must be 3 to 64 letters, digits, '.', '_' or '-'")
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		details = append(details, "email must be a valid address")
+	}
+	if len(req.Password) < 8 || len(req.Password) > 72 {
+		details = append(details, "password must be 8 to 72 characters")
+	}
+	if len(details) > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Request validation failed",
+			"details": details,
+		})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to hash portal password")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to register"})
+	}
+
+	user := &mongodb.UserDocument{
+		ID:       uuid.New().String(),
+		Username: req.Username,
+		Email:    req.Email,
+		Password: string(hash),
+		Role:     developerRole,
+		Active:   true,
+		APIKeys:  []string{},
+	}
+	if err := p.store.CreateUser(c.Request().Context(), user); err != nil {
+		if errors.Is(err, mongodb.ErrDuplicate) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Username or email is already registered"})
+		}
+		p.logger.WithError(err).Error("Failed to create portal user")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to register"})
+	}
+
+	p.logger.WithField("username", user.Username).Info("Developer registered in portal")
+	return p.startSession(c, http.StatusCreated, user)
+}
+
+func (p *Portal) login(c echo.Context) error {
+	var req credentials
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	user, err := p.store.GetUserByUsername(c.Request().Context(), req.Username)
+	if err != nil || user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid username or password"})
+	}
+	if !user.Active {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Account is disabled"})
+	}
+
+	return p.startSession(c, http.StatusOK, user)
+}
+
+// startSession answers with a new portal token for user
+func (p *Portal) startSession(c echo.Context, status int, user *mongodb.UserDocument) error {
+	now := time.Now()
+	expiresAt := now.Add(p.cfg.TokenTTL)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   user.ID,
+		Audience:  jwt.ClaimStrings{tokenAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString(p.key)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to sign portal token")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
+	}
+
+	return c.JSON(status, session{Token: token, ExpiresAt: expiresAt, User: p.profile(user)})
+}
+
+func (p *Portal) profile(user *mongodb.UserDocument) profile {
+	return profile{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Plans:     p.entitlements(user),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// entitlements returns the IDs of the plans user may subscribe keys to: the
+// default plans and those granted to them, as long as they are still
+// configured
+func (p *Portal) entitlements(user *mongodb.UserDocument) []string {
+	plans := []string{}
+	for _, id := range append(append([]string{}, p.cfg.DefaultPlans...), user.Plans...) {
+		if _, ok := p.catalog.Plan(id); ok && !slices.Contains(plans, id) {
+			plans = append(plans, id)
+		}
+	}
+	return plans
+}
+
+func (p *Portal) me(c echo.Context) error {
+	return c.JSON(http.StatusOK, p.profile(c.Get("portalUser").(*mongodb.UserDocument)))
+}
+
+type planView struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	RateLimit   int    `json:"rateLimit,omitempty"`
+	Quota       int    `json:"quota,omitempty"`
+	QuotaPeriod string `json:"quotaPeriod,omitempty"`
+	KeyTTL      string `json:"keyTTL,omitempty"`
+	// Keys of the plan stay pending until an admin approves them
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+type productView struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Services    []string   `json:"services"`
+	Plans       []planView `json:"plans"`
+}
+
+func (p *Portal) listProducts(c echo.Context) error {
+	views := make([]productView, 0, len(p.catalog.Products()))
+	for _, product := range p.catalog.Products() {
+		view := productView{
+			Name:        product.Name,
+			Description: product.Description,
+			Services:    product.Services,
+			Plans:       make([]planView, 0, len(product.Plans)),
+		}
+		for _, plan := range product.Plans {
+			pv := planView{
+				ID:          plan.ID,
+				Name:        plan.Name,
+				Description: plan.Description,
+				RateLimit:   plan.RateLimit,
+			}
+			if plan.Quota > 0 {
+				pv.Quota = plan.Quota
+				pv.QuotaPeriod = plan.QuotaPeriod
+			}
+			if plan.KeyTTL > 0 {
+				pv.KeyTTL = plan.KeyTTL.String()
+			}
+			pv.RequireApproval = p.requiresApproval(plan)
+			view.Plans = append(view.Plans, pv)
+		}
+		views = append(views, view)
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+func (p *Portal) listServices(c echo.Context) error {
+	return c.JSON(http.StatusOK, p.services)
+}
+
+func (p *Portal) serviceSpec(c echo.Context) error {
+	for _, svc := range p.services {
+		if svc.Name != c.Param("name") {
+			continue
+		}
+		if svc.Spec == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Service has no OpenAPI document"})
+		}
+		return c.JSON(http.StatusOK, svc.Spec)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Service not found"})
+}
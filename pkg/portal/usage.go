@@ -0,0 +1,202 @@
+package portal
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// usageMetric names the metric documents usage is saved as
+	usageMetric = "portal_usage"
+	// usageFlushInterval is how often counted requests are saved
+	usageFlushInterval = time.Minute
+	// usageRetention is how long metrics are kept, and how far back usage
+	// is reported by default
+	usageRetention = 30 * 24 * time.Hour
+)
+
+// usageKey identifies the requests counted together
+type usageKey struct {
+	userID  string
+	keyID   string
+	service string
+}
+
+type usageCount struct {
+	requests int64
+	errors   int64
+}
+
+// usageRecorder counts requests in memory until they are saved
+type usageRecorder struct {
+	mu     sync.Mutex
+	counts map[usageKey]*usageCount
+}
+
+func newUsageRecorder() *usageRecorder {
+	return &usageRecorder{counts: make(map[usageKey]*usageCount)}
+}
+
+func (u *usageRecorder) record(key usageKey, failed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	count, ok := u.counts[key]
+	if !ok {
+		count = &usageCount{}
+		u.counts[key] = count
+	}
+	count.requests++
+	if failed {
+		count.errors++
+	}
+}
+
+// take returns the counts so far and starts over
+func (u *usageRecorder) take() map[usageKey]*usageCount {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	counts := u.counts
+	u.counts = make(map[usageKey]*usageCount)
+	return counts
+}
+
+func (p *Portal) flushLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.flush() // Final flush
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// flush saves the requests counted since the last flush, one metric per
+// user, key and service
+func (p *Portal) flush() {
+	counts := p.usage.take()
+	if len(counts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for key, count := range counts {
+		err := p.store.SaveMetric(ctx, &mongodb.MetricDocument{
+			Name:  usageMetric,
+			Type:  "counter",
+			Value: float64(count.requests),
+			Labels: map[string]string{
+				"userId":  key.userID,
+				"keyId":   key.keyID,
+				"service": key.service,
+			},
+			Metadata: map[string]interface{}{"errors": float64(count.errors)},
+		})
+		if err != nil {
+			p.logger.WithError(err).WithField("service", key.service).Error("Failed to save portal usage")
+		}
+	}
+}
+
+type usageTotals struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+func (t *usageTotals) add(requests, errors int64) {
+	t.Requests += requests
+	t.Errors += errors
+}
+
+func addTo(totals map[string]*usageTotals, key string, requests, errors int64) {
+	if totals[key] == nil {
+		totals[key] = &usageTotals{}
+	}
+	totals[key].add(requests, errors)
+}
+
+// usageReport is a developer's usage over a period, in total and broken down
+// by key, service and day (UTC)
+type usageReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	usageTotals
+	Keys     map[string]*usageTotals `json:"keys"`
+	Services map[string]*usageTotals `json:"services"`
+	Days     map[string]*usageTotals `json:"days"`
+}
+
+func (p *Portal) getUsage(c echo.Context) error {
+	user := c.Get("portalUser").(*mongodb.UserDocument)
+
+	now := time.Now().UTC()
+	to, err := parseTime(c.QueryParam("to"), now, true)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be an RFC 3339 time or a date"})
+	}
+	from, err := parseTime(c.QueryParam("from"), to.Add(-usageRetention), false)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be an RFC 3339 time or a date"})
+	}
+	if from.After(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+
+	labels := map[string]string{"userId": user.ID}
+	if key := c.QueryParam("key"); key != "" {
+		labels["keyId"] = key
+	}
+	metrics, err := p.store.QueryMetrics(c.Request().Context(), usageMetric, from, to, labels)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to query portal usage")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load usage"})
+	}
+
+	report := usageReport{
+		From:     from,
+		To:       to,
+		Keys:     make(map[string]*usageTotals),
+		Services: make(map[string]*usageTotals),
+		Days:     make(map[string]*usageTotals),
+	}
+	for _, metric := range metrics {
+		requests := int64(metric.Value)
+		errors, _ := metric.Metadata["errors"].(float64)
+		report.add(requests, int64(errors))
+		addTo(report.Keys, metric.Labels["keyId"], requests, int64(errors))
+		addTo(report.Services, metric.Labels["service"], requests, int64(errors))
+		addTo(report.Days, metric.Timestamp.UTC().Format(time.DateOnly), requests, int64(errors))
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// parseTime parses an RFC 3339 time or a date, or returns def when value is
+// empty. A date is the start of the day (UTC), or its end when end is set.
+func parseTime(value string, def time.Time, end bool) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
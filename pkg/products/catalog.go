@@ -0,0 +1,86 @@
+package products
+
+import (
+	"slices"
+
+	"odin/pkg/config"
+)
+
+// Product bundles services offered together under a set of plans
+type Product struct {
+	Name        string
+	Description string
+	Services    []string
+	Plans       []*Plan
+}
+
+// Plan is a product's plan. API keys subscribe to a plan by its ID.
+type Plan struct {
+	config.PlanConfig
+	ID      string // product/plan
+	Product *Product
+}
+
+// Includes reports whether keys of the plan are accepted by service
+func (p *Plan) Includes(service string) bool {
+	return slices.Contains(p.Product.Services, service)
+}
+
+// Catalog holds the configured products and their plans
+type Catalog struct {
+	products []*Product
+	plans    map[string]*Plan
+}
+
+// NewCatalog creates a catalog of products, which are expected to have been
+// validated with the rest of the configuration
+func NewCatalog(products []config.ProductConfig) *Catalog {
+	c := &Catalog{plans: make(map[string]*Plan)}
+	for _, pc := range products {
+		product := &Product{
+			Name:        pc.Name,
+			Description: pc.Description,
+			Services:    pc.Services,
+		}
+		for _, planConfig := range pc.Plans {
+			plan := &Plan{
+				PlanConfig: planConfig,
+				ID:         PlanID(pc.Name, planConfig.Name),
+				Product:    product,
+			}
+			product.Plans = append(product.Plans, plan)
+			c.plans[plan.ID] = plan
+		}
+		c.products = append(c.products, product)
+	}
+	return c
+}
+
+// PlanID returns the ID of a product's plan
+func PlanID(product, plan string) string {
+	return product + "/" + plan
+}
+
+// Products returns the products in the order they are configured
+func (c *Catalog) Products() []*Product {
+	return c.products
+}
+
+// Plan returns the plan with id
+func (c *Catalog) Plan(id string) (*Plan, bool) {
+	plan, ok := c.plans[id]
+	return plan, ok
+}
+
+// Services returns the names of the services in any product
+func (c *Catalog) Services() []string {
+	var services []string
+	for _, product := range c.products {
+		for _, name := range product.Services {
+			if !slices.Contains(services, name) {
+				services = append(services, name)
+			}
+		}
+	}
+	return services
+}
@@ -0,0 +1,90 @@
+package products
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Enforcer applies the plans API keys are subscribed to
+type Enforcer struct {
+	catalog *Catalog
+	counter ratelimit.Counter
+	logger  *logrus.Logger
+}
+
+// NewEnforcer creates an enforcer that counts requests with counter, in
+// memory or in Redis when several gateways share the limits
+func NewEnforcer(catalog *Catalog, counter ratelimit.Counter, logger *logrus.Logger) *Enforcer {
+	return &Enforcer{
+		catalog: catalog,
+		counter: counter,
+		logger:  logger,
+	}
+}
+
+// Middleware runs after a service's authentication. Keys subscribed to a
+// plan are only accepted by the services of its product, within the plan's
+// rate limit and quota. Keys without a plan are left alone.
+func (e *Enforcer) Middleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, ok := c.Get("apiKey").(*mongodb.APIKeyDocument)
+			if !ok || key.Plan == "" {
+				return next(c)
+			}
+
+			// The plan is looked up in the configuration, so changes to it
+			// apply to existing keys
+			plan, ok := e.catalog.Plan(key.Plan)
+			if !ok || !plan.Includes(service) {
+				return echo.NewHTTPError(http.StatusForbidden, "API key's plan does not include this service")
+			}
+
+			ctx := c.Request().Context()
+			now := time.Now()
+			header := c.Response().Header()
+			if plan.RateLimit > 0 {
+				info, allowed, err := ratelimit.CheckWindow(ctx, e.counter, "plan:rate:"+key.ID, plan.RateLimit, ratelimit.PeriodMinute, now)
+				if err != nil {
+					e.logger.WithError(err).WithField("plan", plan.ID).Error("Failed to check plan rate limit")
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "Rate limit unavailable")
+				}
+				header.Set("X-RateLimit-Limit", strconv.Itoa(info.Limit))
+				header.Set("X-RateLimit-Remaining", strconv.Itoa(info.Remaining))
+				header.Set("X-RateLimit-Reset", strconv.FormatInt(info.ResetTime.Unix(), 10))
+				if !allowed {
+					header.Set("Retry-After", strconv.Itoa(retryAfter(info, now)))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+				}
+			}
+			if plan.Quota > 0 {
+				info, allowed, err := ratelimit.CheckWindow(ctx, e.counter, "plan:quota:"+key.ID, plan.Quota, plan.QuotaPeriod, now)
+				if err != nil {
+					e.logger.WithError(err).WithField("plan", plan.ID).Error("Failed to check plan quota")
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "Quota unavailable")
+				}
+				header.Set("X-Quota-Limit", strconv.Itoa(info.Limit))
+				header.Set("X-Quota-Remaining", strconv.Itoa(info.Remaining))
+				header.Set("X-Quota-Reset", strconv.FormatInt(info.ResetTime.Unix(), 10))
+				if !allowed {
+					header.Set("Retry-After", strconv.Itoa(retryAfter(info, now)))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Quota exceeded")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// retryAfter returns the seconds until the window of info starts over
+func retryAfter(info *ratelimit.LimitInfo, now time.Time) int {
+	return int(info.ResetTime.Sub(now).Seconds()) + 1
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"odin/pkg/bufpool"
 	"odin/pkg/config"
 	"strings"
 	"sync"
@@ -111,6 +112,8 @@ func (h *Handler) Handle(c echo.Context) error {
 	// Create proxy request
 	var body io.Reader
 	if c.Request().Body != nil {
+		// Not pooled: the transport may still read the body after the
+		// response is returned
 		bodyBytes, err := io.ReadAll(c.Request().Body)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
@@ -159,7 +162,7 @@ func (h *Handler) Handle(c echo.Context) error {
 
 	// Copy response body
 	c.Response().WriteHeader(resp.StatusCode)
-	_, err = io.Copy(c.Response().Writer, resp.Body)
+	_, err = bufpool.Copy(c.Response().Writer, resp.Body)
 	return err
 }
 
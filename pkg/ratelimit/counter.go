@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Periods of the fixed windows hits are counted in
+const (
+	PeriodMinute = "minute"
+	PeriodDay    = "day"
+	PeriodMonth  = "month"
+)
+
+// Counter counts hits per key in fixed windows, e.g. the requests an API key
+// makes per minute or per month
+type Counter interface {
+	// Increment adds a hit to key in the window that starts at start and
+	// returns the hits in the window so far. The count may be forgotten once
+	// the window ends at end.
+	Increment(ctx context.Context, key string, start, end time.Time) (int64, error)
+	// Ping reports whether the store hits are counted in can be reached
+	Ping(ctx context.Context) error
+}
+
+// Seeder is implemented by counters that can restore counts, e.g. those a
+// gateway persisted before it restarted
+type Seeder interface {
+	// Seed starts the window of key that starts at start at count, unless
+	// hits are counted in it already
+	Seed(ctx context.Context, key string, count int64, start, end time.Time) error
+}
+
+// Window returns the fixed window of period that t falls in. Days and months
+// start at midnight UTC.
+func Window(period string, t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	switch period {
+	case PeriodDay:
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	case PeriodMonth:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = t.Truncate(time.Minute)
+		return start, start.Add(time.Minute)
+	}
+}
+
+// CheckWindow counts a hit for key and reports whether it is within limit
+// hits per period. Hits over the limit are counted too.
+func CheckWindow(ctx context.Context, counter Counter, key string, limit int, period string, now time.Time) (*LimitInfo, bool, error) {
+	start, end := Window(period, now)
+	count, err := counter.Increment(ctx, key, start, end)
+	if err != nil {
+		return nil, false, err
+	}
+
+	remaining := limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &LimitInfo{
+		Key:       key,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetTime: end,
+		Window:    end.Sub(start),
+	}, count <= int64(limit), nil
+}
+
+// MemoryCounter counts hits in memory, for a single gateway
+type MemoryCounter struct {
+	mu        sync.Mutex
+	windows   map[string]*windowCount
+	nextSweep time.Time
+}
+
+type windowCount struct {
+	start time.Time
+	end   time.Time
+	count int64
+}
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{windows: make(map[string]*windowCount)}
+}
+
+func (m *MemoryCounter) Increment(_ context.Context, key string, start, end time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Forget ended windows once a minute, so idle keys do not pile up
+	if now := time.Now(); now.After(m.nextSweep) {
+		for k, w := range m.windows {
+			if !w.end.After(now) {
+				delete(m.windows, k)
+			}
+		}
+		m.nextSweep = now.Add(time.Minute)
+	}
+
+	w, ok := m.windows[key]
+	if !ok || !w.start.Equal(start) {
+		w = &windowCount{start: start, end: end}
+		m.windows[key] = w
+	}
+	w.count++
+	return w.count, nil
+}
+
+func (m *MemoryCounter) Seed(_ context.Context, key string, count int64, start, end time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, ok := m.windows[key]; ok && w.start.Equal(start) {
+		return nil
+	}
+	m.windows[key] = &windowCount{start: start, end: end, count: count}
+	return nil
+}
+
+func (m *MemoryCounter) Ping(_ context.Context) error {
+	return nil
+}
+
+// RedisCounter counts hits in Redis, so that every gateway sharing it
+// enforces the same limits
+type RedisCounter struct {
+	client *redis.Client
+}
+
+func NewRedisCounter(client *redis.Client) *RedisCounter {
+	return &RedisCounter{client: client}
+}
+
+func (r *RedisCounter) Increment(ctx context.Context, key string, start, end time.Time) (int64, error) {
+	windowKey := fmt.Sprintf("ratelimit:window:%s:%d", key, start.Unix())
+
+	pipe := r.client.Pipeline()
+	incrCmd := pipe.Incr(ctx, windowKey)
+	pipe.ExpireAt(ctx, windowKey, end.Add(time.Minute))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count in Redis: %w", err)
+	}
+	return incrCmd.Val(), nil
+}
+
+func (r *RedisCounter) Seed(ctx context.Context, key string, count int64, start, end time.Time) error {
+	windowKey := fmt.Sprintf("ratelimit:window:%s:%d", key, start.Unix())
+	if err := r.client.SetNX(ctx, windowKey, count, time.Until(end.Add(time.Minute))).Err(); err != nil {
+		return fmt.Errorf("failed to seed count in Redis: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisCounter) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
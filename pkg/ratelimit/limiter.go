@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
@@ -41,6 +42,7 @@ type Config struct {
 }
 
 type RedisConfig struct {
+	URL      string `yaml:"url"` // redis:// URL, used instead of the other fields
 	Address  string `yaml:"address"`
 	Password string `yaml:"password"`
 	DB       int    `yaml:"db"`
@@ -78,6 +80,7 @@ const (
 type Limiter struct {
 	config      Config
 	redisClient *redis.Client
+	store       Store
 	logger      *logrus.Logger
 	rules       map[string]Rule
 }
@@ -88,6 +91,8 @@ type LimitInfo struct {
 	Remaining int           `json:"remaining"`
 	ResetTime time.Time     `json:"reset_time"`
 	Window    time.Duration `json:"window"`
+	// RetryAfter is how long a client over the limit should wait
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
 }
 
 type RateLimiter interface {
@@ -98,13 +103,22 @@ type RateLimiter interface {
 
 func NewLimiter(config Config, logger *logrus.Logger) (*Limiter, error) {
 	var redisClient *redis.Client
+	var store Store = NewMemoryStore()
 
-	if config.Redis.Address != "" {
-		redisClient = redis.NewClient(&redis.Options{
+	if config.Redis.URL != "" || config.Redis.Address != "" {
+		opts := &redis.Options{
 			Addr:     config.Redis.Address,
 			Password: config.Redis.Password,
 			DB:       config.Redis.DB,
-		})
+		}
+		if config.Redis.URL != "" {
+			var err error
+			if opts, err = redis.ParseURL(config.Redis.URL); err != nil {
+				return nil, fmt.Errorf("invalid Redis URL: %w", err)
+			}
+		}
+		redisClient = redis.NewClient(opts)
+		store = NewRedisStore(redisClient)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -123,11 +137,18 @@ func NewLimiter(config Config, logger *logrus.Logger) (*Limiter, error) {
 	return &Limiter{
 		config:      config,
 		redisClient: redisClient,
+		store:       store,
 		logger:      logger,
 		rules:       rules,
 	}, nil
 }
 
+// SetStore keeps the limits in store, e.g. one the gateway shares with its
+// plans, instead of the limiter's own
+func (l *Limiter) SetStore(store Store) {
+	l.store = store
+}
+
 func (l *Limiter) Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -155,6 +176,11 @@ func (l *Limiter) Middleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusForbidden, "IP address is blacklisted")
 			}
 
+			// Rules without a limit let everything through
+			if limit, window := l.limits(rule); limit <= 0 || window <= 0 {
+				return next(c)
+			}
+
 			key := l.generateKey(c, rule)
 			limitInfo, allowed := l.checkLimit(c.Request().Context(), key, rule)
 
@@ -163,6 +189,7 @@ func (l *Limiter) Middleware() echo.MiddlewareFunc {
 			}
 
 			if !allowed {
+				c.Response().Header().Set("Retry-After", retryAfter(limitInfo.RetryAfter))
 				if l.config.LogViolations {
 					l.logger.WithFields(logrus.Fields{
 						"key":       key,
@@ -186,7 +213,10 @@ func (l *Limiter) shouldSkip(c echo.Context) bool {
 	path := c.Request().URL.Path
 
 	for _, skipPath := range l.config.SkipPaths {
-		if strings.HasPrefix(path, skipPath) {
+		if skipPath == "" {
+			continue
+		}
+		if path == skipPath || strings.HasPrefix(path, strings.TrimSuffix(skipPath, "/")+"/") {
 			return true
 		}
 	}
@@ -330,14 +360,9 @@ func (l *Limiter) getUserID(c echo.Context) string {
 }
 
 func (l *Limiter) CheckLimit(ctx context.Context, key string, rule *Rule) (*LimitInfo, bool) {
-	limit := rule.Limit
-	window := rule.Window
-
-	if limit <= 0 {
-		limit = l.config.DefaultLimit
-	}
-	if window <= 0 {
-		window = l.config.DefaultWindow
+	limit, window := l.limits(rule)
+	if limit <= 0 || window <= 0 {
+		return &LimitInfo{Key: key}, true
 	}
 
 	switch l.config.Algorithm {
@@ -352,89 +377,95 @@ func (l *Limiter) CheckLimit(ctx context.Context, key string, rule *Rule) (*Limi
 	}
 }
 
-func (l *Limiter) checkFixedWindow(ctx context.Context, key string, limit int, window time.Duration) (*LimitInfo, bool) {
-	if l.redisClient == nil {
-		// For local testing without Redis, we'll always allow requests
-		// In a real implementation, you'd use local storage
-		return &LimitInfo{
-			Key:       key,
-			Limit:     limit,
-			Remaining: limit - 1,
-			ResetTime: time.Now().Add(window),
-			Window:    window,
-		}, true
+// limits returns the limit and window of rule, or the defaults
+func (l *Limiter) limits(rule *Rule) (int, time.Duration) {
+	limit, window := rule.Limit, rule.Window
+	if limit <= 0 {
+		limit = l.config.DefaultLimit
 	}
+	if window <= 0 {
+		window = l.config.DefaultWindow
+	}
+	return limit, window
+}
 
-	windowKey := fmt.Sprintf("%s:%d", key, time.Now().Unix()/int64(window.Seconds()))
-
-	pipe := l.redisClient.Pipeline()
-	incrCmd := pipe.Incr(ctx, windowKey)
-	pipe.Expire(ctx, windowKey, window)
+func (l *Limiter) checkFixedWindow(ctx context.Context, key string, limit int, window time.Duration) (*LimitInfo, bool) {
+	now := time.Now()
+	start := now.Truncate(window)
+	end := start.Add(window)
 
-	_, err := pipe.Exec(ctx)
+	count, err := l.store.Increment(ctx, key, start, end)
 	if err != nil {
-		l.logger.WithError(err).Error("Redis pipeline execution failed")
-		return &LimitInfo{Key: key, Limit: limit, Remaining: 0}, false
+		l.logger.WithError(err).Error("Failed to count request for rate limiting")
+		return &LimitInfo{Key: key, Limit: limit, Remaining: 0, ResetTime: end, Window: window, RetryAfter: end.Sub(now)}, false
 	}
 
-	count := int(incrCmd.Val())
-	remaining := limit - count
+	remaining := limit - int(count)
 	if remaining < 0 {
 		remaining = 0
 	}
 
-	resetTime := time.Now().Add(window)
-
-	return &LimitInfo{
+	info := &LimitInfo{
 		Key:       key,
 		Limit:     limit,
 		Remaining: remaining,
-		ResetTime: resetTime,
+		ResetTime: end,
 		Window:    window,
-	}, count <= limit
+	}
+	allowed := count <= int64(limit)
+	if !allowed {
+		info.RetryAfter = end.Sub(now)
+	}
+	return info, allowed
 }
 
+// checkSlidingWindow counts the hits of the current fixed window plus those
+// of the previous one, weighted by how much of it the sliding window still
+// covers
 func (l *Limiter) checkSlidingWindow(ctx context.Context, key string, limit int, window time.Duration) (*LimitInfo, bool) {
-	if l.redisClient == nil {
-		return &LimitInfo{
-			Key:       key,
-			Limit:     limit,
-			Remaining: limit - 1,
-			ResetTime: time.Now().Add(window),
-			Window:    window,
-		}, true
-	}
-
 	now := time.Now()
-	windowStart := now.Add(-window)
+	start := now.Truncate(window)
+	end := start.Add(window)
+	weight := 1 - float64(now.Sub(start))/float64(window)
 
-	pipe := l.redisClient.Pipeline()
-	pipe.ZRemRangeByScore(ctx, key, "0", strconv.FormatInt(windowStart.UnixNano(), 10))
-	countCmd := pipe.ZCard(ctx, key)
-	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()), Member: now.UnixNano()})
-	pipe.Expire(ctx, key, window+time.Minute)
-
-	_, err := pipe.Exec(ctx)
+	previous, current, allowed, err := l.store.SlidingWindow(ctx, key, start, window, weight, limit)
 	if err != nil {
-		l.logger.WithError(err).Error("Redis pipeline execution failed")
-		return &LimitInfo{Key: key, Limit: limit, Remaining: 0}, false
+		l.logger.WithError(err).Error("Failed to count request for rate limiting")
+		return &LimitInfo{Key: key, Limit: limit, Remaining: 0, ResetTime: end, Window: window, RetryAfter: end.Sub(now)}, false
 	}
 
-	count := int(countCmd.Val())
-	remaining := limit - count - 1
+	remaining := limit - int(weightedHits(previous, weight)+current)
 	if remaining < 0 {
 		remaining = 0
 	}
 
-	return &LimitInfo{
+	info := &LimitInfo{
 		Key:       key,
 		Limit:     limit,
 		Remaining: remaining,
-		ResetTime: now.Add(window),
+		ResetTime: end,
 		Window:    window,
-	}, count < limit
+	}
+	if !allowed {
+		info.RetryAfter = slidingRetryAfter(previous, current, limit, start, window).Sub(now)
+	}
+	return info, allowed
+}
+
+// slidingRetryAfter returns when the weighted hits drop below limit: once
+// the previous window weighs less, or once the current one has become the
+// previous window and weighs less
+func slidingRetryAfter(previous, current int64, limit int, start time.Time, window time.Duration) time.Time {
+	if current < int64(limit) && previous > 0 {
+		weight := float64(int64(limit)-current) / float64(previous)
+		return start.Add(time.Duration((1 - weight) * float64(window)))
+	}
+	weight := float64(limit) / float64(current)
+	return start.Add(window).Add(time.Duration((1 - weight) * float64(window)))
 }
 
+// checkTokenBucket lets bursts of up to burstSize requests through and
+// refills the bucket at limit requests per window
 func (l *Limiter) checkTokenBucket(ctx context.Context, key string, limit int, window time.Duration, burstSize int) (*LimitInfo, bool) {
 	if burstSize <= 0 {
 		burstSize = l.config.BurstSize
@@ -442,8 +473,26 @@ func (l *Limiter) checkTokenBucket(ctx context.Context, key string, limit int, w
 	if burstSize <= 0 {
 		burstSize = limit
 	}
+	rate := float64(limit) / window.Seconds()
+	now := time.Now()
+
+	tokens, allowed, err := l.store.TokenBucket(ctx, key, rate, burstSize, now)
+	if err != nil {
+		l.logger.WithError(err).Error("Failed to take a token for rate limiting")
+		return &LimitInfo{Key: key, Limit: burstSize, Remaining: 0, ResetTime: now.Add(window), Window: window, RetryAfter: durationOf(1 / rate)}, false
+	}
 
-	return l.checkFixedWindow(ctx, key, burstSize, window)
+	info := &LimitInfo{
+		Key:       key,
+		Limit:     burstSize,
+		Remaining: int(math.Floor(tokens)),
+		ResetTime: now.Add(durationOf((float64(burstSize) - tokens) / rate)),
+		Window:    window,
+	}
+	if !allowed {
+		info.RetryAfter = durationOf((1 - tokens) / rate)
+	}
+	return info, allowed
 }
 
 func (l *Limiter) setHeaders(c echo.Context, limitInfo *LimitInfo) {
@@ -453,6 +502,15 @@ func (l *Limiter) setHeaders(c echo.Context, limitInfo *LimitInfo) {
 	c.Response().Header().Set("X-RateLimit-Window", limitInfo.Window.String())
 }
 
+// retryAfter formats a wait as whole seconds for Retry-After, at least one
+func retryAfter(wait time.Duration) string {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
 func (l *Limiter) Close() error {
 	if l.redisClient != nil {
 		return l.redisClient.Close()
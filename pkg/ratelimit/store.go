@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps the state of rate limits: fixed windows, sliding windows and
+// token buckets
+type Store interface {
+	Counter
+	// SlidingWindow adds a hit to the window of key that starts at start,
+	// unless the hits of the previous window weighted by weight plus those
+	// of this one reach limit. It returns the hits of both windows.
+	SlidingWindow(ctx context.Context, key string, start time.Time, window time.Duration, weight float64, limit int) (previous, current int64, allowed bool, err error)
+	// TokenBucket takes a token from the bucket of key, which holds up to
+	// burst tokens and refills at rate tokens per second. It returns the
+	// tokens left.
+	TokenBucket(ctx context.Context, key string, rate float64, burst int, now time.Time) (tokens float64, allowed bool, err error)
+}
+
+// MemoryStore keeps rate limits in memory, for a single gateway
+type MemoryStore struct {
+	*MemoryCounter
+	mu        sync.Mutex
+	windows   map[string]*slidingWindow
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+type slidingWindow struct {
+	start    time.Time
+	end      time.Time
+	previous int64
+	current  int64
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // When the bucket is full again and may be forgotten
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryCounter: NewMemoryCounter(),
+		windows:       make(map[string]*slidingWindow),
+		buckets:       make(map[string]*bucket),
+	}
+}
+
+func (m *MemoryStore) SlidingWindow(_ context.Context, key string, start time.Time, window time.Duration, weight float64, limit int) (int64, int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+
+	w, ok := m.windows[key]
+	switch {
+	case !ok || !w.end.After(start.Add(-window)):
+		w = &slidingWindow{}
+		m.windows[key] = w
+	case w.start.Before(start):
+		w.previous = w.current
+		w.current = 0
+	}
+	w.start, w.end = start, start.Add(window)
+
+	if weightedHits(w.previous, weight)+w.current >= int64(limit) {
+		return w.previous, w.current, false, nil
+	}
+	w.current++
+	return w.previous, w.current, true, nil
+}
+
+func (m *MemoryStore) TokenBucket(_ context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, b.last, now, rate, burst)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(durationOf((float64(burst) - b.tokens) / rate))
+	return b.tokens, allowed, nil
+}
+
+// sweep forgets ended windows and full buckets once a minute, so idle keys
+// do not pile up
+func (m *MemoryStore) sweep() {
+	now := time.Now()
+	if now.Before(m.nextSweep) {
+		return
+	}
+	for k, w := range m.windows {
+		// The window still weighs on the next one until that ends too
+		if !w.end.Add(w.end.Sub(w.start)).After(now) {
+			delete(m.windows, k)
+		}
+	}
+	for k, b := range m.buckets {
+		if !b.full.After(now) {
+			delete(m.buckets, k)
+		}
+	}
+	m.nextSweep = now.Add(time.Minute)
+}
+
+// slidingWindowScript counts a hit in the current window unless the
+// weighted hits of both windows reach the limit
+var slidingWindowScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+if math.floor(previous * tonumber(ARGV[2])) + current >= tonumber(ARGV[1]) then
+	return {previous, current, 0}
+end
+current = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {previous, current, 1}
+`)
+
+// tokenBucketScript refills a bucket for the time since it was last used
+// and takes a token from it
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {tostring(tokens), allowed}
+`)
+
+// RedisStore keeps rate limits in Redis, so that every gateway sharing it
+// enforces the same limits
+type RedisStore struct {
+	*RedisCounter
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{RedisCounter: NewRedisCounter(client)}
+}
+
+func (r *RedisStore) SlidingWindow(ctx context.Context, key string, start time.Time, window time.Duration, weight float64, limit int) (int64, int64, bool, error) {
+	// The hash tag keeps both windows on the same Redis Cluster node
+	keys := []string{
+		fmt.Sprintf("ratelimit:sliding:{%s}:%d", key, start.UnixMilli()),
+		fmt.Sprintf("ratelimit:sliding:{%s}:%d", key, start.Add(-window).UnixMilli()),
+	}
+	ttl := (2*window + time.Minute).Milliseconds()
+	result, err := slidingWindowScript.Run(ctx, r.client, keys, limit, strconv.FormatFloat(weight, 'f', -1, 64), ttl).Int64Slice()
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to count in Redis: %w", err)
+	}
+	return result[0], result[1], result[2] == 1, nil
+}
+
+func (r *RedisStore) TokenBucket(ctx context.Context, key string, rate float64, burst int, now time.Time) (float64, bool, error) {
+	keys := []string{"ratelimit:bucket:" + key}
+	result, err := tokenBucketScript.Run(ctx, r.client, keys, strconv.FormatFloat(rate, 'f', -1, 64), burst, now.UnixMilli()).Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to take a token in Redis: %w", err)
+	}
+	if len(result) != 2 {
+		return 0, false, fmt.Errorf("unexpected token bucket result from Redis")
+	}
+	text, _ := result[0].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("unexpected token count from Redis: %w", err)
+	}
+	allowed, _ := result[1].(int64)
+	return tokens, allowed == 1, nil
+}
+
+// weightedHits counts the hits of the previous window by how much of it
+// still overlaps the sliding window
+func weightedHits(previous int64, weight float64) int64 {
+	return int64(math.Floor(float64(previous) * weight))
+}
+
+// refill adds the tokens earned since last to a bucket
+func refill(tokens float64, last, now time.Time, rate float64, burst int) float64 {
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens += elapsed.Seconds() * rate
+	}
+	return math.Min(tokens, float64(burst))
+}
+
+func durationOf(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
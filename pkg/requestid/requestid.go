@@ -0,0 +1,222 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/ipfilter"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ID formats selectable in the configuration
+const (
+	FormatUUIDv4 = "uuidv4"
+	FormatUUIDv7 = "uuidv7"
+	FormatULID   = "ulid"
+)
+
+// Inbound ID policies selectable in the configuration
+const (
+	TrustAll      = "all"
+	TrustNone     = "none"
+	TrustNetworks = "networks"
+)
+
+// ContextKey is the echo context key the ID of a request is stored under
+const ContextKey = "request_id"
+
+// maxInboundLength bounds the inbound IDs that are kept, since they end up
+// in logs and upstream requests
+const maxInboundLength = 128
+
+type contextKey struct{}
+
+// Generator assigns every request an ID, keeping the one the client sent
+// when it is trusted to
+type Generator struct {
+	header   string
+	format   string
+	prefix   string
+	trust    string
+	networks []*net.IPNet
+}
+
+// New creates a generator from cfg
+func New(cfg config.RequestIDConfig) (*Generator, error) {
+	g := &Generator{
+		header: cfg.Header,
+		format: cfg.Format,
+		prefix: cfg.Prefix,
+		trust:  cfg.Trust,
+	}
+	if g.header == "" {
+		g.header = echo.HeaderXRequestID
+	}
+	if g.format == "" {
+		g.format = FormatUUIDv4
+	}
+	if g.trust == "" {
+		g.trust = TrustAll
+	}
+	switch g.format {
+	case FormatUUIDv4, FormatUUIDv7, FormatULID:
+	default:
+		return nil, fmt.Errorf("unsupported request ID format %q", g.format)
+	}
+	for _, entry := range cfg.TrustedNetworks {
+		network, err := ipfilter.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		g.networks = append(g.networks, network)
+	}
+	return g, nil
+}
+
+// Header returns the name of the header IDs are read from and sent in
+func (g *Generator) Header() string {
+	return g.header
+}
+
+// Generate returns a new ID
+func (g *Generator) Generate() string {
+	var id string
+	switch g.format {
+	case FormatUUIDv7:
+		if u, err := uuid.NewV7(); err == nil {
+			id = u.String()
+		} else {
+			id = uuid.NewString()
+		}
+	case FormatULID:
+		id = newULID(time.Now())
+	default:
+		id = uuid.NewString()
+	}
+	return g.prefix + id
+}
+
+// Middleware assigns the request its ID before anything else handles it.
+// The ID is sent upstream and back to the client in the configured header.
+func (g *Generator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(g.header)
+			if id == "" || !valid(id) || !g.trusted(req.RemoteAddr) {
+				id = g.Generate()
+			}
+
+			req.Header.Set(g.header, id)
+			c.Response().Header().Set(g.header, id)
+			c.Set(ContextKey, id)
+			c.SetRequest(req.WithContext(NewContext(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
+
+// TraceMiddleware records the ID on the request's span. It must run after
+// the tracing middleware has started the span.
+func TraceMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if id := Get(c); id != "" {
+				trace.SpanFromContext(c.Request().Context()).SetAttributes(attribute.String("http.request_id", id))
+			}
+			return next(c)
+		}
+	}
+}
+
+// trusted reports whether IDs sent by the peer at remoteAddr are kept.
+// The peer address is used, not X-Forwarded-For, which clients can forge.
+func (g *Generator) trusted(remoteAddr string) bool {
+	switch g.trust {
+	case TrustAll:
+		return true
+	case TrustNone:
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// valid reports whether an inbound ID is short and printable ASCII, so it
+// cannot break log lines or headers
+func valid(id string) bool {
+	if len(id) > maxInboundLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID ctx carries, if any
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Get returns the ID of the request being handled by c. Without the
+// middleware it falls back to the X-Request-ID headers.
+func Get(c echo.Context) string {
+	if id, ok := c.Get(ContextKey).(string); ok && id != "" {
+		return id
+	}
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// crockford is the alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48-bit millisecond timestamp followed by 80
+// random bits, written as 26 Crockford base32 characters so IDs sort by time
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
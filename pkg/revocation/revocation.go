@@ -0,0 +1,240 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of revocation
+const (
+	KindToken   = "jti"     // One JWT, by its jti claim
+	KindSubject = "subject" // Every JWT of a sub or user_id claim issued before the revocation
+	KindAPIKey  = "apiKey"  // An API key, by its ID
+)
+
+var (
+	// ErrInvalid is returned for revocations that cannot be made
+	ErrInvalid = errors.New("invalid revocation")
+	// ErrNotFound is returned when deleting a revocation that does not exist
+	ErrNotFound = errors.New("revocation not found")
+)
+
+// List keeps a copy of the revocations in a store shared by the gateways and
+// answers whether credentials are revoked from it. Revocations made through
+// a gateway apply to it right away and to the others once they refresh.
+type List struct {
+	store       Store
+	interval    time.Duration
+	maxLifetime time.Duration
+	logger      *logrus.Logger
+
+	mu        sync.Mutex // serializes changes to entries
+	entries   atomic.Pointer[map[string]*mongodb.RevocationDocument]
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	startOnce sync.Once
+}
+
+// New creates a revocation list. Token and subject revocations are kept for
+// cfg.MaxTokenLifetime, else tokenTTL, else a day, by which time the tokens
+// they revoke have expired.
+func New(cfg config.RevocationConfig, tokenTTL time.Duration, store Store, logger *logrus.Logger) *List {
+	l := &List{
+		store:       store,
+		interval:    cfg.SyncInterval,
+		maxLifetime: cfg.MaxTokenLifetime,
+		logger:      logger,
+		stopChan:    make(chan struct{}),
+	}
+	if l.interval == 0 {
+		l.interval = 10 * time.Second
+	}
+	if l.maxLifetime == 0 {
+		l.maxLifetime = tokenTTL
+	}
+	if l.maxLifetime == 0 {
+		l.maxLifetime = 24 * time.Hour
+	}
+	l.entries.Store(&map[string]*mongodb.RevocationDocument{})
+	return l
+}
+
+// ID returns the ID of the revocation of value
+func ID(kind, value string) string {
+	return kind + ":" + value
+}
+
+// Sync replaces the copy with the revocations in the store. On error the
+// copy is kept.
+func (l *List) Sync(ctx context.Context) error {
+	// Changes made meanwhile are applied after the listed revocations
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	docs, err := l.store.ListRevocations(ctx)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]*mongodb.RevocationDocument, len(docs))
+	for _, doc := range docs {
+		entries[doc.ID] = doc
+	}
+	l.entries.Store(&entries)
+	return nil
+}
+
+// Start loads the revocations, then refreshes them until Stop is called
+func (l *List) Start() {
+	l.startOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := l.Sync(ctx); err != nil {
+			l.logger.WithError(err).Warn("Failed to load revocations")
+		}
+		cancel()
+		l.wg.Add(1)
+		go l.loop()
+	})
+}
+
+// Stop stops refreshing the revocations
+func (l *List) Stop() {
+	select {
+	case <-l.stopChan:
+	default:
+		close(l.stopChan)
+	}
+	l.wg.Wait()
+}
+
+func (l *List) loop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopChan:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+			if err := l.Sync(ctx); err != nil {
+				l.logger.WithError(err).Warn("Failed to refresh revocations, keeping the current ones")
+			}
+			cancel()
+		}
+	}
+}
+
+// Revoke revokes value, a jti, subject or API key ID depending on kind,
+// until expiresAt. Without an expiry, token and subject revocations last the
+// maximum token lifetime and API key revocations until they are deleted.
+func (l *List) Revoke(ctx context.Context, kind, value, reason, by string, expiresAt time.Time) (*mongodb.RevocationDocument, error) {
+	switch kind {
+	case KindToken, KindSubject:
+		if expiresAt.IsZero() {
+			expiresAt = time.Now().Add(l.maxLifetime)
+		}
+	case KindAPIKey:
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q (expected jti, subject or apiKey)", ErrInvalid, kind)
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%w: value cannot be empty", ErrInvalid)
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiresAt is in the past", ErrInvalid)
+	}
+
+	doc := &mongodb.RevocationDocument{
+		ID:        ID(kind, value),
+		Kind:      kind,
+		Value:     value,
+		Reason:    reason,
+		RevokedBy: by,
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := l.store.SaveRevocation(ctx, doc); err != nil {
+		return nil, err
+	}
+	l.update(func(entries map[string]*mongodb.RevocationDocument) { entries[doc.ID] = doc })
+	return doc, nil
+}
+
+// Delete lifts a revocation
+func (l *List) Delete(ctx context.Context, id string) error {
+	err := l.store.DeleteRevocation(ctx, id)
+	if errors.Is(err, mongodb.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	l.update(func(entries map[string]*mongodb.RevocationDocument) { delete(entries, id) })
+	return nil
+}
+
+// update changes a copy of the entries and makes it current
+func (l *List) update(change func(map[string]*mongodb.RevocationDocument)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := maps.Clone(*l.entries.Load())
+	change(entries)
+	l.entries.Store(&entries)
+}
+
+// Entries returns the revocations in effect, latest first
+func (l *List) Entries() []*mongodb.RevocationDocument {
+	now := time.Now()
+	var list []*mongodb.RevocationDocument
+	for _, doc := range *l.entries.Load() {
+		if active(doc, now) {
+			list = append(list, doc)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RevokedAt.After(list[j].RevokedAt) })
+	return list
+}
+
+// TokenRevoked reports whether a JWT with the jti id, issued at issuedAt to
+// subjects, is revoked. Tokens without an issue time are revoked along with
+// their subject.
+func (l *List) TokenRevoked(id string, subjects []string, issuedAt time.Time) bool {
+	entries := *l.entries.Load()
+	now := time.Now()
+	if id != "" {
+		if doc, ok := entries[ID(KindToken, id)]; ok && active(doc, now) {
+			return true
+		}
+	}
+	for _, subject := range subjects {
+		if subject == "" {
+			continue
+		}
+		doc, ok := entries[ID(KindSubject, subject)]
+		if ok && active(doc, now) && (issuedAt.IsZero() || !issuedAt.After(doc.RevokedAt)) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRevoked reports whether the API key with the given ID is revoked
+func (l *List) APIKeyRevoked(id string) bool {
+	doc, ok := (*l.entries.Load())[ID(KindAPIKey, id)]
+	return ok && active(doc, time.Now())
+}
+
+func active(doc *mongodb.RevocationDocument, now time.Time) bool {
+	return doc.ExpiresAt.IsZero() || doc.ExpiresAt.After(now)
+}
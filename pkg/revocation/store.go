@@ -0,0 +1,133 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps revocations. The MongoDB repository is a Store shared by every
+// gateway using the same database.
+type Store interface {
+	SaveRevocation(ctx context.Context, revocation *mongodb.RevocationDocument) error
+	ListRevocations(ctx context.Context) ([]*mongodb.RevocationDocument, error)
+	DeleteRevocation(ctx context.Context, id string) error
+}
+
+// memoryStore keeps the revocations of a single gateway. They are lost on
+// restart.
+type memoryStore struct {
+	mu          sync.Mutex
+	revocations map[string]*mongodb.RevocationDocument
+}
+
+// NewMemoryStore creates a store that keeps revocations in memory
+func NewMemoryStore() Store {
+	return &memoryStore{revocations: make(map[string]*mongodb.RevocationDocument)}
+}
+
+func (s *memoryStore) SaveRevocation(ctx context.Context, revocation *mongodb.RevocationDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *revocation
+	s.revocations[revocation.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) ListRevocations(ctx context.Context) ([]*mongodb.RevocationDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var list []*mongodb.RevocationDocument
+	for id, revocation := range s.revocations {
+		if !active(revocation, now) {
+			delete(s.revocations, id)
+			continue
+		}
+		copied := *revocation
+		list = append(list, &copied)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) DeleteRevocation(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revocations[id]; !ok {
+		return fmt.Errorf("revocation %s: %w", id, mongodb.ErrNotFound)
+	}
+	delete(s.revocations, id)
+	return nil
+}
+
+// redisKey is the hash revocations are kept in, by ID
+const redisKey = "odin:revocations"
+
+// RedisStore keeps revocations in a Redis hash shared by every gateway
+// using the same Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store that keeps revocations in Redis
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) SaveRevocation(ctx context.Context, revocation *mongodb.RevocationDocument) error {
+	data, err := json.Marshal(revocation)
+	if err != nil {
+		return err
+	}
+	if err := s.client.HSet(ctx, redisKey, revocation.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save revocation: %w", err)
+	}
+	return nil
+}
+
+// ListRevocations also deletes the expired revocations, since hash fields
+// do not expire on their own
+func (s *RedisStore) ListRevocations(ctx context.Context) ([]*mongodb.RevocationDocument, error) {
+	fields, err := s.client.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revocations: %w", err)
+	}
+
+	now := time.Now()
+	var list []*mongodb.RevocationDocument
+	var expired []string
+	for id, data := range fields {
+		var revocation mongodb.RevocationDocument
+		if err := json.Unmarshal([]byte(data), &revocation); err != nil {
+			return nil, fmt.Errorf("failed to decode revocation %s: %w", id, err)
+		}
+		if !active(&revocation, now) {
+			expired = append(expired, id)
+			continue
+		}
+		list = append(list, &revocation)
+	}
+	if len(expired) > 0 {
+		s.client.HDel(ctx, redisKey, expired...)
+	}
+	return list, nil
+}
+
+func (s *RedisStore) DeleteRevocation(ctx context.Context, id string) error {
+	deleted, err := s.client.HDel(ctx, redisKey, id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete revocation: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("revocation %s: %w", id, mongodb.ErrNotFound)
+	}
+	return nil
+}
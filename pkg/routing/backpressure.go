@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// defaultMaxBackpressureDelay bounds how long a request waits on a target's
+// Retry-After unless the service sets its own bound
+const defaultMaxBackpressureDelay = 5 * time.Second
+
+var upstreamBackpressure = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_upstream_backpressure_total",
+		Help: "Total number of 429 and 503 responses with Retry-After from targets, by whether they were retried",
+	},
+	[]string{"service", "status", "action"},
+)
+
+// backpressure reports whether resp asks the gateway to back off, and for
+// how long
+func backpressure(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter parses a Retry-After value, in seconds or as an HTTP date.
+// Dates in the past mean no delay.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryBackpressure decides whether a response asking for delay is retried
+// after attempt, or returned to the client
+func (h *ServiceHandler) retryBackpressure(resp *http.Response, delay time.Duration, attempt int) bool {
+	cfg := h.service.Backpressure
+	maxDelay := defaultMaxBackpressureDelay
+	if cfg != nil && cfg.MaxDelay > 0 {
+		maxDelay = cfg.MaxDelay
+	}
+
+	retry := attempt < h.service.RetryCount && delay <= maxDelay && (cfg == nil || !cfg.DisableRetries)
+	action := "returned"
+	if retry {
+		action = "retried"
+	}
+	upstreamBackpressure.WithLabelValues(h.service.Name, strconv.Itoa(resp.StatusCode), action).Inc()
+	if !retry && cfg != nil && cfg.StripRetryAfter {
+		resp.Header.Del("Retry-After")
+	}
+	return retry
+}
+
+// discard drains and closes the body of a response that is not passed on,
+// so its connection can be reused
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// sleep waits for d, returning false if ctx ends first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
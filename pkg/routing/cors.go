@@ -0,0 +1,35 @@
+package routing
+
+import (
+	"net/http"
+	"strings"
+
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+)
+
+// CORSMiddleware enforces a service's CORS policy. Preflight requests are
+// answered by the gateway and never reach the backend.
+func CORSMiddleware(cors *service.CORSConfig) echo.MiddlewareFunc {
+	methods := cors.AllowMethods
+	if len(methods) == 0 {
+		methods = echomw.DefaultCORSConfig.AllowMethods
+	}
+
+	return echomw.CORSWithConfig(echomw.CORSConfig{
+		AllowOrigins:     cors.AllowOrigins,
+		AllowMethods:     methods,
+		AllowHeaders:     cors.AllowHeaders,
+		ExposeHeaders:    cors.ExposeHeaders,
+		AllowCredentials: cors.AllowCredentials,
+		MaxAge:           cors.MaxAge,
+	})
+}
+
+// isCORSHeader reports whether a backend response header would conflict with
+// the headers the gateway stamps for a service with a CORS policy
+func isCORSHeader(name string) bool {
+	return strings.HasPrefix(http.CanonicalHeaderKey(name), "Access-Control-")
+}
@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"odin/pkg/service"
+)
+
+// egressProxy chooses the proxy each upstream request of a service goes
+// through
+type egressProxy struct {
+	url      *url.URL
+	all      bool // noProxy is *
+	hosts    map[string]bool
+	domains  []string
+	networks []*net.IPNet
+}
+
+// newEgressProxy parses cfg into the Proxy function of a transport
+func newEgressProxy(cfg *service.EgressProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	proxyURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	if cfg.Username != "" {
+		proxyURL.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+
+	p := &egressProxy{url: proxyURL, hosts: make(map[string]bool)}
+	for _, entry := range cfg.NoProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "*":
+			p.all = true
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid noProxy entry %q", entry)
+			}
+			p.networks = append(p.networks, network)
+		case strings.HasPrefix(entry, "."):
+			p.domains = append(p.domains, entry)
+		default:
+			p.hosts[entry] = true
+		}
+	}
+	return p.proxy, nil
+}
+
+// proxy returns the proxy for req, or nil when its host is reached directly
+func (p *egressProxy) proxy(req *http.Request) (*url.URL, error) {
+	if p.direct(req.URL) {
+		return nil, nil
+	}
+	return p.url, nil
+}
+
+// direct reports whether target matches an entry of noProxy. Entries match
+// the host with or without the port; .example.com matches its subdomains
+// and example.com itself.
+func (p *egressProxy) direct(target *url.URL) bool {
+	if p.all {
+		return true
+	}
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" || target.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	if p.hosts[host] || p.hosts[net.JoinHostPort(host, port)] {
+		return true
+	}
+	for _, domain := range p.domains {
+		if strings.HasSuffix(host, domain) || host == domain[1:] {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range p.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
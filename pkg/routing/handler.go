@@ -3,13 +3,25 @@ package routing
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"odin/pkg/async"
+	"odin/pkg/bufpool"
 	"odin/pkg/cache"
 	"odin/pkg/canary"
+	"odin/pkg/cel"
+	"odin/pkg/discovery"
+	"odin/pkg/dlp"
+	"odin/pkg/experiments"
+	"odin/pkg/flags"
+	"odin/pkg/health"
 	"odin/pkg/service"
 	"odin/pkg/transform"
+	"odin/pkg/versioning"
+	"odin/pkg/websocket"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -18,14 +30,31 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// defaultStreamThreshold matches the largest buffer bufpool keeps, so
+// buffered bodies are normally small enough to go back to the pool
+const defaultStreamThreshold = 1 << 20
+
 type ServiceHandler struct {
 	service         *service.Config
 	logger          *logrus.Logger
 	cacheStore      cache.Store
 	client          *http.Client
+	jobClient       *http.Client // Without the service timeout, for asynchronous requests
 	nextTarget      uint64
 	canaryRouter    *canary.Router
+	canaryMatch     *cel.Program // Sends the requests it matches to the canary
 	transformEngine *transform.Engine
+	requestRules    *transform.CompiledRequest
+	responseRules   *transform.CompiledResponse
+	templates       *transform.Templates
+	headerRules     *transform.HeaderRules
+	fieldRules      *transform.FieldRules
+	dlpFilter       *dlp.Filter
+	wsProxy         *websocket.Proxy
+	healthChecker   *health.TargetChecker
+	maintenance     *health.Maintenance
+	resolver        *discovery.Resolver
+	flags           *flags.Flags
 }
 
 func NewServiceHandler(svc *service.Config, logger *logrus.Logger, cacheStore cache.Store) (*ServiceHandler, error) {
@@ -33,11 +62,20 @@ func NewServiceHandler(svc *service.Config, logger *logrus.Logger, cacheStore ca
 		return nil, fmt.Errorf("service %s has no targets", svc.Name)
 	}
 
+	transport, err := newTransport(svc.Transport)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+	}
 	client := &http.Client{
-		Timeout: svc.Timeout,
+		Timeout:   svc.Timeout,
+		Transport: transport,
+	}
+	if svc.Streaming != nil && svc.Streaming.Enabled {
+		// Handle applies the timeout to the headers only, so streams last
+		client.Timeout = 0
 	}
 
-	return &ServiceHandler{
+	h := &ServiceHandler{
 		service:         svc,
 		logger:          logger,
 		cacheStore:      cacheStore,
@@ -45,14 +83,60 @@ func NewServiceHandler(svc *service.Config, logger *logrus.Logger, cacheStore ca
 		nextTarget:      0,
 		canaryRouter:    canary.NewRouter(),
 		transformEngine: transform.NewEngine(logger),
-	}, nil
+	}
+	if svc.Async != nil {
+		// Jobs are bounded by their own deadline instead
+		h.jobClient = &http.Client{Transport: transport}
+	}
+
+	// Parse transformation templates once instead of on every request
+	if svc.Transformation != nil {
+		if svc.Transformation.Request != nil {
+			if h.requestRules, err = transform.CompileRequest(svc.Transformation.Request); err != nil {
+				return nil, fmt.Errorf("service %s: request transformation: %w", svc.Name, err)
+			}
+		}
+		if svc.Transformation.Response != nil {
+			if h.responseRules, err = transform.CompileResponse(svc.Transformation.Response); err != nil {
+				return nil, fmt.Errorf("service %s: response transformation: %w", svc.Name, err)
+			}
+		}
+		if len(svc.Transformation.Templates) > 0 {
+			if h.templates, err = transform.CompileTemplates(svc.Transformation.Templates); err != nil {
+				return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+		}
+	}
+
+	if len(svc.ResponseFields) > 0 {
+		if h.fieldRules, err = transform.CompileFieldRules(svc.ResponseFields); err != nil {
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+	}
+	if svc.HeaderRules != nil {
+		if h.headerRules, err = transform.CompileHeaderRules(svc.HeaderRules.Request, svc.HeaderRules.Response); err != nil {
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+	}
+
+	return h, nil
 }
 
 func (h *ServiceHandler) Handle(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	// Get target URL with canary routing support
-	target := h.getTargetURL(c.Request())
+	// WebSocket services take nothing but upgrades
+	if h.service.Protocol == "websocket" && !websocket.IsUpgrade(c.Request()) {
+		c.Response().Header().Set(echo.HeaderUpgrade, "websocket")
+		return echo.NewHTTPError(http.StatusUpgradeRequired, "WebSocket upgrade required")
+	}
+
+	// Get target URL with version and canary routing support
+	version, _ := c.Get(versioning.ContextKey).(*versioning.Version)
+	target := h.getTargetURL(c, version)
+	if target == "" {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "No available targets")
+	}
 	path := c.Request().URL.Path
 
 	if h.service.StripBasePath && strings.HasPrefix(path, h.service.BasePath) {
@@ -67,51 +151,133 @@ func (h *ServiceHandler) Handle(c echo.Context) error {
 		targetURL += "?" + c.Request().URL.RawQuery
 	}
 
+	// Hand WebSocket upgrades to the proxy, which holds the connection open
+	if h.wsProxy != nil && websocket.IsUpgrade(c.Request()) {
+		return h.wsProxy.ProxyWebSocket(c, targetURL)
+	}
+
 	// Log which target is being used (production or canary)
 	logFields := logrus.Fields{
 		"service": h.service.Name,
 		"target":  targetURL,
 		"method":  c.Request().Method,
 	}
+	if version != nil {
+		logFields["version"] = version.Name
+	}
+	if variant := experiments.FromContext(c); variant != nil {
+		logFields["variant"] = variant.Name
+	}
 	if h.service.Canary != nil && h.service.Canary.Enabled {
-		isCanary := h.canaryRouter.ShouldUseCanary(c.Request(), h.service.Canary)
-		logFields["canary"] = isCanary
+		logFields["canary"] = h.useCanary(c, h.service.Canary)
 	}
-	h.logger.WithFields(logFields).Debug("Forwarding request")
+	h.logger.WithContext(ctx).WithFields(logFields).Debug("Forwarding request")
 
 	req, err := h.createProxyRequest(c, targetURL)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logLimit(h.logger, h.service, c, "request body size")
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create proxy request")
 	}
 
+	var userClaims map[string]interface{}
+	if h.templates != nil || h.headerRules != nil {
+		userClaims = claims(c)
+	}
+
 	// Apply request transformations if configured
-	if h.service.Transformation != nil && h.service.Transformation.Request != nil {
-		if err := h.transformEngine.TransformRequest(req, h.service.Transformation.Request); err != nil {
+	var match *transform.TemplateMatch
+	if h.templates != nil {
+		match = h.templates.Match(c.Request(), userClaims)
+	}
+	if h.requestRules != nil || match != nil {
+		if err := h.transformEngine.ApplyRequestWith(req, h.requestRules, match); err != nil {
 			h.logger.WithError(err).Warn("Failed to transform request")
 			// Continue without transformation
 		}
 	}
+	if h.headerRules != nil {
+		h.headerRules.ApplyRequest(req.Header, c.Request(), userClaims)
+	}
 
-	resp, err := h.doRequestWithRetries(ctx, req)
+	// Ask for an uncompressed body when the response is read here; the
+	// transport still negotiates and decodes compression with the backend
+	transformResponse := h.responseRules != nil || match.RewritesResponse()
+	fields := h.fieldRules.Match(c.Request())
+	inspected := transformResponse || fields != nil || h.dlpFilter != nil || h.service.Aggregation != nil
+	if inspected {
+		req.Header.Del("Accept-Encoding")
+	}
+
+	// Streaming services time out waiting for the headers themselves, as the
+	// client timeout would cut streams off too
+	upstream, cancel := ctx, context.CancelFunc(func() {})
+	var timeout *time.Timer
+	if h.streaming() && !async.IsJob(ctx) {
+		upstream, cancel = context.WithCancel(ctx)
+		if h.service.Timeout > 0 {
+			timeout = time.AfterFunc(h.service.Timeout, cancel)
+		}
+	}
+	defer cancel()
+
+	resp, err := h.doRequestWithRetries(upstream, req)
+	// Requests the client gave up on say nothing about the target
+	if h.healthChecker != nil && ctx.Err() == nil {
+		h.healthChecker.ReportRequest(target, requestFailure(resp, err))
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadGateway, "Service unavailable")
 	}
 	defer resp.Body.Close()
+	if err := h.limitResponse(c, resp); err != nil {
+		return err
+	}
+
+	if h.service.Aggregation != nil {
+		// Initialize aggregation handler
+		h.logger.Debug("Aggregation config found but not processed yet")
+	}
+
+	// Large bodies and those of unknown length, e.g. file downloads, are
+	// streamed through when nothing inspects them so memory stays flat.
+	// Event streams never end, so streaming services pass them through
+	// uninspected, flushing like chunked responses
+	flush := h.streaming() && (isEventStream(resp.Header) || (!inspected && resp.ContentLength < 0))
+	if flush || (!inspected && (resp.ContentLength < 0 || resp.ContentLength > h.streamThreshold())) {
+		h.copyResponseHeaders(c, resp.Header, userClaims)
+		c.Response().WriteHeader(resp.StatusCode)
+		if flush {
+			return h.abortOversized(c, h.stream(c, resp.Body, timeout, cancel))
+		}
+		_, err = bufpool.Copy(c.Response(), resp.Body)
+		return h.abortOversized(c, err)
+	}
 
 	// Read response body first
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := bufpool.ReadAll(resp.Body)
+	defer bufpool.Put(respBody)
+	if errors.Is(err, errResponseTooLarge) {
+		logLimit(h.logger, h.service, c, "response body size")
+		return echo.NewHTTPError(http.StatusBadGateway, "Response body too large")
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read response body")
 	}
+	body := respBody.Bytes()
 
 	// Apply response transformations if configured
 	responseHeaders := resp.Header
-	if h.service.Transformation != nil && h.service.Transformation.Response != nil {
-		transformedBody, transformedHeaders, err := h.transformEngine.TransformResponse(
+	if transformResponse {
+		transformedBody, transformedHeaders, err := h.transformEngine.ApplyResponseWith(
 			body,
 			resp.StatusCode,
 			resp.Header,
-			h.service.Transformation.Response,
+			h.responseRules,
+			match,
 		)
 		if err != nil {
 			h.logger.WithError(err).Warn("Failed to transform response")
@@ -122,27 +288,108 @@ func (h *ServiceHandler) Handle(c echo.Context) error {
 		}
 	}
 
-	// Copy response headers
-	for k, vals := range responseHeaders {
-		for _, v := range vals {
-			c.Response().Header().Add(k, v)
+	// Strip the fields the route does not expose; error responses are left
+	// alone so clients still learn what went wrong. Bodies that cannot be
+	// filtered are not sent, as they could hold any field.
+	if fields.Filters(responseHeaders.Get("Content-Type")) && len(body) > 0 && resp.StatusCode/100 == 2 {
+		filtered, err := fields.Apply(body)
+		if err != nil {
+			h.logger.WithError(err).WithField("service", h.service.Name).Warn("Failed to filter response fields")
+			return echo.NewHTTPError(http.StatusBadGateway, "Invalid response from service")
 		}
+		body = filtered
+		responseHeaders.Del("Content-Length")
 	}
 
-	if h.service.Aggregation != nil {
-		// Initialize aggregation handler
-		h.logger.Debug("Aggregation config found but not processed yet")
+	// Mask sensitive data last so transformations cannot reintroduce it
+	if h.dlpFilter != nil && dlp.Inspects(responseHeaders) {
+		filtered, changed, err := h.dlpFilter.Apply(body)
+		if err != nil {
+			h.logger.WithError(err).WithField("service", h.service.Name).Warn("Failed to inspect response for sensitive data")
+		} else if changed {
+			body = filtered
+			responseHeaders.Del("Content-Length")
+			h.logger.WithFields(logrus.Fields{
+				"service": h.service.Name,
+				"path":    c.Request().URL.Path,
+			}).Debug("Sensitive data removed from response")
+		}
 	}
 
+	h.copyResponseHeaders(c, responseHeaders, userClaims)
 	c.Response().WriteHeader(resp.StatusCode)
 	_, err = c.Response().Write(body)
 	return err
 }
 
-func (h *ServiceHandler) getTargetURL(req *http.Request) string {
-	// Get the appropriate target list based on canary routing
-	targets := h.canaryRouter.GetTargets(req, h.service)
+// setWebSocketProxy proxies upgrades through proxy, which dials wss://
+// targets with the service's upstream TLS settings
+func (h *ServiceHandler) setWebSocketProxy(proxy *websocket.Proxy) {
+	if transport, ok := h.client.Transport.(*http.Transport); ok {
+		proxy.SetTLSConfig(transport.TLSClientConfig)
+		if t := h.service.Transport; t != nil && t.Proxy != nil {
+			proxy.SetProxy(transport.Proxy)
+		}
+	}
+	h.wsProxy = proxy
+}
 
+// closeIdleConnections closes the idle upstream connections of a handler
+// that no longer serves new requests
+func (h *ServiceHandler) closeIdleConnections() {
+	h.client.CloseIdleConnections()
+	if h.jobClient != nil {
+		h.jobClient.CloseIdleConnections()
+	}
+}
+
+// streamThreshold is the response size above which uninspected bodies are
+// streamed instead of buffered
+func (h *ServiceHandler) streamThreshold() int64 {
+	if h.service.StreamThreshold > 0 {
+		return h.service.StreamThreshold
+	}
+	return defaultStreamThreshold
+}
+
+// copyResponseHeaders applies the service's response header rules to
+// headers and copies them to the client's response
+func (h *ServiceHandler) copyResponseHeaders(c echo.Context, headers http.Header, userClaims map[string]interface{}) {
+	if h.headerRules != nil {
+		h.headerRules.ApplyResponse(headers, c.Request(), userClaims)
+	}
+	for k, vals := range headers {
+		// The gateway owns CORS for services with a policy
+		if h.service.CORS != nil && isCORSHeader(k) {
+			continue
+		}
+		for _, v := range vals {
+			c.Response().Header().Add(k, v)
+		}
+	}
+}
+
+func (h *ServiceHandler) getTargetURL(c echo.Context, version *versioning.Version) string {
+	// Versions, then experiment variants, with their own targets bypass
+	// canary routing
+	var targets []string
+	if version != nil && len(version.Targets) > 0 {
+		targets = version.Targets
+	} else if variant := experiments.FromContext(c); variant != nil && len(variant.Targets) > 0 {
+		targets = variant.Targets
+	} else if canary := h.canary(c); canary != nil && len(canary.Targets) > 0 && h.useCanary(c, canary) {
+		targets = canary.Targets
+	} else {
+		targets = h.service.Targets
+	}
+	if h.resolver != nil {
+		targets = h.resolver.Expand(targets)
+	}
+
+	targets = health.AvailableTargets(targets, h.healthChecker, h.maintenance)
+	if len(targets) == 0 {
+		return ""
+	}
 	if len(targets) == 1 {
 		return targets[0]
 	}
@@ -157,6 +404,9 @@ func (h *ServiceHandler) getTargetURL(req *http.Request) string {
 	}
 }
 
+// createProxyRequest builds the upstream request. Its body is not pooled:
+// the transport may still read it after the response is returned, and
+// retries read it again through GetBody.
 func (h *ServiceHandler) createProxyRequest(c echo.Context, targetURL string) (*http.Request, error) {
 	var body io.Reader = nil
 
@@ -177,29 +427,119 @@ func (h *ServiceHandler) createProxyRequest(c echo.Context, targetURL string) (*
 	for k, v := range c.Request().Header {
 		req.Header[k] = v
 	}
+	for k, v := range h.service.Headers {
+		req.Header.Set(k, v)
+	}
 
 	return req, nil
 }
 
+// useCanary reports whether the request goes to the canary, by its match
+// condition, header, cookie or weight
+func (h *ServiceHandler) useCanary(c echo.Context, canary *service.CanaryConfig) bool {
+	if h.canaryMatch != nil && h.canaryMatch.Matches(c) {
+		return true
+	}
+	return h.canaryRouter.ShouldUseCanary(c.Request(), canary)
+}
+
+// canary returns the service's canary settings, with the weight its flag
+// gives the request
+func (h *ServiceHandler) canary(c echo.Context) *service.CanaryConfig {
+	canary := h.service.Canary
+	if canary == nil || canary.WeightFlag == "" || h.flags == nil {
+		return canary
+	}
+	weighted := *canary
+	weighted.Weight = h.flags.Int(c, canary.WeightFlag, canary.Weight)
+	return &weighted
+}
+
+// claims returns the authenticated client's JWT claims as body templates
+// see them, or nil
+func claims(c echo.Context) map[string]interface{} {
+	user := c.Get("user")
+	if user == nil {
+		return nil
+	}
+	if m, ok := user.(map[string]interface{}); ok {
+		return m
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// requestFailure returns why a proxied request counts as failed for passive
+// health checks: a connection error, a timeout or a 5xx response
+func requestFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func (h *ServiceHandler) doRequestWithRetries(ctx context.Context, req *http.Request) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
+	client := h.client
+	if h.jobClient != nil && async.IsJob(ctx) {
+		client = h.jobClient
+	}
 	for i := 0; i <= h.service.RetryCount; i++ {
-		resp, err = h.client.Do(req.WithContext(ctx))
+		resp, err = client.Do(req.WithContext(ctx))
 		if err == nil {
-			return resp, nil
+			// Targets answering 429 or 503 with Retry-After are retried
+			// no sooner than they ask
+			delay, ok := backpressure(resp)
+			if !ok || !h.retryBackpressure(resp, delay, i) {
+				return resp, nil
+			}
+			h.logger.WithFields(logrus.Fields{
+				"target": req.URL.String(),
+				"status": resp.StatusCode,
+				"delay":  delay,
+			}).Debugf("Target asked to back off, retrying (%d/%d)", i+1, h.service.RetryCount)
+			discard(resp)
+			if !sleep(ctx, delay) {
+				return nil, ctx.Err()
+			}
+			rewindBody(req)
+			continue
+		}
+		// The client went away or the gateway is shutting down
+		if ctx.Err() != nil {
+			return nil, err
 		}
 
 		if i < h.service.RetryCount {
-			h.logger.WithError(err).Warnf("Request to %s failed, retrying (%d/%d)",
+			h.logger.WithContext(ctx).WithError(err).Warnf("Request to %s failed, retrying (%d/%d)",
 				req.URL.String(), i+1, h.service.RetryCount)
-			time.Sleep(h.service.RetryDelay)
-
-			body, _ := io.ReadAll(req.Body)
-			req.Body = io.NopCloser(bytes.NewReader(body))
+			if !sleep(ctx, h.service.RetryDelay) {
+				return nil, ctx.Err()
+			}
+			rewindBody(req)
 		}
 	}
 
 	return nil, err
 }
+
+// rewindBody resets the body of req; a failed attempt may have consumed it
+func rewindBody(req *http.Request) {
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package routing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// errResponseTooLarge is returned by response bodies read past the
+// service's maxResponseBodySize
+var errResponseTooLarge = errors.New("response body too large")
+
+// requestLimits returns the middleware enforcing the request limits of svc,
+// or nil if it has none. It rejects requests whose headers or declared body
+// exceed them and caps bodies of unknown length as they are read. It must
+// run before anything reads the body.
+func requestLimits(svc *service.Config, logger *logrus.Logger) echo.MiddlewareFunc {
+	limits := svc.Limits
+	if limits == nil || (limits.MaxHeaderBytes <= 0 && limits.MaxRequestBodySize <= 0) {
+		return nil
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			if limits.MaxHeaderBytes > 0 {
+				total := 0
+				for name, values := range req.Header {
+					for _, value := range values {
+						// name + ": " + value + CRLF, as sent on the wire
+						total += len(name) + len(value) + 4
+					}
+				}
+				if total > limits.MaxHeaderBytes {
+					logLimit(logger, svc, c, "total header size")
+					return echo.NewHTTPError(http.StatusRequestHeaderFieldsTooLarge, "Request header fields too large")
+				}
+			}
+
+			if max := limits.MaxRequestBodySize; max > 0 && req.Body != nil {
+				if req.ContentLength > max {
+					logLimit(logger, svc, c, "request body size")
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+				}
+				req.Body = http.MaxBytesReader(c.Response().Writer, req.Body, max)
+			}
+			return next(c)
+		}
+	}
+}
+
+// limitResponse caps body at the service's maxResponseBodySize. Bodies
+// declaring a larger length are rejected before anything is read.
+func (h *ServiceHandler) limitResponse(c echo.Context, resp *http.Response) error {
+	if h.service.Limits == nil || h.service.Limits.MaxResponseBodySize <= 0 {
+		return nil
+	}
+	max := h.service.Limits.MaxResponseBodySize
+	if resp.ContentLength > max {
+		logLimit(h.logger, h.service, c, "response body size")
+		return echo.NewHTTPError(http.StatusBadGateway, "Response body too large")
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: max}
+	return nil
+}
+
+// abortOversized ends a response whose body turned out too large once
+// part of it was already sent. The client sees a truncated response
+// instead of a complete one.
+func (h *ServiceHandler) abortOversized(c echo.Context, err error) error {
+	if !errors.Is(err, errResponseTooLarge) {
+		return err
+	}
+	logLimit(h.logger, h.service, c, "response body size")
+	panic(http.ErrAbortHandler)
+}
+
+func logLimit(logger *logrus.Logger, svc *service.Config, c echo.Context, reason string) {
+	logger.WithFields(logrus.Fields{
+		"service": svc.Name,
+		"path":    c.Request().URL.Path,
+		"reason":  reason,
+	}).Warn("Request rejected by service limits")
+}
+
+// limitedBody fails reads past remaining bytes with errResponseTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errResponseTooLarge
+	}
+	// Read one byte past the limit to tell a body ending right at it from
+	// a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), errResponseTooLarge
+	}
+	return n, err
+}
@@ -1,8 +1,37 @@
 package routing
 
 import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/async"
+	"odin/pkg/auth"
+	"odin/pkg/bot"
 	"odin/pkg/cache"
+	"odin/pkg/cel"
+	"odin/pkg/consumers"
+	"odin/pkg/discovery"
+	"odin/pkg/dlp"
+	"odin/pkg/experiments"
+	"odin/pkg/faults"
+	"odin/pkg/flags"
+	"odin/pkg/health"
+	"odin/pkg/ipfilter"
+	"odin/pkg/metering"
+	"odin/pkg/mock"
+	"odin/pkg/monitoring"
+	"odin/pkg/openapi"
+	"odin/pkg/overload"
+	"odin/pkg/portal"
+	"odin/pkg/products"
 	"odin/pkg/service"
+	"odin/pkg/soap"
+	"odin/pkg/static"
+	"odin/pkg/versioning"
+	"odin/pkg/websocket"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
@@ -14,6 +43,48 @@ type Router struct {
 	logger         *logrus.Logger
 	cacheStore     cache.Store
 	authMiddleware echo.MiddlewareFunc
+	oidcProviders  map[string]*auth.OIDCProvider
+	clientCerts    map[string]*auth.ClientCertAuth
+	hmacAuth       *auth.HMACAuth
+	ipFilter       *ipfilter.Filter
+	botGuard       *bot.Guard
+	overloadGuard  *overload.Guard
+	validators     map[string]*openapi.Validator
+	dlpFilters     map[string]*dlp.Filter
+	wsProxies      map[string]*websocket.Proxy
+	soapProxies    map[string]*soap.Proxy
+	versions       map[string]*versioning.Router
+	mocks          map[string]*mock.Mocker
+	statics        map[string]*static.Responder
+	healthCheckers map[string]*health.TargetChecker
+	maintenance    *health.Maintenance
+	resolver       *discovery.Resolver
+	flags          *flags.Flags
+	predicates     map[string]*cel.Route
+	experiments    map[string]*experiments.Experiment
+	faults         *faults.Injector
+	async          *async.Manager
+	portal         *portal.Portal
+	products       *products.Enforcer
+	apiKeyLimiter  *auth.APIKeyLimiter
+	meter          *metering.Meter
+	consumers      *consumers.Registry
+	samples        *monitoring.RequestSamples
+	serviceRoutes  map[string]func(e *echo.Echo)
+	routes         atomic.Pointer[routeTable]
+	dispatch       sync.Once
+}
+
+// routeTable holds the routes of one set of services. Requests are served by
+// the table in use when they arrive, so replacing it leaves requests in
+// flight on the routes they started on.
+type routeTable struct {
+	echo     *echo.Echo // Only its router is used
+	params   []string   // Sized for the route with the most parameters
+	inFlight map[string]*int64
+	handlers []*ServiceHandler
+	limits   map[string]echo.MiddlewareFunc // Request limits of the routes protocol proxies register, by path
+	chains   map[string][]string            // Names of the middleware of each service, outermost first
 }
 
 func NewRouter(e *echo.Echo, registry *service.Registry, logger *logrus.Logger) *Router {
@@ -32,13 +103,289 @@ func (r *Router) SetAuthMiddleware(middleware echo.MiddlewareFunc) {
 	r.authMiddleware = middleware
 }
 
+// SetOIDCProviders sets the providers services may authenticate with
+// instead of the JWT secret, by name
+func (r *Router) SetOIDCProviders(providers map[string]*auth.OIDCProvider) {
+	r.oidcProviders = providers
+}
+
+// SetHMACAuth verifies the signed requests of services with the hmac
+// provider
+func (r *Router) SetHMACAuth(hmacAuth *auth.HMACAuth) {
+	r.hmacAuth = hmacAuth
+}
+
+// SetClientCertAuth requires the clients of a service to present a
+// certificate it accepts
+func (r *Router) SetClientCertAuth(serviceName string, clientCert *auth.ClientCertAuth) {
+	if r.clientCerts == nil {
+		r.clientCerts = make(map[string]*auth.ClientCertAuth)
+	}
+	r.clientCerts[serviceName] = clientCert
+}
+
+func (r *Router) SetIPFilter(filter *ipfilter.Filter) {
+	r.ipFilter = filter
+}
+
+// SetBotGuard applies bot mitigation to every service it is not excluded from
+func (r *Router) SetBotGuard(guard *bot.Guard) {
+	r.botGuard = guard
+}
+
+// SetOverloadGuard limits the requests in flight across all services and
+// sheds the excess
+func (r *Router) SetOverloadGuard(guard *overload.Guard) {
+	r.overloadGuard = guard
+}
+
+// SetRequestValidator validates requests to a service against an OpenAPI spec
+func (r *Router) SetRequestValidator(serviceName string, validator *openapi.Validator) {
+	if r.validators == nil {
+		r.validators = make(map[string]*openapi.Validator)
+	}
+	r.validators[serviceName] = validator
+}
+
+// SetDLPFilter masks sensitive data in a service's responses
+func (r *Router) SetDLPFilter(serviceName string, filter *dlp.Filter) {
+	if r.dlpFilters == nil {
+		r.dlpFilters = make(map[string]*dlp.Filter)
+	}
+	r.dlpFilters[serviceName] = filter
+}
+
+// SetWebSocketProxy proxies WebSocket upgrades to a service through proxy
+func (r *Router) SetWebSocketProxy(serviceName string, proxy *websocket.Proxy) {
+	if r.wsProxies == nil {
+		r.wsProxies = make(map[string]*websocket.Proxy)
+	}
+	r.wsProxies[serviceName] = proxy
+}
+
+// SetVersionRouter routes a service's requests to the API version they ask
+// for
+func (r *Router) SetVersionRouter(serviceName string, versions *versioning.Router) {
+	if r.versions == nil {
+		r.versions = make(map[string]*versioning.Router)
+	}
+	r.versions[serviceName] = versions
+}
+
+// SetMocker answers a service's requests with mock responses
+func (r *Router) SetMocker(serviceName string, mocker *mock.Mocker) {
+	if r.mocks == nil {
+		r.mocks = make(map[string]*mock.Mocker)
+	}
+	r.mocks[serviceName] = mocker
+}
+
+// SetStaticResponder answers a service's requests with responder instead
+// of proxying them
+func (r *Router) SetStaticResponder(serviceName string, responder *static.Responder) {
+	if r.statics == nil {
+		r.statics = make(map[string]*static.Responder)
+	}
+	r.statics[serviceName] = responder
+}
+
+// SetSOAPProxy serves a soap service's operations through proxy
+func (r *Router) SetSOAPProxy(serviceName string, proxy *soap.Proxy) {
+	if r.soapProxies == nil {
+		r.soapProxies = make(map[string]*soap.Proxy)
+	}
+	r.soapProxies[serviceName] = proxy
+}
+
+// SetHealthChecker routes a service's requests away from the targets checker
+// finds unhealthy, and reports their outcome to it for passive health checks
+func (r *Router) SetHealthChecker(serviceName string, checker *health.TargetChecker) {
+	if r.healthCheckers == nil {
+		r.healthCheckers = make(map[string]*health.TargetChecker)
+	}
+	r.healthCheckers[serviceName] = checker
+}
+
+// SetMaintenance stops routing requests to the targets disabled in m
+func (r *Router) SetMaintenance(m *health.Maintenance) {
+	r.maintenance = m
+}
+
+// SetResolver routes requests for dns:// and dns+srv:// targets to the
+// addresses resolver currently has for them
+func (r *Router) SetResolver(resolver *discovery.Resolver) {
+	r.resolver = resolver
+}
+
+// SetFlags evaluates the feature flags that gate routes and set canary
+// weights with flags
+func (r *Router) SetFlags(flags *flags.Flags) {
+	r.flags = flags
+}
+
+// SetRoutePredicates applies a service's CEL match condition, canary
+// condition and authorization policies
+func (r *Router) SetRoutePredicates(serviceName string, route *cel.Route) {
+	if r.predicates == nil {
+		r.predicates = make(map[string]*cel.Route)
+	}
+	r.predicates[serviceName] = route
+}
+
+// SetExperiment splits the clients of a service between the variants of an
+// experiment
+func (r *Router) SetExperiment(serviceName string, experiment *experiments.Experiment) {
+	if r.experiments == nil {
+		r.experiments = make(map[string]*experiments.Experiment)
+	}
+	r.experiments[serviceName] = experiment
+}
+
+// SetFaults injects failures into the requests of services, when allowed
+// in the gateway's environment
+func (r *Router) SetFaults(injector *faults.Injector) {
+	r.faults = injector
+}
+
+// SetAsync runs the asynchronous requests of services with an async section
+// in the background
+func (r *Router) SetAsync(m *async.Manager) {
+	r.async = m
+}
+
+// SetPortal records the usage of developers' keys on authenticated services
+func (r *Router) SetPortal(p *portal.Portal) {
+	r.portal = p
+}
+
+// SetMeter counts the requests and bytes of every service for billing
+func (r *Router) SetMeter(meter *metering.Meter) {
+	r.meter = meter
+}
+
+// SetConsumers applies the rate limits, allowed services and headers of the
+// consumers requests belong to
+func (r *Router) SetConsumers(registry *consumers.Registry) {
+	r.consumers = registry
+}
+
+// SetProductEnforcer applies the plans API keys subscribe to on
+// authenticated services
+func (r *Router) SetProductEnforcer(enforcer *products.Enforcer) {
+	r.products = enforcer
+}
+
+// SetAPIKeyLimiter applies the rate limits of API keys on authenticated
+// services
+func (r *Router) SetAPIKeyLimiter(limiter *auth.APIKeyLimiter) {
+	r.apiKeyLimiter = limiter
+}
+
+// SetRequestSamples keeps the recent requests of every service
+func (r *Router) SetRequestSamples(samples *monitoring.RequestSamples) {
+	r.samples = samples
+}
+
+// SetServiceRoutes registers the routes of a service whose protocol proxy
+// serves them itself, such as GraphQL and gRPC, along with the other
+// service routes
+func (r *Router) SetServiceRoutes(serviceName string, register func(e *echo.Echo)) {
+	if r.serviceRoutes == nil {
+		r.serviceRoutes = make(map[string]func(e *echo.Echo))
+	}
+	r.serviceRoutes[serviceName] = register
+}
+
+// ResetServices replaces the registry and forgets the components set for its
+// services, so that those of another set of services can be set before
+// RegisterRoutes swaps them in. The routes in use are not affected.
+func (r *Router) ResetServices(registry *service.Registry) {
+	r.registry = registry
+	r.validators = nil
+	r.dlpFilters = nil
+	r.clientCerts = nil
+	r.wsProxies = nil
+	r.soapProxies = nil
+	r.versions = nil
+	r.mocks = nil
+	r.statics = nil
+	r.healthCheckers = nil
+	r.predicates = nil
+	r.experiments = nil
+	r.serviceRoutes = nil
+}
+
+// InFlight returns the number of requests each service is serving
+func (r *Router) InFlight() map[string]int64 {
+	table := r.routes.Load()
+	if table == nil {
+		return map[string]int64{}
+	}
+	counts := make(map[string]int64, len(table.inFlight))
+	for name, count := range table.inFlight {
+		counts[name] = atomic.LoadInt64(count)
+	}
+	return counts
+}
+
+// Chain returns the names of the middleware the routes in use apply to the
+// requests of a service, outermost first. Services whose protocol proxy
+// serves them only list the limits applied to them.
+func (r *Router) Chain(serviceName string) []string {
+	table := r.routes.Load()
+	if table == nil {
+		return nil
+	}
+	return table.chains[serviceName]
+}
+
+// trackRequests counts the requests a service is serving while they run,
+// and samples them once they are done if samples is not nil
+func trackRequests(service string, count *int64, samples *monitoring.RequestSamples) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			atomic.AddInt64(count, 1)
+			defer atomic.AddInt64(count, -1)
+
+			start := time.Now()
+			err := next(c)
+			if samples != nil {
+				status := c.Response().Status
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+				samples.Record(service, monitoring.RequestSample{
+					Time:     start,
+					Method:   c.Request().Method,
+					Path:     c.Request().URL.Path,
+					Client:   c.RealIP(),
+					Status:   status,
+					Duration: time.Since(start),
+				})
+			}
+			return err
+		}
+	}
+}
+
+// RegisterRoutes builds the routes of the registered services and serves
+// requests with them. Called again, e.g. after ResetServices, it swaps the
+// new routes in for the old ones without dropping requests in flight.
 func (r *Router) RegisterRoutes() error {
-	// Register HTTP service routes (GraphQL and gRPC are handled separately)
+	// Register HTTP service routes (GraphQL and gRPC register their own)
 	services := r.registry.GetAllServices()
+	previous := r.routes.Load()
+	table := &routeTable{
+		echo:     echo.New(),
+		inFlight: make(map[string]*int64, len(services)),
+		chains:   make(map[string][]string, len(services)),
+	}
 
 	for _, svc := range services {
-		// Skip non-HTTP services as they have their own handlers
-		if svc.Protocol != "" && svc.Protocol != "http" {
+		// Skip non-HTTP services as they have their own handlers. SOAP and
+		// WebSocket services are served here so they get the same middleware.
+		soapProxy, isSOAP := r.soapProxies[svc.Name]
+		if svc.Protocol != "" && svc.Protocol != "http" && svc.Protocol != "websocket" && (svc.Protocol != "soap" || !isSOAP) {
 			continue
 		}
 
@@ -48,29 +395,299 @@ func (r *Router) RegisterRoutes() error {
 			"protocol": svc.Protocol,
 		}).Info("Registering HTTP service route")
 
-		// Create service handler
-		handler, err := NewServiceHandler(svc, r.logger, r.cacheStore)
-		if err != nil {
-			r.logger.WithError(err).Warnf("Failed to create handler for service %s", svc.Name)
-			continue
+		var handler *ServiceHandler
+		mocker, mocked := r.mocks[svc.Name]
+		responder, isStatic := r.statics[svc.Name]
+		if isStatic {
+			// Static responses and redirects need no upstream
+		} else if isSOAP {
+			transport, err := newTransport(svc.Transport)
+			if err != nil {
+				r.logger.WithError(err).Warnf("Failed to create handler for service %s", svc.Name)
+				continue
+			}
+			soapProxy.SetClient(&http.Client{Timeout: svc.Timeout, Transport: transport})
+			soapProxy.SetMaintenance(r.maintenance)
+			if checker, ok := r.healthCheckers[svc.Name]; ok {
+				soapProxy.SetHealthChecker(checker)
+			}
+		} else if !mocked || len(svc.Targets) > 0 {
+			// Create service handler
+			var err error
+			handler, err = NewServiceHandler(svc, r.logger, r.cacheStore)
+			if err != nil {
+				r.logger.WithError(err).Warnf("Failed to create handler for service %s", svc.Name)
+				continue
+			}
+			handler.dlpFilter = r.dlpFilters[svc.Name]
+			handler.healthChecker = r.healthCheckers[svc.Name]
+			handler.maintenance = r.maintenance
+			handler.resolver = r.resolver
+			handler.flags = r.flags
+			if predicates, ok := r.predicates[svc.Name]; ok {
+				handler.canaryMatch = predicates.Canary
+			}
+			if proxy, ok := r.wsProxies[svc.Name]; ok {
+				handler.setWebSocketProxy(proxy)
+			}
+		}
+
+		if handler != nil {
+			table.handlers = append(table.handlers, handler)
+		}
+
+		// Create route group. Request limits come first, so that they cap
+		// the body before any middleware reads it.
+		group := table.echo.Group(svc.BasePath)
+		var names []string
+		use := func(name string, middleware ...echo.MiddlewareFunc) {
+			group.Use(middleware...)
+			names = append(names, name)
+		}
+		if limits := requestLimits(svc, r.logger); limits != nil {
+			use("limits", limits)
+		}
+
+		// Keep counting the requests of a service across route changes, so
+		// that those still in flight on the old routes are included
+		inFlight := new(int64)
+		if previous != nil && previous.inFlight[svc.Name] != nil {
+			inFlight = previous.inFlight[svc.Name]
 		}
+		table.inFlight[svc.Name] = inFlight
+		use("requests", trackRequests(svc.Name, inFlight, r.samples))
 
-		// Create route group
-		group := r.echo.Group(svc.BasePath)
+		// Shed excess load first, so rejected requests cost as little as possible
+		if r.overloadGuard != nil {
+			use("overload", r.overloadGuard.Middleware(svc.Name))
+		}
+
+		// Apply the service's IP allow/deny lists before authentication
+		if r.ipFilter != nil {
+			use("ipfilter", r.ipFilter.ServiceMiddleware(svc.Name))
+		}
+
+		// Answer preflights and stamp CORS headers before authentication,
+		// since browsers send preflights without credentials
+		if svc.CORS != nil {
+			use("cors", CORSMiddleware(svc.CORS))
+		}
+
+		// Score automated clients after preflights are answered but before
+		// authentication
+		if r.botGuard != nil && r.botGuard.Applies(svc.Name) {
+			use("bot", r.botGuard.Middleware(svc.Name))
+		}
+
+		// Verify client certificates before tokens, so that a token cannot
+		// stand in for a missing certificate
+		if clientCert, ok := r.clientCerts[svc.Name]; ok {
+			use("clientcert", clientCert.Middleware())
+		}
 
 		// Apply authentication middleware if required
-		if svc.Authentication && r.authMiddleware != nil {
-			group.Use(r.authMiddleware)
+		authenticate := r.serviceAuth(svc)
+		if authenticate != nil {
+			use("auth", authenticate)
+		}
+
+		// Meter and record usage outside plan enforcement, so that rejected
+		// requests count too
+		if r.meter != nil {
+			use("metering", r.meter.Middleware(svc.Name))
+		}
+		// Consumers are also identified by client certificate, so they
+		// apply to services without authentication too
+		if r.consumers != nil {
+			use("consumers", r.consumers.Middleware(svc.Name))
+		}
+		if authenticate != nil {
+			if r.portal != nil {
+				use("portal", r.portal.Middleware(svc.Name))
+			}
+			if r.products != nil {
+				use("products", r.products.Middleware(svc.Name))
+			}
+			if r.apiKeyLimiter != nil {
+				use("apikeylimits", r.apiKeyLimiter.Middleware())
+			}
+		}
+
+		// Hide the route from requests its flag is off for
+		if svc.FeatureFlag != "" && r.flags != nil {
+			use("flag", r.flags.Gate(svc.FeatureFlag))
+		}
+
+		// Hide the route from requests its match condition is false for, then
+		// authorize the rest; both may look at the client's claims
+		if predicates, ok := r.predicates[svc.Name]; ok {
+			if predicates.Match != nil {
+				use("match", predicates.Match.Gate())
+			}
+			if predicates.Policy != nil {
+				use("policy", predicates.Policy.Middleware())
+			}
+		}
+
+		// Assign the clients that reach the route to variants, so that only
+		// requests it serves are counted
+		if experiment, ok := r.experiments[svc.Name]; ok {
+			use("experiment", experiment.Middleware())
+		}
+
+		// Fail admitted requests as a failing service would. Every route
+		// gets the middleware, since faults can be set at runtime.
+		if r.faults != nil && r.faults.Allowed() {
+			use("faults", r.faults.Middleware(svc.Name))
+		}
+
+		// Resolve the API version and announce its deprecation
+		var tail []echo.MiddlewareFunc
+		var tailNames []string
+		if versions, ok := r.versions[svc.Name]; ok {
+			tail = append(tail, versions.Middleware())
+			tailNames = append(tailNames, "versioning")
 		}
 
+		// Reject requests that violate the service's spec before proxying
+		if validator, ok := r.validators[svc.Name]; ok {
+			tail = append(tail, validator.Middleware())
+			tailNames = append(tailNames, "validation")
+		}
+
+		// Answer validated requests with mock responses instead of proxying
+		// them; mocked services without targets answer everything themselves
+		if mocked && handler != nil {
+			tail = append(tail, mocker.Middleware())
+			tailNames = append(tailNames, "mock")
+		}
+
+		// Accept asynchronous requests once they are admitted; the rest of
+		// the chain runs in the background
+		if svc.Async != nil && r.async != nil && handler != nil {
+			use("async", r.async.Middleware(svc.Name, *svc.Async, chain(handler.Handle, tail)))
+		}
+		group.Use(tail...)
+		names = append(names, tailNames...)
+		table.chains[svc.Name] = names
+
 		// Register routes
+		if isStatic {
+			group.Any("", responder.Handle)
+			group.Any("/*", responder.Handle)
+			continue
+		}
+		if isSOAP {
+			soapProxy.RegisterRoutes(group)
+			continue
+		}
+		if handler == nil {
+			group.Any("", mocker.Handle)
+			group.Any("/*", mocker.Handle)
+			continue
+		}
 		group.Any("", handler.Handle)
 		group.Any("/*", handler.Handle)
 	}
 
+	for name, register := range r.serviceRoutes {
+		var limits echo.MiddlewareFunc
+		if svc, ok := r.registry.GetService(name); ok {
+			limits = requestLimits(svc, r.logger)
+		}
+		if limits == nil {
+			register(table.echo)
+			continue
+		}
+		table.chains[name] = []string{"limits"}
+		// Protocol proxies register their routes themselves, so their limits
+		// are applied when a request is routed
+		existing := make(map[string]bool)
+		for _, route := range table.echo.Routes() {
+			existing[route.Path] = true
+		}
+		register(table.echo)
+		for _, route := range table.echo.Routes() {
+			if !existing[route.Path] {
+				if table.limits == nil {
+					table.limits = make(map[string]echo.MiddlewareFunc)
+				}
+				table.limits[route.Path] = limits
+			}
+		}
+	}
+
+	params := 0
+	for _, route := range table.echo.Routes() {
+		params = max(params, strings.Count(route.Path, ":")+strings.Count(route.Path, "*"))
+	}
+	table.params = make([]string, params)
+
+	r.routes.Store(table)
+	r.dispatch.Do(func() {
+		r.echo.Any("/", r.serve)
+		r.echo.Any("/*", r.serve)
+	})
+
+	// Requests in flight keep their connections; idle ones are not needed
+	if previous != nil {
+		for _, handler := range previous.handlers {
+			handler.closeIdleConnections()
+		}
+	}
 	return nil
 }
 
+// serviceAuth returns the middleware authenticating a service's clients,
+// or nil if it has no authentication. Services whose provider is not
+// configured reject every request rather than go unauthenticated.
+func (r *Router) serviceAuth(svc *service.Config) echo.MiddlewareFunc {
+	if !svc.Authentication {
+		return nil
+	}
+	if svc.Auth == nil || svc.Auth.Provider == "" || svc.Auth.Provider == "jwt" {
+		return r.authMiddleware
+	}
+	if svc.Auth.Provider == "hmac" && r.hmacAuth != nil {
+		return r.hmacAuth.Middleware()
+	}
+	if provider, ok := r.oidcProviders[svc.Auth.Provider]; ok {
+		return provider.Middleware(svc.Auth.Scopes)
+	}
+	r.logger.WithFields(logrus.Fields{
+		"service":  svc.Name,
+		"provider": svc.Auth.Provider,
+	}).Error("Unknown authentication provider; the service rejects every request")
+	return func(echo.HandlerFunc) echo.HandlerFunc {
+		return func(echo.Context) error {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Authentication provider unavailable")
+		}
+	}
+}
+
+// serve routes a request to a service with the routes in use. Routes of the
+// gateway itself, such as the admin API, take precedence.
+func (r *Router) serve(c echo.Context) error {
+	table := r.routes.Load()
+	req := c.Request()
+	// The context's parameter values are sized for the gateway's own routes
+	c.SetParamValues(table.params...)
+	c.SetHandler(echo.NotFoundHandler)
+	table.echo.Router().Find(req.Method, echo.GetPath(req), c)
+	if limits, ok := table.limits[c.Path()]; ok {
+		return limits(c.Handler())(c)
+	}
+	return c.Handler()(c)
+}
+
+// chain wraps h in middleware, the first one outermost, as a group does
+func chain(h echo.HandlerFunc, middleware []echo.MiddlewareFunc) echo.HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 func (r *Router) RegisterHealthRoutes() {
 	r.echo.GET("/health", func(c echo.Context) error {
 		return c.JSON(200, map[string]string{
@@ -0,0 +1,104 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/bufpool"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streaming reports whether the service passes event streams and chunked
+// responses through as they arrive
+func (h *ServiceHandler) streaming() bool {
+	return h.service.Streaming != nil && h.service.Streaming.Enabled
+}
+
+// isEventStream reports whether headers describe a Server-Sent Events stream
+func isEventStream(headers http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(headers.Get(echo.HeaderContentType))
+	return mediaType == "text/event-stream"
+}
+
+// stream copies body to the client, flushing it as it arrives. The header
+// timeout no longer applies; the service's maxDuration cuts the stream off
+// instead.
+func (h *ServiceHandler) stream(c echo.Context, body io.Reader, timeout *time.Timer, cancel context.CancelFunc) error {
+	if timeout != nil {
+		timeout.Stop()
+	}
+	var expired atomic.Bool
+	if d := h.service.Streaming.MaxDuration; d > 0 {
+		limit := time.AfterFunc(d, func() {
+			expired.Store(true)
+			cancel()
+		})
+		defer limit.Stop()
+	}
+
+	// The server's write timeout would end streams too
+	controller := http.NewResponseController(c.Response().Writer)
+	controller.SetWriteDeadline(time.Time{})
+	w := &flushWriter{dst: c.Response(), flush: controller.Flush, delay: h.service.Streaming.FlushInterval}
+	// Clients of event streams wait for the headers before the first event
+	w.flush()
+	_, err := bufpool.Copy(w, body)
+	w.stop()
+	if err != nil && expired.Load() && errors.Is(err, context.Canceled) {
+		h.logger.WithField("service", h.service.Name).Debug("Stream reached its maximum duration")
+		return nil
+	}
+	return err
+}
+
+// flushWriter flushes what is written to it right away or, with a delay,
+// at most once per delay
+type flushWriter struct {
+	mu      sync.Mutex
+	dst     io.Writer
+	flush   func() error
+	delay   time.Duration
+	pending *time.Timer
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.dst.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if w.delay <= 0 {
+		w.flush()
+	} else if w.pending == nil {
+		w.pending = time.AfterFunc(w.delay, w.delayedFlush)
+	}
+	return n, nil
+}
+
+func (w *flushWriter) delayedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending != nil {
+		w.pending = nil
+		w.flush()
+	}
+}
+
+// stop flushes what is left; nothing is flushed after it returns
+func (w *flushWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending != nil {
+		w.pending.Stop()
+		w.pending = nil
+	}
+	w.flush()
+}
@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"odin/pkg/service"
+)
+
+// Upstream connection pool defaults. Go's own default of 2 idle connections
+// per host makes busy services open and close connections constantly.
+const (
+	defaultMaxIdleConnsPerHost = 100
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// newTransport creates the connection pool shared by all requests to one
+// service. cfg may be nil.
+func newTransport(cfg *service.TransportConfig) (*http.Transport, error) {
+	settings := service.TransportConfig{}
+	if cfg != nil {
+		settings = *cfg
+	}
+	if settings.MaxIdleConnsPerHost == 0 {
+		settings.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if settings.IdleConnTimeout == 0 {
+		settings.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if settings.DialTimeout == 0 {
+		settings.DialTimeout = defaultDialTimeout
+	}
+	if settings.TLSHandshakeTimeout == 0 {
+		settings.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	// Only the per-target limit applies, so services with many targets are
+	// not capped by a pool-wide one
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = settings.IdleConnTimeout
+	transport.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
+	transport.DisableKeepAlives = settings.DisableKeepAlives
+
+	if settings.Proxy != nil {
+		proxy, err := newEgressProxy(settings.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = proxy
+	}
+	if settings.TLS != nil {
+		tlsConfig, err := newUpstreamTLSConfig(settings.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// newUpstreamTLSConfig loads the CA and client certificate a service's
+// targets are verified and authenticated with
+func newUpstreamTLSConfig(cfg *service.UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,528 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/backup"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// lockName is the lock the replicas elect the leader with
+const lockName = "scheduler"
+
+// Sources of a job
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+// Triggers of a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	// ErrNotFound is returned for jobs that do not exist
+	ErrNotFound = errors.New("job not found")
+	// ErrExists is returned when creating a job whose name is taken
+	ErrExists = errors.New("job already exists")
+	// ErrReadOnly is returned when changing a job defined in the configuration
+	ErrReadOnly = errors.New("job is defined in the configuration")
+	// ErrInvalid is returned for jobs that cannot be scheduled
+	ErrInvalid = errors.New("invalid job")
+	// ErrRunning is returned when running a job that is already running here
+	ErrRunning = errors.New("job is already running")
+)
+
+// Task does the work of a job with the job's params and returns a short
+// summary of what it did
+type Task func(ctx context.Context, params map[string]interface{}) (string, error)
+
+// Job is a task run on a schedule
+type Job struct {
+	Name     string                  `json:"name"`
+	Schedule string                  `json:"schedule"`
+	Task     string                  `json:"task"`
+	Params   map[string]interface{}  `json:"params,omitempty"`
+	Timeout  string                  `json:"timeout"`
+	Disabled bool                    `json:"disabled"`
+	Source   string                  `json:"source"`         // config or api
+	Next     *time.Time              `json:"next,omitempty"` // When the job is next due, on the leader
+	LastRun  *mongodb.JobRunDocument `json:"lastRun,omitempty"`
+}
+
+// Status tells which gateway runs the jobs
+type Status struct {
+	Owner  string `json:"owner"`
+	Leader bool   `json:"leader"`
+}
+
+type job struct {
+	Job
+	schedule backup.Schedule
+	timeout  time.Duration
+}
+
+type due struct {
+	schedule string
+	at       time.Time
+}
+
+// Scheduler runs jobs on their schedules. Replicas sharing a store elect a
+// leader through a lock they renew, and only the leader runs scheduled jobs;
+// another replica takes over once the leader stops renewing it.
+type Scheduler struct {
+	store      Store
+	owner      string
+	lease      time.Duration
+	historyTTL time.Duration
+	configured []*job
+	logger     *logrus.Logger
+
+	mu      sync.Mutex
+	tasks   map[string]Task
+	leader  bool
+	due     map[string]due
+	running map[string]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	runs   sync.WaitGroup
+}
+
+// New creates a scheduler for the jobs of cfg. Tasks are registered before
+// Start.
+func New(cfg config.SchedulerConfig, store Store, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		store:      store,
+		lease:      cfg.LeaseDuration,
+		historyTTL: cfg.HistoryTTL,
+		logger:     logger,
+		tasks:      make(map[string]Task),
+		due:        make(map[string]due),
+		running:    make(map[string]bool),
+	}
+	if s.lease == 0 {
+		s.lease = 30 * time.Second
+	}
+	if s.historyTTL == 0 {
+		s.historyTTL = 30 * 24 * time.Hour
+	}
+	hostname, _ := os.Hostname()
+	s.owner = hostname + "-" + uuid.NewString()[:8]
+
+	for _, jc := range cfg.Jobs {
+		j, err := compile(Job{
+			Name:     jc.Name,
+			Schedule: jc.Schedule,
+			Task:     jc.Task,
+			Params:   jc.Params,
+			Disabled: jc.Disabled,
+			Source:   SourceConfig,
+		}, jc.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", jc.Name, err)
+		}
+		s.configured = append(s.configured, j)
+	}
+	return s, nil
+}
+
+// compile parses the schedule of a job
+func compile(j Job, timeout time.Duration) (*job, error) {
+	schedule, err := backup.ParseSchedule(j.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	j.Timeout = timeout.String()
+	return &job{Job: j, schedule: schedule, timeout: timeout}, nil
+}
+
+// Register makes a task available to jobs under name
+func (s *Scheduler) Register(name string, task Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[name] = task
+}
+
+func (s *Scheduler) task(name string) Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tasks[name]
+}
+
+// Start checks that the tasks of the configured jobs exist, then runs jobs
+// on their schedules until Stop is called
+func (s *Scheduler) Start() error {
+	for _, j := range s.configured {
+		if s.task(j.Task) == nil {
+			return fmt.Errorf("job %s: unknown task %q", j.Name, j.Task)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go s.loop(ctx)
+	return nil
+}
+
+// Stop stops scheduling jobs, cancels the running ones and gives up the
+// leadership so another replica takes over right away
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.runs.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.store.ReleaseLock(ctx, lockName, s.owner); err != nil {
+		s.logger.WithError(err).Warn("Failed to release the scheduler lock")
+	}
+}
+
+// Status tells whether this gateway is the one running the jobs
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{Owner: s.owner, Leader: s.leader}
+}
+
+// loop renews the lease three times per lease duration, which is also how
+// late a job may start after it is due
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.lease / 3)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	leader, err := s.store.AcquireLock(ctx, lockName, s.owner, time.Now().Add(s.lease))
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to renew the scheduler lease")
+		leader = false
+	}
+	s.mu.Lock()
+	if leader != s.leader {
+		s.logger.WithFields(logrus.Fields{"owner": s.owner, "leader": leader}).Info("Scheduler leadership changed")
+	}
+	s.leader = leader
+	if !leader {
+		// A new leader schedules from scratch
+		clear(s.due)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	jobs, err := s.jobs(ctx)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to load scheduled jobs")
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		seen[j.Name] = true
+		if j.Disabled {
+			delete(s.due, j.Name)
+			continue
+		}
+		d, ok := s.due[j.Name]
+		if !ok || d.schedule != j.Schedule {
+			s.due[j.Name] = due{schedule: j.Schedule, at: j.schedule.Next(now)}
+			continue
+		}
+		if now.Before(d.at) {
+			continue
+		}
+		s.due[j.Name] = due{schedule: j.Schedule, at: j.schedule.Next(now)}
+		if s.running[j.Name] {
+			s.logger.WithField("job", j.Name).Warn("Skipping scheduled job, the previous run has not finished")
+			continue
+		}
+		s.running[j.Name] = true
+		s.runs.Add(1)
+		go func(j *job) {
+			defer s.runs.Done()
+			s.execute(ctx, j, TriggerSchedule)
+		}(j)
+	}
+	for name := range s.due {
+		if !seen[name] {
+			delete(s.due, name)
+		}
+	}
+}
+
+// jobs returns the configured jobs followed by those added through the
+// admin API
+func (s *Scheduler) jobs(ctx context.Context) ([]*job, error) {
+	docs, err := s.store.ListScheduledJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs := append([]*job(nil), s.configured...)
+	for _, doc := range docs {
+		if s.configuredJob(doc.Name) != nil {
+			continue
+		}
+		j, err := fromDocument(doc)
+		if err != nil {
+			s.logger.WithError(err).WithField("job", doc.Name).Warn("Ignoring invalid scheduled job")
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+func (s *Scheduler) configuredJob(name string) *job {
+	for _, j := range s.configured {
+		if j.Name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) find(ctx context.Context, name string) (*job, error) {
+	jobs, err := s.jobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		if j.Name == name {
+			return j, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func fromDocument(doc *mongodb.ScheduledJobDocument) (*job, error) {
+	var timeout time.Duration
+	if doc.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(doc.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("timeout cannot be negative")
+		}
+	}
+	return compile(Job{
+		Name:     doc.Name,
+		Schedule: doc.Schedule,
+		Task:     doc.Task,
+		Params:   doc.Params,
+		Disabled: doc.Disabled,
+		Source:   SourceAPI,
+	}, timeout)
+}
+
+// execute runs a job and records the run. The run is returned with its
+// outcome; the task's error is in its Error field.
+func (s *Scheduler) execute(ctx context.Context, j *job, trigger string) *mongodb.JobRunDocument {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, j.Name)
+		s.mu.Unlock()
+	}()
+
+	now := time.Now()
+	run := &mongodb.JobRunDocument{
+		ID:        uuid.NewString(),
+		Job:       j.Name,
+		Task:      j.Task,
+		Trigger:   trigger,
+		Owner:     s.owner,
+		Status:    mongodb.JobRunRunning,
+		StartedAt: now,
+		TTL:       now.Add(s.historyTTL),
+	}
+	logger := s.logger.WithFields(logrus.Fields{"job": j.Name, "task": j.Task, "trigger": trigger})
+	if err := s.store.CreateJobRun(ctx, run); err != nil {
+		logger.WithError(err).Warn("Failed to record job run")
+	}
+
+	var output string
+	var err error
+	if task := s.task(j.Task); task == nil {
+		err = fmt.Errorf("unknown task %q", j.Task)
+	} else {
+		runCtx, cancel := context.WithTimeout(ctx, j.timeout)
+		output, err = task(runCtx, j.Params)
+		cancel()
+	}
+
+	run.FinishedAt = time.Now()
+	run.Output = output
+	run.Status = mongodb.JobRunSucceeded
+	if err != nil {
+		run.Status = mongodb.JobRunFailed
+		run.Error = err.Error()
+		logger.WithError(err).Error("Scheduled job failed")
+	} else {
+		logger.WithFields(logrus.Fields{
+			"duration": run.FinishedAt.Sub(run.StartedAt),
+			"output":   output,
+		}).Info("Scheduled job completed")
+	}
+
+	// Record the outcome even when the run was cancelled by Stop
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.store.FinishJobRun(finishCtx, run); err != nil {
+		logger.WithError(err).Warn("Failed to record job run")
+	}
+	return run
+}
+
+// Run runs a job now on this gateway, outside its schedule and whether or
+// not this gateway is the leader
+func (s *Scheduler) Run(ctx context.Context, name string) (*mongodb.JobRunDocument, error) {
+	j, err := s.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.running[name] {
+		s.mu.Unlock()
+		return nil, ErrRunning
+	}
+	s.running[name] = true
+	s.mu.Unlock()
+	return s.execute(ctx, j, TriggerManual), nil
+}
+
+// Jobs lists every job with its last run, and when it is next due if this
+// gateway is the leader
+func (s *Scheduler) Jobs(ctx context.Context) ([]Job, error) {
+	jobs, err := s.jobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Job, 0, len(jobs))
+	for _, j := range jobs {
+		item := j.Job
+		s.mu.Lock()
+		if d, ok := s.due[j.Name]; ok {
+			next := d.at
+			item.Next = &next
+		}
+		s.mu.Unlock()
+		runs, err := s.store.ListJobRuns(ctx, j.Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			item.LastRun = runs[0]
+		}
+		list = append(list, item)
+	}
+	sort.SliceStable(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list, nil
+}
+
+// Runs returns the latest runs of a job, newest first
+func (s *Scheduler) Runs(ctx context.Context, name string, limit int) ([]*mongodb.JobRunDocument, error) {
+	if _, err := s.find(ctx, name); err != nil {
+		return nil, err
+	}
+	return s.store.ListJobRuns(ctx, name, limit)
+}
+
+// CreateJob adds a job to the store
+func (s *Scheduler) CreateJob(ctx context.Context, doc *mongodb.ScheduledJobDocument) error {
+	if err := s.validate(doc); err != nil {
+		return err
+	}
+	if _, err := s.find(ctx, doc.Name); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	doc.CreatedAt = time.Time{}
+	return s.store.SaveScheduledJob(ctx, doc)
+}
+
+// UpdateJob replaces a job added through the admin API
+func (s *Scheduler) UpdateJob(ctx context.Context, doc *mongodb.ScheduledJobDocument) error {
+	if err := s.validate(doc); err != nil {
+		return err
+	}
+	existing, err := s.find(ctx, doc.Name)
+	if err != nil {
+		return err
+	}
+	if existing.Source == SourceConfig {
+		return ErrReadOnly
+	}
+	docs, err := s.store.ListScheduledJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		if d.Name == doc.Name {
+			doc.CreatedAt = d.CreatedAt
+		}
+	}
+	return s.store.SaveScheduledJob(ctx, doc)
+}
+
+// DeleteJob removes a job added through the admin API
+func (s *Scheduler) DeleteJob(ctx context.Context, name string) error {
+	if s.configuredJob(name) != nil {
+		return ErrReadOnly
+	}
+	err := s.store.DeleteScheduledJob(ctx, name)
+	if errors.Is(err, mongodb.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// validate checks a job sent to the admin API
+func (s *Scheduler) validate(doc *mongodb.ScheduledJobDocument) error {
+	if doc.Name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalid)
+	}
+	if s.configuredJob(doc.Name) != nil {
+		return ErrReadOnly
+	}
+	if _, err := fromDocument(doc); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if s.task(doc.Task) == nil {
+		return fmt.Errorf("%w: unknown task %q", ErrInvalid, doc.Task)
+	}
+	return nil
+}
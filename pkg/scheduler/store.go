@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"odin/pkg/mongodb"
+)
+
+// Store keeps the jobs added through the admin API, the history of runs and
+// the leader lock. The MongoDB repository is a Store shared by every gateway
+// using the same database.
+type Store interface {
+	ListScheduledJobs(ctx context.Context) ([]*mongodb.ScheduledJobDocument, error)
+	SaveScheduledJob(ctx context.Context, job *mongodb.ScheduledJobDocument) error
+	DeleteScheduledJob(ctx context.Context, name string) error
+	CreateJobRun(ctx context.Context, run *mongodb.JobRunDocument) error
+	FinishJobRun(ctx context.Context, run *mongodb.JobRunDocument) error
+	ListJobRuns(ctx context.Context, job string, limit int) ([]*mongodb.JobRunDocument, error)
+	AcquireLock(ctx context.Context, name, owner string, until time.Time) (bool, error)
+	ReleaseLock(ctx context.Context, name, owner string) error
+}
+
+// maxMemoryRuns bounds the runs the memory store keeps
+const maxMemoryRuns = 1000
+
+// memoryStore keeps the jobs and runs of a single gateway. They are lost on
+// restart.
+type memoryStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*mongodb.ScheduledJobDocument
+	runs  []*mongodb.JobRunDocument // Oldest first
+	locks map[string]mongodb.LockDocument
+}
+
+// NewMemoryStore creates a store that keeps jobs and runs in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		jobs:  make(map[string]*mongodb.ScheduledJobDocument),
+		locks: make(map[string]mongodb.LockDocument),
+	}
+}
+
+func (s *memoryStore) ListScheduledJobs(ctx context.Context) ([]*mongodb.ScheduledJobDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*mongodb.ScheduledJobDocument, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		copied := *job
+		jobs = append(jobs, &copied)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs, nil
+}
+
+func (s *memoryStore) SaveScheduledJob(ctx context.Context, job *mongodb.ScheduledJobDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job.UpdatedAt = now
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	stored := *job
+	s.jobs[job.Name] = &stored
+	return nil
+}
+
+func (s *memoryStore) DeleteScheduledJob(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; !ok {
+		return fmt.Errorf("scheduled job %s: %w", name, mongodb.ErrNotFound)
+	}
+	delete(s.jobs, name)
+	return nil
+}
+
+func (s *memoryStore) CreateJobRun(ctx context.Context, run *mongodb.JobRunDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	kept := s.runs[:0]
+	for _, r := range s.runs {
+		if r.TTL.IsZero() || r.TTL.After(now) {
+			kept = append(kept, r)
+		}
+	}
+	s.runs = kept
+	if len(s.runs) >= maxMemoryRuns {
+		s.runs = s.runs[len(s.runs)-maxMemoryRuns+1:]
+	}
+
+	stored := *run
+	s.runs = append(s.runs, &stored)
+	return nil
+}
+
+func (s *memoryStore) FinishJobRun(ctx context.Context, run *mongodb.JobRunDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.runs {
+		if r.ID == run.ID {
+			stored := *run
+			s.runs[i] = &stored
+			return nil
+		}
+	}
+	return fmt.Errorf("job run %s: %w", run.ID, mongodb.ErrNotFound)
+}
+
+func (s *memoryStore) ListJobRuns(ctx context.Context, job string, limit int) ([]*mongodb.JobRunDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []*mongodb.JobRunDocument
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if job != "" && s.runs[i].Job != job {
+			continue
+		}
+		copied := *s.runs[i]
+		runs = append(runs, &copied)
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+	return runs, nil
+}
+
+func (s *memoryStore) AcquireLock(ctx context.Context, name, owner string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[name]
+	if ok && lock.Owner != owner && lock.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+	s.locks[name] = mongodb.LockDocument{Name: name, Owner: owner, ExpiresAt: until}
+	return true, nil
+}
+
+func (s *memoryStore) ReleaseLock(ctx context.Context, name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, ok := s.locks[name]; ok && lock.Owner == owner {
+		delete(s.locks, name)
+	}
+	return nil
+}
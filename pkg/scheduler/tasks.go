@@ -0,0 +1,396 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"odin/pkg/ai"
+	"odin/pkg/mongodb"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Built-in tasks
+const (
+	TaskHTTP                 = "http"
+	TaskExpireAPIKeys        = "expireApiKeys"
+	TaskUsageReport          = "usageReport"
+	TaskMetricRollup         = "metricRollup"
+	TaskRecalculateBaselines = "recalculateBaselines"
+)
+
+// APIKeyStore lists and updates API keys
+type APIKeyStore interface {
+	ListAPIKeys(ctx context.Context, userID string) ([]*mongodb.APIKeyDocument, error)
+	UpdateAPIKey(ctx context.Context, id string, key *mongodb.APIKeyDocument) error
+}
+
+// UsageStore queries metered usage
+type UsageStore interface {
+	QueryUsageRecords(ctx context.Context, query mongodb.UsageRecordQuery) ([]*mongodb.UsageRecordDocument, error)
+}
+
+// MetricStore reads and writes stored metrics
+type MetricStore interface {
+	SaveMetric(ctx context.Context, metric *mongodb.MetricDocument) error
+	QueryMetrics(ctx context.Context, name string, start, end time.Time, labels map[string]string) ([]*mongodb.MetricDocument, error)
+}
+
+// HTTPTask requests URLs, for example to warm up caches. Paths such as
+// /api/products are served by handler, the gateway itself, without going
+// through the network; absolute URLs are requested with client.
+//
+// Params: url or urls, method (default GET), host and headers. A response
+// with a status of 400 or more fails the run.
+func HTTPTask(handler http.Handler, client *http.Client) Task {
+	return func(ctx context.Context, params map[string]interface{}) (string, error) {
+		urls := stringsParam(params, "urls")
+		if url := stringParam(params, "url"); url != "" {
+			urls = append(urls, url)
+		}
+		if len(urls) == 0 {
+			return "", fmt.Errorf("url or urls is required")
+		}
+		method := strings.ToUpper(stringParam(params, "method"))
+		if method == "" {
+			method = http.MethodGet
+		}
+		headers := mapParam(params, "headers")
+
+		for _, url := range urls {
+			req, err := http.NewRequestWithContext(ctx, method, url, nil)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", url, err)
+			}
+			for name, value := range headers {
+				req.Header.Set(name, fmt.Sprint(value))
+			}
+			if host := stringParam(params, "host"); host != "" {
+				req.Host = host
+			}
+
+			var status int
+			if strings.HasPrefix(url, "/") {
+				req.RemoteAddr = "127.0.0.1:0"
+				w := &discardWriter{header: make(http.Header)}
+				handler.ServeHTTP(w, req)
+				status = w.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+			} else {
+				resp, err := client.Do(req)
+				if err != nil {
+					return "", fmt.Errorf("%s: %w", url, err)
+				}
+				resp.Body.Close()
+				status = resp.StatusCode
+			}
+			if status >= http.StatusBadRequest {
+				return "", fmt.Errorf("%s %s: status %d", method, url, status)
+			}
+		}
+		return fmt.Sprintf("requested %d URLs", len(urls)), nil
+	}
+}
+
+// discardWriter keeps the status of a response served in-process and drops
+// its body
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// ExpireAPIKeysTask disables enabled API keys past their expiry date and,
+// with the maxIdle param, those unused for longer than it
+func ExpireAPIKeysTask(keys APIKeyStore) Task {
+	return func(ctx context.Context, params map[string]interface{}) (string, error) {
+		maxIdle, err := durationParam(params, "maxIdle", 0)
+		if err != nil {
+			return "", err
+		}
+
+		all, err := keys.ListAPIKeys(ctx, "")
+		if err != nil {
+			return "", err
+		}
+		now := time.Now()
+		disabled := 0
+		for _, key := range all {
+			if !key.Enabled {
+				continue
+			}
+			lastUsed := key.LastUsed
+			if lastUsed.IsZero() {
+				lastUsed = key.CreatedAt
+			}
+			expired := key.ExpiresAt != nil && key.ExpiresAt.Before(now)
+			idle := maxIdle > 0 && now.Sub(lastUsed) > maxIdle
+			if !expired && !idle {
+				continue
+			}
+			key.Enabled = false
+			if err := keys.UpdateAPIKey(ctx, key.ID, key); err != nil {
+				return "", fmt.Errorf("disabled %d keys before failing: %w", disabled, err)
+			}
+			disabled++
+		}
+		return fmt.Sprintf("disabled %d of %d keys", disabled, len(all)), nil
+	}
+}
+
+// UsageReportTask writes the metered usage of the last period (param
+// period, default 24h) as a CSV file in the directory param
+func UsageReportTask(usage UsageStore) Task {
+	return func(ctx context.Context, params map[string]interface{}) (string, error) {
+		dir := stringParam(params, "directory")
+		if dir == "" {
+			return "", fmt.Errorf("directory is required")
+		}
+		period, err := durationParam(params, "period", 24*time.Hour)
+		if err != nil {
+			return "", err
+		}
+
+		now := time.Now().UTC()
+		records, err := usage.QueryUsageRecords(ctx, mongodb.UsageRecordQuery{From: now.Add(-period), To: now})
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		path := filepath.Join(dir, "usage-"+now.Format("20060102-150405")+".csv")
+		f, err := os.Create(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		w := csv.NewWriter(f)
+		w.Write([]string{"periodStart", "periodEnd", "keyId", "userId", "plan", "service", "requests", "errors", "bytesIn", "bytesOut"})
+		for _, r := range records {
+			w.Write([]string{
+				r.PeriodStart.Format(time.RFC3339), r.PeriodEnd.Format(time.RFC3339),
+				r.KeyID, r.UserID, r.Plan, r.Service,
+				strconv.FormatInt(r.Requests, 10), strconv.FormatInt(r.Errors, 10),
+				strconv.FormatInt(r.BytesIn, 10), strconv.FormatInt(r.BytesOut, 10),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("wrote %d records to %s", len(records), path), nil
+	}
+}
+
+// MetricRollupTask summarizes the samples of the metric param over the last
+// window (default 1h) into one metric per set of labels, named by the into
+// param (default <metric>_rollup). Counters are summed and other metrics
+// averaged; the count, minimum and maximum go in the metadata.
+func MetricRollupTask(metrics MetricStore) Task {
+	return func(ctx context.Context, params map[string]interface{}) (string, error) {
+		name := stringParam(params, "metric")
+		if name == "" {
+			return "", fmt.Errorf("metric is required")
+		}
+		window, err := durationParam(params, "window", time.Hour)
+		if err != nil {
+			return "", err
+		}
+		into := stringParam(params, "into")
+		if into == "" {
+			into = name + "_rollup"
+		}
+
+		end := time.Now()
+		start := end.Add(-window)
+		samples, err := metrics.QueryMetrics(ctx, name, start, end, nil)
+		if err != nil {
+			return "", err
+		}
+
+		type group struct {
+			labels   map[string]string
+			kind     string
+			count    int
+			sum      float64
+			min, max float64
+		}
+		groups := make(map[string]*group)
+		var keys []string
+		for _, m := range samples {
+			key := labelKey(m.Labels)
+			g, ok := groups[key]
+			if !ok {
+				g = &group{labels: m.Labels, kind: m.Type, min: m.Value, max: m.Value}
+				groups[key] = g
+				keys = append(keys, key)
+			}
+			g.count++
+			g.sum += m.Value
+			g.min = min(g.min, m.Value)
+			g.max = max(g.max, m.Value)
+		}
+
+		for _, key := range keys {
+			g := groups[key]
+			value := g.sum
+			if g.kind != "counter" {
+				value = g.sum / float64(g.count)
+			}
+			err := metrics.SaveMetric(ctx, &mongodb.MetricDocument{
+				Name:   into,
+				Type:   g.kind,
+				Value:  value,
+				Labels: g.labels,
+				Metadata: map[string]interface{}{
+					"count":       g.count,
+					"min":         g.min,
+					"max":         g.max,
+					"windowStart": start,
+					"windowEnd":   end,
+				},
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("rolled up %d samples into %d metrics", len(samples), len(keys)), nil
+	}
+}
+
+// labelKey identifies a set of labels
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// RecalculateBaselinesTask recalculates the AI anomaly baselines of the
+// services from their traffic over the last window (param window, default
+// window or 24h). Services with fewer than minSamples patterns (param
+// minSamples) keep their baseline.
+func RecalculateBaselinesTask(repository ai.Repository, services func() []string, window time.Duration, minSamples int) Task {
+	if window == 0 {
+		window = 24 * time.Hour
+	}
+	return func(ctx context.Context, params map[string]interface{}) (string, error) {
+		window, err := durationParam(params, "window", window)
+		if err != nil {
+			return "", err
+		}
+		samples := minSamples
+		switch n := params["minSamples"].(type) {
+		case int:
+			samples = n
+		case int32:
+			samples = int(n)
+		case int64:
+			samples = int(n)
+		case float64:
+			samples = int(n)
+		}
+
+		updated := 0
+		names := services()
+		for _, name := range names {
+			baseline, err := ai.RecalculateBaseline(ctx, repository, name, window, samples)
+			if err != nil {
+				return "", fmt.Errorf("service %s: %w", name, err)
+			}
+			if baseline != nil {
+				updated++
+			}
+		}
+		return fmt.Sprintf("recalculated %d of %d baselines", updated, len(names)), nil
+	}
+}
+
+func stringParam(params map[string]interface{}, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+// stringsParam returns a list param, or a single string as a list of one
+func stringsParam(params map[string]interface{}, name string) []string {
+	switch v := params[name].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case primitive.A: // Jobs read from MongoDB
+		return stringsParam(map[string]interface{}{name: []interface{}(v)}, name)
+	}
+	return nil
+}
+
+// mapParam returns an object param
+func mapParam(params map[string]interface{}, name string) map[string]interface{} {
+	switch v := params[name].(type) {
+	case map[string]interface{}:
+		return v
+	case primitive.D: // Jobs read from MongoDB
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = e.Value
+		}
+		return m
+	}
+	return nil
+}
+
+func durationParam(params map[string]interface{}, name string, fallback time.Duration) (time.Duration, error) {
+	s := stringParam(params, name)
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
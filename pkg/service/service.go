@@ -20,7 +20,10 @@ type Config struct {
 	Authentication bool                  `yaml:"authentication"`
 	LoadBalancing  string                `yaml:"loadBalancing"`
 	Headers        map[string]string     `yaml:"headers"`
+	HeaderRules    *HeaderRulesConfig    `yaml:"headerRules,omitempty"`
+	ResponseFields []transform.FieldRule `yaml:"responseFields,omitempty"`
 	Protocol       string                `yaml:"protocol"`
+	FeatureFlag    string                `yaml:"featureFlag,omitempty"`
 	Canary         *CanaryConfig         `yaml:"canary,omitempty"`
 	Transformation *TransformationConfig `yaml:"transformation,omitempty"`
 	Transform      struct {
@@ -29,18 +32,124 @@ type Config struct {
 	} `yaml:"transform"` // Legacy field, kept for backward compatibility
 	Aggregation *AggregationConfig `yaml:"aggregation,omitempty"`
 	HealthCheck *HealthCheckConfig `yaml:"healthCheck,omitempty"`
+	CORS        *CORSConfig        `yaml:"cors,omitempty"`
+	Transport   *TransportConfig   `yaml:"transport,omitempty"`
+	// Backpressure sets how 429 and 503 responses with Retry-After are
+	// retried; nil uses the defaults
+	Backpressure *BackpressureConfig `yaml:"backpressure,omitempty"`
+	// Async accepts requests with 202 and calls the targets in the
+	// background; nil serves every request synchronously
+	Async *AsyncConfig `yaml:"async,omitempty"`
+	// Responses above this size in bytes are streamed when nothing inspects
+	// them; 0 uses the default
+	StreamThreshold int64 `yaml:"streamThreshold,omitempty"`
+	// Streaming flushes event streams and chunked responses as they arrive;
+	// nil leaves them to the stream threshold
+	Streaming *StreamingConfig `yaml:"streaming,omitempty"`
+	// Auth picks the provider authenticating clients; nil uses the JWT
+	// secret
+	Auth *AuthConfig `yaml:"auth,omitempty"`
+	// Limits caps the size of requests and responses; nil leaves them
+	// unbounded
+	Limits *LimitsConfig `yaml:"limits,omitempty"`
+}
+
+// LimitsConfig bounds what the gateway accepts from clients and targets.
+// Zero disables a limit.
+type LimitsConfig struct {
+	MaxRequestBodySize  int64 `yaml:"maxRequestBodySize,omitempty"`
+	MaxHeaderBytes      int   `yaml:"maxHeaderBytes,omitempty"`
+	MaxResponseBodySize int64 `yaml:"maxResponseBodySize,omitempty"`
+}
+
+// AuthConfig names the provider a service's clients authenticate with and
+// the scopes their tokens need
+type AuthConfig struct {
+	Provider string   `yaml:"provider,omitempty"`
+	Scopes   []string `yaml:"scopes,omitempty"`
+}
+
+// StreamingConfig sets how responses are passed through as they arrive
+type StreamingConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	FlushInterval time.Duration `yaml:"flushInterval,omitempty"`
+	MaxDuration   time.Duration `yaml:"maxDuration,omitempty"`
+}
+
+// BackpressureConfig sets how targets asking the gateway to back off are
+// handled
+type BackpressureConfig struct {
+	DisableRetries  bool          `yaml:"disableRetries,omitempty"`
+	MaxDelay        time.Duration `yaml:"maxDelay,omitempty"`
+	StripRetryAfter bool          `yaml:"stripRetryAfter,omitempty"`
+}
+
+// AsyncConfig sets which requests of a service run in the background and
+// where their results may be reported
+type AsyncConfig struct {
+	Mode           string        `yaml:"mode,omitempty"`
+	Timeout        time.Duration `yaml:"timeout,omitempty"`
+	CallbackHosts  []string      `yaml:"callbackHosts,omitempty"`
+	CallbackSecret string        `yaml:"callbackSecret,omitempty"`
+}
+
+// TransportConfig tunes the service's upstream connection pool
+type TransportConfig struct {
+	MaxIdleConnsPerHost int                `yaml:"maxIdleConnsPerHost,omitempty"`
+	IdleConnTimeout     time.Duration      `yaml:"idleConnTimeout,omitempty"`
+	DialTimeout         time.Duration      `yaml:"dialTimeout,omitempty"`
+	TLSHandshakeTimeout time.Duration      `yaml:"tlsHandshakeTimeout,omitempty"`
+	DisableKeepAlives   bool               `yaml:"disableKeepAlives,omitempty"`
+	TLS                 *UpstreamTLSConfig `yaml:"tls,omitempty"`
+	Proxy               *EgressProxyConfig `yaml:"proxy,omitempty"`
+}
+
+// EgressProxyConfig is the proxy the service's targets are reached through
+type EgressProxyConfig struct {
+	URL      string   `yaml:"url"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	NoProxy  []string `yaml:"noProxy,omitempty"`
+}
+
+// UpstreamTLSConfig holds the TLS settings used towards the service's targets
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`
+	CertFile           string `yaml:"certFile,omitempty"`
+	KeyFile            string `yaml:"keyFile,omitempty"`
+	ServerName         string `yaml:"serverName,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+}
+
+// CORSConfig holds the cross-origin policy answered at the gateway
+type CORSConfig struct {
+	AllowOrigins     []string `yaml:"allowOrigins"`
+	AllowMethods     []string `yaml:"allowMethods,omitempty"`
+	AllowHeaders     []string `yaml:"allowHeaders,omitempty"`
+	ExposeHeaders    []string `yaml:"exposeHeaders,omitempty"`
+	AllowCredentials bool     `yaml:"allowCredentials,omitempty"`
+	MaxAge           int      `yaml:"maxAge,omitempty"`
+}
+
+// HeaderRulesConfig changes the headers of the service's requests and
+// responses
+type HeaderRulesConfig struct {
+	Request  []transform.HeaderRule `yaml:"request,omitempty"`
+	Response []transform.HeaderRule `yaml:"response,omitempty"`
 }
 
 // TransformationConfig holds the new template-based transformation settings
 type TransformationConfig struct {
-	Request  *transform.RequestTransform  `yaml:"request,omitempty"`
-	Response *transform.ResponseTransform `yaml:"response,omitempty"`
+	Request   *transform.RequestTransform  `yaml:"request,omitempty"`
+	Response  *transform.ResponseTransform `yaml:"response,omitempty"`
+	Templates []transform.TemplateRule     `yaml:"templates,omitempty"`
 }
 
 type CanaryConfig struct {
 	Enabled     bool     `yaml:"enabled"`
 	Targets     []string `yaml:"targets"`
-	Weight      int      `yaml:"weight"` // Percentage of traffic (0-100)
+	Weight      int      `yaml:"weight"`               // Percentage of traffic (0-100)
+	WeightFlag  string   `yaml:"weightFlag,omitempty"` // Feature flag overriding Weight per request
 	Header      string   `yaml:"header,omitempty"`
 	HeaderValue string   `yaml:"headerValue,omitempty"`
 	CookieName  string   `yaml:"cookieName,omitempty"`
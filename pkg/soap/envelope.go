@@ -0,0 +1,126 @@
+package soap
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// soapVersion holds what differs between SOAP 1.1 and 1.2 on the wire
+type soapVersion struct {
+	namespace string
+	// contentType returns the request content type, which carries the
+	// action in SOAP 1.2
+	contentType func(action string) string
+	// actionHeader is the SOAPAction header of SOAP 1.1
+	actionHeader func(action string) string
+}
+
+var versions = map[string]soapVersion{
+	"1.1": {
+		namespace:    "http://schemas.xmlsoap.org/soap/envelope/",
+		contentType:  func(string) string { return "text/xml; charset=utf-8" },
+		actionHeader: func(action string) string { return `"` + action + `"` },
+	},
+	"1.2": {
+		namespace: "http://www.w3.org/2003/05/soap-envelope",
+		contentType: func(action string) string {
+			if action == "" {
+				return "application/soap+xml; charset=utf-8"
+			}
+			return `application/soap+xml; charset=utf-8; action="` + action + `"`
+		},
+		actionHeader: func(string) string { return "" },
+	},
+}
+
+// envelope wraps a rendered header and body
+func (v soapVersion) envelope(header, body string) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<soap:Envelope xmlns:soap="` + v.namespace + `">`)
+	if header != "" {
+		b.WriteString("<soap:Header>" + header + "</soap:Header>")
+	}
+	b.WriteString("<soap:Body>" + body + "</soap:Body>")
+	b.WriteString("</soap:Envelope>")
+	return []byte(b.String())
+}
+
+var errNotEnvelope = errors.New("response is not a SOAP envelope")
+
+// bodyContent returns the element inside the Body of an envelope, or nil
+// for an empty body
+func bodyContent(envelope *node) (*node, error) {
+	if envelope.name.Local != "Envelope" {
+		return nil, errNotEnvelope
+	}
+	body := envelope.child("Body")
+	if body == nil {
+		return nil, errNotEnvelope
+	}
+	if len(body.children) == 0 {
+		return nil, nil
+	}
+	return body.children[0], nil
+}
+
+// fault is a SOAP fault as returned to clients
+type fault struct {
+	Error  string      `json:"error"`
+	Code   string      `json:"faultCode"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// parseFault reads a SOAP 1.1 or 1.2 Fault element and picks the status
+// returned to the client: faults blamed on the sender are the client's
+// request being refused, anything else is the service failing.
+func parseFault(n *node, arrays map[string]bool) (int, *fault) {
+	f := &fault{}
+	var detail *node
+
+	if code := n.child("Code"); code != nil {
+		// SOAP 1.2
+		if value := code.child("Value"); value != nil {
+			f.Code = localName(value.text)
+		}
+		if reason := n.child("Reason"); reason != nil {
+			if text := reason.child("Text"); text != nil {
+				f.Error = strings.TrimSpace(text.text)
+			}
+		}
+		detail = n.child("Detail")
+	} else {
+		if code := n.child("faultcode"); code != nil {
+			f.Code = localName(code.text)
+		}
+		if message := n.child("faultstring"); message != nil {
+			f.Error = strings.TrimSpace(message.text)
+		}
+		detail = n.child("detail")
+	}
+
+	if f.Error == "" {
+		f.Error = "SOAP fault"
+	}
+	if detail != nil && len(detail.children) > 0 {
+		f.Detail = detail.toJSON(arrays)
+	}
+
+	status := http.StatusBadGateway
+	// Subcodes are dot-separated in SOAP 1.1, e.g. Client.Authentication
+	switch class, _, _ := strings.Cut(f.Code, "."); class {
+	case "Client", "Sender":
+		status = http.StatusBadRequest
+	}
+	return status, f
+}
+
+// localName strips the namespace prefix from a qualified name
+func localName(qname string) string {
+	qname = strings.TrimSpace(qname)
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
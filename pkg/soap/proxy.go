@@ -0,0 +1,315 @@
+// Package soap puts a JSON API in front of SOAP services. Each configured
+// operation renders a SOAP envelope from the client's JSON request with a
+// template, optionally validates it against XSDs, and converts the response,
+// or the SOAP fault, back to JSON.
+package soap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"odin/pkg/bufpool"
+	"odin/pkg/config"
+	"odin/pkg/health"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// noValue is what templates print for missing keys and JSON nulls. Request
+// data is escaped before rendering, so it only ever comes from templates.
+const noValue = "<no value>"
+
+var funcs = template.FuncMap{
+	"toXML": toXML,
+	"default": func(defaultVal, val interface{}) interface{} {
+		if val == nil || val == "" {
+			return defaultVal
+		}
+		return val
+	},
+}
+
+// Proxy serves the operations of one SOAP service
+type Proxy struct {
+	name       string
+	targets    []string
+	next       atomic.Uint64
+	config     config.SOAPConfig
+	version    soapVersion
+	header     *template.Template
+	operations []*operation
+	schema     *Schema
+	client     *http.Client
+	logger     *logrus.Logger
+
+	checker     *health.TargetChecker
+	maintenance *health.Maintenance
+}
+
+// operation is a configured operation with its templates parsed
+type operation struct {
+	config.SOAPOperation
+	request  *template.Template
+	response []string
+	arrays   map[string]bool
+}
+
+// NewProxy parses the templates and loads the schemas of a service
+func NewProxy(name string, targets []string, cfg config.SOAPConfig, logger *logrus.Logger) (*Proxy, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("service %s has no targets", name)
+	}
+	version, ok := versions[cfg.Version]
+	if !ok {
+		version = versions["1.1"]
+	}
+	if cfg.MaxResponseSize == 0 {
+		cfg.MaxResponseSize = 10 << 20
+	}
+
+	p := &Proxy{
+		name:    name,
+		targets: targets,
+		config:  cfg,
+		version: version,
+		client:  http.DefaultClient,
+		logger:  logger,
+	}
+
+	var err error
+	if cfg.Header != "" {
+		if p.header, err = parseTemplate("header", cfg.Header); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Schemas) > 0 {
+		if p.schema, err = LoadSchema(cfg.Schemas); err != nil {
+			return nil, fmt.Errorf("failed to load schemas: %w", err)
+		}
+	}
+
+	for _, opConfig := range cfg.Operations {
+		op := &operation{SOAPOperation: opConfig, arrays: make(map[string]bool)}
+		if op.Method == "" {
+			op.Method = http.MethodPost
+		}
+		if op.Path == "" {
+			op.Path = "/" + op.Name
+		}
+		if op.request, err = parseTemplate(op.Name, op.Request); err != nil {
+			return nil, err
+		}
+		if op.Response != "" {
+			op.response = strings.Split(strings.Trim(op.Response, "/"), "/")
+		}
+		for _, name := range op.Arrays {
+			op.arrays[name] = true
+		}
+		p.operations = append(p.operations, op)
+	}
+	return p, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("operation %s: failed to parse template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// SetClient sets the client requests are sent with, which carries the
+// service's timeout and upstream connection settings
+func (p *Proxy) SetClient(client *http.Client) {
+	p.client = client
+}
+
+// SetMaintenance stops sending requests to the targets disabled in m
+func (p *Proxy) SetMaintenance(m *health.Maintenance) {
+	p.maintenance = m
+}
+
+// SetHealthChecker stops sending requests to the targets checker finds
+// unhealthy, unless all are
+func (p *Proxy) SetHealthChecker(checker *health.TargetChecker) {
+	p.checker = checker
+}
+
+// RegisterRoutes registers a route per operation on the service's group
+func (p *Proxy) RegisterRoutes(g *echo.Group) {
+	for _, op := range p.operations {
+		g.Add(strings.ToUpper(op.Method), op.Path, p.handler(op))
+	}
+}
+
+// target returns the next available target in turn, or "" when all are
+// disabled
+func (p *Proxy) target() string {
+	targets := health.AvailableTargets(p.targets, p.checker, p.maintenance)
+	if len(targets) == 0 {
+		return ""
+	}
+	return targets[(p.next.Add(1)-1)%uint64(len(targets))]
+}
+
+func (p *Proxy) handler(op *operation) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data, err := templateData(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON request body"})
+		}
+
+		log := p.logger.WithFields(logrus.Fields{"service": p.name, "operation": op.Name})
+
+		body, err := render(op.request, data)
+		if err != nil {
+			log.WithError(err).Error("Failed to render SOAP request")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to render SOAP request"})
+		}
+		var header string
+		if p.header != nil {
+			if header, err = render(p.header, data); err != nil {
+				log.WithError(err).Error("Failed to render SOAP header")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to render SOAP request"})
+			}
+		}
+
+		if p.schema != nil {
+			elements, err := parseFragment(body)
+			if err != nil {
+				log.WithError(err).Error("Rendered SOAP body is not well-formed XML")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to render SOAP request"})
+			}
+			if errs := p.schema.Validate(elements); len(errs) > 0 {
+				return c.JSON(http.StatusBadRequest, map[string]interface{}{
+					"error":   "Request validation failed",
+					"details": errs,
+				})
+			}
+		}
+
+		target := p.target()
+		if target == "" {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "No available targets")
+		}
+		req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodPost, target, bytes.NewReader(p.version.envelope(header, body)))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create proxy request")
+		}
+		req.Header.Set("Content-Type", p.version.contentType(op.Action))
+		if action := p.version.actionHeader(op.Action); action != "" {
+			req.Header.Set("SOAPAction", action)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			log.WithError(err).Warn("SOAP request failed")
+			return echo.NewHTTPError(http.StatusBadGateway, "Service unavailable")
+		}
+		defer resp.Body.Close()
+
+		buf, err := bufpool.ReadAll(io.LimitReader(resp.Body, p.config.MaxResponseSize+1))
+		defer bufpool.Put(buf)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to read response body")
+		}
+		if int64(buf.Len()) > p.config.MaxResponseSize {
+			log.Warn("SOAP response exceeds maxResponseSize")
+			return echo.NewHTTPError(http.StatusBadGateway, "SOAP response too large")
+		}
+
+		envelope, err := parseXML(buf)
+		var content *node
+		if err == nil {
+			content, err = bodyContent(envelope)
+		}
+		if err != nil {
+			log.WithError(err).WithField("status", resp.StatusCode).Warn("Invalid SOAP response")
+			return echo.NewHTTPError(http.StatusBadGateway, "Invalid SOAP response")
+		}
+
+		if content != nil && content.name.Local == "Fault" {
+			status, f := parseFault(content, op.arrays)
+			log.WithFields(logrus.Fields{"fault_code": f.Code, "fault": f.Error}).Debug("SOAP fault")
+			return c.JSON(status, f)
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			log.WithField("status", resp.StatusCode).Warn("SOAP service returned an error without a fault")
+			return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("SOAP service returned %d", resp.StatusCode))
+		}
+		if content == nil {
+			return c.NoContent(http.StatusNoContent)
+		}
+
+		if p.schema != nil && p.config.ValidateResponses {
+			if errs := p.schema.Validate([]*node{content}); len(errs) > 0 {
+				log.WithField("errors", errs).Warn("SOAP response does not match the schema")
+				return c.JSON(http.StatusBadGateway, map[string]interface{}{
+					"error":   "Response validation failed",
+					"details": errs,
+				})
+			}
+		}
+
+		for _, name := range op.response {
+			if content = content.child(name); content == nil {
+				log.WithField("response", op.Response).Warn("SOAP response lacks the configured element")
+				return echo.NewHTTPError(http.StatusBadGateway, "Invalid SOAP response")
+			}
+		}
+		return c.JSON(http.StatusOK, content.toJSON(op.arrays))
+	}
+}
+
+// templateData is what templates render: the JSON body, path parameters,
+// query parameters and headers of the request, escaped for XML
+func templateData(c echo.Context) (map[string]interface{}, error) {
+	var body interface{}
+	if c.Request().Body != nil {
+		decoder := json.NewDecoder(c.Request().Body)
+		// Keep numbers as written, e.g. large IDs, instead of as floats
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+
+	params := make(map[string]interface{})
+	for _, name := range c.ParamNames() {
+		params[name] = c.Param(name)
+	}
+	query := make(map[string]interface{})
+	for name, values := range c.QueryParams() {
+		query[name] = values[0]
+	}
+	headers := make(map[string]interface{})
+	for name, values := range c.Request().Header {
+		headers[name] = values[0]
+	}
+
+	return map[string]interface{}{
+		"body":    escape(body),
+		"params":  escape(params),
+		"query":   escape(query),
+		"headers": escape(headers),
+	}, nil
+}
+
+// render executes a template. Missing values render as nothing rather than
+// as text that would break the XML.
+func render(tmpl *template.Template, data interface{}) (string, error) {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(buf.String(), noValue, ""), nil
+}
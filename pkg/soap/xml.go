@@ -0,0 +1,244 @@
+package soap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// xsiNamespace holds the nil and type attributes of instance documents
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// maxDepth bounds the nesting of parsed documents
+const maxDepth = 100
+
+// node is an XML element with its attributes, child elements and the text
+// directly inside it
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+// parseXML reads a document into a tree of elements
+func parseXML(r io.Reader) (*node, error) {
+	d := xml.NewDecoder(r)
+	var stack []*node
+	var root *node
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("more than one root element")
+			}
+			if len(stack) == maxDepth {
+				return nil, errors.New("document is nested too deeply")
+			}
+			n := &node{name: t.Name, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+	return root, nil
+}
+
+// parseFragment parses a sequence of elements, such as a rendered SOAP body
+func parseFragment(fragment string) ([]*node, error) {
+	root, err := parseXML(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	if err != nil {
+		return nil, err
+	}
+	return root.children, nil
+}
+
+// attr returns the value of the attribute with the given local name
+func (n *node) attr(local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Local == local && a.Name.Space != "xmlns" {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// child returns the first child element with the given local name
+func (n *node) child(local string) *node {
+	for _, c := range n.children {
+		if c.name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// isNil reports whether the element is marked xsi:nil
+func (n *node) isNil() bool {
+	for _, a := range n.attrs {
+		if a.Name.Space == xsiNamespace && a.Name.Local == "nil" {
+			return a.Value == "true" || a.Value == "1"
+		}
+	}
+	return false
+}
+
+// toJSON converts an element to a JSON value. Elements with only text become
+// strings and xsi:nil elements null. Others become objects of their child
+// elements by local name, with repeated elements, and those named in arrays,
+// as arrays. Attributes are kept as "@name" and text next to child elements
+// as "#text". Namespace declarations are dropped.
+func (n *node) toJSON(arrays map[string]bool) interface{} {
+	if n.isNil() {
+		return nil
+	}
+
+	var attrs []xml.Attr
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Name.Space == xsiNamespace {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	if len(n.children) == 0 && len(attrs) == 0 {
+		return n.text
+	}
+
+	counts := make(map[string]int, len(n.children))
+	for _, c := range n.children {
+		counts[c.name.Local]++
+	}
+
+	obj := make(map[string]interface{}, len(counts)+len(attrs))
+	for _, a := range attrs {
+		obj["@"+a.Name.Local] = a.Value
+	}
+	for _, c := range n.children {
+		key := c.name.Local
+		value := c.toJSON(arrays)
+		if counts[key] > 1 || arrays[key] {
+			list, _ := obj[key].([]interface{})
+			obj[key] = append(list, value)
+		} else {
+			obj[key] = value
+		}
+	}
+	if text := strings.TrimSpace(n.text); text != "" {
+		obj["#text"] = text
+	}
+	return obj
+}
+
+// escape returns a copy of a decoded JSON value with its strings and object
+// keys escaped for XML, so templates cannot be broken by request data
+func escape(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return escapeString(v)
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			escaped[escapeString(key)] = escape(value)
+		}
+		return escaped
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		for i, value := range v {
+			escaped[i] = escape(value)
+		}
+		return escaped
+	default:
+		return v
+	}
+}
+
+func escapeString(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+// toXML renders an escaped JSON value as elements: object keys become
+// element names, in sorted order, and arrays repeat the element. A scalar is
+// rendered as text.
+func toXML(v interface{}) (string, error) {
+	var b strings.Builder
+	if err := writeXML(&b, "", v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writeXML(b *strings.Builder, name string, v interface{}) error {
+	if list, ok := v.([]interface{}); ok && name != "" {
+		for _, item := range list {
+			if err := writeXML(b, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if name != "" {
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf("%q is not a valid element name", name)
+		}
+		b.WriteString("<" + name + ">")
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXML(b, key, v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXML(b, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	case json.Number:
+		b.WriteString(v.String())
+	default:
+		fmt.Fprint(b, v)
+	}
+	if name != "" {
+		b.WriteString("</" + name + ">")
+	}
+	return nil
+}
@@ -0,0 +1,874 @@
+package soap
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// unbounded is the maximum occurrence of maxOccurs="unbounded"
+const unbounded = -1
+
+// Schema validates elements against the declarations of XSD files. It
+// supports the parts of XML Schema SOAP services commonly use: global and
+// local elements, named and anonymous complex types with sequence, choice
+// and all groups, complex and simple content extensions, attributes, simple
+// type restrictions with enumeration, pattern, length and range facets, and
+// the built-in types. Names are resolved by their local part across all
+// loaded files, so imports and includes need no special handling.
+type Schema struct {
+	elements map[string]*elementDecl
+	types    map[string]*xsdType
+}
+
+type elementDecl struct {
+	name     string
+	typ      *xsdType
+	nillable bool
+}
+
+type attributeDecl struct {
+	name     string
+	typ      *xsdType
+	required bool
+}
+
+// particle is an element, a group of particles or a wildcard, with how often
+// it may occur
+type particle struct {
+	kind     string // element, sequence, choice, all or any
+	element  *elementDecl
+	items    []*particle
+	min, max int
+}
+
+// xsdType is a simple or complex type. Simple types are a built-in type or a
+// restriction of another simple type.
+type xsdType struct {
+	name string
+
+	// Simple types
+	builtin  string
+	base     *xsdType
+	enum     []string
+	patterns []*regexp.Regexp
+	length   *int
+	minLen   *int
+	maxLen   *int
+	minIncl  *float64
+	maxIncl  *float64
+	minExcl  *float64
+	maxExcl  *float64
+
+	// Complex types
+	complex    bool
+	content    *particle
+	attributes []*attributeDecl
+	text       *xsdType // simple content
+	mixed      bool
+}
+
+// LoadSchema reads and compiles XSD files
+func LoadSchema(files []string) (*Schema, error) {
+	var roots []*node
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		root, err := parseXML(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if root.name.Local != "schema" {
+			return nil, fmt.Errorf("%s: not an XML schema", file)
+		}
+		roots = append(roots, root)
+	}
+	return compileSchema(roots)
+}
+
+// States of named types during compilation
+const (
+	compiling = iota + 1
+	compiled
+)
+
+// schemaCompiler turns schema documents into declarations. Named types and
+// global elements are created before they are compiled, so declarations can
+// refer to ones defined later and to themselves.
+type schemaCompiler struct {
+	schema   *Schema
+	defs     map[string]*node
+	elements map[string]*node
+	state    map[string]int
+}
+
+func compileSchema(roots []*node) (*Schema, error) {
+	c := &schemaCompiler{
+		schema:   &Schema{elements: make(map[string]*elementDecl), types: make(map[string]*xsdType)},
+		defs:     make(map[string]*node),
+		elements: make(map[string]*node),
+		state:    make(map[string]int),
+	}
+	for _, root := range roots {
+		for _, n := range root.children {
+			name, _ := n.attr("name")
+			switch n.name.Local {
+			case "complexType", "simpleType":
+				c.defs[name] = n
+				c.schema.types[name] = &xsdType{name: name}
+			case "element":
+				c.elements[name] = n
+			}
+		}
+	}
+
+	for name := range c.defs {
+		if err := c.complete(c.schema.types[name]); err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+	}
+	for name := range c.elements {
+		if _, err := c.global(name); err != nil {
+			return nil, fmt.Errorf("element %s: %w", name, err)
+		}
+	}
+	return c.schema, nil
+}
+
+// complete compiles a named type unless it already is. Types are completed
+// before they are derived from, so a base's content can be inherited.
+func (c *schemaCompiler) complete(t *xsdType) error {
+	n, ok := c.defs[t.name]
+	if !ok || t.builtin != "" {
+		return nil
+	}
+	switch c.state[t.name] {
+	case compiled:
+		return nil
+	case compiling:
+		return fmt.Errorf("type %s derives from itself", t.name)
+	}
+	c.state[t.name] = compiling
+	if err := c.defineType(t, n); err != nil {
+		return err
+	}
+	c.state[t.name] = compiled
+	return nil
+}
+
+// lookup resolves a type reference by local name, preferring the schema's
+// own types over built-in ones
+func (c *schemaCompiler) lookup(ref string) (*xsdType, error) {
+	local := ref
+	if i := strings.IndexByte(ref, ':'); i >= 0 {
+		local = ref[i+1:]
+	}
+	if t, ok := c.schema.types[local]; ok {
+		return t, nil
+	}
+	if builtinTypes[local] {
+		return &xsdType{name: local, builtin: local}, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", ref)
+}
+
+func (c *schemaCompiler) defineType(t *xsdType, n *node) error {
+	if n.name.Local == "simpleType" {
+		return c.defineSimple(t, n)
+	}
+	return c.defineComplex(t, n)
+}
+
+func (c *schemaCompiler) anonymous(n *node) (*xsdType, error) {
+	t := &xsdType{}
+	return t, c.defineType(t, n)
+}
+
+// defineSimple compiles a restriction. Lists and unions accept any text.
+func (c *schemaCompiler) defineSimple(t *xsdType, n *node) error {
+	restriction := n.child("restriction")
+	if restriction == nil {
+		t.builtin = "string"
+		return nil
+	}
+	base, err := c.restrictionBase(restriction)
+	if err != nil {
+		return err
+	}
+	t.base = base
+	return c.facets(t, restriction)
+}
+
+// restrictionBase returns the base named by a restriction or extension, or
+// defined inside it
+func (c *schemaCompiler) restrictionBase(restriction *node) (*xsdType, error) {
+	if ref, ok := restriction.attr("base"); ok {
+		base, err := c.lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		return base, c.complete(base)
+	}
+	if inner := restriction.child("simpleType"); inner != nil {
+		return c.anonymous(inner)
+	}
+	return nil, fmt.Errorf("restriction without a base")
+}
+
+func (c *schemaCompiler) facets(t *xsdType, restriction *node) error {
+	for _, f := range restriction.children {
+		value, _ := f.attr("value")
+		switch f.name.Local {
+		case "enumeration":
+			t.enum = append(t.enum, value)
+		case "pattern":
+			// XSD patterns match the whole value
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return fmt.Errorf("pattern %q: %w", value, err)
+			}
+			t.patterns = append(t.patterns, re)
+		case "length", "minLength", "maxLength":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s %q: %w", f.name.Local, value, err)
+			}
+			switch f.name.Local {
+			case "length":
+				t.length = &n
+			case "minLength":
+				t.minLen = &n
+			default:
+				t.maxLen = &n
+			}
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s %q: %w", f.name.Local, value, err)
+			}
+			switch f.name.Local {
+			case "minInclusive":
+				t.minIncl = &v
+			case "maxInclusive":
+				t.maxIncl = &v
+			case "minExclusive":
+				t.minExcl = &v
+			default:
+				t.maxExcl = &v
+			}
+		}
+	}
+	return nil
+}
+
+func (c *schemaCompiler) defineComplex(t *xsdType, n *node) error {
+	t.complex = true
+	t.mixed = isTrue(n, "mixed")
+
+	if content := n.child("simpleContent"); content != nil {
+		derivation := content.child("extension")
+		if derivation == nil {
+			derivation = content.child("restriction")
+		}
+		if derivation == nil {
+			return fmt.Errorf("simpleContent without extension or restriction")
+		}
+		base, err := c.restrictionBase(derivation)
+		if err != nil {
+			return err
+		}
+		// Deriving from a complex type with simple content derives its text
+		if base.complex {
+			t.attributes = append(t.attributes, base.attributes...)
+			base = base.text
+		}
+		t.text = base
+		if derivation.name.Local == "restriction" {
+			t.text = &xsdType{base: base}
+			if err := c.facets(t.text, derivation); err != nil {
+				return err
+			}
+		}
+		return c.attributes(t, derivation)
+	}
+
+	body := n
+	var inherited *particle
+	if content := n.child("complexContent"); content != nil {
+		t.mixed = t.mixed || isTrue(content, "mixed")
+		extension := content.child("extension")
+		if extension == nil {
+			// A restriction repeats the content it keeps
+			body = content.child("restriction")
+			if body == nil {
+				return fmt.Errorf("complexContent without extension or restriction")
+			}
+		} else {
+			body = extension
+			base, err := c.restrictionBase(extension)
+			if err != nil {
+				return err
+			}
+			inherited = base.content
+			t.attributes = append(t.attributes, base.attributes...)
+		}
+	}
+
+	own, err := c.group(body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case inherited != nil && own != nil:
+		t.content = &particle{kind: "sequence", items: []*particle{inherited, own}, min: 1, max: 1}
+	case inherited != nil:
+		t.content = inherited
+	default:
+		t.content = own
+	}
+	return c.attributes(t, body)
+}
+
+// group compiles the sequence, choice or all group of a type, if any
+func (c *schemaCompiler) group(n *node) (*particle, error) {
+	for _, child := range n.children {
+		switch child.name.Local {
+		case "sequence", "choice", "all":
+			return c.particle(child)
+		}
+	}
+	return nil, nil
+}
+
+func (c *schemaCompiler) particle(n *node) (*particle, error) {
+	min, max, err := occurs(n)
+	if err != nil {
+		return nil, err
+	}
+	p := &particle{kind: n.name.Local, min: min, max: max}
+
+	switch n.name.Local {
+	case "element":
+		if p.element, err = c.element(n); err != nil {
+			return nil, err
+		}
+	case "any":
+	case "sequence", "choice", "all":
+		for _, child := range n.children {
+			switch child.name.Local {
+			case "element", "sequence", "choice", "any":
+				item, err := c.particle(child)
+				if err != nil {
+					return nil, err
+				}
+				p.items = append(p.items, item)
+			}
+		}
+	}
+	return p, nil
+}
+
+// element compiles a local element declaration or a reference to a global one
+func (c *schemaCompiler) element(n *node) (*elementDecl, error) {
+	if ref, ok := n.attr("ref"); ok {
+		return c.global(ref[strings.IndexByte(ref, ':')+1:])
+	}
+	name, _ := n.attr("name")
+	decl := &elementDecl{name: name}
+	return decl, c.declare(decl, n)
+}
+
+// global returns a global element, compiling it on first use
+func (c *schemaCompiler) global(name string) (*elementDecl, error) {
+	if decl, ok := c.schema.elements[name]; ok {
+		return decl, nil
+	}
+	n, ok := c.elements[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown element %s", name)
+	}
+	decl := &elementDecl{name: name}
+	c.schema.elements[name] = decl
+	return decl, c.declare(decl, n)
+}
+
+// declare compiles the type of an element declaration
+func (c *schemaCompiler) declare(decl *elementDecl, n *node) error {
+	decl.nillable = isTrue(n, "nillable")
+
+	var err error
+	if ref, ok := n.attr("type"); ok {
+		decl.typ, err = c.lookup(ref)
+	} else if inner := n.child("complexType"); inner != nil {
+		decl.typ, err = c.anonymous(inner)
+	} else if inner := n.child("simpleType"); inner != nil {
+		decl.typ, err = c.anonymous(inner)
+	} else {
+		decl.typ = &xsdType{builtin: "anyType"}
+	}
+	if err != nil {
+		return fmt.Errorf("element %s: %w", decl.name, err)
+	}
+	return nil
+}
+
+func (c *schemaCompiler) attributes(t *xsdType, n *node) error {
+	for _, a := range n.children {
+		if a.name.Local != "attribute" {
+			continue
+		}
+		name, _ := a.attr("name")
+		if name == "" {
+			// References to global attributes are not checked
+			continue
+		}
+		use, _ := a.attr("use")
+		decl := &attributeDecl{name: name, required: use == "required"}
+		var err error
+		if ref, ok := a.attr("type"); ok {
+			decl.typ, err = c.lookup(ref)
+		} else if inner := a.child("simpleType"); inner != nil {
+			decl.typ, err = c.anonymous(inner)
+		} else {
+			decl.typ = &xsdType{builtin: "string"}
+		}
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", name, err)
+		}
+		t.attributes = append(t.attributes, decl)
+	}
+	return nil
+}
+
+func occurs(n *node) (int, int, error) {
+	min, max := 1, 1
+	if v, ok := n.attr("minOccurs"); ok {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid minOccurs %q", v)
+		}
+		min = i
+	}
+	if v, ok := n.attr("maxOccurs"); ok {
+		if v == "unbounded" {
+			max = unbounded
+		} else {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid maxOccurs %q", v)
+			}
+			max = i
+		}
+	}
+	return min, max, nil
+}
+
+func isTrue(n *node, attr string) bool {
+	v, _ := n.attr(attr)
+	return v == "true" || v == "1"
+}
+
+// Validate checks elements against their global declarations and returns
+// what is wrong with them
+func (s *Schema) Validate(elements []*node) []string {
+	v := &validation{}
+	for _, n := range elements {
+		decl, ok := s.elements[n.name.Local]
+		if !ok {
+			v.errorf("/"+n.name.Local, "element is not declared in the schema")
+			continue
+		}
+		v.element(decl, n, "/"+n.name.Local)
+	}
+	return v.errors
+}
+
+// validation collects the errors found in a document
+type validation struct {
+	errors []string
+}
+
+// maxErrors bounds the errors reported for one document
+const maxErrors = 20
+
+func (v *validation) errorf(path, format string, args ...interface{}) {
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validation) element(decl *elementDecl, n *node, path string) {
+	if n.isNil() {
+		if !decl.nillable {
+			v.errorf(path, "element is not nillable")
+		} else if len(n.children) > 0 || strings.TrimSpace(n.text) != "" {
+			v.errorf(path, "nil element must be empty")
+		}
+		return
+	}
+
+	t := decl.typ
+	if !t.complex {
+		if t.builtin == "anyType" {
+			return
+		}
+		if len(n.children) > 0 {
+			v.errorf(path, "element cannot contain elements")
+			return
+		}
+		if err := t.check(n.text); err != nil {
+			v.errorf(path, "%v", err)
+		}
+		return
+	}
+
+	v.attributes(t, n, path)
+
+	if t.text != nil {
+		if len(n.children) > 0 {
+			v.errorf(path, "element cannot contain elements")
+		} else if err := t.text.check(n.text); err != nil {
+			v.errorf(path, "%v", err)
+		}
+		return
+	}
+	if !t.mixed && strings.TrimSpace(n.text) != "" {
+		v.errorf(path, "element cannot contain text")
+	}
+
+	if t.content == nil {
+		if len(n.children) > 0 {
+			v.errorf(path, "element must be empty")
+		}
+		return
+	}
+	m := &matcher{v: v, children: n.children, path: path}
+	i, ok := m.particle(t.content, 0)
+	switch {
+	case ok && i == len(n.children):
+	case m.furthest < len(n.children):
+		child := n.children[m.furthest]
+		if m.expected != "" {
+			v.errorf(path, "unexpected element %s, expected %s", child.name.Local, m.expected)
+		} else {
+			v.errorf(path, "unexpected element %s", child.name.Local)
+		}
+	default:
+		v.errorf(path, "missing element %s", m.expected)
+	}
+}
+
+func (v *validation) attributes(t *xsdType, n *node, path string) {
+	for _, decl := range t.attributes {
+		value, ok := n.attr(decl.name)
+		if !ok {
+			if decl.required {
+				v.errorf(path, "missing attribute %s", decl.name)
+			}
+			continue
+		}
+		if err := decl.typ.check(value); err != nil {
+			v.errorf(path+"/@"+decl.name, "%v", err)
+		}
+	}
+}
+
+// matcher matches child elements against a content model. Models are
+// matched greedily, which is exact for the deterministic models XML Schema
+// requires.
+type matcher struct {
+	v        *validation
+	children []*node
+	path     string
+
+	// The furthest child no particle matched and what was expected there
+	furthest int
+	expected string
+}
+
+// particle matches p as often as it may occur from child i and returns the
+// position after it
+func (m *matcher) particle(p *particle, i int) (int, bool) {
+	count := 0
+	for p.max == unbounded || count < p.max {
+		next, ok := m.once(p, i)
+		if !ok {
+			break
+		}
+		if next == i {
+			// An empty match, e.g. of a group of optional elements, would
+			// match any remaining occurrences too
+			return i, true
+		}
+		i = next
+		count++
+	}
+	return i, count >= p.min
+}
+
+// childPath is the path of the i-th child, indexed XPath-style when it has
+// siblings of the same name
+func (m *matcher) childPath(i int) string {
+	name := m.children[i].name.Local
+	index, count := 0, 0
+	for j, c := range m.children {
+		if c.name.Local == name {
+			count++
+			if j <= i {
+				index++
+			}
+		}
+	}
+	if count == 1 {
+		return m.path + "/" + name
+	}
+	return fmt.Sprintf("%s/%s[%d]", m.path, name, index)
+}
+
+func (m *matcher) once(p *particle, i int) (int, bool) {
+	switch p.kind {
+	case "element":
+		if i < len(m.children) && m.children[i].name.Local == p.element.name {
+			child := m.children[i]
+			m.v.element(p.element, child, m.childPath(i))
+			return i + 1, true
+		}
+		m.miss(i, p.element.name)
+		return i, false
+	case "any":
+		return i + 1, i < len(m.children)
+	case "sequence":
+		for _, item := range p.items {
+			next, ok := m.particle(item, i)
+			if !ok {
+				return i, false
+			}
+			i = next
+		}
+		return i, true
+	case "choice":
+		optional := false
+		for _, item := range p.items {
+			next, ok := m.particle(item, i)
+			if ok && next > i {
+				return next, true
+			}
+			optional = optional || ok
+		}
+		return i, optional
+	case "all":
+		seen := make([]bool, len(p.items))
+	loop:
+		for i < len(m.children) {
+			for j, item := range p.items {
+				if !seen[j] && item.element != nil && m.children[i].name.Local == item.element.name {
+					seen[j] = true
+					i, _ = m.particle(item, i)
+					continue loop
+				}
+			}
+			break
+		}
+		for j, item := range p.items {
+			if !seen[j] && item.min > 0 && item.element != nil {
+				m.miss(i, item.element.name)
+				return i, false
+			}
+		}
+		return i, true
+	}
+	return i, false
+}
+
+func (m *matcher) miss(i int, expected string) {
+	if i >= m.furthest {
+		if i > m.furthest {
+			m.expected = ""
+		}
+		m.furthest = i
+		if m.expected == "" {
+			m.expected = expected
+		} else if !strings.Contains(m.expected, expected) {
+			m.expected += " or " + expected
+		}
+	}
+}
+
+// builtinTypes are the XML Schema types checked by check; other built-in
+// types accept any text
+var builtinTypes = map[string]bool{
+	"anyType": true, "anySimpleType": true, "string": true, "normalizedString": true, "token": true,
+	"language": true, "Name": true, "NCName": true, "NMTOKEN": true, "NMTOKENS": true, "ID": true,
+	"IDREF": true, "IDREFS": true, "ENTITY": true, "ENTITIES": true, "QName": true, "NOTATION": true,
+	"anyURI": true, "boolean": true, "decimal": true, "float": true, "double": true, "integer": true,
+	"nonPositiveInteger": true, "negativeInteger": true, "long": true, "int": true, "short": true,
+	"byte": true, "nonNegativeInteger": true, "unsignedLong": true, "unsignedInt": true,
+	"unsignedShort": true, "unsignedByte": true, "positiveInteger": true, "date": true, "dateTime": true,
+	"time": true, "duration": true, "gYear": true, "gYearMonth": true, "gMonth": true, "gMonthDay": true,
+	"gDay": true, "base64Binary": true, "hexBinary": true,
+}
+
+var (
+	integerPattern = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	timezone       = `(Z|[+-][0-9]{2}:[0-9]{2})?$`
+	datePattern    = regexp.MustCompile(`^-?[0-9]{4,}-[0-9]{2}-[0-9]{2}` + timezone)
+	timePattern    = regexp.MustCompile(`^[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?` + timezone)
+)
+
+// integer ranges of the bounded built-in integer types
+var integerBits = map[string]struct {
+	bits     int
+	unsigned bool
+}{
+	"long": {64, false}, "int": {32, false}, "short": {16, false}, "byte": {8, false},
+	"unsignedLong": {64, true}, "unsignedInt": {32, true}, "unsignedShort": {16, true}, "unsignedByte": {8, true},
+}
+
+// check validates a value against a simple type and its bases
+func (t *xsdType) check(raw string) error {
+	value := raw
+	if t.builtin != "" {
+		if t.builtin != "string" && t.builtin != "anyType" && t.builtin != "anySimpleType" {
+			value = strings.TrimSpace(raw)
+		}
+		return checkBuiltin(t.builtin, value)
+	}
+	if t.base != nil {
+		if err := t.base.check(raw); err != nil {
+			return err
+		}
+		if t.base.whitespaceCollapsed() {
+			value = strings.TrimSpace(raw)
+		}
+	}
+
+	if len(t.enum) > 0 {
+		found := false
+		for _, e := range t.enum {
+			if value == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(t.enum, ", "))
+		}
+	}
+	for _, re := range t.patterns {
+		if !re.MatchString(value) {
+			return fmt.Errorf("%q does not match pattern %s", value, re.String()[4:len(re.String())-2])
+		}
+	}
+
+	length := utf8.RuneCountInString(value)
+	if t.length != nil && length != *t.length {
+		return fmt.Errorf("length must be %d", *t.length)
+	}
+	if t.minLen != nil && length < *t.minLen {
+		return fmt.Errorf("length must be at least %d", *t.minLen)
+	}
+	if t.maxLen != nil && length > *t.maxLen {
+		return fmt.Errorf("length must be at most %d", *t.maxLen)
+	}
+
+	if t.minIncl != nil || t.maxIncl != nil || t.minExcl != nil || t.maxExcl != nil {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		switch {
+		case t.minIncl != nil && n < *t.minIncl:
+			return fmt.Errorf("%s must be at least %v", value, *t.minIncl)
+		case t.maxIncl != nil && n > *t.maxIncl:
+			return fmt.Errorf("%s must be at most %v", value, *t.maxIncl)
+		case t.minExcl != nil && n <= *t.minExcl:
+			return fmt.Errorf("%s must be greater than %v", value, *t.minExcl)
+		case t.maxExcl != nil && n >= *t.maxExcl:
+			return fmt.Errorf("%s must be less than %v", value, *t.maxExcl)
+		}
+	}
+	return nil
+}
+
+// whitespaceCollapsed reports whether values of the type are compared
+// without surrounding whitespace
+func (t *xsdType) whitespaceCollapsed() bool {
+	for ; t != nil; t = t.base {
+		if t.builtin != "" {
+			return t.builtin != "string" && t.builtin != "anyType" && t.builtin != "anySimpleType"
+		}
+	}
+	return false
+}
+
+func checkBuiltin(builtin, value string) error {
+	valid := true
+	switch builtin {
+	case "boolean":
+		valid = value == "true" || value == "false" || value == "1" || value == "0"
+	case "decimal":
+		valid = decimalPattern.MatchString(value)
+	case "float", "double":
+		_, err := strconv.ParseFloat(value, 64)
+		valid = err == nil || value == "INF" || value == "-INF" || value == "NaN"
+	case "integer":
+		valid = integerPattern.MatchString(value)
+	case "nonNegativeInteger", "positiveInteger", "nonPositiveInteger", "negativeInteger":
+		valid = integerPattern.MatchString(value)
+		if valid {
+			digits := strings.TrimLeft(strings.TrimLeft(value, "+-"), "0")
+			negative := strings.HasPrefix(value, "-") && digits != ""
+			zero := digits == ""
+			switch builtin {
+			case "nonNegativeInteger":
+				valid = !negative
+			case "positiveInteger":
+				valid = !negative && !zero
+			case "nonPositiveInteger":
+				valid = negative || zero
+			default:
+				valid = negative
+			}
+		}
+	case "long", "int", "short", "byte", "unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		r := integerBits[builtin]
+		var err error
+		if r.unsigned {
+			_, err = strconv.ParseUint(strings.TrimPrefix(value, "+"), 10, r.bits)
+		} else {
+			_, err = strconv.ParseInt(value, 10, r.bits)
+		}
+		valid = err == nil
+	case "date":
+		valid = datePattern.MatchString(value)
+		if valid {
+			_, err := time.Parse("2006-01-02", strings.TrimPrefix(value, "-")[:10])
+			valid = err == nil
+		}
+	case "dateTime":
+		date, clock, ok := strings.Cut(value, "T")
+		valid = ok && datePattern.MatchString(date) && timePattern.MatchString(clock)
+	case "time":
+		valid = timePattern.MatchString(value)
+	case "base64Binary":
+		_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		valid = err == nil
+	case "hexBinary":
+		_, err := hex.DecodeString(value)
+		valid = err == nil
+	}
+	if !valid {
+		return fmt.Errorf("%q is not a valid %s", value, builtin)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package static
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Responder answers every request of a service itself, with a fixed
+// response or a redirect, without calling any upstream
+type Responder struct {
+	basePath string
+	response *config.StaticResponseConfig
+	body     []byte
+	status   int
+	location *template.Template
+}
+
+// Request is what redirect locations are rendered from
+type Request struct {
+	Scheme  string
+	Host    string
+	Path    string
+	Subpath string // Path below the service's base path
+	Query   string // Raw query string, without the ?
+	Method  string
+}
+
+// NewResponse answers every request with cfg
+func NewResponse(cfg config.StaticResponseConfig) *Responder {
+	status := cfg.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &Responder{response: &cfg, body: []byte(cfg.Body), status: status}
+}
+
+// NewRedirect redirects every request to the location cfg renders for it
+func NewRedirect(basePath string, cfg config.RedirectConfig) (*Responder, error) {
+	location, err := template.New("location").Option("missingkey=error").Parse(cfg.Location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location: %w", err)
+	}
+	status := cfg.Status
+	if status == 0 {
+		status = http.StatusFound
+	}
+	return &Responder{basePath: basePath, status: status, location: location}, nil
+}
+
+// Handle answers a request
+func (r *Responder) Handle(c echo.Context) error {
+	if r.location != nil {
+		return r.redirect(c)
+	}
+
+	header := c.Response().Header()
+	for name, value := range r.response.Headers {
+		header.Set(name, value)
+	}
+	if header.Get(echo.HeaderContentType) == "" && len(r.body) > 0 {
+		header.Set(echo.HeaderContentType, http.DetectContentType(r.body))
+	}
+	if r.status == http.StatusNoContent || r.status == http.StatusNotModified {
+		return c.NoContent(r.status)
+	}
+	header.Set(echo.HeaderContentLength, strconv.Itoa(len(r.body)))
+	c.Response().WriteHeader(r.status)
+	if c.Request().Method == http.MethodHead {
+		return nil
+	}
+	_, err := c.Response().Write(r.body)
+	return err
+}
+
+func (r *Responder) redirect(c echo.Context) error {
+	req := c.Request()
+	subpath := strings.TrimPrefix(req.URL.Path, r.basePath)
+	if subpath != "" && !strings.HasPrefix(subpath, "/") {
+		subpath = "/" + subpath
+	}
+
+	var location bytes.Buffer
+	err := r.location.Execute(&location, Request{
+		Scheme:  c.Scheme(),
+		Host:    req.Host,
+		Path:    req.URL.Path,
+		Subpath: subpath,
+		Query:   req.URL.RawQuery,
+		Method:  req.Method,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to build redirect location").SetInternal(err)
+	}
+	return c.Redirect(r.status, location.String())
+}
@@ -0,0 +1,105 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"odin/pkg/config"
+)
+
+// kafkaContentType is the Kafka REST Proxy v2 JSON embedded format
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaSink publishes to Kafka through the REST Proxy v2 API (Confluent REST
+// Proxy, Redpanda HTTP Proxy). Using HTTP keeps the gateway free of a native
+// Kafka client and works through the same network policies as other egress.
+type KafkaSink struct {
+	config config.StreamingKafkaConfig
+	client *http.Client
+}
+
+// NewKafkaSink creates a new Kafka REST Proxy sink
+func NewKafkaSink(cfg config.StreamingKafkaConfig) *KafkaSink {
+	return &KafkaSink{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Publish produces a batch of records to topic
+func (k *KafkaSink) Publish(ctx context.Context, topic string, messages []Message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, msg := range messages {
+		records[i] = kafkaRecord{Key: msg.Key, Value: msg.Value}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(k.config.RestProxyURL, "/") + "/topics/" + url.PathEscape(topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if k.config.Username != "" {
+		req.SetBasicAuth(k.config.Username, k.config.Password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Kafka REST proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	var result kafkaProduceResponse
+	_ = json.Unmarshal(data, &result)
+
+	if resp.StatusCode != http.StatusOK {
+		if result.Message != "" {
+			return fmt.Errorf("kafka REST proxy returned status %d: %s", resp.StatusCode, result.Message)
+		}
+		return fmt.Errorf("kafka REST proxy returned status %d", resp.StatusCode)
+	}
+
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil && *offset.ErrorCode != 0 {
+			return fmt.Errorf("kafka rejected record in partition %d: %s", offset.Partition, offset.Error)
+		}
+	}
+
+	return nil
+}
+
+// Close releases idle connections
+func (k *KafkaSink) Close() error {
+	k.client.CloseIdleConnections()
+	return nil
+}
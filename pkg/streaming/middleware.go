@@ -0,0 +1,141 @@
+package streaming
+
+import (
+	"strings"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/events"
+	"odin/pkg/requestid"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AccessMiddleware publishes an access record for every request
+func AccessMiddleware(p *Pipeline) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				// Let echo resolve the final status before it is recorded
+				c.Error(err)
+			}
+
+			req := c.Request()
+			res := c.Response()
+
+			record := AccessRecord{
+				Timestamp: start.UTC(),
+				RequestID: requestid.Get(c),
+				Method:    req.Method,
+				Host:      req.Host,
+				Path:      req.URL.Path,
+				Query:     req.URL.RawQuery,
+				Route:     c.Path(),
+				Status:    res.Status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				BytesIn:   req.ContentLength,
+				BytesOut:  res.Size,
+				ClientIP:  c.RealIP(),
+				UserAgent: req.UserAgent(),
+				User:      requestUser(c),
+			}
+			if record.BytesIn < 0 {
+				record.BytesIn = 0
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+
+			p.PublishAccess(record)
+
+			return err
+		}
+	}
+}
+
+// AuditMiddleware publishes an audit record for every mutating admin request
+func AuditMiddleware(p *Pipeline) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !strings.HasPrefix(req.URL.Path, "/admin") || !isMutating(req.Method) {
+				return next(c)
+			}
+
+			err := next(c)
+
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+
+			outcome := "success"
+			if err != nil || status >= 400 {
+				outcome = "failure"
+			}
+
+			actor := requestUser(c)
+			if actor == "" {
+				if username, _, ok := req.BasicAuth(); ok {
+					actor = username
+				}
+			}
+
+			p.PublishAudit(AuditRecord{
+				Timestamp: time.Now().UTC(),
+				Action:    req.Method + " " + c.Path(),
+				Resource:  req.URL.Path,
+				Actor:     actor,
+				ClientIP:  c.RealIP(),
+				Status:    outcome,
+				Details: map[string]interface{}{
+					"status":    status,
+					"requestId": requestid.Get(c),
+				},
+			})
+
+			return err
+		}
+	}
+}
+
+// AuditSubscriber turns gateway lifecycle events into audit records, so changes
+// made outside the admin API (GitOps, health transitions) are audited as well
+func AuditSubscriber(p *Pipeline) events.Subscriber {
+	return func(event events.Event) {
+		resource := ""
+		for _, key := range []string{"service", "cluster", "plugin", "target"} {
+			if value, ok := event.Data[key].(string); ok {
+				resource = key + "/" + value
+				break
+			}
+		}
+
+		p.PublishAudit(AuditRecord{
+			Timestamp: event.Timestamp,
+			Action:    string(event.Type),
+			Resource:  resource,
+			Actor:     event.Source,
+			Status:    "success",
+			Details:   event.Data,
+		})
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+func requestUser(c echo.Context) string {
+	if claims, ok := c.Get("user").(*auth.JWTClaims); ok {
+		return claims.Username
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package streaming
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"odin/pkg/config"
+)
+
+// NATSSink publishes to NATS subjects using the core NATS text protocol.
+// Every batch is followed by a PING so the server has acknowledged the
+// batch (or reported an error) before Publish returns.
+type NATSSink struct {
+	config config.StreamingNATSConfig
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// NewNATSSink creates a new NATS sink. The connection is established lazily
+// and re-established after failures.
+func NewNATSSink(cfg config.StreamingNATSConfig) *NATSSink {
+	return &NATSSink{config: cfg}
+}
+
+// Publish sends a batch of messages to subject topic
+func (n *NATSSink) Publish(ctx context.Context, topic string, messages []Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	err := n.publish(ctx, topic, messages)
+	if err != nil && n.conn != nil {
+		// Retry once on a fresh connection, e.g. after the server dropped an idle client
+		n.disconnect()
+		err = n.publish(ctx, topic, messages)
+	}
+	if err != nil {
+		n.disconnect()
+	}
+	return err
+}
+
+func (n *NATSSink) publish(ctx context.Context, subject string, messages []Message) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(n.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	n.conn.SetDeadline(deadline)
+
+	for _, msg := range messages {
+		fmt.Fprintf(n.writer, "PUB %s %d\r\n", subject, len(msg.Value))
+		n.writer.Write(msg.Value)
+		n.writer.WriteString("\r\n")
+	}
+	n.writer.WriteString("PING\r\n")
+	if err := n.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write to NATS: %w", err)
+	}
+
+	return n.awaitPong()
+}
+
+// connect dials the server and performs the CONNECT handshake
+func (n *NATSSink) connect(ctx context.Context) error {
+	u, err := url.Parse(n.config.URL)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := &net.Dialer{Timeout: n.timeout()}
+	var conn net.Conn
+	if u.Scheme == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+	n.writer = bufio.NewWriter(conn)
+	conn.SetDeadline(time.Now().Add(n.timeout()))
+
+	// The server greets with INFO before accepting CONNECT
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		n.disconnect()
+		return fmt.Errorf("failed to read NATS INFO: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		n.disconnect()
+		return fmt.Errorf("unexpected NATS greeting: %s", strings.TrimSpace(line))
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "odin-gateway",
+		"lang":     "go",
+		"version":  "1.0.0",
+		"protocol": 0,
+	}
+
+	username, password := n.config.Username, n.config.Password
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if username != "" {
+		options["user"] = username
+		options["pass"] = password
+	}
+	if n.config.Token != "" {
+		options["auth_token"] = n.config.Token
+	}
+
+	connect, _ := json.Marshal(options)
+	fmt.Fprintf(n.writer, "CONNECT %s\r\nPING\r\n", connect)
+	if err := n.writer.Flush(); err != nil {
+		n.disconnect()
+		return fmt.Errorf("failed to send NATS CONNECT: %w", err)
+	}
+
+	if err := n.awaitPong(); err != nil {
+		n.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+// awaitPong reads until the PONG for our PING, answering server PINGs and
+// surfacing -ERR responses
+func (n *NATSSink) awaitPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read from NATS: %w", err)
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			n.writer.WriteString("PONG\r\n")
+			if err := n.writer.Flush(); err != nil {
+				return fmt.Errorf("failed to write to NATS: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.Trim(strings.TrimPrefix(line, "-ERR"), " '"))
+		}
+	}
+}
+
+func (n *NATSSink) disconnect() {
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn = nil
+	n.reader = nil
+	n.writer = nil
+}
+
+func (n *NATSSink) timeout() time.Duration {
+	if n.config.Timeout > 0 {
+		return n.config.Timeout
+	}
+	return 5 * time.Second
+}
+
+// Close closes the connection
+func (n *NATSSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.disconnect()
+	return nil
+}
@@ -0,0 +1,265 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// entry is a record waiting to be encoded and batched
+type entry struct {
+	topic  string
+	key    string
+	schema string
+	record interface{}
+	time   time.Time
+}
+
+// Pipeline batches access and audit records and publishes them to a Sink.
+// Enqueueing never blocks the request path; records are dropped when the
+// buffer is full.
+type Pipeline struct {
+	config config.StreamingConfig
+	sink   Sink
+	logger *logrus.Logger
+
+	queue    chan entry
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	running  bool
+
+	published int64
+	dropped   int64
+	failed    int64
+	lastError atomic.Value
+}
+
+// NewPipeline creates a pipeline publishing to sink
+func NewPipeline(cfg config.StreamingConfig, sink Sink, logger *logrus.Logger) *Pipeline {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+
+	return &Pipeline{
+		config:   cfg,
+		sink:     sink,
+		logger:   logger,
+		queue:    make(chan entry, cfg.BufferSize),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// NewSink creates the sink for the configured backend
+func NewSink(cfg config.StreamingConfig) (Sink, error) {
+	switch cfg.Backend {
+	case "kafka":
+		return NewKafkaSink(cfg.Kafka), nil
+	case "nats":
+		return NewNATSSink(cfg.NATS), nil
+	default:
+		return nil, fmt.Errorf("unsupported streaming backend: %s", cfg.Backend)
+	}
+}
+
+// Start launches the batching worker
+func (p *Pipeline) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return fmt.Errorf("streaming pipeline already running")
+	}
+	p.running = true
+
+	p.wg.Add(1)
+	go p.run()
+
+	p.logger.WithFields(logrus.Fields{
+		"backend":     p.config.Backend,
+		"accessTopic": p.config.AccessTopic,
+		"auditTopic":  p.config.AuditTopic,
+		"schema":      p.config.Schema,
+	}).Info("Streaming pipeline started")
+
+	return nil
+}
+
+// Stop flushes buffered records and closes the sink
+func (p *Pipeline) Stop() error {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return fmt.Errorf("streaming pipeline not running")
+	}
+	p.running = false
+	p.mu.Unlock()
+
+	close(p.stopChan)
+	p.wg.Wait()
+
+	p.logger.Info("Streaming pipeline stopped")
+	return p.sink.Close()
+}
+
+// PublishAccess queues an access record
+func (p *Pipeline) PublishAccess(record AccessRecord) {
+	record.Schema = AccessSchema
+	p.enqueue(entry{
+		topic:  p.config.AccessTopic,
+		key:    record.ClientIP,
+		schema: AccessSchema,
+		record: record,
+		time:   record.Timestamp,
+	})
+}
+
+// PublishAudit queues an audit record
+func (p *Pipeline) PublishAudit(record AuditRecord) {
+	record.Schema = AuditSchema
+	p.enqueue(entry{
+		topic:  p.config.AuditTopic,
+		key:    record.Resource,
+		schema: AuditSchema,
+		record: record,
+		time:   record.Timestamp,
+	})
+}
+
+// Stats returns the pipeline counters
+func (p *Pipeline) Stats() Stats {
+	p.mu.RLock()
+	running := p.running
+	p.mu.RUnlock()
+
+	stats := Stats{
+		Backend:   p.config.Backend,
+		Running:   running,
+		Queued:    len(p.queue),
+		Published: atomic.LoadInt64(&p.published),
+		Dropped:   atomic.LoadInt64(&p.dropped),
+		Failed:    atomic.LoadInt64(&p.failed),
+	}
+	if err, ok := p.lastError.Load().(string); ok {
+		stats.LastError = err
+	}
+	return stats
+}
+
+func (p *Pipeline) enqueue(e entry) {
+	select {
+	case p.queue <- e:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+// run collects records into per-topic batches and flushes them when a batch
+// is full or the flush interval elapses
+func (p *Pipeline) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make(map[string][]Message)
+
+	add := func(e entry) {
+		msg, err := p.encode(e)
+		if err != nil {
+			atomic.AddInt64(&p.failed, 1)
+			p.logger.WithError(err).Warn("Failed to encode streaming record")
+			return
+		}
+		batches[e.topic] = append(batches[e.topic], msg)
+		if len(batches[e.topic]) >= p.config.BatchSize {
+			p.flush(e.topic, batches[e.topic])
+			delete(batches, e.topic)
+		}
+	}
+
+	flushAll := func() {
+		for topic, messages := range batches {
+			p.flush(topic, messages)
+			delete(batches, topic)
+		}
+	}
+
+	for {
+		select {
+		case e := <-p.queue:
+			add(e)
+		case <-ticker.C:
+			flushAll()
+		case <-p.stopChan:
+			// Drain what is already buffered before shutting down
+			for {
+				select {
+				case e := <-p.queue:
+					add(e)
+				default:
+					flushAll()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Pipeline) flush(topic string, messages []Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := p.sink.Publish(ctx, topic, messages); err != nil {
+		atomic.AddInt64(&p.failed, int64(len(messages)))
+		p.lastError.Store(err.Error())
+		p.logger.WithError(err).WithFields(logrus.Fields{
+			"topic":   topic,
+			"records": len(messages),
+		}).Warn("Failed to publish streaming batch")
+		return
+	}
+
+	atomic.AddInt64(&p.published, int64(len(messages)))
+}
+
+// encode serializes a record using the configured schema
+func (p *Pipeline) encode(e entry) (Message, error) {
+	var value interface{} = e.record
+	if p.config.Schema == SchemaCloudEvents {
+		value = map[string]interface{}{
+			"specversion":     "1.0",
+			"id":              uuid.New().String(),
+			"source":          "odin",
+			"type":            e.schema,
+			"time":            e.time.UTC().Format(time.RFC3339Nano),
+			"datacontenttype": "application/json",
+			"data":            e.record,
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Key: e.key, Value: data}, nil
+}
@@ -0,0 +1,73 @@
+package streaming
+
+import (
+	"context"
+	"time"
+)
+
+// Schema identifiers carried by every record so consumers can evolve independently
+const (
+	AccessSchema = "odin.access.v1"
+	AuditSchema  = "odin.audit.v1"
+)
+
+// Record encodings
+const (
+	SchemaJSON        = "json"
+	SchemaCloudEvents = "cloudevents"
+)
+
+// Message is a single encoded record ready to be published
+type Message struct {
+	Key   string
+	Value []byte
+}
+
+// Sink publishes batches of messages to a message bus topic
+type Sink interface {
+	Publish(ctx context.Context, topic string, messages []Message) error
+	Close() error
+}
+
+// AccessRecord describes a single proxied request
+type AccessRecord struct {
+	Schema    string    `json:"schema"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"requestId,omitempty"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Route     string    `json:"route,omitempty"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+	BytesIn   int64     `json:"bytesIn"`
+	BytesOut  int64     `json:"bytesOut"`
+	ClientIP  string    `json:"clientIp"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditRecord describes a configuration or administrative change
+type AuditRecord struct {
+	Schema    string                 `json:"schema"`
+	Timestamp time.Time              `json:"timestamp"`
+	Action    string                 `json:"action"`
+	Resource  string                 `json:"resource,omitempty"`
+	Actor     string                 `json:"actor,omitempty"`
+	ClientIP  string                 `json:"clientIp,omitempty"`
+	Status    string                 `json:"status"` // success, failure
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Stats reports pipeline throughput counters
+type Stats struct {
+	Backend   string `json:"backend"`
+	Running   bool   `json:"running"`
+	Queued    int    `json:"queued"`
+	Published int64  `json:"published"`
+	Dropped   int64  `json:"dropped"`
+	Failed    int64  `json:"failed"`
+	LastError string `json:"lastError,omitempty"`
+}
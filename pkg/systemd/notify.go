@@ -0,0 +1,90 @@
+// Package systemd implements the parts of the sd_notify protocol the gateway
+// uses: readiness, stopping and watchdog notifications. Outside of a systemd
+// service with Type=notify every call is a no-op.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notification states understood by systemd
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state to the socket in NOTIFY_SOCKET. It reports false when
+// the process was not started by systemd with notification enabled.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	// A leading @ denotes an abstract socket
+	if socket[0] == '@' {
+		addr.Name = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout systemd expects pings
+// within, from WATCHDOG_USEC. It reports false when the watchdog is disabled
+// or meant for another process.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// RunWatchdog pings the watchdog at half the timeout for as long as check
+// passes, until ctx is done. While check fails no pings are sent, so systemd
+// restarts the service once the timeout runs out.
+func RunWatchdog(ctx context.Context, timeout time.Duration, check func(context.Context) error, logger *logrus.Logger) {
+	interval := timeout / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := check(checkCtx)
+		cancel()
+		if err != nil {
+			logger.WithError(err).Warn("Self-check failed, withholding watchdog ping")
+			continue
+		}
+		if _, err := Notify(Watchdog); err != nil {
+			logger.WithError(err).Warn("Failed to send watchdog ping")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package tcpproxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons connections are rejected or closed by the gateway
+const (
+	rejectLimit       = "limit"
+	rejectNoTarget    = "no_target"
+	rejectClientHello = "client_hello"
+	rejectNoRoute     = "no_route"
+	closeIdle         = "idle"
+)
+
+// routeDefault labels TLS connections sent to a listener's own targets
+const routeDefault = "default"
+
+var (
+	activeConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_tcp_connections",
+			Help: "Currently open TCP proxy connections",
+		},
+		[]string{"listener"},
+	)
+
+	rejectedConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_tcp_rejected_total",
+			Help: "Total number of TCP proxy connections refused or not forwarded",
+		},
+		[]string{"listener", "reason"},
+	)
+
+	closedConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_tcp_closed_total",
+			Help: "Total number of TCP proxy connections closed by the gateway",
+		},
+		[]string{"listener", "reason"},
+	)
+
+	routedConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_tcp_routed_total",
+			Help: "Total number of TLS passthrough connections by route, named by its first server name",
+		},
+		[]string{"listener", "route"},
+	)
+
+	transferredBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_tcp_bytes_total",
+			Help: "Total bytes relayed by the TCP proxy, in from clients and out to them",
+		},
+		[]string{"listener", "direction"},
+	)
+)
@@ -0,0 +1,83 @@
+package tcpproxy
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync/atomic"
+)
+
+// target is a backend address and the connections currently open to it
+type target struct {
+	addr   string
+	active atomic.Int64
+}
+
+// pool orders the targets of a listener for each new connection
+type pool struct {
+	targets  []*target
+	strategy string
+	healthy  func(addr string) bool
+	disabled func(addr string) bool
+	next     atomic.Uint64
+}
+
+func newPool(addrs []string, strategy string, healthy, disabled func(addr string) bool) *pool {
+	p := &pool{strategy: strategy, healthy: healthy, disabled: disabled}
+	for _, addr := range addrs {
+		p.targets = append(p.targets, &target{addr: addr})
+	}
+	return p
+}
+
+// candidates returns the healthy targets that are not disabled in the order a connection should
+// try them: the next one in turn first for round-robin, a random one for
+// random, and the least busy for least-connections, with ties taken in turn.
+// The others follow so a target refusing the connection can be skipped.
+func (p *pool) candidates() []*target {
+	healthy := make([]*target, 0, len(p.targets))
+	for _, t := range p.targets {
+		if p.healthy(t.addr) && !p.disabled(t.addr) {
+			healthy = append(healthy, t)
+		}
+	}
+	if len(healthy) < 2 {
+		return healthy
+	}
+
+	switch p.strategy {
+	case "random":
+		return rotate(healthy, rand.IntN(len(healthy)))
+	case "least-connections":
+		healthy = rotate(healthy, p.turn(len(healthy)))
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].active.Load() < healthy[j].active.Load()
+		})
+		return healthy
+	default:
+		return rotate(healthy, p.turn(len(healthy)))
+	}
+}
+
+// turn returns the round-robin starting position among n targets
+func (p *pool) turn(n int) int {
+	return int((p.next.Add(1) - 1) % uint64(n))
+}
+
+func rotate(targets []*target, i int) []*target {
+	return slices.Concat(targets[i:], targets[:i])
+}
+
+// stats returns the state of the pool's targets
+func (p *pool) stats() []TargetStats {
+	stats := make([]TargetStats, 0, len(p.targets))
+	for _, t := range p.targets {
+		stats = append(stats, TargetStats{
+			Address:  t.addr,
+			Healthy:  p.healthy(t.addr),
+			Disabled: p.disabled(t.addr),
+			Active:   t.active.Load(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,472 @@
+// Package tcpproxy forwards raw TCP connections to pools of targets, so
+// backends that do not speak HTTP, such as databases or custom binary
+// protocols, can sit behind the gateway with the same health checks, metrics
+// and zero-downtime upgrades as HTTP services. In TLS passthrough mode,
+// connections are routed by the server name of their TLS ClientHello and
+// passed on without being decrypted.
+package tcpproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"odin/pkg/bufpool"
+	"odin/pkg/config"
+	"odin/pkg/health"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	errNoTargets = errors.New("no available targets")
+	errIdle      = errors.New("idle timeout")
+)
+
+// Proxy accepts connections on one listener and relays each to a target
+type Proxy struct {
+	config  config.TCPListenerConfig
+	pool    *pool
+	routes  []*route
+	table   *routeTable // Set in tls-passthrough mode
+	checker *health.TargetChecker
+	logger  *logrus.Entry
+	dialer  net.Dialer
+
+	maintenance *health.Maintenance
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	wg       sync.WaitGroup
+
+	accepted atomic.Int64
+	rejected atomic.Int64
+	failed   atomic.Int64
+	unrouted atomic.Int64
+}
+
+// New creates a proxy for a listener. Target health changes are reported to
+// alerts like those of HTTP services.
+func New(cfg config.TCPListenerConfig, logger *logrus.Logger, alerts *health.AlertManager) *Proxy {
+	if cfg.ConnectTimeout == 0 {
+		cfg.ConnectTimeout = 5 * time.Second
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = "tcp"
+	}
+	if cfg.ClientHelloTimeout == 0 {
+		cfg.ClientHelloTimeout = 10 * time.Second
+	}
+
+	p := &Proxy{
+		config: cfg,
+		logger: logger.WithField("listener", cfg.Name),
+		dialer: net.Dialer{Timeout: cfg.ConnectTimeout},
+		conns:  make(map[net.Conn]struct{}),
+	}
+
+	if hc := cfg.HealthCheck; hc != nil && hc.Enabled {
+		timeout := hc.Timeout
+		if timeout == 0 {
+			timeout = cfg.ConnectTimeout
+		}
+		p.checker = health.NewTargetChecker(health.Config{
+			Interval:           hc.Interval,
+			Timeout:            timeout,
+			UnhealthyThreshold: hc.UnhealthyThreshold,
+			HealthyThreshold:   hc.HealthyThreshold,
+			Check:              health.TCPCheck(timeout),
+		}, logger, alerts)
+		for _, target := range cfg.Targets {
+			p.checker.AddTarget(target)
+		}
+		for _, r := range cfg.Routes {
+			for _, target := range r.Targets {
+				p.checker.AddTarget(target)
+			}
+		}
+	}
+	p.pool = newPool(cfg.Targets, cfg.LoadBalancing, p.healthy, p.disabled)
+
+	if cfg.Mode == "tls-passthrough" {
+		for _, r := range cfg.Routes {
+			strategy := r.LoadBalancing
+			if strategy == "" {
+				strategy = cfg.LoadBalancing
+			}
+			names := make([]string, len(r.ServerNames))
+			for i, name := range r.ServerNames {
+				names[i] = strings.ToLower(name)
+			}
+			p.routes = append(p.routes, &route{
+				name:        names[0],
+				serverNames: names,
+				pool:        newPool(r.Targets, strategy, p.healthy, p.disabled),
+			})
+		}
+		p.table = newRouteTable(p.routes)
+	}
+
+	return p
+}
+
+// SetMaintenance stops relaying connections to the targets disabled in m.
+// It must be set before Serve is called.
+func (p *Proxy) SetMaintenance(m *health.Maintenance) {
+	p.maintenance = m
+}
+
+func (p *Proxy) healthy(addr string) bool {
+	return p.checker == nil || p.checker.IsHealthy(addr)
+}
+
+func (p *Proxy) disabled(addr string) bool {
+	return p.maintenance != nil && p.maintenance.IsDisabled(addr)
+}
+
+// Name returns the listener's name
+func (p *Proxy) Name() string {
+	return p.config.Name
+}
+
+// Addr returns the address the listener should be opened on
+func (p *Proxy) Addr() string {
+	return fmt.Sprintf(":%d", p.config.Port)
+}
+
+// Serve starts the health checks and relays the connections accepted on l
+// until Shutdown is called
+func (p *Proxy) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	p.listener = l
+	p.mu.Unlock()
+
+	if p.checker != nil {
+		p.checker.Start()
+	}
+	p.logger.Infof("TCP proxy starting on %s", l.Addr())
+
+	var backoff time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if p.isClosing() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			// Out of file descriptors and the like; wait for connections to end
+			backoff = min(max(2*backoff, 5*time.Millisecond), time.Second)
+			p.logger.WithError(err).Warnf("Accept failed, retrying in %v", backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		if !p.track(conn) {
+			conn.Close()
+			continue
+		}
+		go p.handle(conn)
+	}
+}
+
+// Shutdown stops accepting connections and waits for open ones to end. Those
+// still open when ctx is done are closed.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closing = true
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	p.mu.Unlock()
+
+	if p.checker != nil {
+		p.checker.Stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		for conn := range p.conns {
+			conn.Close()
+		}
+		p.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Proxy) isClosing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closing
+}
+
+// track registers a client connection, refusing it when the listener is
+// full or shutting down
+func (p *Proxy) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closing {
+		return false
+	}
+	if limit := p.config.MaxConnections; limit > 0 && len(p.conns) >= limit {
+		p.rejected.Add(1)
+		rejectedConnections.WithLabelValues(p.config.Name, rejectLimit).Inc()
+		return false
+	}
+
+	p.conns[conn] = struct{}{}
+	p.wg.Add(1)
+	p.accepted.Add(1)
+	activeConnections.WithLabelValues(p.config.Name).Inc()
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn) {
+	p.mu.Lock()
+	delete(p.conns, conn)
+	p.mu.Unlock()
+
+	activeConnections.WithLabelValues(p.config.Name).Dec()
+	p.wg.Done()
+}
+
+// handle relays one client connection to a target
+func (p *Proxy) handle(client net.Conn) {
+	defer p.untrack(client)
+	defer client.Close()
+
+	log := p.logger.WithField("client", client.RemoteAddr().String())
+
+	pool := p.pool
+	var hello []byte
+	if p.table != nil {
+		var serverName string
+		var err error
+		serverName, hello, err = readClientHello(client, p.config.ClientHelloTimeout)
+		if err != nil {
+			p.unrouted.Add(1)
+			rejectedConnections.WithLabelValues(p.config.Name, rejectClientHello).Inc()
+			log.WithError(err).Debug("Connection did not open with a TLS ClientHello")
+			return
+		}
+		log = log.WithField("server_name", serverName)
+
+		label := routeDefault
+		if r := p.table.lookup(serverName); r != nil {
+			pool, label = r.pool, r.name
+		} else if len(pool.targets) == 0 {
+			p.unrouted.Add(1)
+			rejectedConnections.WithLabelValues(p.config.Name, rejectNoRoute).Inc()
+			log.Debug("No TLS route for server name")
+			return
+		}
+		routedConnections.WithLabelValues(p.config.Name, label).Inc()
+	}
+
+	backend, t, err := p.dial(pool)
+	if err != nil {
+		p.failed.Add(1)
+		rejectedConnections.WithLabelValues(p.config.Name, rejectNoTarget).Inc()
+		log.WithError(err).Warn("No TCP target accepted the connection")
+		return
+	}
+	defer backend.Close()
+
+	t.active.Add(1)
+	defer t.active.Add(-1)
+
+	// Replay the ClientHello read for routing, so the target can complete
+	// the handshake with the client
+	if len(hello) > 0 {
+		if _, err := backend.Write(hello); err != nil {
+			log.WithError(err).WithField("target", t.addr).Debug("Failed to pass on TLS ClientHello")
+			return
+		}
+		transferredBytes.WithLabelValues(p.config.Name, "in").Add(float64(len(hello)))
+	}
+
+	start := time.Now()
+	idle := p.pipe(client, backend)
+	if idle {
+		closedConnections.WithLabelValues(p.config.Name, closeIdle).Inc()
+	}
+	log.WithFields(logrus.Fields{
+		"target":   t.addr,
+		"duration": time.Since(start),
+		"idle":     idle,
+	}).Debug("TCP connection closed")
+}
+
+// dial connects to the first candidate target of pool that accepts the
+// connection
+func (p *Proxy) dial(pool *pool) (net.Conn, *target, error) {
+	candidates := pool.candidates()
+	if len(candidates) == 0 {
+		return nil, nil, errNoTargets
+	}
+
+	var lastErr error
+	for _, t := range candidates {
+		conn, err := p.dialer.Dial("tcp", t.addr)
+		if err == nil {
+			return conn, t, nil
+		}
+		p.logger.WithError(err).WithField("target", t.addr).Debug("TCP target refused connection")
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// pipe copies between client and backend until both directions are done,
+// and reports whether the connection was closed for being idle
+func (p *Proxy) pipe(client, backend net.Conn) bool {
+	var fromClient, fromBackend io.Reader = client, backend
+	if timeout := p.config.IdleTimeout; timeout > 0 {
+		last := &atomic.Int64{}
+		last.Store(time.Now().UnixNano())
+		fromClient = &idleReader{conn: client, timeout: timeout, last: last}
+		fromBackend = &idleReader{conn: backend, timeout: timeout, last: last}
+	}
+
+	errs := make(chan error, 2)
+	relay := func(dst net.Conn, src io.Reader, direction string) {
+		n, err := bufpool.Copy(dst, src)
+		transferredBytes.WithLabelValues(p.config.Name, direction).Add(float64(n))
+		errs <- closeWrite(dst, err)
+	}
+	go relay(backend, fromClient, "in")
+	go relay(client, fromBackend, "out")
+
+	idle := false
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			idle = idle || errors.Is(err, errIdle)
+			// Unblock the other direction
+			client.Close()
+			backend.Close()
+		}
+	}
+	return idle
+}
+
+// closeWrite passes the end of one direction on as a half-close, so
+// protocols that finish sending before they finish reading keep working.
+// Errors, and connections that cannot be half-closed, end both directions.
+func closeWrite(conn net.Conn, err error) error {
+	if err != nil {
+		return err
+	}
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return io.EOF
+}
+
+// idleReader reads from a connection until neither direction has carried
+// data for timeout. last is shared by both directions.
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+	last    *atomic.Int64
+}
+
+func (r *idleReader) Read(b []byte) (int, error) {
+	for {
+		r.conn.SetReadDeadline(time.Unix(0, r.last.Load()).Add(r.timeout))
+		n, err := r.conn.Read(b)
+		if n > 0 {
+			r.last.Store(time.Now().UnixNano())
+		}
+
+		var netErr net.Error
+		if err == nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+			return n, err
+		}
+		// The other direction may have kept the connection busy
+		if time.Since(time.Unix(0, r.last.Load())) < r.timeout {
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, errIdle
+	}
+}
+
+// Stats is a snapshot of a listener's connections and targets
+type Stats struct {
+	Name     string        `json:"name"`
+	Port     int           `json:"port"`
+	Mode     string        `json:"mode"`
+	Active   int           `json:"active"`
+	Accepted int64         `json:"accepted"`
+	Rejected int64         `json:"rejected"`           // Refused by maxConnections
+	Failed   int64         `json:"failed"`             // Accepted but no target could be reached
+	Unrouted int64         `json:"unrouted,omitempty"` // Without a ClientHello or a route for its server name
+	Targets  []TargetStats `json:"targets"`
+	Routes   []RouteStats  `json:"routes,omitempty"`
+}
+
+// RouteStats describes the targets of one TLS route
+type RouteStats struct {
+	ServerNames []string      `json:"serverNames"`
+	Targets     []TargetStats `json:"targets"`
+}
+
+// TargetStats describes one target of a listener
+type TargetStats struct {
+	Address  string `json:"address"`
+	Healthy  bool   `json:"healthy"`
+	Disabled bool   `json:"disabled,omitempty"` // Taken out of service by an admin
+	Active   int64  `json:"active"`
+}
+
+// Stats returns the listener's counters and the state of its targets
+func (p *Proxy) Stats() Stats {
+	p.mu.Lock()
+	active := len(p.conns)
+	p.mu.Unlock()
+
+	stats := Stats{
+		Name:     p.config.Name,
+		Port:     p.config.Port,
+		Mode:     p.config.Mode,
+		Active:   active,
+		Accepted: p.accepted.Load(),
+		Rejected: p.rejected.Load(),
+		Failed:   p.failed.Load(),
+		Unrouted: p.unrouted.Load(),
+		Targets:  p.pool.stats(),
+	}
+	for _, r := range p.routes {
+		stats.Routes = append(stats.Routes, RouteStats{ServerNames: r.serverNames, Targets: r.pool.stats()})
+	}
+	return stats
+}
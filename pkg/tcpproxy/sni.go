@@ -0,0 +1,86 @@
+package tcpproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// errHelloRead stops the handshake once the ClientHello has been read
+var errHelloRead = errors.New("client hello read")
+
+// readClientHello reads the ClientHello a TLS client opens with and returns
+// the server name it asks for, which is empty when it sends none, and the
+// bytes read so they can be replayed to the target.
+func readClientHello(conn net.Conn, timeout time.Duration) (string, []byte, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	// crypto/tls parses the ClientHello, however it is split across records
+	// and reads. The handshake is abandoned before anything is written.
+	var read bytes.Buffer
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(helloConn{Conn: conn, r: io.TeeReader(conn, &read)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if hello == nil {
+		return "", nil, err
+	}
+	return strings.TrimSuffix(strings.ToLower(hello.ServerName), "."), read.Bytes(), nil
+}
+
+// helloConn lets crypto/tls read from a client connection but not write to
+// or close it
+type helloConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c helloConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+func (c helloConn) Write([]byte) (int, error)  { return 0, io.ErrClosedPipe }
+func (c helloConn) Close() error               { return nil }
+
+// route is a pool of targets for some server names
+type route struct {
+	name        string // The first server name, to label metrics with
+	serverNames []string
+	pool        *pool
+}
+
+// routeTable finds the route for a server name: an exact match first, then a
+// wildcard covering its first label
+type routeTable struct {
+	exact    map[string]*route
+	wildcard map[string]*route // By the domain below the wildcard
+}
+
+func newRouteTable(routes []*route) *routeTable {
+	t := &routeTable{exact: make(map[string]*route), wildcard: make(map[string]*route)}
+	for _, r := range routes {
+		for _, name := range r.serverNames {
+			if domain, ok := strings.CutPrefix(name, "*."); ok {
+				t.wildcard[domain] = r
+			} else {
+				t.exact[name] = r
+			}
+		}
+	}
+	return t
+}
+
+func (t *routeTable) lookup(serverName string) *route {
+	if r, ok := t.exact[serverName]; ok {
+		return r
+	}
+	if _, domain, ok := strings.Cut(serverName, "."); ok {
+		return t.wildcard[domain]
+	}
+	return nil
+}
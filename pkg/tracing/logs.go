@@ -0,0 +1,316 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var droppedLogs = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "api_gateway_otlp_logs_dropped_total",
+	Help: "Total number of log records not exported because the queue was full or the export failed",
+})
+
+// LogsConfig represents log export configuration
+type LogsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Endpoint      string        `yaml:"endpoint"`
+	Level         string        `yaml:"level"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	QueueSize     int           `yaml:"queueSize"`
+}
+
+// LogExporter is a logrus hook sending log records to an OTLP/HTTP logs
+// endpoint in batches. Records written with WithContext carry the trace and
+// span of their context, so backends can link them to traces.
+type LogExporter struct {
+	endpoint  string
+	client    *http.Client
+	resource  *resourcepb.Resource
+	scope     *commonpb.InstrumentationScope
+	levels    []logrus.Level
+	batchSize int
+	interval  time.Duration
+	queue     chan *logspb.LogRecord
+	errors    *logrus.Logger // Without the hook, so export failures are not exported
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewLogExporter creates an exporter for the logs of logger and starts
+// sending them. The records carry the attributes of res. It does not add
+// itself to logger; callers do with AddHook.
+func NewLogExporter(config Config, res *resource.Resource, logger *logrus.Logger) (*LogExporter, error) {
+	logs := config.Logs
+	level := logrus.InfoLevel
+	if logs.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(logs.Level); err != nil {
+			return nil, fmt.Errorf("invalid log export level: %w", err)
+		}
+	}
+	endpoint := logs.Endpoint
+	if endpoint == "" {
+		endpoint = config.Endpoint
+	}
+
+	e := &LogExporter{
+		endpoint:  logsURL(endpoint, config.Insecure),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		resource:  &resourcepb.Resource{Attributes: keyValues(res.Attributes())},
+		scope:     &commonpb.InstrumentationScope{Name: config.ServiceName, Version: config.ServiceVersion},
+		batchSize: logs.BatchSize,
+		interval:  logs.FlushInterval,
+		stopChan:  make(chan struct{}),
+		errors: &logrus.Logger{
+			Out:       logger.Out,
+			Formatter: logger.Formatter,
+			Hooks:     make(logrus.LevelHooks),
+			Level:     logger.Level,
+		},
+	}
+	if e.batchSize == 0 {
+		e.batchSize = 512
+	}
+	if e.interval == 0 {
+		e.interval = 5 * time.Second
+	}
+	queueSize := logs.QueueSize
+	if queueSize == 0 {
+		queueSize = 4096
+	}
+	e.queue = make(chan *logspb.LogRecord, queueSize)
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			e.levels = append(e.levels, l)
+		}
+	}
+
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+// logsURL returns the OTLP/HTTP logs URL of an endpoint, which may be a
+// host and port or the URL of the traces endpoint of the same collector
+func logsURL(endpoint string, insecure bool) string {
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https://"
+		if insecure {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	switch {
+	case u.Path == "" || u.Path == "/":
+		u.Path = "/v1/logs"
+	case strings.HasSuffix(u.Path, "/v1/traces"):
+		u.Path = strings.TrimSuffix(u.Path, "/v1/traces") + "/v1/logs"
+	}
+	return u.String()
+}
+
+// Endpoint returns the URL logs are sent to
+func (e *LogExporter) Endpoint() string {
+	return e.endpoint
+}
+
+// Levels returns the levels that are exported
+func (e *LogExporter) Levels() []logrus.Level {
+	return e.levels
+}
+
+// Fire queues an entry for export. Entries that do not fit in the queue are
+// dropped rather than slowing down the code logging them.
+func (e *LogExporter) Fire(entry *logrus.Entry) error {
+	select {
+	case e.queue <- logRecord(entry):
+	default:
+		droppedLogs.Inc()
+	}
+	return nil
+}
+
+// Stop exports the queued records and stops the exporter
+func (e *LogExporter) Stop() {
+	e.stopOnce.Do(func() { close(e.stopChan) })
+	e.wg.Wait()
+}
+
+func (e *LogExporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]*logspb.LogRecord, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			droppedLogs.Add(float64(len(batch)))
+			e.errors.WithError(err).WithField("records", len(batch)).Warn("Failed to export logs")
+		}
+		batch = make([]*logspb.LogRecord, 0, e.batchSize)
+	}
+
+	for {
+		select {
+		case record := <-e.queue:
+			batch = append(batch, record)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopChan:
+			for {
+				select {
+				case record := <-e.queue:
+					batch = append(batch, record)
+					if len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends a batch of records to the endpoint
+func (e *LogExporter) export(records []*logspb.LogRecord) error {
+	body, err := proto.Marshal(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: e.scope, LogRecords: records}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// severities maps logrus levels to OTel severity numbers
+var severities = map[logrus.Level]logspb.SeverityNumber{
+	logrus.TraceLevel: logspb.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	logrus.DebugLevel: logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	logrus.InfoLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	logrus.WarnLevel:  logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	logrus.ErrorLevel: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	logrus.FatalLevel: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	logrus.PanicLevel: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4,
+}
+
+// logRecord converts a logrus entry to an OTLP log record
+func logRecord(entry *logrus.Entry) *logspb.LogRecord {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(entry.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severities[entry.Level],
+		SeverityText:         strings.ToUpper(entry.Level.String()),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: entry.Message}},
+	}
+	for key, value := range entry.Data {
+		record.Attributes = append(record.Attributes, &commonpb.KeyValue{Key: key, Value: anyValue(value)})
+	}
+	if entry.Context != nil {
+		if span := oteltrace.SpanContextFromContext(entry.Context); span.IsValid() {
+			traceID, spanID := span.TraceID(), span.SpanID()
+			record.TraceId = traceID[:]
+			record.SpanId = spanID[:]
+			record.Flags = uint32(span.TraceFlags())
+		}
+	}
+	return record
+}
+
+// anyValue converts a logrus field to an OTLP value, keeping scalar types
+func anyValue(v any) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case error:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Error()}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+}
+
+// keyValues converts resource attributes to OTLP attributes
+func keyValues(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		var value *commonpb.AnyValue
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			value = anyValue(kv.Value.AsBool())
+		case attribute.INT64:
+			value = anyValue(kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			value = anyValue(kv.Value.AsFloat64())
+		default:
+			value = anyValue(kv.Value.Emit())
+		}
+		kvs = append(kvs, &commonpb.KeyValue{Key: string(kv.Key), Value: value})
+	}
+	return kvs
+}
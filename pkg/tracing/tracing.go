@@ -3,6 +3,7 @@ package tracing
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -20,13 +21,14 @@ import (
 
 // Config represents tracing configuration
 type Config struct {
-	Enabled        bool    `yaml:"enabled"`
-	ServiceName    string  `yaml:"serviceName"`
-	ServiceVersion string  `yaml:"serviceVersion"`
-	Environment    string  `yaml:"environment"`
-	Endpoint       string  `yaml:"endpoint"`
-	SampleRate     float64 `yaml:"sampleRate"`
-	Insecure       bool    `yaml:"insecure"`
+	Enabled        bool       `yaml:"enabled"`
+	ServiceName    string     `yaml:"serviceName"`
+	ServiceVersion string     `yaml:"serviceVersion"`
+	Environment    string     `yaml:"environment"`
+	Endpoint       string     `yaml:"endpoint"`
+	SampleRate     float64    `yaml:"sampleRate"`
+	Insecure       bool       `yaml:"insecure"`
+	Logs           LogsConfig `yaml:"logs"`
 }
 
 // SetDefaults sets default values for tracing configuration
@@ -52,13 +54,15 @@ func (c *Config) SetDefaults() {
 type Manager struct {
 	tracer   oteltrace.Tracer
 	provider *trace.TracerProvider
+	logs     *LogExporter
 	config   Config
 	logger   *logrus.Logger
 }
 
-// NewManager creates a new tracing manager
+// NewManager creates a new tracing manager. Logs are exported when enabled,
+// with or without traces.
 func NewManager(config Config, logger *logrus.Logger) (*Manager, error) {
-	if !config.Enabled {
+	if !config.Enabled && !config.Logs.Enabled {
 		return &Manager{
 			tracer: otel.Tracer("noop"),
 			config: config,
@@ -68,10 +72,37 @@ func NewManager(config Config, logger *logrus.Logger) (*Manager, error) {
 
 	config.SetDefaults()
 
+	// Create resource with service information, shared by traces and logs
+	res, err := newResource(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	var logs *LogExporter
+	if config.Logs.Enabled {
+		if logs, err = NewLogExporter(config, res, logger); err != nil {
+			return nil, err
+		}
+		logger.AddHook(logs)
+		logger.WithField("endpoint", logs.Endpoint()).Info("Log export initialized")
+	}
+	if !config.Enabled {
+		return &Manager{
+			tracer: otel.Tracer("noop"),
+			logs:   logs,
+			config: config,
+			logger: logger,
+		}, nil
+	}
+
 	// Create OTLP exporter
+	// The endpoint is a URL, like that of logs, or a host and port
 	opts := []otlptracehttp.Option{
 		otlptracehttp.WithEndpoint(config.Endpoint),
 	}
+	if strings.Contains(config.Endpoint, "://") {
+		opts = []otlptracehttp.Option{otlptracehttp.WithEndpointURL(config.Endpoint)}
+	}
 	if config.Insecure {
 		opts = append(opts, otlptracehttp.WithInsecure())
 	}
@@ -81,20 +112,6 @@ func NewManager(config Config, logger *logrus.Logger) (*Manager, error) {
 		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
 	}
 
-	// Create resource with service information
-	res, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(config.ServiceName),
-			semconv.ServiceVersionKey.String(config.ServiceVersion),
-			semconv.DeploymentEnvironmentKey.String(config.Environment),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
 	// Create tracer provider
 	provider := trace.NewTracerProvider(
 		trace.WithBatcher(exporter),
@@ -124,11 +141,26 @@ func NewManager(config Config, logger *logrus.Logger) (*Manager, error) {
 	return &Manager{
 		tracer:   tracer,
 		provider: provider,
+		logs:     logs,
 		config:   config,
 		logger:   logger,
 	}, nil
 }
 
+// newResource describes the gateway to tracing and logging backends. The
+// attributes are schemaless because the default resource may use a newer
+// schema than the semconv package, which Merge rejects.
+func newResource(config Config) (*resource.Resource, error) {
+	return resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(
+			semconv.ServiceNameKey.String(config.ServiceName),
+			semconv.ServiceVersionKey.String(config.ServiceVersion),
+			semconv.DeploymentEnvironmentKey.String(config.Environment),
+		),
+	)
+}
+
 // StartSpan starts a new span with the given name and options
 func (m *Manager) StartSpan(ctx context.Context, spanName string, opts ...oteltrace.SpanStartOption) (context.Context, oteltrace.Span) {
 	if !m.config.Enabled {
@@ -222,8 +254,11 @@ func (m *Manager) FinishSpan(span oteltrace.Span, err error, attrs ...attribute.
 	span.End()
 }
 
-// Shutdown shuts down the tracer provider
+// Shutdown shuts down the tracer provider and exports the remaining logs
 func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.logs != nil {
+		defer m.logs.Stop()
+	}
 	if !m.config.Enabled || m.provider == nil {
 		return nil
 	}
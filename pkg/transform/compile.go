@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+)
+
+// funcs are the helper functions available to every template
+var funcs = templateFuncs()
+
+// namedTemplate is the template producing the header or query parameter name
+type namedTemplate struct {
+	name string
+	tmpl *template.Template
+}
+
+// CompiledRequest is a RequestTransform with its templates parsed, so
+// requests only execute them
+type CompiledRequest struct {
+	headers []namedTemplate
+	query   []namedTemplate
+	body    *template.Template
+	convert string
+	xml     XMLOptions
+}
+
+// CompiledResponse is a ResponseTransform with its templates parsed
+type CompiledResponse struct {
+	headers []namedTemplate
+	body    *template.Template
+	convert string
+	xml     XMLOptions
+}
+
+// CompileRequest parses the templates of config. Services compile their
+// transformations once when they are registered.
+func CompileRequest(config *RequestTransform) (*CompiledRequest, error) {
+	headers, err := compileTemplates("header", config.Headers)
+	if err != nil {
+		return nil, err
+	}
+	query, err := compileTemplates("query param", config.QueryParams)
+	if err != nil {
+		return nil, err
+	}
+	body, err := compileBody(config.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := validConversion(config.Convert); err != nil {
+		return nil, err
+	}
+	return &CompiledRequest{
+		headers: headers,
+		query:   query,
+		body:    body,
+		convert: config.Convert,
+		xml:     config.XML.withDefaults(),
+	}, nil
+}
+
+// CompileResponse parses the templates of config
+func CompileResponse(config *ResponseTransform) (*CompiledResponse, error) {
+	headers, err := compileTemplates("header", config.Headers)
+	if err != nil {
+		return nil, err
+	}
+	body, err := compileBody(config.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := validConversion(config.Convert); err != nil {
+		return nil, err
+	}
+	return &CompiledResponse{
+		headers: headers,
+		body:    body,
+		convert: config.Convert,
+		xml:     config.XML.withDefaults(),
+	}, nil
+}
+
+// compileTemplates parses a template per name, in name order so they are
+// applied in the same order every time
+func compileTemplates(kind string, templates map[string]string) ([]namedTemplate, error) {
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	compiled := make([]namedTemplate, 0, len(templates))
+	for name, text := range templates {
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kind, name, err)
+		}
+		compiled = append(compiled, namedTemplate{name: name, tmpl: tmpl})
+	}
+	sort.Slice(compiled, func(i, j int) bool { return compiled[i].name < compiled[j].name })
+	return compiled, nil
+}
+
+func compileBody(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	return tmpl, nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("transform").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
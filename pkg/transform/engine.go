@@ -1,230 +1,335 @@
 package transform
 
 import (
-"bytes"
-"encoding/json"
-"fmt"
-"io"
-"net/http"
-"net/url"
-"strings"
-"text/template"
-
-"github.com/sirupsen/logrus"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"odin/pkg/bufpool"
+
+	"github.com/sirupsen/logrus"
 )
 
 // Engine handles request and response transformations using Go templates
 type Engine struct {
-logger *logrus.Logger
+	logger *logrus.Logger
 }
 
 // NewEngine creates a new transformation engine
 func NewEngine(logger *logrus.Logger) *Engine {
-return &Engine{
-logger: logger,
-}
+	return &Engine{
+		logger: logger,
+	}
 }
 
-// TransformRequest applies transformations to the request
+// TransformRequest applies transformations to the request. The templates are
+// parsed on every call; use CompileRequest and ApplyRequest on hot paths.
 func (e *Engine) TransformRequest(req *http.Request, config *RequestTransform) error {
-if config == nil {
-return nil
-}
-
-// Transform headers
-if err := e.transformHeaders(req.Header, config.Headers); err != nil {
-return fmt.Errorf("failed to transform headers: %w", err)
-}
-
-// Transform query parameters
-if err := e.transformQueryParams(req.URL, config.QueryParams); err != nil {
-return fmt.Errorf("failed to transform query params: %w", err)
-}
-
-// Transform body if present
-if config.Body != "" && req.Body != nil {
-if err := e.transformBody(req, config.Body); err != nil {
-return fmt.Errorf("failed to transform body: %w", err)
-}
-}
-
-return nil
-}
-
-// TransformResponse applies transformations to the response
+	if config == nil {
+		return nil
+	}
+	compiled, err := CompileRequest(config)
+	if err != nil {
+		return err
+	}
+	return e.ApplyRequest(req, compiled)
+}
+
+// TransformResponse applies transformations to the response. The templates
+// are parsed on every call; use CompileResponse and ApplyResponse on hot paths.
 func (e *Engine) TransformResponse(body []byte, statusCode int, headers http.Header, config *ResponseTransform) ([]byte, http.Header, error) {
-if config == nil {
-return body, headers, nil
-}
-
-// Transform headers
-transformedHeaders := headers.Clone()
-if err := e.transformHeaders(transformedHeaders, config.Headers); err != nil {
-return body, headers, fmt.Errorf("failed to transform headers: %w", err)
-}
-
-// Transform body if template provided
-if config.Body != "" {
-transformedBody, err := e.applyBodyTemplate(body, statusCode, config.Body)
-if err != nil {
-return body, headers, fmt.Errorf("failed to transform body: %w", err)
-}
-return transformedBody, transformedHeaders, nil
-}
-
-return body, transformedHeaders, nil
+	if config == nil {
+		return body, headers, nil
+	}
+	compiled, err := CompileResponse(config)
+	if err != nil {
+		return body, headers, err
+	}
+	return e.ApplyResponse(body, statusCode, headers, compiled)
+}
+
+// ApplyRequest applies compiled transformations to the request
+func (e *Engine) ApplyRequest(req *http.Request, t *CompiledRequest) error {
+	return e.ApplyRequestWith(req, t, nil)
+}
+
+// ApplyRequestWith applies compiled transformations and the request template
+// of m to the request. Either may be nil.
+func (e *Engine) ApplyRequestWith(req *http.Request, t *CompiledRequest, m *TemplateMatch) error {
+	if t == nil && m == nil {
+		return nil
+	}
+	if t == nil {
+		t = &CompiledRequest{}
+	}
+
+	// Transform headers
+	if err := e.transformHeaders(req.Header, t.headers); err != nil {
+		return fmt.Errorf("failed to transform headers: %w", err)
+	}
+
+	// Transform query parameters
+	if err := e.transformQueryParams(req.URL, t.query); err != nil {
+		return fmt.Errorf("failed to transform query params: %w", err)
+	}
+
+	// Transform body if present
+	rewrite := m != nil && m.rule.request != nil
+	if (t.body != nil || t.convert != "" || rewrite) && req.Body != nil {
+		if err := e.transformBody(req, t, m); err != nil {
+			return fmt.Errorf("failed to transform body: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyResponse applies compiled transformations to the response
+func (e *Engine) ApplyResponse(body []byte, statusCode int, headers http.Header, t *CompiledResponse) ([]byte, http.Header, error) {
+	return e.ApplyResponseWith(body, statusCode, headers, t, nil)
+}
+
+// ApplyResponseWith applies compiled transformations and the response
+// template of m to the response. Either may be nil.
+func (e *Engine) ApplyResponseWith(body []byte, statusCode int, headers http.Header, t *CompiledResponse, m *TemplateMatch) ([]byte, http.Header, error) {
+	if t == nil && !m.RewritesResponse() {
+		return body, headers, nil
+	}
+	if t == nil {
+		t = &CompiledResponse{}
+	}
+
+	// Transform headers
+	transformedHeaders := headers.Clone()
+	if err := e.transformHeaders(transformedHeaders, t.headers); err != nil {
+		return body, headers, fmt.Errorf("failed to transform headers: %w", err)
+	}
+
+	// Templates work on JSON, so XML is converted before them and JSON after
+	transformed := body
+	contentType := headers.Get("Content-Type")
+	var err error
+	if t.convert == ConvertXMLToJSON {
+		if transformed, contentType, err = convertBody(transformed, contentType, t.convert, t.xml); err != nil {
+			return body, headers, fmt.Errorf("failed to convert body: %w", err)
+		}
+	}
+	if t.body != nil {
+		if transformed, err = e.applyBodyTemplate(transformed, statusCode, t.body); err != nil {
+			return body, headers, fmt.Errorf("failed to transform body: %w", err)
+		}
+	}
+	if m.RewritesResponse() {
+		if transformed, err = m.renderResponse(transformed, statusCode, transformedHeaders); err != nil {
+			return body, headers, fmt.Errorf("failed to render body template: %w", err)
+		}
+	}
+	if t.convert == ConvertJSONToXML {
+		if transformed, contentType, err = convertBody(transformed, contentType, t.convert, t.xml); err != nil {
+			return body, headers, fmt.Errorf("failed to convert body: %w", err)
+		}
+	}
+
+	if t.body != nil || t.convert != "" || m.RewritesResponse() {
+		// The upstream's length no longer applies
+		transformedHeaders.Del("Content-Length")
+		if contentType != "" {
+			transformedHeaders.Set("Content-Type", contentType)
+		}
+	}
+	return transformed, transformedHeaders, nil
 }
 
 // transformHeaders applies template transformations to headers
-func (e *Engine) transformHeaders(headers http.Header, transforms map[string]string) error {
-if len(transforms) == 0 {
-return nil
-}
-
-// Create template data from existing headers
-data := make(map[string]interface{})
-for key, values := range headers {
-if len(values) > 0 {
-data[key] = values[0]
-}
-}
-
-for key, tmplStr := range transforms {
-value, err := e.executeTemplate(tmplStr, data)
-if err != nil {
-return fmt.Errorf("failed to transform header %s: %w", key, err)
-}
-headers.Set(key, value)
-}
-
-return nil
+func (e *Engine) transformHeaders(headers http.Header, transforms []namedTemplate) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+
+	// Create template data from existing headers
+	data := make(map[string]interface{}, len(headers))
+	for key, values := range headers {
+		if len(values) > 0 {
+			data[key] = values[0]
+		}
+	}
+
+	for _, t := range transforms {
+		value, err := executeTemplate(t.tmpl, data)
+		if err != nil {
+			return fmt.Errorf("failed to transform header %s: %w", t.name, err)
+		}
+		headers.Set(t.name, value)
+	}
+
+	return nil
 }
 
 // transformQueryParams applies template transformations to query parameters
-func (e *Engine) transformQueryParams(u *url.URL, transforms map[string]string) error {
-if len(transforms) == 0 {
-return nil
-}
-
-query := u.Query()
-
-// Create template data from existing query params
-data := make(map[string]interface{})
-for key, values := range query {
-if len(values) > 0 {
-data[key] = values[0]
-}
-}
-
-for key, tmplStr := range transforms {
-value, err := e.executeTemplate(tmplStr, data)
-if err != nil {
-return fmt.Errorf("failed to transform query param %s: %w", key, err)
-}
-query.Set(key, value)
-}
-
-u.RawQuery = query.Encode()
-return nil
-}
-
-// transformBody applies template transformation to request body
-func (e *Engine) transformBody(req *http.Request, tmplStr string) error {
-// Read body
-bodyBytes, err := io.ReadAll(req.Body)
-if err != nil {
-return fmt.Errorf("failed to read body: %w", err)
-}
-
-// Parse as JSON for template data
-var data map[string]interface{}
-if len(bodyBytes) > 0 {
-if err := json.Unmarshal(bodyBytes, &data); err != nil {
-// If not JSON, use raw body as string
-data = map[string]interface{}{"body": string(bodyBytes)}
-}
-}
-
-// Apply template
-result, err := e.executeTemplate(tmplStr, data)
-if err != nil {
-return fmt.Errorf("failed to execute template: %w", err)
-}
-
-// Set new body
-req.Body = io.NopCloser(strings.NewReader(result))
-req.ContentLength = int64(len(result))
-
-return nil
+func (e *Engine) transformQueryParams(u *url.URL, transforms []namedTemplate) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+
+	query := u.Query()
+
+	// Create template data from existing query params
+	data := make(map[string]interface{}, len(query))
+	for key, values := range query {
+		if len(values) > 0 {
+			data[key] = values[0]
+		}
+	}
+
+	for _, t := range transforms {
+		value, err := executeTemplate(t.tmpl, data)
+		if err != nil {
+			return fmt.Errorf("failed to transform query param %s: %w", t.name, err)
+		}
+		query.Set(t.name, value)
+	}
+
+	u.RawQuery = query.Encode()
+	return nil
+}
+
+// transformBody converts the request body and applies its templates. The
+// original body is sent if that fails.
+func (e *Engine) transformBody(req *http.Request, t *CompiledRequest, m *TemplateMatch) error {
+	// Read body
+	original, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+
+	body, contentType, err := e.requestBody(original, req.Header, t, m)
+	if err != nil {
+		body = original
+	} else if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Set new body; retries resend the transformed one
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Del("Content-Length")
+
+	return err
+}
+
+// requestBody returns the transformed body and its content type
+func (e *Engine) requestBody(body []byte, headers http.Header, t *CompiledRequest, m *TemplateMatch) ([]byte, string, error) {
+	// Templates work on JSON, so XML is converted before them and JSON after
+	contentType := headers.Get("Content-Type")
+	var err error
+	if t.convert == ConvertXMLToJSON {
+		if body, contentType, err = convertBody(body, contentType, t.convert, t.xml); err != nil {
+			return nil, "", fmt.Errorf("failed to convert body: %w", err)
+		}
+	}
+
+	if t.body != nil {
+		// Parse as JSON for template data
+		var data map[string]interface{}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &data); err != nil {
+				// If not JSON, use raw body as string
+				data = map[string]interface{}{"body": string(body)}
+			}
+		}
+
+		// Apply template
+		result, err := executeTemplate(t.body, data)
+		if err != nil {
+			return nil, "", err
+		}
+		body = []byte(result)
+	}
+	if m != nil && m.rule.request != nil {
+		if body, err = m.renderRequest(body, headers); err != nil {
+			return nil, "", fmt.Errorf("failed to render body template: %w", err)
+		}
+	}
+
+	if t.convert == ConvertJSONToXML {
+		if body, contentType, err = convertBody(body, contentType, t.convert, t.xml); err != nil {
+			return nil, "", fmt.Errorf("failed to convert body: %w", err)
+		}
+	}
+	return body, contentType, nil
 }
 
 // applyBodyTemplate applies template to response body
-func (e *Engine) applyBodyTemplate(body []byte, statusCode int, tmplStr string) ([]byte, error) {
-// Parse body as JSON for template data
-var data map[string]interface{}
-if len(body) > 0 {
-if err := json.Unmarshal(body, &data); err != nil {
-// If not JSON, use raw body
-data = map[string]interface{}{
-"body":       string(body),
-"statusCode": statusCode,
-}
-} else {
-data["statusCode"] = statusCode
-}
-} else {
-data = map[string]interface{}{"statusCode": statusCode}
-}
-
-result, err := e.executeTemplate(tmplStr, data)
-if err != nil {
-return nil, err
-}
-
-return []byte(result), nil
-}
-
-// executeTemplate executes a Go template with the given data
-func (e *Engine) executeTemplate(tmplStr string, data interface{}) (string, error) {
-// Create template with helper functions
-tmpl, err := template.New("transform").Funcs(templateFuncs()).Parse(tmplStr)
-if err != nil {
-return "", fmt.Errorf("failed to parse template: %w", err)
-}
-
-var buf bytes.Buffer
-if err := tmpl.Execute(&buf, data); err != nil {
-return "", fmt.Errorf("failed to execute template: %w", err)
-}
-
-return buf.String(), nil
+func (e *Engine) applyBodyTemplate(body []byte, statusCode int, tmpl *template.Template) ([]byte, error) {
+	// Parse body as JSON for template data
+	var data map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &data); err != nil {
+			// If not JSON, use raw body
+			data = map[string]interface{}{
+				"body":       string(body),
+				"statusCode": statusCode,
+			}
+		} else {
+			data["statusCode"] = statusCode
+		}
+	} else {
+		data = map[string]interface{}{"statusCode": statusCode}
+	}
+
+	result, err := executeTemplate(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(result), nil
+}
+
+// executeTemplate executes a compiled template with the given data
+func executeTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return buf.String(), nil
 }
 
 // templateFuncs returns helper functions for templates
 func templateFuncs() template.FuncMap {
-return template.FuncMap{
-"upper":    strings.ToUpper,
-"lower":    strings.ToLower,
-"title":    strings.Title,
-"trim":     strings.TrimSpace,
-"replace":  strings.ReplaceAll,
-"contains": strings.Contains,
-"split":    strings.Split,
-"join":     strings.Join,
-"default": func(defaultVal, val interface{}) interface{} {
-if val == nil || val == "" {
-return defaultVal
-}
-return val
-},
-"toJson": func(v interface{}) string {
-b, _ := json.Marshal(v)
-return string(b)
-},
-"fromJson": func(s string) map[string]interface{} {
-var m map[string]interface{}
-json.Unmarshal([]byte(s), &m)
-return m
-},
-}
+	return template.FuncMap{
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"title":    strings.Title,
+		"trim":     strings.TrimSpace,
+		"replace":  strings.ReplaceAll,
+		"contains": strings.Contains,
+		"split":    strings.Split,
+		"join":     strings.Join,
+		"default": func(defaultVal, val interface{}) interface{} {
+			if val == nil || val == "" {
+				return defaultVal
+			}
+			return val
+		},
+		"toJson": func(v interface{}) string {
+			b, _ := json.Marshal(v)
+			return string(b)
+		},
+		"fromJson": func(s string) map[string]interface{} {
+			var m map[string]interface{}
+			json.Unmarshal([]byte(s), &m)
+			return m
+		},
+	}
 }
@@ -0,0 +1,158 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FieldRule keeps only Fields of the JSON responses to the requests matching
+// Method and Path
+type FieldRule struct {
+	Method string // default: any method
+	Path   string // Request path; {name} segments match any value (default: any path)
+	// Fields are dotted paths such as $.user.id. Arrays are filtered item
+	// by item, so items.id and items[*].id both keep the id of each item.
+	Fields []string
+}
+
+// fieldNode is a level of an allow-list; a node without children keeps the
+// whole value
+type fieldNode map[string]fieldNode
+
+type fieldRule struct {
+	method   string
+	segments []string
+	allowed  fieldNode
+}
+
+// FieldRules are compiled field rules
+type FieldRules struct {
+	rules []fieldRule
+}
+
+// FieldFilter is the allow-list of a response
+type FieldFilter struct {
+	allowed fieldNode
+}
+
+// CompileFieldRules parses the fields of rules
+func CompileFieldRules(rules []FieldRule) (*FieldRules, error) {
+	r := &FieldRules{}
+	for i, rule := range rules {
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("field rule %d: fields cannot be empty", i)
+		}
+		allowed := fieldNode{}
+		for _, field := range rule.Fields {
+			segments, err := fieldSegments(field)
+			if err != nil {
+				return nil, fmt.Errorf("field rule %d: %w", i, err)
+			}
+			node := allowed
+			for _, segment := range segments {
+				next, ok := node[segment]
+				if !ok {
+					next = fieldNode{}
+					node[segment] = next
+				}
+				node = next
+			}
+		}
+		r.rules = append(r.rules, fieldRule{method: rule.Method, segments: splitPath(rule.Path), allowed: allowed})
+	}
+	return r, nil
+}
+
+func fieldSegments(field string) ([]string, error) {
+	expr := strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	expr = strings.ReplaceAll(expr, "[*]", "")
+	if expr == "" {
+		return nil, fmt.Errorf("invalid field %q", field)
+	}
+	segments := strings.Split(expr, ".")
+	for _, segment := range segments {
+		if segment == "" || strings.ContainsAny(segment, "[]") {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+	}
+	return segments, nil
+}
+
+// Match returns the filter of the first rule matching the client's request,
+// or nil
+func (r *FieldRules) Match(req *http.Request) *FieldFilter {
+	if r == nil {
+		return nil
+	}
+	segments := splitPath(req.URL.Path)
+	for _, rule := range r.rules {
+		if rule.method != "" && !strings.EqualFold(rule.method, req.Method) {
+			continue
+		}
+		if _, ok := matchSegments(rule.segments, segments); ok {
+			return &FieldFilter{allowed: rule.allowed}
+		}
+	}
+	return nil
+}
+
+// Apply removes the fields of a JSON body that are not allowed
+func (f *FieldFilter) Apply(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	filtered, ok := filterFields(value, f.allowed)
+	if !ok {
+		filtered = map[string]interface{}{}
+	}
+	if err := encoder.Encode(filtered); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Filters reports whether the filter applies to a body of contentType
+func (f *FieldFilter) Filters(contentType string) bool {
+	return f != nil && isJSONType(contentType)
+}
+
+// filterFields returns the allowed part of value, and false when nothing of
+// it is allowed
+func filterFields(value interface{}, allowed fieldNode) (interface{}, bool) {
+	if len(allowed) == 0 {
+		return value, true
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filtered := make(map[string]interface{}, len(allowed))
+		for key, node := range allowed {
+			if child, ok := v[key]; ok {
+				if kept, ok := filterFields(child, node); ok {
+					filtered[key] = kept
+				}
+			}
+		}
+		return filtered, true
+	case []interface{}:
+		filtered := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if kept, ok := filterFields(item, allowed); ok {
+				filtered = append(filtered, kept)
+			}
+		}
+		return filtered, true
+	default:
+		// Scalars have no fields to keep
+		return nil, false
+	}
+}
@@ -0,0 +1,150 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Header rule actions
+const (
+	HeaderAdd            = "add"
+	HeaderSet            = "set"
+	HeaderRemove         = "remove"
+	HeaderRename         = "rename"
+	HeaderCopyFromClaim  = "copy-from-claim"
+	HeaderCopyFromHeader = "copy-from-header"
+)
+
+// HeaderRule changes a header of the requests matching Method and Path, or
+// of their responses
+type HeaderRule struct {
+	Action string // One of the Header actions
+	Name   string // Header changed
+	Value  string // Value added or set
+	// From is the header renamed, the claim copied, e.g. sub or org.id, or
+	// the client request header copied
+	From   string
+	Method string // default: any method
+	Path   string // Request path; {name} segments match any value (default: any path)
+}
+
+type headerRule struct {
+	HeaderRule
+	claim    Path
+	segments []string
+}
+
+// HeaderRules are compiled header rules, applied in order
+type HeaderRules struct {
+	request  []headerRule
+	response []headerRule
+}
+
+// CompileHeaderRules checks the rules applied to requests and to responses
+func CompileHeaderRules(request, response []HeaderRule) (*HeaderRules, error) {
+	r := &HeaderRules{}
+	var err error
+	if r.request, err = compileHeaderRules("request", request); err != nil {
+		return nil, err
+	}
+	if r.response, err = compileHeaderRules("response", response); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func compileHeaderRules(kind string, rules []HeaderRule) ([]headerRule, error) {
+	compiled := make([]headerRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s header rule %d: name cannot be empty", kind, i)
+		}
+		switch rule.Action {
+		case HeaderAdd, HeaderSet, HeaderRemove:
+		case HeaderRename, HeaderCopyFromClaim, HeaderCopyFromHeader:
+			if rule.From == "" {
+				return nil, fmt.Errorf("%s header rule %d: from is required for %s", kind, i, rule.Action)
+			}
+		default:
+			return nil, fmt.Errorf("%s header rule %d: unknown action %q", kind, i, rule.Action)
+		}
+		compiled = append(compiled, headerRule{
+			HeaderRule: rule,
+			claim:      CompilePath(rule.From),
+			segments:   splitPath(rule.Path),
+		})
+	}
+	return compiled, nil
+}
+
+// ApplyRequest applies the request rules matching client to headers, the
+// headers of the upstream request. claims may be nil.
+func (r *HeaderRules) ApplyRequest(headers http.Header, client *http.Request, claims map[string]interface{}) {
+	applyHeaderRules(r.request, headers, client, claims)
+}
+
+// ApplyResponse applies the response rules matching client to headers,
+// the headers of the response to it. claims may be nil.
+func (r *HeaderRules) ApplyResponse(headers http.Header, client *http.Request, claims map[string]interface{}) {
+	applyHeaderRules(r.response, headers, client, claims)
+}
+
+func applyHeaderRules(rules []headerRule, headers http.Header, client *http.Request, claims map[string]interface{}) {
+	if len(rules) == 0 {
+		return
+	}
+	segments := splitPath(client.URL.Path)
+	for _, rule := range rules {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, client.Method) {
+			continue
+		}
+		if _, ok := matchSegments(rule.segments, segments); !ok {
+			continue
+		}
+
+		switch rule.Action {
+		case HeaderAdd:
+			headers.Add(rule.Name, rule.Value)
+		case HeaderSet:
+			headers.Set(rule.Name, rule.Value)
+		case HeaderRemove:
+			headers.Del(rule.Name)
+		case HeaderRename:
+			if values := headers.Values(rule.From); len(values) > 0 {
+				values = append([]string(nil), values...)
+				headers.Del(rule.From)
+				headers[http.CanonicalHeaderKey(rule.Name)] = values
+			}
+		case HeaderCopyFromClaim:
+			if value, ok := claimValue(rule.claim, claims); ok {
+				headers.Set(rule.Name, value)
+			}
+		case HeaderCopyFromHeader:
+			if value := client.Header.Get(rule.From); value != "" {
+				headers.Set(rule.Name, value)
+			}
+		}
+	}
+}
+
+// claimValue formats a claim as a header value: strings as they are, other
+// values as JSON
+func claimValue(path Path, claims map[string]interface{}) (string, bool) {
+	if claims == nil {
+		return "", false
+	}
+	value, ok := path.Get(claims)
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, s != ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,62 @@
+package transform
+
+import "strings"
+
+// Path is a dotted field path such as $.user.id, split once so lookups only
+// walk maps. "$" and the empty path denote the whole document.
+type Path struct {
+	segments []string
+}
+
+// CompilePath splits expr into a Path
+func CompilePath(expr string) Path {
+	expr = strings.TrimPrefix(expr, "$.")
+	if expr == "" || expr == "$" {
+		return Path{}
+	}
+	return Path{segments: strings.Split(expr, ".")}
+}
+
+// IsRoot reports whether the path denotes the whole document
+func (p Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// Get returns the value at the path. Intermediate values must be objects.
+func (p Path) Get(data map[string]interface{}) (interface{}, bool) {
+	if p.IsRoot() {
+		return data, true
+	}
+
+	current := data
+	last := len(p.segments) - 1
+	for _, key := range p.segments[:last] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	value, ok := current[p.segments[last]]
+	return value, ok
+}
+
+// Set stores value at the path, creating or replacing intermediate objects
+// as needed. Setting the root does nothing.
+func (p Path) Set(data map[string]interface{}, value interface{}) {
+	if p.IsRoot() {
+		return
+	}
+
+	current := data
+	last := len(p.segments) - 1
+	for _, key := range p.segments[:last] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[p.segments[last]] = value
+}
@@ -0,0 +1,186 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// TemplateRule rewrites the bodies of the requests matching Method and Path
+// with Go templates. Unlike the Body templates of RequestTransform and
+// ResponseTransform, these see the request's headers, path parameters,
+// query parameters and claims next to the body.
+type TemplateRule struct {
+	Method   string // default: any method
+	Path     string // Request path; {name} segments match any value (default: any path)
+	Request  string // Template of the request body sent to the service
+	Response string // Template of the response body sent to the client
+}
+
+type templateRule struct {
+	method   string
+	segments []string
+	request  *template.Template
+	response *template.Template
+}
+
+// Templates are compiled template rules
+type Templates struct {
+	rules []*templateRule
+}
+
+// CompileTemplates parses the templates of rules
+func CompileTemplates(rules []TemplateRule) (*Templates, error) {
+	t := &Templates{}
+	for i, rule := range rules {
+		if rule.Request == "" && rule.Response == "" {
+			return nil, fmt.Errorf("template %d: request or response must be set", i)
+		}
+		compiled := &templateRule{method: rule.Method, segments: splitPath(rule.Path)}
+		var err error
+		if compiled.request, err = compileBody(rule.Request); err != nil {
+			return nil, fmt.Errorf("template %d: request %w", i, err)
+		}
+		if compiled.response, err = compileBody(rule.Response); err != nil {
+			return nil, fmt.Errorf("template %d: response %w", i, err)
+		}
+		t.rules = append(t.rules, compiled)
+	}
+	return t, nil
+}
+
+// TemplateMatch is the rule of a request with what its templates see of the
+// client's request
+type TemplateMatch struct {
+	rule    *templateRule
+	params  map[string]interface{}
+	query   map[string]interface{}
+	headers map[string]interface{}
+	claims  map[string]interface{}
+}
+
+// Match returns the first rule matching the client's request, or nil.
+// claims are the authenticated client's and may be nil.
+func (t *Templates) Match(req *http.Request, claims map[string]interface{}) *TemplateMatch {
+	segments := splitPath(req.URL.Path)
+	for _, rule := range t.rules {
+		if rule.method != "" && !strings.EqualFold(rule.method, req.Method) {
+			continue
+		}
+		params, ok := matchSegments(rule.segments, segments)
+		if !ok {
+			continue
+		}
+
+		query := make(map[string]interface{})
+		for name, values := range req.URL.Query() {
+			query[name] = values[0]
+		}
+		if claims == nil {
+			claims = map[string]interface{}{}
+		}
+		return &TemplateMatch{
+			rule:    rule,
+			params:  params,
+			query:   query,
+			headers: firstValues(req.Header),
+			claims:  claims,
+		}
+	}
+	return nil
+}
+
+// RewritesResponse reports whether the rule has a response template
+func (m *TemplateMatch) RewritesResponse() bool {
+	return m != nil && m.rule.response != nil
+}
+
+// renderRequest renders the request template over body
+func (m *TemplateMatch) renderRequest(body []byte, headers http.Header) ([]byte, error) {
+	return m.render(m.rule.request, map[string]interface{}{
+		"body":    decodeBody(body),
+		"headers": firstValues(headers),
+		"params":  m.params,
+		"query":   m.query,
+		"claims":  m.claims,
+	})
+}
+
+// renderResponse renders the response template over body. headers are the
+// response's; the request's are not available.
+func (m *TemplateMatch) renderResponse(body []byte, statusCode int, headers http.Header) ([]byte, error) {
+	return m.render(m.rule.response, map[string]interface{}{
+		"body":    decodeBody(body),
+		"status":  statusCode,
+		"headers": firstValues(headers),
+		"params":  m.params,
+		"query":   m.query,
+		"claims":  m.claims,
+	})
+}
+
+func (m *TemplateMatch) render(tmpl *template.Template, data map[string]interface{}) ([]byte, error) {
+	result, err := executeTemplate(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+// decodeBody returns a JSON body as a value, keeping numbers as written,
+// and other bodies as a string
+func decodeBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return string(body)
+	}
+	return value
+}
+
+func firstValues(header http.Header) map[string]interface{} {
+	values := make(map[string]interface{}, len(header))
+	for name, v := range header {
+		if len(v) > 0 {
+			values[name] = v[0]
+		}
+	}
+	return values
+}
+
+// matchSegments matches a request path against a rule's, whose {name}
+// segments match any value. A rule without segments matches every path.
+func matchSegments(rule, path []string) (map[string]interface{}, bool) {
+	params := make(map[string]interface{})
+	if len(rule) == 0 {
+		return params, true
+	}
+	if len(rule) != len(path) {
+		return nil, false
+	}
+	for i, segment := range rule {
+		if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
@@ -2,13 +2,19 @@ package transform
 
 // RequestTransform defines transformations to apply to requests
 type RequestTransform struct {
-Headers     map[string]string
-QueryParams map[string]string
-Body        string
+	Headers     map[string]string
+	QueryParams map[string]string
+	Body        string
+	// Convert converts the body between XML and JSON: ConvertXMLToJSON or
+	// ConvertJSONToXML. The Body template always sees JSON.
+	Convert string
+	XML     XMLOptions
 }
 
 // ResponseTransform defines transformations to apply to responses
 type ResponseTransform struct {
-Headers map[string]string
-Body    string
+	Headers map[string]string
+	Body    string
+	Convert string // See RequestTransform
+	XML     XMLOptions
 }
@@ -0,0 +1,385 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Body conversions between XML and JSON
+const (
+	ConvertXMLToJSON = "xml-to-json"
+	ConvertJSONToXML = "json-to-xml"
+)
+
+// XMLOptions control how bodies are converted between XML and JSON
+type XMLOptions struct {
+	// AttributePrefix marks the JSON keys holding attributes (default: "@")
+	AttributePrefix string
+	// TextKey holds the text of elements that also have attributes or
+	// children (default: "#text")
+	TextKey string
+	// KeepNamespaces keeps namespace prefixes in names and xmlns attributes
+	// in JSON instead of dropping them
+	KeepNamespaces bool
+	// Namespace is declared as the default namespace of the XML root element
+	Namespace string
+	// RootElement wraps the XML produced, and is unwrapped from the XML
+	// read. When empty, JSON objects with a single key use it as the root
+	// and other JSON is wrapped in "root".
+	RootElement string
+	// ContentType is the content type of XML produced (default: application/xml)
+	ContentType string
+}
+
+func (o XMLOptions) withDefaults() XMLOptions {
+	if o.AttributePrefix == "" {
+		o.AttributePrefix = "@"
+	}
+	if o.TextKey == "" {
+		o.TextKey = "#text"
+	}
+	if o.ContentType == "" {
+		o.ContentType = "application/xml"
+	}
+	return o
+}
+
+func validConversion(convert string) error {
+	switch convert {
+	case "", ConvertXMLToJSON, ConvertJSONToXML:
+		return nil
+	default:
+		return fmt.Errorf("unknown conversion %q (expected %s or %s)", convert, ConvertXMLToJSON, ConvertJSONToXML)
+	}
+}
+
+// XMLToJSON converts an XML document to JSON. Elements become objects keyed
+// by child name, repeated children become arrays and text becomes strings.
+func XMLToJSON(data []byte, opts XMLOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			return nil, errors.New("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue // Declaration, comments and whitespace before the root
+		}
+
+		value, err := xmlElement(dec, start, opts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.RootElement == "" {
+			value = map[string]interface{}{xmlName(start.Name, opts): value}
+		}
+		return json.Marshal(value)
+	}
+}
+
+// xmlElement reads the content of start up to its end element
+func xmlElement(dec *xml.Decoder, start xml.StartElement, opts XMLOptions) (interface{}, error) {
+	obj := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		isNamespace := attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+		if isNamespace && !opts.KeepNamespaces {
+			continue
+		}
+		obj[opts.AttributePrefix+xmlName(attr.Name, opts)] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := xmlElement(dec, t, opts)
+			if err != nil {
+				return nil, err
+			}
+			name := xmlName(t.Name, opts)
+			switch existing := obj[name].(type) {
+			case nil:
+				obj[name] = child
+			case []interface{}:
+				obj[name] = append(existing, child)
+			default:
+				obj[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if t.Name != start.Name {
+				return nil, fmt.Errorf("element <%s> closed by </%s>", xmlName(start.Name, opts), xmlName(t.Name, opts))
+			}
+			content := strings.TrimSpace(text.String())
+			if len(obj) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				obj[opts.TextKey] = content
+			}
+			return obj, nil
+		}
+	}
+}
+
+// xmlName returns the JSON key of an element or attribute name, whose Space
+// is its namespace prefix
+func xmlName(name xml.Name, opts XMLOptions) string {
+	if opts.KeepNamespaces && name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// jsonField is a key of a JSON object, kept in document order since XML
+// schemas often require elements in a given order
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+type jsonObject []jsonField
+
+// JSONToXML converts a JSON document to XML. Objects become elements, arrays
+// become repeated elements and keys starting with the attribute prefix
+// become attributes.
+func JSONToXML(data []byte, opts XMLOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	root := opts.RootElement
+	if root == "" {
+		root = "root"
+		if obj, ok := value.(jsonObject); ok && len(obj) == 1 && !strings.HasPrefix(obj[0].key, opts.AttributePrefix) {
+			root, value = obj[0].key, obj[0].value
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := writeXMLElement(enc, root, value, true, opts); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered decodes the next JSON value, keeping the order of keys
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{key: key.(string), value: value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+func writeXMLElement(enc *xml.Encoder, name string, value interface{}, root bool, opts XMLOptions) error {
+	// Arrays repeat their element, except at the root which must be single
+	if arr, ok := value.([]interface{}); ok && !root {
+		for _, item := range arr {
+			if err := writeXMLElement(enc, name, item, false, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !isXMLName(name) {
+		return fmt.Errorf("%q is not a valid XML name", name)
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if root && opts.Namespace != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: opts.Namespace})
+	}
+	obj, _ := value.(jsonObject)
+	for _, field := range obj {
+		if field.key == opts.TextKey || !strings.HasPrefix(field.key, opts.AttributePrefix) {
+			continue
+		}
+		attr := strings.TrimPrefix(field.key, opts.AttributePrefix)
+		if !isXMLName(attr) {
+			return fmt.Errorf("%q is not a valid XML name", attr)
+		}
+		text, err := xmlText(field.value)
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", attr, err)
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: text})
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case jsonObject:
+		for _, field := range v {
+			if field.key == opts.TextKey {
+				text, err := xmlText(field.value)
+				if err != nil {
+					return fmt.Errorf("element %s: %w", name, err)
+				}
+				if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+					return err
+				}
+				continue
+			}
+			if strings.HasPrefix(field.key, opts.AttributePrefix) {
+				continue
+			}
+			if err := writeXMLElement(enc, field.key, field.value, false, opts); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXMLElement(enc, "item", item, false, opts); err != nil {
+				return err
+			}
+		}
+	default:
+		text, err := xmlText(v)
+		if err != nil {
+			return fmt.Errorf("element %s: %w", name, err)
+		}
+		if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlText formats a JSON scalar as XML text; null is empty
+func xmlText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", errors.New("objects and arrays cannot be text")
+	}
+}
+
+// isXMLName reports whether name can be used as an element or attribute
+// name; prefixes such as soap:Envelope are allowed
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' || r == ':' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// isXMLType and isJSONType report whether a body of contentType can be
+// converted; bodies without a content type are tried
+func isXMLType(contentType string) bool {
+	mediaType := parseMediaType(contentType)
+	return mediaType == "" || mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+func isJSONType(contentType string) bool {
+	mediaType := parseMediaType(contentType)
+	return mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func parseMediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
+
+// convertBody applies conversion to body if its content type matches, and
+// returns the body with its new content type
+func convertBody(body []byte, contentType, conversion string, opts XMLOptions) ([]byte, string, error) {
+	switch {
+	case len(body) == 0:
+	case conversion == ConvertXMLToJSON && isXMLType(contentType):
+		converted, err := XMLToJSON(body, opts)
+		return converted, "application/json", err
+	case conversion == ConvertJSONToXML && isJSONType(contentType):
+		converted, err := JSONToXML(body, opts)
+		return converted, opts.ContentType, err
+	}
+	return body, contentType, nil
+}
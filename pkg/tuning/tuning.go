@@ -0,0 +1,146 @@
+// Package tuning adapts the Go runtime to the CPU and memory limits of the
+// container the gateway runs in. The Go runtime already derives GOMAXPROCS
+// from the cgroup CPU limit; the soft memory limit is derived here, since
+// without one the garbage collector lets the heap grow until the kernel
+// kills the process.
+package tuning
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"odin/pkg/config"
+)
+
+// CgroupRoot is where the cgroup filesystem of the process is mounted
+const CgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited is the smallest value cgroup v1 reports for "no limit"
+const cgroupV1Unlimited = 1 << 62
+
+// Limits are the resources a cgroup grants the process. Zero means
+// unlimited.
+type Limits struct {
+	CPU    float64 `json:"cpu"`    // CPUs worth of time per period
+	Memory int64   `json:"memory"` // bytes
+}
+
+// Settings describe the effective runtime values and where they came from
+type Settings struct {
+	GOMAXPROCS        int    `json:"gomaxprocs"`
+	GOMAXPROCSSource  string `json:"gomaxprocsSource"`
+	NumCPU            int    `json:"numCpu"`
+	MemoryLimit       int64  `json:"memoryLimit"` // bytes, 0 when unlimited
+	MemoryLimitSource string `json:"memoryLimitSource"`
+	Cgroup            Limits `json:"cgroup"`
+}
+
+// Apply sets GOMAXPROCS and the soft memory limit from cfg and the cgroup
+// limits, unless the environment already sets them
+func Apply(cfg config.RuntimeConfig) (Settings, error) {
+	limits := Detect(cgroupDir())
+
+	procsSource := "runtime"
+	if os.Getenv("GOMAXPROCS") != "" {
+		procsSource = "GOMAXPROCS"
+	} else if cfg.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.MaxProcs)
+		procsSource = "config"
+	}
+
+	memorySource := "none"
+	configured, err := cfg.MemoryLimitBytes()
+	if err != nil {
+		return Settings{}, err
+	}
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		memorySource = "GOMEMLIMIT"
+	case configured > 0:
+		debug.SetMemoryLimit(configured)
+		memorySource = "config"
+	case configured == 0 && limits.Memory > 0 && cfg.MemoryLimitRatio > 0:
+		debug.SetMemoryLimit(int64(float64(limits.Memory) * cfg.MemoryLimitRatio))
+		memorySource = "cgroup"
+	}
+
+	settings := Current()
+	settings.GOMAXPROCSSource = procsSource
+	settings.MemoryLimitSource = memorySource
+	return settings, nil
+}
+
+// Current reports the runtime values in effect and the cgroup limits
+func Current() Settings {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = 0
+	}
+	return Settings{
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		NumCPU:      runtime.NumCPU(),
+		MemoryLimit: limit,
+		Cgroup:      Detect(cgroupDir()),
+	}
+}
+
+// Detect reads the CPU and memory limits from the cgroup filesystem mounted
+// at root, trying cgroup v2 before v1. Limits that cannot be read are
+// reported as unlimited.
+func Detect(root string) Limits {
+	var limits Limits
+
+	if fields := strings.Fields(readFile(filepath.Join(root, "cpu.max"))); len(fields) == 2 {
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+			limits.CPU = quota / period
+		}
+	} else {
+		quota, err1 := strconv.ParseFloat(readFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us")), 64)
+		period, err2 := strconv.ParseFloat(readFile(filepath.Join(root, "cpu", "cpu.cfs_period_us")), 64)
+		if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+			limits.CPU = quota / period
+		}
+	}
+
+	if value := readFile(filepath.Join(root, "memory.max")); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+			limits.Memory = n
+		}
+	} else {
+		value := readFile(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 && n < cgroupV1Unlimited {
+			limits.Memory = n
+		}
+	}
+
+	return limits
+}
+
+// cgroupDir is the cgroup v2 directory of this process, e.g. that of its
+// systemd unit. Inside a container it is the root of the mount.
+func cgroupDir() string {
+	for _, line := range strings.Split(readFile("/proc/self/cgroup"), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			dir := filepath.Join(CgroupRoot, path)
+			if _, err := os.Stat(filepath.Join(dir, "memory.max")); err == nil {
+				return dir
+			}
+		}
+	}
+	return CgroupRoot
+}
+
+func readFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
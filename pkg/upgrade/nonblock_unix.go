@@ -0,0 +1,28 @@
+//go:build !windows
+
+package upgrade
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func setNonblock(l net.Listener) error {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("%T has no file descriptor", l)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var setErr error
+	err = raw.Control(func(fd uintptr) {
+		setErr = syscall.SetNonblock(int(fd), true)
+	})
+	if err != nil {
+		return err
+	}
+	return setErr
+}
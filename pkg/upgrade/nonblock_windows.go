@@ -0,0 +1,8 @@
+package upgrade
+
+import "net"
+
+// Listeners cannot be inherited on Windows, so there is nothing to restore
+func setNonblock(net.Listener) error {
+	return nil
+}
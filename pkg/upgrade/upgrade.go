@@ -0,0 +1,267 @@
+// Package upgrade hands the gateway's listening sockets to a new process so
+// the binary can be replaced without refusing a single connection. The old
+// process starts the new binary with its listeners as inherited file
+// descriptors, waits until the new process serves traffic and then drains.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Environment variables describing what a new process inherits
+const (
+	listenersEnv = "ODIN_UPGRADE_LISTENERS" // name=fd pairs, e.g. http=3,https=4
+	readyEnv     = "ODIN_UPGRADE_READY"     // fd to write to once serving
+)
+
+// ErrInProgress is returned when an upgrade is requested while another one
+// is still waiting for its new process
+var ErrInProgress = errors.New("an upgrade is already in progress")
+
+// filer is implemented by TCP and Unix listeners
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Upgrader creates the gateway's listeners, reusing those inherited from a
+// previous process, and starts upgrades
+type Upgrader struct {
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	active    map[string]net.Listener
+	ready     *os.File
+	upgrading bool
+	logger    *logrus.Logger
+}
+
+// New creates an upgrader and takes over any listeners passed down by a
+// previous gateway process
+func New(logger *logrus.Logger) (*Upgrader, error) {
+	u := &Upgrader{
+		inherited: make(map[string]net.Listener),
+		active:    make(map[string]net.Listener),
+		logger:    logger,
+	}
+
+	if spec := os.Getenv(listenersEnv); spec != "" {
+		for _, pair := range strings.Split(spec, ",") {
+			name, fd, err := parseFD(pair)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", listenersEnv, err)
+			}
+			file := os.NewFile(fd, name)
+			l, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to inherit listener %s: %w", name, err)
+			}
+			u.inherited[name] = l
+		}
+	}
+	if value := os.Getenv(readyEnv); value != "" {
+		fd, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", readyEnv, err)
+		}
+		u.ready = os.NewFile(uintptr(fd), "upgrade-ready")
+	}
+
+	// Processes started by this one get their own values
+	os.Unsetenv(listenersEnv)
+	os.Unsetenv(readyEnv)
+
+	return u, nil
+}
+
+// HasParent reports whether this process was started by an upgrade and has
+// not yet told the old process to drain
+func (u *Upgrader) HasParent() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ready != nil
+}
+
+// Listen returns the inherited listener called name, or a new TCP listener
+// on addr when there is none
+func (u *Upgrader) Listen(name, addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	l, ok := u.inherited[name]
+	if ok {
+		delete(u.inherited, name)
+		u.logger.WithFields(logrus.Fields{"listener": name, "addr": l.Addr()}).Info("Using listener inherited from previous process")
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	u.active[name] = l
+	return l, nil
+}
+
+// Ready tells the process that started this one to drain and exit. It is
+// called once this process serves traffic; without a parent it does nothing.
+// Inherited listeners that were not used, e.g. because TLS was turned off,
+// are closed.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for name, l := range u.inherited {
+		l.Close()
+		delete(u.inherited, name)
+	}
+
+	if u.ready == nil {
+		return nil
+	}
+	_, err := u.ready.Write([]byte{1})
+	u.ready.Close()
+	u.ready = nil
+	return err
+}
+
+// Upgrade starts the current executable with the same arguments, passing it
+// the active listeners, and waits up to timeout for it to become ready. On
+// success the caller should shut down gracefully; the new process already
+// accepts connections on the same sockets. On failure the new process is
+// stopped and this one keeps serving.
+func (u *Upgrader) Upgrade(timeout time.Duration) (*os.Process, error) {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return nil, ErrInProgress
+	}
+	u.upgrading = true
+	names := make([]string, 0, len(u.active))
+	for name := range u.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var pairs []string
+	for _, name := range names {
+		l, ok := u.active[name].(filer)
+		if !ok {
+			u.upgrading = false
+			u.mu.Unlock()
+			return nil, fmt.Errorf("listener %s cannot be handed over", name)
+		}
+		f, err := l.File()
+		if err != nil {
+			u.upgrading = false
+			u.mu.Unlock()
+			return nil, fmt.Errorf("listener %s: %w", name, err)
+		}
+		// Inherited files start at fd 3
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, 3+len(files)))
+		files = append(files, f)
+	}
+	u.mu.Unlock()
+
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(childEnv(),
+		listenersEnv+"="+strings.Join(pairs, ","),
+		fmt.Sprintf("%s=%d", readyEnv, 3+len(files)),
+	)
+
+	err = cmd.Start()
+	readyW.Close()
+	// Starting the process put the shared sockets into blocking mode, which
+	// would tie up this process's accept loops
+	for _, name := range names {
+		if err := setNonblock(u.active[name]); err != nil {
+			u.logger.WithError(err).WithField("listener", name).Warn("Failed to restore non-blocking mode")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+	u.logger.WithField("pid", cmd.Process.Pid).Info("Started new gateway process, waiting for it to become ready")
+
+	// The pipe is closed without a write if the new process exits first
+	ready := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, _ := readyR.Read(buf)
+		ready <- n == 1
+	}()
+
+	select {
+	case ok := <-ready:
+		if ok {
+			return cmd.Process, nil
+		}
+		cmd.Wait()
+		return nil, fmt.Errorf("new process exited before becoming ready: %s", cmd.ProcessState)
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("new process did not become ready within %s", timeout)
+	}
+}
+
+// childEnv is this process's environment without WATCHDOG_PID, which names
+// this process; the new one becomes systemd's main process once it is ready
+func childEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "WATCHDOG_PID=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func parseFD(pair string) (string, uintptr, error) {
+	name, value, ok := strings.Cut(pair, "=")
+	if !ok || name == "" {
+		return "", 0, fmt.Errorf("%q is not name=fd", pair)
+	}
+	fd, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("%q is not name=fd", pair)
+	}
+	return name, uintptr(fd), nil
+}
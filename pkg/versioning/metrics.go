@@ -0,0 +1,14 @@
+package versioning
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var versionRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_version_requests_total",
+		Help: "Total number of requests per service API version",
+	},
+	[]string{"service", "version", "deprecated"},
+)
@@ -0,0 +1,173 @@
+package versioning
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the echo context key the resolved *Version is stored under
+const ContextKey = "apiVersion"
+
+// versionSegment matches path segments that look like a version, so unknown
+// versions are rejected instead of being proxied to the default one
+var versionSegment = regexp.MustCompile(`^[vV]\d+(\.\d+)*$`)
+
+// Version is one version of a service's API
+type Version struct {
+	config.APIVersionConfig
+}
+
+// IsDeprecated reports whether clients are told to move off the version
+func (v *Version) IsDeprecated() bool {
+	return v.Deprecated || !v.DeprecatedAt.IsZero()
+}
+
+// Router resolves the API version of a service's requests
+type Router struct {
+	service  string
+	basePath string
+	cfg      config.VersioningConfig
+	versions map[string]*Version
+	fallback *Version
+}
+
+// NewRouter creates the version router of a service mounted at basePath
+func NewRouter(service, basePath string, cfg config.VersioningConfig) *Router {
+	r := &Router{
+		service:  service,
+		basePath: strings.TrimSuffix(basePath, "/"),
+		cfg:      cfg,
+		versions: make(map[string]*Version),
+	}
+	for _, vc := range cfg.Versions {
+		r.versions[normalize(vc.Name)] = &Version{APIVersionConfig: vc}
+	}
+	if cfg.Default != "" {
+		r.fallback = r.versions[normalize(cfg.Default)]
+	}
+	return r
+}
+
+// normalize makes v2, V2 and 2 name the same version
+func normalize(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "v")
+}
+
+// Middleware resolves the version of each request, stores it in the context
+// for the proxy and adds the version's deprecation headers to the response
+func (r *Router) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			version, err := r.Resolve(c.Request())
+			if err != nil {
+				return err
+			}
+
+			r.setHeaders(c.Response().Header(), version)
+			versionRequests.WithLabelValues(r.service, version.Name, strconv.FormatBool(version.IsDeprecated())).Inc()
+
+			if !version.Sunset.IsZero() && !time.Now().Before(version.Sunset) {
+				return echo.NewHTTPError(http.StatusGone,
+					fmt.Sprintf("API version %s was retired on %s", version.Name, version.Sunset.UTC().Format("2006-01-02")))
+			}
+
+			c.Set(ContextKey, version)
+			return next(c)
+		}
+	}
+}
+
+// Resolve returns the version req asks for, or the default version when it
+// names none. With the path strategy and stripVersion, the version segment
+// is removed from req's path.
+func (r *Router) Resolve(req *http.Request) (*Version, error) {
+	var name string
+	switch r.cfg.Strategy {
+	case "path":
+		rest := strings.TrimPrefix(req.URL.Path, r.basePath)
+		segment, remainder, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		if version, ok := r.versions[normalize(segment)]; ok && segment != "" {
+			if r.cfg.StripVersion {
+				req.URL.Path = r.basePath + "/" + remainder
+				req.URL.RawPath = ""
+			}
+			return version, nil
+		}
+		if versionSegment.MatchString(segment) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Unsupported API version %s", segment))
+		}
+	case "header":
+		name = req.Header.Get(r.cfg.Header)
+	case "mediaType":
+		name = r.mediaTypeVersion(req.Header.Get("Accept"))
+	}
+
+	if name != "" {
+		version, ok := r.versions[normalize(name)]
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unsupported API version %s", name))
+		}
+		return version, nil
+	}
+	if r.fallback == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "API version required")
+	}
+	return r.fallback, nil
+}
+
+// mediaTypeVersion finds the version in an Accept header, either as a
+// version parameter (application/json; version=2) or as a vendor media type
+// (application/vnd.acme.v2+json)
+func (r *Router) mediaTypeVersion(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if version := params["version"]; version != "" {
+			return version
+		}
+		_, subtype, _ := strings.Cut(mediaType, "/")
+		subtype, _, _ = strings.Cut(subtype, "+")
+		if !strings.HasPrefix(subtype, "vnd.") {
+			continue
+		}
+		for _, token := range strings.Split(subtype, ".") {
+			if _, ok := r.versions[normalize(token)]; ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// setHeaders names the version in the response and announces its
+// deprecation (RFC 9745) and sunset (RFC 8594)
+func (r *Router) setHeaders(header http.Header, version *Version) {
+	header.Set(r.cfg.Header, version.Name)
+	if !version.DeprecatedAt.IsZero() {
+		header.Set("Deprecation", "@"+strconv.FormatInt(version.DeprecatedAt.Unix(), 10))
+	} else if version.Deprecated {
+		header.Set("Deprecation", "true")
+	}
+	if !version.Sunset.IsZero() {
+		header.Set("Sunset", version.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if version.Link != "" {
+		if version.IsDeprecated() {
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"; type=\"text/html\"", version.Link))
+		}
+		if !version.Sunset.IsZero() {
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"sunset\"; type=\"text/html\"", version.Link))
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"regexp"
 
+	"odin/pkg/requestid"
+
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
@@ -29,7 +31,7 @@ func Middleware(runtime Runtime, logger *logrus.Logger) echo.MiddlewareFunc {
 
 			// Create plugin context
 			pluginCtx := &PluginContext{
-				RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+				RequestID: requestid.Get(c),
 				ServiceID: c.Get("service_id").(string),
 				RoutePath: c.Path(),
 				Metadata:  make(map[string]string),
@@ -282,7 +284,7 @@ func ExecutePluginHandler(runtime Runtime, logger *logrus.Logger) echo.HandlerFu
 
 		// Create context
 		pluginCtx := &PluginContext{
-			RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+			RequestID: requestid.Get(c),
 			Metadata:  make(map[string]string),
 		}
 
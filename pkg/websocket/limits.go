@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrTooManyConnections is returned when the gateway or the service holds
+	// as many connections as it may
+	ErrTooManyConnections = errors.New("too many WebSocket connections")
+	// ErrTooManyConnectionsFromIP is returned when a client address holds as
+	// many connections as it may
+	ErrTooManyConnectionsFromIP = errors.New("too many WebSocket connections from client")
+)
+
+// Limits caps open connections. Zero means no limit.
+type Limits struct {
+	MaxConnections      int `yaml:"maxConnections"`
+	MaxConnectionsPerIP int `yaml:"maxConnectionsPerIP"`
+}
+
+// connections counts the open connections of a scope, in total and by
+// client address
+type connections struct {
+	total int
+	byIP  map[string]int
+}
+
+func (c *connections) admits(limits Limits, ip string) error {
+	if limits.MaxConnections > 0 && c.total >= limits.MaxConnections {
+		return ErrTooManyConnections
+	}
+	if limits.MaxConnectionsPerIP > 0 && c.byIP[ip] >= limits.MaxConnectionsPerIP {
+		return ErrTooManyConnectionsFromIP
+	}
+	return nil
+}
+
+func (c *connections) add(ip string, n int) {
+	c.total += n
+	if c.byIP == nil {
+		c.byIP = make(map[string]int)
+	}
+	c.byIP[ip] += n
+	if c.byIP[ip] <= 0 {
+		delete(c.byIP, ip)
+	}
+}
+
+// ServiceStats are the connection counters of a service
+type ServiceStats struct {
+	Active         int    `json:"active"`
+	Accepted       uint64 `json:"accepted"`
+	Rejected       uint64 `json:"rejected"`
+	IdleClosed     uint64 `json:"idleClosed"`
+	OversizeClosed uint64 `json:"oversizeClosed"`
+}
+
+// Stats is a snapshot of the connections held by a Limiter
+type Stats struct {
+	Active   int                     `json:"active"`
+	Services map[string]ServiceStats `json:"services"`
+}
+
+// Limiter enforces connection limits for the whole gateway and for each
+// service. It is shared by the proxies of all services.
+type Limiter struct {
+	limits Limits
+
+	mu       sync.Mutex
+	global   connections
+	services map[string]*connections
+	stats    map[string]*ServiceStats
+}
+
+// NewLimiter creates a limiter enforcing limits across all services
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		services: make(map[string]*connections),
+		stats:    make(map[string]*ServiceStats),
+	}
+}
+
+// Acquire admits a connection from ip to service, which has its own limits.
+// The returned function must be called once the connection is closed.
+func (l *Limiter) Acquire(service string, limits Limits, ip string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.serviceStats(service)
+	conns := l.services[service]
+	if conns == nil {
+		conns = &connections{}
+		l.services[service] = conns
+	}
+
+	err := l.global.admits(l.limits, ip)
+	if err == nil {
+		err = conns.admits(limits, ip)
+	}
+	if err != nil {
+		stats.Rejected++
+		return nil, err
+	}
+
+	l.global.add(ip, 1)
+	conns.add(ip, 1)
+	stats.Active++
+	stats.Accepted++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.global.add(ip, -1)
+			conns.add(ip, -1)
+			stats.Active--
+		})
+	}, nil
+}
+
+// closed records that a connection to service was closed for being idle or
+// for sending a message that was too large
+func (l *Limiter) closed(service string, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch reason {
+	case closeIdle:
+		l.serviceStats(service).IdleClosed++
+	case closeTooBig:
+		l.serviceStats(service).OversizeClosed++
+	}
+}
+
+func (l *Limiter) serviceStats(service string) *ServiceStats {
+	stats := l.stats[service]
+	if stats == nil {
+		stats = &ServiceStats{}
+		l.stats[service] = stats
+	}
+	return stats
+}
+
+// Stats returns the open connections and counters of every service
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := Stats{
+		Active:   l.global.total,
+		Services: make(map[string]ServiceStats, len(l.stats)),
+	}
+	for service, s := range l.stats {
+		stats.Services[service] = *s
+	}
+	return stats
+}
@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons connections are rejected or closed by the gateway
+const (
+	rejectLimit   = "limit"
+	rejectIPLimit = "ip_limit"
+	closeIdle     = "idle"
+	closeTooBig   = "message_too_big"
+	closeShutdown = "shutdown"
+)
+
+var (
+	activeConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_websocket_connections",
+			Help: "Currently open WebSocket connections",
+		},
+		[]string{"service"},
+	)
+
+	rejectedConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_websocket_rejected_total",
+			Help: "Total number of WebSocket connections rejected by connection limits",
+		},
+		[]string{"service", "reason"},
+	)
+
+	closedConnections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_websocket_closed_total",
+			Help: "Total number of WebSocket connections closed by the gateway",
+		},
+		[]string{"service", "reason"},
+	)
+)
@@ -1,10 +1,13 @@
 package websocket
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,14 +22,20 @@ type Config struct {
 	ReadTimeout       time.Duration `yaml:"readTimeout"`
 	WriteTimeout      time.Duration `yaml:"writeTimeout"`
 	PingPeriod        time.Duration `yaml:"pingPeriod"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
 	MaxMessageSize    int64         `yaml:"maxMessageSize"`
 	EnableCompression bool          `yaml:"enableCompression"`
 }
 
 type Proxy struct {
-	config   Config
-	logger   *logrus.Logger
-	upgrader websocket.Upgrader
+	config    Config
+	logger    *logrus.Logger
+	upgrader  websocket.Upgrader
+	tlsConfig *tls.Config
+	egress    func(*http.Request) (*url.URL, error)
+	limiter   *Limiter
+	service   string
+	limits    Limits
 }
 
 type Connection struct {
@@ -36,6 +45,7 @@ type Connection struct {
 	target     string
 	done       chan struct{}
 	once       sync.Once
+	lastActive atomic.Int64 // unix nanoseconds of the last message in either direction
 }
 
 func NewProxy(config Config, logger *logrus.Logger) *Proxy {
@@ -78,16 +88,35 @@ func NewProxy(config Config, logger *logrus.Logger) *Proxy {
 	}
 }
 
+// SetLimiter caps the connections the proxy holds for service. limits apply
+// to the service alone; limiter also enforces the gateway-wide ones.
+func (p *Proxy) SetLimiter(limiter *Limiter, service string, limits Limits) {
+	p.limiter = limiter
+	p.service = service
+	p.limits = limits
+}
+
+// SetTLSConfig sets the TLS configuration used to dial wss:// targets
+func (p *Proxy) SetTLSConfig(config *tls.Config) {
+	p.tlsConfig = config
+}
+
+// SetProxy sets the proxy targets are dialed through
+func (p *Proxy) SetProxy(proxy func(*http.Request) (*url.URL, error)) {
+	p.egress = proxy
+}
+
 func (p *Proxy) ProxyWebSocket(c echo.Context, targetURL string) error {
-	clientConn, err := p.upgrader.Upgrade(c.Response(), c.Request(), nil)
-	if err != nil {
-		p.logger.WithError(err).Error("Failed to upgrade client connection")
-		return err
+	if p.limiter != nil {
+		release, err := p.limiter.Acquire(p.service, p.limits, c.RealIP())
+		if err != nil {
+			return p.reject(c, err)
+		}
+		defer release()
 	}
 
 	target, err := url.Parse(targetURL)
 	if err != nil {
-		clientConn.Close()
 		return err
 	}
 
@@ -102,16 +131,38 @@ func (p *Proxy) ProxyWebSocket(c echo.Context, targetURL string) error {
 	}
 
 	dialer := websocket.Dialer{
-		HandshakeTimeout: p.config.HandshakeTimeout,
+		HandshakeTimeout:  p.config.HandshakeTimeout,
+		ReadBufferSize:    p.config.ReadBufferSize,
+		WriteBufferSize:   p.config.WriteBufferSize,
+		EnableCompression: p.config.EnableCompression,
+		TLSClientConfig:   p.tlsConfig,
+		Proxy:             p.egress,
 	}
 
-	serverConn, _, err := dialer.Dial(wsURL, nil)
+	// Connect to the target first so a failure can still be answered with
+	// an HTTP error, and so its chosen subprotocol can be passed on
+	serverConn, resp, err := dialer.Dial(wsURL, forwardedHeaders(c.Request().Header))
 	if err != nil {
 		p.logger.WithError(err).WithField("target", wsURL).Error("Failed to connect to target WebSocket")
-		clientConn.Close()
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to connect to WebSocket backend")
+	}
+
+	var responseHeader http.Header
+	if protocol := resp.Header.Get("Sec-Websocket-Protocol"); protocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+	}
+
+	clientConn, err := p.upgrader.Upgrade(c.Response(), c.Request(), responseHeader)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to upgrade client connection")
+		serverConn.Close()
 		return err
 	}
 
+	// Messages above the limit are refused with a 1009 close frame
+	clientConn.SetReadLimit(p.config.MaxMessageSize)
+	serverConn.SetReadLimit(p.config.MaxMessageSize)
+
 	conn := &Connection{
 		clientConn: clientConn,
 		serverConn: serverConn,
@@ -119,103 +170,179 @@ func (p *Proxy) ProxyWebSocket(c echo.Context, targetURL string) error {
 		target:     wsURL,
 		done:       make(chan struct{}),
 	}
+	conn.touch()
+
+	activeConnections.WithLabelValues(p.service).Inc()
+	defer activeConnections.WithLabelValues(p.service).Dec()
 
 	go conn.proxyClientToServer()
 	go conn.proxyServerToClient()
-
-	<-conn.done
+	go conn.keepAlive()
+
+	// The request context is cancelled when the gateway shuts down and can
+	// no longer wait for the connection to end on its own
+	select {
+	case <-conn.done:
+	case <-c.Request().Context().Done():
+		p.closed(closeShutdown)
+		conn.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
 
 	return nil
 }
 
-func (c *Connection) proxyClientToServer() {
-	defer c.close()
-
-	err := c.clientConn.SetReadDeadline(time.Now().Add(c.proxy.config.ReadTimeout))
-	if err != nil {
-		c.proxy.logger.WithError(err).Error("Failed to set read deadline on client connection")
-		return
+// reject answers a connection refused by the limiter: 503 when the gateway
+// or service is full, 429 when the client holds too many connections
+func (p *Proxy) reject(c echo.Context, err error) error {
+	reason, status := rejectLimit, http.StatusServiceUnavailable
+	if errors.Is(err, ErrTooManyConnectionsFromIP) {
+		reason, status = rejectIPLimit, http.StatusTooManyRequests
 	}
+	rejectedConnections.WithLabelValues(p.service, reason).Inc()
+	p.logger.WithFields(logrus.Fields{
+		"service":   p.service,
+		"client_ip": c.RealIP(),
+	}).WithError(err).Warn("WebSocket connection rejected")
+	return echo.NewHTTPError(status, err.Error())
+}
 
-	c.clientConn.SetPongHandler(func(string) error {
-		err := c.clientConn.SetReadDeadline(time.Now().Add(c.proxy.config.ReadTimeout))
-		if err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to set read deadline in pong handler")
+// forwardedHeaders are the client's handshake headers passed to the target,
+// minus those the dialer sets itself
+func forwardedHeaders(header http.Header) http.Header {
+	forwarded := make(http.Header, len(header))
+	for k, v := range header {
+		switch k {
+		case "Host", "Upgrade", "Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding",
+			"Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions":
+			continue
 		}
-		return nil
-	})
+		forwarded[k] = v
+	}
+	return forwarded
+}
 
-	for {
-		messageType, data, err := c.clientConn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				c.proxy.logger.WithError(err).Error("Unexpected WebSocket close error from client")
-			}
-			break
-		}
+// touch records traffic on the connection
+func (c *Connection) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
 
-		if int64(len(data)) > c.proxy.config.MaxMessageSize {
-			c.proxy.logger.Error("Message size exceeds maximum allowed size")
-			break
-		}
+// keepAlive pings both sides so dead peers are noticed, and closes the
+// connection once no message has passed in either direction for IdleTimeout
+func (c *Connection) keepAlive() {
+	ping := time.NewTicker(c.proxy.config.PingPeriod)
+	defer ping.Stop()
+
+	// A nil channel never fires, so without an idle timeout only pings run
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if c.proxy.config.IdleTimeout > 0 {
+		timer = time.NewTimer(c.proxy.config.IdleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
 
-		if err := c.serverConn.SetWriteDeadline(time.Now().Add(c.proxy.config.WriteTimeout)); err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to set write deadline on server connection")
-			break
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ping.C:
+			c.ping()
+		case <-idle:
+			quiet := time.Since(time.Unix(0, c.lastActive.Load()))
+			if quiet >= c.proxy.config.IdleTimeout {
+				c.proxy.closed(closeIdle)
+				c.closeWith(websocket.CloseGoingAway, "idle timeout")
+				return
+			}
+			timer.Reset(c.proxy.config.IdleTimeout - quiet)
 		}
+	}
+}
 
-		if err := c.serverConn.WriteMessage(messageType, data); err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to write message to server")
-			break
-		}
+func (c *Connection) ping() {
+	deadline := time.Now().Add(c.proxy.config.WriteTimeout)
+	if err := c.clientConn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+		c.proxy.logger.WithError(err).Debug("Failed to ping client")
+	}
+	if err := c.serverConn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+		c.proxy.logger.WithError(err).Debug("Failed to ping server")
 	}
 }
 
+func (c *Connection) proxyClientToServer() {
+	c.pump(c.clientConn, c.serverConn, "client")
+}
+
 func (c *Connection) proxyServerToClient() {
-	defer c.close()
+	c.pump(c.serverConn, c.clientConn, "server")
+}
 
-	err := c.serverConn.SetReadDeadline(time.Now().Add(c.proxy.config.ReadTimeout))
-	if err != nil {
-		c.proxy.logger.WithError(err).Error("Failed to set read deadline on server connection")
+// pump copies messages from src to dst until either side fails or closes,
+// then closes both, passing src's close code on to dst
+func (c *Connection) pump(src, dst *websocket.Conn, from string) {
+	code, text := websocket.CloseGoingAway, ""
+	defer func() { c.closeWith(code, text) }()
+
+	extend := func() error {
+		return src.SetReadDeadline(time.Now().Add(c.proxy.config.ReadTimeout))
+	}
+	if err := extend(); err != nil {
+		c.proxy.logger.WithError(err).Errorf("Failed to set read deadline on %s connection", from)
 		return
 	}
-
-	c.serverConn.SetPongHandler(func(string) error {
-		err := c.serverConn.SetReadDeadline(time.Now().Add(c.proxy.config.ReadTimeout))
-		if err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to set read deadline in pong handler")
-		}
-		return nil
+	src.SetPongHandler(func(string) error {
+		return extend()
 	})
 
 	for {
-		messageType, data, err := c.serverConn.ReadMessage()
+		messageType, data, err := src.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				c.proxy.logger.WithError(err).Error("Unexpected WebSocket close error from server")
+			var closeErr *websocket.CloseError
+			switch {
+			case errors.As(err, &closeErr):
+				code, text = closeErr.Code, closeErr.Text
+				if code == websocket.CloseNoStatusReceived || code == websocket.CloseAbnormalClosure {
+					code = websocket.CloseGoingAway
+				}
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					c.proxy.logger.WithError(err).Errorf("Unexpected WebSocket close error from %s", from)
+				}
+			case errors.Is(err, websocket.ErrReadLimit):
+				code, text = websocket.CloseMessageTooBig, "message too big"
+				c.proxy.closed(closeTooBig)
+				c.proxy.logger.WithField("service", c.proxy.service).Warnf("WebSocket message from %s exceeds maximum allowed size", from)
 			}
-			break
+			return
 		}
+		c.touch()
 
-		if int64(len(data)) > c.proxy.config.MaxMessageSize {
-			c.proxy.logger.Error("Message size exceeds maximum allowed size")
-			break
+		if err := extend(); err != nil {
+			c.proxy.logger.WithError(err).Errorf("Failed to set read deadline on %s connection", from)
+			return
 		}
 
-		if err := c.clientConn.SetWriteDeadline(time.Now().Add(c.proxy.config.WriteTimeout)); err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to set write deadline on client connection")
-			break
+		if err := dst.SetWriteDeadline(time.Now().Add(c.proxy.config.WriteTimeout)); err != nil {
+			c.proxy.logger.WithError(err).Error("Failed to set write deadline")
+			return
 		}
 
-		if err := c.clientConn.WriteMessage(messageType, data); err != nil {
-			c.proxy.logger.WithError(err).Error("Failed to write message to client")
-			break
+		if err := dst.WriteMessage(messageType, data); err != nil {
+			c.proxy.logger.WithError(err).Errorf("Failed to forward message from %s", from)
+			return
 		}
 	}
 }
 
-func (c *Connection) close() {
+// closeWith sends a close frame with code to both sides and closes them.
+// Only the first call has an effect.
+func (c *Connection) closeWith(code int, text string) {
 	c.once.Do(func() {
+		message := websocket.FormatCloseMessage(code, text)
+		deadline := time.Now().Add(c.proxy.config.WriteTimeout)
+		// Either side may already be gone or have sent its close frame
+		_ = c.clientConn.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = c.serverConn.WriteControl(websocket.CloseMessage, message, deadline)
+
 		if err := c.clientConn.Close(); err != nil {
 			c.proxy.logger.WithError(err).Debug("Error closing client connection")
 		}
@@ -226,6 +353,14 @@ func (c *Connection) close() {
 	})
 }
 
+// closed counts a connection the gateway closed
+func (p *Proxy) closed(reason string) {
+	closedConnections.WithLabelValues(p.service, reason).Inc()
+	if p.limiter != nil {
+		p.limiter.closed(p.service, reason)
+	}
+}
+
 func (p *Proxy) HandleWebSocketUpgrade(c echo.Context) error {
 	targetURL := c.Get("target_url").(string)
 	return p.ProxyWebSocket(c, targetURL)
@@ -234,7 +369,7 @@ func (p *Proxy) HandleWebSocketUpgrade(c echo.Context) error {
 func WebSocketMiddleware(proxy *Proxy) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if isWebSocketUpgrade(c.Request()) {
+			if IsUpgrade(c.Request()) {
 				targetURL := c.Get("target_url")
 				if targetURL == nil {
 					return echo.NewHTTPError(http.StatusBadRequest, "No target URL specified for WebSocket")
@@ -246,6 +381,7 @@ func WebSocketMiddleware(proxy *Proxy) echo.MiddlewareFunc {
 	}
 }
 
-func isWebSocketUpgrade(r *http.Request) bool {
-	return r.Header.Get("Connection") == "Upgrade" && r.Header.Get("Upgrade") == "websocket"
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol
+func IsUpgrade(r *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(r)
 }
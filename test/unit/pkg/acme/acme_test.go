@@ -0,0 +1,169 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/acme"
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned returns a PEM certificate and key for name valid for validFor
+func selfSigned(t *testing.T, name string, validFor time.Duration) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestDiskStorage(t *testing.T) {
+	storage := acme.NewDiskStorage(t.TempDir())
+	ctx := context.Background()
+
+	res, err := storage.Load(ctx, "*.example.com")
+	require.NoError(t, err)
+	assert.Nil(t, res, "missing resources are not an error")
+
+	certPEM, keyPEM := selfSigned(t, "*.example.com", 24*time.Hour)
+	require.NoError(t, storage.Save(ctx, &acme.Resource{Name: "*.example.com", CertPEM: certPEM, KeyPEM: keyPEM}))
+
+	res, err = storage.Load(ctx, "*.example.com")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, certPEM, res.CertPEM)
+	assert.Equal(t, keyPEM, res.KeyPEM)
+}
+
+func TestManagerServesStoredCertificates(t *testing.T) {
+	storage := acme.NewDiskStorage(t.TempDir())
+	certPEM, keyPEM := selfSigned(t, "*.example.com", 90*24*time.Hour)
+	require.NoError(t, storage.Save(context.Background(), &acme.Resource{Name: "*.example.com", CertPEM: certPEM, KeyPEM: keyPEM}))
+
+	manager, err := acme.NewManager(config.ACMEConfig{
+		Enabled:     true,
+		Domains:     []string{"*.example.com"},
+		Challenge:   "dns-01",
+		RenewBefore: 30 * 24 * time.Hour,
+		DNS:         config.ACMEDNSConfig{Provider: "webhook", WebhookURL: "http://127.0.0.1:1"},
+	}, storage, logrus.New())
+	require.NoError(t, err)
+
+	// The stored certificate is far from expiry, so no order is placed
+	require.NoError(t, manager.Start(context.Background()))
+	defer manager.Stop()
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	assert.Equal(t, "*.example.com", cert.Leaf.Subject.CommonName)
+
+	cert, err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.org"})
+	require.NoError(t, err)
+	assert.Nil(t, cert, "unmanaged names fall through to the static certificates")
+
+	status := manager.Status()
+	require.Len(t, status, 1)
+	assert.True(t, status[0].Issued)
+
+	assert.ErrorIs(t, manager.Renew(context.Background(), "other.org"), acme.ErrUnknownDomain)
+}
+
+func TestHTTPHandlerPassesThrough(t *testing.T) {
+	manager, err := acme.NewManager(config.ACMEConfig{Domains: []string{"example.com"}, Challenge: "http-01"},
+		acme.NewDiskStorage(t.TempDir()), logrus.New())
+	require.NoError(t, err)
+
+	handler := manager.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, acme.ChallengePath+"unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestWebhookProvider(t *testing.T) {
+	var calls []string
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+	}))
+	defer server.Close()
+
+	provider := acme.NewWebhookProvider(server.URL+"/", "secret")
+	require.NoError(t, provider.Present(context.Background(), "_acme-challenge.example.com", "token"))
+	require.NoError(t, provider.CleanUp(context.Background(), "_acme-challenge.example.com", "token"))
+
+	assert.Equal(t, []string{"/present", "/cleanup"}, calls)
+	assert.Equal(t, "_acme-challenge.example.com.", payload["fqdn"])
+	assert.Equal(t, "token", payload["value"])
+}
+
+func TestCloudflareProvider(t *testing.T) {
+	var deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer cf-token", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			// Only the apex is a zone, so the provider must walk up the labels
+			if r.URL.Query().Get("name") == "example.com" {
+				w.Write([]byte(`{"success":true,"result":[{"id":"zone1"}]}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"result":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/zones/zone1/dns_records":
+			w.Write([]byte(`{"success":true,"result":{"id":"rec1"}}`))
+		case r.Method == http.MethodDelete:
+			deleted = r.URL.Path
+			w.Write([]byte(`{"success":true,"result":{"id":"rec1"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"success":false,"errors":[{"message":"unexpected request"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	provider := acme.NewCloudflareProvider("cf-token", server.URL)
+	require.NoError(t, provider.Present(context.Background(), "_acme-challenge.api.example.com", "value"))
+	require.NoError(t, provider.CleanUp(context.Background(), "_acme-challenge.api.example.com", "value"))
+	assert.Equal(t, "/zones/zone1/dns_records/rec1", deleted)
+}
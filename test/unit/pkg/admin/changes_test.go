@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type changeMessage struct {
+	admin.ChangeEvent
+	Session string `json:"session"`
+}
+
+func connectChanges(t *testing.T, server *httptest.Server) (*websocket.Conn, string) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/admin/ws/changes"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	hello := readChange(t, ws)
+	require.Equal(t, "hello", hello.Type)
+	require.NotEmpty(t, hello.Session)
+	return ws, hello.Session
+}
+
+func readChange(t *testing.T, ws *websocket.Conn) changeMessage {
+	t.Helper()
+	var msg changeMessage
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.NoError(t, ws.ReadJSON(&msg))
+	return msg
+}
+
+func sendChange(t *testing.T, server *httptest.Server, method, path, session string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set(admin.SessionHeader, session)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestChangeNotifier(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	notifier := admin.NewChangeNotifier(logger)
+
+	e := echo.New()
+	g := e.Group("/admin", notifier.Middleware)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g.GET("/ws/changes", notifier.HandleWebSocket)
+	g.PUT("/api/settings/server", ok)
+	g.POST("/api/settings/validate", ok)
+	g.DELETE("/services/:name", ok)
+	g.POST("/api/plugins/:name/enable", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "plugin not found")
+	})
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	first, firstSession := connectChanges(t, server)
+	second, secondSession := connectChanges(t, server)
+	assert.Equal(t, 2, notifier.Sessions())
+
+	// Neither validating nor a failed change is reported
+	sendChange(t, server, http.MethodPost, "/admin/api/settings/validate", firstSession)
+	sendChange(t, server, http.MethodPost, "/admin/api/plugins/auth/enable", firstSession)
+	sendChange(t, server, http.MethodPut, "/admin/api/settings/server?dryRun=true", firstSession)
+
+	sendChange(t, server, http.MethodPut, "/admin/api/settings/server", firstSession)
+	change := readChange(t, second)
+	assert.Equal(t, "change", change.Type)
+	assert.Equal(t, "alice", change.User)
+	assert.Equal(t, admin.ChangeConfig, change.Kind)
+	assert.Equal(t, "updated", change.Action)
+	assert.Equal(t, "server", change.Target)
+	assert.WithinDuration(t, time.Now(), change.Time, 5*time.Second)
+
+	// The session a change was made from is not told about it, so the
+	// first message it receives is about the change of the other session
+	sendChange(t, server, http.MethodDelete, "/admin/services/billing", secondSession)
+	change = readChange(t, first)
+	assert.Equal(t, admin.ChangeService, change.Kind)
+	assert.Equal(t, "deleted", change.Action)
+	assert.Equal(t, "billing", change.Target)
+	assert.Equal(t, "/admin/services/billing", change.Path)
+}
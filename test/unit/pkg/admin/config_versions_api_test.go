@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryConfigs is a ConfigVersionStore kept in memory, newest version first
+type memoryConfigs struct {
+	mu    sync.Mutex
+	docs  []*mongodb.ConfigDocument
+	audit []*mongodb.AuditLogDocument
+}
+
+func (m *memoryConfigs) SaveConfig(ctx context.Context, doc *mongodb.ConfigDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if doc.Active {
+		for _, d := range m.docs {
+			d.Active = false
+		}
+	}
+	m.docs = append([]*mongodb.ConfigDocument{doc}, m.docs...)
+	return nil
+}
+
+func (m *memoryConfigs) GetConfigByVersion(ctx context.Context, version string) (*mongodb.ConfigDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.docs {
+		if d.Version == version {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("config not found: %s", version)
+}
+
+func (m *memoryConfigs) ListConfigs(ctx context.Context, limit int) ([]*mongodb.ConfigDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limit > 0 && limit < len(m.docs) {
+		return m.docs[:limit], nil
+	}
+	return m.docs, nil
+}
+
+func (m *memoryConfigs) CreateAuditLog(ctx context.Context, log *mongodb.AuditLogDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, log)
+	return nil
+}
+
+// fakeReloader applies configurations unless they have no services
+type fakeReloader struct {
+	applied *config.Config
+}
+
+func (r *fakeReloader) Reload(cfg *config.Config) (*config.ReloadReport, error) {
+	if len(cfg.Services) == 0 {
+		return nil, errors.New("invalid configuration: no services")
+	}
+	r.applied = cfg
+	return &config.ReloadReport{Applied: []string{"services"}}, nil
+}
+
+func configVersion(t *testing.T, version string, cfg *config.Config) *mongodb.ConfigDocument {
+	data, err := mongodb.ConfigToMap(cfg)
+	require.NoError(t, err)
+	return &mongodb.ConfigDocument{Version: version, Config: data, Source: "gitops"}
+}
+
+func TestConfigVersionsHandler(t *testing.T) {
+	v1 := &config.Config{Services: []config.ServiceConfig{
+		{Name: "orders", BasePath: "/orders", Targets: []string{"http://orders-v1"}},
+		{Name: "users", BasePath: "/users", Targets: []string{"http://users"}},
+	}}
+	v2 := &config.Config{Server: config.ServerConfig{Port: 9090}, Services: []config.ServiceConfig{
+		{Name: "orders", BasePath: "/orders", Targets: []string{"http://orders-v2"}},
+		{Name: "carts", BasePath: "/carts", Targets: []string{"http://carts"}},
+	}}
+	store := &memoryConfigs{}
+	require.NoError(t, store.SaveConfig(context.Background(), configVersion(t, "empty", &config.Config{})))
+	require.NoError(t, store.SaveConfig(context.Background(), configVersion(t, "v1", v1)))
+	active := configVersion(t, "v2", v2)
+	active.Active = true
+	require.NoError(t, store.SaveConfig(context.Background(), active))
+
+	reloader := &fakeReloader{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	e := echo.New()
+	admin.NewConfigVersionsHandler(store, reloader, func() *config.Config { return v2 }, logger).RegisterRoutes(e.Group("/admin"))
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/admin/api/config/versions?limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var versions []admin.ConfigVersion
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &versions))
+	require.Len(t, versions, 2)
+	assert.Equal(t, "v2", versions[0].Version)
+	assert.True(t, versions[0].Active)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/api/config/versions?limit=none").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/admin/api/config/versions/v9").Code)
+
+	rec = do(http.MethodGet, "/admin/api/config/diff?from=v1&to=v2")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var diff struct {
+		Changes []admin.ConfigChange `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &diff))
+	changes := make(map[string]admin.ConfigChange)
+	for _, change := range diff.Changes {
+		changes[change.Path] = change
+	}
+	assert.Equal(t, admin.ConfigChange{Path: "server.port", Type: "changed", From: float64(0), To: float64(9090)}, changes["server.port"])
+	assert.Equal(t, "changed", changes["services[orders].targets[0]"].Type)
+	assert.Equal(t, "http://orders-v2", changes["services[orders].targets[0]"].To)
+	assert.Equal(t, "removed", changes["services[users]"].Type)
+	assert.Equal(t, "added", changes["services[carts]"].Type)
+	assert.Len(t, diff.Changes, 4)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/admin/api/config/diff?from=v1&to=v9").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/api/config/diff?from=v1").Code)
+
+	// Rolling back backs up the running configuration and applies the version
+	rec = do(http.MethodPost, "/admin/api/config/versions/v1/rollback")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NotNil(t, reloader.applied)
+	assert.Equal(t, "http://orders-v1", reloader.applied.Services[0].Targets[0])
+	assert.Equal(t, 30*time.Second, reloader.applied.Services[0].Timeout, "defaults are set")
+
+	restored, backup := store.docs[0], store.docs[1]
+	assert.True(t, restored.Active)
+	assert.Equal(t, "rollback", restored.Source)
+	assert.Equal(t, "v1", restored.RestoredFrom)
+	assert.False(t, backup.Active)
+	assert.Equal(t, "backup", backup.Source)
+	backedUp, err := mongodb.MapToConfig(backup.Config)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, backedUp.Server.Port)
+	for _, doc := range store.docs[1:] {
+		assert.False(t, doc.Active, doc.Version)
+	}
+
+	// A version the gateway refuses is not applied
+	assert.Equal(t, http.StatusUnprocessableEntity, do(http.MethodPost, "/admin/api/config/versions/empty/rollback").Code)
+	assert.True(t, store.docs[1].Active, "the rolled back version stays active")
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/api/config/versions/v9/rollback").Code)
+
+	require.Len(t, store.audit, 2)
+	assert.Equal(t, "config.rollback", store.audit[0].Action)
+	assert.Equal(t, "success", store.audit[0].Status)
+	assert.Equal(t, "v1", store.audit[0].Changes["restoredFrom"])
+	assert.Equal(t, backup.Version, store.audit[0].Changes["backup"])
+	assert.Equal(t, "failure", store.audit[1].Status)
+}
@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/consumers"
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryConsumers is a consumers.Store kept in memory
+type memoryConsumers struct {
+	mu        sync.Mutex
+	consumers map[string]mongodb.ConsumerDocument
+}
+
+func (s *memoryConsumers) CreateConsumer(_ context.Context, consumer *mongodb.ConsumerDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consumers[consumer.ID] = *consumer
+	return nil
+}
+
+func (s *memoryConsumers) GetConsumer(_ context.Context, id string) (*mongodb.ConsumerDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consumer, ok := s.consumers[id]
+	if !ok {
+		return nil, nil
+	}
+	return &consumer, nil
+}
+
+func (s *memoryConsumers) ListConsumers(_ context.Context) ([]*mongodb.ConsumerDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*mongodb.ConsumerDocument
+	for _, consumer := range s.consumers {
+		list = append(list, &consumer)
+	}
+	return list, nil
+}
+
+func (s *memoryConsumers) UpdateConsumer(_ context.Context, id string, consumer *mongodb.ConsumerDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.consumers[id]; !ok {
+		return mongodb.ErrNotFound
+	}
+	s.consumers[id] = *consumer
+	return nil
+}
+
+func (s *memoryConsumers) DeleteConsumer(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.consumers[id]; !ok {
+		return mongodb.ErrNotFound
+	}
+	delete(s.consumers, id)
+	return nil
+}
+
+func TestConsumersHMACKeys(t *testing.T) {
+	store := &memoryConsumers{consumers: make(map[string]mongodb.ConsumerDocument)}
+	registry, err := consumers.NewRegistry(config.ConsumersConfig{Enabled: true, RefreshInterval: time.Hour},
+		store, ratelimit.NewMemoryCounter(), logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(registry.Stop)
+
+	e := echo.New()
+	admin.NewConsumersHandler(registry).RegisterRoutes(e.Group("/admin"))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/admin/api/consumers", `{"username":"partner","hmacKeys":[{"id":"k1","secret":"s3cret"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "s3cret")
+	var created mongodb.ConsumerDocument
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, []mongodb.ConsumerHMACKey{{ID: "k1"}}, created.HMACKeys)
+	secret, ok := registry.HMACSecret("k1")
+	require.True(t, ok)
+	assert.Equal(t, "s3cret", secret)
+
+	// Reads never return secrets
+	for _, path := range []string{"/admin/api/consumers", "/admin/api/consumers/" + created.ID} {
+		rec = do(http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"k1"`)
+		assert.NotContains(t, rec.Body.String(), "s3cret")
+	}
+
+	// Keys sent back without a secret keep it, new keys need one
+	rec = do(http.MethodPut, "/admin/api/consumers/"+created.ID, `{"username":"partner","hmacKeys":[{"id":"k1"},{"id":"k2","secret":"rotated"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "rotated")
+	secret, _ = registry.HMACSecret("k1")
+	assert.Equal(t, "s3cret", secret)
+	secret, _ = registry.HMACSecret("k2")
+	assert.Equal(t, "rotated", secret)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/api/consumers/"+created.ID, `{"username":"partner","hmacKeys":[{"id":"k3"}]}`).Code)
+
+	// Leaving a key out removes it
+	rec = do(http.MethodPut, "/admin/api/consumers/"+created.ID, `{"username":"partner","hmacKeys":[{"id":"k2"}]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	_, ok = registry.HMACSecret("k1")
+	assert.False(t, ok)
+	secret, _ = registry.HMACSecret("k2")
+	assert.Equal(t, "rotated", secret)
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSRFServer() *echo.Echo {
+	e := echo.New()
+	g := e.Group("/admin", admin.CSRFMiddleware())
+	g.GET("/dashboard", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	g.POST("/services", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	})
+	return e
+}
+
+func issueToken(t *testing.T, e *echo.Echo) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == admin.CSRFCookie {
+			assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+			assert.False(t, cookie.HttpOnly)
+			return cookie
+		}
+	}
+	t.Fatal("no CSRF cookie issued")
+	return nil
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	e := newCSRFServer()
+	cookie := issueToken(t, e)
+
+	tests := []struct {
+		name   string
+		header string
+		form   string
+		cookie bool
+		status int
+	}{
+		{name: "header token", header: cookie.Value, cookie: true, status: http.StatusCreated},
+		{name: "form token", form: cookie.Value, cookie: true, status: http.StatusCreated},
+		{name: "missing token", cookie: true, status: http.StatusForbidden},
+		{name: "wrong token", header: "forged", cookie: true, status: http.StatusForbidden},
+		{name: "missing cookie", header: cookie.Value, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.form != "" {
+				req = httptest.NewRequest(http.MethodPost, "/admin/services",
+					strings.NewReader(url.Values{"_csrf": {tt.form}}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(http.MethodPost, "/admin/services", nil)
+			}
+			if tt.header != "" {
+				req.Header.Set(admin.CSRFHeader, tt.header)
+			}
+			if tt.cookie {
+				req.AddCookie(cookie)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestCSRFSkipsHeaderAuthenticatedAPICalls(t *testing.T) {
+	e := newCSRFServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/services", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// Browsers replay cached Basic credentials on cross-site requests too
+	req = httptest.NewRequest(http.MethodPost, "/admin/services", nil)
+	req.SetBasicAuth("admin", "secret")
+	req.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestCSRFProtectsMongoDBAPI(t *testing.T) {
+	t.Chdir(t.TempDir()) // Register creates the templates directory
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := admin.New(config.NewStore(&config.Config{Admin: config.AdminConfig{Enabled: true, Username: "root", Password: "root-pass", BasicAuth: true}}), "", logger)
+	e := echo.New()
+	h.Register(e)
+	h.RegisterMongoDBRoutes(e, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/login",
+		strings.NewReader(url.Values{"username": {"root"}, "password": {"root-pass"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	// The browser sends the login cookie along with a forged request
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		path := "/admin/api/mongodb/services"
+		if method != http.MethodPost {
+			path += "/users"
+		}
+		req = httptest.NewRequest(method, path, strings.NewReader(`{"name":"users"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, method)
+		assert.Contains(t, rec.Body.String(), "CSRF", method)
+	}
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// declarativeGateway serves the admin API over cfg, saving it to a
+// temporary file. Requests authenticate with an admin token.
+func declarativeGateway(t *testing.T, cfg *config.Config) (func(method, path, body string, headers ...string) *httptest.ResponseRecorder, *config.Store, string) {
+	t.Helper()
+	t.Chdir(t.TempDir()) // Register creates the templates directory
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	sum := sha256.Sum256([]byte("test-token"))
+	cfg.Server.Port = 8080
+	cfg.Admin.Enabled = true
+	cfg.Admin.Tokens = []config.AdminTokenConfig{{Name: "test", SHA256: hex.EncodeToString(sum[:])}}
+	store := config.NewStore(cfg)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	e := echo.New()
+	admin.New(store, path, logger).Register(e)
+
+	do := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", "Bearer test-token")
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	return do, store, path
+}
+
+func desiredResult(t *testing.T, rec *httptest.ResponseRecorder) admin.DesiredResource {
+	t.Helper()
+	var res admin.DesiredResource
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res), rec.Body.String())
+	return res
+}
+
+func TestDeclarativeCreateAndUpdate(t *testing.T) {
+	do, store, path := declarativeGateway(t, &config.Config{})
+	const users = "/admin/api/declarative/services/users"
+
+	rec := do(http.MethodPut, users, `{"basePath":"/api/users","targets":["http://users:8081"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := desiredResult(t, rec)
+	assert.Equal(t, admin.ReconcileCreated, created.Result)
+	assert.Equal(t, "service/users", created.ID)
+	assert.Equal(t, created.ETag, rec.Header().Get("ETag"))
+	require.Len(t, store.Load().Services, 1)
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), "/api/users")
+
+	// The same document again changes nothing
+	rec = do(http.MethodPut, users, `{"basePath":"/api/users","targets":["http://users:8081"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, admin.ReconcileUnchanged, desiredResult(t, rec).Result)
+	assert.Equal(t, created.ETag, rec.Header().Get("ETag"))
+
+	rec = do(http.MethodPut, users, `{"basePath":"/api/people","targets":["http://users:8081"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	updated := desiredResult(t, rec)
+	assert.Equal(t, admin.ReconcileUpdated, updated.Result)
+	assert.NotEqual(t, created.ETag, updated.ETag)
+	assert.Equal(t, "/api/people", store.Load().Services[0].BasePath)
+
+	// Dry runs report the result without making the change
+	rec = do(http.MethodPut, users+"?dryRun=true", `{"basePath":"/api/dry","targets":["http://users:8081"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, admin.ReconcileUpdated, desiredResult(t, rec).Result)
+	assert.Equal(t, "/api/people", store.Load().Services[0].BasePath)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, users, `{"name":"other","basePath":"/api/users"}`).Code)
+	// Changes leaving the configuration invalid are refused
+	rec = do(http.MethodPut, "/admin/api/declarative/services/people", `{"basePath":"/api/people","targets":["http://people:8081"],"cors":{"maxAge":-1,"allowOrigins":["*"]}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Len(t, store.Load().Services, 1)
+}
+
+func TestDeclarativePreconditions(t *testing.T) {
+	do, store, _ := declarativeGateway(t, &config.Config{})
+	const users = "/admin/api/declarative/services/users"
+	document := `{"basePath":"/api/users","targets":["http://users:8081"]}`
+
+	// If-Match needs the resource to exist
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, users, document, "If-Match", "*").Code)
+
+	etag := desiredResult(t, do(http.MethodPut, users, document, "If-None-Match", "*")).ETag
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, users, document, "If-None-Match", "*").Code)
+	assert.Equal(t, http.StatusNotModified, do(http.MethodGet, users, "", "If-None-Match", etag).Code)
+
+	// A stale ETag is refused, the current one accepted
+	changed := `{"basePath":"/api/people","targets":["http://users:8081"]}`
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodPut, users, changed, "If-Match", `"stale"`).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, do(http.MethodDelete, users, "", "If-Match", `"stale"`).Code)
+	assert.Equal(t, "/api/users", store.Load().Services[0].BasePath)
+	rec := do(http.MethodPut, users, changed, "If-Match", etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag = rec.Header().Get("ETag")
+
+	// With If-Match required, changes to existing resources need it
+	require.NoError(t, store.Update(func(cfg *config.Config) error {
+		cfg.Admin.RequireIfMatch = true
+		return nil
+	}))
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodPut, users, document).Code)
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodDelete, users, "").Code)
+	assert.Len(t, store.Load().Services, 1)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPut, "/admin/api/declarative/services/orders", `{"basePath":"/api/orders","targets":["http://orders:8081"]}`).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/api/declarative/services/absent", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, users, "", "If-Match", etag).Code)
+}
+
+func TestDeclarativeDelete(t *testing.T) {
+	do, store, _ := declarativeGateway(t, &config.Config{
+		Services: []config.ServiceConfig{
+			{Name: "users", BasePath: "/api/users", Targets: []string{"http://users:8081"}},
+			{Name: "orders", BasePath: "/api/orders", Targets: []string{"http://orders:8081"}},
+		},
+		Products: []config.ProductConfig{
+			{Name: "shop", Services: []string{"orders"}, Plans: []config.PlanConfig{{Name: "free"}}},
+		},
+	})
+
+	rec := do(http.MethodDelete, "/admin/api/declarative/services/users?dryRun=true", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, admin.ReconcileDeleted, desiredResult(t, rec).Result)
+	assert.Len(t, store.Load().Services, 2)
+
+	rec = do(http.MethodDelete, "/admin/api/declarative/services/users", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, admin.ReconcileDeleted, desiredResult(t, rec).Result)
+	require.Len(t, store.Load().Services, 1)
+
+	// Deleting again succeeds
+	rec = do(http.MethodDelete, "/admin/api/declarative/services/users", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, admin.ReconcileAbsent, desiredResult(t, rec).Result)
+
+	// A service a product refers to cannot be deleted, not even in a dry run
+	assert.Equal(t, http.StatusUnprocessableEntity, do(http.MethodDelete, "/admin/api/declarative/services/orders?dryRun=true", "").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do(http.MethodDelete, "/admin/api/declarative/services/orders", "").Code)
+	assert.Len(t, store.Load().Services, 1)
+}
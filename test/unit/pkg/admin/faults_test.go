@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/faults"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultsHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	newServer := func(environment string) func(method, path, body string) *httptest.ResponseRecorder {
+		injector := faults.New(config.FaultsConfig{Enabled: true, Environment: environment}, []config.ServiceConfig{{Name: "orders"}}, logger)
+		e := echo.New()
+		admin.NewFaultsHandler(injector).RegisterRoutes(e.Group("/admin"))
+		return func(method, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+	}
+
+	do := newServer("staging")
+	rec := do(http.MethodPut, "/admin/api/faults/orders", `{"delayPercentage":10,"delay":"250ms","errorPercentage":5,"duration":"15m"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodGet, "/admin/api/faults", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Environment string `json:"environment"`
+		Allowed     bool   `json:"allowed"`
+		Faults      map[string]struct {
+			Delay     string `json:"delay"`
+			ExpiresAt string `json:"expiresAt"`
+		} `json:"faults"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.True(t, list.Allowed)
+	assert.Equal(t, "250ms", list.Faults["orders"].Delay)
+	assert.NotEmpty(t, list.Faults["orders"].ExpiresAt)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/api/faults/orders", `{"delayPercentage":10,"delay":"soon"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/api/faults/orders", `{"errorPercentage":5,"errorStatus":200}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/admin/api/faults/payments", `{"errorPercentage":5}`).Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/api/faults/orders", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/api/faults/orders", "").Code)
+
+	do = newServer("production")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/admin/api/faults/orders", `{"errorPercentage":5}`).Code)
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogsHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tail := logging.NewTail(100)
+	logger.AddHook(tail)
+	logger.WithField("service", "orders").Info("order proxied")
+	logger.WithField("service", "orders").Error("order failed")
+	logger.WithField("service", "users").Warn("user slow")
+
+	e := echo.New()
+	admin.NewLogsHandler(tail).RegisterRoutes(e.Group("/admin"))
+	get := func(query string) (*httptest.ResponseRecorder, []string) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/api/logs"+query, nil))
+		var messages []string
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			var entry logging.Entry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			messages = append(messages, entry.Message)
+		}
+		return rec, messages
+	}
+
+	rec, messages := get("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, []string{"order proxied", "order failed", "user slow"}, messages)
+
+	_, messages = get("?level=warn")
+	assert.Equal(t, []string{"order failed", "user slow"}, messages)
+
+	_, messages = get("?service=orders")
+	assert.Equal(t, []string{"order proxied", "order failed"}, messages)
+
+	_, messages = get("?lines=1")
+	assert.Equal(t, []string{"user slow"}, messages)
+
+	rec, _ = get("?level=loud")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = get("?lines=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
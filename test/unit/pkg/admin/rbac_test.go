@@ -0,0 +1,181 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPermits(t *testing.T) {
+	tests := []struct {
+		role, method, path string
+		permitted          bool
+	}{
+		{admin.RoleAdmin, http.MethodPost, "/admin/api/users", true},
+		{admin.RoleAdmin, http.MethodPut, "/admin/api/settings/server", true},
+		{admin.RoleViewer, http.MethodGet, "/admin/dashboard", true},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/settings/server", true},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/settings", false},
+		{admin.RoleUser, http.MethodGet, "/admin/api/settings/", false},
+		{admin.RoleAdmin, http.MethodGet, "/admin/api/settings", true},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/settings/export", false},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/config/versions", false},
+		{admin.RoleUser, http.MethodPost, "/admin/api/config/versions/v1/rollback", false},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/users", false},
+		{admin.RoleViewer, http.MethodGet, "/admin/api/consumers", false},
+		{admin.RoleUser, http.MethodGet, "/admin/api/consumers/c1", false},
+		{admin.RoleViewer, http.MethodPost, "/admin/services", false},
+		{admin.RoleViewer, http.MethodPost, "/admin/api/targets/disable", false},
+		{admin.RoleUser, http.MethodPost, "/admin/services", true},
+		{admin.RoleUser, http.MethodDelete, "/admin/services/orders", true},
+		{admin.RoleUser, http.MethodPut, "/admin/api/mongodb/services/orders", true},
+		{admin.RoleUser, http.MethodPut, "/admin/api/declarative/services/orders", true},
+		{admin.RoleUser, http.MethodPost, "/admin/api/services", true},
+		{admin.RoleViewer, http.MethodDelete, "/admin/api/services/orders", false},
+		{admin.RoleUser, http.MethodPost, "/admin/api/targets/disable", true},
+		{admin.RoleUser, http.MethodGet, "/admin/api/plugins", true},
+		{admin.RoleUser, http.MethodPost, "/admin/api/plugins", false},
+		{admin.RoleUser, http.MethodPut, "/admin/api/declarative/plugins/auth", false},
+		{admin.RoleUser, http.MethodPut, "/admin/api/settings/server", false},
+		{admin.RoleUser, http.MethodPost, "/admin/servicesx", false},
+		{admin.RoleUser, http.MethodGet, "/admin/api/users/", false},
+		{"developer", http.MethodGet, "/admin/dashboard", false},
+		{"", http.MethodGet, "/admin/dashboard", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.permitted, admin.Permits(tt.role, tt.method, tt.path))
+		})
+	}
+}
+
+// memoryUsers is a UserStore kept in memory
+type memoryUsers struct {
+	mu    sync.Mutex
+	users map[string]*mongodb.UserDocument
+}
+
+func (m *memoryUsers) CreateUser(ctx context.Context, user *mongodb.UserDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return fmt.Errorf("failed to create user: %w", mongodb.ErrDuplicate)
+		}
+	}
+	copied := *user
+	m.users[user.ID] = &copied
+	return nil
+}
+
+func (m *memoryUsers) GetUser(ctx context.Context, id string) (*mongodb.UserDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found: %s", id)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryUsers) GetUserByUsername(ctx context.Context, username string) (*mongodb.UserDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found: %s", username)
+}
+
+func (m *memoryUsers) ListUsers(ctx context.Context) ([]*mongodb.UserDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []*mongodb.UserDocument
+	for _, user := range m.users {
+		copied := *user
+		users = append(users, &copied)
+	}
+	return users, nil
+}
+
+func (m *memoryUsers) UpdateUser(ctx context.Context, id string, user *mongodb.UserDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *user
+	m.users[id] = &copied
+	return nil
+}
+
+func (m *memoryUsers) DeleteUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.users, id)
+	return nil
+}
+
+func TestUsersHandler(t *testing.T) {
+	store := &memoryUsers{users: make(map[string]*mongodb.UserDocument)}
+	e := echo.New()
+	admin.NewUsersHandler(store).RegisterRoutes(e.Group("/admin"))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/admin/api/users", `{"username":"bob","email":"bob@example.com","password":"correct horse","role":"viewer"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created mongodb.UserDocument
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Empty(t, created.Password)
+	assert.True(t, created.Active)
+
+	stored, err := store.GetUser(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("correct horse")))
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/api/users", `{"username":"bob","email":"bob@example.com","password":"correct horse","role":"viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/api/users", `{"username":"eve","email":"eve@example.com","password":"correct horse","role":"developer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/api/users", `{"username":"eve","email":"eve@example.com","password":"short","role":"user"}`).Code)
+
+	rec = do(http.MethodPut, "/admin/api/users/"+created.ID, `{"role":"user","active":false}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	stored, err = store.GetUser(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, admin.RoleUser, stored.Role)
+	assert.False(t, stored.Active)
+	assert.Equal(t, "bob@example.com", stored.Email)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("correct horse")))
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/api/users/"+created.ID, `{"username":"robert"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/admin/api/users/missing", `{"role":"user"}`).Code)
+
+	rec = do(http.MethodGet, "/admin/api/users", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listed []mongodb.UserDocument
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Password)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/api/users/"+created.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/api/users/"+created.ID, "").Code)
+}
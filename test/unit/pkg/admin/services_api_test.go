@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryServices is a ServiceStore kept in memory, keyed by the namespace
+// of the context and the name
+type memoryServices struct {
+	mu       sync.Mutex
+	services []config.ServiceConfig
+	failing  bool
+}
+
+func (m *memoryServices) LoadServices(ctx context.Context) ([]config.ServiceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]config.ServiceConfig{}, m.services...), nil
+}
+
+func (m *memoryServices) SaveService(ctx context.Context, svc *config.ServiceConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failing {
+		return errors.New("store unavailable")
+	}
+	stored := *svc
+	stored.Namespace, _ = mongodb.NamespaceFromContext(ctx)
+	for i := range m.services {
+		if m.services[i].Namespace == stored.Namespace && m.services[i].Name == svc.Name {
+			m.services[i] = stored
+			return nil
+		}
+	}
+	m.services = append(m.services, stored)
+	return nil
+}
+
+func (m *memoryServices) DeleteService(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	namespace, _ := mongodb.NamespaceFromContext(ctx)
+	for i := range m.services {
+		if m.services[i].Namespace == namespace && m.services[i].Name == name {
+			m.services = append(m.services[:i], m.services[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("service not found")
+}
+
+// recordingRouter routes whatever it is given, except base paths under /reserved
+type recordingRouter struct {
+	routed []config.ServiceConfig
+}
+
+func (r *recordingRouter) SetStoredServices(services []config.ServiceConfig) error {
+	for _, svc := range services {
+		if strings.HasPrefix(svc.BasePath, "/reserved") {
+			return errors.New("base path " + svc.BasePath + " is already used")
+		}
+	}
+	r.routed = services
+	return nil
+}
+
+func routedNames(services []config.ServiceConfig) []string {
+	names := []string{}
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	return names
+}
+
+func TestStoredServicesHandler(t *testing.T) {
+	store := &memoryServices{}
+	router := &recordingRouter{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	e := echo.New()
+	admin.NewStoredServicesHandler(store, router, logger).RegisterRoutes(e.Group("/admin"))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/admin/api/services", `{"name":"users","basePath":"/users","targets":["http://users:8080"],"timeout":"5s"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created admin.ServiceResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "5s", created.Timeout)
+	assert.Equal(t, "round-robin", created.LoadBalancing)
+	assert.Equal(t, []string{"users"}, routedNames(router.routed))
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/api/services", `{"name":"users","basePath":"/people","targets":["http://users:8080"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/api/services", `{"name":"carts","basePath":"/carts"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/api/services", `{"name":"carts","basePath":"/carts","targets":["http://carts"],"timeout":"soon"}`).Code)
+
+	// Changes the router refuses are not stored
+	assert.Equal(t, http.StatusUnprocessableEntity, do(http.MethodPost, "/admin/api/services", `{"name":"carts","basePath":"/reserved","targets":["http://carts"]}`).Code)
+	assert.Len(t, store.services, 1)
+
+	// Changes that cannot be stored are unrouted
+	store.failing = true
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodPost, "/admin/api/services", `{"name":"carts","basePath":"/carts","targets":["http://carts"]}`).Code)
+	assert.Equal(t, []string{"users"}, routedNames(router.routed))
+	store.failing = false
+
+	rec = do(http.MethodPut, "/admin/api/services/users", `{"basePath":"/users","targets":["http://users-v2:8080"]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, []string{"http://users-v2:8080"}, router.routed[0].Targets)
+	assert.Equal(t, []string{"http://users-v2:8080"}, store.services[0].Targets)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/api/services/users", `{"name":"people","basePath":"/users","targets":["http://users"]}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/admin/api/services/carts", `{"basePath":"/carts","targets":["http://carts"]}`).Code)
+
+	rec = do(http.MethodGet, "/admin/api/services/users", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/admin/api/services/carts", "").Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/api/services/users", "").Code)
+	assert.Empty(t, router.routed)
+	assert.Empty(t, store.services)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/api/services/users", "").Code)
+
+	rec = do(http.MethodGet, "/admin/api/services", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+}
+
+func TestStoredServicesHandlerNamespaces(t *testing.T) {
+	store := &memoryServices{services: []config.ServiceConfig{
+		{Name: "users", BasePath: "/users", Targets: []string{"http://users:8080"}},
+		{Name: "users", Namespace: "payments", BasePath: "/payments/users", Targets: []string{"http://payments-users:8080"}},
+	}}
+	router := &recordingRouter{}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	e := echo.New()
+	admin.NewStoredServicesHandler(store, router, logger).RegisterRoutes(e.Group("/admin"))
+	// Requests of the search namespace admin are limited to their namespace
+	scoped := e.Group("/search", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(admin.NamespaceContextKey, "search")
+			return next(c)
+		}
+	})
+	admin.NewStoredServicesHandler(store, router, logger).RegisterRoutes(scoped)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(path string) admin.ServiceResponse {
+		rec := do(http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var svc admin.ServiceResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &svc))
+		return svc
+	}
+	list := func(path string) []admin.ServiceResponse {
+		rec := do(http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var services []admin.ServiceResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &services))
+		return services
+	}
+
+	assert.Len(t, list("/admin/api/services"), 2)
+	assert.Len(t, list("/admin/api/services?namespace=payments"), 1)
+	assert.Equal(t, "/users", get("/admin/api/services/users").BasePath)
+	assert.Equal(t, "/payments/users", get("/admin/api/services/users?namespace=payments").BasePath)
+
+	// Services sharing a name are changed independently
+	rec := do(http.MethodPut, "/admin/api/services/users?namespace=payments", `{"basePath":"/payments/users","targets":["http://payments-users-v2:8080"]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, []string{"http://payments-users-v2:8080"}, get("/admin/api/services/users?namespace=payments").Targets)
+	assert.Equal(t, []string{"http://users:8080"}, get("/admin/api/services/users").Targets)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/admin/api/services/users?namespace=payments", `{"namespace":"search","basePath":"/payments/users","targets":["http://payments-users"]}`).Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/admin/api/services/users?namespace=payments", "").Code)
+	require.Len(t, store.services, 1)
+	assert.Equal(t, "", store.services[0].Namespace)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/api/services/users?namespace=payments", "").Code)
+
+	rec = do(http.MethodPost, "/admin/api/services", `{"name":"users","namespace":"payments","basePath":"/payments/users","targets":["http://payments-users:8080"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/api/services?namespace=payments", `{"name":"users","basePath":"/payments/people","targets":["http://payments-users:8080"]}`).Code)
+
+	// A namespace admin only reaches the services of their namespace
+	assert.Empty(t, list("/search/api/services?namespace=payments"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/search/api/services/users?namespace=payments", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/search/api/services/users", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/search/api/services", `{"name":"users","namespace":"payments","basePath":"/search/users","targets":["http://search-users"]}`).Code)
+	rec = do(http.MethodPost, "/search/api/services", `{"name":"users","basePath":"/search/users","targets":["http://search-users:8080"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, "search", get("/search/api/services/users").Namespace)
+	assert.Len(t, store.services, 3)
+}
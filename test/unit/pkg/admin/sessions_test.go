@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memorySessions is a SessionStore kept in memory
+type memorySessions struct {
+	mu     sync.Mutex
+	tokens map[string]*mongodb.RefreshTokenDocument
+	audit  []*mongodb.AuditLogDocument
+}
+
+func (m *memorySessions) CreateRefreshToken(ctx context.Context, token *mongodb.RefreshTokenDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *token
+	m.tokens[token.ID] = &copied
+	return nil
+}
+
+func (m *memorySessions) GetRefreshToken(ctx context.Context, id string) (*mongodb.RefreshTokenDocument, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (m *memorySessions) RevokeRefreshToken(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[id]
+	if !ok || !token.RevokedAt.IsZero() {
+		return false, nil
+	}
+	token.RevokedAt = token.CreatedAt
+	return true, nil
+}
+
+func (m *memorySessions) RevokeRefreshTokens(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.tokens {
+		if token.SessionID == sessionID && token.RevokedAt.IsZero() {
+			token.RevokedAt = token.CreatedAt
+		}
+	}
+	return nil
+}
+
+func (m *memorySessions) CreateAuditLog(ctx context.Context, log *mongodb.AuditLogDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, log)
+	return nil
+}
+
+type sessionTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	Role         string `json:"role"`
+}
+
+func TestAdminSessions(t *testing.T) {
+	t.Chdir(t.TempDir()) // Register creates the templates directory
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("viewer-pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users := &memoryUsers{users: map[string]*mongodb.UserDocument{
+		"u1": {ID: "u1", Username: "vera", Email: "vera@example.com", Password: string(hash), Role: admin.RoleViewer, Active: true},
+	}}
+	store := &memorySessions{tokens: make(map[string]*mongodb.RefreshTokenDocument)}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := admin.New(config.NewStore(&config.Config{Admin: config.AdminConfig{Enabled: true, Username: "root", Password: "root-pass"}}), "", logger)
+	h.SetUserStore(users)
+	h.SetSessions(store, "jwt-secret")
+	e := echo.New()
+	h.Register(e)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	tokens := func(rec *httptest.ResponseRecorder) sessionTokens {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var pair sessionTokens
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+		return pair
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/admin/api/auth/login", "", `{"username":"vera","password":"wrong"}`).Code)
+
+	viewer := tokens(do(http.MethodPost, "/admin/api/auth/login", "", `{"username":"vera","password":"viewer-pass"}`))
+	assert.Equal(t, admin.RoleViewer, viewer.Role)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/admin/api/settings/server", viewer.AccessToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/api/settings", viewer.AccessToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/admin/api/settings/reload", viewer.AccessToken, "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/api/consumers", viewer.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/api/settings", "forged", "").Code)
+
+	// Refresh tokens are used once, and reusing one ends the session
+	refreshed := tokens(do(http.MethodPost, "/admin/api/auth/refresh", "", `{"refreshToken":"`+viewer.RefreshToken+`"}`))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/admin/api/settings/server", refreshed.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/admin/api/auth/refresh", "", `{"refreshToken":"`+viewer.RefreshToken+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/admin/api/auth/refresh", "", `{"refreshToken":"`+refreshed.RefreshToken+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/api/settings/server", refreshed.AccessToken, "").Code)
+
+	// Logging out revokes both tokens
+	root := tokens(do(http.MethodPost, "/admin/api/auth/login", "", `{"username":"root","password":"root-pass"}`))
+	assert.Equal(t, admin.RoleAdmin, root.Role)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/api/auth/logout", root.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/api/settings", root.AccessToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/admin/api/auth/refresh", "", `{"refreshToken":"`+root.RefreshToken+`"}`).Code)
+
+	// Deactivated users cannot refresh their sessions
+	viewer = tokens(do(http.MethodPost, "/admin/api/auth/login", "", `{"username":"vera","password":"viewer-pass"}`))
+	users.users["u1"].Active = false
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/admin/api/auth/refresh", "", `{"refreshToken":"`+viewer.RefreshToken+`"}`).Code)
+
+	var attempts []string
+	for _, log := range store.audit {
+		attempts = append(attempts, log.Action+" "+log.Username+" "+log.Status)
+	}
+	assert.Equal(t, []string{
+		"admin.login vera failure",
+		"admin.login vera success",
+		"admin.login root success",
+		"admin.logout root success",
+		"admin.login vera success",
+	}, attempts)
+}
+
+func TestAdminBasicAuth(t *testing.T) {
+	t.Chdir(t.TempDir()) // Register creates the templates directory
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	sum := sha256.Sum256([]byte("test-token"))
+	server := func(basicAuth bool) *echo.Echo {
+		h := admin.New(config.NewStore(&config.Config{Admin: config.AdminConfig{
+			Enabled:   true,
+			Username:  "root",
+			Password:  "root-pass",
+			Tokens:    []config.AdminTokenConfig{{Name: "test", SHA256: hex.EncodeToString(sum[:])}},
+			BasicAuth: basicAuth,
+		}}), "", logger)
+		e := echo.New()
+		h.Register(e)
+		return e
+	}
+	get := func(e *echo.Echo, prepare func(req *http.Request)) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/api/settings", nil)
+		prepare(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	login := func(e *echo.Echo) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader("username=root&password=root-pass"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	basic := func(req *http.Request) { req.SetBasicAuth("root", "root-pass") }
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer test-token") }
+
+	// Off by default: only tokens and sessions are accepted
+	e := server(false)
+	assert.Equal(t, http.StatusUnauthorized, get(e, basic))
+	assert.Equal(t, http.StatusOK, get(e, bearer))
+	rec := login(e)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Result().Cookies())
+	assert.Equal(t, http.StatusUnauthorized, get(e, func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "Authorization", Value: base64.StdEncoding.EncodeToString([]byte("root:root-pass"))})
+	}))
+
+	e = server(true)
+	assert.Equal(t, http.StatusOK, get(e, basic))
+	assert.Equal(t, http.StatusOK, get(e, bearer))
+	rec = login(e)
+	require.Equal(t, http.StatusOK, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.NotEmpty(t, cookies)
+	assert.Equal(t, http.StatusOK, get(e, func(req *http.Request) {
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+	}))
+}
+
+func TestAdminSessionsWithoutSecret(t *testing.T) {
+	t.Chdir(t.TempDir()) // Register creates the templates directory
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	h := admin.New(config.NewStore(&config.Config{Admin: config.AdminConfig{Enabled: true, Username: "root", Password: "root-pass"}}), "", logger)
+	h.SetSessions(&memorySessions{tokens: make(map[string]*mongodb.RefreshTokenDocument)}, "")
+	e := echo.New()
+	h.Register(e)
+
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/api/settings", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The key an empty secret would derive is public
+	key := sha256.Sum256([]byte("odin-admin:"))
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"role": admin.RoleAdmin,
+		"sid":  "forged",
+		"sub":  "mallory",
+		"aud":  "odin-admin",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString(key[:])
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, get(forged))
+
+	// Tokens the gateway issued itself are accepted
+	req := httptest.NewRequest(http.MethodPost, "/admin/api/auth/login", strings.NewReader(`{"username":"root","password":"root-pass"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var pair sessionTokens
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+	assert.Equal(t, http.StatusOK, get(pair.AccessToken))
+}
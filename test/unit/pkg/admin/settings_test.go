@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+	"odin/pkg/cache"
+	"odin/pkg/config"
+	"odin/pkg/monitoring"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingReloader struct {
+	reloaded *config.Config
+}
+
+func (r *recordingReloader) Reload(cfg *config.Config) (*config.ReloadReport, error) {
+	r.reloaded = cfg
+	return &config.ReloadReport{Applied: []string{"logging"}, RequiresRestart: []string{"services"}}, nil
+}
+
+func postJSON(t *testing.T, handler echo.HandlerFunc, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler(echo.New().NewContext(req, rec)))
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec, resp
+}
+
+func TestSettingsHandler_ClearCache(t *testing.T) {
+	store := cache.NewMemoryStore()
+	cfg := &config.Config{Services: []config.ServiceConfig{{Name: "users", BasePath: "/users"}}}
+	h := admin.NewSettingsHandler("", config.NewStore(cfg), store, nil, logrus.New())
+
+	store.Set(cache.ResponseKey("/users/1", "a"), "alice", 0)
+	store.Set(cache.ResponseKey("/orders/1", "b"), "order", 0)
+
+	rec, resp := postJSON(t, h.ClearCache, `{"service": "users"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(1), resp["purged"])
+
+	rec, _ = postJSON(t, h.ClearCache, `{"service": "billing"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec, resp = postJSON(t, h.ClearCache, `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(1), resp["purged"])
+}
+
+func TestSettingsHandler_ClearCacheDisabled(t *testing.T) {
+	h := admin.NewSettingsHandler("", config.NewStore(&config.Config{}), nil, nil, logrus.New())
+
+	rec, _ := postJSON(t, h.ClearCache, `{}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestSettingsHandler_ReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("logging:\n  level: debug\n"), 0644))
+
+	reloader := &recordingReloader{}
+	h := admin.NewSettingsHandler(path, config.NewStore(&config.Config{}), nil, reloader, logrus.New())
+
+	rec, resp := postJSON(t, h.ReloadConfig, `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []interface{}{"logging"}, resp["applied"])
+	assert.Equal(t, []interface{}{"services"}, resp["requiresRestart"])
+	require.NotNil(t, reloader.reloaded)
+	assert.Equal(t, "debug", reloader.reloaded.Logging.Level)
+}
+
+func TestSettingsHandler_ReloadConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server: [\n"), 0644))
+
+	reloader := &recordingReloader{}
+	h := admin.NewSettingsHandler(path, config.NewStore(&config.Config{}), nil, reloader, logrus.New())
+
+	rec, resp := postJSON(t, h.ReloadConfig, `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.NotEmpty(t, resp["error"])
+	assert.Nil(t, reloader.reloaded)
+}
+
+type staticInFlight map[string]int64
+
+func (s staticInFlight) InFlight() map[string]int64 { return s }
+
+type unreachableCounter struct{}
+
+func (unreachableCounter) Increment(ctx context.Context, key string, start, end time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (unreachableCounter) Ping(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestSettingsHandler_GetSystemStats(t *testing.T) {
+	h := admin.NewSettingsHandler("", config.NewStore(&config.Config{}), cache.NewMemoryStore(), nil, logrus.New())
+	h.SetInFlightCounter(staticInFlight{"users": 3})
+	h.SetRateLimitCounter(unreachableCounter{})
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.GetSystemStats(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Runtime  admin.RuntimeStats           `json:"runtime"`
+		Build    admin.BuildStats             `json:"build"`
+		InFlight map[string]int64             `json:"inFlight"`
+		Stores   map[string]admin.StoreHealth `json:"stores"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	assert.Positive(t, resp.Runtime.Goroutines)
+	assert.Positive(t, resp.Runtime.HeapAlloc)
+	assert.NotEmpty(t, resp.Build.GoVersion)
+	assert.Equal(t, int64(3), resp.InFlight["users"])
+	assert.Equal(t, "ok", resp.Stores["cache"].Status)
+	assert.Equal(t, "unreachable", resp.Stores["rateLimit"].Status)
+	assert.Equal(t, "connection refused", resp.Stores["rateLimit"].Error)
+}
+
+func TestSettingsHandler_GetSystemStatsDisabledStores(t *testing.T) {
+	h := admin.NewSettingsHandler("", config.NewStore(&config.Config{}), nil, nil, logrus.New())
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.GetSystemStats(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+
+	var resp struct {
+		Stores map[string]admin.StoreHealth `json:"stores"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "disabled", resp.Stores["cache"].Status)
+	assert.Equal(t, "disabled", resp.Stores["rateLimit"].Status)
+}
+
+func TestSettingsHandler_UpdateSettingsImpact(t *testing.T) {
+	samples := monitoring.NewRequestSamples(100)
+	start := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		duration := 100 * time.Millisecond
+		if i < 2 {
+			duration = 5 * time.Second
+		}
+		samples.Record("billing", monitoring.RequestSample{
+			Time: start.Add(time.Duration(i) * time.Second), Method: http.MethodGet, Path: "/billing/invoices",
+			Client: "10.0.0.1", Status: http.StatusOK, Duration: duration,
+		})
+	}
+
+	cfg := &config.Config{}
+	h := admin.NewSettingsHandler("", config.NewStore(cfg), nil, nil, logrus.New())
+	h.SetRequestSamples(samples)
+
+	req := httptest.NewRequest(http.MethodPut, "/?dryRun=true", strings.NewReader(
+		`{"port": 8080, "timeout": "2s", "readTimeout": "30s", "writeTimeout": "30s", "gracefulTimeout": "15s"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.UpdateServerSettings(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		DryRun bool                 `json:"dryRun"`
+		Impact admin.SettingsImpact `json:"impact"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	require.Len(t, resp.Impact.Services, 1)
+	assert.Equal(t, "billing", resp.Impact.Services[0].Service)
+	assert.Equal(t, 2, resp.Impact.Services[0].Affected)
+	assert.InDelta(t, 20.0, resp.Impact.Services[0].Percent, 0.01)
+	assert.Equal(t, []string{"a 2s timeout would have cut off 20.0% of requests to billing (2 of the last 10)"}, resp.Impact.Summary)
+	assert.Zero(t, cfg.Server.Port, "a dry run does not change settings")
+
+	req = httptest.NewRequest(http.MethodPut, "/?dryRun=true", strings.NewReader(
+		`{"enabled": true, "limit": 5, "duration": "1m", "strategy": "local"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.UpdateRateLimitSettings(echo.New().NewContext(req, rec)))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Impact.Services, 1)
+	assert.Equal(t, 5, resp.Impact.Services[0].Affected)
+}
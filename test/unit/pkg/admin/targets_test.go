@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/health"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetsHandler(t *testing.T) {
+	cfg := &config.Config{
+		Services: []config.ServiceConfig{
+			{Name: "orders", Targets: []string{"http://orders-1:8080", "http://orders-2:8080"}},
+			{Name: "billing", Targets: []string{"http://billing:8080"}, Versioning: &config.VersioningConfig{
+				Versions: []config.APIVersionConfig{{Name: "v2", Targets: []string{"http://orders-2:8080"}}},
+			}},
+		},
+		TCP: config.TCPConfig{Listeners: []config.TCPListenerConfig{
+			{Name: "postgres", Targets: []string{"db-1:5432"}},
+		}},
+	}
+	maintenance := health.NewMaintenance()
+
+	e := echo.New()
+	admin.NewTargetsHandler(maintenance, config.NewStore(cfg)).RegisterRoutes(e.Group("/admin"))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/admin/api/targets/disable", `{"target":"http://orders-2:8080","reason":"kernel upgrade"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var disabled struct {
+		Target     string   `json:"target"`
+		Reason     string   `json:"reason"`
+		DisabledBy string   `json:"disabledBy"`
+		UsedBy     []string `json:"usedBy"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &disabled))
+	assert.Equal(t, "kernel upgrade", disabled.Reason)
+	assert.Equal(t, "alice", disabled.DisabledBy)
+	assert.Equal(t, []string{"service orders", "service billing"}, disabled.UsedBy)
+	assert.True(t, maintenance.IsDisabled("http://orders-2:8080"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/api/targets/disable", `{"target":"db-1:5432"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/api/targets/disable", `{"target":"http://typo:8080"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/api/targets/disable", `{}`).Code)
+
+	rec = do(http.MethodGet, "/admin/api/targets/disabled", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "db-1:5432", list[0]["target"])
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/api/targets/enable", `{"target":"http://orders-2:8080"}`).Code)
+	assert.False(t, maintenance.IsDisabled("http://orders-2:8080"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/admin/api/targets/enable", `{"target":"http://orders-2:8080"}`).Code)
+}
@@ -0,0 +1,79 @@
+package adminclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/adminclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAuthentication(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client := adminclient.New(server.URL)
+	client.Username, client.Password = "admin", "secret"
+	_, err := client.Resources("services")
+	require.NoError(t, err)
+	assert.Equal(t, "Basic YWRtaW46c2VjcmV0", authorization)
+
+	client.Token = "odin_token"
+	_, err = client.Resources("services")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer odin_token", authorization)
+}
+
+func TestClientApply(t *testing.T) {
+	var contentTypes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/admin/api/declarative/services/orders", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("dryRun"))
+		io.Copy(io.Discard, r.Body)
+		json.NewEncoder(w).Encode(adminclient.Resource{Kind: "services", Name: "orders", Result: "updated"})
+	}))
+	defer server.Close()
+
+	client := adminclient.New(server.URL)
+	res, err := client.Apply("services", "orders", []byte("basePath: /orders\n"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", res.Result)
+
+	_, err = client.Apply("services", "orders", []byte(`{"basePath":"/orders"}`), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"application/yaml", "application/json"}, contentTypes)
+}
+
+func TestClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/api/declarative/services/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"service not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := adminclient.New(server.URL)
+	_, err := client.Resource("services", "missing")
+	var apiErr *adminclient.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "service not found (404)", err.Error())
+
+	_, err = client.Stream("/admin/api/logs")
+	assert.EqualError(t, err, "admin API returned 401 Unauthorized")
+}
@@ -1,13 +1,18 @@
 package aggregator
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"odin/pkg/aggregator"
 	"odin/pkg/config"
 
+	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewAggregator(t *testing.T) {
@@ -53,3 +58,26 @@ func TestAggregatorWithMultipleServices(t *testing.T) {
 	assert.NotNil(t, agg)
 	assert.Equal(t, len(services), 2)
 }
+
+func TestAggregatorSetServices(t *testing.T) {
+	agg := aggregator.New(logrus.New(), []config.ServiceConfig{{Name: "users"}})
+	e := echo.New()
+	agg.RegisterRoutes(e)
+
+	statuses := func() map[string]int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/aggregate?services=users,orders", nil))
+		var body aggregator.AggregateResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		statuses := make(map[string]int)
+		for name, result := range body.Results {
+			statuses[name] = result.Status
+		}
+		return statuses
+	}
+
+	// Services without targets are known but unavailable
+	assert.Equal(t, map[string]int{"users": http.StatusServiceUnavailable, "orders": http.StatusNotFound}, statuses())
+	agg.SetServices([]config.ServiceConfig{{Name: "orders"}})
+	assert.Equal(t, map[string]int{"users": http.StatusNotFound, "orders": http.StatusServiceUnavailable}, statuses())
+}
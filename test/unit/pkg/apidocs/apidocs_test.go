@@ -0,0 +1,121 @@
+package apidocs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/apidocs"
+	"odin/pkg/config"
+	"odin/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spec(path string) *openapi.Spec {
+	return &openapi.Spec{
+		OpenAPI: "3.0.0",
+		Info:    openapi.Info{Title: "backend", Version: "2.1.0"},
+		Paths: map[string]openapi.PathItem{
+			path: {Get: &openapi.Operation{OperationID: "list", Responses: map[string]openapi.Response{"200": {Description: "OK"}}}},
+		},
+	}
+}
+
+func newSite(t *testing.T, cfg config.OpenAPIConfig, apiKeyHeader string) *echo.Echo {
+	site, err := apidocs.New(cfg, []apidocs.Service{
+		{Name: "orders", BasePath: "/orders", Authentication: true, Spec: spec("/items"), PathPrefix: "/orders"},
+		{Name: "catalog", BasePath: "/catalog", Spec: spec("/catalog/products")},
+	}, apiKeyHeader)
+	require.NoError(t, err)
+	e := echo.New()
+	site.Register(e)
+	return e
+}
+
+func get(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "gateway.example.com"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServiceSpec(t *testing.T) {
+	e := newSite(t, config.OpenAPIConfig{UIEnabled: true}, "X-API-Key")
+
+	rec := get(e, "/docs/services/orders/openapi.json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served openapi.Spec
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+
+	// Tried requests go to the gateway, under the service's base path
+	assert.Equal(t, []openapi.Server{{URL: "http://gateway.example.com"}}, served.Servers)
+	assert.Equal(t, "2.1.0", served.Info.Version)
+	op := served.Paths["/orders/items"].Get
+	require.NotNil(t, op)
+
+	// With the credentials the gateway accepts
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}, {"apiKeyAuth": {}}}, op.Security)
+	assert.Equal(t, "header", served.Components.SecuritySchemes["apiKeyAuth"].In)
+	assert.Equal(t, "X-API-Key", served.Components.SecuritySchemes["apiKeyAuth"].Name)
+	assert.Equal(t, "bearer", served.Components.SecuritySchemes["bearerAuth"].Scheme)
+
+	rec = get(e, "/docs/services/catalog/openapi.json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	served = openapi.Spec{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Empty(t, served.Paths["/catalog/products"].Get.Security)
+
+	assert.Equal(t, http.StatusNotFound, get(e, "/docs/services/payments/openapi.json").Code)
+}
+
+func TestAllServicesSpec(t *testing.T) {
+	e := newSite(t, config.OpenAPIConfig{UIEnabled: true, Title: "Shop API"}, "")
+
+	rec := get(e, "/docs/openapi.json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served openapi.Spec
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, "Shop API", served.Info.Title)
+	assert.Equal(t, []string{"orders"}, served.Paths["/orders/items"].Get.Tags)
+	assert.Equal(t, []string{"catalog"}, served.Paths["/catalog/products"].Get.Tags)
+
+	// Without API keys only JWTs are documented
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, served.Paths["/orders/items"].Get.Security)
+	assert.NotContains(t, served.Components.SecuritySchemes, "apiKeyAuth")
+}
+
+func TestPages(t *testing.T) {
+	e := newSite(t, config.OpenAPIConfig{UIEnabled: true, UIPath: "/api/docs/"}, "X-API-Key")
+
+	rec := get(e, "/api/docs")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/api/docs/services/catalog"`)
+	assert.Contains(t, rec.Body.String(), `href="/api/docs/services/orders"`)
+
+	rec = get(e, "/api/docs/services")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var services []apidocs.Service
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &services))
+	require.Len(t, services, 2)
+	assert.Equal(t, "catalog", services[0].Name)
+	assert.True(t, services[1].Authentication)
+
+	rec = get(e, "/api/docs/services/orders")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "swagger-ui-bundle.js")
+	assert.Contains(t, rec.Body.String(), `"/api/docs/services/orders/openapi.json"`)
+	assert.Contains(t, rec.Body.String(), "persistAuthorization: true")
+
+	assert.Equal(t, http.StatusNotFound, get(e, "/api/docs/services/payments").Code)
+
+	e = newSite(t, config.OpenAPIConfig{UIEnabled: true, UIRenderer: "redoc", UIAssetsURL: "/assets/redoc/"}, "")
+	rec = get(e, "/docs/all")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `src="/assets/redoc/redoc.standalone.js"`)
+	assert.Contains(t, rec.Body.String(), `spec-url="/docs/openapi.json"`)
+}
@@ -0,0 +1,183 @@
+package async
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/async"
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T, store async.Store, durable bool) (*async.Manager, *echo.Echo) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	m := async.NewManager(config.AsyncConfig{PollInterval: 20 * time.Millisecond}, store, durable, logger)
+	e := echo.New()
+	m.Register(e)
+	t.Cleanup(m.Stop)
+	return m, e
+}
+
+func serve(e *echo.Echo, method, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitFinished polls the status URL until the job is done
+func waitFinished(t *testing.T, e *echo.Echo, statusURL string) async.Status {
+	var status async.Status
+	require.Eventually(t, func() bool {
+		rec := serve(e, http.MethodGet, statusURL, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		return status.Status == mongodb.AsyncJobCompleted || status.Status == mongodb.AsyncJobFailed
+	}, 2*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestAsyncRequestPolling(t *testing.T) {
+	m, e := newManager(t, async.NewMemoryStore(), false)
+
+	run := func(c echo.Context) error {
+		assert.True(t, async.IsJob(c.Request().Context()))
+		assert.Empty(t, c.Request().Header.Get(async.HeaderPrefer), "Prefer is not sent upstream")
+		body, _ := io.ReadAll(c.Request().Body)
+		c.Response().Header().Set("X-Report", "ready")
+		return c.String(http.StatusCreated, "report for "+string(body)+" "+c.QueryParam("year"))
+	}
+	sync := func(c echo.Context) error { return c.String(http.StatusOK, "sync") }
+	e.Group("/reports", m.Middleware("reports", service.AsyncConfig{}, run)).POST("", sync)
+	m.Start()
+
+	rec := serve(e, http.MethodPost, "/reports", "", nil)
+	assert.Equal(t, "sync", rec.Body.String(), "requests without Prefer: respond-async are served right away")
+
+	rec = serve(e, http.MethodPost, "/reports?year=2025", "sales", map[string]string{"Prefer": "wait=5, respond-async"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, async.RespondAsync, rec.Header().Get(async.HeaderPreferenceApplied))
+	var accepted async.Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &accepted))
+	assert.Equal(t, rec.Header().Get(echo.HeaderLocation), accepted.StatusURL)
+	assert.True(t, strings.HasPrefix(accepted.StatusURL, "/_async/jobs/"))
+
+	status := waitFinished(t, e, accepted.StatusURL)
+	assert.Equal(t, mongodb.AsyncJobCompleted, status.Status)
+	assert.Equal(t, http.StatusCreated, status.ResponseStatus)
+
+	rec = serve(e, http.MethodGet, status.ResultURL, "", nil)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "ready", rec.Header().Get("X-Report"))
+	assert.Equal(t, "report for sales 2025", rec.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(e, http.MethodGet, "/_async/jobs/unknown", "", nil).Code)
+}
+
+func TestAsyncRequestErrors(t *testing.T) {
+	m, e := newManager(t, async.NewMemoryStore(), false)
+
+	run := func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadGateway, "Service unavailable")
+	}
+	e.Group("/reports", m.Middleware("reports", service.AsyncConfig{Mode: async.ModeAlways}, run)).POST("", nil)
+	m.Start()
+
+	rec := serve(e, http.MethodPost, "/reports", "", nil)
+	require.Equal(t, http.StatusAccepted, rec.Code, "every request is asynchronous in mode always")
+	status := waitFinished(t, e, rec.Header().Get(echo.HeaderLocation))
+	assert.Equal(t, mongodb.AsyncJobCompleted, status.Status, "error responses are results too")
+	assert.Equal(t, http.StatusBadGateway, status.ResponseStatus)
+
+	rec = serve(e, http.MethodPost, "/reports", "", map[string]string{async.HeaderCallback: "http://evil.example/hook"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "callbacks need an allowed host")
+}
+
+func TestAsyncRequestCallback(t *testing.T) {
+	deliveries := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	m, e := newManager(t, async.NewMemoryStore(), false)
+	cfg := service.AsyncConfig{
+		CallbackHosts:  []string{"127.0.0.1"},
+		CallbackSecret: "s3cret",
+	}
+	run := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.Group("/reports", m.Middleware("reports", cfg, run)).POST("", nil)
+	m.Start()
+
+	rec := serve(e, http.MethodPost, "/reports", "", map[string]string{
+		"Prefer":             "respond-async",
+		async.HeaderCallback: receiver.URL + "/hooks/reports",
+	})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	select {
+	case delivery := <-deliveries:
+		body := <-bodies
+		var status async.Status
+		require.NoError(t, json.Unmarshal(body, &status))
+		assert.Equal(t, mongodb.AsyncJobCompleted, status.Status)
+		assert.Equal(t, http.StatusNoContent, status.ResponseStatus)
+		assert.Equal(t, "async.completed", delivery.Header.Get(events.HeaderEvent))
+
+		timestamp, err := strconv.ParseInt(delivery.Header.Get(events.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, events.Sign("s3cret", timestamp, body), delivery.Header.Get(events.HeaderSignature))
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+func TestAsyncDurableStorePickup(t *testing.T) {
+	store := async.NewMemoryStore()
+	// A job accepted by a gateway that stopped before running it
+	require.NoError(t, store.CreateAsyncJob(t.Context(), &mongodb.AsyncJobDocument{
+		ID:      "left-over",
+		Service: "reports",
+		Status:  mongodb.AsyncJobPending,
+		Method:  http.MethodPost,
+		Path:    "/reports",
+		TTL:     time.Now().Add(time.Hour),
+	}))
+
+	m, e := newManager(t, store, true)
+	run := func(c echo.Context) error { return c.String(http.StatusOK, "done") }
+	e.Group("/reports", m.Middleware("reports", service.AsyncConfig{}, run)).POST("", nil)
+	m.Start()
+
+	status := waitFinished(t, e, "/_async/jobs/left-over")
+	assert.Equal(t, mongodb.AsyncJobCompleted, status.Status)
+
+	job, err := store.GetAsyncJob(t.Context(), "left-over")
+	require.NoError(t, err)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "done", string(job.ResponseBody))
+
+	claimed, err := store.ClaimAsyncJob(t.Context(), "left-over", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Nil(t, claimed, "finished jobs are not run again")
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/certs"
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyStore map[string]*mongodb.APIKeyDocument
+
+func (s keyStore) GetAPIKey(ctx context.Context, key string) (*mongodb.APIKeyDocument, error) {
+	if doc, ok := s[key]; ok {
+		return doc, nil
+	}
+	return nil, errors.New("API key not found")
+}
+
+func TestAPIKeyPinning(t *testing.T) {
+	clientCert := &x509.Certificate{Raw: []byte("client certificate")}
+	otherCert := &x509.Certificate{Raw: []byte("other certificate")}
+	expired := time.Now().Add(-time.Hour)
+
+	store := keyStore{
+		"open":     {Key: "open", Enabled: true},
+		"off":      {Key: "off", Enabled: false},
+		"expired":  {Key: "expired", Enabled: true, ExpiresAt: &expired},
+		"pending":  {Key: "pending", Enabled: true, Status: mongodb.APIKeyPending},
+		"rejected": {Key: "rejected", Enabled: true, Status: mongodb.APIKeyRejected},
+		"approved": {Key: "approved", Enabled: true, Status: mongodb.APIKeyApproved},
+		"cert":     {Key: "cert", Enabled: true, CertFingerprints: []string{certs.Fingerprint(clientCert)}},
+		"ja3":      {Key: "ja3", Enabled: true, JA3Fingerprints: []string{"E7D705A3286E19EA42F587B344EE6865"}},
+	}
+
+	apiKeys := auth.NewAPIKeyAuth(store, "X-API-Key")
+	apiKeys.SetJA3Lookup(func(r *http.Request) string {
+		return r.Header.Get("X-Test-JA3")
+	})
+
+	e := echo.New()
+	handler := auth.NewAuthMiddleware(config.AuthConfig{JWTSecret: "test-secret"}, apiKeys)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		cert   *x509.Certificate
+		ja3    string
+		status int
+	}{
+		{name: "unpinned key", key: "open", status: http.StatusOK},
+		{name: "unknown key", key: "missing", status: http.StatusUnauthorized},
+		{name: "disabled key", key: "off", status: http.StatusUnauthorized},
+		{name: "expired key", key: "expired", status: http.StatusUnauthorized},
+		{name: "pending key", key: "pending", status: http.StatusUnauthorized},
+		{name: "rejected key", key: "rejected", status: http.StatusUnauthorized},
+		{name: "approved key", key: "approved", status: http.StatusOK},
+		{name: "pinned certificate", key: "cert", cert: clientCert, status: http.StatusOK},
+		{name: "other certificate", key: "cert", cert: otherCert, status: http.StatusUnauthorized},
+		{name: "no certificate", key: "cert", status: http.StatusUnauthorized},
+		{name: "pinned ja3", key: "ja3", ja3: "e7d705a3286e19ea42f587b344ee6865", status: http.StatusOK},
+		{name: "other ja3", key: "ja3", ja3: "0123456789abcdef0123456789abcdef", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+			req.Header.Set("X-API-Key", tt.key)
+			if tt.cert != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			}
+			if tt.ja3 != "" {
+				req.Header.Set("X-Test-JA3", tt.ja3)
+			}
+
+			rec := httptest.NewRecorder()
+			err := handler(e.NewContext(req, rec))
+			if tt.status == http.StatusOK {
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			var httpErr *echo.HTTPError
+			if assert.ErrorAs(t, err, &httpErr) {
+				assert.Equal(t, tt.status, httpErr.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareFallsBackToJWT(t *testing.T) {
+	apiKeys := auth.NewAPIKeyAuth(keyStore{}, "X-API-Key")
+	handler := auth.NewAuthMiddleware(config.AuthConfig{JWTSecret: "test-secret"}, apiKeys)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	err := handler(echo.New().NewContext(req, httptest.NewRecorder()))
+
+	var httpErr *echo.HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, "Missing authorization header", httpErr.Message)
+	}
+}
+
+type revoked map[string]bool
+
+func (r revoked) TokenRevoked(id string, subjects []string, issuedAt time.Time) bool {
+	return r[id]
+}
+
+func (r revoked) APIKeyRevoked(id string) bool {
+	return r[id]
+}
+
+func TestRevokedCredentials(t *testing.T) {
+	apiKeys := auth.NewAPIKeyAuth(keyStore{
+		"live":    {ID: "key-1", Key: "live", Enabled: true},
+		"revoked": {ID: "key-2", Key: "revoked", Enabled: true},
+	}, "X-API-Key")
+	revocations := revoked{"key-2": true, "token-2": true}
+	apiKeys.SetRevocations(revocations)
+
+	cfg := config.AuthConfig{JWTSecret: "test-secret"}
+	handler := auth.RejectRevokedTokens(auth.NewAuthMiddleware(cfg, apiKeys), revocations)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	manager := auth.NewJWTManager(auth.JWTConfig{Secret: cfg.JWTSecret, AccessTokenTTL: time.Hour})
+	token := func(id string) string {
+		signed, err := manager.GenerateToken(&auth.Claims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{name: "live key", header: "X-API-Key", value: "live", status: http.StatusOK},
+		{name: "revoked key", header: "X-API-Key", value: "revoked", status: http.StatusUnauthorized},
+		{name: "live token", header: "Authorization", value: "Bearer " + token("token-1"), status: http.StatusOK},
+		{name: "revoked token", header: "Authorization", value: "Bearer " + token("token-2"), status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			err := handler(echo.New().NewContext(req, rec))
+			if tt.status == http.StatusOK {
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			var httpErr *echo.HTTPError
+			if assert.ErrorAs(t, err, &httpErr) {
+				assert.Equal(t, tt.status, httpErr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) writeBundle(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600))
+	return path
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	clientCert, err := auth.NewClientCertAuth(config.ClientCertConfig{
+		CAFile:      ca.writeBundle(t),
+		AllowedCNs:  []string{"billing"},
+		AllowedSANs: []string{"*.orders.internal"},
+	})
+	require.NoError(t, err)
+
+	var forwarded http.Header
+	var user *auth.JWTClaims
+	e := echo.New()
+	handler := clientCert.Middleware()(func(c echo.Context) error {
+		forwarded = c.Request().Header.Clone()
+		user, _ = c.Get("user").(*auth.JWTClaims)
+		return c.NoContent(http.StatusOK)
+	})
+	serve := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("X-Client-Cert-CN", "spoofed")
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		rec := httptest.NewRecorder()
+		if err := handler(e.NewContext(req, rec)); err != nil {
+			e.HTTPErrorHandler(err, e.NewContext(req, rec))
+		}
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(ca.issue(t, "worker", "api.orders.internal")))
+	assert.Equal(t, "worker", forwarded.Get("X-Client-Cert-CN"))
+	assert.Equal(t, "api.orders.internal", forwarded.Get("X-Client-Cert-SAN"))
+	assert.Equal(t, "CN=worker", forwarded.Get("X-Client-Cert-Subject"))
+	assert.NotEmpty(t, forwarded.Get("X-Client-Cert-Fingerprint"))
+	require.NotNil(t, user)
+	assert.Equal(t, "worker", user.UserID)
+
+	assert.Equal(t, http.StatusOK, serve(ca.issue(t, "billing")))
+	assert.Equal(t, "billing", forwarded.Get("X-Client-Cert-CN"))
+	assert.Empty(t, forwarded.Get("X-Client-Cert-SAN"))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(other.issue(t, "billing")))
+	assert.Equal(t, http.StatusForbidden, serve(ca.issue(t, "reports", "api.reports.internal")))
+}
+
+func TestClientCertAuthRequiresBundle(t *testing.T) {
+	_, err := auth.NewClientCertAuth(config.ClientCertConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o600))
+	_, err = auth.NewClientCertAuth(config.ClientCertConfig{CAFile: empty})
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type hmacSecrets map[string]string
+
+func (s hmacSecrets) HMACSecret(keyID string) (string, bool) {
+	secret, ok := s[keyID]
+	return secret, ok
+}
+
+func TestHMACAuth(t *testing.T) {
+	hmacAuth := auth.NewHMACAuth(config.HMACConfig{Algorithm: "sha512", ClockSkew: time.Minute, MaxBodySize: 64}, hmacSecrets{"acme-1": "s3cret"})
+
+	var received string
+	var keyID interface{}
+	e := echo.New()
+	handler := hmacAuth.Middleware()(func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		received, keyID = string(body), c.Get("hmacKeyID")
+		return c.NoContent(http.StatusOK)
+	})
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		if err := handler(e.NewContext(req, rec)); err != nil {
+			e.HTTPErrorHandler(err, e.NewContext(req, rec))
+		}
+		return rec.Code
+	}
+	// signed builds a request to uri signed with secret at ts
+	signed := func(method, uri, body, secret string, ts time.Time) *http.Request {
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		req.Header.Set("X-Key-ID", "acme-1")
+		req.Header.Set("X-Timestamp", strconv.FormatInt(ts.Unix(), 10))
+		req.Header.Set("X-Signature", hmacAuth.Sign(secret, ts.Unix(), method, uri, []byte(body)))
+		return req
+	}
+
+	now := time.Now()
+	req := signed(http.MethodPost, "/hooks/orders?source=shop", `{"id":1}`, "s3cret", now)
+	assert.True(t, strings.HasPrefix(req.Header.Get("X-Signature"), "sha512="))
+	assert.Equal(t, http.StatusOK, serve(req))
+	assert.Equal(t, `{"id":1}`, received, "the body is passed on after it is verified")
+	assert.Equal(t, "acme-1", keyID)
+
+	// The same request cannot be replayed
+	assert.Equal(t, http.StatusUnauthorized, serve(signed(http.MethodPost, "/hooks/orders?source=shop", `{"id":1}`, "s3cret", now)))
+
+	assert.Equal(t, http.StatusOK, serve(signed(http.MethodPost, "/hooks/orders", `{"id":2}`, "s3cret", now.Add(-30*time.Second))))
+	assert.Equal(t, http.StatusUnauthorized, serve(signed(http.MethodPost, "/hooks/orders", `{"id":3}`, "wrong", now)))
+	assert.Equal(t, http.StatusUnauthorized, serve(signed(http.MethodPost, "/hooks/orders", `{"id":4}`, "s3cret", now.Add(-2*time.Minute))))
+	assert.Equal(t, http.StatusUnauthorized, serve(signed(http.MethodPost, "/hooks/orders", `{"id":5}`, "s3cret", now.Add(2*time.Minute))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(signed(http.MethodPost, "/hooks/orders", strings.Repeat("x", 65), "s3cret", now)))
+
+	// A signature only covers its own method, path and body
+	req = signed(http.MethodPost, "/hooks/orders", `{"id":6}`, "s3cret", now)
+	req.URL.Path, req.RequestURI = "/hooks/refunds", "/hooks/refunds"
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+	req = signed(http.MethodPost, "/hooks/orders", `{"id":7}`, "s3cret", now)
+	req.Body = io.NopCloser(strings.NewReader(`{"id":8}`))
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+
+	req = signed(http.MethodPost, "/hooks/orders", `{"id":9}`, "s3cret", now)
+	req.Header.Set("X-Key-ID", "unknown")
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+	req = httptest.NewRequest(http.MethodPost, "/hooks/orders", nil)
+	assert.Equal(t, http.StatusUnauthorized, serve(req))
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identityProvider serves discovery and the JWKS of its current keys
+type identityProvider struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches atomic.Int32
+}
+
+func newIdentityProvider(t *testing.T) *identityProvider {
+	idp := &identityProvider{keys: make(map[string]*rsa.PrivateKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.fetches.Add(1)
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, key := range idp.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// rotate replaces the provider's keys with a new one
+func (idp *identityProvider) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+func (idp *identityProvider) token(t *testing.T, kid string, claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	key := idp.keys[kid]
+	idp.mu.Unlock()
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestOIDCProvider(t *testing.T) {
+	idp := newIdentityProvider(t)
+	idp.rotate(t, "key-1")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	provider := auth.NewOIDCProvider(config.OIDCProviderConfig{
+		Name:     "idp",
+		Issuer:   idp.URL,
+		Audience: []string{"orders-api"},
+		Scopes:   []string{"openid"},
+	}, config.AuthConfig{}, nil, logger)
+	provider.Start()
+	defer provider.Stop()
+	assert.Equal(t, int32(1), idp.fetches.Load())
+
+	var user *auth.JWTClaims
+	e := echo.New()
+	handler := provider.Middleware([]string{"orders:read"})(func(c echo.Context) error {
+		user, _ = c.Get("user").(*auth.JWTClaims)
+		return c.NoContent(http.StatusOK)
+	})
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		if err := handler(e.NewContext(req, rec)); err != nil {
+			e.HTTPErrorHandler(err, e.NewContext(req, rec))
+		}
+		return rec
+	}
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":                idp.URL,
+			"sub":                "user-42",
+			"aud":                "orders-api",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"scope":              "openid orders:read",
+			"preferred_username": "alice",
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	rec := serve(idp.token(t, "key-1", claims(nil)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, user)
+	assert.Equal(t, "user-42", user.UserID)
+	assert.Equal(t, "alice", user.Username)
+
+	// scp arrays count as scopes too
+	rec = serve(idp.token(t, "key-1", claims(jwt.MapClaims{"scope": nil, "scp": []string{"openid", "orders:read"}})))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"wrong issuer", jwt.MapClaims{"iss": "https://other.example.com"}, http.StatusUnauthorized},
+		{"wrong audience", jwt.MapClaims{"aud": "billing-api"}, http.StatusUnauthorized},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, http.StatusUnauthorized},
+		{"no expiry", jwt.MapClaims{"exp": nil}, http.StatusUnauthorized},
+		{"missing service scope", jwt.MapClaims{"scope": "openid"}, http.StatusForbidden},
+		{"missing provider scope", jwt.MapClaims{"scope": "orders:read"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := claims(tt.claims)
+			for k, v := range c {
+				if v == nil {
+					delete(c, k)
+				}
+			}
+			rec := serve(idp.token(t, "key-1", c))
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusForbidden {
+				assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+			}
+		})
+	}
+
+	// Tokens signed with a shared secret are refused
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil))
+	signed, err := hmac.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(signed).Code)
+
+	// A rotated key is fetched when the first token signed with it arrives
+	idp.rotate(t, "key-2")
+	fetches := idp.fetches.Load()
+	assert.Equal(t, http.StatusOK, serve(idp.token(t, "key-2", claims(nil))).Code)
+	assert.Equal(t, fetches+1, idp.fetches.Load())
+
+	// Other unknown keys do not make it fetch the keys over and over
+	assert.Equal(t, http.StatusUnauthorized, serve(idp.token(t, "key-3", claims(nil))).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(idp.token(t, "key-4", claims(nil))).Code)
+	assert.Equal(t, fetches+1, idp.fetches.Load())
+}
+
+func TestOIDCProviderRefreshesKeys(t *testing.T) {
+	idp := newIdentityProvider(t)
+	idp.rotate(t, "key-1")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	provider := auth.NewOIDCProvider(config.OIDCProviderConfig{
+		Name:            "idp",
+		Issuer:          idp.URL,
+		RefreshInterval: 20 * time.Millisecond,
+	}, config.AuthConfig{}, nil, logger)
+	provider.Start()
+	defer provider.Stop()
+
+	assert.Eventually(t, func() bool { return idp.fetches.Load() >= 3 }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rateLimitStore struct {
+	mu   sync.Mutex
+	docs map[string]mongodb.RateLimitDocument
+}
+
+func (s *rateLimitStore) UpdateRateLimit(ctx context.Context, limit *mongodb.RateLimitDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[limit.Key] = *limit
+	return nil
+}
+
+func (s *rateLimitStore) ListRateLimits(ctx context.Context, prefix string, expiresAfter time.Time) ([]*mongodb.RateLimitDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var limits []*mongodb.RateLimitDocument
+	for _, doc := range s.docs {
+		if strings.HasPrefix(doc.Key, prefix) && doc.ExpiresAt.After(expiresAfter) {
+			limits = append(limits, &doc)
+		}
+	}
+	return limits, nil
+}
+
+// limiterCall passes a request with key through the limiter's middleware
+func limiterCall(limiter *auth.APIKeyLimiter) func(key *mongodb.APIKeyDocument) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	return func(key *mongodb.APIKeyDocument) (*httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		if key != nil {
+			c.Set("apiKey", key)
+		}
+		return rec, limiter.Middleware()(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})(c)
+	}
+}
+
+func TestAPIKeyLimiter(t *testing.T) {
+	store := &rateLimitStore{docs: make(map[string]mongodb.RateLimitDocument)}
+	limiter := auth.NewAPIKeyLimiter(ratelimit.NewMemoryCounter(), store, logrus.New())
+	limiter.Start()
+	call := limiterCall(limiter)
+
+	limited := &mongodb.APIKeyDocument{ID: "k1", Name: "limited", RateLimit: 2}
+	rec, err := call(limited)
+	require.NoError(t, err)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("X-RateLimit-Reset"))
+	_, err = call(limited)
+	require.NoError(t, err)
+
+	rec, err = call(limited)
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusTooManyRequests, httpErr.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Keys without a limit, keys of plans and requests without a key are left alone
+	for _, key := range []*mongodb.APIKeyDocument{
+		{ID: "k2"},
+		{ID: "k3", RateLimit: 1, Plan: "basic/free"},
+		nil,
+	} {
+		for i := 0; i < 3; i++ {
+			rec, err := call(key)
+			require.NoError(t, err)
+			assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+
+	// The counts are persisted when the limiter stops
+	limiter.Stop()
+	doc, ok := store.docs["apikey:k1"]
+	require.True(t, ok)
+	assert.Equal(t, 3, doc.Count)
+	assert.True(t, doc.ExpiresAt.After(doc.Window))
+	assert.Len(t, store.docs, 1)
+}
+
+func TestAPIKeyLimiterRestart(t *testing.T) {
+	// Both gateways must count in the same window
+	if _, end := ratelimit.Window(ratelimit.PeriodMinute, time.Now()); time.Until(end) < 2*time.Second {
+		time.Sleep(time.Until(end))
+	}
+	start, _ := ratelimit.Window(ratelimit.PeriodMinute, time.Now())
+	store := &rateLimitStore{docs: map[string]mongodb.RateLimitDocument{
+		// Counts of ended windows are not restored
+		"apikey:k2": {Key: "apikey:k2", Count: 5, Window: start.Add(-time.Minute), ExpiresAt: start},
+	}}
+	limited := &mongodb.APIKeyDocument{ID: "k1", Name: "limited", RateLimit: 3}
+	other := &mongodb.APIKeyDocument{ID: "k2", Name: "other", RateLimit: 3}
+
+	limiter := auth.NewAPIKeyLimiter(ratelimit.NewMemoryCounter(), store, logrus.New())
+	limiter.Start()
+	call := limiterCall(limiter)
+	for i := 0; i < 2; i++ {
+		_, err := call(limited)
+		require.NoError(t, err)
+	}
+	limiter.Stop()
+	assert.Equal(t, 2, store.docs["apikey:k1"].Count)
+
+	// The restarted gateway counts on from the persisted count
+	limiter = auth.NewAPIKeyLimiter(ratelimit.NewMemoryCounter(), store, logrus.New())
+	limiter.Start()
+	defer limiter.Stop()
+	call = limiterCall(limiter)
+
+	rec, err := call(limited)
+	require.NoError(t, err)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	_, err = call(limited)
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusTooManyRequests, httpErr.Code)
+
+	rec, err = call(other)
+	require.NoError(t, err)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Remaining"))
+}
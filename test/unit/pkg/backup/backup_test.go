@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/backup"
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2025, 3, 14, 10, 7, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2025, 3, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2025, 3, 15, 2, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2025, 3, 17, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 6h", base.Add(6 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := backup.ParseSchedule(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, schedule.Next(base))
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "@every 10s", "@yearly"} {
+		_, err := backup.ParseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseScheduleNeverMatches(t *testing.T) {
+	schedule, err := backup.ParseSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.Local)
+	for _, age := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 48 * time.Hour} {
+		name := "config.yaml" + backup.Marker + now.Add(-age).Format(backup.TimeFormat)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600))
+	}
+	other := "mongodb-config.yaml" + backup.Marker + now.Add(-48*time.Hour).Format(backup.TimeFormat)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, other), []byte("x"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml.before-restore"), []byte("x"), 0600))
+
+	pruned, err := backup.Prune(dir, 2, 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.Len(t, pruned, 3)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		"config.yaml" + backup.Marker + now.Add(-time.Hour).Format(backup.TimeFormat),
+		"config.yaml" + backup.Marker + now.Add(-2*time.Hour).Format(backup.TimeFormat),
+		"config.yaml.before-restore",
+	}, names)
+}
+
+func TestSchedulerRunUploadsToS3(t *testing.T) {
+	var uploads []string
+	var authorization string
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "server:\n  port: 8080\n", string(body))
+		uploads = append(uploads, r.URL.Path)
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer s3.Close()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("server:\n  port: 8080\n"), 0644))
+
+	scheduler, err := backup.NewScheduler(config.BackupConfig{
+		Schedule: "@daily",
+		Sources:  []string{backup.SourceFile},
+		MaxCount: 5,
+		S3: &config.BackupS3Config{
+			Endpoint:        s3.URL,
+			Region:          "eu-west-1",
+			Bucket:          "backups",
+			Prefix:          "odin/",
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "secret",
+			PathStyle:       true,
+		},
+	}, configPath, nil, logrus.New())
+	require.NoError(t, err)
+
+	result, err := scheduler.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Snapshots, 1)
+	assert.FileExists(t, result.Snapshots[0])
+	assert.True(t, strings.HasPrefix(filepath.Base(result.Snapshots[0]), "config.yaml"+backup.Marker))
+
+	require.Len(t, uploads, 1)
+	assert.True(t, strings.HasPrefix(uploads[0], "/backups/odin/config.yaml"+backup.Marker))
+	assert.Contains(t, authorization, "AWS4-HMAC-SHA256 Credential=AKID/")
+	assert.Contains(t, authorization, "/eu-west-1/s3/aws4_request")
+	assert.Equal(t, result, scheduler.Status().LastRun)
+}
+
+func TestNewSchedulerRequiresMongoDB(t *testing.T) {
+	_, err := backup.NewScheduler(config.BackupConfig{
+		Schedule: "@daily",
+		Sources:  []string{backup.SourceMongoDB},
+	}, "config.yaml", nil, logrus.New())
+	assert.Error(t, err)
+}
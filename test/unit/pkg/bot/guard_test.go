@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/bot"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chromeUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func newGuard(t *testing.T, modify func(*config.BotConfig)) *bot.Guard {
+	t.Helper()
+	cfg := config.BotConfig{
+		Enabled:       true,
+		Thresholds:    config.BotThresholds{Tag: 30, Challenge: 50, Throttle: 70, Block: 90},
+		Challenge:     config.BotChallengeConfig{Cookie: "odin_bot_check", Header: "X-Bot-Token", TTL: time.Hour},
+		ThrottleRPM:   2,
+		CadenceWindow: 10 * time.Second,
+		CadenceLimit:  20,
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	guard, err := bot.New(cfg, logrus.New())
+	require.NoError(t, err)
+	return guard
+}
+
+func browserRequest(remote string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.RemoteAddr = remote
+	req.Header.Set("User-Agent", chromeUA)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Language", "en-US")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	return req
+}
+
+func TestEvaluateScoresUserAgents(t *testing.T) {
+	guard := newGuard(t, nil)
+
+	result := guard.Evaluate(browserRequest("192.0.2.1:1234"))
+	assert.Equal(t, 0, result.Score)
+	assert.Equal(t, bot.ActionNone, result.Action)
+
+	req := browserRequest("192.0.2.2:1234")
+	req.Header.Set("User-Agent", "python-requests/2.31")
+	result = guard.Evaluate(req)
+	assert.Equal(t, 40, result.Score)
+	assert.Equal(t, bot.ActionTag, result.Action)
+	assert.Contains(t, result.Reasons, "automation user agent")
+
+	// A browser user agent without the headers browsers always send
+	req = httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.RemoteAddr = "192.0.2.3:1234"
+	req.Header.Set("User-Agent", chromeUA)
+	result = guard.Evaluate(req)
+	assert.Equal(t, 50, result.Score)
+	assert.Equal(t, bot.ActionChallenge, result.Action)
+}
+
+func TestEvaluateScoresCadence(t *testing.T) {
+	guard := newGuard(t, nil)
+
+	var result bot.Result
+	for i := 0; i < 25; i++ {
+		req := browserRequest("192.0.2.10:1234")
+		req.Header.Set("User-Agent", "")
+		result = guard.Evaluate(req)
+	}
+	assert.Contains(t, result.Reasons, "high request rate")
+	assert.GreaterOrEqual(t, result.Score, 70)
+}
+
+func TestEvaluateSkipsAllowedAgentsAndPaths(t *testing.T) {
+	guard := newGuard(t, func(cfg *config.BotConfig) {
+		cfg.AllowUserAgents = []string{"UptimeRobot"}
+		cfg.ExcludePaths = []string{"/health"}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0+(compatible; UptimeRobot/2.0)")
+	assert.Equal(t, 0, guard.Evaluate(req).Score)
+
+	req = httptest.NewRequest(http.MethodGet, "/health/live", nil)
+	assert.Equal(t, 0, guard.Evaluate(req).Score)
+}
+
+func TestChallengeToken(t *testing.T) {
+	guard := newGuard(t, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.RemoteAddr = "192.0.2.20:1234"
+	req.Header.Set("User-Agent", chromeUA)
+	req.Header.Set("X-Bot-Token", guard.Token("192.0.2.20", time.Now().Add(time.Minute)))
+
+	result := guard.Evaluate(req)
+	assert.True(t, result.ChallengePassed)
+	assert.Equal(t, bot.ActionTag, result.Action)
+
+	// Tokens are bound to the client address
+	req.RemoteAddr = "192.0.2.21:1234"
+	assert.Equal(t, bot.ActionChallenge, guard.Evaluate(req).Action)
+}
+
+type recorder struct {
+	scores  []int
+	actions []string
+}
+
+func (r *recorder) RecordBotScore(serviceName, endpoint, method string, score int, action string) {
+	r.scores = append(r.scores, score)
+	r.actions = append(r.actions, action)
+}
+
+func TestMiddleware(t *testing.T) {
+	guard := newGuard(t, nil)
+	rec := &recorder{}
+	guard.SetRecorder(rec)
+
+	e := echo.New()
+	var upstreamScore string
+	handler := guard.Middleware("products")(func(c echo.Context) error {
+		upstreamScore = c.Request().Header.Get(bot.ScoreHeader)
+		return c.NoContent(http.StatusOK)
+	})
+
+	// Tagged requests reach the upstream with their score
+	req := browserRequest("192.0.2.30:1234")
+	req.Header.Set("User-Agent", "curl/8.0")
+	resp := httptest.NewRecorder()
+	require.NoError(t, handler(e.NewContext(req, resp)))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "40", upstreamScore)
+
+	// Challenged requests get a token cookie and pass when they return it
+	req = httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.RemoteAddr = "192.0.2.31:1234"
+	req.Header.Set("User-Agent", chromeUA)
+	resp = httptest.NewRecorder()
+	require.NoError(t, handler(e.NewContext(req, resp)))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.RemoteAddr = "192.0.2.31:1234"
+	req.Header.Set("User-Agent", chromeUA)
+	req.AddCookie(cookies[0])
+	resp = httptest.NewRecorder()
+	require.NoError(t, handler(e.NewContext(req, resp)))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	assert.Equal(t, []string{"tag", "challenge", "tag"}, rec.actions)
+}
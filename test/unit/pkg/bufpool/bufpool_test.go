@@ -0,0 +1,84 @@
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"odin/pkg/bufpool"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAll(t *testing.T) {
+	buf, err := bufpool.ReadAll(strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", buf.String())
+	bufpool.Put(buf)
+
+	// Pooled buffers come back empty
+	buf = bufpool.Get()
+	assert.Equal(t, 0, buf.Len())
+	bufpool.Put(buf)
+}
+
+func TestPutIgnoresNilAndOversizedBuffers(t *testing.T) {
+	bufpool.Put(nil)
+
+	large := bytes.NewBuffer(make([]byte, 0, 4<<20))
+	bufpool.Put(large)
+	for i := 0; i < 10; i++ {
+		assert.NotSame(t, large, bufpool.Get())
+	}
+}
+
+func TestCopy(t *testing.T) {
+	payload := strings.Repeat("odin", 64*1024)
+
+	var dst bytes.Buffer
+	// Hide WriterTo and ReaderFrom so the pooled buffer is used
+	n, err := bufpool.Copy(struct{ io.Writer }{&dst}, struct{ io.Reader }{strings.NewReader(payload)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), n)
+	assert.Equal(t, payload, dst.String())
+}
+
+var body = bytes.Repeat([]byte("x"), 64*1024)
+
+func BenchmarkReadAll(b *testing.B) {
+	b.Run("io", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := io.ReadAll(bytes.NewReader(body))
+			_ = data
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, _ := bufpool.ReadAll(bytes.NewReader(body))
+			bufpool.Put(buf)
+		}
+	})
+}
+
+func BenchmarkCopy(b *testing.B) {
+	// Wrapped so neither side short-circuits io.Copy's buffer
+	src := func() io.Reader { return struct{ io.Reader }{bytes.NewReader(body)} }
+	dst := struct{ io.Writer }{io.Discard}
+
+	b.Run("io", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			io.Copy(dst, src())
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bufpool.Copy(dst, src())
+		}
+	})
+}
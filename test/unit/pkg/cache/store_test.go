@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"odin/pkg/cache"
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_PurgeByPrefix(t *testing.T) {
+	local, err := cache.NewStore(config.CacheConfig{Strategy: "local", TTL: time.Minute})
+	require.NoError(t, err)
+
+	stores := map[string]cache.Store{
+		"local":  local,
+		"memory": cache.NewMemoryStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			store.Set(cache.ResponseKey("/users/1", "a"), "alice", 0)
+			store.Set(cache.ResponseKey("/users/2", "b"), "bob", 0)
+			store.Set(cache.ResponseKey("/orders/1", "c"), "order", 0)
+
+			purged, err := store.Purge("/users")
+			require.NoError(t, err)
+			assert.Equal(t, 2, purged)
+
+			_, found := store.Get(cache.ResponseKey("/users/1", "a"))
+			assert.False(t, found)
+			_, found = store.Get(cache.ResponseKey("/orders/1", "c"))
+			assert.True(t, found)
+
+			purged, err = store.Purge("")
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+
+			_, found = store.Get(cache.ResponseKey("/orders/1", "c"))
+			assert.False(t, found)
+		})
+	}
+}
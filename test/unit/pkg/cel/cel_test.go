@@ -0,0 +1,185 @@
+package cel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/cel"
+	"odin/pkg/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testVars() map[string]any {
+	return map[string]any{
+		"request": map[string]any{
+			"method":  "POST",
+			"path":    "/api/orders/42",
+			"ip":      "10.1.2.3",
+			"headers": map[string]any{"x-tenant": "acme", "user-agent": "curl/8.0"},
+			"query":   map[string]any{"debug": "1"},
+		},
+		"claims": map[string]any{"sub": "user-1", "roles": []any{"admin", "ops"}, "level": float64(3)},
+		"now":    time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC), // A Friday
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`request.method == "POST"`, true},
+		{`request.method in ["GET", "HEAD"]`, false},
+		{`request.path.startsWith("/api/orders") && request.headers["x-tenant"] == "acme"`, true},
+		{`request.path.matches("^/api/orders/[0-9]+$")`, true},
+		{`request.headers["user-agent"].lowerAscii().contains("curl")`, true},
+		{`"admin" in claims.roles`, true},
+		{`claims.level >= 3 && claims.level < 4`, true},
+		{`claims.level + 1 == 4`, true},
+		{`size(claims.roles) == 2 && claims.roles.size() == 2`, true},
+		{`has(claims.email)`, false},
+		{`has(claims.sub) && claims.sub.endsWith("-1")`, true},
+		{`"debug" in request.query && int(request.query.debug) == 1`, true},
+		{`inCidr(request.ip, "10.0.0.0/8")`, true},
+		{`inCidr(request.ip, "192.168.0.0/16")`, false},
+		{`now.getHours() >= 22 || now.getHours() < 6`, true},
+		{`now.getHours("Asia/Tokyo") == 7`, true},
+		{`now.getDayOfWeek() == 5`, true},
+		{`request.method == "GET" ? false : !(request.ip == "")`, true},
+		{`{"a": 1}.a == 1 && [1, 2][1] == 2`, true},
+		{`"a" + "b" == 'ab' && 7 % 4 == 3 && -2 * 2 == -4`, true},
+		// Either side of || and && decides on its own, as in CEL
+		{`claims.email == "x" || request.method == "POST"`, true},
+		{`request.method == "GET" && claims.email == "x"`, false},
+	}
+	for _, tt := range tests {
+		program, err := cel.Compile(tt.expr)
+		require.NoError(t, err, tt.expr)
+		got, err := program.Test(testVars())
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, expr := range []string{
+		`claims.email == "x"`,
+		`claims.sub > 1`,
+		`request.headers["x-missing"] == "1"`,
+		`1 / 0 == 1`,
+		`request.method`,
+	} {
+		program, err := cel.Compile(expr)
+		require.NoError(t, err, expr)
+		_, err = program.Test(testVars())
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`request.method ==`,
+		`user.id == "1"`,
+		`lookup(request.ip)`,
+		`request.path.reverse()`,
+		`request.path.matches("[")`,
+		`inCidr(request.ip, "10.0.0.0/99")`,
+		`now.getHours("Mars/Olympus")`,
+		`has(request)`,
+		`"unterminated`,
+		`request.method == "GET" extra`,
+		`42`,
+	} {
+		_, err := cel.Compile(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func newContext(method, path string, header map[string]string, claims map[string]any) echo.Context {
+	req := httptest.NewRequest(method, path, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if claims != nil {
+		c.Set("user", claims)
+	}
+	return c
+}
+
+func TestRoute(t *testing.T) {
+	route, err := cel.CompileRoute(config.ServiceConfig{
+		Name:   "orders",
+		Match:  `request.headers["x-tenant"] == "acme"`,
+		Canary: &config.CanaryConfig{Targets: []string{"http://canary"}, Match: `"beta" in claims.groups`},
+	})
+	require.NoError(t, err)
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	gated := route.Match.Gate()(ok)
+	assert.NoError(t, gated(newContext(http.MethodGet, "/orders", map[string]string{"X-Tenant": "acme"}, nil)))
+	var httpErr *echo.HTTPError
+	if assert.ErrorAs(t, gated(newContext(http.MethodGet, "/orders", nil, nil)), &httpErr) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+
+	assert.True(t, route.Canary.Matches(newContext(http.MethodGet, "/orders", nil, map[string]any{"groups": []any{"beta"}})))
+	assert.False(t, route.Canary.Matches(newContext(http.MethodGet, "/orders", nil, nil)), "missing claim")
+
+	route, err = cel.CompileRoute(config.ServiceConfig{Name: "plain"})
+	assert.NoError(t, err)
+	assert.Nil(t, route)
+
+	_, err = cel.CompileRoute(config.ServiceConfig{Name: "bad", Match: `request.nope(`})
+	assert.Error(t, err)
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := cel.NewPolicy([]config.PolicyConfig{
+		{Name: "no-writes-at-night", Effect: "deny", When: `request.method != "GET" && claims.shift == "night"`, Message: "Read only"},
+		{Name: "admins", Effect: "allow", When: `"admin" in claims.roles`},
+		{Name: "reads", Effect: "allow", When: `request.method == "GET"`},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		claims  map[string]any
+		allowed bool
+		message string
+	}{
+		{name: "admin write", method: http.MethodPost, claims: map[string]any{"roles": []any{"admin"}, "shift": "day"}, allowed: true},
+		{name: "admin write at night", method: http.MethodPost, claims: map[string]any{"roles": []any{"admin"}, "shift": "night"}, message: "Read only"},
+		{name: "deny rule error denies", method: http.MethodPost, claims: map[string]any{"roles": []any{"admin"}}, message: "Read only"},
+		{name: "anonymous read", method: http.MethodGet, allowed: true},
+		{name: "user write", method: http.MethodPost, claims: map[string]any{"shift": "day"}, message: "Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, message := policy.Authorize(newContext(tt.method, "/orders", nil, tt.claims))
+			assert.Equal(t, tt.allowed, allowed)
+			if !tt.allowed {
+				assert.Equal(t, tt.message, message)
+			}
+		})
+	}
+
+	denyOnly, err := cel.NewPolicy([]config.PolicyConfig{{Effect: "deny", When: `inCidr(request.ip, "203.0.113.0/24")`}})
+	require.NoError(t, err)
+	allowed, _ := denyOnly.Authorize(newContext(http.MethodGet, "/orders", nil, nil))
+	assert.True(t, allowed, "requests no deny rule matches are allowed")
+
+	handler := denyOnly.Middleware()(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	c := newContext(http.MethodGet, "/orders", map[string]string{"X-Real-IP": "203.0.113.9"}, nil)
+	var httpErr *echo.HTTPError
+	if assert.ErrorAs(t, handler(c), &httpErr) {
+		assert.Equal(t, http.StatusForbidden, httpErr.Code)
+	}
+}
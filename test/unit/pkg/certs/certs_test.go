@@ -0,0 +1,115 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"odin/pkg/certs"
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert creates a self-signed certificate for names and returns its config
+func writeCert(t *testing.T, names ...string) config.TLSCertificateConfig {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return config.TLSCertificateConfig{CertFile: certFile, KeyFile: keyFile}
+}
+
+func servedName(t *testing.T, store *certs.Store, serverName string) string {
+	t.Helper()
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	require.NoError(t, err)
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestStoreSelectsCertificateBySNI(t *testing.T) {
+	store, err := certs.NewStore([]config.TLSCertificateConfig{
+		writeCert(t, "default.example.com"),
+		writeCert(t, "*.api.example.com"),
+		writeCert(t, "shop.example.org", "www.shop.example.org"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "shop.example.org", servedName(t, store, "WWW.shop.example.org"))
+	assert.Equal(t, "*.api.example.com", servedName(t, store, "users.api.example.com"))
+	assert.Equal(t, "default.example.com", servedName(t, store, "a.b.api.example.com"), "wildcards cover one label")
+	assert.Equal(t, "default.example.com", servedName(t, store, ""))
+}
+
+func TestStoreUsesConfiguredDomains(t *testing.T) {
+	cert := writeCert(t, "internal.local")
+	cert.Domains = []string{"gateway.example.com"}
+
+	store, err := certs.NewStore([]config.TLSCertificateConfig{cert})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gateway.example.com"}, store.Names())
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	store, err := certs.NewStore([]config.TLSCertificateConfig{writeCert(t, "example.com")})
+	require.NoError(t, err)
+	tlsConfig, err := certs.NewTLSConfig(config.ServerTLSConfig{
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}, store, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+
+	_, err = certs.ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err, "insecure suites are rejected")
+	_, err = certs.ParseVersion("1.4")
+	assert.Error(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	handler := certs.RedirectHandler(8443)
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.example.com:8080/users?page=2", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+	assert.Equal(t, "https://api.example.com:8443/users?page=2", rec.Header().Get("Location"))
+
+	req = httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	rec = httptest.NewRecorder()
+	certs.RedirectHandler(443).ServeHTTP(rec, req)
+	assert.Equal(t, "https://api.example.com/", rec.Header().Get("Location"))
+}
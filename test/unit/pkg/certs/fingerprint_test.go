@@ -0,0 +1,58 @@
+package certs
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/certs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJA3(t *testing.T) {
+	hello := &tls.ClientHelloInfo{
+		SupportedVersions: []uint16{0x0a0a, tls.VersionTLS13, tls.VersionTLS12},
+		CipherSuites:      []uint16{0x1a1a, tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384},
+		Extensions:        []uint16{0x2a2a, 0, 23, 65281},
+		SupportedCurves:   []tls.CurveID{tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+	}
+
+	sum := md5.Sum([]byte("771,4865-4866,0-23-65281,29-23,0"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), certs.JA3(hello))
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	assert.Equal(t, "abcdef01", certs.NormalizeFingerprint("SHA256:AB:CD:EF:01"))
+	assert.Equal(t, "abcdef01", certs.NormalizeFingerprint("sha256 Fingerprint=AB:CD:EF:01"))
+	assert.Equal(t, "abcdef01", certs.NormalizeFingerprint(" abcdef01 "))
+}
+
+func TestFingerprintRecorder(t *testing.T) {
+	recorder := certs.NewFingerprintRecorder()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, recorder.JA3(r))
+	}))
+	server.TLS = &tls.Config{}
+	recorder.Attach(server.TLS)
+	server.Config.ConnState = recorder.ConnState
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Len(t, string(body), 32)
+
+	// Plaintext requests have no fingerprint
+	assert.Empty(t, recorder.JA3(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
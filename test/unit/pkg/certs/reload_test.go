@@ -0,0 +1,94 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"testing"
+	"time"
+
+	"odin/pkg/certs"
+	"odin/pkg/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replaceCert overwrites the files of dst with those of src, as a renewal
+// would, and moves their modification time forward
+func replaceCert(t *testing.T, dst, src config.TLSCertificateConfig) {
+	t.Helper()
+	later := time.Now().Add(time.Minute)
+	for _, pair := range [][2]string{{dst.CertFile, src.CertFile}, {dst.KeyFile, src.KeyFile}} {
+		data, err := os.ReadFile(pair[1])
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(pair[0], data, 0600))
+		require.NoError(t, os.Chtimes(pair[0], later, later))
+	}
+}
+
+func newReloader(t *testing.T, cert config.TLSCertificateConfig) *certs.Reloader {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	reloader, err := certs.NewReloader([]config.TLSCertificateConfig{cert}, logger)
+	require.NoError(t, err)
+	return reloader
+}
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	cert := writeCert(t, "old.example.com")
+	reloader := newReloader(t, cert)
+	assert.Equal(t, "old.example.com", servedName(t, reloader.Store(), ""))
+
+	reloaded, err := reloader.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files are not reloaded")
+
+	replaceCert(t, cert, writeCert(t, "new.example.com"))
+	reloaded, err = reloader.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "new.example.com", servedName(t, reloader.Store(), ""))
+}
+
+func TestReloaderKeepsCertificatesOnError(t *testing.T) {
+	cert := writeCert(t, "current.example.com")
+	reloader := newReloader(t, cert)
+
+	// A certificate replaced before its key does not match it
+	renewed := writeCert(t, "renewed.example.com")
+	require.NoError(t, os.WriteFile(cert.CertFile, mustRead(t, renewed.CertFile), 0600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(cert.CertFile, later, later))
+
+	_, err := reloader.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "current.example.com", servedName(t, reloader.Store(), ""))
+
+	// Once the key follows, the pair is loaded
+	replaceCert(t, cert, renewed)
+	reloaded, err := reloader.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "renewed.example.com", servedName(t, reloader.Store(), ""))
+}
+
+func TestReloaderWatchesFiles(t *testing.T) {
+	cert := writeCert(t, "old.example.com")
+	reloader := newReloader(t, cert)
+	reloader.Start(10 * time.Millisecond)
+	defer reloader.Stop()
+
+	replaceCert(t, cert, writeCert(t, "new.example.com"))
+	require.Eventually(t, func() bool {
+		cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+		return err == nil && cert.Leaf.Subject.CommonName == "new.example.com"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -171,3 +173,1232 @@ services:
 	assert.Equal(t, "test-secret", cfg.Auth.JWTSecret)
 	assert.True(t, cfg.Services[0].Authentication)
 }
+
+func TestTransportValidation(t *testing.T) {
+	newConfig := func(transport *config.TransportConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{
+					Name:      "test",
+					BasePath:  "/api/test",
+					Targets:   []string{"http://localhost:8081"},
+					Transport: transport,
+				},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(nil)))
+	assert.NoError(t, config.Validate(newConfig(&config.TransportConfig{
+		MaxIdleConnsPerHost: 200,
+		IdleConnTimeout:     time.Minute,
+		DialTimeout:         5 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+	})))
+
+	err := config.Validate(newConfig(&config.TransportConfig{MaxIdleConnsPerHost: -1}))
+	assert.Error(t, err)
+	err = config.Validate(newConfig(&config.TransportConfig{DialTimeout: -time.Second}))
+	assert.Error(t, err)
+}
+
+func TestServiceLimitsValidation(t *testing.T) {
+	newConfig := func(limits *config.ServiceLimitsConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{
+					Name:     "test",
+					BasePath: "/api/test",
+					Targets:  []string{"http://localhost:8081"},
+					Limits:   limits,
+				},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(nil)))
+	assert.NoError(t, config.Validate(newConfig(&config.ServiceLimitsConfig{
+		MaxRequestBodySize:  1 << 20,
+		MaxHeaderBytes:      8192,
+		MaxResponseBodySize: 10 << 20,
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.ServiceLimitsConfig{MaxRequestBodySize: -1})))
+	assert.Error(t, config.Validate(newConfig(&config.ServiceLimitsConfig{MaxResponseBodySize: -1})))
+}
+
+func TestOverloadValidation(t *testing.T) {
+	newConfig := func(overload config.OverloadConfig) *config.Config {
+		return &config.Config{
+			Server:   config.ServerConfig{Port: 8080},
+			Overload: overload,
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.OverloadConfig{})))
+	assert.NoError(t, config.Validate(newConfig(config.OverloadConfig{
+		Enabled:       true,
+		MaxConcurrent: 100,
+		Classes:       []config.OverloadClass{{Name: "checkout", Priority: 10}},
+	})))
+
+	assert.Error(t, config.Validate(newConfig(config.OverloadConfig{Enabled: true})))
+	assert.Error(t, config.Validate(newConfig(config.OverloadConfig{Enabled: true, MaxConcurrent: 1, TargetDelay: -time.Millisecond})))
+	assert.Error(t, config.Validate(newConfig(config.OverloadConfig{
+		Enabled:       true,
+		MaxConcurrent: 1,
+		Classes:       []config.OverloadClass{{Priority: 10}},
+	})))
+}
+
+func TestWebSocketValidation(t *testing.T) {
+	newConfig := func(ws *config.ServiceWebSocketConfig) *config.Config {
+		return &config.Config{
+			Server:    config.ServerConfig{Port: 8080},
+			WebSocket: config.WebSocketConfig{Enabled: true, MaxConnections: 100},
+			Services: []config.ServiceConfig{
+				{
+					Name:      "chat",
+					BasePath:  "/api/chat",
+					Targets:   []string{"http://localhost:8081"},
+					WebSocket: ws,
+				},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(nil)))
+	assert.NoError(t, config.Validate(newConfig(&config.ServiceWebSocketConfig{MaxConnectionsPerIP: 5})))
+	assert.Error(t, config.Validate(newConfig(&config.ServiceWebSocketConfig{IdleTimeout: -time.Second})))
+
+	cfg := newConfig(nil)
+	cfg.WebSocket.MaxConnectionsPerIP = -1
+	assert.Error(t, config.Validate(cfg))
+
+	// WebSocket services need targets and get the global defaults
+	cfg = newConfig(nil)
+	cfg.WebSocket = config.WebSocketConfig{}
+	cfg.Services[0].Protocol = "websocket"
+	cfg.SetDefaults()
+	assert.NoError(t, config.Validate(cfg))
+	assert.Equal(t, 5*time.Minute, cfg.WebSocket.IdleTimeout)
+	cfg.Services[0].Targets = nil
+	assert.Error(t, config.Validate(cfg))
+}
+
+func TestRateLimitValidation(t *testing.T) {
+	newConfig := func(r config.RateLimitConfig) *config.Config {
+		return &config.Config{Server: config.ServerConfig{Port: 8080}, RateLimit: r}
+	}
+
+	for _, strategy := range []string{"", "local", "redis", "sliding-window", "token-bucket", "fixed-window"} {
+		assert.NoError(t, config.Validate(newConfig(config.RateLimitConfig{Enabled: true, Strategy: strategy})), strategy)
+	}
+	assert.Error(t, config.Validate(newConfig(config.RateLimitConfig{Strategy: "leaky-bucket"})))
+	assert.Error(t, config.Validate(newConfig(config.RateLimitConfig{Burst: -1})))
+
+	// Enabled limits without values get the defaults
+	cfg := newConfig(config.RateLimitConfig{Enabled: true})
+	cfg.SetDefaults()
+	assert.Equal(t, 100, cfg.RateLimit.Limit)
+	assert.Equal(t, time.Minute, cfg.RateLimit.Duration)
+}
+
+func TestOIDCValidation(t *testing.T) {
+	newConfig := func(providers []config.OIDCProviderConfig, auth *config.ServiceAuthConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Auth:   config.AuthConfig{OIDC: providers},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Targets: []string{"http://localhost:9000"}, Auth: auth},
+			},
+		}
+	}
+	idp := []config.OIDCProviderConfig{{Name: "idp", Issuer: "https://idp.example.com"}}
+
+	assert.NoError(t, config.Validate(newConfig(idp, &config.ServiceAuthConfig{Provider: "idp", Scopes: []string{"orders:read"}})))
+	assert.NoError(t, config.Validate(newConfig(nil, &config.ServiceAuthConfig{Provider: "jwt"})))
+	assert.Error(t, config.Validate(newConfig(nil, &config.ServiceAuthConfig{Provider: "idp"})))
+	assert.Error(t, config.Validate(newConfig(nil, &config.ServiceAuthConfig{Scopes: []string{"orders:read"}})))
+	assert.Error(t, config.Validate(newConfig([]config.OIDCProviderConfig{{Name: "idp"}}, nil)))
+	assert.Error(t, config.Validate(newConfig([]config.OIDCProviderConfig{{Name: "jwt", Issuer: "https://idp.example.com"}}, nil)))
+	assert.Error(t, config.Validate(newConfig(append(idp, idp...), nil)))
+	assert.Error(t, config.Validate(newConfig([]config.OIDCProviderConfig{{Name: "idp", Issuer: "https://idp.example.com", JWKSURL: "keys.json"}}, nil)))
+
+	// Picking a provider turns authentication on
+	cfg := newConfig(idp, &config.ServiceAuthConfig{Provider: "idp"})
+	cfg.SetDefaults()
+	assert.True(t, cfg.Services[0].Authentication)
+}
+
+func TestHMACValidation(t *testing.T) {
+	newConfig := func(consumers bool, hmac config.HMACConfig) *config.Config {
+		return &config.Config{
+			Server:    config.ServerConfig{Port: 8080},
+			MongoDB:   config.MongoDBConfig{Enabled: true, URI: "mongodb://localhost:27017", Database: "odin"},
+			Consumers: config.ConsumersConfig{Enabled: consumers, RefreshInterval: time.Minute},
+			Auth:      config.AuthConfig{HMAC: hmac},
+			Services: []config.ServiceConfig{
+				{Name: "hooks", BasePath: "/hooks", Targets: []string{"http://localhost:9000"}, Auth: &config.ServiceAuthConfig{Provider: "hmac"}},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(true, config.HMACConfig{Algorithm: "sha384"})))
+	assert.Error(t, config.Validate(newConfig(false, config.HMACConfig{})))
+	assert.Error(t, config.Validate(newConfig(true, config.HMACConfig{Algorithm: "md5"})))
+	assert.Error(t, config.Validate(newConfig(true, config.HMACConfig{ClockSkew: -time.Second})))
+}
+
+func TestClientCertValidation(t *testing.T) {
+	newConfig := func(clientAuth string, cc *config.ClientCertConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080, TLS: config.ServerTLSConfig{
+				Enabled:      true,
+				Port:         8443,
+				Certificates: []config.TLSCertificateConfig{{CertFile: "server.pem", KeyFile: "server-key.pem"}},
+				ClientAuth:   clientAuth,
+			}},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Targets: []string{"http://localhost:9000"}, Auth: &config.ServiceAuthConfig{ClientCert: cc}},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig("request", &config.ClientCertConfig{CAFile: "ca.pem"})))
+	assert.Error(t, config.Validate(newConfig("request", &config.ClientCertConfig{})))
+	assert.Error(t, config.Validate(newConfig("", &config.ClientCertConfig{CAFile: "ca.pem"})))
+}
+
+func TestMQTTValidation(t *testing.T) {
+	newConfig := func(mqtt *config.MQTTConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{
+					Name:     "devices",
+					BasePath: "/mqtt",
+					Protocol: "mqtt-ws",
+					Targets:  []string{"http://localhost:9001"},
+					MQTT:     mqtt,
+				},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(&config.MQTTConfig{
+		Auth: "apiKey",
+		ACL:  []config.MQTTACLRule{{Topic: "devices/{userId}/#", Access: "publish"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.MQTTConfig{Auth: "basic"})))
+	assert.Error(t, config.Validate(newConfig(&config.MQTTConfig{
+		ACL: []config.MQTTACLRule{{Topic: "devices/#", Access: "write"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.MQTTConfig{
+		ACL: []config.MQTTACLRule{{Access: "all"}},
+	})))
+}
+
+func TestSOAPValidation(t *testing.T) {
+	newConfig := func(soap *config.SOAPConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{
+					Name:     "billing",
+					BasePath: "/billing",
+					Protocol: "soap",
+					Targets:  []string{"http://localhost:8000/ws"},
+					SOAP:     soap,
+				},
+			},
+		}
+	}
+	getInvoice := config.SOAPOperation{Name: "GetInvoice", Method: "GET", Path: "/invoices/:id", Request: "<GetInvoice/>"}
+
+	assert.NoError(t, config.Validate(newConfig(&config.SOAPConfig{
+		Version:    "1.2",
+		Operations: []config.SOAPOperation{getInvoice, {Name: "CreateInvoice", Request: "<CreateInvoice/>"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(nil)))
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{})))
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{
+		Version:    "2.0",
+		Operations: []config.SOAPOperation{getInvoice},
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{
+		Operations: []config.SOAPOperation{{Name: "GetInvoice"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{
+		Operations: []config.SOAPOperation{{Name: "GetInvoice", Path: "invoices", Request: "<GetInvoice/>"}},
+	})))
+	// Routes are matched on method and path, which default to POST /<name>
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{
+		Operations: []config.SOAPOperation{getInvoice, {Name: "FindInvoice", Method: "get", Path: "/invoices/:id", Request: "<FindInvoice/>"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(&config.SOAPConfig{
+		Operations: []config.SOAPOperation{
+			{Name: "CreateInvoice", Request: "<CreateInvoice/>"},
+			{Name: "AddInvoice", Path: "/CreateInvoice", Request: "<AddInvoice/>"},
+		},
+	})))
+}
+
+func TestTCPValidation(t *testing.T) {
+	newConfig := func(listener config.TCPListenerConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			TCP:    config.TCPConfig{Listeners: []config.TCPListenerConfig{listener}},
+		}
+	}
+	valid := config.TCPListenerConfig{Name: "postgres", Port: 5432, Targets: []string{"db:5432"}}
+
+	assert.NoError(t, config.Validate(newConfig(valid)))
+
+	for name, change := range map[string]func(*config.TCPListenerConfig){
+		"missing name":  func(l *config.TCPListenerConfig) { l.Name = "" },
+		"gateway port":  func(l *config.TCPListenerConfig) { l.Port = 8080 },
+		"no targets":    func(l *config.TCPListenerConfig) { l.Targets = nil },
+		"target":        func(l *config.TCPListenerConfig) { l.Targets = []string{"http://db"} },
+		"load balancer": func(l *config.TCPListenerConfig) { l.LoadBalancing = "weighted" },
+		"idle timeout":  func(l *config.TCPListenerConfig) { l.IdleTimeout = -time.Second },
+	} {
+		listener := valid
+		change(&listener)
+		assert.Error(t, config.Validate(newConfig(listener)), name)
+	}
+
+	cfg := newConfig(valid)
+	cfg.TCP.Listeners = append(cfg.TCP.Listeners, config.TCPListenerConfig{Name: "postgres", Port: 5433, Targets: []string{"db:5432"}})
+	assert.Error(t, config.Validate(cfg))
+}
+
+func TestTLSPassthroughValidation(t *testing.T) {
+	newConfig := func(listener config.TCPListenerConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			TCP:    config.TCPConfig{Listeners: []config.TCPListenerConfig{listener}},
+		}
+	}
+	valid := config.TCPListenerConfig{
+		Name: "tls",
+		Port: 443,
+		Mode: "tls-passthrough",
+		Routes: []config.TLSRouteConfig{
+			{ServerNames: []string{"api.example.com"}, Targets: []string{"api:8443"}},
+			{ServerNames: []string{"*.tenants.example.com", "Tenants.example.com"}, Targets: []string{"tenants:8443"}, LoadBalancing: "random"},
+		},
+	}
+
+	assert.NoError(t, config.Validate(newConfig(valid)))
+
+	for name, change := range map[string]func(*config.TCPListenerConfig){
+		"mode":             func(l *config.TCPListenerConfig) { l.Mode = "tls" },
+		"no routes":        func(l *config.TCPListenerConfig) { l.Routes = nil },
+		"routes in tcp":    func(l *config.TCPListenerConfig) { l.Mode = "tcp"; l.Targets = []string{"api:8443"} },
+		"no server names":  func(l *config.TCPListenerConfig) { l.Routes = []config.TLSRouteConfig{{Targets: []string{"api:8443"}}} },
+		"server name":      func(l *config.TCPListenerConfig) { l.Routes[0].ServerNames = []string{"api.*.com"} },
+		"duplicate name":   func(l *config.TCPListenerConfig) { l.Routes[1].ServerNames = []string{"API.example.com"} },
+		"no route targets": func(l *config.TCPListenerConfig) { l.Routes[0].Targets = nil },
+		"route target":     func(l *config.TCPListenerConfig) { l.Routes[0].Targets = []string{"api"} },
+		"route balancing":  func(l *config.TCPListenerConfig) { l.Routes[0].LoadBalancing = "weighted" },
+		"default target":   func(l *config.TCPListenerConfig) { l.Targets = []string{"https://fallback"} },
+		"hello timeout":    func(l *config.TCPListenerConfig) { l.ClientHelloTimeout = -time.Second },
+	} {
+		listener := valid
+		listener.Routes = []config.TLSRouteConfig{valid.Routes[0], valid.Routes[1]}
+		change(&listener)
+		assert.Error(t, config.Validate(newConfig(listener)), name)
+	}
+}
+
+func productsConfig() *config.Config {
+	return &config.Config{
+		Server:  config.ServerConfig{Port: 8080},
+		MongoDB: config.MongoDBConfig{Enabled: true},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{"http://orders:8080"}},
+			{Name: "billing", BasePath: "/billing", Targets: []string{"http://billing:8080"}},
+		},
+		Products: []config.ProductConfig{
+			{
+				Name:     "commerce",
+				Services: []string{"orders", "billing"},
+				Plans: []config.PlanConfig{
+					{Name: "free", RateLimit: 60, Quota: 1000, QuotaPeriod: "day"},
+					{Name: "pro", RateLimit: 600, Quota: 100000, KeyTTL: 24 * time.Hour},
+				},
+			},
+		},
+	}
+}
+
+func TestPortalValidation(t *testing.T) {
+	newConfig := func(portal config.PortalConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Portal = portal
+		return cfg
+	}
+	valid := config.PortalConfig{
+		Enabled:      true,
+		Path:         "/portal",
+		DefaultPlans: []string{"commerce/free"},
+	}
+
+	assert.NoError(t, config.Validate(newConfig(valid)))
+
+	noMongo := newConfig(valid)
+	noMongo.MongoDB.Enabled = false
+	assert.Error(t, config.Validate(noMongo))
+
+	for name, change := range map[string]func(*config.PortalConfig){
+		"relative path":        func(p *config.PortalConfig) { p.Path = "portal" },
+		"trailing slash":       func(p *config.PortalConfig) { p.Path = "/portal/" },
+		"admin path":           func(p *config.PortalConfig) { p.Path = "/admin/portal" },
+		"unknown plan":         func(p *config.PortalConfig) { p.DefaultPlans = []string{"commerce/gold"} },
+		"plan without product": func(p *config.PortalConfig) { p.DefaultPlans = []string{"free"} },
+		"negative limit":       func(p *config.PortalConfig) { p.MaxKeysPerUser = -1 },
+	} {
+		portal := valid
+		change(&portal)
+		assert.Error(t, config.Validate(newConfig(portal)), name)
+	}
+}
+
+func TestProductValidation(t *testing.T) {
+	assert.NoError(t, config.Validate(productsConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"no name":           func(c *config.Config) { c.Products[0].Name = "" },
+		"slash in name":     func(c *config.Config) { c.Products[0].Name = "a/b" },
+		"duplicate product": func(c *config.Config) { c.Products = append(c.Products, c.Products[0]) },
+		"no services":       func(c *config.Config) { c.Products[0].Services = nil },
+		"unknown service":   func(c *config.Config) { c.Products[0].Services = []string{"inventory"} },
+		"no plans":          func(c *config.Config) { c.Products[0].Plans = nil },
+		"plan name":         func(c *config.Config) { c.Products[0].Plans[0].Name = "" },
+		"duplicate plan":    func(c *config.Config) { c.Products[0].Plans[1].Name = "free" },
+		"negative rate":     func(c *config.Config) { c.Products[0].Plans[0].RateLimit = -1 },
+		"negative quota":    func(c *config.Config) { c.Products[0].Plans[0].Quota = -1 },
+		"quota period":      func(c *config.Config) { c.Products[0].Plans[0].QuotaPeriod = "week" },
+	} {
+		cfg := productsConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestMeteringValidation(t *testing.T) {
+	newConfig := func(metering config.MeteringConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Metering = metering
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.MeteringConfig{Enabled: true, Period: time.Hour})))
+	assert.NoError(t, config.Validate(newConfig(config.MeteringConfig{Enabled: true, Period: 15 * time.Minute, Retention: 400 * 24 * time.Hour})))
+	assert.NoError(t, config.Validate(newConfig(config.MeteringConfig{Enabled: true, Period: 24 * time.Hour})))
+
+	noMongo := newConfig(config.MeteringConfig{Enabled: true, Period: time.Hour})
+	noMongo.MongoDB.Enabled = false
+	assert.Error(t, config.Validate(noMongo))
+
+	for name, metering := range map[string]config.MeteringConfig{
+		"too short":           {Enabled: true, Period: time.Second},
+		"does not divide day": {Enabled: true, Period: 7 * time.Hour},
+		"longer than day":     {Enabled: true, Period: 48 * time.Hour},
+		"negative retention":  {Enabled: true, Period: time.Hour, Retention: -time.Hour},
+	} {
+		assert.Error(t, config.Validate(newConfig(metering)), name)
+	}
+}
+
+func TestVersioningValidation(t *testing.T) {
+	newConfig := func(versioning *config.VersioningConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{
+					Name:       "orders",
+					BasePath:   "/api/orders",
+					Targets:    []string{"http://localhost:8081"},
+					Versioning: versioning,
+				},
+			},
+		}
+	}
+	versions := []config.APIVersionConfig{{Name: "v1", Deprecated: true}, {Name: "v2"}}
+
+	assert.NoError(t, config.Validate(newConfig(&config.VersioningConfig{Strategy: "path", Default: "v2", Versions: versions})))
+	assert.NoError(t, config.Validate(newConfig(&config.VersioningConfig{Strategy: "header", Default: "2", Versions: versions})))
+	assert.NoError(t, config.Validate(newConfig(&config.VersioningConfig{Strategy: "mediaType", Versions: versions})))
+
+	sunsetFirst := []config.APIVersionConfig{{
+		Name:         "v1",
+		DeprecatedAt: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}}
+	for name, versioning := range map[string]*config.VersioningConfig{
+		"unknown strategy":  {Strategy: "query", Versions: versions},
+		"no versions":       {Strategy: "path"},
+		"empty name":        {Strategy: "path", Versions: []config.APIVersionConfig{{}}},
+		"name with slash":   {Strategy: "path", Versions: []config.APIVersionConfig{{Name: "v1/beta"}}},
+		"duplicate version": {Strategy: "path", Versions: []config.APIVersionConfig{{Name: "v1"}, {Name: "1"}}},
+		"unknown default":   {Strategy: "path", Default: "v3", Versions: versions},
+		"sunset first":      {Strategy: "path", Versions: sunsetFirst},
+	} {
+		assert.Error(t, config.Validate(newConfig(versioning)), name)
+	}
+}
+
+func TestLoadVersioning(t *testing.T) {
+	configContent := `
+server:
+  port: 8080
+
+services:
+  - name: orders
+    basePath: /api/orders
+    targets:
+      - http://localhost:8081
+    versioning:
+      strategy: path
+      default: v2
+      versions:
+        - name: v1
+          deprecatedAt: 2025-01-01
+          sunset: 2026-12-31T00:00:00Z
+          link: https://example.com/migrate
+        - name: v2
+          targets:
+            - http://localhost:8082
+`
+
+	tmpFile, err := ioutil.TempFile("", "config-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := config.Load(tmpFile.Name(), logrus.New())
+	require.NoError(t, err)
+
+	versioning := cfg.Services[0].Versioning
+	require.NotNil(t, versioning)
+	assert.Equal(t, "X-API-Version", versioning.Header)
+	require.Len(t, versioning.Versions, 2)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), versioning.Versions[0].DeprecatedAt)
+	assert.Equal(t, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), versioning.Versions[0].Sunset)
+	assert.Equal(t, []string{"http://localhost:8082"}, versioning.Versions[1].Targets)
+}
+
+func TestConsumersValidation(t *testing.T) {
+	newConfig := func(consumers config.ConsumersConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Consumers = consumers
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.ConsumersConfig{Enabled: true, RefreshInterval: 30 * time.Second})))
+	assert.Error(t, config.Validate(newConfig(config.ConsumersConfig{Enabled: true, RefreshInterval: time.Millisecond})))
+
+	noMongo := newConfig(config.ConsumersConfig{Enabled: true, RefreshInterval: 30 * time.Second})
+	noMongo.MongoDB.Enabled = false
+	assert.Error(t, config.Validate(noMongo))
+}
+
+func TestAdminNamespacesValidation(t *testing.T) {
+	newConfig := func(namespaces ...config.AdminNamespaceConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Admin = config.AdminConfig{Enabled: true, Username: "admin", Password: "secret", Namespaces: namespaces}
+		return cfg
+	}
+
+	payments := config.AdminNamespaceConfig{Name: "payments", Username: "payments-admin", Password: "p4ss"}
+	search := config.AdminNamespaceConfig{Name: "search", Username: "search-admin", Password: "s3arch"}
+	assert.NoError(t, config.Validate(newConfig(payments, search)))
+
+	assert.Error(t, config.Validate(newConfig(payments, payments)), "duplicate namespace")
+	assert.Error(t, config.Validate(newConfig(config.AdminNamespaceConfig{Name: "team/a", Username: "a", Password: "a"})))
+	assert.Error(t, config.Validate(newConfig(config.AdminNamespaceConfig{Name: "search", Username: "search-admin"})))
+	assert.Error(t, config.Validate(newConfig(config.AdminNamespaceConfig{Name: "search", Username: "admin", Password: "x"})),
+		"username of the gateway administrator")
+	assert.Error(t, config.Validate(newConfig(payments, config.AdminNamespaceConfig{Name: "search", Username: "payments-admin", Password: "x"})))
+}
+
+func TestAdminTokensValidation(t *testing.T) {
+	newConfig := func(tokens ...config.AdminTokenConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Admin = config.AdminConfig{Enabled: true, Username: "admin", Password: "secret", Tokens: tokens}
+		return cfg
+	}
+
+	ci := config.AdminTokenConfig{Name: "ci", SHA256: strings.Repeat("ab", 32)}
+	assert.NoError(t, config.Validate(newConfig(ci)))
+	assert.Error(t, config.Validate(newConfig(ci, ci)), "duplicate token")
+	assert.Error(t, config.Validate(newConfig(config.AdminTokenConfig{SHA256: ci.SHA256})), "unnamed token")
+	assert.Error(t, config.Validate(newConfig(config.AdminTokenConfig{Name: "ci", SHA256: "odin_plaintext"})),
+		"tokens are configured by hash")
+}
+
+func TestAdminSessionsValidation(t *testing.T) {
+	newConfig := func(sessions config.AdminSessionsConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Admin = config.AdminConfig{Enabled: true, Username: "admin", Password: "secret", Sessions: sessions}
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.AdminSessionsConfig{})))
+	assert.NoError(t, config.Validate(newConfig(config.AdminSessionsConfig{AccessTokenTTL: 5 * time.Minute, RefreshTokenTTL: 24 * time.Hour})))
+	assert.Error(t, config.Validate(newConfig(config.AdminSessionsConfig{AccessTokenTTL: -time.Minute})))
+	assert.Error(t, config.Validate(newConfig(config.AdminSessionsConfig{AccessTokenTTL: time.Hour, RefreshTokenTTL: time.Minute})),
+		"refresh tokens outlive access tokens")
+}
+
+func TestMockValidation(t *testing.T) {
+	newConfig := func(mock *config.MockConfig, targets ...string) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].Mock = mock
+		cfg.Services[0].Targets = targets
+		return cfg
+	}
+
+	fromSpec := &config.MockConfig{FromSpec: true, Latency: 100 * time.Millisecond}
+	assert.NoError(t, config.Validate(newConfig(fromSpec)), "mocked services need no targets")
+	assert.NoError(t, config.Validate(newConfig(&config.MockConfig{
+		Routes: []config.MockRouteConfig{{Method: "GET", Path: "/orders/{id}", Body: `{"id": 1}`}},
+	})))
+	assert.Error(t, config.Validate(newConfig(nil)), "unmocked services need targets")
+	assert.Error(t, config.Validate(newConfig(&config.MockConfig{FromSpec: true, Passthrough: true})),
+		"passthrough needs targets")
+	assert.NoError(t, config.Validate(newConfig(&config.MockConfig{FromSpec: true, Passthrough: true}, "http://orders:8080")))
+
+	assert.Error(t, config.Validate(newConfig(&config.MockConfig{})), "nothing to answer with")
+	assert.Error(t, config.Validate(newConfig(&config.MockConfig{FromSpec: true, Jitter: -time.Second})))
+	assert.Error(t, config.Validate(newConfig(&config.MockConfig{Routes: []config.MockRouteConfig{{Path: "orders"}}})))
+	assert.Error(t, config.Validate(newConfig(&config.MockConfig{Routes: []config.MockRouteConfig{{Path: "/orders", Status: 42}}})))
+}
+
+func TestProbesValidation(t *testing.T) {
+	newConfig := func(probes config.ProbesConfig) *config.Config {
+		return &config.Config{
+			Server:     config.ServerConfig{Port: 8080},
+			Monitoring: config.MonitoringConfig{Probes: probes},
+			Services: []config.ServiceConfig{
+				{
+					Name:        "orders",
+					BasePath:    "/api/orders",
+					Targets:     []string{"http://localhost:8081", "http://localhost:8082"},
+					HealthCheck: &config.HealthCheckConfig{Enabled: true},
+				},
+				{
+					Name:     "billing",
+					BasePath: "/api/billing",
+					Targets:  []string{"http://localhost:8083"},
+				},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.ProbesConfig{})))
+	assert.NoError(t, config.Validate(newConfig(config.ProbesConfig{
+		ReadinessPath:      "/healthz/ready",
+		IgnoreDependencies: []string{"cache"},
+		CriticalServices:   []config.CriticalServiceConfig{{Name: "orders", MinHealthyTargets: 2}},
+	})))
+
+	assert.Error(t, config.Validate(newConfig(config.ProbesConfig{LivenessPath: "live"})))
+	assert.Error(t, config.Validate(newConfig(config.ProbesConfig{IgnoreDependencies: []string{"redis"}})))
+	assert.Error(t, config.Validate(newConfig(config.ProbesConfig{
+		CriticalServices: []config.CriticalServiceConfig{{Name: "unknown"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(config.ProbesConfig{
+		CriticalServices: []config.CriticalServiceConfig{{Name: "billing"}},
+	})))
+	assert.Error(t, config.Validate(newConfig(config.ProbesConfig{
+		CriticalServices: []config.CriticalServiceConfig{{Name: "orders", MinHealthyTargets: 3}},
+	})))
+}
+
+func TestXMLTransformValidation(t *testing.T) {
+	newConfig := func(x *config.XMLTransformConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].Transform.XML = x
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(&config.XMLTransformConfig{Request: "json-to-xml", Response: "xml-to-json"})))
+	assert.Error(t, config.Validate(newConfig(&config.XMLTransformConfig{})), "no conversion")
+	assert.Error(t, config.Validate(newConfig(&config.XMLTransformConfig{Response: "xml-to-yaml"})))
+	assert.Error(t, config.Validate(newConfig(&config.XMLTransformConfig{Response: "xml-to-json", AttributePrefix: "_", TextKey: "_"})))
+}
+
+func TestTemplateTransformValidation(t *testing.T) {
+	newConfig := func(templates ...config.TemplateTransformConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].Transform.Templates = templates
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.TemplateTransformConfig{Path: "/api/orders/{id}", Request: `{"id":{{ toJson .params.id }}}`})))
+	assert.Error(t, config.Validate(newConfig(config.TemplateTransformConfig{Path: "/api/orders"})), "no template")
+	assert.Error(t, config.Validate(newConfig(config.TemplateTransformConfig{Path: "api/orders", Response: "{}"})))
+}
+
+func TestHeaderRulesValidation(t *testing.T) {
+	newConfig := func(rules ...config.HeaderRuleConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].HeaderRules = &config.HeaderRulesConfig{Request: rules}
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(
+		config.HeaderRuleConfig{Action: "set", Name: "X-Gateway", Value: "odin"},
+		config.HeaderRuleConfig{Action: "copy-from-claim", Name: "X-User-Id", From: "sub", Path: "/api/orders/{id}"},
+	)))
+	assert.Error(t, config.Validate(newConfig(config.HeaderRuleConfig{Action: "append", Name: "X-Gateway"})))
+	assert.Error(t, config.Validate(newConfig(config.HeaderRuleConfig{Action: "remove"})))
+	assert.Error(t, config.Validate(newConfig(config.HeaderRuleConfig{Action: "rename", Name: "X-Trace"})))
+	assert.Error(t, config.Validate(newConfig(config.HeaderRuleConfig{Action: "set", Name: "X-A", Path: "orders"})))
+}
+
+func TestResponseFieldsValidation(t *testing.T) {
+	newConfig := func(rules ...config.ResponseFieldsConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].ResponseFields = rules
+		return cfg
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.ResponseFieldsConfig{Path: "/api/products/{id}", Fields: []string{"$.id", "$.name"}})))
+	assert.Error(t, config.Validate(newConfig(config.ResponseFieldsConfig{Path: "/api/products"})))
+	assert.Error(t, config.Validate(newConfig(config.ResponseFieldsConfig{Path: "products", Fields: []string{"id"}})))
+}
+
+func TestGRPCRoutesValidation(t *testing.T) {
+	newConfig := func(descriptorSets []string, routes ...config.GRPCRoute) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].Protocol = "grpc"
+		cfg.Services[0].GRPC = &config.GRPCConfig{DescriptorSets: descriptorSets, Routes: routes}
+		return cfg
+	}
+	descriptors := []string{"users.pb"}
+	getUser := config.GRPCRoute{Method: "GET", Path: "/users/:id", RPC: "users.v1.UserService/GetUser"}
+
+	assert.NoError(t, config.Validate(newConfig(descriptors, getUser)))
+	assert.Error(t, config.Validate(newConfig(nil, getUser)))
+	reflected := newConfig(nil, getUser)
+	reflected.Services[0].GRPC.EnableReflection = true
+	assert.NoError(t, config.Validate(reflected))
+	assert.Error(t, config.Validate(newConfig(descriptors, getUser, getUser)))
+	assert.Error(t, config.Validate(newConfig(descriptors, config.GRPCRoute{Path: "/users", RPC: "GetUser"})))
+	assert.Error(t, config.Validate(newConfig(descriptors, config.GRPCRoute{Path: "users", RPC: "users.v1.UserService/GetUser"})))
+
+	streams := newConfig(nil)
+	streams.Services[0].GRPC.StreamTimeout = time.Minute
+	streams.Services[0].GRPC.MaxConcurrentStreams = 100
+	assert.NoError(t, config.Validate(streams))
+	streams.Services[0].GRPC.MaxConcurrentStreams = -1
+	assert.Error(t, config.Validate(streams))
+}
+
+func TestGraphQLFederationValidation(t *testing.T) {
+	newConfig := func(federation config.GraphQLFederationConfig) *config.Config {
+		cfg := productsConfig()
+		cfg.Services[0].Protocol = "graphql"
+		cfg.Services[0].Targets = nil
+		cfg.Services[0].GraphQL = &config.GraphQLConfig{Federation: &federation}
+		return cfg
+	}
+	subgraphs := []config.GraphQLSubgraph{{Name: "users", URL: "http://users:4000/graphql"}, {Name: "orders", URL: "http://orders:4000/graphql"}}
+	customer := config.GraphQLLink{Type: "Order", Field: "customer", Subgraph: "users", Query: "user", Arguments: map[string]string{"id": "customerId"}}
+
+	assert.NoError(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: subgraphs, Links: []config.GraphQLLink{customer}})))
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{})))
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: append(subgraphs, subgraphs[0])})))
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: []config.GraphQLSubgraph{{Name: "users", URL: "users:4000"}}})))
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: subgraphs, Links: []config.GraphQLLink{customer, customer}})))
+
+	unknown := customer
+	unknown.Subgraph = "billing"
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: subgraphs, Links: []config.GraphQLLink{unknown}})))
+	noArguments := customer
+	noArguments.Arguments = nil
+	assert.Error(t, config.Validate(newConfig(config.GraphQLFederationConfig{Subgraphs: subgraphs, Links: []config.GraphQLLink{noArguments}})))
+}
+
+func TestCompressionValidation(t *testing.T) {
+	newConfig := func(compression config.CompressionConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080, Compression: true, CompressionOptions: compression},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.CompressionConfig{})))
+	assert.NoError(t, config.Validate(newConfig(config.CompressionConfig{
+		Encodings:   []string{"zstd", "gzip"},
+		MinSize:     512,
+		ZstdLevel:   19,
+		BrotliLevel: 11,
+	})))
+
+	assert.Error(t, config.Validate(newConfig(config.CompressionConfig{Encodings: []string{"deflate"}})))
+	assert.Error(t, config.Validate(newConfig(config.CompressionConfig{MinSize: -1})))
+	assert.Error(t, config.Validate(newConfig(config.CompressionConfig{GzipLevel: 10})))
+	assert.Error(t, config.Validate(newConfig(config.CompressionConfig{BrotliLevel: 12})))
+}
+
+func TestDNSTargetValidation(t *testing.T) {
+	newConfig := func(protocol string, targets ...string) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Protocol: protocol, Targets: targets},
+			},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig("", "dns+srv://orders.service.consul", "http://static:8080")))
+	assert.NoError(t, config.Validate(newConfig("http", "dns://orders.internal:8080/api?scheme=https")))
+
+	assert.Error(t, config.Validate(newConfig("", "dns+srv://orders.service.consul:8080")))
+	assert.Error(t, config.Validate(newConfig("", "dns://orders.internal?scheme=ftp")))
+	assert.Error(t, config.Validate(newConfig("grpc", "dns://orders.internal:9090")))
+
+	cfg := newConfig("", "http://static:8080")
+	cfg.Discovery = config.DiscoveryConfig{MinRefresh: time.Minute, MaxRefresh: time.Second}
+	assert.Error(t, config.Validate(cfg))
+	cfg.Discovery = config.DiscoveryConfig{Nameservers: []string{"10.0.0.2"}}
+	assert.Error(t, config.Validate(cfg))
+}
+
+func TestFixedServiceValidation(t *testing.T) {
+	newConfig := func(svc config.ServiceConfig) *config.Config {
+		svc.Name, svc.BasePath = "fixed", "/fixed"
+		return &config.Config{Server: config.ServerConfig{Port: 8080}, Services: []config.ServiceConfig{svc}}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.ServiceConfig{
+		Static: &config.StaticResponseConfig{Status: 503, Body: "Down for maintenance"},
+	})))
+	assert.NoError(t, config.Validate(newConfig(config.ServiceConfig{
+		Redirect: &config.RedirectConfig{Status: 301, Location: "https://new.example.com{{.Subpath}}"},
+	})))
+
+	for name, svc := range map[string]config.ServiceConfig{
+		"both":          {Static: &config.StaticResponseConfig{}, Redirect: &config.RedirectConfig{Location: "/"}},
+		"targets":       {Static: &config.StaticResponseConfig{}, Targets: []string{"http://localhost:8081"}},
+		"status":        {Static: &config.StaticResponseConfig{Status: 99}},
+		"redirect code": {Redirect: &config.RedirectConfig{Status: 200, Location: "/"}},
+		"no location":   {Redirect: &config.RedirectConfig{}},
+		"protocol":      {Protocol: "grpc", Static: &config.StaticResponseConfig{}},
+	} {
+		assert.Error(t, config.Validate(newConfig(svc)), name)
+	}
+}
+
+func TestRequestIDValidation(t *testing.T) {
+	newConfig := func(r config.RequestIDConfig) *config.Config {
+		return &config.Config{Server: config.ServerConfig{Port: 8080, RequestID: r}}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(config.RequestIDConfig{})))
+	assert.NoError(t, config.Validate(newConfig(config.RequestIDConfig{
+		Header: "X-Correlation-ID", Format: "ulid", Prefix: "edge-",
+		Trust: "networks", TrustedNetworks: []string{"10.0.0.0/8", "192.0.2.1"},
+	})))
+
+	for _, r := range []config.RequestIDConfig{
+		{Format: "snowflake"},
+		{Header: "X Request ID"},
+		{Trust: "some"},
+		{Trust: "networks"},
+		{TrustedNetworks: []string{"10.0.0.0/8"}},
+		{Trust: "networks", TrustedNetworks: []string{"10.0.0.0/33"}},
+	} {
+		assert.Error(t, config.Validate(newConfig(r)), "%+v", r)
+	}
+}
+
+func TestBackpressureValidation(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 8080},
+		Services: []config.ServiceConfig{{
+			Name: "orders", BasePath: "/orders", Targets: []string{"http://localhost:8081"},
+			Backpressure: &config.BackpressureConfig{MaxDelay: 10 * time.Second, StripRetryAfter: true},
+		}},
+	}
+	assert.NoError(t, config.Validate(cfg))
+
+	cfg.Services[0].Backpressure.MaxDelay = -time.Second
+	assert.Error(t, config.Validate(cfg))
+}
+
+func TestEgressProxyValidation(t *testing.T) {
+	newConfig := func(proxy *config.EgressProxyConfig) *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{{
+				Name: "partner", BasePath: "/partner", Targets: []string{"https://api.partner.example"},
+				Transport: &config.TransportConfig{Proxy: proxy},
+			}},
+		}
+	}
+
+	assert.NoError(t, config.Validate(newConfig(&config.EgressProxyConfig{
+		URL: "http://proxy.corp:3128", Username: "gateway", Password: "secret",
+		NoProxy: []string{".corp", "10.0.0.0/8", "localhost:8080"},
+	})))
+	assert.NoError(t, config.Validate(newConfig(&config.EgressProxyConfig{URL: "socks5://127.0.0.1:1080"})))
+
+	for _, proxy := range []*config.EgressProxyConfig{
+		{URL: "ftp://proxy.corp:21"},
+		{URL: "http://"},
+		{URL: "http://proxy.corp:3128", Password: "secret"},
+		{URL: "http://proxy.corp:3128", NoProxy: []string{"10.0.0.0/33"}},
+	} {
+		assert.Error(t, config.Validate(newConfig(proxy)), proxy.URL)
+	}
+}
+
+func TestFeatureFlagsValidation(t *testing.T) {
+	percent := func(p int) *int { return &p }
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			FeatureFlags: config.FeatureFlagsConfig{Flags: map[string]config.FeatureFlagConfig{
+				"beta": {Default: false, Rules: []config.FlagRuleConfig{
+					{Claim: "plan", Values: []string{"enterprise"}, Value: true},
+					{Percentage: percent(10), Value: true},
+				}},
+				"weight": {Default: 10},
+			}},
+			Services: []config.ServiceConfig{{
+				Name: "orders", BasePath: "/orders", Targets: []string{"http://localhost:8081"},
+				FeatureFlag: "beta",
+				Canary:      &config.CanaryConfig{Targets: []string{"http://localhost:8082"}, WeightFlag: "weight"},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"undefined route flag":  func(c *config.Config) { c.Services[0].FeatureFlag = "missing" },
+		"numeric route flag":    func(c *config.Config) { c.Services[0].FeatureFlag = "weight" },
+		"boolean weight flag":   func(c *config.Config) { c.Services[0].Canary.WeightFlag = "beta" },
+		"canary without target": func(c *config.Config) { c.Services[0].Canary.Targets = nil },
+		"canary weight":         func(c *config.Config) { c.Services[0].Canary.Weight = 101 },
+		"string default": func(c *config.Config) {
+			c.FeatureFlags.Flags["beta"] = config.FeatureFlagConfig{Default: "on"}
+		},
+		"mixed types": func(c *config.Config) {
+			c.FeatureFlags.Flags["weight"] = config.FeatureFlagConfig{Default: 10, Rules: []config.FlagRuleConfig{{Header: "X-Beta", Value: true}}}
+		},
+		"empty rule": func(c *config.Config) {
+			c.FeatureFlags.Flags["weight"] = config.FeatureFlagConfig{Default: 10, Rules: []config.FlagRuleConfig{{Value: 20}}}
+		},
+		"percentage": func(c *config.Config) {
+			c.FeatureFlags.Flags["weight"] = config.FeatureFlagConfig{Default: 10, Rules: []config.FlagRuleConfig{{Percentage: percent(110), Value: 20}}}
+		},
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+
+	// Flags from a file are only known at runtime
+	cfg := newConfig()
+	cfg.FeatureFlags.File = "/etc/odin/flags.yaml"
+	cfg.Services[0].FeatureFlag = "from-file"
+	assert.NoError(t, config.Validate(cfg))
+}
+
+func TestAsyncValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Async:  config.AsyncConfig{StatusPath: "/jobs"},
+			Services: []config.ServiceConfig{{
+				Name: "reports", BasePath: "/reports", Targets: []string{"http://localhost:8081"},
+				Async: &config.ServiceAsyncConfig{Mode: "always", CallbackHosts: []string{"hooks.example.com", ".example.org"}},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"mode":             func(c *config.Config) { c.Services[0].Async.Mode = "sometimes" },
+		"negative timeout": func(c *config.Config) { c.Services[0].Async.Timeout = -time.Second },
+		"callback host":    func(c *config.Config) { c.Services[0].Async.CallbackHosts = []string{"https://hooks.example.com/"} },
+		"protocol":         func(c *config.Config) { c.Services[0].Protocol = "grpc" },
+		"store":            func(c *config.Config) { c.Async.Store = "redis" },
+		"mongodb disabled": func(c *config.Config) { c.Async.Store = "mongodb" },
+		"workers":          func(c *config.Config) { c.Async.Workers = -1 },
+		"status path":      func(c *config.Config) { c.Async.StatusPath = "jobs/" },
+		"shadowed path":    func(c *config.Config) { c.Async.StatusPath = "/reports/jobs" },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestSchedulerValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Scheduler: config.SchedulerConfig{
+				Enabled: true,
+				Jobs: []config.ScheduledJobConfig{
+					{Name: "warm-cache", Schedule: "*/5 * * * *", Task: "http", Params: map[string]interface{}{"url": "/products"}},
+					{Name: "expire-keys", Schedule: "@daily", Task: "expireApiKeys", Timeout: time.Minute},
+				},
+			},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"store":            func(c *config.Config) { c.Scheduler.Store = "redis" },
+		"mongodb disabled": func(c *config.Config) { c.Scheduler.Store = "mongodb" },
+		"lease":            func(c *config.Config) { c.Scheduler.LeaseDuration = -time.Second },
+		"empty name":       func(c *config.Config) { c.Scheduler.Jobs[0].Name = "" },
+		"duplicate name":   func(c *config.Config) { c.Scheduler.Jobs[1].Name = "warm-cache" },
+		"no schedule":      func(c *config.Config) { c.Scheduler.Jobs[0].Schedule = "" },
+		"no task":          func(c *config.Config) { c.Scheduler.Jobs[0].Task = "" },
+		"negative timeout": func(c *config.Config) { c.Scheduler.Jobs[1].Timeout = -time.Second },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestRevocationValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Auth:   config.AuthConfig{Revocation: config.RevocationConfig{Enabled: true, SyncInterval: 5 * time.Second}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	cfg := newConfig()
+	cfg.Auth.Revocation.Store = "redis"
+	cfg.Auth.Revocation.RedisURL = "redis://localhost:6379"
+	assert.NoError(t, config.Validate(cfg))
+
+	for name, change := range map[string]func(*config.Config){
+		"store":            func(c *config.Config) { c.Auth.Revocation.Store = "etcd" },
+		"mongodb disabled": func(c *config.Config) { c.Auth.Revocation.Store = "mongodb" },
+		"no redis url":     func(c *config.Config) { c.Auth.Revocation.Store = "redis" },
+		"negative sync":    func(c *config.Config) { c.Auth.Revocation.SyncInterval = -time.Second },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{{
+				Name:     "orders",
+				BasePath: "/orders",
+				Targets:  []string{"http://orders:8080"},
+				Match:    `request.headers["x-tenant"] == "acme"`,
+				Policies: []config.PolicyConfig{{Effect: "allow", When: `"admin" in claims.roles`}},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"effect": func(c *config.Config) { c.Services[0].Policies[0].Effect = "permit" },
+		"when":   func(c *config.Config) { c.Services[0].Policies[0].When = " " },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestGeoIPValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			GeoIP:  config.GeoIPConfig{Enabled: true, Database: "/var/lib/geoip/GeoLite2-City.mmdb", MetricLabels: []string{"country", "asn"}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"no database":  func(c *config.Config) { c.GeoIP.Database = "" },
+		"city label":   func(c *config.Config) { c.GeoIP.MetricLabels = []string{"city"} },
+		"negative max": func(c *config.Config) { c.GeoIP.MaxLabelValues = -1 },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestExperimentValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Services: []config.ServiceConfig{{
+				Name:     "checkout",
+				BasePath: "/checkout",
+				Targets:  []string{"http://checkout:8080"},
+				Experiment: &config.ExperimentConfig{
+					Name:    "redesign",
+					Traffic: 20,
+					Variants: []config.VariantConfig{
+						{Name: "control", Weight: 50},
+						{Name: "redesign", Weight: 50, Targets: []string{"http://checkout-v2:8080"}},
+					},
+				},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"name":         func(c *config.Config) { c.Services[0].Experiment.Name = "" },
+		"traffic":      func(c *config.Config) { c.Services[0].Experiment.Traffic = 101 },
+		"one variant":  func(c *config.Config) { c.Services[0].Experiment.Variants = c.Services[0].Experiment.Variants[:1] },
+		"variant name": func(c *config.Config) { c.Services[0].Experiment.Variants[1].Name = "control" },
+		"weight":       func(c *config.Config) { c.Services[0].Experiment.Variants[0].Weight = -1 },
+		"no weight": func(c *config.Config) {
+			c.Services[0].Experiment.Variants[0].Weight, c.Services[0].Experiment.Variants[1].Weight = 0, 0
+		},
+		"cookie max age": func(c *config.Config) { c.Services[0].Experiment.CookieMaxAge = -time.Hour },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestTracingLogsValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server:  config.ServerConfig{Port: 8080},
+			Tracing: config.TracingConfig{Logs: config.TracingLogsConfig{Enabled: true, Level: "warn", BatchSize: 100}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"level":      func(c *config.Config) { c.Tracing.Logs.Level = "verbose" },
+		"batch size": func(c *config.Config) { c.Tracing.Logs.BatchSize = -1 },
+		"interval":   func(c *config.Config) { c.Tracing.Logs.FlushInterval = -time.Second },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestFaultValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{Port: 8080},
+			Faults: config.FaultsConfig{Enabled: true, Environment: "staging"},
+			Services: []config.ServiceConfig{{
+				Name:     "orders",
+				BasePath: "/orders",
+				Targets:  []string{"http://orders:8080"},
+				Fault:    &config.FaultConfig{DelayPercentage: 10, Delay: time.Second, ErrorPercentage: 5, ErrorStatus: 503},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"environment":   func(c *config.Config) { c.Faults.Environment = "" },
+		"percentage":    func(c *config.Config) { c.Services[0].Fault.ErrorPercentage = 101 },
+		"no percentage": func(c *config.Config) { *c.Services[0].Fault = config.FaultConfig{} },
+		"sum": func(c *config.Config) {
+			c.Services[0].Fault.ErrorPercentage, c.Services[0].Fault.AbortPercentage = 60, 50
+		},
+		"delay":  func(c *config.Config) { c.Services[0].Fault.Delay = 0 },
+		"status": func(c *config.Config) { c.Services[0].Fault.ErrorStatus = 302 },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+func TestOpenAPIUIValidation(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Server:  config.ServerConfig{Port: 8080},
+			OpenAPI: config.OpenAPIConfig{UIEnabled: true, UIPath: "/docs", UIRenderer: "redoc", UIServices: []string{"orders"}},
+			Services: []config.ServiceConfig{{
+				Name:     "orders",
+				BasePath: "/orders",
+				Targets:  []string{"http://orders:8080"},
+			}},
+		}
+	}
+	assert.NoError(t, config.Validate(newConfig()))
+
+	for name, change := range map[string]func(*config.Config){
+		"path":     func(c *config.Config) { c.OpenAPI.UIPath = "docs" },
+		"root":     func(c *config.Config) { c.OpenAPI.UIPath = "/" },
+		"renderer": func(c *config.Config) { c.OpenAPI.UIRenderer = "rapidoc" },
+		"service":  func(c *config.Config) { c.OpenAPI.UIServices = []string{"payments"} },
+	} {
+		cfg := newConfig()
+		change(cfg)
+		assert.Error(t, config.Validate(cfg), name)
+	}
+}
+
+// setNonZero gives v a value other than its zero value
+func setNonZero(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		setNonZero(v.Field(0))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+		setNonZero(key)
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(key, reflect.New(v.Type().Elem()).Elem())
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.String:
+		v.SetString("changed")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	}
+}
+
+func TestChangedSectionsCoversEverySection(t *testing.T) {
+	typ := reflect.TypeOf(config.Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		t.Run(field.Name, func(t *testing.T) {
+			require.NotEmpty(t, name, "section needs a yaml name")
+			var changed config.Config
+			setNonZero(reflect.ValueOf(&changed).Elem().Field(i))
+			assert.Equal(t, []string{name}, config.ChangedSections(&config.Config{}, &changed))
+		})
+	}
+	assert.Empty(t, config.ChangedSections(&config.Config{}, &config.Config{}))
+}
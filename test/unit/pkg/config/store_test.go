@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreUpdate(t *testing.T) {
+	first := &config.Config{Server: config.ServerConfig{Port: 8080}}
+	store := config.NewStore(first)
+
+	require.NoError(t, store.Update(func(cfg *config.Config) error {
+		cfg.Server.Port = 9090
+		return nil
+	}))
+	assert.Equal(t, 9090, store.Load().Server.Port)
+	// Snapshots taken before are never changed
+	assert.Equal(t, 8080, first.Server.Port)
+
+	// Failed changes are not published
+	err := store.Update(func(cfg *config.Config) error {
+		cfg.Server.Port = 1
+		return errors.New("save failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 9090, store.Load().Server.Port)
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	store := config.NewStore(&config.Config{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.Update(func(cfg *config.Config) error {
+				cfg.Server.Port++
+				return nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = store.Load().Server.Port
+		}()
+	}
+	wg.Wait()
+
+	// Every writer saw the changes of those before it
+	assert.Equal(t, 20, store.Load().Server.Port)
+}
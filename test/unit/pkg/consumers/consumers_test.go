@@ -0,0 +1,346 @@
+package consumers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/certs"
+	"odin/pkg/config"
+	"odin/pkg/consumers"
+	"odin/pkg/mongodb"
+	"odin/pkg/ratelimit"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps consumers in memory and enforces unique usernames, like
+// the repository
+type memoryStore struct {
+	mu        sync.Mutex
+	consumers map[string]*mongodb.ConsumerDocument
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{consumers: make(map[string]*mongodb.ConsumerDocument)}
+}
+
+func (s *memoryStore) CreateConsumer(_ context.Context, consumer *mongodb.ConsumerDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.consumers {
+		if other.Username == consumer.Username {
+			return mongodb.ErrDuplicate
+		}
+	}
+	copied := *consumer
+	s.consumers[consumer.ID] = &copied
+	return nil
+}
+
+func (s *memoryStore) GetConsumer(_ context.Context, id string) (*mongodb.ConsumerDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consumer, ok := s.consumers[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *consumer
+	return &copied, nil
+}
+
+func (s *memoryStore) ListConsumers(_ context.Context) ([]*mongodb.ConsumerDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*mongodb.ConsumerDocument
+	for _, consumer := range s.consumers {
+		copied := *consumer
+		list = append(list, &copied)
+	}
+	return list, nil
+}
+
+func (s *memoryStore) UpdateConsumer(_ context.Context, id string, consumer *mongodb.ConsumerDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.consumers[id]; !ok {
+		return mongodb.ErrNotFound
+	}
+	copied := *consumer
+	s.consumers[id] = &copied
+	return nil
+}
+
+func (s *memoryStore) DeleteConsumer(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.consumers[id]; !ok {
+		return mongodb.ErrNotFound
+	}
+	delete(s.consumers, id)
+	return nil
+}
+
+func newRegistry(t *testing.T, store *memoryStore) *consumers.Registry {
+	registry, err := consumers.NewRegistry(config.ConsumersConfig{Enabled: true, RefreshInterval: time.Hour},
+		store, ratelimit.NewMemoryCounter(), logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(registry.Stop)
+	return registry
+}
+
+var clientCert = &x509.Certificate{Raw: []byte("partner certificate")}
+
+// credentials set up how a test request authenticates
+type credentials struct {
+	keyID   string
+	subject string
+	userID  string
+	cert    bool
+	header  http.Header
+}
+
+// newGateway serves the orders and billing services behind an
+// authentication stand-in and the consumer middleware. The handler echoes
+// the consumer headers it receives.
+func newGateway(registry *consumers.Registry) *echo.Echo {
+	e := echo.New()
+	for _, name := range []string{"orders", "billing"} {
+		group := e.Group("/" + name)
+		group.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if id := c.Request().Header.Get("Test-Key"); id != "" {
+					c.Set("apiKey", &mongodb.APIKeyDocument{ID: id})
+				}
+				if sub := c.Request().Header.Get("Test-Subject"); sub != "" {
+					claims := &auth.JWTClaims{UserID: c.Request().Header.Get("Test-User")}
+					claims.RegisteredClaims = jwt.RegisteredClaims{Subject: sub}
+					c.Set("user", claims)
+				}
+				return next(c)
+			}
+		})
+		group.Use(registry.Middleware(name))
+		group.GET("/items", func(c echo.Context) error {
+			header := c.Request().Header
+			return c.JSON(http.StatusOK, map[string]string{
+				"id":       header.Get(consumers.HeaderConsumerID),
+				"username": header.Get(consumers.HeaderConsumerUsername),
+				"customId": header.Get(consumers.HeaderConsumerCustomID),
+				"tenant":   header.Get("X-Tenant"),
+			})
+		})
+	}
+	return e
+}
+
+func call(e *echo.Echo, path string, creds credentials) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range creds.header {
+		req.Header[name] = values
+	}
+	if creds.keyID != "" {
+		req.Header.Set("Test-Key", creds.keyID)
+	}
+	if creds.subject != "" {
+		req.Header.Set("Test-Subject", creds.subject)
+		req.Header.Set("Test-User", creds.userID)
+	}
+	if creds.cert {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRegistryValidation(t *testing.T) {
+	registry := newRegistry(t, newMemoryStore())
+	ctx := context.Background()
+
+	acme := &mongodb.ConsumerDocument{
+		Username:         "acme",
+		Enabled:          true,
+		APIKeyIDs:        []string{"key-1"},
+		CertFingerprints: []string{"SHA256:AB:CD"},
+	}
+	require.NoError(t, registry.Create(ctx, acme))
+	assert.NotEmpty(t, acme.ID)
+	assert.Equal(t, []string{"abcd"}, acme.CertFingerprints)
+
+	stored, ok := registry.Get(acme.ID)
+	require.True(t, ok)
+	assert.Equal(t, "acme", stored.Username)
+
+	for name, consumer := range map[string]*mongodb.ConsumerDocument{
+		"no username":     {},
+		"zero limit":      {Username: "a", RateLimit: &mongodb.ConsumerRateLimit{Period: "minute"}},
+		"unknown period":  {Username: "a", RateLimit: &mongodb.ConsumerRateLimit{Limit: 1, Period: "week"}},
+		"bad header name": {Username: "a", Headers: map[string]string{"X Tenant": "a"}},
+	} {
+		assert.ErrorIs(t, registry.Create(ctx, consumer), consumers.ErrInvalid, name)
+	}
+
+	for name, consumer := range map[string]*mongodb.ConsumerDocument{
+		"taken username": {Username: "acme"},
+		"taken key":      {Username: "globex", APIKeyIDs: []string{"key-1"}},
+		"taken cert":     {Username: "globex", CertFingerprints: []string{"ab:cd"}},
+	} {
+		assert.ErrorIs(t, registry.Create(ctx, consumer), consumers.ErrConflict, name)
+	}
+
+	// A consumer keeps its own credentials when it is updated
+	update := &mongodb.ConsumerDocument{Username: "acme", APIKeyIDs: []string{"key-1", "key-2"}}
+	require.NoError(t, registry.Update(ctx, acme.ID, update))
+	stored, _ = registry.Get(acme.ID)
+	assert.Equal(t, []string{"key-1", "key-2"}, stored.APIKeyIDs)
+	assert.False(t, stored.Enabled)
+
+	assert.ErrorIs(t, registry.Update(ctx, "missing", update), consumers.ErrNotFound)
+	assert.ErrorIs(t, registry.Delete(ctx, "missing"), consumers.ErrNotFound)
+
+	require.NoError(t, registry.Delete(ctx, acme.ID))
+	assert.Empty(t, registry.List())
+}
+
+func TestMiddleware(t *testing.T) {
+	store := newMemoryStore()
+	registry := newRegistry(t, store)
+	ctx := context.Background()
+
+	require.NoError(t, registry.Create(ctx, &mongodb.ConsumerDocument{
+		Username:    "acme",
+		CustomID:    "crm-42",
+		Enabled:     true,
+		APIKeyIDs:   []string{"key-1"},
+		JWTSubjects: []string{"acme-app"},
+		Services:    []string{"orders"},
+		Headers:     map[string]string{"X-Tenant": "acme"},
+	}))
+	require.NoError(t, registry.Create(ctx, &mongodb.ConsumerDocument{
+		Username:         "globex",
+		Enabled:          true,
+		JWTSubjects:      []string{"user-7"},
+		CertFingerprints: []string{certs.Fingerprint(clientCert)},
+	}))
+	require.NoError(t, registry.Create(ctx, &mongodb.ConsumerDocument{
+		Username:  "initech",
+		APIKeyIDs: []string{"key-3"},
+	}))
+	e := newGateway(registry)
+
+	// Requests made with any of a consumer's credentials carry its headers
+	rec := call(e, "/orders/items", credentials{keyID: "key-1"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"username":"acme"`)
+	assert.Contains(t, rec.Body.String(), `"customId":"crm-42"`)
+	assert.Contains(t, rec.Body.String(), `"tenant":"acme"`)
+
+	rec = call(e, "/orders/items", credentials{subject: "acme-app"})
+	assert.Contains(t, rec.Body.String(), `"username":"acme"`)
+
+	// JWTs are matched by sub, then by user_id
+	rec = call(e, "/orders/items", credentials{subject: "other", userID: "user-7"})
+	assert.Contains(t, rec.Body.String(), `"username":"globex"`)
+
+	rec = call(e, "/billing/items", credentials{cert: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"username":"globex"`)
+
+	// Consumers are limited to their services, and disabled ones rejected
+	rec = call(e, "/billing/items", credentials{keyID: "key-1"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = call(e, "/orders/items", credentials{keyID: "key-3"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Clients cannot pose as a consumer
+	rec = call(e, "/orders/items", credentials{keyID: "key-9", header: http.Header{
+		consumers.HeaderConsumerUsername: {"acme"},
+	}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"username":""`)
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	registry := newRegistry(t, newMemoryStore())
+	require.NoError(t, registry.Create(context.Background(), &mongodb.ConsumerDocument{
+		Username:  "acme",
+		Enabled:   true,
+		APIKeyIDs: []string{"key-1", "key-2"},
+		RateLimit: &mongodb.ConsumerRateLimit{Limit: 2, Period: ratelimit.PeriodMinute},
+	}))
+	e := newGateway(registry)
+
+	// The limit is shared by all the consumer's credentials and services
+	rec := call(e, "/orders/items", credentials{keyID: "key-1"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = call(e, "/billing/items", credentials{keyID: "key-2"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = call(e, "/orders/items", credentials{keyID: "key-1"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestReloadPicksUpChanges(t *testing.T) {
+	store := newMemoryStore()
+	registry := newRegistry(t, store)
+
+	// Consumers created by another gateway appear after a reload
+	require.NoError(t, store.CreateConsumer(context.Background(), &mongodb.ConsumerDocument{
+		ID:        "c-1",
+		Username:  "acme",
+		Enabled:   true,
+		APIKeyIDs: []string{"key-1"},
+	}))
+	_, ok := registry.Get("c-1")
+	assert.False(t, ok)
+
+	require.NoError(t, registry.Reload(context.Background()))
+	rec := call(newGateway(registry), "/orders/items", credentials{keyID: "key-1"})
+	assert.Contains(t, rec.Body.String(), `"id":"c-1"`)
+}
+
+func TestHMACKeys(t *testing.T) {
+	registry := newRegistry(t, newMemoryStore())
+	ctx := context.Background()
+
+	acme := &mongodb.ConsumerDocument{
+		Username: "acme",
+		Enabled:  true,
+		HMACKeys: []mongodb.ConsumerHMACKey{{ID: "acme-1", Secret: "s3cret"}},
+	}
+	require.NoError(t, registry.Create(ctx, acme))
+	secret, ok := registry.HMACSecret("acme-1")
+	assert.True(t, ok)
+	assert.Equal(t, "s3cret", secret)
+	_, ok = registry.HMACSecret("other")
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, registry.Create(ctx, &mongodb.ConsumerDocument{
+		Username: "globex", HMACKeys: []mongodb.ConsumerHMACKey{{ID: "globex-1"}},
+	}), consumers.ErrInvalid)
+	assert.ErrorIs(t, registry.Create(ctx, &mongodb.ConsumerDocument{
+		Username: "globex", HMACKeys: []mongodb.ConsumerHMACKey{{ID: "acme-1", Secret: "x"}},
+	}), consumers.ErrConflict)
+
+	// Requests verified with a key belong to its consumer
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/orders/items", nil), httptest.NewRecorder())
+	c.Set("hmacKeyID", "acme-1")
+	require.NotNil(t, registry.Identify(c))
+	assert.Equal(t, acme.ID, registry.Identify(c).ID)
+}
@@ -0,0 +1,212 @@
+package discovery
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/discovery"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsServer answers queries over UDP from a table of records
+type dnsServer struct {
+	mu      sync.Mutex
+	records map[string][]dnsmessage.Resource
+	fail    bool
+	addr    string
+}
+
+func startDNSServer(t *testing.T) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	s := &dnsServer{records: make(map[string][]dnsmessage.Resource), addr: conn.LocalAddr().String()}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			resp := s.answer(query)
+			packed, _ := resp.Pack()
+			conn.WriteTo(packed, from)
+		}
+	}()
+	return s
+}
+
+func (s *dnsServer) answer(query dnsmessage.Message) dnsmessage.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := query.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true},
+		Questions: query.Questions,
+	}
+	if s.fail {
+		resp.RCode = dnsmessage.RCodeServerFailure
+		return resp
+	}
+	for _, rr := range s.records[q.Name.String()] {
+		if rr.Header.Type == q.Type {
+			resp.Answers = append(resp.Answers, rr)
+		}
+	}
+	return resp
+}
+
+func (s *dnsServer) set(name string, records ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name] = records
+}
+
+func (s *dnsServer) setFailing(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func header(name string, typ dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+}
+
+func srv(name, target string, priority, port uint16, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypeSRV, ttl),
+		Body:   &dnsmessage.SRVResource{Priority: priority, Port: port, Target: dnsmessage.MustNewName(target)},
+	}
+}
+
+func a(name, ip string, ttl uint32) dnsmessage.Resource {
+	var addr [4]byte
+	copy(addr[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{Header: header(name, dnsmessage.TypeA, ttl), Body: &dnsmessage.AResource{A: addr}}
+}
+
+func aaaa(name, ip string, ttl uint32) dnsmessage.Resource {
+	var addr [16]byte
+	copy(addr[:], net.ParseIP(ip))
+	return dnsmessage.Resource{Header: header(name, dnsmessage.TypeAAAA, ttl), Body: &dnsmessage.AAAAResource{AAAA: addr}}
+}
+
+func newResolver(server *dnsServer) *discovery.Resolver {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return discovery.NewResolver(discovery.Config{
+		Nameservers: []string{server.addr},
+		Timeout:     time.Second,
+		MinRefresh:  20 * time.Millisecond,
+	}, logger)
+}
+
+func TestResolverSRVTargets(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("orders.service.consul.",
+		srv("orders.service.consul.", "node-b.consul.", 10, 8081, 30),
+		srv("orders.service.consul.", "node-a.consul.", 10, 8080, 30),
+		srv("orders.service.consul.", "backup.consul.", 20, 9000, 30),
+	)
+	resolver := newResolver(server)
+
+	target := "dns+srv://orders.service.consul"
+	require.NoError(t, resolver.Add(target))
+	assert.Equal(t, []string{"http://node-a.consul:8080", "http://node-b.consul:8081"}, resolver.Targets(target),
+		"only the records with the lowest priority are used")
+
+	expanded := resolver.Expand([]string{"http://static:80", target})
+	assert.Equal(t, []string{"http://static:80", "http://node-a.consul:8080", "http://node-b.consul:8081"}, expanded)
+
+	static := []string{"http://static:80"}
+	assert.Equal(t, static, resolver.Expand(static))
+}
+
+func TestResolverHostTargets(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("api.internal.",
+		a("api.internal.", "10.0.0.2", 30),
+		a("api.internal.", "10.0.0.1", 30),
+		aaaa("api.internal.", "fd00::1", 30),
+	)
+	resolver := newResolver(server)
+
+	target := "dns://api.internal/v1?scheme=https"
+	require.NoError(t, resolver.Add(target))
+	assert.Equal(t, []string{
+		"https://10.0.0.1:443/v1",
+		"https://10.0.0.2:443/v1",
+		"https://[fd00::1]:443/v1",
+	}, resolver.Targets(target))
+}
+
+func TestResolverRefreshesExpiredRecords(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("api.internal.", a("api.internal.", "10.0.0.1", 0))
+	resolver := newResolver(server)
+
+	changes := make(chan discovery.Change, 10)
+	resolver.OnChange(func(change discovery.Change) { changes <- change })
+
+	target := "dns://api.internal:8080"
+	require.NoError(t, resolver.Add(target))
+	<-changes
+	resolver.Start()
+	defer resolver.Stop()
+
+	server.set("api.internal.", a("api.internal.", "10.0.0.1", 0), a("api.internal.", "10.0.0.2", 0))
+	select {
+	case change := <-changes:
+		assert.Equal(t, target, change.Target)
+		assert.Equal(t, []string{"http://10.0.0.2:8080"}, change.Added)
+		assert.Empty(t, change.Removed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("records were not looked up again")
+	}
+
+	// Failed lookups keep the addresses
+	server.setFailing(true)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}, resolver.Targets(target))
+
+	server.setFailing(false)
+	server.set("api.internal.", a("api.internal.", "10.0.0.2", 0))
+	select {
+	case change := <-changes:
+		assert.Empty(t, change.Added)
+		assert.Equal(t, []string{"http://10.0.0.1:8080"}, change.Removed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("records were not looked up again")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	_, err := discovery.ParseTarget("dns+srv://orders.service.consul?scheme=https")
+	assert.NoError(t, err)
+	_, err = discovery.ParseTarget("dns://api.internal:8080/v1")
+	assert.NoError(t, err)
+
+	for _, target := range []string{
+		"dns+srv://orders.service.consul:8080",
+		"dns://api.internal?scheme=ftp",
+		"dns://",
+		"http://api.internal",
+	} {
+		_, err := discovery.ParseTarget(target)
+		assert.Error(t, err, target)
+	}
+	assert.True(t, discovery.IsDNS("dns+srv://orders"))
+	assert.False(t, discovery.IsDNS("http://api"))
+}
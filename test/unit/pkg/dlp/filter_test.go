@@ -0,0 +1,137 @@
+package dlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/dlp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFilter(t *testing.T, stats *dlp.Stats, rules ...config.DLPRule) *dlp.Filter {
+	t.Helper()
+	for i := range rules {
+		if rules[i].Action == "" {
+			rules[i].Action = "mask"
+		}
+	}
+	filter, err := dlp.NewFilter("payments", config.DLPConfig{Rules: rules}, stats)
+	require.NoError(t, err)
+	return filter
+}
+
+func apply(t *testing.T, filter *dlp.Filter, body string) map[string]interface{} {
+	t.Helper()
+	out, changed, err := filter.Apply([]byte(body))
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &doc))
+	return doc
+}
+
+func TestDetectorsMaskValues(t *testing.T) {
+	filter := newFilter(t, nil,
+		config.DLPRule{Name: "pan", Detector: "pan", KeepLast: 4},
+		config.DLPRule{Name: "ssn", Detector: "ssn"},
+		config.DLPRule{Name: "email", Detector: "email"},
+	)
+
+	doc := apply(t, filter, `{
+		"card": "4111111111111111",
+		"order": "1234567890123",
+		"note": "call a@b.io about 078-05-1120",
+		"invalidSsn": "000-12-3456"
+	}`)
+
+	assert.Equal(t, "************1111", doc["card"])
+	// Fails the Luhn check, so it is not a card number
+	assert.Equal(t, "1234567890123", doc["order"])
+	assert.Equal(t, "call ****** about ***********", doc["note"])
+	assert.Equal(t, "000-12-3456", doc["invalidSsn"])
+}
+
+func TestFieldRules(t *testing.T) {
+	filter := newFilter(t, nil,
+		config.DLPRule{Name: "secrets", Fields: []string{"password", "customer.token"}, Action: "drop"},
+		config.DLPRule{Name: "phone", Fields: []string{"Phone"}, KeepLast: 2},
+	)
+
+	doc := apply(t, filter, `{
+		"password": "hunter2",
+		"customer": {"token": {"id": 1}, "phone": 5551234, "name": "Ann"},
+		"token": "kept",
+		"contacts": [{"phone": "5559876"}]
+	}`)
+
+	assert.NotContains(t, doc, "password")
+	assert.Equal(t, "kept", doc["token"])
+
+	customer := doc["customer"].(map[string]interface{})
+	assert.NotContains(t, customer, "token")
+	assert.Equal(t, "*****34", customer["phone"])
+	assert.Equal(t, "Ann", customer["name"])
+
+	contacts := doc["contacts"].([]interface{})
+	assert.Equal(t, "*****76", contacts[0].(map[string]interface{})["phone"])
+}
+
+func TestDetectorWithinFieldsAndDrop(t *testing.T) {
+	filter := newFilter(t, nil,
+		config.DLPRule{Name: "emails", Fields: []string{"contacts"}, Detector: "email", Action: "drop"},
+	)
+
+	doc := apply(t, filter, `{"owner": "x@y.com", "contacts": ["a@b.com", "none", "c@d.org"]}`)
+	assert.Equal(t, "x@y.com", doc["owner"])
+	assert.Equal(t, []interface{}{"none"}, doc["contacts"])
+}
+
+func TestUnchangedBodyIsReturnedAsIs(t *testing.T) {
+	filter := newFilter(t, nil, config.DLPRule{Name: "ssn", Detector: "ssn"})
+
+	body := []byte("{\n  \"id\": 12,\n  \"html\": \"<b>\"\n}")
+	out, changed, err := filter.Apply(body)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, body, out)
+
+	_, _, err = filter.Apply([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestStatsCountOccurrences(t *testing.T) {
+	stats := dlp.NewStats()
+	filter := newFilter(t, stats, config.DLPRule{Name: "email", Detector: "email"})
+
+	apply(t, filter, `{"a": "x@y.com", "b": ["p@q.com", "r@s.com"]}`)
+	apply(t, filter, `{"a": "x@y.com"}`)
+
+	counters := stats.Snapshot()
+	require.Len(t, counters, 1)
+	assert.Equal(t, "payments", counters[0].Service)
+	assert.Equal(t, "email", counters[0].Rule)
+	assert.Equal(t, "mask", counters[0].Action)
+	assert.Equal(t, int64(4), counters[0].Occurrences)
+	assert.Equal(t, int64(2), counters[0].Responses)
+}
+
+func TestInspects(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	assert.True(t, dlp.Inspects(header))
+
+	header.Set("Content-Type", "application/problem+json")
+	assert.True(t, dlp.Inspects(header))
+
+	header.Set("Content-Encoding", "gzip")
+	assert.False(t, dlp.Inspects(header))
+
+	header = http.Header{}
+	header.Set("Content-Type", "text/html")
+	assert.False(t, dlp.Inspects(header))
+}
@@ -0,0 +1,126 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPagesServer(t *testing.T, global config.ErrorPagesConfig, services []config.ServiceConfig) *echo.Echo {
+	t.Helper()
+	pages, err := errors.NewPages(global, services, logrus.New())
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.HTTPErrorHandler = pages.ErrorHandler(e.DefaultHTTPErrorHandler)
+	fail := func(code int, message string) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return echo.NewHTTPError(code, message)
+		}
+	}
+	e.GET("/orders/*", fail(http.StatusBadGateway, "Service unavailable"))
+	e.GET("/billing/*", fail(http.StatusTooManyRequests, "Rate limit exceeded, retry in <1m"))
+	e.GET("/admin/api/thing", fail(http.StatusNotFound, "not found"))
+	return e
+}
+
+func get(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPages_BuiltIn(t *testing.T) {
+	e := newPagesServer(t, config.ErrorPagesConfig{}, []config.ServiceConfig{
+		{Name: "orders", BasePath: "/orders"},
+	})
+
+	rec := get(e, "/orders/1")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{"error":"Service unavailable","status":502,"requestId":"req-1"}`, rec.Body.String())
+
+	// Requests without a request ID are assigned one
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["requestId"])
+	assert.Equal(t, body["requestId"], rec.Header().Get(echo.HeaderXRequestID))
+
+	// Other routes keep echo's errors
+	rec = get(e, "/admin/api/thing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"message":"not found"}`, rec.Body.String())
+}
+
+func TestPages_Templates(t *testing.T) {
+	global := config.ErrorPagesConfig{
+		Templates: map[string]string{
+			"5xx":     `{"code": {{.Status}}, "reason": {{json .Message}}, "service": {{json .Service}}}`,
+			"default": `{"code": {{.Status}}}`,
+		},
+	}
+	e := newPagesServer(t, global, []config.ServiceConfig{
+		{Name: "orders", BasePath: "/orders"},
+		{Name: "billing", BasePath: "/billing", ErrorPages: &config.ErrorPagesConfig{
+			Format: "html",
+			Templates: map[string]string{
+				"429": `<p>{{.Message}} for {{.Service}} ({{.RequestID}})</p>`,
+			},
+		}},
+	})
+
+	rec := get(e, "/orders/1")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.JSONEq(t, `{"code":502,"reason":"Service unavailable","service":"orders"}`, rec.Body.String())
+
+	// The service's HTML template overrides the global ones, and escapes values
+	rec = get(e, "/billing/1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `<p>Rate limit exceeded, retry in &lt;1m for billing (req-1)</p>`, rec.Body.String())
+}
+
+func TestPages_InvalidTemplate(t *testing.T) {
+	_, err := errors.NewPages(config.ErrorPagesConfig{
+		Templates: map[string]string{"502": "{{.Status"},
+	}, nil, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestPages_SetServices(t *testing.T) {
+	global := config.ErrorPagesConfig{
+		Templates: map[string]string{"default": `{"code": {{.Status}}, "service": {{json .Service}}}`},
+	}
+	pages, err := errors.NewPages(global, []config.ServiceConfig{{Name: "orders", BasePath: "/orders"}}, logrus.New())
+	require.NoError(t, err)
+	e := echo.New()
+	e.HTTPErrorHandler = pages.ErrorHandler(e.DefaultHTTPErrorHandler)
+	e.GET("/*", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadGateway, "Service unavailable")
+	})
+
+	assert.JSONEq(t, `{"code":502,"service":"orders"}`, get(e, "/orders/1").Body.String())
+
+	require.NoError(t, pages.SetServices([]config.ServiceConfig{{Name: "billing", BasePath: "/billing"}}))
+	assert.JSONEq(t, `{"code":502,"service":"billing"}`, get(e, "/billing/1").Body.String())
+	assert.JSONEq(t, `{"message":"Service unavailable"}`, get(e, "/orders/1").Body.String())
+
+	assert.Error(t, pages.SetServices([]config.ServiceConfig{{Name: "billing", BasePath: "/billing", ErrorPages: &config.ErrorPagesConfig{
+		Templates: map[string]string{"502": "{{.Status"},
+	}}}))
+	assert.JSONEq(t, `{"code":502,"service":"billing"}`, get(e, "/billing/1").Body.String())
+}
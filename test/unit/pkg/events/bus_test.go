@@ -0,0 +1,153 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryDeadLetters struct {
+	mu      sync.Mutex
+	letters []*mongodb.DeadLetterDocument
+}
+
+func (m *memoryDeadLetters) CreateDeadLetter(ctx context.Context, letter *mongodb.DeadLetterDocument) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters = append(m.letters, letter)
+	return nil
+}
+
+func (m *memoryDeadLetters) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.letters)
+}
+
+func TestBusDeliversSignedWebhook(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bus := events.NewBus(config.EventsConfig{
+		Webhooks: []config.EventWebhookConfig{
+			{Name: "ops", URL: server.URL, Secret: "s3cret", Events: []string{"service.*"}},
+		},
+	}, nil, logrus.New())
+	require.NoError(t, bus.Start())
+	defer bus.Stop()
+
+	bus.Publish(events.ServiceCreated, map[string]interface{}{"service": "users"})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		assert.Equal(t, "service.created", r.Header.Get(events.HeaderEvent))
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(events.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, events.Sign("s3cret", timestamp, body), r.Header.Get(events.HeaderSignature))
+
+		var event events.Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, events.ServiceCreated, event.Type)
+		assert.Equal(t, r.Header.Get(events.HeaderDelivery), event.ID)
+		assert.Equal(t, "users", event.Data["service"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestBusDeadLettersAfterRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	store := &memoryDeadLetters{}
+	bus := events.NewBus(config.EventsConfig{
+		Webhooks: []config.EventWebhookConfig{
+			{Name: "flaky", URL: server.URL, MaxRetries: 2, RetryBackoff: 10 * time.Millisecond},
+		},
+	}, store, logrus.New())
+	require.NoError(t, bus.Start())
+	defer bus.Stop()
+
+	bus.Publish(events.ConfigReloaded, nil)
+
+	require.Eventually(t, func() bool { return store.count() == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	letter := store.letters[0]
+	assert.Equal(t, "flaky", letter.Webhook)
+	assert.Equal(t, "config.reloaded", letter.EventType)
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, letter.LastStatus)
+}
+
+func TestBusSkipsUnsubscribedEvents(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	delivered := make(chan events.Event, 1)
+	bus := events.NewBus(config.EventsConfig{
+		Webhooks: []config.EventWebhookConfig{
+			{Name: "plugins", URL: server.URL, Events: []string{"plugin.loaded"}},
+		},
+	}, nil, logrus.New())
+	bus.Subscribe(func(event events.Event) { delivered <- event })
+	require.NoError(t, bus.Start())
+	defer bus.Stop()
+
+	bus.Publish(events.TargetUnhealthy, map[string]interface{}{"target": "http://users:8081"})
+
+	select {
+	case event := <-delivered:
+		assert.Equal(t, events.TargetUnhealthy, event.Type)
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber was not called")
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestMatches(t *testing.T) {
+	assert.True(t, events.Matches(nil, events.ServiceCreated))
+	assert.True(t, events.Matches([]string{"*"}, events.AnomalyDetected))
+	assert.True(t, events.Matches([]string{"service.*"}, events.ServiceDeleted))
+	assert.True(t, events.Matches([]string{"target.unhealthy"}, events.TargetUnhealthy))
+	assert.False(t, events.Matches([]string{"service.*"}, events.PluginLoaded))
+	assert.False(t, events.Matches([]string{"target.recovered"}, events.TargetUnhealthy))
+}
+
+func TestPublishOnNilBus(t *testing.T) {
+	var bus *events.Bus
+	assert.NotPanics(t, func() {
+		bus.Publish(events.ServiceCreated, nil)
+	})
+}
@@ -0,0 +1,136 @@
+package experiments
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/experiments"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func experimentConfig(traffic int) config.ExperimentConfig {
+	return config.ExperimentConfig{
+		Name:    "redesign",
+		Traffic: traffic,
+		Claim:   "sub",
+		Variants: []config.VariantConfig{
+			{Name: "control", Weight: 75},
+			{Name: "new", Weight: 25, Targets: []string{"http://checkout-v2:8080"}, Headers: map[string]string{"X-Checkout-UI": "v2"}},
+		},
+	}
+}
+
+func TestAssign(t *testing.T) {
+	half, err := experiments.New("checkout", experimentConfig(50))
+	require.NoError(t, err)
+	all, err := experiments.New("checkout", experimentConfig(100))
+	require.NoError(t, err)
+	none, err := experiments.New("checkout", experimentConfig(0))
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		assert.Nil(t, none.Assign(key))
+
+		variant := all.Assign(key)
+		require.NotNil(t, variant)
+		assert.Same(t, variant, all.Assign(key), "assignment is stable")
+		counts[variant.Name]++
+
+		// Raising the traffic share keeps the variant of clients already in
+		if v := half.Assign(key); v != nil {
+			counts["half"]++
+			assert.Equal(t, variant.Name, v.Name)
+		}
+	}
+	assert.InDelta(t, 3000, counts["control"], 200)
+	assert.InDelta(t, 1000, counts["new"], 200)
+	assert.InDelta(t, 2000, counts["half"], 200)
+
+	_, err = experiments.New("checkout", config.ExperimentConfig{Name: "empty"})
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	experiment, err := experiments.New("checkout", experimentConfig(100))
+	require.NoError(t, err)
+
+	e := echo.New()
+	serve := func(req *http.Request, user any) (*httptest.ResponseRecorder, http.Header, *experiments.Variant) {
+		var upstream http.Header
+		var variant *experiments.Variant
+		handler := experiment.Middleware()(func(c echo.Context) error {
+			upstream = c.Request().Header.Clone()
+			variant = experiments.FromContext(c)
+			return c.NoContent(http.StatusOK)
+		})
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if user != nil {
+			c.Set("user", user)
+		}
+		require.NoError(t, handler(c))
+		return rec, upstream, variant
+	}
+
+	// Anonymous clients get a cookie and keep their variant with it
+	req := httptest.NewRequest(http.MethodGet, "/checkout", nil)
+	req.Header.Set(experiments.Header, "redesign=forged")
+	rec, upstream, variant := serve(req, nil)
+	require.NotNil(t, variant)
+	assignment := "redesign=" + variant.Name
+	assert.Equal(t, assignment, rec.Header().Get(experiments.Header))
+	assert.Equal(t, assignment, upstream.Get(experiments.Header))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "odin_exp_redesign", cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/checkout", nil)
+		req.AddCookie(cookies[0])
+		rec, _, again := serve(req, nil)
+		assert.Equal(t, variant.Name, again.Name)
+		assert.Empty(t, rec.Result().Cookies())
+	}
+
+	// Authenticated clients are assigned by their claim, on any device
+	var newVariant string
+	for i := 0; i < 100 && newVariant == ""; i++ {
+		claims := map[string]interface{}{"sub": fmt.Sprintf("user-%d", i)}
+		_, upstream, variant := serve(httptest.NewRequest(http.MethodGet, "/checkout", nil), claims)
+		if variant.Name == "new" {
+			newVariant = claims["sub"].(string)
+			assert.Equal(t, "v2", upstream.Get("X-Checkout-UI"))
+			assert.Equal(t, []string{"http://checkout-v2:8080"}, variant.Targets)
+		}
+	}
+	require.NotEmpty(t, newVariant)
+	rec, _, variant = serve(httptest.NewRequest(http.MethodGet, "/checkout", nil), map[string]interface{}{"sub": newVariant})
+	assert.Equal(t, "new", variant.Name)
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestMiddlewareOutsideExperiment(t *testing.T) {
+	experiment, err := experiments.New("checkout", experimentConfig(0))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/checkout", nil)
+	req.Header.Set(experiments.Header, "redesign=new")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	handler := experiment.Middleware()(func(c echo.Context) error {
+		assert.Empty(t, c.Request().Header.Get(experiments.Header))
+		assert.Nil(t, experiments.FromContext(c))
+		return c.NoContent(http.StatusOK)
+	})
+	require.NoError(t, handler(c))
+	assert.Empty(t, rec.Header().Get(experiments.Header))
+}
@@ -0,0 +1,130 @@
+package faults
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/faults"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInjector(environment string, fault *config.FaultConfig) *faults.Injector {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return faults.New(
+		config.FaultsConfig{Enabled: true, Environment: environment},
+		[]config.ServiceConfig{{Name: "orders", Fault: fault}, {Name: "billing"}},
+		logger,
+	)
+}
+
+// serve runs a request of service through the injector's middleware
+func serve(injector *faults.Injector, service string) (*httptest.ResponseRecorder, error) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	err := injector.Middleware(service)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "served")
+	})(c)
+	return rec, err
+}
+
+func TestErrorFault(t *testing.T) {
+	injector := newInjector("staging", &config.FaultConfig{ErrorPercentage: 100, ErrorStatus: 502})
+	require.True(t, injector.Allowed())
+
+	rec, err := serve(injector, "orders")
+	var he *echo.HTTPError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusBadGateway, he.Code)
+	assert.Equal(t, "error", rec.Header().Get(faults.Header))
+
+	// Other services are served
+	rec, err = serve(injector, "billing")
+	require.NoError(t, err)
+	assert.Equal(t, "served", rec.Body.String())
+}
+
+func TestDelayFault(t *testing.T) {
+	injector := newInjector("development", &config.FaultConfig{DelayPercentage: 100, Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	rec, err := serve(injector, "orders")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, "served", rec.Body.String())
+	assert.Equal(t, "delay", rec.Header().Get(faults.Header))
+}
+
+func TestAbortFault(t *testing.T) {
+	injector := newInjector("test", &config.FaultConfig{AbortPercentage: 100})
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { serve(injector, "orders") })
+}
+
+func TestRuntimeFaults(t *testing.T) {
+	injector := newInjector("staging", nil)
+
+	_, err := injector.Set("payments", config.FaultConfig{ErrorPercentage: 50}, 0)
+	assert.ErrorIs(t, err, faults.ErrUnknownService)
+	_, err = injector.Set("billing", config.FaultConfig{ErrorPercentage: 150}, 0)
+	assert.Error(t, err)
+
+	f, err := injector.Set("billing", config.FaultConfig{ErrorPercentage: 100}, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, f.ExpiresAt.IsZero())
+	assert.Contains(t, injector.Faults(), "billing")
+	_, err = serve(injector, "billing")
+	assert.Error(t, err)
+
+	// Faults stop once they expire
+	time.Sleep(60 * time.Millisecond)
+	assert.NotContains(t, injector.Faults(), "billing")
+	_, err = serve(injector, "billing")
+	assert.NoError(t, err)
+
+	_, err = injector.Set("orders", config.FaultConfig{ErrorPercentage: 100}, 0)
+	require.NoError(t, err)
+	assert.True(t, injector.Clear("orders"))
+	assert.False(t, injector.Clear("orders"))
+	_, err = serve(injector, "orders")
+	assert.NoError(t, err)
+}
+
+func TestFaultsNotAllowed(t *testing.T) {
+	injector := newInjector("production", &config.FaultConfig{ErrorPercentage: 100})
+	assert.False(t, injector.Allowed())
+	assert.Empty(t, injector.Faults(), "configured faults are ignored")
+
+	_, err := injector.Set("orders", config.FaultConfig{ErrorPercentage: 100}, 0)
+	assert.ErrorIs(t, err, faults.ErrNotAllowed)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	custom := faults.New(config.FaultsConfig{Enabled: true, Environment: "perf", AllowedEnvironments: []string{"perf"}}, nil, logger)
+	assert.True(t, custom.Allowed())
+}
+
+func TestSetServices(t *testing.T) {
+	injector := newInjector("staging", &config.FaultConfig{ErrorPercentage: 100})
+	_, err := injector.Set("billing", config.FaultConfig{ErrorPercentage: 100}, 0)
+	require.NoError(t, err)
+
+	injector.SetServices([]config.ServiceConfig{
+		{Name: "orders", Fault: &config.FaultConfig{ErrorPercentage: 100}},
+		{Name: "payments", Fault: &config.FaultConfig{DelayPercentage: 100, Delay: time.Millisecond}},
+	})
+
+	// Faults of removed services are dropped, those of new services added
+	assert.Contains(t, injector.Faults(), "orders")
+	assert.NotContains(t, injector.Faults(), "billing")
+	assert.Contains(t, injector.Faults(), "payments")
+	_, err = injector.Set("billing", config.FaultConfig{ErrorPercentage: 100}, 0)
+	assert.ErrorIs(t, err, faults.ErrUnknownService)
+}
@@ -0,0 +1,144 @@
+package flags
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/flags"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func percent(p int) *int { return &p }
+
+func newFlags(t *testing.T, cfg config.FeatureFlagsConfig) *flags.Flags {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	f, err := flags.New(cfg, logger)
+	require.NoError(t, err)
+	t.Cleanup(f.Stop)
+	return f
+}
+
+// request returns an echo context for a request from ip with the headers
+// and JWT claims given
+func request(ip string, headers map[string]string, claims map[string]interface{}) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ip + ":1234"
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if claims != nil {
+		c.Set("user", claims)
+	}
+	return c
+}
+
+func TestFlagRules(t *testing.T) {
+	f := newFlags(t, config.FeatureFlagsConfig{Flags: map[string]config.FeatureFlagConfig{
+		"new-checkout": {
+			Default: false,
+			Rules: []config.FlagRuleConfig{
+				{Header: "X-Beta", Values: []string{"1"}, Value: true},
+				{Claim: "roles", Values: []string{"staff"}, Value: true},
+				{Claim: "plan", Values: []string{"free"}, Value: false},
+				{Claim: "sub", Percentage: percent(50), Value: true},
+			},
+		},
+		"canary-weight": {Default: 5, Rules: []config.FlagRuleConfig{
+			{Header: "X-Region", Values: []string{"eu"}, Value: 50},
+		}},
+	}})
+
+	assert.False(t, f.Bool(request("192.0.2.1", nil, nil), "new-checkout", true))
+	assert.True(t, f.Bool(request("192.0.2.1", map[string]string{"X-Beta": "1"}, nil), "new-checkout", false))
+	assert.True(t, f.Bool(request("192.0.2.1", nil, map[string]interface{}{"roles": []interface{}{"dev", "staff"}}), "new-checkout", false))
+	assert.False(t, f.Bool(request("192.0.2.1", nil, map[string]interface{}{"plan": "free", "roles": "dev"}), "new-checkout", true))
+
+	// Half of the users get the feature, always the same ones
+	on := 0
+	for i := 0; i < 1000; i++ {
+		c := request("192.0.2.1", nil, map[string]interface{}{"sub": i})
+		value := f.Bool(c, "new-checkout", false)
+		assert.Equal(t, value, f.Bool(c, "new-checkout", false))
+		if value {
+			on++
+		}
+	}
+	assert.InDelta(t, 500, on, 75)
+
+	assert.Equal(t, 5, f.Int(request("192.0.2.1", nil, nil), "canary-weight", 0))
+	assert.Equal(t, 50, f.Int(request("192.0.2.1", map[string]string{"X-Region": "eu"}, nil), "canary-weight", 0))
+	assert.Equal(t, 7, f.Int(request("192.0.2.1", nil, nil), "undefined", 7))
+	assert.True(t, f.Defined("new-checkout"))
+	assert.False(t, f.Defined("undefined"))
+}
+
+func TestFlagPercentageByClientIP(t *testing.T) {
+	f := newFlags(t, config.FeatureFlagsConfig{Flags: map[string]config.FeatureFlagConfig{
+		"all":  {Default: false, Rules: []config.FlagRuleConfig{{Percentage: percent(100), Value: true}}},
+		"none": {Default: false, Rules: []config.FlagRuleConfig{{Percentage: percent(0), Value: true}}},
+	}})
+	c := request("198.51.100.7", nil, nil)
+	assert.True(t, f.Bool(c, "all", false))
+	assert.False(t, f.Bool(c, "none", true))
+}
+
+func TestFlagGate(t *testing.T) {
+	f := newFlags(t, config.FeatureFlagsConfig{Flags: map[string]config.FeatureFlagConfig{
+		"beta-api": {Default: false, Rules: []config.FlagRuleConfig{{Header: "X-Beta", Value: true}}},
+	}})
+	e := echo.New()
+	e.GET("/beta", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, f.Gate("beta-api"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/beta", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/beta", nil)
+	req.Header.Set("X-Beta", "anything")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestFlagsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "flags.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("flags:\n  new-checkout:\n    default: true\n"), 0600))
+
+	f := newFlags(t, config.FeatureFlagsConfig{
+		File:         file,
+		PollInterval: 10 * time.Millisecond,
+		Flags: map[string]config.FeatureFlagConfig{
+			"new-checkout": {Default: false},
+			"search-v2":    {Default: true},
+		},
+	})
+	c := request("192.0.2.1", nil, nil)
+	assert.True(t, f.Bool(c, "new-checkout", false), "the file overrides the configuration")
+	assert.True(t, f.Bool(c, "search-v2", false))
+
+	f.Start()
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(file, []byte("flags:\n  new-checkout:\n    default: false\n"), 0600))
+	require.NoError(t, os.Chtimes(file, later, later))
+	require.Eventually(t, func() bool { return !f.Bool(c, "new-checkout", true) }, 2*time.Second, 10*time.Millisecond)
+
+	// Invalid files keep the current flags
+	later = later.Add(time.Minute)
+	require.NoError(t, os.WriteFile(file, []byte("flags:\n  new-checkout:\n    default: maybe\n"), 0600))
+	require.NoError(t, os.Chtimes(file, later, later))
+	_, err := f.Reload()
+	assert.Error(t, err)
+	assert.False(t, f.Bool(c, "new-checkout", true))
+}
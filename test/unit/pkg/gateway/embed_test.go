@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+	"odin/pkg/plugins"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagPlugin adds a header to the requests it sees
+type tagPlugin struct {
+	value string
+}
+
+func (p *tagPlugin) Name() string    { return "tag" }
+func (p *tagPlugin) Version() string { return "1.0.0" }
+func (p *tagPlugin) Initialize(config map[string]interface{}) error {
+	p.value, _ = config["value"].(string)
+	return nil
+}
+func (p *tagPlugin) PreRequest(_ context.Context, pluginCtx *plugins.PluginContext) error {
+	http.Header(pluginCtx.Headers).Set("X-Tag", p.value)
+	return nil
+}
+func (p *tagPlugin) PostRequest(context.Context, *plugins.PluginContext) error  { return nil }
+func (p *tagPlugin) PreResponse(context.Context, *plugins.PluginContext) error  { return nil }
+func (p *tagPlugin) PostResponse(context.Context, *plugins.PluginContext) error { return nil }
+func (p *tagPlugin) Cleanup() error                                             { return nil }
+
+func TestEmbeddedGateway(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Tag", r.Header.Get("X-Tag"))
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer backend.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	gw, err := gateway.New(
+		gateway.WithConfig(&config.Config{
+			Logging: config.LoggingConfig{AccessLog: "off"},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Targets: []string{backend.URL}, StripBasePath: true},
+			},
+		}),
+		gateway.WithLogger(logger),
+		gateway.WithPlugin(&tagPlugin{}, map[string]interface{}{"value": "embedded"}, plugins.PreRequestHook),
+	)
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/42", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/42", rec.Body.String())
+	assert.Equal(t, "embedded", rec.Header().Get("X-Seen-Tag"))
+}
+
+func TestEmbeddedGatewayValidatesConfig(t *testing.T) {
+	_, err := gateway.New(gateway.WithConfig(&config.Config{
+		Server: config.ServerConfig{Port: 70000},
+	}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/admin"
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+	"odin/pkg/mongodb"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceRepository keeps services in memory and leaves everything else to
+// the repository of a disabled MongoDB
+type serviceRepository struct {
+	mongodb.Repository
+	mu       sync.Mutex
+	services []*mongodb.ServiceDocument
+}
+
+func newServiceRepository(t *testing.T) *serviceRepository {
+	repo, err := mongodb.NewRepository(&mongodb.Config{}, logrus.New())
+	require.NoError(t, err)
+	return &serviceRepository{Repository: repo}
+}
+
+// visible reports whether ctx is scoped to the namespace of doc, if at all
+func visible(ctx context.Context, doc *mongodb.ServiceDocument) bool {
+	namespace, ok := mongodb.NamespaceFromContext(ctx)
+	return !ok || doc.Namespace == namespace
+}
+
+func (r *serviceRepository) CreateService(ctx context.Context, service *mongodb.ServiceDocument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if namespace, ok := mongodb.NamespaceFromContext(ctx); ok {
+		service.Namespace = namespace
+	}
+	for _, doc := range r.services {
+		if doc.Namespace == service.Namespace && doc.Name == service.Name {
+			return fmt.Errorf("failed to create service: %w", mongodb.ErrDuplicate)
+		}
+	}
+	copied := *service
+	copied.ID = uuid.NewString()
+	r.services = append(r.services, &copied)
+	return nil
+}
+
+func (r *serviceRepository) GetService(ctx context.Context, id string) (*mongodb.ServiceDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, doc := range r.services {
+		if doc.ID == id && visible(ctx, doc) {
+			copied := *doc
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("service not found: %s", id)
+}
+
+func (r *serviceRepository) GetServiceByName(ctx context.Context, name string) (*mongodb.ServiceDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, doc := range r.services {
+		if doc.Name == name && visible(ctx, doc) {
+			copied := *doc
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("service not found: %s", name)
+}
+
+func (r *serviceRepository) ListServices(ctx context.Context, enabled *bool) ([]*mongodb.ServiceDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var services []*mongodb.ServiceDocument
+	for _, doc := range r.services {
+		if visible(ctx, doc) && (enabled == nil || doc.Enabled == *enabled) {
+			copied := *doc
+			services = append(services, &copied)
+		}
+	}
+	return services, nil
+}
+
+func (r *serviceRepository) UpdateService(ctx context.Context, id string, service *mongodb.ServiceDocument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if namespace, ok := mongodb.NamespaceFromContext(ctx); ok {
+		service.Namespace = namespace
+	}
+	for i, doc := range r.services {
+		if doc.ID == id && visible(ctx, doc) {
+			copied := *service
+			copied.ID = id
+			r.services[i] = &copied
+			return nil
+		}
+	}
+	return fmt.Errorf("service not found: %s", id)
+}
+
+func (r *serviceRepository) DeleteService(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, doc := range r.services {
+		if doc.ID == id && visible(ctx, doc) {
+			r.services = append(r.services[:i], r.services[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("service not found: %s", id)
+}
+
+func TestNamespaceAdminsManageTheirServices(t *testing.T) {
+	t.Chdir(t.TempDir()) // The gateway creates the admin templates directory
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{AccessLog: "off"},
+		Admin: config.AdminConfig{
+			Enabled:   true,
+			Username:  "root",
+			Password:  "root-pass",
+			BasicAuth: true,
+			Namespaces: []config.AdminNamespaceConfig{
+				{Name: "payments", Username: "payments-admin", Password: "payments-pass"},
+				{Name: "search", Username: "search-admin", Password: "search-pass"},
+			},
+		},
+	}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger), gateway.WithStore(newServiceRepository(t)))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	do := func(method, path, username, password, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(username, password)
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(username, password string) []admin.ServiceResponse {
+		rec := do(http.MethodGet, "/admin/api/mongodb/services", username, password, "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var services []admin.ServiceResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &services))
+		return services
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/api/mongodb/services", "payments-admin", "wrong", "").Code)
+
+	rec := do(http.MethodPost, "/admin/api/mongodb/services", "payments-admin", "payments-pass",
+		`{"name":"orders","basePath":"/payments/orders","targets":["http://orders:8080"],"timeout":"10s","retryDelay":"1s"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	services := list("payments-admin", "payments-pass")
+	require.Len(t, services, 1)
+	assert.Equal(t, "payments", services[0].Namespace)
+	// Other namespaces do not see the service, the gateway administrator does
+	assert.Empty(t, list("search-admin", "search-pass"))
+	assert.Len(t, list("root", "root-pass"), 1)
+
+	// Nor can they delete it
+	assert.NotEqual(t, http.StatusOK, do(http.MethodDelete, "/admin/api/mongodb/services/orders", "search-admin", "search-pass", "").Code)
+	assert.Len(t, list("payments-admin", "payments-pass"), 1)
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	backend := namedBackend("orders")
+	defer backend.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	gw, err := gateway.New(
+		gateway.WithConfig(&config.Config{
+			Logging:   config.LoggingConfig{AccessLog: "off"},
+			RateLimit: config.RateLimitConfig{Enabled: true, Limit: 2, Duration: time.Minute},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Targets: []string{backend.URL}, StripBasePath: true},
+			},
+		}),
+		gateway.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	rec := serve(gw, "/orders/1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, serve(gw, "/orders/2").Code)
+
+	rec = serve(gw, "/orders/3")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// The gateway's own endpoints are not limited
+	assert.Equal(t, http.StatusOK, serve(gw, "/health").Code)
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func namedBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + r.URL.Path))
+	}))
+}
+
+func serve(gw *gateway.Gateway, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestReloadRoutesChangedServices(t *testing.T) {
+	v1, v2, users := namedBackend("v1"), namedBackend("v2"), namedBackend("users")
+	defer v1.Close()
+	defer v2.Close()
+	defer users.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{AccessLog: "off"},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{v1.URL}, StripBasePath: true},
+		},
+	}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+	assert.Equal(t, "v1 /42", serve(gw, "/orders/42").Body.String())
+
+	// Change a service and add another
+	next, err := cfg.Clone()
+	require.NoError(t, err)
+	next.Services[0].Targets = []string{v2.URL}
+	next.Services = append(next.Services, config.ServiceConfig{
+		Name: "users", BasePath: "/users", Targets: []string{users.URL}, StripBasePath: true,
+	})
+	report, err := gw.Reload(next)
+	require.NoError(t, err)
+	assert.Contains(t, report.Applied, "services")
+	assert.NotContains(t, report.RequiresRestart, "services")
+	assert.Equal(t, "v2 /42", serve(gw, "/orders/42").Body.String())
+	assert.Equal(t, "users /7", serve(gw, "/users/7").Body.String())
+
+	// Remove a service
+	next, err = next.Clone()
+	require.NoError(t, err)
+	next.Services = next.Services[1:]
+	report, err = gw.Reload(next)
+	require.NoError(t, err)
+	assert.Contains(t, report.Applied, "services")
+	assert.Equal(t, http.StatusNotFound, serve(gw, "/orders/42").Code)
+	assert.Equal(t, "users /7", serve(gw, "/users/7").Body.String())
+
+	// Unchanged services are left alone
+	next, err = next.Clone()
+	require.NoError(t, err)
+	report, err = gw.Reload(next)
+	require.NoError(t, err)
+	assert.NotContains(t, report.Applied, "services")
+}
+
+func TestReloadKeepsRoutesOnInvalidServices(t *testing.T) {
+	backend := namedBackend("orders")
+	defer backend.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{AccessLog: "off"},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{backend.URL}, StripBasePath: true},
+		},
+	}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	next, err := cfg.Clone()
+	require.NoError(t, err)
+	next.Services[0].Match = "request.method =="
+	_, err = gw.Reload(next)
+	assert.Error(t, err)
+	assert.Equal(t, "orders /42", serve(gw, "/orders/42").Body.String())
+}
+
+func TestReloadFinishesRequestsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+	fast := namedBackend("fast")
+	defer fast.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{AccessLog: "off"},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{slow.URL}, Timeout: 5 * time.Second},
+		},
+	}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(gw, "/orders/1") }()
+	<-started
+
+	next, err := cfg.Clone()
+	require.NoError(t, err)
+	next.Services[0].Targets = []string{fast.URL}
+	_, err = gw.Reload(next)
+	require.NoError(t, err)
+	assert.Equal(t, "fast /orders/2", serve(gw, "/orders/2").Body.String())
+
+	close(release)
+	rec := <-done
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "slow", rec.Body.String())
+}
+
+func TestReloadReportsSectionsNeedingRestart(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{Logging: config.LoggingConfig{AccessLog: "off"}}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	next, err := cfg.Clone()
+	require.NoError(t, err)
+	next.Events.QueueSize = 50
+	next.Bot.ThrottleRPM = 10
+	next.Backup.MaxCount = 3
+	next.FeatureFlags.PollInterval = time.Minute
+	report, err := gw.Reload(next)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"events", "bot", "backup", "featureFlags.pollInterval"}, report.RequiresRestart)
+	assert.Empty(t, report.Applied)
+}
@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newShutdownGateway(t *testing.T, backend string) *gateway.Gateway {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	gw, err := gateway.New(
+		gateway.WithConfig(&config.Config{
+			Logging:   config.LoggingConfig{AccessLog: "off"},
+			WebSocket: config.WebSocketConfig{Enabled: true},
+			Services: []config.ServiceConfig{
+				{Name: "orders", BasePath: "/orders", Targets: []string{backend}, StripBasePath: true},
+			},
+		}),
+		gateway.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	return gw
+}
+
+func serveInBackground(gw *gateway.Gateway, path string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		done <- rec
+	}()
+	return done
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+	gw := newShutdownGateway(t, backend.URL)
+
+	done := serveInBackground(gw, "/orders/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, gw.Shutdown(ctx))
+
+	// Shutdown returned only after the request finished
+	select {
+	case rec := <-done:
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "done", rec.Body.String())
+	default:
+		t.Fatal("request still in flight after shutdown")
+	}
+
+	// New requests are refused
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/late", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "close", rec.Header().Get("Connection"))
+}
+
+func TestShutdownClosesRequestsAfterTimeout(t *testing.T) {
+	started := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+	gw := newShutdownGateway(t, backend.URL)
+
+	done := serveInBackground(gw, "/orders/stuck")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := gw.Shutdown(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	select {
+	case rec := <-done:
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request was not closed")
+	}
+}
+
+func TestShutdownClosesWebSockets(t *testing.T) {
+	upgrader := gws.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+	gw := newShutdownGateway(t, backend.URL)
+
+	server := httptest.NewServer(gw)
+	defer server.Close()
+	conn, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/orders/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, gw.Shutdown(ctx))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *gws.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, gws.CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "server shutting down", closeErr.Text)
+}
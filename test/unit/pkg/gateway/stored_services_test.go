@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredServicesRoutedLive(t *testing.T) {
+	orders, users, users2 := namedBackend("orders"), namedBackend("users"), namedBackend("users2")
+	defer orders.Close()
+	defer users.Close()
+	defer users2.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	cfg := &config.Config{
+		Logging: config.LoggingConfig{AccessLog: "off"},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{orders.URL}, StripBasePath: true},
+		},
+	}
+	gw, err := gateway.New(gateway.WithConfig(cfg), gateway.WithLogger(logger))
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	stored := config.ServiceConfig{Name: "users", BasePath: "/users", Targets: []string{users.URL}, StripBasePath: true}
+	require.NoError(t, gw.SetStoredServices([]config.ServiceConfig{stored}))
+	assert.Equal(t, "users /7", serve(gw, "/users/7").Body.String())
+	assert.Equal(t, "orders /42", serve(gw, "/orders/42").Body.String())
+
+	// Services clashing with the configured ones, or invalid ones, are refused
+	assert.Error(t, gw.SetStoredServices([]config.ServiceConfig{stored, {Name: "orders", BasePath: "/o", Targets: []string{orders.URL}}}))
+	assert.Error(t, gw.SetStoredServices([]config.ServiceConfig{stored, {Name: "carts", BasePath: "/orders", Targets: []string{orders.URL}}}))
+	assert.Error(t, gw.SetStoredServices([]config.ServiceConfig{{Name: "users", BasePath: "/users"}}))
+	assert.Equal(t, "users /7", serve(gw, "/users/7").Body.String())
+
+	stored.Targets = []string{users2.URL}
+	require.NoError(t, gw.SetStoredServices([]config.ServiceConfig{stored}))
+	assert.Equal(t, "users2 /7", serve(gw, "/users/7").Body.String())
+
+	// Reloading the configuration keeps the stored services routed
+	next, err := cfg.Clone()
+	require.NoError(t, err)
+	_, err = gw.Reload(next)
+	require.NoError(t, err)
+	assert.Equal(t, "users2 /7", serve(gw, "/users/7").Body.String())
+
+	require.NoError(t, gw.SetStoredServices(nil))
+	assert.Equal(t, http.StatusNotFound, serve(gw, "/users/7").Code)
+	assert.Equal(t, "orders /42", serve(gw, "/orders/42").Body.String())
+}
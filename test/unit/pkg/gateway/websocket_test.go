@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gateway"
+
+	gws "github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketService(t *testing.T) {
+	upgrader := gws.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			kind, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(kind, append([]byte(r.URL.Path+" "), message...))
+		}
+	}))
+	defer backend.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	gw, err := gateway.New(
+		gateway.WithConfig(&config.Config{
+			Logging: config.LoggingConfig{AccessLog: "off"},
+			Services: []config.ServiceConfig{{
+				Name:          "chat",
+				BasePath:      "/chat",
+				Targets:       []string{backend.URL},
+				StripBasePath: true,
+				Protocol:      "websocket",
+				WebSocket:     &config.ServiceWebSocketConfig{MaxConnections: 1},
+			}},
+		}),
+		gateway.WithLogger(logger),
+	)
+	require.NoError(t, err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Shutdown(ctx)
+	}()
+
+	server := httptest.NewServer(gw)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/chat/rooms/1"
+
+	// Messages are relayed without websocket.enabled
+	conn, _, err := gws.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(gws.TextMessage, []byte("hello")))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "/rooms/1 hello", string(message))
+
+	// The service's connection limit applies
+	_, resp, err := gws.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// Plain requests are refused
+	rec := httptest.NewRecorder()
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chat/rooms/1", nil))
+	assert.Equal(t, http.StatusUpgradeRequired, rec.Code)
+	assert.Equal(t, "websocket", rec.Header().Get("Upgrade"))
+}
@@ -0,0 +1,284 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/geoip"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbWriter builds small MaxMind DB files. Strings used more than once are
+// written once and pointed to afterwards, as real databases do.
+type mmdbWriter struct {
+	data    bytes.Buffer
+	strings map[string]int
+}
+
+type uint16Value uint16
+type uint32Value uint32
+
+// control writes the type and size of a value; sizes up to 284 are enough
+// for these tests
+func (w *mmdbWriter) control(b *bytes.Buffer, kind, size int) {
+	sizeBits := min(size, 29)
+	if kind < 8 {
+		b.WriteByte(byte(kind<<5 | sizeBits))
+	} else {
+		b.WriteByte(byte(sizeBits))
+		b.WriteByte(byte(kind - 7))
+	}
+	if size >= 29 {
+		b.WriteByte(byte(size - 29))
+	}
+}
+
+func (w *mmdbWriter) encode(b *bytes.Buffer, v any, shared bool) {
+	switch v := v.(type) {
+	case string:
+		if shared {
+			if offset, ok := w.strings[v]; ok {
+				b.WriteByte(byte(1<<5 | offset>>8))
+				b.WriteByte(byte(offset))
+				return
+			}
+			w.strings[v] = b.Len()
+		}
+		w.control(b, 2, len(v))
+		b.WriteString(v)
+	case float64:
+		w.control(b, 3, 8)
+		binary.Write(b, binary.BigEndian, math.Float64bits(v))
+	case uint16Value:
+		w.control(b, 5, 2)
+		binary.Write(b, binary.BigEndian, uint16(v))
+	case uint32Value:
+		w.control(b, 6, 4)
+		binary.Write(b, binary.BigEndian, uint32(v))
+	case map[string]any:
+		w.control(b, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			w.encode(b, k, shared)
+			w.encode(b, v[k], shared)
+		}
+	case []any:
+		w.control(b, 11, len(v))
+		for _, item := range v {
+			w.encode(b, item, shared)
+		}
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		w.control(b, 14, size)
+	}
+}
+
+// buildMMDB writes a database with 24-bit records mapping networks to
+// records. IPv4 networks go under ::/96 in IPv6 databases.
+func buildMMDB(ipVersion int, networks map[string]map[string]any) []byte {
+	w := &mmdbWriter{strings: make(map[string]int)}
+	type child struct {
+		node   int // -1 when the child is not a node
+		record int // -1 when the child is not a record
+	}
+	nodes := [][2]child{{{-1, -1}, {-1, -1}}}
+
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := []byte(network.IP)
+		if ipVersion == 6 && len(ip) == 4 {
+			ip = append(make([]byte, 12), ip...)
+			ones += 96
+		}
+
+		offset := w.data.Len()
+		w.encode(&w.data, networks[cidr], true)
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == ones-1 {
+				nodes[node][bit] = child{node: -1, record: offset}
+				break
+			}
+			if nodes[node][bit].node < 0 {
+				nodes = append(nodes, [2]child{{-1, -1}, {-1, -1}})
+				nodes[node][bit] = child{node: len(nodes) - 1, record: -1}
+			}
+			node = nodes[node][bit].node
+		}
+	}
+
+	var file bytes.Buffer
+	count := len(nodes)
+	for _, n := range nodes {
+		for _, c := range n {
+			value := count // No data
+			switch {
+			case c.node >= 0:
+				value = c.node
+			case c.record >= 0:
+				value = count + 16 + c.record
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(w.data.Bytes())
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	w.encode(&file, map[string]any{
+		"node_count":                  uint32Value(count),
+		"record_size":                 uint16Value(24),
+		"ip_version":                  uint16Value(ipVersion),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16Value(2),
+		"binary_format_minor_version": uint16Value(0),
+		"languages":                   []any{"en"},
+	}, false)
+	return file.Bytes()
+}
+
+func cityRecord(country, region, city string) map[string]any {
+	return map[string]any{
+		"country":      map[string]any{"iso_code": country, "names": map[string]any{"en": country}},
+		"subdivisions": []any{map[string]any{"iso_code": region}},
+		"city":         map[string]any{"names": map[string]any{"en": city}},
+		"location":     map[string]any{"latitude": 52.52, "longitude": 13.4},
+		"is_eu":        true,
+	}
+}
+
+var cityNetworks = map[string]map[string]any{
+	"81.2.69.0/24":  cityRecord("GB", "ENG", "London"),
+	"89.160.0.0/16": cityRecord("SE", "E", "Linköping"),
+	"2001:db8::/32": cityRecord("DE", "BE", "Berlin"),
+}
+
+func TestReader(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		networks := cityNetworks
+		if ipVersion == 4 {
+			networks = map[string]map[string]any{"81.2.69.0/24": cityNetworks["81.2.69.0/24"], "89.160.0.0/16": cityNetworks["89.160.0.0/16"]}
+		}
+		reader, err := geoip.NewReader(buildMMDB(ipVersion, networks))
+		require.NoError(t, err)
+		assert.Equal(t, "Test-City", reader.DatabaseType())
+
+		record, err := reader.Lookup(net.ParseIP("81.2.69.142"))
+		require.NoError(t, err)
+		assert.Equal(t, "GB", record["country"].(map[string]any)["iso_code"])
+		assert.Equal(t, 52.52, record["location"].(map[string]any)["latitude"])
+		assert.Equal(t, true, record["is_eu"])
+
+		record, err = reader.Lookup(net.ParseIP("89.160.20.1"))
+		require.NoError(t, err)
+		assert.Equal(t, "Linköping", record["city"].(map[string]any)["names"].(map[string]any)["en"])
+
+		record, err = reader.Lookup(net.ParseIP("10.0.0.1"))
+		assert.NoError(t, err)
+		assert.Nil(t, record)
+
+		if ipVersion == 6 {
+			record, err = reader.Lookup(net.ParseIP("2001:db8::1"))
+			require.NoError(t, err)
+			assert.Equal(t, "DE", record["country"].(map[string]any)["iso_code"])
+		} else {
+			_, err = reader.Lookup(net.ParseIP("2001:db8::1"))
+			assert.Error(t, err)
+		}
+	}
+
+	_, err := geoip.NewReader([]byte("not a database"))
+	assert.Error(t, err)
+}
+
+func writeDatabases(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	asn := filepath.Join(dir, "asn.mmdb")
+	require.NoError(t, os.WriteFile(city, buildMMDB(6, cityNetworks), 0o644))
+	require.NoError(t, os.WriteFile(asn, buildMMDB(6, map[string]map[string]any{
+		"81.2.69.0/24": {"autonomous_system_number": uint32Value(20712), "autonomous_system_organization": "Andrews & Arnold Ltd"},
+	}), 0o644))
+	return city, asn
+}
+
+func TestLocator(t *testing.T) {
+	city, asn := writeDatabases(t)
+	locator, err := geoip.New(config.GeoIPConfig{Enabled: true, Database: city, ASNDatabase: asn})
+	require.NoError(t, err)
+
+	loc, found := locator.Lookup(net.ParseIP("81.2.69.142"))
+	assert.True(t, found)
+	assert.Equal(t, geoip.Location{Country: "GB", Region: "ENG", City: "London", ASN: 20712, ASNOrg: "Andrews & Arnold Ltd"}, loc)
+
+	// Cached records give the same answer
+	loc, _ = locator.Lookup(net.ParseIP("81.2.69.1"))
+	assert.Equal(t, "London", loc.City)
+
+	loc, found = locator.Lookup(net.ParseIP("89.160.1.1"))
+	assert.True(t, found)
+	assert.Equal(t, uint(0), loc.ASN)
+
+	_, found = locator.Lookup(net.ParseIP("192.0.2.1"))
+	assert.False(t, found)
+
+	_, err = geoip.New(config.GeoIPConfig{Enabled: true, Database: filepath.Join(t.TempDir(), "missing.mmdb")})
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	city, asn := writeDatabases(t)
+	locator, err := geoip.New(config.GeoIPConfig{Enabled: true, Database: city, ASNDatabase: asn, MetricLabels: []string{"country", "asn"}})
+	require.NoError(t, err)
+
+	var got http.Header
+	handler := locator.Middleware()(func(c echo.Context) error {
+		got = c.Request().Header.Clone()
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.RemoteAddr = "81.2.69.142:51000"
+	req.Header.Set("X-Geo-Country", "US") // Clients cannot claim a location
+	require.NoError(t, handler(echo.New().NewContext(req, httptest.NewRecorder())))
+	assert.Equal(t, "GB", got.Get(geoip.HeaderCountry))
+	assert.Equal(t, "ENG", got.Get(geoip.HeaderRegion))
+	assert.Equal(t, "London", got.Get(geoip.HeaderCity))
+	assert.Equal(t, "20712", got.Get(geoip.HeaderASN))
+	assert.Equal(t, "Andrews & Arnold Ltd", got.Get(geoip.HeaderASNOrg))
+
+	req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.RemoteAddr = "192.0.2.1:51000"
+	req.Header.Set("X-Geo-Country", "US")
+	require.NoError(t, handler(echo.New().NewContext(req, httptest.NewRecorder())))
+	assert.Empty(t, got.Get(geoip.HeaderCountry))
+}
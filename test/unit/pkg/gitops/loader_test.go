@@ -0,0 +1,110 @@
+package gitops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/gitops"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func baseConfig() *config.Config {
+	return &config.Config{
+		Server: config.ServerConfig{Port: 8080, Timeout: 30 * time.Second},
+		Logging: config.LoggingConfig{
+			Level: "info",
+		},
+		GitOps: config.GitOpsConfig{
+			Enabled:    true,
+			Repository: "https://example.com/config.git",
+			Branch:     "main",
+		},
+		Services: []config.ServiceConfig{
+			{Name: "legacy", BasePath: "/legacy", Targets: []string{"http://legacy:8080"}},
+		},
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "settings.yaml", "logging:\n  level: debug\n")
+	writeFile(t, dir, "services/users.yaml", "name: users\nbasePath: /api/users\ntargets:\n  - http://users:8081\n")
+	writeFile(t, dir, "services/orders.yaml", "services:\n  - name: orders\n    basePath: /api/orders\n    targets:\n      - http://orders:8082\n")
+
+	base := baseConfig()
+	cfg, files, err := gitops.LoadDirectory(dir, base)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"settings.yaml", "services/orders.yaml", "services/users.yaml"}, files)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	require.Len(t, cfg.Services, 2)
+	assert.Equal(t, "orders", cfg.Services[0].Name)
+	assert.Equal(t, "users", cfg.Services[1].Name)
+
+	// The base configuration is left untouched
+	assert.Equal(t, "info", base.Logging.Level)
+	assert.Equal(t, "legacy", base.Services[0].Name)
+}
+
+func TestLoadDirectoryKeepsServicesWithoutServiceFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "settings.yaml", "logging:\n  level: warn\n")
+
+	cfg, _, err := gitops.LoadDirectory(dir, baseConfig())
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Services, 1)
+	assert.Equal(t, "legacy", cfg.Services[0].Name)
+}
+
+func TestLoadDirectoryIgnoresGitOpsSettings(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "settings.yaml", "gitops:\n  repository: https://evil.example.com/repo.git\n")
+
+	cfg, _, err := gitops.LoadDirectory(dir, baseConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://example.com/config.git", cfg.GitOps.Repository)
+}
+
+func TestLoadDirectoryRejectsDuplicateServices(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "services.yaml", "services:\n  - name: users\n    basePath: /a\n    targets: [\"http://a\"]\n")
+	writeFile(t, dir, "services/users.yaml", "name: users\nbasePath: /b\ntargets: [\"http://b\"]\n")
+
+	_, _, err := gitops.LoadDirectory(dir, baseConfig())
+	assert.Error(t, err)
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	syncer := gitops.NewSyncer(config.GitOpsConfig{WebhookSecret: "s3cret"}, baseConfig, nil, nil, logrus.New())
+
+	payload := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, syncer.VerifySignature(payload, signature))
+	assert.False(t, syncer.VerifySignature([]byte("tampered"), signature))
+	assert.False(t, syncer.VerifySignature(payload, "sha256=zz"))
+
+	assert.True(t, syncer.VerifyToken("s3cret"))
+	assert.False(t, syncer.VerifyToken("wrong"))
+}
@@ -0,0 +1,277 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"odin/pkg/graphql"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// typeRef describes a type written as in GraphQL, e.g. [Order!]!
+func typeRef(typ string) map[string]interface{} {
+	if strings.HasSuffix(typ, "!") {
+		return map[string]interface{}{"kind": "NON_NULL", "name": nil, "ofType": typeRef(strings.TrimSuffix(typ, "!"))}
+	}
+	if strings.HasPrefix(typ, "[") {
+		return map[string]interface{}{"kind": "LIST", "name": nil, "ofType": typeRef(typ[1 : len(typ)-1])}
+	}
+	kind := "OBJECT"
+	switch typ {
+	case "ID", "String", "Int", "Boolean":
+		kind = "SCALAR"
+	}
+	return map[string]interface{}{"kind": kind, "name": typ, "ofType": nil}
+}
+
+// introspection describes object types whose fields are written as
+// "name(arg: Type)": "Type"
+func introspection(types map[string]map[string]string) map[string]interface{} {
+	var list []interface{}
+	for _, scalar := range []string{"ID", "String", "Int", "Boolean"} {
+		list = append(list, map[string]interface{}{"kind": "SCALAR", "name": scalar})
+	}
+	for name, fields := range types {
+		var fieldList []interface{}
+		for signature, typ := range fields {
+			fieldName, args := signature, []interface{}{}
+			if i := strings.Index(signature, "("); i >= 0 {
+				fieldName = signature[:i]
+				for _, arg := range strings.Split(strings.Trim(signature[i:], "()"), ",") {
+					parts := strings.SplitN(arg, ":", 2)
+					args = append(args, map[string]interface{}{"name": strings.TrimSpace(parts[0]), "type": typeRef(strings.TrimSpace(parts[1]))})
+				}
+			}
+			fieldList = append(fieldList, map[string]interface{}{"name": fieldName, "args": args, "type": typeRef(typ), "isDeprecated": false})
+		}
+		list = append(list, map[string]interface{}{"kind": "OBJECT", "name": name, "fields": fieldList, "interfaces": []interface{}{}})
+	}
+	schema := map[string]interface{}{"queryType": map[string]interface{}{"name": "Query"}, "types": list, "directives": []interface{}{}}
+	if _, ok := types["Mutation"]; ok {
+		schema["mutationType"] = map[string]interface{}{"name": "Mutation"}
+	}
+	return map[string]interface{}{"__schema": schema}
+}
+
+// subgraph serves a schema and answers other requests with resolve,
+// recording them
+type subgraph struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []graphql.GraphQLRequest
+}
+
+func newSubgraph(t *testing.T, types map[string]map[string]string, resolve func(req graphql.GraphQLRequest) map[string]interface{}) *subgraph {
+	s := &subgraph{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphql.GraphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		data := introspection(types)
+		if !strings.Contains(req.Query, "__schema") {
+			s.mu.Lock()
+			s.requests = append(s.requests, req)
+			s.mu.Unlock()
+			data = resolve(req)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *subgraph) recorded() []graphql.GraphQLRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]graphql.GraphQLRequest(nil), s.requests...)
+}
+
+var userNames = map[string]string{"u1": "Ada", "u2": "Grace"}
+
+// newUsers serves users, answering me and the user queries of batches
+func newUsers(t *testing.T) *subgraph {
+	return newSubgraph(t, map[string]map[string]string{
+		"Query": {"me": "User", "user(id: ID!)": "User"},
+		"User":  {"id": "ID!", "name": "String"},
+	}, func(req graphql.GraphQLRequest) map[string]interface{} {
+		if strings.Contains(req.Query, "{me ") {
+			return map[string]interface{}{"me": map[string]interface{}{"name": "Ada"}}
+		}
+		data := make(map[string]interface{})
+		for variable, id := range req.Variables {
+			alias := variable[:strings.LastIndex(variable, "_")]
+			data[alias] = map[string]interface{}{"id": id, "name": userNames[id.(string)]}
+		}
+		return data
+	})
+}
+
+// newOrders serves orders of customers u1, u2, u1 and nobody
+func newOrders(t *testing.T) *subgraph {
+	return newSubgraph(t, map[string]map[string]string{
+		"Query":    {"orders": "[Order]"},
+		"Mutation": {"placeOrder(total: Int!)": "Order"},
+		"Order":    {"id": "ID!", "customerId": "ID", "total": "Int"},
+	}, func(req graphql.GraphQLRequest) map[string]interface{} {
+		if strings.HasPrefix(req.Query, "mutation") {
+			return map[string]interface{}{"placeOrder": map[string]interface{}{"id": "5"}}
+		}
+		var orders []interface{}
+		for i, customer := range []interface{}{"u1", "u2", "u1", nil} {
+			order := map[string]interface{}{"id": string(rune('1' + i))}
+			if strings.Contains(req.Query, "_odin_Order_customerId: customerId") {
+				order["_odin_Order_customerId"] = customer
+			}
+			orders = append(orders, order)
+		}
+		return map[string]interface{}{"orders": orders}
+	})
+}
+
+func newFederation(t *testing.T, subgraphs []graphql.Subgraph, links ...graphql.Link) *echo.Echo {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	proxy := graphql.NewProxy(&graphql.ProxyConfig{
+		EnableIntrospection: true,
+		Federation:          &graphql.FederationConfig{Subgraphs: subgraphs, Links: links},
+	}, logger)
+	e := echo.New()
+	proxy.RegisterRoutes(e, "/graphql")
+	return e
+}
+
+var customerLink = graphql.Link{Type: "Order", Field: "customer", Subgraph: "users", Query: "user", Arguments: map[string]string{"id": "customerId"}}
+
+func query(t *testing.T, e *echo.Echo, body map[string]interface{}) (int, map[string]interface{}) {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), rec.Body.String())
+	return rec.Code, resp
+}
+
+func TestFederationRoutesRootFields(t *testing.T) {
+	users, orders := newUsers(t), newOrders(t)
+	e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "orders", URL: orders.URL}})
+
+	code, resp := query(t, e, map[string]interface{}{
+		"query":     `query Dashboard($verbose: Boolean = false) { me { ...Name } orders @include(if: $verbose) { id } } fragment Name on User { name }`,
+		"variables": map[string]interface{}{"verbose": true},
+	})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, map[string]interface{}{"name": "Ada"}, resp["data"].(map[string]interface{})["me"])
+	assert.Len(t, resp["data"].(map[string]interface{})["orders"], 4)
+
+	require.Len(t, users.recorded(), 1)
+	assert.Equal(t, "query Dashboard {me {... on User {name}}}", users.recorded()[0].Query)
+	require.Len(t, orders.recorded(), 1)
+	assert.Equal(t, "query Dashboard($verbose: Boolean = false) {orders @include(if: $verbose) {id}}", orders.recorded()[0].Query)
+	assert.Equal(t, map[string]interface{}{"verbose": true}, orders.recorded()[0].Variables)
+
+	t.Run("mutations", func(t *testing.T) {
+		code, resp := query(t, e, map[string]interface{}{"query": `mutation { placeOrder(total: 3) { id } }`})
+		require.Equal(t, http.StatusOK, code, resp)
+		assert.Equal(t, map[string]interface{}{"placeOrder": map[string]interface{}{"id": "5"}}, resp["data"])
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		code, resp := query(t, e, map[string]interface{}{"query": `{ invoices { id } }`})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, resp["errors"].([]interface{})[0].(map[string]interface{})["message"], "invoices")
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		code, _ := query(t, e, map[string]interface{}{"query": `{ me { name }`})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestFederationResolvesLinksInBatches(t *testing.T) {
+	users, orders := newUsers(t), newOrders(t)
+	e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "orders", URL: orders.URL}}, customerLink)
+
+	code, resp := query(t, e, map[string]interface{}{"query": `{ orders { id customer { name } } }`})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, map[string]interface{}{"orders": []interface{}{
+		map[string]interface{}{"id": "1", "customer": map[string]interface{}{"id": "u1", "name": "Ada"}},
+		map[string]interface{}{"id": "2", "customer": map[string]interface{}{"id": "u2", "name": "Grace"}},
+		map[string]interface{}{"id": "3", "customer": map[string]interface{}{"id": "u1", "name": "Ada"}},
+		map[string]interface{}{"id": "4", "customer": nil},
+	}}, resp["data"])
+
+	// One request for all customers, asking for each of them once
+	require.Len(t, users.recorded(), 1)
+	batch := users.recorded()[0]
+	assert.Equal(t, "query($_0_id: ID!, $_1_id: ID!) {_0: user(id: $_0_id) {name} _1: user(id: $_1_id) {name}}", batch.Query)
+	assert.Equal(t, map[string]interface{}{"_0_id": "u1", "_1_id": "u2"}, batch.Variables)
+}
+
+func TestFederationIntrospection(t *testing.T) {
+	users, orders := newUsers(t), newOrders(t)
+	e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "orders", URL: orders.URL}}, customerLink)
+
+	code, resp := query(t, e, map[string]interface{}{"query": `{
+		__schema { queryType { name } mutationType { name } }
+		order: __type(name: "Order") { __typename name fields { name type { name } } }
+	}`})
+	require.Equal(t, http.StatusOK, code, resp)
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"queryType":    map[string]interface{}{"name": "Query"},
+		"mutationType": map[string]interface{}{"name": "Mutation"},
+	}, data["__schema"])
+
+	order := data["order"].(map[string]interface{})
+	assert.Equal(t, "__Type", order["__typename"])
+	assert.Contains(t, order["fields"], map[string]interface{}{"name": "customer", "type": map[string]interface{}{"name": "User"}})
+
+	code, resp = query(t, e, map[string]interface{}{"query": `{ __type(name: "Query") { fields { name } } }`})
+	require.Equal(t, http.StatusOK, code, resp)
+	assert.ElementsMatch(t, []interface{}{
+		map[string]interface{}{"name": "me"},
+		map[string]interface{}{"name": "user"},
+		map[string]interface{}{"name": "orders"},
+	}, resp["data"].(map[string]interface{})["__type"].(map[string]interface{})["fields"])
+	assert.Empty(t, users.recorded())
+}
+
+func TestFederationErrors(t *testing.T) {
+	t.Run("unavailable subgraphs", func(t *testing.T) {
+		users, orders := newUsers(t), newOrders(t)
+		e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "orders", URL: orders.URL}})
+		query(t, e, map[string]interface{}{"query": `{ me { name } }`})
+		orders.Close()
+
+		code, resp := query(t, e, map[string]interface{}{"query": `{ me { name } orders { id } }`})
+		require.Equal(t, http.StatusOK, code, resp)
+		assert.Equal(t, map[string]interface{}{"me": map[string]interface{}{"name": "Ada"}, "orders": nil}, resp["data"])
+		assert.Contains(t, resp["errors"].([]interface{})[0].(map[string]interface{})["message"], "orders")
+	})
+
+	t.Run("conflicting root fields", func(t *testing.T) {
+		users, others := newUsers(t), newUsers(t)
+		e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "others", URL: others.URL}})
+		code, _ := query(t, e, map[string]interface{}{"query": `{ me { name } }`})
+		assert.Equal(t, http.StatusBadGateway, code)
+	})
+
+	t.Run("invalid links", func(t *testing.T) {
+		users, orders := newUsers(t), newOrders(t)
+		link := customerLink
+		link.Arguments = map[string]string{"id": "buyerId"}
+		e := newFederation(t, []graphql.Subgraph{{Name: "users", URL: users.URL}, {Name: "orders", URL: orders.URL}}, link)
+		code, _ := query(t, e, map[string]interface{}{"query": `{ orders { id } }`})
+		assert.Equal(t, http.StatusBadGateway, code)
+	})
+}
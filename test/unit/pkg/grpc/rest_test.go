@@ -0,0 +1,254 @@
+package grpc
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	odingrpc "odin/pkg/grpc"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   typ.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+// usersFile describes users.v1.UserService with GetUser and CreateUser, the
+// server-streaming ListUsers and the bidirectional Chat
+func usersFile() *descriptorpb.FileDescriptorProto {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("users.proto"),
+		Package: proto.String("users.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("GetUserRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, ""),
+				field("verbose", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+			}},
+			{Name: proto.String("User"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, ""),
+				field("display_name", 2, str, ""),
+				field("age", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			}},
+			{Name: proto.String("CreateUserRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("org", 1, str, ""),
+				field("user", 2, msg, ".users.v1.User"),
+			}},
+			{Name: proto.String("CreateUserResponse"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("user", 1, msg, ".users.v1.User"),
+			}},
+			{Name: proto.String("ListUsersRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("org", 1, str, ""),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("UserService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetUser"), InputType: proto.String(".users.v1.GetUserRequest"), OutputType: proto.String(".users.v1.User")},
+				{Name: proto.String("CreateUser"), InputType: proto.String(".users.v1.CreateUserRequest"), OutputType: proto.String(".users.v1.CreateUserResponse")},
+				{Name: proto.String("ListUsers"), InputType: proto.String(".users.v1.ListUsersRequest"), OutputType: proto.String(".users.v1.User"), ServerStreaming: proto.Bool(true)},
+				{Name: proto.String("Chat"), InputType: proto.String(".users.v1.User"), OutputType: proto.String(".users.v1.User"), ClientStreaming: proto.Bool(true), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+}
+
+func writeDescriptorSet(t *testing.T) string {
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{usersFile()}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "users.pb")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+// startUserService serves UserService with dynamic messages, and describes
+// it through server reflection
+func startUserService(t *testing.T, opts ...grpc.ServerOption) string {
+	file, err := protodesc.NewFile(usersFile(), nil)
+	require.NoError(t, err)
+	service := file.Services().ByName("UserService")
+	files := &protoregistry.Files{}
+	require.NoError(t, files.RegisterFile(file))
+
+	server := grpc.NewServer(append(opts, grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		fullMethod, _ := grpc.MethodFromServerStream(stream)
+		method := service.Methods().ByName(protoreflect.Name(fullMethod[strings.LastIndex(fullMethod, "/")+1:]))
+		if method == nil {
+			return status.Error(codes.Unimplemented, "unknown method")
+		}
+		if method.Name() == "Chat" {
+			return chat(stream, method)
+		}
+		req := dynamicpb.NewMessage(method.Input())
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		user := dynamicpb.NewMessage(file.Messages().ByName("User"))
+		fields := user.Descriptor().Fields()
+
+		switch method.Name() {
+		case "GetUser":
+			id := req.Get(method.Input().Fields().ByName("id")).String()
+			if id == "missing" {
+				return status.Error(codes.NotFound, "user not found")
+			}
+			name := "Ada"
+			if req.Get(method.Input().Fields().ByName("verbose")).Bool() {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				name += " (" + strings.Join(md.Get("x-tenant"), ",") + ")"
+			}
+			user.Set(fields.ByName("id"), protoreflect.ValueOfString(id))
+			user.Set(fields.ByName("display_name"), protoreflect.ValueOfString(name))
+			user.Set(fields.ByName("age"), protoreflect.ValueOfInt32(36))
+			return stream.SendMsg(user)
+		case "ListUsers":
+			return listUsers(stream, method, req)
+		default:
+			created := req.Get(method.Input().Fields().ByName("user")).Message()
+			user.Set(fields.ByName("id"), protoreflect.ValueOfString(req.Get(method.Input().Fields().ByName("org")).String()+"-1"))
+			user.Set(fields.ByName("display_name"), created.Get(fields.ByName("display_name")))
+			resp := dynamicpb.NewMessage(method.Output())
+			resp.Set(method.Output().Fields().ByName("user"), protoreflect.ValueOfMessage(user))
+			return stream.SendMsg(resp)
+		}
+	}))...)
+	reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{DescriptorResolver: files}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func newRESTProxy(t *testing.T, routes []odingrpc.RESTRoute) *echo.Echo {
+	return newProxy(t, &odingrpc.ProxyConfig{DescriptorSets: []string{writeDescriptorSet(t)}, Routes: routes})
+}
+
+// newProxy serves the proxy of a started UserService under /api
+func newProxy(t *testing.T, config *odingrpc.ProxyConfig) *echo.Echo {
+	_, e := startProxy(t, config)
+	return e
+}
+
+func startProxy(t *testing.T, config *odingrpc.ProxyConfig) (*odingrpc.Proxy, *echo.Echo) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	config.Target = startUserService(t)
+	config.Timeout = 5 * time.Second
+	proxy, err := odingrpc.NewProxy(config, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { proxy.Close() })
+
+	e := echo.New()
+	proxy.RegisterRoutes(e, "/api")
+	return proxy, e
+}
+
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRESTRoutes(t *testing.T) {
+	e := newRESTProxy(t, []odingrpc.RESTRoute{
+		{Method: "GET", Path: "/users/:id", RPC: "users.v1.UserService/GetUser"},
+		{Method: "POST", Path: "/orgs/:org/users", RPC: "users.v1.UserService/CreateUser", Body: "user", Response: "user"},
+	})
+
+	t.Run("path and query parameters", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/api/users/42?verbose=true&unknown=1", "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var user map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+		assert.Equal(t, map[string]interface{}{"id": "42", "displayName": "Ada (acme)", "age": float64(36)}, user)
+	})
+
+	t.Run("body field and response field", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/api/orgs/acme/users", `{"displayName": "Grace"}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var user map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+		assert.Equal(t, map[string]interface{}{"id": "acme-1", "displayName": "Grace"}, user)
+	})
+
+	t.Run("gRPC errors", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/api/users/missing", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), "user not found")
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/api/orgs/acme/users", `{"nickname": "G"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = serve(e, http.MethodGet, "/api/users/42?verbose=maybe", "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestRESTRouteErrors(t *testing.T) {
+	descriptors := writeDescriptorSet(t)
+	logger := logrus.New()
+
+	tests := []struct {
+		name  string
+		route odingrpc.RESTRoute
+		err   string
+	}{
+		{"unknown method", odingrpc.RESTRoute{Path: "/users", RPC: "users.v1.UserService/DeleteUser"}, "not found"},
+		{"unknown path parameter", odingrpc.RESTRoute{Path: "/users/:userId", RPC: "users.v1.UserService/GetUser"}, "no field userId"},
+		{"body is not a message", odingrpc.RESTRoute{Path: "/users", RPC: "users.v1.UserService/CreateUser", Body: "org"}, "not a message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := odingrpc.NewProxy(&odingrpc.ProxyConfig{
+				Target:         "127.0.0.1:1",
+				DescriptorSets: []string{descriptors},
+				Routes:         []odingrpc.RESTRoute{tt.route},
+			}, logger)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package grpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	odingrpc "odin/pkg/grpc"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// listUsers streams count users of an org. The org missing fails at once,
+// fail after the first user and slow blocks after it until the call ends.
+func listUsers(stream grpc.ServerStream, method protoreflect.MethodDescriptor, req *dynamicpb.Message) error {
+	org := req.Get(method.Input().Fields().ByName("org")).String()
+	count := int(req.Get(method.Input().Fields().ByName("count")).Int())
+	if org == "missing" {
+		return status.Error(codes.NotFound, "org not found")
+	}
+	fields := method.Output().Fields()
+	for i := 0; i < count; i++ {
+		user := dynamicpb.NewMessage(method.Output())
+		user.Set(fields.ByName("id"), protoreflect.ValueOfString(fmt.Sprintf("%s-%d", org, i)))
+		if err := stream.SendMsg(user); err != nil {
+			return err
+		}
+		switch org {
+		case "fail":
+			return status.Error(codes.Unavailable, "backend going away")
+		case "slow":
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		}
+	}
+	return nil
+}
+
+// chat greets every user it receives until the client is done
+func chat(stream grpc.ServerStream, method protoreflect.MethodDescriptor) error {
+	name := method.Input().Fields().ByName("display_name")
+	for {
+		user := dynamicpb.NewMessage(method.Input())
+		if err := stream.RecvMsg(user); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		user.Set(name, protoreflect.ValueOfString("Hi "+user.Get(name).String()))
+		if err := stream.SendMsg(user); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonLines decodes a newline-delimited JSON body
+func jsonLines(t *testing.T, body string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestServerStreaming(t *testing.T) {
+	proxy, e := startProxy(t, &odingrpc.ProxyConfig{
+		DescriptorSets: []string{writeDescriptorSet(t)},
+		Routes:         []odingrpc.RESTRoute{{Method: "GET", Path: "/orgs/:org/users", RPC: "users.v1.UserService/ListUsers"}},
+	})
+
+	t.Run("newline-delimited JSON", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/api/orgs/acme/users?count=3", "")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+		assert.Equal(t, []map[string]interface{}{{"id": "acme-0"}, {"id": "acme-1"}, {"id": "acme-2"}}, jsonLines(t, rec.Body.String()))
+	})
+
+	t.Run("server-sent events", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/orgs/acme/users?count=2", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+
+		events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+		require.Len(t, events, 2)
+		for i, event := range events {
+			require.True(t, strings.HasPrefix(event, "data: "), event)
+			var user map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &user))
+			assert.Equal(t, fmt.Sprintf("acme-%d", i), user["id"])
+		}
+	})
+
+	t.Run("generic form", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/api/users.v1.UserService/ListUsers", `{"org": "acme", "count": 2}`)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Len(t, jsonLines(t, rec.Body.String()), 2)
+	})
+
+	t.Run("errors before the first response", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/api/orgs/missing/users?count=1", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), "org not found")
+	})
+
+	t.Run("errors while streaming", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, "/api/orgs/fail/users?count=3", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []map[string]interface{}{
+			{"id": "fail-0"},
+			{"error": "backend going away", "code": "Unavailable"},
+		}, jsonLines(t, rec.Body.String()))
+	})
+
+	t.Run("client streams need a WebSocket", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "/api/users.v1.UserService/Chat", `{"displayName": "Ada"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	assert.Equal(t, 0, proxy.ActiveStreams())
+}
+
+func TestStreamLimits(t *testing.T) {
+	proxy, e := startProxy(t, &odingrpc.ProxyConfig{
+		DescriptorSets:       []string{writeDescriptorSet(t)},
+		Routes:               []odingrpc.RESTRoute{{Method: "GET", Path: "/orgs/:org/users", RPC: "users.v1.UserService/ListUsers"}},
+		StreamTimeout:        500 * time.Millisecond,
+		MaxConcurrentStreams: 1,
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(e, http.MethodGet, "/api/orgs/slow/users?count=2", "") }()
+	require.Eventually(t, func() bool { return proxy.ActiveStreams() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	rec := serve(e, http.MethodGet, "/api/orgs/acme/users?count=1", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = <-done
+	require.Equal(t, http.StatusOK, rec.Code)
+	lines := jsonLines(t, rec.Body.String())
+	require.Len(t, lines, 2)
+	assert.Equal(t, "DeadlineExceeded", lines[1]["code"])
+	assert.Equal(t, 0, proxy.ActiveStreams())
+}
+
+func TestBidiStreaming(t *testing.T) {
+	proxy, e := startProxy(t, &odingrpc.ProxyConfig{EnableReflection: true})
+	server := httptest.NewServer(e)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/users.v1.UserService/Chat"
+
+	t.Run("messages both ways", func(t *testing.T) {
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer ws.Close()
+
+		for _, name := range []string{"Ada", "Grace"} {
+			require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"displayName": "`+name+`"}`)))
+			_, data, err := ws.ReadMessage()
+			require.NoError(t, err)
+			var user map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &user))
+			assert.Equal(t, "Hi "+name, user["displayName"])
+		}
+
+		// An empty message ends the client's side, and the call with it
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, nil))
+		_, _, err = ws.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+	})
+
+	t.Run("invalid messages", func(t *testing.T) {
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer ws.Close()
+
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(`{"nickname": "G"}`)))
+		_, _, err = ws.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData), err)
+	})
+
+	require.Eventually(t, func() bool { return proxy.ActiveStreams() == 0 }, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	odingrpc "odin/pkg/grpc"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestRESTRoutesWithReflection(t *testing.T) {
+	e := newProxy(t, &odingrpc.ProxyConfig{
+		EnableReflection: true,
+		Routes: []odingrpc.RESTRoute{
+			{Method: "GET", Path: "/users/:id", RPC: "users.v1.UserService/GetUser"},
+			{Method: "GET", Path: "/ghosts/:id", RPC: "ghosts.v1.GhostService/GetGhost"},
+		},
+	})
+
+	rec := serve(e, http.MethodGet, "/api/users/42", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var user map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+	assert.Equal(t, map[string]interface{}{"id": "42", "displayName": "Ada", "age": float64(36)}, user)
+
+	// Methods the target does not describe fail when called
+	assert.Equal(t, http.StatusBadGateway, serve(e, http.MethodGet, "/api/ghosts/1", "").Code)
+}
+
+func TestReflectionRequestsAreShared(t *testing.T) {
+	// Count the reflection requests the target serves
+	var lookups atomic.Int32
+	target := startUserService(t, grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.Contains(info.FullMethod, "ServerReflection") {
+			lookups.Add(1)
+		}
+		return handler(srv, stream)
+	}))
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	proxy, err := odingrpc.NewProxy(&odingrpc.ProxyConfig{Target: target, Timeout: 5 * time.Second, EnableReflection: true}, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { proxy.Close() })
+	e := echo.New()
+	proxy.RegisterRoutes(e, "/api")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serve(e, http.MethodGet, "/api/users.v1.UserService/GetUser?id=7", "")
+			assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), lookups.Load())
+
+	// Services the target does not know are not asked about again right away
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusNotFound, serve(e, http.MethodPost, "/api/users.v1.GroupService/GetGroup", `{}`).Code)
+	}
+	assert.Equal(t, int32(2), lookups.Load())
+}
+
+func TestReflectionDoesNotHoldUpKnownMethods(t *testing.T) {
+	release := make(chan struct{})
+	target := startUserService(t, grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.Contains(info.FullMethod, "ServerReflection") {
+			<-release
+		}
+		return handler(srv, stream)
+	}))
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	proxy, err := odingrpc.NewProxy(&odingrpc.ProxyConfig{
+		Target:           target,
+		Timeout:          5 * time.Second,
+		EnableReflection: true,
+		DescriptorSets:   []string{writeDescriptorSet(t)},
+	}, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { proxy.Close() })
+	e := echo.New()
+	proxy.RegisterRoutes(e, "/api")
+
+	// A lookup the target is slow to answer
+	looked := make(chan int)
+	go func() {
+		looked <- serve(e, http.MethodPost, "/api/users.v1.GroupService/GetGroup", `{}`).Code
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Methods of the descriptor sets are found meanwhile
+	rec := serve(e, http.MethodGet, "/api/users.v1.UserService/GetUser?id=7", "")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	close(release)
+	assert.Equal(t, http.StatusNotFound, <-looked)
+}
+
+func TestGenericTranscoding(t *testing.T) {
+	for name, config := range map[string]*odingrpc.ProxyConfig{
+		"descriptor sets": {DescriptorSets: []string{writeDescriptorSet(t)}},
+		"reflection":      {EnableReflection: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := newProxy(t, config)
+
+			rec := serve(e, http.MethodPost, "/api/users.v1.UserService/CreateUser", `{"org": "acme", "user": {"displayName": "Grace"}}`)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, map[string]interface{}{"user": map[string]interface{}{"id": "acme-1", "displayName": "Grace"}}, resp)
+
+			rec = serve(e, http.MethodGet, "/api/users.v1.UserService/GetUser?id=7", "")
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), `"id":"7"`)
+
+			assert.Equal(t, http.StatusNotFound, serve(e, http.MethodPost, "/api/users.v1.UserService/DeleteUser", `{}`).Code)
+			assert.Equal(t, http.StatusNotFound, serve(e, http.MethodPost, "/api/users.v1.GroupService/GetGroup", `{}`).Code)
+			assert.Equal(t, http.StatusBadRequest, serve(e, http.MethodPost, "/api/users.v1.UserService", `{}`).Code)
+			assert.Equal(t, http.StatusBadRequest, serve(e, http.MethodPost, "/api/users.v1.UserService/CreateUser", `{"nickname": "G"}`).Code)
+		})
+	}
+}
+
+func TestGenericTranscodingWithoutDescriptors(t *testing.T) {
+	e := newProxy(t, &odingrpc.ProxyConfig{})
+	assert.Equal(t, http.StatusNotImplemented, serve(e, http.MethodPost, "/api/users.v1.UserService/GetUser", `{}`).Code)
+
+	_, err := odingrpc.NewProxy(&odingrpc.ProxyConfig{
+		Target: "127.0.0.1:1",
+		Routes: []odingrpc.RESTRoute{{Path: "/users/:id", RPC: "users.v1.UserService/GetUser"}},
+	}, logrus.New())
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/health"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingChannel struct {
+	alerts []health.Alert
+}
+
+func (r *recordingChannel) Name() string { return "recording" }
+
+func (r *recordingChannel) Send(alert health.Alert) error {
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func captureServer(t *testing.T, status int) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+
+	var payloads []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &payloads
+}
+
+func TestRoutedChannelFiltersSeverities(t *testing.T) {
+	inner := &recordingChannel{}
+	channel := health.NewRoutedChannel(inner, []health.Severity{health.SeverityCritical}, false)
+
+	require.NoError(t, channel.Send(health.Alert{Type: health.AlertTypeSlowResponse, Severity: health.SeverityWarning}))
+	require.NoError(t, channel.Send(health.Alert{Type: health.AlertTypeTargetDown, Severity: health.SeverityCritical}))
+	// Resolutions are info but still reach the channel
+	require.NoError(t, channel.Send(health.Alert{Type: health.AlertTypeTargetRecovered, Severity: health.SeverityInfo}))
+
+	require.Len(t, inner.alerts, 2)
+	assert.Equal(t, health.AlertTypeTargetDown, inner.alerts[0].Type)
+	assert.Equal(t, health.AlertTypeTargetRecovered, inner.alerts[1].Type)
+
+	skipping := &recordingChannel{}
+	channel = health.NewRoutedChannel(skipping, nil, true)
+	require.NoError(t, channel.Send(health.Alert{Type: health.AlertTypeTargetRecovered, Severity: health.SeverityInfo}))
+	assert.Empty(t, skipping.alerts)
+}
+
+func TestSlackChannelSendsBlocks(t *testing.T) {
+	server, payloads := captureServer(t, http.StatusOK)
+
+	channel := health.NewSlackChannel("ops", server.URL, "#alerts", "odin", logrus.New())
+	err := channel.Send(health.Alert{
+		Type:      health.AlertTypeTargetDown,
+		Severity:  health.SeverityCritical,
+		Target:    "http://users:8080",
+		Message:   "Target is down",
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"service": "users"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, *payloads, 1)
+	payload := (*payloads)[0]
+	assert.Equal(t, "#alerts", payload["channel"])
+	assert.Equal(t, "odin", payload["username"])
+
+	blocks := payload["blocks"].([]interface{})
+	require.Len(t, blocks, 4)
+	header := blocks[0].(map[string]interface{})["text"].(map[string]interface{})
+	assert.Contains(t, header["text"], "Target down")
+}
+
+func TestTeamsChannelSendsAdaptiveCard(t *testing.T) {
+	server, payloads := captureServer(t, http.StatusAccepted)
+
+	channel := health.NewTeamsChannel("", server.URL, logrus.New())
+	assert.Equal(t, "teams", channel.Name())
+
+	err := channel.Send(health.Alert{
+		Type:      health.AlertTypeTargetRecovered,
+		Severity:  health.SeverityInfo,
+		Target:    "http://users:8080",
+		Message:   "Target recovered",
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+
+	attachment := (*payloads)[0]["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+	title := attachment["content"].(map[string]interface{})["body"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Resolved: Target recovered", title["text"])
+	assert.Equal(t, "Good", title["color"])
+}
+
+func TestPagerDutyChannelTriggersAndResolves(t *testing.T) {
+	server, payloads := captureServer(t, http.StatusAccepted)
+
+	channel := health.NewPagerDutyChannel("oncall", "routing-key", "", server.URL, logrus.New())
+
+	down := health.Alert{
+		Type:      health.AlertTypeTargetDown,
+		Severity:  health.SeverityCritical,
+		Target:    "http://users:8080",
+		Message:   "Target is down",
+		Timestamp: time.Now(),
+	}
+	require.NoError(t, channel.Send(down))
+
+	recovered := down
+	recovered.Type = health.AlertTypeTargetRecovered
+	recovered.Severity = health.SeverityInfo
+	require.NoError(t, channel.Send(recovered))
+
+	require.Len(t, *payloads, 2)
+	trigger, resolve := (*payloads)[0], (*payloads)[1]
+
+	assert.Equal(t, "trigger", trigger["event_action"])
+	assert.Equal(t, "routing-key", trigger["routing_key"])
+	details := trigger["payload"].(map[string]interface{})
+	assert.Equal(t, "critical", details["severity"])
+	assert.Equal(t, "odin-gateway", details["source"])
+
+	assert.Equal(t, "resolve", resolve["event_action"])
+	assert.Equal(t, trigger["dedup_key"], resolve["dedup_key"])
+}
+
+func TestPagerDutyChannelReportsRejection(t *testing.T) {
+	server, _ := captureServer(t, http.StatusBadRequest)
+
+	channel := health.NewPagerDutyChannel("oncall", "bad-key", "", server.URL, logrus.New())
+	err := channel.Send(health.Alert{Type: health.AlertTypeTargetDown, Severity: health.SeverityCritical, Timestamp: time.Now()})
+	assert.ErrorContains(t, err, "unexpected status 400")
+}
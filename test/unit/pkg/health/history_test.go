@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/health"
+	"odin/pkg/mongodb"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryHistoryStore keeps saved records by ID
+type memoryHistoryStore struct {
+	mu      sync.Mutex
+	records map[string]*mongodb.HealthCheckDocument
+}
+
+func (s *memoryHistoryStore) SaveHealthCheck(ctx context.Context, check *mongodb.HealthCheckDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[check.ID] = check
+	return nil
+}
+
+func (s *memoryHistoryStore) QueryHealthChecks(ctx context.Context, serviceName string, start, end time.Time) ([]*mongodb.HealthCheckDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var checks []*mongodb.HealthCheckDocument
+	for _, check := range s.records {
+		if check.ServiceName == serviceName && !check.CheckedAt.Before(start) && !check.CheckedAt.After(end) {
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+func TestHistory_AggregatesChecks(t *testing.T) {
+	store := &memoryHistoryStore{records: make(map[string]*mongodb.HealthCheckDocument)}
+	history := health.NewHistory(config.HealthHistoryConfig{
+		Enabled:    true,
+		Resolution: time.Hour,
+		Retention:  24 * time.Hour,
+	}, store, logrus.New())
+
+	history.RecordCheck("orders", "http://orders-1:8080", health.TargetStatusHealthy, 10*time.Millisecond, nil)
+	history.RecordCheck("orders", "http://orders-1:8080", health.TargetStatusHealthy, 30*time.Millisecond, nil)
+	history.RecordCheck("orders", "http://orders-2:8080", health.TargetStatusHealthy, 100*time.Millisecond, errors.New("connection refused"))
+	history.RecordCheck("orders", "http://orders-2:8080", health.TargetStatusUnhealthy, 0, errors.New("timeout"))
+	history.RecordCheck("billing", "http://billing:8080", health.TargetStatusHealthy, time.Millisecond, nil)
+	history.Stop()
+
+	// One record per target for the current period
+	require.Len(t, store.records, 3)
+	for _, record := range store.records {
+		assert.Equal(t, record.CheckedAt.Add(25*time.Hour), record.TTL)
+	}
+
+	now := time.Now()
+	targets, err := history.Query(context.Background(), "orders", now.Add(-2*time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+
+	assert.Equal(t, "http://orders-1:8080", targets[0].Target)
+	assert.Equal(t, int64(2), targets[0].Checks)
+	assert.Equal(t, 100.0, targets[0].Uptime)
+	assert.Equal(t, int64(20), targets[0].LatencyMs)
+	require.Len(t, targets[0].Points, 1)
+	assert.Equal(t, int64(30), targets[0].Points[0].MaxLatencyMs)
+
+	assert.Equal(t, "http://orders-2:8080", targets[1].Target)
+	assert.Equal(t, 0.0, targets[1].Uptime)
+	require.Len(t, targets[1].Points, 1)
+	assert.Equal(t, string(health.TargetStatusUnhealthy), targets[1].Points[0].Status)
+	assert.Equal(t, int64(2), targets[1].Points[0].Failures)
+	assert.Equal(t, "timeout", targets[1].Points[0].Error)
+}
+
+func TestTargetChecker_Recorder(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	alerts := health.NewAlertManager(logger)
+
+	lis := listen(t)
+	target := "http://" + lis.Addr().String()
+
+	store := &memoryHistoryStore{records: make(map[string]*mongodb.HealthCheckDocument)}
+	history := health.NewHistory(config.HealthHistoryConfig{
+		Enabled:    true,
+		Resolution: time.Hour,
+		Retention:  time.Hour,
+	}, store, logger)
+
+	checker := health.NewTargetChecker(health.Config{
+		Interval: time.Hour,
+		Timeout:  time.Second,
+		Probe:    health.ProbeTCP,
+	}, logger, alerts)
+	checker.SetRecorder(history)
+	checker.AddServiceTarget("orders", target)
+	checker.Start()
+	defer checker.Stop()
+
+	require.Eventually(t, func() bool {
+		return checker.GetTargetHealth(target).TotalChecks > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	history.Stop()
+
+	require.Len(t, store.records, 1)
+	for _, record := range store.records {
+		assert.Equal(t, "orders", record.ServiceName)
+		assert.Equal(t, target, record.Target)
+		assert.Equal(t, string(health.TargetStatusHealthy), record.Status)
+	}
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"odin/pkg/health"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPassiveChecker(t *testing.T, decay time.Duration) *health.TargetChecker {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	checker := health.NewTargetChecker(health.Config{
+		PassiveFailures: 3,
+		PassiveDecay:    decay,
+	}, logger, health.NewAlertManager(logger))
+	checker.AddTarget("http://orders-1:8080")
+	return checker
+}
+
+func TestTargetChecker_ReportRequest(t *testing.T) {
+	checker := newPassiveChecker(t, time.Hour)
+	target := "http://orders-1:8080"
+	failed := errors.New("connection refused")
+
+	checker.ReportRequest(target, failed)
+	checker.ReportRequest(target, failed)
+	checker.ReportRequest(target, nil)
+	checker.ReportRequest(target, failed)
+	checker.ReportRequest(target, failed)
+	assert.True(t, checker.IsHealthy(target), "a success resets the consecutive failures")
+
+	checker.ReportRequest(target, failed)
+	assert.False(t, checker.IsHealthy(target))
+	th := checker.GetTargetHealth(target)
+	assert.Equal(t, health.TargetStatusDegraded, th.Status)
+	assert.Equal(t, "connection refused", th.LastError)
+
+	// Targets that are not monitored are ignored
+	checker.ReportRequest("http://unknown:8080", failed)
+	assert.Nil(t, checker.GetTargetHealth("http://unknown:8080"))
+}
+
+func TestTargetChecker_ReportRequestDecay(t *testing.T) {
+	checker := newPassiveChecker(t, 100*time.Millisecond)
+	target := "http://orders-1:8080"
+	failed := errors.New("unexpected status code: 503")
+
+	for i := 0; i < 3; i++ {
+		checker.ReportRequest(target, failed)
+	}
+	require.False(t, checker.IsHealthy(target))
+
+	// Further failures keep the target degraded
+	time.Sleep(60 * time.Millisecond)
+	checker.ReportRequest(target, failed)
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, checker.IsHealthy(target))
+
+	assert.Eventually(t, func() bool {
+		return checker.IsHealthy(target)
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, checker.GetTargetHealth(target).PassiveFails)
+}
+
+func TestTargetChecker_ReportRequestDisabled(t *testing.T) {
+	logger := logrus.New()
+	checker := health.NewTargetChecker(health.Config{}, logger, health.NewAlertManager(logger))
+	target := "http://orders-1:8080"
+	checker.AddTarget(target)
+
+	for i := 0; i < 10; i++ {
+		checker.ReportRequest(target, errors.New("timeout"))
+	}
+	assert.True(t, checker.IsHealthy(target))
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"odin/pkg/health"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	return lis
+}
+
+// closedAddress returns an address nothing listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+	return addr
+}
+
+func TestTCPCheck(t *testing.T) {
+	lis := listen(t)
+	check := health.TCPCheck(time.Second)
+
+	assert.NoError(t, check(lis.Addr().String()))
+	assert.NoError(t, check("http://"+lis.Addr().String()))
+	assert.Error(t, check("http://"+closedAddress(t)))
+}
+
+func TestGRPCCheck(t *testing.T) {
+	lis := listen(t)
+	server := grpc.NewServer()
+	status := grpchealth.NewServer()
+	status.SetServingStatus("orders.Orders", healthpb.HealthCheckResponse_SERVING)
+	status.SetServingStatus("billing.Billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, status)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	target := "http://" + lis.Addr().String()
+	assert.NoError(t, health.GRPCCheck(time.Second, "", false)(target))
+	assert.NoError(t, health.GRPCCheck(time.Second, "orders.Orders", false)(target))
+
+	err := health.GRPCCheck(time.Second, "billing.Billing", false)(target)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NOT_SERVING")
+
+	assert.Error(t, health.GRPCCheck(time.Second, "unknown.Service", false)(target))
+	assert.Error(t, health.GRPCCheck(time.Second, "", false)("http://"+closedAddress(t)))
+}
+
+func TestTargetChecker_Probe(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	alerts := health.NewAlertManager(logger)
+
+	lis := listen(t)
+	up := "http://" + lis.Addr().String()
+	down := "http://" + closedAddress(t)
+
+	checker := health.NewTargetChecker(health.Config{
+		Interval:           time.Hour,
+		Timeout:            time.Second,
+		UnhealthyThreshold: 1,
+		Probe:              health.ProbeTCP,
+	}, logger, alerts)
+	checker.AddTarget(up)
+	checker.AddTarget(down)
+	checker.Start()
+	defer checker.Stop()
+
+	require.Eventually(t, func() bool {
+		return checker.GetTargetHealth(up).TotalChecks > 0 && checker.GetTargetHealth(down).TotalChecks > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A plain TCP listener does not answer HTTP, so only a TCP probe passes
+	assert.True(t, checker.IsHealthy(up))
+	assert.False(t, checker.IsHealthy(down))
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/health"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, e *echo.Echo, path string) (int, health.Status) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var status health.Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return rec.Code, status
+}
+
+func TestProbes(t *testing.T) {
+	readiness := health.NewReadiness(50 * time.Millisecond)
+	var mongoErr error
+	readiness.AddCheck("mongodb", func(ctx context.Context) error { return mongoErr })
+
+	e := echo.New()
+	health.RegisterProbes(e, config.ProbesConfig{LivenessPath: "/live", ReadinessPath: "/ready"}, readiness)
+
+	code, status := probe(t, e, "/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alive", status.Status)
+
+	// Not ready until routes are registered
+	code, status = probe(t, e, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy", status.Checks["routes"].Status)
+	assert.Equal(t, "healthy", status.Checks["mongodb"].Status)
+
+	readiness.MarkRoutesRegistered()
+	code, status = probe(t, e, "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", status.Status)
+
+	mongoErr = errors.New("connection refused")
+	code, status = probe(t, e, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "connection refused", status.Checks["mongodb"].Error)
+
+	// Liveness does not depend on dependencies
+	code, _ = probe(t, e, "/live")
+	assert.Equal(t, http.StatusOK, code)
+
+	mongoErr = nil
+	readiness.MarkShuttingDown()
+	code, status = probe(t, e, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting down", status.Checks["routes"].Error)
+}
+
+func TestReadiness_CheckTimeout(t *testing.T) {
+	readiness := health.NewReadiness(20 * time.Millisecond)
+	readiness.MarkRoutesRegistered()
+	readiness.AddCheck("redis", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	status, ready := readiness.Check(context.Background())
+	assert.False(t, ready)
+	assert.Equal(t, context.DeadlineExceeded.Error(), status.Checks["redis"].Error)
+}
+
+func TestMinHealthyTargets(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	up := "http://" + listen(t).Addr().String()
+	down := "http://" + closedAddress(t)
+
+	checker := health.NewTargetChecker(health.Config{
+		Interval:           time.Hour,
+		Timeout:            time.Second,
+		UnhealthyThreshold: 1,
+		Probe:              health.ProbeTCP,
+	}, logger, health.NewAlertManager(logger))
+	checker.AddTarget(up)
+	checker.AddTarget(down)
+	checker.Start()
+	defer checker.Stop()
+	require.Eventually(t, func() bool {
+		return !checker.IsHealthy(down)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	targets := []string{up, down}
+	assert.NoError(t, health.MinHealthyTargets(checker, targets, 1)(context.Background()))
+	err := health.MinHealthyTargets(checker, targets, 2)(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 targets healthy")
+}
@@ -0,0 +1,81 @@
+package insomnia
+
+import (
+	"encoding/json"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/integrations/insomnia"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleExport = `{
+	"_type": "export",
+	"__export_format": 4,
+	"resources": [
+		{"_id": "wrk_1", "_type": "workspace", "name": "Users API"},
+		{"_id": "env_1", "_type": "environment", "parentId": "wrk_1", "name": "Base", "data": {"base_url": "http://users.internal:8081"}},
+		{"_id": "fld_1", "_type": "request_group", "parentId": "wrk_1", "name": "Users"},
+		{"_id": "req_1", "_type": "request", "parentId": "fld_1", "name": "List users", "method": "GET", "url": "{{ _.base_url }}/api/users"},
+		{"_id": "req_2", "_type": "request", "parentId": "fld_1", "name": "Create user", "method": "POST", "url": "{{ _.base_url }}/api/users/new",
+		 "headers": [{"name": "X-Team", "value": "core"}],
+		 "body": {"mimeType": "application/json", "text": "{\"name\": \"{{ _.user }}\"}"}}
+	]
+}`
+
+func TestParse_RejectsUnsupportedFormat(t *testing.T) {
+	_, err := insomnia.Parse([]byte(`{"_type": "export", "__export_format": 3, "resources": []}`))
+	assert.Error(t, err)
+
+	_, err = insomnia.Parse([]byte(`{"_type": "workspace", "__export_format": 4}`))
+	assert.Error(t, err)
+}
+
+func TestTransformer_EnhancedTransform(t *testing.T) {
+	export, err := insomnia.Parse([]byte(sampleExport))
+	require.NoError(t, err)
+
+	tr := insomnia.NewTransformer()
+	svc, routes, err := tr.EnhancedTransform(export, "users")
+	require.NoError(t, err)
+
+	assert.Equal(t, "users", svc.Name)
+	assert.Equal(t, []string{"http://users.internal:8081"}, svc.Targets)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "GET", routes[0].Method)
+	assert.Equal(t, "/api/users", routes[0].Path)
+	assert.Equal(t, `{"name": "{{user}}"}`, routes[1].Body.Raw)
+
+	summary := tr.Summarize(export)
+	assert.Equal(t, "Users API", summary.Workspace)
+	assert.Equal(t, 2, summary.Requests)
+	assert.Equal(t, 1, summary.Folders)
+}
+
+func TestTransformer_OdinServiceToInsomnia(t *testing.T) {
+	svc := &config.ServiceConfig{
+		Name:     "orders",
+		BasePath: "/api/orders",
+		Targets:  []string{"http://orders:8080"},
+	}
+
+	tr := insomnia.NewTransformer()
+	export, err := tr.OdinServiceToInsomnia(svc)
+	require.NoError(t, err)
+
+	assert.Equal(t, insomnia.ExportType, export.Type)
+	assert.Equal(t, insomnia.ExportFormat, export.ExportFormat)
+
+	// The export must be importable again
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	reparsed, err := insomnia.Parse(data)
+	require.NoError(t, err)
+
+	imported, err := tr.InsomniaToOdinService(reparsed)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", imported.Name)
+	assert.Equal(t, []string{"http://orders:8080"}, imported.Targets)
+}
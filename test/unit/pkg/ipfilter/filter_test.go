@@ -0,0 +1,116 @@
+package ipfilter
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/ipfilter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFilter(t *testing.T, cfg config.IPFilterConfig, services ...config.ServiceConfig) *ipfilter.Filter {
+	t.Helper()
+	filter, err := ipfilter.New(cfg, services, logrus.New())
+	require.NoError(t, err)
+	return filter
+}
+
+func TestGlobalAllowAndDeny(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{
+		Allow: []string{"10.0.0.0/8"},
+		Deny:  []string{"10.0.0.5"},
+	})
+
+	assert.True(t, filter.Allowed(net.ParseIP("10.1.2.3"), ""))
+	assert.False(t, filter.Allowed(net.ParseIP("10.0.0.5"), ""), "deny wins over allow")
+	assert.False(t, filter.Allowed(net.ParseIP("192.168.1.1"), ""), "not in allow list")
+}
+
+func TestServiceListsAreScoped(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{}, config.ServiceConfig{
+		Name:     "billing",
+		IPFilter: &config.IPFilterRules{Allow: []string{"192.168.0.0/16"}},
+	})
+
+	assert.True(t, filter.Allowed(net.ParseIP("203.0.113.7"), ""))
+	assert.True(t, filter.Allowed(net.ParseIP("203.0.113.7"), "users"))
+	assert.False(t, filter.Allowed(net.ParseIP("203.0.113.7"), "billing"))
+	assert.True(t, filter.Allowed(net.ParseIP("192.168.4.4"), "billing"))
+}
+
+func TestSetServiceLists(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{Deny: []string{"192.0.2.0/24"}}, config.ServiceConfig{
+		Name:     "billing",
+		IPFilter: &config.IPFilterRules{Allow: []string{"192.168.0.0/16"}},
+	})
+	blocked, err := filter.Add(ipfilter.Entry{CIDR: "198.51.100.9", Action: ipfilter.ActionDeny}, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, filter.SetServiceLists([]config.ServiceConfig{{
+		Name:     "users",
+		IPFilter: &config.IPFilterRules{Deny: []string{"203.0.113.0/24"}},
+	}}))
+
+	assert.True(t, filter.Allowed(net.ParseIP("203.0.113.7"), "billing"), "lists of removed services are dropped")
+	assert.False(t, filter.Allowed(net.ParseIP("203.0.113.7"), "users"))
+	assert.False(t, filter.Allowed(net.ParseIP("192.0.2.1"), ""), "global lists are kept")
+	assert.False(t, filter.Allowed(net.ParseIP("198.51.100.9"), ""), "runtime entries are kept")
+	assert.NoError(t, filter.Remove(blocked.ID))
+
+	assert.Error(t, filter.SetServiceLists([]config.ServiceConfig{{
+		Name:     "users",
+		IPFilter: &config.IPFilterRules{Deny: []string{"not-an-ip"}},
+	}}))
+	assert.False(t, filter.Allowed(net.ParseIP("203.0.113.7"), "users"), "invalid lists change nothing")
+}
+
+func TestTemporaryBlockExpires(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{})
+	ip := net.ParseIP("198.51.100.9")
+
+	entry, err := filter.Add(ipfilter.Entry{CIDR: "198.51.100.9", Action: ipfilter.ActionDeny}, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.NotNil(t, entry.ExpiresAt)
+	assert.Equal(t, "198.51.100.9/32", entry.CIDR)
+	assert.False(t, filter.Allowed(ip, ""))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, filter.Allowed(ip, ""))
+	assert.Empty(t, filter.List())
+}
+
+func TestRemoveEntry(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{Deny: []string{"192.0.2.0/24"}})
+
+	static := filter.List()[0]
+	assert.ErrorIs(t, filter.Remove(static.ID), ipfilter.ErrStatic)
+
+	entry, err := filter.Add(ipfilter.Entry{CIDR: "2001:db8::/32", Action: ipfilter.ActionDeny, Service: "users"}, 0)
+	require.NoError(t, err)
+	assert.Nil(t, entry.ExpiresAt)
+	require.NoError(t, filter.Remove(entry.ID))
+	assert.ErrorIs(t, filter.Remove(entry.ID), ipfilter.ErrNotFound)
+
+	_, err = filter.Add(ipfilter.Entry{CIDR: "not-an-ip", Action: ipfilter.ActionDeny}, 0)
+	assert.Error(t, err)
+	_, err = filter.Add(ipfilter.Entry{CIDR: "192.0.2.1", Action: "block"}, 0)
+	assert.Error(t, err)
+}
+
+func TestClientIPHonoursTrustedProxies(t *testing.T) {
+	filter := newFilter(t, config.IPFilterConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7, 10.0.0.9")
+	assert.Equal(t, "203.0.113.7", filter.ClientIP(req).String(), "spoofed leftmost hop is ignored")
+
+	req.RemoteAddr = "198.51.100.1:4321"
+	assert.Equal(t, "198.51.100.1", filter.ClientIP(req).String(), "untrusted peer cannot set the header")
+}
@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/logging"
+	"odin/pkg/requestid"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveLogged(t *testing.T, logger *logging.AccessLogger, uri string, handler echo.HandlerFunc) {
+	t.Helper()
+
+	e := echo.New()
+	e.Use(logger.Middleware())
+	e.GET("/*", handler)
+
+	req := httptest.NewRequest(http.MethodGet, uri, nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	e.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	serveLogged(t, logging.NewAccessLogger(&out, true), `/api/users?q="x"`, func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "203.0.113.7", entry["remote_ip"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, `/api/users?q="x"`, entry["uri"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes_out"])
+	assert.Contains(t, entry, "latency_us")
+	assert.NotContains(t, entry, "error")
+}
+
+func TestAccessLoggerLogsErrorStatus(t *testing.T) {
+	var out bytes.Buffer
+	serveLogged(t, logging.NewAccessLogger(&out, true), "/api/orders", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadGateway, "Service unavailable")
+	})
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, float64(502), entry["status"])
+	assert.Contains(t, entry["error"], "Service unavailable")
+}
+
+func TestAccessLoggerText(t *testing.T) {
+	var out bytes.Buffer
+	serveLogged(t, logging.NewAccessLogger(&out, false), "/api/users/42", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	line := out.String()
+	require.True(t, strings.HasSuffix(line, "\n"))
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), " | ")
+	require.Len(t, fields, 5)
+	assert.Equal(t, "203.0.113.7", fields[1])
+	assert.Equal(t, "GET /api/users/42", fields[2])
+	assert.Equal(t, "204", fields[3])
+}
+
+func BenchmarkAccessLogger(b *testing.B) {
+	e := echo.New()
+	handler := logging.NewAccessLogger(io.Discard, true).Middleware()(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/users/42?fields=name", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reset(req, rec)
+		handler(c)
+	}
+}
+
+func BenchmarkLogrusAccessLog(b *testing.B) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/users/42?fields=name", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Reset(req, rec)
+		handler(c)
+		logger.WithFields(logrus.Fields{
+			"method": req.Method,
+			"uri":    req.RequestURI,
+			"status": c.Response().Status,
+			"ip":     c.RealIP(),
+		}).Info("Request processed")
+	}
+}
+
+func TestAccessLoggerRequestID(t *testing.T) {
+	var out bytes.Buffer
+	serveLogged(t, logging.NewAccessLogger(&out, true), "/api/users", func(c echo.Context) error {
+		c.Set(requestid.ContextKey, "req-7")
+		return c.NoContent(http.StatusOK)
+	})
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "req-7", entry["request_id"])
+
+	out.Reset()
+	serveLogged(t, logging.NewAccessLogger(&out, false), "/api/users", func(c echo.Context) error {
+		c.Set(requestid.ContextKey, "req-8")
+		return c.NoContent(http.StatusOK)
+	})
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(out.String()), " | req-8"), out.String())
+}
+
+func TestAccessLoggerHeaders(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.NewAccessLogger(&out, true)
+	logger.LogHeaders("X-Geo-Country", "X-Geo-ASN")
+	serveLogged(t, logger, "/api/users", func(c echo.Context) error {
+		c.Request().Header.Set("X-Geo-Country", "GB")
+		return c.NoContent(http.StatusOK)
+	})
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "GB", entry["x-geo-country"])
+	assert.Equal(t, "", entry["x-geo-asn"])
+
+	out.Reset()
+	logger = logging.NewAccessLogger(&out, false)
+	logger.LogHeaders("X-Geo-Country")
+	serveLogged(t, logger, "/api/users", func(c echo.Context) error {
+		c.Request().Header.Set("X-Geo-Country", "GB")
+		return c.NoContent(http.StatusOK)
+	})
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(out.String()), " | GB"), out.String())
+}
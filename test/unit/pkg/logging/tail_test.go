@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"odin/pkg/logging"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTailLogger(size int) (*logrus.Logger, *logging.Tail) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tail := logging.NewTail(size)
+	logger.AddHook(tail)
+	return logger, tail
+}
+
+func TestTailRecent(t *testing.T) {
+	logger, tail := newTailLogger(3)
+	assert.Empty(t, tail.Recent(10))
+
+	logger.WithError(errors.New("refused")).WithField("service", "orders").Warn("upstream failed")
+	entries := tail.Recent(10)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "warning", entries[0].Level)
+	assert.Equal(t, "upstream failed", entries[0].Message)
+	assert.Equal(t, "refused", entries[0].Fields["error"])
+	assert.Equal(t, "orders", entries[0].Fields["service"])
+
+	for _, msg := range []string{"b", "c", "d", "e"} {
+		logger.Info(msg)
+	}
+	var messages []string
+	for _, e := range tail.Recent(10) {
+		messages = append(messages, e.Message)
+	}
+	assert.Equal(t, []string{"c", "d", "e"}, messages)
+	require.Len(t, tail.Recent(1), 1)
+	assert.Equal(t, "e", tail.Recent(1)[0].Message)
+}
+
+func TestTailFollow(t *testing.T) {
+	logger, tail := newTailLogger(10)
+	logger.Info("before")
+
+	recent, entries, stop := tail.Follow(5, 4)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "before", recent[0].Message)
+
+	logger.Info("after")
+	select {
+	case e := <-entries:
+		assert.Equal(t, "after", e.Message)
+	case <-time.After(time.Second):
+		t.Fatal("no entry followed")
+	}
+
+	stop()
+	stop()
+	logger.Info("stopped")
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,201 @@
+package metering
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/metering"
+	"odin/pkg/mongodb"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore adds up usage records in memory, like the repository
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]*mongodb.UsageRecordDocument
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]*mongodb.UsageRecordDocument)}
+}
+
+func (s *memoryStore) AddUsageRecord(_ context.Context, record *mongodb.UsageRecordDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.records[record.ID]
+	if !ok {
+		copied := *record
+		s.records[record.ID] = &copied
+		return nil
+	}
+	stored.Requests += record.Requests
+	stored.Errors += record.Errors
+	stored.BytesIn += record.BytesIn
+	stored.BytesOut += record.BytesOut
+	return nil
+}
+
+func (s *memoryStore) QueryUsageRecords(_ context.Context, query mongodb.UsageRecordQuery) ([]*mongodb.UsageRecordDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []*mongodb.UsageRecordDocument
+	for _, record := range s.records {
+		if record.PeriodStart.Before(query.From) || !record.PeriodStart.Before(query.To) {
+			continue
+		}
+		if query.KeyID != "" && record.KeyID != query.KeyID {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// find returns the stored record of a key and service
+func (s *memoryStore) find(keyID, service string) *mongodb.UsageRecordDocument {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range s.records {
+		if record.KeyID == keyID && record.Service == service {
+			return record
+		}
+	}
+	return nil
+}
+
+type publisher struct {
+	mu     sync.Mutex
+	events []map[string]interface{}
+}
+
+func (p *publisher) Publish(eventType events.EventType, data map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if eventType == events.UsageRecorded {
+		p.events = append(p.events, data)
+	}
+}
+
+var keys = map[string]*mongodb.APIKeyDocument{
+	"alpha": {ID: "key-1", UserID: "user-1", Plan: "commerce/pro"},
+	"beta":  {ID: "key-2", UserID: "user-2"},
+}
+
+// newGateway serves orders and billing behind an authentication middleware
+// that accepts keys, and the meter
+func newGateway(meter *metering.Meter) *echo.Echo {
+	e := echo.New()
+	for _, name := range []string{"orders", "billing"} {
+		group := e.Group("/" + name)
+		group.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if key, ok := keys[c.Request().Header.Get("X-API-Key")]; ok {
+					c.Set("apiKey", key)
+				}
+				return next(c)
+			}
+		})
+		group.Use(meter.Middleware(name))
+		group.POST("/echo", func(c echo.Context) error {
+			body, _ := io.ReadAll(c.Request().Body)
+			c.Response().WriteHeader(http.StatusOK)
+			_, err := c.Response().Write(body)
+			return err
+		})
+		group.GET("/fail", func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusBadGateway, "upstream failed")
+		})
+	}
+	return e
+}
+
+func call(e *echo.Echo, method, path, key, body string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	e.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestMeter(t *testing.T) {
+	store := newMemoryStore()
+	pub := &publisher{}
+	meter := metering.NewMeter(config.MeteringConfig{Enabled: true, Period: time.Hour}, store, logrus.New())
+	meter.SetEventPublisher(pub)
+	e := newGateway(meter)
+
+	call(e, http.MethodPost, "/orders/echo", "alpha", "hello")
+	call(e, http.MethodPost, "/orders/echo", "alpha", "hello world")
+	call(e, http.MethodGet, "/orders/fail", "alpha", "")
+	call(e, http.MethodPost, "/billing/echo", "alpha", "{}")
+	call(e, http.MethodPost, "/orders/echo", "beta", "x")
+	call(e, http.MethodPost, "/orders/echo", "", "anonymous")
+	meter.Stop()
+
+	orders := store.find("key-1", "orders")
+	require.NotNil(t, orders)
+	assert.Equal(t, int64(3), orders.Requests)
+	assert.Equal(t, int64(1), orders.Errors)
+	assert.Equal(t, int64(16), orders.BytesIn)
+	assert.Equal(t, int64(16), orders.BytesOut)
+	assert.Equal(t, "user-1", orders.UserID)
+	assert.Equal(t, "commerce/pro", orders.Plan)
+	start := time.Now().UTC().Truncate(time.Hour)
+	assert.Equal(t, start, orders.PeriodStart)
+	assert.Equal(t, start.Add(time.Hour), orders.PeriodEnd)
+	assert.True(t, orders.TTL.IsZero())
+
+	billing := store.find("key-1", "billing")
+	require.NotNil(t, billing)
+	assert.Equal(t, int64(1), billing.Requests)
+	assert.Equal(t, int64(2), billing.BytesIn)
+
+	// Requests without an API key are metered with an empty key
+	anonymous := store.find("", "orders")
+	require.NotNil(t, anonymous)
+	assert.Equal(t, int64(9), anonymous.BytesIn)
+	assert.Len(t, store.records, 4)
+
+	// The records saved for a period are published together
+	require.Len(t, pub.events, 1)
+	records := pub.events[0]["records"].([]*mongodb.UsageRecordDocument)
+	assert.Len(t, records, 4)
+	assert.Equal(t, start, pub.events[0]["periodStart"])
+	assert.Equal(t, "", records[0].KeyID)
+	assert.Equal(t, "billing", records[1].Service)
+
+	found, err := meter.Query(context.Background(), mongodb.UsageRecordQuery{From: start, To: start.Add(time.Hour), KeyID: "key-2"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, int64(1), found[0].Requests)
+}
+
+func TestMeterAddsUpAcrossFlushes(t *testing.T) {
+	store := newMemoryStore()
+	cfg := config.MeteringConfig{Enabled: true, Period: time.Hour, Retention: 24 * time.Hour}
+
+	// A gateway restarting within a period adds to the same record
+	for i := 0; i < 2; i++ {
+		meter := metering.NewMeter(cfg, store, logrus.New())
+		call(newGateway(meter), http.MethodPost, "/orders/echo", "beta", "abc")
+		meter.Stop()
+	}
+
+	require.Len(t, store.records, 1)
+	record := store.find("key-2", "orders")
+	assert.Equal(t, int64(2), record.Requests)
+	assert.Equal(t, int64(6), record.BytesIn)
+	assert.Equal(t, record.PeriodEnd.Add(24*time.Hour), record.TTL)
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/middleware"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var largeJSON = `{"items":"` + strings.Repeat("odin ", 1000) + `"}`
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		r = gr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	default:
+		return string(body)
+	}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func newCompressionServer(cfg config.CompressionConfig) *echo.Echo {
+	e := echo.New()
+	e.Use(middleware.CompressionMiddleware(cfg))
+	e.GET("/json", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(largeJSON))
+	})
+	e.GET("/small", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/image", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, "image/png", []byte(largeJSON))
+	})
+	e.GET("/encoded", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentEncoding, "gzip")
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(largeJSON))
+	})
+	return e
+}
+
+func request(e *echo.Echo, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	e := newCompressionServer(config.CompressionConfig{})
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"gzip, deflate, br, zstd", "br"},
+		{"gzip, zstd", "zstd"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, *", "zstd"},
+		{"deflate", ""},
+		{"identity", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			rec := request(e, "/json", tt.acceptEncoding)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.encoding, rec.Header().Get(echo.HeaderContentEncoding))
+			assert.Equal(t, largeJSON, decompress(t, tt.encoding, rec.Body.Bytes()))
+			if tt.encoding != "" {
+				assert.Equal(t, echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+				assert.Less(t, rec.Body.Len(), len(largeJSON))
+			}
+		})
+	}
+}
+
+func TestCompressionPreferenceAndLevels(t *testing.T) {
+	e := newCompressionServer(config.CompressionConfig{
+		Encodings:   []string{"gzip", "br"},
+		GzipLevel:   9,
+		BrotliLevel: 11,
+	})
+
+	rec := request(e, "/json", "br, gzip, zstd")
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, largeJSON, decompress(t, "gzip", rec.Body.Bytes()))
+
+	rec = request(e, "/json", "zstd")
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+}
+
+func TestCompressionSkips(t *testing.T) {
+	e := newCompressionServer(config.CompressionConfig{MinSize: 16})
+
+	t.Run("below minimum size", func(t *testing.T) {
+		rec := request(e, "/small", "gzip")
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+		assert.Equal(t, "ok", rec.Body.String())
+	})
+
+	t.Run("already compressed type", func(t *testing.T) {
+		rec := request(e, "/image", "br")
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+		assert.Equal(t, largeJSON, rec.Body.String())
+	})
+
+	t.Run("already encoded", func(t *testing.T) {
+		rec := request(e, "/encoded", "br")
+		assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+		assert.Equal(t, largeJSON, rec.Body.String())
+	})
+}
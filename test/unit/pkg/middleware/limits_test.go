@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/middleware"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	limits := config.RequestLimits{
+		MaxURLLength:   64,
+		MaxQueryParams: 3,
+		MaxHeaderCount: 5,
+		MaxHeaderSize:  128,
+		MaxHeaderBytes: 256,
+	}
+
+	e := echo.New()
+	e.Pre(middleware.RequestLimitsMiddleware(limits, logrus.New()))
+	e.GET("/*", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		status int
+	}{
+		{name: "within limits", target: "/api/users?page=1", status: http.StatusOK},
+		{name: "long url", target: "/api/" + strings.Repeat("a", 64), status: http.StatusRequestURITooLong},
+		{name: "too many query params", target: "/api?a=1&b=2&c=3&d=4", status: http.StatusRequestURITooLong},
+		{name: "oversized header", target: "/api", header: map[string]string{"X-Data": strings.Repeat("x", 200)}, status: http.StatusRequestHeaderFieldsTooLarge},
+		{
+			name:   "too many headers",
+			target: "/api",
+			header: map[string]string{"X-A": "1", "X-B": "2", "X-C": "3", "X-D": "4", "X-E": "5", "X-F": "6"},
+			status: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		{
+			name:   "total header size",
+			target: "/api",
+			header: map[string]string{"X-A": strings.Repeat("a", 100), "X-B": strings.Repeat("b", 100), "X-C": strings.Repeat("c", 100)},
+			status: http.StatusRequestHeaderFieldsTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
@@ -64,6 +64,26 @@ func TestCacheMiddleware(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "cached response")
 }
 
+func TestCacheMiddlewareSkipsPrivateResponses(t *testing.T) {
+	store := cache.NewMemoryStore()
+	middlewareFunc := middleware.CacheMiddleware(store, logrus.New())
+
+	calls := 0
+	handler := middlewareFunc(func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("Cache-Control", "private, max-age=60")
+		return c.String(http.StatusOK, "mine")
+	})
+
+	e := echo.New()
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler(e.NewContext(httptest.NewRequest("GET", "/me", nil), rec)))
+		assert.Equal(t, "mine", rec.Body.String())
+	}
+	assert.Equal(t, 2, calls)
+}
+
 func TestRateLimiterMiddleware(t *testing.T) {
 	config := ratelimit.Config{
 		Enabled:       true,
@@ -0,0 +1,130 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mock"
+	"odin/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var paths = []string{"/orders", "/orders/42", "/orders/me", "/customers"}
+
+// newGateway serves the orders service through mocker, answering requests
+// that reach the backend with "proxied"
+func newGateway(mocker *mock.Mocker) *echo.Echo {
+	e := echo.New()
+	group := e.Group("/api")
+	group.Use(mocker.Middleware())
+	for _, path := range paths {
+		group.GET(path, func(c echo.Context) error {
+			return c.String(http.StatusOK, "proxied")
+		})
+	}
+	return e
+}
+
+func call(e *echo.Echo, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCannedRoutes(t *testing.T) {
+	e := newGateway(mock.NewMocker("orders", config.MockConfig{
+		Routes: []config.MockRouteConfig{
+			{Method: "GET", Path: "/api/orders/{id}", Body: `{"id": 42}`},
+			{Path: "/api/orders/me", Status: http.StatusUnauthorized, Headers: map[string]string{"WWW-Authenticate": "Bearer"}, Body: "log in first"},
+		},
+	}, nil))
+
+	rec := call(e, "/api/orders/42", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rec.Header().Get(mock.HeaderMock))
+	assert.JSONEq(t, `{"id": 42}`, rec.Body.String())
+
+	// The route with more literal segments wins
+	rec = call(e, "/api/orders/me", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "log in first", rec.Body.String())
+
+	rec = call(e, "/api/customers", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get(mock.HeaderMock))
+}
+
+func TestPassthrough(t *testing.T) {
+	e := newGateway(mock.NewMocker("orders", config.MockConfig{
+		Passthrough: true,
+		Routes:      []config.MockRouteConfig{{Path: "/api/orders", Body: "[]"}},
+	}, nil))
+
+	assert.Equal(t, "[]", call(e, "/api/orders", nil).Body.String())
+	assert.Equal(t, "proxied", call(e, "/api/customers", nil).Body.String())
+}
+
+func TestResponsesFromSpec(t *testing.T) {
+	spec := &openapi.Spec{
+		Paths: map[string]openapi.PathItem{
+			"/orders/{id}": {Get: &openapi.Operation{Responses: map[string]openapi.Response{
+				"200": {Content: map[string]openapi.MediaType{
+					"application/json": {Schema: &openapi.Schema{
+						Type:       "object",
+						Properties: map[string]*openapi.Schema{"id": {Type: "integer"}},
+					}},
+				}},
+				"404": {Content: map[string]openapi.MediaType{
+					"application/json": {Example: map[string]interface{}{"error": "not found"}},
+				}},
+			}}},
+		},
+	}
+	e := newGateway(mock.NewMocker("orders", config.MockConfig{
+		FromSpec:    true,
+		Passthrough: true,
+	}, openapi.NewValidator(spec, "/api")))
+
+	rec := call(e, "/api/orders/42", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(mock.HeaderMock))
+	assert.JSONEq(t, `{"id": 1}`, rec.Body.String())
+
+	rec = call(e, "/api/orders/42", http.Header{"Prefer": {"code=404"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error": "not found"}`, rec.Body.String())
+
+	rec = call(e, "/api/orders/42", http.Header{"Prefer": {"code=500"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Operations the spec does not describe reach the backend
+	assert.Equal(t, "proxied", call(e, "/api/customers", nil).Body.String())
+}
+
+func TestLatency(t *testing.T) {
+	latency := 50 * time.Millisecond
+	e := newGateway(mock.NewMocker("orders", config.MockConfig{
+		Latency: time.Hour,
+		Jitter:  10 * time.Millisecond,
+		Routes:  []config.MockRouteConfig{{Path: "/api/orders", Latency: &latency}},
+	}, nil))
+
+	start := time.Now()
+	rec := call(e, "/api/orders", nil)
+	elapsed := time.Since(start)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.GreaterOrEqual(t, elapsed, latency)
+	assert.Less(t, elapsed, time.Second)
+}
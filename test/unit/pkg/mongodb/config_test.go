@@ -0,0 +1,41 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestConfigDocumentRoundTrip(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{Port: 9090, ReadTimeout: 5 * time.Second},
+		Services: []config.ServiceConfig{
+			{Name: "orders", BasePath: "/orders", Targets: []string{"http://orders:8080"}, Timeout: 3 * time.Second},
+		},
+	}
+	data, err := mongodb.ConfigToMap(cfg)
+	require.NoError(t, err)
+
+	// Documents come back from MongoDB with nested documents and arrays
+	raw, err := bson.Marshal(bson.M{"config": data})
+	require.NoError(t, err)
+	var doc struct {
+		Config map[string]interface{} `bson:"config"`
+	}
+	require.NoError(t, bson.Unmarshal(raw, &doc))
+
+	restored, err := mongodb.MapToConfig(doc.Config)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, restored.Server.Port)
+	assert.Equal(t, 5*time.Second, restored.Server.ReadTimeout)
+	require.Len(t, restored.Services, 1)
+	assert.Equal(t, "orders", restored.Services[0].Name)
+	assert.Equal(t, []string{"http://orders:8080"}, restored.Services[0].Targets)
+	assert.Equal(t, 3*time.Second, restored.Services[0].Timeout)
+}
@@ -0,0 +1,30 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"odin/pkg/mongodb"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := mongodb.NamespaceFromContext(ctx)
+	assert.False(t, ok)
+
+	_, ok = mongodb.NamespaceFromContext(mongodb.WithNamespace(ctx, ""))
+	assert.False(t, ok, "the empty namespace leaves the context unscoped")
+
+	namespace, ok := mongodb.NamespaceFromContext(mongodb.WithNamespace(ctx, "payments"))
+	assert.True(t, ok)
+	assert.Equal(t, "payments", namespace)
+}
+
+func TestInNamespace(t *testing.T) {
+	namespace, ok := mongodb.NamespaceFromContext(mongodb.InNamespace(context.Background(), ""))
+	assert.True(t, ok, "the empty namespace scopes the context to the default namespace")
+	assert.Equal(t, "", namespace)
+}
@@ -0,0 +1,27 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"odin/pkg/monitoring"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestSamplesKeepsMostRecent(t *testing.T) {
+	samples := monitoring.NewRequestSamples(3)
+	for i := 1; i <= 5; i++ {
+		samples.Record("users", monitoring.RequestSample{Status: 200, Duration: time.Duration(i) * time.Millisecond})
+	}
+	samples.Record("orders", monitoring.RequestSample{Status: 500})
+
+	snapshot := samples.Snapshot()
+	assert.Len(t, snapshot["orders"], 1)
+
+	var durations []time.Duration
+	for _, sample := range snapshot["users"] {
+		durations = append(durations, sample.Duration)
+	}
+	assert.Equal(t, []time.Duration{3 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond}, durations)
+}
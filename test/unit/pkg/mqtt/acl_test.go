@@ -0,0 +1,63 @@
+package mqtt
+
+import (
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/mqtt"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLEmptyAllowsAll(t *testing.T) {
+	grants := mqtt.NewACL(nil).For(&mqtt.Identity{UserID: "u1"})
+	assert.True(t, grants.CanPublish("any/topic"))
+	assert.True(t, grants.CanSubscribe("#"))
+}
+
+func TestACLPlaceholders(t *testing.T) {
+	acl := mqtt.NewACL([]config.MQTTACLRule{
+		{Topic: "devices/{userId}/#", Access: "all"},
+		{Topic: "fleet/+/status", Access: "subscribe"},
+		{Topic: "clients/{clientId}/events", Access: "publish"},
+	})
+	grants := acl.For(&mqtt.Identity{UserID: "u1", ClientID: "sensor-7"})
+
+	assert.True(t, grants.CanPublish("devices/u1/temp"))
+	assert.True(t, grants.CanPublish("devices/u1"))
+	assert.False(t, grants.CanPublish("devices/u2/temp"))
+	assert.True(t, grants.CanPublish("clients/sensor-7/events"))
+	assert.False(t, grants.CanPublish("fleet/a/status"))
+
+	assert.True(t, grants.CanSubscribe("devices/u1/#"))
+	assert.True(t, grants.CanSubscribe("devices/u1/+/humidity"))
+	assert.False(t, grants.CanSubscribe("devices/+/temp"))
+	assert.False(t, grants.CanSubscribe("devices/#"))
+	assert.True(t, grants.CanSubscribe("fleet/+/status"))
+	assert.True(t, grants.CanSubscribe("fleet/truck-1/status"))
+	assert.False(t, grants.CanSubscribe("fleet/#"))
+	assert.False(t, grants.CanSubscribe("clients/sensor-7/events"))
+}
+
+func TestACLRejectsWildcardIdentities(t *testing.T) {
+	acl := mqtt.NewACL([]config.MQTTACLRule{{Topic: "devices/{userId}/#"}})
+
+	assert.False(t, acl.For(&mqtt.Identity{UserID: "#"}).CanPublish("devices/u1/temp"))
+	assert.False(t, acl.For(&mqtt.Identity{UserID: "a/b"}).CanPublish("devices/a/b/temp"))
+	assert.False(t, acl.For(&mqtt.Identity{}).CanPublish("devices//temp"))
+}
+
+func TestACLRoles(t *testing.T) {
+	acl := mqtt.NewACL([]config.MQTTACLRule{
+		{Topic: "#", Roles: []string{"admin"}},
+		{Topic: "public/#", Access: "subscribe"},
+	})
+
+	admin := acl.For(&mqtt.Identity{UserID: "a", Roles: []string{"admin"}})
+	assert.True(t, admin.CanPublish("devices/u1/cmd"))
+	assert.False(t, admin.CanSubscribe("$SYS/broker/uptime"))
+
+	user := acl.For(&mqtt.Identity{UserID: "u", Roles: []string{"user"}})
+	assert.False(t, user.CanPublish("devices/u1/cmd"))
+	assert.True(t, user.CanSubscribe("public/news"))
+}
@@ -0,0 +1,191 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mqtt"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenAuth accepts the password "secret-<userId>"
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(r *http.Request, password string) (*mqtt.Identity, error) {
+	userID, ok := strings.CutPrefix(password, "secret-")
+	if !ok {
+		return nil, errors.New("bad password")
+	}
+	return &mqtt.Identity{UserID: userID}, nil
+}
+
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+func packet(first byte, body []byte) []byte {
+	return append([]byte{first, byte(len(body))}, body...)
+}
+
+// connectPacket builds an MQTT 3.1.1 CONNECT
+func connectPacket(clientID, username, password string) []byte {
+	body := mqttString("MQTT")
+	body = append(body, 4, 0xC2, 0, 60) // level, username+password+clean session, keep alive
+	body = append(body, mqttString(clientID)...)
+	body = append(body, mqttString(username)...)
+	body = append(body, mqttString(password)...)
+	return packet(0x10, body)
+}
+
+func publishPacket(topic, payload string) []byte {
+	return packet(0x30, append(mqttString(topic), payload...))
+}
+
+func subscribePacket(filter string) []byte {
+	body := append([]byte{0, 1}, mqttString(filter)...)
+	return packet(0x82, append(body, 0))
+}
+
+// broker is a fake MQTT broker that records the packets it receives and
+// acknowledges the CONNECT
+type broker struct {
+	server   *httptest.Server
+	received chan []byte
+}
+
+func newBroker(t *testing.T) *broker {
+	b := &broker{received: make(chan []byte, 10)}
+	upgrader := websocket.Upgrader{Subprotocols: []string{"mqtt"}}
+	b.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			b.received <- data
+			if data[0]>>4 == 1 {
+				conn.WriteMessage(websocket.BinaryMessage, []byte{0x20, 2, 0, 0})
+			}
+		}
+	}))
+	t.Cleanup(b.server.Close)
+	return b
+}
+
+func (b *broker) next(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case data := <-b.received:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("broker received nothing")
+		return nil
+	}
+}
+
+func newGateway(t *testing.T, b *broker, cfg config.MQTTConfig) string {
+	e := echo.New()
+	proxy := mqtt.NewProxy("devices", b.server.URL, cfg, tokenAuth{}, logrus.New())
+	proxy.RegisterRoutes(e, "/mqtt")
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/mqtt"
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{"mqtt"}}
+	conn, _, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	assert.Equal(t, "mqtt", conn.Subprotocol())
+	return conn
+}
+
+func TestProxyMapsCredentials(t *testing.T) {
+	b := newBroker(t)
+	conn := dial(t, newGateway(t, b, config.MQTTConfig{
+		BrokerUsername: "gw-{userId}",
+		BrokerPassword: "broker-secret",
+	}))
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, connectPacket("sensor-1", "ignored", "secret-u1")))
+	assert.Equal(t, connectPacket("sensor-1", "gw-u1", "broker-secret"), b.next(t))
+
+	_, connack, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x20, 2, 0, 0}, connack)
+}
+
+func TestProxyRejectsInvalidCredentials(t *testing.T) {
+	b := newBroker(t)
+	conn := dial(t, newGateway(t, b, config.MQTTConfig{BrokerUsername: "{userId}"}))
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, connectPacket("sensor-1", "u1", "wrong")))
+	_, connack, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x20, 2, 0, 5}, connack)
+
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err)
+	assert.Empty(t, b.received)
+}
+
+func TestProxyEnforcesACL(t *testing.T) {
+	b := newBroker(t)
+	url := newGateway(t, b, config.MQTTConfig{
+		BrokerUsername: "{userId}",
+		ACL:            []config.MQTTACLRule{{Topic: "devices/{userId}/#", Access: "all"}},
+	})
+
+	conn := dial(t, url)
+	// Packets may be split across and combined in WebSocket messages
+	connect := connectPacket("sensor-1", "u1", "secret-u1")
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, connect[:5]))
+	allowed := append(connect[5:], publishPacket("devices/u1/temp", "21.5")...)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, allowed))
+	b.next(t)
+	assert.Equal(t, publishPacket("devices/u1/temp", "21.5"), b.next(t))
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, subscribePacket("devices/u1/#")))
+	assert.Equal(t, subscribePacket("devices/u1/#"), b.next(t))
+
+	// Publishing outside the granted topics closes the connection
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, publishPacket("devices/u2/temp", "0")))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.Empty(t, b.received)
+
+	// So does subscribing to them
+	conn = dial(t, url)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, connectPacket("sensor-1", "u1", "secret-u1")))
+	b.next(t)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, subscribePacket("devices/#")))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	assert.Empty(t, b.received)
+}
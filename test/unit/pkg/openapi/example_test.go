@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"odin/pkg/openapi"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const ordersSpec = `
+openapi: 3.0.3
+info:
+  title: Orders
+  version: "1.0"
+paths:
+  /orders:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              examples:
+                two:
+                  value: [{id: 1}, {id: 2}]
+                empty:
+                  value: []
+  /orders/{id}:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+        "404":
+          description: Not found
+          content:
+            application/json:
+              example: {error: order not found}
+    delete:
+      responses:
+        "204":
+          description: Deleted
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        id:
+          type: integer
+          minimum: 1000
+        email:
+          type: string
+          format: email
+        status:
+          type: string
+          enum: [pending, shipped]
+        total:
+          type: number
+          example: 9.99
+        items:
+          type: array
+          minItems: 2
+          items:
+            type: string
+`
+
+func newOrdersValidator(t *testing.T) *openapi.Validator {
+	var spec openapi.Spec
+	require.NoError(t, yaml.Unmarshal([]byte(ordersSpec), &spec))
+	return openapi.NewValidator(&spec, "/api")
+}
+
+func TestExampleFromSchema(t *testing.T) {
+	v := newOrdersValidator(t)
+
+	resp, matched, err := v.Example(http.MethodGet, "/api/orders/42", 0, "")
+	require.NoError(t, err)
+	require.True(t, matched)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, "application/json", resp.ContentType)
+
+	var order map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body, &order))
+	assert.Equal(t, float64(1000), order["id"])
+	assert.Equal(t, "user@example.com", order["email"])
+	assert.Equal(t, "pending", order["status"])
+	assert.Equal(t, 9.99, order["total"])
+	assert.Equal(t, []interface{}{"string", "string"}, order["items"])
+}
+
+func TestExampleSelection(t *testing.T) {
+	v := newOrdersValidator(t)
+
+	// The first named example, unless another is asked for
+	resp, _, err := v.Example(http.MethodGet, "/api/orders", 0, "")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(resp.Body))
+
+	resp, _, err = v.Example(http.MethodGet, "/api/orders", 0, "two")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id": 1}, {"id": 2}]`, string(resp.Body))
+
+	_, matched, err := v.Example(http.MethodGet, "/api/orders", 0, "missing")
+	assert.True(t, matched)
+	assert.Error(t, err)
+
+	resp, _, err = v.Example(http.MethodGet, "/api/orders/42", http.StatusNotFound, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+	assert.JSONEq(t, `{"error": "order not found"}`, string(resp.Body))
+
+	_, _, err = v.Example(http.MethodGet, "/api/orders/42", http.StatusTeapot, "")
+	assert.Error(t, err, "undocumented status")
+
+	resp, _, err = v.Example(http.MethodDelete, "/api/orders/42", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.Status)
+	assert.Nil(t, resp.Body)
+
+	_, matched, _ = v.Example(http.MethodGet, "/api/customers", 0, "")
+	assert.False(t, matched)
+}
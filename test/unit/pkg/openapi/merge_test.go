@@ -0,0 +1,96 @@
+package openapi
+
+import (
+	"testing"
+
+	"odin/pkg/openapi"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const billingSpec = `
+openapi: 3.0.3
+info:
+  title: Billing
+  version: "2.0"
+paths:
+  /invoices/{id}:
+    get:
+      tags: [invoices]
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        invoice:
+          type: string
+`
+
+func parseSpec(t *testing.T, source string) *openapi.Spec {
+	var spec openapi.Spec
+	require.NoError(t, yaml.Unmarshal([]byte(source), &spec))
+	return &spec
+}
+
+func TestAddSpec(t *testing.T) {
+	orders := parseSpec(t, ordersSpec)
+	billing := parseSpec(t, billingSpec)
+
+	g := openapi.NewGenerator("shop", "1.0.0", "")
+	require.NoError(t, g.AddSpec(orders, "/api/", "orders"))
+	require.NoError(t, g.AddSpec(billing, "/billing", "billing"))
+	spec := g.GetSpec()
+
+	// Paths are prefixed, and untagged operations tagged with their service
+	require.Contains(t, spec.Paths, "/api/orders/{id}")
+	assert.Equal(t, []string{"orders"}, spec.Paths["/api/orders/{id}"].Get.Tags)
+	assert.NotNil(t, spec.Paths["/api/orders/{id}"].Delete)
+	require.Contains(t, spec.Paths, "/billing/invoices/{id}")
+	invoice := spec.Paths["/billing/invoices/{id}"].Get
+	assert.Equal(t, []string{"invoices"}, invoice.Tags)
+
+	// A different schema of the same name is renamed, with its references
+	assert.Contains(t, spec.Components.Schemas["Order"].Properties, "email")
+	require.Contains(t, spec.Components.Schemas, "BillingOrder")
+	assert.Contains(t, spec.Components.Schemas["BillingOrder"].Properties, "invoice")
+	assert.Equal(t, "#/components/schemas/BillingOrder", invoice.Responses["200"].Content["application/json"].Schema.Ref)
+
+	// The specs of the services are left alone
+	assert.Contains(t, billing.Paths, "/invoices/{id}")
+	assert.Equal(t, "#/components/schemas/Order", billing.Paths["/invoices/{id}"].Get.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Empty(t, orders.Paths["/orders"].Get.Tags)
+
+	// Documenting an operation twice is refused
+	assert.Error(t, g.AddSpec(orders, "/api", "orders"))
+}
+
+func TestBodyExample(t *testing.T) {
+	spec := parseSpec(t, `
+openapi: 3.0.3
+info: {title: Orders, version: "1.0"}
+paths: {}
+`)
+	contentType, body, err := spec.BodyExample(&openapi.RequestBody{
+		Content: map[string]openapi.MediaType{
+			"text/plain":       {Example: "hello"},
+			"application/json": {Schema: &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"qty": {Type: "integer"}}}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	assert.JSONEq(t, `{"qty": 1}`, string(body))
+
+	contentType, body, err = spec.BodyExample(nil)
+	require.NoError(t, err)
+	assert.Empty(t, contentType)
+	assert.Nil(t, body)
+}
@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"odin/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const usersSpec = `
+openapi: 3.0.3
+info:
+  title: Users
+  version: "1.0"
+paths:
+  /users:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/NewUser'
+      responses:
+        "201":
+          description: Created
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+          minimum: 1
+    get:
+      parameters:
+        - name: fields
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [name, email]
+        - name: X-Tenant
+          in: header
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: OK
+  /users/me:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/NewUser'
+        4XX:
+          description: Client error
+components:
+  schemas:
+    NewUser:
+      type: object
+      required: [name, email]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          minLength: 2
+        email:
+          type: string
+          format: email
+        age:
+          type: integer
+          minimum: 0
+        tags:
+          type: array
+          maxItems: 2
+          items:
+            type: string
+`
+
+func loadValidator(t *testing.T) *openapi.Validator {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(usersSpec), 0644))
+
+	spec, err := openapi.LoadSpec(path)
+	require.NoError(t, err)
+	return openapi.NewValidator(spec, "/api")
+}
+
+func fields(errs []openapi.ValidationError) []string {
+	var result []string
+	for _, err := range errs {
+		result = append(result, err.In+":"+err.Field)
+	}
+	return result
+}
+
+func TestValidateBody(t *testing.T) {
+	v := loadValidator(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"A","email":"nope","age":1.5,"tags":["a","b","c"],"admin":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	errs, matched := v.Validate(req)
+
+	require.True(t, matched)
+	assert.ElementsMatch(t, []string{"body:name", "body:email", "body:age", "body:tags", "body:admin"}, fields(errs))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"Ada","email":"ada@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	errs, _ = v.Validate(req)
+	assert.Empty(t, errs)
+}
+
+func TestValidateMissingBodyAndContentType(t *testing.T) {
+	v := loadValidator(t)
+
+	errs, _ := v.Validate(httptest.NewRequest(http.MethodPost, "/api/users", nil))
+	assert.Equal(t, []string{"body:"}, fields(errs))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`name=ada`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	errs, _ = v.Validate(req)
+	assert.Equal(t, []string{"header:Content-Type"}, fields(errs))
+}
+
+func TestValidateParameters(t *testing.T) {
+	v := loadValidator(t)
+
+	errs, matched := v.Validate(httptest.NewRequest(http.MethodGet, "/api/users/0?fields=name,phone", nil))
+	require.True(t, matched)
+	assert.ElementsMatch(t, []string{"path:id", "query:fields[1]", "header:X-Tenant"}, fields(errs))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/42?fields=email", nil)
+	req.Header.Set("X-Tenant", "acme")
+	errs, _ = v.Validate(req)
+	assert.Empty(t, errs)
+
+	// Literal paths win over templated ones
+	errs, matched = v.Validate(httptest.NewRequest(http.MethodGet, "/api/users/me", nil))
+	assert.True(t, matched)
+	assert.Empty(t, errs)
+
+	_, matched = v.Validate(httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	assert.False(t, matched)
+}
+
+func TestMiddlewareRejectsInvalidRequests(t *testing.T) {
+	v := loadValidator(t)
+
+	e := echo.New()
+	e.Use(v.Middleware())
+	e.POST("/api/users", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"Ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var body struct {
+		Error   string                    `json:"error"`
+		Details []openapi.ValidationError `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Details, 1)
+	assert.Equal(t, "email", body.Details[0].Field)
+	assert.Equal(t, "is required", body.Details[0].Message)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"Ada","email":"ada@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestProbePaths(t *testing.T) {
+	v := loadValidator(t)
+
+	// /users has no GET and /users/{id} needs a path parameter
+	assert.Equal(t, []string{"/api/users/me"}, v.ProbePaths())
+}
+
+func TestValidateResponse(t *testing.T) {
+	v := loadValidator(t)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	errs, matched := v.ValidateResponse(http.MethodGet, "/api/users/me", http.StatusOK, header, []byte(`{"name":"Ada","email":"ada@example.com"}`))
+	require.True(t, matched)
+	assert.Empty(t, errs)
+
+	errs, _ = v.ValidateResponse(http.MethodGet, "/api/users/me", http.StatusOK, header, []byte(`{"name":"A"}`))
+	assert.ElementsMatch(t, []string{"body:name", "body:email"}, fields(errs))
+
+	// Documented by the 4XX range
+	errs, _ = v.ValidateResponse(http.MethodGet, "/api/users/me", http.StatusNotFound, header, []byte(`{"error":"gone"}`))
+	assert.Empty(t, errs)
+
+	errs, _ = v.ValidateResponse(http.MethodGet, "/api/users/me", http.StatusBadGateway, header, nil)
+	assert.Equal(t, []string{"status:"}, fields(errs))
+
+	_, matched = v.ValidateResponse(http.MethodGet, "/api/orders", http.StatusOK, header, nil)
+	assert.False(t, matched)
+}
@@ -0,0 +1,179 @@
+package overload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"odin/pkg/overload"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimiter(maxConcurrent, maxQueue int) *overload.Limiter {
+	return overload.NewLimiter(overload.LimiterConfig{
+		MaxConcurrent: maxConcurrent,
+		MaxQueue:      maxQueue,
+		MaxQueueTime:  time.Second,
+		TargetDelay:   5 * time.Millisecond,
+		Interval:      10 * time.Millisecond,
+	}, nil)
+}
+
+// acquireAsync queues a request and reports its outcome on the channel
+func acquireAsync(l *overload.Limiter, priority int) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), priority)
+		if err == nil {
+			defer release()
+		}
+		result <- err
+	}()
+	return result
+}
+
+func waitQueued(t *testing.T, l *overload.Limiter, queued int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return l.Stats().Queued == queued }, time.Second, time.Millisecond)
+}
+
+func TestLimiterAdmitsUpToMaxConcurrent(t *testing.T) {
+	l := newLimiter(2, 0)
+
+	release1, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+	release2, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+
+	_, err = l.Acquire(context.Background(), 0)
+	assert.ErrorIs(t, err, overload.ErrOverloaded)
+
+	release1()
+	release3, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+	release2()
+	release3()
+
+	stats := l.Stats()
+	assert.Equal(t, 0, stats.InFlight)
+	assert.Equal(t, uint64(3), stats.AdmittedTotal)
+	assert.Equal(t, uint64(1), stats.ShedTotal)
+}
+
+func TestLimiterQueuesUntilSlotIsReleased(t *testing.T) {
+	l := newLimiter(1, 1)
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+
+	result := acquireAsync(l, 0)
+	waitQueued(t, l, 1)
+
+	release()
+	assert.NoError(t, <-result)
+	assert.Equal(t, uint64(1), l.Stats().QueuedTotal)
+}
+
+func TestLimiterShedsLowerPriorityWhenQueueIsFull(t *testing.T) {
+	l := newLimiter(1, 1)
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+
+	low := acquireAsync(l, 0)
+	waitQueued(t, l, 1)
+
+	// An equally important request cannot displace the queued one
+	_, err = l.Acquire(context.Background(), 0)
+	assert.ErrorIs(t, err, overload.ErrOverloaded)
+
+	// A more important one can
+	high := acquireAsync(l, 10)
+	assert.ErrorIs(t, <-low, overload.ErrOverloaded)
+	waitQueued(t, l, 1)
+
+	release()
+	assert.NoError(t, <-high)
+}
+
+func TestLimiterAdmitsMostImportantFirst(t *testing.T) {
+	l := newLimiter(1, 2)
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+
+	low := acquireAsync(l, 0)
+	waitQueued(t, l, 1)
+	high := acquireAsync(l, 5)
+	waitQueued(t, l, 2)
+
+	release()
+	assert.NoError(t, <-high)
+	assert.NoError(t, <-low)
+}
+
+func TestLimiterShedsWhenWaitRunsOut(t *testing.T) {
+	l := overload.NewLimiter(overload.LimiterConfig{
+		MaxConcurrent: 1,
+		MaxQueue:      1,
+		MaxQueueTime:  10 * time.Millisecond,
+	}, nil)
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+	defer release()
+
+	_, err = l.Acquire(context.Background(), 0)
+	assert.ErrorIs(t, err, overload.ErrOverloaded)
+	assert.Equal(t, 0, l.Stats().Queued)
+}
+
+func TestLimiterShedsWhenContextIsDone(t *testing.T) {
+	l := newLimiter(1, 1)
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.Acquire(ctx, 0)
+	assert.ErrorIs(t, err, overload.ErrOverloaded)
+}
+
+func TestLimiterDetectsOverload(t *testing.T) {
+	var transitions []bool
+	l := overload.NewLimiter(overload.LimiterConfig{
+		MaxConcurrent: 1,
+		MaxQueue:      10,
+		MaxQueueTime:  time.Second,
+		TargetDelay:   time.Millisecond,
+		Interval:      5 * time.Millisecond,
+	}, func(overloaded bool) { transitions = append(transitions, overloaded) })
+
+	release, err := l.Acquire(context.Background(), 0)
+	require.NoError(t, err)
+
+	// Keep the queue delay above the target for longer than the interval
+	for i := 0; i < 2; i++ {
+		result := make(chan func(), 1)
+		go func() {
+			next, err := l.Acquire(context.Background(), 0)
+			if err == nil {
+				result <- next
+			}
+		}()
+		waitQueued(t, l, 1)
+		time.Sleep(6 * time.Millisecond)
+		release()
+		release = <-result
+	}
+	assert.True(t, l.Stats().Overloaded)
+
+	// An empty queue ends the overload
+	release()
+	assert.False(t, l.Stats().Overloaded)
+	assert.Equal(t, []bool{true, false}, transitions)
+}
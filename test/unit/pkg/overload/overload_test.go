@@ -0,0 +1,72 @@
+package overload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/overload"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardPriority(t *testing.T) {
+	guard := overload.New(config.OverloadConfig{
+		MaxConcurrent: 1,
+		Classes: []config.OverloadClass{
+			{Name: "health", Priority: -10, Paths: []string{"/api/health"}},
+			{Name: "checkout", Priority: 20, Services: []string{"orders"}, Methods: []string{"POST"}},
+			{Name: "premium", Priority: 10, Header: "X-Tier", HeaderValue: "premium"},
+		},
+	}, logrus.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/health/live", nil)
+	assert.Equal(t, -10, guard.Priority("orders", req))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+	assert.Equal(t, 20, guard.Priority("orders", req))
+	assert.Equal(t, 0, guard.Priority("users", req))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("X-Tier", "Premium")
+	assert.Equal(t, 10, guard.Priority("users", req))
+	req.Header.Set("X-Tier", "free")
+	assert.Equal(t, 0, guard.Priority("users", req))
+}
+
+func TestGuardMiddlewareSheds(t *testing.T) {
+	guard := overload.New(config.OverloadConfig{
+		MaxConcurrent: 1,
+		RetryAfter:    1500 * time.Millisecond,
+	}, logrus.New())
+
+	e := echo.New()
+	entered := make(chan struct{})
+	done := make(chan struct{})
+	handler := guard.Middleware("users")(func(c echo.Context) error {
+		close(entered)
+		<-done
+		return c.NoContent(http.StatusOK)
+	})
+
+	go func() {
+		rec := httptest.NewRecorder()
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+	}()
+	<-entered
+
+	rec := httptest.NewRecorder()
+	err := handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+	close(done)
+
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusServiceUnavailable, httpErr.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, uint64(1), guard.Stats().ShedTotal)
+}
@@ -0,0 +1,54 @@
+package plugins
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/plugins"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingPlugin counts the requests it sees
+type countingPlugin struct {
+	calls int
+}
+
+func (p *countingPlugin) Name() string                                               { return "counter" }
+func (p *countingPlugin) Version() string                                            { return "1.0.0" }
+func (p *countingPlugin) Initialize(map[string]interface{}) error                    { return nil }
+func (p *countingPlugin) PostRequest(context.Context, *plugins.PluginContext) error  { return nil }
+func (p *countingPlugin) PreResponse(context.Context, *plugins.PluginContext) error  { return nil }
+func (p *countingPlugin) PostResponse(context.Context, *plugins.PluginContext) error { return nil }
+func (p *countingPlugin) Cleanup() error                                             { return nil }
+
+func (p *countingPlugin) PreRequest(context.Context, *plugins.PluginContext) error {
+	p.calls++
+	return nil
+}
+
+func TestPluginGate(t *testing.T) {
+	manager := plugins.NewPluginManager(logrus.New())
+	plugin := &countingPlugin{}
+	require.NoError(t, manager.RegisterPlugin(plugin, nil, []string{"pre-request"}))
+	manager.SetGate("counter", func(c echo.Context) bool {
+		return c.Request().Header.Get("X-Beta") != ""
+	})
+
+	e := echo.New()
+	e.Use(manager.PluginMiddleware())
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, 0, plugin.calls)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Beta", "1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, 1, plugin.calls)
+}
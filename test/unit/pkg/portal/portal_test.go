@@ -0,0 +1,622 @@
+package portal
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/events"
+	"odin/pkg/mongodb"
+	"odin/pkg/openapi"
+	"odin/pkg/portal"
+	"odin/pkg/products"
+	"odin/pkg/ratelimit"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+// memoryStore keeps users, keys and metrics in memory
+type memoryStore struct {
+	mu      sync.Mutex
+	users   map[string]*mongodb.UserDocument
+	keys    []*mongodb.APIKeyDocument
+	metrics []*mongodb.MetricDocument
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{users: make(map[string]*mongodb.UserDocument)}
+}
+
+func (s *memoryStore) CreateUser(_ context.Context, user *mongodb.UserDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return fmt.Errorf("failed to create user: %w", mongodb.ErrDuplicate)
+		}
+	}
+	user.CreatedAt = time.Now()
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *memoryStore) GetUser(_ context.Context, id string) (*mongodb.UserDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (s *memoryStore) GetUserByUsername(_ context.Context, username string) (*mongodb.UserDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (s *memoryStore) CreateAPIKey(_ context.Context, key *mongodb.APIKeyDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.CreatedAt = time.Now()
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *memoryStore) ListAPIKeys(_ context.Context, userID string) ([]*mongodb.APIKeyDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []*mongodb.APIKeyDocument
+	for _, key := range s.keys {
+		if userID == "" || key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) UpdateAPIKey(_ context.Context, id string, key *mongodb.APIKeyDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, k := range s.keys {
+		if k.ID == id {
+			s.keys[i] = key
+			return nil
+		}
+	}
+	return errors.New("API key not found")
+}
+
+func (s *memoryStore) DeleteAPIKey(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range s.keys {
+		if key.ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("API key not found")
+}
+
+func (s *memoryStore) SaveMetric(_ context.Context, metric *mongodb.MetricDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metric.Timestamp = time.Now()
+	s.metrics = append(s.metrics, metric)
+	return nil
+}
+
+func (s *memoryStore) QueryMetrics(_ context.Context, name string, start, end time.Time, labels map[string]string) ([]*mongodb.MetricDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var metrics []*mongodb.MetricDocument
+	for _, metric := range s.metrics {
+		if metric.Name != name || metric.Timestamp.Before(start) || metric.Timestamp.After(end) {
+			continue
+		}
+		matches := true
+		for k, v := range labels {
+			matches = matches && metric.Labels[k] == v
+		}
+		if matches {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+func portalConfig() config.PortalConfig {
+	return config.PortalConfig{
+		Enabled:           true,
+		Path:              "/portal",
+		AllowRegistration: true,
+		TokenTTL:          time.Hour,
+		MaxKeysPerUser:    2,
+		DefaultPlans:      []string{"shop/free"},
+	}
+}
+
+func catalog() *products.Catalog {
+	return products.NewCatalog([]config.ProductConfig{
+		{
+			Name:     "shop",
+			Services: []string{"orders"},
+			Plans: []config.PlanConfig{
+				{Name: "free", Description: "Try it out", RateLimit: 2, Quota: 100, QuotaPeriod: "day"},
+			},
+		},
+		{
+			Name:     "suite",
+			Services: []string{"orders", "billing"},
+			Plans: []config.PlanConfig{
+				{Name: "partner", KeyTTL: 24 * time.Hour, QuotaPeriod: "month"},
+			},
+		},
+	})
+}
+
+func newPortal(t *testing.T, cfg config.PortalConfig, store portal.Store) (*portal.Portal, *echo.Echo) {
+	services := []portal.Service{
+		{Name: "orders", BasePath: "/orders", Spec: &openapi.Spec{OpenAPI: "3.0.0", Info: openapi.Info{Title: "orders", Version: "1.0.0"}}},
+		{Name: "billing", BasePath: "/billing"},
+	}
+	p, err := portal.New(cfg, catalog(), store, services, secret, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+
+	e := echo.New()
+	p.Register(e)
+	return p, e
+}
+
+func do(e *echo.Echo, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	return body
+}
+
+// register signs up a developer and returns their token and ID
+func register(t *testing.T, e *echo.Echo, username string) (string, string) {
+	rec := do(e, http.MethodPost, "/portal/api/register", "",
+		fmt.Sprintf(`{"username":%q,"email":"%s@example.com","password":"correct horse"}`, username, username))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	body := decode(t, rec)
+	return body["token"].(string), body["user"].(map[string]interface{})["id"].(string)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	_, e := newPortal(t, portalConfig(), newMemoryStore())
+
+	token, _ := register(t, e, "ada")
+
+	rec := do(e, http.MethodGet, "/portal/api/me", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	me := decode(t, rec)
+	assert.Equal(t, "ada", me["username"])
+	assert.Equal(t, []interface{}{"shop/free"}, me["plans"])
+	assert.NotContains(t, me, "password")
+
+	rec = do(e, http.MethodPost, "/portal/api/register", "", `{"username":"ada","email":"other@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = do(e, http.MethodPost, "/portal/api/register", "", `{"username":"a","email":"nope","password":"short"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, decode(t, rec)["details"], 3)
+
+	rec = do(e, http.MethodPost, "/portal/api/login", "", `{"username":"ada","password":"wrong password"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do(e, http.MethodPost, "/portal/api/login", "", `{"username":"ada","password":"correct horse"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, decode(t, rec)["token"])
+}
+
+func TestTokens(t *testing.T) {
+	store := newMemoryStore()
+	_, e := newPortal(t, portalConfig(), store)
+	token, id := register(t, e, "ada")
+
+	assert.Equal(t, http.StatusUnauthorized, do(e, http.MethodGet, "/portal/api/me", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(e, http.MethodGet, "/portal/api/me", "garbage", "").Code)
+
+	// Tokens signed with the gateway's JWT secret are not portal tokens
+	gatewayToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   id,
+		Audience:  jwt.ClaimStrings{"odin-portal"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, do(e, http.MethodGet, "/portal/api/me", gatewayToken, "").Code)
+
+	// Disabled users are locked out at once
+	store.users[id].Active = false
+	assert.Equal(t, http.StatusUnauthorized, do(e, http.MethodGet, "/portal/api/me", token, "").Code)
+	rec := do(e, http.MethodPost, "/portal/api/login", "", `{"username":"ada","password":"correct horse"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestRegistrationDisabled(t *testing.T) {
+	cfg := portalConfig()
+	cfg.AllowRegistration = false
+	_, e := newPortal(t, cfg, newMemoryStore())
+
+	rec := do(e, http.MethodPost, "/portal/api/register", "", `{"username":"ada","email":"ada@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestCatalog(t *testing.T) {
+	_, e := newPortal(t, portalConfig(), newMemoryStore())
+
+	rec := do(e, http.MethodGet, "/portal/api/products", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var offered []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &offered))
+	require.Len(t, offered, 2)
+	assert.Equal(t, "shop", offered[0]["name"])
+	assert.Equal(t, []interface{}{"orders"}, offered[0]["services"])
+	free := offered[0]["plans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "shop/free", free["id"])
+	assert.Equal(t, float64(2), free["rateLimit"])
+	assert.Equal(t, float64(100), free["quota"])
+	assert.Equal(t, "day", free["quotaPeriod"])
+	partner := offered[1]["plans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "24h0m0s", partner["keyTTL"])
+	assert.NotContains(t, partner, "quotaPeriod")
+
+	rec = do(e, http.MethodGet, "/portal/api/services", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var services []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &services))
+	require.Len(t, services, 2)
+	assert.Equal(t, "billing", services[0]["name"])
+	assert.Equal(t, []interface{}{"suite"}, services[0]["products"])
+	assert.Equal(t, []interface{}{"shop", "suite"}, services[1]["products"])
+
+	rec = do(e, http.MethodGet, "/portal/api/services/orders/openapi", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3.0.0", decode(t, rec)["openapi"])
+
+	assert.Equal(t, http.StatusNotFound, do(e, http.MethodGet, "/portal/api/services/billing/openapi", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(e, http.MethodGet, "/portal/api/services/admin/openapi", "", "").Code)
+}
+
+func TestKeys(t *testing.T) {
+	store := newMemoryStore()
+	_, e := newPortal(t, portalConfig(), store)
+	token, id := register(t, e, "ada")
+
+	rec := do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"ci","plan":"shop/free"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := decode(t, rec)
+	assert.Equal(t, "shop/free", created["plan"])
+	key := created["key"].(string)
+	assert.True(t, strings.HasPrefix(key, "odin_"))
+	assert.Equal(t, key[:8], created["prefix"])
+	assert.NotContains(t, created, "expiresAt")
+
+	require.Len(t, store.keys, 1)
+	doc := store.keys[0]
+	assert.Equal(t, id, doc.UserID)
+	assert.Equal(t, []string{"orders"}, doc.Permissions)
+	assert.Equal(t, 2, doc.RateLimit)
+	assert.True(t, doc.Enabled)
+	assert.Equal(t, "shop/free", doc.Plan)
+	assert.Equal(t, "portal", doc.Metadata["source"])
+
+	// Plans must be granted before keys can be subscribed to them
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"prod","plan":"suite/partner"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"prod","plan":"free"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"plan":"shop/free"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	store.users[id].Plans = []string{"suite/partner"}
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"prod","plan":"suite/partner"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, decode(t, rec), "expiresAt")
+	assert.Equal(t, []string{"orders", "billing"}, store.keys[1].Permissions)
+
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"third","plan":"shop/free"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Listed keys show only their prefix
+	rec = do(e, http.MethodGet, "/portal/api/keys", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), key)
+	var keys []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &keys))
+	assert.Len(t, keys, 2)
+
+	// Developers cannot see or delete each other's keys
+	other, _ := register(t, e, "grace")
+	rec = do(e, http.MethodGet, "/portal/api/keys", other, "")
+	assert.Equal(t, "[]\n", rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, do(e, http.MethodDelete, "/portal/api/keys/"+doc.ID, other, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, do(e, http.MethodDelete, "/portal/api/keys/"+doc.ID, token, "").Code)
+	assert.Len(t, store.keys, 1)
+}
+
+func TestProductBundle(t *testing.T) {
+	orders := &openapi.Spec{
+		OpenAPI: "3.0.0",
+		Info:    openapi.Info{Title: "orders", Version: "1.0.0"},
+		Paths: map[string]openapi.PathItem{
+			"/orders": {Get: &openapi.Operation{Summary: "List orders", Responses: map[string]openapi.Response{"200": {Description: "OK"}}}},
+		},
+	}
+	billing := &openapi.Spec{
+		OpenAPI: "3.0.0",
+		Info:    openapi.Info{Title: "billing", Version: "1.0.0"},
+		Paths: map[string]openapi.PathItem{
+			"/invoices": {Get: &openapi.Operation{Summary: "List invoices", Responses: map[string]openapi.Response{"200": {Description: "OK"}}}},
+		},
+	}
+	services := []portal.Service{
+		{Name: "orders", BasePath: "/orders", Spec: orders},
+		{Name: "billing", BasePath: "/billing", Spec: billing, PathPrefix: "/billing"},
+	}
+	p, err := portal.New(portalConfig(), catalog(), newMemoryStore(), services, secret, logrus.New())
+	require.NoError(t, err)
+	t.Cleanup(p.Stop)
+	p.SetAPIKeyHeader("X-Key")
+	e := echo.New()
+	p.Register(e)
+
+	// The product's spec has the paths of all its services at the gateway
+	rec := do(e, http.MethodGet, "/portal/api/products/suite/openapi", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var spec openapi.Spec
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	assert.Equal(t, "suite", spec.Info.Title)
+	assert.Contains(t, spec.Paths, "/orders")
+	assert.Contains(t, spec.Paths, "/billing/invoices")
+	assert.Equal(t, []string{"billing"}, spec.Paths["/billing/invoices"].Get.Tags)
+	assert.Equal(t, "http://example.com", spec.Servers[0].URL)
+
+	// Products only document their own services
+	spec2, err := p.ProductSpec("shop")
+	require.NoError(t, err)
+	assert.NotContains(t, spec2.Paths, "/billing/invoices")
+
+	rec = do(e, http.MethodGet, "/portal/api/products/suite/bundle", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), `filename="suite-bundle.zip"`)
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	require.NoError(t, err)
+	files := make(map[string][]byte)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+	}
+	require.Contains(t, files, "openapi.json")
+	require.Contains(t, files, "suite.postman_collection.json")
+	require.Contains(t, files, "suite.postman_environment.json")
+
+	// The collection is generated from the bundled spec
+	var collection struct {
+		Auth struct {
+			APIKey []map[string]string `json:"apikey"`
+		} `json:"auth"`
+		Item []struct {
+			Name string `json:"name"`
+		} `json:"item"`
+	}
+	require.NoError(t, json.Unmarshal(files["suite.postman_collection.json"], &collection))
+	assert.Contains(t, collection.Auth.APIKey, map[string]string{"key": "key", "value": "X-Key", "type": "string"})
+	require.Len(t, collection.Item, 2)
+	assert.Equal(t, "billing", collection.Item[0].Name)
+	assert.Equal(t, "orders", collection.Item[1].Name)
+	assert.Contains(t, string(files["suite.postman_environment.json"]), `"value": "http://example.com"`)
+
+	assert.Equal(t, http.StatusNotFound, do(e, http.MethodGet, "/portal/api/products/missing/bundle", "", "").Code)
+}
+
+// recorder keeps the events published to it
+type recorder struct {
+	mu     sync.Mutex
+	events []events.EventType
+	data   []map[string]interface{}
+}
+
+func (r *recorder) Publish(eventType events.EventType, data map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, eventType)
+	r.data = append(r.data, data)
+}
+
+func TestKeyApproval(t *testing.T) {
+	store := newMemoryStore()
+	cfg := portalConfig()
+	cfg.RequireApproval = true
+	p, e := newPortal(t, cfg, store)
+	published := &recorder{}
+	p.SetEventPublisher(published)
+	token, _ := register(t, e, "ada")
+
+	rec := do(e, http.MethodGet, "/portal/api/products", "", "")
+	assert.Contains(t, rec.Body.String(), `"requireApproval":true`)
+
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"ci","plan":"shop/free"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Equal(t, mongodb.APIKeyPending, decode(t, rec)["status"])
+	require.Len(t, store.keys, 1)
+	pending := store.keys[0]
+	assert.False(t, pending.Approved())
+	require.Equal(t, []events.EventType{events.APIKeyRequested}, published.events)
+	assert.Equal(t, "ada", published.data[0]["username"])
+	assert.Equal(t, "ada@example.com", published.data[0]["email"])
+
+	ctx := context.Background()
+	keys, err := p.Keys(ctx, mongodb.APIKeyPending)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	approved, err := p.Approve(ctx, pending.ID, "ops")
+	require.NoError(t, err)
+	assert.Equal(t, mongodb.APIKeyApproved, approved.Status)
+	assert.Equal(t, "ops", approved.ReviewedBy)
+	assert.NotNil(t, approved.ReviewedAt)
+	assert.True(t, store.keys[0].Approved())
+	assert.Equal(t, events.APIKeyApproved, published.events[1])
+
+	// Only pending keys can be reviewed
+	_, err = p.Reject(ctx, pending.ID, "ops", "too late")
+	assert.ErrorIs(t, err, portal.ErrNotPending)
+	_, err = p.Approve(ctx, "missing", "ops")
+	assert.ErrorIs(t, err, portal.ErrKeyNotFound)
+
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"prod","plan":"shop/free"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rejected, err := p.Reject(ctx, decode(t, rec)["id"].(string), "ops", "use the ci key")
+	require.NoError(t, err)
+	assert.Equal(t, mongodb.APIKeyRejected, rejected.Status)
+	assert.Equal(t, events.APIKeyRejected, published.events[3])
+	assert.Equal(t, "use the ci key", published.data[3]["reason"])
+
+	// Developers see why their key was rejected
+	rec = do(e, http.MethodGet, "/portal/api/keys", token, "")
+	assert.Contains(t, rec.Body.String(), `"rejectReason":"use the ci key"`)
+
+	keys, err = p.Keys(ctx, mongodb.APIKeyApproved)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+// service serves name behind an authentication middleware that accepts the
+// API keys in store, the portal's middleware and plan enforcement, as the
+// router does
+func service(e *echo.Echo, p *portal.Portal, store *memoryStore, name string) {
+	group := e.Group("/" + name)
+	group.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			keys, _ := store.ListAPIKeys(context.Background(), "")
+			for _, key := range keys {
+				if key.Key == c.Request().Header.Get("X-API-Key") {
+					c.Set("apiKey", key)
+					return next(c)
+				}
+			}
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API key")
+		}
+	})
+	group.Use(p.Middleware(name))
+	group.Use(products.NewEnforcer(catalog(), ratelimit.NewMemoryCounter(), logrus.New()).Middleware(name))
+	group.GET("/fail", func(c echo.Context) error {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "upstream failed"})
+	})
+	group.GET("/ok", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"service": name})
+	})
+}
+
+func call(e *echo.Echo, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUsage(t *testing.T) {
+	store := newMemoryStore()
+	p, e := newPortal(t, portalConfig(), store)
+	service(e, p, store, "orders")
+	service(e, p, store, "billing")
+
+	token, id := register(t, e, "ada")
+	store.users[id].Plans = []string{"suite/partner"}
+	rec := do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"prod","plan":"suite/partner"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	created := decode(t, rec)
+	key, keyID := created["key"].(string), created["id"].(string)
+
+	call(e, "/orders/ok", key)
+	call(e, "/orders/fail", key)
+	call(e, "/billing/ok", key)
+
+	// Requests rejected by the key's plan count as errors
+	rec = do(e, http.MethodPost, "/portal/api/keys", token, `{"name":"ci","plan":"shop/free"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, http.StatusForbidden, call(e, "/billing/ok", decode(t, rec)["key"].(string)).Code)
+
+	// Other developers' usage is not reported
+	other, _ := register(t, e, "grace")
+	rec = do(e, http.MethodPost, "/portal/api/keys", other, `{"name":"ci","plan":"shop/free"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	call(e, "/orders/ok", decode(t, rec)["key"].(string))
+
+	p.Stop()
+	require.Len(t, store.metrics, 4)
+
+	rec = do(e, http.MethodGet, "/portal/api/usage", token, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	usage := decode(t, rec)
+	assert.Equal(t, float64(4), usage["requests"])
+	assert.Equal(t, float64(2), usage["errors"])
+	assert.Equal(t, map[string]interface{}{"requests": float64(2), "errors": float64(1)}, usage["services"].(map[string]interface{})["orders"])
+	assert.Equal(t, map[string]interface{}{"requests": float64(2), "errors": float64(1)}, usage["services"].(map[string]interface{})["billing"])
+	assert.Equal(t, map[string]interface{}{"requests": float64(3), "errors": float64(1)}, usage["keys"].(map[string]interface{})[keyID])
+	today := time.Now().UTC().Format(time.DateOnly)
+	assert.Contains(t, usage["days"], today)
+
+	rec = do(e, http.MethodGet, "/portal/api/usage?key="+keyID, token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(3), decode(t, rec)["requests"])
+
+	rec = do(e, http.MethodGet, "/portal/api/usage?to=2020-01-01", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(0), decode(t, rec)["requests"])
+
+	assert.Equal(t, http.StatusBadRequest, do(e, http.MethodGet, "/portal/api/usage?from=yesterday", token, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(e, http.MethodGet, "/portal/api/usage?from=2026-02-01&to=2026-01-01", token, "").Code)
+}
+
+func TestNewRequiresSecret(t *testing.T) {
+	_, err := portal.New(portalConfig(), catalog(), newMemoryStore(), nil, "", logrus.New())
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package postman
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"odin/pkg/integrations/postman"
+	"odin/pkg/openapi"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ordersSpec = `{
+	"openapi": "3.0.3",
+	"info": {"title": "shop", "version": "1.0.0", "description": "Orders and billing"},
+	"paths": {
+		"/api/orders": {
+			"get": {
+				"summary": "List orders",
+				"tags": ["orders"],
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "example": 10}},
+					{"name": "status", "in": "query", "required": true, "schema": {"type": "string", "example": "open"}}
+				],
+				"responses": {"200": {"description": "OK"}}
+			},
+			"post": {
+				"operationId": "createOrder",
+				"tags": ["orders"],
+				"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Order"}}}},
+				"responses": {"201": {"description": "Created"}}
+			}
+		},
+		"/api/orders/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "example": 42}}],
+			"delete": {
+				"tags": ["orders"],
+				"parameters": [{"name": "X-Reason", "in": "header", "schema": {"type": "string"}}],
+				"responses": {"204": {"description": "Deleted"}}
+			}
+		},
+		"/health": {
+			"get": {"responses": {"200": {"description": "OK"}}}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Order": {"type": "object", "properties": {"sku": {"type": "string", "example": "A-1"}}}
+		}
+	}
+}`
+
+func TestOpenAPIToPostman(t *testing.T) {
+	var spec openapi.Spec
+	require.NoError(t, json.Unmarshal([]byte(ordersSpec), &spec))
+
+	collection, err := postman.NewTransformer().OpenAPIToPostman(&spec, "X-API-Key")
+	require.NoError(t, err)
+	assert.Equal(t, "shop", collection.Info.Name)
+	assert.Equal(t, "1.0.0", collection.Info.Version)
+
+	// Requests authenticate with the API key variable
+	require.NotNil(t, collection.Auth)
+	assert.Equal(t, "apikey", collection.Auth.Type)
+	assert.Contains(t, collection.Auth.APIKey, postman.AuthAttribute{Key: "key", Value: "X-API-Key", Type: "string"})
+	assert.Contains(t, collection.Auth.APIKey, postman.AuthAttribute{Key: "value", Value: "{{apiKey}}", Type: "string"})
+
+	// Untagged operations come first, then a folder per tag
+	require.Len(t, collection.Item, 2)
+	assert.Equal(t, "GET /health", collection.Item[0].Name)
+	folder := collection.Item[1]
+	assert.Equal(t, "orders", folder.Name)
+	require.Len(t, folder.Item, 3)
+
+	list := folder.Item[0].Request
+	assert.Equal(t, "List orders", folder.Item[0].Name)
+	assert.Equal(t, http.MethodGet, list.Method)
+	assert.Equal(t, "{{baseUrl}}/api/orders?status=open", list.URL.Raw)
+	assert.Equal(t, []string{"{{baseUrl}}"}, list.URL.Host)
+	require.Len(t, list.URL.Query, 2)
+	assert.True(t, list.URL.Query[0].Disabled, "optional parameters are disabled")
+	assert.Equal(t, "10", list.URL.Query[0].Value)
+
+	create := folder.Item[1]
+	assert.Equal(t, "createOrder", create.Name)
+	require.NotNil(t, create.Request.Body)
+	assert.JSONEq(t, `{"sku": "A-1"}`, create.Request.Body.Raw)
+	assert.Contains(t, create.Request.Header, postman.Header{Key: "Content-Type", Value: "application/json"})
+
+	// Path parameters, including those shared by the path, become variables
+	remove := folder.Item[2].Request
+	assert.Equal(t, []string{"api", "orders", ":id"}, remove.URL.Path)
+	assert.Equal(t, []postman.Variable{{Key: "id", Value: "42"}}, remove.URL.Variable)
+	require.Len(t, remove.Header, 1)
+	assert.Equal(t, "X-Reason", remove.Header[0].Key)
+	assert.True(t, remove.Header[0].Disabled)
+
+	_, err = postman.NewTransformer().OpenAPIToPostman(nil, "")
+	assert.Error(t, err)
+}
+
+func TestOpenAPIEnvironment(t *testing.T) {
+	env := postman.NewTransformer().OpenAPIEnvironment("shop", "https://api.example.com/")
+	assert.Equal(t, "shop", env.Name)
+	require.Len(t, env.Values, 2)
+	assert.Equal(t, postman.EnvValue{Key: "baseUrl", Value: "https://api.example.com", Type: "default", Enabled: true}, env.Values[0])
+	assert.Equal(t, "apiKey", env.Values[1].Key)
+	assert.Empty(t, env.Values[1].Value)
+}
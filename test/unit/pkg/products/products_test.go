@@ -0,0 +1,178 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+	"odin/pkg/products"
+	"odin/pkg/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func catalog() *products.Catalog {
+	return products.NewCatalog([]config.ProductConfig{
+		{
+			Name:     "commerce",
+			Services: []string{"orders", "billing"},
+			Plans: []config.PlanConfig{
+				{Name: "free", RateLimit: 2, Quota: 3, QuotaPeriod: "day"},
+				{Name: "enterprise"},
+			},
+		},
+		{
+			Name:     "shipping",
+			Services: []string{"shipments", "orders"},
+			Plans:    []config.PlanConfig{{Name: "pro", Quota: 1, QuotaPeriod: "month"}},
+		},
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	c := catalog()
+
+	require.Len(t, c.Products(), 2)
+	assert.Equal(t, "commerce", c.Products()[0].Name)
+	assert.Equal(t, []string{"orders", "billing", "shipments"}, c.Services())
+
+	plan, ok := c.Plan("commerce/free")
+	require.True(t, ok)
+	assert.Equal(t, "commerce/free", plan.ID)
+	assert.Equal(t, "free", plan.Name)
+	assert.Equal(t, "commerce", plan.Product.Name)
+	assert.True(t, plan.Includes("billing"))
+	assert.False(t, plan.Includes("shipments"))
+
+	_, ok = c.Plan("free")
+	assert.False(t, ok)
+	assert.Equal(t, "shipping/pro", products.PlanID("shipping", "pro"))
+}
+
+// newGateway serves the services of the catalog behind an authentication
+// middleware that accepts the keys in keys, and plan enforcement
+func newGateway(counter ratelimit.Counter, keys map[string]*mongodb.APIKeyDocument) *echo.Echo {
+	e := echo.New()
+	enforcer := products.NewEnforcer(catalog(), counter, logrus.New())
+	for _, name := range []string{"orders", "billing", "shipments"} {
+		group := e.Group("/" + name)
+		group.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				key, ok := keys[c.Request().Header.Get("X-API-Key")]
+				if !ok {
+					return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API key")
+				}
+				c.Set("apiKey", key)
+				return next(c)
+			}
+		})
+		group.Use(enforcer.Middleware(name))
+		group.GET("/ok", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+		})
+	}
+	return e
+}
+
+func call(e *echo.Echo, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPlanServices(t *testing.T) {
+	e := newGateway(ratelimit.NewMemoryCounter(), map[string]*mongodb.APIKeyDocument{
+		"enterprise": {ID: "1", Plan: "commerce/enterprise"},
+		"removed":    {ID: "2", Plan: "commerce/gold"},
+		"admin":      {ID: "3"},
+	})
+
+	assert.Equal(t, http.StatusOK, call(e, "/orders/ok", "enterprise").Code)
+	assert.Equal(t, http.StatusOK, call(e, "/billing/ok", "enterprise").Code)
+	assert.Equal(t, http.StatusForbidden, call(e, "/shipments/ok", "enterprise").Code)
+
+	// Keys of plans no longer configured are rejected
+	assert.Equal(t, http.StatusForbidden, call(e, "/orders/ok", "removed").Code)
+
+	// Keys without a plan are left alone
+	for i := 0; i < 5; i++ {
+		rec := call(e, "/shipments/ok", "admin")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	e := newGateway(ratelimit.NewMemoryCounter(), map[string]*mongodb.APIKeyDocument{
+		"free":  {ID: "1", Plan: "commerce/free"},
+		"other": {ID: "2", Plan: "commerce/free"},
+	})
+
+	rec := call(e, "/orders/ok", "free")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("X-RateLimit-Reset"))
+
+	// The limit applies to the key across the product's services. The
+	// minute may turn over between requests, which allows one more.
+	assert.Equal(t, http.StatusOK, call(e, "/billing/ok", "free").Code)
+	rec = call(e, "/orders/ok", "free")
+	if rec.Code == http.StatusOK {
+		rec = call(e, "/orders/ok", "free")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, call(e, "/orders/ok", "other").Code)
+}
+
+func TestQuota(t *testing.T) {
+	e := newGateway(ratelimit.NewMemoryCounter(), map[string]*mongodb.APIKeyDocument{
+		"pro": {ID: "1", Plan: "shipping/pro"},
+	})
+
+	rec := call(e, "/shipments/ok", "pro")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Quota-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("X-Quota-Remaining"))
+	_, end := ratelimit.Window(ratelimit.PeriodMonth, time.Now())
+	assert.Equal(t, strconv.FormatInt(end.Unix(), 10), rec.Header().Get("X-Quota-Reset"))
+
+	rec = call(e, "/orders/ok", "pro")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Quota exceeded")
+}
+
+type failingCounter struct{}
+
+func (failingCounter) Increment(context.Context, string, time.Time, time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingCounter) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestCounterFailure(t *testing.T) {
+	e := newGateway(failingCounter{}, map[string]*mongodb.APIKeyDocument{
+		"free":       {ID: "1", Plan: "commerce/free"},
+		"enterprise": {ID: "2", Plan: "commerce/enterprise"},
+	})
+
+	// Limits fail closed, but plans without limits do not need the counter
+	assert.Equal(t, http.StatusServiceUnavailable, call(e, "/orders/ok", "free").Code)
+	assert.Equal(t, http.StatusOK, call(e, "/orders/ok", "enterprise").Code)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"odin/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 30, 45, 0, time.FixedZone("CEST", 2*60*60))
+
+	start, end := ratelimit.Window(ratelimit.PeriodMinute, now)
+	assert.Equal(t, time.Date(2026, 10, 16, 7, 30, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Minute, end.Sub(start))
+
+	// Days and months start at midnight UTC
+	start, end = ratelimit.Window(ratelimit.PeriodDay, now)
+	assert.Equal(t, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = ratelimit.Window(ratelimit.PeriodMonth, time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestCheckWindow(t *testing.T) {
+	ctx := context.Background()
+	counter := ratelimit.NewMemoryCounter()
+	now := time.Now()
+
+	info, allowed, err := ratelimit.CheckWindow(ctx, counter, "key", 2, ratelimit.PeriodDay, now)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 2, info.Limit)
+	assert.Equal(t, 1, info.Remaining)
+	_, end := ratelimit.Window(ratelimit.PeriodDay, now)
+	assert.Equal(t, end, info.ResetTime)
+
+	_, allowed, _ = ratelimit.CheckWindow(ctx, counter, "key", 2, ratelimit.PeriodDay, now)
+	assert.True(t, allowed)
+	info, allowed, _ = ratelimit.CheckWindow(ctx, counter, "key", 2, ratelimit.PeriodDay, now)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, info.Remaining)
+
+	// Keys are counted apart, and the next window starts over
+	_, allowed, _ = ratelimit.CheckWindow(ctx, counter, "other", 2, ratelimit.PeriodDay, now)
+	assert.True(t, allowed)
+	info, allowed, _ = ratelimit.CheckWindow(ctx, counter, "key", 2, ratelimit.PeriodDay, now.Add(24*time.Hour))
+	assert.True(t, allowed)
+	assert.Equal(t, 1, info.Remaining)
+}
+
+func TestMemoryCounterSeed(t *testing.T) {
+	ctx := context.Background()
+	counter := ratelimit.NewMemoryCounter()
+	start, end := ratelimit.Window(ratelimit.PeriodDay, time.Now())
+
+	require.NoError(t, counter.Seed(ctx, "key", 5, start, end))
+	count, err := counter.Increment(ctx, "key", start, end)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), count)
+
+	// Windows counted already are left alone
+	require.NoError(t, counter.Seed(ctx, "key", 1, start, end))
+	count, _ = counter.Increment(ctx, "key", start, end)
+	assert.Equal(t, int64(7), count)
+}
@@ -2,6 +2,7 @@ package ratelimit
 
 import (
 	"context"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -125,22 +126,105 @@ func TestLimiter_CheckLimit_FixedWindow(t *testing.T) {
 	key := "test-key"
 	ctx := context.Background()
 
-	// For local testing without Redis, the implementation returns consistent values
-	// First request - should be allowed
+	// Without Redis, requests are counted in memory
 	limitInfo1, allowed1 := limiter.CheckLimit(ctx, key, rule)
 	assert.True(t, allowed1)
 	assert.Equal(t, 2, limitInfo1.Limit)
-	assert.Equal(t, 1, limitInfo1.Remaining) // Implementation returns limit - 1
+	assert.Equal(t, 1, limitInfo1.Remaining)
 
-	// Second request - should be allowed (same key returns same result without Redis)
 	limitInfo2, allowed2 := limiter.CheckLimit(ctx, key, rule)
 	assert.True(t, allowed2)
-	assert.Equal(t, 1, limitInfo2.Remaining) // Same as above without Redis storage
+	assert.Equal(t, 0, limitInfo2.Remaining)
 
-	// Since we don't have Redis, all requests will be allowed in the current implementation
 	limitInfo3, allowed3 := limiter.CheckLimit(ctx, key, rule)
-	assert.True(t, allowed3) // Changed expectation to match implementation
-	assert.Equal(t, 1, limitInfo3.Remaining)
+	assert.False(t, allowed3)
+	assert.Equal(t, 0, limitInfo3.Remaining)
+	assert.Positive(t, limitInfo3.RetryAfter)
+
+	// Other keys have their own window
+	_, allowed := limiter.CheckLimit(ctx, "other-key", rule)
+	assert.True(t, allowed)
+}
+
+func TestLimiter_CheckLimit_SlidingWindow(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(ratelimit.Config{
+		Algorithm:     ratelimit.AlgorithmSlidingWindow,
+		DefaultLimit:  3,
+		DefaultWindow: time.Hour,
+	}, logrus.New())
+	require.NoError(t, err)
+
+	rule := &ratelimit.Rule{}
+	ctx := context.Background()
+	for i := 2; i >= 0; i-- {
+		info, allowed := limiter.CheckLimit(ctx, "client", rule)
+		require.True(t, allowed)
+		assert.Equal(t, i, info.Remaining)
+	}
+
+	// Rejected requests are not counted against the client
+	for i := 0; i < 3; i++ {
+		info, allowed := limiter.CheckLimit(ctx, "client", rule)
+		assert.False(t, allowed)
+		assert.Equal(t, 0, info.Remaining)
+		assert.Positive(t, info.RetryAfter)
+		assert.LessOrEqual(t, info.RetryAfter, 2*time.Hour)
+	}
+}
+
+func TestLimiter_CheckLimit_TokenBucket(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(ratelimit.Config{
+		Algorithm:     ratelimit.AlgorithmTokenBucket,
+		DefaultLimit:  10,
+		DefaultWindow: time.Second,
+		BurstSize:     2,
+	}, logrus.New())
+	require.NoError(t, err)
+
+	rule := &ratelimit.Rule{}
+	ctx := context.Background()
+
+	// The burst goes through at once, then tokens come back at 10 a second
+	_, allowed := limiter.CheckLimit(ctx, "client", rule)
+	assert.True(t, allowed)
+	_, allowed = limiter.CheckLimit(ctx, "client", rule)
+	assert.True(t, allowed)
+	info, allowed := limiter.CheckLimit(ctx, "client", rule)
+	assert.False(t, allowed)
+	assert.Equal(t, 2, info.Limit)
+	assert.Equal(t, 0, info.Remaining)
+	assert.LessOrEqual(t, info.RetryAfter, 100*time.Millisecond)
+
+	time.Sleep(info.RetryAfter + 10*time.Millisecond)
+	_, allowed = limiter.CheckLimit(ctx, "client", rule)
+	assert.True(t, allowed)
+}
+
+func TestLimiter_MiddlewareHeaders(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(ratelimit.Config{
+		Enabled:         true,
+		Algorithm:       ratelimit.AlgorithmSlidingWindow,
+		DefaultLimit:    1,
+		DefaultWindow:   time.Minute,
+		ResponseHeaders: true,
+	}, logrus.New())
+	require.NoError(t, err)
+
+	e := echo.New()
+	handler := limiter.Middleware()(func(c echo.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler(e.NewContext(httptest.NewRequest("GET", "/api/users", nil), rec)))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("X-RateLimit-Reset"))
+
+	rec = httptest.NewRecorder()
+	err = handler(e.NewContext(httptest.NewRequest("GET", "/api/users", nil), rec))
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusTooManyRequests, httpErr.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
 }
 
 func TestLimiter_MatchesRule(t *testing.T) {
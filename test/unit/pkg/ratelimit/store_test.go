@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"odin/pkg/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	store := ratelimit.NewMemoryStore()
+	start := time.Now().Truncate(time.Minute)
+
+	for i := 0; i < 4; i++ {
+		_, _, allowed, err := store.SlidingWindow(ctx, "key", start, time.Minute, 1, 4)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	_, _, allowed, _ := store.SlidingWindow(ctx, "key", start, time.Minute, 1, 4)
+	assert.False(t, allowed)
+
+	// Halfway through the next window, the previous one counts for half
+	next := start.Add(time.Minute)
+	previous, current, allowed, _ := store.SlidingWindow(ctx, "key", next, time.Minute, 0.5, 4)
+	assert.True(t, allowed)
+	assert.Equal(t, int64(4), previous)
+	assert.Equal(t, int64(1), current)
+	_, _, allowed, _ = store.SlidingWindow(ctx, "key", next, time.Minute, 0.5, 4)
+	assert.True(t, allowed)
+	_, _, allowed, _ = store.SlidingWindow(ctx, "key", next, time.Minute, 0.5, 4)
+	assert.False(t, allowed)
+
+	// Windows further back are forgotten
+	previous, current, allowed, _ = store.SlidingWindow(ctx, "key", next.Add(2*time.Minute), time.Minute, 1, 4)
+	assert.True(t, allowed)
+	assert.Equal(t, int64(0), previous)
+	assert.Equal(t, int64(1), current)
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	store := ratelimit.NewMemoryStore()
+	now := time.Now()
+
+	tokens, allowed, err := store.TokenBucket(ctx, "key", 1, 2, now)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 1.0, tokens)
+	_, allowed, _ = store.TokenBucket(ctx, "key", 1, 2, now)
+	assert.True(t, allowed)
+	_, allowed, _ = store.TokenBucket(ctx, "key", 1, 2, now)
+	assert.False(t, allowed)
+
+	// A token a second comes back, up to the burst
+	tokens, allowed, _ = store.TokenBucket(ctx, "key", 1, 2, now.Add(1500*time.Millisecond))
+	assert.True(t, allowed)
+	assert.InDelta(t, 0.5, tokens, 0.001)
+	tokens, _, _ = store.TokenBucket(ctx, "key", 1, 2, now.Add(time.Hour))
+	assert.Equal(t, 1.0, tokens)
+}
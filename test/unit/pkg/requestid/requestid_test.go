@@ -0,0 +1,107 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/requestid"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve sends a request with the inbound ID from remoteAddr and returns the
+// ID handlers saw, the one sent upstream and the one returned to the client
+func serve(t *testing.T, cfg config.RequestIDConfig, remoteAddr, inbound string) (seen, upstream, returned string) {
+	t.Helper()
+	generator, err := requestid.New(cfg)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Pre(generator.Middleware())
+	e.GET("/", func(c echo.Context) error {
+		seen = requestid.Get(c)
+		assert.Equal(t, seen, requestid.FromContext(c.Request().Context()))
+		upstream = c.Request().Header.Get(generator.Header())
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if inbound != "" {
+		req.Header.Set(generator.Header(), inbound)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return seen, upstream, rec.Header().Get(generator.Header())
+}
+
+func TestRequestIDFormats(t *testing.T) {
+	for format, pattern := range map[string]string{
+		"":       `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"uuidv7": `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"ulid":   `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`,
+	} {
+		id, upstream, returned := serve(t, config.RequestIDConfig{Format: format}, "192.0.2.1:1234", "")
+		assert.Regexp(t, regexp.MustCompile(pattern), id, format)
+		assert.Equal(t, id, upstream)
+		assert.Equal(t, id, returned)
+	}
+
+	id, _, _ := serve(t, config.RequestIDConfig{Format: "ulid", Prefix: "edge-"}, "192.0.2.1:1234", "")
+	assert.Regexp(t, `^edge-[0-9A-Z]{26}$`, id)
+
+	_, err := requestid.New(config.RequestIDConfig{Format: "snowflake"})
+	assert.Error(t, err)
+}
+
+func TestULIDsSortByTime(t *testing.T) {
+	generator, err := requestid.New(config.RequestIDConfig{Format: "ulid"})
+	require.NoError(t, err)
+	first := generator.Generate()
+	for i := 0; i < 5; i++ {
+		// The timestamp is the first 10 characters
+		assert.LessOrEqual(t, first[:10], generator.Generate()[:10])
+	}
+}
+
+func TestRequestIDTrust(t *testing.T) {
+	networks := config.RequestIDConfig{Trust: "networks", TrustedNetworks: []string{"10.0.0.0/8"}}
+
+	id, _, _ := serve(t, networks, "10.1.2.3:1234", "lb-42")
+	assert.Equal(t, "lb-42", id, "IDs from trusted networks are kept")
+
+	id, upstream, returned := serve(t, networks, "198.51.100.9:1234", "forged")
+	assert.NotEqual(t, "forged", id)
+	assert.Equal(t, id, upstream, "untrusted IDs are replaced upstream")
+	assert.Equal(t, id, returned)
+
+	id, _, _ = serve(t, config.RequestIDConfig{}, "198.51.100.9:1234", "client-7")
+	assert.Equal(t, "client-7", id, "all inbound IDs are kept by default")
+
+	id, _, _ = serve(t, config.RequestIDConfig{Trust: "none"}, "10.1.2.3:1234", "lb-42")
+	assert.NotEqual(t, "lb-42", id)
+
+	id, _, _ = serve(t, config.RequestIDConfig{}, "10.1.2.3:1234", "bad id\twith spaces")
+	assert.NotEqual(t, "bad id\twith spaces", id, "unprintable IDs are replaced")
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	generator, err := requestid.New(config.RequestIDConfig{Header: "X-Correlation-ID"})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Pre(generator.Middleware())
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-ID", "corr-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, "corr-1", rec.Header().Get("X-Correlation-ID"))
+	assert.Empty(t, rec.Header().Get(echo.HeaderXRequestID))
+}
@@ -0,0 +1,105 @@
+package revocation
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/revocation"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newList(store revocation.Store) *revocation.List {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return revocation.New(config.RevocationConfig{Enabled: true}, time.Hour, store, logger)
+}
+
+func TestRevokeToken(t *testing.T) {
+	list := newList(revocation.NewMemoryStore())
+	ctx := context.Background()
+
+	doc, err := list.Revoke(ctx, revocation.KindToken, "token-1", "leaked", "admin", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "jti:token-1", doc.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), doc.ExpiresAt, time.Minute)
+
+	assert.True(t, list.TokenRevoked("token-1", nil, time.Now()))
+	assert.False(t, list.TokenRevoked("token-2", nil, time.Now()))
+	assert.False(t, list.TokenRevoked("", nil, time.Time{}))
+}
+
+func TestRevokeSubject(t *testing.T) {
+	list := newList(revocation.NewMemoryStore())
+	issued := time.Now().Add(-time.Minute)
+
+	_, err := list.Revoke(context.Background(), revocation.KindSubject, "user-1", "", "admin", time.Time{})
+	require.NoError(t, err)
+
+	assert.True(t, list.TokenRevoked("a", []string{"", "user-1"}, issued), "issued before the revocation")
+	assert.True(t, list.TokenRevoked("a", []string{"user-1"}, time.Time{}), "no issue time")
+	assert.False(t, list.TokenRevoked("a", []string{"user-1"}, time.Now().Add(time.Minute)), "issued after the revocation")
+	assert.False(t, list.TokenRevoked("a", []string{"user-2"}, issued))
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	list := newList(revocation.NewMemoryStore())
+	ctx := context.Background()
+
+	doc, err := list.Revoke(ctx, revocation.KindAPIKey, "key-1", "", "admin", time.Time{})
+	require.NoError(t, err)
+	assert.True(t, doc.ExpiresAt.IsZero(), "API key revocations last until deleted")
+	assert.True(t, list.APIKeyRevoked("key-1"))
+	assert.False(t, list.APIKeyRevoked("key-2"))
+
+	require.NoError(t, list.Delete(ctx, doc.ID))
+	assert.False(t, list.APIKeyRevoked("key-1"))
+	assert.ErrorIs(t, list.Delete(ctx, doc.ID), revocation.ErrNotFound)
+}
+
+func TestRevokeInvalid(t *testing.T) {
+	list := newList(revocation.NewMemoryStore())
+	ctx := context.Background()
+
+	_, err := list.Revoke(ctx, "user", "u", "", "admin", time.Time{})
+	assert.ErrorIs(t, err, revocation.ErrInvalid)
+	_, err = list.Revoke(ctx, revocation.KindToken, "", "", "admin", time.Time{})
+	assert.ErrorIs(t, err, revocation.ErrInvalid)
+	_, err = list.Revoke(ctx, revocation.KindToken, "t", "", "admin", time.Now().Add(-time.Second))
+	assert.ErrorIs(t, err, revocation.ErrInvalid)
+}
+
+func TestRevocationExpires(t *testing.T) {
+	list := newList(revocation.NewMemoryStore())
+
+	_, err := list.Revoke(context.Background(), revocation.KindToken, "t", "", "admin", time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, list.TokenRevoked("t", nil, time.Time{}))
+	assert.Len(t, list.Entries(), 1)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, list.TokenRevoked("t", nil, time.Time{}))
+	assert.Empty(t, list.Entries())
+}
+
+func TestSyncSharesRevocations(t *testing.T) {
+	store := revocation.NewMemoryStore()
+	first, second := newList(store), newList(store)
+	ctx := context.Background()
+
+	_, err := first.Revoke(ctx, revocation.KindAPIKey, "key-1", "", "admin", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, second.APIKeyRevoked("key-1"), "not synced yet")
+
+	require.NoError(t, second.Sync(ctx))
+	assert.True(t, second.APIKeyRevoked("key-1"))
+
+	require.NoError(t, first.Delete(ctx, revocation.ID(revocation.KindAPIKey, "key-1")))
+	require.NoError(t, second.Sync(ctx))
+	assert.False(t, second.APIKeyRevoked("key-1"))
+}
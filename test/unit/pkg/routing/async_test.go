@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/async"
+	"odin/pkg/config"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncRequestsOutliveServiceTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("report"))
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "reports",
+		BasePath: "/reports",
+		Targets:  []string{upstream.URL},
+		Timeout:  50 * time.Millisecond,
+		Async:    &service.AsyncConfig{Timeout: 5 * time.Second},
+	}))
+
+	e := echo.New()
+	manager := async.NewManager(config.AsyncConfig{}, async.NewMemoryStore(), false, logger)
+	manager.Register(e)
+	defer manager.Stop()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetAsync(manager)
+	require.NoError(t, router.RegisterRoutes())
+	manager.Start()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/2025", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code, "synchronous requests keep the service timeout")
+
+	req := httptest.NewRequest(http.MethodGet, "/reports/2025", nil)
+	req.Header.Set(async.HeaderPrefer, async.RespondAsync)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	statusURL := rec.Header().Get(echo.HeaderLocation)
+
+	var status async.Status
+	require.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, statusURL, nil))
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		return status.Status == "completed" || status.Status == "failed"
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, status.ResponseStatus)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, status.ResultURL, nil))
+	assert.Equal(t, "report", rec.Body.String())
+}
@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backpressureUpstream answers the first busy requests with status and
+// Retry-After, then 200
+func backpressureUpstream(t *testing.T, busy int32, status int, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= busy {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, &calls
+}
+
+func newBackpressureRouter(t *testing.T, target string, backpressure *service.BackpressureConfig) *echo.Echo {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:         "orders",
+		BasePath:     "/api/orders",
+		Targets:      []string{target},
+		Timeout:      5 * time.Second,
+		RetryCount:   2,
+		RetryDelay:   time.Millisecond,
+		Backpressure: backpressure,
+	}))
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+	return e
+}
+
+func get(e *echo.Echo) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil))
+	return rec
+}
+
+func TestBackpressureRetriesAfterDelay(t *testing.T) {
+	upstream, calls := backpressureUpstream(t, 1, http.StatusTooManyRequests, "1")
+	e := newBackpressureRouter(t, upstream.URL, nil)
+
+	start := time.Now()
+	rec := get(e)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second, "the retry waits for Retry-After")
+}
+
+func TestBackpressureReturnsLongDelays(t *testing.T) {
+	upstream, calls := backpressureUpstream(t, 1, http.StatusServiceUnavailable, "120")
+	e := newBackpressureRouter(t, upstream.URL, nil)
+
+	rec := get(e)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "120", rec.Header().Get("Retry-After"))
+	assert.Equal(t, int32(1), calls.Load(), "delays above maxDelay are not waited for")
+}
+
+func TestBackpressureExhaustsRetries(t *testing.T) {
+	upstream, calls := backpressureUpstream(t, 10, http.StatusServiceUnavailable, "0")
+	e := newBackpressureRouter(t, upstream.URL, &service.BackpressureConfig{StripRetryAfter: true})
+
+	rec := get(e)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestBackpressureRetriesDisabled(t *testing.T) {
+	upstream, calls := backpressureUpstream(t, 1, http.StatusTooManyRequests, "0")
+	e := newBackpressureRouter(t, upstream.URL, &service.BackpressureConfig{DisableRetries: true})
+
+	rec := get(e)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("Retry-After"))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestBackpressureHTTPDate(t *testing.T) {
+	upstream, calls := backpressureUpstream(t, 1, http.StatusServiceUnavailable, time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	e := newBackpressureRouter(t, upstream.URL, nil)
+
+	assert.Equal(t, http.StatusOK, get(e).Code)
+	assert.Equal(t, int32(2), calls.Load())
+}
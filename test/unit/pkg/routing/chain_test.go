@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/ipfilter"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "orders",
+		BasePath: "/orders",
+		Targets:  []string{"http://orders:8080"},
+		Timeout:  time.Second,
+	}))
+	require.NoError(t, registry.Register(&service.Config{
+		Name:           "users",
+		BasePath:       "/users",
+		Targets:        []string{"http://users:8080"},
+		Timeout:        time.Second,
+		Authentication: true,
+		CORS:           &service.CORSConfig{AllowOrigins: []string{"*"}},
+		Limits:         &service.LimitsConfig{MaxRequestBodySize: 1024},
+	}))
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "rpc",
+		BasePath: "/rpc",
+		Protocol: "grpc",
+		Timeout:  time.Second,
+		Limits:   &service.LimitsConfig{MaxRequestBodySize: 1024},
+	}))
+
+	// Services without lists of their own get the filter too
+	filter, err := ipfilter.New(config.IPFilterConfig{Enabled: true}, []config.ServiceConfig{
+		{Name: "users", IPFilter: &config.IPFilterRules{Deny: []string{"192.0.2.1"}}},
+	}, logger)
+	require.NoError(t, err)
+
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetIPFilter(filter)
+	router.SetAuthMiddleware(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		}
+	})
+	router.SetServiceRoutes("rpc", func(e *echo.Echo) {
+		e.POST("/rpc/*", func(c echo.Context) error { return nil })
+	})
+	assert.Empty(t, router.Chain("orders"))
+	require.NoError(t, router.RegisterRoutes())
+
+	assert.Equal(t, []string{"requests", "ipfilter"}, router.Chain("orders"))
+	assert.Equal(t, []string{"limits", "requests", "ipfilter", "cors", "auth"}, router.Chain("users"))
+	assert.Equal(t, []string{"limits"}, router.Chain("rpc"))
+
+	// The filter runs before authentication, as listed
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
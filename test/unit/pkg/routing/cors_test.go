@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCORSGateway(t *testing.T) (*echo.Echo, *int32) {
+	t.Helper()
+
+	var hits int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+
+	logger := logrus.New()
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "users",
+		BasePath: "/api/users",
+		Targets:  []string{backend.URL},
+		Timeout:  time.Second,
+		CORS: &service.CORSConfig{
+			AllowOrigins:     []string{"https://app.example.com"},
+			AllowMethods:     []string{http.MethodGet, http.MethodPost},
+			AllowHeaders:     []string{"Authorization", "Content-Type"},
+			AllowCredentials: true,
+			MaxAge:           600,
+		},
+	}))
+
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+	return e, &hits
+}
+
+func TestCORSPreflightAnsweredAtGateway(t *testing.T) {
+	e, hits := newCORSGateway(t)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/users/42", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET,POST", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization,Content-Type", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, int32(0), atomic.LoadInt32(hits))
+}
+
+func TestCORSHeadersStampedOnResponses(t *testing.T) {
+	e, hits := newCORSGateway(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/42", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"https://app.example.com"}, rec.Header().Values("Access-Control-Allow-Origin"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users/42", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
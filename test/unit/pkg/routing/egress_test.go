@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forwardProxy answers requests itself, recording the target they were
+// meant for and the credentials they carried
+type forwardProxy struct {
+	*httptest.Server
+	target chan string
+	auth   chan string
+}
+
+func newForwardProxy(t *testing.T) *forwardProxy {
+	p := &forwardProxy{target: make(chan string, 1), auth: make(chan string, 1)}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.target <- r.URL.String()
+		p.auth <- r.Header.Get("Proxy-Authorization")
+		io.WriteString(w, "proxied")
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func proxiedBody(t *testing.T, target string, proxy *service.EgressProxyConfig) string {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:      "partner",
+		BasePath:  "/api/partner",
+		Targets:   []string{target},
+		Timeout:   5 * time.Second,
+		Transport: &service.TransportConfig{Proxy: proxy},
+	}))
+
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/partner/orders", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestEgressProxy(t *testing.T) {
+	proxy := newForwardProxy(t)
+
+	body := proxiedBody(t, "http://partner.internal:8080", &service.EgressProxyConfig{
+		URL:      proxy.URL,
+		Username: "gateway",
+		Password: "s3cret",
+	})
+	assert.Equal(t, "proxied", body)
+	assert.Equal(t, "http://partner.internal:8080/api/partner/orders", <-proxy.target)
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("gateway:s3cret")), <-proxy.auth)
+}
+
+func TestEgressProxyNoProxy(t *testing.T) {
+	proxy := newForwardProxy(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer upstream.Close()
+
+	for _, noProxy := range [][]string{{"127.0.0.0/8"}, {"127.0.0.1"}, {upstream.Listener.Addr().String()}, {"*"}} {
+		body := proxiedBody(t, upstream.URL, &service.EgressProxyConfig{URL: proxy.URL, NoProxy: noProxy})
+		assert.Equal(t, "direct", body, noProxy)
+	}
+
+	body := proxiedBody(t, "http://api.partner.example:8080", &service.EgressProxyConfig{
+		URL:     proxy.URL,
+		NoProxy: []string{".internal", "127.0.0.1:1"},
+	})
+	assert.Equal(t, "proxied", body)
+	<-proxy.target
+}
@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+	"odin/pkg/transform"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseFields(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/users/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found","trace":"users.go:42"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"7","name":"Ada","passwordHash":"x"}`))
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:           "users",
+		BasePath:       "/api/users",
+		Targets:        []string{upstream.URL},
+		Timeout:        5 * time.Second,
+		ResponseFields: []transform.FieldRule{{Path: "/api/users/{id}", Fields: []string{"id", "name"}}},
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	require.NoError(t, router.RegisterRoutes())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/users/7")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"7","name":"Ada"}`, rec.Body.String())
+
+	rec = get("/api/users/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error":"not found","trace":"users.go:42"}`, rec.Body.String(), "error responses are left alone")
+
+	rec = get("/api/users/7/orders")
+	assert.Contains(t, rec.Body.String(), "passwordHash", "routes without a rule are left alone")
+}
+
+func TestResponseFieldsOfCompressedResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body io.WriteCloser
+		switch {
+		case r.URL.Path == "/api/users/deflated":
+			// An encoding nobody asked for
+			w.Header().Set("Content-Encoding", "deflate")
+			body, _ = flate.NewWriter(w, flate.DefaultCompression)
+		case strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			body = gzip.NewWriter(w)
+		default:
+			w.Write([]byte(`{"id":"7","name":"Ada","passwordHash":"x"}`))
+			return
+		}
+		body.Write([]byte(`{"id":"7","name":"Ada","passwordHash":"x"}`))
+		body.Close()
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:           "users",
+		BasePath:       "/api/users",
+		Targets:        []string{upstream.URL},
+		Timeout:        5 * time.Second,
+		ResponseFields: []transform.FieldRule{{Path: "/api/users/{id}", Fields: []string{"id", "name"}}},
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	require.NoError(t, router.RegisterRoutes())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/users/7")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"7","name":"Ada"}`, rec.Body.String())
+
+	// Bodies that cannot be filtered are not sent
+	rec = get("/api/users/deflated")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "passwordHash")
+}
@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/flags"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func namedUpstream(t *testing.T, name string) string {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream.URL
+}
+
+func TestFeatureFlagRouting(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	featureFlags, err := flags.New(config.FeatureFlagsConfig{Flags: map[string]config.FeatureFlagConfig{
+		"beta-api": {Default: false, Rules: []config.FlagRuleConfig{{Header: "X-Beta", Value: true}}},
+		"orders-canary": {Default: 0, Rules: []config.FlagRuleConfig{
+			{Header: "X-Tester", Values: []string{"yes"}, Value: 100},
+		}},
+	}}, logger)
+	require.NoError(t, err)
+
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "orders",
+		BasePath: "/api/orders",
+		Targets:  []string{namedUpstream(t, "stable")},
+		Timeout:  5 * time.Second,
+		Canary: &service.CanaryConfig{
+			Enabled:    true,
+			Targets:    []string{namedUpstream(t, "canary")},
+			Weight:     100,
+			WeightFlag: "orders-canary",
+		},
+	}))
+	require.NoError(t, registry.Register(&service.Config{
+		Name:        "beta",
+		BasePath:    "/api/beta",
+		Targets:     []string{namedUpstream(t, "beta")},
+		Timeout:     5 * time.Second,
+		FeatureFlag: "beta-api",
+	}))
+
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetFlags(featureFlags)
+	require.NoError(t, router.RegisterRoutes())
+
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, "stable", serve("/api/orders/1", nil).Body.String(), "the flag sets the weight to 0")
+	assert.Equal(t, "canary", serve("/api/orders/1", map[string]string{"X-Tester": "yes"}).Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve("/api/beta/1", nil).Code)
+	rec := serve("/api/beta/1", map[string]string{"X-Beta": "1"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "beta", rec.Body.String())
+}
@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+	"odin/pkg/transform"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderRules(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Server", "legacy/1.0")
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:           "orders",
+		BasePath:       "/api/orders",
+		Targets:        []string{upstream.URL},
+		Timeout:        5 * time.Second,
+		Authentication: true,
+		Headers:        map[string]string{"X-Source": "odin"},
+		HeaderRules: &service.HeaderRulesConfig{
+			Request: []transform.HeaderRule{
+				{Action: transform.HeaderRemove, Name: "Authorization"},
+				{Action: transform.HeaderCopyFromClaim, Name: "X-User-Id", From: "sub"},
+				{Action: transform.HeaderRename, Name: "X-Trace", From: "X-Request-Id"},
+			},
+			Response: []transform.HeaderRule{
+				{Action: transform.HeaderRemove, Name: "Server"},
+				{Action: transform.HeaderCopyFromHeader, Name: "X-Request-Id", From: "X-Request-Id"},
+			},
+		},
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetAuthMiddleware(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &auth.JWTClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}})
+			return next(c)
+		}
+	})
+	require.NoError(t, router.RegisterRoutes())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/orders/7", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Request-Id", "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "odin", received.Get("X-Source"))
+	assert.Empty(t, received.Get("Authorization"))
+	assert.Equal(t, "user-1", received.Get("X-User-Id"))
+	assert.Equal(t, "req-1", received.Get("X-Trace"))
+	assert.Empty(t, received.Get("X-Request-Id"))
+	assert.Empty(t, rec.Header().Get("Server"))
+	assert.Equal(t, "req-1", rec.Header().Get("X-Request-Id"))
+}
@@ -0,0 +1,235 @@
+package routing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/openapi"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitedGateway(t *testing.T, backend http.Handler, limits *service.LimitsConfig, setup ...func(r *routing.Router)) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(backend)
+	t.Cleanup(upstream.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "files",
+		BasePath: "/api/files",
+		Targets:  []string{upstream.URL},
+		Timeout:  5 * time.Second,
+		Limits:   limits,
+	}))
+
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	for _, set := range setup {
+		set(router)
+	}
+	require.NoError(t, router.RegisterRoutes())
+	gateway := httptest.NewServer(e)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func echoBody() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	gateway := newLimitedGateway(t, echoBody(), &service.LimitsConfig{MaxRequestBodySize: 16})
+
+	resp, err := http.Post(gateway.URL+"/api/files/upload", "text/plain", strings.NewReader("small"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "small", string(body))
+
+	resp, err = http.Post(gateway.URL+"/api/files/upload", "text/plain", strings.NewReader(strings.Repeat("x", 17)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestChunkedRequestBodyLimit(t *testing.T) {
+	gateway := newLimitedGateway(t, echoBody(), &service.LimitsConfig{MaxRequestBodySize: 16})
+
+	// Hiding the length makes the client send the body chunked
+	body := io.MultiReader(strings.NewReader(strings.Repeat("x", 32)))
+	req, err := http.NewRequest(http.MethodPost, gateway.URL+"/api/files/upload", body)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+const uploadSpec = `
+openapi: 3.0.0
+info:
+  title: Files
+  version: "1"
+paths:
+  /upload:
+    post:
+      requestBody:
+        required: true
+        content:
+          text/plain:
+            schema:
+              type: string
+      responses:
+        "200":
+          description: OK
+`
+
+func TestRequestBodyLimitBeforeValidation(t *testing.T) {
+	specPath := filepath.Join(t.TempDir(), "files.yaml")
+	require.NoError(t, os.WriteFile(specPath, []byte(uploadSpec), 0644))
+	spec, err := openapi.LoadSpec(specPath)
+	require.NoError(t, err)
+
+	var proxied atomic.Bool
+	gateway := newLimitedGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(true)
+	}), &service.LimitsConfig{MaxRequestBodySize: 16}, func(r *routing.Router) {
+		r.SetRequestValidator("files", openapi.NewValidator(spec, "/api/files"))
+	})
+
+	resp, err := http.Post(gateway.URL+"/api/files/upload", "text/plain", strings.NewReader(strings.Repeat("x", 32)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// The validator reads bodies of unknown length up to the limit only
+	req, err := http.NewRequest(http.MethodPost, gateway.URL+"/api/files/upload", io.MultiReader(strings.NewReader(strings.Repeat("x", 32))))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.False(t, proxied.Load())
+
+	resp, err = http.Post(gateway.URL+"/api/files/upload", "text/plain", strings.NewReader("small"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, proxied.Load())
+}
+
+func TestRequestBodyLimitOfProxyRoutes(t *testing.T) {
+	// Protocol proxies such as gRPC register their own routes
+	gateway := newLimitedGateway(t, echoBody(), &service.LimitsConfig{MaxRequestBodySize: 16}, func(r *routing.Router) {
+		r.SetServiceRoutes("files", func(e *echo.Echo) {
+			e.POST("/api/files/rpc", func(c echo.Context) error {
+				body, err := io.ReadAll(c.Request().Body)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge)
+				}
+				return c.Blob(http.StatusOK, "text/plain", body)
+			})
+		})
+	})
+
+	resp, err := http.Post(gateway.URL+"/api/files/rpc", "text/plain", strings.NewReader(strings.Repeat("x", 32)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, gateway.URL+"/api/files/rpc", io.MultiReader(strings.NewReader(strings.Repeat("x", 32))))
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = http.Post(gateway.URL+"/api/files/rpc", "text/plain", strings.NewReader("small"))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "small", string(body))
+}
+
+func TestRequestHeaderLimit(t *testing.T) {
+	gateway := newLimitedGateway(t, echoBody(), &service.LimitsConfig{MaxHeaderBytes: 512})
+
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/api/files/list", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Large", strings.Repeat("x", 1024))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+
+	resp, err = http.Get(gateway.URL + "/api/files/list")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestResponseBodyLimit(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 64)
+	gateway := newLimitedGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "exact":
+			w.Header().Set("Content-Length", "32")
+			w.Write(large[:32])
+		case "declared":
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			w.Write(large)
+		case "chunked":
+			// Unknown length: the limit only shows while reading
+			w.Write(large[:32])
+			w.(http.Flusher).Flush()
+			w.Write(large[32:])
+		}
+	}), &service.LimitsConfig{MaxResponseBodySize: 32})
+
+	resp, err := http.Get(gateway.URL + "/api/files/exact")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body, 32)
+
+	resp, err = http.Get(gateway.URL + "/api/files/declared")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// Streamed responses are cut off, never passed through in full
+	resp, err = http.Get(gateway.URL + "/api/files/chunked")
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Error(t, err)
+		assert.LessOrEqual(t, len(body), 32)
+	}
+}
@@ -0,0 +1,122 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/health"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisabledTargetsAreSkipped(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	one, two := backend("one"), backend("two")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "orders",
+		BasePath: "/api/orders",
+		Targets:  []string{one.URL, two.URL},
+		Timeout:  5 * time.Second,
+	}))
+	maintenance := health.NewMaintenance()
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetMaintenance(maintenance)
+	require.NoError(t, router.RegisterRoutes())
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil))
+		return rec
+	}
+
+	maintenance.Disable(one.URL, "maintenance", "alice")
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "two", get().Body.String())
+	}
+
+	maintenance.Disable(two.URL, "maintenance", "alice")
+	assert.Equal(t, http.StatusServiceUnavailable, get().Code)
+
+	maintenance.Enable(one.URL)
+	assert.Equal(t, "one", get().Body.String())
+}
+
+func TestUnhealthyTargetsAreSkipped(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	one, two := backend("one"), backend("two")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	checker := health.NewTargetChecker(health.Config{
+		PassiveFailures: 1,
+		PassiveDecay:    100 * time.Millisecond,
+	}, logger, health.NewAlertManager(logger))
+	t.Cleanup(checker.Stop)
+	checker.AddServiceTarget("orders", one.URL)
+	checker.AddServiceTarget("orders", two.URL)
+
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "orders",
+		BasePath: "/api/orders",
+		Targets:  []string{one.URL, two.URL},
+		Timeout:  5 * time.Second,
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetHealthChecker("orders", checker)
+	require.NoError(t, router.RegisterRoutes())
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil))
+		return rec.Body.String()
+	}
+
+	checker.ReportRequest(one.URL, assert.AnError)
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "two", get())
+	}
+
+	// With no healthy target left, requests go to all of them
+	checker.ReportRequest(two.URL, assert.AnError)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[get()] = true
+	}
+	assert.Equal(t, map[string]bool{"one": true, "two": true}, seen)
+
+	// Recovered targets are used again
+	assert.Eventually(t, func() bool {
+		return checker.IsHealthy(one.URL) && checker.IsHealthy(two.URL)
+	}, 2*time.Second, 10*time.Millisecond)
+	seen = map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[get()] = true
+	}
+	assert.Equal(t, map[string]bool{"one": true, "two": true}, seen)
+}
@@ -0,0 +1,63 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/health"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassiveHealthChecks(t *testing.T) {
+	var status atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	checker := health.NewTargetChecker(health.Config{
+		PassiveFailures: 2,
+		PassiveDecay:    time.Hour,
+	}, logger, health.NewAlertManager(logger))
+	checker.AddServiceTarget("orders", upstream.URL)
+
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:     "orders",
+		BasePath: "/api/orders",
+		Targets:  []string{upstream.URL},
+		Timeout:  5 * time.Second,
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetHealthChecker("orders", checker)
+	require.NoError(t, router.RegisterRoutes())
+
+	get := func() int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders/1", nil))
+		return rec.Code
+	}
+
+	// 4xx responses are the client's fault
+	status.Store(http.StatusNotFound)
+	get()
+	get()
+	assert.True(t, checker.IsHealthy(upstream.URL))
+
+	status.Store(http.StatusServiceUnavailable)
+	assert.Equal(t, http.StatusServiceUnavailable, get())
+	get()
+	assert.Equal(t, health.TargetStatusDegraded, checker.GetTargetHealth(upstream.URL).Status)
+}
@@ -0,0 +1,198 @@
+package routing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamGateway(t *testing.T, backend http.Handler, threshold int64) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(backend)
+	t.Cleanup(upstream.Close)
+
+	logger := logrus.New()
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:            "files",
+		BasePath:        "/api/files",
+		Targets:         []string{upstream.URL},
+		Timeout:         5 * time.Second,
+		StreamThreshold: threshold,
+	}))
+
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+	gateway := httptest.NewServer(e)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func TestLargeResponseIsStreamed(t *testing.T) {
+	chunk := bytes.Repeat([]byte("x"), 64*1024)
+	release := make(chan struct{})
+	gateway := newStreamGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Unknown length: the body is sent chunked
+		w.Write(chunk)
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write(chunk)
+	}), 0)
+	defer close(release)
+
+	resp, err := http.Get(gateway.URL + "/api/files/download")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// The first chunk arrives while the backend is still holding the rest
+	first := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(resp.Body, make([]byte, len(chunk)))
+		first <- err
+	}()
+	select {
+	case err := <-first:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("response was buffered instead of streamed")
+	}
+}
+
+func TestSmallResponseKeepsContentLength(t *testing.T) {
+	body := []byte(`{"id":42}`)
+	gateway := newStreamGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}), 1024)
+
+	resp, err := http.Get(gateway.URL + "/api/files/42")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, got)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+}
+
+func newStreamingGateway(t *testing.T, backend http.Handler, streaming *service.StreamingConfig) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewServer(backend)
+	t.Cleanup(upstream.Close)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:      "events",
+		BasePath:  "/api/events",
+		Targets:   []string{upstream.URL},
+		Timeout:   200 * time.Millisecond,
+		Streaming: streaming,
+	}))
+
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+	gateway := httptest.NewServer(e)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+// eventSource sends an event every interval until the client goes away
+func eventSource(interval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	})
+}
+
+func TestEventStreamIsFlushed(t *testing.T) {
+	gateway := newStreamingGateway(t, eventSource(100*time.Millisecond), &service.StreamingConfig{Enabled: true})
+
+	resp, err := http.Get(gateway.URL + "/api/events/feed")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Events keep arriving one by one after the service timeout has passed
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+	for i := 0; i < 5; i++ {
+		select {
+		case line, ok := <-lines:
+			require.True(t, ok, "stream ended early")
+			assert.Equal(t, fmt.Sprintf("data: %d", i), line)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("event %d was held back", i)
+		}
+	}
+}
+
+func TestEventStreamMaxDuration(t *testing.T) {
+	gateway := newStreamingGateway(t, eventSource(20*time.Millisecond), &service.StreamingConfig{
+		Enabled:       true,
+		FlushInterval: 50 * time.Millisecond,
+		MaxDuration:   300 * time.Millisecond,
+	})
+
+	start := time.Now()
+	resp, err := http.Get(gateway.URL + "/api/events/feed")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Contains(t, string(body), "data: 0\n\n")
+}
+
+func TestStreamingKeepsHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	gateway := newStreamingGateway(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}), &service.StreamingConfig{Enabled: true})
+
+	resp, err := http.Get(gateway.URL + "/api/events/feed")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
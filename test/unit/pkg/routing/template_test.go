@@ -0,0 +1,68 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/auth"
+	"odin/pkg/routing"
+	"odin/pkg/service"
+	"odin/pkg/transform"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyTemplates(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"orderId":"o-1"}`))
+	}))
+	defer upstream.Close()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:           "orders",
+		BasePath:       "/api/orders",
+		Targets:        []string{upstream.URL},
+		Timeout:        5 * time.Second,
+		Authentication: true,
+		Transformation: &service.TransformationConfig{
+			Templates: []transform.TemplateRule{{
+				Method:   http.MethodPut,
+				Path:     "/api/orders/{id}",
+				Request:  `{"id":{{ toJson .params.id }},"owner":{{ toJson .claims.username }},"qty":{{ .body.qty }}}`,
+				Response: `{"order":{{ toJson .body.orderId }},"status":{{ .status }}}`,
+			}},
+		},
+	}))
+	e := echo.New()
+	router := routing.NewRouter(e, registry, logger)
+	router.SetAuthMiddleware(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &auth.JWTClaims{Username: "ada"})
+			return next(c)
+		}
+	})
+	require.NoError(t, router.RegisterRoutes())
+
+	req := httptest.NewRequest(http.MethodPut, "/api/orders/7", strings.NewReader(`{"qty":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"7","owner":"ada","qty":3}`, received)
+	assert.JSONEq(t, `{"order":"o-1","status":200}`, rec.Body.String())
+}
@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"odin/pkg/routing"
+	"odin/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTLSUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func proxyStatus(t *testing.T, upstream *httptest.Server, transport *service.TransportConfig) int {
+	t.Helper()
+
+	logger := logrus.New()
+	registry := service.NewRegistry(logger)
+	require.NoError(t, registry.Register(&service.Config{
+		Name:      "secure",
+		BasePath:  "/api/secure",
+		Targets:   []string{upstream.URL},
+		Timeout:   5 * time.Second,
+		Transport: transport,
+	}))
+
+	e := echo.New()
+	require.NoError(t, routing.NewRouter(e, registry, logger).RegisterRoutes())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/secure/ping", nil))
+	return rec.Code
+}
+
+func TestUpstreamTLSWithCustomCA(t *testing.T) {
+	upstream := newTLSUpstream(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	// The test server's certificate is not signed by a system root
+	assert.Equal(t, http.StatusBadGateway, proxyStatus(t, upstream, nil))
+
+	assert.Equal(t, http.StatusOK, proxyStatus(t, upstream, &service.TransportConfig{
+		TLS: &service.UpstreamTLSConfig{CAFile: caFile, ServerName: "example.com"},
+	}))
+}
+
+func TestUpstreamTLSInsecureSkipVerify(t *testing.T) {
+	upstream := newTLSUpstream(t)
+
+	assert.Equal(t, http.StatusOK, proxyStatus(t, upstream, &service.TransportConfig{
+		TLS: &service.UpstreamTLSConfig{InsecureSkipVerify: true},
+	}))
+}
+
+func TestUpstreamTLSMissingCAFile(t *testing.T) {
+	_, err := routing.NewServiceHandler(&service.Config{
+		Name:     "secure",
+		BasePath: "/api/secure",
+		Targets:  []string{"https://localhost:8443"},
+		Transport: &service.TransportConfig{
+			TLS: &service.UpstreamTLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		},
+	}, logrus.New(), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/mongodb"
+	"odin/pkg/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newScheduler(t *testing.T, cfg config.SchedulerConfig, store scheduler.Store) *scheduler.Scheduler {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	s, err := scheduler.New(cfg, store, logger)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSchedulerManualRuns(t *testing.T) {
+	store := scheduler.NewMemoryStore()
+	s := newScheduler(t, config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{
+		{Name: "warm", Schedule: "@hourly", Task: "echo", Params: map[string]interface{}{"say": "hi"}},
+		{Name: "broken", Schedule: "0 3 * * *", Task: "fail"},
+	}}, store)
+	s.Register("echo", func(ctx context.Context, params map[string]interface{}) (string, error) {
+		return params["say"].(string), nil
+	})
+	s.Register("fail", func(ctx context.Context, params map[string]interface{}) (string, error) {
+		return "", errors.New("boom")
+	})
+
+	run, err := s.Run(context.Background(), "warm")
+	require.NoError(t, err)
+	assert.Equal(t, mongodb.JobRunSucceeded, run.Status)
+	assert.Equal(t, "hi", run.Output)
+	assert.Equal(t, scheduler.TriggerManual, run.Trigger)
+
+	run, err = s.Run(context.Background(), "broken")
+	require.NoError(t, err)
+	assert.Equal(t, mongodb.JobRunFailed, run.Status)
+	assert.Equal(t, "boom", run.Error)
+
+	_, err = s.Run(context.Background(), "missing")
+	assert.ErrorIs(t, err, scheduler.ErrNotFound)
+
+	runs, err := s.Runs(context.Background(), "warm", 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "hi", runs[0].Output)
+
+	jobs, err := s.Jobs(context.Background())
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "broken", jobs[0].Name)
+	assert.Equal(t, scheduler.SourceConfig, jobs[0].Source)
+	assert.Equal(t, "10m0s", jobs[0].Timeout)
+	require.NotNil(t, jobs[0].LastRun)
+	assert.Equal(t, mongodb.JobRunFailed, jobs[0].LastRun.Status)
+}
+
+func TestSchedulerRejectsInvalidConfig(t *testing.T) {
+	logger := logrus.New()
+	_, err := scheduler.New(config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{
+		{Name: "bad", Schedule: "every day", Task: "http"},
+	}}, scheduler.NewMemoryStore(), logger)
+	assert.Error(t, err)
+
+	s, err := scheduler.New(config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{
+		{Name: "unknown", Schedule: "@daily", Task: "nope"},
+	}}, scheduler.NewMemoryStore(), logger)
+	require.NoError(t, err)
+	assert.Error(t, s.Start())
+}
+
+func TestSchedulerAPIJobs(t *testing.T) {
+	s := newScheduler(t, config.SchedulerConfig{Jobs: []config.ScheduledJobConfig{
+		{Name: "fixed", Schedule: "@daily", Task: "noop"},
+	}}, scheduler.NewMemoryStore())
+	s.Register("noop", func(ctx context.Context, params map[string]interface{}) (string, error) {
+		return "done", nil
+	})
+	ctx := context.Background()
+
+	job := &mongodb.ScheduledJobDocument{Name: "added", Schedule: "*/15 * * * *", Task: "noop", Timeout: "30s"}
+	require.NoError(t, s.CreateJob(ctx, job))
+	assert.ErrorIs(t, s.CreateJob(ctx, job), scheduler.ErrExists)
+	assert.ErrorIs(t, s.CreateJob(ctx, &mongodb.ScheduledJobDocument{Name: "fixed", Schedule: "@daily", Task: "noop"}), scheduler.ErrReadOnly)
+	assert.ErrorIs(t, s.CreateJob(ctx, &mongodb.ScheduledJobDocument{Name: "x", Schedule: "bad", Task: "noop"}), scheduler.ErrInvalid)
+	assert.ErrorIs(t, s.CreateJob(ctx, &mongodb.ScheduledJobDocument{Name: "x", Schedule: "@daily", Task: "missing"}), scheduler.ErrInvalid)
+	assert.ErrorIs(t, s.CreateJob(ctx, &mongodb.ScheduledJobDocument{Name: "x", Schedule: "@daily", Task: "noop", Timeout: "soon"}), scheduler.ErrInvalid)
+
+	run, err := s.Run(ctx, "added")
+	require.NoError(t, err)
+	assert.Equal(t, "done", run.Output)
+
+	require.NoError(t, s.UpdateJob(ctx, &mongodb.ScheduledJobDocument{Name: "added", Schedule: "@hourly", Task: "noop", Disabled: true}))
+	assert.ErrorIs(t, s.UpdateJob(ctx, &mongodb.ScheduledJobDocument{Name: "ghost", Schedule: "@hourly", Task: "noop"}), scheduler.ErrNotFound)
+
+	jobs, err := s.Jobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "added", jobs[0].Name)
+	assert.Equal(t, scheduler.SourceAPI, jobs[0].Source)
+	assert.Equal(t, "@hourly", jobs[0].Schedule)
+	assert.True(t, jobs[0].Disabled)
+
+	assert.ErrorIs(t, s.DeleteJob(ctx, "fixed"), scheduler.ErrReadOnly)
+	require.NoError(t, s.DeleteJob(ctx, "added"))
+	assert.ErrorIs(t, s.DeleteJob(ctx, "added"), scheduler.ErrNotFound)
+}
+
+func TestSchedulerLeaderElection(t *testing.T) {
+	store := scheduler.NewMemoryStore()
+	cfg := config.SchedulerConfig{LeaseDuration: 150 * time.Millisecond}
+	first := newScheduler(t, cfg, store)
+	second := newScheduler(t, cfg, store)
+
+	require.NoError(t, first.Start())
+	require.Eventually(t, func() bool { return first.Status().Leader }, time.Second, 10*time.Millisecond)
+	require.NoError(t, second.Start())
+	defer second.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, first.Status().Leader)
+	assert.False(t, second.Status().Leader)
+
+	// The leader gives up its lease when it stops
+	first.Stop()
+	assert.Eventually(t, func() bool { return second.Status().Leader }, time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPTask(t *testing.T) {
+	var paths []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Host+r.URL.Path)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	task := scheduler.HTTPTask(handler, http.DefaultClient)
+
+	output, err := task(context.Background(), map[string]interface{}{
+		"urls": []interface{}{"/products", "/categories"},
+		"host": "shop.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "requested 2 URLs", output)
+	assert.Equal(t, []string{"shop.example.com/products", "shop.example.com/categories"}, paths)
+
+	_, err = task(context.Background(), map[string]interface{}{"url": "/missing"})
+	assert.ErrorContains(t, err, "status 404")
+
+	_, err = task(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+type keyStore struct {
+	keys    []*mongodb.APIKeyDocument
+	updated []string
+}
+
+func (s *keyStore) ListAPIKeys(ctx context.Context, userID string) ([]*mongodb.APIKeyDocument, error) {
+	return s.keys, nil
+}
+
+func (s *keyStore) UpdateAPIKey(ctx context.Context, id string, key *mongodb.APIKeyDocument) error {
+	s.updated = append(s.updated, id)
+	return nil
+}
+
+func TestExpireAPIKeysTask(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	store := &keyStore{keys: []*mongodb.APIKeyDocument{
+		{ID: "expired", Enabled: true, ExpiresAt: &past, LastUsed: now},
+		{ID: "valid", Enabled: true, ExpiresAt: &future, LastUsed: now},
+		{ID: "idle", Enabled: true, LastUsed: now.Add(-100 * 24 * time.Hour)},
+		{ID: "never-used", Enabled: true, CreatedAt: now.Add(-100 * 24 * time.Hour)},
+		{ID: "already-disabled", Enabled: false, ExpiresAt: &past},
+	}}
+	task := scheduler.ExpireAPIKeysTask(store)
+
+	output, err := task(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expired"}, store.updated)
+	assert.Equal(t, "disabled 1 of 5 keys", output)
+
+	_, err = task(context.Background(), map[string]interface{}{"maxIdle": "2160h"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"expired", "idle", "never-used"}, store.updated)
+	assert.True(t, store.keys[1].Enabled)
+}
+
+type usageStore struct {
+	records []*mongodb.UsageRecordDocument
+}
+
+func (s *usageStore) QueryUsageRecords(ctx context.Context, query mongodb.UsageRecordQuery) ([]*mongodb.UsageRecordDocument, error) {
+	return s.records, nil
+}
+
+func TestUsageReportTask(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	task := scheduler.UsageReportTask(&usageStore{records: []*mongodb.UsageRecordDocument{
+		{PeriodStart: start, PeriodEnd: start.Add(time.Hour), KeyID: "k1", UserID: "u1", Service: "orders", Requests: 12, Errors: 1, BytesIn: 100, BytesOut: 2000},
+	}})
+
+	output, err := task(context.Background(), map[string]interface{}{"directory": dir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "wrote 1 records")
+
+	files, err := filepath.Glob(filepath.Join(dir, "usage-*.csv"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "2026-01-02T00:00:00Z,2026-01-02T01:00:00Z,k1,u1,,orders,12,1,100,2000", lines[1])
+
+	_, err = task(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+type metricStore struct {
+	samples []*mongodb.MetricDocument
+	saved   []*mongodb.MetricDocument
+}
+
+func (s *metricStore) SaveMetric(ctx context.Context, metric *mongodb.MetricDocument) error {
+	s.saved = append(s.saved, metric)
+	return nil
+}
+
+func (s *metricStore) QueryMetrics(ctx context.Context, name string, start, end time.Time, labels map[string]string) ([]*mongodb.MetricDocument, error) {
+	var samples []*mongodb.MetricDocument
+	for _, m := range s.samples {
+		if m.Name == name {
+			samples = append(samples, m)
+		}
+	}
+	return samples, nil
+}
+
+func TestMetricRollupTask(t *testing.T) {
+	store := &metricStore{samples: []*mongodb.MetricDocument{
+		{Name: "requests", Type: "counter", Value: 3, Labels: map[string]string{"service": "a"}},
+		{Name: "requests", Type: "counter", Value: 4, Labels: map[string]string{"service": "a"}},
+		{Name: "requests", Type: "counter", Value: 10, Labels: map[string]string{"service": "b"}},
+		{Name: "latency", Type: "gauge", Value: 20, Labels: map[string]string{"service": "a"}},
+		{Name: "latency", Type: "gauge", Value: 40, Labels: map[string]string{"service": "a"}},
+	}}
+	task := scheduler.MetricRollupTask(store)
+
+	output, err := task(context.Background(), map[string]interface{}{"metric": "requests"})
+	require.NoError(t, err)
+	assert.Equal(t, "rolled up 3 samples into 2 metrics", output)
+	require.Len(t, store.saved, 2)
+	assert.Equal(t, "requests_rollup", store.saved[0].Name)
+	assert.Equal(t, 7.0, store.saved[0].Value)
+	assert.Equal(t, 2, store.saved[0].Metadata["count"])
+	assert.Equal(t, 10.0, store.saved[1].Value)
+
+	_, err = task(context.Background(), map[string]interface{}{"metric": "latency", "into": "latency_hourly"})
+	require.NoError(t, err)
+	require.Len(t, store.saved, 3)
+	assert.Equal(t, "latency_hourly", store.saved[2].Name)
+	assert.Equal(t, 30.0, store.saved[2].Value)
+	assert.Equal(t, 40.0, store.saved[2].Metadata["max"])
+}
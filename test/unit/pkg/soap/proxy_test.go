@@ -0,0 +1,337 @@
+package soap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/soap"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const accountsSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="AccountID">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[A-Z]{2}[0-9]{4}"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:element name="GetAccount">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="id" type="AccountID"/>
+        <xs:element name="limit" type="xs:int" minOccurs="0"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="GetAccountResponse">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="account">
+          <xs:complexType>
+            <xs:sequence>
+              <xs:element name="id" type="AccountID"/>
+              <xs:element name="balance" type="xs:decimal"/>
+            </xs:sequence>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+// envelope wraps a body in a SOAP 1.1 envelope
+func envelope(body string) string {
+	return `<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		body + `</soap:Body></soap:Envelope>`
+}
+
+// upstream is a SOAP endpoint that records the last request and answers
+// with a fixed status and body
+type upstream struct {
+	server      *httptest.Server
+	calls       atomic.Int32
+	body        string
+	contentType string
+	action      string
+}
+
+func newUpstream(t *testing.T, status int, response string) *upstream {
+	u := &upstream{}
+	u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u.calls.Add(1)
+		u.body = string(body)
+		u.contentType = r.Header.Get("Content-Type")
+		u.action = r.Header.Get("SOAPAction")
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(u.server.Close)
+	return u
+}
+
+func newProxy(cfg config.SOAPConfig) (*soap.Proxy, error) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return soap.NewProxy("accounts", []string{"http://soap"}, cfg, logger)
+}
+
+func newServer(t *testing.T, target string, cfg config.SOAPConfig) *echo.Echo {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	proxy, err := soap.NewProxy("accounts", []string{target}, cfg, logger)
+	require.NoError(t, err)
+
+	e := echo.New()
+	proxy.RegisterRoutes(e.Group("/accounts"))
+	return e
+}
+
+func do(e *echo.Echo, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	return body
+}
+
+var getAccount = config.SOAPOperation{
+	Name:    "GetAccount",
+	Method:  "GET",
+	Path:    "/:id",
+	Action:  "urn:GetAccount",
+	Request: `<GetAccount><id>{{ .params.id }}</id>{{ with .query.limit }}<limit>{{ . }}</limit>{{ end }}</GetAccount>`,
+}
+
+func TestProxyConvertsResponse(t *testing.T) {
+	u := newUpstream(t, http.StatusOK, envelope(
+		`<GetAccountResponse xmlns="urn:accounts"><account currency="EUR"><id>AB1234</id><balance>10.50</balance>`+
+			`<tag>gold</tag><tag>vip</tag><owner xsi:nil="true" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"/></account></GetAccountResponse>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{Operations: []config.SOAPOperation{getAccount}})
+
+	rec := do(e, http.MethodGet, "/accounts/AB1234?limit=5", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, map[string]interface{}{
+		"account": map[string]interface{}{
+			"@currency": "EUR",
+			"id":        "AB1234",
+			"balance":   "10.50",
+			"tag":       []interface{}{"gold", "vip"},
+			"owner":     nil,
+		},
+	}, decode(t, rec))
+
+	assert.Equal(t, "text/xml; charset=utf-8", u.contentType)
+	assert.Equal(t, `"urn:GetAccount"`, u.action)
+	assert.Contains(t, u.body, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">`)
+	assert.Contains(t, u.body, `<soap:Body><GetAccount><id>AB1234</id><limit>5</limit></GetAccount></soap:Body>`)
+}
+
+func TestProxyResponsePathAndArrays(t *testing.T) {
+	u := newUpstream(t, http.StatusOK, envelope(
+		`<ListAccountsResponse><accounts><account><id>AB1234</id></account></accounts></ListAccountsResponse>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{Operations: []config.SOAPOperation{{
+		Name:     "ListAccounts",
+		Request:  `<ListAccounts/>`,
+		Response: "accounts",
+		Arrays:   []string{"account"},
+	}}})
+
+	rec := do(e, http.MethodPost, "/accounts/ListAccounts", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, map[string]interface{}{
+		"account": []interface{}{map[string]interface{}{"id": "AB1234"}},
+	}, decode(t, rec))
+}
+
+func TestProxyEscapesRequestData(t *testing.T) {
+	u := newUpstream(t, http.StatusOK, envelope(`<UpdateAccountResponse/>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{Operations: []config.SOAPOperation{{
+		Name:    "UpdateAccount",
+		Request: `<UpdateAccount><name>{{ .body.name }}</name><note>{{ .body.note }}</note>{{ toXML .body.meta }}</UpdateAccount>`,
+	}}})
+
+	rec := do(e, http.MethodPost, "/accounts/UpdateAccount",
+		`{"name": "</name><admin>true</admin>", "meta": {"id": 12345678901234567890, "tags": ["a&b", "c"]}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Missing values render as nothing and numbers are kept as written
+	assert.Contains(t, u.body, `<UpdateAccount><name>&lt;/name&gt;&lt;admin&gt;true&lt;/admin&gt;</name><note></note>`+
+		`<id>12345678901234567890</id><tags>a&amp;b</tags><tags>c</tags></UpdateAccount>`)
+}
+
+func TestProxyInvalidJSON(t *testing.T) {
+	u := newUpstream(t, http.StatusOK, envelope(`<UpdateAccountResponse/>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{Operations: []config.SOAPOperation{{
+		Name:    "UpdateAccount",
+		Request: `<UpdateAccount/>`,
+	}}})
+
+	rec := do(e, http.MethodPost, "/accounts/UpdateAccount", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "Invalid JSON request body", decode(t, rec)["error"])
+	assert.Zero(t, u.calls.Load())
+}
+
+func TestProxyFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   string
+		status  int
+		code    string
+		message string
+		detail  interface{}
+		version string
+	}{
+		{
+			name: "SOAP 1.1 client fault",
+			fault: `<soap:Fault><faultcode>soap:Client.Validation</faultcode><faultstring>Unknown account</faultstring>` +
+				`<detail><AccountFault><id>AB1234</id></AccountFault></detail></soap:Fault>`,
+			status:  http.StatusBadRequest,
+			code:    "Client.Validation",
+			message: "Unknown account",
+			detail:  map[string]interface{}{"AccountFault": map[string]interface{}{"id": "AB1234"}},
+		},
+		{
+			name:    "SOAP 1.1 server fault",
+			fault:   `<soap:Fault><faultcode>soap:Server</faultcode><faultstring>Database unavailable</faultstring></soap:Fault>`,
+			status:  http.StatusBadGateway,
+			code:    "Server",
+			message: "Database unavailable",
+		},
+		{
+			name:    "SOAP 1.2 sender fault",
+			version: "1.2",
+			fault: `<env:Fault xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Code><env:Value>env:Sender</env:Value></env:Code>` +
+				`<env:Reason><env:Text xml:lang="en">Unknown account</env:Text></env:Reason></env:Fault>`,
+			status:  http.StatusBadRequest,
+			code:    "Sender",
+			message: "Unknown account",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Faults are usually sent with a 500 status
+			u := newUpstream(t, http.StatusInternalServerError, envelope(tt.fault))
+			e := newServer(t, u.server.URL, config.SOAPConfig{
+				Version:    tt.version,
+				Operations: []config.SOAPOperation{getAccount},
+			})
+
+			rec := do(e, http.MethodGet, "/accounts/AB1234", "")
+			assert.Equal(t, tt.status, rec.Code)
+			body := decode(t, rec)
+			assert.Equal(t, tt.message, body["error"])
+			assert.Equal(t, tt.code, body["faultCode"])
+			assert.Equal(t, tt.detail, body["detail"])
+		})
+	}
+}
+
+func TestProxySOAP12(t *testing.T) {
+	u := newUpstream(t, http.StatusOK,
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><GetAccountResponse><account><id>AB1234</id></account></GetAccountResponse></env:Body></env:Envelope>`)
+	e := newServer(t, u.server.URL, config.SOAPConfig{
+		Version:    "1.2",
+		Operations: []config.SOAPOperation{getAccount},
+	})
+
+	rec := do(e, http.MethodGet, "/accounts/AB1234", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `application/soap+xml; charset=utf-8; action="urn:GetAccount"`, u.contentType)
+	assert.Empty(t, u.action)
+	assert.Contains(t, u.body, `xmlns:soap="http://www.w3.org/2003/05/soap-envelope"`)
+}
+
+func TestProxyInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+	}{
+		{"not XML", http.StatusOK, `{"ok": true}`},
+		{"not an envelope", http.StatusOK, `<GetAccountResponse/>`},
+		{"error without fault", http.StatusServiceUnavailable, envelope(``)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUpstream(t, tt.status, tt.response)
+			e := newServer(t, u.server.URL, config.SOAPConfig{Operations: []config.SOAPOperation{getAccount}})
+
+			rec := do(e, http.MethodGet, "/accounts/AB1234", "")
+			assert.Equal(t, http.StatusBadGateway, rec.Code)
+		})
+	}
+}
+
+func TestProxyMaxResponseSize(t *testing.T) {
+	u := newUpstream(t, http.StatusOK, envelope(`<GetAccountResponse>`+strings.Repeat("x", 1024)+`</GetAccountResponse>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{
+		MaxResponseSize: 512,
+		Operations:      []config.SOAPOperation{getAccount},
+	})
+
+	rec := do(e, http.MethodGet, "/accounts/AB1234", "")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestProxyValidatesAgainstSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.xsd")
+	require.NoError(t, os.WriteFile(path, []byte(accountsSchema), 0o600))
+
+	u := newUpstream(t, http.StatusOK, envelope(
+		`<GetAccountResponse><account><id>AB1234</id><balance>lots</balance></account></GetAccountResponse>`))
+	e := newServer(t, u.server.URL, config.SOAPConfig{
+		Schemas:           []string{path},
+		ValidateResponses: true,
+		Operations:        []config.SOAPOperation{getAccount},
+	})
+
+	rec := do(e, http.MethodGet, "/accounts/ab12?limit=many", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	body := decode(t, rec)
+	assert.Equal(t, "Request validation failed", body["error"])
+	assert.Len(t, body["details"], 2)
+	assert.Zero(t, u.calls.Load())
+
+	// The request is valid but the response is not
+	rec = do(e, http.MethodGet, "/accounts/AB1234?limit=5", "")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	body = decode(t, rec)
+	assert.Equal(t, "Response validation failed", body["error"])
+	assert.Equal(t, []interface{}{"/GetAccountResponse/account/balance: \"lots\" is not a valid decimal"}, body["details"])
+}
+
+func TestNewProxyErrors(t *testing.T) {
+	_, err := newProxy(config.SOAPConfig{
+		Operations: []config.SOAPOperation{{Name: "GetAccount", Request: "{{ .body.id "}},
+	})
+	assert.Error(t, err)
+
+	_, err = newProxy(config.SOAPConfig{
+		Schemas:    []string{filepath.Join(t.TempDir(), "missing.xsd")},
+		Operations: []config.SOAPOperation{getAccount},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package soap
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ordersSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:orders" xmlns:o="urn:orders">
+  <xs:simpleType name="Status">
+    <xs:restriction base="xs:string">
+      <xs:enumeration value="open"/>
+      <xs:enumeration value="closed"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="Quantity">
+    <xs:restriction base="xs:positiveInteger">
+      <xs:maxInclusive value="100"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:complexType name="Party">
+    <xs:sequence>
+      <xs:element name="name" type="xs:string"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:complexType name="Customer">
+    <xs:complexContent>
+      <xs:extension base="o:Party">
+        <xs:sequence>
+          <xs:element name="email" type="xs:string" minOccurs="0"/>
+        </xs:sequence>
+        <xs:attribute name="vip" type="xs:boolean"/>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+  <xs:complexType name="Price">
+    <xs:simpleContent>
+      <xs:extension base="xs:decimal">
+        <xs:attribute name="currency" type="xs:string" use="required"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+  <xs:element name="Order">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="customer" type="o:Customer"/>
+        <xs:choice>
+          <xs:element name="pickup" type="xs:date"/>
+          <xs:element name="address" type="xs:string"/>
+        </xs:choice>
+        <xs:element name="line" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:sequence>
+              <xs:element name="sku" type="xs:string"/>
+              <xs:element name="quantity" type="o:Quantity"/>
+              <xs:element name="price" type="o:Price"/>
+            </xs:sequence>
+          </xs:complexType>
+        </xs:element>
+        <xs:element name="note" type="xs:string" nillable="true" minOccurs="0"/>
+      </xs:sequence>
+      <xs:attribute name="status" type="o:Status" use="required"/>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+const validLine = `<line><sku>A-1</sku><quantity>2</quantity><price currency="EUR">9.99</price></line>`
+
+func TestSchemaValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.xsd")
+	require.NoError(t, os.WriteFile(path, []byte(ordersSchema), 0o600))
+
+	tests := []struct {
+		name    string
+		request string
+		errors  []interface{}
+	}{
+		{
+			name: "valid",
+			request: `<o:Order xmlns:o="urn:orders" status="open"><customer vip="true"><name>Ada</name><email>ada@example.com</email></customer>` +
+				`<pickup>2026-01-31</pickup>` + validLine + validLine + `<note xsi:nil="true" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"/></o:Order>`,
+		},
+		{
+			name:    "undeclared element",
+			request: `<Invoice/>`,
+			errors:  []interface{}{"/Invoice: element is not declared in the schema"},
+		},
+		{
+			name:    "missing and invalid attributes",
+			request: `<Order><customer vip="maybe"><name>Ada</name></customer><address>Main St</address>` + validLine + `</Order>`,
+			errors: []interface{}{
+				"/Order: missing attribute status",
+				`/Order/customer/@vip: "maybe" is not a valid boolean`,
+			},
+		},
+		{
+			name:    "enumeration",
+			request: `<Order status="lost"><customer><name>Ada</name></customer><address>Main St</address>` + validLine + `</Order>`,
+			errors:  []interface{}{`/Order/@status: "lost" is not one of open, closed`},
+		},
+		{
+			name:    "missing element",
+			request: `<Order status="open"><customer><name>Ada</name></customer><address>Main St</address></Order>`,
+			errors:  []interface{}{"/Order: missing element line"},
+		},
+		{
+			name: "unexpected element",
+			request: `<Order status="open"><customer><name>Ada</name></customer><address>Main St</address>` + validLine +
+				`<gift>yes</gift></Order>`,
+			errors: []interface{}{"/Order: unexpected element gift, expected line or note"},
+		},
+		{
+			name: "facets and simple content",
+			request: `<Order status="open"><customer><name>Ada</name></customer><pickup>tomorrow</pickup>` + validLine +
+				`<line><sku>A-2</sku><quantity>500</quantity><price>1</price></line></Order>`,
+			errors: []interface{}{
+				`/Order/pickup: "tomorrow" is not a valid date`,
+				`/Order/line[2]/quantity: 500 must be at most 100`,
+				"/Order/line[2]/price: missing attribute currency",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUpstream(t, http.StatusOK, envelope(`<OrderResponse/>`))
+			e := newServer(t, u.server.URL, config.SOAPConfig{
+				Schemas:    []string{path},
+				Operations: []config.SOAPOperation{{Name: "PlaceOrder", Request: tt.request}},
+			})
+
+			rec := do(e, http.MethodPost, "/accounts/PlaceOrder", "")
+			if tt.errors == nil {
+				assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, tt.errors, decode(t, rec)["details"])
+			assert.Zero(t, u.calls.Load())
+		})
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	dir := t.TempDir()
+	schemas := map[string]string{
+		"not XML":      `<xs:schema`,
+		"unknown type": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="Missing"/></xs:schema>`,
+		"type cycle":   `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="A"><xs:restriction base="B"/></xs:simpleType><xs:simpleType name="B"><xs:restriction base="A"/></xs:simpleType></xs:schema>`,
+		"bad pattern":  `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="A"><xs:restriction base="xs:string"><xs:pattern value="("/></xs:restriction></xs:simpleType></xs:schema>`,
+		"not a schema": `<definitions/>`,
+	}
+
+	for name, schema := range schemas {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".xsd")
+			require.NoError(t, os.WriteFile(path, []byte(schema), 0o600))
+
+			_, err := newProxy(config.SOAPConfig{
+				Schemas:    []string{path},
+				Operations: []config.SOAPOperation{getAccount},
+			})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/static"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(responder *static.Responder, method, target string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Any("/svc", responder.Handle)
+	e.Any("/svc/*", responder.Handle)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestStaticResponse(t *testing.T) {
+	responder := static.NewResponse(config.StaticResponseConfig{
+		Status:  http.StatusServiceUnavailable,
+		Headers: map[string]string{"Retry-After": "120"},
+		Body:    "<html><body>Down for maintenance</body></html>",
+	})
+
+	rec := serve(responder, http.MethodGet, "/svc/anything")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "120", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "<html><body>Down for maintenance</body></html>", rec.Body.String())
+
+	rec = serve(responder, http.MethodHead, "/svc")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "46", rec.Header().Get(echo.HeaderContentLength))
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestStaticResponseContentType(t *testing.T) {
+	responder := static.NewResponse(config.StaticResponseConfig{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    `{"issuer":"https://auth.example.com"}`,
+	})
+
+	rec := serve(responder, http.MethodGet, "/svc/.well-known/openid-configuration")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{"issuer":"https://auth.example.com"}`, rec.Body.String())
+
+	rec = serve(static.NewResponse(config.StaticResponseConfig{Status: http.StatusNoContent}), http.MethodGet, "/svc")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestRedirect(t *testing.T) {
+	responder, err := static.NewRedirect("/svc", config.RedirectConfig{
+		Status:   http.StatusMovedPermanently,
+		Location: "https://new.example.com/v2{{.Subpath}}{{if .Query}}?{{.Query}}{{end}}",
+	})
+	require.NoError(t, err)
+
+	rec := serve(responder, http.MethodGet, "/svc/orders/42?expand=items")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "https://new.example.com/v2/orders/42?expand=items", rec.Header().Get(echo.HeaderLocation))
+
+	rec = serve(responder, http.MethodGet, "/svc")
+	assert.Equal(t, "https://new.example.com/v2", rec.Header().Get(echo.HeaderLocation))
+}
+
+func TestRedirectDefaults(t *testing.T) {
+	responder, err := static.NewRedirect("/svc", config.RedirectConfig{Location: "{{.Scheme}}://{{.Host}}/new{{.Path}}"})
+	require.NoError(t, err)
+
+	rec := serve(responder, http.MethodGet, "/svc/a")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "http://example.com/new/svc/a", rec.Header().Get(echo.HeaderLocation))
+
+	_, err = static.NewRedirect("/svc", config.RedirectConfig{Location: "{{.Subpath"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,196 @@
+package streaming
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/streaming"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	batches map[string][][]streaming.Message
+}
+
+func (m *memorySink) Publish(ctx context.Context, topic string, messages []streaming.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.batches == nil {
+		m.batches = make(map[string][][]streaming.Message)
+	}
+	m.batches[topic] = append(m.batches[topic], messages)
+	return nil
+}
+
+func (m *memorySink) Close() error { return nil }
+
+func (m *memorySink) get(topic string) [][]streaming.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.batches[topic]
+}
+
+func TestPipelineBatchesBySize(t *testing.T) {
+	sink := &memorySink{}
+	p := streaming.NewPipeline(config.StreamingConfig{
+		Backend:       "kafka",
+		Schema:        streaming.SchemaJSON,
+		AccessTopic:   "access",
+		AuditTopic:    "audit",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	}, sink, logrus.New())
+	require.NoError(t, p.Start())
+
+	for i := 0; i < 4; i++ {
+		p.PublishAccess(streaming.AccessRecord{Method: "GET", Path: fmt.Sprintf("/api/%d", i), Status: 200, ClientIP: "10.0.0.1"})
+	}
+
+	require.Eventually(t, func() bool { return len(sink.get("access")) == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	batch := sink.get("access")[0]
+	require.Len(t, batch, 2)
+	assert.Equal(t, "10.0.0.1", batch[0].Key)
+
+	var record streaming.AccessRecord
+	require.NoError(t, json.Unmarshal(batch[0].Value, &record))
+	assert.Equal(t, streaming.AccessSchema, record.Schema)
+	assert.Equal(t, "/api/0", record.Path)
+
+	require.NoError(t, p.Stop())
+	assert.Equal(t, int64(4), p.Stats().Published)
+}
+
+func TestPipelineFlushesOnStop(t *testing.T) {
+	sink := &memorySink{}
+	p := streaming.NewPipeline(config.StreamingConfig{
+		Backend:       "nats",
+		Schema:        streaming.SchemaCloudEvents,
+		AccessTopic:   "access",
+		AuditTopic:    "audit",
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+	}, sink, logrus.New())
+	require.NoError(t, p.Start())
+
+	p.PublishAudit(streaming.AuditRecord{Action: "service.created", Resource: "service/users", Status: "success", Timestamp: time.Now()})
+	require.NoError(t, p.Stop())
+
+	batches := sink.get("audit")
+	require.Len(t, batches, 1)
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(batches[0][0].Value, &envelope))
+	assert.Equal(t, "1.0", envelope["specversion"])
+	assert.Equal(t, streaming.AuditSchema, envelope["type"])
+	data := envelope["data"].(map[string]interface{})
+	assert.Equal(t, "service.created", data["action"])
+}
+
+func TestKafkaSinkPublishesThroughRestProxy(t *testing.T) {
+	var path, contentType string
+	var body map[string][]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+
+	sink := streaming.NewKafkaSink(config.StreamingKafkaConfig{RestProxyURL: server.URL, Timeout: time.Second})
+	err := sink.Publish(context.Background(), "odin.access", []streaming.Message{
+		{Key: "10.0.0.1", Value: []byte(`{"path":"/api"}`)},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/topics/odin.access", path)
+	assert.Equal(t, "application/vnd.kafka.json.v2+json", contentType)
+	require.Len(t, body["records"], 1)
+	assert.Equal(t, "10.0.0.1", body["records"][0]["key"])
+	assert.Equal(t, map[string]interface{}{"path": "/api"}, body["records"][0]["value"])
+}
+
+func TestKafkaSinkReportsRecordErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"offsets":[{"partition":0,"error_code":40403,"error":"topic not found"}]}`))
+	}))
+	defer server.Close()
+
+	sink := streaming.NewKafkaSink(config.StreamingKafkaConfig{RestProxyURL: server.URL, Timeout: time.Second})
+	err := sink.Publish(context.Background(), "missing", []streaming.Message{{Value: []byte(`{}`)}})
+	assert.ErrorContains(t, err, "topic not found")
+}
+
+// fakeNATS accepts one client, answers the handshake and records published payloads
+func fakeNATS(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "PING":
+				conn.Write([]byte("PONG\r\n"))
+			case strings.HasPrefix(line, "PUB "):
+				parts := strings.Fields(line)
+				size, _ := strconv.Atoi(parts[len(parts)-1])
+				payload := make([]byte, size+2)
+				io.ReadFull(reader, payload)
+				published <- parts[1] + " " + string(payload[:size])
+			}
+		}
+	}()
+
+	return "nats://" + ln.Addr().String(), published
+}
+
+func TestNATSSinkPublishes(t *testing.T) {
+	url, published := fakeNATS(t)
+
+	sink := streaming.NewNATSSink(config.StreamingNATSConfig{URL: url, Timeout: time.Second})
+	defer sink.Close()
+
+	err := sink.Publish(context.Background(), "odin.audit", []streaming.Message{
+		{Value: []byte(`{"action":"a"}`)},
+		{Value: []byte(`{"action":"b"}`)},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `odin.audit {"action":"a"}`, <-published)
+	assert.Equal(t, `odin.audit {"action":"b"}`, <-published)
+}
@@ -0,0 +1,109 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"odin/pkg/systemd"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 256)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listen(t)
+
+	sent, err := systemd.Notify(systemd.Ready)
+	require.NoError(t, err)
+	assert.True(t, sent)
+	assert.Equal(t, "READY=1", receive(t, conn))
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := systemd.Notify(systemd.Ready)
+	assert.NoError(t, err)
+	assert.False(t, sent)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	_, ok := systemd.WatchdogInterval()
+	assert.False(t, ok)
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	interval, ok := systemd.WatchdogInterval()
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, interval)
+
+	// Meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	_, ok = systemd.WatchdogInterval()
+	assert.False(t, ok)
+}
+
+func TestRunWatchdogPingsOnlyWhileHealthy(t *testing.T) {
+	conn := listen(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+	check := func(context.Context) error {
+		if healthy.Load() {
+			return nil
+		}
+		return errors.New("wedged")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		systemd.RunWatchdog(ctx, 40*time.Millisecond, check, logger)
+		close(done)
+	}()
+
+	assert.Equal(t, "WATCHDOG=1", receive(t, conn))
+
+	healthy.Store(false)
+	// Drain a ping that may have been in flight
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(30*time.Millisecond)))
+	conn.Read(make([]byte, 64))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err := conn.Read(make([]byte, 64))
+	assert.Error(t, err, "no pings while the self-check fails")
+
+	cancel()
+	<-done
+}
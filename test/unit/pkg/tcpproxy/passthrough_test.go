@@ -0,0 +1,174 @@
+package tcpproxy
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tlsBackend terminates TLS with a self-signed certificate for names and
+// answers every line with the name of the backend and the line. It returns
+// its address and the certificate pool clients need to trust it.
+func tlsBackend(t *testing.T, name string, names ...string) (string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					io.WriteString(conn, name+": "+scanner.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), roots
+}
+
+// tlsRoundTrip sends a line over TLS for serverName and returns the reply
+func tlsRoundTrip(t *testing.T, addr, serverName string, roots *x509.CertPool) (string, error) {
+	t.Helper()
+	dialer := &net.Dialer{Timeout: time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: serverName, RootCAs: roots})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	return strings.TrimSpace(reply), err
+}
+
+func TestPassthroughRoutesByServerName(t *testing.T) {
+	api, apiRoots := tlsBackend(t, "api", "api.example.com")
+	tenants, tenantRoots := tlsBackend(t, "tenants", "*.tenants.example.com")
+	fallback, fallbackRoots := tlsBackend(t, "fallback", "www.example.com", "example.com")
+
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:    "tls",
+		Mode:    "tls-passthrough",
+		Targets: []string{fallback},
+		Routes: []config.TLSRouteConfig{
+			{ServerNames: []string{"API.example.com"}, Targets: []string{api}},
+			{ServerNames: []string{"*.tenants.example.com"}, Targets: []string{tenants}},
+		},
+	})
+
+	for _, tt := range []struct {
+		serverName string
+		roots      *x509.CertPool
+		reply      string
+	}{
+		{"api.example.com", apiRoots, "api: ping"},
+		{"acme.tenants.example.com", tenantRoots, "tenants: ping"},
+		// Wildcards cover a single label
+		{"www.example.com", fallbackRoots, "fallback: ping"},
+		{"example.com", fallbackRoots, "fallback: ping"},
+	} {
+		// The handshake is completed by the backend, so the client sees
+		// and verifies its certificate
+		reply, err := tlsRoundTrip(t, addr, tt.serverName, tt.roots)
+		require.NoError(t, err, tt.serverName)
+		assert.Equal(t, tt.reply, reply, tt.serverName)
+	}
+
+	stats := proxy.Stats()
+	assert.Equal(t, "tls-passthrough", stats.Mode)
+	assert.Equal(t, int64(4), stats.Accepted)
+	assert.Zero(t, stats.Unrouted)
+	require.Len(t, stats.Routes, 2)
+	assert.Equal(t, []string{"api.example.com"}, stats.Routes[0].ServerNames)
+	assert.Equal(t, api, stats.Routes[0].Targets[0].Address)
+}
+
+func TestPassthroughWithoutRoute(t *testing.T) {
+	api, apiRoots := tlsBackend(t, "api", "api.example.com", "other.example.com")
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:   "tls",
+		Mode:   "tls-passthrough",
+		Routes: []config.TLSRouteConfig{{ServerNames: []string{"api.example.com"}, Targets: []string{api}}},
+	})
+
+	_, err := tlsRoundTrip(t, addr, "other.example.com", apiRoots)
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), proxy.Stats().Unrouted)
+
+	reply, err := tlsRoundTrip(t, addr, "api.example.com", apiRoots)
+	require.NoError(t, err)
+	assert.Equal(t, "api: ping", reply)
+}
+
+func TestPassthroughRequiresClientHello(t *testing.T) {
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:               "tls",
+		Mode:               "tls-passthrough",
+		Targets:            []string{backend(t, "plain")},
+		Routes:             []config.TLSRouteConfig{{ServerNames: []string{"api.example.com"}, Targets: []string{backend(t, "api")}}},
+		ClientHelloTimeout: 100 * time.Millisecond,
+	})
+
+	// Plain text is not relayed, even to the listener's own targets
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	io.WriteString(conn, "GET / HTTP/1.1\r\n\r\n")
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Error(t, err)
+
+	// Clients that send nothing are dropped after the timeout
+	silent, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer silent.Close()
+	silent.SetDeadline(time.Now().Add(time.Second))
+	dialed := time.Now()
+	_, err = silent.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Less(t, time.Since(dialed), 500*time.Millisecond)
+
+	assert.Equal(t, int64(2), proxy.Stats().Unrouted)
+}
@@ -0,0 +1,256 @@
+package tcpproxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/health"
+	"odin/pkg/tcpproxy"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend answers every line with its name and the line, and closes its
+// side once the client has finished sending
+func backend(t *testing.T, name string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					io.WriteString(conn, name+": "+scanner.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// closedAddr returns an address nothing listens on
+func closedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func start(t *testing.T, cfg config.TCPListenerConfig) (*tcpproxy.Proxy, string) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	proxy := tcpproxy.New(cfg, logger, health.NewAlertManager(logger))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go proxy.Serve(l)
+	t.Cleanup(func() { proxy.Shutdown(context.Background()) })
+	return proxy, l.Addr().String()
+}
+
+// roundTrip sends a line on a new connection and returns the reply
+func roundTrip(t *testing.T, addr, line string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = io.WriteString(conn, line+"\n")
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(reply)
+}
+
+func TestProxyRoundRobin(t *testing.T) {
+	_, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{backend(t, "a"), backend(t, "b")},
+	})
+
+	assert.Equal(t, "a: ping", roundTrip(t, addr, "ping"))
+	assert.Equal(t, "b: ping", roundTrip(t, addr, "ping"))
+	assert.Equal(t, "a: ping", roundTrip(t, addr, "ping"))
+}
+
+func TestProxySkipsUnreachableTargets(t *testing.T) {
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{closedAddr(t), backend(t, "a")},
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "a: ping", roundTrip(t, addr, "ping"))
+	}
+	assert.Zero(t, proxy.Stats().Failed)
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	down := closedAddr(t)
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{down, backend(t, "a")},
+		HealthCheck: &config.HealthCheckConfig{
+			Enabled:            true,
+			Interval:           10 * time.Millisecond,
+			UnhealthyThreshold: 1,
+		},
+	})
+
+	require.Eventually(t, func() bool {
+		return !proxy.Stats().Targets[0].Healthy
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, proxy.Stats().Targets[1].Healthy)
+	assert.Equal(t, "a: ping", roundTrip(t, addr, "ping"))
+}
+
+func TestProxyDisabledTargets(t *testing.T) {
+	a, b := backend(t, "a"), backend(t, "b")
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	proxy := tcpproxy.New(config.TCPListenerConfig{Name: "echo", Targets: []string{a, b}}, logger, health.NewAlertManager(logger))
+	maintenance := health.NewMaintenance()
+	maintenance.Disable(a, "", "alice")
+	proxy.SetMaintenance(maintenance)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go proxy.Serve(l)
+	t.Cleanup(func() { proxy.Shutdown(context.Background()) })
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b: ping", roundTrip(t, l.Addr().String(), "ping"))
+	}
+	assert.True(t, proxy.Stats().Targets[0].Disabled)
+
+	maintenance.Enable(a)
+	assert.False(t, proxy.Stats().Targets[0].Disabled)
+}
+
+func TestProxyNoTargets(t *testing.T) {
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{closedAddr(t)},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, int64(1), proxy.Stats().Failed)
+}
+
+func TestProxyMaxConnections(t *testing.T) {
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:           "echo",
+		Targets:        []string{backend(t, "a")},
+		MaxConnections: 1,
+	})
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	require.Eventually(t, func() bool { return proxy.Stats().Active == 1 }, time.Second, 5*time.Millisecond)
+
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(time.Second))
+	_, err = second.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), proxy.Stats().Rejected)
+
+	first.Close()
+	require.Eventually(t, func() bool { return proxy.Stats().Active == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "a: ping", roundTrip(t, addr, "ping"))
+}
+
+func TestProxyHalfClose(t *testing.T) {
+	_, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{backend(t, "a")},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	// The reply is still delivered after the client stops sending
+	_, err = io.WriteString(conn, "one\ntwo\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	reply, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "a: one\na: two\n", string(reply))
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	_, addr := start(t, config.TCPListenerConfig{
+		Name:        "echo",
+		Targets:     []string{backend(t, "a")},
+		IdleTimeout: 100 * time.Millisecond,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+
+	// Traffic keeps the connection open past the timeout
+	for i := 0; i < 4; i++ {
+		_, err = io.WriteString(conn, "ping\n")
+		require.NoError(t, err)
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	idleSince := time.Now()
+	_, err = reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+	assert.Less(t, time.Since(idleSince), 500*time.Millisecond)
+}
+
+func TestProxyShutdownDrains(t *testing.T) {
+	proxy, addr := start(t, config.TCPListenerConfig{
+		Name:    "echo",
+		Targets: []string{backend(t, "a")},
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	require.Eventually(t, func() bool { return proxy.Stats().Active == 1 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, proxy.Shutdown(ctx), context.DeadlineExceeded)
+
+	// Open connections were closed and no new ones are accepted
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"odin/pkg/tracing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector records the OTLP log exports it receives
+type collector struct {
+	mu       sync.Mutex
+	paths    []string
+	requests []*collogspb.ExportLogsServiceRequest
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := &collogspb.ExportLogsServiceRequest{}
+	if r.Header.Get("Content-Type") != "application/x-protobuf" || proto.Unmarshal(body, req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.paths = append(c.paths, r.URL.Path)
+	c.requests = append(c.requests, req)
+	c.mu.Unlock()
+}
+
+func (c *collector) records() []*logspb.LogRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var records []*logspb.LogRecord
+	for _, req := range c.requests {
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				records = append(records, sl.LogRecords...)
+			}
+		}
+	}
+	return records
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	m := make(map[string]*commonpb.AnyValue, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestLogExport(t *testing.T) {
+	col := &collector{}
+	server := httptest.NewServer(col)
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.DebugLevel)
+	manager, err := tracing.NewManager(tracing.Config{
+		ServiceName: "odin-test",
+		Environment: "test",
+		Endpoint:    server.URL + "/v1/traces", // The traces endpoint of the collector
+		Logs:        tracing.LogsConfig{Enabled: true, Level: "info", FlushInterval: time.Hour},
+	}, logger)
+	require.NoError(t, err)
+
+	span := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     oteltrace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+	ctx := oteltrace.ContextWithSpanContext(context.Background(), span)
+
+	logger.Debug("Not exported")
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"service": "orders",
+		"status":  502,
+		"latency": 1.5,
+		"retried": true,
+	}).WithError(errors.New("connection refused")).Warn("Request failed")
+
+	// Stopping exports what is queued
+	require.NoError(t, manager.Shutdown(context.Background()))
+
+	assert.Contains(t, col.paths, "/v1/logs")
+	records := col.records()
+	var failed *logspb.LogRecord
+	for _, r := range records {
+		assert.NotEqual(t, "Not exported", r.Body.GetStringValue())
+		if r.Body.GetStringValue() == "Request failed" {
+			failed = r
+		}
+	}
+	require.NotNil(t, failed)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, failed.SeverityNumber)
+	assert.Equal(t, "WARNING", failed.SeverityText)
+	assert.NotZero(t, failed.TimeUnixNano)
+
+	traceID, spanID := span.TraceID(), span.SpanID()
+	assert.Equal(t, traceID[:], failed.TraceId)
+	assert.Equal(t, spanID[:], failed.SpanId)
+	assert.Equal(t, uint32(1), failed.Flags)
+
+	attrs := attributes(failed.Attributes)
+	assert.Equal(t, "orders", attrs["service"].GetStringValue())
+	assert.Equal(t, int64(502), attrs["status"].GetIntValue())
+	assert.Equal(t, 1.5, attrs["latency"].GetDoubleValue())
+	assert.True(t, attrs["retried"].GetBoolValue())
+	assert.Equal(t, "connection refused", attrs["error"].GetStringValue())
+
+	// Records carry the same resource as traces
+	resource := attributes(col.requests[0].ResourceLogs[0].Resource.Attributes)
+	assert.Equal(t, "odin-test", resource["service.name"].GetStringValue())
+	assert.Equal(t, "test", resource["deployment.environment"].GetStringValue())
+}
+
+func TestLogExportBatches(t *testing.T) {
+	col := &collector{}
+	server := httptest.NewServer(col)
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager, err := tracing.NewManager(tracing.Config{
+		Endpoint: server.URL,
+		Logs:     tracing.LogsConfig{Enabled: true, BatchSize: 2, FlushInterval: time.Hour},
+	}, logger)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		logger.Info("Batched")
+	}
+	assert.Eventually(t, func() bool {
+		col.mu.Lock()
+		defer col.mu.Unlock()
+		return len(col.requests) >= 2
+	}, 2*time.Second, 10*time.Millisecond, "full batches are sent without waiting for the interval")
+	require.NoError(t, manager.Shutdown(context.Background()))
+	assert.Equal(t, "/v1/logs", col.paths[0])
+}
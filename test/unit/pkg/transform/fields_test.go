@@ -0,0 +1,58 @@
+package transform
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/transform"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldRules(t *testing.T) {
+	rules, err := transform.CompileFieldRules([]transform.FieldRule{
+		{Method: http.MethodGet, Path: "/api/users/{id}", Fields: []string{"$.id", "$.name", "$.address.city", "tags"}},
+		{Path: "/api/users", Fields: []string{"items[*].id", "total"}},
+	})
+	require.NoError(t, err)
+
+	filter := rules.Match(httptest.NewRequest(http.MethodGet, "/api/users/7", nil))
+	require.NotNil(t, filter)
+	body, err := filter.Apply([]byte(`{
+		"id": 12345678901234567,
+		"name": "Ada <admin>",
+		"passwordHash": "x",
+		"address": {"city": "London", "street": "1 Main St"},
+		"tags": ["a", "b"],
+		"name2": "hidden"
+	}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id": 12345678901234567, "name": "Ada <admin>", "address": {"city": "London"}, "tags": ["a", "b"]}`, string(body))
+	assert.Contains(t, string(body), "<admin>", "no HTML escaping")
+
+	filter = rules.Match(httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	require.NotNil(t, filter)
+	body, err = filter.Apply([]byte(`{"items": [{"id": 1, "email": "a@x"}, {"id": 2, "email": "b@x"}, "bogus"], "total": 2, "cursor": "c"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"items": [{"id": 1}, {"id": 2}], "total": 2}`, string(body))
+
+	assert.Nil(t, rules.Match(httptest.NewRequest(http.MethodDelete, "/api/users/7", nil)))
+	var none *transform.FieldRules
+	assert.Nil(t, none.Match(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	assert.True(t, filter.Filters("application/json; charset=utf-8"))
+	assert.False(t, filter.Filters("text/html"))
+	_, err = filter.Apply([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestCompileFieldRulesRejectsInvalidFields(t *testing.T) {
+	_, err := transform.CompileFieldRules([]transform.FieldRule{{Path: "/users"}})
+	assert.Error(t, err)
+	_, err = transform.CompileFieldRules([]transform.FieldRule{{Fields: []string{"$"}}})
+	assert.Error(t, err)
+	_, err = transform.CompileFieldRules([]transform.FieldRule{{Fields: []string{"items[0].id"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package transform
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"odin/pkg/transform"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderRules(t *testing.T) {
+	rules, err := transform.CompileHeaderRules([]transform.HeaderRule{
+		{Action: transform.HeaderSet, Name: "X-Gateway", Value: "odin"},
+		{Action: transform.HeaderAdd, Name: "X-Tag", Value: "b"},
+		{Action: transform.HeaderRemove, Name: "Cookie"},
+		{Action: transform.HeaderRename, Name: "X-Api-Version", From: "Accept-Version"},
+		{Action: transform.HeaderCopyFromClaim, Name: "X-User", From: "sub"},
+		{Action: transform.HeaderCopyFromClaim, Name: "X-Org", From: "org.id"},
+		{Action: transform.HeaderCopyFromClaim, Name: "X-Missing", From: "email"},
+		{Action: transform.HeaderCopyFromHeader, Name: "X-Client-Id", From: "X-Request-Id"},
+		{Action: transform.HeaderSet, Name: "X-Admin", Value: "true", Method: http.MethodDelete},
+		{Action: transform.HeaderSet, Name: "X-Order-Route", Value: "true", Path: "/api/orders/{id}"},
+	}, []transform.HeaderRule{
+		{Action: transform.HeaderRemove, Name: "Server"},
+		{Action: transform.HeaderCopyFromHeader, Name: "X-Request-Id", From: "X-Request-Id"},
+	})
+	require.NoError(t, err)
+
+	client := httptest.NewRequest(http.MethodGet, "/api/orders/7", nil)
+	client.Header.Set("X-Request-Id", "req-1")
+	claims := map[string]interface{}{
+		"sub": "user-1",
+		"org": map[string]interface{}{"id": 42.0},
+	}
+
+	upstream := http.Header{
+		"X-Tag":          {"a"},
+		"Cookie":         {"session=1"},
+		"Accept-Version": {"2", "3"},
+		"X-Request-Id":   {"req-1"},
+	}
+	rules.ApplyRequest(upstream, client, claims)
+	assert.Equal(t, "odin", upstream.Get("X-Gateway"))
+	assert.Equal(t, []string{"a", "b"}, upstream.Values("X-Tag"))
+	assert.Empty(t, upstream.Get("Cookie"))
+	assert.Empty(t, upstream.Get("Accept-Version"))
+	assert.Equal(t, []string{"2", "3"}, upstream.Values("X-Api-Version"))
+	assert.Equal(t, "user-1", upstream.Get("X-User"))
+	assert.Equal(t, "42", upstream.Get("X-Org"))
+	assert.NotContains(t, upstream, "X-Missing")
+	assert.Equal(t, "req-1", upstream.Get("X-Client-Id"))
+	assert.NotContains(t, upstream, "X-Admin", "rule for another method")
+	assert.Equal(t, "true", upstream.Get("X-Order-Route"))
+
+	// Rules on claims do nothing for anonymous clients
+	anonymous := http.Header{}
+	rules.ApplyRequest(anonymous, httptest.NewRequest(http.MethodGet, "/api/orders", nil), nil)
+	assert.NotContains(t, anonymous, "X-User")
+	assert.NotContains(t, anonymous, "X-Order-Route", "rule for another path")
+
+	response := http.Header{"Server": {"nginx"}}
+	rules.ApplyResponse(response, client, claims)
+	assert.Empty(t, response.Get("Server"))
+	assert.Equal(t, "req-1", response.Get("X-Request-Id"))
+}
+
+func TestCompileHeaderRulesRejectsInvalidRules(t *testing.T) {
+	_, err := transform.CompileHeaderRules([]transform.HeaderRule{{Action: "append", Name: "X-A"}}, nil)
+	assert.Error(t, err)
+	_, err = transform.CompileHeaderRules(nil, []transform.HeaderRule{{Action: transform.HeaderSet}})
+	assert.Error(t, err)
+	_, err = transform.CompileHeaderRules([]transform.HeaderRule{{Action: transform.HeaderRename, Name: "X-A"}}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/transform"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateRules(t *testing.T) {
+	templates, err := transform.CompileTemplates([]transform.TemplateRule{
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/users/{id}/orders",
+			Request:  `{"customer":{"id":{{ toJson .params.id }},"tenant":{{ toJson .claims.tenant }}},"lines":{{ toJson .body.items }},"source":{{ toJson (index .headers "X-Source") }}}`,
+			Response: `{"status":{{ .status }},"order":{{ toJson .body.id }},"user":{{ toJson .params.id }},"page":{{ toJson .query.page }}}`,
+		},
+		{Path: "/api/users", Response: `{{ len .body }} users`},
+	})
+	require.NoError(t, err)
+
+	client := httptest.NewRequest(http.MethodPost, "/api/users/42/orders?page=2", nil)
+	client.Header.Set("X-Source", "mobile")
+	match := templates.Match(client, map[string]interface{}{"tenant": "acme"})
+	require.NotNil(t, match)
+	assert.True(t, match.RewritesResponse())
+	assert.Nil(t, templates.Match(httptest.NewRequest(http.MethodGet, "/api/users/42/orders", nil), nil), "method differs")
+	assert.Nil(t, templates.Match(httptest.NewRequest(http.MethodPost, "/api/users/42", nil), nil), "path differs")
+
+	engine := transform.NewEngine(logrus.New())
+	req := httptest.NewRequest(http.MethodPost, "http://orders/users/42/orders", strings.NewReader(`{"items":[{"sku":"A1","qty":12345678901234567}]}`))
+	req.Header.Set("X-Source", "mobile")
+	require.NoError(t, engine.ApplyRequestWith(req, nil, match))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"customer":{"id":"42","tenant":"acme"},"lines":[{"sku":"A1","qty":12345678901234567}],"source":"mobile"}`, string(body))
+
+	body, headers, err := engine.ApplyResponseWith([]byte(`{"id":"o-1"}`), http.StatusCreated,
+		http.Header{"Content-Type": {"application/json"}, "Content-Length": {"12"}}, nil, match)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":201,"order":"o-1","user":"42","page":"2"}`, string(body))
+	assert.Empty(t, headers.Get("Content-Length"))
+
+	// Later rules apply when earlier ones do not match
+	match = templates.Match(httptest.NewRequest(http.MethodGet, "/api/users", nil), nil)
+	require.NotNil(t, match)
+	body, _, err = engine.ApplyResponseWith([]byte(`[{"id":1},{"id":2}]`), http.StatusOK, http.Header{}, nil, match)
+	require.NoError(t, err)
+	assert.Equal(t, "2 users", string(body))
+}
+
+func TestTemplateRulesRunBetweenConversions(t *testing.T) {
+	templates, err := transform.CompileTemplates([]transform.TemplateRule{
+		{Request: `{"order":{"id":{{ toJson .body.id }}}}`},
+	})
+	require.NoError(t, err)
+	request, err := transform.CompileRequest(&transform.RequestTransform{Convert: transform.ConvertJSONToXML})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":7,"ignored":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine := transform.NewEngine(logrus.New())
+	require.NoError(t, engine.ApplyRequestWith(req, request, templates.Match(req, nil)))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<order><id>7</id></order>`)
+}
+
+func TestFailedRequestTransformKeepsBody(t *testing.T) {
+	request, err := transform.CompileRequest(&transform.RequestTransform{Convert: transform.ConvertJSONToXML})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"first name":"Ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine := transform.NewEngine(logrus.New())
+	assert.Error(t, engine.ApplyRequest(req, request))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"first name":"Ada"}`, string(body))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+}
+
+func TestCompileTemplatesRejectsInvalidRules(t *testing.T) {
+	_, err := transform.CompileTemplates([]transform.TemplateRule{{Path: "/orders"}})
+	assert.Error(t, err)
+	_, err = transform.CompileTemplates([]transform.TemplateRule{{Request: "{{ .body"}})
+	assert.Error(t, err)
+}
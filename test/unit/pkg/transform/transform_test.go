@@ -0,0 +1,152 @@
+package transform
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/transform"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathGetAndSet(t *testing.T) {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{"id": "42", "name": "Ada"},
+	}
+
+	value, ok := transform.CompilePath("$.user.id").Get(data)
+	require.True(t, ok)
+	assert.Equal(t, "42", value)
+
+	_, ok = transform.CompilePath("$.user.email").Get(data)
+	assert.False(t, ok)
+	_, ok = transform.CompilePath("$.user.id.value").Get(data)
+	assert.False(t, ok)
+
+	root := transform.CompilePath("$")
+	assert.True(t, root.IsRoot())
+	value, ok = root.Get(data)
+	require.True(t, ok)
+	assert.Equal(t, data, value)
+
+	result := map[string]interface{}{}
+	transform.CompilePath("$.owner.profile.id").Set(result, "42")
+	assert.Equal(t, map[string]interface{}{
+		"owner": map[string]interface{}{
+			"profile": map[string]interface{}{"id": "42"},
+		},
+	}, result)
+}
+
+func TestCompiledRequestTransform(t *testing.T) {
+	compiled, err := transform.CompileRequest(&transform.RequestTransform{
+		Headers:     map[string]string{"X-Tenant": `{{ index . "X-Org" | lower }}`},
+		QueryParams: map[string]string{"version": `{{ default "v1" .version }}`},
+		Body:        `{"userId":"{{ .id }}"}`,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/users?page=2", strings.NewReader(`{"id":"42"}`))
+	req.Header.Set("X-Org", "ACME")
+
+	engine := transform.NewEngine(logrus.New())
+	require.NoError(t, engine.ApplyRequest(req, compiled))
+
+	assert.Equal(t, "acme", req.Header.Get("X-Tenant"))
+	assert.Equal(t, "v1", req.URL.Query().Get("version"))
+	assert.Equal(t, "2", req.URL.Query().Get("page"))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"userId":"42"}`, string(body))
+
+	// Retries resend the transformed body
+	require.NotNil(t, req.GetBody)
+	rewound, err := req.GetBody()
+	require.NoError(t, err)
+	body, err = io.ReadAll(rewound)
+	require.NoError(t, err)
+	assert.Equal(t, `{"userId":"42"}`, string(body))
+}
+
+func TestCompiledResponseTransform(t *testing.T) {
+	compiled, err := transform.CompileResponse(&transform.ResponseTransform{
+		Headers: map[string]string{"X-Gateway": "odin"},
+		Body:    `{"status":{{ .statusCode }},"name":{{ toJson .name }}}`,
+	})
+	require.NoError(t, err)
+
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	engine := transform.NewEngine(logrus.New())
+	body, newHeaders, err := engine.ApplyResponse([]byte(`{"name":"Ada"}`), http.StatusOK, headers, compiled)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"status":200,"name":"Ada"}`, string(body))
+	assert.Equal(t, "odin", newHeaders.Get("X-Gateway"))
+	assert.Empty(t, headers.Get("X-Gateway"), "original headers are left untouched")
+}
+
+func TestCompileRejectsInvalidTemplates(t *testing.T) {
+	_, err := transform.CompileRequest(&transform.RequestTransform{
+		Headers: map[string]string{"X-Broken": "{{ .unclosed"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "X-Broken")
+
+	_, err = transform.CompileResponse(&transform.ResponseTransform{Body: "{{ nosuchfunc . }}"})
+	assert.Error(t, err)
+}
+
+var benchmarkResponse = &transform.ResponseTransform{
+	Headers: map[string]string{"X-Gateway": "odin", "X-Request-Type": `{{ index . "Content-Type" }}`},
+	Body:    `{"user":{{ toJson .user }},"status":{{ .statusCode }}}`,
+}
+
+func BenchmarkTransformResponse(b *testing.B) {
+	engine := transform.NewEngine(logrus.New())
+	body := []byte(`{"user":{"id":"42","name":"Ada"}}`)
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := engine.TransformResponse(body, http.StatusOK, headers, benchmarkResponse); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkApplyCompiledResponse(b *testing.B) {
+	engine := transform.NewEngine(logrus.New())
+	body := []byte(`{"user":{"id":"42","name":"Ada"}}`)
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	compiled, err := transform.CompileResponse(benchmarkResponse)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := engine.ApplyResponse(body, http.StatusOK, headers, compiled); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPathGet(b *testing.B) {
+	data := map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{"id": "42"},
+		},
+	}
+	path := transform.CompilePath("$.data.user.id")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, ok := path.Get(data); !ok {
+			b.Fatal("value not found")
+		}
+	}
+}
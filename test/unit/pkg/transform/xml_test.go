@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"odin/pkg/transform"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderXML = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <order id="7" xmlns="urn:orders">
+      <item>apple</item>
+      <item>pear</item>
+      <note lang="en">ring twice</note>
+      <gift/>
+    </order>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestXMLToJSON(t *testing.T) {
+	body, err := transform.XMLToJSON([]byte(orderXML), transform.XMLOptions{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Envelope": {"Body": {"order": {
+		"@id": "7",
+		"item": ["apple", "pear"],
+		"note": {"@lang": "en", "#text": "ring twice"},
+		"gift": ""
+	}}}}`, string(body))
+
+	body, err = transform.XMLToJSON([]byte(orderXML), transform.XMLOptions{
+		AttributePrefix: "_",
+		TextKey:         "value",
+		KeepNamespaces:  true,
+		RootElement:     "soap:Envelope",
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"_xmlns:soap": "http://schemas.xmlsoap.org/soap/envelope/",
+		"soap:Body": {"order": {
+			"_id": "7",
+			"_xmlns": "urn:orders",
+			"item": ["apple", "pear"],
+			"note": {"_lang": "en", "value": "ring twice"},
+			"gift": ""
+		}}
+	}`, string(body))
+
+	_, err = transform.XMLToJSON([]byte(`<order><item>apple</order>`), transform.XMLOptions{})
+	assert.Error(t, err)
+	_, err = transform.XMLToJSON([]byte(`not xml`), transform.XMLOptions{})
+	assert.Error(t, err)
+}
+
+func TestJSONToXML(t *testing.T) {
+	body, err := transform.JSONToXML([]byte(`{"order": {
+		"@id": 7,
+		"item": ["apple", "pear"],
+		"note": {"@lang": "en", "#text": "ring <twice>"},
+		"express": true,
+		"gift": null
+	}}`), transform.XMLOptions{Namespace: "urn:orders"})
+	require.NoError(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<order xmlns="urn:orders" id="7"><item>apple</item><item>pear</item>`+
+		`<note lang="en">ring &lt;twice&gt;</note><express>true</express><gift></gift></order>`, string(body))
+
+	// Several keys and arrays at the top need a root element
+	body, err = transform.JSONToXML([]byte(`{"id": 1, "name": "Ada"}`), transform.XMLOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<root><id>1</id><name>Ada</name></root>`)
+	body, err = transform.JSONToXML([]byte(`[1, 2]`), transform.XMLOptions{RootElement: "ids"})
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<ids><item>1</item><item>2</item></ids>`)
+
+	_, err = transform.JSONToXML([]byte(`{"first name": "Ada"}`), transform.XMLOptions{})
+	assert.Error(t, err)
+	_, err = transform.JSONToXML([]byte(`{"user": {"@tags": ["a"]}}`), transform.XMLOptions{})
+	assert.Error(t, err)
+}
+
+func TestXMLConversionTransforms(t *testing.T) {
+	engine := transform.NewEngine(logrus.New())
+
+	// JSON clients of an XML service
+	request, err := transform.CompileRequest(&transform.RequestTransform{
+		Body:    `{"order":{"id":{{ .id }}}}`,
+		Convert: transform.ConvertJSONToXML,
+		XML:     transform.XMLOptions{ContentType: "text/xml"},
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":7}`))
+	req.Header.Set("Content-Type", "application/json")
+	require.NoError(t, engine.ApplyRequest(req, request))
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<order><id>7</id></order>`)
+	assert.Equal(t, "text/xml", req.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(body)), req.ContentLength)
+
+	response, err := transform.CompileResponse(&transform.ResponseTransform{Convert: transform.ConvertXMLToJSON})
+	require.NoError(t, err)
+	headers := http.Header{"Content-Type": {"text/xml; charset=utf-8"}, "Content-Length": {"42"}}
+	body, newHeaders, err := engine.ApplyResponse([]byte(`<order><id>7</id></order>`), http.StatusOK, headers, response)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order":{"id":"7"}}`, string(body))
+	assert.Equal(t, "application/json", newHeaders.Get("Content-Type"))
+	assert.Empty(t, newHeaders.Get("Content-Length"))
+
+	// Bodies of other types, e.g. error pages, are left alone
+	html := []byte(`<html><body>Bad gateway</body></html>`)
+	body, _, err = engine.ApplyResponse(html, http.StatusBadGateway, http.Header{"Content-Type": {"text/html"}}, response)
+	require.NoError(t, err)
+	assert.Equal(t, html, body)
+
+	_, err = transform.CompileResponse(&transform.ResponseTransform{Convert: "xml-to-yaml"})
+	assert.Error(t, err)
+}
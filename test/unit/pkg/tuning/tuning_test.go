@@ -0,0 +1,80 @@
+package tuning
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"odin/pkg/config"
+	"odin/pkg/tuning"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestDetectCgroupV2(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cpu.max"), "150000 100000\n")
+	writeFile(t, filepath.Join(root, "memory.max"), "536870912\n")
+
+	limits := tuning.Detect(root)
+	assert.Equal(t, 1.5, limits.CPU)
+	assert.Equal(t, int64(512<<20), limits.Memory)
+
+	writeFile(t, filepath.Join(root, "cpu.max"), "max 100000\n")
+	writeFile(t, filepath.Join(root, "memory.max"), "max\n")
+	assert.Equal(t, tuning.Limits{}, tuning.Detect(root))
+}
+
+func TestDetectCgroupV1(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cpu", "cpu.cfs_quota_us"), "200000\n")
+	writeFile(t, filepath.Join(root, "cpu", "cpu.cfs_period_us"), "100000\n")
+	writeFile(t, filepath.Join(root, "memory", "memory.limit_in_bytes"), "1073741824\n")
+
+	limits := tuning.Detect(root)
+	assert.Equal(t, 2.0, limits.CPU)
+	assert.Equal(t, int64(1<<30), limits.Memory)
+
+	// No quota and the "unlimited" memory value
+	writeFile(t, filepath.Join(root, "cpu", "cpu.cfs_quota_us"), "-1\n")
+	writeFile(t, filepath.Join(root, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	assert.Equal(t, tuning.Limits{}, tuning.Detect(root))
+}
+
+func TestDetectWithoutCgroups(t *testing.T) {
+	assert.Equal(t, tuning.Limits{}, tuning.Detect(t.TempDir()))
+}
+
+func TestMemoryLimitBytes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   bool
+	}{
+		{"", 0, false},
+		{"off", -1, false},
+		{"1536MiB", 1536 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{"4096", 4096, false},
+		{"10KB", 0, true},
+		{"-1MiB", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := config.RuntimeConfig{MemoryLimit: tt.value}.MemoryLimitBytes()
+		if tt.err {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
@@ -0,0 +1,121 @@
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"odin/pkg/upgrade"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// childModeEnv makes the re-executed test binary act as the new gateway
+// process instead of running the tests
+const childModeEnv = "UPGRADE_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(childModeEnv) {
+	case "serve":
+		runChild()
+		return
+	case "fail":
+		os.Exit(3)
+	}
+	os.Exit(m.Run())
+}
+
+// runChild serves on the inherited listener, tells the parent to drain and
+// exits after a while
+func runChild() {
+	u, err := upgrade.New(quietLogger())
+	if err != nil {
+		os.Exit(4)
+	}
+	l, err := u.Listen("http", "127.0.0.1:0")
+	if err != nil {
+		os.Exit(5)
+	}
+	go http.Serve(l, respond("child"))
+	if !u.HasParent() || u.Ready() != nil {
+		os.Exit(6)
+	}
+	time.Sleep(5 * time.Second)
+	os.Exit(0)
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	client := &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestListenWithoutParent(t *testing.T) {
+	u, err := upgrade.New(quietLogger())
+	require.NoError(t, err)
+	assert.False(t, u.HasParent())
+	assert.NoError(t, u.Ready())
+
+	l, err := u.Listen("http", "127.0.0.1:0")
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestUpgradeHandsOverListener(t *testing.T) {
+	u, err := upgrade.New(quietLogger())
+	require.NoError(t, err)
+	l, err := u.Listen("http", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{Handler: respond("parent")}
+	go server.Serve(l)
+	url := "http://" + l.Addr().String()
+	assert.Equal(t, "parent", get(t, url))
+
+	t.Setenv(childModeEnv, "serve")
+	process, err := u.Upgrade(10 * time.Second)
+	require.NoError(t, err)
+	defer process.Kill()
+
+	// The old process stops accepting; the socket stays open in the new one
+	require.NoError(t, server.Close())
+	assert.Equal(t, "child", get(t, url))
+}
+
+func TestFailedUpgradeKeepsServing(t *testing.T) {
+	u, err := upgrade.New(quietLogger())
+	require.NoError(t, err)
+	l, err := u.Listen("http", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{Handler: respond("parent")}
+	go server.Serve(l)
+	defer server.Close()
+
+	t.Setenv(childModeEnv, "fail")
+	_, err = u.Upgrade(10 * time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before becoming ready")
+
+	assert.Equal(t, "parent", get(t, "http://"+l.Addr().String()))
+}
@@ -0,0 +1,147 @@
+package versioning
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"odin/pkg/config"
+	"odin/pkg/versioning"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	deprecatedAt = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset       = time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+)
+
+func versions() []config.APIVersionConfig {
+	return []config.APIVersionConfig{
+		{Name: "v1", DeprecatedAt: deprecatedAt, Sunset: sunset, Link: "https://example.com/migrate"},
+		{Name: "v2", Targets: []string{"http://orders-v2:8080"}},
+		{Name: "v0", Deprecated: true, Sunset: time.Now().Add(-time.Hour)},
+	}
+}
+
+// newGateway serves the orders service behind the version router and
+// answers with the resolved version and the path left for the upstream
+func newGateway(cfg config.VersioningConfig) *echo.Echo {
+	if cfg.Header == "" {
+		cfg.Header = "X-API-Version"
+	}
+	cfg.Versions = versions()
+	e := echo.New()
+	group := e.Group("/api/orders")
+	group.Use(versioning.NewRouter("orders", "/api/orders", cfg).Middleware())
+	handler := func(c echo.Context) error {
+		version := c.Get(versioning.ContextKey).(*versioning.Version)
+		return c.JSON(http.StatusOK, map[string]string{"version": version.Name, "path": c.Request().URL.Path})
+	}
+	for _, path := range []string{"/items", "/v0/items", "/v1/items", "/v2/items", "/v9/items"} {
+		group.GET(path, handler)
+	}
+	return e
+}
+
+func call(e *echo.Echo, path string, header http.Header) (*httptest.ResponseRecorder, map[string]string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec, body
+}
+
+func TestPathVersioning(t *testing.T) {
+	e := newGateway(config.VersioningConfig{Strategy: "path", Default: "v2"})
+
+	rec, body := call(e, "/api/orders/v1/items", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v1", body["version"])
+	assert.Equal(t, "/api/orders/v1/items", body["path"])
+	assert.Equal(t, "v1", rec.Header().Get("X-API-Version"))
+	assert.Equal(t, "@1735689600", rec.Header().Get("Deprecation"))
+	assert.Equal(t, sunset.Format(http.TimeFormat), rec.Header().Get("Sunset"))
+	assert.Equal(t, []string{
+		`<https://example.com/migrate>; rel="deprecation"; type="text/html"`,
+		`<https://example.com/migrate>; rel="sunset"; type="text/html"`,
+	}, rec.Header().Values("Link"))
+
+	// Current versions carry no deprecation headers
+	rec, body = call(e, "/api/orders/v2/items", nil)
+	assert.Equal(t, "v2", body["version"])
+	assert.Empty(t, rec.Header().Get("Deprecation"))
+	assert.Empty(t, rec.Header().Get("Sunset"))
+	assert.Empty(t, rec.Header().Get("Link"))
+
+	// Paths without a version go to the default one
+	rec, body = call(e, "/api/orders/items", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v2", body["version"])
+
+	rec, _ = call(e, "/api/orders/v9/items", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Versions past their sunset are gone, but still say so
+	rec, _ = call(e, "/api/orders/v0/items", nil)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Deprecation"))
+	assert.NotEmpty(t, rec.Header().Get("Sunset"))
+}
+
+func TestPathVersioningStripsVersion(t *testing.T) {
+	e := newGateway(config.VersioningConfig{Strategy: "path", StripVersion: true})
+
+	_, body := call(e, "/api/orders/v2/items", nil)
+	assert.Equal(t, "v2", body["version"])
+	assert.Equal(t, "/api/orders/items", body["path"])
+
+	// Without a default, requests must name a version
+	rec, _ := call(e, "/api/orders/items", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHeaderVersioning(t *testing.T) {
+	e := newGateway(config.VersioningConfig{Strategy: "header", Header: "Api-Version", Default: "v2"})
+
+	rec, body := call(e, "/api/orders/items", http.Header{"Api-Version": {"1"}})
+	assert.Equal(t, "v1", body["version"])
+	assert.Equal(t, "v1", rec.Header().Get("Api-Version"))
+	assert.NotEmpty(t, rec.Header().Get("Deprecation"))
+
+	_, body = call(e, "/api/orders/items", http.Header{"Api-Version": {"V2"}})
+	assert.Equal(t, "v2", body["version"])
+
+	_, body = call(e, "/api/orders/items", nil)
+	assert.Equal(t, "v2", body["version"])
+
+	rec, _ = call(e, "/api/orders/items", http.Header{"Api-Version": {"v3"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestMediaTypeVersioning(t *testing.T) {
+	e := newGateway(config.VersioningConfig{Strategy: "mediaType", Default: "v2"})
+
+	for accept, want := range map[string]string{
+		"application/vnd.acme.v1+json":            "v1",
+		"application/json; version=1":             "v1",
+		"text/html, application/vnd.acme.v1+json": "v1",
+		"application/json":                        "v2",
+		"application/vnd.acme+json":               "v2",
+	} {
+		rec, body := call(e, "/api/orders/items", http.Header{"Accept": {accept}})
+		require.Equal(t, http.StatusOK, rec.Code, accept)
+		assert.Equal(t, want, body["version"], accept)
+	}
+
+	rec, _ := call(e, "/api/orders/items", http.Header{"Accept": {"application/json; version=7"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
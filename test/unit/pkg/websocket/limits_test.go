@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"testing"
+
+	"odin/pkg/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterGlobalLimit(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{MaxConnections: 2})
+
+	release1, err := limiter.Acquire("chat", websocket.Limits{}, "10.0.0.1")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("feed", websocket.Limits{}, "10.0.0.2")
+	require.NoError(t, err)
+
+	_, err = limiter.Acquire("chat", websocket.Limits{}, "10.0.0.3")
+	assert.ErrorIs(t, err, websocket.ErrTooManyConnections)
+
+	release1()
+	release1() // releasing twice frees the slot once
+	_, err = limiter.Acquire("chat", websocket.Limits{}, "10.0.0.3")
+	assert.NoError(t, err)
+	_, err = limiter.Acquire("chat", websocket.Limits{}, "10.0.0.4")
+	assert.ErrorIs(t, err, websocket.ErrTooManyConnections)
+}
+
+func TestLimiterServiceLimits(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{})
+	limits := websocket.Limits{MaxConnections: 3, MaxConnectionsPerIP: 1}
+
+	_, err := limiter.Acquire("chat", limits, "10.0.0.1")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("chat", limits, "10.0.0.1")
+	assert.ErrorIs(t, err, websocket.ErrTooManyConnectionsFromIP)
+
+	// Other services keep their own counts
+	_, err = limiter.Acquire("feed", limits, "10.0.0.1")
+	assert.NoError(t, err)
+
+	_, err = limiter.Acquire("chat", limits, "10.0.0.2")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("chat", limits, "10.0.0.3")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("chat", limits, "10.0.0.4")
+	assert.ErrorIs(t, err, websocket.ErrTooManyConnections)
+}
+
+func TestLimiterGlobalPerIPLimit(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{MaxConnectionsPerIP: 2})
+
+	_, err := limiter.Acquire("chat", websocket.Limits{}, "10.0.0.1")
+	require.NoError(t, err)
+	release, err := limiter.Acquire("feed", websocket.Limits{}, "10.0.0.1")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("alerts", websocket.Limits{}, "10.0.0.1")
+	assert.ErrorIs(t, err, websocket.ErrTooManyConnectionsFromIP)
+
+	release()
+	_, err = limiter.Acquire("alerts", websocket.Limits{}, "10.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestLimiterStats(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{MaxConnections: 1})
+
+	release, err := limiter.Acquire("chat", websocket.Limits{}, "10.0.0.1")
+	require.NoError(t, err)
+	_, err = limiter.Acquire("chat", websocket.Limits{}, "10.0.0.2")
+	require.Error(t, err)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 1, stats.Active)
+	assert.Equal(t, websocket.ServiceStats{Active: 1, Accepted: 1, Rejected: 1}, stats.Services["chat"])
+
+	release()
+	assert.Equal(t, 0, limiter.Stats().Active)
+	assert.Equal(t, 0, limiter.Stats().Services["chat"].Active)
+}
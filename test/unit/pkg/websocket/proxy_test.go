@@ -3,14 +3,17 @@ package websocket
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"odin/pkg/websocket"
 
+	gws "github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func isWebSocketUpgrade(r *http.Request) bool {
@@ -144,3 +147,127 @@ func TestConnectionClose(t *testing.T) {
 	assert.Equal(t, 1*time.Second, config.ReadTimeout)
 	assert.Equal(t, 1*time.Second, config.WriteTimeout)
 }
+
+// newEchoBackend starts a WebSocket server that echoes every message
+func newEchoBackend(t *testing.T) *httptest.Server {
+	upgrader := gws.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newGateway serves proxy in front of backend and returns its WebSocket URL
+func newGateway(t *testing.T, proxy *websocket.Proxy, backend *httptest.Server) string {
+	e := echo.New()
+	e.GET("/ws", func(c echo.Context) error {
+		return proxy.ProxyWebSocket(c, backend.URL)
+	})
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func dial(t *testing.T, url string) *gws.Conn {
+	t.Helper()
+	conn, _, err := gws.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestProxyForwardsMessages(t *testing.T) {
+	proxy := websocket.NewProxy(websocket.Config{}, logrus.New())
+	conn := dial(t, newGateway(t, proxy, newEchoBackend(t)))
+
+	require.NoError(t, conn.WriteMessage(gws.TextMessage, []byte("hello")))
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, gws.TextMessage, messageType)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestProxyConnectionLimits(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{MaxConnectionsPerIP: 1})
+	proxy := websocket.NewProxy(websocket.Config{}, logrus.New())
+	proxy.SetLimiter(limiter, "chat", websocket.Limits{})
+	url := newGateway(t, proxy, newEchoBackend(t))
+
+	conn := dial(t, url)
+	_, resp, err := gws.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Closing the first connection frees its slot
+	conn.Close()
+	require.Eventually(t, func() bool { return limiter.Stats().Active == 0 }, time.Second, 5*time.Millisecond)
+	dial(t, url)
+
+	stats := limiter.Stats().Services["chat"]
+	assert.Equal(t, uint64(2), stats.Accepted)
+	assert.Equal(t, uint64(1), stats.Rejected)
+}
+
+func TestProxyServiceConnectionLimit(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{})
+	proxy := websocket.NewProxy(websocket.Config{}, logrus.New())
+	proxy.SetLimiter(limiter, "chat", websocket.Limits{MaxConnections: 1})
+	url := newGateway(t, proxy, newEchoBackend(t))
+
+	dial(t, url)
+	_, resp, err := gws.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestProxyClosesIdleConnections(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{})
+	proxy := websocket.NewProxy(websocket.Config{IdleTimeout: 50 * time.Millisecond}, logrus.New())
+	proxy.SetLimiter(limiter, "chat", websocket.Limits{})
+	conn := dial(t, newGateway(t, proxy, newEchoBackend(t)))
+
+	// Traffic keeps the connection open past the timeout
+	for i := 0; i < 3; i++ {
+		require.NoError(t, conn.WriteMessage(gws.TextMessage, []byte("ping")))
+		_, _, err := conn.ReadMessage()
+		require.NoError(t, err)
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *gws.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, gws.CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "idle timeout", closeErr.Text)
+	assert.Equal(t, uint64(1), limiter.Stats().Services["chat"].IdleClosed)
+}
+
+func TestProxyRejectsOversizedMessages(t *testing.T) {
+	limiter := websocket.NewLimiter(websocket.Limits{})
+	proxy := websocket.NewProxy(websocket.Config{MaxMessageSize: 16}, logrus.New())
+	proxy.SetLimiter(limiter, "chat", websocket.Limits{})
+	conn := dial(t, newGateway(t, proxy, newEchoBackend(t)))
+
+	require.NoError(t, conn.WriteMessage(gws.BinaryMessage, make([]byte, 32)))
+	_, _, err := conn.ReadMessage()
+	var closeErr *gws.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, gws.CloseMessageTooBig, closeErr.Code)
+	require.Eventually(t, func() bool {
+		return limiter.Stats().Services["chat"].OversizeClosed == 1
+	}, time.Second, 5*time.Millisecond)
+}